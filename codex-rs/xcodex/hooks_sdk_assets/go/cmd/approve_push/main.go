@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/ntfy"
+)
+
+// Decisions for on_timeout.
+const (
+	decisionAsk   = "ask"
+	decisionAllow = "allow"
+	decisionDeny  = "deny"
+)
+
+// config is read from `$CODEX_HOME/hooks/config/approve_push.toml`; CODEX_HOOK_APPROVE_PUSH_<KEY>
+// variables (CODEX_HOOK_APPROVE_PUSH_TOPIC, ...) override it.
+type config struct {
+	// Server is the ntfy server.
+	Server string `toml:"server" default:"https://ntfy.sh"`
+	// Topic receives the requests. Anyone who knows it can read them and answer, so on a public
+	// server pick a long random name, or use a token.
+	Topic string `toml:"topic"`
+	// ReplyTopic is where the answers are posted, by default Topic.
+	ReplyTopic string `toml:"reply_topic"`
+	// Token is an ntfy access token, for servers with access control.
+	Token string `toml:"token"`
+	// Timeout is how long to wait for an answer (it is also kept below CODEX_HOOK_TIMEOUT_MS).
+	Timeout time.Duration `toml:"timeout" default:"5m"`
+	// OnTimeout is the decision without an answer: ask (fall back to the prompt in the terminal),
+	// allow, or deny.
+	OnTimeout string `toml:"on_timeout" default:"ask"`
+	// Priority of the notification, 1 to 5.
+	Priority int `toml:"priority" default:"4"`
+}
+
+func (c *config) Validate() error {
+	if c.Topic == "" {
+		return errors.New("topic must be set")
+	}
+	switch c.OnTimeout {
+	case decisionAsk, decisionAllow, decisionDeny:
+	default:
+		return fmt.Errorf("on_timeout must be %s, %s, or %s, not %q", decisionAsk, decisionAllow, decisionDeny, c.OnTimeout)
+	}
+	if c.Timeout <= 0 {
+		return errors.New("timeout must be positive")
+	}
+	if c.Priority < 1 || c.Priority > 5 {
+		return errors.New("priority must be between 1 and 5")
+	}
+	if c.ReplyTopic == "" {
+		c.ReplyTopic = c.Topic
+	}
+	return nil
+}
+
+func main() {
+	var cfg config
+	cfgErr := hooksdk.LoadConfig("approve_push", &cfg)
+	// RunWithTimeout writes the on_timeout decision when no answer has come within the timeout,
+	// before the host gives up on the hook.
+	hooksdk.RunWithTimeout(cfg.Timeout, func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return handle(ctx, p, &cfg, cfgErr)
+	}, timedOut(&cfg), hooksdk.WithSelfTest(func() []hooksdk.Check {
+		return []hooksdk.Check{
+			hooksdk.CheckConfig("approve_push", cfgErr),
+			hooksdk.CheckHTTP("ntfy server", cfg.Server),
+		}
+	}))
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload, cfg *config, cfgErr error) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	if payload.EventType() != "approval-requested" {
+		return hooksdk.Allow(), nil
+	}
+	if cfgErr != nil {
+		hooklog.Errorf("load config: %v", cfgErr)
+		return hooksdk.Ask("approve_push is not configured; approve in the terminal"), nil
+	}
+	client := &ntfy.Client{Server: cfg.Server, Token: cfg.Token}
+
+	id, err := requestID()
+	if err != nil {
+		hooklog.Errorf("request ID: %v", err)
+		return hooksdk.Ask("approve_push failed; approve in the terminal"), nil
+	}
+	sent, err := client.Publish(ctx, request(client, cfg, payload, id))
+	if err != nil {
+		hooklog.Errorf("publish to %s: %v", cfg.Topic, err)
+		return hooksdk.Ask("approve_push couldn't reach ntfy; approve in the terminal"), nil
+	}
+	hooklog.Infof("waiting up to %v for `approve %s` or `deny %s` on %s", cfg.Timeout, id, id, cfg.ReplyTopic)
+
+	// Only answers posted after the request, naming its ID, count: a late answer to an earlier
+	// request can't decide this one.
+	since := sent.ID
+	if cfg.ReplyTopic != cfg.Topic {
+		since = fmt.Sprint(sent.Time)
+	}
+	decision := ""
+	err = client.Subscribe(ctx, cfg.ReplyTopic, since, func(m ntfy.Event) bool {
+		d, replyID, ok := parseReply(m.Message)
+		switch {
+		case !ok:
+			return false
+		case replyID != id:
+			hooklog.Debugf("ignoring %q: not an answer to request %s", m.Message, id)
+			return false
+		}
+		decision = d
+		return true
+	})
+	switch {
+	case decision == decisionAllow:
+		hooklog.Infof("approved from ntfy")
+		resp := hooksdk.Allow()
+		resp.SystemMessage = "Approved from ntfy"
+		return resp, nil
+	case decision == decisionDeny:
+		hooklog.Infof("denied from ntfy")
+		resp := hooksdk.Deny("denied from ntfy")
+		resp.ReasonCode = "APPROVE_PUSH_DENIED"
+		return resp, nil
+	case err != nil && ctx.Err() == nil:
+		hooklog.Errorf("read answers from %s: %v", cfg.ReplyTopic, err)
+		return hooksdk.Ask("approve_push couldn't read the answer; approve in the terminal"), nil
+	}
+	return timedOut(cfg), nil
+}
+
+// timedOut is the on_timeout response.
+func timedOut(cfg *config) hooksdk.Response {
+	reason := fmt.Sprintf("no answer from ntfy within %v", cfg.Timeout)
+	var resp hooksdk.Response
+	switch cfg.OnTimeout {
+	case decisionAllow:
+		resp = hooksdk.Allow()
+		resp.SystemMessage = "Approved: " + reason
+	case decisionDeny:
+		resp = hooksdk.Deny(reason)
+	default:
+		resp = hooksdk.Ask(reason + "; approve in the terminal")
+	}
+	resp.ReasonCode = "APPROVE_PUSH_TIMEOUT"
+	return resp
+}
+
+// requestID returns a short random ID, which answers must repeat.
+func requestID() (string, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// request is the notification: what is to be approved, with Approve and Deny buttons that post
+// the answer to the reply topic, and the answers to type for clients without buttons.
+func request(client *ntfy.Client, cfg *config, p *hooksdk.HookPayload, id string) ntfy.Message {
+	var header map[string]string
+	if cfg.Token != "" {
+		header = map[string]string{"Authorization": "Bearer " + cfg.Token}
+	}
+	button := func(label, answer string) ntfy.Action {
+		return ntfy.Action{Label: label, URL: client.TopicURL(cfg.ReplyTopic), Body: answer + " " + id, Header: header, Clear: true}
+	}
+	title := "xcodex: approval needed"
+	if cwd := p.WorkingDir(); cwd != "" {
+		title += " in " + filepath.Base(cwd)
+	}
+	return ntfy.Message{
+		Topic:    cfg.Topic,
+		Title:    title,
+		Message:  summary(p) + fmt.Sprintf("\n\nAnswer `approve %s` or `deny %s`.", id, id),
+		Tags:     []string{"question"},
+		Priority: cfg.Priority,
+		Actions:  []ntfy.Action{button("Approve", "approve"), button("Deny", "deny")},
+	}
+}
+
+// summary describes the action: the tool and command, and the reason the agent gave.
+func summary(p *hooksdk.HookPayload) string {
+	var lines []string
+	if p.ToolName != nil && *p.ToolName != "" {
+		lines = append(lines, *p.ToolName)
+	}
+	if len(p.Command) > 0 {
+		lines = append(lines, "$ "+excerpt(strings.Join(p.Command, " "), 1000))
+	}
+	if p.Reason != nil && *p.Reason != "" {
+		lines = append(lines, excerpt(*p.Reason, 500))
+	}
+	if len(lines) == 0 {
+		return "The agent is waiting for an approval."
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseReply reads an answer, `approve <id>` or `deny <id>` (also allow/yes and no/reject, in any
+// case).
+func parseReply(text string) (decision, id string, ok bool) {
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	switch fields[0] {
+	case "approve", "allow", "yes":
+		return decisionAllow, fields[1], true
+	case "deny", "no", "reject":
+		return decisionDeny, fields[1], true
+	}
+	return "", "", false
+}
+
+// excerpt shortens s to at most max runes, ending with "…" when it was cut.
+func excerpt(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	r := []rune(s)
+	return strings.TrimSpace(string(r[:max-1])) + "…"
+}
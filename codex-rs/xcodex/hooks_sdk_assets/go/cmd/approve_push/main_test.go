@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/ntfy"
+	"example.com/xcodex/hooks-sdk/hooksdk/ntfy/ntfytest"
+)
+
+// load reads the config for srv, with the given CODEX_HOOK_APPROVE_PUSH_<KEY>=value overrides.
+func load(t *testing.T, srv *ntfytest.Server, env ...string) *config {
+	t.Helper()
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_APPROVE_PUSH_SERVER", srv.URL)
+	t.Setenv("CODEX_HOOK_APPROVE_PUSH_TOPIC", "requests")
+	for _, key := range []string{"REPLY_TOPIC", "TOKEN", "TIMEOUT", "ON_TIMEOUT", "PRIORITY"} {
+		t.Setenv("CODEX_HOOK_APPROVE_PUSH_"+key, "")
+	}
+	t.Setenv("CODEX_HOOK_APPROVE_PUSH_TIMEOUT", "10s")
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv("CODEX_HOOK_APPROVE_PUSH_"+k, v)
+	}
+	var cfg config
+	if err := hooksdk.LoadConfig("approve_push", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return &cfg
+}
+
+// press taps the button of m labelled label, as the ntfy app does: it sends the action's request.
+func press(t *testing.T, m ntfy.Message, label string) {
+	for _, a := range m.Actions {
+		if a.Label != label {
+			continue
+		}
+		req, _ := http.NewRequest(http.MethodPost, a.URL, strings.NewReader(a.Body))
+		for k, v := range a.Header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s button: %s", label, resp.Status)
+		}
+		return
+	}
+	t.Errorf("no %s button in %+v", label, m.Actions)
+}
+
+// requestOf returns the ID an answer to m must name, from its Approve button.
+func requestOf(m ntfy.Message) string {
+	_, id, _ := strings.Cut(m.Actions[0].Body, " ")
+	return id
+}
+
+func run(t *testing.T, cfg *config, timeout time.Duration) hooksdk.Response {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resp, err := handle(ctx, hooktest.ApprovalRequested().WithCwd("/src/app").Build(), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func checkProblems(t *testing.T, srv *ntfytest.Server) {
+	t.Helper()
+	for _, p := range srv.Problems() {
+		t.Error(p)
+	}
+}
+
+func TestApprove(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{
+		OnPublish: func(srv *ntfytest.Server, m ntfy.Message) { press(t, m, "Approve") },
+	})
+	resp := run(t, load(t, srv), 10*time.Second)
+	if resp.Decision != hooksdk.DecisionAllow || resp.SystemMessage != "Approved from ntfy" {
+		t.Errorf("handle = %+v", resp)
+	}
+
+	published := srv.Published()
+	if len(published) != 1 {
+		t.Fatalf("published %+v", published)
+	}
+	m := published[0]
+	id := requestOf(m)
+	if m.Topic != "requests" || m.Title != "xcodex: approval needed in app" || m.Priority != 4 {
+		t.Errorf("request = %+v", m)
+	}
+	if want := "Bash\n$ curl https://example.com\nneeds network access\n\nAnswer `approve " + id + "` or `deny " + id + "`."; m.Message != want {
+		t.Errorf("request message = %q, want %q", m.Message, want)
+	}
+	if len(m.Actions) != 2 || m.Actions[1].Body != "deny "+id || m.Actions[0].URL != srv.URL+"/requests" || !m.Actions[0].Clear {
+		t.Errorf("request actions = %+v", m.Actions)
+	}
+	checkProblems(t, srv)
+}
+
+func TestDeny(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{
+		OnPublish: func(srv *ntfytest.Server, m ntfy.Message) {
+			// Answered a moment later, while the hook is waiting on the stream.
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				press(t, m, "Deny")
+			}()
+		},
+	})
+	resp := run(t, load(t, srv), 10*time.Second)
+	if resp.Decision != hooksdk.DecisionDeny || resp.ReasonCode != "APPROVE_PUSH_DENIED" {
+		t.Errorf("handle = %+v", resp)
+	}
+	checkProblems(t, srv)
+}
+
+// TestTypedAnswers answers by typing in the topic, in a reply topic of its own, on a server that
+// needs a token.
+func TestTypedAnswers(t *testing.T) {
+	for answer, want := range map[string]hooksdk.Decision{
+		"YES %s":       hooksdk.DecisionAllow,
+		"  allow %s ":  hooksdk.DecisionAllow,
+		"reject %s":    hooksdk.DecisionDeny,
+		"No %s":        hooksdk.DecisionDeny,
+		"approve %s x": hooksdk.DecisionAsk,
+	} {
+		answer := answer
+		srv := ntfytest.NewServer(t, ntfytest.Options{
+			Token: "tk",
+			OnPublish: func(srv *ntfytest.Server, m ntfy.Message) {
+				srv.Post("answers", strings.ReplaceAll(answer, "%s", requestOf(m)))
+			},
+		})
+		cfg := load(t, srv, "REPLY_TOPIC=answers", "TOKEN=tk", "TIMEOUT=300ms")
+		resp := run(t, cfg, 300*time.Millisecond)
+		if resp.Decision != want {
+			t.Errorf("%q: handle = %+v, want %s", answer, resp, want)
+		}
+		m := srv.Published()[0]
+		if m.Actions[0].URL != srv.URL+"/answers" || m.Actions[0].Header["Authorization"] != "Bearer tk" {
+			t.Errorf("%q: actions = %+v", answer, m.Actions)
+		}
+		checkProblems(t, srv)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	for onTimeout, want := range map[string]hooksdk.Decision{
+		"ask":   hooksdk.DecisionAsk,
+		"allow": hooksdk.DecisionAllow,
+		"deny":  hooksdk.DecisionDeny,
+	} {
+		srv := ntfytest.NewServer(t, ntfytest.Options{})
+		cfg := load(t, srv, "ON_TIMEOUT="+onTimeout, "TIMEOUT=300ms")
+		start := time.Now()
+		resp := run(t, cfg, 300*time.Millisecond)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: handle took %v", onTimeout, elapsed)
+		}
+		if resp.Decision != want || resp.ReasonCode != "APPROVE_PUSH_TIMEOUT" {
+			t.Errorf("%s: handle = %+v", onTimeout, resp)
+		}
+	}
+}
+
+// TestStaleReply checks that answers to an earlier request, or naming no request, don't decide
+// the current one.
+func TestStaleReply(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{
+		OnPublish: func(srv *ntfytest.Server, m ntfy.Message) {
+			published := srv.Published()
+			if len(published) == 1 {
+				return
+			}
+			srv.Post("requests", "approve "+requestOf(published[0]))
+			srv.Post("requests", "approve")
+			srv.Post("requests", "approve deadbeef")
+		},
+	})
+	cfg := load(t, srv, "ON_TIMEOUT=deny", "TIMEOUT=300ms")
+	if resp := run(t, cfg, 300*time.Millisecond); resp.Decision != hooksdk.DecisionDeny {
+		t.Fatalf("unanswered request: %+v", resp)
+	}
+	// An approval of the earlier request, posted before the new one, is in the topic's cache too.
+	srv.Post("requests", "approve "+requestOf(srv.Published()[0]))
+	if resp := run(t, cfg, 300*time.Millisecond); resp.Decision != hooksdk.DecisionDeny || resp.ReasonCode != "APPROVE_PUSH_TIMEOUT" {
+		t.Errorf("request answered only with stale replies: %+v", resp)
+	}
+	checkProblems(t, srv)
+}
+
+func TestFailures(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{})
+	cfg := load(t, srv)
+	srv.Fail(http.StatusInternalServerError)
+	if resp := run(t, cfg, 10*time.Second); resp.Decision != hooksdk.DecisionAsk || !strings.Contains(resp.Prompt, "couldn't reach ntfy") {
+		t.Errorf("publish failed: %+v", resp)
+	}
+
+	srv = ntfytest.NewServer(t, ntfytest.Options{
+		OnPublish: func(srv *ntfytest.Server, m ntfy.Message) { srv.Fail(http.StatusForbidden) },
+	})
+	cfg = load(t, srv)
+	if resp := run(t, cfg, 10*time.Second); resp.Decision != hooksdk.DecisionAsk || !strings.Contains(resp.Prompt, "couldn't read the answer") {
+		t.Errorf("subscribe failed: %+v", resp)
+	}
+
+	resp, err := handle(context.Background(), hooktest.ApprovalRequested().Build(), &config{}, errors.New("topic must be set"))
+	if err != nil || resp.Decision != hooksdk.DecisionAsk || !strings.Contains(resp.Prompt, "not configured") {
+		t.Errorf("without a config: %+v, %v", resp, err)
+	}
+
+	// Other events go through without a notification.
+	srv = ntfytest.NewServer(t, ntfytest.Options{})
+	cfg = load(t, srv)
+	if resp, _ := handle(context.Background(), hooktest.ToolCallStarted().Build(), cfg, nil); resp.Decision != hooksdk.DecisionAllow || len(srv.Published()) != 0 {
+		t.Errorf("tool-call-started: %+v, published %d", resp, len(srv.Published()))
+	}
+}
+
+// TestHostDeadline runs the hook the way main does, with a host timeout far shorter than its own:
+// it gives the on_timeout answer before the host gives up.
+func TestHostDeadline(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{})
+	cfg := load(t, srv, "ON_TIMEOUT=deny", "TIMEOUT=5m")
+	t.Setenv(hooksdk.TimeoutEnv, "500")
+	handler := func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return handle(ctx, p, cfg, nil)
+	}
+	start := time.Now()
+	res := hooktest.RunHook(t, handler, hooktest.ApprovalRequested().Bytes(), hooksdk.WithTimeout(cfg.Timeout, timedOut(cfg)))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hook took %v with a 500ms host timeout", elapsed)
+	}
+	if res.ExitCode != hooksdk.ExitDeny || res.Response.ReasonCode != "APPROVE_PUSH_TIMEOUT" {
+		t.Errorf("hook = exit %d, %+v", res.ExitCode, res.Response)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{})
+	if cfg := load(t, srv); cfg.ReplyTopic != "requests" || cfg.OnTimeout != decisionAsk {
+		t.Errorf("defaults = %+v", cfg)
+	}
+	for name, c := range map[string]config{
+		"topic":      {OnTimeout: decisionAsk, Timeout: time.Minute, Priority: 3},
+		"on_timeout": {Topic: "t", OnTimeout: "maybe", Timeout: time.Minute, Priority: 3},
+		"timeout":    {Topic: "t", OnTimeout: decisionAsk, Priority: 3},
+		"priority":   {Topic: "t", OnTimeout: decisionAsk, Timeout: time.Minute, Priority: 6},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	for text, want := range map[string][2]string{
+		"approve ab12":  {decisionAllow, "ab12"},
+		"Yes AB12":      {decisionAllow, "ab12"},
+		"deny ab12\n":   {decisionDeny, "ab12"},
+		"no ab12":       {decisionDeny, "ab12"},
+		"approve":       {},
+		"maybe ab12":    {},
+		"approve a b":   {},
+		"":              {},
+		"ok, deny ab12": {},
+	} {
+		decision, id, ok := parseReply(text)
+		if decision != want[0] || id != want[1] || ok != (want[0] != "") {
+			t.Errorf("parseReply(%q) = %q, %q, %v; want %q", text, decision, id, ok, want)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	long := strings.Repeat("é", 1200)
+	p := hooktest.ApprovalRequested().With("command", []string{"echo", long}).With("reason", "").Build()
+	s := summary(p)
+	if !strings.HasPrefix(s, "Bash\n$ echo éé") || !strings.HasSuffix(s, "…") || len([]rune(s)) != len("Bash\n$ ")+1000 {
+		t.Errorf("summary of a long command = %d runes: %.40q…", len([]rune(s)), s)
+	}
+	bare := hooktest.New("approval-requested", "PermissionRequest").Build()
+	if s := summary(bare); s != "The agent is waiting for an approval." {
+		t.Errorf("summary without details = %q", s)
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/s3"
+)
+
+const (
+	// uploadArg runs the binary as the uploader, which archives every rotated file not uploaded
+	// yet. The hook starts it in the background; it can also be run by hand.
+	uploadArg = "--upload"
+
+	// lockName keeps uploaders from running at once; lockWait is how long a new one waits for a
+	// running one before leaving the work to it.
+	lockName = "archive_s3"
+	lockWait = time.Second
+)
+
+// config is read from `$CODEX_HOME/hooks/config/archive_s3.toml`; CODEX_HOOK_ARCHIVE_S3_<KEY>
+// variables (CODEX_HOOK_ARCHIVE_S3_SECRET_ACCESS_KEY, ...) override it.
+type config struct {
+	// Endpoint is the store's URL; "" is AWS S3 in Region.
+	Endpoint string `toml:"endpoint"`
+	Region   string `toml:"region" default:"us-east-1"`
+	Bucket   string `toml:"bucket"`
+	// Prefix starts every object key: `<prefix><host>/<log name>-<time>-<hash>.jsonl[.gz]`.
+	Prefix string `toml:"prefix" default:"xcodex/"`
+	// PathStyle puts the bucket in the URL's path, as MinIO and most other S3-compatible stores
+	// need.
+	PathStyle bool `toml:"path_style"`
+	// The credentials default to AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN.
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	SessionToken    string `toml:"session_token"`
+	// Concurrency is the number of files uploaded at once.
+	Concurrency int `toml:"concurrency" default:"2"`
+	// DeleteAfterUpload deletes each rotated file once the store holds a verified copy.
+	DeleteAfterUpload bool `toml:"delete_after_upload"`
+	// Events and Exclude pick the event types that start an upload (`*` suffix wildcards).
+	Events  []string `toml:"events" default:"session-end"`
+	Exclude []string `toml:"exclude"`
+	// OnRotation also starts an upload on any other event once a rotated file is waiting.
+	OnRotation bool `toml:"on_rotation" default:"true"`
+	// Log is the log whose rotated files are archived; "" is `$CODEX_HOME/hooks.jsonl`.
+	Log string `toml:"log"`
+	// Timeout bounds the upload of one file, retries included.
+	Timeout time.Duration `toml:"timeout" default:"5m"`
+}
+
+func (c *config) Validate() error {
+	if c.Bucket == "" {
+		return errors.New("bucket not set")
+	}
+	if c.Endpoint != "" {
+		if u, err := url.Parse(c.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("endpoint %q isn't an http(s) URL", c.Endpoint)
+		}
+	}
+	if c.Concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == uploadArg {
+		if !upload() {
+			os.Exit(1)
+		}
+		return
+	}
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `archive_s3 --self-test`, that the config and credentials are set, the
+// store answers, and the upload state can be saved.
+func selfTest() []hooksdk.Check {
+	cfg, err := loadConfig()
+	checks := []hooksdk.Check{
+		hooksdk.CheckConfig("archive_s3", err),
+		hooksdk.CheckWritable("upload state", statePath()),
+	}
+	if err != nil {
+		return checks
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	return append(checks, hooksdk.CheckHTTP("object store", endpoint))
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		hooklog.Errorf("load config: %v; nothing archived", err)
+		return hooksdk.Allow(), nil
+	}
+	filter := hooksdk.ParseFilter(strings.Join(cfg.Events, ","), strings.Join(cfg.Exclude, ","))
+	if !filter.MatchPayload(payload) && !cfg.OnRotation {
+		return hooksdk.Allow(), nil
+	}
+	// Most events find nothing to do, which takes a directory listing and the state file; only
+	// then is the uploader started, in the background so the session isn't held up.
+	files := pending(cfg, loadState())
+	if len(files) == 0 {
+		return hooksdk.Allow(), nil
+	}
+	hooklog.Debugf("%d rotated file(s) to archive", len(files))
+	if err := startUploader(); err != nil {
+		hooklog.Errorf("start uploader: %v", err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+func loadConfig() (*config, error) {
+	var cfg config
+	if err := hooksdk.LoadConfig("archive_s3", &cfg); err != nil {
+		return nil, err
+	}
+	for _, f := range []struct {
+		value *string
+		env   string
+	}{
+		{&cfg.AccessKeyID, "AWS_ACCESS_KEY_ID"},
+		{&cfg.SecretAccessKey, "AWS_SECRET_ACCESS_KEY"},
+		{&cfg.SessionToken, "AWS_SESSION_TOKEN"},
+	} {
+		if *f.value == "" {
+			*f.value = os.Getenv(f.env)
+		}
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("access_key_id and secret_access_key not set (nor AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+	if cfg.Log == "" {
+		cfg.Log = hooksdk.Environ().Path("hooks.jsonl")
+	}
+	return &cfg, nil
+}
+
+// startUploader starts this binary in upload mode, detached from the hook's stdio.
+func startUploader() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, uploadArg)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// state records the rotated files already uploaded, so they aren't uploaded again while they
+// stay on disk (without delete_after_upload). Files are keyed by fingerprint, which survives the
+// renames of later rotations.
+type state struct {
+	Uploaded map[string]archived `json:"uploaded"`
+}
+
+// archived is where a file went.
+type archived struct {
+	Key  string    `json:"key"`
+	ETag string    `json:"etag"`
+	At   time.Time `json:"at"`
+}
+
+func statePath() string {
+	return hooksdk.Environ().Path("hooks", "state", "archive_s3.json")
+}
+
+// loadState reads the state; a missing or unreadable file is an empty state, at worst uploading
+// files again.
+func loadState() *state {
+	st := &state{Uploaded: map[string]archived{}}
+	data, err := os.ReadFile(statePath())
+	if err != nil {
+		return st
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		hooklog.Warnf("ignoring %s: %v", statePath(), err)
+	}
+	if st.Uploaded == nil {
+		st.Uploaded = map[string]archived{}
+	}
+	return st
+}
+
+// save writes the state, keeping only the files still on disk. Only the uploader, holding the
+// lock, writes it; the temp file and rename keep hooks from reading it half-written.
+func (st *state) save(onDisk map[string]bool) error {
+	for fp := range st.Uploaded {
+		if !onDisk[fp] {
+			delete(st.Uploaded, fp)
+		}
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := statePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// fingerprint identifies a rotated file by its size and modification time, which rotation's
+// renames keep.
+func fingerprint(info os.FileInfo) string {
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// rotated returns the log's rotated files, oldest first, with their fingerprints. With
+// CODEX_HOOKLOG_COMPRESS set, uncompressed generations are left out: they are about to be
+// replaced by their .gz.
+func rotated(cfg *config) ([]string, map[string]bool) {
+	opts := jsonl.OptionsFromEnv()
+	var files []string
+	fps := map[string]bool{}
+	for _, path := range jsonl.Files(cfg.Log) {
+		if path == cfg.Log || path == cfg.Log+".gz" {
+			continue
+		}
+		if opts.Compress && !strings.HasSuffix(path, ".gz") {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		files = append(files, path)
+		fps[fingerprint(info)] = true
+	}
+	return files, fps
+}
+
+// pending returns the rotated files still to archive: those not uploaded yet, and with
+// delete_after_upload those uploaded but not yet deleted.
+func pending(cfg *config, st *state) []string {
+	files, _ := rotated(cfg)
+	var out []string
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if _, done := st.Uploaded[fingerprint(info)]; done && !cfg.DeleteAfterUpload {
+			continue
+		}
+		out = append(out, path)
+	}
+	return out
+}
+
+// upload archives rotated files until none are left, reporting whether all went well.
+func upload() bool {
+	cfg, err := loadConfig()
+	if err != nil {
+		hooklog.Errorf("load config: %v; nothing archived", err)
+		return false
+	}
+	ctx, stop := hooksdk.SignalContext()
+	defer stop()
+
+	ok := true
+	err = hooksdk.WithLock(lockName, lockWait, func() error {
+		u := newUploader(cfg)
+		// Rotations during an upload add files, so look again until a pass finds nothing (or
+		// only what the last one couldn't get rid of).
+		var last []string
+		for ctx.Err() == nil {
+			files := pending(cfg, u.state)
+			if len(files) == 0 || slices.Equal(files, last) {
+				return nil
+			}
+			if !u.run(ctx, files) {
+				ok = false
+				return nil
+			}
+			last = files
+		}
+		return ctx.Err()
+	})
+	if errors.Is(err, hooksdk.ErrLockTimeout) {
+		hooklog.Debugf("another uploader is running; leaving the files to it")
+		return true
+	}
+	if err != nil {
+		hooklog.Errorf("archive: %v", err)
+		return false
+	}
+	return ok
+}
+
+type uploader struct {
+	cfg    *config
+	client *s3.Client
+	log    *jsonl.Writer
+	host   string
+
+	mu    sync.Mutex
+	state *state
+}
+
+func newUploader(cfg *config) *uploader {
+	host, _ := os.Hostname()
+	host, ok := jsonl.SafeName(host)
+	if !ok {
+		host = "unknown-host"
+	}
+	return &uploader{
+		cfg: cfg,
+		client: &s3.Client{
+			Endpoint:  cfg.Endpoint,
+			Region:    cfg.Region,
+			Bucket:    cfg.Bucket,
+			PathStyle: cfg.PathStyle,
+			Credentials: s3.Credentials{
+				AccessKeyID:     cfg.AccessKeyID,
+				SecretAccessKey: cfg.SecretAccessKey,
+				SessionToken:    cfg.SessionToken,
+			},
+			Timeout: cfg.Timeout,
+			OnRetry: func(attempt int, err error, wait time.Duration) {
+				hooklog.Warnf("upload attempt %d failed: %v; retrying in %v", attempt, err, wait.Round(time.Millisecond))
+			},
+		},
+		log:   jsonl.New(cfg.Log, jsonl.OptionsFromEnv()),
+		host:  host,
+		state: loadState(),
+	}
+}
+
+// run archives files, cfg.Concurrency at a time, reporting whether all of them were.
+func (u *uploader) run(ctx context.Context, files []string) bool {
+	work := make(chan string)
+	var wg sync.WaitGroup
+	var failed atomic.Bool
+	for i := 0; i < min(u.cfg.Concurrency, len(files)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range work {
+				if err := u.archive(ctx, path); err != nil {
+					hooklog.Errorf("archive %s: %v", path, err)
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for _, path := range files {
+		work <- path
+	}
+	close(work)
+	wg.Wait()
+	return !failed.Load()
+}
+
+// archive uploads the rotated file at path unless it already was, then deletes it with
+// delete_after_upload. The file is read whole and closed before the upload, so it is never held
+// open while a rotation renames it (which Windows wouldn't allow); rotated files are at most
+// CODEX_HOOKLOG_MAX_SIZE.
+func (u *uploader) archive(ctx context.Context, path string) error {
+	data, info, err := read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Compressed, pruned, or shifted to another name by a rotation: the next pass finds it.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fp := fingerprint(info)
+
+	u.mu.Lock()
+	done, uploaded := u.state.Uploaded[fp]
+	u.mu.Unlock()
+	if !uploaded {
+		key := u.key(info, path, data)
+		contentType := "application/x-ndjson"
+		if strings.HasSuffix(path, ".gz") {
+			contentType = "application/gzip"
+		}
+		etag, err := u.client.Put(ctx, key, data, contentType)
+		if err != nil {
+			return err
+		}
+		done = archived{Key: key, ETag: etag, At: time.Now().UTC()}
+		hooklog.Debugf("uploaded %s to s3://%s/%s", path, u.cfg.Bucket, key)
+		if err := u.record(fp, done); err != nil {
+			return fmt.Errorf("uploaded to %s, but saving the state failed: %w", key, err)
+		}
+	}
+	if !u.cfg.DeleteAfterUpload {
+		return nil
+	}
+	removed, ok, err := u.log.RemoveRotated(info)
+	if err != nil {
+		return fmt.Errorf("uploaded to %s, but deleting failed: %w", done.Key, err)
+	}
+	if ok {
+		hooklog.Debugf("deleted %s", removed)
+	}
+	return nil
+}
+
+// read returns the file's contents with its details, taken from the open file so they describe
+// what was read even if a rotation renames the file meanwhile.
+func read(path string) ([]byte, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, info, nil
+}
+
+// key is the object key for a rotated file, named after its last write and its contents, so a
+// generation keeps its key as rotations rename it and distinct files never share one:
+// `xcodex/laptop/hooks-20260102T150405Z-3f2a9c1e0b7d.jsonl.gz`.
+func (u *uploader) key(info os.FileInfo, path string, data []byte) string {
+	base := filepath.Base(u.cfg.Log)
+	ext := filepath.Ext(base)
+	if strings.HasSuffix(path, ".gz") {
+		ext += ".gz"
+	}
+	sum := sha256.Sum256(data)
+	name := fmt.Sprintf("%s-%s-%s%s", strings.TrimSuffix(base, filepath.Ext(base)),
+		info.ModTime().UTC().Format("20060102T150405Z"), hex.EncodeToString(sum[:6]), ext)
+	return u.cfg.Prefix + u.host + "/" + name
+}
+
+// record notes an upload in the state file.
+func (u *uploader) record(fp string, done archived) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.state.Uploaded[fp] = done
+	_, onDisk := rotated(u.cfg)
+	return u.state.save(onDisk)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/s3"
+	"example.com/xcodex/hooks-sdk/hooksdk/s3/s3test"
+)
+
+// TestMain runs the uploader handle starts, which is this binary run with --upload.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == uploadArg {
+		if !upload() {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+var testCreds = s3.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+
+// s3Server starts an S3 stub, points the hook at it, and returns it with the log path.
+func s3Server(t *testing.T) (*s3test.Server, string) {
+	t.Helper()
+	srv := s3test.NewServer(t, testCreds, "us-east-1")
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOKLOG_COMPRESS", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", testCreds.AccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", testCreds.SecretAccessKey)
+	t.Setenv("CODEX_HOOK_ARCHIVE_S3_ENDPOINT", srv.URL)
+	t.Setenv("CODEX_HOOK_ARCHIVE_S3_BUCKET", "logs")
+	t.Setenv("CODEX_HOOK_ARCHIVE_S3_PATH_STYLE", "true")
+	return srv, filepath.Join(home, "hooks.jsonl")
+}
+
+// rotate appends records to the log and rotates it n times, each generation a different size.
+func rotate(t *testing.T, path string, opts jsonl.Options, n int) {
+	t.Helper()
+	opts.Keep = 5
+	w := jsonl.New(path, opts)
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			if err := w.Append(map[string]int{"generation": i, "n": j}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Append(map[string]string{"active": "yes"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func objectKeys(srv *s3test.Server) []string {
+	var keys []string
+	for k := range srv.Objects() {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func TestUpload(t *testing.T) {
+	srv, log := s3Server(t)
+	rotate(t, log, jsonl.Options{}, 2)
+	if !upload() {
+		t.Fatal("upload failed")
+	}
+	objects := srv.Objects()
+	if len(objects) != 2 {
+		t.Fatalf("uploaded %v, want the 2 rotated files", objectKeys(srv))
+	}
+	for key, obj := range objects {
+		if !strings.HasPrefix(key, "logs/xcodex/") || !strings.HasSuffix(key, ".jsonl") || !strings.Contains(filepath.Base(key), "hooks-") {
+			t.Errorf("key %q", key)
+		}
+		if obj.ContentType != "application/x-ndjson" || strings.Contains(string(obj.Data), "active") {
+			t.Errorf("%s: %s %q", key, obj.ContentType, obj.Data)
+		}
+	}
+	for _, path := range []string{log + ".1", log + ".2"} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s: %v, want it kept", path, err)
+		}
+	}
+
+	// The state keeps them from being uploaded again, even once a rotation renames them.
+	requests := srv.Requests()
+	upload()
+	rotate(t, log, jsonl.Options{}, 1)
+	if files := pending(mustConfig(t), loadState()); len(files) != 1 || files[0] != log+".1" {
+		t.Errorf("pending = %q, want only the new generation", files)
+	}
+	upload()
+	if got := srv.Requests() - requests; got != 1 || len(srv.Objects()) != 3 {
+		t.Errorf("%d more uploads, objects %v", got, objectKeys(srv))
+	}
+}
+
+func mustConfig(t *testing.T) *config {
+	t.Helper()
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestUploadDeletes(t *testing.T) {
+	srv, log := s3Server(t)
+	t.Setenv("CODEX_HOOK_ARCHIVE_S3_DELETE_AFTER_UPLOAD", "true")
+	t.Setenv("CODEX_HOOKLOG_COMPRESS", "1")
+	rotate(t, log, jsonl.Options{Compress: true}, 3)
+	if !upload() {
+		t.Fatal("upload failed")
+	}
+	if len(srv.Objects()) != 3 {
+		t.Errorf("uploaded %v", objectKeys(srv))
+	}
+	for _, obj := range srv.Objects() {
+		if obj.ContentType != "application/gzip" {
+			t.Errorf("content type %q for a compressed generation", obj.ContentType)
+		}
+	}
+	if files := jsonl.Files(log); len(files) != 1 || files[0] != log {
+		t.Errorf("files left: %q, want the active log", files)
+	}
+}
+
+func TestArchiveRetries(t *testing.T) {
+	srv, log := s3Server(t)
+	t.Setenv("CODEX_HOOK_ARCHIVE_S3_DELETE_AFTER_UPLOAD", "true")
+	rotate(t, log, jsonl.Options{}, 1)
+	u := newUploader(mustConfig(t))
+	u.client.Sleep = func(ctx context.Context, _ time.Duration) error { return ctx.Err() }
+
+	// A file isn't deleted until an upload is verified.
+	u.client.MaxAttempts = 2
+	srv.Fail(s3test.Failure{Status: 503}, s3test.Failure{ETag: `"bad"`})
+	if u.run(context.Background(), []string{log + ".1"}) {
+		t.Error("run succeeded without a verified upload")
+	}
+	if _, err := os.Stat(log + ".1"); err != nil {
+		t.Errorf("file deleted after failed uploads: %v", err)
+	}
+	if len(loadState().Uploaded) != 0 {
+		t.Errorf("state records a failed upload: %+v", loadState())
+	}
+
+	srv.Fail(s3test.Failure{Status: 500})
+	if !u.run(context.Background(), []string{log + ".1"}) {
+		t.Error("run failed after a retry")
+	}
+	if _, err := os.Stat(log + ".1"); !os.IsNotExist(err) {
+		t.Errorf("file kept after the upload: %v", err)
+	}
+	if srv.Requests() != 4 {
+		t.Errorf("%d requests, want 4", srv.Requests())
+	}
+}
+
+func TestHandle(t *testing.T) {
+	srv, log := s3Server(t)
+	t.Setenv("CODEX_HOOK_ARCHIVE_S3_ON_ROTATION", "false")
+
+	// Nothing rotated: nothing to start.
+	for _, payload := range []*hooktest.Builder{hooktest.SessionEnd(), hooktest.ToolCallStarted()} {
+		resp, err := handle(context.Background(), payload.Build())
+		if err != nil || resp.Decision != "allow" {
+			t.Errorf("handle = %+v, %v; want allow", resp, err)
+		}
+	}
+	rotate(t, log, jsonl.Options{}, 1)
+	// Without on_rotation, only a session-end starts an upload.
+	handle(context.Background(), hooktest.ToolCallStarted().Build())
+	time.Sleep(200 * time.Millisecond)
+	if len(srv.Objects()) != 0 {
+		t.Fatalf("uploaded on a tool call: %v", objectKeys(srv))
+	}
+	handle(context.Background(), hooktest.SessionEnd().Build())
+	deadline := time.Now().Add(10 * time.Second)
+	for len(srv.Objects()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the uploader didn't upload the rotated file")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// The uploader holds the lock until it has saved its state.
+	if err := hooksdk.WithLock(lockName, 10*time.Second, func() error { return nil }); err != nil {
+		t.Error(err)
+	}
+	if len(loadState().Uploaded) != 1 {
+		t.Errorf("state = %+v", loadState())
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	s3Server(t)
+	t.Setenv("CODEX_HOOK_ARCHIVE_S3_ACCESS_KEY_ID", "from-config")
+	t.Setenv("AWS_SESSION_TOKEN", "token")
+	cfg := mustConfig(t)
+	if cfg.AccessKeyID != "from-config" || cfg.SecretAccessKey != "secret" || cfg.SessionToken != "token" {
+		t.Errorf("credentials = %q, %q, %q", cfg.AccessKeyID, cfg.SecretAccessKey, cfg.SessionToken)
+	}
+	if cfg.Log != filepath.Join(os.Getenv("CODEX_HOME"), "hooks.jsonl") || cfg.Prefix != "xcodex/" || cfg.Concurrency != 2 {
+		t.Errorf("defaults: %+v", cfg)
+	}
+
+	t.Setenv("CODEX_HOOK_ARCHIVE_S3_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	if _, err := loadConfig(); err == nil {
+		t.Error("loadConfig without credentials succeeded")
+	}
+	for name, c := range map[string]config{
+		"no bucket":   {Concurrency: 1},
+		"endpoint":    {Bucket: "b", Concurrency: 1, Endpoint: "minio:9000"},
+		"concurrency": {Bucket: "b"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func main() {
+	os.Exit(run(hooksdk.IO{}))
+}
+
+// run is the whole hook on the given stdio and environment (the process's for the zero IO), so
+// tests can drive it in-process. It parses the event payload, writes the returned response to
+// stdout, and returns hooksdk.ExitDeny when the response denies the action.
+func run(stdio hooksdk.IO) int {
+	ctx, stop := hooksdk.SignalContext()
+	defer stop()
+	return stdio.Run(ctx, handle)
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	// Add your logic here. This template denies approval requests for commands that start with
+	// `rm` and allows everything else.
+	if payload.XcodexEventType == "approval-requested" && len(payload.Command) > 0 && payload.Command[0] == "rm" {
+		resp := hooksdk.Deny(fmt.Sprintf("refusing to run %q", strings.Join(payload.Command, " ")))
+		resp.ReasonCode = "EXAMPLE_RM"
+		return resp, nil
+	}
+	return hooksdk.Allow(), nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  []byte
+		code     int
+		decision hooksdk.Decision
+	}{
+		{"rm", hooktest.ApprovalRequested().WithCommand("rm -rf build").Bytes(), hooksdk.ExitDeny, hooksdk.DecisionDeny},
+		{"ls", hooktest.ApprovalRequested().WithCommand("ls").Bytes(), hooksdk.ExitOK, hooksdk.DecisionAllow},
+		{"other event", hooktest.SessionStart().Bytes(), hooksdk.ExitOK, hooksdk.DecisionAllow},
+	}
+	for _, tt := range tests {
+		var out, stderr bytes.Buffer
+		env := map[string]string{"CODEX_HOME": t.TempDir()}
+		code := run(hooksdk.IO{In: bytes.NewReader(tt.payload), Out: &out, Err: &stderr, Getenv: func(k string) string { return env[k] }})
+		if code != tt.code {
+			t.Errorf("%s: exit code = %d, want %d; stderr: %s", tt.name, code, tt.code, stderr.String())
+		}
+		var resp hooksdk.Response
+		if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+			t.Errorf("%s: response %q: %v", tt.name, out.String(), err)
+			continue
+		}
+		if resp.Decision != tt.decision {
+			t.Errorf("%s: decision = %q, want %q", tt.name, resp.Decision, tt.decision)
+		}
+		if tt.decision == hooksdk.DecisionDeny && (resp.ReasonCode != "EXAMPLE_RM" || resp.Reason != `refusing to run "rm -rf build"`) {
+			t.Errorf("%s: response = %+v, want the rm reason", tt.name, resp)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Command exec_hook runs an existing script as a hook, through hooksdk/execadapter: the SDK reads
+// the envelope, the script gets the payload on stdin, in CODEX_HOOK_PAYLOAD_FILE, and as
+// CODEX_HOOK_* variables, and its exit status is the decision (0 allows, 2 denies with stderr as
+// the reason). It doubles as a template: copy it and set the script in code to ship a script with
+// its own binary.
+//
+//	CODEX_HOOK_EXEC_SCRIPT=$HOME/.codex/hooks/check.sh exec_hook
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/execadapter"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+func main() {
+	// WithTimeout(0, ...) keeps the handler within the host's CODEX_HOOK_TIMEOUT_MS, so a script
+	// that runs too long is killed and the agent goes on.
+	hooksdk.Run(handle, hooksdk.WithTimeout(0, hooksdk.Allow()), hooksdk.WithSelfTest(selfTest))
+}
+
+// selfTest checks, for `exec_hook --self-test`, that CODEX_HOOK_EXEC_SCRIPT is set and found.
+func selfTest() []hooksdk.Check {
+	script := os.Getenv("CODEX_HOOK_EXEC_SCRIPT")
+	if script == "" {
+		return []hooksdk.Check{{
+			Name: "CODEX_HOOK_EXEC_SCRIPT is set",
+			Run:  func(context.Context, hooksdk.Env) error { return errors.New("not set") },
+		}}
+	}
+	return []hooksdk.Check{hooksdk.CheckCommand("script", script)}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	// CODEX_HOOK_EXEC_SCRIPT is the script to run; CODEX_HOOK_EXEC_TIMEOUT bounds it (a Go
+	// duration, default 30s).
+	script := execadapter.Script{Path: os.Getenv("CODEX_HOOK_EXEC_SCRIPT"), Stderr: os.Stderr}
+	if script.Path == "" {
+		hooklog.Errorf("CODEX_HOOK_EXEC_SCRIPT is not set")
+		return hooksdk.Allow(), nil
+	}
+	if v := os.Getenv("CODEX_HOOK_EXEC_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			hooklog.Warnf("ignoring CODEX_HOOK_EXEC_TIMEOUT: %v", err)
+		} else {
+			script.Timeout = d
+		}
+	}
+	// A failing script is reported like a failing hook: on stderr, with ExitError.
+	return script.Run(ctx, payload)
+}
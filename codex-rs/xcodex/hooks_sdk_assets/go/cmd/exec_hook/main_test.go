@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestHandle(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("runs an sh script")
+	}
+	t.Setenv("CODEX_HOOK_EXEC_SCRIPT", "")
+	p := hooktest.ApprovalRequested().Build()
+	if resp, err := handle(context.Background(), p); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("no script: %+v, %v; want allow", resp, err)
+	}
+	if checks := selfTest(); len(checks) != 1 || checks[0].Run(context.Background(), hooksdk.Env{}) == nil {
+		t.Errorf("self-test without a script passed")
+	}
+
+	script := filepath.Join(t.TempDir(), "check.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho denied >&2\nsleep 1\nexit 2\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOOK_EXEC_SCRIPT", script)
+	t.Setenv("CODEX_HOOK_EXEC_TIMEOUT", "soon")
+	if resp, err := handle(context.Background(), p); err != nil || resp.Decision != hooksdk.DecisionDeny {
+		t.Errorf("deny script: %+v, %v", resp, err)
+	}
+	t.Setenv("CODEX_HOOK_EXEC_TIMEOUT", "100ms")
+	if _, err := handle(context.Background(), p); err == nil {
+		t.Error("a script over CODEX_HOOK_EXEC_TIMEOUT didn't fail")
+	}
+	if checks := selfTest(); len(checks) != 1 || checks[0].Run(context.Background(), hooksdk.Env{}) != nil {
+		t.Errorf("self-test with a script failed")
+	}
+}
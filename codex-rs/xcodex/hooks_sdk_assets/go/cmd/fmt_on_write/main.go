@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/run"
+)
+
+// builtin are the formatters used unless `builtin = false`, after the configured ones. For each
+// extension the first formatter whose program is installed wins, so goimports is preferred to
+// gofmt where both exist.
+var builtin = []formatter{
+	{Extensions: []string{".go"}, Command: []string{"goimports", "-w"}},
+	{Extensions: []string{".go"}, Command: []string{"gofmt", "-w"}},
+	{Extensions: []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".json", ".css", ".scss"},
+		Command: []string{"prettier", "--write", "--log-level", "warn"}},
+	{Extensions: []string{".rs"}, Command: []string{"rustfmt", "--edition", "2021"}},
+}
+
+// Report modes: where the list of reformatted files goes.
+const (
+	reportLog     = "log"     // stderr
+	reportMessage = "message" // system_message, for the user
+	reportContext = "context" // additional_context, so the model knows to re-read the files
+)
+
+// config is read from `$CODEX_HOME/hooks/config/fmt_on_write.toml`; CODEX_HOOK_FMT_ON_WRITE_<KEY>
+// variables (CODEX_HOOK_FMT_ON_WRITE_TIMEOUT, ...) override it.
+type config struct {
+	// Formatter holds `[[formatter]]` tables, tried before the built-in ones.
+	Formatter []formatter `toml:"formatter"`
+	// Builtin enables the built-in formatters.
+	Builtin bool `toml:"builtin" default:"true"`
+	// MaxFiles skips formatting when a tool call wrote more files than this, e.g. a large
+	// generated change. 0 means no limit.
+	MaxFiles int `toml:"max_files" default:"20"`
+	// Timeout bounds each formatter invocation.
+	Timeout time.Duration `toml:"timeout" default:"10s"`
+	// Report is log, message, or context (see the report modes).
+	Report string `toml:"report" default:"log"`
+	// Env names more variables of the hook's environment formatters get, beyond
+	// run.DefaultAllow (e.g. NODE_PATH); a name ending in `*` is a prefix.
+	Env []string `toml:"env"`
+}
+
+// formatter is a `[[formatter]]` table: a command run on the files with one of the extensions,
+// which are appended to it.
+type formatter struct {
+	Extensions []string `toml:"extensions"`
+	Command    []string `toml:"command"`
+}
+
+func (c *config) Validate() error {
+	for i, f := range c.Formatter {
+		if len(f.Extensions) == 0 || len(f.Command) == 0 {
+			return fmt.Errorf("formatter[%d]: extensions and command must both be set", i)
+		}
+	}
+	switch c.Report {
+	case reportLog, reportMessage, reportContext:
+	default:
+		return fmt.Errorf("report must be %s, %s, or %s, not %q", reportLog, reportMessage, reportContext, c.Report)
+	}
+	if c.MaxFiles < 0 {
+		return errors.New("max_files must not be negative")
+	}
+	return nil
+}
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response. A formatter that
+	// fails or times out is logged by handle, and the write is allowed.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest))
+}
+
+// selfTest checks, for `fmt_on_write --self-test`, that the config loads, the host passes the list
+// of reformatted files on to the agent, and the programs of the configured formatters are
+// installed. Built-in formatters whose program is missing are skipped on events too, so they
+// aren't checked.
+func selfTest() []hooksdk.Check {
+	var cfg config
+	err := hooksdk.LoadConfig("fmt_on_write", &cfg)
+	checks := []hooksdk.Check{
+		hooksdk.CheckConfig("fmt_on_write", err),
+		hooksdk.CheckCapability(hooksdk.CapabilityAdditionalContext, "the list of reformatted files"),
+	}
+	for _, f := range cfg.Formatter {
+		checks = append(checks, hooksdk.CheckCommand("formatter", f.Command[0]))
+	}
+	return checks
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	if payload.EventType() != "tool-call-finished" || payload.Success == nil || !*payload.Success {
+		return hooksdk.Allow(), nil
+	}
+	touched := gitsnap.TouchedPaths(payload.ToolInput)
+	if payload.WorkingDir() == "" || len(touched) == 0 {
+		return hooksdk.Allow(), nil
+	}
+	// Symlinks are resolved in every path, so a link can't lead the formatter outside the
+	// workspace.
+	dir, err := filepath.EvalSymlinks(payload.WorkingDir())
+	if err != nil {
+		return hooksdk.Allow(), nil
+	}
+	var cfg config
+	if err := hooksdk.LoadConfig("fmt_on_write", &cfg); err != nil {
+		hooklog.Errorf("load config: %v; files not formatted", err)
+		return hooksdk.Allow(), nil
+	}
+
+	formatters := cfg.Formatter
+	if cfg.Builtin {
+		formatters = append(formatters, builtin...)
+	}
+	batches := plan(formatters, workspaceFiles(dir, touched), exec.LookPath)
+	count := 0
+	for _, b := range batches {
+		count += len(b.files)
+	}
+	if count == 0 {
+		return hooksdk.Allow(), nil
+	}
+	if cfg.MaxFiles > 0 && count > cfg.MaxFiles {
+		hooklog.Warnf("%d files written, more than max_files (%d); files not formatted", count, cfg.MaxFiles)
+		return hooksdk.Allow(), nil
+	}
+
+	var changed []string
+	for _, b := range batches {
+		changed = append(changed, format(ctx, dir, b, &cfg)...)
+	}
+	if len(changed) == 0 {
+		return hooksdk.Allow(), nil
+	}
+	rel := make([]string, len(changed))
+	for i, path := range changed {
+		rel[i] = path
+		if r, err := filepath.Rel(dir, path); err == nil {
+			rel[i] = filepath.ToSlash(r)
+		}
+	}
+	sort.Strings(rel)
+	switch cfg.Report {
+	case reportMessage:
+		resp := hooksdk.Allow()
+		resp.SystemMessage = "Reformatted " + strings.Join(rel, ", ")
+		return resp, nil
+	case reportContext:
+		return hooksdk.Allow().InjectContext("These files were reformatted after the last write; " +
+			"re-read them before editing them again: " + strings.Join(rel, ", ")), nil
+	}
+	hooklog.Infof("reformatted %s", strings.Join(rel, ", "))
+	return hooksdk.Allow(), nil
+}
+
+// workspaceFiles returns the absolute paths of the touched files that exist as regular files
+// inside dir, symlinks resolved. Deleted files and files outside the workspace are left alone.
+func workspaceFiles(dir string, touched []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, path := range touched {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, real)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			hooklog.Debugf("skipping %s: outside %s", path, dir)
+			continue
+		}
+		if info, err := os.Stat(real); err != nil || !info.Mode().IsRegular() || seen[real] {
+			continue
+		}
+		seen[real] = true
+		out = append(out, real)
+	}
+	return out
+}
+
+// batch is one formatter invocation.
+type batch struct {
+	command []string
+	files   []string
+}
+
+// plan assigns each file to the first formatter for its extension (compared case-insensitively)
+// whose program lookPath finds, and groups the files by formatter, in formatter order. Files no
+// installed formatter handles are left out.
+func plan(formatters []formatter, files []string, lookPath func(string) (string, error)) []batch {
+	installed := map[string]bool{}
+	have := func(program string) bool {
+		ok, known := installed[program]
+		if !known {
+			_, err := lookPath(program)
+			ok = err == nil
+			installed[program] = ok
+		}
+		return ok
+	}
+	batches := make([]batch, len(formatters))
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file))
+		for i, f := range formatters {
+			if hasExtension(f, ext) && have(f.Command[0]) {
+				batches[i].command = f.Command
+				batches[i].files = append(batches[i].files, file)
+				break
+			}
+		}
+	}
+	out := batches[:0]
+	for _, b := range batches {
+		if len(b.files) > 0 {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func hasExtension(f formatter, ext string) bool {
+	for _, e := range f.Extensions {
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if strings.EqualFold(e, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// format runs one formatter on its files in dir, within the configured timeout, and returns the
+// files whose content it changed. A formatter that fails or times out is logged; files it rewrote
+// before that are still reported.
+func format(ctx context.Context, dir string, b batch, cfg *config) []string {
+	before := make([][32]byte, len(b.files))
+	for i, file := range b.files {
+		before[i] = digest(file)
+	}
+
+	args := append(append([]string(nil), b.command[1:]...), b.files...)
+	cmd := run.Command(ctx, b.command[0], args...)
+	cmd.Dir = dir
+	cmd.Timeout = cfg.Timeout
+	cmd.Allow = append(append([]string(nil), run.DefaultAllow...), cfg.Env...)
+	cmd.MergeStderr = true
+	name := strings.Join(b.command, " ")
+	switch res, err := cmd.Run(); {
+	case err == nil:
+	case res.TimedOut:
+		hooklog.Warnf("%s did not finish within %v", name, cfg.Timeout)
+	default:
+		hooklog.Warnf("%s: %v: %s", name, err, strings.TrimSpace(string(res.Stdout)))
+	}
+
+	var changed []string
+	for i, file := range b.files {
+		if digest(file) != before[i] {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+// digest hashes the file's content; an unreadable file hashes as empty.
+func digest(path string) [32]byte {
+	data, _ := os.ReadFile(path)
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestPlan(t *testing.T) {
+	formatters := []formatter{
+		{Extensions: []string{"txt", ".MD"}, Command: []string{"mdfmt"}},
+		{Extensions: []string{".go"}, Command: []string{"missing"}},
+	}
+	formatters = append(formatters, builtin...)
+	installed := map[string]bool{"mdfmt": true, "gofmt": true, "goimports": false, "prettier": true, "rustfmt": true}
+	var looked []string
+	lookPath := func(program string) (string, error) {
+		looked = append(looked, program)
+		if installed[program] {
+			return "/bin/" + program, nil
+		}
+		return "", errors.New("not found")
+	}
+	files := []string{"a.go", "b.Go", "c.tsx", "d.JSON", "e.rs", "f.txt", "g.md", "h.py", "Makefile", "i.ts"}
+	var got []string
+	for _, b := range plan(formatters, files, lookPath) {
+		got = append(got, b.command[0]+": "+strings.Join(b.files, " "))
+	}
+	want := []string{"mdfmt: f.txt g.md", "gofmt: a.go b.Go", "prettier: c.tsx d.JSON i.ts", "rustfmt: e.rs"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("plan = %q, want %q", got, want)
+	}
+	// Each program is looked up once.
+	seen := map[string]bool{}
+	for _, p := range looked {
+		if seen[p] {
+			t.Errorf("%s looked up twice: %q", p, looked)
+		}
+		seen[p] = true
+	}
+	if got := plan(formatters, []string{"x.py"}, lookPath); len(got) != 0 {
+		t.Errorf("plan for unformattable files = %+v", got)
+	}
+}
+
+// fakeFormatter is a formatter that logs how it was run to $FMT_LOG and appends a line naming
+// itself to each file it is given. It uses shell builtins alone, so it runs with a bare PATH.
+const fakeFormatter = `#!/bin/sh
+printf '%s\n' "${0##*/} $*" >> "$FMT_LOG"
+for f; do
+	if [ -f "$f" ]; then printf '// %s\n' "${0##*/}" >> "$f"; fi
+done
+`
+
+type workspace struct {
+	dir, bin, outside, log string
+	payload                *hooksdk.HookPayload
+}
+
+// newWorkspace makes a workspace and fake formatters, named for the built-in ones, on PATH, and
+// returns it with the payload of an apply_patch that wrote a file of each kind, one outside the
+// workspace, and one through a link leading out of it.
+func newWorkspace(t *testing.T) *workspace {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fakes the formatters with sh scripts")
+	}
+	root := t.TempDir()
+	w := &workspace{
+		dir:     filepath.Join(root, "repo"),
+		bin:     filepath.Join(root, "bin"),
+		outside: filepath.Join(root, "outside.go"),
+		log:     filepath.Join(root, "fmt.log"),
+	}
+	for _, dir := range []string{w.bin, filepath.Join(w.dir, "web")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"goimports", "gofmt", "prettier", "rustfmt", "txtfmt"} {
+		if err := os.WriteFile(filepath.Join(w.bin, name), []byte(fakeFormatter), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{"a.go", "web/b.TS", "c.rs", "notes.txt", "../outside.go"} {
+		if err := os.WriteFile(filepath.Join(w.dir, path), []byte("x\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(w.outside, filepath.Join(w.dir, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", w.bin)
+	t.Setenv("FMT_LOG", w.log)
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_FMT_ON_WRITE_ENV", "FMT_LOG")
+	t.Setenv("CODEX_HOOK_FMT_ON_WRITE_REPORT", reportMessage)
+
+	patch := "*** Begin Patch\n"
+	for _, path := range []string{"a.go", "web/b.TS", "c.rs", "notes.txt", "link.go", w.outside, "deleted.go"} {
+		patch += "*** Add File: " + path + "\n+x\n"
+	}
+	patch += "*** End Patch\n"
+	w.payload = hooktest.ToolCallFinished().
+		WithCwd(w.dir).
+		WithToolName("apply_patch").
+		With("tool_input", map[string]any{"input": patch}).
+		Build()
+	return w
+}
+
+func (w *workspace) read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(w.dir, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func writeConfig(t *testing.T, cfg string) {
+	t.Helper()
+	path := hooksdk.ConfigPath("fmt_on_write")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	w := newWorkspace(t)
+	resp, err := handle(context.Background(), w.payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Decision != hooksdk.DecisionAllow || resp.SystemMessage != "Reformatted a.go, c.rs, web/b.TS" {
+		t.Errorf("handle = %+v", resp)
+	}
+	for path, want := range map[string]string{
+		"a.go":          "x\n// goimports\n",
+		"web/b.TS":      "x\n// prettier\n",
+		"c.rs":          "x\n// rustfmt\n",
+		"notes.txt":     "x\n",
+		"../outside.go": "x\n",
+	} {
+		if got := w.read(t, path); got != want {
+			t.Errorf("%s = %q, want %q", path, got, want)
+		}
+	}
+	// Each formatter runs once, with its arguments, on the real paths.
+	log, _ := os.ReadFile(w.log)
+	dir, _ := filepath.EvalSymlinks(w.dir)
+	want := "goimports -w " + filepath.Join(dir, "a.go") + "\n" +
+		"prettier --write --log-level warn " + filepath.Join(dir, "web/b.TS") + "\n" +
+		"rustfmt --edition 2021 " + filepath.Join(dir, "c.rs") + "\n"
+	if string(log) != want {
+		t.Errorf("formatters ran:\n%s\nwant:\n%s", log, want)
+	}
+
+	// gofmt stands in for a missing goimports; what a formatter leaves unchanged isn't reported.
+	os.Remove(filepath.Join(w.bin, "goimports"))
+	os.Remove(filepath.Join(w.bin, "prettier"))
+	os.WriteFile(filepath.Join(w.bin, "rustfmt"), []byte("#!/bin/sh\n"), 0o755)
+	t.Setenv("CODEX_HOOK_FMT_ON_WRITE_REPORT", reportContext)
+	resp, _ = handle(context.Background(), w.payload)
+	if ctx := resp.AdditionalContext; !strings.HasSuffix(ctx, "re-read them before editing them again: a.go") || resp.SystemMessage != "" {
+		t.Errorf("handle = %+v, context %q", resp, ctx)
+	}
+	if got := w.read(t, "a.go"); got != "x\n// goimports\n// gofmt\n" {
+		t.Errorf("a.go = %q", got)
+	}
+}
+
+func TestHandleConfig(t *testing.T) {
+	w := newWorkspace(t)
+	// Configured formatters come before the built-in ones.
+	writeConfig(t, `builtin = false
+
+[[formatter]]
+extensions = ["txt", ".GO"]
+command = ["txtfmt", "--fix"]
+`)
+	resp, _ := handle(context.Background(), w.payload)
+	if resp.SystemMessage != "Reformatted a.go, notes.txt" {
+		t.Errorf("handle = %+v", resp)
+	}
+	if got := w.read(t, "c.rs"); got != "x\n" {
+		t.Errorf("c.rs = %q with builtin = false", got)
+	}
+
+	// More files than max_files: none are formatted.
+	t.Setenv("CODEX_HOOK_FMT_ON_WRITE_MAX_FILES", "1")
+	before := w.read(t, "a.go")
+	if resp, _ := handle(context.Background(), w.payload); resp.SystemMessage != "" || w.read(t, "a.go") != before {
+		t.Errorf("over max_files: %+v, a.go = %q", resp, w.read(t, "a.go"))
+	}
+
+	// A bad config allows the event without formatting.
+	t.Setenv("CODEX_HOOK_FMT_ON_WRITE_REPORT", "stdout")
+	if resp, err := handle(context.Background(), w.payload); err != nil || resp.Decision != hooksdk.DecisionAllow || resp.SystemMessage != "" {
+		t.Errorf("bad config: %+v, %v", resp, err)
+	}
+}
+
+func TestHandleIgnores(t *testing.T) {
+	w := newWorkspace(t)
+	failed := hooktest.ToolCallFinished().WithCwd(w.dir).With("success", false).
+		With("tool_input", map[string]any{"path": "a.go"}).Build()
+	started := hooktest.ToolCallStarted().WithCwd(w.dir).With("tool_input", map[string]any{"path": "a.go"}).Build()
+	noCwd := hooktest.ToolCallFinished().With("tool_input", map[string]any{"path": "a.go"}).Build()
+	shell := hooktest.ToolCallFinished().WithCwd(w.dir).Build()
+	for name, p := range map[string]*hooksdk.HookPayload{"failed": failed, "started": started, "no cwd": noCwd, "shell": shell} {
+		if resp, err := handle(context.Background(), p); err != nil || resp.Decision != hooksdk.DecisionAllow || resp.SystemMessage != "" {
+			t.Errorf("%s: %+v, %v", name, resp, err)
+		}
+	}
+	if got := w.read(t, "a.go"); got != "x\n" {
+		t.Errorf("a.go = %q", got)
+	}
+
+	// A single written file, by path.
+	written := hooktest.ToolCallFinished().WithCwd(w.dir).With("tool_input", map[string]any{"file_path": filepath.Join(w.dir, "c.rs")}).Build()
+	if resp, _ := handle(context.Background(), written); resp.SystemMessage != "Reformatted c.rs" {
+		t.Errorf("file_path write: %+v", resp)
+	}
+}
+
+func TestFormatTimeout(t *testing.T) {
+	w := newWorkspace(t)
+	slow := filepath.Join(w.bin, "slowfmt")
+	// It rewrites its file, then hangs.
+	os.WriteFile(slow, []byte("#!/bin/sh\nfor f; do echo slow >> \"$f\"; done\nexec /bin/sleep 10\n"), 0o755)
+	writeConfig(t, `timeout = "200ms"
+
+[[formatter]]
+extensions = [".go"]
+command = ["`+slow+`"]
+`)
+	start := time.Now()
+	resp, err := handle(context.Background(), w.payload)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("handle took %v with a 200ms timeout", elapsed)
+	}
+	// The built-in formatters still ran on the other files.
+	if err != nil || resp.SystemMessage != "Reformatted a.go, c.rs, web/b.TS" {
+		t.Errorf("handle = %+v, %v", resp, err)
+	}
+	if got := w.read(t, "a.go"); got != "x\nslow\n" {
+		t.Errorf("a.go = %q", got)
+	}
+}
+
+func TestFormatEnvironment(t *testing.T) {
+	w := newWorkspace(t)
+	// envfmt writes the variables it got into its files.
+	os.WriteFile(filepath.Join(w.bin, "envfmt"), []byte("#!/bin/sh\nfor f; do echo \"key=${OPENAI_API_KEY-unset} home=${CODEX_HOME-unset} node=$NODE_PATH\" > \"$f\"; done\n"), 0o755)
+	writeConfig(t, `builtin = false
+
+[[formatter]]
+extensions = [".go"]
+command = ["envfmt"]
+`)
+	t.Setenv("OPENAI_API_KEY", "sk-secret")
+	t.Setenv("NODE_PATH", "/opt/node")
+	t.Setenv("CODEX_HOOK_FMT_ON_WRITE_ENV", "NODE_*")
+	handle(context.Background(), w.payload)
+	if got := w.read(t, "a.go"); got != "key=unset home=unset node=/opt/node\n" {
+		t.Errorf("a.go = %q", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, c := range map[string]config{
+		"no command": {Report: reportLog, Formatter: []formatter{{Extensions: []string{".go"}}}},
+		"no ext":     {Report: reportLog, Formatter: []formatter{{Command: []string{"gofmt"}}}},
+		"report":     {Report: "stdout"},
+		"max files":  {Report: reportLog, MaxFiles: -1},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: validated", name)
+		}
+	}
+	if err := (&config{Report: reportContext}).Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	// The self-test checks the host passes the list of reformatted files on to the agent.
+	t.Setenv("CODEX_HOME", t.TempDir())
+	for capabilities, want := range map[string]string{
+		hooksdk.CapabilityAdditionalContext: "PASS  host supports additional_context",
+		hooksdk.CapabilityModify:            "FAIL  host supports additional_context",
+	} {
+		t.Setenv(hooksdk.CapabilitiesEnv, capabilities)
+		var out strings.Builder
+		hooksdk.IO{Out: &out, Err: io.Discard, Getenv: os.Getenv}.SelfTest(context.Background(), selfTest()...)
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("capabilities %q: no %q in\n%s", capabilities, want, out.String())
+		}
+	}
+}
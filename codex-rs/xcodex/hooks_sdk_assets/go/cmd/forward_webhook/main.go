@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/cloudevents"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/outbox"
+	"example.com/xcodex/hooks-sdk/hooksdk/retry"
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+// drainArg runs the binary as a drainer that delivers every queued event, e.g. from cron while
+// no session is running.
+const drainArg = "--drain"
+
+// Body formats: the payload as it is, or wrapped as a CloudEvent in structured mode (the event
+// as JSON) or binary mode (the payload, with the attributes in ce- headers).
+const (
+	formatJSON              = "json"
+	formatCloudEvents       = "cloudevents"
+	formatCloudEventsBinary = "cloudevents-binary"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == drainArg {
+		os.Exit(drain())
+	}
+	// Run parses the event payload, calls handle, and writes the response. This hook is
+	// fire-and-forget: it always allows the event, even when delivery fails.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `forward_webhook --self-test`, that the config loads, the webhook
+// answers, and events can be queued.
+func selfTest() []hooksdk.Check {
+	var cfg config
+	err := hooksdk.LoadConfig("webhook", &cfg)
+	checks := []hooksdk.Check{
+		hooksdk.CheckConfig("webhook", err),
+		hooksdk.CheckHTTP("webhook", cfg.URL),
+	}
+	if cfg.Outbox {
+		checks = append(checks, hooksdk.CheckWritable("outbox", outboxDir()))
+	}
+	return checks
+}
+
+// config is read from `$CODEX_HOME/hooks/config/webhook.toml`, and CODEX_HOOK_WEBHOOK_URL,
+// CODEX_HOOK_WEBHOOK_SECRET, CODEX_HOOK_WEBHOOK_TIMEOUT, CODEX_HOOK_WEBHOOK_DETACH, ... override it.
+type config struct {
+	URL string `toml:"url"`
+	// Secret signs the body with HMAC-SHA256 in X-Hook-Signature.
+	Secret string `toml:"secret"`
+	// Timeout bounds delivery, retries (5xx, 408, 429, timeouts) included. With the outbox it
+	// bounds delivering the queue and the new event together.
+	Timeout time.Duration `toml:"timeout" default:"5s"`
+	// Detach acknowledges the event at once and delivers it from a background process, so a slow
+	// endpoint never holds up the agent; delivery errors then go to hooksdk.DetachLogPath.
+	Detach bool `toml:"detach"`
+	// Outbox queues each event in outboxDir before sending it, and keeps the ones the endpoint
+	// didn't take for later runs (or `forward_webhook --drain`), which send them oldest first.
+	Outbox bool `toml:"outbox" default:"true"`
+	// MaxAge drops queued events older than this unsent.
+	MaxAge time.Duration `toml:"max_age" default:"168h"`
+	// DrainBudget caps the events one hook run sends, queued ones included; the rest wait for the
+	// next run.
+	DrainBudget int `toml:"drain_budget" default:"20"`
+	// Format is the body format (see the formats); `--format <format>` on the command line
+	// overrides it.
+	Format string `toml:"format" default:"json"`
+}
+
+func (c *config) Validate() error {
+	if c.DrainBudget < 1 {
+		return errors.New("drain_budget must be at least 1")
+	}
+	if f, ok := formatArg(); ok {
+		c.Format = f
+	}
+	switch c.Format {
+	case formatJSON, formatCloudEvents, formatCloudEventsBinary:
+	default:
+		return fmt.Errorf("format must be %s, %s, or %s, not %q", formatJSON, formatCloudEvents, formatCloudEventsBinary, c.Format)
+	}
+	return nil
+}
+
+// formatArg is the value of a `--format` (or `--format=`) argument.
+func formatArg() (string, bool) {
+	for i, arg := range os.Args[1:] {
+		if v, ok := strings.CutPrefix(arg, "--format="); ok {
+			return v, true
+		}
+		if arg == "--format" && i+2 < len(os.Args) {
+			return os.Args[i+2], true
+		}
+	}
+	return "", false
+}
+
+// queued is an event in the outbox, or on its way to the endpoint.
+type queued struct {
+	Event   string          `json:"event"`
+	EventID string          `json:"event_id"`
+	Body    json.RawMessage `json:"body"`
+	// Header holds the headers of the body format, e.g. the ce- headers of a binary CloudEvent.
+	Header http.Header `json:"header,omitempty"`
+	// InvocationID is the invocation that queued the event, which the process delivering it may
+	// not be.
+	InvocationID string `json:"hook_invocation_id,omitempty"`
+}
+
+// encode returns the event in payload in cfg's format.
+func encode(cfg *config, payload *hooksdk.HookPayload) (queued, error) {
+	event := queued{Event: payload.EventType(), EventID: payload.EventId, InvocationID: payload.InvocationID()}
+	if cfg.Format == formatJSON {
+		body, err := json.Marshal(payload.RawPayload)
+		event.Body = body
+		return event, err
+	}
+	ce, err := cloudevents.ToCloudEvent(payload)
+	if err != nil {
+		return event, err
+	}
+	if cfg.Format == formatCloudEventsBinary {
+		event.Body, event.Header = ce.Data, ce.Header()
+		return event, nil
+	}
+	event.Body, err = json.Marshal(ce)
+	event.Header = http.Header{"Content-Type": {cloudevents.ContentType}}
+	return event, err
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		hooklog.Errorf("%v; event not forwarded", err)
+		return hooksdk.Allow(), nil
+	}
+	event, err := encode(cfg, payload)
+	if err != nil {
+		hooklog.Errorf("encode payload: %v", err)
+		return hooksdk.Allow(), nil
+	}
+
+	send := func() {
+		if !cfg.Outbox {
+			if err := post(ctx, cfg, event); err != nil {
+				hooklog.Errorf("forward event to %s: %v", cfg.URL, err)
+			}
+			return
+		}
+		enqueue(ctx, cfg, event)
+	}
+	if !cfg.Detach {
+		send()
+		return hooksdk.Allow(), nil
+	}
+	// The background copy runs handle again up to here (nothing above has side effects) and sends
+	// the event from Detach.
+	if err := hooksdk.Detach(send); err != nil {
+		hooklog.Warnf("delivered synchronously: %v", err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+func loadConfig() (*config, error) {
+	var cfg config
+	if err := hooksdk.LoadConfig("webhook", &cfg); err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("no webhook url (set url in %s or CODEX_HOOK_WEBHOOK_URL)", hooksdk.ConfigPath("webhook"))
+	}
+	return &cfg, nil
+}
+
+// outboxDir holds the queued events: `$CODEX_HOME/hooks/outbox/webhook`.
+func outboxDir() string {
+	return hooksdk.Environ().Path("hooks", "outbox", "webhook")
+}
+
+// enqueue adds event to the outbox and delivers the queue, within the drain budget and the
+// timeout. An event that can't be queued is sent directly.
+func enqueue(ctx context.Context, cfg *config, event queued) {
+	box := outbox.New(outboxDir())
+	box.MaxAge, box.Budget = cfg.MaxAge, cfg.DrainBudget
+	data, err := json.Marshal(event)
+	if err == nil {
+		_, err = box.Add(data)
+	}
+	if err != nil {
+		hooklog.Warnf("queue event: %v; sending it directly", err)
+		if err := post(ctx, cfg, event); err != nil {
+			hooklog.Errorf("forward event to %s: %v", cfg.URL, err)
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	stats, err := deliver(ctx, cfg, box)
+	if err != nil {
+		hooklog.Errorf("forward events to %s: %v; %d event(s) queued in %s", cfg.URL, err, stats.Left, box.Dir)
+	} else if stats.Left > 0 && !stats.Busy {
+		hooklog.Warnf("%d event(s) still queued in %s", stats.Left, box.Dir)
+	}
+}
+
+// deliver drains box, logging the events it drops.
+func deliver(ctx context.Context, cfg *config, box *outbox.Outbox) (outbox.Stats, error) {
+	stats, err := box.Drain(ctx, func(ctx context.Context, m outbox.Message) error {
+		var event queued
+		if err := json.Unmarshal(m.Data, &event); err != nil {
+			return fmt.Errorf("%w: %s: %v", outbox.ErrReject, m.ID, err)
+		}
+		err := post(ctx, cfg, event)
+		var se *webhook.StatusError
+		if errors.As(err, &se) && !retry.HTTPStatus(se.StatusCode) {
+			// Another try would get the same answer; don't let it hold up the queue.
+			hooklog.Errorf("event %s rejected by %s: %v; dropped", event.EventID, cfg.URL, err)
+			return fmt.Errorf("%w: %v", outbox.ErrReject, err)
+		}
+		return err
+	})
+	if stats.Expired > 0 {
+		hooklog.Warnf("dropped %d queued event(s) older than max_age (%v)", stats.Expired, cfg.MaxAge)
+	}
+	return stats, err
+}
+
+// post sends one event.
+func post(ctx context.Context, cfg *config, event queued) error {
+	// The event id lets the receiver drop duplicates caused by retries and redeliveries.
+	header := http.Header{
+		"X-Hook-Event":    {event.Event},
+		"X-Hook-Event-Id": {event.EventID},
+	}
+	if event.InvocationID != "" {
+		header.Set(webhook.InvocationIDHeader, event.InvocationID)
+	}
+	for k, vs := range event.Header {
+		header[k] = vs
+	}
+	client := &webhook.Client{
+		URL:      cfg.URL,
+		Secret:   []byte(cfg.Secret),
+		Deadline: cfg.Timeout,
+		Header:   header,
+		OnRetry: func(attempt int, err error, wait time.Duration) {
+			hooklog.Debugf("attempt %d failed: %v; retrying in %v", attempt, err, wait.Round(time.Millisecond))
+		},
+	}
+	return client.Send(ctx, event.Body)
+}
+
+// drain delivers every queued event, for `forward_webhook --drain`, and prints what it did.
+func drain() int {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "forward_webhook: %v\n", err)
+		return hooksdk.ExitError
+	}
+	box := outbox.New(outboxDir())
+	box.MaxAge = cfg.MaxAge
+	ctx, stop := hooksdk.SignalContext()
+	defer stop()
+	stats, err := deliver(ctx, cfg, box)
+	if stats.Busy {
+		fmt.Println("another process is delivering the queue")
+		return hooksdk.ExitOK
+	}
+	fmt.Printf("%d sent, %d rejected, %d expired, %d queued\n", stats.Sent, stats.Rejected, stats.Expired, stats.Left)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "forward_webhook: forward events to %s: %v\n", cfg.URL, err)
+		return hooksdk.ExitError
+	}
+	return hooksdk.ExitOK
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/cloudevents"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/outbox"
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+// received is a request the test endpoint got.
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// endpoint starts a webhook endpoint answering status, points the hook at it, and returns the
+// requests it gets.
+func endpoint(t *testing.T, status int) chan received {
+	t.Helper()
+	got := make(chan received, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header, body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_WEBHOOK_URL", srv.URL)
+	t.Setenv("CODEX_HOOK_WEBHOOK_SECRET", "s3cret")
+	t.Setenv("CODEX_HOOK_WEBHOOK_OUTBOX", "false")
+	return got
+}
+
+func TestHandleForwardsSignedPayload(t *testing.T) {
+	got := endpoint(t, http.StatusNoContent)
+	payload := hooktest.ToolCallStarted().WithSessionID("s1").Build()
+	resp, err := handle(context.Background(), payload)
+	if err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle = %+v, %v; want allow", resp, err)
+	}
+
+	r := <-got
+	if !webhook.Verify([]byte("s3cret"), r.body, r.header.Get(webhook.SignatureHeader)) {
+		t.Errorf("signature %q doesn't verify", r.header.Get(webhook.SignatureHeader))
+	}
+	var body map[string]any
+	if err := json.Unmarshal(r.body, &body); err != nil || body["session_id"] != "s1" {
+		t.Errorf("body = %s, want the payload", r.body)
+	}
+	if r.header.Get("X-Hook-Event") != payload.EventType() || r.header.Get("X-Hook-Event-Id") != payload.EventId {
+		t.Errorf("event headers = %v", r.header)
+	}
+}
+
+func TestHandleAllowsWhenDeliveryFails(t *testing.T) {
+	got := endpoint(t, http.StatusBadRequest)
+	resp, err := handle(context.Background(), hooktest.SessionStart().Build())
+	if err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("handle = %+v, %v; want allow", resp, err)
+	}
+	if n := len(got); n != 1 {
+		t.Errorf("a 400 was tried %d times, want once", n)
+	}
+
+	// Without a URL the event is allowed without being sent.
+	t.Setenv("CODEX_HOOK_WEBHOOK_URL", "")
+	if resp, err := handle(context.Background(), hooktest.SessionStart().Build()); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("handle without a url = %+v, %v; want allow", resp, err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	for _, k := range []string{"URL", "SECRET", "TIMEOUT", "DETACH", "OUTBOX", "MAX_AGE", "DRAIN_BUDGET", "FORMAT"} {
+		t.Setenv("CODEX_HOOK_WEBHOOK_"+k, "")
+	}
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "no webhook url") {
+		t.Errorf("no url: error = %v", err)
+	}
+
+	path := hooksdk.ConfigPath("webhook")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("url = \"https://file.example\"\ntimeout = \"2s\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.URL != "https://file.example" || cfg.Timeout != 2*time.Second || !cfg.Outbox || cfg.MaxAge != 168*time.Hour || cfg.DrainBudget != 20 || cfg.Format != "json" {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	t.Setenv("CODEX_HOOK_WEBHOOK_URL", "https://env.example")
+	t.Setenv("CODEX_HOOK_WEBHOOK_TIMEOUT", "1s")
+	if cfg, err = loadConfig(); err != nil || cfg.URL != "https://env.example" || cfg.Timeout != time.Second {
+		t.Errorf("with overrides: %+v, %v", cfg, err)
+	}
+
+	t.Setenv("CODEX_HOOK_WEBHOOK_TIMEOUT", "soon")
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "CODEX_HOOK_WEBHOOK_TIMEOUT") {
+		t.Errorf("bad timeout: error = %v, want one naming the variable", err)
+	}
+}
+
+func TestHandleDetachOutsideRun(t *testing.T) {
+	// Called directly, as under hooktest, a detached delivery happens before handle returns.
+	got := endpoint(t, http.StatusNoContent)
+	t.Setenv("CODEX_HOOK_WEBHOOK_DETACH", "true")
+	if resp, err := handle(context.Background(), hooktest.SessionStart().Build()); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle = %+v, %v", resp, err)
+	}
+	select {
+	case <-got:
+	default:
+		t.Error("detached delivery didn't run synchronously outside Run")
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	// failures runs the self-test, returning the names of the checks that failed.
+	failures := func() []string {
+		var failed []string
+		for _, c := range selfTest() {
+			if err := c.Run(context.Background(), hooksdk.Environ()); err != nil {
+				failed = append(failed, c.Name)
+			}
+		}
+		return failed
+	}
+	endpoint(t, http.StatusNoContent)
+	t.Setenv("CODEX_HOOK_WEBHOOK_OUTBOX", "true")
+	if failed := failures(); len(failed) != 0 {
+		t.Errorf("working environment: %q failed", failed)
+	}
+
+	// An endpoint that isn't listening.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	t.Setenv("CODEX_HOOK_WEBHOOK_URL", srv.URL)
+	if failed := failures(); len(failed) != 1 || !strings.HasPrefix(failed[0], "webhook ") {
+		t.Errorf("closed endpoint: %q failed", failed)
+	}
+
+	// An outbox that can't be created, and a broken config.
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	if err := os.WriteFile(filepath.Join(home, "hooks"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOOK_WEBHOOK_TIMEOUT", "soon")
+	if failed := failures(); len(failed) != 3 || !strings.HasPrefix(failed[0], "config ") || !strings.HasPrefix(failed[2], "outbox ") {
+		t.Errorf("broken environment: %q failed", failed)
+	}
+}
+
+func TestHandleOutbox(t *testing.T) {
+	var mu sync.Mutex
+	status := http.StatusServiceUnavailable
+	var sessions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if status < 300 {
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			sessions = append(sessions, body["session_id"].(string))
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	setStatus := func(s int) {
+		mu.Lock()
+		status = s
+		mu.Unlock()
+	}
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_WEBHOOK_URL", srv.URL)
+	t.Setenv("CODEX_HOOK_WEBHOOK_SECRET", "")
+	t.Setenv("CODEX_HOOK_WEBHOOK_OUTBOX", "true")
+	t.Setenv("CODEX_HOOK_WEBHOOK_TIMEOUT", "100ms")
+	t.Setenv("CODEX_HOOK_WEBHOOK_DETACH", "")
+	event := func(session string) {
+		t.Helper()
+		if resp, err := handle(context.Background(), hooktest.SessionStart().WithSessionID(session).Build()); err != nil || resp.Decision != hooksdk.DecisionAllow {
+			t.Fatalf("handle = %+v, %v", resp, err)
+		}
+	}
+	queued := func() int {
+		n, err := outbox.New(outboxDir()).Len()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	// While the endpoint is down, events wait in the outbox.
+	event("a")
+	event("b")
+	if n := queued(); n != 2 {
+		t.Errorf("%d events queued while the endpoint was down, want 2", n)
+	}
+
+	// The next event, once it is up, sends them first.
+	setStatus(http.StatusNoContent)
+	event("c")
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(sessions, want) || queued() != 0 {
+		t.Errorf("delivered %q (%d queued), want %q", sessions, queued(), want)
+	}
+
+	// An event the endpoint refuses is dropped rather than blocking the queue.
+	setStatus(http.StatusBadRequest)
+	event("d")
+	if n := queued(); n != 0 {
+		t.Errorf("a rejected event stayed queued (%d)", n)
+	}
+
+	// --drain delivers what is queued, and fails while the endpoint is down.
+	setStatus(http.StatusServiceUnavailable)
+	event("e")
+	if code := drain(); code != hooksdk.ExitError || queued() != 1 {
+		t.Errorf("drain with the endpoint down = %d, %d queued", code, queued())
+	}
+	setStatus(http.StatusNoContent)
+	if code := drain(); code != hooksdk.ExitOK || queued() != 0 || sessions[len(sessions)-1] != "e" {
+		t.Errorf("drain = %d, %d queued, delivered %q", code, queued(), sessions)
+	}
+}
+
+func TestHandleOutboxMaxAge(t *testing.T) {
+	got := endpoint(t, http.StatusNoContent)
+	t.Setenv("CODEX_HOOK_WEBHOOK_OUTBOX", "true")
+	t.Setenv("CODEX_HOOK_WEBHOOK_MAX_AGE", "1h")
+	// An event queued a day ago, as outbox names them.
+	old := filepath.Join(outboxDir(), fmt.Sprintf("%020d-00000000.msg", time.Now().Add(-24*time.Hour).UnixNano()))
+	if err := os.MkdirAll(filepath.Dir(old), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(old, []byte(`{"event":"session-start","event_id":"old","body":{}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := handle(context.Background(), hooktest.SessionStart().Build()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(got); n != 1 {
+		t.Errorf("%d events delivered, want only the new one", n)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("the expired event is still queued: %v", err)
+	}
+}
+
+func TestHandleCloudEvents(t *testing.T) {
+	got := endpoint(t, http.StatusNoContent)
+	payload := hooktest.ToolCallStarted().WithSessionID("s1").With("hook_invocation_id", "inv-1").Build()
+
+	// Structured: the event is the body.
+	t.Setenv("CODEX_HOOK_WEBHOOK_FORMAT", "cloudevents")
+	if resp, err := handle(context.Background(), payload); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle = %+v, %v; want allow", resp, err)
+	}
+	r := <-got
+	var ce cloudevents.CloudEvent
+	if err := json.Unmarshal(r.body, &ce); err != nil {
+		t.Fatalf("body %s isn't a CloudEvent: %v", r.body, err)
+	}
+	if ce.ID != "inv-1" || ce.Type != "dev.xcodex.hook.tool-call-started" || ce.Subject != "s1" || ce.Validate() != nil {
+		t.Errorf("event = %+v", ce)
+	}
+	if ct := r.header.Get("Content-Type"); ct != cloudevents.ContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !webhook.Verify([]byte("s3cret"), r.body, r.header.Get(webhook.SignatureHeader)) || r.header.Get("X-Hook-Event") != payload.EventType() {
+		t.Errorf("headers = %v, want the signature and event headers still", r.header)
+	}
+
+	// Binary: the payload is the body, the attributes are headers.
+	t.Setenv("CODEX_HOOK_WEBHOOK_FORMAT", "cloudevents-binary")
+	handle(context.Background(), payload)
+	r = <-got
+	ce, err := cloudevents.FromHeader(r.header, r.body)
+	if err != nil || ce.ID != "inv-1" || ce.Type != "dev.xcodex.hook.tool-call-started" || ce.DataContentType != "application/json" {
+		t.Errorf("FromHeader = %+v, %v", ce, err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(r.body, &body); err != nil || body["session_id"] != "s1" {
+		t.Errorf("body = %s, want the payload", r.body)
+	}
+	if !webhook.Verify([]byte("s3cret"), r.body, r.header.Get(webhook.SignatureHeader)) {
+		t.Errorf("signature %q doesn't verify", r.header.Get(webhook.SignatureHeader))
+	}
+}
+
+func TestFormat(t *testing.T) {
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_WEBHOOK_URL", "https://example.invalid")
+	t.Setenv("CODEX_HOOK_WEBHOOK_FORMAT", "cloudevents")
+	defer func(args []string) { os.Args = args }(os.Args)
+
+	// The command line wins over the config.
+	for args, want := range map[string]string{
+		"":                            "cloudevents",
+		"--format json":               "json",
+		"--format=cloudevents-binary": "cloudevents-binary",
+		"--verbose --format json":     "json",
+	} {
+		os.Args = append([]string{"forward_webhook"}, strings.Fields(args)...)
+		if cfg, err := loadConfig(); err != nil || cfg.Format != want {
+			t.Errorf("%q: format = %+v, %v; want %s", args, cfg, err, want)
+		}
+	}
+	// A trailing --format without a value is left alone.
+	os.Args = []string{"forward_webhook", "--format"}
+	if cfg, err := loadConfig(); err != nil || cfg.Format != "cloudevents" {
+		t.Errorf("trailing --format: format = %+v, %v", cfg, err)
+	}
+
+	os.Args = []string{"forward_webhook", "--format", "xml"}
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), `not "xml"`) {
+		t.Errorf("--format xml: error = %v", err)
+	}
+	os.Args = []string{"forward_webhook"}
+	t.Setenv("CODEX_HOOK_WEBHOOK_FORMAT", "yaml")
+	if _, err := loadConfig(); err == nil {
+		t.Error("format = yaml loaded")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// maxMessage bounds an annotation's message, in bytes; the runner cuts long ones anyway.
+const maxMessage = 1000
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response. Outside GitHub Actions
+	// the hook does nothing; inside, failures are reported on stderr and the event is still allowed.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `gha_annotate --self-test`, that the state directory is writable.
+func selfTest() []hooksdk.Check {
+	return []hooksdk.Check{hooksdk.CheckWritable("state directory", stateDir())}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	if !gha.InActions() {
+		return hooksdk.Allow(), nil
+	}
+	hooklog.Bind(payload)
+
+	if a, kind, ok := annotation(payload); ok && gha.Enabled(kind) {
+		if err := gha.Emit(a); err != nil {
+			hooklog.Errorf("write annotation: %v", err)
+		}
+	}
+
+	act, err := gha.NewTracker(stateDir()).Observe(payload)
+	if err != nil {
+		hooklog.Errorf("record session activity: %v", err)
+		return hooksdk.Allow(), nil
+	}
+	if act == nil {
+		return hooksdk.Allow(), nil
+	}
+	annotations, err := act.Annotations()
+	if err != nil {
+		hooklog.Warnf("read annotations: %v", err)
+	}
+	if err := gha.AppendSummary(act.Summary(annotations)); errors.Is(err, gha.ErrNoSummary) {
+		hooklog.Warnf("no step summary to write to: %v", err)
+	} else if err != nil {
+		hooklog.Errorf("write step summary: %v", err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+// annotation describes an event worth annotating: a failed patch, any other failed or aborted
+// tool call, or an approval request. Guard denials are annotated by guard_exec and guard_secrets,
+// since only they know a call was blocked.
+func annotation(p *hooksdk.HookPayload) (gha.Annotation, string, bool) {
+	str := func(key string) string {
+		s, _ := hooksdk.StringField(p.RawPayload, key)
+		return s
+	}
+	switch p.EventType() {
+	case "approval-requested":
+		msg := str("reason")
+		if len(p.Command) > 0 {
+			msg = strings.TrimSpace(msg + "\n$ " + strings.Join(p.Command, " "))
+		}
+		if msg == "" {
+			msg = str("message")
+		}
+		title := "Approval requested"
+		if kind := str("kind"); kind != "" {
+			title += " (" + kind + ")"
+		}
+		return gha.Annotation{Level: gha.Notice, Title: title, Message: clip(msg)}, gha.KindApproval, true
+	case "tool-call-finished":
+		if !gha.Failed(p) {
+			break
+		}
+		verb := "failed"
+		if str("status") == "aborted" {
+			verb = "was aborted"
+		}
+		output := strings.TrimSpace(str("output_preview"))
+		if paths, ok := gha.Patch(p); ok {
+			a := gha.Annotation{Level: gha.Error, Title: "Patch " + verb, Message: output}
+			if len(paths) > 0 {
+				a.File = gha.WorkspacePath(paths[0], p.WorkingDir())
+			}
+			if len(paths) > 1 {
+				a.Message = strings.TrimSpace(a.Message + "\nFiles: " + strings.Join(paths, ", "))
+			}
+			if a.Message == "" {
+				a.Message = "The patch was not applied."
+			}
+			a.Message = clip(a.Message)
+			return a, gha.KindPatchFailure, true
+		}
+		tool := str("tool_name")
+		if tool == "" {
+			tool = "Tool call"
+		}
+		msg := output
+		if cmd := command(p.ToolInput); cmd != "" {
+			msg = strings.TrimSpace("$ " + cmd + "\n" + msg)
+		}
+		return gha.Annotation{Level: gha.Warning, Title: tool + " " + verb, Message: clip(msg)}, gha.KindToolFailure, true
+	}
+	return gha.Annotation{}, "", false
+}
+
+// command is the shell command of a tool call, as a string or an argv.
+func command(input any) string {
+	v, ok := input.(map[string]any)
+	if !ok {
+		return ""
+	}
+	switch c := v["command"].(type) {
+	case string:
+		return c
+	case []any:
+		parts := make([]string, len(c))
+		for i, item := range c {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, " ")
+	}
+	return ""
+}
+
+func clip(s string) string {
+	return hooksdk.TruncateString(s, maxMessage)
+}
+
+// stateDir is CODEX_HOOK_GHA_STATE_DIR, or `$CODEX_HOME/hooks/gha`; it holds per-session activity.
+func stateDir() string {
+	if dir := os.Getenv("CODEX_HOOK_GHA_STATE_DIR"); dir != "" {
+		return dir
+	}
+	return hooksdk.Environ().Path("hooks", "gha")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// runner sets up a GitHub Actions job in a temporary directory and returns it.
+func runner(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("CODEX_HOME", filepath.Join(dir, "home"))
+	t.Setenv("RUNNER_TEMP", dir)
+	t.Setenv("GITHUB_WORKSPACE", filepath.Join(dir, "repo"))
+	t.Setenv("GITHUB_STEP_SUMMARY", filepath.Join(dir, "summary.md"))
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATIONS", "")
+	t.Setenv("CODEX_HOOK_GHA_STATE_DIR", "")
+	return dir
+}
+
+// annotations reads the annotations the hook wrote.
+func annotations(t *testing.T) []gha.Annotation {
+	t.Helper()
+	f, err := os.Open(gha.AnnotationsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []gha.Annotation
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		a, ok := gha.ParseAnnotation(sc.Text())
+		if !ok {
+			t.Errorf("not an annotation: %q", sc.Text())
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+func run(t *testing.T, b *hooktest.Builder) {
+	t.Helper()
+	resp, err := handle(context.Background(), b.Build())
+	if err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle = %+v, %v; want allow", resp, err)
+	}
+}
+
+func TestHandleOutsideActions(t *testing.T) {
+	dir := runner(t)
+	t.Setenv("GITHUB_ACTIONS", "")
+	run(t, hooktest.ToolCallFinished().WithToolName("apply_patch").With("success", false))
+	run(t, hooktest.SessionEnd())
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("outside Actions the hook wrote %v", entries)
+	}
+}
+
+func TestHandleSession(t *testing.T) {
+	dir := runner(t)
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATE", "patch-failure,tool-failure")
+	cwd := filepath.Join(dir, "repo", "pkg")
+	patch := "*** Begin Patch\n*** Update File: a.go\n@@\n-x\n+y\n*** Update File: b.go\n@@\n-x\n+y\n*** End Patch\n"
+	events := []*hooktest.Builder{
+		hooktest.SessionStart(),
+		hooktest.ToolCallFinished().WithCommand("go test ./...").With("success", false).With("output_preview", "FAIL\tpkg"),
+		hooktest.ToolCallFinished().WithToolName("apply_patch").With("tool_input", map[string]any{"input": patch}).
+			With("success", false).With("output_preview", "context not found"),
+		// Successful calls and approvals (not enabled) aren't annotated.
+		hooktest.ToolCallFinished(),
+		hooktest.ApprovalRequested(),
+		hooktest.SessionEnd(),
+	}
+	for _, b := range events {
+		run(t, b.WithCwd(cwd))
+	}
+
+	got := annotations(t)
+	if len(got) != 2 {
+		t.Fatalf("annotations = %+v, want 2", got)
+	}
+	if a := got[0]; a.Level != gha.Warning || a.Title != "Bash failed" || a.Message != "$ go test ./...\nFAIL\tpkg" {
+		t.Errorf("tool failure = %+v", a)
+	}
+	if a := got[1]; a.Level != gha.Error || a.Title != "Patch failed" || a.File != "pkg/a.go" || a.Message != "context not found\nFiles: a.go, b.go" {
+		t.Errorf("patch failure = %+v", a)
+	}
+
+	summary, err := os.ReadFile(filepath.Join(dir, "summary.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"### xcodex session test-session", "| Tool calls | 3 (2 failed) |", "| Annotations | 2 |", "| error | pkg/a.go | Patch failed: context not found<br>Files: a.go, b.go |"} {
+		if !strings.Contains(string(summary), want) {
+			t.Errorf("summary lacks %q:\n%s", want, summary)
+		}
+	}
+}
+
+func TestAnnotation(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *hooktest.Builder
+		kind  string
+		want  gha.Annotation
+	}{
+		{"approval", hooktest.ApprovalRequested().WithCommand("git push").With("reason", "network").With("kind", "exec"),
+			gha.KindApproval, gha.Annotation{Level: gha.Notice, Title: "Approval requested (exec)", Message: "network\n$ git push"}},
+		{"aborted call", hooktest.ToolCallFinished().With("status", "aborted").With("success", nil).With("tool_name", nil),
+			gha.KindToolFailure, gha.Annotation{Level: gha.Warning, Title: "Tool call was aborted", Message: "$ go test ./...\nok"}},
+		{"patch without output", hooktest.ToolCallFinished().WithToolName("apply_patch").With("success", false).With("output_preview", nil),
+			gha.KindPatchFailure, gha.Annotation{Level: gha.Error, Title: "Patch failed", Message: "The patch was not applied."}},
+		{"long output", hooktest.ToolCallFinished().With("success", false).With("tool_input", nil).With("output_preview", strings.Repeat("x", 5000)),
+			gha.KindToolFailure, gha.Annotation{Level: gha.Warning, Title: "Bash failed", Message: hooksdk.TruncateString(strings.Repeat("x", 5000), maxMessage)}},
+	}
+	for _, tt := range tests {
+		a, kind, ok := annotation(tt.event.Build())
+		if !ok || kind != tt.kind || a != tt.want {
+			t.Errorf("%s: annotation = %+v, %s, %v; want %+v, %s", tt.name, a, kind, ok, tt.want, tt.kind)
+		}
+	}
+	for _, b := range []*hooktest.Builder{hooktest.ToolCallFinished(), hooktest.SessionStart(), hooktest.ToolCallStarted()} {
+		if a, _, ok := annotation(b.Build()); ok {
+			t.Errorf("%s: annotation = %+v, want none", b.Build().EventType(), a)
+		}
+	}
+}
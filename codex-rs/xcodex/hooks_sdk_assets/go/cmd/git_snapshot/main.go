@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response. When git fails,
+	// handle logs it and allows the edit without a snapshot.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest))
+}
+
+// selfTest checks, for `git_snapshot --self-test`, that git is installed.
+func selfTest() []hooksdk.Check {
+	return []hooksdk.Check{hooksdk.CheckCommand("git", "git")}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	if payload.EventType() != "tool-call-finished" {
+		return hooksdk.Allow(), nil
+	}
+	paths := gitsnap.TouchedPaths(payload.ToolInput)
+	if len(paths) == 0 || payload.WorkingDir() == "" {
+		return hooksdk.Allow(), nil
+	}
+
+	opts := gitsnap.Options{
+		Dir:     payload.WorkingDir(),
+		Ref:     os.Getenv("CODEX_HOOK_SNAPSHOT_REF"),
+		Paths:   paths,
+		Message: message(payload, paths),
+	}
+	// CODEX_HOOK_SNAPSHOT_ALL=1 records the whole working tree rather than just the touched files.
+	if os.Getenv("CODEX_HOOK_SNAPSHOT_ALL") == "1" {
+		opts.Paths = nil
+	}
+	res, err := gitsnap.Take(ctx, opts)
+	if err != nil {
+		hooklog.Errorf("snapshot: %v", err)
+		return hooksdk.Allow(), nil
+	}
+	if res != nil {
+		hooklog.Infof("snapshot %s records %d file(s)", shortID(res.Commit), len(res.Changes))
+	}
+	return hooksdk.Allow(), nil
+}
+
+// message is the snapshot's commit message: what ran, in which session.
+func message(p *hooksdk.HookPayload, paths []string) string {
+	raw := p.RawPayload
+	str := func(key string) string {
+		s, _ := hooksdk.StringField(raw, key)
+		return s
+	}
+	tool := str("tool_name")
+	if tool == "" {
+		tool = "tool call"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "xcodex snapshot after %s (%d file(s))\n\n", tool, len(paths))
+	fmt.Fprintf(&b, "Session: %s\n", p.SessionID())
+	for _, f := range []struct{ label, key string }{
+		{"Turn", "turn_id"},
+		{"Call", "tool_use_id"},
+		{"Status", "status"},
+	} {
+		if v := str(f.key); v != "" {
+			fmt.Fprintf(&b, "%s: %s\n", f.label, v)
+		}
+	}
+	if ok, found := hooksdk.BoolField(raw, "success"); found {
+		fmt.Fprintf(&b, "Success: %t\n", ok)
+	}
+	if ts := str("timestamp"); ts != "" {
+		fmt.Fprintf(&b, "Time: %s\n", ts)
+	}
+	return b.String()
+}
+
+func shortID(oid string) string {
+	if len(oid) > 12 {
+		return oid[:12]
+	}
+	return oid
+}
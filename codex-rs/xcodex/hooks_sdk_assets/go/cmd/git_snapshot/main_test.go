@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestHandleSnapshotsPatchedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("CODEX_HOOK_SNAPSHOT_REF", "")
+	t.Setenv("CODEX_HOOK_SNAPSHOT_ALL", "")
+	dir := t.TempDir()
+	git(t, dir, "init", "-q")
+	git(t, dir, "config", "user.name", "Test")
+	git(t, dir, "config", "user.email", "test@example.com")
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git(t, dir, "add", ".")
+	git(t, dir, "commit", "-q", "-m", "initial")
+	head := git(t, dir, "rev-parse", "HEAD")
+
+	// What the patch did, and a change the agent didn't make.
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("mine\n"), 0o644)
+	patch := "*** Begin Patch\n*** Update File: main.go\n@@\n+func main() {}\n*** End Patch"
+	payload := hooktest.ToolCallFinished().WithCwd(dir).WithSessionID("s1").WithToolName("apply_patch").
+		With("tool_input", map[string]any{"input": patch}).Build()
+	resp, err := handle(context.Background(), payload)
+	if err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle = %+v, %v", resp, err)
+	}
+
+	log := git(t, dir, "log", "--format=%B", "refs/xcodex/snapshots")
+	for _, want := range []string{"xcodex snapshot after apply_patch (1 file(s))", "Session: s1", "Call: call-1", "Success: true", "Files:\n  M main.go"} {
+		if !strings.Contains(log, want) {
+			t.Errorf("snapshot log lacks %q:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "notes.txt") {
+		t.Errorf("snapshot records a file the tool didn't touch:\n%s", log)
+	}
+	if got := git(t, dir, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD moved to %s", got)
+	}
+	if status := git(t, dir, "status", "--porcelain"); status != "M main.go\n?? notes.txt" {
+		t.Errorf("status = %q", status)
+	}
+
+	// Outside a repository, and for events without files, nothing happens.
+	for _, p := range []*hooksdk.HookPayload{
+		hooktest.ToolCallFinished().WithCwd(t.TempDir()).With("tool_input", map[string]any{"input": patch}).Build(),
+		hooktest.ToolCallFinished().WithCwd(dir).Build(),
+		hooktest.ToolCallStarted().WithCwd(dir).With("tool_input", map[string]any{"input": patch}).Build(),
+	} {
+		if resp, err := handle(context.Background(), p); err != nil || resp.Decision != hooksdk.DecisionAllow {
+			t.Errorf("handle = %+v, %v", resp, err)
+		}
+	}
+}
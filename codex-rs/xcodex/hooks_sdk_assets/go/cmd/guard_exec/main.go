@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+	"example.com/xcodex/hooks-sdk/hooksdk/guard"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/suppress"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(test(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	// Run parses the event payload, calls handle, and writes the response. A deny response makes
+	// the hook exit 2, which blocks the command; everything but shell commands is allowed. A
+	// failure denies too, so a payload the guard can't read isn't let through unchecked.
+	hooksdk.Run(handler(), hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailClosed))
+}
+
+// handler is handle, behind suppress.Middleware when CODEX_HOOK_GUARD_SUPPRESS (a Go duration,
+// e.g. `1m`) is set: a command the agent retries within it after a deny is denied again without
+// being checked, logged, or annotated again.
+func handler() hooksdk.Handler {
+	v := os.Getenv("CODEX_HOOK_GUARD_SUPPRESS")
+	if v == "" {
+		return handle
+	}
+	window, err := time.ParseDuration(v)
+	if err != nil || window < 0 {
+		hooklog.Warnf("ignoring CODEX_HOOK_GUARD_SUPPRESS %q: not a duration", v)
+		return handle
+	}
+	if window == 0 {
+		return handle
+	}
+	return hooksdk.Chain(handle, suppress.Middleware(suppress.New(suppress.DefaultPath()), suppress.ActionKey, window))
+}
+
+// selfTest checks, for `guard_exec --self-test`, that the rule config is valid and git, which
+// protected-branch rules ask for the current branch, is installed.
+func selfTest() []hooksdk.Check {
+	path := configPath()
+	_, err := readConfig(path)
+	return []hooksdk.Check{
+		hooksdk.CheckConfigFile(path, err),
+		hooksdk.CheckCommand("git", "git"),
+	}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	var check func(*guard.Engine) guard.Verdict
+	switch payload.EventType() {
+	case "approval-requested":
+		if len(payload.Command) == 0 {
+			return hooksdk.Allow(), nil
+		}
+		check = func(e *guard.Engine) guard.Verdict { return e.CheckArgv(payload.Command) }
+	case "tool-call-started":
+		// Shell tools carry the command line as a string, or an argv like approvals do.
+		command, ok := hooksdk.Field[any](payload.RawPayload, "tool_input.command")
+		if !ok {
+			return hooksdk.Allow(), nil
+		}
+		switch c := command.(type) {
+		case string:
+			check = func(e *guard.Engine) guard.Verdict { return e.Check(c) }
+		default:
+			// Anything but an array of strings yields an empty argv, which gets the `unknown`
+			// verdict.
+			var argv []string
+			items, _ := c.([]any)
+			for _, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					argv = nil
+					break
+				}
+				argv = append(argv, s)
+			}
+			check = func(e *guard.Engine) guard.Verdict { return e.CheckArgv(argv) }
+		}
+	default:
+		return hooksdk.Allow(), nil
+	}
+
+	engine := guard.New(loadConfig(payload))
+	engine.CurrentBranch = func() string { return currentBranch(ctx, payload.WorkingDir()) }
+
+	v := check(engine)
+	msg := fmt.Sprintf("guard_exec rule %s: %s", v.Rule, v.Reason)
+	switch v.Action {
+	case guard.Deny:
+		hooklog.Warnf("denied %q: %s (%s)", v.Command, v.Reason, v.Code)
+		if gha.Enabled(gha.KindDenial) {
+			a := gha.Annotation{
+				Level:   gha.Error,
+				Title:   "guard_exec denied a command",
+				Message: fmt.Sprintf("%s: %s\n$ %s", v.Rule, v.Reason, v.Command),
+			}
+			if err := gha.Emit(a); err != nil {
+				hooklog.Errorf("write annotation: %v", err)
+			}
+		}
+		return hooksdk.Deny(msg, hooksdk.WithReasonCode(v.Code), hooksdk.WithRule(v.Rule), hooksdk.WithSeverity(v.Severity)), nil
+	case guard.Ask:
+		resp := hooksdk.Ask(msg + ". Run it anyway?")
+		return resp.AddReason(hooksdk.Reason{Code: v.Code, Message: msg, Rule: v.Rule, Severity: v.Severity}), nil
+	}
+	return hooksdk.Allow(), nil
+}
+
+// loadConfig reads CODEX_HOOK_GUARD_CONFIG, or `$CODEX_HOME/hooks/config/guard_exec.toml` (the
+// older `$CODEX_HOME/hooks/guard_exec.toml` is still read when that doesn't exist), then a trusted
+// project's `.xcodex/hooks/guard_exec.toml` over it, with CODEX_HOOK_GUARD_EXEC_* overrides.
+// Without a config file (or with a broken one) the built-in rules still apply; untrusted project
+// config is reported and skipped.
+func loadConfig(payload *hooksdk.HookPayload) *guard.Config {
+	var file guard.File
+	err := hooksdk.LoadProjectConfigFile(configPath(), payload, "guard_exec", &file)
+	if errors.Is(err, hooksdk.ErrUntrustedProject) {
+		hooklog.Warnf("%v; using the global rules only", err)
+		err = nil
+	}
+	var cfg *guard.Config
+	if err == nil {
+		cfg, err = file.Config()
+	}
+	if err != nil {
+		hooklog.Errorf("load config: %v; using the built-in rules only", err)
+		return guard.DefaultConfig()
+	}
+	return cfg
+}
+
+// test is `guard_exec test`: it checks the examples of corpus files (see guard.Corpus) against the
+// rule config, printing each mismatch, and exits 1 if there is one. With --update it rewrites the
+// expectations to the verdicts the rules give now instead.
+func test(args []string, stdout, stderr io.Writer) int {
+	fl := flag.NewFlagSet("guard_exec test", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	config := fl.String("config", "", "rule config (default: CODEX_HOOK_GUARD_CONFIG, or $CODEX_HOME/hooks/config/guard_exec.toml)")
+	update := fl.Bool("update", false, "rewrite the corpus expectations to the verdicts the rules give")
+	branch := fl.String("branch", "", "the current git branch, for force pushes without a refspec (default none: they are asked about)")
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: guard_exec test [flags] CORPUS...\n\nChecks each example of the corpus files, lines like `deny rm-root $ rm -rf /`, against the rules.\n\n")
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fl.NArg() == 0 {
+		fl.Usage()
+		return 2
+	}
+	path := *config
+	if path == "" {
+		path = configPath()
+	}
+	cfg, err := readConfig(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "guard_exec: %v\n", err)
+		return 1
+	}
+	engine := guard.New(cfg)
+	if *branch != "" {
+		engine.CurrentBranch = func() string { return *branch }
+	}
+
+	total, failed := 0, 0
+	for _, file := range fl.Args() {
+		corpus, err := guard.LoadCorpus(file)
+		if err != nil {
+			fmt.Fprintf(stderr, "guard_exec: %v\n", err)
+			return 1
+		}
+		results := engine.Test(corpus)
+		total += len(results)
+		if *update {
+			if n := corpus.Update(results); n > 0 {
+				if err := os.WriteFile(file, corpus.Bytes(), 0o644); err != nil {
+					fmt.Fprintf(stderr, "guard_exec: %v\n", err)
+					return 1
+				}
+				fmt.Fprintf(stdout, "updated %d example(s) in %s\n", n, file)
+			}
+			continue
+		}
+		for _, r := range results {
+			if !r.OK() {
+				failed++
+				fmt.Fprintf(stdout, "%s:%d: %s\n", file, r.Line, r)
+			}
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(stdout, "FAIL: %d of %d example(s) got another verdict\n", failed, total)
+		return 1
+	}
+	if !*update {
+		fmt.Fprintf(stdout, "ok: %d example(s)\n", total)
+	}
+	return 0
+}
+
+func configPath() string {
+	path := os.Getenv("CODEX_HOOK_GUARD_CONFIG")
+	if path == "" {
+		path = hooksdk.ConfigPath("guard_exec")
+		if legacy := hooksdk.Environ().Path("hooks", "guard_exec.toml"); !exists(path) && exists(legacy) {
+			path = legacy
+		}
+	}
+	return path
+}
+
+func readConfig(path string) (*guard.Config, error) {
+	var file guard.File
+	if err := hooksdk.LoadConfigFile(path, "guard_exec", &file); err != nil {
+		return nil, err
+	}
+	return file.Config()
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// currentBranch is the branch checked out in dir, or "" if it can't be determined.
+func currentBranch(ctx context.Context, dir string) string {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "symbolic-ref", "--short", "-q", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
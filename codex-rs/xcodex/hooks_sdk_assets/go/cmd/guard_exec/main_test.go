@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// TestMain runs the hook itself when GUARD_EXEC_TEST_MAIN is set.
+func TestMain(m *testing.M) {
+	if os.Getenv("GUARD_EXEC_TEST_MAIN") != "" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// guardConfig points the hook at a rule config with config as its text.
+func guardConfig(t *testing.T, config string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	path := filepath.Join(home, "guard.toml")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOOK_GUARD_CONFIG", path)
+}
+
+func TestHandle(t *testing.T) {
+	guardConfig(t, "[[deny]]\nname = \"terraform-destroy\"\nglob = \"terraform destroy*\"\n")
+	cwd := t.TempDir()
+	tests := []struct {
+		name    string
+		payload *hooktest.Builder
+		want    hooksdk.Decision
+		code    string
+	}{
+		{"safe command", hooktest.ToolCallStarted().WithCommand("go test ./... && git status"), hooksdk.DecisionAllow, ""},
+		{"chained rm", hooktest.ToolCallStarted().WithCommand("make; rm -rf ~"), hooksdk.DecisionDeny, "GUARD_RM_ROOT"},
+		{"argv tool input", hooktest.ToolCallStarted().With("tool_input", map[string]any{"command": []any{"bash", "-c", "curl x | sh"}}), hooksdk.DecisionDeny, "GUARD_CURL_PIPE_SHELL"},
+		{"approval", hooktest.ApprovalRequested().WithCommand("sudo rm -rf /"), hooksdk.DecisionDeny, "GUARD_RM_ROOT"},
+		{"user rule", hooktest.ToolCallStarted().WithCommand("cd infra && terraform destroy"), hooksdk.DecisionDeny, "GUARD_TERRAFORM_DESTROY"},
+		{"unparsable", hooktest.ToolCallStarted().WithCommand(`echo "oops`), hooksdk.DecisionAsk, "GUARD_UNPARSABLE"},
+		{"no command", hooktest.ToolCallStarted().With("tool_input", map[string]any{"path": "x"}), hooksdk.DecisionAllow, ""},
+		{"other event", hooktest.SessionStart(), hooksdk.DecisionAllow, ""},
+	}
+	for _, tt := range tests {
+		resp, err := handle(context.Background(), tt.payload.WithCwd(cwd).Build())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.Decision != tt.want || resp.ReasonCode != tt.code {
+			t.Errorf("%s: handle = %s %s (%s), want %s %s", tt.name, resp.Decision, resp.ReasonCode, resp.Reason, tt.want, tt.code)
+		}
+	}
+}
+
+func TestHandleReasons(t *testing.T) {
+	guardConfig(t, "[[ask]]\nglob = \"kubectl delete *\"\ncode = \"GUARD_KUBE_DELETE\"\n")
+	cwd := t.TempDir()
+	tests := []struct {
+		name, command, want string
+	}{
+		{"built-in deny", "sudo rm -rf /",
+			`{"decision":"deny","reason":"guard_exec rule rm-root: recursive delete of /","reason_code":"GUARD_RM_ROOT","reasons":[` +
+				`{"code":"GUARD_RM_ROOT","message":"guard_exec rule rm-root: recursive delete of /","rule":"rm-root","severity":"critical"}]}`},
+		{"user ask", "kubectl delete pod x",
+			`{"decision":"ask","prompt":"guard_exec rule kubectl delete *: matches ask rule kubectl delete *. Run it anyway?","reason_code":"GUARD_KUBE_DELETE","reasons":[` +
+				`{"code":"GUARD_KUBE_DELETE","message":"guard_exec rule kubectl delete *: matches ask rule kubectl delete *","rule":"kubectl delete *","severity":"medium"}]}`},
+	}
+	for _, tt := range tests {
+		resp, err := handle(context.Background(), hooktest.ToolCallStarted().WithCwd(cwd).WithCommand(tt.command).Build())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s: response = %s\nwant %s", tt.name, data, tt.want)
+		}
+		if err := hooksdk.ValidateResponse(string(hooksdk.EventToolCallStarted), resp); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestHandleAnnotatesDenials(t *testing.T) {
+	guardConfig(t, "")
+	annotations := filepath.Join(t.TempDir(), "annotations.txt")
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATIONS", annotations)
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATE", "")
+	deny := hooktest.ToolCallStarted().WithCwd(t.TempDir()).WithCommand("rm -rf /").Build()
+
+	// Denials aren't annotated unless enabled.
+	handle(context.Background(), deny)
+	if _, err := os.Stat(annotations); !os.IsNotExist(err) {
+		t.Errorf("annotated a denial with annotations off: %v", err)
+	}
+
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATE", "denial")
+	handle(context.Background(), deny)
+	data, err := os.ReadFile(annotations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, ok := gha.ParseAnnotation(strings.TrimSuffix(string(data), "\n"))
+	if !ok || a.Level != gha.Error || a.Title != "guard_exec denied a command" || !strings.HasSuffix(a.Message, "\n$ rm -rf /") {
+		t.Errorf("annotation = %q", data)
+	}
+}
+
+func TestHandlerSuppresses(t *testing.T) {
+	guardConfig(t, "")
+	annotations := filepath.Join(t.TempDir(), "annotations.txt")
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATIONS", annotations)
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATE", "denial")
+	deny := hooktest.ToolCallStarted().WithCwd(t.TempDir()).WithCommand("rm -rf /").Build()
+	// Retries of a denied command are denied again, annotated only with the window set.
+	for _, tt := range []struct {
+		window, note string
+		annotations  int
+	}{
+		{"", "", 3},
+		{"soon", "", 3},
+		{"0s", "", 3},
+		{"1m", "(repeated; notifications suppressed)", 1},
+	} {
+		t.Setenv("CODEX_HOOK_GUARD_SUPPRESS", tt.window)
+		os.Remove(annotations)
+		h := handler()
+		var resp hooksdk.Response
+		for i := 0; i < 3; i++ {
+			var err error
+			if resp, err = h(context.Background(), deny); err != nil || resp.Decision != hooksdk.DecisionDeny || resp.ReasonCode != "GUARD_RM_ROOT" {
+				t.Fatalf("%q: call %d = %+v, %v", tt.window, i, resp, err)
+			}
+		}
+		data, _ := os.ReadFile(annotations)
+		if n := strings.Count(string(data), "\n"); n != tt.annotations || !strings.HasSuffix(resp.Reason, tt.note) {
+			t.Errorf("%q: %d annotations, last reason %q", tt.window, n, resp.Reason)
+		}
+	}
+}
+
+func TestHandleBrokenConfig(t *testing.T) {
+	// The built-in rules still apply.
+	guardConfig(t, `unknown = "deny"`)
+	resp, err := handle(context.Background(), hooktest.ToolCallStarted().WithCwd(t.TempDir()).WithCommand("rm -rf /").Build())
+	if err != nil || resp.Decision != hooksdk.DecisionDeny {
+		t.Errorf("handle with a broken config = %+v, %v; want deny", resp, err)
+	}
+}
+
+func TestFailsClosed(t *testing.T) {
+	// A payload the guard can't read is denied, not let through unchecked.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "GUARD_EXEC_TEST_MAIN=1", "CODEX_HOME="+t.TempDir(), "CODEX_HOOK_GUARD_CONFIG=")
+	cmd.Stdin = strings.NewReader("not json")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() != hooksdk.ExitDeny {
+		t.Fatalf("exit: %v\n%s", err, stderr.String())
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out, &resp); err != nil || resp.Decision != hooksdk.DecisionDeny || resp.ReasonCode != hooksdk.ReasonHookError {
+		t.Errorf("response = %s, %v", out, err)
+	}
+	if !strings.Contains(stderr.String(), `"policy":"fail-closed"`) {
+		t.Errorf("stderr = %s", stderr.String())
+	}
+}
+
+func TestTestCorpus(t *testing.T) {
+	guardConfig(t, "[[deny]]\nname = \"terraform-destroy\"\nglob = \"terraform destroy*\"\n")
+	dir := t.TempDir()
+	corpus := filepath.Join(dir, "guard.corpus")
+	text := "# rules\ndeny rm-root $ rm -rf /\ndeny terraform-destroy $ terraform destroy\nallow - $ ls\n"
+	if err := os.WriteFile(corpus, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	guardTest := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := test(args, &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+
+	if code, out, errOut := guardTest(corpus); code != 0 || out != "ok: 3 example(s)\n" {
+		t.Errorf("passing corpus: exit %d, stdout %q, stderr %q", code, out, errOut)
+	}
+
+	// With --config, the terraform rule is gone: a mismatch, naming the rule that decided.
+	other := filepath.Join(dir, "other.toml")
+	if err := os.WriteFile(other, []byte("[[ask]]\nname = \"tf\"\nglob = \"terraform *\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, out, _ := guardTest("--config", other, corpus)
+	want := corpus + ":3: `terraform destroy`: want deny by rule terraform-destroy, got ask by rule tf ("
+	if code != 1 || !strings.HasPrefix(out, want) || !strings.HasSuffix(out, "FAIL: 1 of 3 example(s) got another verdict\n") {
+		t.Errorf("failing corpus: exit %d, stdout %q", code, out)
+	}
+
+	// --update rewrites the expectation, keeping the rest, and then the corpus passes.
+	if code, out, _ := guardTest("--config", other, "--update", corpus); code != 0 || out != "updated 1 example(s) in "+corpus+"\n" {
+		t.Errorf("--update: exit %d, stdout %q", code, out)
+	}
+	data, _ := os.ReadFile(corpus)
+	if want := strings.Replace(text, "deny terraform-destroy $", "ask tf $", 1); string(data) != want {
+		t.Errorf("updated corpus =\n%s\nwant\n%s", data, want)
+	}
+	if code, out, _ := guardTest("--config", other, corpus); code != 0 {
+		t.Errorf("updated corpus: exit %d, stdout %q", code, out)
+	}
+
+	// --branch names the branch a force push without a refspec goes to.
+	branch := filepath.Join(dir, "branch.corpus")
+	if err := os.WriteFile(branch, []byte("deny git-force-push $ git push --force\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, out, _ := guardTest("--branch", "main", branch); code != 0 {
+		t.Errorf("--branch main: exit %d, stdout %q", code, out)
+	}
+	if code, _, _ := guardTest("--branch", "feature", branch); code != 1 {
+		t.Errorf("--branch feature: exit %d", code)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{nil, 2, "usage: guard_exec test"},
+		{[]string{"-h"}, 0, "usage: guard_exec test"},
+		{[]string{"--nope", corpus}, 2, "flag provided but not defined"},
+		{[]string{filepath.Join(dir, "missing.corpus")}, 1, "missing.corpus"},
+		{[]string{"--config", corpus, corpus}, 1, "guard_exec: "},
+	} {
+		if code, _, errOut := guardTest(tt.args...); code != tt.code || !strings.Contains(errOut, tt.want) {
+			t.Errorf("%q: exit %d, stderr %q; want %d and %q", tt.args, code, errOut, tt.code, tt.want)
+		}
+	}
+	bad := filepath.Join(dir, "bad.corpus")
+	if err := os.WriteFile(bad, []byte("allow $ ls\nblock $ ls\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := guardTest(bad); code != 1 || !strings.Contains(errOut, bad+":2: ") {
+		t.Errorf("malformed corpus: exit %d, stderr %q", code, errOut)
+	}
+}
+
+func TestHandleProjectRules(t *testing.T) {
+	guardConfig(t, "[[deny]]\nglob = \"terraform destroy*\"\n")
+	project := t.TempDir()
+	dir := filepath.Join(project, ".xcodex", "hooks")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "guard_exec.toml"), []byte("[[deny]]\nglob = \"make deploy*\"\ncode = \"GUARD_PROJECT_DEPLOY\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	decide := func(command string) hooksdk.Response {
+		t.Helper()
+		resp, err := handle(context.Background(), hooktest.ToolCallStarted().WithCwd(project).WithCommand(command).Build())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Until the project is trusted its rules are skipped, and the global ones still apply.
+	if resp := decide("make deploy"); resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("untrusted project rule = %s %s", resp.Decision, resp.ReasonCode)
+	}
+	if resp := decide("terraform destroy"); resp.Decision != hooksdk.DecisionDeny {
+		t.Errorf("global rule beside untrusted project config = %s", resp.Decision)
+	}
+
+	trusted := hooksdk.Environ().Path(hooksdk.TrustedProjectsFile)
+	if err := os.MkdirAll(filepath.Dir(trusted), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(trusted, []byte(project+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if resp := decide("make deploy"); resp.Decision != hooksdk.DecisionDeny || resp.ReasonCode != "GUARD_PROJECT_DEPLOY" {
+		t.Errorf("trusted project rule = %s %s", resp.Decision, resp.ReasonCode)
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOK_GUARD_CONFIG", "")
+	current := filepath.Join(home, "hooks", "config", "guard_exec.toml")
+	legacy := filepath.Join(home, "hooks", "guard_exec.toml")
+	if got := configPath(); got != current {
+		t.Errorf("no config: path = %s, want %s", got, current)
+	}
+	write := func(path string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("unknown = \"allow\"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(legacy)
+	if got := configPath(); got != legacy {
+		t.Errorf("only the old file: path = %s, want %s", got, legacy)
+	}
+	write(current)
+	if got := configPath(); got != current {
+		t.Errorf("both files: path = %s, want %s", got, current)
+	}
+	t.Setenv("CODEX_HOOK_GUARD_CONFIG", "/etc/guard.toml")
+	if got := configPath(); got != "/etc/guard.toml" {
+		t.Errorf("CODEX_HOOK_GUARD_CONFIG: path = %s", got)
+	}
+}
+
+func TestReadConfigEnvOverrides(t *testing.T) {
+	guardConfig(t, "unknown = \"allow\"\nprotected_branches = [\"trunk\"]\n")
+	t.Setenv("CODEX_HOOK_GUARD_EXEC_UNKNOWN", "")
+	t.Setenv("CODEX_HOOK_GUARD_EXEC_PROTECTED_BRANCHES", "release, prod")
+	cfg, err := readConfig(os.Getenv("CODEX_HOOK_GUARD_CONFIG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Unknown != "allow" || strings.Join(cfg.ProtectedBranches, ",") != "release,prod" {
+		t.Errorf("config = %+v", cfg)
+	}
+
+	t.Setenv("CODEX_HOOK_GUARD_EXEC_UNKNOWN", "deny")
+	if _, err := readConfig(os.Getenv("CODEX_HOOK_GUARD_CONFIG")); err == nil || !strings.Contains(err.Error(), `unknown must be "allow" or "ask"`) {
+		t.Errorf("bad override: error = %v", err)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	guardConfig(t, "[[deny]]\nglob = \"terraform destroy*\"\n")
+	checks := selfTest()
+	if len(checks) != 2 || !strings.Contains(checks[0].Name, "guard.toml") {
+		t.Fatalf("checks = %+v", checks)
+	}
+	if err := checks[0].Run(context.Background(), hooksdk.Environ()); err != nil {
+		t.Errorf("%s: %v", checks[0].Name, err)
+	}
+
+	guardConfig(t, "[[deny]]\nglob = \"x\"\ncode = \"lower\"\n")
+	if err := selfTest()[0].Run(context.Background(), hooksdk.Environ()); err == nil || !strings.Contains(err.Error(), "code") {
+		t.Errorf("broken config: %v", err)
+	}
+	t.Setenv("PATH", t.TempDir())
+	if err := selfTest()[1].Run(context.Background(), hooksdk.Environ()); err == nil {
+		t.Error("git check passed without git on PATH")
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/netguard"
+)
+
+// Verdicts for commands whose destination can't be determined.
+const (
+	unknownAsk   = "ask"
+	unknownAllow = "allow"
+	unknownDeny  = "deny"
+)
+
+// config is read from `$CODEX_HOME/hooks/config/guard_network.toml`; CODEX_HOOK_GUARD_NETWORK_ALLOW
+// (comma-separated) and CODEX_HOOK_GUARD_NETWORK_UNKNOWN override it.
+type config struct {
+	// Allow lists the permitted hosts: `github.com`, `*.github.com` for its subdomains, or an IP
+	// address or CIDR range for raw addresses (see netguard.ParseAllowlist).
+	Allow []string `toml:"allow" default:"localhost,127.0.0.0/8,::1"`
+	// Unknown is ask, allow, or deny: the verdict for network commands whose destination can't be
+	// determined, such as `curl "$URL"`, and for command lines that can't be parsed.
+	Unknown string `toml:"unknown" default:"ask"`
+
+	allowlist *netguard.Allowlist
+}
+
+func (c *config) Validate() error {
+	switch c.Unknown {
+	case unknownAsk, unknownAllow, unknownDeny:
+	default:
+		return fmt.Errorf("unknown must be %s, %s, or %s, not %q", unknownAsk, unknownAllow, unknownDeny, c.Unknown)
+	}
+	list, err := netguard.ParseAllowlist(c.Allow)
+	if err != nil {
+		return err
+	}
+	c.allowlist = list
+	return nil
+}
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response. A deny response makes
+	// the hook exit 2, which blocks the command; everything but shell commands is allowed. A
+	// failure denies too, so a payload the guard can't read isn't let through unchecked.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailClosed))
+}
+
+// selfTest checks, for `guard_network --self-test`, that the allowlist config is valid.
+func selfTest() []hooksdk.Check {
+	var cfg config
+	return []hooksdk.Check{hooksdk.CheckConfig("guard_network", hooksdk.LoadConfig("guard_network", &cfg))}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	var extract func(*netguard.Extractor) (netguard.Result, error)
+	switch payload.EventType() {
+	case "approval-requested":
+		if len(payload.Command) == 0 {
+			return hooksdk.Allow(), nil
+		}
+		extract = func(e *netguard.Extractor) (netguard.Result, error) { return e.ExtractArgv(payload.Command) }
+	case "tool-call-started":
+		// Shell tools carry the command line as a string, or an argv like approvals do.
+		command, ok := hooksdk.Field[any](payload.RawPayload, "tool_input.command")
+		if !ok {
+			return hooksdk.Allow(), nil
+		}
+		switch c := command.(type) {
+		case string:
+			extract = func(e *netguard.Extractor) (netguard.Result, error) { return e.Extract(c) }
+		default:
+			var argv []string
+			items, _ := c.([]any)
+			for _, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					return hooksdk.Allow(), nil
+				}
+				argv = append(argv, s)
+			}
+			if len(argv) == 0 {
+				return hooksdk.Allow(), nil
+			}
+			extract = func(e *netguard.Extractor) (netguard.Result, error) { return e.ExtractArgv(argv) }
+		}
+	default:
+		return hooksdk.Allow(), nil
+	}
+
+	var cfg config
+	if err := hooksdk.LoadConfig("guard_network", &cfg); err != nil {
+		// Without a usable allowlist every destination would be denied; ask instead.
+		hooklog.Errorf("load config: %v", err)
+		resp := hooksdk.Ask("guard_network can't check this command: its config is broken. Run it anyway?")
+		resp.ReasonCode = "GUARD_NETWORK_UNKNOWN"
+		return resp, nil
+	}
+	e := &netguard.Extractor{GitRemote: func(name string) string { return gitRemote(ctx, payload.WorkingDir(), name) }}
+	result, err := extract(e)
+	if err != nil {
+		return unknown(&cfg, fmt.Sprintf("the command can't be parsed (%v)", err)), nil
+	}
+
+	var denied []string
+	for _, d := range result.Destinations {
+		if !cfg.allowlist.Allows(d.Host) {
+			denied = append(denied, fmt.Sprintf("%s connects to %s", d.Tool, d.Host))
+			hooklog.Warnf("denied %q: %s is not on the allowlist", d.Command, d.Host)
+		}
+	}
+	if len(denied) > 0 {
+		reason := strings.Join(denied, "; ") + ", which is not on the guard_network allowlist"
+		if gha.Enabled(gha.KindDenial) {
+			a := gha.Annotation{Level: gha.Error, Title: "guard_network denied a command", Message: reason}
+			if err := gha.Emit(a); err != nil {
+				hooklog.Errorf("write annotation: %v", err)
+			}
+		}
+		resp := hooksdk.Deny(reason)
+		resp.ReasonCode = "GUARD_NETWORK_HOST"
+		return resp, nil
+	}
+	if len(result.Unresolved) > 0 {
+		u := result.Unresolved[0]
+		return unknown(&cfg, fmt.Sprintf("the destination of %s can't be determined: %s", u.Tool, u.Reason)), nil
+	}
+	return hooksdk.Allow(), nil
+}
+
+// unknown is the response for a command whose destination can't be checked, as configured.
+func unknown(cfg *config, reason string) hooksdk.Response {
+	var resp hooksdk.Response
+	switch cfg.Unknown {
+	case unknownAllow:
+		hooklog.Debugf("allowed: %s", reason)
+		return hooksdk.Allow()
+	case unknownDeny:
+		hooklog.Warnf("denied: %s", reason)
+		resp = hooksdk.Deny("guard_network: " + reason)
+	default:
+		resp = hooksdk.Ask("guard_network: " + reason + ". Run it anyway?")
+	}
+	resp.ReasonCode = "GUARD_NETWORK_UNKNOWN"
+	return resp
+}
+
+// gitRemote is the URL of the named remote of the repository in dir, or "" if it can't be
+// determined.
+func gitRemote(ctx context.Context, dir, name string) string {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "remote", "get-url", "--", name)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
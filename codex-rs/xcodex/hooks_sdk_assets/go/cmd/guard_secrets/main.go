@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/secrets"
+)
+
+// allowArg adds fingerprints to the allowlist: `hook-guard-secrets --allow <fingerprint>...`.
+const allowArg = "--allow"
+
+// maxListed bounds how many findings the deny reason spells out.
+const maxListed = 10
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == allowArg {
+		os.Exit(allow(os.Args[2:]))
+	}
+	// Run parses the event payload, calls handle, and writes the response. A deny response makes
+	// the hook exit 2, which blocks the write; events that write no files are allowed. A failure
+	// denies too, so a payload the guard can't read isn't let through unchecked.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailClosed))
+}
+
+// selfTest checks, for `guard_secrets --self-test`, that the detector config and the allowlist
+// next to it are valid.
+func selfTest() []hooksdk.Check {
+	path := configPath()
+	_, err := secrets.LoadConfig(path)
+	_, allowErr := secrets.LoadAllowlist(allowlistPath(path))
+	return []hooksdk.Check{
+		hooksdk.CheckConfigFile(path, err),
+		hooksdk.CheckConfigFile(allowlistPath(path), allowErr),
+	}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	if payload.EventType() != "tool-call-started" {
+		return hooksdk.Allow(), nil
+	}
+	changes := fileChanges(payload.ToolInput)
+	if len(changes) == 0 {
+		return hooksdk.Allow(), nil
+	}
+
+	configPath := configPath()
+	cfg, err := secrets.LoadConfig(configPath)
+	if err != nil {
+		hooklog.Errorf("load config: %v; using the built-in detectors only", err)
+		cfg = nil
+	}
+	allowlist, err := secrets.LoadAllowlist(allowlistPath(configPath))
+	if err != nil {
+		hooklog.Warnf("load allowlist: %v", err)
+	}
+
+	findings := secrets.New(cfg, allowlist).Scan(changes)
+	if len(findings) == 0 {
+		return hooksdk.Allow(), nil
+	}
+
+	var b strings.Builder
+	b.WriteString("guard_secrets found possible secrets in the change:\n")
+	for i, f := range findings {
+		if i == maxListed {
+			fmt.Fprintf(&b, "- ... and %d more\n", len(findings)-maxListed)
+			break
+		}
+		fmt.Fprintf(&b, "- %s: %s (fingerprint %s)\n", f.Location(), f.Detector, f.Fingerprint)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+	fmt.Fprintf(&b, "Remove them, or allowlist a false positive with `%s %s <fingerprint>`.", exe, allowArg)
+	hooklog.Warnf("denied write with %d possible secret(s)", len(findings))
+	if gha.Enabled(gha.KindDenial) {
+		annotate(findings, payload.WorkingDir())
+	}
+
+	resp := hooksdk.Deny(b.String())
+	resp.ReasonCode = "GUARD_SECRETS"
+	return resp, nil
+}
+
+// annotate marks each finding on its line in the pull request diff (the first maxListed of them).
+func annotate(findings []secrets.Finding, dir string) {
+	for i, f := range findings {
+		if i == maxListed {
+			break
+		}
+		a := gha.Annotation{
+			Level:   gha.Error,
+			File:    gha.WorkspacePath(f.Path, dir),
+			Line:    f.Line,
+			Title:   "guard_secrets denied a write",
+			Message: fmt.Sprintf("Possible secret (%s, fingerprint %s).", f.Detector, f.Fingerprint),
+		}
+		if err := gha.Emit(a); err != nil {
+			hooklog.Errorf("write annotation: %v", err)
+			return
+		}
+	}
+}
+
+// fileChanges finds the files a tool call would write: patches (apply_patch's `input`, or any
+// string holding a `*** Begin Patch` block, such as an `apply_patch` shell heredoc), whole-file
+// writes (`content` with `path`/`file_path`), and edits (the replacement text of an edit_block).
+func fileChanges(input any) []secrets.Change {
+	switch v := input.(type) {
+	case string:
+		return secrets.ParsePatch(v)
+	case map[string]any:
+		str := func(keys ...string) string {
+			for _, k := range keys {
+				if s, ok := v[k].(string); ok && s != "" {
+					return s
+				}
+			}
+			return ""
+		}
+		path := str("file_path", "path")
+		if patch := str("input", "patch"); patch != "" {
+			return secrets.ParsePatch(patch)
+		}
+		if content := str("content"); content != "" && path != "" {
+			return []secrets.Change{secrets.WholeFile(path, content)}
+		}
+		if replacement := str("new_string", "replace", "replacement"); replacement != "" && path != "" {
+			// The replacement's position in the file isn't known, only its own line numbers.
+			c := secrets.WholeFile(path, replacement)
+			for i := range c.Added {
+				c.Added[i].N = 0
+			}
+			return []secrets.Change{c}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var out []secrets.Change
+		for _, k := range keys {
+			out = append(out, embeddedPatches(v[k])...)
+		}
+		return out
+	}
+	return nil
+}
+
+// embeddedPatches parses strings (or argv elements) that contain an apply_patch block.
+func embeddedPatches(v any) []secrets.Change {
+	switch t := v.(type) {
+	case string:
+		if strings.Contains(t, "*** Begin Patch") {
+			return secrets.ParsePatch(t)
+		}
+	case []any:
+		var out []secrets.Change
+		for _, item := range t {
+			out = append(out, embeddedPatches(item)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// configPath is CODEX_HOOK_SECRETS_CONFIG, or `$CODEX_HOME/hooks/guard_secrets.toml`.
+func configPath() string {
+	if p := os.Getenv("CODEX_HOOK_SECRETS_CONFIG"); p != "" {
+		return p
+	}
+	return hooksdk.Environ().Path("hooks", "guard_secrets.toml")
+}
+
+// allowlistPath sits next to the config: `guard_secrets.toml` -> `guard_secrets.allow`.
+func allowlistPath(configPath string) string {
+	return strings.TrimSuffix(configPath, filepath.Ext(configPath)) + ".allow"
+}
+
+func allow(fingerprints []string) int {
+	if len(fingerprints) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s %s <fingerprint>...\n", filepath.Base(os.Args[0]), allowArg)
+		return 1
+	}
+	path := allowlistPath(configPath())
+	note := "added " + time.Now().Format("2006-01-02")
+	for _, fp := range fingerprints {
+		if err := secrets.AddToAllowlist(path, fp, note); err != nil {
+			fmt.Fprintf(os.Stderr, "allowlist %s: %v\n", fp, err)
+			return 1
+		}
+		fmt.Printf("allowlisted %s in %s\n", fp, path)
+	}
+	return 0
+}
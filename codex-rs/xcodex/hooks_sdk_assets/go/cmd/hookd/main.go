@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func main() {
+	// Serve keeps the handler running as a daemon on a unix socket, so each event costs a socket
+	// round trip instead of a process spawn. Point the host at the hookd_forward binary, which
+	// relays each event here. Stop the daemon with SIGTERM or ^C.
+	socketPath := hooksdk.DefaultSocketPath()
+	if len(os.Args) > 1 {
+		socketPath = os.Args[1]
+	}
+
+	fmt.Fprintf(os.Stderr, "hookd listening on %s\n", socketPath)
+	if err := hooksdk.Serve(socketPath, handle); err != nil {
+		fmt.Fprintf(os.Stderr, "hookd: %v\n", err)
+		os.Exit(hooksdk.ExitError)
+	}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	// Add your logic here. Handlers run concurrently, so guard any shared state.
+	fmt.Fprintf(os.Stderr, "hookd: %s\n", payload.EventType())
+	return hooksdk.Allow(), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func main() {
+	// Configure this binary as the hook command. It relays the event on stdin to the hookd daemon
+	// (at $CODEX_HOOKD_SOCKET, or the path given as the first argument) and exits with the
+	// daemon's result.
+	socketPath, selfTest := parseArgs(os.Args[1:])
+	if selfTest {
+		hooksdk.SelfTest(selfTestChecks(socketPath)...)
+	}
+
+	ctx, stop := hooksdk.SignalContext()
+	code := hooksdk.Forward(ctx, socketPath, os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// parseArgs returns the socket path, the first argument other than --self-test or else
+// DefaultSocketPath, and whether a self-test was asked for, before or after the path.
+func parseArgs(args []string) (socketPath string, selfTest bool) {
+	for _, arg := range args {
+		switch {
+		case arg == hooksdk.SelfTestFlag:
+			selfTest = true
+		case socketPath == "":
+			socketPath = arg
+		}
+	}
+	if socketPath == "" {
+		socketPath = hooksdk.DefaultSocketPath()
+	}
+	return socketPath, selfTest
+}
+
+// selfTestChecks check the socket events would be sent to, socketPath; the report names it.
+func selfTestChecks(socketPath string) []hooksdk.Check {
+	return []hooksdk.Check{hooksdk.CheckDial("hookd", "unix", socketPath)}
+}
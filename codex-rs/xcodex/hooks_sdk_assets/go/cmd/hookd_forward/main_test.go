@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Setenv("CODEX_HOOKD_SOCKET", filepath.Join(t.TempDir(), "default.sock"))
+	def := hooksdk.DefaultSocketPath()
+	tests := []struct {
+		args     []string
+		socket   string
+		selfTest bool
+	}{
+		{nil, def, false},
+		{[]string{"/run/hookd.sock"}, "/run/hookd.sock", false},
+		{[]string{hooksdk.SelfTestFlag}, def, true},
+		{[]string{hooksdk.SelfTestFlag, "/run/hookd.sock"}, "/run/hookd.sock", true},
+		{[]string{"/run/hookd.sock", hooksdk.SelfTestFlag}, "/run/hookd.sock", true},
+	}
+	for _, tt := range tests {
+		socket, selfTest := parseArgs(tt.args)
+		if socket != tt.socket || selfTest != tt.selfTest {
+			t.Errorf("parseArgs(%q) = %q, %v; want %q, %v", tt.args, socket, selfTest, tt.socket, tt.selfTest)
+		}
+	}
+}
+
+func TestSelfTestChecksTheGivenSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "hookd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The default socket is up, the one passed on the command line is not.
+	def := filepath.Join(dir, "default.sock")
+	ln, err := net.Listen("unix", def)
+	if err != nil {
+		t.Skipf("unix sockets: %v", err)
+	}
+	defer ln.Close()
+	down := filepath.Join(dir, "down.sock")
+
+	env := map[string]string{"CODEX_HOME": dir, "CODEX_HOOKD_SOCKET": def}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	socket, _ := parseArgs([]string{hooksdk.SelfTestFlag, down})
+	var out bytes.Buffer
+	s := hooksdk.IO{Out: &out, Err: &out, Getenv: func(k string) string { return env[k] }}
+	if code := s.SelfTest(context.Background(), selfTestChecks(socket)...); code != hooksdk.ExitError {
+		t.Errorf("self-test exit code = %d, want %d:\n%s", code, hooksdk.ExitError, out.String())
+	}
+	if want := "FAIL  hookd " + down + " is reachable"; !strings.Contains(out.String(), want) {
+		t.Errorf("self-test report doesn't contain %q:\n%s", want, out.String())
+	}
+
+	socket, _ = parseArgs([]string{hooksdk.SelfTestFlag})
+	out.Reset()
+	if code := s.SelfTest(context.Background(), selfTestChecks(socket)...); code != hooksdk.ExitOK {
+		t.Errorf("self-test of the default socket exit code = %d, want %d:\n%s", code, hooksdk.ExitOK, out.String())
+	}
+	if want := "PASS  hookd " + def + " is reachable"; !strings.Contains(out.String(), want) {
+		t.Errorf("self-test report doesn't contain %q:\n%s", want, out.String())
+	}
+}
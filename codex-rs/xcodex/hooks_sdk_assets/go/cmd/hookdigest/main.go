@@ -0,0 +1,779 @@
+// Command hookdigest summarizes hooks.jsonl logs, as written by cmd/log_jsonl, in a daily or weekly
+// digest: sessions, files changed, commands run, denials, and tokens per day and per project, and
+// the most-run commands, most-changed files, most-denied tools, and most active sessions (by
+// hooksdk.ShortID, which `hookq resolve` expands).
+//
+//	go run ./cmd/hookdigest [flags] [file...]
+//
+// Without files it reads `$CODEX_HOME/hooks.jsonl` and its rotated generations, oldest first,
+// gzipped or not, as cmd/hookq does. Records are read one at a time and only counters are kept, so
+// memory grows with the days, projects, and sessions of the range, not with the size of the log.
+// Malformed records are counted and skipped.
+//
+// The digest is Markdown, or HTML with --format html, written to stdout or --out; --send mails it
+// with the cmd/notify_email settings or posts it to the cmd/notify_chat webhook.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/chat"
+	"example.com/xcodex/hooks-sdk/hooksdk/email"
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+	"example.com/xcodex/hooks-sdk/hooksdk/usage"
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+// topCap bounds the values each top-N list counts. Past it the least counted one is replaced
+// (the space-saving algorithm), so a list's counts may be overestimates when a range has more
+// distinct values than this.
+const topCap = 1000
+
+// unknownProject is the project of events without a working directory whose session never had one.
+const unknownProject = "(unknown)"
+
+// periods are the --period values: how far before --until the digest starts when --since isn't set.
+var periods = map[string]time.Duration{
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr, time.Now()))
+}
+
+func run(args []string, stdout, stderr io.Writer, now time.Time) int {
+	fl := flag.NewFlagSet("hookdigest", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	period := fl.String("period", "week", "the range when --since isn't set: day or week before --until")
+	since := fl.String("since", "", "summarize events at or after this time (RFC 3339, a date, or a duration ago such as 24h)")
+	until := fl.String("until", "", "summarize events before this time (same forms as --since; default now)")
+	format := fl.String("format", "markdown", "output format: markdown or html")
+	out := fl.String("out", "", "the file to write (default stdout, or nothing with --send)")
+	top := fl.Int("top", 5, "entries in each top list")
+	tz := fl.String("tz", "", "the IANA zone days are counted in (default CODEX_HOOK_TZ, or the machine's)")
+	send := fl.String("send", "", "also send the digest: email (the notify_email settings) or chat (CODEX_HOOK_CHAT_WEBHOOK_URL)")
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hookdigest [flags] [file...]\n\nReads $CODEX_HOME/hooks.jsonl and its rotated generations when no file is given ('-' is stdin).\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	loc, err := summarize.Location(*tz)
+	if err != nil {
+		fmt.Fprintf(stderr, "hookdigest: --tz: %v\n", err)
+		return 2
+	}
+	now = now.In(loc)
+	end, err := parseTime(*until, now)
+	if err != nil {
+		fmt.Fprintf(stderr, "hookdigest: --until: %v\n", err)
+		return 2
+	}
+	if end.IsZero() {
+		end = now
+	}
+	start, err := parseTime(*since, now)
+	if err != nil {
+		fmt.Fprintf(stderr, "hookdigest: --since: %v\n", err)
+		return 2
+	}
+	if start.IsZero() {
+		d, ok := periods[*period]
+		if !ok {
+			fmt.Fprintf(stderr, "hookdigest: unknown --period %q (want day or week)\n", *period)
+			return 2
+		}
+		start = end.Add(-d)
+	}
+	if !start.Before(end) {
+		fmt.Fprintf(stderr, "hookdigest: --since must be before --until\n")
+		return 2
+	}
+	if *format != "markdown" && *format != "html" {
+		fmt.Fprintf(stderr, "hookdigest: unknown --format %q (want markdown or html)\n", *format)
+		return 2
+	}
+	if *top < 1 {
+		fmt.Fprintf(stderr, "hookdigest: --top must be positive\n")
+		return 2
+	}
+	var emailCfg *emailConfig
+	switch *send {
+	case "":
+	case "email":
+		if emailCfg, err = loadEmailConfig(); err != nil {
+			fmt.Fprintf(stderr, "hookdigest: %v\n", err)
+			return 2
+		}
+	case "chat":
+		if os.Getenv("CODEX_HOOK_CHAT_WEBHOOK_URL") == "" {
+			fmt.Fprintf(stderr, "hookdigest: --send chat: CODEX_HOOK_CHAT_WEBHOOK_URL is not set\n")
+			return 2
+		}
+	default:
+		fmt.Fprintf(stderr, "hookdigest: unknown --send %q (want email or chat)\n", *send)
+		return 2
+	}
+
+	files := fl.Args()
+	if len(files) == 0 {
+		log := hooksdk.Environ().Path("hooks.jsonl")
+		if files = jsonl.Files(log); len(files) == 0 {
+			fmt.Fprintf(stderr, "hookdigest: no log at %s\n", log)
+			return 1
+		}
+	}
+
+	d := newDigest(start, end, loc)
+	code := 0
+	for _, path := range files {
+		n, err := scanFile(path, d.add)
+		d.malformed += n
+		if err != nil {
+			fmt.Fprintf(stderr, "hookdigest: %s: %v\n", path, err)
+			code = 1
+		}
+	}
+	if d.malformed > 0 {
+		fmt.Fprintf(stderr, "hookdigest: skipped %d malformed record(s)\n", d.malformed)
+	}
+
+	r := d.report(*top)
+	markdown := r.markdown()
+	text := markdown
+	if *format == "html" {
+		if text, err = r.html(); err != nil {
+			fmt.Fprintf(stderr, "hookdigest: %v\n", err)
+			return 1
+		}
+	}
+	switch {
+	case *out != "":
+		if err := os.WriteFile(*out, []byte(text), 0o644); err != nil {
+			fmt.Fprintf(stderr, "hookdigest: %v\n", err)
+			return 1
+		}
+	case *send == "":
+		io.WriteString(stdout, text)
+	}
+
+	if *send != "" {
+		ctx, stop := hooksdk.SignalContext()
+		defer stop()
+		// Mail and chat messages are text, so they get the Markdown whatever --format is.
+		if *send == "email" {
+			err = sendEmail(ctx, emailCfg, r.Title, markdown)
+		} else {
+			err = sendChat(ctx, markdown)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "hookdigest: send: %v\n", err)
+			return 1
+		}
+	}
+	return code
+}
+
+// scanFile calls fn with the payload and time of each event of the file at path ("-" for stdin),
+// returning how many records weren't JSON objects. The file's header line, if it has one, says
+// how its records are laid out.
+func scanFile(path string, fn func(p hooksdk.HookPayloadJSON, t time.Time)) (malformed int, err error) {
+	var r io.Reader
+	if path == "-" {
+		if r, err = jsonl.NewReader(os.Stdin); err != nil {
+			return 0, err
+		}
+	} else {
+		f, err := jsonl.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var dec jsonl.Decoder
+	err = jsonl.ScanRecords(r, func(rec []byte) error {
+		ev, err := dec.Decode(rec)
+		if err != nil {
+			malformed++
+			return nil
+		}
+		if ev.Payload == nil {
+			// The header.
+			return nil
+		}
+		p := hooksdk.HookPayloadJSON(ev.Payload)
+		var t time.Time
+		if ts, err := time.Parse(time.RFC3339Nano, firstString(p, "timestamp")); err == nil {
+			t = ts
+		} else if ts, err := time.Parse(time.RFC3339Nano, ev.TS); err == nil {
+			t = ts
+		}
+		fn(p, t)
+		return nil
+	})
+	return malformed, err
+}
+
+// digest accumulates the counters of the events in [since, until).
+type digest struct {
+	since, until time.Time
+	loc          *time.Location
+
+	days     map[string]*stats
+	projects map[string]*stats
+	total    *stats
+	// cwds is the last working directory of each session, the project of its events without one.
+	cwds map[string]string
+
+	commands, files, denied *counter
+	// active counts the events of each session, by full id.
+	active *counter
+	// untimed counts the events without a time, which the range can't place.
+	untimed   int
+	malformed int
+}
+
+// stats are the counters of a day, a project, or the whole range. Sessions and files are sets, so
+// that one seen twice counts once.
+type stats struct {
+	sessions map[string]bool
+	files    map[string]bool
+	commands int
+	denials  int
+	tokens   int64
+}
+
+func newStats() *stats {
+	return &stats{sessions: map[string]bool{}, files: map[string]bool{}}
+}
+
+func newDigest(since, until time.Time, loc *time.Location) *digest {
+	return &digest{
+		since:    since,
+		until:    until,
+		loc:      loc,
+		days:     map[string]*stats{},
+		projects: map[string]*stats{},
+		total:    newStats(),
+		cwds:     map[string]string{},
+		commands: newCounter(topCap),
+		files:    newCounter(topCap),
+		denied:   newCounter(topCap),
+		active:   newCounter(topCap),
+	}
+}
+
+// add counts one event, if it is in the range.
+func (d *digest) add(p hooksdk.HookPayloadJSON, t time.Time) {
+	// Sessions' directories are learned from every event, so a session that started before the
+	// range has its project.
+	session := firstString(p, "session_id", "thread_id", "thread-id", "session-id")
+	project := firstString(p, "cwd")
+	if session != "" {
+		if project != "" {
+			d.cwds[session] = project
+		} else {
+			project = d.cwds[session]
+		}
+	}
+	if t.IsZero() {
+		d.untimed++
+		return
+	}
+	if t.Before(d.since) || !t.Before(d.until) {
+		return
+	}
+	if project == "" {
+		project = unknownProject
+	}
+	day := t.In(d.loc).Format("2006-01-02")
+	if d.days[day] == nil {
+		d.days[day] = newStats()
+	}
+	if d.projects[project] == nil {
+		d.projects[project] = newStats()
+	}
+	all := []*stats{d.days[day], d.projects[project], d.total}
+
+	each := func(fn func(s *stats)) {
+		for _, s := range all {
+			fn(s)
+		}
+	}
+	if session != "" {
+		d.active.add(session)
+		each(func(s *stats) { s.sessions[session] = true })
+	}
+	if tokens, ok := usage.FromPayload(p); ok {
+		each(func(s *stats) { s.tokens += tokens.Total })
+	}
+	// Tool calls are counted when they finish, as hooksdk/aggregate counts them: aborted ones
+	// were denied, and only successful ones changed files.
+	typ := firstString(p, "xcodex_event_type", "type")
+	if hooksdk.ParseEventType(typ) != "tool-call-finished" {
+		return
+	}
+	if status, _ := hooksdk.StringField(p, "status"); status == "aborted" {
+		tool := firstString(p, "tool_name")
+		if tool == "" {
+			tool = "(unknown)"
+		}
+		d.denied.add(tool)
+		each(func(s *stats) { s.denials++ })
+		return
+	}
+	if name := program(p); name != "" {
+		d.commands.add(name)
+		each(func(s *stats) { s.commands++ })
+	}
+	if ok, found := hooksdk.BoolField(p, "success"); found && !ok {
+		return
+	}
+	for _, path := range gitsnap.TouchedPaths(p["tool_input"]) {
+		if !filepath.IsAbs(path) && project != unknownProject {
+			path = filepath.Join(project, path)
+		}
+		d.files.add(path)
+		each(func(s *stats) { s.files[path] = true })
+	}
+}
+
+// shells are the programs whose `-c` script is the command a tool call runs.
+var shells = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "fish": true}
+
+// program is the program the tool call ran, "" when it ran no command: the first word of its
+// command, or of the script when the command is `bash -lc '...'` and the like.
+func program(p hooksdk.HookPayloadJSON) string {
+	input, _ := p["tool_input"].(map[string]any)
+	var argv []string
+	switch c := input["command"].(type) {
+	case string:
+		argv = strings.Fields(c)
+	case []any:
+		for _, arg := range c {
+			argv = append(argv, fmt.Sprint(arg))
+		}
+	}
+	if len(argv) >= 3 && shells[filepath.Base(argv[0])] && strings.HasPrefix(argv[1], "-") && strings.HasSuffix(argv[1], "c") {
+		argv = strings.Fields(argv[2])
+	}
+	if len(argv) == 0 {
+		return ""
+	}
+	return filepath.Base(argv[0])
+}
+
+func firstString(p hooksdk.HookPayloadJSON, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := p[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// counter counts at most max distinct values (see topCap).
+type counter struct {
+	max    int
+	counts map[string]int64
+}
+
+func newCounter(max int) *counter {
+	return &counter{max: max, counts: map[string]int64{}}
+}
+
+func (c *counter) add(value string) {
+	if _, ok := c.counts[value]; !ok && len(c.counts) >= c.max {
+		least, n := "", int64(-1)
+		for v, count := range c.counts {
+			if n < 0 || count < n || count == n && v < least {
+				least, n = v, count
+			}
+		}
+		delete(c.counts, least)
+		c.counts[value] = n
+	}
+	c.counts[value]++
+}
+
+// top returns the n most counted values, ties in name order.
+func (c *counter) top(n int) []entry {
+	out := make([]entry, 0, len(c.counts))
+	for v, count := range c.counts {
+		out = append(out, entry{Name: v, Count: count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// report is the digest as it is rendered.
+type report struct {
+	Title     string
+	Since     string
+	Until     string
+	Days      []row
+	Projects  []row
+	Total     row
+	Commands  []entry
+	Files     []entry
+	Denied    []entry
+	Sessions  []entry
+	Untimed   int
+	Malformed int
+}
+
+// row is a line of the day and project tables.
+type row struct {
+	Name     string
+	Sessions int
+	Files    int
+	Commands int
+	Denials  int
+	Tokens   int64
+}
+
+type entry struct {
+	Name  string
+	Count int64
+}
+
+func (s *stats) row(name string) row {
+	return row{
+		Name:     name,
+		Sessions: len(s.sessions),
+		Files:    len(s.files),
+		Commands: s.commands,
+		Denials:  s.denials,
+		Tokens:   s.tokens,
+	}
+}
+
+// report returns the digest with top entries in each list. Days are in order; projects have the
+// most sessions first; sessions, counted by events, are named by their short id.
+func (d *digest) report(top int) *report {
+	r := &report{
+		Since:     summarize.Time(d.since, d.loc),
+		Until:     summarize.Time(d.until, d.loc),
+		Total:     d.total.row("Total"),
+		Commands:  d.commands.top(top),
+		Files:     d.files.top(top),
+		Denied:    d.denied.top(top),
+		Sessions:  d.active.top(top),
+		Untimed:   d.untimed,
+		Malformed: d.malformed,
+	}
+	// The last day shown is the one before until when until is midnight, as with --since and
+	// --until dates.
+	last := d.until.Add(-time.Nanosecond).In(d.loc).Format("2006-01-02")
+	r.Title = "xcodex digest: " + d.since.In(d.loc).Format("2006-01-02")
+	if first := d.since.In(d.loc).Format("2006-01-02"); last != first {
+		r.Title += " to " + last
+	}
+	for i := range r.Sessions {
+		r.Sessions[i].Name = hooksdk.ShortID(r.Sessions[i].Name)
+	}
+	for day, s := range d.days {
+		r.Days = append(r.Days, s.row(day))
+	}
+	sort.Slice(r.Days, func(i, j int) bool { return r.Days[i].Name < r.Days[j].Name })
+	for project, s := range d.projects {
+		r.Projects = append(r.Projects, s.row(project))
+	}
+	sort.Slice(r.Projects, func(i, j int) bool {
+		a, b := r.Projects[i], r.Projects[j]
+		if a.Sessions != b.Sessions {
+			return a.Sessions > b.Sessions
+		}
+		return a.Name < b.Name
+	})
+	return r
+}
+
+// markdown renders the report as GitHub-flavored Markdown.
+func (r *report) markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n%s to %s\n", r.Title, r.Since, r.Until)
+	if len(r.Days) == 0 {
+		b.WriteString("\nNo events in this range.\n")
+	} else {
+		table := func(title, first string, rows []row) {
+			fmt.Fprintf(&b, "\n## %s\n\n| %s | Sessions | Files changed | Commands | Denials | Tokens |\n", title, first)
+			b.WriteString("| --- | ---: | ---: | ---: | ---: | ---: |\n")
+			for _, r := range rows {
+				fmt.Fprintf(&b, "| %s | %d | %d | %d | %d | %s |\n", cell(r.Name), r.Sessions, r.Files, r.Commands, r.Denials, thousands(r.Tokens))
+			}
+		}
+		table("By day", "Day", append(r.Days[:len(r.Days):len(r.Days)], r.Total))
+		table("By project", "Project", r.Projects)
+		list := func(title string, entries []entry) {
+			if len(entries) == 0 {
+				return
+			}
+			fmt.Fprintf(&b, "\n## %s\n\n", title)
+			for i, e := range entries {
+				fmt.Fprintf(&b, "%d. `%s` (%d)\n", i+1, strings.ReplaceAll(e.Name, "`", "'"), e.Count)
+			}
+		}
+		list("Top commands", r.Commands)
+		list("Most-changed files", r.Files)
+		list("Most-denied tools", r.Denied)
+		list("Most active sessions", r.Sessions)
+	}
+	if note := r.note(); note != "" {
+		fmt.Fprintf(&b, "\n_%s_\n", note)
+	}
+	return b.String()
+}
+
+// note says what was left out, or is "".
+func (r *report) note() string {
+	var parts []string
+	if r.Malformed > 0 {
+		parts = append(parts, fmt.Sprintf("%d malformed record(s)", r.Malformed))
+	}
+	if r.Untimed > 0 {
+		parts = append(parts, fmt.Sprintf("%d event(s) without a time", r.Untimed))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "Skipped " + strings.Join(parts, " and ") + "."
+}
+
+// cell escapes s for a Markdown table cell.
+func cell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// thousands formats n with comma separators.
+func thousands(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return sign + s
+}
+
+// htmlTemplate renders the report's view as a standalone page.
+var htmlTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"thousands": thousands,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; }
+td.n { text-align: right; }
+tr.total td { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Since}} to {{.Until}}</p>
+{{- range .Tables}}
+<h2>{{.Title}}</h2>
+<table>
+<tr><th>{{.First}}</th><th>Sessions</th><th>Files changed</th><th>Commands</th><th>Denials</th><th>Tokens</th></tr>
+{{- range .Rows}}
+<tr{{if .Total}} class="total"{{end}}><td>{{.Name}}</td><td class="n">{{.Sessions}}</td><td class="n">{{.Files}}</td><td class="n">{{.Commands}}</td><td class="n">{{.Denials}}</td><td class="n">{{thousands .Tokens}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>No events in this range.</p>
+{{- end}}
+{{- range .Lists}}
+<h2>{{.Title}}</h2>
+<ol>
+{{- range .Entries}}
+<li><code>{{.Name}}</code> ({{.Count}})</li>
+{{- end}}
+</ol>
+{{- end}}
+{{- with .Note}}
+<p><em>{{.}}</em></p>
+{{- end}}
+</body>
+</html>
+`))
+
+// html renders the report as a standalone HTML page.
+func (r *report) html() (string, error) {
+	type htmlRow struct {
+		row
+		Total bool
+	}
+	type table struct {
+		Title, First string
+		Rows         []htmlRow
+	}
+	type list struct {
+		Title   string
+		Entries []entry
+	}
+	view := struct {
+		Title, Since, Until, Note string
+		Tables                    []table
+		Lists                     []list
+	}{Title: r.Title, Since: r.Since, Until: r.Until, Note: r.note()}
+	if len(r.Days) > 0 {
+		rows := func(rows []row) []htmlRow {
+			out := make([]htmlRow, len(rows))
+			for i, r := range rows {
+				out[i] = htmlRow{row: r}
+			}
+			return out
+		}
+		view.Tables = []table{
+			{"By day", "Day", append(rows(r.Days), htmlRow{r.Total, true})},
+			{"By project", "Project", rows(r.Projects)},
+		}
+		for _, l := range []list{{"Top commands", r.Commands}, {"Most-changed files", r.Files}, {"Most-denied tools", r.Denied}, {"Most active sessions", r.Sessions}} {
+			if len(l.Entries) > 0 {
+				view.Lists = append(view.Lists, l)
+			}
+		}
+	}
+	var b strings.Builder
+	err := htmlTemplate.Execute(&b, view)
+	return b.String(), err
+}
+
+// emailConfig is cmd/notify_email's config, `$CODEX_HOME/hooks/config/email.toml`. The digest uses
+// only the server and the addresses; the rest are the notifier's own settings, listed so the file
+// loads.
+type emailConfig struct {
+	Host       string        `toml:"host"`
+	Port       int           `toml:"port"`
+	Security   string        `toml:"security" default:"starttls"`
+	Username   string        `toml:"username"`
+	Password   string        `toml:"password"`
+	From       string        `toml:"from"`
+	To         []string      `toml:"to"`
+	Timeout    time.Duration `toml:"timeout" default:"30s"`
+	Events     []string      `toml:"events"`
+	Exclude    []string      `toml:"exclude"`
+	Subject    string        `toml:"subject"`
+	Body       string        `toml:"body"`
+	BodyFile   string        `toml:"body_file"`
+	Timezone   string        `toml:"timezone"`
+	Window     time.Duration `toml:"window"`
+	MaxPerHour int           `toml:"max_per_hour"`
+}
+
+func (c *emailConfig) Validate() error {
+	var missing []string
+	if c.Host == "" {
+		missing = append(missing, "host")
+	}
+	if c.From == "" {
+		missing = append(missing, "from")
+	}
+	if len(c.To) == 0 {
+		missing = append(missing, "to")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s not set", strings.Join(missing, ", "))
+	}
+	_, err := email.ParseSecurity(c.Security)
+	return err
+}
+
+func loadEmailConfig() (*emailConfig, error) {
+	var cfg emailConfig
+	if err := hooksdk.LoadConfig("email", &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func sendEmail(ctx context.Context, cfg *emailConfig, subject, body string) error {
+	security, _ := email.ParseSecurity(cfg.Security)
+	client := &email.Client{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Security: security,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Timeout:  cfg.Timeout,
+	}
+	return client.Send(ctx, &email.Message{
+		From:    cfg.From,
+		To:      cfg.To,
+		Subject: "[xcodex] " + strings.TrimPrefix(subject, "xcodex "),
+		Body:    body,
+	})
+}
+
+// sendChat posts body to CODEX_HOOK_CHAT_WEBHOOK_URL in CODEX_HOOK_CHAT_FORMAT, as cmd/notify_chat
+// does, as one message.
+func sendChat(ctx context.Context, body string) error {
+	webhookURL := os.Getenv("CODEX_HOOK_CHAT_WEBHOOK_URL")
+	format := chat.DetectFormat(webhookURL)
+	if v := os.Getenv("CODEX_HOOK_CHAT_FORMAT"); v != "" {
+		f, err := chat.ParseFormat(v)
+		if err != nil {
+			return err
+		}
+		format = f
+	}
+	data, err := chat.Body(format, []string{body})
+	if err != nil {
+		return err
+	}
+	client := &webhook.Client{URL: webhookURL}
+	return client.Send(ctx, data)
+}
+
+// parseTime reads a --since/--until value: RFC 3339, a date (midnight in now's zone), or a
+// duration before now. "" is the zero time.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time, a date, or a duration", s)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/email/emailtest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixture is the fixture log, a plain rotated generation and the current file with a header,
+// oldest first.
+var fixture = []string{filepath.Join("testdata", "hooks.jsonl.1"), filepath.Join("testdata", "hooks.jsonl")}
+
+// now is the clock the digests are run at: the start of the Monday after the fixture's week.
+var now = time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+
+// digestOf runs hookdigest with args and returns its exit code, stdout, and stderr.
+func digestOf(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr, now)
+	return code, stdout.String(), stderr.String()
+}
+
+// golden compares got with testdata/<name>, or rewrites it with -update.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	t.Setenv("CODEX_HOOK_TZ", "")
+	for _, tt := range []struct {
+		name string
+		args []string
+	}{
+		// The week before now, in UTC: every day of the fixture, and both projects.
+		{"week.md", []string{"--tz", "UTC"}},
+		{"week.html", []string{"--tz", "UTC", "--format", "html"}},
+		// A day in Berlin, where the last token spend of March 4 in UTC is on March 5.
+		{"day.md", []string{"--tz", "Europe/Berlin", "--period", "day", "--until", "2026-03-06", "--top", "1"}},
+		{"empty.md", []string{"--tz", "UTC", "--since", "2026-02-01", "--until", "2026-02-02"}},
+	} {
+		code, out, stderr := digestOf(append(tt.args, fixture...)...)
+		if code != 0 || stderr != "hookdigest: skipped 2 malformed record(s)\n" {
+			t.Errorf("%s: exit %d, stderr %q", tt.name, code, stderr)
+		}
+		golden(t, tt.name, out)
+	}
+}
+
+func TestDefaultLog(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOK_TZ", "UTC")
+	if code, _, stderr := digestOf(); code != 1 || !strings.Contains(stderr, "no log at "+filepath.Join(home, "hooks.jsonl")) {
+		t.Errorf("no log: exit %d, %q", code, stderr)
+	}
+
+	// Without files it reads the log and its rotated generations, as given the fixture.
+	for _, path := range fixture {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(home, filepath.Base(path)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, want, _ := digestOf(fixture...)
+	if code, out, _ := digestOf(); code != 0 || out != want {
+		t.Errorf("default log: exit %d\n%s\nwant\n%s", code, out, want)
+	}
+
+	// A log given on stdin, and one that can't be read, which fails the run but not the digest.
+	stdin, err := os.Open(fixture[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	saved := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = saved }()
+	_, want, _ = digestOf(fixture[1])
+	if code, out, _ := digestOf("-"); code != 0 || out != want {
+		t.Errorf("stdin: exit %d\n%s", code, out)
+	}
+	code, out, stderr := digestOf(filepath.Join(home, "missing.jsonl"), fixture[1])
+	if code != 1 || out != want || !strings.Contains(stderr, "missing.jsonl") {
+		t.Errorf("missing file: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	t.Setenv("CODEX_HOOK_TZ", "UTC")
+	title := func(args ...string) string {
+		t.Helper()
+		code, out, stderr := digestOf(append(args, fixture...)...)
+		if code != 0 {
+			t.Fatalf("%q: exit %d, %s", args, code, stderr)
+		}
+		first, _, _ := strings.Cut(out, "\n")
+		return first
+	}
+	for want, args := range map[string][]string{
+		"# xcodex digest: 2026-03-02 to 2026-03-08": nil,
+		"# xcodex digest: 2026-03-08":               {"--period", "day"},
+		"# xcodex digest: 2026-03-03 to 2026-03-04": {"--since", "2026-03-03", "--until", "2026-03-05"},
+		"# xcodex digest: 2026-03-07 to 2026-03-08": {"--since", "36h"},
+		"# xcodex digest: 2026-03-04":               {"--since", "2026-03-04T10:00:00Z", "--until", "2026-03-04T11:00:00+00:00"},
+	} {
+		if got := title(args...); got != want {
+			t.Errorf("%q: title %q, want %q", args, got, want)
+		}
+	}
+
+	// --out writes the file instead of stdout.
+	path := filepath.Join(t.TempDir(), "digest.html")
+	code, out, _ := digestOf(append([]string{"--out", path, "--format", "html"}, fixture...)...)
+	data, _ := os.ReadFile(path)
+	if code != 0 || out != "" || !strings.HasPrefix(string(data), "<!DOCTYPE html>") {
+		t.Errorf("--out: exit %d, stdout %q, file %.40q", code, out, data)
+	}
+	if code, _, stderr := digestOf(append([]string{"--out", filepath.Join(path, "x")}, fixture...)...); code != 1 || stderr == "" {
+		t.Errorf("unwritable --out: exit %d", code)
+	}
+
+	for _, args := range [][]string{
+		{"--period", "month"},
+		{"--format", "pdf"},
+		{"--top", "0"},
+		{"--tz", "Mars/Olympus"},
+		{"--since", "yesterday"},
+		{"--until", "soon"},
+		{"--since", "2026-03-05", "--until", "2026-03-05"},
+		{"--send", "pager"},
+		{"--nope"},
+	} {
+		if code, out, stderr := digestOf(append(args, fixture...)...); code != 2 || out != "" || stderr == "" {
+			t.Errorf("%q: exit %d, stdout %q, stderr %q; want a usage error", args, code, out, stderr)
+		}
+	}
+	if code, out, stderr := digestOf("-h"); code != 0 || out != "" || !strings.Contains(stderr, "usage: hookdigest") {
+		t.Errorf("-h: exit %d, %q", code, stderr)
+	}
+}
+
+func TestSendChat(t *testing.T) {
+	t.Setenv("CODEX_HOOK_TZ", "UTC")
+	t.Setenv("CODEX_HOOK_CHAT_FORMAT", "")
+	t.Setenv("CODEX_HOOK_CHAT_WEBHOOK_URL", "")
+	if code, _, stderr := digestOf(append([]string{"--send", "chat"}, fixture...)...); code != 2 || !strings.Contains(stderr, "CODEX_HOOK_CHAT_WEBHOOK_URL") {
+		t.Errorf("no webhook: exit %d, %q", code, stderr)
+	}
+
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("body %s: %v", data, err)
+		}
+		bodies = append(bodies, body)
+	}))
+	defer srv.Close()
+	t.Setenv("CODEX_HOOK_CHAT_WEBHOOK_URL", srv.URL)
+	t.Setenv("CODEX_HOOK_CHAT_FORMAT", "slack")
+	_, markdown, _ := digestOf(fixture...)
+
+	// The chat gets the Markdown, whatever --format is, and nothing goes to stdout.
+	code, out, stderr := digestOf(append([]string{"--send", "chat", "--format", "html"}, fixture...)...)
+	if code != 0 || out != "" || len(bodies) != 1 {
+		t.Fatalf("exit %d, stdout %q, stderr %q, %d messages", code, out, stderr, len(bodies))
+	}
+	if text, _ := bodies[0]["text"].(string); !strings.Contains(text, strings.TrimSpace(markdown)) {
+		t.Errorf("posted %v, want the Markdown digest", bodies[0])
+	}
+
+	t.Setenv("CODEX_HOOK_CHAT_FORMAT", "fax")
+	if code, _, stderr := digestOf(append([]string{"--send", "chat"}, fixture...)...); code != 1 || !strings.Contains(stderr, "send:") {
+		t.Errorf("bad format: exit %d, %q", code, stderr)
+	}
+}
+
+func TestSendEmail(t *testing.T) {
+	t.Setenv("CODEX_HOOK_TZ", "UTC")
+	t.Setenv("CODEX_HOME", t.TempDir())
+	if code, _, stderr := digestOf(append([]string{"--send", "email"}, fixture...)...); code != 2 || !strings.Contains(stderr, "host, from, to not set") {
+		t.Errorf("no config: exit %d, %q", code, stderr)
+	}
+
+	srv := emailtest.NewServer(t, emailtest.Options{})
+	t.Setenv("CODEX_HOOK_EMAIL_HOST", srv.Host)
+	t.Setenv("CODEX_HOOK_EMAIL_PORT", strconv.Itoa(srv.Port))
+	t.Setenv("CODEX_HOOK_EMAIL_SECURITY", "none")
+	t.Setenv("CODEX_HOOK_EMAIL_FROM", "xcodex <bot@example.com>")
+	t.Setenv("CODEX_HOOK_EMAIL_TO", "me@example.com")
+	// The notifier's own settings don't stop the config loading.
+	t.Setenv("CODEX_HOOK_EMAIL_EVENTS", "*")
+	t.Setenv("CODEX_HOOK_EMAIL_MAX_PER_HOUR", "3")
+	_, markdown, _ := digestOf(fixture...)
+
+	// With --out the digest is written and mailed.
+	path := filepath.Join(t.TempDir(), "digest.md")
+	if code, out, stderr := digestOf(append([]string{"--send", "email", "--out", path}, fixture...)...); code != 0 || out != "" {
+		t.Fatalf("exit %d, stdout %q, stderr %q", code, out, stderr)
+	}
+	msg := srv.Wait(t, 1)[0]
+	if msg.Subject != "[xcodex] digest: 2026-03-02 to 2026-03-08" || strings.Join(msg.To, ",") != "me@example.com" {
+		t.Errorf("subject %q to %q", msg.Subject, msg.To)
+	}
+	if strings.TrimSpace(strings.ReplaceAll(msg.Body, "\r\n", "\n")) != strings.TrimSpace(markdown) {
+		t.Errorf("body:\n%s\nwant:\n%s", msg.Body, markdown)
+	}
+	if data, _ := os.ReadFile(path); string(data) != markdown {
+		t.Errorf("--out file:\n%s", data)
+	}
+}
+
+func TestCounterBounded(t *testing.T) {
+	// Past its cap the least counted value gives way. A value counted more than 1/cap of the
+	// time keeps its place however many others there are, its count never under the true one.
+	c := newCounter(10)
+	for i := 0; i < 5000; i++ {
+		c.add(fmt.Sprintf("cmd-%d", i))
+		if i%5 == 0 {
+			c.add("go")
+		}
+	}
+	if len(c.counts) > 10 {
+		t.Errorf("%d values counted, want at most 10", len(c.counts))
+	}
+	if top := c.top(1); len(top) != 1 || top[0].Name != "go" || top[0].Count < 1000 {
+		t.Errorf("top = %+v", top)
+	}
+
+	// Ties are in name order.
+	c = newCounter(10)
+	for _, v := range []string{"b", "a", "c", "a", "b"} {
+		c.add(v)
+	}
+	if top := c.top(5); fmt.Sprint(top) != "[{a 2} {b 2} {c 1}]" {
+		t.Errorf("top = %v", top)
+	}
+}
+
+func TestProgram(t *testing.T) {
+	for want, input := range map[string]any{
+		"go":     "go test ./...",
+		"git":    []any{"/usr/bin/git", "status"},
+		"npm":    []any{"bash", "-lc", "npm test && npm run lint"},
+		"make":   []any{"/bin/zsh", "-c", "make"},
+		"bash":   []any{"bash", "script.sh", "arg"},
+		"sh":     []any{"sh", "-c"},
+		"python": "python -c 'print(1)'",
+	} {
+		if got := program(hooksdk.HookPayloadJSON{"tool_input": map[string]any{"command": input}}); got != want {
+			t.Errorf("program(%v) = %q, want %q", input, got, want)
+		}
+	}
+	for _, p := range []hooksdk.HookPayloadJSON{{}, {"tool_input": map[string]any{"input": "patch"}}, {"tool_input": map[string]any{"command": ""}}} {
+		if got := program(p); got != "" {
+			t.Errorf("program(%v) = %q", p, got)
+		}
+	}
+}
+
+func TestThousands(t *testing.T) {
+	for n, want := range map[int64]string{0: "0", 999: "999", 1000: "1,000", 123456: "123,456", 1234567: "1,234,567", -1234: "-1,234"} {
+		if got := thousands(n); got != want {
+			t.Errorf("thousands(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,852 @@
+// Command hookdoctor checks a hooks installation for the problems that keep hooks from running
+// or their logs from being read.
+//
+//	go run ./cmd/hookdoctor [--json] [--mod DIR]... [--event TYPE] [hook [arg...]]
+//
+// It checks that CODEX_HOME is a writable directory; that `$CODEX_HOME/hooks/templates/go` holds
+// what `xcodex hooks install sdks go` installs; that the hook commands in `$CODEX_HOME/config.toml`
+// are executables built for this machine; that the replace directives of the SDK's go.mod files,
+// and of the modules given with --mod, point at the modules they replace; and that every file of
+// `$CODEX_HOME/hooks.jsonl` parses. Given a hook, it also runs it on a synthetic event, on stdin
+// and through a payload_path envelope as the host hands over large payloads, and checks that it
+// answers.
+//
+// The report is a PASS, FAIL, or SKIP line per check, or with --json one JSON object. The exit
+// status is 1 when any check failed.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// sdkModule is the module path of the SDK's go.mod.
+const sdkModule = "example.com/xcodex/hooks-sdk"
+
+// installedFiles are files `xcodex hooks install sdks go` installs, a few from each part of the
+// SDK; an install missing any of them is incomplete or from before the part existed.
+var installedFiles = []string{
+	"go.mod",
+	"README.md",
+	"hooksdk/hooksdk.go",
+	"hooksdk/version.go",
+	"hooksdk/types.go",
+	"hooksdk/internal/minitoml/minitoml.go",
+	"hooksdk/hooktest/hooktest.go",
+	"hooksdk/jsonl/jsonl.go",
+	"cmd/log_jsonl/main.go",
+	"cmd/newhook/main.go",
+	"cmd/newhook/templates/main.go.tmpl",
+	"cmd/hookdoctor/main.go",
+}
+
+// maxListedLines bounds the corrupt line numbers a log check's error lists.
+const maxListedLines = 10
+
+// maxStderrBytes bounds the hook stderr quoted in a round-trip failure.
+const maxStderrBytes = 1 << 10
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// result is the outcome of one check.
+type result struct {
+	Name string `json:"name"`
+	// Status is "pass", "fail", or "skip".
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Lines are the corrupt line numbers a log check found.
+	Lines []int `json:"lines,omitempty"`
+}
+
+// report is the outcome of every check, as --json writes it.
+type report struct {
+	CodexHome string `json:"codex_home"`
+	// CodexHomeSource is where CodexHome came from (see hooksdk.CodexHomeSource).
+	CodexHomeSource string   `json:"codex_home_source"`
+	Checks          []result `json:"checks"`
+	Passed          int      `json:"passed"`
+	Failed          int      `json:"failed"`
+	Skipped         int      `json:"skipped"`
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fl := flag.NewFlagSet("hookdoctor", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	asJSON := fl.Bool("json", false, "write the report as one JSON object")
+	var mods []string
+	fl.Func("mod", "also check the replace directives of the module in `dir` (repeatable)", func(s string) error {
+		mods = append(mods, s)
+		return nil
+	})
+	eventType := fl.String("event", "tool-call-finished", "the type of the synthetic event the hook is run on")
+	timeout := fl.Duration("timeout", 10*time.Second, "kill the hook after this long and fail the round trip")
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hookdoctor [flags] [hook [arg...]]\n\nChecks CODEX_HOME, the installed Go SDK, the hook commands in config.toml, and hooks.jsonl;\ngiven a hook, also runs it on a synthetic event.\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	fixture, ok := hooktest.Fixtures()[*eventType]
+	if !ok {
+		fmt.Fprintf(stderr, "hookdoctor: unknown --event %q\n", *eventType)
+		return 2
+	}
+	if *timeout <= 0 {
+		fmt.Fprintf(stderr, "hookdoctor: --timeout must be positive\n")
+		return 2
+	}
+
+	env := hooksdk.Environ()
+	ctx, stop := hooksdk.SignalContext()
+	defer stop()
+	rep := runChecks(ctx, env, checks(env, mods, fl.Args(), fixture, *timeout))
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			fmt.Fprintf(stderr, "hookdoctor: %v\n", err)
+			return 1
+		}
+	} else {
+		rep.print(stdout)
+	}
+	if rep.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checks returns every check to run, in report order.
+func checks(env hooksdk.Env, mods, hook []string, event *hooktest.Builder, timeout time.Duration) []hooksdk.Check {
+	sdk := env.Path("hooks", "templates", "go")
+	out := []hooksdk.Check{checkCodexHome(), checkLayout(sdk)}
+
+	config := env.Path("config.toml")
+	progs, err := hookCommands(config)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		out = append(out, skip("hook commands in "+config, "no config.toml"))
+	case err != nil:
+		out = append(out, failed("hook commands in "+config+" can be read", err))
+	case len(progs) == 0:
+		out = append(out, skip("hook commands in "+config, "no hook commands configured"))
+	}
+	for _, prog := range progs {
+		out = append(out, checkBinary(prog))
+	}
+
+	gomods := goModFiles(sdk)
+	for _, dir := range mods {
+		if filepath.Base(dir) != "go.mod" {
+			dir = filepath.Join(dir, "go.mod")
+		}
+		gomods = append(gomods, dir)
+	}
+	for _, path := range gomods {
+		out = append(out, checkReplaces(path))
+	}
+
+	log := env.Path("hooks.jsonl")
+	files := jsonl.Files(log)
+	if len(files) == 0 {
+		out = append(out, skip("log "+log+" parses", "no log"))
+	}
+	for _, path := range files {
+		out = append(out, checkLog(path))
+	}
+
+	if len(hook) == 0 {
+		out = append(out, skip("hook answers a synthetic event", "no hook given"))
+	} else {
+		out = append(out, checkRoundTrip(hook, event, timeout))
+	}
+	return out
+}
+
+// runChecks runs checks in order.
+func runChecks(ctx context.Context, env hooksdk.Env, checks []hooksdk.Check) report {
+	rep := report{CodexHome: env.CodexHome, CodexHomeSource: string(env.CodexHomeSource), Checks: []result{}}
+	for _, c := range checks {
+		r := result{Name: c.Name, Status: "pass"}
+		switch err := c.Run(ctx, env); {
+		case err == nil:
+			rep.Passed++
+		case errors.Is(err, hooksdk.ErrSkipped):
+			r.Status, r.Error = "skip", err.Error()
+			rep.Skipped++
+		default:
+			r.Status, r.Error = "fail", err.Error()
+			var corrupt *corruptError
+			if errors.As(err, &corrupt) {
+				r.Lines = corrupt.lines
+			}
+			rep.Failed++
+		}
+		rep.Checks = append(rep.Checks, r)
+	}
+	return rep
+}
+
+func (rep report) print(w io.Writer) {
+	if rep.CodexHomeSource == string(hooksdk.CodexHomeFromEnv) {
+		fmt.Fprintf(w, "hookdoctor: CODEX_HOME is %s\n", rep.CodexHome)
+	} else {
+		fmt.Fprintf(w, "hookdoctor: CODEX_HOME is unset; using %s (from %s)\n", rep.CodexHome, rep.CodexHomeSource)
+	}
+	for _, r := range rep.Checks {
+		if r.Error == "" {
+			fmt.Fprintf(w, "%-4s  %s\n", strings.ToUpper(r.Status), r.Name)
+		} else {
+			fmt.Fprintf(w, "%-4s  %s: %s\n", strings.ToUpper(r.Status), r.Name, r.Error)
+		}
+	}
+	fmt.Fprintf(w, "%d passed, %d failed, %d skipped\n", rep.Passed, rep.Failed, rep.Skipped)
+}
+
+// skip returns a check that is skipped for reason.
+func skip(name, reason string) hooksdk.Check {
+	return hooksdk.Check{Name: name, Run: func(context.Context, hooksdk.Env) error {
+		return fmt.Errorf("%w: %s", hooksdk.ErrSkipped, reason)
+	}}
+}
+
+// failed returns a check that fails with err.
+func failed(name string, err error) hooksdk.Check {
+	return hooksdk.Check{Name: name, Run: func(context.Context, hooksdk.Env) error { return err }}
+}
+
+// checkCodexHome checks that CODEX_HOME is a directory the hooks can write their logs and state
+// to.
+func checkCodexHome() hooksdk.Check {
+	return hooksdk.Check{
+		Name: "CODEX_HOME is a writable directory",
+		Run: func(ctx context.Context, env hooksdk.Env) error {
+			if err := hooksdk.CheckCodexHome().Run(ctx, env); err != nil {
+				return err
+			}
+			return hooksdk.CheckWritable("CODEX_HOME", env.CodexHome).Run(ctx, env)
+		},
+	}
+}
+
+// checkLayout checks that the SDK installed at dir has installedFiles and a go.mod for the SDK
+// module, and that every template under cmd has its main.go.
+func checkLayout(dir string) hooksdk.Check {
+	return hooksdk.Check{
+		Name: "SDK " + dir + " is installed",
+		Run: func(context.Context, hooksdk.Env) error {
+			if info, err := os.Stat(dir); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("%s doesn't exist; install it with `xcodex hooks install sdks go`", dir)
+				}
+				return err
+			} else if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			var missing []string
+			for _, rel := range installedFiles {
+				if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel))); err != nil || !info.Mode().IsRegular() {
+					missing = append(missing, rel)
+				}
+			}
+			entries, err := os.ReadDir(filepath.Join(dir, "cmd"))
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			for _, e := range entries {
+				rel := "cmd/" + e.Name() + "/main.go"
+				if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel))); e.IsDir() && err != nil && !contains(missing, rel) {
+					missing = append(missing, rel)
+				}
+			}
+			if len(missing) > 0 {
+				return fmt.Errorf("missing %s; reinstall with `xcodex hooks install sdks go`", strings.Join(missing, ", "))
+			}
+			if module := modulePath(filepath.Join(dir, "go.mod")); module != sdkModule {
+				return fmt.Errorf("go.mod is for module %q, not %s", module, sdkModule)
+			}
+			return nil
+		},
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hookArgvPattern matches the start of an argv array, `["prog"` or `['prog'`, capturing its first
+// element.
+var hookArgvPattern = regexp.MustCompile(`\[\s*("(?:[^"\\]|\\.)*"|'[^']*')`)
+
+// argvsPattern matches the start of an array of argv arrays.
+var argvsPattern = regexp.MustCompile(`^\[\s*\[`)
+
+// hookCommands returns the programs of the hook commands in the config.toml at path, each once:
+// the first element of every argv under `[hooks]` (`event = [["prog", ...], ...]`) and of every
+// `argv` in the `[hooks.command]` tables. It scans the lines of the file rather than parsing TOML,
+// and understands the forms docs/config.md shows, arrays spanning lines included.
+func hookCommands(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var progs []string
+	seen := map[string]bool{}
+	table := ""
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		line, depth := tomlCode(lines[i])
+		if strings.HasPrefix(line, "[") {
+			table = strings.TrimSpace(strings.Trim(line, "[]"))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		// An array continues to the line that closes its brackets.
+		for depth > 0 && i+1 < len(lines) {
+			i++
+			more, d := tomlCode(lines[i])
+			value += " " + more
+			depth += d
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		var argvs []string
+		switch {
+		case table == "hooks" && argvsPattern.MatchString(value):
+			for _, m := range hookArgvPattern.FindAllStringSubmatch(value, -1) {
+				argvs = append(argvs, m[1])
+			}
+		case strings.HasPrefix(table, "hooks.command") && key == "argv":
+			if m := hookArgvPattern.FindStringSubmatch(value); m != nil {
+				argvs = append(argvs, m[1])
+			}
+		}
+		for _, quoted := range argvs {
+			prog := tomlString(quoted)
+			if prog != "" && !seen[prog] {
+				seen[prog] = true
+				progs = append(progs, prog)
+			}
+		}
+	}
+	return progs, nil
+}
+
+// tomlCode returns line without its comment and surrounding space, and how many more brackets
+// it opens than it closes, outside strings.
+func tomlCode(line string) (string, int) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return strings.TrimSpace(line[:i]), depth
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		}
+	}
+	return strings.TrimSpace(line), depth
+}
+
+// tomlString returns the value of a quoted TOML string: a basic string, with escapes, or a
+// literal one.
+func tomlString(quoted string) string {
+	if strings.HasPrefix(quoted, "'") {
+		return strings.Trim(quoted, "'")
+	}
+	if s, err := strconv.Unquote(quoted); err == nil {
+		return s
+	}
+	return strings.Trim(quoted, `"`)
+}
+
+// checkBinary checks that the hook command prog (a path, or a name looked up in PATH as the host
+// does) is an executable file for this GOOS and GOARCH. Scripts pass once they are executable;
+// their interpreter is a command of its own.
+func checkBinary(prog string) hooksdk.Check {
+	return hooksdk.Check{
+		Name: "hook command " + prog + " is executable and built for " + runtime.GOOS + "/" + runtime.GOARCH,
+		Run: func(context.Context, hooksdk.Env) error {
+			path, err := exec.LookPath(prog)
+			if err != nil {
+				if info, serr := os.Stat(prog); serr == nil && info.Mode().IsRegular() {
+					return fmt.Errorf("%s is not executable (mode %v)", prog, info.Mode().Perm())
+				}
+				return err
+			}
+			goos, goarch, err := binaryPlatform(path)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			if (goos != "" && goos != runtime.GOOS) || (goarch != "" && goarch != runtime.GOARCH) {
+				return fmt.Errorf("%s is built for %s/%s; rebuild it here", path, orAny(goos), orAny(goarch))
+			}
+			return nil
+		},
+	}
+}
+
+func orAny(s string) string {
+	if s == "" {
+		return "any"
+	}
+	return s
+}
+
+// binaryPlatform returns the GOOS and GOARCH the executable at path runs on: exactly for a Go
+// binary, from its build info, and otherwise from its object format and machine, with goos "" for
+// an ELF file (which doesn't say which Unix it is for) and both "" for a script.
+func binaryPlatform(path string) (goos, goarch string, err error) {
+	if info, err := buildinfo.ReadFile(path); err == nil {
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "GOOS":
+				goos = s.Value
+			case "GOARCH":
+				goarch = s.Value
+			}
+		}
+		if goos != "" && goarch != "" {
+			return goos, goarch, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return "", "", errors.New("not an executable: too short")
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte("#!")):
+		return "", "", nil
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		ef, err := elf.NewFile(f)
+		if err != nil {
+			return "", "", err
+		}
+		goarch, ok := elfArch(ef)
+		if !ok {
+			return "", "", fmt.Errorf("ELF executable for unknown machine %v", ef.Machine)
+		}
+		if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+			return "linux", goarch, nil
+		}
+		return "", goarch, nil
+	case bytes.Equal(magic[:2], []byte("MZ")):
+		pf, err := pe.NewFile(f)
+		if err != nil {
+			return "", "", err
+		}
+		return "windows", peArch[pf.Machine], nil
+	}
+	if mf, err := macho.NewFile(f); err == nil {
+		return "darwin", machoArch[mf.Cpu], nil
+	}
+	if ff, err := macho.NewFatFile(f); err == nil {
+		// A universal binary runs here if any of its architectures does.
+		for _, a := range ff.Arches {
+			if machoArch[a.Cpu] == runtime.GOARCH {
+				return "darwin", runtime.GOARCH, nil
+			}
+		}
+		return "darwin", machoArch[ff.Arches[0].Cpu], nil
+	}
+	return "", "", errors.New("not an executable this system can run: neither a script nor an ELF, Mach-O, or PE binary")
+}
+
+func elfArch(f *elf.File) (string, bool) {
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return "amd64", true
+	case elf.EM_386:
+		return "386", true
+	case elf.EM_AARCH64:
+		return "arm64", true
+	case elf.EM_ARM:
+		return "arm", true
+	case elf.EM_RISCV:
+		return "riscv64", true
+	case elf.EM_LOONGARCH:
+		return "loong64", true
+	case elf.EM_S390:
+		return "s390x", true
+	case elf.EM_PPC64:
+		if f.ByteOrder == binary.LittleEndian {
+			return "ppc64le", true
+		}
+		return "ppc64", true
+	}
+	return "", false
+}
+
+var peArch = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_I386:  "386",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+}
+
+var machoArch = map[macho.Cpu]string{
+	macho.CpuAmd64: "amd64",
+	macho.Cpu386:   "386",
+	macho.CpuArm64: "arm64",
+	macho.CpuArm:   "arm",
+}
+
+// goModFiles returns the go.mod files of the SDK installed at dir: its own and those of the
+// templates that are modules of their own, such as cmd/log_sqlite.
+func goModFiles(dir string) []string {
+	var out []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && d.Name() == "go.mod" {
+			out = append(out, path)
+		}
+		return nil
+	})
+	return out
+}
+
+// replace is a replace directive of a go.mod file.
+type replace struct {
+	line    int
+	module  string
+	target  string
+	version string
+}
+
+// checkReplaces checks that every replace directive of the go.mod at path that replaces a module
+// with a directory names a directory holding that module, as the go command requires.
+func checkReplaces(path string) hooksdk.Check {
+	return hooksdk.Check{
+		Name: "go.mod " + path + " replace directives resolve",
+		Run: func(context.Context, hooksdk.Env) error {
+			reps, err := replaces(path)
+			if err != nil {
+				return err
+			}
+			var errs []string
+			for _, r := range reps {
+				if r.version != "" || !isLocalPath(r.target) {
+					continue
+				}
+				dir := r.target
+				if !filepath.IsAbs(dir) {
+					dir = filepath.Join(filepath.Dir(path), filepath.FromSlash(dir))
+				}
+				switch module := modulePath(filepath.Join(dir, "go.mod")); module {
+				case r.module:
+				case "":
+					errs = append(errs, fmt.Sprintf("line %d: %s => %s: %s has no go.mod", r.line, r.module, r.target, dir))
+				default:
+					errs = append(errs, fmt.Sprintf("line %d: %s => %s: %s is module %s", r.line, r.module, r.target, dir, module))
+				}
+			}
+			if len(errs) > 0 {
+				return errors.New(strings.Join(errs, "; "))
+			}
+			return nil
+		},
+	}
+}
+
+// replaces returns the replace directives of the go.mod at path, single-line and in blocks.
+func replaces(path string) ([]replace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []replace
+	inBlock := false
+	for i, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		switch {
+		case inBlock && len(fields) == 1 && fields[0] == ")":
+			inBlock = false
+			continue
+		case inBlock:
+		case len(fields) == 2 && fields[0] == "replace" && fields[1] == "(":
+			inBlock = true
+			continue
+		case len(fields) > 0 && fields[0] == "replace":
+			fields = fields[1:]
+		default:
+			continue
+		}
+		old, target, ok := cutFields(fields, "=>")
+		if !ok || len(old) == 0 || len(old) > 2 || len(target) == 0 || len(target) > 2 {
+			return nil, fmt.Errorf("line %d: malformed replace directive", i+1)
+		}
+		r := replace{line: i + 1, module: unquote(old[0]), target: unquote(target[0])}
+		if len(target) == 2 {
+			r.version = target[1]
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func cutFields(fields []string, sep string) (before, after []string, ok bool) {
+	for i, f := range fields {
+		if f == sep {
+			return fields[:i], fields[i+1:], true
+		}
+	}
+	return fields, nil, false
+}
+
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// isLocalPath reports whether a replacement is a directory rather than a module path: the go
+// command takes one starting with ./ or ../, or an absolute path, as a directory.
+func isLocalPath(target string) bool {
+	return target == "." || target == ".." || strings.HasPrefix(target, "./") || strings.HasPrefix(target, "../") ||
+		strings.HasPrefix(target, `.\`) || strings.HasPrefix(target, `..\`) || filepath.IsAbs(target)
+}
+
+// modulePath returns the module path the go.mod at path declares, or "" if there is none.
+func modulePath(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// corruptError is a log check's failure: the records of the log that aren't JSON objects.
+type corruptError struct {
+	lines   []int
+	records int
+}
+
+func (e *corruptError) Error() string {
+	listed := e.lines
+	if len(listed) > maxListedLines {
+		listed = listed[:maxListedLines]
+	}
+	nums := make([]string, len(listed))
+	for i, n := range listed {
+		nums[i] = strconv.Itoa(n)
+	}
+	more := ""
+	if len(e.lines) > len(listed) {
+		more = fmt.Sprintf(", and %d more", len(e.lines)-len(listed))
+	}
+	return fmt.Sprintf("%d of %d record(s) are not JSON objects, at line(s) %s%s", len(e.lines), e.records, strings.Join(nums, ", "), more)
+}
+
+// checkLog checks that every record of the log file at path is a JSON object, as cmd/log_jsonl
+// writes them; the failure is a *corruptError.
+func checkLog(path string) hooksdk.Check {
+	return hooksdk.Check{
+		Name: "log " + path + " parses",
+		Run: func(context.Context, hooksdk.Env) error {
+			lines, records, err := corruptLines(path)
+			if err != nil {
+				return err
+			}
+			if len(lines) > 0 {
+				return &corruptError{lines: lines, records: records}
+			}
+			return nil
+		},
+	}
+}
+
+// corruptLines reads the log file at path, gzipped or not, and returns the line numbers of its
+// records that aren't JSON objects, and how many records it has, its header not counted. A
+// FormatPretty record is numbered by its first line.
+func corruptLines(path string) (lines []int, records int, err error) {
+	f, err := jsonl.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	var dec jsonl.Decoder
+	decode := func(line int, rec []byte) {
+		if len(bytes.TrimSpace(rec)) == 0 {
+			return
+		}
+		ev, err := dec.Decode(rec)
+		switch {
+		case err != nil:
+			lines = append(lines, line)
+		case ev.Payload == nil:
+			// The header.
+			return
+		}
+		records++
+	}
+	br := bufio.NewReaderSize(f, 64<<10)
+	var pretty []byte
+	prettyLine := 0
+	for n := 1; ; n++ {
+		data, rerr := br.ReadBytes('\n')
+		switch trimmed := bytes.TrimRight(data, "\r\n"); {
+		case string(trimmed) == "---":
+			if prettyLine > 0 {
+				decode(prettyLine, pretty)
+			}
+			pretty, prettyLine = pretty[:0], n+1
+		case prettyLine > 0:
+			pretty = append(pretty, data...)
+		default:
+			decode(n, data)
+		}
+		if rerr == io.EOF {
+			if prettyLine > 0 {
+				decode(prettyLine, pretty)
+			}
+			return lines, records, nil
+		}
+		if rerr != nil {
+			return lines, records, rerr
+		}
+	}
+}
+
+// checkRoundTrip runs hook on event twice, with the payload on stdin and in a payload_path file,
+// and checks that it exits as a hook does and that what it writes to stdout is a response.
+func checkRoundTrip(hook []string, event *hooktest.Builder, timeout time.Duration) hooksdk.Check {
+	eventType, _ := event.Map()["xcodex_event_type"].(string)
+	return hooksdk.Check{
+		Name: "hook " + strings.Join(hook, " ") + " answers a synthetic " + eventType + " event",
+		Run: func(ctx context.Context, env hooksdk.Env) error {
+			payload := event.
+				With("event_id", fmt.Sprintf("hookdoctor-%d", time.Now().UnixNano())).
+				With("timestamp", time.Now().UTC().Format(time.RFC3339)).
+				WithSessionID("hookdoctor").
+				Bytes()
+			if err := roundTrip(ctx, hook, payload, timeout); err != nil {
+				return fmt.Errorf("payload on stdin: %w", err)
+			}
+			dir, err := os.MkdirTemp("", "hookdoctor-")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "payload.json")
+			if err := os.WriteFile(path, payload, 0o600); err != nil {
+				return err
+			}
+			// The envelope repeats the fields the host puts beside payload_path.
+			fields := event.Map()
+			envelope := map[string]any{"payload_path": path}
+			for _, key := range []string{"schema_version", "event_id", "timestamp", "hook_event_name", "xcodex_event_type"} {
+				if v, ok := fields[key]; ok {
+					envelope[key] = v
+				}
+			}
+			stdin, err := json.Marshal(envelope)
+			if err != nil {
+				return err
+			}
+			if err := roundTrip(ctx, hook, stdin, timeout); err != nil {
+				return fmt.Errorf("payload_path envelope: %w", err)
+			}
+			return nil
+		},
+	}
+}
+
+// roundTrip runs hook with stdin and checks how it answers, as the host reads the answer: exit
+// status 0 (or 2, a deny) and stdout empty or a response with a known decision.
+func roundTrip(ctx context.Context, hook []string, stdin []byte, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, hook[0], hook[1:]...)
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fmt.Errorf("timed out after %v", timeout)
+	case err != nil && !errors.As(err, &exitErr):
+		return err
+	}
+	if code := cmd.ProcessState.ExitCode(); code != hooksdk.ExitOK && code != hooksdk.ExitDeny {
+		msg := fmt.Sprintf("exit status %d", code)
+		if s := strings.TrimSpace(hooksdk.TruncateString(stderr.String(), maxStderrBytes)); s != "" {
+			msg += ": " + s
+		}
+		return errors.New(msg)
+	}
+	out := bytes.TrimSpace(stdout.Bytes())
+	if len(out) == 0 {
+		return nil
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return fmt.Errorf("stdout is not a response: %v", err)
+	}
+	switch resp.Decision {
+	case "", hooksdk.DecisionAllow, hooksdk.DecisionDeny, hooksdk.DecisionAsk:
+		return nil
+	}
+	return fmt.Errorf("response has unknown decision %q", resp.Decision)
+}
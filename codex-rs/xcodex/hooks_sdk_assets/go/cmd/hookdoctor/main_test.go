@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// TestMain lets the round-trip tests run this binary as the hook: with HOOKDOCTOR_TEST_HOOK set
+// it is testHook.
+func TestMain(m *testing.M) {
+	if mode := os.Getenv("HOOKDOCTOR_TEST_HOOK"); mode != "" {
+		os.Exit(testHook(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// testHook reads the payload as a hook does and answers as mode says: "allow" and "deny" answer
+// so, "silent" writes nothing, "crash" fails, "garbage" writes something that isn't a response,
+// "maybe" answers an unknown decision, "sleep" hangs, and "stdin" only understands a bare
+// payload, as a hook predating payload_path envelopes does.
+func testHook(mode string) int {
+	var session string
+	if mode == "stdin" {
+		var p map[string]any
+		if err := json.NewDecoder(os.Stdin).Decode(&p); err != nil || p["session_id"] == nil {
+			fmt.Fprintln(os.Stderr, "stdin is not a payload")
+			return 1
+		}
+		session, _ = p["session_id"].(string)
+	} else {
+		p, err := hooksdk.ReadPayload()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		session = p.SessionID()
+	}
+	if session != "hookdoctor" {
+		fmt.Fprintf(os.Stderr, "session %q\n", session)
+		return 1
+	}
+	switch mode {
+	case "deny":
+		hooksdk.WriteResponse(hooksdk.Deny("no"))
+		return hooksdk.ExitDeny
+	case "silent":
+	case "crash":
+		fmt.Fprintln(os.Stderr, "boom")
+		return 3
+	case "garbage":
+		fmt.Println("not a response")
+	case "maybe":
+		fmt.Println(`{"decision":"maybe"}`)
+	case "sleep":
+		time.Sleep(time.Minute)
+	default:
+		hooksdk.WriteResponse(hooksdk.Allow())
+	}
+	return 0
+}
+
+// setup points CODEX_HOME at a new directory and returns its Env.
+func setup(t *testing.T) hooksdk.Env {
+	t.Helper()
+	t.Setenv("CODEX_HOME", t.TempDir())
+	return hooksdk.Environ()
+}
+
+// runCheck runs c and returns its error, failing the test unless it contains want ("" for
+// success).
+func runCheck(t *testing.T, env hooksdk.Env, c hooksdk.Check, want string) {
+	t.Helper()
+	err := c.Run(context.Background(), env)
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("%s: %v", c.Name, err)
+	case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+		t.Errorf("%s = %v, want an error containing %q", c.Name, err, want)
+	}
+}
+
+func writeFile(t *testing.T, path, data string, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckCodexHome(t *testing.T) {
+	env := setup(t)
+	runCheck(t, env, checkCodexHome(), "")
+
+	t.Setenv("CODEX_HOME", filepath.Join(env.CodexHome, "missing"))
+	runCheck(t, hooksdk.Environ(), checkCodexHome(), "no such file")
+
+	file := filepath.Join(env.CodexHome, "file")
+	writeFile(t, file, "", 0o644)
+	t.Setenv("CODEX_HOME", file)
+	runCheck(t, hooksdk.Environ(), checkCodexHome(), "is not a directory")
+
+	// With CODEX_HOME unset, the report says which fallback it used, or why none would do.
+	xdg := t.TempDir()
+	var out bytes.Buffer
+	fallback := hooksdk.FromMap(map[string]string{"XDG_STATE_HOME": xdg})
+	runChecks(context.Background(), fallback, []hooksdk.Check{checkCodexHome()}).print(&out)
+	want := "hookdoctor: CODEX_HOME is unset; using " + filepath.Join(xdg, "xcodex") + " (from XDG_STATE_HOME)\nPASS  CODEX_HOME is a writable directory\n"
+	if !strings.HasPrefix(out.String(), want) {
+		t.Errorf("report =\n%s\nwant\n%s", out.String(), want)
+	}
+	file = filepath.Join(t.TempDir(), "file")
+	writeFile(t, file, "", 0o644)
+	none := hooksdk.FromMap(map[string]string{"XDG_STATE_HOME": file, "HOME": file, "TMPDIR": file})
+	runCheck(t, none, checkCodexHome(), "CODEX_HOME is unset and none of ")
+}
+
+// installSDK writes the files checkLayout looks for to a new SDK directory and returns it.
+func installSDK(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "templates", "go")
+	for _, rel := range installedFiles {
+		writeFile(t, filepath.Join(dir, filepath.FromSlash(rel)), "package x\n", 0o644)
+	}
+	writeFile(t, filepath.Join(dir, "go.mod"), "module "+sdkModule+"\n\ngo 1.21\n", 0o644)
+	return dir
+}
+
+func TestCheckLayout(t *testing.T) {
+	env := setup(t)
+	dir := installSDK(t)
+	runCheck(t, env, checkLayout(dir), "")
+
+	runCheck(t, env, checkLayout(filepath.Join(dir, "missing")), "install it with `xcodex hooks install sdks go`")
+	runCheck(t, env, checkLayout(filepath.Join(dir, "go.mod")), "is not a directory")
+
+	// A template without its main.go, and a missing file, are listed.
+	if err := os.MkdirAll(filepath.Join(dir, "cmd", "notify_chat"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "hooksdk", "jsonl", "jsonl.go"))
+	runCheck(t, env, checkLayout(dir), "missing hooksdk/jsonl/jsonl.go, cmd/notify_chat/main.go; reinstall")
+
+	// A listed template missing its main.go is only listed once.
+	dir = installSDK(t)
+	os.Remove(filepath.Join(dir, "cmd", "newhook", "main.go"))
+	runCheck(t, env, checkLayout(dir), "missing cmd/newhook/main.go; reinstall")
+
+	dir = installSDK(t)
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/other\n", 0o644)
+	runCheck(t, env, checkLayout(dir), `go.mod is for module "example.com/other"`)
+}
+
+func TestHookCommands(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.toml")
+	writeFile(t, config, `model = "o3"
+notify = ["notify-send", "done"]
+
+[hooks]
+agent_turn_complete = [["python3", "/home/a/hook.py"]] # a comment ["ignored"]
+approval_requested = [
+  ["/home/a/bin/hook-approve", "--strict"],
+  ['C:\hooks\hook.exe'],
+]
+tool_call_started = [["python3", "/home/a/other.py"], ["hook-\"quoted\""]]
+inproc = ["event_log_jsonl"]
+
+[hooks.command]
+default_timeout_sec = 30
+
+[[hooks.command.tool_call_finished]]
+matcher = "write_file"
+  [[hooks.command.tool_call_finished.hooks]]
+  argv = ["/home/a/bin/hook-summary", "--verbose"]
+  [[hooks.command.tool_call_finished.hooks]]
+  argv = [
+    "/home/a/bin/hook-log",
+  ]
+
+[hooks.host]
+command = ["python3", "-u", "/home/a/host.py"]
+`, 0o644)
+	progs, err := hookCommands(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"python3", "/home/a/bin/hook-approve", `C:\hooks\hook.exe`, `hook-"quoted"`, "/home/a/bin/hook-summary", "/home/a/bin/hook-log"}
+	if !reflect.DeepEqual(progs, want) {
+		t.Errorf("hookCommands = %q, want %q", progs, want)
+	}
+
+	if _, err := hookCommands(filepath.Join(t.TempDir(), "config.toml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("hookCommands of a missing file = %v", err)
+	}
+}
+
+// header returns the bytes of v as an executable's header.
+func header(t *testing.T, v ...any) string {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, x := range v {
+		if err := binary.Write(&buf, binary.LittleEndian, x); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+// elfHeader is the header of an ELF executable for machine, without sections.
+func elfHeader(t *testing.T, machine elf.Machine) string {
+	ident := [16]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)}
+	return header(t, elf.Header64{
+		Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT),
+		Ehsize: 64, Phentsize: 56, Shentsize: 64,
+	})
+}
+
+// foreign returns a GOARCH other than this one, and its ELF machine.
+func foreign() (string, elf.Machine) {
+	if runtime.GOARCH == "arm64" {
+		return "amd64", elf.EM_X86_64
+	}
+	return "arm64", elf.EM_AARCH64
+}
+
+func TestCheckBinary(t *testing.T) {
+	env := setup(t)
+	dir := t.TempDir()
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCheck(t, env, checkBinary(self), "")
+
+	script := filepath.Join(dir, "hook.sh")
+	writeFile(t, script, "#!/bin/sh\nexit 0\n", 0o755)
+	runCheck(t, env, checkBinary(script), "")
+
+	// A name is looked up in PATH, as the host does.
+	t.Setenv("PATH", dir)
+	runCheck(t, env, checkBinary("hook.sh"), "")
+	runCheck(t, env, checkBinary("hook-missing"), "executable file not found")
+
+	plain := filepath.Join(dir, "plain")
+	writeFile(t, plain, "#!/bin/sh\n", 0o644)
+	runCheck(t, env, checkBinary(plain), "is not executable (mode -rw-r--r--)")
+
+	arch, machine := foreign()
+	goos := "any"
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		goos = "linux"
+	}
+	executables := map[string][2]string{
+		"elf":         {elfHeader(t, machine), "is built for " + goos + "/" + arch + "; rebuild it here"},
+		"elf unknown": {elfHeader(t, elf.EM_SPARC), "ELF executable for unknown machine EM_SPARC"},
+		"pe":          {"MZ" + strings.Repeat("\x00", 0x3a) + header(t, uint32(0x40)) + "PE\x00\x00" + header(t, pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_ARM64}) + strings.Repeat("\x00", 8), "windows/arm64"},
+		"macho":       {header(t, macho.FileHeader{Magic: macho.Magic64, Cpu: macho.CpuArm64, Type: macho.TypeExec}, uint32(0)), "darwin/arm64"},
+		"short":       {"#", "too short"},
+		"text":        {"hello, world\n", "neither a script nor an ELF, Mach-O, or PE binary"},
+	}
+	for name, tt := range executables {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, tt[0], 0o755)
+		want := tt[1]
+		if (name == "pe" && runtime.GOOS == "windows" && runtime.GOARCH == "arm64") || (name == "macho" && runtime.GOOS == "darwin" && runtime.GOARCH == "arm64") {
+			want = ""
+		}
+		runCheck(t, env, checkBinary(path), want)
+	}
+}
+
+// module writes a go.mod for module path to dir/rel and returns the directory.
+func module(t *testing.T, dir, rel, path string) string {
+	t.Helper()
+	writeFile(t, filepath.Join(dir, filepath.FromSlash(rel), "go.mod"), "module "+path+"\n", 0o644)
+	return filepath.Join(dir, filepath.FromSlash(rel))
+}
+
+func TestCheckReplaces(t *testing.T) {
+	env := setup(t)
+	dir := t.TempDir()
+	module(t, dir, "sdk", sdkModule)
+	abs := module(t, dir, "abs", "example.com/abs")
+	module(t, dir, "hook", "example.com/hook")
+	gomod := filepath.Join(dir, "hook", "go.mod")
+	writeFile(t, gomod, `module example.com/hook
+
+replace example.com/xcodex/hooks-sdk => ../sdk // the installed SDK
+
+replace (
+	"example.com/abs" v1.0.0 => `+abs+`
+	example.com/fork => github.com/a/fork v1.2.3
+	example.com/vendored => ./vendored v1.0.0
+)
+`, 0o644)
+	runCheck(t, env, checkReplaces(gomod), "")
+
+	writeFile(t, gomod, `module example.com/hook
+
+replace example.com/xcodex/hooks-sdk => ../abs
+replace (
+	example.com/gone => ../gone
+)
+`, 0o644)
+	runCheck(t, env, checkReplaces(gomod), "line 3: "+sdkModule+" => ../abs: "+filepath.Join(dir, "abs")+" is module example.com/abs; line 5: example.com/gone => ../gone: "+filepath.Join(dir, "gone")+" has no go.mod")
+
+	writeFile(t, gomod, "module example.com/hook\n\nreplace example.com/a\n", 0o644)
+	runCheck(t, env, checkReplaces(gomod), "line 3: malformed replace directive")
+	runCheck(t, env, checkReplaces(filepath.Join(dir, "missing", "go.mod")), "no such file")
+}
+
+// writeLog writes records, and a header line, to a log file at path, gzipped if it ends in .gz.
+func writeLog(t *testing.T, path string, f jsonl.Format, records ...string) {
+	t.Helper()
+	header, err := jsonl.Meta{Format: jsonl.MetaFormatPlain, SDK: "1.0.0"}.Header(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := string(header)
+	for _, rec := range records {
+		if f == jsonl.FormatPretty {
+			data += "---\n"
+		}
+		data += rec + "\n"
+	}
+	if strings.HasSuffix(path, ".gz") {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(data))
+		zw.Close()
+		data = buf.String()
+	}
+	writeFile(t, path, data, 0o644)
+}
+
+func TestCheckLog(t *testing.T) {
+	env := setup(t)
+	dir := t.TempDir()
+	event := `{"xcodex_event_type":"session-start","session_id":"s"}`
+
+	ok := filepath.Join(dir, "ok.jsonl")
+	writeLog(t, ok, jsonl.FormatJSONL, event, "", event)
+	runCheck(t, env, checkLog(ok), "")
+
+	// Line numbers count the header; a blank line is no record.
+	broken := filepath.Join(dir, "broken.jsonl.1.gz")
+	writeLog(t, broken, jsonl.FormatJSONL, event, `{"xcodex_event_type":"session-st`, "", "[1]", event)
+	runCheck(t, env, checkLog(broken), "2 of 4 record(s) are not JSON objects, at line(s) 3, 5")
+
+	// A pretty record is numbered by its first line, after the header's nine and the first
+	// record's four.
+	pretty := filepath.Join(dir, "pretty.jsonl")
+	writeLog(t, pretty, jsonl.FormatPretty, "{\n  \"a\": 1\n}", "{\n  \"a\":", "{}")
+	runCheck(t, env, checkLog(pretty), "1 of 3 record(s) are not JSON objects, at line(s) 15")
+
+	// Past maxListedLines, the rest are counted; the report has them all.
+	many := filepath.Join(dir, "many.jsonl")
+	var records []string
+	for i := 0; i < 12; i++ {
+		records = append(records, "oops")
+	}
+	writeLog(t, many, jsonl.FormatJSONL, records...)
+	runCheck(t, env, checkLog(many), "12 of 12 record(s) are not JSON objects, at line(s) 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, and 2 more")
+	rep := runChecks(context.Background(), env, []hooksdk.Check{checkLog(ok), checkLog(many)})
+	if want := []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}; rep.Failed != 1 || rep.Checks[0].Lines != nil || !reflect.DeepEqual(rep.Checks[1].Lines, want) {
+		t.Errorf("report = %+v", rep)
+	}
+
+	runCheck(t, env, checkLog(filepath.Join(dir, "missing.jsonl")), "no such file")
+}
+
+// hook returns the argv that runs this binary as testHook in mode.
+func hook(t *testing.T, mode string) []string {
+	t.Helper()
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOOKDOCTOR_TEST_HOOK", mode)
+	return []string{self}
+}
+
+func TestCheckRoundTrip(t *testing.T) {
+	env := setup(t)
+	event := hooktest.ToolCallFinished()
+	for mode, want := range map[string]string{
+		"allow":   "",
+		"deny":    "",
+		"silent":  "",
+		"crash":   "payload on stdin: exit status 3: boom",
+		"garbage": "payload on stdin: stdout is not a response",
+		"maybe":   `payload on stdin: response has unknown decision "maybe"`,
+		"stdin":   "payload_path envelope: exit status 1: stdin is not a payload",
+	} {
+		c := checkRoundTrip(hook(t, mode), event, 10*time.Second)
+		if !strings.HasSuffix(c.Name, " answers a synthetic tool-call-finished event") {
+			t.Errorf("name = %q", c.Name)
+		}
+		runCheck(t, env, c, want)
+	}
+
+	start := time.Now()
+	runCheck(t, env, checkRoundTrip(hook(t, "sleep"), event, 200*time.Millisecond), "payload on stdin: timed out after 200ms")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timed-out round trip took %v", elapsed)
+	}
+	runCheck(t, env, checkRoundTrip([]string{filepath.Join(t.TempDir(), "missing")}, event, time.Second), "payload on stdin:")
+}
+
+func TestRun(t *testing.T) {
+	env := setup(t)
+	sdk := env.Path("hooks", "templates", "go")
+	for _, rel := range installedFiles {
+		writeFile(t, filepath.Join(sdk, filepath.FromSlash(rel)), "package x\n", 0o644)
+	}
+	writeFile(t, filepath.Join(sdk, "go.mod"), "module "+sdkModule+"\n", 0o644)
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	writeFile(t, script, "#!/bin/sh\n", 0o755)
+	writeFile(t, env.Path("config.toml"), "[hooks]\nsession_start = [[\""+filepath.ToSlash(script)+"\"]]\n", 0o644)
+	writeLog(t, env.Path("hooks.jsonl"), jsonl.FormatJSONL, `{"a":1}`)
+	argv := hook(t, "allow")
+
+	var stdout, stderr bytes.Buffer
+	if code := run(append([]string{"--json", "--event", "session-start"}, argv...), &stdout, &stderr); code != 0 {
+		t.Fatalf("run = %d\n%s%s", code, stdout.String(), stderr.String())
+	}
+	var rep report
+	if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range rep.Checks {
+		names = append(names, c.Status+" "+c.Name)
+	}
+	want := []string{
+		"pass CODEX_HOME is a writable directory",
+		"pass SDK " + sdk + " is installed",
+		"pass hook command " + script + " is executable and built for " + runtime.GOOS + "/" + runtime.GOARCH,
+		"pass go.mod " + filepath.Join(sdk, "go.mod") + " replace directives resolve",
+		"pass log " + env.Path("hooks.jsonl") + " parses",
+		"pass hook " + argv[0] + " answers a synthetic session-start event",
+	}
+	if rep.CodexHome != env.CodexHome || rep.CodexHomeSource != string(hooksdk.CodexHomeFromEnv) || rep.Passed != 6 || rep.Failed != 0 || !reflect.DeepEqual(names, want) {
+		t.Errorf("report = %+v\nchecks %q", rep, names)
+	}
+
+	// Broken, it says what failed and exits 1; what it can't check is skipped.
+	os.Remove(env.Path("config.toml"))
+	os.Remove(filepath.Join(sdk, "hooksdk", "types.go"))
+	writeLog(t, env.Path("hooks.jsonl"), jsonl.FormatJSONL, `{"a":1}`, "{")
+	stdout.Reset()
+	if code := run(nil, &stdout, &stderr); code != 1 {
+		t.Errorf("run of a broken install = %d", code)
+	}
+	for _, line := range []string{
+		"hookdoctor: CODEX_HOME is " + env.CodexHome + "\n",
+		"PASS  CODEX_HOME is a writable directory\n",
+		"FAIL  SDK " + sdk + " is installed: missing hooksdk/types.go; reinstall with `xcodex hooks install sdks go`\n",
+		"SKIP  hook commands in " + env.Path("config.toml") + ": skipped: no config.toml\n",
+		"FAIL  log " + env.Path("hooks.jsonl") + " parses: 1 of 2 record(s) are not JSON objects, at line(s) 3\n",
+		"SKIP  hook answers a synthetic event: skipped: no hook given\n",
+		"2 passed, 2 failed, 2 skipped\n",
+	} {
+		if !strings.Contains(stdout.String(), line) {
+			t.Errorf("report lacks %q:\n%s", line, stdout.String())
+		}
+	}
+
+	// --mod checks another module's go.mod too.
+	mod := t.TempDir()
+	writeFile(t, filepath.Join(mod, "go.mod"), "module example.com/mine\n\nreplace "+sdkModule+" => ./nowhere\n", 0o644)
+	stdout.Reset()
+	run([]string{"--mod", mod}, &stdout, &stderr)
+	if want := "FAIL  go.mod " + filepath.Join(mod, "go.mod") + " replace directives resolve: line 3"; !strings.Contains(stdout.String(), want) {
+		t.Errorf("report lacks %q:\n%s", want, stdout.String())
+	}
+
+	for _, args := range [][]string{{"--event", "nope"}, {"--timeout", "0s"}, {"--bogus"}} {
+		stderr.Reset()
+		if code := run(args, &stdout, &stderr); code != 2 || stderr.Len() == 0 {
+			t.Errorf("run %q = %d, %q", args, code, stderr.String())
+		}
+	}
+	if code := run([]string{"-h"}, &stdout, &stderr); code != 0 {
+		t.Errorf("run -h = %d", code)
+	}
+}
@@ -0,0 +1,506 @@
+// Command hookexport converts hooks.jsonl logs, as written by cmd/log_jsonl, to Parquet, for
+// DuckDB, pandas, and other tools that load JSON slowly.
+//
+//	go run ./cmd/hookexport [flags] [file...]
+//
+// Without files it reads `$CODEX_HOME/hooks.jsonl` and its rotated generations, oldest first,
+// gzipped or not, as cmd/hookq does. The common fields get typed columns (timestamp, event_type,
+// session_id, tool_name, duration_ms, exit_code) and the rest of each payload is kept as JSON in
+// the payload column. Rows are written in row groups of --batch rows, so memory stays bounded
+// however large the log is.
+//
+// With --partition date the output is a directory in the Hive layout
+// (`date=2025-01-31/part-....parquet`), and --append adds the events logged since the previous
+// export to such a directory.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/parquet"
+)
+
+// columns is the schema of every exported file.
+var columns = []parquet.Column{
+	{Name: "timestamp", Type: parquet.Timestamp, Optional: true},
+	{Name: "event_type", Type: parquet.String, Optional: true},
+	{Name: "session_id", Type: parquet.String, Optional: true},
+	{Name: "tool_name", Type: parquet.String, Optional: true},
+	{Name: "duration_ms", Type: parquet.Int64, Optional: true},
+	{Name: "exit_code", Type: parquet.Int32, Optional: true},
+	{Name: "payload", Type: parquet.String},
+}
+
+// stateFile, in an output directory, records the newest event exported to it, for --append.
+const stateFile = "_hookexport.json"
+
+// nullPartition is where events without a time go with --partition date, as Hive names a null
+// partition value.
+const nullPartition = "__HIVE_DEFAULT_PARTITION__"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr, time.Now()))
+}
+
+type filters struct {
+	types hooksdk.Filter
+	since time.Time
+	until time.Time
+	// after is the newest event of the previous export, for --append.
+	after time.Time
+}
+
+func run(args []string, stderr io.Writer, now time.Time) int {
+	fl := flag.NewFlagSet("hookexport", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	out := fl.String("out", "", "the Parquet file to write, or the directory with --partition or --append (default hooks.parquet, or hooks-parquet for a directory)")
+	types := fl.String("type", "", "comma-separated event types to export, with * suffix wildcards (e.g. tool-call-*)")
+	since := fl.String("since", "", "export events at or after this time (RFC 3339, a date, or a duration ago such as 24h)")
+	until := fl.String("until", "", "export events before this time (same forms as --since)")
+	partition := fl.String("partition", "", "write a directory partitioned by event date (UTC): date")
+	appendTo := fl.Bool("append", false, "add the events newer than the previous export to the output directory")
+	batch := fl.Int("batch", parquet.DefaultRowGroupRows, "rows per row group, which bounds memory")
+	codec := fl.String("codec", "gzip", "page compression: gzip or none")
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hookexport [flags] [file...]\n\nReads $CODEX_HOME/hooks.jsonl and its rotated generations when no file is given ('-' is stdin).\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	f := filters{types: hooksdk.ParseFilter(*types, "")}
+	var err error
+	if f.since, err = parseTime(*since, now); err != nil {
+		fmt.Fprintf(stderr, "hookexport: --since: %v\n", err)
+		return 2
+	}
+	if f.until, err = parseTime(*until, now); err != nil {
+		fmt.Fprintf(stderr, "hookexport: --until: %v\n", err)
+		return 2
+	}
+	if *partition != "" && *partition != "date" {
+		fmt.Fprintf(stderr, "hookexport: unknown --partition %q (want date)\n", *partition)
+		return 2
+	}
+	if *batch < 1 {
+		fmt.Fprintf(stderr, "hookexport: --batch must be positive\n")
+		return 2
+	}
+	e := &exporter{
+		partition: *partition == "date",
+		dir:       *partition != "" || *appendTo,
+		batch:     *batch,
+		run:       now.UTC().Format("20060102T150405Z"),
+	}
+	switch *codec {
+	case "gzip":
+		e.codec = parquet.Gzip
+	case "none":
+		e.codec = parquet.Uncompressed
+	default:
+		fmt.Fprintf(stderr, "hookexport: unknown --codec %q (want gzip or none)\n", *codec)
+		return 2
+	}
+	e.out = *out
+	if e.out == "" {
+		e.out = "hooks.parquet"
+		if e.dir {
+			e.out = "hooks-parquet"
+		}
+	}
+	if e.dir {
+		st, err := loadState(e.out)
+		switch {
+		case err != nil:
+			fmt.Fprintf(stderr, "hookexport: %v\n", err)
+			return 1
+		case st != nil && !*appendTo:
+			fmt.Fprintf(stderr, "hookexport: %s already holds an export; pass --append to add to it\n", e.out)
+			return 1
+		case st != nil:
+			f.after = st.Last
+		}
+		e.last = f.after
+	}
+
+	files := fl.Args()
+	if len(files) == 0 {
+		log := hooksdk.Environ().Path("hooks.jsonl")
+		if files = jsonl.Files(log); len(files) == 0 {
+			fmt.Fprintf(stderr, "hookexport: no log at %s\n", log)
+			return 1
+		}
+	}
+
+	code := 0
+	var corrupt, untimed int
+	for _, path := range files {
+		n, err := scanFile(path, func(ev jsonl.Event) error {
+			row, t, ok := toRow(ev)
+			switch {
+			case !ok:
+				corrupt++
+				return nil
+			case !f.keep(row, t):
+				return nil
+			case *appendTo && t.IsZero():
+				// Without a time there is no telling whether it was exported before.
+				untimed++
+				return nil
+			}
+			return e.add(row, t)
+		})
+		corrupt += n
+		if errors.Is(err, errExport) {
+			fmt.Fprintf(stderr, "hookexport: %v\n", err)
+			e.abort()
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "hookexport: %s: %v\n", path, err)
+			code = 1
+		}
+	}
+	if err := e.close(); err != nil {
+		fmt.Fprintf(stderr, "hookexport: %v\n", err)
+		e.abort()
+		return 1
+	}
+	if corrupt > 0 {
+		fmt.Fprintf(stderr, "hookexport: skipped %d corrupt record(s)\n", corrupt)
+	}
+	if untimed > 0 {
+		fmt.Fprintf(stderr, "hookexport: skipped %d event(s) without a time, which --append can't place\n", untimed)
+	}
+	fmt.Fprintf(stderr, "hookexport: wrote %d row(s) to %d file(s)\n", e.rows, len(e.done))
+	return code
+}
+
+// keep reports whether the event passes the filters.
+func (f *filters) keep(row []any, t time.Time) bool {
+	if len(f.types.Include) > 0 {
+		typ, _ := row[1].(string)
+		if !f.types.Match(typ) {
+			return false
+		}
+	}
+	if !f.since.IsZero() || !f.until.IsZero() {
+		if t.IsZero() || (!f.since.IsZero() && t.Before(f.since)) || (!f.until.IsZero() && !t.Before(f.until)) {
+			return false
+		}
+	}
+	return f.after.IsZero() || t.IsZero() || t.After(f.after)
+}
+
+// scanFile calls fn with each event of the file at path ("-" for stdin), returning how many
+// records weren't JSON objects. The file's header line, if it has one, says how its records are
+// laid out.
+func scanFile(path string, fn func(ev jsonl.Event) error) (corrupt int, err error) {
+	var r io.Reader
+	if path == "-" {
+		if r, err = jsonl.NewReader(os.Stdin); err != nil {
+			return 0, err
+		}
+	} else {
+		f, err := jsonl.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var dec jsonl.Decoder
+	err = jsonl.ScanRecords(r, func(rec []byte) error {
+		ev, err := dec.Decode(rec)
+		if err != nil {
+			corrupt++
+			return nil
+		}
+		if ev.Payload == nil {
+			// The header.
+			return nil
+		}
+		return fn(ev)
+	})
+	return corrupt, err
+}
+
+// toRow splits a logged event into the columns, taking the fields it promotes out of the payload
+// JSON. ok is false when the payload can't be encoded again.
+func toRow(ev jsonl.Event) (row []any, t time.Time, ok bool) {
+	payload := hooksdk.HookPayloadJSON(ev.Payload)
+
+	row = make([]any, len(columns))
+	if ts, err := time.Parse(time.RFC3339Nano, firstString(payload, "timestamp")); err == nil {
+		t = ts
+		delete(payload, "timestamp")
+	} else if ts, err := time.Parse(time.RFC3339Nano, ev.TS); err == nil {
+		t = ts
+	}
+	if !t.IsZero() {
+		row[0] = t
+	}
+	// The event type and session are read as hooksdk.HookPayload reads them, legacy keys included.
+	if key, s := take(payload, "xcodex_event_type", "type"); key != "" {
+		row[1] = string(hooksdk.ParseEventType(s))
+	}
+	if key, s := take(payload, "session_id", "thread_id", "thread-id", "session-id"); key != "" {
+		row[2] = s
+	}
+	if key, s := take(payload, "tool_name"); key != "" {
+		row[3] = s
+	}
+	if n, ok := hooksdk.IntField(payload, "duration_ms"); ok {
+		row[4] = n
+		delete(payload, "duration_ms")
+	}
+	if n, ok := hooksdk.IntField(payload, "exit_code"); ok && int64(int32(n)) == n {
+		row[5] = int32(n)
+		delete(payload, "exit_code")
+	} else {
+		for _, path := range []string{"tool_response.exit_code", "tool_response.metadata.exit_code"} {
+			if n, ok := hooksdk.IntField(payload, path); ok && int64(int32(n)) == n {
+				row[5] = int32(n)
+				break
+			}
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	row[6] = string(data)
+	return row, t, true
+}
+
+// take removes and returns the first of keys holding a non-empty string.
+func take(p hooksdk.HookPayloadJSON, keys ...string) (key, value string) {
+	for _, k := range keys {
+		if s, ok := p[k].(string); ok && s != "" {
+			delete(p, k)
+			return k, s
+		}
+	}
+	return "", ""
+}
+
+func firstString(p hooksdk.HookPayloadJSON, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := p[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// parseTime reads a --since/--until value: RFC 3339, a date (local midnight), or a duration
+// before now. "" is the zero time.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time, a date, or a duration", s)
+}
+
+// errExport marks a failure to write the output, which ends the export.
+var errExport = errors.New("export failed")
+
+// exporter writes rows to the output. It keeps one file open at a time: with --partition, a log
+// in time order makes one file per date, and an event out of order starts another.
+type exporter struct {
+	out       string
+	dir       bool
+	partition bool
+	batch     int
+	codec     parquet.Codec
+	// run names this export's files, so they don't collide with earlier ones.
+	run string
+
+	cur  *part
+	seq  int
+	done []string
+	rows int64
+	// last is the newest event exported, saved for the next --append.
+	last time.Time
+}
+
+// part is an output file being written, under a temporary name until it is complete.
+type part struct {
+	key  string
+	path string
+	tmp  string
+	f    *os.File
+	w    *parquet.Writer
+}
+
+func (e *exporter) add(row []any, t time.Time) error {
+	key := ""
+	if e.partition {
+		key = nullPartition
+		if !t.IsZero() {
+			key = t.UTC().Format("2006-01-02")
+		}
+	}
+	if e.cur != nil && e.cur.key != key {
+		if err := e.finish(); err != nil {
+			return err
+		}
+	}
+	if e.cur == nil {
+		if err := e.open(key); err != nil {
+			return err
+		}
+	}
+	if err := e.cur.w.Write(row); err != nil {
+		return fmt.Errorf("%w: %s: %v", errExport, e.cur.path, err)
+	}
+	e.rows++
+	if t.After(e.last) {
+		e.last = t
+	}
+	return nil
+}
+
+func (e *exporter) open(key string) error {
+	path := e.out
+	if e.dir {
+		e.seq++
+		dir := e.out
+		if e.partition {
+			dir = filepath.Join(e.out, "date="+key)
+		}
+		path = filepath.Join(dir, fmt.Sprintf("part-%s-%03d.parquet", e.run, e.seq))
+	}
+	// Readers globbing *.parquet skip the temporary name.
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("%w: %v", errExport, err)
+	}
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errExport, err)
+	}
+	w, err := parquet.NewWriter(f, columns)
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("%w: %s: %v", errExport, path, err)
+	}
+	w.RowGroupRows = e.batch
+	w.Codec = e.codec
+	e.cur = &part{key: key, path: path, tmp: tmp, f: f, w: w}
+	return nil
+}
+
+// finish completes the open file and moves it into place.
+func (e *exporter) finish() error {
+	p := e.cur
+	e.cur = nil
+	err := p.w.Close()
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(p.tmp, p.path)
+	}
+	if err != nil {
+		os.Remove(p.tmp)
+		return fmt.Errorf("%w: %s: %v", errExport, p.path, err)
+	}
+	e.done = append(e.done, p.path)
+	return nil
+}
+
+// close finishes the open file and, for a directory, records the newest event exported.
+func (e *exporter) close() error {
+	if e.cur != nil {
+		if err := e.finish(); err != nil {
+			return err
+		}
+	}
+	if !e.dir {
+		if len(e.done) == 0 {
+			// An export with no rows still makes a file, with the schema.
+			if err := e.open(""); err != nil {
+				return err
+			}
+			return e.finish()
+		}
+		return nil
+	}
+	return saveState(e.out, &state{Last: e.last})
+}
+
+// abort removes the open file and the files this export completed, so a failed export leaves the
+// output as it was.
+func (e *exporter) abort() {
+	if e.cur != nil {
+		e.cur.f.Close()
+		os.Remove(e.cur.tmp)
+		e.cur = nil
+	}
+	if e.dir {
+		for _, path := range e.done {
+			os.Remove(path)
+		}
+	}
+}
+
+type state struct {
+	// Last is the time of the newest event exported so far.
+	Last time.Time `json:"last_timestamp"`
+}
+
+// loadState reads the state of the output directory dir, or nil if it holds no export.
+func loadState(dir string) (*state, error) {
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(dir, stateFile), err)
+	}
+	return &st, nil
+}
+
+func saveState(dir string, st *state) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, stateFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
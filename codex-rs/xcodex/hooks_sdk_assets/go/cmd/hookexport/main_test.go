@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/parquet/parquettest"
+)
+
+// now is the time the tests run hookexport at.
+var now = time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+
+// rotated and active are the records of a test log: its gzipped older generation, then the
+// active file, which has a wrapped record, a legacy one, and two that aren't JSON objects.
+var (
+	rotated = []string{
+		`{"xcodex_event_type":"session-start","session_id":"s1","timestamp":"2026-01-01T10:00:00Z"}`,
+		`{"xcodex_event_type":"tool-call-finished","session_id":"s1","timestamp":"2026-01-01T10:01:00Z","tool_name":"shell","duration_ms":250,"tool_response":{"exit_code":2},"cwd":"/w"}`,
+	}
+	active = []string{
+		`{"ts":"2026-01-02T09:00:00Z","event":{"xcodex_event_type":"tool-call-finished","session_id":"s2","tool_name":"apply_patch","exit_code":1}}`,
+		`{"xcodex_event_type": "tool-call-fin`,
+		`{"type":"session_end","thread_id":"s2","timestamp":"2026-01-02T10:00:00Z"}`,
+		`[1, 2]`,
+	}
+)
+
+// writeLog writes records, one per line, to path, gzipped if path ends in .gz.
+func writeLog(t *testing.T, path string, records []string) {
+	t.Helper()
+	data := []byte(strings.Join(records, "\n") + "\n")
+	if strings.HasSuffix(path, ".gz") {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = buf.Bytes()
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testLog writes the test log to a new CODEX_HOME and returns its files, oldest first.
+func testLog(t *testing.T) []string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	files := []string{filepath.Join(home, "hooks.jsonl.1.gz"), filepath.Join(home, "hooks.jsonl")}
+	writeLog(t, files[0], rotated)
+	writeLog(t, files[1], active)
+	return files
+}
+
+func hookexport(t *testing.T, args ...string) (code int, stderr string) {
+	t.Helper()
+	var errOut bytes.Buffer
+	code = run(args, &errOut, now)
+	return code, errOut.String()
+}
+
+// payload decodes a row's payload column.
+func payload(t *testing.T, row []any) map[string]any {
+	t.Helper()
+	var v map[string]any
+	if err := json.Unmarshal([]byte(row[6].(string)), &v); err != nil {
+		t.Fatalf("payload %v: %v", row[6], err)
+	}
+	return v
+}
+
+// parts returns the Parquet files under dir, relative to it, sorted.
+func parts(t *testing.T, dir string) []string {
+	t.Helper()
+	var out []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && strings.HasSuffix(path, ".parquet") {
+			rel, _ := filepath.Rel(dir, path)
+			out = append(out, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	sort.Strings(out)
+	return out
+}
+
+func TestExport(t *testing.T) {
+	testLog(t)
+	out := filepath.Join(t.TempDir(), "hooks.parquet")
+	code, stderr := hookexport(t, "--out", out)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if !strings.Contains(stderr, "skipped 2 corrupt record(s)") || !strings.Contains(stderr, "wrote 4 row(s) to 1 file(s)") {
+		t.Errorf("stderr = %q", stderr)
+	}
+
+	f := parquettest.ReadFile(t, out)
+	if !reflect.DeepEqual(f.Columns, columns) {
+		t.Errorf("schema = %+v, want %+v", f.Columns, columns)
+	}
+	if f.NumRows != 4 {
+		t.Fatalf("%d rows, want 4", f.NumRows)
+	}
+	want := [][]any{
+		{time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC), "session-start", "s1", nil, nil, nil},
+		// An exit code nested in tool_response is promoted and left in the payload.
+		{time.Date(2026, 1, 1, 10, 1, 0, 0, time.UTC), "tool-call-finished", "s1", "shell", int64(250), int32(2)},
+		// A wrapped record without a timestamp of its own takes the log's.
+		{time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC), "tool-call-finished", "s2", "apply_patch", nil, int32(1)},
+		// Legacy keys are read, and the event type normalized.
+		{time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC), "session-end", "s2", nil, nil, nil},
+	}
+	for i, row := range f.Rows {
+		if !reflect.DeepEqual(row[:6], want[i]) {
+			t.Errorf("row %d = %v, want %v", i, row[:6], want[i])
+		}
+	}
+	// Promoted fields leave the payload; the rest stays.
+	if p := payload(t, f.Rows[1]); !reflect.DeepEqual(p, map[string]any{"cwd": "/w", "tool_response": map[string]any{"exit_code": float64(2)}}) {
+		t.Errorf("payload = %v", p)
+	}
+	if p := payload(t, f.Rows[0]); len(p) != 0 {
+		t.Errorf("payload = %v, want every field promoted", p)
+	}
+	for _, c := range f.Chunks[0] {
+		if c.Codec != 2 {
+			t.Errorf("codec = %d, want gzip", c.Codec)
+		}
+	}
+}
+
+func TestExportFilters(t *testing.T) {
+	files := testLog(t)
+	tests := []struct {
+		args     []string
+		sessions []any
+	}{
+		{[]string{"--type", "tool-call-*"}, []any{"s1", "s2"}},
+		{[]string{"--type", "session-start,session-end"}, []any{"s1", "s2"}},
+		{[]string{"--since", "2026-01-02"}, []any{"s2", "s2"}},
+		{[]string{"--since", "4h"}, []any{"s2", "s2"}},
+		{[]string{"--until", "2026-01-01T10:01:00Z"}, []any{"s1"}},
+		{[]string{"--type", "tool-call-finished", "--since", "2026-01-02"}, []any{"s2"}},
+		{[]string{"--type", "notification"}, nil},
+	}
+	for _, tt := range tests {
+		out := filepath.Join(t.TempDir(), "out.parquet")
+		args := append(append([]string{"--out", out}, tt.args...), files...)
+		if code, stderr := hookexport(t, args...); code != 0 {
+			t.Errorf("%v: exit %d: %s", tt.args, code, stderr)
+			continue
+		}
+		// An export with no rows still has the schema.
+		f := parquettest.ReadFile(t, out)
+		var sessions []any
+		for _, row := range f.Rows {
+			sessions = append(sessions, row[2])
+		}
+		if !reflect.DeepEqual(sessions, tt.sessions) || !reflect.DeepEqual(f.Columns, columns) {
+			t.Errorf("%v: sessions %v, want %v", tt.args, sessions, tt.sessions)
+		}
+	}
+}
+
+func TestExportBatches(t *testing.T) {
+	files := testLog(t)
+	out := filepath.Join(t.TempDir(), "hooks.parquet")
+	if code, stderr := hookexport(t, append([]string{"--out", out, "--batch", "3", "--codec", "none"}, files...)...); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	f := parquettest.ReadFile(t, out)
+	if !reflect.DeepEqual(f.RowGroups, []int64{3, 1}) {
+		t.Errorf("row groups = %v, want [3 1]", f.RowGroups)
+	}
+	if c := f.Chunks[0][0]; c.Codec != 0 || !c.HasMinMax || c.Max != time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC).UnixMicro() {
+		t.Errorf("first timestamp chunk = %+v", c)
+	}
+}
+
+func TestExportPartitionAppend(t *testing.T) {
+	files := testLog(t)
+	out := filepath.Join(t.TempDir(), "export")
+	if code, stderr := hookexport(t, "--out", out, "--partition", "date"); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	first := parts(t, out)
+	if len(first) != 2 || !strings.HasPrefix(first[0], "date=2026-01-01/part-") || !strings.HasPrefix(first[1], "date=2026-01-02/part-") {
+		t.Fatalf("parts = %v", first)
+	}
+	if f := parquettest.ReadFile(t, filepath.Join(out, first[0])); f.NumRows != 2 {
+		t.Errorf("2026-01-01 has %d rows, want 2", f.NumRows)
+	}
+
+	// Exporting into it again needs --append.
+	if code, stderr := hookexport(t, "--out", out, "--partition", "date"); code != 1 || !strings.Contains(stderr, "pass --append") {
+		t.Errorf("second export: exit %d, stderr %q", code, stderr)
+	}
+
+	// --append adds only the events newer than the export, and skips those without a time.
+	writeLog(t, files[1], append(active,
+		`{"xcodex_event_type":"session-start","session_id":"s3","timestamp":"2026-01-03T08:00:00Z"}`,
+		`{"xcodex_event_type":"session-start","session_id":"untimed"}`))
+	code, stderr := hookexport(t, "--out", out, "--partition", "date", "--append")
+	if code != 0 || !strings.Contains(stderr, "wrote 1 row(s)") || !strings.Contains(stderr, "skipped 1 event(s) without a time") {
+		t.Fatalf("append: exit %d, stderr %q", code, stderr)
+	}
+	all := parts(t, out)
+	if len(all) != 3 || !strings.HasPrefix(all[2], "date=2026-01-03/") {
+		t.Fatalf("parts after append = %v", all)
+	}
+	if f := parquettest.ReadFile(t, filepath.Join(out, all[2])); len(f.Rows) != 1 || f.Rows[0][2] != "s3" {
+		t.Errorf("appended part = %v", f.Rows)
+	}
+	if code, stderr := hookexport(t, "--out", out, "--append"); code != 0 || !strings.Contains(stderr, "wrote 0 row(s) to 0 file(s)") {
+		t.Errorf("append with nothing new: exit %d, stderr %q", code, stderr)
+	}
+	// No temporary files are left behind.
+	if tmps, _ := filepath.Glob(filepath.Join(out, "*", ".*.tmp")); len(tmps) != 0 {
+		t.Errorf("temporary files: %v", tmps)
+	}
+}
+
+func TestExportUntimedPartition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	writeLog(t, path, []string{`{"xcodex_event_type":"session-start","session_id":"s1"}`})
+	out := filepath.Join(t.TempDir(), "export")
+	if code, stderr := hookexport(t, "--out", out, "--partition", "date", path); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if got := parts(t, out); len(got) != 1 || !strings.HasPrefix(got[0], "date="+nullPartition+"/") {
+		t.Errorf("parts = %v", got)
+	}
+}
+
+func TestExportUsage(t *testing.T) {
+	files := testLog(t)
+	for _, args := range [][]string{
+		{"--partition", "hour"},
+		{"--batch", "0"},
+		{"--codec", "zstd"},
+		{"--since", "yesterday"},
+		{"--until", "soon"},
+		{"--no-such-flag"},
+	} {
+		if code, stderr := hookexport(t, append(args, files...)...); code != 2 || stderr == "" {
+			t.Errorf("%v: exit %d, stderr %q", args, code, stderr)
+		}
+	}
+	if code, _ := hookexport(t, "-h"); code != 0 {
+		t.Errorf("-h: exit %d", code)
+	}
+
+	t.Setenv("CODEX_HOME", t.TempDir())
+	if code, stderr := hookexport(t, "--out", filepath.Join(t.TempDir(), "x.parquet")); code != 1 || !strings.Contains(stderr, "no log at") {
+		t.Errorf("no log: exit %d, stderr %q", code, stderr)
+	}
+	// A missing file is reported, and the rest still exported.
+	out := filepath.Join(t.TempDir(), "x.parquet")
+	if code, stderr := hookexport(t, "--out", out, filepath.Join(t.TempDir(), "missing"), files[1]); code != 1 || !strings.Contains(stderr, "missing") {
+		t.Errorf("missing file: exit %d, stderr %q", code, stderr)
+	}
+	if f := parquettest.ReadFile(t, out); f.NumRows != 2 {
+		t.Errorf("%d rows, want the active file's 2", f.NumRows)
+	}
+}
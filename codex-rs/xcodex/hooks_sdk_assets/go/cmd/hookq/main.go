@@ -0,0 +1,759 @@
+// Command hookq filters and formats the events in hooks.jsonl logs, as written by cmd/log_jsonl.
+//
+//	go run ./cmd/hookq [flags] [file...]
+//
+// Without files it reads `$CODEX_HOME/hooks.jsonl` and its rotated generations, oldest first.
+// Files are read as a stream, one record at a time; gzipped generations (`hooks.jsonl.1.gz`),
+// logs written compressed with CODEX_HOOKLOG_COMPRESS=gzip (`hooks.jsonl.gz`), and logs written
+// with CODEX_HOOKLOG_FORMAT=pretty are read too. Lines that aren't JSON are skipped
+// and counted on stderr at the end.
+//
+//	go run ./cmd/hookq verify [file...]
+//
+// checks the hash chain of a log written with CODEX_HOOKLOG_AUDIT=1 (see jsonl.Verify), across
+// the same files, and reports where it first breaks.
+//
+//	go run ./cmd/hookq migrate [--convert] [--gzip] [file]
+//
+// moves a log from before headers aside as `hooks.jsonl.legacy`, as cmd/log_jsonl does on its
+// next append, and with --convert rewrites the legacy files into the wrapped format.
+//
+//	go run ./cmd/hookq resolve SHORT-ID [file...]
+//
+// prints the full session, turn, and event ids the short id shown in summaries and hooktail
+// stands for (see hooksdk.ShortID).
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// defaultColumns are the table and CSV columns when --fields isn't given.
+var defaultColumns = []string{"timestamp", "xcodex_event_type", "session_id", "tool_name"}
+
+// tableFlushRows bounds how many table rows are buffered to align their columns, so the table
+// streams too; a later block may align differently.
+const tableFlushRows = 500
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr, time.Now()))
+}
+
+// condition is one --where: the value at path must equal value.
+type condition struct {
+	path, value string
+}
+
+type query struct {
+	types   hooksdk.Filter
+	session string
+	since   time.Time
+	until   time.Time
+	where   []condition
+	fields  []string
+}
+
+func run(args []string, stdout, stderr io.Writer, now time.Time) int {
+	if len(args) > 0 && args[0] == "verify" {
+		return verify(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "migrate" {
+		return migrate(args[1:], stdout, stderr, now)
+	}
+	if len(args) > 0 && args[0] == "resolve" {
+		return resolve(args[1:], stdout, stderr)
+	}
+	fl := flag.NewFlagSet("hookq", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	types := fl.String("type", "", "comma-separated event types to keep, with * suffix wildcards (e.g. tool-call-*)")
+	session := fl.String("session", "", "keep only events of this session id, or short id")
+	since := fl.String("since", "", "keep events at or after this time (RFC 3339, a date, or a duration ago such as 2h)")
+	until := fl.String("until", "", "keep events before this time (same forms as --since)")
+	fields := fl.String("fields", "", "comma-separated dot paths to output (default: the whole record; table and csv: "+strings.Join(defaultColumns, ",")+")")
+	format := fl.String("format", "jsonl", "output format: jsonl, table, or csv")
+	var where []condition
+	fl.Func("where", "keep events whose value at a dot path equals a value, `path=value` (repeatable)", func(s string) error {
+		path, value, ok := strings.Cut(s, "=")
+		if !ok || path == "" {
+			return fmt.Errorf("want path=value, got %q", s)
+		}
+		where = append(where, condition{path, value})
+		return nil
+	})
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hookq [flags] [file...]\n       hookq verify [file...]\n       hookq migrate [--convert] [--gzip] [file]\n       hookq resolve SHORT-ID [file...]\n\nReads $CODEX_HOME/hooks.jsonl and its rotated generations when no file is given ('-' is stdin).\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	q := query{types: hooksdk.ParseFilter(*types, ""), session: *session, where: where, fields: splitList(*fields)}
+	var err error
+	if q.since, err = parseTime(*since, now); err != nil {
+		fmt.Fprintf(stderr, "hookq: --since: %v\n", err)
+		return 2
+	}
+	if q.until, err = parseTime(*until, now); err != nil {
+		fmt.Fprintf(stderr, "hookq: --until: %v\n", err)
+		return 2
+	}
+	out, err := newOutput(*format, stdout, q.fields)
+	if err != nil {
+		fmt.Fprintf(stderr, "hookq: %v\n", err)
+		return 2
+	}
+
+	files, ok := logFiles(fl.Args(), stderr)
+	if !ok {
+		return 1
+	}
+
+	code, corrupt := 0, 0
+	for _, path := range files {
+		n, err := scanFile(path, func(rec []byte, ev jsonl.Event) error { return q.apply(rec, ev, out) })
+		corrupt += n
+		if err != nil {
+			fmt.Fprintf(stderr, "hookq: %s: %v\n", path, err)
+			code = 1
+		}
+	}
+	if err := out.flush(); err != nil {
+		fmt.Fprintf(stderr, "hookq: %v\n", err)
+		code = 1
+	}
+	if corrupt > 0 {
+		fmt.Fprintf(stderr, "hookq: skipped %d corrupt record(s)\n", corrupt)
+	}
+	return code
+}
+
+// logFiles returns the files given, or else those of `$CODEX_HOME/hooks.jsonl`, oldest first; ok
+// is false, after saying so on stderr, when there are none.
+func logFiles(files []string, stderr io.Writer) (_ []string, ok bool) {
+	if len(files) > 0 {
+		return files, true
+	}
+	log := hooksdk.Environ().Path("hooks.jsonl")
+	if files = jsonl.Files(log); len(files) == 0 {
+		fmt.Fprintf(stderr, "hookq: no log at %s\n", log)
+		return nil, false
+	}
+	return files, true
+}
+
+// verify is `hookq verify`: it checks the hash chain of an audit log, given oldest file first,
+// and exits 1 at the first break.
+func verify(args []string, stdout, stderr io.Writer) int {
+	fl := flag.NewFlagSet("hookq verify", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hookq verify [file...]\n\nChecks the hash chain of a log written with CODEX_HOOKLOG_AUDIT=1: $CODEX_HOME/hooks.jsonl\nand its rotated generations when no file is given, or the files given, oldest first.\n")
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	files, ok := logFiles(fl.Args(), stderr)
+	if !ok {
+		return 1
+	}
+	if fl.NArg() == 0 {
+		// The files a migration moved aside are from before the chain.
+		legacy := map[string]bool{}
+		for _, path := range jsonl.LegacyFiles(hooksdk.Environ().Path("hooks.jsonl")) {
+			legacy[path] = true
+		}
+		var chained []string
+		for _, path := range files {
+			if !legacy[path] {
+				chained = append(chained, path)
+			}
+		}
+		files = chained
+	}
+
+	report, err := jsonl.Verify(files)
+	var chainBreak *jsonl.ChainBreak
+	if errors.As(err, &chainBreak) {
+		fmt.Fprintf(stdout, "broken: %v\n", chainBreak)
+		fmt.Fprintf(stdout, "the chain holds for %d record(s) before it, up to seq %d\n", report.Records, report.Last.Seq)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "hookq: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "ok: %d record(s) in %d file(s), seq %d..%d, last hash %s\n",
+		report.Records, report.Files, report.First.Seq+1, report.Last.Seq, report.Last.Hash)
+	return 0
+}
+
+// resolve is `hookq resolve`: it prints the ids of the logs whose short id is the one given, one
+// `KIND ID` line each, and exits 1 when there is none.
+func resolve(args []string, stdout, stderr io.Writer) int {
+	fl := flag.NewFlagSet("hookq resolve", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hookq resolve SHORT-ID [file...]\n\nPrints the session, turn, and event ids whose short id is SHORT-ID, from $CODEX_HOME/hooks.jsonl,\nthe per-session logs, and their rotated generations when no file is given. More than one line\nmeans the short id is ambiguous.\n")
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fl.NArg() == 0 {
+		fl.Usage()
+		return 2
+	}
+	short := fl.Arg(0)
+	if !hooksdk.IsShortID(short) {
+		fmt.Fprintf(stderr, "hookq: %q is not a short id (%d characters of a-z and 2-7)\n", short, hooksdk.ShortIDLen)
+		return 2
+	}
+	matches, err := hooksdk.ResolveShortID(short, fl.Args()[1:]...)
+	if err != nil {
+		fmt.Fprintf(stderr, "hookq: %v\n", err)
+		return 1
+	}
+	if len(matches) == 0 {
+		fmt.Fprintf(stderr, "hookq: no id with short id %s in the logs\n", strings.ToLower(short))
+		return 1
+	}
+	for _, m := range matches {
+		fmt.Fprintf(stdout, "%-7s  %s\n", m.Kind, m.ID)
+	}
+	if len(matches) > 1 {
+		fmt.Fprintf(stderr, "hookq: %d ids share short id %s\n", len(matches), strings.ToLower(short))
+	}
+	return 0
+}
+
+// migrate is `hookq migrate`: it moves the log aside as `<file>.legacy` if it has no header, and
+// with --convert rewrites each legacy file that has none into the wrapped format. Run again, it
+// finds nothing left to do.
+func migrate(args []string, stdout, stderr io.Writer, now time.Time) int {
+	fl := flag.NewFlagSet("hookq migrate", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	convert := fl.Bool("convert", false, "rewrite the legacy files as wrapped records with a header, timed from their payloads")
+	gz := fl.Bool("gzip", false, "gzip the legacy files")
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hookq migrate [--convert] [--gzip] [file]\n\nMoves $CODEX_HOME/hooks.jsonl (or the file given) aside as <file>.legacy if it has no header\nline, as log_jsonl does on its next append, which then starts a new headered file.\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fl.NArg() > 1 {
+		fl.Usage()
+		return 2
+	}
+	log := hooksdk.Environ().Path("hooks.jsonl")
+	if fl.NArg() == 1 {
+		log = fl.Arg(0)
+	}
+
+	// The writer's options are the hooks', so the move is made under the lock they append under,
+	// and only one of any processes migrating at once makes it.
+	opts := jsonl.OptionsFromEnv()
+	w := jsonl.New(log, opts)
+	moved, err := w.MigrateLegacy()
+	if err != nil {
+		fmt.Fprintf(stderr, "hookq: %v\n", err)
+		return 1
+	}
+	if moved != "" {
+		fmt.Fprintf(stdout, "moved %s to %s\n", w.Path(), moved)
+	}
+
+	code, done := 0, moved != ""
+	for _, path := range jsonl.LegacyFiles(log) {
+		var msg string
+		var err error
+		switch {
+		case *convert:
+			msg, err = convertLegacy(path, *gz || opts.Compress, now)
+		case *gz && !strings.HasSuffix(path, ".gz"):
+			var dest string
+			if dest, err = gzipFile(path); err == nil {
+				msg = "gzipped " + path + " to " + dest
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "hookq: %s: %v\n", path, err)
+			code = 1
+		}
+		if msg != "" {
+			fmt.Fprintln(stdout, msg)
+			done = true
+		}
+	}
+	if !done && code == 0 {
+		fmt.Fprintf(stdout, "nothing to migrate for %s\n", log)
+	}
+	return code
+}
+
+// timeKeys are the payload fields a legacy record's time is read from, in order.
+var timeKeys = []string{"timestamp", "ts", "time", "created_at", "started_at"}
+
+// convertLegacy rewrites the legacy file at path as log_jsonl writes logs now: a header line, then
+// each payload wrapped as `{"ts":...,"event":...}`. The time is the payload's own, from the first
+// of timeKeys that holds RFC 3339 or a Unix time in seconds or milliseconds; else that of the
+// record before, since the file was written in order; else none. Records that are wrapped already
+// are kept, and lines that aren't JSON objects are copied as they are, for readers to skip as
+// before. The result is gzipped when gz is set or path is, and replaces path; a file that has a
+// header is left alone, since it is converted already. msg says what was done.
+func convertLegacy(path string, gz bool, now time.Time) (msg string, err error) {
+	if converted, err := hasHeader(path); err != nil || converted {
+		return "", err
+	}
+	f, err := jsonl.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	gz = gz || strings.HasSuffix(path, ".gz")
+	dest := strings.TrimSuffix(path, ".gz")
+	if gz {
+		dest += ".gz"
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	var out io.Writer = tmp
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(tmp)
+		out = zw
+	}
+	bw := bufio.NewWriterSize(out, 64<<10)
+
+	header, err := jsonl.Meta{
+		Format:  jsonl.MetaFormatWrapped,
+		SDK:     hooksdk.SDKVersion,
+		Created: now.UTC().Format(time.RFC3339),
+		Host:    hooksdk.Meta().Host,
+	}.Header(jsonl.FormatJSONL)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	bw.Write(header)
+
+	var (
+		dec                                       jsonl.Decoder
+		prevTS                                    string
+		records, inherited, untimed, kept, copied int
+		compact                                   bytes.Buffer
+	)
+	err = jsonl.ScanRecords(f, func(rec []byte) error {
+		ev, err := dec.Decode(rec)
+		switch {
+		case err != nil:
+			copied++
+			bw.Write(rec)
+			return bw.WriteByte('\n')
+		case ev.Payload == nil:
+			// A header line further down.
+			return nil
+		case ev.TS != "":
+			kept++
+			prevTS = ev.TS
+			compact.Reset()
+			if err := json.Compact(&compact, rec); err != nil {
+				return err
+			}
+			bw.Write(compact.Bytes())
+			return bw.WriteByte('\n')
+		}
+		records++
+		ts := ""
+		if t := payloadTime(ev.Payload); !t.IsZero() {
+			ts = t.UTC().Format(time.RFC3339Nano)
+		} else if prevTS != "" {
+			ts = prevTS
+			inherited++
+		} else {
+			untimed++
+		}
+		prevTS = ts
+		data, err := json.Marshal(legacyRecord{TS: ts, Event: ev.Payload})
+		if err != nil {
+			return err
+		}
+		bw.Write(data)
+		return bw.WriteByte('\n')
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", err
+	}
+	if dest != path {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	msg = fmt.Sprintf("converted %s: %d record(s) wrapped (%d timed from the record before, %d without a time)", dest, records, inherited, untimed)
+	if kept > 0 {
+		msg += fmt.Sprintf(", %d already wrapped", kept)
+	}
+	if copied > 0 {
+		msg += fmt.Sprintf(", %d not JSON copied as they were", copied)
+	}
+	return msg, nil
+}
+
+// hasHeader reports whether the log file at path starts with a header line.
+func hasHeader(path string) (bool, error) {
+	f, err := jsonl.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	header, _, err := jsonl.StartsWithHeader(f)
+	return header, err
+}
+
+// legacyRecord is a converted legacy record. Unlike hooksdk.Record it has no host, pid, or hook,
+// which a legacy record doesn't say.
+type legacyRecord struct {
+	TS    string `json:"ts,omitempty"`
+	Event any    `json:"event"`
+}
+
+// payloadTime is the time of a legacy payload, from the first of timeKeys that holds one.
+func payloadTime(p map[string]any) time.Time {
+	for _, k := range timeKeys {
+		switch v := p[k].(type) {
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		case json.Number:
+			n, err := v.Float64()
+			if err != nil || n <= 0 {
+				continue
+			}
+			if n >= 1e12 {
+				return time.UnixMilli(int64(n))
+			}
+			return time.Unix(0, int64(n*1e9))
+		}
+	}
+	return time.Time{}
+}
+
+// gzipFile compresses the file at path into `<path>.gz`, replacing it, and returns the new path.
+func gzipFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dest := path + ".gz"
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	src.Close()
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return dest, nil
+}
+
+// parseTime reads a --since/--until value: RFC 3339, a date (local midnight), or a duration
+// before now. "" is the zero time.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a time, a date, or a duration", s)
+}
+
+// scanFile calls fn with each event of the file at path ("-" for stdin) and the record it came
+// from, returning how many records weren't JSON objects. Gzipped files are decompressed, and a
+// gzip member cut short (by a crash) ends the file; the incomplete record it held counts as
+// corrupt. The file's header line, if it has one, says how its records are laid out.
+func scanFile(path string, fn func(rec []byte, ev jsonl.Event) error) (corrupt int, err error) {
+	var r io.Reader
+	if path == "-" {
+		if r, err = jsonl.NewReader(os.Stdin); err != nil {
+			return 0, err
+		}
+	} else {
+		f, err := jsonl.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var dec jsonl.Decoder
+	err = jsonl.ScanRecords(r, func(rec []byte) error {
+		ev, err := dec.Decode(rec)
+		if err != nil {
+			corrupt++
+			return nil
+		}
+		if ev.Payload == nil {
+			// The header.
+			return nil
+		}
+		return fn(rec, ev)
+	})
+	return corrupt, err
+}
+
+// matchSession reports whether session is the --session one: that id, or one with that short id.
+func (q *query) matchSession(session string) bool {
+	return session == q.session || hooksdk.IsShortID(q.session) && hooksdk.ShortID(session) == strings.ToLower(q.session)
+}
+
+// apply writes rec, which holds ev, to out if it passes q. Filters and fields apply to the
+// payload, whether log_jsonl wrapped it or not.
+func (q *query) apply(rec []byte, ev jsonl.Event, out output) error {
+	payload := hooksdk.HookPayloadJSON(ev.Payload)
+
+	if len(q.types.Include) > 0 && !q.types.Match(eventType(payload)) {
+		return nil
+	}
+	if q.session != "" && !q.matchSession(sessionID(payload)) {
+		return nil
+	}
+	if !q.since.IsZero() || !q.until.IsZero() {
+		t := eventTime(payload, ev.TS)
+		if t.IsZero() || (!q.since.IsZero() && t.Before(q.since)) || (!q.until.IsZero() && !t.Before(q.until)) {
+			return nil
+		}
+	}
+	for _, c := range q.where {
+		v, ok := hooksdk.Field[any](payload, c.path)
+		if !ok || cell(v) != c.value {
+			return nil
+		}
+	}
+	return out.write(rec, payload)
+}
+
+// The event type, session, and time are read as hooksdk.HookPayload reads them, legacy keys
+// included.
+func eventType(p hooksdk.HookPayloadJSON) string {
+	return string(hooksdk.ParseEventType(firstString(p, "xcodex_event_type", "type")))
+}
+
+func sessionID(p hooksdk.HookPayloadJSON) string {
+	return firstString(p, "session_id", "thread_id", "thread-id", "session-id")
+}
+
+func eventTime(p hooksdk.HookPayloadJSON, wrapperTS string) time.Time {
+	for _, ts := range []string{firstString(p, "timestamp"), wrapperTS} {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func firstString(p hooksdk.HookPayloadJSON, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := p[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// cell renders a value for --where comparisons and table/CSV cells: strings as they are, nothing
+// for null, and anything else as compact JSON.
+func cell(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+type output interface {
+	write(rec []byte, payload hooksdk.HookPayloadJSON) error
+	flush() error
+}
+
+func newOutput(format string, w io.Writer, fields []string) (output, error) {
+	columns := fields
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+	switch format {
+	case "jsonl":
+		return &jsonlOutput{w: bufio.NewWriter(w), fields: fields}, nil
+	case "table":
+		t := &tableOutput{w: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0), columns: columns}
+		return t, t.row(columns)
+	case "csv":
+		c := &csvOutput{w: csv.NewWriter(w), columns: columns}
+		return c, c.w.Write(columns)
+	}
+	return nil, fmt.Errorf("unknown --format %q (want jsonl, table, or csv)", format)
+}
+
+// jsonlOutput writes each record on one line: as logged, or only --fields of the payload.
+type jsonlOutput struct {
+	w      *bufio.Writer
+	fields []string
+}
+
+func (o *jsonlOutput) write(rec []byte, payload hooksdk.HookPayloadJSON) error {
+	if len(o.fields) > 0 {
+		data, err := json.Marshal(hooksdk.Project(payload, o.fields))
+		if err != nil {
+			return err
+		}
+		rec = data
+	} else {
+		// Pretty records span lines.
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, rec); err != nil {
+			return err
+		}
+		rec = buf.Bytes()
+	}
+	o.w.Write(rec)
+	return o.w.WriteByte('\n')
+}
+
+func (o *jsonlOutput) flush() error { return o.w.Flush() }
+
+type tableOutput struct {
+	w       *tabwriter.Writer
+	columns []string
+	rows    int
+}
+
+func (o *tableOutput) write(_ []byte, payload hooksdk.HookPayloadJSON) error {
+	cells := make([]string, len(o.columns))
+	for i, path := range o.columns {
+		v, _ := hooksdk.Field[any](payload, path)
+		cells[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(cell(v))
+	}
+	if err := o.row(cells); err != nil {
+		return err
+	}
+	if o.rows++; o.rows%tableFlushRows == 0 {
+		return o.w.Flush()
+	}
+	return nil
+}
+
+func (o *tableOutput) row(cells []string) error {
+	_, err := fmt.Fprintln(o.w, strings.Join(cells, "\t"))
+	return err
+}
+
+func (o *tableOutput) flush() error { return o.w.Flush() }
+
+type csvOutput struct {
+	w       *csv.Writer
+	columns []string
+}
+
+func (o *csvOutput) write(_ []byte, payload hooksdk.HookPayloadJSON) error {
+	cells := make([]string, len(o.columns))
+	for i, path := range o.columns {
+		v, _ := hooksdk.Field[any](payload, path)
+		cells[i] = cell(v)
+	}
+	return o.w.Write(cells)
+}
+
+func (o *csvOutput) flush() error {
+	o.w.Flush()
+	return o.w.Error()
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// now is the time the tests run hookq at.
+var now = time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)
+
+// rotated and active are the records of a test log: its gzipped older generation, then the
+// active file, which has a wrapped record and two that aren't JSON objects.
+var (
+	rotated = []string{
+		`{"xcodex_event_type":"session-start","session_id":"s1","timestamp":"2026-01-01T10:00:00Z"}`,
+		`{"xcodex_event_type":"tool-call-started","session_id":"s1","timestamp":"2026-01-01T10:01:00Z","tool_name":"shell","tool_input":{"command":"ls"}}`,
+	}
+	active = []string{
+		`{"ts":"2026-01-01T11:00:00Z","event":{"xcodex_event_type":"tool-call-finished","session_id":"s2","tool_name":"apply_patch","exit_code":1}}`,
+		`{"xcodex_event_type": "tool-call-fin`,
+		`{"xcodex_event_type":"session-end","session_id":"s2","timestamp":"2026-01-01T12:00:00Z"}`,
+		`[1, 2]`,
+	}
+)
+
+// writeLog writes records, one per line, to path, gzipped if path ends in .gz.
+func writeLog(t *testing.T, path string, records []string) {
+	t.Helper()
+	data := []byte(strings.Join(records, "\n") + "\n")
+	if strings.HasSuffix(path, ".gz") {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = buf.Bytes()
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testLog writes the test log to a new CODEX_HOME and returns its files, oldest first.
+func testLog(t *testing.T) []string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	files := []string{filepath.Join(home, "hooks.jsonl.1.gz"), filepath.Join(home, "hooks.jsonl")}
+	writeLog(t, files[0], rotated)
+	writeLog(t, files[1], active)
+	return files
+}
+
+func hookq(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = run(args, &out, &errOut, now)
+	return code, out.String(), errOut.String()
+}
+
+func TestQueryFiles(t *testing.T) {
+	files := testLog(t)
+	code, stdout, stderr := hookq(t, files...)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	// Records come out as they were logged, across files, in order.
+	want := strings.Join([]string{rotated[0], rotated[1], active[0], active[2]}, "\n") + "\n"
+	if stdout != want {
+		t.Errorf("stdout =\n%s\nwant\n%s", stdout, want)
+	}
+	if !strings.Contains(stderr, "skipped 2 corrupt record(s)") {
+		t.Errorf("stderr = %q, want the corrupt records counted", stderr)
+	}
+
+	// Without files, the CODEX_HOME log and its generations are read, oldest first.
+	if code, got, _ := hookq(t); code != 0 || got != want {
+		t.Errorf("default files: exit %d, stdout\n%s", code, got)
+	}
+	t.Setenv("CODEX_HOME", t.TempDir())
+	if code, _, stderr := hookq(t); code != 1 || !strings.Contains(stderr, "no log at") {
+		t.Errorf("no log: exit %d, stderr %q", code, stderr)
+	}
+	if code, _, stderr := hookq(t, filepath.Join(t.TempDir(), "missing.jsonl")); code != 1 || stderr == "" {
+		t.Errorf("missing file: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestQueryFilters(t *testing.T) {
+	files := testLog(t)
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"session-start", "tool-call-started", "tool-call-finished", "session-end"}},
+		{[]string{"--type", "tool-call-*"}, []string{"tool-call-started", "tool-call-finished"}},
+		{[]string{"--type", "session-start,session-end"}, []string{"session-start", "session-end"}},
+		{[]string{"--session", "s2"}, []string{"tool-call-finished", "session-end"}},
+		{[]string{"--session", "s3"}, nil},
+		{[]string{"--session", hooksdk.ShortID("s2")}, []string{"tool-call-finished", "session-end"}},
+		{[]string{"--session", strings.ToUpper(hooksdk.ShortID("s1"))}, []string{"session-start", "tool-call-started"}},
+		// A wrapped record is timed by its ts when its payload has no timestamp.
+		{[]string{"--since", "2026-01-01T11:00:00Z"}, []string{"tool-call-finished", "session-end"}},
+		{[]string{"--until", "2026-01-01T11:00:00Z"}, []string{"session-start", "tool-call-started"}},
+		{[]string{"--since", "1h"}, []string{"session-end"}},
+		{[]string{"--since", "2026-01-01", "--until", "2026-01-02"}, []string{"session-start", "tool-call-started", "tool-call-finished", "session-end"}},
+		{[]string{"--since", "2026-01-02"}, nil},
+		{[]string{"--where", "tool_name=shell"}, []string{"tool-call-started"}},
+		{[]string{"--where", "exit_code=1"}, []string{"tool-call-finished"}},
+		{[]string{"--where", "tool_input.command=ls", "--where", "session_id=s1"}, []string{"tool-call-started"}},
+		{[]string{"--where", "tool_input.command=ls", "--where", "session_id=s2"}, nil},
+		{[]string{"--where", "tool_input.cwd="}, nil},
+		{[]string{"--type", "tool-call-*", "--session", "s1", "--since", "2026-01-01T10:00:30Z"}, []string{"tool-call-started"}},
+	}
+	for _, tt := range tests {
+		args := append([]string{"--fields", "xcodex_event_type"}, tt.args...)
+		code, stdout, stderr := hookq(t, append(args, files...)...)
+		if code != 0 {
+			t.Errorf("%q: exit %d: %s", tt.args, code, stderr)
+			continue
+		}
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+			if line == "" {
+				continue
+			}
+			var v map[string]string
+			if err := json.Unmarshal([]byte(line), &v); err != nil {
+				t.Fatalf("%q: line %q: %v", tt.args, line, err)
+			}
+			got = append(got, v["xcodex_event_type"])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: events %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestQueryOutputs(t *testing.T) {
+	files := testLog(t)
+
+	// --fields projects the payload, also of wrapped records.
+	_, stdout, _ := hookq(t, append([]string{"--fields", "session_id,tool_input.command,exit_code", "--type", "tool-call-*"}, files...)...)
+	if want := `{"session_id":"s1","tool_input":{"command":"ls"}}` + "\n" + `{"exit_code":1,"session_id":"s2"}` + "\n"; stdout != want {
+		t.Errorf("projected jsonl =\n%s\nwant\n%s", stdout, want)
+	}
+
+	code, stdout, _ := hookq(t, append([]string{"--format", "csv", "--session", "s1"}, files...)...)
+	rows, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	want := [][]string{
+		{"timestamp", "xcodex_event_type", "session_id", "tool_name"},
+		{"2026-01-01T10:00:00Z", "session-start", "s1", ""},
+		{"2026-01-01T10:01:00Z", "tool-call-started", "s1", "shell"},
+	}
+	if code != 0 || err != nil || !reflect.DeepEqual(rows, want) {
+		t.Errorf("csv: exit %d, rows %q, %v", code, rows, err)
+	}
+	_, stdout, _ = hookq(t, append([]string{"--format", "csv", "--fields", "tool_input,exit_code", "--type", "tool-call-*"}, files...)...)
+	if rows, _ := csv.NewReader(strings.NewReader(stdout)).ReadAll(); !reflect.DeepEqual(rows, [][]string{{"tool_input", "exit_code"}, {`{"command":"ls"}`, ""}, {"", "1"}}) {
+		t.Errorf("csv with fields: %q", rows)
+	}
+
+	_, stdout, _ = hookq(t, append([]string{"--format", "table", "--fields", "session_id,tool_name"}, files...)...)
+	lines := strings.Split(strings.TrimRight(stdout, "\n"), "\n")
+	if len(lines) != 5 || strings.Fields(lines[0])[0] != "session_id" || !reflect.DeepEqual(strings.Fields(lines[2]), []string{"s1", "shell"}) {
+		t.Errorf("table =\n%s", stdout)
+	}
+	// Columns are aligned.
+	if col := strings.Index(lines[0], "tool_name"); col < 0 || strings.Index(lines[2], "shell") != col {
+		t.Errorf("table columns aren't aligned:\n%s", stdout)
+	}
+}
+
+func TestQueryPrettyLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	writeLog(t, path, []string{"---", "{", `  "xcodex_event_type": "session-start",`, `  "session_id": "s1"`, "}", "---", `{"xcodex_event_type": "session-end",`, `"session_id": "s1"}`})
+	code, stdout, stderr := hookq(t, path)
+	want := `{"xcodex_event_type":"session-start","session_id":"s1"}` + "\n" + `{"xcodex_event_type":"session-end","session_id":"s1"}` + "\n"
+	if code != 0 || stdout != want || stderr != "" {
+		t.Errorf("pretty log: exit %d, stdout\n%s\nstderr %q", code, stdout, stderr)
+	}
+}
+
+func TestQueryGzipStream(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	writeLog(t, filepath.Join(home, "hooks.jsonl.1.gz"), rotated)
+	// A log written with CODEX_HOOKLOG_COMPRESS=gzip: hooks.jsonl.gz, one gzip member per record.
+	w := jsonl.New(filepath.Join(home, "hooks.jsonl"), jsonl.Options{GzipStream: true})
+	for _, rec := range []string{active[0], active[2]} {
+		if err := w.Append(json.RawMessage(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := strings.Join([]string{rotated[0], rotated[1], active[0], active[2]}, "\n") + "\n"
+	if code, stdout, stderr := hookq(t); code != 0 || stdout != want || stderr != "" {
+		t.Errorf("gzip stream: exit %d, stdout\n%s\nstderr %q", code, stdout, stderr)
+	}
+
+	// A member cut short by a crash ends the file, and its record counts as corrupt.
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(`{"xcodex_event_type":"session-start","session_id":"s3"}` + "\n"))
+	zw.Close()
+	f, err := os.OpenFile(w.Path(), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(buf.Bytes()[:buf.Len()/2])
+	f.Close()
+	code, stdout, stderr := hookq(t)
+	if code != 0 || stdout != want || !strings.Contains(stderr, "skipped 1 corrupt record(s)") {
+		t.Errorf("truncated member: exit %d, stdout\n%s\nstderr %q", code, stdout, stderr)
+	}
+}
+
+func TestQueryUsage(t *testing.T) {
+	files := testLog(t)
+	for _, args := range [][]string{
+		{"--format", "xml"},
+		{"--since", "yesterday"},
+		{"--until", "10:30"},
+		{"--where", "tool_name"},
+		{"--where", "=shell"},
+		{"--no-such-flag"},
+	} {
+		if code, stdout, stderr := hookq(t, append(args, files...)...); code != 2 || stdout != "" || stderr == "" {
+			t.Errorf("%q: exit %d, stdout %q, stderr %q; want a usage error", args, code, stdout, stderr)
+		}
+	}
+	if code, _, stderr := hookq(t, "-h"); code != 0 || !strings.Contains(stderr, "usage: hookq") {
+		t.Errorf("-h: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	for s, want := range map[string]time.Time{
+		"":                            {},
+		"2026-01-01T10:00:00Z":        time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC),
+		"2026-01-01T10:00:00.5+01:00": time.Date(2026, 1, 1, 9, 0, 0, 5e8, time.UTC),
+		"2025-12-31":                  time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+		"90m":                         now.Add(-90 * time.Minute),
+	} {
+		if got, err := parseTime(s, now); err != nil || !got.Equal(want) {
+			t.Errorf("parseTime(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+}
+
+// auditLog writes an audit log of records to a new CODEX_HOME, rotating after the first two, and
+// returns its files, oldest first.
+func auditLog(t *testing.T, records []string) []string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	path := filepath.Join(home, "hooks.jsonl")
+	w := jsonl.New(path, jsonl.Options{Audit: true, Keep: 10, LockTimeout: time.Minute})
+	for i, rec := range records {
+		if i == 2 {
+			if err := w.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.AppendRecord([]byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return jsonl.Files(path)
+}
+
+func TestVerify(t *testing.T) {
+	files := auditLog(t, append(append([]string{}, rotated...), active[0], active[2]))
+	code, stdout, stderr := hookq(t, "verify")
+	if code != 0 || !strings.HasPrefix(stdout, "ok: 4 record(s) in 2 file(s), seq 1..4, last hash ") || stderr != "" {
+		t.Errorf("verify: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if code, stdout, _ := hookq(t, "verify", files[1]); code != 0 || !strings.HasPrefix(stdout, "ok: 2 record(s) in 1 file(s), seq 3..4") {
+		t.Errorf("verify %s: exit %d, stdout %q", files[1], code, stdout)
+	}
+
+	// Queries filter on the events an audit log's records chain, and print the records.
+	code, stdout, _ = hookq(t, "--session", "s2")
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); code != 0 || len(lines) != 2 || !strings.HasPrefix(lines[0], `{"seq":3,`) || !strings.HasPrefix(lines[1], `{"seq":4,`) {
+		t.Errorf("query: exit %d, stdout\n%s", code, stdout)
+	}
+
+	// An edited record is reported with where the chain holds to.
+	data, err := os.ReadFile(files[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(files[1], bytes.Replace(data, []byte(`"exit_code":1`), []byte(`"exit_code":0`), 1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, stdout, _ = hookq(t, "verify")
+	want := "broken: " + files[1] + ":2: seq 3 doesn't match its hash: the record was edited\nthe chain holds for 2 record(s) before it, up to seq 2\n"
+	if code != 1 || stdout != want {
+		t.Errorf("verify an edited log: exit %d, stdout %q, want %q", code, stdout, want)
+	}
+
+	// A log that isn't an audit log has no chain to check.
+	files = testLog(t)
+	if code, stdout, _ := hookq(t, "verify", files[1]); code != 1 || !strings.Contains(stdout, "no audit log header") {
+		t.Errorf("verify a plain log: exit %d, stdout %q", code, stdout)
+	}
+	if code, _, stderr := hookq(t, "verify", filepath.Join(t.TempDir(), "missing.jsonl")); code != 1 || stderr == "" {
+		t.Errorf("verify a missing file: exit %d, stderr %q", code, stderr)
+	}
+	if code, _, stderr := hookq(t, "verify", "--bogus"); code != 2 || !strings.Contains(stderr, "usage: hookq verify") {
+		t.Errorf("verify --bogus: exit %d, stderr %q", code, stderr)
+	}
+}
+
+// legacy is a log from before headers: payloads timed in each way convertLegacy reads, or not at
+// all, a wrapped record, and a line that isn't JSON.
+var legacy = []string{
+	`{"xcodex_event_type":"session-start","session_id":"s1"}`,
+	`{"xcodex_event_type":"user-prompt-submit","session_id":"s1","timestamp":"2026-01-01T10:00:00+01:00"}`,
+	`{"xcodex_event_type":"tool-call-started","session_id":"s1"}`,
+	`{"xcodex_event_type":"tool-call-finished","session_id":"s1","ts":1767261600}`,
+	`{"xcodex_event_type":"agent-turn-complete","session_id":"s1","time":1767261660500}`,
+	`{"ts":"2026-01-01T10:05:00Z","event":{"xcodex_event_type":"notification","session_id":"s1"}}`,
+	`{"xcodex_event_type": "session-en`,
+	`{"xcodex_event_type":"session-end","session_id":"s1","created_at":"soon"}`,
+}
+
+// legacyHome writes legacy as the log of a new CODEX_HOME and returns its path.
+func legacyHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOKLOG_COMPRESS", "")
+	t.Setenv("CODEX_HOOKLOG_GZIP_STREAM", "")
+	path := filepath.Join(home, "hooks.jsonl")
+	writeLog(t, path, legacy)
+	return path
+}
+
+func TestMigrate(t *testing.T) {
+	path := legacyHome(t)
+	want := "moved " + path + " to " + path + ".legacy\n"
+	if code, stdout, stderr := hookq(t, "migrate"); code != 0 || stdout != want || stderr != "" {
+		t.Fatalf("migrate: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if code, stdout, _ := hookq(t, "migrate"); code != 0 || stdout != "nothing to migrate for "+path+"\n" {
+		t.Errorf("migrate again: exit %d, stdout %q", code, stdout)
+	}
+
+	// --convert wraps the legacy file's payloads, timing them from their own fields or the record
+	// before; the wrapped record and the line that isn't JSON are kept.
+	code, stdout, _ := hookq(t, "migrate", "--convert")
+	if want := "converted " + path + ".legacy: 6 record(s) wrapped (2 timed from the record before, 1 without a time), 1 already wrapped, 1 not JSON copied as they were\n"; code != 0 || stdout != want {
+		t.Fatalf("migrate --convert: exit %d, stdout %q, want %q", code, stdout, want)
+	}
+	data, err := os.ReadFile(path + ".legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if m, ok := jsonl.ParseMeta([]byte(lines[0])); !ok || m.Format != jsonl.MetaFormatWrapped || m.Created != "2026-01-01T12:30:00Z" {
+		t.Errorf("header = %s", lines[0])
+	}
+	var ts []string
+	for _, line := range lines[1:] {
+		var rec struct {
+			TS    string         `json:"ts"`
+			Event map[string]any `json:"event"`
+		}
+		if json.Unmarshal([]byte(line), &rec) != nil {
+			ts = append(ts, "not json")
+			continue
+		}
+		ts = append(ts, rec.TS)
+	}
+	if wantTS := []string{"", "2026-01-01T09:00:00Z", "2026-01-01T09:00:00Z", "2026-01-01T10:00:00Z", "2026-01-01T10:01:00.5Z",
+		"2026-01-01T10:05:00Z", "not json", "2026-01-01T10:05:00Z"}; !reflect.DeepEqual(ts, wantTS) {
+		t.Errorf("times = %q, want %q", ts, wantTS)
+	}
+	// Queries read the converted file with the log, timing its records by their ts.
+	code, stdout, _ = hookq(t, "--since", "2026-01-01T10:00:00Z", "--fields", "xcodex_event_type", "--format", "csv")
+	if want := "xcodex_event_type\ntool-call-finished\nagent-turn-complete\nnotification\nsession-end\n"; code != 0 || stdout != want {
+		t.Errorf("query of the converted log: exit %d, stdout %q, want %q", code, stdout, want)
+	}
+	if code, stdout, _ := hookq(t, "migrate", "--convert"); code != 0 || stdout != "nothing to migrate for "+path+"\n" {
+		t.Errorf("convert again: exit %d, stdout %q", code, stdout)
+	}
+
+	// --gzip compresses the legacy files, converted or not.
+	if code, stdout, _ := hookq(t, "migrate", "--gzip"); code != 0 || stdout != "gzipped "+path+".legacy to "+path+".legacy.gz\n" {
+		t.Errorf("migrate --gzip: exit %d, stdout %q", code, stdout)
+	}
+	if files := jsonl.LegacyFiles(path); !reflect.DeepEqual(files, []string{path + ".legacy.gz"}) {
+		t.Errorf("legacy files = %q", files)
+	}
+	if code, _, stderr := hookq(t, "migrate", "a", "b"); code != 2 || !strings.Contains(stderr, "usage: hookq migrate") {
+		t.Errorf("migrate a b: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestMigrateConvertGzip(t *testing.T) {
+	// Given a file, with --convert and --gzip, it is moved, converted, and gzipped in one go.
+	path := filepath.Join(t.TempDir(), "other.jsonl")
+	legacyHome(t)
+	writeLog(t, path, legacy)
+	code, stdout, _ := hookq(t, "migrate", "--convert", "--gzip", path)
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); code != 0 || len(lines) != 2 || !strings.HasPrefix(lines[1], "converted "+path+".legacy.gz: 6 record(s)") {
+		t.Fatalf("exit %d, stdout %q", code, stdout)
+	}
+	if files := jsonl.LegacyFiles(path); !reflect.DeepEqual(files, []string{path + ".legacy.gz"}) {
+		t.Fatalf("legacy files = %q", files)
+	}
+	f, err := jsonl.Open(path + ".legacy.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if header, _, err := jsonl.StartsWithHeader(f); !header || err != nil {
+		t.Errorf("the gzipped file isn't converted: %v", err)
+	}
+}
+
+func TestMigrateConcurrent(t *testing.T) {
+	path := legacyHome(t)
+	const runs = 8
+	type result struct {
+		code           int
+		stdout, stderr string
+	}
+	results := make(chan result, runs)
+	for i := 0; i < runs; i++ {
+		go func() {
+			var out, errOut bytes.Buffer
+			code := run([]string{"migrate", "--convert", "--gzip"}, &out, &errOut, now)
+			results <- result{code, out.String(), errOut.String()}
+		}()
+	}
+	moves, conversions := 0, 0
+	for i := 0; i < runs; i++ {
+		r := <-results
+		if r.code != 0 || r.stderr != "" {
+			t.Errorf("exit %d, stderr %q", r.code, r.stderr)
+		}
+		moves += strings.Count(r.stdout, "moved ")
+		conversions += strings.Count(r.stdout, "converted ")
+	}
+	// One run moves and converts the log; the others find it done, or in hand.
+	if moves != 1 || conversions < 1 {
+		t.Errorf("%d moves and %d conversions", moves, conversions)
+	}
+	if files := jsonl.LegacyFiles(path); !reflect.DeepEqual(files, []string{path + ".legacy.gz"}) {
+		t.Fatalf("legacy files = %q", files)
+	}
+	var n int
+	if _, err := scanFile(path+".legacy.gz", func([]byte, jsonl.Event) error { n++; return nil }); err != nil || n != len(legacy)-1 {
+		t.Errorf("the converted file has %d records, %v", n, err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	files := testLog(t)
+	// session-300066 and session-1021806 share a short id.
+	collide := filepath.Join(t.TempDir(), "collide.jsonl")
+	writeLog(t, collide, []string{
+		`{"xcodex_event_type":"session-start","session_id":"session-300066","turn_id":"t1"}`,
+		`{"ts":"2026-01-01T11:00:00Z","event":{"xcodex_event_type":"session-start","session_id":"session-1021806"}}`,
+	})
+
+	tests := []struct {
+		args   []string
+		code   int
+		stdout string
+		stderr string
+	}{
+		// Without files, the CODEX_HOME log.
+		{[]string{hooksdk.ShortID("s2")}, 0, "session  s2\n", ""},
+		{[]string{strings.ToUpper(hooksdk.ShortID("s1")), files[0]}, 0, "session  s1\n", ""},
+		{[]string{hooksdk.ShortID("t1"), collide}, 0, "turn     t1\n", ""},
+		{[]string{hooksdk.ShortID("session-300066"), collide}, 0, "session  session-300066\nsession  session-1021806\n", "2 ids share short id"},
+		{[]string{hooksdk.ShortID("s1"), collide}, 1, "", "no id with short id " + hooksdk.ShortID("s1")},
+		{[]string{hooksdk.ShortID("s1"), filepath.Join(collide, "x")}, 1, "", "not a directory"},
+		{[]string{"s1"}, 2, "", "not a short id"},
+		{nil, 2, "", "usage: hookq resolve"},
+		{[]string{"-h"}, 0, "", "usage: hookq resolve"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := hookq(t, append([]string{"resolve"}, tt.args...)...)
+		if code != tt.code || stdout != tt.stdout || !strings.Contains(stderr, tt.stderr) || tt.stderr == "" && stderr != "" {
+			t.Errorf("resolve %q: exit %d, stdout %q, stderr %q; want %d, %q, %q", tt.args, code, stdout, stderr, tt.code, tt.stdout, tt.stderr)
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// Command hookreplay runs a hook on the events recorded in a hooks.jsonl log, as written by
+// cmd/log_jsonl, to check that a change to the hook doesn't change its decisions.
+//
+//	go run ./cmd/hookreplay [flags] <hook> [arg...]
+//
+// Each event is handed to the hook as the host hands over a large payload: the payload in a temp
+// file and a small `payload_path` envelope on stdin. The hook's decision, exit code, and duration
+// are written as one JSON line per event, in log order, and a summary goes to stderr.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// maxStderrBytes bounds the hook stderr kept in a result.
+const maxStderrBytes = 4 << 10
+
+// outcomeError is the outcome of an event the hook failed on, besides the decisions.
+const outcomeError = "error"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+type config struct {
+	hook       []string
+	types      hooksdk.Filter
+	session    string
+	jobs       int
+	timeout    time.Duration
+	slowest    int
+	failOnDeny bool
+}
+
+// event is one recorded event to replay.
+type event struct {
+	// seq numbers the replayed events in log order.
+	seq     int
+	line    int
+	payload hooksdk.HookPayloadJSON
+}
+
+// result is the line written for each replayed event.
+type result struct {
+	Line       int               `json:"line"`
+	EventType  string            `json:"event_type"`
+	SessionID  string            `json:"session_id,omitempty"`
+	EventID    string            `json:"event_id,omitempty"`
+	Outcome    string            `json:"outcome"`
+	ExitCode   int               `json:"exit_code"`
+	DurationMS int64             `json:"duration_ms"`
+	Response   *hooksdk.Response `json:"response,omitempty"`
+	Stderr     string            `json:"stderr,omitempty"`
+	Error      string            `json:"error,omitempty"`
+
+	seq      int
+	duration time.Duration
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fl := flag.NewFlagSet("hookreplay", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	logPath := fl.String("log", "", "the log to replay, plain or gzipped (default $CODEX_HOME/hooks.jsonl; - is stdin)")
+	types := fl.String("type", "", "comma-separated event types to replay, with * suffix wildcards")
+	session := fl.String("session", "", "replay only the events of this session id")
+	out := fl.String("out", "", "write the results to this file instead of stdout")
+	jobs := fl.Int("jobs", 1, "how many events to replay at once")
+	timeout := fl.Duration("timeout", 30*time.Second, "kill the hook after this long and count the event as an error")
+	slowest := fl.Int("slowest", 5, "how many of the slowest events the summary lists")
+	failOnDeny := fl.Bool("fail-on-deny", false, "exit 1 when the hook denies any event, not only when it fails")
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hookreplay [flags] <hook> [arg...]\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fl.NArg() == 0 {
+		fl.Usage()
+		return 2
+	}
+	if *jobs < 1 || *timeout <= 0 {
+		fmt.Fprintf(stderr, "hookreplay: --jobs and --timeout must be positive\n")
+		return 2
+	}
+	cfg := config{
+		hook:       fl.Args(),
+		types:      hooksdk.ParseFilter(*types, ""),
+		session:    *session,
+		jobs:       *jobs,
+		timeout:    *timeout,
+		slowest:    *slowest,
+		failOnDeny: *failOnDeny,
+	}
+	if *logPath == "" {
+		*logPath = hooksdk.Environ().Path("hooks.jsonl")
+	}
+
+	in, err := openLog(*logPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "hookreplay: %v\n", err)
+		return 1
+	}
+	defer in.Close()
+	w := stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(stderr, "hookreplay: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	tmp, err := os.MkdirTemp("", "hookreplay-")
+	if err != nil {
+		fmt.Fprintf(stderr, "hookreplay: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(tmp)
+
+	sum, err := replay(context.Background(), cfg, in, w, tmp)
+	sum.print(stderr, cfg.slowest)
+	if err != nil {
+		fmt.Fprintf(stderr, "hookreplay: %v\n", err)
+		return 1
+	}
+	if sum.counts[outcomeError] > 0 || (cfg.failOnDeny && sum.counts[string(hooksdk.DecisionDeny)] > 0) {
+		return 1
+	}
+	return 0
+}
+
+// openLog opens the log at path ("-" for stdin), decompressing it when it is gzipped.
+func openLog(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		r, err := jsonl.NewReader(os.Stdin)
+		return io.NopCloser(r), err
+	}
+	return jsonl.Open(path)
+}
+
+// replay runs cfg.hook on each event of in that passes the filters, cfg.jobs at a time, and writes
+// the results to w in log order.
+func replay(ctx context.Context, cfg config, in io.Reader, w io.Writer, tmp string) (*summary, error) {
+	sum := &summary{counts: map[string]int{}}
+	events := make(chan event)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ev := range events {
+				results <- invoke(ctx, cfg, ev, tmp)
+			}
+		}()
+	}
+
+	var readErr error
+	go func() {
+		readErr = readEvents(cfg, in, events, sum)
+		close(events)
+		wg.Wait()
+		close(results)
+	}()
+
+	// Results arrive as hooks finish; hold the early ones until the events before them are written.
+	bw := bufio.NewWriter(w)
+	pending := map[int]result{}
+	next := 0
+	var writeErr error
+	for r := range results {
+		sum.add(r)
+		pending[r.seq] = r
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			data, err := json.Marshal(r)
+			if err != nil {
+				if writeErr == nil {
+					writeErr = err
+				}
+				continue
+			}
+			if _, err := bw.Write(append(data, '\n')); err != nil && writeErr == nil {
+				writeErr = err
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if readErr != nil {
+		return sum, readErr
+	}
+	return sum, writeErr
+}
+
+// readEvents sends each event of in that passes the filters, counting the corrupt lines in sum.
+// log_jsonl's {"ts","host","pid","hook","event"} wrapper is taken off, and the log's header line,
+// which says whether there is one, is skipped.
+func readEvents(cfg config, in io.Reader, events chan<- event, sum *summary) error {
+	br := bufio.NewReaderSize(in, 64<<10)
+	var dec jsonl.Decoder
+	seq := 0
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			if ev, derr := dec.Decode(data); derr != nil {
+				sum.mu.Lock()
+				sum.corrupt++
+				sum.mu.Unlock()
+			} else if payload := hooksdk.HookPayloadJSON(ev.Payload); payload != nil && cfg.match(payload) {
+				events <- event{seq: seq, line: line, payload: payload}
+				seq++
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (cfg config) match(p hooksdk.HookPayloadJSON) bool {
+	if len(cfg.types.Include) > 0 && !cfg.types.Match(eventType(p)) {
+		return false
+	}
+	return cfg.session == "" || sessionID(p) == cfg.session
+}
+
+// The event type and session are read as hooksdk.HookPayload reads them, legacy keys included.
+func eventType(p hooksdk.HookPayloadJSON) string {
+	return string(hooksdk.ParseEventType(firstString(p, "xcodex_event_type", "type")))
+}
+
+func sessionID(p hooksdk.HookPayloadJSON) string {
+	return firstString(p, "session_id", "thread_id", "thread-id", "session-id")
+}
+
+func firstString(p hooksdk.HookPayloadJSON, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := p[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// invoke runs the hook on one event, with the payload in a file of its own under tmp.
+func invoke(ctx context.Context, cfg config, ev event, tmp string) result {
+	r := result{
+		seq:       ev.seq,
+		Line:      ev.line,
+		EventType: eventType(ev.payload),
+		SessionID: sessionID(ev.payload),
+		EventID:   firstString(ev.payload, "event_id"),
+	}
+	fail := func(err error) result {
+		r.Outcome, r.Error = outcomeError, err.Error()
+		return r
+	}
+	payload, err := json.Marshal(ev.payload)
+	if err != nil {
+		return fail(err)
+	}
+	path := filepath.Join(tmp, fmt.Sprintf("payload-%d.json", ev.line))
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		return fail(err)
+	}
+	defer os.Remove(path)
+	// The envelope repeats the fields the host puts beside payload_path.
+	envelope := map[string]any{"payload_path": path}
+	for _, key := range []string{"schema_version", "event_id", "timestamp", "hook_event_name", "xcodex_event_type"} {
+		if v, ok := ev.payload[key]; ok {
+			envelope[key] = v
+		}
+	}
+	stdin, err := json.Marshal(envelope)
+	if err != nil {
+		return fail(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cfg.hook[0], cfg.hook[1:]...)
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &errOut
+	start := time.Now()
+	err = cmd.Run()
+	r.duration = time.Since(start)
+	r.DurationMS = r.duration.Milliseconds()
+	r.Stderr = hooksdk.TruncateString(errOut.String(), maxStderrBytes)
+	r.ExitCode = -1
+	if cmd.ProcessState != nil {
+		r.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return fail(fmt.Errorf("timed out after %v", cfg.timeout))
+	case err != nil && !errors.As(err, &exitErr):
+		return fail(err)
+	}
+	if out := bytes.TrimSpace(stdout.Bytes()); len(out) > 0 {
+		var resp hooksdk.Response
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return fail(fmt.Errorf("stdout is not a response: %v", err))
+		}
+		r.Response = &resp
+	}
+	// The same mapping as the host: exit 2 denies, other failures are errors, and a hook that
+	// says nothing allows.
+	switch {
+	case r.ExitCode == hooksdk.ExitDeny:
+		r.Outcome = string(hooksdk.DecisionDeny)
+	case r.ExitCode != hooksdk.ExitOK:
+		return fail(fmt.Errorf("exit status %d", r.ExitCode))
+	case r.Response != nil && r.Response.Decision != "":
+		r.Outcome = string(r.Response.Decision)
+	default:
+		r.Outcome = string(hooksdk.DecisionAllow)
+	}
+	return r
+}
+
+// summary counts the outcomes of a replay.
+type summary struct {
+	mu      sync.Mutex
+	counts  map[string]int
+	corrupt int
+	results []result
+}
+
+func (s *summary) add(r result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[r.Outcome]++
+	s.results = append(s.results, r)
+}
+
+func (s *summary) print(w io.Writer, slowest int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var parts []string
+	for _, outcome := range []string{"allow", "ask", "deny", outcomeError} {
+		parts = append(parts, fmt.Sprintf("%d %s", s.counts[outcome], outcome))
+	}
+	fmt.Fprintf(w, "hookreplay: %d event(s): %s\n", len(s.results), strings.Join(parts, ", "))
+	if s.corrupt > 0 {
+		fmt.Fprintf(w, "hookreplay: skipped %d corrupt line(s)\n", s.corrupt)
+	}
+	byDuration := append([]result(nil), s.results...)
+	sort.SliceStable(byDuration, func(i, j int) bool { return byDuration[i].duration > byDuration[j].duration })
+	if len(byDuration) > slowest {
+		byDuration = byDuration[:slowest]
+	}
+	for _, r := range byDuration {
+		fmt.Fprintf(w, "  %6dms  line %d  %s  %s\n", r.DurationMS, r.Line, r.EventType, r.Outcome)
+	}
+}
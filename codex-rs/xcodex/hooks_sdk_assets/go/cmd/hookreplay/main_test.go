@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// TestMain lets the tests replay events through this binary: with HOOKREPLAY_TEST_HOOK=1 it is
+// echoHook.
+func TestMain(m *testing.M) {
+	if os.Getenv("HOOKREPLAY_TEST_HOOK") == "1" {
+		os.Exit(echoHook())
+	}
+	os.Exit(m.Run())
+}
+
+// echoHook is the hook the tests replay events through. It reads the envelope on stdin and the
+// payload it points to, and answers by the payload's command: `rm ...` is denied, `crash` exits
+// 1, `garbage` writes something that isn't a response, `sleep D` sleeps for D first, `barrier DIR
+// N D` waits for N hooks to reach DIR and then sleeps for D, and anything else is allowed. The
+// response's reason is the session id read from the payload file, and its system message the
+// envelope's keys.
+func echoHook() int {
+	var envelope map[string]any
+	if err := json.NewDecoder(os.Stdin).Decode(&envelope); err != nil {
+		fmt.Fprintln(os.Stderr, "envelope:", err)
+		return 1
+	}
+	path, _ := envelope["payload_path"].(string)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "payload:", err)
+		return 1
+	}
+	var payload hooksdk.HookPayloadJSON
+	if err := json.Unmarshal(data, &payload); err != nil {
+		fmt.Fprintln(os.Stderr, "payload:", err)
+		return 1
+	}
+	var keys []string
+	for k := range envelope {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	command, _ := hooksdk.StringField(payload, "tool_input.command")
+	session, _ := hooksdk.StringField(payload, "session_id")
+	resp := hooksdk.Allow()
+	switch {
+	case strings.HasPrefix(command, "rm "):
+		resp = hooksdk.Deny(session)
+	case command == "crash":
+		fmt.Fprintln(os.Stderr, "boom")
+		return 1
+	case command == "garbage":
+		fmt.Println("not a response")
+		return 0
+	case strings.HasPrefix(command, "sleep "):
+		d, _ := time.ParseDuration(strings.TrimPrefix(command, "sleep "))
+		time.Sleep(d)
+	case strings.HasPrefix(command, "barrier "):
+		if err := barrier(strings.Fields(command)[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "barrier:", err)
+			return 1
+		}
+	}
+	resp.Reason, resp.SystemMessage = session, strings.Join(keys, ",")
+	out, _ := json.Marshal(resp)
+	fmt.Println(string(out))
+	if resp.Decision == hooksdk.DecisionDeny {
+		return hooksdk.ExitDeny
+	}
+	return 0
+}
+
+// barrier marks this hook as arrived in dir, waits until n hooks have, and then sleeps for d; args
+// are dir, n, and d. It gives up after 20 seconds, when the hooks aren't running at once.
+func barrier(args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("want DIR N D, got %q", args)
+	}
+	dir := args[0]
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(args[2])
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, strconv.Itoa(os.Getpid())), nil, 0o644); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(20 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		if len(entries) >= n {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("only %d of %d hooks arrived", len(entries), n)
+		}
+	}
+	time.Sleep(d)
+	return nil
+}
+
+// writeEvents writes a log of lines to a new file and returns its path.
+func writeEvents(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func command(session, cmd string) string {
+	return string(hooktest.ToolCallStarted().WithSessionID(session).WithCommand(cmd).Bytes())
+}
+
+// wrapped is line as log_jsonl wraps it.
+func wrapped(line string) string {
+	return `{"ts":"2026-01-01T10:00:00Z","host":"h","pid":1,"hook":"log","event":` + line + `}`
+}
+
+// replayLog runs hookreplay on log with args, replaying through echoHook, and returns its exit
+// code, its results, and its stderr.
+func replayLog(t *testing.T, log string, args ...string) (int, []result, string) {
+	t.Helper()
+	t.Setenv("HOOKREPLAY_TEST_HOOK", "1")
+	var stdout, stderr bytes.Buffer
+	args = append(append([]string{"--log", log}, args...), os.Args[0], "-test.run=^$")
+	code := run(args, &stdout, &stderr)
+	var results []result
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r result
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("result %q: %v", line, err)
+		}
+		results = append(results, r)
+	}
+	return code, results, stderr.String()
+}
+
+func outcomes(results []result) []string {
+	var out []string
+	for _, r := range results {
+		out = append(out, fmt.Sprintf("%d:%s", r.Line, r.Outcome))
+	}
+	return out
+}
+
+func TestReplay(t *testing.T) {
+	log := writeEvents(t,
+		command("s1", "ls"),
+		wrapped(command("s1", "rm -rf build")),
+		"not json",
+		"",
+		string(hooktest.SessionStart().WithSessionID("s2").Bytes()),
+	)
+	code, results, stderr := replayLog(t, log)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	if got, want := outcomes(results), []string{"1:allow", "2:deny", "5:allow"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("outcomes = %v, want %v", got, want)
+	}
+	r := results[1]
+	if r.ExitCode != hooksdk.ExitDeny || r.EventType != "tool-call-started" || r.SessionID != "s1" || r.Response == nil || r.Response.Reason != "s1" {
+		t.Errorf("denied result = %+v", r)
+	}
+	// The hook got a payload_path envelope repeating the event's type, and read the payload from
+	// the file it points to.
+	if msg := results[0].Response.SystemMessage; !strings.Contains(msg, "payload_path") || !strings.Contains(msg, "xcodex_event_type") {
+		t.Errorf("envelope keys = %q", msg)
+	}
+	if results[0].EventID == "" {
+		t.Errorf("result without the event id: %+v", results[0])
+	}
+	for _, want := range []string{"3 event(s): 2 allow, 0 ask, 1 deny, 0 error", "skipped 1 corrupt line(s)", "line 2"} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("summary %q doesn't say %q", stderr, want)
+		}
+	}
+
+	if code, _, _ := replayLog(t, log, "--fail-on-deny"); code != 1 {
+		t.Errorf("--fail-on-deny with a deny: exit %d, want 1", code)
+	}
+	if code, _, _ := replayLog(t, log, "--fail-on-deny", "--type", "session-*"); code != 0 {
+		t.Errorf("--fail-on-deny without a deny: exit %d, want 0", code)
+	}
+}
+
+func TestReplayErrors(t *testing.T) {
+	// The hooks that answer get a timeout no loaded machine runs out; only the slow one is cut short.
+	log := writeEvents(t, command("s1", "crash"), command("s1", "garbage"), command("s1", "ls"))
+	code, results, stderr := replayLog(t, log, "--timeout", "20s")
+	if code != 1 {
+		t.Errorf("exit %d, want 1 for errors", code)
+	}
+	if got, want := outcomes(results), []string{"1:error", "2:error", "3:allow"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("outcomes = %v, want %v", got, want)
+	}
+	if r := results[0]; r.ExitCode != 1 || r.Error != "exit status 1" || !strings.Contains(r.Stderr, "boom") {
+		t.Errorf("crash = %+v", r)
+	}
+	if r := results[1]; !strings.Contains(r.Error, "not a response") {
+		t.Errorf("garbage = %+v", r)
+	}
+	if !strings.Contains(stderr, "1 allow, 0 ask, 0 deny, 2 error") {
+		t.Errorf("summary = %q", stderr)
+	}
+
+	code, results, stderr = replayLog(t, writeEvents(t, command("s1", "sleep 10s")), "--timeout", "300ms")
+	if code != 1 || len(results) != 1 {
+		t.Fatalf("slow hook: exit %d, results %v", code, results)
+	}
+	if r := results[0]; r.Outcome != "error" || !strings.Contains(r.Error, "timed out after 300ms") || r.DurationMS >= 10000 {
+		t.Errorf("slow hook = %+v", r)
+	}
+	if !strings.Contains(stderr, "0 allow, 0 ask, 0 deny, 1 error") {
+		t.Errorf("summary = %q", stderr)
+	}
+}
+
+func TestReplayFilters(t *testing.T) {
+	log := writeEvents(t,
+		string(hooktest.SessionStart().WithSessionID("s1").Bytes()),
+		command("s1", "ls"),
+		command("s2", "ls"),
+		string(hooktest.ToolCallFinished().WithSessionID("s2").Bytes()),
+	)
+	for _, tt := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--type", "tool-call-*"}, []string{"2:allow", "3:allow", "4:allow"}},
+		{[]string{"--session", "s2"}, []string{"3:allow", "4:allow"}},
+		{[]string{"--type", "tool-call-started", "--session", "s1"}, []string{"2:allow"}},
+		{[]string{"--session", "s3"}, nil},
+	} {
+		if code, results, stderr := replayLog(t, log, tt.args...); code != 0 || !reflect.DeepEqual(outcomes(results), tt.want) {
+			t.Errorf("%q: exit %d, outcomes %v, want %v\n%s", tt.args, code, outcomes(results), tt.want, stderr)
+		}
+	}
+}
+
+func TestReplayJobs(t *testing.T) {
+	// Each hook waits at a barrier for all 8, which they only pass when they run at once.
+	dir := t.TempDir()
+	var lines []string
+	for i := 0; i < 8; i++ {
+		// Later events finish first, and are still written in log order.
+		lines = append(lines, command("s1", fmt.Sprintf("barrier %s 8 %dms", dir, 160-20*i)))
+	}
+	log := writeEvents(t, lines...)
+	code, results, stderr := replayLog(t, log, "--jobs", "8", "--slowest", "2")
+	if code != 0 || len(results) != 8 {
+		t.Fatalf("exit %d, %d results: %s", code, len(results), stderr)
+	}
+	for i, r := range results {
+		if r.Line != i+1 {
+			t.Errorf("result %d is of line %d", i, r.Line)
+		}
+	}
+
+	// The summary lists the 2 events that took longest.
+	listed := map[int]bool{}
+	for _, line := range strings.Split(stderr, "\n") {
+		var ms, n int
+		if _, err := fmt.Sscanf(line, " %dms  line %d", &ms, &n); err == nil {
+			listed[n] = true
+		}
+	}
+	if len(listed) != 2 {
+		t.Fatalf("--slowest 2 listed %d events:\n%s", len(listed), stderr)
+	}
+	for _, r := range results {
+		for _, other := range results {
+			if listed[r.Line] && !listed[other.Line] && r.DurationMS < other.DurationMS {
+				t.Errorf("line %d (%dms) is listed and line %d (%dms) isn't:\n%s", r.Line, r.DurationMS, other.Line, other.DurationMS, stderr)
+			}
+		}
+	}
+}
+
+func TestReplayOut(t *testing.T) {
+	log := writeEvents(t, command("s1", "ls"))
+	out := filepath.Join(t.TempDir(), "results.jsonl")
+	code, results, _ := replayLog(t, log, "--out", out)
+	if code != 0 || len(results) != 0 {
+		t.Errorf("--out: exit %d, stdout results %v", code, results)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || !strings.Contains(string(data), `"outcome":"allow"`) {
+		t.Errorf("results file %q: %v", data, err)
+	}
+}
+
+func TestReplayUsage(t *testing.T) {
+	log := writeEvents(t, command("s1", "ls"))
+	for _, args := range [][]string{
+		{"--log", log},
+		{"--log", log, "--jobs", "0", "hook"},
+		{"--log", log, "--timeout", "0s", "hook"},
+		{"--bogus", "hook"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != 2 || stderr.Len() == 0 {
+			t.Errorf("%q: exit %d, stderr %q; want a usage error", args, code, stderr.String())
+		}
+	}
+	var stderr bytes.Buffer
+	if code := run([]string{"--log", filepath.Join(t.TempDir(), "missing.jsonl"), "hook"}, &bytes.Buffer{}, &stderr); code != 1 {
+		t.Errorf("missing log: exit %d, stderr %q", code, stderr.String())
+	}
+}
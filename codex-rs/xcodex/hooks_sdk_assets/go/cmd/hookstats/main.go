@@ -0,0 +1,136 @@
+// Command hookstats prints the event size statistics that cmd/log_jsonl keeps with
+// CODEX_HOOKLOG_STATS=1, to see which event types make the log grow.
+//
+//	go run ./cmd/hookstats show [--file PATH] [--sort bytes|count|p95|type]
+//	go run ./cmd/hookstats reset [--file PATH]
+//
+// The statistics live in `$CODEX_HOME/hooks/stats.json`. Sizes are the bytes of each logged record;
+// p50 and p95 are estimates, within 1%.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/sizestats"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	usage := func() {
+		fmt.Fprintf(stderr, "usage: hookstats show [--file PATH] [--sort bytes|count|p95|type]\n       hookstats reset [--file PATH]\n")
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	cmd, args := args[0], args[1:]
+	fl := flag.NewFlagSet("hookstats "+cmd, flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	file := fl.String("file", "", "statistics file (default $CODEX_HOME/hooks/stats.json)")
+	var sortBy *string
+	switch cmd {
+	case "show":
+		sortBy = fl.String("sort", "bytes", "row order: bytes (total, largest first), count, p95, or type")
+	case "reset":
+	case "-h", "-help", "--help", "help":
+		usage()
+		return 0
+	default:
+		fmt.Fprintf(stderr, "hookstats: unknown command %q\n", cmd)
+		usage()
+		return 2
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fl.NArg() > 0 {
+		fmt.Fprintf(stderr, "hookstats: unexpected argument %q\n", fl.Arg(0))
+		return 2
+	}
+	path := *file
+	if path == "" {
+		path = sizestats.DefaultPath()
+	}
+	store := sizestats.New(path)
+
+	if cmd == "reset" {
+		if err := store.Reset(); err != nil {
+			fmt.Fprintf(stderr, "hookstats: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	less, ok := orders[*sortBy]
+	if !ok {
+		fmt.Fprintf(stderr, "hookstats: unknown --sort %q (want bytes, count, p95, or type)\n", *sortBy)
+		return 2
+	}
+	stats, err := store.Load()
+	if err != nil {
+		fmt.Fprintf(stderr, "hookstats: %v\n", err)
+		return 1
+	}
+	rows := stats.Rows()
+	if len(rows) == 0 {
+		fmt.Fprintf(stderr, "hookstats: no statistics in %s (log events with CODEX_HOOKLOG_STATS=1)\n", path)
+		return 0
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return less(rows[i], rows[j]) })
+	show(stdout, stats, rows)
+	return 0
+}
+
+// orders are the --sort orders. Rows() already sorts by total bytes.
+var orders = map[string]func(a, b sizestats.Row) bool{
+	"bytes": func(a, b sizestats.Row) bool { return false },
+	"count": func(a, b sizestats.Row) bool { return a.Count > b.Count },
+	"p95":   func(a, b sizestats.Row) bool { return a.P95 > b.P95 },
+	"type":  func(a, b sizestats.Row) bool { return a.EventType < b.EventType },
+}
+
+func show(w io.Writer, stats *sizestats.Stats, rows []sizestats.Row) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "EVENT TYPE\tCOUNT\tTOTAL\tP50\tP95\tMAX")
+	var count, total uint64
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", r.EventType, r.Count, size(float64(r.TotalBytes)), size(r.P50), size(r.P95), size(r.Max))
+		count += r.Count
+		total += r.TotalBytes
+	}
+	fmt.Fprintf(tw, "total\t%d\t%s\n", count, size(float64(total)))
+	tw.Flush()
+	fmt.Fprintf(w, "\nsince %s, last updated %s\n", stats.Since.Local().Format(time.DateTime), stats.Updated.Local().Format(time.DateTime))
+}
+
+// size formats n bytes for reading: 512 B, 3.4 KB, 12 MB.
+func size(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatFloat(n, 'f', 0, 64) + " B"
+	}
+	exp := 0
+	for n >= unit && exp < 4 {
+		n /= unit
+		exp++
+	}
+	prec := 1
+	if n >= 10 {
+		prec = 0
+	}
+	return strconv.FormatFloat(n, 'f', prec, 64) + " " + "KMGT"[exp-1:exp] + "B"
+}
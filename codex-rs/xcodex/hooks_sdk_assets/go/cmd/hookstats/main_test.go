@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/sizestats"
+)
+
+func hookstats(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// recordStats records a few sizes in path.
+func recordStats(t *testing.T, path string) {
+	t.Helper()
+	s := sizestats.New(path)
+	for typ, sizes := range map[string][]int{
+		"tool-call-finished": {3000, 5000, 400000},
+		"session-start":      {100, 100, 100, 100, 100},
+		"tool-call-started":  {900},
+	} {
+		for _, size := range sizes {
+			if err := s.Record(typ, size); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// eventTypes returns the event type column of a table shown by hookstats.
+func eventTypes(out string) []string {
+	var types []string
+	for _, line := range strings.Split(out, "\n")[1:] {
+		if f := strings.Fields(line); len(f) > 0 && f[0] != "total" && f[0] != "since" {
+			types = append(types, f[0])
+		}
+	}
+	return types
+}
+
+func TestShow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	recordStats(t, path)
+	code, out, stderr := hookstats("show", "--file", path)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	lines := strings.Split(out, "\n")
+	if f := strings.Fields(lines[0]); strings.Join(f, " ") != "EVENT TYPE COUNT TOTAL P50 P95 MAX" {
+		t.Errorf("header = %q", lines[0])
+	}
+	if f := strings.Fields(lines[1]); len(f) != 10 || f[0] != "tool-call-finished" || f[1] != "3" || f[2]+f[3] != "398KB" || f[6]+f[7] != "4.8KB" || f[8]+f[9] != "391KB" {
+		t.Errorf("first row = %q", lines[1])
+	}
+	if !strings.Contains(out, "total") || !strings.Contains(out, "since ") {
+		t.Errorf("no total or time line:\n%s", out)
+	}
+	for sortBy, want := range map[string]string{
+		"bytes": "[tool-call-finished tool-call-started session-start]",
+		"count": "[session-start tool-call-finished tool-call-started]",
+		"p95":   "[tool-call-finished tool-call-started session-start]",
+		"type":  "[session-start tool-call-finished tool-call-started]",
+	} {
+		_, out, _ := hookstats("show", "--file", path, "--sort", sortBy)
+		if got := strings.Join(eventTypes(out), " "); "["+got+"]" != want {
+			t.Errorf("--sort %s: rows %s, want %s", sortBy, got, want)
+		}
+	}
+}
+
+func TestShowDefaultFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	if code, out, stderr := hookstats("show"); code != 0 || out != "" || !strings.Contains(stderr, "no statistics in "+filepath.Join(home, "hooks", "stats.json")) {
+		t.Errorf("no statistics: exit %d, stdout %q, stderr %q", code, out, stderr)
+	}
+	recordStats(t, sizestats.DefaultPath())
+	if code, out, _ := hookstats("show"); code != 0 || !strings.Contains(out, "session-start") {
+		t.Errorf("default file: exit %d, stdout %q", code, out)
+	}
+}
+
+func TestReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	recordStats(t, path)
+	if code, _, stderr := hookstats("reset", "--file", path); code != 0 {
+		t.Fatalf("reset: exit %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("statistics left after reset: %v", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	for _, args := range [][]string{
+		nil,
+		{"frobnicate"},
+		{"show", "--sort", "size", "--file", path},
+		{"show", "extra"},
+		{"reset", "--sort", "bytes"},
+	} {
+		if code, _, stderr := hookstats(args...); code != 2 || stderr == "" {
+			t.Errorf("%q: exit %d, stderr %q; want a usage error", args, code, stderr)
+		}
+	}
+	if code, _, stderr := hookstats("help"); code != 0 || !strings.Contains(stderr, "usage: hookstats") {
+		t.Errorf("help: exit %d, stderr %q", code, stderr)
+	}
+	if err := os.WriteFile(path, []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := hookstats("show", "--file", path); code != 1 || stderr == "" {
+		t.Errorf("corrupt statistics: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestSize(t *testing.T) {
+	for n, want := range map[float64]string{
+		0:          "0 B",
+		512:        "512 B",
+		1023:       "1023 B",
+		1024:       "1.0 KB",
+		3482:       "3.4 KB",
+		12 << 20:   "12 MB",
+		3 << 29:    "1.5 GB",
+		5 << 40:    "5.0 TB",
+		5000 << 40: "5000 TB",
+	} {
+		if got := size(n); got != want {
+			t.Errorf("size(%v) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+// Command hooktail follows the hooks.jsonl log cmd/log_jsonl writes and prints each event as it
+// is logged, one colored line per event:
+//
+//	go run ./cmd/hooktail [--type LIST] [--session ID] [--raw] [--from-start] [file]
+//
+//	14:03:11  tool-call-started     ab3kq2xd  shell: cargo test -p core
+//	14:03:19  tool-call-finished    ab3kq2xd  shell ok 8.2s: cargo test -p core
+//
+// Without a file it follows `$CODEX_HOME/hooks.jsonl` (`hooks.jsonl.gz` with
+// CODEX_HOOKLOG_COMPRESS=gzip). It keeps following across rotations and runs until interrupted.
+// --raw prints the records as logged instead, one per line, for piping to jq.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+// maxDetail bounds the detail at the end of a line, in runes.
+const maxDetail = 160
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fl := flag.NewFlagSet("hooktail", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	types := fl.String("type", "", "comma-separated event types to show, with * suffix wildcards (e.g. tool-call-*)")
+	session := fl.String("session", "", "show only events of this session id, an id prefix, or (a prefix of) the short id printed")
+	raw := fl.Bool("raw", false, "print records as logged, one per line, instead of rendering them")
+	fromStart := fl.Bool("from-start", false, "print the events already in the log first")
+	color := fl.String("color", "auto", "color output: auto (when writing to a terminal and NO_COLOR is unset), always, or never")
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: hooktail [flags] [file]\n\nFollows $CODEX_HOME/hooks.jsonl when no file is given.\n\nFlags:\n")
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fl.NArg() > 1 {
+		fmt.Fprintf(stderr, "hooktail: unexpected argument %q\n", fl.Arg(1))
+		return 2
+	}
+	var useColor bool
+	switch *color {
+	case "auto":
+		useColor = isTerminal(stdout) && os.Getenv("NO_COLOR") == ""
+	case "always":
+		useColor = true
+	case "never":
+	default:
+		fmt.Fprintf(stderr, "hooktail: unknown --color %q (want auto, always, or never)\n", *color)
+		return 2
+	}
+
+	path := fl.Arg(0)
+	if path == "" {
+		path = jsonl.New(hooksdk.Environ().Path("hooks.jsonl"), jsonl.OptionsFromEnv()).Path()
+	}
+	p := printer{
+		w:       stdout,
+		types:   hooksdk.ParseFilter(*types, ""),
+		session: *session,
+		raw:     *raw,
+		color:   useColor,
+	}
+	follower := jsonl.NewFollower(path)
+	follower.FromStart = *fromStart
+
+	ctx, stop := hooksdk.SignalContext()
+	defer stop()
+	if err := follower.Follow(ctx, p.print); err != nil {
+		fmt.Fprintf(stderr, "hooktail: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+type printer struct {
+	w       io.Writer
+	types   hooksdk.Filter
+	session string
+	raw     bool
+	color   bool
+	// dec is kept across rotations: each new file's header replaces the last one's.
+	dec jsonl.Decoder
+}
+
+// print writes the line for one logged record, if it passes the filters. Records that aren't JSON
+// objects, and header lines, are skipped.
+func (p *printer) print(rec []byte) error {
+	// log_jsonl wraps the payload as {"ts","host","pid","hook","event"} unless it logs plain
+	// payloads; the header line it starts each file with says which, and is skipped.
+	ev, err := p.dec.Decode(rec)
+	if err != nil || ev.Payload == nil {
+		return nil
+	}
+	payload, wrapperTS := hooksdk.HookPayloadJSON(ev.Payload), ev.TS
+	typ := hooksdk.ParseEventType(firstString(payload, "xcodex_event_type", "type"))
+	session := firstString(payload, "session_id", "thread_id", "thread-id", "session-id")
+	if len(p.types.Include) > 0 && !p.types.Match(string(typ)) {
+		return nil
+	}
+	if p.session != "" && !strings.HasPrefix(session, p.session) && !strings.HasPrefix(hooksdk.ShortID(session), strings.ToLower(p.session)) {
+		return nil
+	}
+
+	var line []byte
+	if p.raw {
+		// Pretty records span lines.
+		var buf bytes.Buffer
+		if json.Compact(&buf, rec) != nil {
+			return nil
+		}
+		line = append(buf.Bytes(), '\n')
+	} else {
+		line = []byte(p.render(typ, session, eventTime(payload, wrapperTS), payload) + "\n")
+	}
+	// One write per line, so lines show up as they come.
+	_, err = p.w.Write(line)
+	return err
+}
+
+// ANSI colors.
+const (
+	reset   = "\x1b[0m"
+	dim     = "\x1b[2m"
+	red     = "\x1b[31m"
+	green   = "\x1b[32m"
+	yellow  = "\x1b[33m"
+	blue    = "\x1b[34m"
+	magenta = "\x1b[35m"
+	cyan    = "\x1b[36m"
+)
+
+// sessionColors are picked by a hash of the session id, so each session keeps its color.
+var sessionColors = []string{"\x1b[91m", "\x1b[92m", "\x1b[93m", "\x1b[94m", "\x1b[95m", "\x1b[96m"}
+
+// render formats an event as `time  type  session  detail`.
+func (p *printer) render(typ hooksdk.EventType, session string, t time.Time, payload hooksdk.HookPayloadJSON) string {
+	render, ok := renderers[typ]
+	if !ok {
+		render = renderDefault
+	}
+	detail, failed := render(payload)
+	detail = oneLine(detail, maxDetail)
+
+	clock := "--:--:--"
+	if !t.IsZero() {
+		clock = t.Local().Format(time.TimeOnly)
+	}
+	name := string(typ)
+	if name == "" {
+		name = "?"
+	}
+	short := hooksdk.ShortID(session)
+	if short == "" {
+		short = "-"
+	}
+	cols := []string{
+		p.paint(dim, clock),
+		p.paint(typeColor(typ, failed), fmt.Sprintf("%-24s", name)),
+		p.paint(sessionColor(session), fmt.Sprintf("%-8s", short)),
+	}
+	if detail != "" {
+		cols = append(cols, detail)
+	}
+	return strings.Join(cols, "  ")
+}
+
+func (p *printer) paint(color, s string) string {
+	if !p.color || color == "" {
+		return s
+	}
+	return color + s + reset
+}
+
+// typeColor groups event types by color: sessions, prompts and turns, tool calls, model requests,
+// and what needs attention.
+func typeColor(typ hooksdk.EventType, failed bool) string {
+	switch {
+	case failed:
+		return red
+	case typ == hooksdk.EventSessionStart || typ == hooksdk.EventSessionEnd:
+		return magenta
+	case typ == hooksdk.EventUserPromptSubmit || typ == hooksdk.EventAgentTurnComplete:
+		return green
+	case typ == hooksdk.EventToolCallStarted || typ == hooksdk.EventToolCallFinished:
+		return cyan
+	case typ == hooksdk.EventModelRequestStarted || typ == hooksdk.EventModelResponseCompleted:
+		return blue
+	case typ == hooksdk.EventApprovalRequested || typ == hooksdk.EventNotification:
+		return yellow
+	}
+	return ""
+}
+
+func sessionColor(session string) string {
+	if session == "" {
+		return dim
+	}
+	h := fnv.New32a()
+	h.Write([]byte(session))
+	return sessionColors[h.Sum32()%uint32(len(sessionColors))]
+}
+
+// A renderer returns the detail shown for an event (the command of a tool call, the text of a
+// prompt), and whether the event is a failure, shown in red.
+type renderer func(p hooksdk.HookPayloadJSON) (detail string, failed bool)
+
+// renderers are the per-event-type renderers; other types use renderDefault.
+var renderers = map[hooksdk.EventType]renderer{
+	hooksdk.EventSessionStart:           renderSession,
+	hooksdk.EventSessionEnd:             renderSession,
+	hooksdk.EventUserPromptSubmit:       renderPrompt,
+	hooksdk.EventToolCallStarted:        renderToolCallStarted,
+	hooksdk.EventToolCallFinished:       renderToolCallFinished,
+	hooksdk.EventApprovalRequested:      renderApproval,
+	hooksdk.EventModelRequestStarted:    renderModelRequest,
+	hooksdk.EventModelResponseCompleted: renderModelResponse,
+	hooksdk.EventAgentTurnComplete:      renderTurnComplete,
+	hooksdk.EventNotification:           renderNotification,
+	hooksdk.EventPreCompact:             renderPreCompact,
+	hooksdk.EventSubagentStop:           renderSubagentStop,
+}
+
+// renderDefault shows the most telling field an event has.
+func renderDefault(p hooksdk.HookPayloadJSON) (string, bool) {
+	return firstString(p, "tool_name", "message", "reason", "status"), false
+}
+
+// renderSession: `cli in my-repo`.
+func renderSession(p hooksdk.HookPayloadJSON) (string, bool) {
+	parts := []string{firstString(p, "session_source")}
+	if cwd := firstString(p, "cwd"); cwd != "" {
+		parts = append(parts, "in "+filepath.Base(cwd))
+	}
+	return join(" ", parts...), false
+}
+
+// renderPrompt: the prompt.
+func renderPrompt(p hooksdk.HookPayloadJSON) (string, bool) {
+	return firstString(p, "prompt"), false
+}
+
+// renderToolCallStarted: `shell: cargo test`.
+func renderToolCallStarted(p hooksdk.HookPayloadJSON) (string, bool) {
+	return join(": ", firstString(p, "tool_name"), toolInput(p)), false
+}
+
+// renderToolCallFinished: `shell ok 1.2s: cargo test`, or `shell exit 101 1.2s: cargo test` in red.
+func renderToolCallFinished(p hooksdk.HookPayloadJSON) (string, bool) {
+	failed := false
+	outcome := firstString(p, "status")
+	if ok, present := hooksdk.BoolField(p, "success"); present {
+		failed = !ok
+		outcome = "ok"
+		if failed {
+			outcome = "failed"
+		}
+	}
+	for _, path := range []string{"exit_code", "tool_response.exit_code", "tool_response.metadata.exit_code"} {
+		if n, ok := hooksdk.IntField(p, path); ok {
+			if n != 0 {
+				failed, outcome = true, "exit "+strconv.FormatInt(n, 10)
+			}
+			break
+		}
+	}
+	var took string
+	if ms, ok := hooksdk.IntField(p, "duration_ms"); ok {
+		took = duration(ms)
+	}
+	return join(": ", join(" ", firstString(p, "tool_name"), outcome, took), toolInput(p)), failed
+}
+
+// renderApproval: `exec: rm -rf build (outside the workspace)`.
+func renderApproval(p hooksdk.HookPayloadJSON) (string, bool) {
+	what := command(p["command"])
+	if what == "" {
+		if paths, ok := p["paths"].([]any); ok {
+			what = joinAny(paths, ", ")
+		}
+	}
+	if what == "" {
+		what = firstString(p, "tool_name")
+	}
+	detail := join(": ", firstString(p, "kind"), what)
+	if reason := firstString(p, "reason", "message"); reason != "" {
+		detail = join(" ", detail, "("+reason+")")
+	}
+	return detail, false
+}
+
+// renderModelRequest: `openai/gpt-5: 12 items, 8 tools, attempt 2`.
+func renderModelRequest(p hooksdk.HookPayloadJSON) (string, bool) {
+	var counts []string
+	if n, ok := hooksdk.IntField(p, "input_item_count"); ok {
+		counts = append(counts, plural(n, "item"))
+	}
+	if n, ok := hooksdk.IntField(p, "tool_count"); ok {
+		counts = append(counts, plural(n, "tool"))
+	}
+	if n, ok := hooksdk.IntField(p, "attempt"); ok && n > 1 {
+		counts = append(counts, "attempt "+strconv.FormatInt(n, 10))
+	}
+	model := firstString(p, "provider")
+	if m := firstString(p, "model"); m != "" {
+		model = join("/", model, m)
+	}
+	return join(": ", model, join(", ", counts...)), false
+}
+
+// renderModelResponse: `5120 tokens (312 out), follow-up`.
+func renderModelResponse(p hooksdk.HookPayloadJSON) (string, bool) {
+	var parts []string
+	if total, ok := hooksdk.IntField(p, "token_usage.total_tokens"); ok {
+		tokens := plural(total, "token")
+		if out, ok := hooksdk.IntField(p, "token_usage.output_tokens"); ok {
+			tokens += " (" + strconv.FormatInt(out, 10) + " out)"
+		}
+		parts = append(parts, tokens)
+	}
+	if followUp, _ := hooksdk.BoolField(p, "needs_follow_up"); followUp {
+		parts = append(parts, "follow-up")
+	}
+	return join(", ", parts...), false
+}
+
+// renderTurnComplete: the last assistant message.
+func renderTurnComplete(p hooksdk.HookPayloadJSON) (string, bool) {
+	return firstString(p, "last_assistant_message"), false
+}
+
+// renderNotification: `idle: Codex is waiting — approve the command?`.
+func renderNotification(p hooksdk.HookPayloadJSON) (string, bool) {
+	return join(": ", firstString(p, "notification_type"), join(" — ", firstString(p, "title"), firstString(p, "message"))), false
+}
+
+// renderPreCompact: the trigger, `auto` or `manual`.
+func renderPreCompact(p hooksdk.HookPayloadJSON) (string, bool) {
+	return firstString(p, "trigger"), false
+}
+
+// renderSubagentStop: `reviewer completed`, in red when it failed.
+func renderSubagentStop(p hooksdk.HookPayloadJSON) (string, bool) {
+	status := firstString(p, "status")
+	failed := status == "failed" || status == "error" || status == "errored"
+	return join(" ", firstString(p, "subagent", "tool_name"), status), failed
+}
+
+// toolInput summarizes a tool call's input: its shell command, the files it writes, or else the
+// input itself.
+func toolInput(p hooksdk.HookPayloadJSON) string {
+	input := p["tool_input"]
+	if m, ok := input.(map[string]any); ok {
+		if c := command(m["command"]); c != "" {
+			return c
+		}
+	}
+	if paths := gitsnap.TouchedPaths(input); len(paths) > 0 {
+		return strings.Join(paths, ", ")
+	}
+	switch v := input.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// command renders a command given as an argv array or a string.
+func command(v any) string {
+	switch c := v.(type) {
+	case string:
+		return c
+	case []any:
+		return joinAny(c, " ")
+	}
+	return ""
+}
+
+func joinAny(items []any, sep string) string {
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = fmt.Sprint(item)
+	}
+	return strings.Join(parts, sep)
+}
+
+// join joins the non-empty parts with sep.
+func join(sep string, parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+func plural(n int64, noun string) string {
+	s := strconv.FormatInt(n, 10) + " " + noun
+	if n != 1 {
+		s += "s"
+	}
+	return s
+}
+
+// duration formats milliseconds for reading, as summarize.Duration does: 120ms, 8.2s, 1m5s.
+func duration(ms int64) string {
+	return summarize.Duration(time.Duration(ms) * time.Millisecond)
+}
+
+// oneLine collapses s onto one line of at most max runes, ending with "…" when it was cut.
+func oneLine(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	r := []rune(s)
+	return strings.TrimSpace(string(r[:max-1])) + "…"
+}
+
+// eventTime is when the event happened: its timestamp, or else when it was logged.
+func eventTime(p hooksdk.HookPayloadJSON, wrapperTS string) time.Time {
+	for _, ts := range []string{firstString(p, "timestamp"), wrapperTS} {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func firstString(p hooksdk.HookPayloadJSON, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := p[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
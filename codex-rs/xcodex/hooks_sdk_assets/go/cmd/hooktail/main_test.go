@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// decode reads a logged record as hooktail does, with numbers as json.Number.
+func decode(t *testing.T, rec string) hooksdk.HookPayloadJSON {
+	t.Helper()
+	var dec jsonl.Decoder
+	ev, err := dec.Decode([]byte(rec))
+	if err != nil {
+		t.Fatalf("%s: %v", rec, err)
+	}
+	return ev.Payload
+}
+
+func TestRenderers(t *testing.T) {
+	tests := []struct {
+		name   string
+		render renderer
+		rec    string
+		detail string
+		failed bool
+	}{
+		{"session", renderSession, `{"session_source":"cli","cwd":"/home/me/my-repo"}`, "cli in my-repo", false},
+		{"session without a cwd", renderSession, `{"session_source":"exec"}`, "exec", false},
+		{"prompt", renderPrompt, `{"prompt":"fix the tests"}`, "fix the tests", false},
+		{"shell started", renderToolCallStarted, `{"tool_name":"shell","tool_input":{"command":["cargo","test"]}}`, "shell: cargo test", false},
+		{"patch started", renderToolCallStarted, `{"tool_name":"apply_patch","tool_input":{"input":"*** Begin Patch\n*** Update File: a.go\n@@\n-x\n+y\n*** Add File: b.go\n+z\n*** End Patch"}}`, "apply_patch: a.go, b.go", false},
+		{"other input", renderToolCallStarted, `{"tool_name":"web_search","tool_input":{"query":"go"}}`, `web_search: {"query":"go"}`, false},
+		{"string input", renderToolCallStarted, `{"tool_name":"custom","tool_input":"raw text"}`, "custom: raw text", false},
+		{"finished ok", renderToolCallFinished, `{"tool_name":"shell","success":true,"duration_ms":8200,"tool_input":{"command":"make"}}`, "shell ok 8.2s: make", false},
+		{"finished failed", renderToolCallFinished, `{"tool_name":"shell","success":false,"tool_input":{"command":"make"}}`, "shell failed: make", true},
+		{"exit code", renderToolCallFinished, `{"tool_name":"shell","success":true,"tool_response":{"exit_code":101},"duration_ms":120}`, "shell exit 101 120ms", true},
+		{"exit 0", renderToolCallFinished, `{"tool_name":"shell","exit_code":0,"status":"completed"}`, "shell completed", false},
+		{"approval argv", renderApproval, `{"kind":"exec","command":["rm","-rf","build"],"reason":"outside the workspace"}`, "exec: rm -rf build (outside the workspace)", false},
+		{"approval paths", renderApproval, `{"kind":"patch","paths":["a.go","b.go"]}`, "patch: a.go, b.go", false},
+		{"approval tool", renderApproval, `{"tool_name":"mcp"}`, "mcp", false},
+		{"model request", renderModelRequest, `{"provider":"openai","model":"gpt-5","input_item_count":12,"tool_count":1,"attempt":2}`, "openai/gpt-5: 12 items, 1 tool, attempt 2", false},
+		{"first attempt", renderModelRequest, `{"model":"gpt-5","attempt":1}`, "gpt-5", false},
+		{"model response", renderModelResponse, `{"token_usage":{"total_tokens":5120,"output_tokens":312},"needs_follow_up":true}`, "5120 tokens (312 out), follow-up", false},
+		{"response without usage", renderModelResponse, `{}`, "", false},
+		{"turn complete", renderTurnComplete, `{"last_assistant_message":"Done."}`, "Done.", false},
+		{"notification", renderNotification, `{"notification_type":"idle","title":"Codex","message":"approve?"}`, "idle: Codex — approve?", false},
+		{"pre-compact", renderPreCompact, `{"trigger":"auto"}`, "auto", false},
+		{"subagent", renderSubagentStop, `{"subagent":"reviewer","status":"completed"}`, "reviewer completed", false},
+		{"subagent failed", renderSubagentStop, `{"tool_name":"task","status":"errored"}`, "task errored", true},
+		{"default", renderDefault, `{"message":"hi","status":"x"}`, "hi", false},
+		{"default empty", renderDefault, `{}`, "", false},
+	}
+	for _, tt := range tests {
+		detail, failed := tt.render(decode(t, tt.rec))
+		if detail != tt.detail || failed != tt.failed {
+			t.Errorf("%s: %q, %v; want %q, %v", tt.name, detail, failed, tt.detail, tt.failed)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	p := printer{}
+	ts := time.Date(2025, 1, 1, 14, 3, 11, 0, time.Local)
+	payload := decode(t, `{"tool_name":"shell","tool_input":{"command":"cargo   test\n-p core"}}`)
+	got := p.render(hooksdk.EventToolCallStarted, "s1", ts, payload)
+	want := "14:03:11  " + fmtType("tool-call-started") + "  " + hooksdk.ShortID("s1") + "  shell: cargo test -p core"
+	if got != want {
+		t.Errorf("render = %q, want %q", got, want)
+	}
+
+	// No time, type, or session; an unknown type uses renderDefault.
+	got = p.render("", "", time.Time{}, decode(t, `{"message":"hello"}`))
+	if want := "--:--:--  " + fmtType("?") + "  -         hello"; got != want {
+		t.Errorf("render = %q, want %q", got, want)
+	}
+
+	// Colors: the failure is red, the session keeps its color.
+	p.color = true
+	got = p.render(hooksdk.EventToolCallFinished, "s1", ts, decode(t, `{"tool_name":"shell","exit_code":1}`))
+	if !strings.Contains(got, red+fmtType("tool-call-finished")+reset) || !strings.Contains(got, sessionColor("s1")+hooksdk.ShortID("s1")) {
+		t.Errorf("colored render = %q", got)
+	}
+	if sessionColor("s1") != sessionColor("s1") || sessionColor("") != dim {
+		t.Error("session colors aren't stable")
+	}
+}
+
+// fmtType pads an event type to the width of its column.
+func fmtType(s string) string {
+	return s + strings.Repeat(" ", 24-len(s))
+}
+
+func TestPrint(t *testing.T) {
+	records := []string{
+		`{"_meta":{"format":2,"sdk":"1","created":"2025-01-01T00:00:00Z","host":"h"}}`,
+		`{"ts":"2025-01-01T10:00:00Z","event":{"xcodex_event_type":"session-start","session_id":"alpha-1"}}`,
+		`{"ts":"2025-01-01T10:00:01Z","event":{"xcodex_event_type":"tool-call-started","session_id":"alpha-1","tool_name":"shell","tool_input":{"command":"ls"}}}`,
+		`{"ts":"2025-01-01T10:00:02Z","event":{"type":"tool_call_finished","thread_id":"beta-2","tool_name":"shell"}}`,
+		`not json`,
+		"{\n  \"ts\": \"2025-01-01T10:00:03Z\",\n  \"event\": {\"xcodex_event_type\": \"session-end\", \"session_id\": \"beta-2\"}\n}",
+	}
+	run := func(p printer) []string {
+		t.Helper()
+		var buf bytes.Buffer
+		p.w = &buf
+		for _, rec := range records {
+			if err := p.print([]byte(rec)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	}
+
+	// The header and the line that isn't JSON are skipped.
+	if got := run(printer{}); len(got) != 4 || !strings.Contains(got[2], "tool-call-finished") || strings.Contains(got[0], "\x1b") {
+		t.Errorf("lines = %q", got)
+	}
+	if got := run(printer{types: hooksdk.ParseFilter("tool-call-*", "")}); len(got) != 2 {
+		t.Errorf("--type tool-call-*: %q", got)
+	}
+	if got := run(printer{session: "beta"}); len(got) != 2 || !strings.Contains(got[1], "session-end") {
+		t.Errorf("--session beta: %q", got)
+	}
+	short := hooksdk.ShortID("alpha-1")
+	if got := run(printer{session: strings.ToUpper(short[:4])}); len(got) != 2 || !strings.Contains(got[0], short) {
+		t.Errorf("--session %s: %q", short[:4], got)
+	}
+
+	// --raw passes the records through, a pretty one compacted onto its line.
+	got := run(printer{raw: true, session: "beta"})
+	want := []string{records[3], `{"ts":"2025-01-01T10:00:03Z","event":{"xcodex_event_type":"session-end","session_id":"beta-2"}}`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("raw lines = %q, want %q", got, want)
+	}
+
+	// Without the header, a wrapped record is still recognized.
+	var buf bytes.Buffer
+	p := printer{w: &buf}
+	p.print([]byte(records[1]))
+	if !strings.Contains(buf.String(), "session-start") || !strings.Contains(buf.String(), hooksdk.ShortID("alpha-1")) {
+		t.Errorf("headerless line = %q", buf.String())
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	payload := hooktest.SessionStart().Build().Raw()
+	if got := eventTime(payload, "2030-01-01T00:00:00Z"); !got.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("eventTime = %v, want the payload's timestamp", got)
+	}
+	if got := eventTime(hooksdk.HookPayloadJSON{}, "2030-01-01T00:00:00Z"); got.Year() != 2030 {
+		t.Errorf("eventTime = %v, want the wrapper's", got)
+	}
+	if got := eventTime(hooksdk.HookPayloadJSON{"timestamp": "soon"}, ""); !got.IsZero() {
+		t.Errorf("eventTime = %v, want zero", got)
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	if got := oneLine("a\n b\t c", 10); got != "a b c" {
+		t.Errorf("oneLine = %q", got)
+	}
+	if got := oneLine(strings.Repeat("é", 20), 5); got != "éééé…" {
+		t.Errorf("oneLine = %q", got)
+	}
+	if plural(1, "tool") != "1 tool" || plural(0, "tool") != "0 tools" {
+		t.Error("plural")
+	}
+	if duration(65000) != "1m5s" || duration(120) != "120ms" {
+		t.Errorf("duration = %s, %s", duration(65000), duration(120))
+	}
+	if got := join(", ", "", "a", "", "b"); got != "a, b" {
+		t.Errorf("join = %q", got)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"a.jsonl", "b.jsonl"},
+		{"--color", "sometimes"},
+		{"--no-such-flag"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, &stdout, &stderr); code != 2 || stderr.Len() == 0 {
+			t.Errorf("%v: exit %d, stderr %q", args, code, stderr.String())
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-h"}, &stdout, &stderr); code != 0 || !strings.Contains(stderr.String(), "usage: hooktail") {
+		t.Errorf("-h: exit %d, stderr %q", code, stderr.String())
+	}
+	if isTerminal(&stdout) {
+		t.Error("a buffer is a terminal")
+	}
+}
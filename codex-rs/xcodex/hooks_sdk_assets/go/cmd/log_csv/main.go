@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// defaultColumns are logged when CODEX_HOOK_CSV_COLUMNS is unset.
+var defaultColumns = []string{"timestamp", "event_type", "session_id", "cwd", "tool_name", "exit_code", "duration_ms", "summary"}
+
+// maxSummary bounds the summary column, in runes; spreadsheets cap a cell at 32767 characters.
+const maxSummary = 2000
+
+func main() {
+	// CODEX_HOOKLOG_INCLUDE / CODEX_HOOKLOG_EXCLUDE limit which events are logged, as for log_jsonl.
+	filter := hooksdk.ParseFilter(os.Getenv("CODEX_HOOKLOG_INCLUDE"), os.Getenv("CODEX_HOOKLOG_EXCLUDE"))
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(func() []hooksdk.Check {
+		return []hooksdk.Check{hooksdk.CheckWritable("log", csvPath())}
+	}), hooksdk.WithFilter(filter), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	columns := splitList(os.Getenv("CODEX_HOOK_CSV_COLUMNS"))
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+	header, err := encodeRow(columns)
+	if err != nil {
+		hooklog.Errorf("encode header: %v", err)
+		return hooksdk.Allow(), nil
+	}
+
+	// Rotation, locking, and spooling work as for log_jsonl (CODEX_HOOKLOG_MAX_SIZE, ...); every
+	// new file starts with the header row.
+	opts := jsonl.OptionsFromEnv()
+	opts.Header = header
+	// CSV rows aren't JSON, so they can't be hash-chained like log_jsonl's records.
+	opts.Audit = false
+	w := jsonl.New(csvPath(), opts)
+
+	// A file written with other columns is rotated away, so no file mixes two layouts.
+	if existing, ok := firstLine(w.Path()); ok && existing != strings.TrimSuffix(string(header), "\n") {
+		hooklog.Warnf("columns of %s changed; rotating it", w.Path())
+		if err := w.Rotate(); err != nil {
+			hooklog.Errorf("rotate %s: %v", w.Path(), err)
+			return hooksdk.Allow(), nil
+		}
+	}
+
+	row := make([]string, len(columns))
+	for i, col := range columns {
+		row[i] = cell(payload, col)
+	}
+	rec, err := encodeRow(row)
+	if err != nil {
+		hooklog.Errorf("encode row: %v", err)
+		return hooksdk.Allow(), nil
+	}
+	if err := w.AppendRecord(rec); errors.Is(err, jsonl.ErrSpooled) {
+		hooklog.Warnf("append event to %s: %v", w.Path(), err)
+	} else if err != nil {
+		hooklog.Errorf("append event to %s: %v", w.Path(), err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+// cell is the value of one column: a built-in column, or else a dot path into the payload (as in
+// CODEX_HOOKLOG_FIELDS). Fields the event doesn't have are left blank.
+func cell(p *hooksdk.HookPayload, column string) string {
+	raw := hooksdk.HookPayloadJSON(p.RawPayload)
+	var v string
+	switch column {
+	case "timestamp":
+		v = p.Timestamp
+	case "event_type":
+		v = p.EventType()
+	case "session_id":
+		v = p.SessionID()
+	case "cwd":
+		v = p.WorkingDir()
+	case "exit_code":
+		v = exitCode(raw)
+	case "summary":
+		v = summary(p)
+	default:
+		// tool_name, duration_ms, and any other payload field.
+		x, _ := lookup(raw, column)
+		return x
+	}
+	return neutralize(v)
+}
+
+// lookup renders the value at path: strings (neutralized), numbers and booleans as written, and
+// objects or arrays as compact JSON.
+func lookup(raw hooksdk.HookPayloadJSON, path string) (string, bool) {
+	v, ok := hooksdk.Field[any](raw, path)
+	if !ok || v == nil {
+		return "", false
+	}
+	switch t := v.(type) {
+	case string:
+		return neutralize(t), true
+	case json.Number:
+		return t.String(), true
+	case bool, float64, int64, int:
+		return fmt.Sprint(t), true
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return neutralize(string(data)), true
+}
+
+// exitCodeLine is how shell tool output reports its status.
+var exitCodeLine = regexp.MustCompile(`(?m)^Exit code: (-?\d+)\s*$`)
+
+// exitCode is the exit status of a command: an `exit_code` field if the event has one, else the
+// `Exit code: N` line that shell tools put at the top of their output.
+func exitCode(raw hooksdk.HookPayloadJSON) string {
+	for _, path := range []string{"exit_code", "tool_response.exit_code", "tool_response.metadata.exit_code"} {
+		if n, ok := hooksdk.IntField(raw, path); ok {
+			return strconv.FormatInt(n, 10)
+		}
+	}
+	for _, path := range []string{"output_preview", "tool_response.output_preview"} {
+		if s, ok := hooksdk.StringField(raw, path); ok {
+			if m := exitCodeLine.FindStringSubmatch(s); m != nil {
+				return m[1]
+			}
+		}
+	}
+	return ""
+}
+
+// summary is the text worth reading in the event: the command run, the approval reason, the
+// message, the prompt, the agent's reply, or the tool output, whichever comes first.
+func summary(p *hooksdk.HookPayload) string {
+	raw := hooksdk.HookPayloadJSON(p.RawPayload)
+	var parts []string
+	if len(p.Command) > 0 {
+		parts = append(parts, strings.Join(p.Command, " "))
+	} else if cmd, ok := lookupCommand(raw); ok {
+		parts = append(parts, cmd)
+	}
+	for _, key := range []string{"reason", "message", "prompt", "last_assistant_message", "output_preview"} {
+		if s, ok := hooksdk.StringField(raw, key); ok && s != "" {
+			parts = append(parts, s)
+			break
+		}
+	}
+	return truncate(strings.Join(parts, ": "), maxSummary)
+}
+
+// lookupCommand finds a shell command in the tool input, as an argv array or a string.
+func lookupCommand(raw hooksdk.HookPayloadJSON) (string, bool) {
+	switch v := raw["tool_input"].(type) {
+	case map[string]any:
+		switch c := v["command"].(type) {
+		case string:
+			return c, c != ""
+		case []any:
+			parts := make([]string, len(c))
+			for i, item := range c {
+				parts[i] = fmt.Sprint(item)
+			}
+			return strings.Join(parts, " "), len(parts) > 0
+		}
+	}
+	return "", false
+}
+
+// neutralize keeps spreadsheets from evaluating a cell as a formula (a prompt containing
+// `=HYPERLINK(...)`, say) by prefixing text that starts like one with an apostrophe. Numbers,
+// including negative ones, are left alone.
+func neutralize(s string) string {
+	if s == "" || !strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return s
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	return "'" + s
+}
+
+// encodeRow renders one CSV record, quoting fields with commas, quotes, or newlines.
+func encodeRow(fields []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(fields); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// firstLine returns the header line of an existing, non-empty file, decompressing it when it is
+// gzipped (CODEX_HOOKLOG_COMPRESS=gzip).
+func firstLine(path string) (string, bool) {
+	f, err := jsonl.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimRight(line, "\r\n"), true
+}
+
+// truncate shortens s to at most n runes, ending with "…" when it was cut.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// csvPath is CODEX_HOOK_CSV_PATH, or `$CODEX_HOME/hooks.csv`.
+func csvPath() string {
+	if p := os.Getenv("CODEX_HOOK_CSV_PATH"); p != "" {
+		return p
+	}
+	return hooksdk.Environ().Path("hooks.csv")
+}
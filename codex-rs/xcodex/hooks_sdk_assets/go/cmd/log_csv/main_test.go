@@ -0,0 +1,248 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// TestMain lets the tests run this binary as a hook process: with LOG_CSV_TEST_WRITER set, it logs
+// LOG_CSV_TEST_COUNT notifications from that writer to CODEX_HOOK_CSV_PATH.
+func TestMain(m *testing.M) {
+	if writer := os.Getenv("LOG_CSV_TEST_WRITER"); writer != "" {
+		n, _ := strconv.Atoi(os.Getenv("LOG_CSV_TEST_COUNT"))
+		logNotifications(writer, n)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func logNotifications(writer string, n int) {
+	for i := 0; i < n; i++ {
+		// A message with a comma, a quote, and a newline, so a torn row doesn't parse.
+		msg := fmt.Sprintf("%s,%d \"note\"\nend", writer, i)
+		handle(context.Background(), hooktest.Notification().WithSessionID(writer).With("message", msg).Build())
+	}
+}
+
+// setup points the hook at a fresh hooks.csv and returns its path.
+func setup(t *testing.T, columns string) string {
+	t.Helper()
+	home := t.TempDir()
+	path := filepath.Join(home, "hooks.csv")
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOK_CSV_PATH", path)
+	t.Setenv("CODEX_HOOK_CSV_COLUMNS", columns)
+	return path
+}
+
+// readCSV parses path, failing the test on a malformed file.
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return rows
+}
+
+func TestHandleQuoting(t *testing.T) {
+	path := setup(t, "")
+	messages := []string{
+		"plain",
+		"a, b, and c",
+		`she said "hi"`,
+		"line one\nline two",
+		"crlf\r\nline",
+		`"`,
+		"",
+		"unicode ✓ – ok",
+	}
+	for _, msg := range messages {
+		if _, err := handle(context.Background(), hooktest.Notification().With("message", msg).Build()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows := readCSV(t, path)
+	if !reflect.DeepEqual(rows[0], defaultColumns) {
+		t.Errorf("header = %q, want %q", rows[0], defaultColumns)
+	}
+	if len(rows) != len(messages)+1 {
+		t.Fatalf("%d rows, want a header and %d events", len(rows), len(messages))
+	}
+	for i, msg := range messages {
+		// encoding/csv reads a quoted \r\n as \n.
+		if msg == "crlf\r\nline" {
+			msg = "crlf\nline"
+		}
+		if got := rows[i+1][7]; got != msg {
+			t.Errorf("summary %d = %q, want %q", i, got, msg)
+		}
+	}
+}
+
+func TestHandleNeutralizesFormulas(t *testing.T) {
+	path := setup(t, "summary,exit_code")
+	for _, msg := range []string{`=HYPERLINK("http://x")`, "+1+1", "@SUM(A1)", "-2", "-rf"} {
+		handle(context.Background(), hooktest.Notification().With("message", msg).Build())
+	}
+	var got []string
+	for _, row := range readCSV(t, path)[1:] {
+		got = append(got, row[0])
+	}
+	want := []string{`'=HYPERLINK("http://x")`, "'+1+1", "'@SUM(A1)", "-2", "'-rf"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summaries = %q, want %q", got, want)
+	}
+}
+
+func TestHandleColumns(t *testing.T) {
+	path := setup(t, "event_type, tool_name,exit_code,duration_ms,tool_input,no.such.field")
+	finished := hooktest.ToolCallFinished().WithToolName("shell").WithCommand("ls").
+		With("output_preview", "Exit code: 2\nWall time: 0.1 seconds")
+	handle(context.Background(), finished.Build())
+	handle(context.Background(), hooktest.SessionStart().Build())
+
+	rows := readCSV(t, path)
+	want := [][]string{
+		{"event_type", "tool_name", "exit_code", "duration_ms", "tool_input", "no.such.field"},
+		{finished.Build().EventType(), "shell", "2", "1234", `{"command":"ls"}`, ""},
+		// Columns the event doesn't have are blank.
+		{hooktest.SessionStart().Build().EventType(), "", "", "", "", ""},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+
+	// Changing the columns rotates the file, so no file mixes two layouts.
+	t.Setenv("CODEX_HOOK_CSV_COLUMNS", "session_id")
+	handle(context.Background(), hooktest.SessionStart().WithSessionID("s2").Build())
+	if rows := readCSV(t, path); !reflect.DeepEqual(rows, [][]string{{"session_id"}, {"s2"}}) {
+		t.Errorf("after a column change, rows = %q", rows)
+	}
+	if rows := readCSV(t, path+".1"); len(rows) != 3 || rows[0][0] != "event_type" {
+		t.Errorf("rotated file = %q, want the old layout", rows)
+	}
+}
+
+func TestConcurrentAppends(t *testing.T) {
+	path := setup(t, "session_id,summary")
+	// Rotate every few rows, keeping every generation, so appends race rotations too.
+	t.Setenv("CODEX_HOOKLOG_MAX_SIZE", "512")
+	t.Setenv("CODEX_HOOKLOG_KEEP", "10000")
+	const n = 20
+
+	// Hook processes and goroutines at once, as parallel tool calls and sessions do.
+	var cmds []*exec.Cmd
+	for _, writer := range []string{"p1", "p2", "p3"} {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "LOG_CSV_TEST_WRITER="+writer, "LOG_CSV_TEST_COUNT="+strconv.Itoa(n))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	var wg sync.WaitGroup
+	for _, writer := range []string{"g1", "g2", "g3"} {
+		wg.Add(1)
+		go func(writer string) {
+			defer wg.Done()
+			logNotifications(writer, n)
+		}(writer)
+	}
+	wg.Wait()
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The active file and its rotated generations, not the lock beside them.
+	files, err := filepath.Glob(path + ".[0-9]*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, path)
+	if len(files) < 2 {
+		t.Errorf("%d files; the log never rotated", len(files))
+	}
+	got := map[string]int{}
+	for _, file := range files {
+		rows := readCSV(t, file)
+		if len(rows) == 0 || !reflect.DeepEqual(rows[0], []string{"session_id", "summary"}) {
+			t.Errorf("%s doesn't start with the header: %q", file, rows)
+			continue
+		}
+		for _, row := range rows[1:] {
+			var writer string
+			var i int
+			if _, err := fmt.Sscanf(row[1], "%2s,%d", &writer, &i); err != nil || writer != row[0] {
+				t.Errorf("%s: torn row %q", file, row)
+				continue
+			}
+			got[writer]++
+		}
+	}
+	for _, writer := range []string{"p1", "p2", "p3", "g1", "g2", "g3"} {
+		if got[writer] != n {
+			t.Errorf("writer %s: %d of %d rows in the log", writer, got[writer], n)
+		}
+	}
+}
+
+func TestHandleGzipStream(t *testing.T) {
+	path := setup(t, "session_id")
+	t.Setenv("CODEX_HOOKLOG_COMPRESS", "gzip")
+	for _, id := range []string{"s1", "s2"} {
+		handle(context.Background(), hooktest.Notification().WithSessionID(id).Build())
+	}
+	// The compressed header is read back, so the second row doesn't rotate the file.
+	if _, err := os.Stat(path + ".1.gz"); !os.IsNotExist(err) {
+		t.Errorf("the log rotated with unchanged columns: %v", err)
+	}
+	f, err := os.Open(path + ".gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(zr).ReadAll()
+	if err != nil || !reflect.DeepEqual(rows, [][]string{{"session_id"}, {"s1"}, {"s2"}}) {
+		t.Errorf("rows = %q, %v", rows, err)
+	}
+}
+
+// TestHandleIgnoresAudit checks that CODEX_HOOKLOG_AUDIT, meant for log_jsonl, leaves the CSV
+// rows as they are.
+func TestHandleIgnoresAudit(t *testing.T) {
+	path := setup(t, "session_id")
+	t.Setenv("CODEX_HOOKLOG_AUDIT", "1")
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := handle(context.Background(), hooktest.Notification().WithSessionID(id).Build()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rows := readCSV(t, path); !reflect.DeepEqual(rows, [][]string{{"session_id"}, {"s1"}, {"s2"}}) {
+		t.Errorf("rows = %q", rows)
+	}
+}
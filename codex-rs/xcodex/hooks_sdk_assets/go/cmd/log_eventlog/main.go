@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/eventlog"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+const (
+	defaultSource = "xcodex"
+
+	// maxPayloadString bounds each string of the payload in the message, so one long prompt or
+	// output doesn't crowd out the rest.
+	maxPayloadString = 2048
+)
+
+// eventIDs are the event ids, one per event type, for filtering in Event Viewer and forwarding
+// rules; other event types get otherEventID.
+var eventIDs = map[hooksdk.EventType]uint32{
+	hooksdk.EventSessionStart:           1,
+	hooksdk.EventSessionEnd:             2,
+	hooksdk.EventUserPromptSubmit:       3,
+	hooksdk.EventToolCallStarted:        4,
+	hooksdk.EventToolCallFinished:       5,
+	hooksdk.EventApprovalRequested:      6,
+	hooksdk.EventModelRequestStarted:    7,
+	hooksdk.EventModelResponseCompleted: 8,
+	hooksdk.EventAgentTurnComplete:      9,
+	hooksdk.EventNotification:           10,
+	hooksdk.EventPreCompact:             11,
+	hooksdk.EventSubagentStop:           12,
+}
+
+const otherEventID = 100
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `log_eventlog --self-test`, that the Event Log can be used. A source that
+// isn't registered yet is fine: it is registered, or the fallback used, on the first event.
+func selfTest() []hooksdk.Check {
+	return []hooksdk.Check{{
+		Name: "the Windows Event Log is available",
+		Run: func(context.Context, hooksdk.Env) error {
+			_, err := eventlog.New(defaultSource).System.Installed(defaultSource)
+			return err
+		},
+	}}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	// CODEX_HOOK_EVENTLOG_SOURCE names the event source (default `xcodex`), registered in the
+	// Application log on first run when the hook runs elevated; otherwise events are written
+	// under CODEX_HOOK_EVENTLOG_FALLBACK_SOURCE (default `Application`).
+	source := os.Getenv("CODEX_HOOK_EVENTLOG_SOURCE")
+	if source == "" {
+		source = defaultSource
+	}
+	w := eventlog.New(source)
+	w.FallbackSource = os.Getenv("CODEX_HOOK_EVENTLOG_FALLBACK_SOURCE")
+	if err := write(w, payload); err != nil {
+		if errors.Is(err, eventlog.ErrUnsupported) {
+			hooklog.Warnf("%v; event not logged", err)
+		} else {
+			hooklog.Errorf("write event to the event log: %v", err)
+		}
+	}
+	return hooksdk.Allow(), nil
+}
+
+// write writes payload to w, noting (with CODEX_HOOK_DEBUG=1) when it went under the fallback
+// source.
+func write(w *eventlog.Writer, payload *hooksdk.HookPayload) error {
+	used, err := w.Write(level(payload), eventID(payload), message(payload))
+	if err != nil {
+		return err
+	}
+	if used != w.Source {
+		hooklog.Debugf("source %q isn't registered (run the hook elevated once to register it); logged under %q", w.Source, used)
+	}
+	return nil
+}
+
+// level maps events to Event Viewer levels: failed tool calls are errors, aborted ones and
+// approval requests are warnings, and everything else is information.
+func level(p *hooksdk.HookPayload) eventlog.Level {
+	switch hooksdk.EventType(p.EventType()) {
+	case hooksdk.EventToolCallFinished:
+		if p.Success != nil && !*p.Success {
+			return eventlog.Error
+		}
+		if p.Status != nil && *p.Status != "completed" {
+			return eventlog.Warning
+		}
+	case hooksdk.EventApprovalRequested:
+		return eventlog.Warning
+	}
+	return eventlog.Information
+}
+
+func eventID(p *hooksdk.HookPayload) uint32 {
+	if id, ok := eventIDs[hooksdk.EventType(p.EventType())]; ok {
+		return id
+	}
+	return otherEventID
+}
+
+// message is the event's text: a summary line, the fields most often searched for, one per line,
+// and the payload as JSON with long strings cut.
+//
+//	xcodex tool-call-finished: tool=shell status=completed success=false
+//
+//	Session: 3f2a9c1e-...
+//	Event: 0193...
+//	Directory: C:\src\app
+//	Tool: shell
+//
+//	Payload: {"attempt":1,...}
+func message(p *hooksdk.HookPayload) string {
+	sections := []string{"xcodex " + summary(p)}
+	var fields []string
+	for _, kv := range [][2]string{
+		{"Session", p.SessionID()},
+		{"Event", p.EventId},
+		{"Directory", p.WorkingDir()},
+		{"Tool", str(p.ToolName)},
+	} {
+		if kv[1] != "" {
+			fields = append(fields, kv[0]+": "+kv[1])
+		}
+	}
+	if len(fields) > 0 {
+		sections = append(sections, strings.Join(fields, "\r\n"))
+	}
+	if data, err := json.Marshal(hooksdk.TruncateStrings(p.RawPayload, maxPayloadString)); err == nil {
+		sections = append(sections, "Payload: "+string(data))
+	}
+	return strings.Join(sections, "\r\n\r\n") + "\r\n"
+}
+
+// summary is the first line, e.g. `tool-call-finished: tool=shell status=completed`.
+func summary(p *hooksdk.HookPayload) string {
+	var parts []string
+	if name := str(p.ToolName); name != "" {
+		parts = append(parts, "tool="+name)
+	}
+	if len(p.Command) > 0 {
+		parts = append(parts, fmt.Sprintf("command=%q", strings.Join(p.Command, " ")))
+	}
+	if status := str(p.Status); status != "" {
+		parts = append(parts, "status="+status)
+	}
+	if p.Success != nil {
+		parts = append(parts, fmt.Sprintf("success=%t", *p.Success))
+	}
+	if len(parts) == 0 {
+		return p.EventType()
+	}
+	return p.EventType() + ": " + strings.Join(parts, " ")
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
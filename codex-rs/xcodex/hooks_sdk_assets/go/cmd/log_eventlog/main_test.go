@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/eventlog"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// fakeSystem is an Event Log where registering a source is denied, as for a hook that isn't
+// elevated.
+type fakeSystem struct {
+	source  string
+	level   eventlog.Level
+	id      uint32
+	message string
+}
+
+func (s *fakeSystem) Installed(string) (bool, error) { return false, nil }
+func (s *fakeSystem) Install(string, string) error {
+	return fmt.Errorf("RegCreateKeyEx: %w", eventlog.ErrAccessDenied)
+}
+func (s *fakeSystem) Report(source string, level eventlog.Level, id uint32, message string) error {
+	s.source, s.level, s.id, s.message = source, level, id, message
+	return nil
+}
+
+func TestLevel(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		payload *hooksdk.HookPayload
+		want    eventlog.Level
+	}{
+		{"succeeded", hooktest.ToolCallFinished().Build(), eventlog.Information},
+		{"failed", hooktest.ToolCallFinished().With("success", false).Build(), eventlog.Error},
+		{"aborted", hooktest.ToolCallFinished().With("status", "aborted").Build(), eventlog.Warning},
+		{"approval", hooktest.ApprovalRequested().Build(), eventlog.Warning},
+		{"session", hooktest.SessionStart().Build(), eventlog.Information},
+	} {
+		if got := level(tt.payload); got != tt.want {
+			t.Errorf("%s: level %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if eventID(hooktest.ApprovalRequested().Build()) != 6 || eventID(hooktest.New("future-event", "").Build()) != otherEventID {
+		t.Error("eventID")
+	}
+}
+
+func TestMessage(t *testing.T) {
+	p := hooktest.ToolCallFinished().WithSessionID("s1").WithCwd(`C:\src\app`).With("success", false).
+		With("output_preview", strings.Repeat("x", 3*maxPayloadString)).Build()
+	msg := message(p)
+	sections := strings.Split(msg, "\r\n\r\n")
+	if len(sections) != 3 || !strings.HasSuffix(msg, "\r\n") {
+		t.Fatalf("message = %q", msg)
+	}
+	if want := `xcodex tool-call-finished: tool=Bash status=completed success=false`; sections[0] != want {
+		t.Errorf("summary = %q, want %q", sections[0], want)
+	}
+	if want := "Session: s1\r\nEvent: " + p.EventId + "\r\nDirectory: C:\\src\\app\r\nTool: Bash"; sections[1] != want {
+		t.Errorf("fields = %q, want %q", sections[1], want)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(strings.TrimPrefix(sections[2], "Payload: "), "\r\n")), &payload); err != nil {
+		t.Fatalf("payload %q: %v", sections[2], err)
+	}
+	if preview, _ := payload["output_preview"].(string); len(preview) > maxPayloadString+100 || payload["session_id"] != "s1" {
+		t.Errorf("payload has a %d-byte preview, session %v", len(preview), payload["session_id"])
+	}
+
+	if got := summary(hooktest.ApprovalRequested().Build()); got != `approval-requested: tool=Bash command="curl https://example.com"` {
+		t.Errorf("approval summary = %q", got)
+	}
+	// An event with nothing to summarize is its type.
+	if got := message(hooktest.New("pre-compact", "").Build()); !strings.HasPrefix(got, "xcodex pre-compact\r\n\r\n") {
+		t.Errorf("message = %q", got)
+	}
+}
+
+func TestWriteFallsBack(t *testing.T) {
+	sys := &fakeSystem{}
+	w := &eventlog.Writer{Source: "xcodex", System: sys}
+	if err := write(w, hooktest.ApprovalRequested().Build()); err != nil {
+		t.Fatal(err)
+	}
+	if sys.source != eventlog.DefaultFallbackSource || sys.level != eventlog.Warning || sys.id != 6 ||
+		!strings.HasPrefix(sys.message, "xcodex approval-requested") {
+		t.Errorf("reported %+v", sys)
+	}
+}
+
+func TestHandleAllows(t *testing.T) {
+	// Off Windows the write fails with ErrUnsupported; on it, the event is written.
+	t.Setenv("CODEX_HOOK_EVENTLOG_SOURCE", "xcodex-test")
+	resp, err := handle(context.Background(), hooktest.SessionStart().Build())
+	if err != nil || resp.Decision != "allow" {
+		t.Errorf("handle = %+v, %v; want allow", resp, err)
+	}
+}
@@ -1,37 +1,305 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/anonymize"
+	"example.com/xcodex/hooks-sdk/hooksdk/coalesce"
+	"example.com/xcodex/hooks-sdk/hooksdk/dedup"
+	"example.com/xcodex/hooks-sdk/hooksdk/filterexpr"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/redact"
+	"example.com/xcodex/hooks-sdk/hooksdk/sizestats"
 )
 
+// filter is CODEX_HOOKLOG_FILTER, compiled when the hook starts so a mistake in it is reported
+// once rather than on every event; nil logs everything.
+var filter *filterexpr.Expr
+
 func main() {
-	// Parse the event payload (handles stdin vs payload_path envelopes).
-	payload, err := hooksdk.ReadPayload()
+	var err error
+	if filter, err = compileFilter(); err != nil && !hooksdk.SelfTestRequested() {
+		hooklog.Errorf("ignoring CODEX_HOOKLOG_FILTER: %v", err)
+	}
+	// CODEX_HOOKLOG_INCLUDE / CODEX_HOOKLOG_EXCLUDE (comma-separated event types, `*` suffix
+	// wildcards) limit which events are logged. Run allows the others from their type alone, so
+	// skipped events aren't decoded and don't touch the file.
+	types := hooksdk.ParseFilter(os.Getenv("CODEX_HOOKLOG_INCLUDE"), os.Getenv("CODEX_HOOKLOG_EXCLUDE"))
+	// Run parses the event payload (handles stdin vs payload_path envelopes), writes the returned
+	// response to stdout, and reports errors as a structured stderr line, allowing the event.
+	// Strings that aren't valid UTF-8 (e.g. a binary diff in a tool's output) are logged with a
+	// lossless `<key>__base64` copy of their bytes.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithInvalidUTF8(hooksdk.InvalidUTF8Base64), hooksdk.WithFilter(types), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `log_jsonl --self-test`, that the log (and the spool directory lines go to
+// when it can't be written) can be written.
+func selfTest() []hooksdk.Check {
+	codexHome := hooksdk.Environ().CodexHome
+	checks := []hooksdk.Check{hooksdk.CheckWritable("log", filepath.Join(codexHome, "hooks.jsonl"))}
+	if os.Getenv("CODEX_HOOKLOG_SPLIT") == "session" {
+		checks = append(checks, hooksdk.CheckWritable("session log directory", filepath.Join(codexHome, "hooks", "sessions")))
+	}
+	if dir := jsonl.OptionsFromEnv().SpoolDir; dir != "" {
+		checks = append(checks, hooksdk.CheckWritable("spool directory", dir))
+	}
+	if _, err := compileFilter(); err != nil {
+		checks = append(checks, hooksdk.Check{
+			Name: "CODEX_HOOKLOG_FILTER is valid",
+			Run:  func(context.Context, hooksdk.Env) error { return err },
+		})
+	}
+	return checks
+}
+
+// compileFilter compiles CODEX_HOOKLOG_FILTER, or returns nil when it isn't set.
+func compileFilter() (*filterexpr.Expr, error) {
+	src := os.Getenv("CODEX_HOOKLOG_FILTER")
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	return filterexpr.Compile(src)
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	// Add your logic here. This template logs the full payload with a little metadata.
+	hooklog.Bind(payload)
+
+	// CODEX_HOOKLOG_FILTER (e.g. `exit_code != 0 || duration_ms > 10s`) logs only the events the
+	// expression matches; see hooksdk/filterexpr. An event it can't be evaluated on is logged.
+	if ok, err := filter.Eval(hooksdk.HookPayloadJSON(payload.RawPayload)); err != nil {
+		hooklog.Warnf("CODEX_HOOKLOG_FILTER: %v; logging the event", err)
+	} else if !ok {
+		return hooksdk.Allow(), nil
+	}
+
+	// CODEX_HOOKLOG_SAMPLE (e.g. `notification:0.01`) logs only a fraction of the listed event
+	// types; CODEX_HOOKLOG_SAMPLE_MODE=hash picks by event id so replays sample the same events.
+	rates, err := hooksdk.ParseSampleRates(os.Getenv("CODEX_HOOKLOG_SAMPLE"))
+	if err != nil {
+		hooklog.Warnf("ignoring CODEX_HOOKLOG_SAMPLE: %v", err)
+	}
+	sampler := hooksdk.Sampler{Rates: rates, Deterministic: os.Getenv("CODEX_HOOKLOG_SAMPLE_MODE") == "hash"}
+	if !sampler.KeepPayload(payload) {
+		return hooksdk.Allow(), nil
+	}
+
+	codexHome := hooksdk.Environ().CodexHome
+	outPath := logPath(codexHome, payload)
+
+	// The file is rotated past CODEX_HOOKLOG_MAX_SIZE (default 50 MB), keeping
+	// CODEX_HOOKLOG_KEEP (default 5) old generations as hooks.jsonl.1, hooks.jsonl.2, ...
+	// CODEX_HOOKLOG_COMPRESS=1 gzips them, and CODEX_HOOKLOG_COMPRESS=gzip writes hooks.jsonl.gz
+	// compressed from the start, one gzip member per event.
+	// CODEX_HOOKLOG_FORMAT=pretty writes indented records for reading by eye, and compactkeys
+	// sorts every object's keys.
+	// CODEX_HOOKLOG_SYNC=1 fsyncs every event to disk, for logs that must survive a power loss.
+	// CODEX_HOOKLOG_AUDIT=1 hash-chains the records, so `hookq verify` finds any that were edited,
+	// inserted, or deleted.
+	if _, err := jsonl.ParseFormat(os.Getenv("CODEX_HOOKLOG_FORMAT")); err != nil {
+		hooklog.Warnf("ignoring CODEX_HOOKLOG_FORMAT: %v", err)
+	}
+	// Each new file (the first and each one after a rotation) starts with a header line saying how
+	// its records are laid out, unless CODEX_HOOKLOG_HEADER=0. A log without one, from before
+	// headers, is moved aside as hooks.jsonl.legacy first (see `hookq migrate`).
+	opts := jsonl.OptionsFromEnv()
+	if v, err := strconv.ParseBool(os.Getenv("CODEX_HOOKLOG_HEADER")); err != nil || v {
+		opts.Header = header(opts.Format)
+		opts.MigrateLegacy = true
+	}
+	w := jsonl.New(outPath, opts)
+
+	// CODEX_HOOKLOG_COALESCE=1 buffers the chunk events of streamed tool output (see
+	// hooksdk/coalesce) and logs them as one record when the call finishes; a call that never does
+	// has its chunks logged as they were after CODEX_HOOKLOG_COALESCE_TTL (default 10m).
+	events := []hooksdk.HookPayloadJSON{hooksdk.HookPayloadJSON(payload.RawPayload)}
+	if enabled("CODEX_HOOKLOG_COALESCE") {
+		c := coalesce.New(outPath + ".chunks.state")
+		if v := os.Getenv("CODEX_HOOKLOG_COALESCE_TTL"); v != "" {
+			if c.TTL, err = time.ParseDuration(v); err != nil {
+				hooklog.Warnf("ignoring CODEX_HOOKLOG_COALESCE_TTL: %v", err)
+			}
+		}
+		c.ChunkType = os.Getenv("CODEX_HOOKLOG_COALESCE_EVENT")
+		if events, err = c.Add(events[0]); err != nil {
+			hooklog.Warnf("coalesce: %v; logging the event on its own", err)
+		}
+	}
+	for _, event := range events {
+		logEvent(w, event, outPath)
+	}
+	return hooksdk.Allow(), nil
+}
+
+// logEvent appends the record of event to w, unless it is a duplicate.
+func logEvent(w *jsonl.Writer, event hooksdk.HookPayloadJSON, outPath string) {
+	rec := record(event, outPath)
+
+	// CODEX_HOOKLOG_DEDUP=N skips events identical to one of the previous N (ignoring the fields in
+	// CODEX_HOOKLOG_DEDUP_IGNORE, default event_id,timestamp). Skipped events are counted in
+	// `{"type":"dedup_summary","suppressed":K}` lines.
+	if window, _ := strconv.Atoi(os.Getenv("CODEX_HOOKLOG_DEDUP")); window > 0 {
+		d := dedup.New(outPath+".dedup.json", window)
+		if v := os.Getenv("CODEX_HOOKLOG_DEDUP_IGNORE"); v != "" {
+			d.IgnoreFields = splitList(v)
+		}
+		if n, err := strconv.Atoi(os.Getenv("CODEX_HOOKLOG_DEDUP_SUMMARY_EVERY")); err == nil {
+			d.SummaryEvery = n
+		}
+		dup, summary, err := d.Check(rec)
+		if err != nil {
+			hooklog.Warnf("dedup: %v", err)
+		}
+		if summary != nil {
+			appendLine(w, summary)
+		}
+		if dup {
+			return
+		}
+	}
+
+	size := appendLine(w, rec)
+
+	// CODEX_HOOKLOG_STATS=1 keeps per-event-type size statistics (count, total bytes, p50/p95/max
+	// of the logged records) in $CODEX_HOME/hooks/stats.json; `hookstats show` prints them.
+	if size > 0 && enabled("CODEX_HOOKLOG_STATS") {
+		eventType, _ := hooksdk.StringField(event, "xcodex_event_type")
+		sizestats.Record(eventType, size)
+	}
+}
+
+// appendLine logs v, wrapped as `{"ts","host","pid","hook","hook_invocation_id","event":v}` unless
+// CODEX_HOOKLOG_PLAIN=1 asks for one bare payload per line. It returns the size of the record in
+// bytes, or 0 if it couldn't be encoded.
+func appendLine(w *jsonl.Writer, v any) int {
+	if !enabled("CODEX_HOOKLOG_PLAIN") {
+		v = hooksdk.Meta().Wrap(v)
+	}
+	data, err := jsonl.OptionsFromEnv().Format.Marshal(v)
 	if err != nil {
-		panic(err)
+		hooklog.Errorf("append event to %s: %v", w.Path(), err)
+		return 0
 	}
 
-	// Add your logic here. This template just logs the full payload.
-	codexHome := os.Getenv("CODEX_HOME")
-	if codexHome == "" {
-		home, _ := os.UserHomeDir()
-		codexHome = filepath.Join(home, ".xcodex")
+	// A logging hook should never get in the way of the action, so failures are reported on stderr
+	// and the event is still allowed. If the log can't be written (full or read-only disk), the line
+	// is spooled to CODEX_HOOKLOG_SPOOL_DIR and moved into the log by the next run that succeeds.
+	if err := w.AppendRecord(data); errors.Is(err, jsonl.ErrSpooled) {
+		hooklog.Warnf("append event to %s: %v", w.Path(), err)
+	} else if err != nil {
+		hooklog.Errorf("append event to %s: %v", w.Path(), err)
 	}
-	outPath := filepath.Join(codexHome, "hooks.jsonl")
-	_ = os.MkdirAll(filepath.Dir(outPath), 0o755)
+	return len(data)
+}
 
-	f, err := os.OpenFile(outPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+// header is the header line of new log files, in format.
+func header(format jsonl.Format) []byte {
+	meta := jsonl.Meta{
+		Format:  jsonl.MetaFormatWrapped,
+		SDK:     hooksdk.SDKVersion,
+		Created: time.Now().UTC().Format(time.RFC3339),
+		Host:    hooksdk.Meta().Host,
+	}
+	if enabled("CODEX_HOOKLOG_PLAIN") {
+		meta.Format = jsonl.MetaFormatPlain
+	}
+	data, err := meta.Header(format)
 	if err != nil {
-		panic(err)
+		hooklog.Warnf("encode log header: %v", err)
+		return nil
 	}
-	defer f.Close()
+	return data
+}
 
-	enc := json.NewEncoder(f)
-	if err := enc.Encode(payload.RawPayload); err != nil {
-		panic(err)
+// record builds the line to log for event, a raw payload: the payload, with secrets masked when
+// CODEX_HOOKLOG_REDACT=1 (extra key names to mask can be listed in CODEX_HOOKLOG_REDACT_KEYS),
+// paths and user and host names hashed when CODEX_HOOKLOG_ANONYMIZE=1, cut down to the dot paths
+// listed in CODEX_HOOKLOG_FIELDS when that is set, and with string values longer than
+// CODEX_HOOKLOG_MAX_FIELD_BYTES (default 64K; 0 disables) truncated.
+func record(event hooksdk.HookPayloadJSON, outPath string) hooksdk.HookPayloadJSON {
+	rec := event
+	if enabled("CODEX_HOOKLOG_REDACT") {
+		rec = redact.New(splitList(os.Getenv("CODEX_HOOKLOG_REDACT_KEYS"))...).Redact(rec)
 	}
+	if enabled("CODEX_HOOKLOG_ANONYMIZE") {
+		rec = anonymize.Anonymize(rec, anonymizeSalt(outPath))
+	}
+	rec = hooksdk.Project(rec, splitList(os.Getenv("CODEX_HOOKLOG_FIELDS")))
+
+	maxFieldBytes := int64(defaultMaxFieldBytes)
+	if v := os.Getenv("CODEX_HOOKLOG_MAX_FIELD_BYTES"); v != "" {
+		n, err := jsonl.ParseSize(v)
+		if err != nil {
+			hooklog.Warnf("ignoring CODEX_HOOKLOG_MAX_FIELD_BYTES: %v", err)
+		} else {
+			maxFieldBytes = n
+		}
+	}
+	return hooksdk.TruncateStrings(rec, int(maxFieldBytes))
+}
+
+const defaultMaxFieldBytes = 64 << 10
+
+// anonymizeSalt is CODEX_HOOKLOG_ANONYMIZE_SALT, or else the random salt kept next to the log in
+// `<log>.salt`, so tokens stay the same for the life of the log. If that can't be read or created,
+// a salt just for this event keeps the record anonymous at the cost of its tokens matching others.
+func anonymizeSalt(outPath string) string {
+	if salt := os.Getenv("CODEX_HOOKLOG_ANONYMIZE_SALT"); salt != "" {
+		return salt
+	}
+	salt, err := anonymize.LoadSalt(outPath + ".salt")
+	if err != nil {
+		hooklog.Warnf("anonymize salt: %v; using one for this event only", err)
+		var b [16]byte
+		rand.Read(b[:])
+		salt = hex.EncodeToString(b[:])
+	}
+	return salt
+}
+
+func enabled(name string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(name))
+	return v
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// logPath picks the log file for payload. With CODEX_HOOKLOG_SPLIT=session each session gets its
+// own `$CODEX_HOME/hooks/sessions/<short-id>.jsonl` (see hooksdk.ShortID); events without a
+// session id (and the default mode) go to `$CODEX_HOME/hooks.jsonl`.
+func logPath(codexHome string, payload *hooksdk.HookPayload) string {
+	if os.Getenv("CODEX_HOOKLOG_SPLIT") == "session" && payload.SessionID() != "" {
+		dir := filepath.Join(codexHome, "hooks", "sessions")
+		// Sessions started before files were named by short id keep the file named by their id.
+		if name, ok := jsonl.SafeName(payload.SessionID()); ok {
+			if legacy := filepath.Join(dir, name+".jsonl"); fileExists(legacy) {
+				return legacy
+			}
+		}
+		return filepath.Join(dir, hooksdk.ShortID(payload.SessionID())+".jsonl")
+	}
+	return filepath.Join(codexHome, "hooks.jsonl")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
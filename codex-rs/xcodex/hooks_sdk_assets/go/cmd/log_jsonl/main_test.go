@@ -0,0 +1,633 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/anonymize"
+	"example.com/xcodex/hooks-sdk/hooksdk/coalesce"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/sizestats"
+)
+
+// TestMain runs the hook itself when LOG_JSONL_TEST_MAIN is set.
+func TestMain(m *testing.M) {
+	if os.Getenv("LOG_JSONL_TEST_MAIN") != "" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+func TestLogPath(t *testing.T) {
+	home := t.TempDir()
+	global := filepath.Join(home, "hooks.jsonl")
+	sessions := filepath.Join(home, "hooks", "sessions")
+
+	t.Setenv("CODEX_HOOKLOG_SPLIT", "")
+	if got := logPath(home, hooktest.SessionStart().WithSessionID("s1").Build()); got != global {
+		t.Errorf("default mode: log = %s, want %s", got, global)
+	}
+
+	t.Setenv("CODEX_HOOKLOG_SPLIT", "session")
+	if got := logPath(home, hooktest.SessionStart().With("session_id", nil).Build()); got != global {
+		t.Errorf("no session id: log = %s, want %s", got, global)
+	}
+	seen := map[string]bool{}
+	for _, id := range []string{"s1", "s2", "../../etc/passwd", "/abs/path", `..\..\win`, ".hidden", "a\x00b"} {
+		got := logPath(home, hooktest.SessionStart().WithSessionID(id).Build())
+		if filepath.Dir(got) != sessions || !strings.HasSuffix(got, ".jsonl") || strings.HasPrefix(filepath.Base(got), ".") {
+			t.Errorf("session %q: log = %s, want a file in %s", id, got, sessions)
+		}
+		if seen[got] {
+			t.Errorf("session %q: log %s is another session's", id, got)
+		}
+		seen[got] = true
+	}
+
+	// New session logs are named by short id; one named by the full id, from before, is kept.
+	id := "019a2b3c-4d5e-7f60-8a9b-0c1d2e3f4a5b"
+	want := filepath.Join(sessions, hooksdk.ShortID(id)+".jsonl")
+	if got := logPath(home, hooktest.SessionStart().WithSessionID(id).Build()); got != want {
+		t.Errorf("session %q: log = %s, want %s", id, got, want)
+	}
+	legacy := filepath.Join(sessions, id+".jsonl")
+	if err := os.MkdirAll(sessions, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacy, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := logPath(home, hooktest.SessionStart().WithSessionID(id).Build()); got != legacy {
+		t.Errorf("session %q with a log named by its id: log = %s, want %s", id, got, legacy)
+	}
+}
+
+func TestRecordFields(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hooks.jsonl")
+	event := hooksdk.HookPayloadJSON(hooktest.ToolCallFinished().WithSessionID("s1").WithToolName("shell").Map())
+
+	t.Setenv("CODEX_HOOKLOG_FIELDS", "")
+	if got := record(event, out); !reflect.DeepEqual(got, event) {
+		t.Errorf("no fields: record = %v, want the whole event", got)
+	}
+
+	t.Setenv("CODEX_HOOKLOG_FIELDS", "xcodex_event_type, session_id,tool_name,tool_input.command,no.such.path")
+	got := record(event, out)
+	want := hooksdk.HookPayloadJSON{
+		"xcodex_event_type": "tool-call-finished",
+		"session_id":        "s1",
+		"tool_name":         "shell",
+		"tool_input":        map[string]any{"command": "go test ./..."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("record = %v, want %v", got, want)
+	}
+}
+
+func TestRecordAnonymize(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hooks.jsonl")
+	event := hooksdk.HookPayloadJSON(hooktest.ToolCallStarted().WithCwd("/work/shop").WithCommand("cat /work/shop/secret.txt").Map())
+	t.Setenv("CODEX_HOOKLOG_ANONYMIZE", "1")
+	t.Setenv("CODEX_HOOKLOG_ANONYMIZE_SALT", "salt")
+	got := record(event, out)
+	a := &anonymize.Anonymizer{Salt: "salt"}
+	shop := "/" + a.Token("work") + "/" + a.Token("shop")
+	if got["cwd"] != shop || got["tool_input"].(map[string]any)["command"] != "cat "+shop+"/"+a.Token("secret")+".txt" {
+		t.Errorf("record = %v", got)
+	}
+
+	// Without a salt set, one is kept next to the log so tokens match across events.
+	t.Setenv("CODEX_HOOKLOG_ANONYMIZE_SALT", "")
+	first, second := record(event, out), record(event, out)
+	if first["cwd"] == got["cwd"] || first["cwd"] != second["cwd"] {
+		t.Errorf("cwd = %v, then %v", first["cwd"], second["cwd"])
+	}
+	if _, err := os.Stat(out + ".salt"); err != nil {
+		t.Error(err)
+	}
+
+	t.Setenv("CODEX_HOOKLOG_ANONYMIZE", "")
+	if got := record(event, out); got["cwd"] != "/work/shop" {
+		t.Errorf("not anonymizing: cwd = %v", got["cwd"])
+	}
+}
+
+// logEvents runs the hook on each event with CODEX_HOME set to a new directory, and returns the
+// lines of the log it wrote, which has no header.
+func logEvents(t *testing.T, events ...*hooktest.Builder) []map[string]any {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOKLOG_HEADER", "0")
+	for _, b := range events {
+		if _, err := handle(context.Background(), b.Build()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(home, "hooks.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var v map[string]any
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		lines = append(lines, v)
+	}
+	return lines
+}
+
+func TestLogLineShapes(t *testing.T) {
+	t.Setenv("CODEX_HOOK_NAME", "logger")
+	t.Setenv("CODEX_HOOKLOG_PLAIN", "")
+	lines := logEvents(t, hooktest.SessionStart().WithSessionID("s1"))
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want 1", len(lines))
+	}
+	line := lines[0]
+	if _, err := time.Parse(time.RFC3339Nano, line["ts"].(string)); err != nil {
+		t.Errorf("ts: %v", err)
+	}
+	if host, _ := os.Hostname(); line["host"] != host {
+		t.Errorf("host = %v, want %s", line["host"], host)
+	}
+	if line["pid"] != float64(os.Getpid()) || line["hook"] != "logger" {
+		t.Errorf("pid, hook = %v, %v", line["pid"], line["hook"])
+	}
+	if event, _ := line["event"].(map[string]any); event["session_id"] != "s1" {
+		t.Errorf("event = %v, want the payload", line["event"])
+	}
+
+	t.Setenv("CODEX_HOOKLOG_PLAIN", "1")
+	lines = logEvents(t, hooktest.SessionStart().WithSessionID("s1"))
+	if len(lines) != 1 || lines[0]["session_id"] != "s1" || lines[0]["event"] != nil || lines[0]["ts"] != nil {
+		t.Errorf("plain lines = %v, want the bare payload", lines)
+	}
+}
+
+func TestLogHeader(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOKLOG_HEADER", "")
+	t.Setenv("CODEX_HOOKLOG_PLAIN", "")
+	t.Setenv("CODEX_HOOKLOG_SPLIT", "")
+	t.Setenv("CODEX_HOOKLOG_MAX_SIZE", "600")
+	log := filepath.Join(home, "hooks.jsonl")
+	for i := 0; i < 6; i++ {
+		if _, err := handle(context.Background(), hooktest.SessionStart().WithSessionID("s1").Build()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := jsonl.Files(log)
+	if len(files) < 2 {
+		t.Fatalf("files = %q, want the log rotated", files)
+	}
+	for _, file := range files {
+		f, err := jsonl.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dec jsonl.Decoder
+		events := 0
+		err = jsonl.ScanRecords(f, func(rec []byte) error {
+			ev, err := dec.Decode(rec)
+			if err != nil {
+				return err
+			}
+			if _, ok := dec.Meta(); !ok {
+				t.Errorf("%s: record %s before the header", file, rec)
+			}
+			if ev.Payload != nil {
+				events++
+				if ev.Payload["session_id"] != "s1" || ev.TS == "" {
+					t.Errorf("%s: event %v at %q, want the unwrapped payload", file, ev.Payload, ev.TS)
+				}
+			}
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m, _ := dec.Meta(); m.Format != jsonl.MetaFormatWrapped || m.SDK != hooksdk.SDKVersion || m.Host != hooksdk.Meta().Host || events == 0 {
+			t.Errorf("%s: header %+v, %d events", file, m, events)
+		}
+	}
+
+	// Plain payloads are declared as such.
+	t.Setenv("CODEX_HOOKLOG_PLAIN", "1")
+	t.Setenv("CODEX_HOOKLOG_MAX_SIZE", "")
+	if m, ok := jsonl.ParseMeta(header(jsonl.FormatJSONL)); !ok || m.Format != jsonl.MetaFormatPlain {
+		t.Errorf("plain header = %+v, %v", m, ok)
+	}
+}
+
+func TestLogMigratesLegacy(t *testing.T) {
+	for _, headers := range []string{"", "0"} {
+		home := t.TempDir()
+		t.Setenv("CODEX_HOME", home)
+		t.Setenv("CODEX_HOOKLOG_HEADER", headers)
+		t.Setenv("CODEX_HOOKLOG_SPLIT", "")
+		t.Setenv("CODEX_HOOKLOG_MAX_SIZE", "")
+		log := filepath.Join(home, "hooks.jsonl")
+		old := []byte("{\"xcodex_event_type\":\"session-start\"}\n")
+		if err := os.WriteFile(log, old, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := handle(context.Background(), hooktest.SessionStart().Build()); err != nil {
+			t.Fatal(err)
+		}
+		// A log from before headers is moved aside when they are written, and appended to when not.
+		legacy, _ := os.ReadFile(log + ".legacy")
+		data, _ := os.ReadFile(log)
+		headed, _, _ := jsonl.StartsWithHeader(bytes.NewReader(data))
+		if headers == "" && (!bytes.Equal(legacy, old) || !headed) {
+			t.Errorf("headers on: legacy %q, log %q", legacy, data)
+		}
+		if headers == "0" && (legacy != nil || !bytes.HasPrefix(data, old)) {
+			t.Errorf("headers off: legacy %q, log %q", legacy, data)
+		}
+	}
+}
+
+func TestLogWithoutCodexHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("CODEX_HOME", "")
+	t.Setenv("CODEX_HOOKLOG_SPLIT", "")
+	if _, err := handle(context.Background(), hooktest.SessionStart().Build()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".xcodex", "hooks.jsonl")); err != nil {
+		t.Errorf("with CODEX_HOME empty, no log under ~/.xcodex: %v", err)
+	}
+}
+
+func TestLogWithoutHome(t *testing.T) {
+	// In a sandbox with neither CODEX_HOME nor HOME, the log goes to the temp dir, with a warning.
+	tmp := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = []string{"LOG_JSONL_TEST_MAIN=1", "TMPDIR=" + tmp, "CODEX_HOOK_LOG_FORMAT=json", "CODEX_HOOKLOG_HEADER=0"}
+	cmd.Stdin = bytes.NewReader(hooktest.SessionStart().Bytes())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if out, err := cmd.Output(); err != nil || !strings.Contains(string(out), `"allow"`) {
+		t.Fatalf("%v: %s\n%s", err, out, stderr.String())
+	}
+	matches, _ := filepath.Glob(filepath.Join(tmp, "xcodex*", "hooks.jsonl"))
+	if len(matches) != 1 {
+		t.Fatalf("logs in the temp dir: %q", matches)
+	}
+	var rec map[string]any
+	if err := json.Unmarshal(stderr.Bytes(), &rec); err != nil || rec["level"] != "warn" || rec["codex_home"] != filepath.Dir(matches[0]) {
+		t.Errorf("stderr = %s, want one warning naming %s", stderr.String(), filepath.Dir(matches[0]))
+	}
+}
+
+func TestLogFailsOpen(t *testing.T) {
+	// A payload that can't be read is reported, and the event allowed.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "LOG_JSONL_TEST_MAIN=1", "CODEX_HOME="+t.TempDir())
+	cmd.Stdin = strings.NewReader("not json")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v\n%s", err, stderr.String())
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out, &resp); err != nil || resp.Decision != hooksdk.DecisionAllow || resp.ReasonCode != hooksdk.ReasonHookError {
+		t.Errorf("response = %s, %v", out, err)
+	}
+	if !strings.Contains(stderr.String(), `"policy":"fail-open"`) {
+		t.Errorf("stderr = %s", stderr.String())
+	}
+}
+
+func TestLogFormats(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOKLOG_HEADER", "0")
+	t.Setenv("CODEX_HOOKLOG_PLAIN", "1")
+	t.Setenv("CODEX_HOOKLOG_SPLIT", "")
+	log := filepath.Join(home, "hooks.jsonl")
+
+	t.Setenv("CODEX_HOOKLOG_FORMAT", "pretty")
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := handle(context.Background(), hooktest.SessionStart().WithSessionID(id).Build()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := strings.Split(string(data), "---\n")
+	if len(chunks) != 3 || chunks[0] != "" {
+		t.Fatalf("pretty log = %q, want two records after separators", data)
+	}
+	for i, chunk := range chunks[1:] {
+		var v map[string]any
+		if err := json.Unmarshal([]byte(chunk), &v); err != nil || v["session_id"] != []string{"s1", "s2"}[i] {
+			t.Errorf("pretty record %d = %q: %v", i, chunk, err)
+		}
+		if !strings.Contains(chunk, "\n  \"session_id\": ") {
+			t.Errorf("pretty record %d isn't indented: %q", i, chunk)
+		}
+	}
+
+	if err := os.Remove(log); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOOKLOG_FORMAT", "compactkeys")
+	if _, err := handle(context.Background(), hooktest.ToolCallFinished().WithSessionID("s1").Build()); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	// Maps encode with sorted keys, so re-encoding the decoded line gives it back.
+	if want, _ := json.Marshal(v); string(data) != string(want)+"\n" {
+		t.Errorf("compactkeys line = %s, want %s", data, want)
+	}
+}
+
+func TestLogStats(t *testing.T) {
+	t.Setenv("CODEX_HOOKLOG_STATS", "1")
+	t.Setenv("CODEX_HOOKLOG_PLAIN", "1")
+	lines := logEvents(t, hooktest.SessionStart(), hooktest.ToolCallFinished(), hooktest.ToolCallFinished())
+	if len(lines) != 3 {
+		t.Fatalf("logged %d lines, want 3", len(lines))
+	}
+	stats, err := sizestats.New(filepath.Join(os.Getenv("CODEX_HOME"), "hooks", "stats.json")).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(os.Getenv("CODEX_HOME"), "hooks.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total uint64
+	for _, r := range stats.Rows() {
+		total += r.TotalBytes
+	}
+	// Each record's size is the line logged, newline included.
+	if len(stats.Events) != 2 || stats.Events["tool-call-finished"].Count != 2 || total != uint64(len(data)) {
+		t.Errorf("stats = %+v, total %d; want 2 types and the %d bytes logged", stats.Events, total, len(data))
+	}
+
+	t.Setenv("CODEX_HOOKLOG_STATS", "")
+	logEvents(t, hooktest.SessionStart())
+	if _, err := os.Stat(filepath.Join(os.Getenv("CODEX_HOME"), "hooks", "stats.json")); !os.IsNotExist(err) {
+		t.Errorf("stats recorded without CODEX_HOOKLOG_STATS: %v", err)
+	}
+}
+
+func TestLogGzipStream(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOKLOG_HEADER", "0")
+	t.Setenv("CODEX_HOOKLOG_PLAIN", "1")
+	t.Setenv("CODEX_HOOKLOG_SPLIT", "")
+	t.Setenv("CODEX_HOOKLOG_COMPRESS", "gzip")
+	for _, id := range []string{"s1", "s2"} {
+		if _, err := handle(context.Background(), hooktest.SessionStart().WithSessionID(id).Build()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, "hooks.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("hooks.jsonl was written uncompressed: %v", err)
+	}
+	f, err := os.Open(filepath.Join(home, "hooks.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for i, line := range lines {
+		var v map[string]any
+		if err := json.Unmarshal([]byte(line), &v); err != nil || v["session_id"] != []string{"s1", "s2"}[i] {
+			t.Errorf("line %d = %q: %v", i, line, err)
+		}
+	}
+	if len(lines) != 2 {
+		t.Errorf("hooks.jsonl.gz = %q, want two lines", data)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOKLOG_SPLIT", "session")
+	t.Setenv("CODEX_HOOKLOG_SPOOL_DIR", filepath.Join(home, "spool"))
+	t.Setenv("CODEX_HOOKLOG_FILTER", "")
+	report := func() (code int, out string) {
+		var buf strings.Builder
+		code = hooksdk.IO{Out: &buf, Err: io.Discard, Getenv: os.Getenv}.SelfTest(context.Background(), selfTest()...)
+		return code, buf.String()
+	}
+	if code, out := report(); code != hooksdk.ExitOK || !strings.Contains(out, "4 passed, 0 failed") {
+		t.Errorf("working environment: exit %d\n%s", code, out)
+	}
+
+	// The spool directory and the session logs' would be under a file, and the filter is junk.
+	blocker := filepath.Join(home, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOOKLOG_SPOOL_DIR", filepath.Join(blocker, "spool"))
+	if err := os.WriteFile(filepath.Join(home, "hooks"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOOKLOG_FILTER", "exit_code !=")
+	code, out := report()
+	for _, want := range []string{"FAIL  session log directory", "FAIL  spool directory", "FAIL  CODEX_HOOKLOG_FILTER is valid", "2 passed, 3 failed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("broken environment: no %q in\n%s", want, out)
+		}
+	}
+	if code != hooksdk.ExitError {
+		t.Errorf("broken environment: exit %d", code)
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	t.Cleanup(func() { filter = nil })
+	t.Setenv("CODEX_HOOKLOG_PLAIN", "1")
+	t.Setenv("CODEX_HOOKLOG_FILTER", `xcodex_event_type != "tool-call-finished" || !success || duration_ms > 10s || note > 1`)
+	var err error
+	if filter, err = compileFilter(); err != nil {
+		t.Fatal(err)
+	}
+	lines := logEvents(t,
+		hooktest.SessionStart().With("event_id", "start"),
+		hooktest.ToolCallFinished().With("event_id", "quick"),
+		hooktest.ToolCallFinished().With("event_id", "failed").With("success", false),
+		hooktest.ToolCallFinished().With("event_id", "slow").With("duration_ms", 20000),
+		// It can't be evaluated on this one, so it is logged.
+		hooktest.ToolCallFinished().With("event_id", "mistyped").With("note", "x"),
+	)
+	var ids []string
+	for _, line := range lines {
+		ids = append(ids, line["event_id"].(string))
+	}
+	if want := []string{"start", "failed", "slow", "mistyped"}; strings.Join(ids, ",") != strings.Join(want, ",") {
+		t.Errorf("logged %q, want %q", ids, want)
+	}
+
+	// Unset, or blank, the filter logs everything; a broken one is reported when compiled.
+	for _, src := range []string{"", "  "} {
+		t.Setenv("CODEX_HOOKLOG_FILTER", src)
+		if expr, err := compileFilter(); expr != nil || err != nil {
+			t.Errorf("filter %q = %v, %v; want none", src, expr, err)
+		}
+	}
+	t.Setenv("CODEX_HOOKLOG_FILTER", "duration_ms > 10x")
+	if _, err := compileFilter(); err == nil || !strings.Contains(err.Error(), "column 15") {
+		t.Errorf("broken filter: error = %v", err)
+	}
+}
+
+func TestLogInvalidUTF8(t *testing.T) {
+	// The raw bytes of a binary diff survive into the log.
+	home := t.TempDir()
+	payload := hooktest.ToolCallFinished().With("output_preview", "OUTPUT").Bytes()
+	payload = bytes.Replace(payload, []byte(`"OUTPUT"`), []byte("\"GIF89a\xff\xd8\\u0000\""), 1)
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "LOG_JSONL_TEST_MAIN=1", "CODEX_HOME="+home, "CODEX_HOOKLOG_HEADER=0",
+		"CODEX_HOOKLOG_PLAIN=1", "CODEX_HOOKLOG_SPLIT=", "CODEX_HOOKLOG_FORMAT=", "CODEX_HOOKLOG_FILTER=")
+	cmd.Stdin = bytes.NewReader(payload)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	data, err := os.ReadFile(filepath.Join(home, "hooks.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(data, &line); err != nil {
+		t.Fatalf("line %q: %v", data, err)
+	}
+	got, err := base64.StdEncoding.DecodeString(fmt.Sprint(line["output_preview__base64"]))
+	if err != nil || string(got) != "GIF89a\xff\xd8\x00" {
+		t.Errorf("logged copy = %q, %v; line %s", got, err, data)
+	}
+	if line["output_preview"] != "GIF89a\ufffd\ufffd\x00" {
+		t.Errorf("output_preview = %q", line["output_preview"])
+	}
+}
+
+func TestLogSkipsExcludedEvents(t *testing.T) {
+	// An excluded event exits before the log is opened: CODEX_HOME's log file never appears.
+	home := t.TempDir()
+	run := func(payload []byte) string {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "LOG_JSONL_TEST_MAIN=1", "CODEX_HOME="+home, "CODEX_HOOKLOG_HEADER=0",
+			"CODEX_HOOKLOG_PLAIN=1", "CODEX_HOOKLOG_SPLIT=", "CODEX_HOOKLOG_FORMAT=", "CODEX_HOOKLOG_FILTER=",
+			"CODEX_HOOKLOG_INCLUDE=session-*", "CODEX_HOOKLOG_EXCLUDE=session-end")
+		cmd.Stdin = bytes.NewReader(payload)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		return string(out)
+	}
+	for _, b := range []*hooktest.Builder{hooktest.ToolCallFinished().With("session_id", 7), hooktest.SessionEnd()} {
+		if out := run(b.Bytes()); !strings.Contains(out, `"allow"`) {
+			t.Errorf("excluded event: %s", out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, "hooks.jsonl")); !os.IsNotExist(err) {
+		t.Fatalf("log written for excluded events: %v", err)
+	}
+	run(hooktest.SessionStart().Bytes())
+	data, err := os.ReadFile(filepath.Join(home, "hooks.jsonl"))
+	if err != nil || strings.Count(string(data), "\n") != 1 || !strings.Contains(string(data), "session-start") {
+		t.Errorf("log = %q, %v; want the session-start event", data, err)
+	}
+}
+
+func TestLogInvocationID(t *testing.T) {
+	// The wrapped line carries the invocation id the response does.
+	home := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "LOG_JSONL_TEST_MAIN=1", "CODEX_HOME="+home, "CODEX_HOOKLOG_HEADER=0",
+		"CODEX_HOOKLOG_PLAIN=", "CODEX_HOOKLOG_SPLIT=", "CODEX_HOOKLOG_FORMAT=", "CODEX_HOOKLOG_FILTER=",
+		"CODEX_HOOKLOG_INCLUDE=", "CODEX_HOOKLOG_EXCLUDE=")
+	cmd.Stdin = bytes.NewReader(hooktest.SessionStart().Bytes())
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out, &resp); err != nil || resp.Metadata == nil || resp.Metadata.InvocationID == "" {
+		t.Fatalf("response %s: %v", out, err)
+	}
+	data, err := os.ReadFile(filepath.Join(home, "hooks.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(data, &line); err != nil {
+		t.Fatalf("line %q: %v", data, err)
+	}
+	if line["hook_invocation_id"] != resp.Metadata.InvocationID {
+		t.Errorf("logged id = %v, response id %s", line["hook_invocation_id"], resp.Metadata.InvocationID)
+	}
+}
+
+func TestLogCoalesce(t *testing.T) {
+	t.Setenv("CODEX_HOOKLOG_PLAIN", "1")
+	t.Setenv("CODEX_HOOKLOG_COALESCE", "1")
+	t.Setenv("CODEX_HOOKLOG_COALESCE_EVENT", "")
+	t.Setenv("CODEX_HOOKLOG_COALESCE_TTL", "")
+	t.Setenv("CODEX_HOOKLOG_MAX_FIELD_BYTES", "16")
+	chunk := func(seq int, text string) *hooktest.Builder {
+		return hooktest.New("tool-call-output-chunk", "").With("tool_use_id", "call-1").With("seq", seq).With("chunk", text)
+	}
+	lines := logEvents(t,
+		chunk(1, "world, and then some\n"), chunk(0, "hello "),
+		hooktest.SessionStart(),
+		hooktest.ToolCallFinished(),
+	)
+	// The chunks aren't logged; the finished event carries their text, truncated like the rest.
+	if len(lines) != 2 || lines[0]["xcodex_event_type"] != "session-start" {
+		t.Fatalf("logged %v", lines)
+	}
+	c, _ := lines[1][coalesce.Field].(map[string]any)
+	output, _ := c["output"].(string)
+	if !strings.HasPrefix(output, "hello world, and…[truncated ") || c["chunks"] != 2.0 || c["bytes"] != 27.0 {
+		t.Errorf("coalesced = %v", c)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/filterexpr"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/sink"
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+// Sink types.
+const (
+	sinkJSONL   = "jsonl"   // appends to a log file, as cmd/log_jsonl does
+	sinkWebhook = "webhook" // POSTs to a URL, as cmd/forward_webhook does
+	sinkSocket  = "socket"  // sends to a unix socket, buffering while the collector is slow
+)
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response. Like the single-sink
+	// templates this hook always allows the event; sink failures are reported on stderr.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `log_multi --self-test`, that the config loads and each sink can be
+// reached.
+func selfTest() []hooksdk.Check {
+	var cfg config
+	err := hooksdk.LoadConfig("log_multi", &cfg)
+	checks := []hooksdk.Check{hooksdk.CheckConfig("log_multi", err)}
+	if err != nil {
+		return checks
+	}
+	for _, s := range cfg.Sink {
+		switch s.Type {
+		case sinkJSONL:
+			checks = append(checks, hooksdk.CheckWritable(s.Name, s.Path))
+		case sinkWebhook:
+			checks = append(checks, hooksdk.CheckHTTP(s.Name, s.URL))
+		case sinkSocket:
+			network := "unixgram"
+			if s.Stream {
+				network = "unix"
+			}
+			checks = append(checks, hooksdk.CheckDial(s.Name, network, s.Path))
+		}
+	}
+	return checks
+}
+
+// config is read from `$CODEX_HOME/hooks/config/log_multi.toml`; CODEX_HOOK_LOG_MULTI_TIMEOUT
+// and CODEX_HOOK_LOG_MULTI_GRACE override the timeout and the grace period.
+type config struct {
+	// Timeout bounds writing an event to all the sinks, webhook retries included.
+	Timeout time.Duration `toml:"timeout" default:"5s"`
+	// Grace is how long the sinks still writing when the timeout runs out or the host stops the
+	// hook get to finish the event (see sink.Tee.Grace).
+	Grace time.Duration `toml:"grace" default:"500ms"`
+	// Sink holds the `[[sink]]` tables, each event's destinations.
+	Sink []sinkConfig `toml:"sink"`
+}
+
+// sinkConfig is a `[[sink]]` table.
+type sinkConfig struct {
+	Type string `toml:"type"`
+	// Name identifies the sink in errors; it defaults to the type, with the sink's index when
+	// several have that type.
+	Name string `toml:"name"`
+	// Path is the log file of a jsonl sink (default `$CODEX_HOME/hooks.jsonl`) or the socket of a
+	// socket sink.
+	Path string `toml:"path"`
+	// Stream, Buffer, and Overflow set up a socket sink (see sink.Socket): a stream socket with
+	// length-prefixed events instead of a datagram socket, the events held while the collector is
+	// slow (default 64), and what to do with the ones that don't fit: `drop-oldest` (the default),
+	// `spool` to `$CODEX_HOME/hooks/outbox/socket` for the next event to send, or `block`.
+	Stream   bool   `toml:"stream"`
+	Buffer   int    `toml:"buffer"`
+	Overflow string `toml:"overflow"`
+	// Plain logs bare payloads instead of wrapped records in a jsonl sink.
+	Plain bool `toml:"plain"`
+	// URL and Secret are a webhook sink's endpoint and signing secret.
+	URL    string `toml:"url"`
+	Secret string `toml:"secret"`
+	// Filter is a filterexpr expression; only the events it matches reach the sink.
+	Filter string `toml:"filter"`
+
+	expr     *filterexpr.Expr
+	overflow sink.Overflow
+}
+
+func (c *config) Validate() error {
+	types := map[string]int{}
+	for _, s := range c.Sink {
+		types[s.Type]++
+	}
+	for i := range c.Sink {
+		s := &c.Sink[i]
+		switch s.Type {
+		case sinkJSONL:
+			if s.Path == "" {
+				s.Path = filepath.Join(hooksdk.Environ().CodexHome, "hooks.jsonl")
+			}
+		case sinkWebhook:
+			if s.URL == "" {
+				return fmt.Errorf("sink[%d]: a webhook sink needs a url", i)
+			}
+		case sinkSocket:
+			if s.Path == "" {
+				return fmt.Errorf("sink[%d]: a socket sink needs a path", i)
+			}
+			if s.overflow = sink.OverflowDropOldest; s.Overflow != "" {
+				overflow, err := sink.ParseOverflow(s.Overflow)
+				if err != nil {
+					return fmt.Errorf("sink[%d]: %w", i, err)
+				}
+				s.overflow = overflow
+			}
+		default:
+			return fmt.Errorf("sink[%d]: type must be %s, %s, or %s, not %q", i, sinkJSONL, sinkWebhook, sinkSocket, s.Type)
+		}
+		if s.Name == "" {
+			s.Name = s.Type
+			if types[s.Type] > 1 {
+				s.Name = fmt.Sprintf("%s[%d]", s.Type, i)
+			}
+		}
+		if s.Filter != "" {
+			expr, err := filterexpr.Compile(s.Filter)
+			if err != nil {
+				return fmt.Errorf("sink[%d]: filter: %w", i, err)
+			}
+			s.expr = expr
+		}
+	}
+	return nil
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	var cfg config
+	if err := hooksdk.LoadConfig("log_multi", &cfg); err != nil {
+		hooklog.Errorf("load config: %v; event not logged", err)
+		return hooksdk.Allow(), nil
+	}
+	if len(cfg.Sink) == 0 {
+		hooklog.Warnf("no [[sink]] tables in %s; event not logged", hooksdk.ConfigPath("log_multi"))
+		return hooksdk.Allow(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	tee, sockets := newTee(&cfg)
+	for _, err := range tee.WriteEach(ctx, hooksdk.HookPayloadJSON(payload.RawPayload)) {
+		if errors.Is(err, context.DeadlineExceeded) {
+			hooklog.Errorf("%v (timeout %v)", err, cfg.Timeout)
+		} else if err != nil {
+			hooklog.Errorf("%v", err)
+		}
+	}
+	// Socket sinks send in the background; wait for them, within the timeout.
+	for name, s := range sockets {
+		if err := s.Close(ctx); err != nil {
+			hooklog.Errorf("sink %s: %v", name, err)
+		}
+	}
+	return hooksdk.Allow(), nil
+}
+
+// newTee builds the sinks of cfg, returning its socket sinks by name as well, for the caller to
+// close.
+func newTee(cfg *config) (*sink.Tee, map[string]*sink.Socket) {
+	tee := sink.Tee{Grace: cfg.Grace}
+	sockets := map[string]*sink.Socket{}
+	for _, s := range cfg.Sink {
+		name := s.Name
+		var out sink.Sink
+		switch s.Type {
+		case sinkJSONL:
+			out = &sink.JSONL{W: jsonl.New(s.Path, jsonl.OptionsFromEnv()), Plain: s.Plain}
+		case sinkWebhook:
+			out = &sink.Webhook{Client: &webhook.Client{
+				URL:      s.URL,
+				Secret:   []byte(s.Secret),
+				Deadline: cfg.Timeout,
+				OnRetry: func(attempt int, err error, wait time.Duration) {
+					hooklog.Debugf("sink %s: attempt %d failed: %v; retrying in %v", name, attempt, err, wait.Round(time.Millisecond))
+				},
+			}}
+		case sinkSocket:
+			socket := &sink.Socket{Path: s.Path, Stream: s.Stream, Buffer: s.Buffer, Budget: cfg.Timeout, Overflow: s.overflow}
+			sockets[name] = socket
+			out = socket
+		}
+		tee.Add(name, sink.Filter(out, s.expr))
+	}
+	return &tee, sockets
+}
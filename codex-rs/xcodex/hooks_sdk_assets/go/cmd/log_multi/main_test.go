@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/sink"
+)
+
+// TestMain lets TestInterrupted run the hook in a process of its own: with LOG_MULTI_TEST_MAIN
+// set, this binary is log_multi.
+func TestMain(m *testing.M) {
+	if os.Getenv("LOG_MULTI_TEST_MAIN") != "" {
+		main()
+	}
+	os.Exit(m.Run())
+}
+
+// writeConfig makes a CODEX_HOME with log_multi.toml holding toml, and returns it.
+func writeConfig(t *testing.T, toml string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOK_LOG_MULTI_TIMEOUT", "")
+	t.Setenv("CODEX_HOOK_LOG_MULTI_GRACE", "")
+	path := hooksdk.ConfigPath("log_multi")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(toml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return home
+}
+
+// lines returns the event ids logged at path, from bare or wrapped records.
+func lines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var v map[string]any
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if event, ok := v["event"].(map[string]any); ok {
+			v = event
+		}
+		ids = append(ids, v["event_id"].(string))
+	}
+	return ids
+}
+
+func TestHandleTees(t *testing.T) {
+	t.Setenv("CODEX_HOOKLOG_HEADER", "0")
+	got := make(chan string, 8)
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var v map[string]any
+		json.Unmarshal(body, &v)
+		got <- r.Header.Get("X-Hook-Event-Id") + "=" + v["event_id"].(string)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusBadRequest)
+	}))
+	defer down.Close()
+
+	dir := t.TempDir()
+	home := writeConfig(t, `
+timeout = "5s"
+
+[[sink]]
+type = "jsonl"
+
+[[sink]]
+type = "jsonl"
+path = "`+filepath.Join(dir, "failures.jsonl")+`"
+plain = true
+filter = '!success'
+
+[[sink]]
+type = "webhook"
+url = "`+down.URL+`"
+
+[[sink]]
+type = "webhook"
+url = "`+up.URL+`"
+`)
+	for _, b := range []*hooktest.Builder{
+		hooktest.SessionStart().With("event_id", "start"),
+		hooktest.ToolCallFinished().With("event_id", "ok"),
+		hooktest.ToolCallFinished().With("event_id", "failed").With("success", false),
+	} {
+		// The broken webhook is reported, but the event is allowed and reaches the other sinks.
+		resp, err := handle(context.Background(), b.Build())
+		if err != nil || resp.Decision != hooksdk.DecisionAllow {
+			t.Fatalf("handle = %+v, %v; want allow", resp, err)
+		}
+	}
+
+	if ids := lines(t, filepath.Join(home, "hooks.jsonl")); strings.Join(ids, ",") != "start,ok,failed" {
+		t.Errorf("hooks.jsonl has %q", ids)
+	}
+	// The filter's sink takes the events it matches; an event without the field is null, so !success holds.
+	if ids := lines(t, filepath.Join(dir, "failures.jsonl")); strings.Join(ids, ",") != "start,failed" {
+		t.Errorf("failures.jsonl has %q", ids)
+	}
+	close(got)
+	var sent []string
+	for s := range got {
+		sent = append(sent, s)
+	}
+	if strings.Join(sent, ",") != "start=start,ok=ok,failed=failed" {
+		t.Errorf("webhook got %q", sent)
+	}
+}
+
+// TestInterrupted sends the hook SIGTERM while a webhook holds up the event, and checks that it
+// exits as usual once the grace period is over, with the event and a marker naming the webhook in
+// the log.
+func TestInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs SIGTERM")
+	}
+	t.Setenv("CODEX_HOOKLOG_HEADER", "0")
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer stalled.Close()
+	defer close(release)
+	home := writeConfig(t, `
+timeout = "1m"
+grace = "200ms"
+
+[[sink]]
+type = "jsonl"
+
+[[sink]]
+type = "webhook"
+url = "`+stalled.URL+`"
+`)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "LOG_MULTI_TEST_MAIN=1")
+	cmd.Stdin = bytes.NewReader(hooktest.ToolCallFinished().With("event_id", "cut-short").WithSessionID("s1").Bytes())
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-received:
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		t.Fatalf("the webhook got nothing: %s", stderr.String())
+	}
+	// The file sink is quick, but it writes alongside the webhook: wait for it.
+	log := filepath.Join(home, "hooks.jsonl")
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(log); err == nil || time.Now().After(deadline) {
+			break
+		}
+	}
+	start := time.Now()
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("log_multi: %v\n%s", err, stderr.String())
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("exited %v after SIGTERM, want after the grace period", elapsed)
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("response %q: %v", stdout.String(), err)
+	}
+
+	if ids := lines(t, log); strings.Join(ids, ",") != "cut-short,cut-short" {
+		t.Fatalf("hooks.jsonl has %q", ids)
+	}
+	data, _ := os.ReadFile(log)
+	var marker struct {
+		Event map[string]any `json:"event"`
+	}
+	json.Unmarshal([]byte(strings.Split(strings.TrimSpace(string(data)), "\n")[1]), &marker)
+	m := marker.Event
+	if m["type"] != "hook_interrupted" || m["session_id"] != "s1" || m["event_type"] != "tool-call-finished" ||
+		!reflect.DeepEqual(m["delivered"], []any{"jsonl"}) || !reflect.DeepEqual(m["missed"], []any{"webhook"}) || m["reason"] == nil {
+		t.Errorf("marker = %v", m)
+	}
+	if !strings.Contains(stderr.String(), "sink webhook") {
+		t.Errorf("the missed webhook isn't reported: %s", stderr.String())
+	}
+}
+
+func TestHandleWithoutSinks(t *testing.T) {
+	home := writeConfig(t, `timeout = "1s"`)
+	if resp, err := handle(context.Background(), hooktest.SessionStart().Build()); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("handle = %+v, %v; want allow", resp, err)
+	}
+	writeConfig(t, "[[sink]]\ntype = \"ftp\"\n")
+	if resp, err := handle(context.Background(), hooktest.SessionStart().Build()); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("handle with a bad config = %+v, %v; want allow", resp, err)
+	}
+	if _, err := os.Stat(filepath.Join(home, "hooks.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("logged without sinks: %v", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	home := writeConfig(t, `
+[[sink]]
+type = "jsonl"
+
+[[sink]]
+type = "jsonl"
+path = "/tmp/other.jsonl"
+
+[[sink]]
+type = "webhook"
+url = "https://example.invalid"
+name = "team"
+filter = 'exit_code != 0'
+`)
+	var cfg config
+	if err := hooksdk.LoadConfig("log_multi", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Timeout.String() != "5s" || cfg.Grace.String() != "500ms" || len(cfg.Sink) != 3 {
+		t.Fatalf("config = %+v", cfg)
+	}
+	// Repeated types are named with their index.
+	for i, want := range []string{"jsonl[0]", "jsonl[1]", "team"} {
+		if cfg.Sink[i].Name != want {
+			t.Errorf("sink[%d] name = %q, want %q", i, cfg.Sink[i].Name, want)
+		}
+	}
+	if cfg.Sink[0].Path != filepath.Join(home, "hooks.jsonl") || cfg.Sink[2].expr == nil || cfg.Sink[0].expr != nil {
+		t.Errorf("sinks = %+v", cfg.Sink)
+	}
+	t.Setenv("CODEX_HOOK_LOG_MULTI_TIMEOUT", "2s")
+	t.Setenv("CODEX_HOOK_LOG_MULTI_GRACE", "50ms")
+	if err := hooksdk.LoadConfig("log_multi", &cfg); err != nil || cfg.Timeout.String() != "2s" || cfg.Grace.String() != "50ms" {
+		t.Errorf("timeout and grace from the environment = %v, %v, %v", cfg.Timeout, cfg.Grace, err)
+	}
+	if tee, _ := newTee(&cfg); tee.Grace != 50*time.Millisecond {
+		t.Errorf("tee grace = %v", tee.Grace)
+	}
+
+	for toml, want := range map[string]string{
+		"[[sink]]\ntype = \"webhook\"\n":                                        "sink[0]: a webhook sink needs a url",
+		"[[sink]]\ntype = \"jsonl\"\n[[sink]]\ntype = \"socket\"\n":             "sink[1]: a socket sink needs a path",
+		"[[sink]]\ntype = \"ftp\"\n":                                            `sink[0]: type must be jsonl, webhook, or socket, not "ftp"`,
+		"[[sink]]\ntype = \"jsonl\"\nfilter = \"exit_code =! 0\"\n":             "sink[0]: filter: filterexpr: column 11",
+		"[[sink]]\ntype = \"socket\"\npath = \"c.sock\"\noverflow = \"drop\"\n": `sink[0]: overflow must be drop-oldest, spool, or block, not "drop"`,
+	} {
+		writeConfig(t, toml)
+		var cfg config
+		if err := hooksdk.LoadConfig("log_multi", &cfg); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: error = %v, want %q", toml, err, want)
+		}
+	}
+}
+
+func TestSocketConfig(t *testing.T) {
+	// A socket sink drops the oldest events by default, and is handed back for its stats.
+	writeConfig(t, "[[sink]]\ntype = \"socket\"\npath = \"a.sock\"\n[[sink]]\ntype = \"socket\"\npath = \"b.sock\"\nstream = true\nbuffer = 8\noverflow = \"block\"\n")
+	var cfg config
+	if err := hooksdk.LoadConfig("log_multi", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	_, sockets := newTee(&cfg)
+	a, b := sockets["socket[0]"], sockets["socket[1]"]
+	if len(sockets) != 2 || a == nil || b == nil {
+		t.Fatalf("sockets = %v", sockets)
+	}
+	if a.Path != "a.sock" || a.Stream || a.Overflow != sink.OverflowDropOldest || a.Budget != cfg.Timeout {
+		t.Errorf("socket[0] = %+v", a)
+	}
+	if b.Path != "b.sock" || !b.Stream || b.Buffer != 8 || b.Overflow != sink.OverflowBlock {
+		t.Errorf("socket[1] = %+v", b)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	writeConfig(t, "[[sink]]\ntype = \"jsonl\"\n[[sink]]\ntype = \"webhook\"\nurl = \""+srv.URL+"\"\n")
+	report := func() (int, string) {
+		var out strings.Builder
+		code := hooksdk.IO{Out: &out, Err: io.Discard, Getenv: os.Getenv}.SelfTest(context.Background(), selfTest()...)
+		return code, out.String()
+	}
+	if code, out := report(); code != hooksdk.ExitOK || !strings.Contains(out, "4 passed, 0 failed") {
+		t.Errorf("working sinks: exit %d\n%s", code, out)
+	}
+
+	srv.Close()
+	writeConfig(t, "[[sink]]\ntype = \"webhook\"\nurl = \""+srv.URL+"\"\n")
+	if code, out := report(); code != hooksdk.ExitError || !strings.Contains(out, "FAIL  webhook") {
+		t.Errorf("unreachable webhook: exit %d\n%s", code, out)
+	}
+	writeConfig(t, "[[sink]]\ntype = \"ftp\"\n")
+	if code, out := report(); code != hooksdk.ExitError || !strings.Contains(out, "1 passed, 1 failed") {
+		t.Errorf("bad config: exit %d\n%s", code, out)
+	}
+}
@@ -0,0 +1,23 @@
+module example.com/xcodex/hooks-sdk/cmd/log_sqlite
+
+go 1.21
+
+require (
+	example.com/xcodex/hooks-sdk v0.0.0
+	modernc.org/sqlite v1.35.0
+)
+
+require (
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/ncruces/go-strftime v0.1.9 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/exp v0.0.0-20230315142452-642cacee5cc0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	modernc.org/libc v1.61.13 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.8.2 // indirect
+)
+
+replace example.com/xcodex/hooks-sdk => ../..
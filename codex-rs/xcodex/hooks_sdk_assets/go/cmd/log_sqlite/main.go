@@ -0,0 +1,151 @@
+// Command log_sqlite records every event in a SQLite database, for questions JSONL is bad at
+// ("how many tool calls failed per session last week").
+//
+// It is its own Go module because it needs a SQLite driver (modernc.org/sqlite, pure Go, so no
+// cgo toolchain is needed); the other templates keep building offline with the standard library
+// only. Build it from this directory:
+//
+//	go build -o hook-log-sqlite .
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+
+	_ "modernc.org/sqlite"
+)
+
+// schema is created on first use. `id` is the event id, so a replayed event is stored once;
+// `received_at` is RFC 3339 UTC and sorts chronologically as text.
+const schema = `
+CREATE TABLE IF NOT EXISTS events (
+	id          TEXT PRIMARY KEY,
+	received_at TEXT NOT NULL,
+	event_type  TEXT NOT NULL,
+	session_id  TEXT,
+	cwd         TEXT,
+	payload     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_event_type ON events (event_type, received_at);
+CREATE INDEX IF NOT EXISTS events_session_id ON events (session_id, received_at);
+`
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `log_sqlite --self-test`, that the database can be created and opened.
+func selfTest() []hooksdk.Check {
+	path := dbPath()
+	return []hooksdk.Check{
+		hooksdk.CheckWritable("database", path),
+		{
+			Name: "database " + path + " opens",
+			Run: func(ctx context.Context, env hooksdk.Env) error {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					return err
+				}
+				db, err := open(path)
+				if err != nil {
+					return err
+				}
+				defer db.Close()
+				_, err = db.ExecContext(ctx, schema)
+				return err
+			},
+		},
+	}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	path := dbPath()
+	if err := insert(ctx, path, payload); err != nil {
+		hooklog.Errorf("record event in %s: %v", path, err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+// dbPath is CODEX_HOOKLOG_DB, or `$CODEX_HOME/hooks/hooks.db`.
+func dbPath() string {
+	if p := os.Getenv("CODEX_HOOKLOG_DB"); p != "" {
+		return p
+	}
+	return hooksdk.Environ().Path("hooks", "hooks.db")
+}
+
+func insert(ctx context.Context, path string, payload *hooksdk.HookPayload) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	db, err := open(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(payload.RawPayload)
+	if err != nil {
+		return err
+	}
+	id := payload.EventId
+	if id == "" {
+		id = randomID()
+	}
+	_, err = db.ExecContext(ctx,
+		`INSERT OR IGNORE INTO events (id, received_at, event_type, session_id, cwd, payload) VALUES (?, ?, ?, ?, ?, ?)`,
+		id,
+		time.Now().UTC().Format(time.RFC3339Nano),
+		payload.EventType(),
+		nullable(payload.SessionID()),
+		nullable(payload.WorkingDir()),
+		string(raw),
+	)
+	return err
+}
+
+// open opens the database in WAL mode with a busy timeout, so concurrent hook processes wait for
+// each other's writes instead of failing with SQLITE_BUSY.
+func open(path string) (*sql.DB, error) {
+	q := url.Values{}
+	q.Add("_pragma", "busy_timeout(10000)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "synchronous(NORMAL)")
+	q.Add("_txlock", "immediate")
+	db, err := sql.Open("sqlite", "file:"+filepath.ToSlash(path)+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	// One connection is plenty for a single insert, and keeps the pragmas on every statement.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func randomID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// TestMain lets the tests run this binary as a hook process: with LOG_SQLITE_TEST_SESSION set, it
+// records LOG_SQLITE_TEST_COUNT tool calls of that session in CODEX_HOOKLOG_DB.
+func TestMain(m *testing.M) {
+	if session := os.Getenv("LOG_SQLITE_TEST_SESSION"); session != "" {
+		var n int
+		fmt.Sscan(os.Getenv("LOG_SQLITE_TEST_COUNT"), &n)
+		if err := insertCalls(dbPath(), session, n); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func insertCalls(path, session string, n int) error {
+	for i := 0; i < n; i++ {
+		p := hooktest.ToolCallFinished().WithSessionID(session).With("event_id", fmt.Sprintf("%s-%d", session, i)).Build()
+		if err := insert(context.Background(), path, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// count returns the number of events matching where.
+func count(t *testing.T, path, where string, args ...any) int {
+	t.Helper()
+	db, err := open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT count(*) FROM events WHERE "+where, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestInsertAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks", "hooks.db")
+	ctx := context.Background()
+	events := []*hooktest.Builder{
+		hooktest.SessionStart().WithSessionID("s1").WithCwd("/work/a"),
+		hooktest.ToolCallStarted().WithSessionID("s1"),
+		hooktest.ToolCallFinished().WithSessionID("s1"),
+		hooktest.ToolCallFinished().WithSessionID("s2").With("event_id", "e-s2"),
+		// Stored once, though delivered twice.
+		hooktest.ToolCallFinished().WithSessionID("s2").With("event_id", "e-s2"),
+		hooktest.SessionStart().With("session_id", nil).With("event_id", nil),
+	}
+	for i, b := range events {
+		if i < 3 {
+			b = b.With("event_id", fmt.Sprintf("e-s1-%d", i))
+		}
+		if err := insert(ctx, path, b.Build()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	finished := hooktest.ToolCallFinished().Build().EventType()
+	if n := count(t, path, "event_type = ?", finished); n != 2 {
+		t.Errorf("%d %s events, want 2", n, finished)
+	}
+	if n := count(t, path, "session_id = ?", "s1"); n != 3 {
+		t.Errorf("%d events in session s1, want 3", n)
+	}
+	if n := count(t, path, "session_id IS NULL"); n != 1 {
+		t.Errorf("%d events without a session, want 1", n)
+	}
+	if n := count(t, path, "cwd = ?", "/work/a"); n != 1 {
+		t.Errorf("%d events in /work/a, want 1", n)
+	}
+
+	db, err := open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var raw, receivedAt string
+	if err := db.QueryRow(`SELECT payload, received_at FROM events WHERE id = 'e-s2'`).Scan(&raw, &receivedAt); err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil || payload["session_id"] != "s2" {
+		t.Errorf("payload = %s, want the raw event", raw)
+	}
+	var mode string
+	if err := db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("journal_mode = %q, %v; want wal", mode, err)
+	}
+}
+
+func TestConcurrentInserts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.db")
+	t.Setenv("CODEX_HOOKLOG_DB", path)
+	const n = 10
+
+	// Hook processes and goroutines at once, as parallel tool calls and sessions do.
+	var cmds []*exec.Cmd
+	for _, session := range []string{"p1", "p2", "p3"} {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "LOG_SQLITE_TEST_SESSION="+session, fmt.Sprintf("LOG_SQLITE_TEST_COUNT=%d", n))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	var wg sync.WaitGroup
+	for _, session := range []string{"g1", "g2", "g3"} {
+		wg.Add(1)
+		go func(session string) {
+			defer wg.Done()
+			if err := insertCalls(path, session, n); err != nil {
+				t.Error(err)
+			}
+		}(session)
+	}
+	wg.Wait()
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, session := range []string{"p1", "p2", "p3", "g1", "g2", "g3"} {
+		if got := count(t, path, "session_id = ?", session); got != n {
+			t.Errorf("session %s: %d events, want %d", session, got, n)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/syslog"
+)
+
+// sdID names the structured-data element carrying the event fields. 32473 is the enterprise
+// number RFC 5612 reserves for examples; use your organization's if your pipeline checks it.
+const sdID = "xcodex@32473"
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `log_syslog --self-test`, that CODEX_HOOK_SYSLOG_ADDR (or the local log)
+// accepts a connection. Nothing is sent.
+func selfTest() []hooksdk.Check {
+	addr := os.Getenv("CODEX_HOOK_SYSLOG_ADDR")
+	name := "local syslog is reachable"
+	if addr != "" {
+		name = "syslog " + addr + " is reachable"
+	}
+	return []hooksdk.Check{{
+		Name: name,
+		Run: func(context.Context, hooksdk.Env) error {
+			w, err := syslog.Dial(addr)
+			if err != nil {
+				return err
+			}
+			return w.Close()
+		},
+	}}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	// CODEX_HOOK_SYSLOG_FACILITY picks the facility (default `user`).
+	facility := syslog.User
+	if v := os.Getenv("CODEX_HOOK_SYSLOG_FACILITY"); v != "" {
+		f, err := syslog.ParseFacility(v)
+		if err != nil {
+			hooklog.Warnf("ignoring CODEX_HOOK_SYSLOG_FACILITY: %v", err)
+		} else {
+			facility = f
+		}
+	}
+
+	// CODEX_HOOK_SYSLOG_ADDR sends RFC 5424 messages to a collector (`udp://host:514`,
+	// `tcp://host:514`, `unix:///dev/log`, or `journald`). Unset, events go to the systemd journal
+	// when it is running and to the local syslog daemon otherwise.
+	addr := os.Getenv("CODEX_HOOK_SYSLOG_ADDR")
+	w, err := syslog.Dial(addr)
+	if err != nil {
+		hooklog.Errorf("connect to syslog: %v", err)
+		return hooksdk.Allow(), nil
+	}
+	defer w.Close()
+
+	msg := &syslog.Message{
+		Facility: facility,
+		Severity: severity(payload),
+		AppName:  "xcodex",
+		MsgID:    payload.EventType(),
+		Data:     []syslog.Element{{ID: sdID, Params: params(payload)}},
+		Text:     summary(payload),
+	}
+	if err := w.Send(msg); err != nil {
+		hooklog.Errorf("send event to syslog: %v", err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+// severity maps events to priorities: tool executions and approval requests are notices, failed
+// or aborted tool calls are warnings, and everything else is informational.
+func severity(p *hooksdk.HookPayload) syslog.Severity {
+	switch p.EventType() {
+	case "tool-call-finished":
+		if (p.Success != nil && !*p.Success) || (p.Status != nil && *p.Status != "completed") {
+			return syslog.Warning
+		}
+		return syslog.Notice
+	case "tool-call-started", "approval-requested":
+		return syslog.Notice
+	}
+	return syslog.Info
+}
+
+func params(p *hooksdk.HookPayload) []syslog.Param {
+	out := []syslog.Param{{Name: "event_id", Value: p.EventId}}
+	for _, kv := range [][2]string{
+		{"session_id", p.SessionID()},
+		{"cwd", p.WorkingDir()},
+		{"tool_name", str(p.ToolName)},
+		{"status", str(p.Status)},
+	} {
+		if kv[1] != "" {
+			out = append(out, syslog.Param{Name: kv[0], Value: kv[1]})
+		}
+	}
+	return out
+}
+
+// summary is the human-readable message, e.g. `tool-call-finished tool=Bash status=completed`.
+func summary(p *hooksdk.HookPayload) string {
+	parts := []string{p.EventType()}
+	if name := str(p.ToolName); name != "" {
+		parts = append(parts, "tool="+name)
+	}
+	if len(p.Command) > 0 {
+		parts = append(parts, fmt.Sprintf("command=%q", strings.Join(p.Command, " ")))
+	}
+	if status := str(p.Status); status != "" {
+		parts = append(parts, "status="+status)
+	}
+	if p.Success != nil {
+		parts = append(parts, fmt.Sprintf("success=%t", *p.Success))
+	}
+	return strings.Join(parts, " ")
+}
+
+func str(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
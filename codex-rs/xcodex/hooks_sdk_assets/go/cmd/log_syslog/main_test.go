@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/syslog"
+)
+
+func TestSeverity(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *hooktest.Builder
+		want  syslog.Severity
+	}{
+		{"tool started", hooktest.ToolCallStarted(), syslog.Notice},
+		{"tool finished", hooktest.ToolCallFinished(), syslog.Notice},
+		{"tool failed", hooktest.ToolCallFinished().With("success", false), syslog.Warning},
+		{"tool aborted", hooktest.ToolCallFinished().With("status", "aborted"), syslog.Warning},
+		{"approval", hooktest.ApprovalRequested(), syslog.Notice},
+		{"session start", hooktest.SessionStart(), syslog.Info},
+	}
+	for _, tt := range tests {
+		if got := severity(tt.event.Build()); got != tt.want {
+			t.Errorf("%s: severity = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleSendsToCollector(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("CODEX_HOOK_SYSLOG_ADDR", "udp://"+conn.LocalAddr().String())
+	t.Setenv("CODEX_HOOK_SYSLOG_FACILITY", "local3")
+
+	event := hooktest.ToolCallFinished().WithSessionID("s1").WithCwd("/work").WithToolName("Bash").Build()
+	resp, err := handle(context.Background(), event)
+	if err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle = %+v, %v; want allow", resp, err)
+	}
+
+	buf := make([]byte, 8192)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// local3 (19) * 8 + notice (5) = 157.
+	for _, want := range []string{"<157>1 ", " xcodex ", " tool-call-finished [xcodex@32473 ", `session_id="s1"`, `cwd="/work"`, `tool_name="Bash"`, "] tool-call-finished tool=Bash"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("message %q doesn't contain %q", msg, want)
+		}
+	}
+
+	// A collector that can't be reached doesn't get in the way of the event.
+	t.Setenv("CODEX_HOOK_SYSLOG_ADDR", "bogus://nowhere")
+	if resp, err := handle(context.Background(), event); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("handle without a collector = %+v, %v; want allow", resp, err)
+	}
+}
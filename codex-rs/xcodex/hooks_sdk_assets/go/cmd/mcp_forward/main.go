@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/mcp"
+)
+
+const (
+	// serveArg runs the binary as a daemon that keeps one connection to the server open for all
+	// events, instead of connecting for each.
+	serveArg = "--serve"
+
+	// probeTimeout bounds the check for a running daemon before falling back to a direct
+	// connection.
+	probeTimeout = 200 * time.Millisecond
+)
+
+// config is read from `$CODEX_HOME/hooks/config/mcp_forward.toml`; CODEX_HOOK_MCP_FORWARD_<KEY>
+// variables (CODEX_HOOK_MCP_FORWARD_URL, ...) override it.
+type config struct {
+	// Command starts a stdio MCP server, e.g. ["node", "events-server.js"]; URL is a streamable
+	// HTTP one. Exactly one is set.
+	Command []string `toml:"command"`
+	// Env holds extra `KEY=value` variables for Command.
+	Env []string `toml:"env"`
+	URL string   `toml:"url"`
+	// Headers are sent with every HTTP request, e.g. Authorization.
+	Headers map[string]string `toml:"headers"`
+	// Method is the notification each event is sent as.
+	Method string `toml:"method" default:"notifications/xcodex/hook_event"`
+	// Events and Exclude pick the event types to forward (`*` suffix wildcards).
+	Events  []string `toml:"events"`
+	Exclude []string `toml:"exclude"`
+	// Timeout bounds connecting (the initialize handshake included) and sending one event.
+	Timeout time.Duration `toml:"timeout" default:"5s"`
+	// Socket is where `mcp_forward --serve` listens; hooks use it when a daemon is running there.
+	Socket string `toml:"socket"`
+}
+
+func (c *config) Validate() error {
+	if len(c.Command) > 0 && c.URL != "" {
+		return errors.New("set command or url, not both")
+	}
+	if !strings.HasPrefix(c.Method, "notifications/") {
+		return fmt.Errorf("method %q must start with notifications/", c.Method)
+	}
+	if c.Socket == "" {
+		c.Socket = hooksdk.Environ().Path("hooks", "mcp_forward.sock")
+	}
+	return nil
+}
+
+func (c *config) server(stderr io.Writer) mcp.Server {
+	header := http.Header{}
+	for k, v := range c.Headers {
+		header.Set(k, v)
+	}
+	return mcp.Server{Command: c.Command, Env: c.Env, Stderr: stderr, URL: c.URL, Header: header}
+}
+
+func main() {
+	var cfg config
+	cfgErr := hooksdk.LoadConfig("mcp_forward", &cfg)
+	if len(os.Args) > 1 && os.Args[1] == serveArg {
+		if cfgErr != nil {
+			fmt.Fprintf(os.Stderr, "mcp_forward: load config: %v\n", cfgErr)
+			os.Exit(hooksdk.ExitError)
+		}
+		serve(&cfg)
+		return
+	}
+	// With a daemon running, relay the event to it and reuse its connection; otherwise connect to
+	// the server for this event only. A self-test checks the server itself.
+	if cfgErr == nil && !hooksdk.SelfTestRequested() && daemonRunning(cfg.Socket) {
+		ctx, stop := hooksdk.SignalContext()
+		code := hooksdk.Forward(ctx, cfg.Socket, os.Stdin, os.Stdout, os.Stderr)
+		stop()
+		os.Exit(code)
+	}
+	// Run parses the event payload, calls handle, and writes the response. A server that can't be
+	// reached or refuses the notification is logged; the event is allowed and not retried.
+	hooksdk.Run(func(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+		hooklog.Bind(payload)
+		if cfgErr != nil {
+			hooklog.Errorf("load config: %v; event not forwarded", cfgErr)
+			return hooksdk.Allow(), nil
+		}
+		if skip(&cfg, payload) {
+			return hooksdk.Allow(), nil
+		}
+		ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+		c, err := mcp.Dial(ctx, cfg.server(nil))
+		if err != nil {
+			hooklog.Warnf("connect to MCP server: %v; event not forwarded", err)
+			return hooksdk.Allow(), nil
+		}
+		defer c.Close()
+		if err := c.Notify(ctx, cfg.Method, params(payload)); err != nil {
+			hooklog.Warnf("send %s: %v", cfg.Method, err)
+		}
+		return hooksdk.Allow(), nil
+	}, hooksdk.WithSelfTest(func() []hooksdk.Check { return selfTest(&cfg, cfgErr) }))
+}
+
+// selfTest checks, for `mcp_forward --self-test`, that the config loads and the MCP server
+// completes the initialize handshake.
+func selfTest(cfg *config, cfgErr error) []hooksdk.Check {
+	checks := []hooksdk.Check{hooksdk.CheckConfig("mcp_forward", cfgErr)}
+	if cfgErr != nil {
+		return checks
+	}
+	return append(checks, hooksdk.Check{
+		Name: "MCP server connects",
+		Run: func(ctx context.Context, env hooksdk.Env) error {
+			if len(cfg.Command) == 0 && cfg.URL == "" {
+				return fmt.Errorf("%w: neither command nor url set", hooksdk.ErrSkipped)
+			}
+			ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+			defer cancel()
+			c, err := mcp.Dial(ctx, cfg.server(nil))
+			if err != nil {
+				return err
+			}
+			return c.Close()
+		},
+	})
+}
+
+// daemonRunning reports whether something accepts connections on socketPath.
+func daemonRunning(socketPath string) bool {
+	conn, err := net.DialTimeout("unix", socketPath, probeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// skip reports whether the event is filtered out, or there is no server to send it to.
+func skip(cfg *config, payload *hooksdk.HookPayload) bool {
+	if len(cfg.Command) == 0 && cfg.URL == "" {
+		hooklog.Errorf("no MCP server (set command or url in %s); event not forwarded",
+			hooksdk.ConfigPath("mcp_forward"))
+		return true
+	}
+	filter := hooksdk.ParseFilter(strings.Join(cfg.Events, ","), strings.Join(cfg.Exclude, ","))
+	return !filter.MatchPayload(payload)
+}
+
+// params is the notification's params: the event's identity, and the payload as received.
+func params(payload *hooksdk.HookPayload) map[string]any {
+	return map[string]any{
+		"event_type": payload.EventType(),
+		"event_id":   payload.EventId,
+		"session_id": payload.SessionId,
+		"payload":    payload.RawPayload,
+	}
+}
+
+// serve runs the daemon. It connects to the server with the first event and reconnects when a
+// send fails, e.g. because the server restarted. Stop it with SIGTERM or ^C.
+func serve(cfg *config) {
+	d := &daemon{cfg: cfg}
+	defer d.close()
+	fmt.Fprintf(os.Stderr, "mcp_forward listening on %s\n", cfg.Socket)
+	if err := hooksdk.Serve(cfg.Socket, d.handle); err != nil {
+		fmt.Fprintf(os.Stderr, "mcp_forward: %v\n", err)
+		os.Exit(hooksdk.ExitError)
+	}
+}
+
+// daemon holds the connection shared by the events it serves.
+type daemon struct {
+	cfg *config
+
+	mu     sync.Mutex
+	client *mcp.Client
+}
+
+func (d *daemon) handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+	if skip(d.cfg, payload) {
+		return hooksdk.Allow(), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+	for attempt := 0; ; attempt++ {
+		c, err := d.connect(ctx)
+		if err != nil {
+			hooklog.Warnf("connect to MCP server: %v; event not forwarded", err)
+			return hooksdk.Allow(), nil
+		}
+		err = c.Notify(ctx, d.cfg.Method, params(payload))
+		if err == nil {
+			return hooksdk.Allow(), nil
+		}
+		d.drop(c)
+		if attempt > 0 || ctx.Err() != nil {
+			hooklog.Warnf("send %s: %v", d.cfg.Method, err)
+			return hooksdk.Allow(), nil
+		}
+	}
+}
+
+// connect returns the shared connection, dialing it first if there is none.
+func (d *daemon) connect(ctx context.Context) (*mcp.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		return d.client, nil
+	}
+	c, err := mcp.Dial(ctx, d.cfg.server(os.Stderr))
+	if err != nil {
+		return nil, err
+	}
+	d.client = c
+	return c, nil
+}
+
+// drop closes c and forgets it, unless another event has already replaced it.
+func (d *daemon) drop(c *mcp.Client) {
+	d.mu.Lock()
+	if d.client == c {
+		d.client = nil
+	}
+	d.mu.Unlock()
+	c.Close()
+}
+
+func (d *daemon) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		d.client.Close()
+	}
+}
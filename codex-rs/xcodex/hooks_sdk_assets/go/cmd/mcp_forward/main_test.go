@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/mcp"
+	"example.com/xcodex/hooks-sdk/hooksdk/mcp/mcptest"
+)
+
+// TestMain runs the fake stdio MCP server, or with MCP_FORWARD_TEST_MAIN set, the hook itself.
+func TestMain(m *testing.M) {
+	mcptest.Main()
+	if os.Getenv("MCP_FORWARD_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+const hookEvent = "notifications/xcodex/hook_event"
+
+// setup gives the hook a CODEX_HOME of its own and, unless srv is nil, a config pointing at srv.
+func setup(t *testing.T, srv *mcptest.Server) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv(hooksdk.HookNameEnv, "")
+	if srv == nil {
+		return
+	}
+	var cfg strings.Builder
+	if srv.URL != "" {
+		fmt.Fprintf(&cfg, "url = %q\n", srv.URL)
+	} else {
+		fmt.Fprintf(&cfg, "command = [%q]\nenv = [%q]\n", srv.Command[0], srv.Env[0])
+	}
+	// A short socket path: a daemon listens there.
+	fmt.Fprintf(&cfg, "socket = %q\n", filepath.Join(home, "mcp.sock"))
+	writeConfig(t, cfg.String())
+}
+
+func writeConfig(t *testing.T, cfg string) {
+	t.Helper()
+	path := hooksdk.ConfigPath("mcp_forward")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runHook runs the hook on payload, returning its exit code and stderr.
+func runHook(t *testing.T, payload []byte, env ...string) (int, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), append([]string{"MCP_FORWARD_TEST_MAIN=1"}, env...)...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return cmd.ProcessState.ExitCode(), stderr.String()
+}
+
+func checkFraming(t *testing.T, srv *mcptest.Server) {
+	t.Helper()
+	for _, p := range srv.Problems() {
+		t.Error(p)
+	}
+}
+
+func count(msgs []mcptest.Message, method string) int {
+	n := 0
+	for _, m := range msgs {
+		if m.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// checkEvents checks srv got a notification for each payload, in order.
+func checkEvents(t *testing.T, srv *mcptest.Server, payloads ...*hooktest.Builder) {
+	t.Helper()
+	got := srv.Notifications(hookEvent)
+	if len(got) != len(payloads) {
+		t.Fatalf("%d notifications, want %d", len(got), len(payloads))
+	}
+	for i, b := range payloads {
+		var params struct {
+			EventType string          `json:"event_type"`
+			SessionID string          `json:"session_id"`
+			Payload   json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(got[i].Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		p := b.Build()
+		var payload map[string]any
+		json.Unmarshal(params.Payload, &payload)
+		if params.EventType != p.EventType() || params.SessionID != p.SessionId || payload["xcodex_event_type"] != p.EventType() {
+			t.Errorf("notification %d = %s, want %s", i, got[i].Params, p.EventType())
+		}
+	}
+}
+
+func TestForwardStdio(t *testing.T) {
+	srv := mcptest.NewStdio(t, mcptest.Options{})
+	setup(t, srv)
+	events := []*hooktest.Builder{hooktest.SessionStart(), hooktest.ToolCallStarted()}
+	for _, b := range events {
+		if code, stderr := runHook(t, b.Bytes()); code != 0 || stderr != "" {
+			t.Errorf("%s: exit %d, stderr %q", b.Build().EventType(), code, stderr)
+		}
+	}
+	checkFraming(t, srv)
+	checkEvents(t, srv, events...)
+	// Without a daemon, each event connects.
+	if n := count(srv.Messages(), "initialize"); n != 2 {
+		t.Errorf("%d connections, want 2", n)
+	}
+}
+
+func TestForwardHTTP(t *testing.T) {
+	srv := mcptest.NewHTTP(t, mcptest.Options{Stream: true})
+	setup(t, srv)
+	runHook(t, hooktest.SessionStart().Bytes(), "CODEX_HOOK_MCP_FORWARD_EVENTS=session-*")
+	runHook(t, hooktest.ToolCallStarted().Bytes(), "CODEX_HOOK_MCP_FORWARD_EVENTS=session-*")
+	runHook(t, hooktest.SessionEnd().Bytes(), "CODEX_HOOK_MCP_FORWARD_EVENTS=session-*", "CODEX_HOOK_MCP_FORWARD_METHOD=notifications/custom")
+	checkFraming(t, srv)
+	checkEvents(t, srv, hooktest.SessionStart())
+	if n := len(srv.Notifications("notifications/custom")); n != 1 {
+		t.Errorf("%d notifications/custom, want 1", n)
+	}
+	if started, ended := srv.Sessions(); started != 2 || ended != 2 {
+		t.Errorf("%d sessions started, %d ended; want 2 of each", started, ended)
+	}
+}
+
+// TestForwardDegrades checks that an event is allowed, with a warning, whenever it can't be
+// forwarded.
+func TestForwardDegrades(t *testing.T) {
+	payload := hooktest.SessionStart().Bytes()
+	for name, tt := range map[string]struct {
+		srv  *mcptest.Server
+		cfg  string
+		want string
+	}{
+		"hang up":    {srv: mcptest.NewStdio(t, mcptest.Options{HangUp: true}), want: "connect to MCP server"},
+		"init error": {srv: mcptest.NewHTTP(t, mcptest.Options{InitError: &mcp.RPCError{Code: -32603, Message: "down"}}), want: "server error -32603: down"},
+		"stall":      {srv: mcptest.NewHTTP(t, mcptest.Options{Stall: true}), cfg: "timeout = \"300ms\"\n", want: "context deadline exceeded"},
+		"absent":     {cfg: "url = \"http://127.0.0.1:1/mcp\"\n", want: "connect to MCP server"},
+		"no command": {cfg: "command = [\"/nonexistent/mcp-server\"]\n", want: "connect to MCP server"},
+		"no server":  {want: "no MCP server"},
+		"bad config": {cfg: "method = \"tools/call\"\nurl = \"http://127.0.0.1:1/mcp\"\n", want: "must start with notifications/"},
+	} {
+		setup(t, tt.srv)
+		if tt.cfg != "" {
+			cfg, _ := os.ReadFile(hooksdk.ConfigPath("mcp_forward"))
+			writeConfig(t, tt.cfg+string(cfg))
+		}
+		start := time.Now()
+		code, stderr := runHook(t, payload)
+		if code != 0 || !strings.Contains(stderr, tt.want) || strings.Count(strings.TrimSpace(stderr), "\n") != 0 {
+			t.Errorf("%s: exit %d, stderr %q; want 0 and a warning %q", name, code, stderr, tt.want)
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Errorf("%s: took %v", name, time.Since(start))
+		}
+	}
+}
+
+func TestDaemonReconnects(t *testing.T) {
+	srv := mcptest.NewHTTP(t, mcptest.Options{})
+	setup(t, srv)
+	var cfg config
+	if err := hooksdk.LoadConfig("mcp_forward", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	d := &daemon{cfg: &cfg}
+	events := []*hooktest.Builder{hooktest.SessionStart(), hooktest.ToolCallStarted(), hooktest.SessionEnd()}
+	for i, b := range events {
+		if i == 2 {
+			// The server restarts and forgets its session: the event goes out on a new one.
+			srv.EndSession()
+		}
+		if resp, err := d.handle(context.Background(), b.Build()); err != nil || resp.Decision != hooksdk.DecisionAllow {
+			t.Errorf("handle = %+v, %v", resp, err)
+		}
+	}
+	d.close()
+	checkFraming(t, srv)
+	checkEvents(t, srv, events...)
+	if started, _ := srv.Sessions(); started != 2 {
+		t.Errorf("%d sessions, want 2", started)
+	}
+}
+
+func TestServe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stops the daemon with an interrupt")
+	}
+	srv := mcptest.NewStdio(t, mcptest.Options{})
+	setup(t, srv)
+	daemon := exec.Command(os.Args[0], serveArg)
+	daemon.Env = append(os.Environ(), "MCP_FORWARD_TEST_MAIN=1")
+	if err := daemon.Start(); err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(os.Getenv("CODEX_HOME"), "mcp.sock")
+	for deadline := time.Now().Add(10 * time.Second); !daemonRunning(socket); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			daemon.Process.Kill()
+			t.Fatal("the daemon didn't start listening")
+		}
+	}
+
+	events := []*hooktest.Builder{hooktest.SessionStart(), hooktest.ToolCallStarted(), hooktest.SessionEnd()}
+	for _, b := range events {
+		if code, stderr := runHook(t, b.Bytes()); code != 0 || stderr != "" {
+			t.Errorf("%s: exit %d, stderr %q", b.Build().EventType(), code, stderr)
+		}
+	}
+	daemon.Process.Signal(os.Interrupt)
+	if err := daemon.Wait(); err != nil {
+		t.Errorf("daemon: %v", err)
+	}
+	checkFraming(t, srv)
+	checkEvents(t, srv, events...)
+	// The daemon sent them all on one connection.
+	if n := count(srv.Messages(), "initialize"); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	setup(t, mcptest.NewHTTP(t, mcptest.Options{}))
+	var cfg config
+	cfgErr := hooksdk.LoadConfig("mcp_forward", &cfg)
+	checks := selfTest(&cfg, cfgErr)
+	if len(checks) != 2 {
+		t.Fatalf("%d checks", len(checks))
+	}
+	for _, c := range checks {
+		if err := c.Run(context.Background(), hooksdk.Environ()); err != nil {
+			t.Errorf("%s: %v", c.Name, err)
+		}
+	}
+
+	cfg.URL = "http://127.0.0.1:1/mcp"
+	if err := checks[1].Run(context.Background(), hooksdk.Environ()); err == nil {
+		t.Error("self-test passed with no server")
+	}
+	cfg.URL = ""
+	if err := checks[1].Run(context.Background(), hooksdk.Environ()); !errors.Is(err, hooksdk.ErrSkipped) {
+		t.Errorf("self-test without a server = %v, want skipped", err)
+	}
+	if checks := selfTest(&cfg, errors.New("bad toml")); len(checks) != 1 {
+		t.Errorf("%d checks with a bad config, want 1", len(checks))
+	}
+}
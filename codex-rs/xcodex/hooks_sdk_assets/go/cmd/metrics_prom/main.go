@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/metrics"
+)
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `metrics_prom --self-test`, that the state and exposition files can be
+// written.
+func selfTest() []hooksdk.Check {
+	dir := metricsDir()
+	return []hooksdk.Check{
+		hooksdk.CheckWritable("metrics state", filepath.Join(dir, "state.json")),
+		hooksdk.CheckWritable("exposition file", expositionPath(dir)),
+	}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	dir := metricsDir()
+	r := metrics.NewRecorder(filepath.Join(dir, "state.json"), expositionPath(dir))
+	if v := os.Getenv("CODEX_HOOK_METRICS_BUCKETS"); v != "" {
+		buckets, err := parseBuckets(v)
+		if err != nil {
+			hooklog.Warnf("ignoring CODEX_HOOK_METRICS_BUCKETS: %v", err)
+		} else {
+			r.Buckets = buckets
+		}
+	}
+	if err := r.Observe(payload); err != nil {
+		hooklog.Errorf("update metrics: %v", err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+// parseBuckets parses comma-separated bucket bounds in seconds, e.g. `0.1,1,10,60`.
+func parseBuckets(s string) ([]float64, error) {
+	var out []float64
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("bad bound %q (want positive seconds)", f)
+		}
+		out = append(out, v)
+	}
+	sort.Float64s(out)
+	for i := 1; i < len(out); i++ {
+		if out[i] == out[i-1] {
+			return nil, fmt.Errorf("duplicate bound %v", out[i])
+		}
+	}
+	return out, nil
+}
+
+// expositionPath is CODEX_HOOK_METRICS_FILE, the exposition file, e.g. in node_exporter's
+// --collector.textfile.directory (default `xcodex.prom` in the metrics directory).
+func expositionPath(dir string) string {
+	if out := os.Getenv("CODEX_HOOK_METRICS_FILE"); out != "" {
+		return out
+	}
+	return filepath.Join(dir, "xcodex.prom")
+}
+
+// metricsDir is CODEX_HOOK_METRICS_DIR, or `$CODEX_HOME/hooks/metrics`; it holds the state file.
+func metricsDir() string {
+	if dir := os.Getenv("CODEX_HOOK_METRICS_DIR"); dir != "" {
+		return dir
+	}
+	return hooksdk.Environ().Path("hooks", "metrics")
+}
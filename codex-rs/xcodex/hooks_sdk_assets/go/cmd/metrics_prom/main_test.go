@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestParseBuckets(t *testing.T) {
+	got, err := parseBuckets("60, 0.1,1,10")
+	if err != nil || fmt.Sprint(got) != "[0.1 1 10 60]" {
+		t.Errorf("parseBuckets = %v, %v", got, err)
+	}
+	for _, s := range []string{"", "1,x", "0,1", "-1", "1,2,1"} {
+		if _, err := parseBuckets(s); err == nil {
+			t.Errorf("parseBuckets(%q) succeeded", s)
+		}
+	}
+}
+
+func TestHandleWritesExposition(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "textfile", "xcodex.prom")
+	t.Setenv("CODEX_HOOK_METRICS_DIR", dir)
+	t.Setenv("CODEX_HOOK_METRICS_FILE", out)
+	t.Setenv("CODEX_HOOK_METRICS_BUCKETS", "1,5")
+
+	for _, b := range []*hooktest.Builder{hooktest.SessionStart(), hooktest.ToolCallStarted(), hooktest.ToolCallFinished()} {
+		resp, err := handle(context.Background(), b.Build())
+		if err != nil || resp.Decision != hooksdk.DecisionAllow {
+			t.Fatalf("handle = %+v, %v", resp, err)
+		}
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`xcodex_hook_events_total{event="session-start"} 1`,
+		`xcodex_tool_executions_total{tool="Bash",status="success"} 1`,
+		`xcodex_tool_duration_seconds_bucket{tool="Bash",le="5"} 1`,
+	} {
+		if !strings.Contains(string(data), want+"\n") {
+			t.Errorf("exposition lacks %q:\n%s", want, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "state.json")); err != nil {
+		t.Errorf("state file: %v", err)
+	}
+}
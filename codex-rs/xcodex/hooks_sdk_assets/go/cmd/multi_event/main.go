@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/correlate"
+	"example.com/xcodex/hooks-sdk/hooksdk/decisioncache"
+)
+
+func main() {
+	// A single hook binary can handle several event types: register one handler per type and let
+	// the Mux route each payload. Events without a handler fall through to mux.Default (Allow).
+	mux := hooksdk.NewMux()
+
+	// Middleware wraps every handler: log each event's decision and duration on stderr, and turn
+	// a panicking handler into Allow (inside the logger, so the event is still logged).
+	mux.Use(hooksdk.LogRequests(), hooksdk.Recover(hooksdk.Allow()))
+
+	// Once the user has been asked about a command, allow it for the rest of the session instead
+	// of asking again. The session-end event forgets the session's decisions.
+	mux.Use(decisioncache.Middleware(decisioncache.New(decisioncache.DefaultDir()), decisioncache.CommandKey, 0))
+
+	mux.OnSessionStart(func(p *hooksdk.HookPayload) hooksdk.Response {
+		fmt.Fprintf(os.Stderr, "session %s started in %s\n", p.SessionId, p.Cwd)
+		return hooksdk.Allow()
+	})
+
+	mux.OnApprovalRequested(func(p *hooksdk.HookPayload) hooksdk.Response {
+		if len(p.Command) > 0 && p.Command[0] == "sudo" {
+			return hooksdk.Ask(fmt.Sprintf("allow %q?", strings.Join(p.Command, " ")))
+		}
+		return hooksdk.Allow()
+	})
+
+	// Each event runs in a new process, so the start of a tool call is kept by hooksdk/correlate
+	// until its result arrives.
+	mux.OnToolCallStarted(func(p *hooksdk.HookPayload) hooksdk.Response {
+		if p.ToolUseId != nil && p.ToolName != nil {
+			correlate.Start(toolCallKey(p), map[string]any{"tool": *p.ToolName})
+		}
+		return hooksdk.Allow()
+	})
+
+	mux.OnToolCallFinished(func(p *hooksdk.HookPayload) hooksdk.Response {
+		if p.Success != nil && !*p.Success && p.ToolName != nil {
+			fmt.Fprintf(os.Stderr, "tool %s failed\n", *p.ToolName)
+		}
+		if p.ToolUseId != nil {
+			if started, took, ok := correlate.Finish(toolCallKey(p)); ok {
+				fmt.Fprintf(os.Stderr, "tool %v took %.1fs\n", started.Meta["tool"], took.Seconds())
+			}
+		}
+		return hooksdk.Allow()
+	})
+
+	mux.OnSessionEnd(func(p *hooksdk.HookPayload) hooksdk.Response {
+		fmt.Fprintf(os.Stderr, "session %s ended\n", p.SessionId)
+		return hooksdk.Allow()
+	})
+
+	hooksdk.Run(mux.Handle)
+}
+
+// toolCallKey identifies a tool call across its started and finished events.
+func toolCallKey(p *hooksdk.HookPayload) string {
+	return "tool:" + p.SessionID() + ":" + *p.ToolUseId
+}
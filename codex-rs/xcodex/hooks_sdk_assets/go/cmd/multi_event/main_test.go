@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// TestMain lets the tests run this binary as the hook: with MULTI_EVENT_TEST_MAIN set, it runs
+// main. The handlers log to the process's stderr, so each event runs in a process of its own, as
+// the host runs it.
+func TestMain(m *testing.M) {
+	if os.Getenv("MULTI_EVENT_TEST_MAIN") != "" {
+		main()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runHook runs the hook on payload with CODEX_HOME set to home and returns its response and stderr.
+func runHook(t *testing.T, home string, payload []byte) (hooksdk.Response, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "MULTI_EVENT_TEST_MAIN=1", "CODEX_HOME="+home)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("hook: %v\n%s", err, stderr.String())
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		t.Fatalf("response %q: %v", stdout.String(), err)
+	}
+	return resp, stderr.String()
+}
+
+func TestToolCallDuration(t *testing.T) {
+	home := t.TempDir()
+	runHook(t, home, hooktest.ToolCallStarted().WithToolName("Bash").With("tool_use_id", "call-7").Bytes())
+	// Another call's result doesn't finish this one.
+	if _, stderr := runHook(t, home, hooktest.ToolCallFinished().With("tool_use_id", "call-8").Bytes()); strings.Contains(stderr, "took") {
+		t.Errorf("a call with no start was timed: %s", stderr)
+	}
+	_, stderr := runHook(t, home, hooktest.ToolCallFinished().With("tool_use_id", "call-7").With("success", false).Bytes())
+	for _, want := range []string{"tool Bash failed\n", "tool Bash took "} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr lacks %q:\n%s", want, stderr)
+		}
+	}
+	// The start is used up.
+	if _, stderr := runHook(t, home, hooktest.ToolCallFinished().With("tool_use_id", "call-7").Bytes()); strings.Contains(stderr, "took") {
+		t.Errorf("a call was timed twice: %s", stderr)
+	}
+}
+
+func TestApproval(t *testing.T) {
+	home := t.TempDir()
+	if resp, _ := runHook(t, home, hooktest.ApprovalRequested().WithCommand("sudo make install").Bytes()); resp.Decision != hooksdk.DecisionAsk || resp.Prompt != `allow "sudo make install"?` {
+		t.Errorf("sudo = %+v, want ask", resp)
+	}
+	if resp, _ := runHook(t, home, hooktest.ApprovalRequested().WithCommand("ls").Bytes()); resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("ls = %+v, want allow", resp)
+	}
+}
+
+func TestLogsEachEvent(t *testing.T) {
+	t.Setenv("CODEX_HOOK_LOG_FORMAT", "json")
+	t.Setenv("CODEX_HOOK_LOG_LEVEL", "")
+	_, stderr := runHook(t, t.TempDir(), hooktest.ApprovalRequested().WithSessionID("s-mw").WithCommand("sudo ls").Bytes())
+	for _, line := range strings.Split(stderr, "\n") {
+		var rec map[string]any
+		if json.Unmarshal([]byte(line), &rec) != nil || rec["msg"] != "handled event" {
+			continue
+		}
+		if rec["decision"] != "ask" || rec["session_id"] != "s-mw" || rec["event_type"] != "approval-requested" {
+			t.Errorf("record = %v", rec)
+		}
+		return
+	}
+	t.Errorf("no handled event record in stderr:\n%s", stderr)
+}
+
+func TestApprovalRemembered(t *testing.T) {
+	home := t.TempDir()
+	sudo := hooktest.ApprovalRequested().WithSessionID("s-cache").WithCommand("sudo make install").Bytes()
+	if resp, _ := runHook(t, home, sudo); resp.Decision != hooksdk.DecisionAsk {
+		t.Fatalf("first sudo = %+v, want ask", resp)
+	}
+	// Once asked, the command is allowed for the rest of the session.
+	if resp, _ := runHook(t, home, sudo); resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("second sudo = %+v, want allow", resp)
+	}
+	if resp, _ := runHook(t, home, hooktest.ApprovalRequested().WithSessionID("s-other").WithCommand("sudo make install").Bytes()); resp.Decision != hooksdk.DecisionAsk {
+		t.Errorf("sudo in another session = %+v, want ask", resp)
+	}
+	runHook(t, home, hooktest.SessionEnd().WithSessionID("s-cache").Bytes())
+	if resp, _ := runHook(t, home, sudo); resp.Decision != hooksdk.DecisionAsk {
+		t.Errorf("sudo after the session ended = %+v, want ask", resp)
+	}
+}
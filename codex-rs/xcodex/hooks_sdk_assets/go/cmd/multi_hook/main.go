@@ -0,0 +1,62 @@
+// Command multi_hook bundles three small hooks in one binary, built and installed once:
+//
+//   - guard denies approval requests for commands that start with `rm -rf`.
+//   - log logs each event's type and session on stderr.
+//   - timing logs how long each tool call took.
+//
+// hooksdk.Main picks the hook by the first argument, the name the binary was run as, or
+// CODEX_HOOK_NAME, and runs it like hooksdk.Run, reading the payload once:
+//
+//	go build -o hooks ./cmd/multi_hook
+//	ln -s hooks hook-guard   # or run `hooks guard`, or set CODEX_HOOK_NAME=guard
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+func main() {
+	hooksdk.Main(map[string]hooksdk.Hook{
+		"guard": {Handler: newGuard().Handle},
+		"log":   {Handler: logEvent},
+		// Logging the time is never worth holding up the agent.
+		"timing": {Handler: timing, Options: []hooksdk.Option{hooksdk.WithTimeout(2*time.Second, hooksdk.Allow())}},
+	})
+}
+
+// newGuard routes approval requests to guard's check; other events are allowed.
+func newGuard() *hooksdk.Mux {
+	mux := hooksdk.NewMux()
+	mux.Use(hooksdk.Recover(hooksdk.Allow()))
+	hooksdk.Handle(mux, func(ctx context.Context, p *hooksdk.ApprovalRequestedPayload) (hooksdk.Response, error) {
+		if len(p.Command) >= 2 && p.Command[0] == "rm" && (p.Command[1] == "-rf" || p.Command[1] == "-fr") {
+			return hooksdk.Deny(fmt.Sprintf("refusing to run %q", strings.Join(p.Command, " "))), nil
+		}
+		return hooksdk.Allow(), nil
+	})
+	return mux
+}
+
+func logEvent(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(p)
+	hooklog.Infof("%s in session %s", p.Type(), p.SessionID())
+	return hooksdk.Allow(), nil
+}
+
+func timing(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(p)
+	if p.Type() == hooksdk.EventToolCallFinished && p.DurationMs != nil {
+		name := "tool"
+		if p.ToolName != nil {
+			name = *p.ToolName
+		}
+		hooklog.Infof("%s took %s", name, time.Duration(*p.DurationMs)*time.Millisecond)
+	}
+	return hooksdk.Allow(), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestGuard(t *testing.T) {
+	for command, want := range map[string]hooksdk.Decision{
+		"rm -rf /":   hooksdk.DecisionDeny,
+		"rm -fr ./x": hooksdk.DecisionDeny,
+		"rm -r ./x":  hooksdk.DecisionAllow,
+		"ls -rf":     hooksdk.DecisionAllow,
+		"git status": hooksdk.DecisionAllow,
+		"rm":         hooksdk.DecisionAllow,
+	} {
+		res := hooktest.RunHook(t, newGuard().Handle, hooktest.ApprovalRequested().WithCommand(command).Bytes())
+		if res.Response.Decision != want {
+			t.Errorf("%q: %+v, want %s; stderr: %s", command, res.Response, want, res.Stderr)
+		}
+	}
+	// Other events are allowed.
+	if res := hooktest.RunHook(t, newGuard().Handle, hooktest.ToolCallStarted().WithCommand("rm -rf /").Bytes()); res.Response.Decision != hooksdk.DecisionAllow {
+		t.Errorf("tool call: %+v", res.Response)
+	}
+}
+
+func TestLogHooksAllow(t *testing.T) {
+	for name, h := range map[string]hooksdk.Handler{"log": logEvent, "timing": timing} {
+		for _, b := range []*hooktest.Builder{hooktest.SessionStart(), hooktest.ToolCallFinished().With("duration_ms", 1500).WithToolName("exec")} {
+			if res := hooktest.RunHook(t, h, b.Bytes()); res.ExitCode != hooksdk.ExitOK || res.Response.Decision != hooksdk.DecisionAllow {
+				t.Errorf("%s: exit %d, %+v; stderr: %s", name, res.ExitCode, res.Response, res.Stderr)
+			}
+		}
+	}
+}
@@ -0,0 +1,515 @@
+// Command newhook scaffolds a Go hook as its own module: a go.mod that points at this SDK, a
+// main.go with a stub handler per event type, a config loader, and tests built on hooktest.
+// With --into, it adds the hook as a package of a multi-hook module instead, whose one binary
+// runs each of its hooks through hooksdk.Main.
+//
+//	go run ./cmd/newhook [--output DIR] [--module PATH] [--sdk DIR] <name> <event-type>...
+//	go run ./cmd/newhook --into DIR [--module PATH] [--sdk DIR] <name> <event-type>...
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// sdkModule is the module path of this SDK, which generated modules require.
+const sdkModule = "example.com/xcodex/hooks-sdk"
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// files maps each generated file to its template.
+var files = []struct{ name, tmpl string }{
+	{"go.mod", "templates/go.mod.tmpl"},
+	{"main.go", "templates/main.go.tmpl"},
+	{"config.go", "templates/config.go.tmpl"},
+	{"main_test.go", "templates/main_test.go.tmpl"},
+}
+
+// hookFiles maps each file of a hook added to a multi-hook module to its template.
+var hookFiles = []struct{ name, tmpl string }{
+	{"hook.go", "templates/main.go.tmpl"},
+	{"config.go", "templates/config.go.tmpl"},
+	{"hook_test.go", "templates/main_test.go.tmpl"},
+}
+
+// bundleFiles maps the files --into creates for a new multi-hook module to their templates;
+// hooks_gen.go is rewritten each time a hook is added.
+var bundleFiles = []struct{ name, tmpl string }{
+	{"go.mod", "templates/go.mod.tmpl"},
+	{"main.go", "templates/bundle_main.go.tmpl"},
+}
+
+// hints suggest, per event type, where a handler usually starts.
+var hints = map[string]string{
+	"approval-requested":  "check p.Command (or p.Paths); return hooksdk.Deny(reason) or hooksdk.Ask(question) to override the approval.",
+	"tool-call-started":   "check p.ToolName and p.ToolInput; return hooksdk.Deny(reason) to block the call.",
+	"tool-call-finished":  "look at p.ToolName, p.Success, p.DurationMs, and p.OutputPreview.",
+	"user-prompt-submit":  "look at p.Prompt.",
+	"agent-turn-complete": "look at p.LastAssistantMessage.",
+}
+
+var (
+	namePattern  = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+	eventPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fl := flag.NewFlagSet("newhook", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	output := fl.String("output", "", "directory to create (default ./<name>)")
+	module := fl.String("module", "", "module path of the new hook (default example.com/xcodex/hooks/<name>)")
+	sdk := fl.String("sdk", "", "directory of the hooks SDK (default: found from the current directory or $CODEX_HOME)")
+	into := fl.String("into", "", "add the hook to the multi-hook module in this directory (created if it has no go.mod)")
+	fl.Usage = func() {
+		fmt.Fprintf(stderr, "usage: newhook [flags] <name> <event-type>...\n\nEvent types (or `all`):\n  %s\n\nFlags:\n",
+			strings.Join(hooksdk.KnownEventTypes(), "\n  "))
+		fl.PrintDefaults()
+	}
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fl.NArg() < 2 {
+		fl.Usage()
+		return 2
+	}
+
+	name := fl.Arg(0)
+	if !namePattern.MatchString(name) {
+		fmt.Fprintf(stderr, "newhook: name %q must be lowercase letters, digits, - and _, starting with a letter\n", name)
+		return 2
+	}
+	events, err := parseEvents(fl.Args()[1:], stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "newhook: %v\n", err)
+		return 2
+	}
+	if *into != "" && *output != "" {
+		fmt.Fprintln(stderr, "newhook: --into and --output can't be used together")
+		return 2
+	}
+	if *sdk == "" {
+		if *sdk, err = findSDK(); err != nil {
+			fmt.Fprintf(stderr, "newhook: %v\n", err)
+			return 1
+		}
+	}
+	if *into != "" {
+		if err := generateInto(*into, *module, *sdk, name, events); err != nil {
+			fmt.Fprintf(stderr, "newhook: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "added %s to %s\n\n  cd %s\n  go test ./...\n  go build -o hooks .\n  ln -s hooks hook-%s\n",
+			name, *into, *into, name)
+		return 0
+	}
+	if *output == "" {
+		*output = name
+	}
+	if *module == "" {
+		*module = "example.com/xcodex/hooks/" + name
+	}
+
+	if err := generate(*output, *module, *sdk, name, events); err != nil {
+		fmt.Fprintf(stderr, "newhook: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "created %s\n\n  cd %s\n  go test ./...\n  go build -o hook-%s .\n", *output, *output, name)
+	return 0
+}
+
+// event is what the templates know about one event type.
+type event struct {
+	Type string
+	// Method is the Mux method registering its handler, "" for types this SDK doesn't know.
+	Method  string
+	Handler string
+	Fixture string
+	Hint    string
+}
+
+// parseEvents reads event types (also comma-separated, or `all`). Types this SDK doesn't know
+// are accepted with a warning, for hosts newer than the SDK.
+func parseEvents(args []string, stderr io.Writer) ([]event, error) {
+	var out []event
+	seen := map[string]bool{}
+	add := func(t string) error {
+		if seen[t] {
+			return nil
+		}
+		if !eventPattern.MatchString(t) {
+			return fmt.Errorf("bad event type %q", t)
+		}
+		seen[t] = true
+		camel := camelCase(t)
+		ev := event{
+			Type:    t,
+			Handler: strings.ToLower(camel[:1]) + camel[1:],
+			Fixture: "hooktest." + camel + "()",
+			Hint:    hints[t],
+		}
+		if hooksdk.IsKnownEventType(t) {
+			ev.Method = "On" + camel
+		} else {
+			fmt.Fprintf(stderr, "newhook: warning: %q is not an event type this SDK knows\n", t)
+			ev.Fixture = fmt.Sprintf("hooktest.New(%q, \"\")", t)
+		}
+		if ev.Hint == "" {
+			ev.Hint = "handle the event; p.Raw() has every field of the payload."
+		}
+		out = append(out, ev)
+		return nil
+	}
+	for _, arg := range args {
+		for _, t := range strings.Split(arg, ",") {
+			t = strings.TrimSpace(t)
+			switch t {
+			case "":
+				continue
+			case "all":
+				for _, known := range hooksdk.KnownEventTypes() {
+					if err := add(known); err != nil {
+						return nil, err
+					}
+				}
+			default:
+				if err := add(t); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no event types given")
+	}
+	return out, nil
+}
+
+// camelCase turns `tool-call-started` into `ToolCallStarted`.
+func camelCase(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "-") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+// findSDK locates this SDK: the module enclosing the current directory, or the copy installed in
+// `$CODEX_HOME/hooks/templates/go`.
+func findSDK() (string, error) {
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			if isSDK(dir) {
+				return dir, nil
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	codexHome := hooksdk.Environ().CodexHome
+	if dir := filepath.Join(codexHome, "hooks", "templates", "go"); isSDK(dir) {
+		return dir, nil
+	}
+	return "", errors.New("can't find the hooks SDK; run from its directory or pass --sdk")
+}
+
+func isSDK(dir string) bool {
+	return modulePath(dir) == sdkModule
+}
+
+// modulePath returns the module path in dir's go.mod, or "" if it has none.
+func modulePath(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// generate writes the module to output, which must not exist yet.
+func generate(output, module, sdk, name string, events []event) error {
+	abs, err := filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+	sdkAbs, err := filepath.Abs(sdk)
+	if err != nil {
+		return err
+	}
+	if !isSDK(sdkAbs) {
+		return fmt.Errorf("%s is not the hooks SDK (no go.mod for %s)", sdk, sdkAbs)
+	}
+	data := hookData(name, events)
+	data["Module"] = module
+	data["SDK"] = replacePath(abs, sdkAbs)
+	data["Package"] = "main"
+	data["Doc"] = comment(fmt.Sprintf("Command %s is an xcodex hook. It handles %s events; any other event is allowed.", name, eventList(events)))
+
+	rendered, err := render(files, data)
+	if err != nil {
+		return err
+	}
+
+	// Mkdir, not MkdirAll, for the directory itself: it fails if the directory already exists, so
+	// nothing is ever overwritten.
+	if err := os.MkdirAll(filepath.Dir(abs), 0o755); err != nil {
+		return err
+	}
+	if err := os.Mkdir(abs, 0o755); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%s already exists; choose another --output", output)
+		}
+		return err
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(abs, f.name), rendered[f.name], 0o644); err != nil {
+			os.RemoveAll(abs)
+			return err
+		}
+	}
+	return nil
+}
+
+// generateInto adds the hook as the package `<dir>/<name>` of the multi-hook module in dir, and
+// rewrites the module's hooks_gen.go to register it. A dir without a go.mod gets a new module
+// first: go.mod and a main.go that runs the hooks through hooksdk.Main.
+func generateInto(dir, module, sdk, name string, events []event) error {
+	pkg := strings.Map(underscore, name)
+	if token.IsKeyword(pkg) || pkg == "main" || pkg == "hooksdk" {
+		return fmt.Errorf("name %q can't be a package name; choose another", name)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	sdkAbs, err := filepath.Abs(sdk)
+	if err != nil {
+		return err
+	}
+	if !isSDK(sdkAbs) {
+		return fmt.Errorf("%s is not the hooks SDK (no go.mod for %s)", sdk, sdkAbs)
+	}
+
+	if existing := modulePath(abs); existing == "" {
+		if module == "" {
+			module = "example.com/xcodex/hooks/" + filepath.Base(abs)
+		}
+		data := map[string]any{
+			"Module": module,
+			"SDK":    replacePath(abs, sdkAbs),
+			"Doc": comment(fmt.Sprintf("Command %s runs the xcodex hooks in its packages from one binary, "+
+				"through hooksdk.Main. Add one with the --into flag of the SDK's cmd/newhook.", filepath.Base(abs))),
+		}
+		rendered, err := render(bundleFiles, data)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(abs, 0o755); err != nil {
+			return err
+		}
+		for _, f := range bundleFiles {
+			if err := writeNew(filepath.Join(abs, f.name), rendered[f.name]); err != nil {
+				return err
+			}
+		}
+		if err := writeRegistry(abs, module); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(filepath.Join(abs, "hooks_gen.go")); err != nil {
+		return fmt.Errorf("%s is not a multi-hook module (it has no hooks_gen.go); create one with --into on a new directory", dir)
+	} else if module != "" && module != existing {
+		return fmt.Errorf("%s is module %s, not %s", dir, existing, module)
+	} else {
+		module = existing
+	}
+
+	data := hookData(name, events)
+	data["Package"] = pkg
+	data["Multi"] = true
+	data["Doc"] = comment(fmt.Sprintf("Package %s is the %s hook of this module. It handles %s events; any other event is allowed.", pkg, name, eventList(events)))
+	rendered, err := render(hookFiles, data)
+	if err != nil {
+		return err
+	}
+	hookDir := filepath.Join(abs, name)
+	if err := os.Mkdir(hookDir, 0o755); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%s already exists; choose another name", hookDir)
+		}
+		return err
+	}
+	for _, f := range hookFiles {
+		if err := os.WriteFile(filepath.Join(hookDir, f.name), rendered[f.name], 0o644); err != nil {
+			os.RemoveAll(hookDir)
+			return err
+		}
+	}
+	if err := writeRegistry(abs, module); err != nil {
+		os.RemoveAll(hookDir)
+		return err
+	}
+	return nil
+}
+
+// writeRegistry rewrites dir's hooks_gen.go to register every hook of the module: each directory
+// with a hook.go, named after it.
+func writeRegistry(dir, module string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type hook struct{ Name, Package, Import string }
+	var hooks []hook
+	for _, e := range entries {
+		if !e.IsDir() || !namePattern.MatchString(e.Name()) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, e.Name(), "hook.go")); err != nil {
+			continue
+		}
+		hooks = append(hooks, hook{Name: e.Name(), Package: strings.Map(underscore, e.Name()), Import: module + "/" + e.Name()})
+	}
+	rendered, err := render([]struct{ name, tmpl string }{{"hooks_gen.go", "templates/hooks_gen.go.tmpl"}}, map[string]any{"Hooks": hooks})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "hooks_gen.go"), rendered["hooks_gen.go"], 0o644)
+}
+
+// hookData is what the templates of one hook know about it, besides where it goes.
+func hookData(name string, events []event) map[string]any {
+	return map[string]any{
+		"Name":      name,
+		"ConfigEnv": "CODEX_HOOK_" + strings.ToUpper(strings.Map(underscore, name)) + "_CONFIG",
+		"Events":    events,
+	}
+}
+
+// eventList lists the event types for a doc comment: `a`, `b`, and `c`.
+func eventList(events []event) string {
+	items := make([]string, len(events))
+	for i, ev := range events {
+		items[i] = "`" + ev.Type + "`"
+	}
+	return joinList(items)
+}
+
+// render executes each file's template on data, formatting Go files.
+func render(files []struct{ name, tmpl string }, data map[string]any) (map[string][]byte, error) {
+	rendered := make(map[string][]byte, len(files))
+	for _, f := range files {
+		t, err := template.ParseFS(templates, f.tmpl)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("render %s: %w", f.name, err)
+		}
+		out := buf.Bytes()
+		if strings.HasSuffix(f.name, ".go") {
+			if out, err = format.Source(out); err != nil {
+				return nil, fmt.Errorf("format %s: %w", f.name, err)
+			}
+		}
+		rendered[f.name] = out
+	}
+	return rendered, nil
+}
+
+// writeNew writes a file that must not exist yet, so nothing is ever overwritten.
+func writeNew(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%s already exists", path)
+		}
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replacePath is the go.mod replace target for sdk: relative to the new module when the two are
+// close (such as hooks next to the installed SDK in `$CODEX_HOME/hooks`), so they can be moved
+// together; absolute otherwise.
+func replacePath(module, sdk string) string {
+	path := filepath.ToSlash(sdk)
+	if rel, err := filepath.Rel(module, sdk); err == nil && strings.Count(rel+string(filepath.Separator), ".."+string(filepath.Separator)) <= 2 {
+		path = filepath.ToSlash(rel)
+		if !strings.HasPrefix(path, "../") && path != ".." {
+			path = "./" + path
+		}
+	}
+	if strings.ContainsAny(path, " \t\"'`") {
+		path = strconv.Quote(path)
+	}
+	return path
+}
+
+func underscore(r rune) rune {
+	if r == '-' {
+		return '_'
+	}
+	return r
+}
+
+// comment wraps text into `//` lines of at most 100 columns, the width of the SDK's own code.
+func comment(text string) string {
+	var lines []string
+	line := "//"
+	for _, word := range strings.Fields(text) {
+		if len(line)+1+len(word) > 100 && line != "//" {
+			lines = append(lines, line)
+			line = "//"
+		}
+		line += " " + word
+	}
+	return strings.Join(append(lines, line), "\n")
+}
+
+// joinList joins items as English: `a`, `a and b`, `a, b, and c`.
+func joinList(items []string) string {
+	switch len(items) {
+	case 1:
+		return items[0]
+	case 2:
+		return items[0] + " and " + items[1]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + ", and " + items[len(items)-1]
+}
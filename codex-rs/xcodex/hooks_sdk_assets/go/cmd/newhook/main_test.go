@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sdkDir is this SDK's module directory.
+func sdkDir(t *testing.T) string {
+	t.Helper()
+	dir, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil || !isSDK(dir) {
+		t.Fatalf("%s is not the SDK: %v", dir, err)
+	}
+	return dir
+}
+
+// newhook runs the generator and returns its exit code and output.
+func newhook(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// goCmd runs the go command in dir, offline, and fails the test if it fails.
+func goCmd(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not installed")
+	}
+	cmd := exec.Command(gobin, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go %s in %s: %v\n%s", strings.Join(args, " "), dir, err, out)
+	}
+}
+
+func TestGenerateBuilds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a generated module")
+	}
+	sdk := sdkDir(t)
+	for name, dir := range map[string]string{
+		"far from the sdk": filepath.Join(t.TempDir(), "my-hook"),
+		"path with space":  filepath.Join(t.TempDir(), "with space", "my-hook"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			code, stdout, stderr := newhook(t, "--output", dir, "--sdk", sdk, "my-hook",
+				"tool-call-started,approval-requested", "session-start", "plan-updated")
+			if code != 0 {
+				t.Fatalf("newhook exited %d: %s", code, stderr)
+			}
+			if !strings.Contains(stderr, `"plan-updated" is not an event type this SDK knows`) {
+				t.Errorf("no warning for an unknown event type: %q", stderr)
+			}
+			if !strings.Contains(stdout, "created "+dir) {
+				t.Errorf("stdout = %q", stdout)
+			}
+			for _, f := range files {
+				if _, err := os.Stat(filepath.Join(dir, f.name)); err != nil {
+					t.Error(err)
+				}
+			}
+			mod, _ := os.ReadFile(filepath.Join(dir, "go.mod"))
+			if !strings.Contains(string(mod), "module example.com/xcodex/hooks/my-hook") || !strings.Contains(string(mod), sdkModule) {
+				t.Errorf("go.mod =\n%s", mod)
+			}
+			src := readFile(t, filepath.Join(dir, "main.go")) + readFile(t, filepath.Join(dir, "config.go"))
+			for _, want := range []string{"OnToolCallStarted", "OnApprovalRequested", "OnSessionStart", `"plan-updated"`, "CODEX_HOOK_MY_HOOK_CONFIG"} {
+				if !strings.Contains(src, want) {
+					t.Errorf("generated code lacks %s", want)
+				}
+			}
+
+			goCmd(t, dir, "vet", "./...")
+			goCmd(t, dir, "test", "./...")
+			goCmd(t, dir, "build", "-o", filepath.Join(t.TempDir(), "hook"), ".")
+		})
+	}
+}
+
+func TestGenerateIntoBuilds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a generated module")
+	}
+	sdk := sdkDir(t)
+	dir := filepath.Join(t.TempDir(), "my-hooks")
+	for _, args := range [][]string{{"guard", "approval-requested"}, {"notify-me", "session-end,tool-call-finished"}} {
+		code, stdout, stderr := newhook(t, append([]string{"--into", dir, "--sdk", sdk}, args...)...)
+		if code != 0 || !strings.Contains(stdout, "added "+args[0]+" to "+dir) {
+			t.Fatalf("newhook --into %s exited %d: %s%s", args[0], code, stdout, stderr)
+		}
+	}
+	if mod := readFile(t, filepath.Join(dir, "go.mod")); !strings.HasPrefix(mod, "module example.com/xcodex/hooks/my-hooks\n") {
+		t.Errorf("go.mod =\n%s", mod)
+	}
+	gen := readFile(t, filepath.Join(dir, "hooks_gen.go"))
+	// gofmt aligns the map's values.
+	words := strings.Join(strings.Fields(gen), " ")
+	for _, want := range []string{`"guard": guard.Hook`, `notify_me "example.com/xcodex/hooks/my-hooks/notify-me"`, `"notify-me": notify_me.Hook`} {
+		if !strings.Contains(words, want) {
+			t.Errorf("hooks_gen.go lacks %s:\n%s", want, gen)
+		}
+	}
+	for _, f := range hookFiles {
+		if _, err := os.Stat(filepath.Join(dir, "notify-me", f.name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if src := readFile(t, filepath.Join(dir, "notify-me", "hook.go")); !strings.HasPrefix(src, "// Package notify_me is the notify-me hook") || !strings.Contains(src, "\npackage notify_me\n") {
+		t.Errorf("hook.go =\n%s", src)
+	}
+
+	goCmd(t, dir, "vet", "./...")
+	goCmd(t, dir, "test", "./...")
+	bin := filepath.Join(t.TempDir(), "hooks")
+	goCmd(t, dir, "build", "-o", bin, ".")
+	link := filepath.Join(filepath.Dir(bin), "hook-guard")
+	if err := os.Symlink(bin, link); err != nil {
+		t.Skipf("symlinks: %v", err)
+	}
+	cmd := exec.Command(link)
+	cmd.Stdin = strings.NewReader(`{"schema_version":1,"xcodex_event_type":"session-start","session_id":"s"}`)
+	if out, err := cmd.Output(); err != nil || !strings.Contains(string(out), `"decision":"allow"`) {
+		t.Errorf("hook-guard: %s, %v", out, err)
+	}
+}
+
+func TestGenerateIntoErrors(t *testing.T) {
+	sdk := sdkDir(t)
+	dir := filepath.Join(t.TempDir(), "hooks")
+	if code, _, stderr := newhook(t, "--into", dir, "--sdk", sdk, "--module", "github.com/me/hooks", "guard", "session-start"); code != 0 {
+		t.Fatalf("newhook exited %d: %s", code, stderr)
+	}
+	gen := readFile(t, filepath.Join(dir, "hooks_gen.go"))
+	standalone := filepath.Join(t.TempDir(), "h")
+	if code, _, stderr := newhook(t, "--output", standalone, "--sdk", sdk, "h", "session-start"); code != 0 {
+		t.Fatalf("newhook exited %d: %s", code, stderr)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"--into", dir, "--output", standalone, "x", "session-start"}, 2, "can't be used together"},
+		{[]string{"--into", dir, "guard", "session-end"}, 1, "already exists; choose another name"},
+		{[]string{"--into", dir, "--module", "github.com/me/other", "log", "session-end"}, 1, "is module github.com/me/hooks, not github.com/me/other"},
+		{[]string{"--into", dir, "func", "session-end"}, 1, "can't be a package name"},
+		{[]string{"--into", standalone, "log", "session-end"}, 1, "is not a multi-hook module"},
+	} {
+		code, _, stderr := newhook(t, append([]string{"--sdk", sdk}, tt.args...)...)
+		if code != tt.code || !strings.Contains(stderr, tt.want) {
+			t.Errorf("newhook %q exited %d: %s; want %d and %q", tt.args, code, stderr, tt.code, tt.want)
+		}
+	}
+	if got := readFile(t, filepath.Join(dir, "hooks_gen.go")); got != gen {
+		t.Errorf("a failed run rewrote hooks_gen.go:\n%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "log")); !os.IsNotExist(err) {
+		t.Errorf("a failed run left %s behind", filepath.Join(dir, "log"))
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGenerateModuleFlag(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "h")
+	if code, _, stderr := newhook(t, "--output", dir, "--sdk", sdkDir(t), "--module", "github.com/me/h", "h", "all"); code != 0 {
+		t.Fatalf("newhook exited %d: %s", code, stderr)
+	}
+	if mod := readFile(t, filepath.Join(dir, "go.mod")); !strings.HasPrefix(mod, "module github.com/me/h\n") {
+		t.Errorf("go.mod =\n%s", mod)
+	}
+	// `all` stubs every event type the SDK knows.
+	main := readFile(t, filepath.Join(dir, "main.go"))
+	for _, ev := range []string{"OnSessionStart", "OnToolCallFinished", "OnUserPromptSubmit"} {
+		if !strings.Contains(main, ev) {
+			t.Errorf("main.go lacks %s", ev)
+		}
+	}
+}
+
+func TestGenerateRefusesExistingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	keep := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(keep, []byte("package main // mine\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, stderr := newhook(t, "--output", dir, "--sdk", sdkDir(t), "h", "session-start")
+	if code != 1 || !strings.Contains(stderr, "already exists") {
+		t.Errorf("newhook into an existing directory exited %d: %s", code, stderr)
+	}
+	if got := readFile(t, keep); got != "package main // mine\n" {
+		t.Errorf("existing main.go overwritten: %q", got)
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	sdk := sdkDir(t)
+	out := filepath.Join(t.TempDir(), "h")
+	for _, args := range [][]string{
+		{},
+		{"h"},
+		{"--sdk", sdk, "My-Hook", "session-start"},
+		{"--sdk", sdk, "9lives", "session-start"},
+		{"--sdk", sdk, "h", "Tool_Call"},
+		{"--sdk", sdk, "h", ","},
+		{"--bogus", "h", "session-start"},
+	} {
+		if code, _, _ := newhook(t, append([]string{"--output", out}, args...)...); code != 2 {
+			t.Errorf("newhook %q exited %d, want 2", args, code)
+		}
+	}
+	if code, _, stderr := newhook(t, "--output", out, "--sdk", t.TempDir(), "h", "session-start"); code != 1 || !strings.Contains(stderr, "not the hooks SDK") {
+		t.Errorf("newhook with a wrong --sdk exited %d: %s", code, stderr)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("a failed run left %s behind", out)
+	}
+}
+
+func TestParseEvents(t *testing.T) {
+	var stderr bytes.Buffer
+	events, err := parseEvents([]string{"tool-call-started, session-start", "tool-call-started"}, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || stderr.Len() != 0 {
+		t.Fatalf("events = %+v, stderr %q; want two known events", events, stderr.String())
+	}
+	want := event{Type: "tool-call-started", Method: "OnToolCallStarted", Handler: "toolCallStarted", Fixture: "hooktest.ToolCallStarted()", Hint: hints["tool-call-started"]}
+	if events[0] != want {
+		t.Errorf("event = %+v, want %+v", events[0], want)
+	}
+
+	events, _ = parseEvents([]string{"plan-updated"}, &stderr)
+	if e := events[0]; e.Method != "" || e.Fixture != `hooktest.New("plan-updated", "")` || e.Hint == "" {
+		t.Errorf("unknown event = %+v", e)
+	}
+}
+
+func TestReplacePath(t *testing.T) {
+	tests := []struct {
+		module, sdk, want string
+	}{
+		{"/home/u/.codex/hooks/mine", "/home/u/.codex/hooks/templates/go", "../templates/go"},
+		{"/home/u/sdk/cmd/x", "/home/u/sdk", "../.."},
+		{"/home/u/sdk/mine", "/home/u/sdk/mine/vendor/sdk", "./vendor/sdk"},
+		{"/far/away/from/it", "/home/u/sdk", "/home/u/sdk"},
+		// The relative path has no space in it, so it needs no quotes.
+		{"/home/u/my hooks/x", "/home/u/my hooks/sdk", "../sdk"},
+		{"/srv/x/y/z", "/opt/my sdk", `"/opt/my sdk"`},
+	}
+	for _, tt := range tests {
+		if got := replacePath(filepath.FromSlash(tt.module), filepath.FromSlash(tt.sdk)); got != tt.want {
+			t.Errorf("replacePath(%s, %s) = %s, want %s", tt.module, tt.sdk, got, tt.want)
+		}
+	}
+}
+
+func TestComment(t *testing.T) {
+	text := strings.Repeat("word ", 50)
+	for _, line := range strings.Split(comment(text), "\n") {
+		if len(line) > 100 || !strings.HasPrefix(line, "// ") {
+			t.Errorf("comment line %q", line)
+		}
+	}
+	if got := joinList([]string{"a", "b", "c"}); got != "a, b, and c" {
+		t.Errorf("joinList = %q", got)
+	}
+	if got := camelCase("tool-call-started"); got != "ToolCallStarted" {
+		t.Errorf("camelCase = %q", got)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/chat"
+	"example.com/xcodex/hooks-sdk/hooksdk/diffview"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+const (
+	// defaultEvents are posted when CODEX_HOOK_CHAT_EVENTS is unset.
+	defaultEvents = "approval-requested,agent-turn-complete"
+
+	// defaultTemplate renders one event. Templates see the raw payload, so fields are referenced
+	// by their JSON names; `summary` is the event in one line (see summarize.OneLine).
+	defaultTemplate = "{{summary}}{{with diff 1500}}\n```\n{{.}}\n```{{end}}"
+
+	defaultInterval = 30 * time.Second
+
+	// flushArg runs the binary as the flusher that posts a queued digest once the rate limit
+	// allows it.
+	flushArg = "--flush"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == flushArg {
+		flush()
+		return
+	}
+	// CODEX_HOOK_CHAT_EVENTS / CODEX_HOOK_CHAT_EXCLUDE pick the event types to post
+	// (comma-separated, `*` suffix wildcards). Run allows the others from their type alone,
+	// without decoding them.
+	events := os.Getenv("CODEX_HOOK_CHAT_EVENTS")
+	if events == "" {
+		events = defaultEvents
+	}
+	filter := hooksdk.ParseFilter(events, os.Getenv("CODEX_HOOK_CHAT_EXCLUDE"))
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithFilter(filter), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `notify_chat --self-test`, that the chat webhook answers.
+func selfTest() []hooksdk.Check {
+	return []hooksdk.Check{hooksdk.CheckHTTP("chat webhook", os.Getenv("CODEX_HOOK_CHAT_WEBHOOK_URL"))}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	webhookURL := os.Getenv("CODEX_HOOK_CHAT_WEBHOOK_URL")
+	if webhookURL == "" {
+		hooklog.Errorf("CODEX_HOOK_CHAT_WEBHOOK_URL is not set; event not posted")
+		return hooksdk.Allow(), nil
+	}
+
+	msg, err := render(payload)
+	if err != nil {
+		hooklog.Errorf("render message: %v", err)
+		return hooksdk.Allow(), nil
+	}
+
+	// At most one post per CODEX_HOOK_CHAT_INTERVAL; events in between are queued and posted
+	// together as a digest by a background flusher.
+	send, flushAfter, err := batcher().Add(msg)
+	if err != nil {
+		hooklog.Warnf("rate limit state: %v; posting directly", err)
+		send = []string{msg}
+	}
+	if flushAfter > 0 {
+		if err := startFlusher(); err != nil {
+			hooklog.Warnf("start flusher: %v; the digest goes out with the next event", err)
+		}
+	}
+	if len(send) > 0 {
+		post(ctx, webhookURL, send)
+	}
+	return hooksdk.Allow(), nil
+}
+
+// render executes CODEX_HOOK_CHAT_TEMPLATE (or the file named by CODEX_HOOK_CHAT_TEMPLATE_FILE)
+// against the raw payload. Its `time` shows times in CODEX_HOOK_CHAT_TZ, else CODEX_HOOK_TZ.
+func render(payload *hooksdk.HookPayload) (string, error) {
+	text := os.Getenv("CODEX_HOOK_CHAT_TEMPLATE")
+	if path := os.Getenv("CODEX_HOOK_CHAT_TEMPLATE_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		text = string(data)
+	}
+	if text == "" {
+		text = defaultTemplate
+	}
+	loc, err := summarize.Location(os.Getenv("CODEX_HOOK_CHAT_TZ"))
+	if err != nil {
+		hooklog.Warnf("ignoring the time zone: %v", err)
+		loc = time.Local
+	}
+
+	tmpl, err := template.New("message").Funcs(template.FuncMap{
+		"join":     join,
+		"truncate": truncate,
+		"base":     filepath.Base,
+		"time":     func(v any) string { return timestamp(v, loc) },
+		"duration": duration,
+		"short":    short,
+		"summary":  func() string { return summarize.OneLine(payload) },
+		"detail":   func(maxBytes int) string { return summarize.Detail(payload, maxBytes) },
+		"diff": func(maxBytes int) string {
+			// The files an approval or tool call changes, or "" for other events.
+			text, err := diffview.Render(payload, diffview.Options{MaxBytes: maxBytes})
+			if err != nil {
+				return ""
+			}
+			return text
+		},
+	}).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, payload.RawPayload); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// timestamp shows an RFC 3339 timestamp (e.g. `timestamp`) in loc, as summarize.Timestamp does.
+func timestamp(v any, loc *time.Location) string {
+	if s, ok := v.(string); ok {
+		return summarize.Timestamp(s, loc)
+	}
+	return fmt.Sprint(v)
+}
+
+// duration formats a number of milliseconds (e.g. `duration_ms`) as summarize.Duration does.
+func duration(v any) string {
+	ms, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return summarize.Duration(time.Duration(ms * float64(time.Millisecond)))
+}
+
+// join joins a JSON array (e.g. `command`) with sep.
+func join(v any, sep string) string {
+	switch t := v.(type) {
+	case []any:
+		parts := make([]string, len(t))
+		for i, item := range t {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	case []string:
+		return strings.Join(t, sep)
+	}
+	return fmt.Sprint(v)
+}
+
+// short returns the hooksdk.ShortID of an id such as `.session_id`, or "" for a value that isn't a
+// string.
+func short(v any) string {
+	id, _ := v.(string)
+	return hooksdk.ShortID(id)
+}
+
+// truncate shortens s to at most n runes, ending with "…" when it was cut.
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+func batcher() *chat.Batcher {
+	interval := defaultInterval
+	if d, err := time.ParseDuration(os.Getenv("CODEX_HOOK_CHAT_INTERVAL")); err == nil {
+		interval = d
+	}
+	codexHome := hooksdk.Environ().CodexHome
+	return chat.NewBatcher(filepath.Join(codexHome, "hooks", "notify_chat"), interval)
+}
+
+// startFlusher starts this binary in flush mode, detached from the hook's stdio, so the session
+// isn't held up while the digest waits for the rate limit.
+func startFlusher() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, flushArg)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// flush waits until the rate limit allows it, then posts the queued messages as one digest.
+func flush() {
+	webhookURL := os.Getenv("CODEX_HOOK_CHAT_WEBHOOK_URL")
+	b := batcher()
+	for {
+		send, wait, err := b.Flush()
+		if err != nil {
+			hooklog.Errorf("flush digest: %v", err)
+			return
+		}
+		if wait > 0 {
+			time.Sleep(wait)
+			continue
+		}
+		if len(send) > 0 && webhookURL != "" {
+			post(context.Background(), webhookURL, send)
+		}
+		return
+	}
+}
+
+// post sends messages in the Slack or Discord shape, picked by CODEX_HOOK_CHAT_FORMAT or else
+// by the webhook URL.
+func post(ctx context.Context, webhookURL string, messages []string) {
+	format := chat.DetectFormat(webhookURL)
+	if v := os.Getenv("CODEX_HOOK_CHAT_FORMAT"); v != "" {
+		f, err := chat.ParseFormat(v)
+		if err != nil {
+			hooklog.Warnf("ignoring CODEX_HOOK_CHAT_FORMAT: %v", err)
+		} else {
+			format = f
+		}
+	}
+
+	body, err := chat.Body(format, messages)
+	if err != nil {
+		hooklog.Errorf("encode message: %v", err)
+		return
+	}
+	client := &webhook.Client{URL: webhookURL}
+	if err := client.Send(ctx, body); err != nil {
+		hooklog.Errorf("post %d message(s) to chat: %v", len(messages), err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+// TestMain runs the flusher handle starts, which is this binary run with --flush.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == flushArg {
+		flush()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRender(t *testing.T) {
+	event := hooktest.ApprovalRequested().WithCommand("rm -rf build").WithCwd("/work/core").Build()
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE", `{{.xcodex_event_type}} in {{base .cwd}}: {{join .command " "}} {{truncate 5 "abcdefgh"}}`)
+	got, err := render(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "approval-requested in core: rm -rf build abcd…"; got != want {
+		t.Errorf("render = %q, want %q", got, want)
+	}
+
+	// A template file takes precedence.
+	path := t.TempDir() + "/message.tmpl"
+	os.WriteFile(path, []byte("from file: {{.cwd}}\n"), 0o600)
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE_FILE", path)
+	if got, err := render(event); err != nil || got != "from file: /work/core" {
+		t.Errorf("render with a file = %q, %v", got, err)
+	}
+
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE_FILE", "")
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE", "{{.cwd")
+	if _, err := render(event); err == nil {
+		t.Errorf("render of a bad template succeeded")
+	}
+}
+
+func TestRenderTimes(t *testing.T) {
+	event := hooktest.ToolCallFinished().With("timestamp", "2026-03-29T01:30:00Z").With("duration_ms", 92000).Build()
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE_FILE", "")
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE", "{{time .timestamp}} {{duration .duration_ms}} {{time .duration_ms}} {{duration .cwd}}")
+	// CODEX_HOOK_CHAT_TZ comes before CODEX_HOOK_TZ; values that aren't times are shown as they are.
+	for _, tt := range []struct{ chat, tz, want string }{
+		{"", "America/New_York", "2026-03-28 21:30:00 EDT 1m32s 92000 /tmp/project"},
+		{"Europe/Berlin", "America/New_York", "2026-03-29 03:30:00 CEST 1m32s 92000 /tmp/project"},
+	} {
+		t.Setenv("CODEX_HOOK_CHAT_TZ", tt.chat)
+		t.Setenv(hooksdk.TZEnv, tt.tz)
+		if got, err := render(event); err != nil || got != tt.want {
+			t.Errorf("CODEX_HOOK_CHAT_TZ=%q CODEX_HOOK_TZ=%q: render = %q, %v; want %q", tt.chat, tt.tz, got, err, tt.want)
+		}
+	}
+	// An unknown zone falls back to the machine's.
+	t.Setenv("CODEX_HOOK_CHAT_TZ", "Mars/Olympus")
+	want := summarize.Time(time.Date(2026, 3, 29, 1, 30, 0, 0, time.UTC), time.Local)
+	if got, err := render(event); err != nil || !strings.HasPrefix(got, want+" ") {
+		t.Errorf("unknown zone: render = %q, %v; want it to start with %q", got, err, want)
+	}
+}
+
+func TestRenderSummary(t *testing.T) {
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE_FILE", "")
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE", "")
+	event := hooktest.ApprovalRequested().WithCommand("curl https://example.com").Build()
+	// The default template is the one-line summary.
+	if got, err := render(event); err != nil || got != summarize.OneLine(event) {
+		t.Errorf("render with the default template = %q, %v; want %q", got, err, summarize.OneLine(event))
+	}
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE", "{{detail 40}}")
+	if got, err := render(event); err != nil || got != summarize.Detail(event, 40) || len(got) > 40 {
+		t.Errorf("render of detail = %q, %v", got, err)
+	}
+}
+
+func TestRenderDiff(t *testing.T) {
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE_FILE", "")
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE", "{{.tool_name}} changes:\n{{diff 200}}")
+	patch := "*** Begin Patch\n*** Add File: notes.md\n+hello\n*** End Patch"
+	event := hooktest.ToolCallStarted().WithCwd("/work").WithToolName("apply_patch").With("tool_input", map[string]any{"input": patch}).Build()
+	got, err := render(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(got, "changes:\ndiff --git a/notes.md b/notes.md\n--- /dev/null\n+++ b/notes.md\n@@ -0,0 +1 @@\n+hello") {
+		t.Errorf("render = %q", got)
+	}
+	// Events that change no files render no diff.
+	if got, err := render(hooktest.SessionStart().Build()); err != nil || !strings.HasSuffix(got, "changes:") {
+		t.Errorf("render of a session start = %q, %v", got, err)
+	}
+}
+
+// chatServer starts a webhook endpoint, points the hook at it, and returns the bodies it gets.
+func chatServer(t *testing.T, path string) chan map[string]any {
+	t.Helper()
+	got := make(chan map[string]any, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("body %s: %v", data, err)
+		}
+		got <- body
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_CHAT_WEBHOOK_URL", srv.URL+path)
+	t.Setenv("CODEX_HOOK_CHAT_TEMPLATE", "{{.xcodex_event_type}} {{.session_id}}")
+	return got
+}
+
+func receive(t *testing.T, got chan map[string]any) map[string]any {
+	t.Helper()
+	select {
+	case body := <-got:
+		return body
+	case <-time.After(10 * time.Second):
+		t.Fatal("no message posted")
+		return nil
+	}
+}
+
+func TestHandleFormats(t *testing.T) {
+	t.Setenv("CODEX_HOOK_CHAT_INTERVAL", "0s")
+	got := chatServer(t, "/services/T/B/x")
+	handle(context.Background(), hooktest.SessionStart().WithSessionID("s1").Build())
+	if body := receive(t, got); body["text"] != "session-start s1" || body["blocks"] == nil {
+		t.Errorf("Slack body = %v", body)
+	}
+
+	t.Setenv("CODEX_HOOK_CHAT_FORMAT", "discord")
+	handle(context.Background(), hooktest.SessionStart().WithSessionID("s2").Build())
+	if body := receive(t, got); body["content"] != "session-start s2" {
+		t.Errorf("Discord body = %v", body)
+	}
+}
+
+func TestHandleBatchesBursts(t *testing.T) {
+	t.Setenv("CODEX_HOOK_CHAT_INTERVAL", "300ms")
+	t.Setenv("CODEX_HOOK_CHAT_FORMAT", "discord")
+	got := chatServer(t, "/")
+	for _, s := range []string{"s1", "s2", "s3"} {
+		handle(context.Background(), hooktest.SessionStart().WithSessionID(s).Build())
+	}
+	if body := receive(t, got); body["content"] != "session-start s1" {
+		t.Errorf("first post = %v, want the first event alone", body)
+	}
+	// The flusher posts the rest as one digest once the interval is over.
+	body := receive(t, got)
+	if content, _ := body["content"].(string); !strings.HasPrefix(content, "**2 events**") || !strings.Contains(content, "s3") {
+		t.Errorf("digest = %v", body)
+	}
+}
+
+func TestHandleAllowsWhenPostingFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_CHAT_INTERVAL", "0s")
+	t.Setenv("CODEX_HOOK_CHAT_WEBHOOK_URL", srv.URL)
+	resp, err := handle(context.Background(), hooktest.SessionStart().Build())
+	if err != nil || resp.Decision != "allow" {
+		t.Errorf("handle = %+v, %v; want allow", resp, err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/notify"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+// defaultEvents are notified when CODEX_HOOK_NOTIFY_EVENTS is unset: the moments you are most
+// likely to be looking at another window.
+const defaultEvents = "approval-requested,agent-turn-complete"
+
+func main() {
+	// CODEX_HOOK_NOTIFY_EVENTS lists the event types to notify (comma-separated, `*` suffix
+	// wildcards). Run allows the others from their type alone, without decoding them.
+	events := os.Getenv("CODEX_HOOK_NOTIFY_EVENTS")
+	if events == "" {
+		events = defaultEvents
+	}
+	// Run parses the event payload, calls handle, and writes the response. Over SSH or in CI there
+	// is no desktop to notify, so the notification fails open.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithFilter(hooksdk.ParseFilter(events, "")), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `notify_desktop --self-test`, that a notification command is installed
+// and there is a desktop session to show notifications in.
+func selfTest() []hooksdk.Check {
+	return []hooksdk.Check{{
+		Name: "notification command is available",
+		Run: func(context.Context, hooksdk.Env) error {
+			_, _, err := notify.New().Command("", "")
+			return err
+		},
+	}}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	err := notify.New().Notify(ctx, title(payload), body(payload))
+	if errors.Is(err, notify.ErrUnavailable) {
+		hooklog.Warnf("%v", err)
+	} else if err != nil {
+		hooklog.Errorf("show notification: %v", err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+func title(p *hooksdk.HookPayload) string {
+	switch p.EventType() {
+	case "approval-requested":
+		return "xcodex: approval needed"
+	case "agent-turn-complete":
+		return "xcodex: turn complete"
+	case "notification":
+		if p.Title != nil && *p.Title != "" {
+			return *p.Title
+		}
+	case "tool-call-finished":
+		if p.Success != nil && !*p.Success {
+			return "xcodex: tool call failed"
+		}
+	}
+	return "xcodex: " + p.EventType()
+}
+
+// bodyMax is the most bytes of a notification body; desktops show a few lines at most.
+const bodyMax = 480
+
+// body summarizes the event (see summarize.Detail): the tool and command, the reason for an
+// approval, the prompt or last reply, and which project it is about.
+func body(p *hooksdk.HookPayload) string {
+	return summarize.Detail(p, bodyMax)
+}
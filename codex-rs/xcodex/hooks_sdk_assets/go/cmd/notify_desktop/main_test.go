@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		event *hooktest.Builder
+		want  string
+	}{
+		{hooktest.ApprovalRequested(), "xcodex: approval needed"},
+		{hooktest.AgentTurnComplete(), "xcodex: turn complete"},
+		{hooktest.Notification().With("title", "Build finished"), "Build finished"},
+		{hooktest.Notification().With("title", nil), "xcodex: notification"},
+		{hooktest.ToolCallFinished().With("success", false), "xcodex: tool call failed"},
+		{hooktest.ToolCallFinished(), "xcodex: tool-call-finished"},
+	}
+	for _, tt := range tests {
+		p := tt.event.Build()
+		if got := title(p); got != tt.want {
+			t.Errorf("title(%s) = %q, want %q", p.EventType(), got, tt.want)
+		}
+	}
+}
+
+func TestBody(t *testing.T) {
+	p := hooktest.ApprovalRequested().WithCommand("make deploy "+strings.Repeat("--target=production ", 40)).With("reason", "runs outside the sandbox").Build()
+	got := body(p)
+	if want := summarize.Detail(p, bodyMax); got != want {
+		t.Errorf("body = %q, want summarize.Detail's %q", got, want)
+	}
+	if len(got) > bodyMax || !strings.Contains(got, "make deploy") || !strings.Contains(got, "runs outside the sandbox") {
+		t.Errorf("body (%d bytes) = %q", len(got), got)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("checks notify-send")
+	}
+	check := selfTest()[0]
+	bin := t.TempDir()
+	t.Setenv("PATH", bin)
+	t.Setenv("DISPLAY", ":0")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", "")
+	if err := check.Run(context.Background(), hooksdk.Env{}); err == nil {
+		t.Error("passed without notify-send")
+	}
+	if err := os.WriteFile(filepath.Join(bin, "notify-send"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := check.Run(context.Background(), hooksdk.Env{}); err != nil {
+		t.Errorf("with notify-send: %v", err)
+	}
+	// Without a graphical session there is nowhere to show it.
+	t.Setenv("DISPLAY", "")
+	if err := check.Run(context.Background(), hooksdk.Env{}); err == nil {
+		t.Error("passed without a graphical session")
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/chat"
+	"example.com/xcodex/hooks-sdk/hooksdk/email"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/ratelimit"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+const (
+	// defaultSubject and defaultBody render one event. Templates see the raw payload, so fields
+	// are referenced by their JSON names.
+	defaultSubject = "[xcodex] {{.xcodex_event_type}}{{with .cwd}} in {{base .}}{{end}}"
+	defaultBody    = "{{.xcodex_event_type}}{{with .timestamp}} at {{time .}}{{end}}\n" +
+		"{{with .session_id}}session:   {{short .}}\n{{end}}" +
+		"{{with .cwd}}directory: {{.}}\n{{end}}" +
+		"{{with .tool_name}}tool:      {{.}}\n{{end}}" +
+		"{{with .command}}command:   {{join . \" \"}}\n{{end}}" +
+		"{{with .reason}}reason:    {{.}}\n{{end}}" +
+		"{{with .last_assistant_message}}\n{{truncate 2000 .}}\n{{end}}"
+
+	// digestSeparator goes between the events of a digest.
+	digestSeparator = "\n\n----------------------------------------\n\n"
+
+	// flushArg runs the binary as the flusher that mails a queued digest once the window ends.
+	flushArg = "--flush"
+)
+
+// config is read from `$CODEX_HOME/hooks/config/email.toml`; CODEX_HOOK_EMAIL_<KEY> variables
+// (CODEX_HOOK_EMAIL_PASSWORD, ...) override it.
+type config struct {
+	Host string `toml:"host"`
+	// Port defaults to 587 for starttls, 465 for tls, and 25 for none.
+	Port int `toml:"port"`
+	// Security is starttls, tls (implicit TLS), or none (a relay on localhost).
+	Security string   `toml:"security" default:"starttls"`
+	Username string   `toml:"username"`
+	Password string   `toml:"password"`
+	From     string   `toml:"from"`
+	To       []string `toml:"to"`
+	// Events and Exclude pick the event types to mail (`*` suffix wildcards).
+	Events  []string `toml:"events" default:"session-end"`
+	Exclude []string `toml:"exclude"`
+	// Subject and Body are text/templates executed against the raw payload; BodyFile, if set,
+	// holds the body template instead.
+	Subject  string `toml:"subject"`
+	Body     string `toml:"body"`
+	BodyFile string `toml:"body_file"`
+	// Timezone is the IANA zone templates show times in, overriding CODEX_HOOK_TZ; empty means
+	// that, or the machine's zone.
+	Timezone string `toml:"timezone"`
+	// Window is how long events are gathered after a message before the next one, which mails
+	// them together as a digest.
+	Window time.Duration `toml:"window" default:"1m"`
+	// MaxPerHour caps the messages sent per hour (a burst of it, then one every hour/MaxPerHour);
+	// events past it are dropped. 0 means no cap.
+	MaxPerHour int `toml:"max_per_hour" default:"10"`
+	// Timeout bounds sending one message.
+	Timeout time.Duration `toml:"timeout" default:"30s"`
+}
+
+func (c *config) Validate() error {
+	var missing []string
+	for _, f := range []struct {
+		key string
+		set bool
+	}{{"host", c.Host != ""}, {"from", c.From != ""}, {"to", len(c.To) > 0}} {
+		if !f.set {
+			missing = append(missing, f.key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s not set", strings.Join(missing, ", "))
+	}
+	if _, err := email.ParseSecurity(c.Security); err != nil {
+		return err
+	}
+	if _, err := summarize.Location(c.Timezone); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	if c.MaxPerHour < 0 {
+		return errors.New("max_per_hour must not be negative")
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == flushArg {
+		flush()
+		return
+	}
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `notify_email --self-test`, that the config is complete and the SMTP
+// server accepts connections.
+func selfTest() []hooksdk.Check {
+	cfg, err := loadConfig()
+	checks := []hooksdk.Check{hooksdk.CheckConfig("email", err)}
+	if err != nil {
+		return checks
+	}
+	security, _ := email.ParseSecurity(cfg.Security)
+	port := cfg.Port
+	if port == 0 {
+		port = security.DefaultPort()
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	return append(checks, hooksdk.CheckDial("SMTP server", "tcp", addr))
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		hooklog.Errorf("load config: %v; event not mailed", err)
+		return hooksdk.Allow(), nil
+	}
+	filter := hooksdk.ParseFilter(strings.Join(cfg.Events, ","), strings.Join(cfg.Exclude, ","))
+	if !filter.MatchPayload(payload) {
+		return hooksdk.Allow(), nil
+	}
+	// Rendering waits until the message is composed, but a broken template should show up now.
+	if _, err := cfg.templates(); err != nil {
+		hooklog.Errorf("parse templates: %v; event not mailed", err)
+		return hooksdk.Allow(), nil
+	}
+	event, err := json.Marshal(payload.RawPayload)
+	if err != nil {
+		hooklog.Errorf("encode payload: %v", err)
+		return hooksdk.Allow(), nil
+	}
+
+	// At most one message per window; events in between are queued and mailed together as a
+	// digest by a background flusher.
+	send, flushAfter, err := batcher(cfg).Add(string(event))
+	if err != nil {
+		hooklog.Warnf("batch state: %v; mailing directly", err)
+		send = []string{string(event)}
+	}
+	if flushAfter > 0 {
+		if err := startFlusher(); err != nil {
+			hooklog.Warnf("start flusher: %v; the digest goes out with the next event", err)
+		}
+	}
+	if len(send) > 0 {
+		deliver(ctx, cfg, send)
+	}
+	return hooksdk.Allow(), nil
+}
+
+func loadConfig() (*config, error) {
+	var cfg config
+	if err := hooksdk.LoadConfig("email", &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+type templates struct {
+	subject, body *template.Template
+}
+
+func (c *config) templates() (*templates, error) {
+	subject, body := c.Subject, c.Body
+	if c.BodyFile != "" {
+		data, err := os.ReadFile(c.BodyFile)
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+	}
+	if subject == "" {
+		subject = defaultSubject
+	}
+	if body == "" {
+		body = defaultBody
+	}
+	loc, _ := summarize.Location(c.Timezone)
+	funcs := template.FuncMap{
+		"join":     join,
+		"truncate": truncate,
+		"base":     filepath.Base,
+		"time":     func(v any) string { return timestamp(v, loc) },
+		"duration": duration,
+		"short":    short,
+	}
+	var t templates
+	var err error
+	if t.subject, err = template.New("subject").Funcs(funcs).Parse(subject); err != nil {
+		return nil, err
+	}
+	if t.body, err = template.New("body").Funcs(funcs).Parse(body); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// compose renders the message for events, each the JSON of a raw payload: the subject of the
+// first, with a count of the others, and the bodies of all of them.
+func compose(cfg *config, events []string) (*email.Message, error) {
+	t, err := cfg.templates()
+	if err != nil {
+		return nil, err
+	}
+	var subject string
+	bodies := make([]string, len(events))
+	for i, event := range events {
+		var raw map[string]any
+		dec := json.NewDecoder(strings.NewReader(event))
+		dec.UseNumber()
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			if subject, err = execute(t.subject, raw); err != nil {
+				return nil, err
+			}
+		}
+		if bodies[i], err = execute(t.body, raw); err != nil {
+			return nil, err
+		}
+	}
+	if n := len(events) - 1; n > 0 {
+		subject += fmt.Sprintf(" (and %d more)", n)
+	}
+	return &email.Message{
+		From:    cfg.From,
+		To:      cfg.To,
+		Subject: subject,
+		Body:    strings.Join(bodies, digestSeparator) + "\n",
+	}, nil
+}
+
+func execute(t *template.Template, raw map[string]any) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, raw); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// join joins a JSON array (e.g. `command`) with sep.
+func join(v any, sep string) string {
+	switch t := v.(type) {
+	case []any:
+		parts := make([]string, len(t))
+		for i, item := range t {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	case []string:
+		return strings.Join(t, sep)
+	}
+	return fmt.Sprint(v)
+}
+
+// short returns the hooksdk.ShortID of an id such as `.session_id`, or "" for a value that isn't a
+// string.
+func short(v any) string {
+	id, _ := v.(string)
+	return hooksdk.ShortID(id)
+}
+
+// truncate shortens s to at most n runes, ending with "…" when it was cut.
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+// timestamp shows an RFC 3339 timestamp (e.g. `timestamp`) in loc, as summarize.Timestamp does.
+func timestamp(v any, loc *time.Location) string {
+	if s, ok := v.(string); ok {
+		return summarize.Timestamp(s, loc)
+	}
+	return fmt.Sprint(v)
+}
+
+// duration formats a number of milliseconds (e.g. `duration_ms`) as summarize.Duration does.
+func duration(v any) string {
+	ms, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return summarize.Duration(time.Duration(ms * float64(time.Millisecond)))
+}
+
+func batcher(cfg *config) *chat.Batcher {
+	return chat.NewBatcher(hooksdk.Environ().Path("hooks", "notify_email"), cfg.Window)
+}
+
+// startFlusher starts this binary in flush mode, detached from the hook's stdio, so the session
+// isn't held up while the digest waits for the window to end.
+func startFlusher() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, flushArg)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// flush waits until the window ends, then mails the queued events as one digest.
+func flush() {
+	cfg, err := loadConfig()
+	if err != nil {
+		hooklog.Errorf("load config: %v; digest not mailed", err)
+		return
+	}
+	b := batcher(cfg)
+	for {
+		send, wait, err := b.Flush()
+		if err != nil {
+			hooklog.Errorf("flush digest: %v", err)
+			return
+		}
+		if wait > 0 {
+			time.Sleep(wait)
+			continue
+		}
+		if len(send) > 0 {
+			deliver(context.Background(), cfg, send)
+		}
+		return
+	}
+}
+
+// deliver mails events as one message, unless the hourly cap has been reached.
+func deliver(ctx context.Context, cfg *config, events []string) {
+	if cfg.MaxPerHour > 0 && !ratelimit.Allow("notify_email", ratelimit.Every(time.Hour/time.Duration(cfg.MaxPerHour)), cfg.MaxPerHour) {
+		hooklog.Warnf("reached max_per_hour (%d); %d event(s) not mailed", cfg.MaxPerHour, len(events))
+		return
+	}
+	msg, err := compose(cfg, events)
+	if err != nil {
+		hooklog.Errorf("render message: %v", err)
+		return
+	}
+	security, _ := email.ParseSecurity(cfg.Security)
+	client := &email.Client{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Security: security,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Timeout:  cfg.Timeout,
+	}
+	if err := client.Send(ctx, msg); err != nil {
+		hooklog.Errorf("mail %d event(s) to %s: %v", len(events), strings.Join(cfg.To, ", "), err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/email/emailtest"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// TestMain runs the flusher handle starts, which is this binary run with --flush.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == flushArg {
+		flush()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// smtpServer starts an SMTP server and points the hook at it, mailing every event.
+func smtpServer(t *testing.T) *emailtest.Server {
+	t.Helper()
+	srv := emailtest.NewServer(t, emailtest.Options{})
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_EMAIL_HOST", srv.Host)
+	t.Setenv("CODEX_HOOK_EMAIL_PORT", strconv.Itoa(srv.Port))
+	t.Setenv("CODEX_HOOK_EMAIL_SECURITY", "none")
+	t.Setenv("CODEX_HOOK_EMAIL_FROM", "xcodex <bot@example.com>")
+	t.Setenv("CODEX_HOOK_EMAIL_TO", "me@example.com,you@example.com")
+	t.Setenv("CODEX_HOOK_EMAIL_EVENTS", "*")
+	t.Setenv("CODEX_HOOK_EMAIL_WINDOW", "0s")
+	return srv
+}
+
+func handleEvent(t *testing.T, payload *hooksdk.HookPayload) {
+	t.Helper()
+	resp, err := handle(context.Background(), payload)
+	if err != nil || resp.Decision != "allow" {
+		t.Errorf("handle = %+v, %v; want allow", resp, err)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	srv := smtpServer(t)
+	handleEvent(t, hooktest.ApprovalRequested().WithCommand("rm -rf build").WithCwd("/work/core").WithSessionID("s1").Build())
+	got := srv.Wait(t, 1)[0]
+	if got.From != "bot@example.com" || strings.Join(got.To, ",") != "me@example.com,you@example.com" {
+		t.Errorf("from %q to %q", got.From, got.To)
+	}
+	if got.Subject != "[xcodex] approval-requested in core" {
+		t.Errorf("subject = %q", got.Subject)
+	}
+	for _, want := range []string{"approval-requested at ", "session:   " + hooksdk.ShortID("s1"), "directory: /work/core", "command:   rm -rf build"} {
+		if !strings.Contains(got.Body, want) {
+			t.Errorf("body %q doesn't have %q", got.Body, want)
+		}
+	}
+}
+
+func TestHandleFilters(t *testing.T) {
+	srv := smtpServer(t)
+	t.Setenv("CODEX_HOOK_EMAIL_EVENTS", "session-*")
+	t.Setenv("CODEX_HOOK_EMAIL_EXCLUDE", "session-start")
+	handleEvent(t, hooktest.SessionStart().Build())
+	handleEvent(t, hooktest.ToolCallStarted().Build())
+	handleEvent(t, hooktest.SessionEnd().WithSessionID("end").Build())
+	if got := srv.Wait(t, 1); len(got) != 1 || !strings.Contains(got[0].Subject, "session-end") {
+		t.Errorf("mailed %+v, want only the session-end", got)
+	}
+}
+
+func TestHandleBatchesBursts(t *testing.T) {
+	srv := smtpServer(t)
+	t.Setenv("CODEX_HOOK_EMAIL_WINDOW", "300ms")
+	for _, s := range []string{"s1", "s2", "s3"} {
+		handleEvent(t, hooktest.SessionEnd().WithSessionID(s).Build())
+	}
+	got := srv.Wait(t, 1)[0]
+	if got.Subject != "[xcodex] session-end in project" || !strings.Contains(got.Body, hooksdk.ShortID("s1")) {
+		t.Errorf("first message = %q: %q, want the first event alone", got.Subject, got.Body)
+	}
+	// The flusher mails the rest as one digest once the window is over.
+	digest := srv.Wait(t, 2)[1]
+	if digest.Subject != "[xcodex] session-end in project (and 1 more)" || strings.Count(digest.Body, digestSeparator) != 1 ||
+		!strings.Contains(digest.Body, hooksdk.ShortID("s3")) {
+		t.Errorf("digest = %q: %q", digest.Subject, digest.Body)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if n := len(srv.Messages()); n != 2 {
+		t.Errorf("%d messages, want 2", n)
+	}
+}
+
+func TestHandleMaxPerHour(t *testing.T) {
+	srv := smtpServer(t)
+	t.Setenv("CODEX_HOOK_EMAIL_MAX_PER_HOUR", "2")
+	for i := 0; i < 4; i++ {
+		handleEvent(t, hooktest.SessionEnd().Build())
+	}
+	srv.Wait(t, 2)
+	time.Sleep(200 * time.Millisecond)
+	if n := len(srv.Messages()); n != 2 {
+		t.Errorf("%d messages, want max_per_hour's 2", n)
+	}
+}
+
+func TestHandleAllowsWhenMailingFails(t *testing.T) {
+	for name, set := range map[string]func(t *testing.T){
+		"no server":    func(t *testing.T) { t.Setenv("CODEX_HOOK_EMAIL_PORT", "1") },
+		"untrusted":    func(t *testing.T) { t.Setenv("CODEX_HOOK_EMAIL_SECURITY", "starttls") },
+		"bad config":   func(t *testing.T) { t.Setenv("CODEX_HOOK_EMAIL_HOST", "") },
+		"bad template": func(t *testing.T) { t.Setenv("CODEX_HOOK_EMAIL_SUBJECT", "{{.cwd") },
+		"bad address":  func(t *testing.T) { t.Setenv("CODEX_HOOK_EMAIL_TO", "me@") },
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := smtpServer(t)
+			set(t)
+			handleEvent(t, hooktest.SessionEnd().Build())
+			if n := len(srv.Messages()); n != 0 {
+				t.Errorf("%d messages sent", n)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ok := config{Host: "smtp.example.com", From: "bot@example.com", To: []string{"me@example.com"}, Security: "starttls"}
+	if err := ok.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&config{}).Validate(); err == nil || err.Error() != "host, from, to not set" {
+		t.Errorf("empty config: %v", err)
+	}
+	for name, set := range map[string]func(c *config){
+		"security": func(c *config) { c.Security = "ssl" },
+		"timezone": func(c *config) { c.Timezone = "Mars/Olympus" },
+		"max":      func(c *config) { c.MaxPerHour = -1 },
+	} {
+		c := ok
+		set(&c)
+		if err := c.Validate(); err == nil {
+			t.Errorf("bad %s validated", name)
+		}
+	}
+}
+
+func TestCompose(t *testing.T) {
+	cfg := &config{
+		From:     "bot@example.com",
+		To:       []string{"me@example.com"},
+		Subject:  "{{.xcodex_event_type}} {{short .session_id}}",
+		Body:     `{{join .command "+"}} {{truncate 4 "abcdef"}} {{duration .duration_ms}} {{time .timestamp}} {{base .cwd}}`,
+		Timezone: "UTC",
+	}
+	events := []string{
+		`{"xcodex_event_type":"tool-call-finished","session_id":"s1","command":["go","test"],"duration_ms":1500,"timestamp":"2025-01-01T10:00:00Z","cwd":"/a/b"}`,
+		`{"xcodex_event_type":"session-end","session_id":"s2","command":"x","duration_ms":"soon","timestamp":5,"cwd":"/c"}`,
+	}
+	msg, err := compose(cfg, events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "tool-call-finished " + hooksdk.ShortID("s1") + " (and 1 more)"; msg.Subject != want {
+		t.Errorf("subject = %q, want %q", msg.Subject, want)
+	}
+	if want := "go+test abc… 1.5s 2025-01-01 10:00:00 UTC b" + digestSeparator + "x abc… soon 5 c\n"; msg.Body != want {
+		t.Errorf("body = %q, want %q", msg.Body, want)
+	}
+
+	// Without a timezone, CODEX_HOOK_TZ is used; the default body shows the event's time in it.
+	t.Setenv(hooksdk.TZEnv, "Asia/Tokyo")
+	if msg, err := compose(&config{}, events[:1]); err != nil || !strings.HasPrefix(msg.Body, "tool-call-finished at 2025-01-01 19:00:00 JST\n") {
+		t.Errorf("default body in CODEX_HOOK_TZ = %q, %v", msg.Body, err)
+	}
+	if msg, err := compose(cfg, events[:1]); err != nil || !strings.Contains(msg.Body, " 10:00:00 UTC ") {
+		t.Errorf("timezone doesn't override CODEX_HOOK_TZ: %q, %v", msg.Body, err)
+	}
+
+	// A body file replaces Body.
+	cfg.BodyFile = filepath.Join(t.TempDir(), "body.tmpl")
+	os.WriteFile(cfg.BodyFile, []byte("from file: {{.cwd}}\n"), 0o600)
+	if msg, err := compose(cfg, events[:1]); err != nil || msg.Body != "from file: /a/b\n" {
+		t.Errorf("body from a file = %q, %v", msg.Body, err)
+	}
+	cfg.BodyFile += ".missing"
+	if _, err := compose(cfg, events); err == nil {
+		t.Error("compose with a missing body file succeeded")
+	}
+	if _, err := compose(&config{}, []string{"not json"}); err == nil {
+		t.Error("compose of a bad event succeeded")
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	smtpServer(t)
+	checks := selfTest()
+	if len(checks) != 2 {
+		t.Fatalf("%d checks, want the config and the SMTP server", len(checks))
+	}
+	for _, c := range checks {
+		if err := c.Run(context.Background(), hooksdk.Environ()); err != nil {
+			t.Errorf("%s: %v", c.Name, err)
+		}
+	}
+
+	// A port nothing listens on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+	t.Setenv("CODEX_HOOK_EMAIL_PORT", strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
+	if err := selfTest()[1].Run(context.Background(), hooksdk.Environ()); err == nil {
+		t.Errorf("%s passed with nothing listening", checks[1].Name)
+	}
+
+	// A broken config stops there.
+	t.Setenv("CODEX_HOOK_EMAIL_PORT", "smtp")
+	if checks := selfTest(); len(checks) != 1 || checks[0].Run(context.Background(), hooksdk.Environ()) == nil {
+		t.Error("self-test passed with a broken config")
+	}
+}
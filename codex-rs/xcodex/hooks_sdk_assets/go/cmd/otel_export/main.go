@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/otel"
+)
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `otel_export --self-test`, that the OTEL_* settings are valid, the
+// collector answers, and the span state can be saved.
+func selfTest() []hooksdk.Check {
+	exporter, err := otel.ExporterFromEnv()
+	checks := []hooksdk.Check{
+		{
+			Name: "OTEL_EXPORTER_OTLP_* settings are valid",
+			Run:  func(context.Context, hooksdk.Env) error { return err },
+		},
+		hooksdk.CheckWritable("state directory", stateDir()),
+	}
+	if err != nil {
+		return checks
+	}
+	return append(checks, hooksdk.CheckHTTP("collector", exporter.Endpoint))
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	exporter, err := otel.ExporterFromEnv()
+	if err != nil {
+		hooklog.Errorf("configure exporter: %v", err)
+		return hooksdk.Allow(), nil
+	}
+	spans, err := otel.NewTracer(stateDir()).Observe(payload)
+	if err != nil {
+		hooklog.Errorf("record span state: %v", err)
+		return hooksdk.Allow(), nil
+	}
+	// The state lock is released by now, so a slow collector doesn't hold up other hooks.
+	if err := exporter.Export(ctx, spans); err != nil {
+		hooklog.Warnf("%v", err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+// stateDir is CODEX_HOOK_OTEL_STATE_DIR, or `$CODEX_HOME/hooks/otel`.
+func stateDir() string {
+	if dir := os.Getenv("CODEX_HOOK_OTEL_STATE_DIR"); dir != "" {
+		return dir
+	}
+	return hooksdk.Environ().Path("hooks", "otel")
+}
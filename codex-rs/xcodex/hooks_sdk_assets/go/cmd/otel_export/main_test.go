@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+type span struct {
+	TraceID, SpanID, ParentSpanID, Name string
+}
+
+// collector starts an OTLP/JSON traces endpoint, points the hook at it, and returns the spans it
+// receives.
+func collector(t *testing.T) func() []span {
+	t.Helper()
+	var mu sync.Mutex
+	var spans []span
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct{ Spans []span }
+			}
+		}
+		if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", srv.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/json")
+	t.Setenv("CODEX_HOOK_OTEL_STATE_DIR", t.TempDir())
+	return func() []span {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]span(nil), spans...)
+	}
+}
+
+func TestHandleExportsSessionTrace(t *testing.T) {
+	received := collector(t)
+	for _, b := range []*hooktest.Builder{
+		hooktest.SessionStart(),
+		hooktest.UserPromptSubmit(),
+		hooktest.ToolCallStarted(),
+		hooktest.ToolCallFinished(),
+		hooktest.AgentTurnComplete(),
+		hooktest.SessionEnd(),
+	} {
+		resp, err := handle(context.Background(), b.WithSessionID("s1").Build())
+		if err != nil || resp.Decision != hooksdk.DecisionAllow {
+			t.Fatalf("handle = %+v, %v", resp, err)
+		}
+	}
+
+	byName := map[string]span{}
+	for _, s := range received() {
+		byName[s.Name] = s
+	}
+	session, turn, tool := byName["session"], byName["turn"], byName["execute_tool Bash"]
+	if len(byName) != 3 || session.SpanID == "" || turn.SpanID == "" || tool.SpanID == "" {
+		t.Fatalf("spans = %+v, want session, turn, and tool call", byName)
+	}
+	if session.ParentSpanID != "" || turn.ParentSpanID != session.SpanID || tool.ParentSpanID != turn.SpanID {
+		t.Errorf("parents: session %q, turn %q (session %s), tool %q (turn %s)",
+			session.ParentSpanID, turn.ParentSpanID, session.SpanID, tool.ParentSpanID, turn.SpanID)
+	}
+	if session.TraceID != turn.TraceID || turn.TraceID != tool.TraceID {
+		t.Errorf("spans of one session in traces %s, %s, %s", session.TraceID, turn.TraceID, tool.TraceID)
+	}
+}
+
+func TestHandleAllowsWhenMisconfigured(t *testing.T) {
+	collector(t)
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	if resp, err := handle(context.Background(), hooktest.Notification().Build()); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("handle with a bad protocol = %+v, %v; want allow", resp, err)
+	}
+}
@@ -0,0 +1,187 @@
+// Command pipeline runs several built-in hooks, its stages, as one hook, in the order listed in
+// `$CODEX_HOME/hooks/config/pipeline.toml`:
+//
+//	stages = ["redact", "log", "guard"]   # the default
+//	continue_on_deny = false              # true runs every stage even after one denies
+//	log = "/var/log/xcodex/hooks.jsonl"   # the log stage's file, default $CODEX_HOME/hooks.jsonl
+//
+// The stages are:
+//
+//   - redact masks secrets in the payload (see hooksdk/redact) for the stages after it.
+//   - guard denies dangerous shell commands with guard_exec's rules and config.
+//   - log appends the event to a JSONL log, as cmd/log_jsonl does.
+//
+// The pipeline combines their responses as hooksdk.Pipeline describes, and lists each stage's
+// decision and duration in the response's metadata.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/guard"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/redact"
+	"example.com/xcodex/hooks-sdk/hooksdk/sink"
+)
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response. A deny from the guard
+	// stage makes the hook exit 2, which blocks the command.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest))
+}
+
+// selfTest checks, for `pipeline --self-test`, that the config and guard_exec's rules load and
+// the log stage's file can be written.
+func selfTest() []hooksdk.Check {
+	var cfg config
+	err := hooksdk.LoadConfig("pipeline", &cfg)
+	checks := []hooksdk.Check{hooksdk.CheckConfig("pipeline", err)}
+	if err != nil {
+		return checks
+	}
+	for _, name := range cfg.Stages {
+		switch name {
+		case stageGuard:
+			_, err := guardConfig()
+			checks = append(checks, hooksdk.CheckConfig("guard_exec", err))
+		case stageLog:
+			checks = append(checks, hooksdk.CheckWritable("log", cfg.Log))
+		}
+	}
+	return checks
+}
+
+// Stage names.
+const (
+	stageRedact = "redact"
+	stageGuard  = "guard"
+	stageLog    = "log"
+)
+
+// config is read from `$CODEX_HOME/hooks/config/pipeline.toml`; CODEX_HOOK_PIPELINE_STAGES (a
+// comma-separated list) and CODEX_HOOK_PIPELINE_CONTINUE_ON_DENY override it.
+type config struct {
+	// Stages are the names of the stages to run, in order. A stage may be listed more than once.
+	Stages []string `toml:"stages" default:"redact,log,guard"`
+	// ContinueOnDeny runs the stages after the first deny, collecting every stage's reasons.
+	ContinueOnDeny bool `toml:"continue_on_deny"`
+	// Log is the log stage's file.
+	Log string `toml:"log"`
+}
+
+func (c *config) Validate() error {
+	for i, name := range c.Stages {
+		switch name {
+		case stageRedact, stageGuard, stageLog:
+		default:
+			return fmt.Errorf("stages[%d]: must be %s, %s, or %s, not %q", i, stageRedact, stageGuard, stageLog, name)
+		}
+	}
+	if c.Log == "" {
+		c.Log = filepath.Join(hooksdk.Environ().CodexHome, "hooks.jsonl")
+	}
+	return nil
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	var cfg config
+	if err := hooksdk.LoadConfig("pipeline", &cfg); err != nil {
+		// The default stages still guard the agent's commands.
+		hooklog.Errorf("load config: %v; running the default stages", err)
+		cfg = config{Stages: []string{stageRedact, stageLog, stageGuard}}
+		_ = cfg.Validate()
+	}
+	return newPipeline(&cfg).Handle(ctx, payload)
+}
+
+// newPipeline builds the stages of cfg.
+func newPipeline(cfg *config) *hooksdk.Pipeline {
+	pl := &hooksdk.Pipeline{ContinueOnDeny: cfg.ContinueOnDeny}
+	for _, name := range cfg.Stages {
+		s := hooksdk.Stage{Name: name}
+		switch name {
+		case stageRedact:
+			s.Transform = redactPayload
+		case stageGuard:
+			s.Handler = guardCommand
+		case stageLog:
+			s.Handler = logEvent(sink.NewJSONL(cfg.Log, jsonl.OptionsFromEnv()))
+		}
+		pl.Stages = append(pl.Stages, s)
+	}
+	return pl
+}
+
+// redactPayload returns p with its secrets masked.
+func redactPayload(ctx context.Context, p *hooksdk.HookPayload) (*hooksdk.HookPayload, error) {
+	data, err := json.Marshal(redact.Redact(hooksdk.HookPayloadJSON(p.RawPayload)))
+	if err != nil {
+		return nil, err
+	}
+	return hooksdk.ParseHookPayload(data)
+}
+
+// guardCommand checks the command of an approval request or a shell tool call against guard_exec's
+// rules. Without a config file (or with a broken one) the built-in rules apply.
+func guardCommand(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+	var check func(*guard.Engine) guard.Verdict
+	switch p.EventType() {
+	case "approval-requested":
+		if len(p.Command) == 0 {
+			return hooksdk.Allow(), nil
+		}
+		check = func(e *guard.Engine) guard.Verdict { return e.CheckArgv(p.Command) }
+	case "tool-call-started":
+		command, ok := hooksdk.StringField(p.RawPayload, "tool_input.command")
+		if !ok {
+			return hooksdk.Allow(), nil
+		}
+		check = func(e *guard.Engine) guard.Verdict { return e.Check(command) }
+	default:
+		return hooksdk.Allow(), nil
+	}
+
+	cfg, err := guardConfig()
+	if err != nil {
+		hooklog.Errorf("load guard_exec config: %v; using the built-in rules only", err)
+		cfg = guard.DefaultConfig()
+	}
+	v := check(guard.New(cfg))
+	msg := fmt.Sprintf("guard rule %s: %s", v.Rule, v.Reason)
+	switch v.Action {
+	case guard.Deny:
+		return hooksdk.Deny(msg, hooksdk.WithReasonCode(v.Code), hooksdk.WithRule(v.Rule), hooksdk.WithSeverity(v.Severity)), nil
+	case guard.Ask:
+		resp := hooksdk.Ask(msg + ". Run it anyway?")
+		return resp.AddReason(hooksdk.Reason{Code: v.Code, Message: msg, Rule: v.Rule, Severity: v.Severity}), nil
+	}
+	return hooksdk.Allow(), nil
+}
+
+// guardConfig reads guard_exec's `$CODEX_HOME/hooks/config/guard_exec.toml`.
+func guardConfig() (*guard.Config, error) {
+	var file guard.File
+	if err := hooksdk.LoadConfig("guard_exec", &file); err != nil {
+		return nil, err
+	}
+	return file.Config()
+}
+
+// logEvent returns a stage that writes each event to s. A failed write is logged, not returned,
+// so it doesn't end the pipeline.
+func logEvent(s sink.Sink) hooksdk.Handler {
+	return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		if err := s.Write(ctx, hooksdk.HookPayloadJSON(p.RawPayload)); err != nil && !errors.Is(err, context.Canceled) {
+			hooklog.Errorf("log event: %v", err)
+		}
+		return hooksdk.Allow(), nil
+	}
+}
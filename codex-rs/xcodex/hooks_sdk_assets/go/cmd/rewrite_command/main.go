@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/guard"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// config is read from `$CODEX_HOME/hooks/config/rewrite_command.toml`, with
+// CODEX_HOOK_REWRITE_COMMAND_* overrides (see hooksdk.LoadConfig).
+type config struct {
+	// PipIndexURL, when set, is added as `--index-url` to `pip install` commands that don't name
+	// an index.
+	PipIndexURL string `toml:"pip_index_url"`
+	// KubectlDryRun, when set, is added as `--dry-run=<value>` to kubectl commands that change the
+	// cluster; empty turns the rule off.
+	KubectlDryRun string `toml:"kubectl_dry_run" default:"server"`
+}
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response. A response that
+	// modifies fields the event doesn't allow makes the hook fail instead.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest))
+}
+
+// selfTest checks, for `rewrite_command --self-test`, that the rewrite rules are valid and the host
+// applies modifications.
+func selfTest() []hooksdk.Check {
+	var cfg config
+	return []hooksdk.Check{
+		hooksdk.CheckConfig("rewrite_command", hooksdk.LoadConfig("rewrite_command", &cfg)),
+		hooksdk.CheckCapability(hooksdk.CapabilityModify, "rewritten commands"),
+	}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	var cfg config
+	if err := hooksdk.LoadConfig("rewrite_command", &cfg); err != nil {
+		hooklog.Errorf("load config: %v; leaving commands as they are", err)
+		return hooksdk.Allow(), nil
+	}
+
+	switch payload.EventType() {
+	case "approval-requested":
+		if argv, ok := rewriteArgv(cfg, payload.Command); ok {
+			return rewritten(strings.Join(argv, " "), "command", argv), nil
+		}
+	case "tool-call-started":
+		// Shell tools carry the command line as a string, or an argv like approvals do.
+		command, ok := hooksdk.Field[any](payload.RawPayload, "tool_input.command")
+		if !ok {
+			break
+		}
+		switch c := command.(type) {
+		case string:
+			if line, ok := rewriteLine(cfg, c); ok {
+				return rewritten(line, "tool_input.command", line), nil
+			}
+		case []any:
+			var argv []string
+			for _, item := range c {
+				s, ok := item.(string)
+				if !ok {
+					return hooksdk.Allow(), nil
+				}
+				argv = append(argv, s)
+			}
+			if argv, ok := rewriteArgv(cfg, argv); ok {
+				return rewritten(strings.Join(argv, " "), "tool_input.command", argv), nil
+			}
+		}
+	}
+	return hooksdk.Allow(), nil
+}
+
+// rewritten allows the command with the field at path replaced by value. A host that can't apply
+// the change gets a plain allow: the command runs as it was, where WriteResponse would deny it.
+func rewritten(display, path string, value any) hooksdk.Response {
+	if !hooksdk.HostSupports(hooksdk.CapabilityModify) {
+		hooklog.Warnf("not rewriting the command to %q: the host doesn't support %s", display, hooksdk.CapabilityModify)
+		return hooksdk.Allow()
+	}
+	hooklog.Infof("rewrote command to %q", display)
+	resp := hooksdk.Allow().ReplaceField(path, value)
+	resp.SystemMessage = "rewrite_command: running " + display
+	return resp
+}
+
+// rewriteArgv rewrites an argv, including the script of `bash -c`/`sh -lc` and the like.
+func rewriteArgv(cfg config, argv []string) ([]string, bool) {
+	if len(argv) == 3 && isShell(argv[0]) && (argv[1] == "-c" || argv[1] == "-lc") {
+		line, ok := rewriteLine(cfg, argv[2])
+		if !ok {
+			return nil, false
+		}
+		return []string{argv[0], argv[1], line}, true
+	}
+	return rewriteWords(cfg, argv)
+}
+
+// plainWord matches words that mean the same with or without shell quoting.
+var plainWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// rewriteLine rewrites a shell command line. Only a single simple command made of plain words is
+// rewritten: lists, pipes, redirections, substitutions, variables, and quoting are left alone,
+// since rebuilding them from the parsed words could change what runs.
+func rewriteLine(cfg config, line string) (string, bool) {
+	pipelines, err := guard.ParseShell(line)
+	if err != nil || len(pipelines) != 1 || len(pipelines[0]) != 1 {
+		return "", false
+	}
+	cmd := pipelines[0][0]
+	if len(cmd.Redirects) > 0 {
+		return "", false
+	}
+	for _, w := range cmd.Args {
+		if !plainWord.MatchString(w) {
+			return "", false
+		}
+	}
+	argv, ok := rewriteWords(cfg, cmd.Args)
+	if !ok {
+		return "", false
+	}
+	return strings.Join(argv, " "), true
+}
+
+// rewriteWords applies the configured rules to one command's words.
+func rewriteWords(cfg config, argv []string) ([]string, bool) {
+	if len(argv) < 2 {
+		return nil, false
+	}
+	name := argv[0][strings.LastIndexByte(argv[0], '/')+1:]
+	switch {
+	case cfg.PipIndexURL != "" && (name == "pip" || name == "pip3") && argv[1] == "install":
+		if hasFlag(argv, "--index-url", "-i") {
+			return nil, false
+		}
+		return insert(argv, 2, "--index-url", cfg.PipIndexURL), true
+	case cfg.KubectlDryRun != "" && name == "kubectl" && mutatesCluster(argv[1]):
+		if hasFlag(argv, "--dry-run") {
+			return nil, false
+		}
+		return insert(argv, len(argv), "--dry-run="+cfg.KubectlDryRun), true
+	}
+	return nil, false
+}
+
+func mutatesCluster(verb string) bool {
+	switch verb {
+	case "apply", "create", "delete", "patch", "replace", "scale":
+		return true
+	}
+	return false
+}
+
+func hasFlag(argv []string, flags ...string) bool {
+	for _, a := range argv {
+		for _, f := range flags {
+			if a == f || strings.HasPrefix(a, f+"=") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func insert(argv []string, at int, words ...string) []string {
+	out := append([]string(nil), argv[:at]...)
+	out = append(out, words...)
+	return append(out, argv[at:]...)
+}
+
+func isShell(name string) bool {
+	switch name[strings.LastIndexByte(name, '/')+1:] {
+	case "bash", "sh", "zsh", "dash":
+		return true
+	}
+	return false
+}
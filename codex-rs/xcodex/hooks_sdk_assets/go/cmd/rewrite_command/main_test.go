@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestRewriteLine(t *testing.T) {
+	cfg := config{PipIndexURL: "https://pypi.internal/simple", KubectlDryRun: "server"}
+	tests := map[string]string{
+		"pip install requests":                "pip install --index-url https://pypi.internal/simple requests",
+		"/usr/bin/pip3 install -U x":          "/usr/bin/pip3 install --index-url https://pypi.internal/simple -U x",
+		"kubectl apply -f deploy.yaml":        "kubectl apply -f deploy.yaml --dry-run=server",
+		"kubectl delete pod web-1":            "kubectl delete pod web-1 --dry-run=server",
+		"pip install -i https://other x":      "",
+		"pip install --index-url=https://o x": "",
+		"kubectl apply --dry-run=client -f x": "",
+		"kubectl get pods":                    "",
+		"pip list":                            "",
+		"pip":                                 "",
+		"pip install x && rm -rf build":       "",
+		"pip install x | tee log":             "",
+		"pip install x > log":                 "",
+		`pip install "$PKG"`:                  "",
+		"kubectl apply -f $(ls *.yaml)":       "",
+		"echo kubectl apply -f x":             "",
+		"pip install 'requests[security]'":    "",
+		"ls -l":                               "",
+		`echo "unterminated`:                  "",
+	}
+	for line, want := range tests {
+		got, ok := rewriteLine(cfg, line)
+		if ok != (want != "") || got != want {
+			t.Errorf("rewriteLine(%q) = %q, %v; want %q", line, got, ok, want)
+		}
+	}
+
+	// Empty settings turn a rule off.
+	if got, ok := rewriteLine(config{}, "kubectl apply -f x"); ok {
+		t.Errorf("rewrote with no rules: %q", got)
+	}
+}
+
+func TestRewriteArgv(t *testing.T) {
+	cfg := config{KubectlDryRun: "client"}
+	tests := []struct {
+		argv, want []string
+	}{
+		{[]string{"kubectl", "scale", "deploy/web", "--replicas=0"}, []string{"kubectl", "scale", "deploy/web", "--replicas=0", "--dry-run=client"}},
+		{[]string{"bash", "-lc", "kubectl create ns x"}, []string{"bash", "-lc", "kubectl create ns x --dry-run=client"}},
+		{[]string{"/bin/sh", "-c", "kubectl apply -f x; echo done"}, nil},
+		{[]string{"zsh", "-c", "ls"}, nil},
+		{[]string{"kubectl"}, nil},
+	}
+	for _, tt := range tests {
+		got, ok := rewriteArgv(cfg, tt.argv)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("rewriteArgv(%q) = %q, %v; want %q", tt.argv, got, ok, tt.want)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_REWRITE_COMMAND_PIP_INDEX_URL", "https://pypi.internal/simple")
+	t.Setenv("CODEX_HOOK_REWRITE_COMMAND_KUBECTL_DRY_RUN", "")
+	t.Setenv(hooksdk.CapabilitiesEnv, hooksdk.CapabilityModify)
+
+	run := func(b *hooktest.Builder) hooksdk.Response {
+		t.Helper()
+		resp, err := handle(context.Background(), b.Build())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := resp.CheckModify(b.Build().Type()); err != nil {
+			t.Errorf("handle's modification is rejected: %v", err)
+		}
+		return resp
+	}
+
+	resp := run(hooktest.ToolCallStarted().WithCommand("pip install x"))
+	want := map[string]any{"tool_input": map[string]any{"command": "pip install --index-url https://pypi.internal/simple x"}}
+	if resp.Decision != hooksdk.DecisionAllow || !reflect.DeepEqual(resp.Modify, want) || resp.SystemMessage == "" {
+		t.Errorf("string command: %+v", resp)
+	}
+
+	resp = run(hooktest.ToolCallStarted().With("tool_input", map[string]any{"command": []any{"pip", "install", "x"}}))
+	want = map[string]any{"tool_input": map[string]any{"command": []string{"pip", "install", "--index-url", "https://pypi.internal/simple", "x"}}}
+	if !reflect.DeepEqual(resp.Modify, want) {
+		t.Errorf("argv command: Modify = %v, want %v", resp.Modify, want)
+	}
+
+	resp = run(hooktest.ApprovalRequested().WithCommand("pip install x"))
+	if want := map[string]any{"command": []string{"pip", "install", "--index-url", "https://pypi.internal/simple", "x"}}; !reflect.DeepEqual(resp.Modify, want) {
+		t.Errorf("approval: Modify = %v, want %v", resp.Modify, want)
+	}
+
+	for name, b := range map[string]*hooktest.Builder{
+		"unchanged":     hooktest.ToolCallStarted().WithCommand("ls"),
+		"no command":    hooktest.ToolCallStarted().With("tool_input", map[string]any{"path": "x"}),
+		"mixed argv":    hooktest.ToolCallStarted().With("tool_input", map[string]any{"command": []any{"pip", 1}}),
+		"other event":   hooktest.SessionStart(),
+		"finished call": hooktest.ToolCallFinished(),
+	} {
+		if resp := run(b); resp.Decision != hooksdk.DecisionAllow || resp.Modify != nil {
+			t.Errorf("%s: %+v, want a plain allow", name, resp)
+		}
+	}
+
+	// A host that can't apply modifications gets a plain allow.
+	t.Setenv(hooksdk.CapabilitiesEnv, "")
+	if resp := run(hooktest.ApprovalRequested().WithCommand("pip install x")); resp.Modify != nil {
+		t.Errorf("without %s: %+v, want a plain allow", hooksdk.CapabilityModify, resp)
+	}
+}
+
+func TestHandleConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv(hooksdk.CapabilitiesEnv, hooksdk.CapabilityModify)
+	t.Setenv("CODEX_HOOK_REWRITE_COMMAND_PIP_INDEX_URL", "")
+	t.Setenv("CODEX_HOOK_REWRITE_COMMAND_KUBECTL_DRY_RUN", "")
+	approval := hooktest.ApprovalRequested().WithCommand("kubectl apply -f x").Build()
+
+	// Without a config file the defaults apply: kubectl gets --dry-run=server.
+	resp, err := handle(context.Background(), approval)
+	if err != nil || !reflect.DeepEqual(resp.Modify, map[string]any{"command": []string{"kubectl", "apply", "-f", "x", "--dry-run=server"}}) {
+		t.Errorf("defaults: %+v, %v", resp, err)
+	}
+
+	// A config that doesn't load leaves commands alone.
+	path := hooksdk.ConfigPath("rewrite_command")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("kubectl_dry_run = true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := handle(context.Background(), approval); err != nil || resp.Decision != hooksdk.DecisionAllow || resp.Modify != nil {
+		t.Errorf("bad config: %+v, %v; want a plain allow", resp, err)
+	}
+}
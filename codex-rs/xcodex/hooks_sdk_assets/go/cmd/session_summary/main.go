@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/aggregate"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `session_summary --self-test`, that summaries can be written.
+func selfTest() []hooksdk.Check {
+	return []hooksdk.Check{hooksdk.CheckWritable("summary directory", summaryDir())}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	agg := aggregate.New(summaryDir())
+	// CODEX_HOOK_SUMMARY_TTL is how long a session may be quiet before it is summarized without
+	// its session-end (a Go duration, default 24h; 0 waits forever).
+	if v := os.Getenv("CODEX_HOOK_SUMMARY_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			hooklog.Warnf("ignoring CODEX_HOOK_SUMMARY_TTL: %v", err)
+		} else {
+			agg.TTL = ttl
+		}
+	}
+	// CODEX_HOOK_SUMMARY_TZ (else CODEX_HOOK_TZ) is the zone of the times in summaries.txt; unset,
+	// they are in UTC, as those in summaries.jsonl always are.
+	if name := os.Getenv("CODEX_HOOK_SUMMARY_TZ"); name != "" || hooksdk.Environ().TZ != "" {
+		loc, err := summarize.Location(name)
+		if err != nil {
+			hooklog.Warnf("ignoring the time zone: %v", err)
+		} else {
+			agg.Location = loc
+		}
+	}
+	summary, err := agg.Observe(payload)
+	if err != nil {
+		hooklog.Errorf("record session summary: %v", err)
+		return hooksdk.Allow(), nil
+	}
+
+	resp := hooksdk.Allow()
+	if summary != nil && os.Getenv("CODEX_HOOK_SUMMARY_MESSAGE") == "1" {
+		resp.SystemMessage = summary.Message()
+	}
+	return resp, nil
+}
+
+// summaryDir is CODEX_HOOK_SUMMARY_DIR, or `$CODEX_HOME/hooks/summaries`.
+func summaryDir() string {
+	if dir := os.Getenv("CODEX_HOOK_SUMMARY_DIR"); dir != "" {
+		return dir
+	}
+	return hooksdk.Environ().Path("hooks", "summaries")
+}
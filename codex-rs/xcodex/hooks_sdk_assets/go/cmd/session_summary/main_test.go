@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func run(t *testing.T, b *hooktest.Builder) hooksdk.Response {
+	t.Helper()
+	resp, err := handle(context.Background(), b.Build())
+	if err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle = %+v, %v; want allow", resp, err)
+	}
+	return resp
+}
+
+func TestHandle(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOK_SUMMARY_DIR", "")
+	t.Setenv("CODEX_HOOK_SUMMARY_MESSAGE", "1")
+	t.Setenv("CODEX_HOOK_SUMMARY_TZ", "")
+	t.Setenv("CODEX_HOOK_TZ", "")
+
+	for _, b := range []*hooktest.Builder{hooktest.SessionStart(), hooktest.UserPromptSubmit(), hooktest.ToolCallFinished()} {
+		if resp := run(t, b); resp.SystemMessage != "" {
+			t.Errorf("%s: system message %q before session-end", b.Build().EventType(), resp.SystemMessage)
+		}
+	}
+	resp := run(t, hooktest.SessionEnd())
+	if want := "Session summary: 0s, 1 prompt(s), 1 tool call(s), 0 file(s) touched"; resp.SystemMessage != want {
+		t.Errorf("system message = %q, want %q", resp.SystemMessage, want)
+	}
+	dir := filepath.Join(home, "hooks", "summaries")
+	for name, want := range map[string]string{"summaries.jsonl": `"session_id":"test-session"`, "summaries.txt": "Session " + hooksdk.ShortID("test-session") + "\n"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || !strings.Contains(string(data), want) {
+			t.Errorf("%s = %q, %v; want it to contain %q", name, data, err, want)
+		}
+	}
+
+	// Without CODEX_HOOK_SUMMARY_MESSAGE the summary is only written.
+	t.Setenv("CODEX_HOOK_SUMMARY_MESSAGE", "")
+	run(t, hooktest.SessionStart())
+	if resp := run(t, hooktest.SessionEnd()); resp.SystemMessage != "" {
+		t.Errorf("system message %q without CODEX_HOOK_SUMMARY_MESSAGE", resp.SystemMessage)
+	}
+}
+
+func TestHandleSettings(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "digests")
+	t.Setenv("CODEX_HOOK_SUMMARY_DIR", dir)
+	t.Setenv("CODEX_HOOK_SUMMARY_TZ", "Asia/Tokyo")
+	// An invalid TTL is ignored, keeping the default.
+	t.Setenv("CODEX_HOOK_SUMMARY_TTL", "soon")
+	run(t, hooktest.SessionStart())
+	run(t, hooktest.SessionEnd())
+	text, err := os.ReadFile(filepath.Join(dir, "summaries.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "09:00") {
+		t.Errorf("summaries.txt isn't in CODEX_HOOK_SUMMARY_TZ:\n%s", text)
+	}
+
+	// A session quiet past the TTL is flushed by the next event.
+	t.Setenv("CODEX_HOOK_SUMMARY_TTL", "1h")
+	run(t, hooktest.SessionStart().WithSessionID("crashed"))
+	run(t, hooktest.SessionStart().WithSessionID("next"))
+	data, err := os.ReadFile(filepath.Join(dir, "summaries.jsonl"))
+	if err != nil || !strings.Contains(string(data), `"session_id":"crashed"`) || !strings.Contains(string(data), `"expired":true`) {
+		t.Errorf("summaries.jsonl = %s, %v; want the crashed session expired", data, err)
+	}
+}
+
+func TestHandleFailsOpen(t *testing.T) {
+	blocked := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOOK_SUMMARY_DIR", blocked)
+	t.Setenv("CODEX_HOOK_SUMMARY_MESSAGE", "1")
+	if resp := run(t, hooktest.SessionEnd()); resp.SystemMessage != "" {
+		t.Errorf("system message %q without a summary", resp.SystemMessage)
+	}
+	if checks := selfTest(); len(checks) != 1 {
+		t.Errorf("selfTest() = %v", checks)
+	}
+}
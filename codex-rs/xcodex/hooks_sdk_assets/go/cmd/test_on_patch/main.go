@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/run"
+)
+
+const (
+	// stateLock guards the state file; it is held only to read and write it.
+	stateLock = "test_on_patch-state"
+	stateWait = 5 * time.Second
+
+	// stateTTL is how long a directory's entry is kept after its last patch.
+	stateTTL = 24 * time.Hour
+
+	// npmDefaultTest is the test script `npm init` writes, which only fails.
+	npmDefaultTest = `echo "Error: no test specified" && exit 1`
+)
+
+// config is read from `$CODEX_HOME/hooks/config/test.toml`; CODEX_HOOK_TEST_COMMAND,
+// CODEX_HOOK_TEST_TIMEOUT, ... override it.
+type config struct {
+	// Command is the test command, split on spaces. Empty means by project type: `go test ./...`
+	// with a go.mod, `npm test` with a package.json that has a test script.
+	Command string `toml:"command"`
+	// Timeout bounds the test run.
+	Timeout time.Duration `toml:"timeout" default:"5m"`
+	// MaxOutput is how much of the end of a failing run's output is fed back, in bytes (at most
+	// hooksdk.MaxAdditionalContextBytes).
+	MaxOutput int `toml:"max_output" default:"8192"`
+	// Queue sends the failure as a user message after the turn instead of as context for the
+	// current one.
+	Queue bool `toml:"queue"`
+	// Debounce is how long to wait after a patch for another one; only the last patch of a burst
+	// runs the tests. 0 runs them after every patch.
+	Debounce time.Duration `toml:"debounce" default:"2s"`
+	// Env names more variables of the hook's environment the tests get, beyond run.DefaultAllow
+	// (e.g. DATABASE_URL); a name ending in `*` is a prefix.
+	Env []string `toml:"env"`
+}
+
+func (c *config) Validate() error {
+	if c.MaxOutput < 1024 {
+		return errors.New("max_output must be at least 1024")
+	}
+	if c.Debounce < 0 {
+		return errors.New("debounce must not be negative")
+	}
+	c.MaxOutput = min(c.MaxOutput, hooksdk.MaxAdditionalContextBytes)
+	return nil
+}
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response. The hook never blocks
+	// the agent: failures are fed back as context on an allow response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest))
+}
+
+// selfTest checks, for `test_on_patch --self-test`, that the config loads, the host passes
+// failures on to the agent as the config sends them, and the test command, if set, is installed
+// (detected commands depend on the project, so aren't checked).
+func selfTest() []hooksdk.Check {
+	var cfg config
+	err := hooksdk.LoadConfig("test", &cfg)
+	feedback := hooksdk.CapabilityAdditionalContext
+	if cfg.Queue {
+		feedback = hooksdk.CapabilityQueuedUserMessages
+	}
+	checks := []hooksdk.Check{
+		hooksdk.CheckConfig("test", err),
+		hooksdk.CheckWritable("state", statePath()),
+		hooksdk.CheckCapability(feedback, "test failures"),
+	}
+	if args := strings.Fields(cfg.Command); len(args) > 0 {
+		checks = append(checks, hooksdk.CheckCommand("test command", args[0]))
+	}
+	return checks
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	if payload.EventType() != "tool-call-finished" || payload.Success == nil || !*payload.Success {
+		return hooksdk.Allow(), nil
+	}
+	dir := payload.WorkingDir()
+	if dir == "" || len(gitsnap.TouchedPaths(payload.ToolInput)) == 0 {
+		return hooksdk.Allow(), nil
+	}
+	var cfg config
+	if err := hooksdk.LoadConfig("test", &cfg); err != nil {
+		hooklog.Errorf("load config: %v; tests not run", err)
+		return hooksdk.Allow(), nil
+	}
+	command := cfg.Command
+	if command == "" {
+		command = detect(dir)
+	}
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return hooksdk.Allow(), nil
+	}
+
+	if !lastPatch(ctx, dir, cfg.Debounce) {
+		return hooksdk.Allow(), nil
+	}
+	// Runs in one directory take turns, so a burst that outlasts the window doesn't start the
+	// tests twice at once.
+	var res *run.Result
+	var err error
+	lockErr := hooksdk.WithLock("test_on_patch:"+dir, cfg.Timeout, func() error {
+		cmd := run.Command(ctx, args[0], args[1:]...)
+		cmd.Payload = payload
+		cmd.Timeout = cfg.Timeout
+		cmd.Allow = append(append([]string(nil), run.DefaultAllow...), cfg.Env...)
+		// Only the end of the output is fed back.
+		cmd.MaxOutput = cfg.MaxOutput
+		cmd.Tail = true
+		cmd.MergeStderr = true
+		res, err = cmd.Run()
+		return nil
+	})
+	var exitErr *exec.ExitError
+	switch {
+	case lockErr != nil:
+		hooklog.Warnf("tests not run: %v", lockErr)
+		return hooksdk.Allow(), nil
+	case err == nil:
+		hooklog.Infof("%s passed in %v", command, res.Duration.Round(time.Millisecond))
+		return hooksdk.Allow(), nil
+	case res.TimedOut:
+		hooklog.Warnf("%s did not finish within %v", command, cfg.Timeout)
+		return hooksdk.Allow(), nil
+	case !errors.As(err, &exitErr):
+		// The command couldn't be started: a setup problem, not something the agent can fix.
+		hooklog.Errorf("run %s: %v", command, err)
+		return hooksdk.Allow(), nil
+	}
+
+	header := fmt.Sprintf("`%s` failed (exit %d) after the last patch:\n", command, exitErr.ExitCode())
+	feedback := header + tail(string(res.Stdout), cfg.MaxOutput-len(header))
+	if cfg.Queue {
+		return hooksdk.Allow().QueueUserMessage(feedback), nil
+	}
+	return hooksdk.Allow().InjectContext(feedback), nil
+}
+
+// detect returns the test command for the project in dir, or "" when there is none: `go test ./...`
+// for a Go module, `npm test` for a package.json with a test script of its own.
+func detect(dir string) string {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		return "go test ./..."
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return ""
+	}
+	var pkg struct {
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		hooklog.Warnf("read package.json: %v", err)
+		return ""
+	}
+	if test := strings.TrimSpace(pkg.Scripts["test"]); test == "" || test == npmDefaultTest {
+		return ""
+	}
+	return "npm test"
+}
+
+// state is the debounce state, `hooks/state/test_on_patch.json` under CODEX_HOME: the last patch
+// seen in each directory.
+type state map[string]patch
+
+type patch struct {
+	// Seq counts the directory's patches; the hook that recorded the current one runs the tests.
+	Seq int64     `json:"seq"`
+	At  time.Time `json:"at"`
+}
+
+func statePath() string {
+	return hooksdk.Environ().Path("hooks", "state", "test_on_patch.json")
+}
+
+// lastPatch records a patch in dir, waits for debounce, and reports whether no patch came after
+// it, so this hook should run the tests. When the state can't be read or saved the tests run.
+func lastPatch(ctx context.Context, dir string, debounce time.Duration) bool {
+	if debounce == 0 {
+		return true
+	}
+	var seq int64
+	err := hooksdk.WithLock(stateLock, stateWait, func() error {
+		st := loadState()
+		seq = st[dir].Seq + 1
+		st[dir] = patch{Seq: seq, At: time.Now()}
+		return st.save()
+	})
+	if err != nil {
+		hooklog.Warnf("debounce state: %v", err)
+		return true
+	}
+	select {
+	case <-time.After(debounce):
+	case <-ctx.Done():
+		return false
+	}
+	var latest int64
+	err = hooksdk.WithLock(stateLock, stateWait, func() error {
+		latest = loadState()[dir].Seq
+		return nil
+	})
+	if err != nil {
+		hooklog.Warnf("debounce state: %v", err)
+		return true
+	}
+	if latest != seq {
+		hooklog.Debugf("another patch followed within %v; leaving the tests to it", debounce)
+		return false
+	}
+	return true
+}
+
+// loadState reads the state; a missing or unreadable file is an empty state.
+func loadState() state {
+	st := state{}
+	data, err := os.ReadFile(statePath())
+	if err != nil {
+		return st
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		hooklog.Warnf("ignoring %s: %v", statePath(), err)
+		return state{}
+	}
+	return st
+}
+
+// save writes the state, dropping directories without a patch for stateTTL. Callers hold
+// stateLock; the temp file and rename keep a crash from leaving it half-written.
+func (st state) save() error {
+	for dir, p := range st {
+		if time.Since(p.At) > stateTTL {
+			delete(st, dir)
+		}
+	}
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := statePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// tail returns the end of output in at most maxBytes, starting on a line boundary when it has to
+// cut: the failures and the summary come last.
+func tail(output string, maxBytes int) string {
+	if len(output) <= maxBytes {
+		return output
+	}
+	const marker = "[earlier output omitted]\n"
+	cut := len(output) - (maxBytes - len(marker))
+	if i := strings.IndexByte(output[cut:], '\n'); i >= 0 && i < len(output)-cut-1 {
+		cut += i + 1
+	}
+	for cut < len(output) && !utf8.RuneStart(output[cut]) {
+		cut++
+	}
+	return marker + output[cut:]
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// project makes a directory with the test script script (a POSIX shell script) and points the
+// hook at it, with no debounce.
+func project(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("test scripts are shell scripts")
+	}
+	home, dir := t.TempDir(), t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOK_TEST_COMMAND", "sh test.sh")
+	t.Setenv("CODEX_HOOK_TEST_DEBOUNCE", "0s")
+	t.Setenv("CODEX_HOOK_TEST_QUEUE", "")
+	t.Setenv("CODEX_HOOK_TEST_MAX_OUTPUT", "")
+	if err := os.WriteFile(filepath.Join(dir, "test.sh"), []byte(script), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// patched is a successful apply_patch call in dir.
+func patched(dir string) *hooktest.Builder {
+	return hooktest.ToolCallFinished().WithToolName("apply_patch").WithCwd(dir).
+		With("tool_input", map[string]any{"input": "*** Begin Patch\n*** Update File: a.go\n@@\n-a\n+b\n*** End Patch\n"})
+}
+
+func respond(t *testing.T, b *hooktest.Builder) hooksdk.Response {
+	t.Helper()
+	resp, err := handle(context.Background(), b.Build())
+	if err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle = %+v, %v; want allow", resp, err)
+	}
+	return resp
+}
+
+func TestHandleFeedsBackFailures(t *testing.T) {
+	dir := project(t, "echo '--- FAIL: TestX'\necho 'FAIL example.com/pkg' >&2\nexit 3\n")
+	resp := respond(t, patched(dir))
+	want := "`sh test.sh` failed (exit 3) after the last patch:\n--- FAIL: TestX\nFAIL example.com/pkg\n"
+	if resp.AdditionalContext != want || resp.QueuedUserMessages != nil {
+		t.Errorf("response = %+v, want context %q", resp, want)
+	}
+
+	t.Setenv("CODEX_HOOK_TEST_QUEUE", "true")
+	resp = respond(t, patched(dir))
+	if resp.AdditionalContext != "" || len(resp.QueuedUserMessages) != 1 || resp.QueuedUserMessages[0] != want {
+		t.Errorf("queued response = %+v", resp)
+	}
+}
+
+func TestHandleTrimsOutput(t *testing.T) {
+	dir := project(t, "i=0\nwhile [ $i -lt 2000 ]; do echo \"line $i of the output\"; i=$((i+1)); done\necho 'FAIL at the end'\nexit 1\n")
+	t.Setenv("CODEX_HOOK_TEST_MAX_OUTPUT", "2048")
+	ctx := respond(t, patched(dir)).AdditionalContext
+	if len(ctx) > 2048 || !strings.Contains(ctx, "[earlier output omitted]\nline ") || !strings.HasSuffix(ctx, "FAIL at the end\n") {
+		t.Errorf("context of %d bytes:\n%s", len(ctx), ctx)
+	}
+	if strings.Contains(ctx, "line 0 of") {
+		t.Error("context kept the start of the output")
+	}
+}
+
+func TestHandleEnvironment(t *testing.T) {
+	// The tests get a scrubbed environment, plus what `env` names.
+	dir := project(t, "echo \"key=${OPENAI_API_KEY-unset} home=${CODEX_HOME-unset} db=$DATABASE_URL\"\nexit 1\n")
+	t.Setenv("OPENAI_API_KEY", "sk-secret")
+	t.Setenv("DATABASE_URL", "postgres://db")
+	t.Setenv("CODEX_HOOK_TEST_ENV", "DATABASE_*")
+	if ctx := respond(t, patched(dir)).AdditionalContext; !strings.HasSuffix(ctx, "\nkey=unset home=unset db=postgres://db\n") {
+		t.Errorf("context %q", ctx)
+	}
+}
+
+func TestHandleTimeout(t *testing.T) {
+	// The test run and what it started in the background are killed at the timeout.
+	dir := project(t, "while :; do echo . >> ticks; sleep 0.05; done &\nwait\n")
+	t.Setenv("CODEX_HOOK_TEST_TIMEOUT", "300ms")
+	start := time.Now()
+	if resp := respond(t, patched(dir)); resp.AdditionalContext != "" {
+		t.Errorf("context %q", resp.AdditionalContext)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("handle took %v with a 300ms timeout", elapsed)
+	}
+	size := func() int64 {
+		info, err := os.Stat(filepath.Join(dir, "ticks"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	before := size()
+	time.Sleep(300 * time.Millisecond)
+	if after := size(); after != before {
+		t.Errorf("the background loop outlived the timeout: %d bytes, then %d", before, after)
+	}
+}
+
+func TestHandleSkips(t *testing.T) {
+	dir := project(t, "echo ran >> ran.txt\nexit 1\n")
+	for name, b := range map[string]*hooktest.Builder{
+		"failed call":    patched(dir).With("success", false),
+		"no files":       hooktest.ToolCallFinished().WithCwd(dir),
+		"other event":    hooktest.ToolCallStarted().WithCwd(dir),
+		"no working dir": patched("").With("cwd", nil),
+	} {
+		if resp := respond(t, b); resp.AdditionalContext != "" {
+			t.Errorf("%s: context %q", name, resp.AdditionalContext)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ran.txt")); !os.IsNotExist(err) {
+		t.Errorf("tests ran: %v", err)
+	}
+
+	// A passing run, or a command that can't start, feeds nothing back.
+	if err := os.WriteFile(filepath.Join(dir, "test.sh"), []byte("exit 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if resp := respond(t, patched(dir)); resp.AdditionalContext != "" {
+		t.Errorf("passing run: context %q", resp.AdditionalContext)
+	}
+	t.Setenv("CODEX_HOOK_TEST_COMMAND", "no-such-test-runner")
+	if resp := respond(t, patched(dir)); resp.AdditionalContext != "" {
+		t.Errorf("missing command: context %q", resp.AdditionalContext)
+	}
+	// A bad config runs nothing.
+	t.Setenv("CODEX_HOOK_TEST_MAX_OUTPUT", "10")
+	if resp := respond(t, patched(dir)); resp.AdditionalContext != "" {
+		t.Errorf("bad config: context %q", resp.AdditionalContext)
+	}
+}
+
+func TestHandleDebounces(t *testing.T) {
+	dir := project(t, "echo ran >> ran.txt\nexit 1\n")
+	t.Setenv("CODEX_HOOK_TEST_DEBOUNCE", "300ms")
+	var wg sync.WaitGroup
+	fed := make([]bool, 3)
+	for i := range fed {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := handle(context.Background(), patched(dir).Build())
+			fed[i] = err == nil && resp.AdditionalContext != ""
+		}(i)
+	}
+	wg.Wait()
+	data, err := os.ReadFile(filepath.Join(dir, "ran.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs := strings.Count(string(data), "ran\n"); runs != 1 {
+		t.Errorf("a burst of 3 patches ran the tests %d times, want 1", runs)
+	}
+	n := 0
+	for _, ok := range fed {
+		if ok {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("%d hooks fed back the failure, want 1", n)
+	}
+}
+
+// fixture points the hook at the project testdata/name, whose test command is detected, with no
+// debounce.
+func fixture(t *testing.T, name, program string) string {
+	t.Helper()
+	if _, err := exec.LookPath(program); err != nil {
+		t.Skipf("%s isn't installed", program)
+	}
+	dir, err := filepath.Abs(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_TEST_COMMAND", "")
+	t.Setenv("CODEX_HOOK_TEST_DEBOUNCE", "0s")
+	t.Setenv("CODEX_HOOK_TEST_QUEUE", "")
+	t.Setenv("CODEX_HOOK_TEST_MAX_OUTPUT", "")
+	return dir
+}
+
+func TestHandleFixtures(t *testing.T) {
+	for _, tt := range []struct {
+		project, program, command, failure string
+	}{
+		{"go_pass", "go", "go test ./...", ""},
+		{"go_fail", "go", "go test ./...", "Sum(2, 2) = 4, want 5"},
+		{"npm_pass", "npm", "npm test", ""},
+		{"npm_fail", "npm", "npm test", "2 + 2 should be 5"},
+	} {
+		t.Run(tt.project, func(t *testing.T) {
+			dir := fixture(t, tt.project, tt.program)
+			ctx := respond(t, patched(dir)).AdditionalContext
+			if tt.failure == "" {
+				if ctx != "" {
+					t.Errorf("passing tests fed back %q", ctx)
+				}
+				return
+			}
+			if !strings.HasPrefix(ctx, "`"+tt.command+"` failed (exit 1) after the last patch:\n") || !strings.Contains(ctx, tt.failure) {
+				t.Errorf("context = %q, want the failure %q", ctx, tt.failure)
+			}
+		})
+	}
+}
+
+func TestDebounceState(t *testing.T) {
+	dir := project(t, "exit 0\n")
+	t.Setenv("CODEX_HOOK_TEST_DEBOUNCE", "10ms")
+	// An entry past stateTTL is dropped when the state is next saved; a recent one is kept.
+	old, recent := time.Now().Add(-stateTTL-time.Hour), time.Now().Add(-time.Hour)
+	data, _ := json.Marshal(state{"/old": {Seq: 7, At: old}, "/recent": {Seq: 2, At: recent}})
+	os.MkdirAll(filepath.Dir(statePath()), 0o755)
+	if err := os.WriteFile(statePath(), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		respond(t, patched(dir))
+	}
+	st := loadState()
+	if len(st) != 2 || st[dir].Seq != 2 || time.Since(st[dir].At) > time.Minute || st["/recent"].Seq != 2 {
+		t.Errorf("state = %+v", st)
+	}
+	if leftovers, _ := filepath.Glob(statePath() + ".tmp"); len(leftovers) != 0 {
+		t.Errorf("temp files left: %q", leftovers)
+	}
+
+	// Without debounce the state isn't touched.
+	t.Setenv("CODEX_HOOK_TEST_DEBOUNCE", "0s")
+	respond(t, patched(dir))
+	if st := loadState(); st[dir].Seq != 2 {
+		t.Errorf("state without debounce = %+v", st)
+	}
+
+	// A corrupt state file counts as empty: the tests still run.
+	os.WriteFile(statePath(), []byte("{corrupt"), 0o644)
+	t.Setenv("CODEX_HOOK_TEST_DEBOUNCE", "10ms")
+	os.WriteFile(filepath.Join(dir, "test.sh"), []byte("echo failed\nexit 1\n"), 0o644)
+	if ctx := respond(t, patched(dir)).AdditionalContext; !strings.Contains(ctx, "failed") {
+		t.Errorf("with a corrupt state: context %q", ctx)
+	}
+	if st := loadState(); st[dir].Seq != 1 {
+		t.Errorf("state after a corrupt one = %+v", st)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	write := func(dir, name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	goMod, npm, npmDefault, none := t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()
+	write(goMod, "go.mod", "module x\n")
+	write(npm, "package.json", `{"scripts": {"test": "vitest run"}}`)
+	write(npmDefault, "package.json", `{"scripts": {"test": "`+strings.ReplaceAll(npmDefaultTest, `"`, `\"`)+`"}}`)
+	write(none, "package.json", "{not json")
+	for dir, want := range map[string]string{goMod: "go test ./...", npm: "npm test", npmDefault: "", none: "", t.TempDir(): ""} {
+		if got := detect(dir); got != want {
+			t.Errorf("detect(%s) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	if got := tail("short", 100); got != "short" {
+		t.Errorf("tail of short output = %q", got)
+	}
+	out := strings.Repeat("0123456789\n", 20)
+	got := tail(out, 60)
+	if len(got) > 60 || !strings.HasPrefix(got, "[earlier output omitted]\n0123") || !strings.HasSuffix(out, strings.TrimPrefix(got, "[earlier output omitted]\n")) {
+		t.Errorf("tail = %q", got)
+	}
+	// A cut never splits a character.
+	got = tail(strings.Repeat("é", 100), 40)
+	if !strings.HasPrefix(got, "[earlier output omitted]\né") || len(got) > 40 {
+		t.Errorf("tail of multibyte output = %q", got)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	// The self-test checks the host passes failures on as the config sends them.
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_TEST_COMMAND", "")
+	for _, tt := range []struct {
+		queue, capabilities, want string
+	}{
+		{"", hooksdk.CapabilityAdditionalContext, "PASS  host supports additional_context"},
+		{"", hooksdk.CapabilityQueuedUserMessages, "FAIL  host supports additional_context"},
+		{"true", hooksdk.CapabilityQueuedUserMessages, "PASS  host supports queued_user_messages"},
+		{"true", "", "FAIL  host supports queued_user_messages"},
+	} {
+		t.Setenv("CODEX_HOOK_TEST_QUEUE", tt.queue)
+		t.Setenv(hooksdk.CapabilitiesEnv, tt.capabilities)
+		var out strings.Builder
+		hooksdk.IO{Out: &out, Err: io.Discard, Getenv: os.Getenv}.SelfTest(context.Background(), selfTest()...)
+		if !strings.Contains(out.String(), tt.want) {
+			t.Errorf("queue %q, capabilities %q: no %q in\n%s", tt.queue, tt.capabilities, tt.want, out.String())
+		}
+	}
+}
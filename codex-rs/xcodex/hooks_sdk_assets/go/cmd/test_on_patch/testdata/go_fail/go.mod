@@ -0,0 +1,3 @@
+module example.com/go_fail
+
+go 1.21
@@ -0,0 +1,9 @@
+package sum
+
+import "testing"
+
+func TestSum(t *testing.T) {
+	if got := Sum(2, 2); got != 5 {
+		t.Errorf("Sum(2, 2) = %d, want 5", got)
+	}
+}
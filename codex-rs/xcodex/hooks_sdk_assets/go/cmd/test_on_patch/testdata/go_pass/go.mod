@@ -0,0 +1,3 @@
+module example.com/go_pass
+
+go 1.21
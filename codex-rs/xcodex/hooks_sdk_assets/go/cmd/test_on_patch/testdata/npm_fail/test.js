@@ -0,0 +1,4 @@
+const assert = require("assert");
+
+assert.strictEqual(2 + 2, 5, "2 + 2 should be 5");
+console.log("ok");
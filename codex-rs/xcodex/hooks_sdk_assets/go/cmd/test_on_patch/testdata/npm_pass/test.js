@@ -0,0 +1,4 @@
+const assert = require("assert");
+
+assert.strictEqual(2 + 2, 4);
+console.log("ok");
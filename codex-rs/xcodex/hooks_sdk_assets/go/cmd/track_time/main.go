@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/aggregate"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+// columns are the timesheet's columns. duration_seconds runs from the session's first event to
+// its last; ended is `session-end`, or `expired` for a session that went quiet for idle_timeout.
+var columns = []string{"date", "project", "session_id", "start", "duration_seconds", "turns", "ended"}
+
+// config is read from `$CODEX_HOME/hooks/config/track_time.toml`; CODEX_HOOK_TRACK_TIME_PATH and
+// CODEX_HOOK_TRACK_TIME_IDLE_TIMEOUT override it.
+type config struct {
+	// Path is the timesheet, by default `$CODEX_HOME/timesheet.csv`.
+	Path string `toml:"path"`
+	// IdleTimeout ends a session that has had no events for this long, at its last event, so a
+	// session whose session-end never arrives (or one left open overnight) isn't billed for the
+	// idle time. A later event of the session starts a new row.
+	IdleTimeout time.Duration `toml:"idle_timeout" default:"1h"`
+}
+
+func (c *config) Validate() error {
+	if c.IdleTimeout <= 0 {
+		return errors.New("idle_timeout must be positive")
+	}
+	if c.Path == "" {
+		c.Path = hooksdk.Environ().Path("timesheet.csv")
+	}
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		os.Exit(report(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `track_time --self-test`, that the config loads and the timesheet can be
+// written.
+func selfTest() []hooksdk.Check {
+	var cfg config
+	err := hooksdk.LoadConfig("track_time", &cfg)
+	return []hooksdk.Check{
+		hooksdk.CheckConfig("track_time", err),
+		hooksdk.CheckWritable("timesheet", cfg.Path),
+		hooksdk.CheckWritable("session state", hooksdk.Environ().Path("hooks", "track_time")),
+	}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	var cfg config
+	if err := hooksdk.LoadConfig("track_time", &cfg); err != nil {
+		hooklog.Errorf("load config: %v; event not tracked", err)
+		return hooksdk.Allow(), nil
+	}
+	agg := tracker(&cfg)
+	// Flush first, so this event's own session is ended if it has been idle, and the event
+	// starts a new one.
+	finished, err := agg.Flush()
+	if err != nil {
+		hooklog.Errorf("expire idle sessions: %v", err)
+	}
+	s, err := agg.Observe(payload)
+	if err != nil {
+		hooklog.Errorf("track session: %v", err)
+	}
+	if s != nil {
+		finished = append(finished, s)
+	}
+	if err := record(&cfg, finished); err != nil {
+		hooklog.Errorf("write %s: %v", cfg.Path, err)
+	}
+	return hooksdk.Allow(), nil
+}
+
+// tracker keeps each running session's state in `$CODEX_HOME/hooks/track_time/`, one file per
+// session, so concurrent sessions are tracked independently.
+func tracker(cfg *config) *aggregate.Aggregator {
+	agg := aggregate.New(hooksdk.Environ().Path("hooks", "track_time"))
+	agg.TTL = cfg.IdleTimeout
+	agg.SkipSummaries = true
+	return agg
+}
+
+// record appends one timesheet row per finished session. The date is the session's start day in
+// CODEX_HOOK_TZ (or the machine's zone) and the start time is in UTC.
+func record(cfg *config, sessions []*aggregate.Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	loc := location()
+	header, err := encodeRow(columns)
+	if err != nil {
+		return err
+	}
+	w := jsonl.New(cfg.Path, jsonl.Options{Header: header})
+	for _, s := range sessions {
+		ended := "session-end"
+		if s.Expired {
+			ended = "expired"
+		}
+		row, err := encodeRow([]string{
+			s.Start.In(loc).Format(time.DateOnly),
+			project(s.Cwd),
+			s.SessionID,
+			summarize.MachineTime(s.Start),
+			strconv.FormatInt(int64(s.Duration().Round(time.Second)/time.Second), 10),
+			strconv.Itoa(s.Turns),
+			ended,
+		})
+		if err != nil {
+			return err
+		}
+		if err := w.AppendRecord(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// project is the root of the git repository dir is in, so sessions started in subdirectories
+// count for the same project, or dir itself outside a repository.
+func project(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+func encodeRow(fields []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(fields); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// report prints the time per project for each of the last weeks (ISO weeks, Monday first) from
+// the timesheet, after writing the rows of sessions that have expired since the last event.
+func report(args []string, stdout, stderr io.Writer) int {
+	fl := flag.NewFlagSet("track_time report", flag.ContinueOnError)
+	fl.SetOutput(stderr)
+	weeks := fl.Int("weeks", 4, "number of weeks to show, the current one included; 0 shows all")
+	file := fl.String("file", "", "timesheet (default: path in track_time.toml, or $CODEX_HOME/timesheet.csv)")
+	if err := fl.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fl.NArg() > 0 {
+		fmt.Fprintf(stderr, "track_time report: unexpected argument %q\n", fl.Arg(0))
+		return 2
+	}
+
+	var cfg config
+	if err := hooksdk.LoadConfig("track_time", &cfg); err != nil {
+		fmt.Fprintf(stderr, "track_time: load config: %v\n", err)
+		return 1
+	}
+	if *file == "" {
+		if expired, err := tracker(&cfg).Flush(); err != nil {
+			fmt.Fprintf(stderr, "track_time: expire idle sessions: %v\n", err)
+		} else if err := record(&cfg, expired); err != nil {
+			fmt.Fprintf(stderr, "track_time: write %s: %v\n", cfg.Path, err)
+		}
+		*file = cfg.Path
+	}
+
+	rows, err := readTimesheet(*file)
+	if err != nil {
+		fmt.Fprintf(stderr, "track_time: %v\n", err)
+		return 1
+	}
+	var since string
+	if *weeks > 0 {
+		since = weekStart(time.Now().In(location())).AddDate(0, 0, -7*(*weeks-1)).Format(time.DateOnly)
+	}
+	type key struct{ week, project string }
+	type total struct {
+		sessions, turns int
+		seconds         int64
+	}
+	totals := map[key]*total{}
+	for _, r := range rows {
+		if r.date < since {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, r.date)
+		if err != nil {
+			continue
+		}
+		year, week := day.ISOWeek()
+		k := key{fmt.Sprintf("%d-W%02d", year, week), r.project}
+		if totals[k] == nil {
+			totals[k] = &total{}
+		}
+		totals[k].sessions++
+		totals[k].turns += r.turns
+		totals[k].seconds += r.seconds
+	}
+	keys := make([]key, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].week != keys[j].week {
+			return keys[i].week < keys[j].week
+		}
+		return keys[i].project < keys[j].project
+	})
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WEEK\tPROJECT\tSESSIONS\tTURNS\tHOURS")
+	for _, k := range keys {
+		t := totals[k]
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.2f\n", k.week, k.project, t.sessions, t.turns, float64(t.seconds)/3600)
+	}
+	tw.Flush()
+	return 0
+}
+
+// location is the zone of CODEX_HOOK_TZ, or the machine's when it is unset or unknown.
+func location() *time.Location {
+	loc, err := summarize.Location("")
+	if err != nil {
+		hooklog.Warnf("ignoring %s: %v", hooksdk.TZEnv, err)
+		return time.Local
+	}
+	return loc
+}
+
+// weekStart returns the Monday of t's week, at midnight.
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	y, m, d := t.AddDate(0, 0, -offset).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+type row struct {
+	date, project string
+	seconds       int64
+	turns         int
+}
+
+// readTimesheet reads the rows of the timesheet, finding the columns by the header, so columns
+// added by hand don't get in the way. A missing file has no rows.
+func readTimesheet(path string) ([]row, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	index := map[string]int{}
+	for i, name := range records[0] {
+		index[name] = i
+	}
+	for _, name := range []string{"date", "project", "duration_seconds", "turns"} {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("%s has no %s column", path, name)
+		}
+	}
+	field := func(rec []string, name string) string {
+		if i := index[name]; i < len(rec) {
+			return rec[i]
+		}
+		return ""
+	}
+	var rows []row
+	for _, rec := range records[1:] {
+		seconds, _ := strconv.ParseInt(field(rec, "duration_seconds"), 10, 64)
+		turns, _ := strconv.Atoi(field(rec, "turns"))
+		rows = append(rows, row{date: field(rec, "date"), project: field(rec, "project"), seconds: seconds, turns: turns})
+	}
+	return rows, nil
+}
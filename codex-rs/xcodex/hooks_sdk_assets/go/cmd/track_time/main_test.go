@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/aggregate"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// setup gives the hook a CODEX_HOME of its own and returns a git repository, with a
+// subdirectory, and a plain directory to run sessions in.
+func setup(t *testing.T) (repo, plain string) {
+	t.Helper()
+	t.Setenv("CODEX_HOME", t.TempDir())
+	t.Setenv("CODEX_HOOK_TRACK_TIME_PATH", "")
+	t.Setenv("CODEX_HOOK_TRACK_TIME_IDLE_TIMEOUT", "1h")
+	t.Setenv(hooksdk.TZEnv, "UTC")
+	root := t.TempDir()
+	repo, plain = filepath.Join(root, "repo"), filepath.Join(root, "scratch")
+	for _, dir := range []string{filepath.Join(repo, ".git"), filepath.Join(repo, "sub"), plain} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo, plain
+}
+
+// send runs the hook on an event of session in cwd at the given time.
+func send(t *testing.T, b *hooktest.Builder, session, cwd string, at time.Time) {
+	t.Helper()
+	p := b.WithSessionID(session).WithCwd(cwd).With("timestamp", at.UTC().Format(time.RFC3339Nano)).Build()
+	if resp, err := handle(context.Background(), p); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle = %+v, %v", resp, err)
+	}
+}
+
+// timesheet returns the timesheet's rows, header first.
+func timesheet(t *testing.T) [][]string {
+	t.Helper()
+	f, err := os.Open(hooksdk.Environ().Path("timesheet.csv"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 || !reflect.DeepEqual(rows[0], columns) {
+		t.Fatalf("timesheet header = %q, want %q", rows, columns)
+	}
+	return rows[1:]
+}
+
+// summary is a row without its date and start, which depend on the clock.
+func summary(row []string) string {
+	return strings.Join([]string{row[1], row[2], row[4], row[5], row[6]}, " ")
+}
+
+func summaries(t *testing.T) []string {
+	t.Helper()
+	var out []string
+	for _, row := range timesheet(t) {
+		out = append(out, summary(row))
+	}
+	return out
+}
+
+func TestTrackSessions(t *testing.T) {
+	repo, plain := setup(t)
+	start := time.Now().Add(-50 * time.Minute)
+	at := func(min int) time.Time { return start.Add(time.Duration(min) * time.Minute) }
+
+	// Two sessions overlap, one started in a subdirectory of the repository.
+	send(t, hooktest.SessionStart(), "a", filepath.Join(repo, "sub"), at(0))
+	send(t, hooktest.SessionStart(), "b", plain, at(5))
+	send(t, hooktest.UserPromptSubmit(), "a", filepath.Join(repo, "sub"), at(6))
+	send(t, hooktest.AgentTurnComplete(), "a", filepath.Join(repo, "sub"), at(10))
+	send(t, hooktest.AgentTurnComplete(), "b", plain, at(12))
+	send(t, hooktest.AgentTurnComplete(), "a", filepath.Join(repo, "sub"), at(20))
+	if rows := timesheet(t); len(rows) != 0 {
+		t.Fatalf("rows before any session ended: %q", rows)
+	}
+	send(t, hooktest.SessionEnd(), "a", filepath.Join(repo, "sub"), at(30))
+	send(t, hooktest.SessionEnd(), "b", plain, at(45))
+
+	want := []string{repo + " a 1800 2 session-end", plain + " b 2400 1 session-end"}
+	if got := summaries(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("timesheet = %q, want %q", got, want)
+	}
+	row := timesheet(t)[0]
+	if row[0] != start.UTC().Format(time.DateOnly) || row[3] != start.UTC().Format("2006-01-02T15:04:05Z") {
+		t.Errorf("date and start = %q, %q; want %s", row[0], row[3], start.UTC())
+	}
+	if files, _ := filepath.Glob(hooksdk.Environ().Path("hooks", "track_time", "session-*")); len(files) != 0 {
+		t.Errorf("state left for ended sessions: %q", files)
+	}
+}
+
+func TestRecordTimeZone(t *testing.T) {
+	setup(t)
+	var cfg config
+	if err := hooksdk.LoadConfig("track_time", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Late on New Year's Eve in UTC is already the next day in Tokyo, and still the day before
+	// in New York: the date follows CODEX_HOOK_TZ, the start is in UTC.
+	start := time.Date(2025, 12, 31, 22, 30, 0, 0, time.UTC)
+	for tz, date := range map[string]string{"UTC": "2025-12-31", "Asia/Tokyo": "2026-01-01", "America/New_York": "2025-12-31"} {
+		t.Setenv(hooksdk.TZEnv, tz)
+		os.Remove(cfg.Path)
+		s := &aggregate.Session{SessionID: "s", Start: start.In(time.FixedZone("X", 3600)), End: start.Add(time.Hour)}
+		if err := record(&cfg, []*aggregate.Session{s}); err != nil {
+			t.Fatal(err)
+		}
+		if row := timesheet(t)[0]; row[0] != date || row[3] != "2025-12-31T22:30:00Z" || row[4] != "3600" {
+			t.Errorf("%s: row = %q, want date %s", tz, row, date)
+		}
+	}
+}
+
+// TestTrackSessionNeverEnds has the sessions go quiet by shortening idle_timeout, which the hook
+// judges by the clock: events arrive as they happen.
+func TestTrackSessionNeverEnds(t *testing.T) {
+	repo, plain := setup(t)
+	now := time.Now()
+	idle := func(d string) { t.Setenv("CODEX_HOOK_TRACK_TIME_IDLE_TIMEOUT", d) }
+
+	// A session goes quiet for more than idle_timeout: the next event, of any session, ends it at
+	// its last event.
+	send(t, hooktest.SessionStart(), "crashed", repo, now.Add(-30*time.Minute))
+	send(t, hooktest.AgentTurnComplete(), "crashed", repo, now.Add(-10*time.Minute))
+	idle("1ns")
+	send(t, hooktest.SessionStart(), "other", plain, now)
+	if got, want := summaries(t), []string{repo + " crashed 1200 1 expired"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("timesheet = %q, want %q", got, want)
+	}
+
+	// A session that resumes after going quiet starts a new row, so the idle time isn't billed.
+	idle("1h")
+	send(t, hooktest.SessionStart(), "resumed", repo, now.Add(-20*time.Minute))
+	send(t, hooktest.UserPromptSubmit(), "resumed", repo, now.Add(-10*time.Minute))
+	idle("1ns")
+	send(t, hooktest.AgentTurnComplete(), "resumed", repo, now)
+	idle("1h")
+	send(t, hooktest.SessionEnd(), "resumed", repo, now.Add(5*time.Minute))
+	want := []string{
+		repo + " crashed 1200 1 expired",
+		plain + " other 0 0 expired",
+		repo + " resumed 600 0 expired",
+		repo + " resumed 300 1 session-end",
+	}
+	if got := summaries(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("timesheet = %q, want %q", got, want)
+	}
+
+	// The report ends the sessions that went quiet since the last event.
+	send(t, hooktest.SessionStart(), "quiet", plain, now)
+	idle("1ns")
+	var stdout, stderr bytes.Buffer
+	if code := report(nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("report = %d: %s", code, stderr.String())
+	}
+	if rows := timesheet(t); len(rows) != 5 || summary(rows[4]) != plain+" quiet 0 0 expired" {
+		t.Errorf("timesheet after the report = %q", rows)
+	}
+	if !strings.Contains(stdout.String(), plain+"  ") {
+		t.Errorf("report:\n%s", stdout.String())
+	}
+}
+
+func TestTrackConcurrentSessions(t *testing.T) {
+	repo, plain := setup(t)
+	start := time.Now().Add(-30 * time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			session, cwd := fmt.Sprintf("s%d", i), repo
+			if i%2 == 1 {
+				cwd = plain
+			}
+			send(t, hooktest.SessionStart(), session, cwd, start)
+			for turn := 0; turn <= i; turn++ {
+				send(t, hooktest.AgentTurnComplete(), session, cwd, start.Add(time.Duration(turn+1)*time.Minute))
+			}
+			send(t, hooktest.SessionEnd(), session, cwd, start.Add(time.Duration(i+2)*time.Minute))
+		}(i)
+	}
+	wg.Wait()
+	got := map[string]bool{}
+	for _, s := range summaries(t) {
+		got[s] = true
+	}
+	for i := 0; i < 6; i++ {
+		cwd := repo
+		if i%2 == 1 {
+			cwd = plain
+		}
+		if want := fmt.Sprintf("%s s%d %d %d session-end", cwd, i, (i+2)*60, i+1); !got[want] {
+			t.Errorf("no row %q in %q", want, summaries(t))
+		}
+	}
+	if len(got) != 6 {
+		t.Errorf("%d rows, want 6", len(got))
+	}
+}
+
+func TestReport(t *testing.T) {
+	setup(t)
+	path := filepath.Join(t.TempDir(), "timesheet.csv")
+	thisWeek := weekStart(time.Now().UTC())
+	year, week := thisWeek.ISOWeek()
+	current := fmt.Sprintf("%d-W%02d", year, week)
+	sheet := "date,project,duration_seconds,turns,note\n" +
+		"2025-03-03,/src/a,3600,4,monday\n" +
+		"2025-03-09,/src/a,1800,1\n" +
+		"2025-03-05,/src/b,900,2,\n" +
+		"2025-03-10,/src/a,7200,3\n" +
+		thisWeek.Format(time.DateOnly) + ",/src/b,5400,5\n"
+	if err := os.WriteFile(path, []byte(sheet), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	if code := report([]string{"--weeks", "0", "--file", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("report = %d: %s", code, stderr.String())
+	}
+	want := "WEEK      PROJECT  SESSIONS  TURNS  HOURS\n" +
+		"2025-W10  /src/a   2         5      1.50\n" +
+		"2025-W10  /src/b   1         2      0.25\n" +
+		"2025-W11  /src/a   1         3      2.00\n" +
+		current + "  /src/b   1         5      1.50\n"
+	if stdout.String() != want {
+		t.Errorf("report:\n%s\nwant:\n%s", stdout.String(), want)
+	}
+
+	// By default only the last 4 weeks show.
+	stdout.Reset()
+	report([]string{"--file", path}, &stdout, &stderr)
+	if lines := strings.Split(strings.TrimSpace(stdout.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], current) {
+		t.Errorf("report of the last weeks:\n%s", stdout.String())
+	}
+
+	for _, args := range [][]string{{"extra"}, {"--weeks", "x"}} {
+		if code := report(args, &stdout, &stderr); code != 2 {
+			t.Errorf("report %q = %d, want 2", args, code)
+		}
+	}
+	os.WriteFile(path, []byte("date,project\n2025-03-03,/src/a\n"), 0o644)
+	if code := report([]string{"--file", path}, &stdout, &stderr); code != 1 || !strings.Contains(stderr.String(), "no duration_seconds column") {
+		t.Errorf("report of a timesheet without durations = %d: %s", code, stderr.String())
+	}
+	// A missing timesheet is an empty report.
+	stdout.Reset()
+	if code := report([]string{"--file", filepath.Join(t.TempDir(), "none.csv")}, &stdout, &stderr); code != 0 || strings.Count(stdout.String(), "\n") != 1 {
+		t.Errorf("report of a missing timesheet = %d: %q", code, stdout.String())
+	}
+}
+
+func TestWeekStart(t *testing.T) {
+	for day, want := range map[string]string{
+		"2025-03-03": "2025-03-03", // Monday
+		"2025-03-09": "2025-03-03", // Sunday
+		"2025-03-05": "2025-03-03",
+		"2025-01-01": "2024-12-30",
+	} {
+		d, _ := time.Parse(time.DateOnly, day)
+		if got := weekStart(d.Add(15 * time.Hour)).Format("2006-01-02 15:04"); got != want+" 00:00" {
+			t.Errorf("weekStart(%s) = %s, want %s", day, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/usage"
+)
+
+func main() {
+	// Run parses the event payload, calls handle, and writes the response.
+	hooksdk.Run(handle, hooksdk.WithSelfTest(selfTest), hooksdk.WithErrorPolicy(hooksdk.FailOpen))
+}
+
+// selfTest checks, for `track_usage --self-test`, that the usage directory is writable and the
+// price table is valid.
+func selfTest() []hooksdk.Check {
+	dir := usageDir()
+	path := pricesPath(dir)
+	_, err := usage.LoadPrices(path)
+	return []hooksdk.Check{
+		hooksdk.CheckWritable("usage directory", dir),
+		hooksdk.CheckConfigFile(path, err),
+	}
+}
+
+func handle(ctx context.Context, payload *hooksdk.HookPayload) (hooksdk.Response, error) {
+	hooklog.Bind(payload)
+
+	dir := usageDir()
+	tracker := usage.NewTracker(dir)
+	if err := tracker.Observe(payload); err != nil {
+		hooklog.Errorf("record usage: %v", err)
+		return hooksdk.Allow(), nil
+	}
+	if payload.EventType() != "session-end" {
+		return hooksdk.Allow(), nil
+	}
+
+	prices, err := usage.LoadPrices(pricesPath(dir))
+	if err != nil {
+		hooklog.Warnf("ignoring price table: %v", err)
+	}
+
+	summary, err := tracker.End(payload.SessionID(), prices)
+	if err != nil {
+		hooklog.Errorf("write usage summary: %v", err)
+		return hooksdk.Allow(), nil
+	}
+	if summary == nil {
+		return hooksdk.Allow(), nil
+	}
+	if !summary.CostKnown {
+		for _, model := range summary.ModelNames() {
+			if _, ok := prices.Lookup(model); !ok {
+				hooklog.Warnf("no price for model %q in %s; cost left blank", model, pricesPath(dir))
+			}
+		}
+	}
+
+	resp := hooksdk.Allow()
+	if os.Getenv("CODEX_HOOK_USAGE_MESSAGE") == "1" {
+		resp.SystemMessage = summary.Message()
+	}
+	return resp, nil
+}
+
+// pricesPath is CODEX_HOOK_USAGE_PRICES, the price table (default `prices.toml` in the usage
+// directory).
+func pricesPath(dir string) string {
+	if path := os.Getenv("CODEX_HOOK_USAGE_PRICES"); path != "" {
+		return path
+	}
+	return filepath.Join(dir, "prices.toml")
+}
+
+// usageDir is CODEX_HOOK_USAGE_DIR, or `$CODEX_HOME/hooks/usage`.
+func usageDir() string {
+	if dir := os.Getenv("CODEX_HOOK_USAGE_DIR"); dir != "" {
+		return dir
+	}
+	return hooksdk.Environ().Path("hooks", "usage")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestHandleSession(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CODEX_HOOK_USAGE_DIR", dir)
+	t.Setenv("CODEX_HOOK_USAGE_MESSAGE", "1")
+	prices := "[models.\"gpt-5*\"]\ninput = 1.25\ncached_input = 0.125\noutput = 10\n"
+	if err := os.WriteFile(filepath.Join(dir, "prices.toml"), []byte(prices), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	events := []*hooktest.Builder{
+		hooktest.SessionStart(),
+		hooktest.ModelRequestStarted().With("model_request_id", "req-1"),
+		hooktest.ModelResponseCompleted().With("model_request_id", "req-1"),
+		hooktest.ToolCallStarted(),
+		hooktest.ModelRequestStarted().With("model_request_id", "req-2").With("model", "gpt-5-mini"),
+		hooktest.ModelResponseCompleted().With("model_request_id", "req-2"),
+	}
+	for _, b := range events {
+		resp, err := handle(context.Background(), b.WithSessionID("s1").Build())
+		if err != nil || resp.Decision != hooksdk.DecisionAllow || resp.SystemMessage != "" {
+			t.Fatalf("handle(%s) = %+v, %v", b.Build().EventType(), resp, err)
+		}
+	}
+	// Another session's usage stays out of s1's totals.
+	handle(context.Background(), hooktest.ModelResponseCompleted().WithSessionID("s2").Build())
+
+	resp, err := handle(context.Background(), hooktest.SessionEnd().WithSessionID("s1").Build())
+	if err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("handle(session-end) = %+v, %v", resp, err)
+	}
+	if want := "Session usage: 2400 input (1600 cached), 600 output tokens, about $0.01"; resp.SystemMessage != want {
+		t.Errorf("system message = %q, want %q", resp.SystemMessage, want)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "usage.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("usage.csv = %q, %v; want a header and one session", rows, err)
+	}
+	got := map[string]string{}
+	for i, col := range rows[0] {
+		got[col] = rows[1][i]
+	}
+	for col, want := range map[string]string{
+		"session_id":              "s1",
+		"models":                  "gpt-5;gpt-5-mini",
+		"input_tokens":            "2400",
+		"cached_input_tokens":     "1600",
+		"output_tokens":           "600",
+		"reasoning_output_tokens": "200",
+		"total_tokens":            "3000",
+		"estimated_cost_usd":      "0.0072",
+	} {
+		if got[col] != want {
+			t.Errorf("%s = %q, want %q", col, got[col], want)
+		}
+	}
+}
+
+func TestHandleWithoutMessage(t *testing.T) {
+	t.Setenv("CODEX_HOOK_USAGE_DIR", t.TempDir())
+	t.Setenv("CODEX_HOOK_USAGE_MESSAGE", "")
+	handle(context.Background(), hooktest.ModelResponseCompleted().WithSessionID("s1").Build())
+	resp, err := handle(context.Background(), hooktest.SessionEnd().WithSessionID("s1").Build())
+	if err != nil || resp.SystemMessage != "" {
+		t.Errorf("handle(session-end) = %+v, %v; want no message", resp, err)
+	}
+}
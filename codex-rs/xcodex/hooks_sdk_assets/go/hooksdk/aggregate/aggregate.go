@@ -0,0 +1,377 @@
+// Package aggregate counts what happens in each session across hook invocations and writes one
+// digest per session when it ends.
+//
+// Every event updates its session's state file; `session-end` turns the state into a Session
+// summary, appends it to the summaries files, and removes the state. Sessions whose
+// `session-end` never arrives (the host crashed) are flushed the same way once they have been
+// quiet for TTL, marked Expired.
+//
+//	a := aggregate.New(filepath.Join(codexHome, "hooks", "summaries"))
+//	s, err := a.Observe(payload) // for every event; s is non-nil on session-end
+package aggregate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/atomicfile"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+// DefaultTTL is how long New waits after a session's last event before flushing it without a
+// `session-end`.
+const DefaultTTL = 24 * time.Hour
+
+const lockTimeout = 5 * time.Second
+
+// Session is one session's counters, as kept in its state file and written as its summary.
+type Session struct {
+	SessionID string `json:"session_id"`
+	Cwd       string `json:"cwd,omitempty"`
+	// Start is the time of the session's first event and End that of its latest one (the
+	// `session-end`, once it arrived), in UTC.
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Events int       `json:"events"`
+	// Prompts counts `user-prompt-submit` events and Turns `agent-turn-complete` events.
+	Prompts int `json:"prompts"`
+	Turns   int `json:"turns"`
+	// ToolCalls counts finished tool calls, by tool in Tools. ToolFailures are the ones that ran and
+	// failed; Denials the ones aborted before completing (denied by the user or a hook, or
+	// interrupted).
+	ToolCalls    int            `json:"tool_calls"`
+	ToolFailures int            `json:"tool_failures"`
+	Denials      int            `json:"denials"`
+	Tools        map[string]int `json:"tools,omitempty"`
+	Approvals    int            `json:"approvals"`
+	// FilesTouched lists the files tool calls wrote (see gitsnap.TouchedPaths), in order of first
+	// appearance.
+	FilesTouched []string `json:"files_touched,omitempty"`
+	// Expired is set when the session was flushed without a `session-end` event.
+	Expired bool `json:"expired,omitempty"`
+}
+
+// Duration is the wall time from the session's first event to its last.
+func (s *Session) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Message is a one-line summary for people, e.g. for a response's system message.
+func (s *Session) Message() string {
+	msg := fmt.Sprintf("Session summary: %s, %d prompt(s), %d tool call(s)",
+		summarize.Duration(s.Duration().Round(time.Second)), s.Prompts, s.ToolCalls)
+	if s.ToolFailures > 0 {
+		msg += fmt.Sprintf(" (%d failed)", s.ToolFailures)
+	}
+	if s.Denials > 0 {
+		msg += fmt.Sprintf(", %d denied", s.Denials)
+	}
+	return msg + fmt.Sprintf(", %d file(s) touched", len(s.FilesTouched))
+}
+
+// Text renders the summary as a block for people, headed with the session's ShortID and ending in a
+// blank line, with its times in UTC.
+func (s *Session) Text() string {
+	return s.TextIn(time.UTC)
+}
+
+// TextIn is Text with its times in loc (see summarize.Location).
+func (s *Session) TextIn(loc *time.Location) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Session %s", hooksdk.ShortID(s.SessionID))
+	if s.Expired {
+		b.WriteString(" (expired without session-end)")
+	}
+	b.WriteString("\n")
+	row := func(label, format string, args ...any) {
+		fmt.Fprintf(&b, "  %-15s%s\n", label+":", fmt.Sprintf(format, args...))
+	}
+	if s.Cwd != "" {
+		row("Directory", "%s", s.Cwd)
+	}
+	row("Started", "%s", summarize.Time(s.Start, loc))
+	row("Duration", "%s", summarize.Duration(s.Duration().Round(time.Second)))
+	row("Events", "%d", s.Events)
+	row("Prompts", "%d (%d turn(s))", s.Prompts, s.Turns)
+	row("Tool calls", "%d (%d failed, %d denied)", s.ToolCalls, s.ToolFailures, s.Denials)
+	if len(s.Tools) > 0 {
+		names := make([]string, 0, len(s.Tools))
+		for name := range s.Tools {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if s.Tools[names[i]] != s.Tools[names[j]] {
+				return s.Tools[names[i]] > s.Tools[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = fmt.Sprintf("%s %d", name, s.Tools[name])
+		}
+		row("By tool", "%s", strings.Join(parts, ", "))
+	}
+	row("Approvals", "%d", s.Approvals)
+	row("Files touched", "%d", len(s.FilesTouched))
+	for _, path := range s.FilesTouched {
+		fmt.Fprintf(&b, "    %s\n", path)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Aggregator keeps per-session state files, and the summaries of finished sessions, in Dir.
+type Aggregator struct {
+	Dir string
+	// TTL is how long a session may go without events before it is flushed as Expired; zero keeps
+	// it until its `session-end`.
+	TTL time.Duration
+	// Now is the clock for events without a timestamp, and for expiry; nil means time.Now.
+	Now func() time.Time
+	// Location is the zone of the times in the text summaries; nil means UTC. The JSON summaries
+	// are always in UTC.
+	Location *time.Location
+	// SkipSummaries leaves the summaries files alone, for callers that record the sessions
+	// Observe and Flush return themselves.
+	SkipSummaries bool
+}
+
+// New returns an Aggregator storing its state in dir, with DefaultTTL.
+func New(dir string) *Aggregator {
+	return &Aggregator{Dir: dir, TTL: DefaultTTL}
+}
+
+// SummariesPath is the file of JSON summaries, one line per session: `summaries.jsonl` in Dir.
+func (a *Aggregator) SummariesPath() string {
+	return filepath.Join(a.Dir, "summaries.jsonl")
+}
+
+// TextPath is the file of summaries for people (see Session.Text): `summaries.txt` in Dir.
+func (a *Aggregator) TextPath() string {
+	return filepath.Join(a.Dir, "summaries.txt")
+}
+
+// Observe adds p to its session's counters. On `session-end` the session's summary is written
+// and its state removed, and the finished Session returned; other events return nil. Each call
+// also flushes the other sessions that have expired (see Flush). Events without a session id are
+// ignored.
+func (a *Aggregator) Observe(p *hooksdk.HookPayload) (*Session, error) {
+	session := p.SessionID()
+	if session == "" {
+		return nil, nil
+	}
+	var done *Session
+	err := a.locked(func() error {
+		if _, err := a.flushExpired(session); err != nil {
+			return err
+		}
+		path := a.statePath(session)
+		s, err := load(path)
+		if err != nil {
+			return err
+		}
+		at := p.Time().UTC()
+		if at.IsZero() {
+			at = a.now().UTC()
+		}
+		if s.Start.IsZero() {
+			s.SessionID = session
+			s.Start = at
+		}
+		if at.After(s.End) {
+			s.End = at
+		}
+		if s.Cwd == "" {
+			s.Cwd = p.WorkingDir()
+		}
+		s.observe(p)
+
+		if p.EventType() != "session-end" {
+			return atomicfile.WriteJSON(path, s)
+		}
+		if err := a.finish(path, s); err != nil {
+			return err
+		}
+		done = s
+		return nil
+	})
+	return done, err
+}
+
+// Flush writes the summaries of the sessions that have had no events for TTL, marked Expired,
+// removes their state, and returns them.
+func (a *Aggregator) Flush() ([]*Session, error) {
+	var flushed []*Session
+	err := a.locked(func() error {
+		var err error
+		flushed, err = a.flushExpired("")
+		return err
+	})
+	return flushed, err
+}
+
+func (s *Session) observe(p *hooksdk.HookPayload) {
+	s.Events++
+	switch p.EventType() {
+	case "user-prompt-submit":
+		s.Prompts++
+	case "agent-turn-complete":
+		s.Turns++
+	case "approval-requested":
+		s.Approvals++
+	case "tool-call-finished":
+		tool, _ := hooksdk.StringField(p.RawPayload, "tool_name")
+		if tool == "" {
+			tool = "(unknown)"
+		}
+		s.ToolCalls++
+		s.Tools[tool]++
+		if status, _ := hooksdk.StringField(p.RawPayload, "status"); status == "aborted" {
+			s.Denials++
+			return
+		}
+		if ok, found := hooksdk.BoolField(p.RawPayload, "success"); found && !ok {
+			s.ToolFailures++
+			return
+		}
+		for _, path := range gitsnap.TouchedPaths(p.ToolInput) {
+			s.touch(path)
+		}
+	}
+}
+
+func (s *Session) touch(path string) {
+	for _, seen := range s.FilesTouched {
+		if seen == path {
+			return
+		}
+	}
+	s.FilesTouched = append(s.FilesTouched, path)
+}
+
+// flushExpired finishes the expired sessions other than current. It runs under the lock.
+func (a *Aggregator) flushExpired(current string) ([]*Session, error) {
+	if a.TTL <= 0 {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(a.Dir, "session-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	now := a.now()
+	var flushed []*Session
+	for _, path := range paths {
+		s, err := load(path)
+		if err != nil {
+			return flushed, err
+		}
+		if s.SessionID == current || (!s.End.IsZero() && now.Sub(s.End) <= a.TTL) {
+			continue
+		}
+		if s.SessionID == "" {
+			// Corrupt state: nothing worth summarizing.
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return flushed, err
+			}
+			continue
+		}
+		s.Expired = true
+		if err := a.finish(path, s); err != nil {
+			return flushed, err
+		}
+		flushed = append(flushed, s)
+	}
+	return flushed, nil
+}
+
+// finish appends s to the summaries files, unless SkipSummaries, and removes its state file.
+func (a *Aggregator) finish(path string, s *Session) error {
+	if !a.SkipSummaries {
+		line, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if err := appendFile(a.SummariesPath(), append(line, '\n')); err != nil {
+			return err
+		}
+		if err := appendFile(a.TextPath(), []byte(s.TextIn(a.location()))); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (a *Aggregator) location() *time.Location {
+	if a.Location != nil {
+		return a.Location
+	}
+	return time.UTC
+}
+
+func (a *Aggregator) now() time.Time {
+	if a.Now != nil {
+		return a.Now()
+	}
+	return time.Now()
+}
+
+func (a *Aggregator) statePath(session string) string {
+	name, _ := jsonl.SafeName(session)
+	return filepath.Join(a.Dir, "session-"+name+".json")
+}
+
+// locked runs fn under the lock shared by all sessions' state files and the summaries.
+func (a *Aggregator) locked(fn func() error) error {
+	if err := os.MkdirAll(a.Dir, 0o755); err != nil {
+		return err
+	}
+	lock, err := filelock.AcquireTimeout(filepath.Join(a.Dir, "aggregate.lock"), lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return fn()
+}
+
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// load reads a session's state; a missing or corrupt file starts afresh.
+func load(path string) (*Session, error) {
+	var s Session
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 && json.Unmarshal(data, &s) != nil {
+		s = Session{}
+	}
+	if s.Tools == nil {
+		s.Tools = map[string]int{}
+	}
+	return &s, nil
+}
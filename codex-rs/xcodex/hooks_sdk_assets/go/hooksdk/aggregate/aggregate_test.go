@@ -0,0 +1,256 @@
+package aggregate_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/aggregate"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+var t0 = time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC)
+
+// at sets b's timestamp to d after t0.
+func at(b *hooktest.Builder, d time.Duration) *hooktest.Builder {
+	return b.With("timestamp", t0.Add(d).Format(time.RFC3339Nano))
+}
+
+func observe(t *testing.T, a *aggregate.Aggregator, b *hooktest.Builder) *aggregate.Session {
+	t.Helper()
+	s, err := a.Observe(b.Build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// summaries reads the JSON summaries a wrote.
+func summaries(t *testing.T, a *aggregate.Aggregator) []aggregate.Session {
+	t.Helper()
+	f, err := os.Open(a.SummariesPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []aggregate.Session
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var s aggregate.Session
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			t.Fatalf("summary %q: %v", sc.Text(), err)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// stateFiles lists the per-session state files in a's directory.
+func stateFiles(t *testing.T, a *aggregate.Aggregator) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(a.Dir, "session-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func patch(path string) map[string]any {
+	return map[string]any{"input": "*** Begin Patch\n*** Update File: " + path + "\n@@\n-a\n+b\n*** End Patch\n"}
+}
+
+func TestObserveSession(t *testing.T) {
+	a := aggregate.New(t.TempDir())
+	events := []*hooktest.Builder{
+		at(hooktest.SessionStart(), 0),
+		at(hooktest.UserPromptSubmit(), time.Second),
+		at(hooktest.ApprovalRequested(), 2*time.Second),
+		at(hooktest.ToolCallFinished(), 3*time.Second),
+		at(hooktest.ToolCallFinished().WithToolName("apply_patch").With("tool_input", patch("a.go")), 4*time.Second),
+		at(hooktest.ToolCallFinished().WithToolName("apply_patch").With("tool_input", patch("a.go")), 5*time.Second),
+		at(hooktest.ToolCallFinished().With("tool_input", map[string]any{"file_path": "b.go"}), 6*time.Second),
+		// A failed write touches nothing; an aborted call is a denial.
+		at(hooktest.ToolCallFinished().With("success", false).With("tool_input", map[string]any{"file_path": "c.go"}), 7*time.Second),
+		at(hooktest.ToolCallFinished().With("status", "aborted").With("success", nil).With("tool_name", nil), 8*time.Second),
+		at(hooktest.AgentTurnComplete(), 9*time.Second),
+	}
+	for _, b := range events {
+		if s := observe(t, a, b); s != nil {
+			t.Fatalf("%s returned a summary", b.Build().EventType())
+		}
+	}
+	if files := stateFiles(t, a); len(files) != 1 {
+		t.Fatalf("state files = %v, want one", files)
+	}
+
+	got := observe(t, a, at(hooktest.SessionEnd(), time.Minute+500*time.Millisecond))
+	want := &aggregate.Session{
+		SessionID:    "test-session",
+		Cwd:          "/tmp/project",
+		Start:        t0,
+		End:          t0.Add(time.Minute + 500*time.Millisecond),
+		Events:       11,
+		Prompts:      1,
+		Turns:        1,
+		ToolCalls:    6,
+		ToolFailures: 1,
+		Denials:      1,
+		Tools:        map[string]int{"Bash": 3, "apply_patch": 2, "(unknown)": 1},
+		Approvals:    1,
+		FilesTouched: []string{"a.go", "b.go"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("summary =\n%+v\nwant\n%+v", got, want)
+	}
+	if files := stateFiles(t, a); len(files) != 0 {
+		t.Errorf("state left after session-end: %v", files)
+	}
+	if s := summaries(t, a); len(s) != 1 || !reflect.DeepEqual(&s[0], want) {
+		t.Errorf("summaries.jsonl = %+v", s)
+	}
+	text, err := os.ReadFile(a.TextPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != want.Text() {
+		t.Errorf("summaries.txt =\n%s\nwant\n%s", text, want.Text())
+	}
+	if msg := got.Message(); msg != "Session summary: 1m1s, 1 prompt(s), 6 tool call(s) (1 failed), 1 denied, 2 file(s) touched" {
+		t.Errorf("Message() = %q", msg)
+	}
+
+	// A new event for the session starts it afresh.
+	observe(t, a, at(hooktest.UserPromptSubmit(), 2*time.Minute))
+	if got := observe(t, a, at(hooktest.SessionEnd(), 3*time.Minute)); got.Events != 2 || !got.Start.Equal(t0.Add(2*time.Minute)) {
+		t.Errorf("second summary = %+v", got)
+	}
+}
+
+func TestText(t *testing.T) {
+	s := &aggregate.Session{
+		SessionID: "0190e4a1-7b2c-7d3e-8f40-123456789abc",
+		Cwd:       "/work",
+		Start:     t0,
+		End:       t0.Add(90 * time.Second),
+		Events:    4,
+		ToolCalls: 3,
+		Tools:     map[string]int{"Bash": 1, "apply_patch": 1, "Read": 1},
+		Expired:   true,
+	}
+	text := s.Text()
+	for _, want := range []string{
+		"(expired without session-end)\n",
+		"  Directory:     /work\n",
+		"  Duration:      1m30s\n",
+		"  Tool calls:    3 (0 failed, 0 denied)\n",
+		// Most used first, then by name.
+		"  By tool:       Bash 1, Read 1, apply_patch 1\n",
+		"  Files touched: 0\n\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Text() lacks %q:\n%s", want, text)
+		}
+	}
+	if !strings.HasPrefix(text, "Session ") || strings.Contains(text, s.SessionID) {
+		t.Errorf("Text() doesn't start with the short session id:\n%s", text)
+	}
+	tokyo := time.FixedZone("JST", 9*3600)
+	if in := s.TextIn(tokyo); in == text || !strings.Contains(in, "19:00") {
+		t.Errorf("TextIn(JST) doesn't show the local time:\n%s", in)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := t0.Add(time.Hour)
+	a := aggregate.New(t.TempDir())
+	a.TTL = time.Hour
+	a.Now = func() time.Time { return now }
+	observe(t, a, at(hooktest.SessionStart().WithSessionID("crashed"), 0))
+	observe(t, a, at(hooktest.SessionStart().WithSessionID("alive"), 30*time.Minute))
+
+	// Within the TTL nothing is flushed.
+	if flushed, err := a.Flush(); err != nil || len(flushed) != 0 {
+		t.Fatalf("Flush within the TTL = %v, %v", flushed, err)
+	}
+
+	// Another session's event flushes the quiet one.
+	now = now.Add(time.Minute)
+	observe(t, a, at(hooktest.UserPromptSubmit().WithSessionID("alive"), 61*time.Minute))
+	got := summaries(t, a)
+	if len(got) != 1 || got[0].SessionID != "crashed" || !got[0].Expired || got[0].Events != 1 {
+		t.Fatalf("summaries after expiry = %+v", got)
+	}
+	if files := stateFiles(t, a); len(files) != 1 {
+		t.Errorf("state files = %v, want only the live session's", files)
+	}
+
+	now = now.Add(2 * time.Hour)
+	flushed, err := a.Flush()
+	if err != nil || len(flushed) != 1 || flushed[0].SessionID != "alive" || !flushed[0].Expired || flushed[0].Prompts != 1 {
+		t.Fatalf("Flush = %+v, %v", flushed, err)
+	}
+	if files := stateFiles(t, a); len(files) != 0 {
+		t.Errorf("state left after Flush: %v", files)
+	}
+
+	// With no TTL, sessions wait for their session-end.
+	a.TTL = 0
+	observe(t, a, at(hooktest.SessionStart().WithSessionID("patient"), 0))
+	now = now.Add(1000 * time.Hour)
+	if flushed, err := a.Flush(); err != nil || len(flushed) != 0 {
+		t.Errorf("Flush with no TTL = %v, %v", flushed, err)
+	}
+}
+
+func TestCorruptState(t *testing.T) {
+	a := aggregate.New(t.TempDir())
+	a.Now = func() time.Time { return t0.Add(48 * time.Hour) }
+	// A corrupt state file of the session being observed starts afresh; another one is removed.
+	observe(t, a, at(hooktest.SessionStart().WithSessionID("mine"), 47*time.Hour))
+	path := stateFiles(t, a)[0]
+	if err := os.WriteFile(path, []byte("{torn"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(a.Dir, "session-other.json")
+	if err := os.WriteFile(other, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got := observe(t, a, at(hooktest.SessionEnd().WithSessionID("mine"), 48*time.Hour))
+	if got == nil || got.Events != 1 {
+		t.Errorf("summary after corrupt state = %+v", got)
+	}
+	if _, err := os.Stat(other); !os.IsNotExist(err) {
+		t.Errorf("corrupt state file of another session kept: %v", err)
+	}
+	if s := summaries(t, a); len(s) != 1 {
+		t.Errorf("summaries = %+v, want only mine", s)
+	}
+}
+
+func TestObserveOptions(t *testing.T) {
+	a := aggregate.New(t.TempDir())
+	a.SkipSummaries = true
+	if s := observe(t, a, hooktest.SessionStart().WithSessionID("")); s != nil || len(stateFiles(t, a)) != 0 {
+		t.Errorf("event without a session id recorded")
+	}
+	observe(t, a, hooktest.SessionStart())
+	if s := observe(t, a, hooktest.SessionEnd()); s == nil {
+		t.Fatal("no summary on session-end")
+	}
+	if _, err := os.Stat(a.SummariesPath()); !os.IsNotExist(err) {
+		t.Errorf("SkipSummaries wrote %s", a.SummariesPath())
+	}
+	// Session ids that aren't file names stay inside Dir.
+	observe(t, a, hooktest.SessionStart().WithSessionID("../../escape"))
+	if files := stateFiles(t, a); len(files) != 1 || filepath.Dir(files[0]) != a.Dir {
+		t.Errorf("state files = %v", files)
+	}
+}
@@ -0,0 +1,349 @@
+// Package anonymize hides where hook payloads came from, so logs can be shared for debugging
+// without revealing project names, directory layout, or who ran them.
+//
+// Absolute paths, the home directory, the user's names, and the machine's host names are
+// replaced anywhere in the payload, keys and values, including inside longer strings such as
+// shell commands. Each path component becomes a salted hash that keeps its extension, so a path
+// keeps its depth and file type:
+//
+//	/home/alice/src/shop/cmd/main.go  ->  ~/5c0e2b1a/0d9f7c43/a1b2c3d4/7e8f9a0b.go
+//	ssh alice@build-01                ->  ssh user-3f2a9c1e@host-91bc44aa
+//
+// The same input always gets the same token under one salt, so occurrences can still be
+// correlated within a log; without the salt, tokens can't be reversed by hashing guesses. System
+// paths (`/usr/bin/git`, `C:\Windows\...`) are kept as they are, and so is the first component of
+// common roots such as `/tmp` or `/opt`.
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// systemPaths are kept whole, along with everything under them: they hold the system's files,
+// which say nothing about the user.
+var systemPaths = []string{
+	"/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libexec", "/etc", "/dev", "/proc", "/sys",
+	"/usr/bin", "/usr/sbin", "/usr/lib", "/usr/libexec", "/usr/include", "/usr/share",
+	"/usr/local/bin", "/usr/local/sbin", "/opt/homebrew/bin", "/System", "/Library",
+	"C:/Windows",
+}
+
+// commonRoots keep their own name, but not the names under them.
+var commonRoots = []string{
+	"tmp", "var", "opt", "home", "Users", "mnt", "media", "srv", "private", "nix", "Volumes",
+	"run", "usr", "workspace", "workspaces",
+}
+
+// pathChars may appear in a path found inside a string; anything else ends it.
+const pathChars = "[^\\s\"'`<>|;,:()\\[\\]{}=*?$]"
+
+// pathRe finds absolute paths (`/...`, `~`, `~/...`, `C:\...`, `C:/...`) at the start of a string
+// or after a separator, such as a space in a command or the `=` of `--dir=/src`. group 2 is the
+// path.
+var pathRe = regexp.MustCompile("(^|[\\s\"'`(\\[{<>|;&,:=])(" +
+	"/[^/\\s\"'`<>|;,:()\\[\\]{}=*?$]" + pathChars + "*" +
+	"|~(?:[/\\\\]" + pathChars + "*)?" +
+	"|[A-Za-z]:[/\\\\]" + pathChars + "*)")
+
+// maxExt is the longest extension kept: longer "extensions" are usually part of a name
+// (`my.project-name`).
+const maxExt = 8
+
+// Anonymizer replaces paths and names in untyped payloads. Use New for one set up for this
+// machine. Its fields must not change once it is in use; it is then safe for concurrent use.
+type Anonymizer struct {
+	// Salt keys the hashes: tokens are stable under one salt and unrelated across salts.
+	Salt string
+	// Home is replaced with `~`; "" leaves home directories to be hashed like other paths.
+	Home string
+	// Usernames and Hostnames are replaced, as whole words and ignoring case, with `user-<hash>`
+	// and `host-<hash>`.
+	Usernames []string
+	Hostnames []string
+
+	once  sync.Once
+	names *regexp.Regexp
+	kinds map[string]string
+}
+
+// New returns an Anonymizer for salt with this machine's home directory, user names (the login
+// and the home directory's name), and host names (the full and the short one).
+func New(salt string) *Anonymizer {
+	a := &Anonymizer{Salt: salt}
+	if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+		a.Home = home
+		a.Usernames = append(a.Usernames, filepath.Base(home))
+	}
+	if u, err := user.Current(); err == nil {
+		// Windows names are DOMAIN\user.
+		a.Usernames = append(a.Usernames, u.Username[strings.LastIndex(u.Username, `\`)+1:])
+	}
+	for _, env := range []string{"USER", "USERNAME", "LOGNAME"} {
+		a.Usernames = append(a.Usernames, os.Getenv(env))
+	}
+	if host, err := os.Hostname(); err == nil {
+		a.Hostnames = append(a.Hostnames, host)
+	}
+	for _, env := range []string{"HOSTNAME", "COMPUTERNAME"} {
+		a.Hostnames = append(a.Hostnames, os.Getenv(env))
+	}
+	for _, host := range a.Hostnames {
+		if short, _, ok := strings.Cut(host, "."); ok {
+			a.Hostnames = append(a.Hostnames, short)
+		}
+	}
+	return a
+}
+
+// Anonymize returns a copy of payload with paths and names replaced using New(salt). The input
+// is not modified.
+func Anonymize(payload hooksdk.HookPayloadJSON, salt string) hooksdk.HookPayloadJSON {
+	return New(salt).Anonymize(payload)
+}
+
+// Anonymize returns a copy of payload with paths and names replaced. The input is not modified.
+func (a *Anonymizer) Anonymize(payload hooksdk.HookPayloadJSON) hooksdk.HookPayloadJSON {
+	if payload == nil {
+		return nil
+	}
+	return hooksdk.HookPayloadJSON(a.value(map[string]any(payload)).(map[string]any))
+}
+
+func (a *Anonymizer) value(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, child := range t {
+			// Keys can be paths too, e.g. the files of a patch.
+			out[a.String(k)] = a.value(child)
+		}
+		return out
+	case hooksdk.HookPayloadJSON:
+		return hooksdk.HookPayloadJSON(a.value(map[string]any(t)).(map[string]any))
+	case []any:
+		out := make([]any, len(t))
+		for i, child := range t {
+			out[i] = a.value(child)
+		}
+		return out
+	case []string:
+		out := make([]string, len(t))
+		for i, child := range t {
+			out[i] = a.String(child)
+		}
+		return out
+	case string:
+		return a.String(t)
+	default:
+		return v
+	}
+}
+
+// String replaces the paths and names inside s.
+func (a *Anonymizer) String(s string) string {
+	s = replaceSubmatch(pathRe, s, 2, a.Path)
+	if re := a.namesRe(); re != nil {
+		s = re.ReplaceAllStringFunc(s, func(name string) string {
+			// Names match ignoring case, so `Alice` and `alice` get the same token.
+			name = strings.ToLower(name)
+			return a.kinds[name] + "-" + a.Token(name)
+		})
+	}
+	return s
+}
+
+// replaceSubmatch replaces group n of each match of re in s with fn of it, keeping the rest of
+// the match.
+func replaceSubmatch(re *regexp.Regexp, s string, n int, fn func(string) string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[2*n], m[2*n+1]
+		b.WriteString(s[last:start])
+		b.WriteString(fn(s[start:end]))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// namesRe matches the user and host names as whole words, longest first so `build-01.lan` wins
+// over `build-01`. It is nil without names.
+func (a *Anonymizer) namesRe() *regexp.Regexp {
+	a.once.Do(a.compileNames)
+	return a.names
+}
+
+func (a *Anonymizer) compileNames() {
+	a.kinds = map[string]string{}
+	for _, n := range a.Hostnames {
+		if n = strings.ToLower(strings.TrimSpace(n)); len(n) > 1 {
+			a.kinds[n] = "host"
+		}
+	}
+	for _, n := range a.Usernames {
+		if n = strings.ToLower(strings.TrimSpace(n)); len(n) > 1 {
+			a.kinds[n] = "user"
+		}
+	}
+	if len(a.kinds) == 0 {
+		return
+	}
+	names := make([]string, 0, len(a.kinds))
+	for n := range a.kinds {
+		names = append(names, regexp.QuoteMeta(n))
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	a.names = regexp.MustCompile(`(?i)\b(?:` + strings.Join(names, "|") + `)\b`)
+}
+
+// Path anonymizes one absolute path: the home directory becomes `~`, system paths are kept, and
+// every other component is hashed, keeping separators and extensions.
+func (a *Anonymizer) Path(p string) string {
+	// Trailing sentence punctuation isn't part of the path.
+	trimmed := strings.TrimRight(p, ".")
+	if trimmed == "" {
+		return p
+	}
+	trail := p[len(trimmed):]
+	p = trimmed
+	slashed := strings.ReplaceAll(p, `\`, "/")
+	for _, sys := range systemPaths {
+		if hasPathPrefix(slashed, sys) {
+			return p + trail
+		}
+	}
+
+	var prefix, rest string
+	switch {
+	case a.Home != "" && hasPathPrefix(slashed, strings.ReplaceAll(a.Home, `\`, "/")):
+		prefix, rest = "~", p[len(a.Home):]
+	case strings.HasPrefix(p, "~"):
+		prefix, rest = "~", p[1:]
+	case len(p) >= 2 && p[1] == ':':
+		prefix, rest = p[:2], p[2:]
+	default:
+		rest = p
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	first := true
+	for rest != "" {
+		i := strings.IndexAny(rest, `/\`)
+		if i != 0 {
+			if i < 0 {
+				i = len(rest)
+			}
+			b.WriteString(a.component(rest[:i], first && prefix != "~"))
+			first = false
+			rest = rest[i:]
+			continue
+		}
+		b.WriteByte(rest[0])
+		rest = rest[1:]
+	}
+	return b.String() + trail
+}
+
+// hasPathPrefix reports whether p is dir or is under it, ignoring case for Windows paths.
+func hasPathPrefix(p, dir string) bool {
+	if len(p) < len(dir) {
+		return false
+	}
+	head := p[:len(dir)]
+	if head != dir && !(len(dir) > 1 && dir[1] == ':' && strings.EqualFold(head, dir)) {
+		return false
+	}
+	return len(p) == len(dir) || p[len(dir)] == '/'
+}
+
+// component hashes one path component, keeping a short extension and, for the first component of
+// an absolute path, a common root's name.
+func (a *Anonymizer) component(name string, root bool) string {
+	if root {
+		for _, r := range commonRoots {
+			if name == r {
+				return name
+			}
+		}
+	}
+	if name == "." || name == ".." {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if ext == "" || ext == name || len(ext) > maxExt+1 || !alnum(ext[1:]) {
+		ext = ""
+	}
+	return a.Token(strings.TrimSuffix(name, ext)) + ext
+}
+
+func alnum(s string) bool {
+	for _, c := range s {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Token is the stable replacement for s: the start of its HMAC-SHA256 under the salt, in hex.
+func (a *Anonymizer) Token(s string) string {
+	mac := hmac.New(sha256.New, []byte(a.Salt))
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil)[:4])
+}
+
+// LoadSalt returns the salt stored at path, creating it with a random one (readable only by the
+// user) if there is none yet. Hooks racing to create it all end up with the same salt.
+func LoadSalt(path string) (string, error) {
+	if data, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(hex.EncodeToString(b[:]) + "\n")
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	// Link doesn't replace an existing file, so the first hook to get here wins and the others
+	// read its salt.
+	if err := os.Link(tmp.Name(), path); err != nil && !errors.Is(err, os.ErrExist) {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
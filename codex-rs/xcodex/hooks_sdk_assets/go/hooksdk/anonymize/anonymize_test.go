@@ -0,0 +1,168 @@
+package anonymize_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/anonymize"
+)
+
+func testAnonymizer(salt string) *anonymize.Anonymizer {
+	return &anonymize.Anonymizer{
+		Salt:      salt,
+		Home:      "/home/alice",
+		Usernames: []string{"alice", ""},
+		Hostnames: []string{"build-01.lan", "build-01"},
+	}
+}
+
+func TestPath(t *testing.T) {
+	a := testAnonymizer("salt")
+	tok := a.Token
+	for in, want := range map[string]string{
+		"/home/alice/src/shop/cmd/main.go": "~/" + tok("src") + "/" + tok("shop") + "/" + tok("cmd") + "/" + tok("main") + ".go",
+		"/home/alice":                      "~",
+		"/home/alicex/notes.txt":           "/home/" + tok("alicex") + "/" + tok("notes") + ".txt",
+		"~/.config/app.toml":               "~/" + tok(".config") + "/" + tok("app") + ".toml",
+		"/tmp/build/out.tar.gz":            "/tmp/" + tok("build") + "/" + tok("out.tar") + ".gz",
+		"/srv/my.project-name/README":      "/srv/" + tok("my.project-name") + "/" + tok("README"),
+		"/work/a/../b/./c.":                "/" + tok("work") + "/" + tok("a") + "/../" + tok("b") + "/./" + tok("c") + ".",
+		`C:\Users\alice\repo\x.rs`:         `C:\Users\` + tok("alice") + `\` + tok("repo") + `\` + tok("x") + ".rs",
+		"/usr/bin/git":                     "/usr/bin/git",
+		"/etc/hosts":                       "/etc/hosts",
+		`c:\windows\system32\cmd.exe`:      `c:\windows\system32\cmd.exe`,
+	} {
+		if got := a.Path(in); got != want {
+			t.Errorf("Path(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	a := testAnonymizer("salt")
+	tok := a.Token
+	for in, want := range map[string]string{
+		// Paths nested inside commands, after flags and quotes.
+		"cd /work/shop && go test --dir=/work/shop/pkg 'x/y' \"/work/z.go\"": "cd /" + tok("work") + "/" + tok("shop") + " && go test --dir=/" + tok("work") + "/" + tok("shop") + "/" + tok("pkg") + " 'x/y' \"/" + tok("work") + "/" + tok("z") + ".go\"",
+		"ssh alice@build-01":           "ssh user-" + tok("alice") + "@host-" + tok("build-01"),
+		"ALICE on Build-01.lan":        "user-" + tok("alice") + " on host-" + tok("build-01.lan"),
+		"malice and alicea are words":  "malice and alicea are words",
+		"see https://example.com/docs": "see https://example.com/docs",
+		"wrote ~/notes.md.":            "wrote ~/" + tok("notes") + ".md.",
+		"relative/path.go stays":       "relative/path.go stays",
+	} {
+		if got := a.String(in); got != want {
+			t.Errorf("String(%q)\n = %q\nwant %q", in, got, want)
+		}
+	}
+}
+
+func TestAnonymizeStable(t *testing.T) {
+	payload := hooksdk.HookPayloadJSON{
+		"cwd":        "/home/alice/src/shop",
+		"command":    []any{"go", "test", "/home/alice/src/shop/..."},
+		"argv":       []string{"cat", "/work/secret.txt"},
+		"tool_input": map[string]any{"files": map[string]any{"/work/secret.txt": "M"}, "n": 3},
+		"nested":     hooksdk.HookPayloadJSON{"host": "build-01"},
+		"ok":         true,
+	}
+	before := deepCopy(payload)
+	a := testAnonymizer("salt")
+	got := a.Anonymize(payload)
+	if !reflect.DeepEqual(payload, before) {
+		t.Error("the input was modified")
+	}
+	secret := "/" + a.Token("work") + "/" + a.Token("secret") + ".txt"
+	files := got["tool_input"].(map[string]any)["files"].(map[string]any)
+	if files[secret] != "M" || got["argv"].([]string)[1] != secret || got["tool_input"].(map[string]any)["n"] != 3 || got["ok"] != true {
+		t.Errorf("anonymized = %v", got)
+	}
+	if host := got["nested"].(hooksdk.HookPayloadJSON)["host"]; host != "host-"+a.Token("build-01") {
+		t.Errorf("nested host = %v", host)
+	}
+	if got["cwd"] != got["command"].([]any)[2].(string)[:len(got["cwd"].(string))] {
+		t.Errorf("the same path got different tokens: %v and %v", got["cwd"], got["command"])
+	}
+
+	// The same salt gives the same tokens; another gives others.
+	if again := testAnonymizer("salt").Anonymize(payload); !reflect.DeepEqual(again, got) {
+		t.Errorf("anonymized twice: %v and %v", got, again)
+	}
+	if other := testAnonymizer("pepper").Anonymize(payload); other["cwd"] == got["cwd"] {
+		t.Errorf("two salts gave %v", other["cwd"])
+	}
+	if a.Anonymize(nil) != nil {
+		t.Error("Anonymize(nil) isn't nil")
+	}
+	if tok := a.Token("x"); !regexp.MustCompile(`^[0-9a-f]{8}$`).MatchString(tok) {
+		t.Errorf("Token = %q", tok)
+	}
+}
+
+func deepCopy(p hooksdk.HookPayloadJSON) hooksdk.HookPayloadJSON {
+	out := hooksdk.HookPayloadJSON{}
+	for k, v := range p {
+		switch t := v.(type) {
+		case []any:
+			out[k] = append([]any(nil), t...)
+		case []string:
+			out[k] = append([]string(nil), t...)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func TestAnonymizeThisMachine(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil || len(home) < 2 {
+		t.Skip("no home directory")
+	}
+	got := anonymize.Anonymize(hooksdk.HookPayloadJSON{"cwd": filepath.Join(home, "project", "main.go")}, "salt")
+	if cwd, _ := got["cwd"].(string); !strings.HasPrefix(cwd, "~") || strings.Contains(cwd, "project") || !strings.HasSuffix(cwd, ".go") {
+		t.Errorf("cwd = %q", cwd)
+	}
+}
+
+func TestLoadSalt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "hooks.jsonl.salt")
+	var wg sync.WaitGroup
+	salts := make([]string, 20)
+	for i := range salts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			salt, err := anonymize.LoadSalt(path)
+			if err != nil {
+				t.Error(err)
+			}
+			salts[i] = salt
+		}(i)
+	}
+	wg.Wait()
+	for _, s := range salts {
+		if s != salts[0] || len(s) != 32 {
+			t.Fatalf("salts = %q, want one", salts)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		t.Errorf("salt file: %v, %v", info, err)
+	}
+	if leftovers, _ := filepath.Glob(path + ".tmp-*"); len(leftovers) != 0 {
+		t.Errorf("temp files left: %q", leftovers)
+	}
+
+	// An existing salt is kept.
+	os.WriteFile(path, []byte("mine\n"), 0o600)
+	if salt, err := anonymize.LoadSalt(path); err != nil || salt != "mine" {
+		t.Errorf("LoadSalt = %q, %v", salt, err)
+	}
+}
@@ -0,0 +1,163 @@
+package hooksdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PayloadIterator yields the events in a JSONL stream (such as a captured hooks.jsonl), one per
+// call to Next. Create one with ReadPayloads.
+//
+//	it := hooksdk.ReadPayloads(os.Stdin)
+//	for it.Next() {
+//		if err := it.Err(); err != nil {
+//			log.Printf("skipping: %v", err)
+//			continue
+//		}
+//		handle(it.Payload())
+//	}
+type PayloadIterator struct {
+	r    *bufio.Reader
+	opts []Option
+	o    *options
+
+	line    int
+	pending []batchItem
+	done    bool
+
+	cur     batchItem
+	payload *HookPayload
+	err     error
+}
+
+type batchItem struct {
+	data []byte
+	line int
+	err  error
+}
+
+// ReadPayloads returns an iterator over the events in r.
+//
+// Input may be JSONL (one event or payload_path envelope per line) or a single JSON object, which
+// may span several lines and yields exactly one event. Each event is resolved and parsed the same
+// way ReadPayload handles stdin. A line that fails to parse is reported through Err for that
+// iteration and the stream continues with the next line.
+func ReadPayloads(r io.Reader, opts ...Option) *PayloadIterator {
+	return &PayloadIterator{r: bufio.NewReader(r), opts: opts, o: newOptions(opts)}
+}
+
+// Next advances to the next event. It returns false once the input is exhausted.
+func (it *PayloadIterator) Next() bool {
+	for len(it.pending) == 0 {
+		if it.done {
+			it.cur, it.payload, it.err = batchItem{}, nil, nil
+			return false
+		}
+		it.fill()
+	}
+	it.cur, it.pending = it.pending[0], it.pending[1:]
+	it.payload, it.err = nil, it.cur.err
+	if it.err == nil {
+		it.payload, it.err = it.parse(it.cur.data)
+		if it.err != nil {
+			it.err = fmt.Errorf("line %d: %w", it.cur.line, it.err)
+		}
+	}
+	return true
+}
+
+// Payload returns the current event, or nil if it couldn't be read (see Err).
+func (it *PayloadIterator) Payload() *HookPayload {
+	return it.payload
+}
+
+// Err returns why the current event couldn't be read, or nil. Errors are prefixed with the input
+// line the event started on.
+func (it *PayloadIterator) Err() error {
+	return it.err
+}
+
+// Line returns the input line the current event started on (1-based).
+func (it *PayloadIterator) Line() int {
+	return it.cur.line
+}
+
+func (it *PayloadIterator) parse(data []byte) (*HookPayload, error) {
+	o := *it.o
+	o.capture = o.startCapture()
+	full, env, err := readFullPayloadBytes(context.Background(), bytes.NewReader(data), &o)
+	if err != nil {
+		o.capture.finish(nil, err)
+		return nil, err
+	}
+	p, err := ParseHookPayload(full, env.parseOptions(it.opts)...)
+	o.capture.finish(p, err)
+	return p, err
+}
+
+// fill reads input until at least one item is pending or the input ends.
+//
+// Lines are normally complete JSON values. A line that isn't is accumulated with the following
+// lines until they form a value (a pretty-printed object), unless a new unindented object line
+// starts first, in which case the accumulated lines are reported as one bad event.
+func (it *PayloadIterator) fill() {
+	var acc []byte
+	accLine := 0
+	for {
+		line, err := it.r.ReadBytes('\n')
+		if len(line) > 0 {
+			it.line++
+			switch {
+			case acc == nil && isBlank(line):
+			case acc == nil && json.Valid(line):
+				it.pending = append(it.pending, batchItem{data: line, line: it.line})
+				return
+			case acc == nil:
+				acc, accLine = line, it.line
+			case line[0] == '{' && json.Valid(line):
+				it.pending = append(it.pending,
+					it.invalid(acc, accLine),
+					batchItem{data: line, line: it.line})
+				return
+			default:
+				acc = append(acc, line...)
+				if json.Valid(acc) {
+					it.pending = append(it.pending, batchItem{data: acc, line: accLine})
+					return
+				}
+			}
+			if limit := it.o.maxPayloadBytes; limit > 0 && int64(len(acc)) > limit {
+				it.pending = append(it.pending, batchItem{
+					line: accLine,
+					err:  fmt.Errorf("line %d: %w", accLine, &PayloadTooLargeError{Source: "stdin", Limit: limit}),
+				})
+				it.done = true
+				return
+			}
+		}
+		if err != nil {
+			if acc != nil {
+				it.pending = append(it.pending, it.invalid(acc, accLine))
+			}
+			if !errors.Is(err, io.EOF) {
+				it.pending = append(it.pending, batchItem{line: it.line, err: fmt.Errorf("line %d: %w", it.line, err)})
+			}
+			it.done = true
+			return
+		}
+	}
+}
+
+func (it *PayloadIterator) invalid(data []byte, line int) batchItem {
+	var v any
+	err := json.Unmarshal(data, &v)
+	if err == nil {
+		err = errors.New("invalid JSON")
+	}
+	return batchItem{line: line, err: fmt.Errorf("line %d: %w", line, err)}
+}
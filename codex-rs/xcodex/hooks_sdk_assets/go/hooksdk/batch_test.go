@@ -0,0 +1,69 @@
+package hooksdk_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// drain returns the session id of each event ReadPayloads yields for input, or "ERR <line>" for
+// the ones that fail.
+func drain(t *testing.T, input string) []string {
+	t.Helper()
+	var got []string
+	it := hooksdk.ReadPayloads(strings.NewReader(input), hooksdk.WithPayloadRetry(0))
+	for it.Next() {
+		if err := it.Err(); err != nil {
+			if !strings.Contains(err.Error(), fmt.Sprint("line ", it.Line())) {
+				t.Errorf("error %q doesn't name line %d", err, it.Line())
+			}
+			if it.Payload() != nil {
+				t.Errorf("line %d: Payload() is set along with Err() %v", it.Line(), err)
+			}
+			got = append(got, fmt.Sprintf("ERR %d", it.Line()))
+			continue
+		}
+		got = append(got, it.Payload().SessionID())
+	}
+	return got
+}
+
+func line(session string) string {
+	return string(hooktest.SessionStart().WithSessionID(session).Bytes()) + "\n"
+}
+
+func TestReadPayloadsJSONL(t *testing.T) {
+	envelope := string(hooktest.WriteEnvelope(t, hooktest.ToolCallFinished().WithSessionID("file").Bytes())) + "\n"
+	input := line("a") + "not json\n" + "\n" + envelope + `{"payload_path": "/nonexistent/x.json"}` + "\n" + line("b")
+	got := drain(t, input)
+	want := []string{"a", "ERR 2", "file", "ERR 5", "b"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestReadPayloadsSingleObject(t *testing.T) {
+	// A pretty-printed object spans lines but is one event.
+	pretty := "{\n  \"xcodex_event_type\": \"session-start\",\n  \"session_id\": \"pretty\"\n}\n"
+	if got := drain(t, pretty); len(got) != 1 || got[0] != "pretty" {
+		t.Errorf("events = %q, want [pretty]", got)
+	}
+	if got := drain(t, strings.TrimSuffix(line("one"), "\n")); len(got) != 1 || got[0] != "one" {
+		t.Errorf("events = %q, want [one]", got)
+	}
+	if got := drain(t, ""); len(got) != 0 {
+		t.Errorf("events = %q, want none", got)
+	}
+}
+
+func TestReadPayloadsUnterminatedObject(t *testing.T) {
+	// An object that never closes doesn't swallow the events after it.
+	input := "{\n  \"session_id\": \"broken\",\n" + line("after")
+	got := drain(t, input)
+	if len(got) != 2 || !strings.HasPrefix(got[0], "ERR") || got[1] != "after" {
+		t.Errorf("events = %q, want an error then after", got)
+	}
+}
@@ -0,0 +1,313 @@
+// Package canonicaljson encodes JSON values in one canonical form, so equal values always give the
+// same bytes: for hashing a payload, signing it, or comparing two of them. json.Marshal can't do
+// this, since the same value can be written in many ways, e.g. 1, 1.0, and 1e0.
+//
+// The form is that of RFC 8785 (the JSON Canonicalization Scheme):
+//
+//   - no whitespace between tokens;
+//   - object keys sorted by their UTF-16 code units, as RFC 8785 specifies, which for keys in the
+//     Basic Multilingual Plane is the order of their bytes;
+//   - strings with only `"`, `\`, and the control characters escaped, as \b, \t, \n, \f, \r, or
+//     \u00xx (lowercase), and everything else, <, >, &, and U+2028 included, as it is;
+//   - numbers as ECMAScript writes a float64: the shortest digits that read back as the same
+//     number, 1e21 and up and below 1e-6 with an exponent (1e+21, 1e-7), and -0 as 0.
+//
+// One thing differs: an integer written without a fraction or exponent, as a json.Number or a Go
+// integer, keeps all its digits, where RFC 8785 would round one past 2^53 to a float64. Token
+// counts and IDs stay exact that way; 12345678901234567891 and 12345678901234567891.0 then encode
+// differently, while 100, 100.0, and 1e2 all encode as 100.
+//
+// Strings that aren't valid UTF-8 are encoded with U+FFFD in place of the invalid bytes, as
+// encoding/json does. NaN and the infinities have no JSON form and are an error.
+package canonicaljson
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Marshal returns v in canonical form. v may be anything json.Marshal takes; maps, slices,
+// strings, numbers, booleans, nil, and json.RawMessage (a JSON document, which is decoded and
+// encoded again) are encoded directly, and other values as json.Marshal encodes them, then made
+// canonical.
+func Marshal(v any) ([]byte, error) {
+	var e encoder
+	if err := e.value(v); err != nil {
+		return nil, fmt.Errorf("canonicaljson: %w", err)
+	}
+	return e.buf, nil
+}
+
+// Hash returns the SHA-256 of v in canonical form. It is for values known to encode, such as
+// decoded payloads: for one Marshal rejects, Hash returns the zero array, so use Marshal where
+// that can happen.
+func Hash(v any) [32]byte {
+	data, err := Marshal(v)
+	if err != nil {
+		return [32]byte{}
+	}
+	return sha256.Sum256(data)
+}
+
+type encoder struct {
+	buf []byte
+}
+
+var (
+	mapType   = reflect.TypeOf(map[string]any(nil))
+	sliceType = reflect.TypeOf([]any(nil))
+)
+
+func (e *encoder) value(v any) error {
+	switch v := v.(type) {
+	case nil:
+		e.buf = append(e.buf, "null"...)
+	case bool:
+		e.buf = strconv.AppendBool(e.buf, v)
+	case string:
+		e.string(v)
+	case json.Number:
+		return e.number(string(v))
+	case float64:
+		return e.float(v, 64)
+	case float32:
+		return e.float(float64(v), 32)
+	case int:
+		e.buf = strconv.AppendInt(e.buf, int64(v), 10)
+	case int8:
+		e.buf = strconv.AppendInt(e.buf, int64(v), 10)
+	case int16:
+		e.buf = strconv.AppendInt(e.buf, int64(v), 10)
+	case int32:
+		e.buf = strconv.AppendInt(e.buf, int64(v), 10)
+	case int64:
+		e.buf = strconv.AppendInt(e.buf, v, 10)
+	case uint:
+		e.buf = strconv.AppendUint(e.buf, uint64(v), 10)
+	case uint8:
+		e.buf = strconv.AppendUint(e.buf, uint64(v), 10)
+	case uint16:
+		e.buf = strconv.AppendUint(e.buf, uint64(v), 10)
+	case uint32:
+		e.buf = strconv.AppendUint(e.buf, uint64(v), 10)
+	case uint64:
+		e.buf = strconv.AppendUint(e.buf, v, 10)
+	case json.RawMessage:
+		if v == nil {
+			e.buf = append(e.buf, "null"...)
+			return nil
+		}
+		doc, err := decode(v)
+		if err != nil {
+			return err
+		}
+		return e.value(doc)
+	case map[string]any:
+		return e.object(v)
+	case []any:
+		return e.array(v)
+	default:
+		return e.other(v)
+	}
+	return nil
+}
+
+// other encodes a value of a type Marshal doesn't take directly: a type defined on a map or
+// slice of any (e.g. hooksdk.HookPayloadJSON) as that, unless it has a MarshalJSON of its own, and
+// anything else by way of json.Marshal.
+func (e *encoder) other(v any) error {
+	if _, ok := v.(json.Marshaler); !ok {
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.Kind() == reflect.Map && rv.Type().ConvertibleTo(mapType):
+			if rv.IsNil() {
+				e.buf = append(e.buf, "null"...)
+				return nil
+			}
+			return e.object(rv.Convert(mapType).Interface().(map[string]any))
+		case rv.Kind() == reflect.Slice && rv.Type().ConvertibleTo(sliceType):
+			if rv.IsNil() {
+				e.buf = append(e.buf, "null"...)
+				return nil
+			}
+			return e.array(rv.Convert(sliceType).Interface().([]any))
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	doc, err := decode(data)
+	if err != nil {
+		return err
+	}
+	return e.value(doc)
+}
+
+// decode decodes one JSON document, with numbers as json.Number.
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level JSON value")
+	}
+	return v, nil
+}
+
+func (e *encoder) object(m map[string]any) error {
+	if m == nil {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+	type key struct {
+		name  string
+		units []uint16
+	}
+	keys := make([]key, 0, len(m))
+	for k := range m {
+		keys = append(keys, key{name: k, units: utf16.Encode([]rune(k))})
+	}
+	sort.Slice(keys, func(i, j int) bool { return lessUnits(keys[i].units, keys[j].units) })
+	e.buf = append(e.buf, '{')
+	for i, k := range keys {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.string(k.name)
+		e.buf = append(e.buf, ':')
+		if err := e.value(m[k.name]); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, '}')
+	return nil
+}
+
+// lessUnits orders UTF-16 strings by their code units.
+func lessUnits(a, b []uint16) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func (e *encoder) array(a []any) error {
+	if a == nil {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+	e.buf = append(e.buf, '[')
+	for i, v := range a {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		if err := e.value(v); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, ']')
+	return nil
+}
+
+func (e *encoder) string(s string) {
+	e.buf = append(e.buf, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				e.buf = append(e.buf, '\\', c)
+			case c == '\b':
+				e.buf = append(e.buf, `\b`...)
+			case c == '\t':
+				e.buf = append(e.buf, `\t`...)
+			case c == '\n':
+				e.buf = append(e.buf, `\n`...)
+			case c == '\f':
+				e.buf = append(e.buf, `\f`...)
+			case c == '\r':
+				e.buf = append(e.buf, `\r`...)
+			case c < 0x20:
+				const hex = "0123456789abcdef"
+				e.buf = append(e.buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				e.buf = append(e.buf, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			e.buf = utf8.AppendRune(e.buf, utf8.RuneError)
+		} else {
+			e.buf = append(e.buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	e.buf = append(e.buf, '"')
+}
+
+// number encodes a json.Number: an integer as it is written (but -0 as 0), anything else as the
+// float64 it is.
+func (e *encoder) number(n string) error {
+	if !json.Valid([]byte(n)) || n == "" || (n[0] != '-' && (n[0] < '0' || n[0] > '9')) {
+		return fmt.Errorf("invalid number literal %q", n)
+	}
+	if !strings.ContainsAny(n, ".eE") {
+		if strings.TrimLeft(n, "-0") == "" {
+			n = "0"
+		}
+		e.buf = append(e.buf, n...)
+		return nil
+	}
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return fmt.Errorf("number %s is out of range", n)
+	}
+	return e.float(f, 64)
+}
+
+// float encodes f as ECMAScript's Number.prototype.toString does, with the shortest digits that
+// read back as f at its bits of precision.
+func (e *encoder) float(f float64, bits int) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("unsupported value: %v", f)
+	}
+	if f == 0 {
+		// -0 too.
+		e.buf = append(e.buf, '0')
+		return nil
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs < 1e-6 || abs >= 1e21 {
+		format = 'e'
+	}
+	start := len(e.buf)
+	e.buf = strconv.AppendFloat(e.buf, f, format, -1, bits)
+	if format == 'e' {
+		// strconv writes at least two exponent digits: 1e-07 becomes 1e-7.
+		b := e.buf[start:]
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			e.buf = e.buf[:len(e.buf)-1]
+		}
+	}
+	return nil
+}
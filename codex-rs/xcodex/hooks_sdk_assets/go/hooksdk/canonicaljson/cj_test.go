@@ -0,0 +1,253 @@
+package canonicaljson_test
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/canonicaljson"
+)
+
+func marshal(t *testing.T, v any) string {
+	t.Helper()
+	data, err := canonicaljson.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal(%#v): %v", v, err)
+	}
+	return string(data)
+}
+
+// TestRFC8785Examples checks the examples of RFC 8785 sections 3.2.2 and 3.2.3.
+func TestRFC8785Examples(t *testing.T) {
+	doc := `{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`
+	want := `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`
+	if got := marshal(t, json.RawMessage(doc)); got != want {
+		t.Errorf("RFC 8785 3.2.2:\n got %s\nwant %s", got, want)
+	}
+
+	// Keys sort by UTF-16 code units: the emoji's surrogates come before U+FB33.
+	sorting := `{
+  "\u20ac": "Euro Sign",
+  "\r": "Carriage Return",
+  "\ufb33": "Hebrew Letter Dalet With Dagesh",
+  "1": "One",
+  "\ud83d\ude00": "Emoji: Grinning Face",
+  "\u0080": "Control",
+  "\u00f6": "Latin Small Letter O With Diaeresis"
+}`
+	want = "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\"," +
+		"\"\u20ac\":\"Euro Sign\",\"\U0001f600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}"
+	var m map[string]any
+	if err := json.Unmarshal([]byte(sorting), &m); err != nil {
+		t.Fatal(err)
+	}
+	if got := marshal(t, m); got != want {
+		t.Errorf("RFC 8785 3.2.3:\n got %s\nwant %s", got, want)
+	}
+}
+
+// TestNumbers checks the float64 table of RFC 8785 appendix B, from the bits and from the
+// shortest literal, plus the cases where a json.Number is kept as written.
+func TestNumbers(t *testing.T) {
+	for _, tt := range []struct {
+		bits uint64
+		want string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	} {
+		f := math.Float64frombits(tt.bits)
+		if got := marshal(t, f); got != tt.want {
+			t.Errorf("%#016x: Marshal = %s, want %s", tt.bits, got, tt.want)
+		}
+		// As a literal with a fraction or exponent, a json.Number is that float64.
+		literal := json.Number(tt.want)
+		if !strings.ContainsAny(tt.want, ".e") {
+			literal += ".0"
+		}
+		if got := marshal(t, literal); got != tt.want {
+			t.Errorf("json.Number(%s) = %s, want %s", literal, got, tt.want)
+		}
+	}
+
+	for in, want := range map[json.Number]string{
+		"100":                      "100",
+		"100.0":                    "100",
+		"1e2":                      "100",
+		"1E+2":                     "100",
+		"4.50":                     "4.5",
+		"1E-7":                     "1e-7",
+		"0.0000001":                "1e-7",
+		"1e21":                     "1e+21",
+		"-0":                       "0",
+		"-0.0":                     "0",
+		"-0e5":                     "0",
+		"0":                        "0",
+		"12345678901234567891":     "12345678901234567891",
+		"-12345678901234567891":    "-12345678901234567891",
+		"12345678901234567891.0":   "12345678901234567000",
+		"9007199254740993":         "9007199254740993",
+		"9007199254740993.0":       "9007199254740992",
+		"123456789012345678901234": "123456789012345678901234",
+	} {
+		if data, err := canonicaljson.Marshal(in); err != nil || string(data) != want {
+			t.Errorf("json.Number(%s) = %s, %v; want %s", in, data, err, want)
+		}
+	}
+
+	// Go numbers.
+	for _, tt := range []struct {
+		v    any
+		want string
+	}{
+		{int(-7), "-7"},
+		{int8(-128), "-128"},
+		{int16(300), "300"},
+		{int32(-70000), "-70000"},
+		{int64(math.MaxInt64), "9223372036854775807"},
+		{int64(math.MinInt64), "-9223372036854775808"},
+		{uint(7), "7"},
+		{uint8(255), "255"},
+		{uint16(65535), "65535"},
+		{uint32(4294967295), "4294967295"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{float32(0.1), "0.1"},
+		{float32(16777216), "16777216"},
+		{float32(1e-7), "1e-7"},
+		{0.1, "0.1"},
+		{1.0, "1"},
+		{math.Copysign(0, -1), "0"},
+		{1e-7, "1e-7"},
+		{1.5e-300, "1.5e-300"},
+	} {
+		if got := marshal(t, tt.v); got != tt.want {
+			t.Errorf("Marshal(%T %v) = %s, want %s", tt.v, tt.v, got, tt.want)
+		}
+	}
+
+	for _, v := range []any{math.NaN(), math.Inf(1), math.Inf(-1), float32(math.Inf(-1)), json.Number("1e400"),
+		json.Number(""), json.Number("0x10"), json.Number("+1"), json.Number("1."), json.Number(".5"), json.Number("-00"), json.Number("NaN")} {
+		if data, err := canonicaljson.Marshal(v); err == nil || !strings.HasPrefix(err.Error(), "canonicaljson: ") {
+			t.Errorf("Marshal(%v) = %s, %v; want an error", v, data, err)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                    `""`,
+		"plain":               `"plain"`,
+		`quote " backslash \`: `"quote \" backslash \\"`,
+		"\b\t\n\f\r":          `"\b\t\n\f\r"`,
+		"\x00\x01\x1f":        `"\u0000\u0001\u001f"`,
+		"\x7f":                "\"\x7f\"",
+		"<a href=x>&amp;</a>": `"<a href=x>&amp;</a>"`,
+		"/ stays":             `"/ stays"`,
+		"\u2028\u2029":        "\"\u2028\u2029\"",
+		"é€😀":                 `"é€😀"`,
+		"bad \xff byte":       `"bad ` + "\uFFFD" + ` byte"`,
+		"cut \xe2\x82":        `"cut ` + "\uFFFD\uFFFD" + `"`,
+	} {
+		if got := marshal(t, in); got != want {
+			t.Errorf("Marshal(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	type named map[string]any
+	type list []any
+	type rec struct {
+		Z   string         `json:"z"`
+		A   int            `json:"a"`
+		Map map[string]int `json:"m,omitempty"`
+	}
+	want := `{"a":[1,"x",null,true],"b":{"c":{},"d":[]},"é":false}`
+	for _, v := range []any{
+		map[string]any{"é": false, "b": map[string]any{"d": []any{}, "c": map[string]any{}}, "a": []any{1, "x", nil, true}},
+		named{"é": false, "b": named{"d": list{}, "c": named{}}, "a": list{json.Number("1.0"), "x", nil, true}},
+		json.RawMessage("{\n \"b\": {\"d\": [ ], \"c\": { }},\n \"a\": [1e0, \"x\", null, true], \"\\u00e9\": false }\n"),
+	} {
+		if got := marshal(t, v); got != want {
+			t.Errorf("Marshal(%#v) =\n%s\nwant\n%s", v, got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		v    any
+		want string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{map[string]any(nil), "null"},
+		{[]any(nil), "null"},
+		{named(nil), "null"},
+		{list(nil), "null"},
+		{json.RawMessage(nil), "null"},
+		{rec{Z: "z", A: 2}, `{"a":2,"z":"z"}`},
+		{&rec{Z: "<", A: 1, Map: map[string]int{"y": 2, "x": 1}}, `{"a":1,"m":{"x":1,"y":2},"z":"<"}`},
+		{[]string{"b", "a"}, `["b","a"]`},
+		{map[string]int{"b": 2, "a": 1}, `{"a":1,"b":2}`},
+		{[]any{map[string]any{"nested": json.RawMessage(`[1.50, {"b":1,"a":2}]`)}}, `[{"nested":[1.5,{"a":2,"b":1}]}]`},
+	} {
+		if got := marshal(t, tt.v); got != tt.want {
+			t.Errorf("Marshal(%#v) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+
+	for _, v := range []any{
+		json.RawMessage(`{"a":`),
+		json.RawMessage(`{"a":1} {"b":2}`),
+		json.RawMessage(``),
+		map[string]any{"ok": 1, "bad": math.NaN()},
+		[]any{"ok", func() {}},
+		make(chan int),
+	} {
+		if data, err := canonicaljson.Marshal(v); err == nil {
+			t.Errorf("Marshal(%#v) = %s, want an error", v, data)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	a := map[string]any{"b": json.Number("1.0"), "a": "x"}
+	b := json.RawMessage(`{ "a": "x", "b": 1 }`)
+	want := sha256.Sum256([]byte(`{"a":"x","b":1}`))
+	if canonicaljson.Hash(a) != want || canonicaljson.Hash(b) != want {
+		t.Errorf("Hash = %x and %x, want %x", canonicaljson.Hash(a), canonicaljson.Hash(b), want)
+	}
+	if canonicaljson.Hash(map[string]any{"b": 2, "a": "x"}) == want {
+		t.Error("different values hash the same")
+	}
+	if got := canonicaljson.Hash(math.NaN()); got != [32]byte{} {
+		t.Errorf("Hash(NaN) = %x, want zeros", got)
+	}
+}
@@ -0,0 +1,172 @@
+package hooksdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// The capabilities of the response fields a host may not act on, named after the fields (see
+// HostSupports). A host that doesn't list one gets responses without the field: WriteResponse
+// downgrades them. CapabilityTelemetry is the telemetry field's.
+const (
+	CapabilityModify             = "modify"
+	CapabilityAdditionalContext  = "additional_context"
+	CapabilityQueuedUserMessages = "queued_user_messages"
+	CapabilityQuestion           = "question"
+)
+
+// ReasonCapabilityMissing is the reason code of the deny a response with a modification the host
+// can't apply is downgraded to.
+const ReasonCapabilityMissing = "CAPABILITY_MISSING"
+
+// hostCapabilities are the envelope's `capabilities`; set is false when it had none.
+type hostCapabilities struct {
+	list []string
+	set  bool
+}
+
+// stdinCapabilities are the capabilities of the envelope this process read on stdin.
+var stdinCapabilities atomic.Value
+
+// envelopeCapabilities returns the envelope's `capabilities`, an array of strings.
+func envelopeCapabilities(fields map[string]any) (hostCapabilities, error) {
+	v := fields["capabilities"]
+	if v == nil {
+		return hostCapabilities{}, nil
+	}
+	invalid := fmt.Errorf("%w: capabilities must be an array of strings", ErrInvalidEnvelope)
+	items, ok := v.([]any)
+	if !ok {
+		return hostCapabilities{}, invalid
+	}
+	caps := hostCapabilities{set: true}
+	for _, item := range items {
+		c, ok := item.(string)
+		if !ok {
+			return hostCapabilities{}, invalid
+		}
+		if c = strings.TrimSpace(c); c != "" {
+			caps.list = append(caps.list, c)
+		}
+	}
+	return caps, nil
+}
+
+// withCapabilities returns e with the capabilities the host gave in the envelope, when it gave
+// any, in place of CODEX_HOOK_CAPABILITIES.
+func (c hostCapabilities) withCapabilities(e Env) Env {
+	if c.set {
+		e.Capabilities = c.list
+	}
+	return e
+}
+
+// HostSupports reports whether the host acts on feature, e.g. CapabilityModify: whether it is in
+// the `capabilities` array of the envelope read on stdin, or, when the envelope has none, in
+// CODEX_HOOK_CAPABILITIES (see Env.Supports). A host that says neither supports none, as older
+// hosts don't, and WriteResponse downgrades the responses it would ignore.
+func HostSupports(feature string) bool {
+	return IO{}.HostSupports(feature)
+}
+
+// HostSupports is HostSupports with the environment of s, for tests.
+func (s IO) HostSupports(feature string) bool {
+	return s.hostEnv().Supports(feature)
+}
+
+// hostEnv is s.Environ with the capabilities of the envelope read on stdin.
+func (s IO) hostEnv() Env {
+	caps, _ := stdinCapabilities.Load().(hostCapabilities)
+	return caps.withCapabilities(s.Environ())
+}
+
+// downgrade returns resp without the fields the host in env doesn't support, reporting each one it
+// drops on stderr, so that nothing is lost without a trace:
+//
+//   - a modification turns an allow or ask into a deny saying the change couldn't be applied,
+//     rather than have the host run the action unchanged;
+//   - a question is dropped, and its title asked as the prompt;
+//   - additional context and queued user messages are dropped;
+//   - telemetry is appended to TelemetryFile instead, as EmitTelemetry does.
+func downgrade(resp Response, env Env, stderr io.Writer) Response {
+	drop := func(feature, what string, args ...any) {
+		writeLogLine(stderr, "warn", "capabilities", fmt.Errorf("the host doesn't support %s: "+what, append([]any{feature}, args...)...))
+	}
+	if len(resp.Modify) > 0 && !env.Supports(CapabilityModify) {
+		fields := make([]string, 0, len(resp.Modify))
+		for k := range resp.Modify {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		if resp.Decision != DecisionDeny {
+			msg := fmt.Sprintf("the host can't apply the change to %s this hook makes, so the action is denied rather than run unchanged", strings.Join(fields, ", "))
+			if name := hooklog.HookName(); name != "" {
+				msg = name + ": " + msg
+			}
+			denied := Deny(msg, WithReasonCode(ReasonCapabilityMissing))
+			denied.SystemMessage = resp.SystemMessage
+			denied.AdditionalContext = resp.AdditionalContext
+			denied.QueuedUserMessages = resp.QueuedUserMessages
+			denied.Telemetry = resp.Telemetry
+			denied.Metadata = resp.Metadata
+			decision := resp.Decision
+			if decision == "" {
+				decision = DecisionAllow
+			}
+			drop(CapabilityModify, "denying instead of %s with a change to %s", decision, strings.Join(fields, ", "))
+			resp = denied
+		} else {
+			drop(CapabilityModify, "dropped the change to %s of a deny", strings.Join(fields, ", "))
+			resp.Modify = nil
+		}
+	}
+	if resp.Question != nil && !env.Supports(CapabilityQuestion) {
+		if resp.Prompt == "" {
+			resp.Prompt = resp.Question.Title
+		}
+		drop(CapabilityQuestion, "asking %q without the question's options", resp.Prompt)
+		resp.Question = nil
+	}
+	if resp.AdditionalContext != "" && !env.Supports(CapabilityAdditionalContext) {
+		drop(CapabilityAdditionalContext, "dropped %d bytes of context for the agent", len(resp.AdditionalContext))
+		resp.AdditionalContext = ""
+	}
+	if n := len(resp.QueuedUserMessages); n > 0 && !env.Supports(CapabilityQueuedUserMessages) {
+		drop(CapabilityQueuedUserMessages, "dropped %d queued user message(s)", n)
+		resp.QueuedUserMessages = nil
+	}
+	if n := len(resp.Telemetry); n > 0 && !env.Supports(CapabilityTelemetry) {
+		kept := 0
+		for _, t := range resp.Telemetry {
+			if err := appendTelemetry(env, t); err != nil {
+				writeLogLine(stderr, "warn", "telemetry", fmt.Errorf("telemetry record %q: %w", t.Name, err))
+				continue
+			}
+			kept++
+		}
+		drop(CapabilityTelemetry, "%d telemetry record(s) appended to %s instead (%d lost)", kept, TelemetryFile, n-kept)
+		resp.Telemetry = nil
+	}
+	return resp
+}
+
+// CheckCapability checks, for a self-test, that the host supports feature, which the hook's
+// responses need for use (e.g. "rewritten commands"). The check only sees CODEX_HOOK_CAPABILITIES,
+// not the envelope of an event.
+func CheckCapability(feature, use string) Check {
+	return Check{
+		Name: fmt.Sprintf("host supports %s, for %s", feature, use),
+		Run: func(_ context.Context, env Env) error {
+			if env.Supports(feature) {
+				return nil
+			}
+			return fmt.Errorf("not in %s; responses that need it are downgraded (see HostSupports)", CapabilitiesEnv)
+		},
+	}
+}
@@ -0,0 +1,281 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// allCapabilities is CapabilitiesEnv for a host that supports every response field.
+var allCapabilities = strings.Join([]string{hooksdk.CapabilityModify, hooksdk.CapabilityAdditionalContext,
+	hooksdk.CapabilityQueuedUserMessages, hooksdk.CapabilityQuestion, hooksdk.CapabilityTelemetry}, ",")
+
+// capabilitiesMain is the hook HOOKSDK_TEST_CAPABILITIES runs: it reads the payload from stdin,
+// prints a JSON line saying which of the comma-separated capabilities in the variable the host
+// supports, and writes a response with additional context.
+func capabilitiesMain() {
+	if _, err := hooksdk.ReadPayload(); err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+	supports := map[string]bool{}
+	for _, c := range strings.Split(os.Getenv("HOOKSDK_TEST_CAPABILITIES"), ",") {
+		supports[c] = hooksdk.HostSupports(c)
+	}
+	json.NewEncoder(os.Stdout).Encode(supports)
+	hooksdk.WriteResponse(hooksdk.Allow().InjectContext("ctx"))
+	os.Exit(0)
+}
+
+// capabilityEnvelope is an inline envelope for payload with capabilities.
+func capabilityEnvelope(t *testing.T, payload []byte, capabilities any) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"payload": json.RawMessage(payload), "capabilities": capabilities})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// dropped returns the capabilities the warn lines of stderr say were dropped, in order.
+func dropped(t *testing.T, stderr string) []string {
+	t.Helper()
+	var out []string
+	for _, line := range strings.Split(strings.TrimSpace(stderr), "\n") {
+		var rec map[string]any
+		if line == "" || json.Unmarshal([]byte(line), &rec) != nil || rec["stage"] != "capabilities" {
+			continue
+		}
+		msg, _ := rec["error"].(string)
+		feature, _, _ := strings.Cut(strings.TrimPrefix(msg, "the host doesn't support "), ":")
+		if rec["level"] != "warn" || feature == msg {
+			t.Errorf("capabilities line = %v", rec)
+		}
+		out = append(out, feature)
+	}
+	return out
+}
+
+func withSystemMessage(r hooksdk.Response, msg string) hooksdk.Response {
+	r.SystemMessage = msg
+	return r
+}
+
+func TestDowngrade(t *testing.T) {
+	t.Setenv("CODEX_HOOK_NAME", "rewriter")
+	command := hooktest.ApprovalRequested().WithCommand("pip install x").Bytes()
+	question := hooksdk.AskQuestion(hooksdk.Question{Title: "Deploy?", Options: hooksdk.DefaultOptions()})
+	tests := []struct {
+		name  string
+		stdin []byte
+		resp  hooksdk.Response
+		// want checks the downgraded response.
+		want    func(hooksdk.Response) bool
+		code    int
+		dropped []string
+	}{
+		{"allow with modify", command, withSystemMessage(hooksdk.Allow().ReplaceField("command", []string{"pip", "install", "--no-deps", "x"}), "rewrote"),
+			func(r hooksdk.Response) bool {
+				return r.Decision == hooksdk.DecisionDeny && r.ReasonCode == hooksdk.ReasonCapabilityMissing && r.Modify == nil &&
+					strings.HasPrefix(r.Reason, "rewriter: the host can't apply the change to command ") && r.SystemMessage == "rewrote"
+			}, hooksdk.ExitDeny, []string{hooksdk.CapabilityModify}},
+		{"ask with modify", command, hooksdk.Ask("sure?").ReplaceField("command", []string{"ls"}),
+			func(r hooksdk.Response) bool {
+				return r.Decision == hooksdk.DecisionDeny && r.ReasonCode == hooksdk.ReasonCapabilityMissing && r.Modify == nil
+			}, hooksdk.ExitDeny, []string{hooksdk.CapabilityModify}},
+		{"deny with modify", command, hooksdk.Deny("no").ReplaceField("command", []string{"ls"}),
+			func(r hooksdk.Response) bool {
+				return r.Decision == hooksdk.DecisionDeny && r.Reason == "no" && r.ReasonCode == "" && r.Modify == nil
+			}, hooksdk.ExitDeny, []string{hooksdk.CapabilityModify}},
+		{"question", hooktest.ApprovalRequested().Bytes(), question,
+			func(r hooksdk.Response) bool {
+				return r.Decision == hooksdk.DecisionAsk && r.Question == nil && r.Prompt == "Deploy?"
+			}, hooksdk.ExitOK, []string{hooksdk.CapabilityQuestion}},
+		{"question with a prompt", hooktest.ApprovalRequested().Bytes(), func() hooksdk.Response { q := question; q.Prompt = "Deploy now?"; return q }(),
+			func(r hooksdk.Response) bool { return r.Question == nil && r.Prompt == "Deploy now?" }, hooksdk.ExitOK, []string{hooksdk.CapabilityQuestion}},
+		{"additional context", hooktest.ToolCallFinished().Bytes(), hooksdk.Allow().InjectContext("tests failed"),
+			func(r hooksdk.Response) bool { return r.Decision == hooksdk.DecisionAllow && r.AdditionalContext == "" },
+			hooksdk.ExitOK, []string{hooksdk.CapabilityAdditionalContext}},
+		{"queued user messages", hooktest.ToolCallFinished().Bytes(), hooksdk.Allow().QueueUserMessage("fix the tests"),
+			func(r hooksdk.Response) bool { return r.QueuedUserMessages == nil }, hooksdk.ExitOK, []string{hooksdk.CapabilityQueuedUserMessages}},
+		{"telemetry", hooktest.ToolCallFinished().Bytes(), hooksdk.Allow().AddTelemetry("score", map[string]any{"n": 1}),
+			func(r hooksdk.Response) bool { return r.Telemetry == nil }, hooksdk.ExitOK, []string{hooksdk.CapabilityTelemetry}},
+		{"a deny with everything", command, hooksdk.Deny("no").ReplaceField("command", []string{"ls"}).InjectContext("c").QueueUserMessage("m"),
+			func(r hooksdk.Response) bool {
+				return r.Modify == nil && r.AdditionalContext == "" && r.QueuedUserMessages == nil
+			}, hooksdk.ExitDeny, []string{hooksdk.CapabilityModify, hooksdk.CapabilityAdditionalContext, hooksdk.CapabilityQueuedUserMessages}},
+		// The deny a modification turns into still drops what the host doesn't support.
+		{"allow with modify and context", command, hooksdk.Allow().ReplaceField("command", []string{"ls"}).InjectContext("c"),
+			func(r hooksdk.Response) bool {
+				return r.Decision == hooksdk.DecisionDeny && r.AdditionalContext == ""
+			}, hooksdk.ExitDeny, []string{hooksdk.CapabilityModify, hooksdk.CapabilityAdditionalContext}},
+		{"nothing to drop", command, withSystemMessage(hooksdk.Allow(), "ok"),
+			func(r hooksdk.Response) bool { return r.Decision == hooksdk.DecisionAllow && r.SystemMessage == "ok" }, hooksdk.ExitOK, nil},
+	}
+	for _, tt := range tests {
+		// A host that lists no capabilities, in the envelope or in the environment, supports none.
+		home := t.TempDir()
+		t.Setenv("CODEX_HOME", home)
+		t.Setenv(hooksdk.CapabilitiesEnv, "")
+		for _, stdin := range [][]byte{tt.stdin, capabilityEnvelope(t, tt.stdin, []string{})} {
+			res := hooktest.RunHook(t, respond(tt.resp, nil), stdin)
+			if res.ExitCode != tt.code || !tt.want(res.Response) {
+				t.Errorf("%s: exit %d, response %+v", tt.name, res.ExitCode, res.Response)
+			}
+			if got := dropped(t, res.Stderr); !reflect.DeepEqual(got, tt.dropped) {
+				t.Errorf("%s: dropped %q, want %q\n%s", tt.name, got, tt.dropped, res.Stderr)
+			}
+		}
+		// Telemetry the host can't take goes to the telemetry log instead.
+		if tt.name == "telemetry" {
+			data, err := os.ReadFile(filepath.Join(home, hooksdk.TelemetryFile))
+			if err != nil || strings.Count(string(data), `"name":"score"`) != 2 {
+				t.Errorf("telemetry log = %s, %v", data, err)
+			}
+		}
+
+		// A host that supports everything gets the response as it was.
+		t.Setenv(hooksdk.CapabilitiesEnv, allCapabilities)
+		res := hooktest.RunHook(t, respond(tt.resp, nil), tt.stdin)
+		if got := dropped(t, res.Stderr); got != nil {
+			t.Errorf("%s: with every capability, dropped %q", tt.name, got)
+		}
+		want := tt.resp
+		want.Metadata = res.Response.Metadata
+		if got, _ := json.Marshal(res.Response); !jsonEqual(t, got, mustMarshal(t, want)) {
+			t.Errorf("%s: with every capability, response %s", tt.name, got)
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDowngradeEnvelopeCapabilities(t *testing.T) {
+	// The envelope's capabilities, when it has any, stand for the host's instead of the environment's.
+	payload := hooktest.ApprovalRequested().WithCommand("pip install x").Bytes()
+	modify := respond(hooksdk.Allow().ReplaceField("command", []string{"ls"}).InjectContext("c"), nil)
+	tests := []struct {
+		env          string
+		capabilities any
+		dropped      []string
+	}{
+		{allCapabilities, []string{}, []string{hooksdk.CapabilityModify, hooksdk.CapabilityAdditionalContext}},
+		{"", []string{"MODIFY", " additional_context "}, nil},
+		{"", []string{hooksdk.CapabilityModify}, []string{hooksdk.CapabilityAdditionalContext}},
+		{hooksdk.CapabilityModify, nil, []string{hooksdk.CapabilityAdditionalContext}},
+		{"", []string{"", "telemetry"}, []string{hooksdk.CapabilityModify, hooksdk.CapabilityAdditionalContext}},
+	}
+	for _, tt := range tests {
+		t.Setenv(hooksdk.CapabilitiesEnv, tt.env)
+		res := hooktest.RunHook(t, modify, capabilityEnvelope(t, payload, tt.capabilities))
+		if got := dropped(t, res.Stderr); !reflect.DeepEqual(got, tt.dropped) {
+			t.Errorf("env %q, envelope %v: dropped %q, want %q", tt.env, tt.capabilities, got, tt.dropped)
+		}
+	}
+
+	// Anything but an array of strings is an invalid envelope, inline or naming a payload file.
+	for _, caps := range []any{"modify", []any{"modify", 1}, map[string]any{"modify": true}} {
+		for _, stdin := range [][]byte{
+			capabilityEnvelope(t, payload, caps),
+			pathEnvelope(t, "payload.json", payload, map[string]any{"capabilities": caps}),
+		} {
+			if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin)); !errors.Is(err, hooksdk.ErrInvalidEnvelope) || !strings.Contains(err.Error(), "capabilities") {
+				t.Errorf("capabilities %v: %v", caps, err)
+			}
+		}
+	}
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(pathEnvelope(t, "payload.json", payload, map[string]any{"capabilities": []string{"modify"}}))); err != nil {
+		t.Errorf("capabilities with a payload file: %v", err)
+	}
+}
+
+func TestWriteResponseDowngrades(t *testing.T) {
+	resp := hooksdk.Allow().ReplaceField("command", []string{"ls"})
+	for env, want := range map[string]hooksdk.Decision{"": hooksdk.DecisionDeny, hooksdk.CapabilityModify: hooksdk.DecisionAllow} {
+		stdio, out, errOut := testIO(nil, map[string]string{hooksdk.CapabilitiesEnv: env})
+		if err := hooksdk.WriteResponse(resp, hooksdk.WithIO(stdio)); err != nil {
+			t.Fatal(err)
+		}
+		var got hooksdk.Response
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil || got.Decision != want {
+			t.Errorf("%s %q: response %s, %v", hooksdk.CapabilitiesEnv, env, out, err)
+		}
+		if d := dropped(t, errOut.String()); len(d) != 0 != (want == hooksdk.DecisionDeny) {
+			t.Errorf("%s %q: dropped %q", hooksdk.CapabilitiesEnv, env, d)
+		}
+	}
+}
+
+func TestHostSupports(t *testing.T) {
+	stdio, _, _ := testIO(nil, map[string]string{hooksdk.CapabilitiesEnv: "modify, Question"})
+	for c, want := range map[string]bool{hooksdk.CapabilityModify: true, hooksdk.CapabilityQuestion: true, hooksdk.CapabilityTelemetry: false, "": false} {
+		if got := stdio.HostSupports(c); got != want {
+			t.Errorf("HostSupports(%q) = %v, want %v", c, got, want)
+		}
+	}
+	stdio, _, _ = testIO(nil, nil)
+	if stdio.HostSupports(hooksdk.CapabilityModify) {
+		t.Error("a host that lists nothing supports modify")
+	}
+
+	// In a hook, the envelope on stdin says, and WriteResponse downgrades by it.
+	caps := hooksdk.CapabilityModify + "," + hooksdk.CapabilityAdditionalContext
+	for _, tt := range []struct {
+		env, stdin string
+		want       map[string]bool
+	}{
+		{caps, string(capabilityEnvelope(t, hooktest.SessionStart().Bytes(), []string{"modify"})), map[string]bool{"modify": true, "additional_context": false}},
+		{"", string(capabilityEnvelope(t, hooktest.SessionStart().Bytes(), []string{"additional_context"})), map[string]bool{"modify": false, "additional_context": true}},
+		{caps, string(hooktest.SessionStart().Bytes()), map[string]bool{"modify": true, "additional_context": true}},
+		{"", string(hooktest.SessionStart().Bytes()), map[string]bool{"modify": false, "additional_context": false}},
+	} {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "HOOKSDK_TEST_CAPABILITIES="+caps, hooksdk.CapabilitiesEnv+"="+tt.env, "CODEX_HOME="+t.TempDir())
+		cmd.Stdin = strings.NewReader(tt.stdin)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%v: %s", err, stderr.String())
+		}
+		lines := strings.SplitN(string(out), "\n", 2)
+		var supports map[string]bool
+		var resp hooksdk.Response
+		if len(lines) != 2 || json.Unmarshal([]byte(lines[0]), &supports) != nil || json.Unmarshal([]byte(lines[1]), &resp) != nil {
+			t.Fatalf("output %q", out)
+		}
+		if !reflect.DeepEqual(supports, tt.want) || (resp.AdditionalContext == "ctx") != tt.want["additional_context"] {
+			t.Errorf("env %q, stdin %s: supports %v, response %+v", tt.env, tt.stdin, supports, resp)
+		}
+	}
+}
+
+func TestCheckCapability(t *testing.T) {
+	check := hooksdk.CheckCapability(hooksdk.CapabilityModify, "rewritten commands")
+	if !strings.Contains(check.Name, "modify") || !strings.Contains(check.Name, "rewritten commands") {
+		t.Errorf("Name = %q", check.Name)
+	}
+	if err := check.Run(context.Background(), hooksdk.FromMap(map[string]string{hooksdk.CapabilitiesEnv: "Modify"})); err != nil {
+		t.Errorf("with the capability: %v", err)
+	}
+	if err := check.Run(context.Background(), hooksdk.FromMap(nil)); err == nil || !strings.Contains(err.Error(), hooksdk.CapabilitiesEnv) {
+		t.Errorf("without it: %v", err)
+	}
+}
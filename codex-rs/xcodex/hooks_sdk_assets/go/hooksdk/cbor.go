@@ -0,0 +1,127 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/cbor"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/utf8safe"
+)
+
+// PayloadFormat is the encoding of a payload file, as the envelope's `payload_format` names it.
+type PayloadFormat string
+
+const (
+	// PayloadFormatJSON is the default, and the only format of stdin and of inline payloads.
+	PayloadFormatJSON PayloadFormat = "json"
+	// PayloadFormatCBOR is CBOR (RFC 8949), which the host may write a payload_path file or
+	// payload_fd in: byte strings don't have to be base64-encoded, and integers of any size keep
+	// their precision.
+	//
+	// A CBOR payload reads into the same HookPayload as its JSON encoding would, except that its
+	// byte strings are []byte values in RawPayload and in ReadPayloadJSON's map. The typed fields,
+	// ReadPayloadRaw, and WithRawJSON see the payload as JSON, where they are base64 strings.
+	PayloadFormatCBOR PayloadFormat = "cbor"
+)
+
+// WithPayloadFormat tells ParseHookPayload the bytes it is given are in format f, e.g. a CBOR
+// payload file read with ParseEnvelope. ReadPayload and the other readers learn the format from
+// the envelope and need no option.
+func WithPayloadFormat(f PayloadFormat) Option {
+	return func(o *options) { o.payloadFormat = f }
+}
+
+// decodeCBOR decodes a CBOR payload into raw, with the WithInvalidUTF8 policy applied to its text
+// strings, and returns it along with view, its JSON encoding, which the readers that work on bytes
+// (peeking, filtering, WithRawJSON, debug captures) see instead.
+func (o *options) decodeCBOR(data []byte) (raw map[string]any, view []byte, err error) {
+	if isBlank(data) {
+		return nil, nil, ErrEmptyPayload
+	}
+	v, err := cbor.Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, ok := v.(map[string]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("hooksdk: CBOR payload is %T, not a map", v)
+	}
+	if field := utf8safe.Invalid(raw); field != "" {
+		switch o.invalidUTF8 {
+		case InvalidUTF8Fail:
+			return nil, nil, &InvalidUTF8Error{Field: field}
+		case InvalidUTF8Base64:
+			raw = utf8safe.Encode(raw).(map[string]any)
+		}
+	}
+	// encoding/json replaces what is left; RawPayload should say what the typed fields do.
+	raw = validUTF8(raw).(map[string]any)
+	view, err = json.Marshal(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, view, nil
+}
+
+// validUTF8 returns v with the invalid bytes of its keys and strings replaced by U+FFFD, as
+// encoding/json would decode them. v is not changed.
+func validUTF8(v any) any {
+	switch v := v.(type) {
+	case string:
+		return strings.ToValidUTF8(v, string(utf8.RuneError))
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			out[strings.ToValidUTF8(key, string(utf8.RuneError))] = validUTF8(value)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			out[i] = validUTF8(value)
+		}
+		return out
+	}
+	return v
+}
+
+// parseDecoded is ParseHookPayload for a CBOR payload: the envelope's, already decoded, or else
+// data. The typed fields are decoded from the JSON view, and RawPayload is the decoded map.
+func (o *options) parseDecoded(data []byte) (*HookPayload, error) {
+	raw, view := o.decoded, []byte(nil)
+	if raw == nil {
+		var err error
+		if raw, view, err = o.decodeCBOR(data); err != nil {
+			return nil, err
+		}
+	}
+	version, err := o.migrateMap(raw)
+	if err != nil {
+		return nil, err
+	}
+	if view == nil || needsMigration(version) {
+		if view, err = json.Marshal(raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.checkRaw(view); err != nil {
+		return nil, err
+	}
+	var p HookPayload
+	if err := json.Unmarshal(view, &p); err != nil {
+		return nil, err
+	}
+	p.RawPayload = raw
+	p.sentVersion = &version
+	p.invocationID = payloadInvocationID(p.RawPayload)
+	if o.rawJSON {
+		p.rawJSON = view
+	}
+	p.XcodexEventType = string(ParseEventType(p.EventType()))
+	if err := o.checkPayload(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
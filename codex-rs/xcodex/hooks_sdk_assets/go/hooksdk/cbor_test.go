@@ -0,0 +1,170 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// cborFile returns the envelope naming data, CBOR, written to a payload_path file, with
+// fields added.
+func cborFile(t *testing.T, data []byte, fields map[string]any) []byte {
+	t.Helper()
+	env := map[string]any{"payload_format": "cbor"}
+	for k, v := range fields {
+		env[k] = v
+	}
+	return pathEnvelope(t, "payload.cbor", data, env)
+}
+
+// samePayload reports whether a and b have the same typed fields, RawPayload, and version; the
+// invocation ids made for each read differ.
+func samePayload(a, b *hooksdk.HookPayload) bool {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < va.NumField(); i++ {
+		if va.Type().Field(i).IsExported() && !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			return false
+		}
+	}
+	return a.Version() == b.Version() && a.Type() == b.Type()
+}
+
+func TestCBORMatchesJSON(t *testing.T) {
+	builders := hooktest.Fixtures()
+	builders["big integers"] = hooktest.ToolCallFinished().With("total_bytes", json.Number("123456789012345678901234567890")).
+		With("exit_code", -9007199254740993).With("ratio", 0.1).With("duration_ms", 1<<40)
+	builders["legacy"] = hooktest.ToolCallFinished().WithSessionID("s1").Legacy()
+	builders["nested"] = hooktest.ToolCallStarted().With("tool_input", map[string]any{"argv": []any{"ls", nil, true}, "env": map[string]any{}})
+	for name, b := range builders {
+		want, err := hooksdk.ParseHookPayload(b.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// Parsed directly, and read from a payload file named by an envelope.
+		got, err := hooksdk.ParseHookPayload(b.CBOR(), hooksdk.WithPayloadFormat(hooksdk.PayloadFormatCBOR))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !samePayload(got, want) {
+			t.Errorf("%s: from CBOR\n%#v\nwant\n%#v", name, got, want)
+		}
+		read, err := hooksdk.ReadPayloadFrom(bytes.NewReader(hooktest.WriteCBOREnvelope(t, b.CBOR())))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		fromJSON, err := hooksdk.ReadPayloadFrom(bytes.NewReader(hooktest.WriteEnvelope(t, b.Bytes())))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !samePayload(read, fromJSON) || !samePayload(read, want) {
+			t.Errorf("%s: read from a CBOR file = %v, from a JSON one %v", name, read.RawPayload, fromJSON.RawPayload)
+		}
+	}
+}
+
+func TestCBORByteStrings(t *testing.T) {
+	blob := []byte{0, 0xff, 'x'}
+	b := hooktest.ToolCallFinished().WithSessionID("s1").With("blob", blob).With("empty", []byte{})
+	stdin := cborFile(t, b.CBOR(), nil)
+	enc := base64.StdEncoding.EncodeToString(blob)
+
+	// RawPayload and ReadPayloadJSON keep the bytes.
+	p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.RawPayload["blob"].([]byte), blob) || p.RawPayload["empty"] == nil {
+		t.Errorf("RawPayload = %#v", p.RawPayload)
+	}
+	stdio, _, _ := testIO(stdin, nil)
+	m, err := hooksdk.ReadPayloadJSON(hooksdk.WithIO(stdio))
+	if err != nil || !bytes.Equal(m["blob"].([]byte), blob) {
+		t.Errorf("ReadPayloadJSON = %#v, %v", m["blob"], err)
+	}
+
+	// The JSON views see base64 strings, as from the payload's JSON encoding.
+	stdio, _, _ = testIO(stdin, nil)
+	raw, err := hooksdk.ReadPayloadRaw(hooksdk.WithIO(stdio))
+	if err != nil || !jsonEqual(t, raw, b.Bytes()) || !bytes.Contains(raw, []byte(`"blob":"`+enc+`"`)) || !bytes.Contains(raw, []byte(`"empty":""`)) {
+		t.Errorf("ReadPayloadRaw = %s, %v", raw, err)
+	}
+	streamed, _, err := openAll(t, stdin, nil)
+	if err != nil || streamed != string(raw) {
+		t.Errorf("OpenPayload = %s, %v; want %s", streamed, err, raw)
+	}
+	p, err = hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithRawJSON())
+	if err != nil || !bytes.Equal(p.RawJSON(), raw) {
+		t.Errorf("RawJSON = %s, %v", p.RawJSON(), err)
+	}
+	// So does encoding the payload again.
+	if out, _ := json.Marshal(p); !bytes.Contains(out, []byte(enc)) {
+		t.Errorf("MarshalJSON = %s", out)
+	}
+}
+
+func TestCBOREnvelope(t *testing.T) {
+	payload := hooktest.SessionStart().WithSessionID("cb")
+	for name, stdin := range map[string][]byte{
+		"payload-format": pathEnvelope(t, "payload.cbor", payload.CBOR(), map[string]any{"payload-format": "cbor"}),
+		"gzip":           cborFile(t, gzipBytes(t, payload.CBOR()), map[string]any{"payload_encoding": "gzip"}),
+		"checksum":       cborFile(t, payload.CBOR(), map[string]any{"payload_sha256": sha256Hex(payload.CBOR())}),
+		"json named":     pathEnvelope(t, "payload.json", payload.Bytes(), map[string]any{"payload_format": "json"}),
+	} {
+		if p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin)); err != nil || p.SessionID() != "cb" {
+			t.Errorf("%s: %v, %v", name, p, err)
+		}
+	}
+
+	for name, tt := range map[string]struct {
+		stdin []byte
+		want  string
+	}{
+		"unknown format": {cborFile(t, payload.CBOR(), map[string]any{"payload_format": "msgpack"}), "unsupported payload_format"},
+		"truncated":      {cborFile(t, payload.CBOR()[:10], nil), "payload_path"},
+		"not a map":      {cborFile(t, []byte{0x83, 1, 2, 3}, nil), "not a map"},
+		"JSON file":      {cborFile(t, payload.Bytes(), nil), "payload_path"},
+		"empty":          {cborFile(t, nil, nil), "empty"},
+	} {
+		_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(tt.stdin), hooksdk.WithPayloadRetry(0))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: %v, want an error saying %q", name, err, tt.want)
+		}
+		if name == "unknown format" && !errors.Is(err, hooksdk.ErrInvalidEnvelope) {
+			t.Errorf("%s: %v isn't ErrInvalidEnvelope", name, err)
+		}
+	}
+	if _, err := hooksdk.ParseHookPayload(nil, hooksdk.WithPayloadFormat(hooksdk.PayloadFormatCBOR)); !errors.Is(err, hooksdk.ErrEmptyPayload) {
+		t.Errorf("ParseHookPayload of nothing = %v", err)
+	}
+}
+
+func TestCBORInvalidUTF8(t *testing.T) {
+	data := hooktest.ToolCallFinished().With("output_preview", "ok \xff end").CBOR()
+	stdin := cborFile(t, data, nil)
+	read := func(policy hooksdk.InvalidUTF8Policy) (*hooksdk.HookPayload, error) {
+		return hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithInvalidUTF8(policy))
+	}
+
+	replaced := "ok " + string(utf8.RuneError) + " end"
+	p, err := read(hooksdk.InvalidUTF8Replace)
+	if err != nil || p.RawPayload["output_preview"] != replaced {
+		t.Errorf("replace: %q, %v", p.RawPayload["output_preview"], err)
+	}
+	p, err = read(hooksdk.InvalidUTF8Base64)
+	if err != nil || p.RawPayload["output_preview"] != replaced ||
+		p.RawPayload["output_preview"+hooksdk.Base64Suffix] != base64.StdEncoding.EncodeToString([]byte("ok \xff end")) {
+		t.Errorf("base64: %v, %v", p.RawPayload, err)
+	}
+	var ue *hooksdk.InvalidUTF8Error
+	if _, err := read(hooksdk.InvalidUTF8Fail); !errors.As(err, &ue) || ue.Field != "output_preview" {
+		t.Errorf("fail: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/atomicfile"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+)
+
+const lockTimeout = 5 * time.Second
+
+// Batcher rate-limits messages across hook processes: at most one post per Interval. Messages
+// arriving in between are queued in a state file under Dir and later sent together as a digest.
+//
+// Because each hook runs in its own short-lived process, something has to send the queue when
+// the interval ends; Add reports when the first message is queued so the caller can start a
+// flusher for it (see Flush).
+type Batcher struct {
+	Dir      string
+	Interval time.Duration
+}
+
+// NewBatcher returns a Batcher keeping its state in dir.
+func NewBatcher(dir string, interval time.Duration) *Batcher {
+	return &Batcher{Dir: dir, Interval: interval}
+}
+
+type batchState struct {
+	LastSent time.Time `json:"last_sent"`
+	Pending  []string  `json:"pending"`
+}
+
+// Add queues msg. It returns the messages to post now (msg plus anything still queued) when the
+// interval has passed since the last post. Otherwise it returns no messages, and flushAfter is
+// positive when msg started a new queue: the caller should arrange for Flush to run after that
+// long.
+func (b *Batcher) Add(msg string) (send []string, flushAfter time.Duration, err error) {
+	err = b.update(func(st *batchState, now time.Time) {
+		if wait := st.LastSent.Add(b.Interval).Sub(now); wait > 0 {
+			st.Pending = append(st.Pending, msg)
+			if len(st.Pending) == 1 {
+				flushAfter = wait
+			}
+			return
+		}
+		send = append(st.Pending, msg)
+		st.Pending = nil
+		st.LastSent = now
+	})
+	return send, flushAfter, err
+}
+
+// Flush returns the queued messages to post once the interval since the last post has passed.
+// Before that it returns no messages and how much longer to wait.
+func (b *Batcher) Flush() (send []string, wait time.Duration, err error) {
+	err = b.update(func(st *batchState, now time.Time) {
+		if len(st.Pending) == 0 {
+			return
+		}
+		if wait = st.LastSent.Add(b.Interval).Sub(now); wait > 0 {
+			return
+		}
+		wait = 0
+		send = st.Pending
+		st.Pending = nil
+		st.LastSent = now
+	})
+	return send, wait, err
+}
+
+// update applies fn to the state under the batch lock and saves the result.
+func (b *Batcher) update(fn func(st *batchState, now time.Time)) error {
+	if err := os.MkdirAll(b.Dir, 0o755); err != nil {
+		return err
+	}
+	lock, err := filelock.AcquireTimeout(filepath.Join(b.Dir, "batch.lock"), lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	path := filepath.Join(b.Dir, "batch.json")
+	var st batchState
+	if data, err := os.ReadFile(path); err == nil {
+		// A corrupt state file only costs the queued messages.
+		json.Unmarshal(data, &st)
+	}
+
+	fn(&st, time.Now())
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, data, 0o600)
+}
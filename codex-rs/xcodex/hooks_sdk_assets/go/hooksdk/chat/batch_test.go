@@ -0,0 +1,58 @@
+package chat_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/chat"
+)
+
+func TestBatcher(t *testing.T) {
+	const interval = 200 * time.Millisecond
+	dir := t.TempDir()
+	// A new Batcher for each call, as each hook invocation is a new process.
+	add := func(msg string) ([]string, time.Duration) {
+		t.Helper()
+		send, flushAfter, err := chat.NewBatcher(dir, interval).Add(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return send, flushAfter
+	}
+
+	// The first message goes out at once.
+	if send, flushAfter := add("a"); len(send) != 1 || send[0] != "a" || flushAfter != 0 {
+		t.Fatalf("first Add = %q, %v", send, flushAfter)
+	}
+	// Within the interval messages are queued, and only the first asks for a flusher.
+	send, flushAfter := add("b")
+	if len(send) != 0 || flushAfter <= 0 || flushAfter > interval {
+		t.Fatalf("second Add = %q, %v; want it queued with a flush", send, flushAfter)
+	}
+	if send, flushAfter := add("c"); len(send) != 0 || flushAfter != 0 {
+		t.Fatalf("third Add = %q, %v; want it queued", send, flushAfter)
+	}
+
+	// A flush before the interval ends waits.
+	b := chat.NewBatcher(dir, interval)
+	send, wait, err := b.Flush()
+	if err != nil || len(send) != 0 || wait <= 0 {
+		t.Fatalf("early Flush = %q, %v, %v; want a wait", send, wait, err)
+	}
+	time.Sleep(wait)
+	send, wait, err = b.Flush()
+	if err != nil || wait != 0 || len(send) != 2 || send[0] != "b" || send[1] != "c" {
+		t.Fatalf("Flush = %q, %v, %v; want the digest b, c", send, wait, err)
+	}
+	// The queue is empty now.
+	if send, wait, err := b.Flush(); err != nil || len(send) != 0 || wait != 0 {
+		t.Errorf("Flush of an empty queue = %q, %v, %v", send, wait, err)
+	}
+
+	// Once the interval has passed, the queue goes out with the next message.
+	add("d")
+	time.Sleep(interval)
+	if send, _ := add("e"); len(send) != 2 || send[0] != "d" || send[1] != "e" {
+		t.Errorf("Add after the interval = %q, want d, e", send)
+	}
+}
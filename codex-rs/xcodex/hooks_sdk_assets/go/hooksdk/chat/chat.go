@@ -0,0 +1,114 @@
+// Package chat renders messages for Slack and Discord incoming webhooks and batches bursts of
+// messages from separate hook processes into a single digest.
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Format is the JSON shape an incoming webhook expects.
+type Format string
+
+const (
+	// Slack posts `{"text": ..., "blocks": [...]}` with one mrkdwn section per message.
+	Slack Format = "slack"
+	// Discord posts `{"content": ...}`.
+	Discord Format = "discord"
+)
+
+// discordMaxContent is Discord's limit on `content`.
+const discordMaxContent = 2000
+
+// slackMaxBlocks is Slack's limit on blocks per message.
+const slackMaxBlocks = 50
+
+// ParseFormat parses "slack" or "discord" (case-insensitive).
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case Slack, Discord:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown chat format %q (want slack or discord)", s)
+}
+
+// DetectFormat picks the format from the webhook URL: Discord for discord.com /
+// discordapp.com webhooks, Slack otherwise (Slack-compatible webhooks, e.g. Mattermost, are the
+// common case).
+func DetectFormat(webhookURL string) Format {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return Slack
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, d := range []string{"discord.com", "discordapp.com"} {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return Discord
+		}
+	}
+	return Slack
+}
+
+// Body returns the request body posting messages. More than one message is sent as a digest
+// headed with the count; anything past the platform's size limits is summarized as "…and N more".
+func Body(format Format, messages []string) ([]byte, error) {
+	header := ""
+	if len(messages) > 1 {
+		header = fmt.Sprintf("%d events", len(messages))
+	}
+
+	if format == Discord {
+		var head []string
+		if header != "" {
+			head = []string{"**" + header + "**"}
+		}
+		content := strings.Join(append(head, messages...), "\n")
+		for n := len(messages) - 1; len(content) > discordMaxContent && n >= 1; n-- {
+			content = strings.Join(append(head, messages[:n]...), "\n") + fmt.Sprintf("\n…and %d more", len(messages)-n)
+		}
+		return json.Marshal(map[string]string{"content": truncate(content, discordMaxContent)})
+	}
+
+	var blocks []any
+	if header != "" {
+		blocks = append(blocks, map[string]any{
+			"type": "header",
+			"text": map[string]any{"type": "plain_text", "text": header},
+		})
+	}
+	for i, m := range messages {
+		if len(blocks) == slackMaxBlocks-1 && i < len(messages)-1 {
+			m = fmt.Sprintf("…and %d more", len(messages)-i)
+			blocks = append(blocks, section(m))
+			break
+		}
+		blocks = append(blocks, section(m))
+	}
+	text := strings.Join(messages, "\n")
+	if header != "" {
+		text = header
+	}
+	return json.Marshal(map[string]any{"text": truncate(text, 3000), "blocks": blocks})
+}
+
+// section is a Slack mrkdwn section; Slack caps its text at 3000 characters.
+func section(text string) map[string]any {
+	return map[string]any{
+		"type": "section",
+		"text": map[string]any{"type": "mrkdwn", "text": truncate(text, 3000)},
+	}
+}
+
+// truncate cuts s to at most max bytes on a rune boundary, ending with "…" when cut.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max - len("…")
+	for cut > 0 && (s[cut]&0xC0) == 0x80 {
+		cut--
+	}
+	return s[:cut] + "…"
+}
@@ -0,0 +1,130 @@
+package chat_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/chat"
+)
+
+func TestFormats(t *testing.T) {
+	for s, want := range map[string]chat.Format{"slack": chat.Slack, " Discord ": chat.Discord} {
+		if got, err := chat.ParseFormat(s); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", s, got, err, want)
+		}
+	}
+	if _, err := chat.ParseFormat("teams"); err == nil {
+		t.Errorf("ParseFormat(teams) succeeded")
+	}
+
+	for url, want := range map[string]chat.Format{
+		"https://discord.com/api/webhooks/1/x":        chat.Discord,
+		"https://ptb.discordapp.com/api/webhooks/1/x": chat.Discord,
+		"https://hooks.slack.com/services/T/B/x":      chat.Slack,
+		"https://mattermost.example.com/hooks/x":      chat.Slack,
+		"https://notdiscord.com/hooks/x":              chat.Slack,
+		"::bad":                                       chat.Slack,
+	} {
+		if got := chat.DetectFormat(url); got != want {
+			t.Errorf("DetectFormat(%s) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestSlackBody(t *testing.T) {
+	body := slackBody(t, []string{"*approval needed* `rm -rf build`"})
+	if body.Text != "*approval needed* `rm -rf build`" || len(body.Blocks) != 1 {
+		t.Fatalf("body = %+v", body)
+	}
+	if b := body.Blocks[0]; b.Type != "section" || b.Text.Type != "mrkdwn" || b.Text.Text != body.Text {
+		t.Errorf("block = %+v", b)
+	}
+
+	// A digest has a header, and past Slack's 50 blocks the rest are counted.
+	var messages []string
+	for i := 0; i < 60; i++ {
+		messages = append(messages, fmt.Sprintf("event %d", i))
+	}
+	body = slackBody(t, messages)
+	if body.Text != "60 events" || body.Blocks[0].Type != "header" || body.Blocks[0].Text.Text != "60 events" {
+		t.Errorf("digest header = %q, %+v", body.Text, body.Blocks[0])
+	}
+	if len(body.Blocks) != 50 {
+		t.Errorf("%d blocks, want 50", len(body.Blocks))
+	}
+	if last := body.Blocks[49].Text.Text; last != "…and 12 more" {
+		t.Errorf("last block = %q, want …and 12 more", last)
+	}
+}
+
+type slackMessage struct {
+	Text   string `json:"text"`
+	Blocks []struct {
+		Type string `json:"type"`
+		Text struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"text"`
+	} `json:"blocks"`
+}
+
+func slackBody(t *testing.T, messages []string) slackMessage {
+	t.Helper()
+	data, err := chat.Body(chat.Slack, messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body slackMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func discordContent(t *testing.T, messages []string) string {
+	t.Helper()
+	data, err := chat.Body(chat.Discord, messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 1 {
+		t.Errorf("body = %s, want only content", data)
+	}
+	return body["content"]
+}
+
+func TestDiscordBody(t *testing.T) {
+	if got := discordContent(t, []string{"turn complete"}); got != "turn complete" {
+		t.Errorf("content = %q", got)
+	}
+	if got := discordContent(t, []string{"a", "b"}); got != "**2 events**\na\nb" {
+		t.Errorf("digest = %q", got)
+	}
+
+	// Past Discord's 2000 characters, whole messages are dropped and counted.
+	messages := make([]string, 30)
+	for i := range messages {
+		messages[i] = strings.Repeat("x", 99)
+	}
+	got := discordContent(t, messages)
+	if len(got) > 2000 || !strings.HasSuffix(got, "more") || !strings.HasPrefix(got, "**30 events**\n") {
+		t.Errorf("content is %d bytes, ending %q", len(got), got[len(got)-20:])
+	}
+
+	// A single message too long for the limit is cut on a rune boundary.
+	got = discordContent(t, []string{strings.Repeat("é", 1500)})
+	if len(got) > 2000 || !strings.HasSuffix(got, "…") || !strings.HasPrefix(got, "éé") {
+		t.Errorf("content is %d bytes", len(got))
+	}
+	for _, r := range got {
+		if r != 'é' && r != '…' {
+			t.Fatalf("content has %q: split a rune", r)
+		}
+	}
+}
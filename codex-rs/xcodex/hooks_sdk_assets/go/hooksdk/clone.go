@@ -0,0 +1,119 @@
+package hooksdk
+
+import "reflect"
+
+// Clone returns a deep copy of p: nested objects and arrays are copied, so the copy can be
+// redacted or enriched without changing p. Strings and json.Number values are immutable and are
+// shared.
+func (p HookPayloadJSON) Clone() HookPayloadJSON {
+	if p == nil {
+		return nil
+	}
+	return HookPayloadJSON(cloneMap(p))
+}
+
+// Clone returns a deep copy of p, including RawPayload and everything its pointer, slice, and
+// untyped fields refer to. Raw() (like the fields) shares memory with the payload it came from,
+// so clone a payload before mutating it when the original is still needed, e.g. to log a
+// redacted copy while responding from the original.
+func (p *HookPayload) Clone() *HookPayload {
+	c := cloneStruct(p)
+	if c != nil {
+		// Unexported fields aren't copied by cloneStruct; these are never modified, so share them.
+		c.sentVersion, c.rawJSON, c.invocationID = p.sentVersion, p.rawJSON, p.invocationID
+	}
+	return c
+}
+
+func cloneMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+// cloneValue deep-copies a decoded JSON value. The types json.Unmarshal produces are copied
+// directly; anything else a hook stored in the map goes through reflection.
+func cloneValue(v any) any {
+	switch t := v.(type) {
+	case nil, string, bool, float64:
+		return v
+	case map[string]any:
+		return cloneMap(t)
+	case HookPayloadJSON:
+		return t.Clone()
+	case []any:
+		if t == nil {
+			return t
+		}
+		out := make([]any, len(t))
+		for i, item := range t {
+			out[i] = cloneValue(item)
+		}
+		return out
+	}
+	return cloneReflect(reflect.ValueOf(v)).Interface()
+}
+
+// cloneStruct deep-copies the struct p points to (a payload struct: exported fields only).
+func cloneStruct[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	return cloneReflect(reflect.ValueOf(p)).Interface().(*T)
+}
+
+func cloneReflect(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(cloneReflect(v.Elem()))
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(reflect.ValueOf(cloneValue(v.Interface())))
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), cloneReflect(iter.Value()))
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(cloneReflect(v.Index(i)))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(cloneReflect(v.Index(i)))
+		}
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		out.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if out.Field(i).CanSet() {
+				out.Field(i).Set(cloneReflect(v.Field(i)))
+			}
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,125 @@
+package hooksdk_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// nested returns a payload with objects and arrays several levels deep; each call builds a new one.
+func nested() hooksdk.HookPayloadJSON {
+	return hooksdk.HookPayloadJSON{
+		"xcodex_event_type": "tool-call-finished",
+		"attempt":           json.Number("2"),
+		"tool_input": map[string]any{
+			"command": "go test",
+			"env":     map[string]any{"HOME": "/home/u", "PATH": []any{"/bin", "/usr/bin"}},
+		},
+		"items": []any{
+			map[string]any{"id": json.Number("1"), "tags": []any{"a", "b"}},
+			[]any{json.Number("3"), nil, true},
+		},
+		// Values a hook stored itself, not ones json.Unmarshal makes.
+		"extra":    hooksdk.HookPayloadJSON{"k": []any{"v"}},
+		"argv":     []string{"ls", "-l"},
+		"counts":   map[string][]int{"x": {1, 2}},
+		"nothing":  nil,
+		"emptyArr": []any{},
+	}
+}
+
+func TestHookPayloadJSONClone(t *testing.T) {
+	orig := nested()
+	c := orig.Clone()
+	if !reflect.DeepEqual(c, orig) {
+		t.Fatalf("clone = %v, want %v", c, orig)
+	}
+
+	c["attempt"] = json.Number("9")
+	ti := c["tool_input"].(map[string]any)
+	ti["command"] = "[redacted]"
+	env := ti["env"].(map[string]any)
+	delete(env, "HOME")
+	env["PATH"].([]any)[0] = "/evil"
+	items := c["items"].([]any)
+	items[0].(map[string]any)["tags"].([]any)[1] = "z"
+	items[1].([]any)[0] = json.Number("4")
+	c["extra"].(hooksdk.HookPayloadJSON)["k"].([]any)[0] = "w"
+	c["argv"].([]string)[0] = "rm"
+	c["counts"].(map[string][]int)["x"][0] = 7
+	c["added"] = true
+
+	if !reflect.DeepEqual(orig, nested()) {
+		t.Errorf("mutating the clone changed the original: %v", orig)
+	}
+
+	if hooksdk.HookPayloadJSON(nil).Clone() != nil {
+		t.Errorf("nil payload cloned to non-nil")
+	}
+	if got := (hooksdk.HookPayloadJSON{"a": []any(nil)}).Clone(); got["a"].([]any) != nil {
+		t.Errorf("nil slice cloned to %#v", got["a"])
+	}
+}
+
+func TestHookPayloadClone(t *testing.T) {
+	data := hooktest.ApprovalRequested().With("approval_policy", map[string]any{"granular": []any{"exec"}}).
+		With("attempt", 1).Bytes()
+	orig, err := hooksdk.ParseHookPayload(data, hooksdk.WithRawJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := hooksdk.ParseHookPayload(data, hooksdk.WithRawJSON())
+
+	c := orig.Clone()
+	if !reflect.DeepEqual(c, orig) {
+		t.Fatalf("clone = %+v, want %+v", c, orig)
+	}
+	if c.Version() != orig.Version() || string(c.RawJSON()) != string(orig.RawJSON()) || c.InvocationID() != orig.InvocationID() {
+		t.Errorf("clone lost unexported state: version %d, raw JSON %q", c.Version(), c.RawJSON())
+	}
+
+	*c.Attempt = 5
+	c.Command[0] = "rm"
+	c.ApprovalPolicy.(map[string]any)["granular"].([]any)[0] = "patch"
+	c.Raw()["cwd"] = "/elsewhere"
+	c.Raw()["command"].([]any)[0] = "rm"
+
+	// Each parse gets its own invocation ID, so compare what the clone could have changed.
+	if !reflect.DeepEqual(orig.Raw(), want.Raw()) || *orig.Attempt != 1 || !reflect.DeepEqual(orig.Command, want.Command) ||
+		!reflect.DeepEqual(orig.ApprovalPolicy, want.ApprovalPolicy) {
+		t.Errorf("mutating the clone changed the original: %+v", orig)
+	}
+	if (*hooksdk.HookPayload)(nil).Clone() != nil {
+		t.Errorf("nil payload cloned to non-nil")
+	}
+}
+
+func TestTypedPayloadClone(t *testing.T) {
+	event := func() *hooksdk.ToolCallFinishedPayload {
+		ev, err := hooktest.ToolCallFinished().With("tool_input", map[string]any{"command": "ls", "args": []any{"-l"}}).Build().Event()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ev.(*hooksdk.ToolCallFinishedPayload)
+	}
+	orig := event()
+	c := orig.Clone()
+	if !reflect.DeepEqual(c, orig) {
+		t.Fatalf("clone = %+v, want %+v", c, orig)
+	}
+
+	*c.OutputPreview = "[redacted]"
+	c.ToolInput.(map[string]any)["args"].([]any)[0] = "-a"
+	c.Raw()["tool_input"].(map[string]any)["command"] = "rm"
+	c.ToolName = "apply_patch"
+
+	if !reflect.DeepEqual(orig, event()) {
+		t.Errorf("mutating the clone changed the original: %+v", orig)
+	}
+	if (*hooksdk.SessionStartPayload)(nil).Clone() != nil {
+		t.Errorf("nil payload cloned to non-nil")
+	}
+}
@@ -0,0 +1,197 @@
+// Package cloudevents wraps hook events as CloudEvents 1.0 (https://cloudevents.io), for event
+// buses that consume them:
+//
+//	ce, err := cloudevents.ToCloudEvent(payload)
+//	body, _ := json.Marshal(ce) // structured mode: Content-Type application/cloudevents+json
+//	// or binary mode: ce.Header() as the request headers and ce.Data as the body
+//
+// The attributes come from the payload: `id` is its invocation id (HookPayload.InvocationID), so
+// the event can be matched with the hook's logs and response, and a resent event (from an outbox,
+// say) keeps it and consumers can drop the duplicate; a payload without one gets a hash of itself.
+// `source` is "xcodex/hooks/<hook name>"; `type` is
+// "dev.xcodex.hook.<event type>"; `subject` is the session id; `time` is the payload's
+// timestamp; and `data` is the raw payload, as application/json.
+package cloudevents
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// SpecVersion is the CloudEvents version of the events ToCloudEvent makes.
+const SpecVersion = "1.0"
+
+// ContentType is the Content-Type of a structured-mode event: the event itself as JSON.
+const ContentType = "application/cloudevents+json"
+
+// TypePrefix starts the `type` of every event, followed by the hook event type.
+const TypePrefix = "dev.xcodex.hook."
+
+// CloudEvent is an event in the CloudEvents JSON format, which is how it marshals (structured
+// mode).
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// ToCloudEvent wraps p. It fails only for a payload without an event type, or whose raw payload
+// can't be encoded.
+func ToCloudEvent(p *hooksdk.HookPayload) (ce CloudEvent, err error) {
+	eventType := p.EventType()
+	if eventType == "" {
+		return ce, errors.New("cloudevents: payload has no event type")
+	}
+	data, err := json.Marshal(p.RawPayload)
+	if err != nil {
+		return ce, fmt.Errorf("cloudevents: encode payload: %w", err)
+	}
+	id := p.InvocationID()
+	if id == "" {
+		// Maps marshal with sorted keys, so the same payload always hashes the same.
+		sum := sha256.Sum256(data)
+		id = hex.EncodeToString(sum[:16])
+	}
+	ce = CloudEvent{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Source:          "xcodex/hooks/" + hooklog.HookName(),
+		Type:            TypePrefix + eventType,
+		Subject:         p.SessionID(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+	t := p.Time()
+	if t.IsZero() {
+		t = time.Now()
+	}
+	ce.Time = t.UTC().Format(time.RFC3339Nano)
+	return ce, nil
+}
+
+// Validate checks ce against the CloudEvents 1.0 spec: the required attributes are set,
+// specversion is 1.0, and time is an RFC 3339 timestamp.
+func (ce CloudEvent) Validate() error {
+	for _, a := range []struct{ name, value string }{
+		{"specversion", ce.SpecVersion}, {"id", ce.ID}, {"source", ce.Source}, {"type", ce.Type},
+	} {
+		if a.value == "" {
+			return fmt.Errorf("cloudevents: %s is required", a.name)
+		}
+	}
+	if ce.SpecVersion != SpecVersion {
+		return fmt.Errorf("cloudevents: specversion %q isn't %s", ce.SpecVersion, SpecVersion)
+	}
+	if ce.Time != "" {
+		if _, err := time.Parse(time.RFC3339Nano, ce.Time); err != nil {
+			return fmt.Errorf("cloudevents: time %q isn't an RFC 3339 timestamp", ce.Time)
+		}
+	}
+	if len(ce.Data) > 0 && !json.Valid(ce.Data) {
+		return errors.New("cloudevents: data isn't valid JSON")
+	}
+	return nil
+}
+
+// Header returns the HTTP headers of ce in binary mode, where the body is ce.Data: a `ce-`
+// header per attribute and Content-Type set to the data content type. Values are percent-encoded
+// as the HTTP binding requires.
+func (ce CloudEvent) Header() http.Header {
+	h := http.Header{}
+	ce.SetHeader(h)
+	return h
+}
+
+// SetHeader sets the binary-mode headers of ce (see Header) in h.
+func (ce CloudEvent) SetHeader(h http.Header) {
+	for _, a := range []struct{ name, value string }{
+		{"Ce-Specversion", ce.SpecVersion},
+		{"Ce-Id", ce.ID},
+		{"Ce-Source", ce.Source},
+		{"Ce-Type", ce.Type},
+		{"Ce-Subject", ce.Subject},
+		{"Ce-Time", ce.Time},
+	} {
+		if a.value != "" {
+			h.Set(a.name, encodeHeaderValue(a.value))
+		}
+	}
+	if ce.DataContentType != "" {
+		h.Set("Content-Type", ce.DataContentType)
+	}
+}
+
+// FromHeader reads a binary-mode event, the inverse of Header, e.g. in a receiver.
+func FromHeader(h http.Header, body []byte) (CloudEvent, error) {
+	ce := CloudEvent{DataContentType: h.Get("Content-Type"), Data: body}
+	for _, a := range []struct {
+		name  string
+		value *string
+	}{
+		{"Ce-Specversion", &ce.SpecVersion},
+		{"Ce-Id", &ce.ID},
+		{"Ce-Source", &ce.Source},
+		{"Ce-Type", &ce.Type},
+		{"Ce-Subject", &ce.Subject},
+		{"Ce-Time", &ce.Time},
+	} {
+		v, err := decodeHeaderValue(h.Get(a.name))
+		if err != nil {
+			return CloudEvent{}, fmt.Errorf("cloudevents: %s: %w", a.name, err)
+		}
+		*a.value = v
+	}
+	return ce, ce.Validate()
+}
+
+// encodeHeaderValue percent-encodes the bytes of s a header value can't carry: space, `"`, `%`,
+// and everything outside printable ASCII.
+func encodeHeaderValue(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func decodeHeaderValue(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("bad percent-encoding in %q", s)
+		}
+		v, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("bad percent-encoding in %q", s)
+		}
+		b.WriteByte(v[0])
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,276 @@
+package cloudevents_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/cloudevents"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// schema is the part of testdata/cloudevents.json conformance is checked against: the attributes'
+// definitions, the required ones, and the pattern extension attributes must match.
+type schema struct {
+	Properties map[string]struct {
+		Ref string `json:"$ref"`
+	} `json:"properties"`
+	PatternProperties map[string]json.RawMessage `json:"patternProperties"`
+	Required          []string                   `json:"required"`
+	Definitions       map[string]struct {
+		Type      any    `json:"type"`
+		Format    string `json:"format"`
+		MinLength int    `json:"minLength"`
+	} `json:"definitions"`
+}
+
+func loadSchema(t *testing.T) *schema {
+	t.Helper()
+	data, err := os.ReadFile("testdata/cloudevents.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	return &s
+}
+
+// violations checks an event marshaled as JSON against s, returning what doesn't conform.
+func (s *schema) violations(data []byte) []string {
+	var event map[string]any
+	if err := json.Unmarshal(data, &event); err != nil {
+		return []string{err.Error()}
+	}
+	var out []string
+	for _, name := range s.Required {
+		if _, ok := event[name]; !ok {
+			out = append(out, name+" is required")
+		}
+	}
+	for name, v := range event {
+		prop, ok := s.Properties[name]
+		if !ok {
+			matched := false
+			for pattern := range s.PatternProperties {
+				matched = matched || regexp.MustCompile(pattern).MatchString(name)
+			}
+			if !matched {
+				out = append(out, name+" isn't a valid extension attribute name")
+			}
+			continue
+		}
+		def := s.Definitions[strings.TrimPrefix(prop.Ref, "#/definitions/")]
+		if !typeMatches(def.Type, v) {
+			out = append(out, fmt.Sprintf("%s: %T isn't %v", name, v, def.Type))
+			continue
+		}
+		str, isString := v.(string)
+		if !isString {
+			continue
+		}
+		if len(str) < def.MinLength {
+			out = append(out, name+" is empty")
+		}
+		switch def.Format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				out = append(out, name+" isn't a date-time")
+			}
+		case "uri-reference":
+			if _, err := url.Parse(str); err != nil {
+				out = append(out, name+" isn't a URI reference")
+			}
+		case "uri":
+			if u, err := url.Parse(str); err != nil || !u.IsAbs() {
+				out = append(out, name+" isn't an absolute URI")
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// typeMatches reports whether v, decoded from JSON, has the JSON Schema type (or one of the
+// types) in want.
+func typeMatches(want, v any) bool {
+	types, ok := want.([]any)
+	if !ok {
+		types = []any{want}
+	}
+	for _, t := range types {
+		switch t {
+		case "string":
+			_, ok = v.(string)
+		case "number", "integer":
+			_, ok = v.(float64)
+		case "boolean":
+			_, ok = v.(bool)
+		case "object":
+			_, ok = v.(map[string]any)
+		case "array":
+			_, ok = v.([]any)
+		case "null":
+			ok = v == nil
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// TestConformance checks the event of every fixture against the CloudEvents JSON schema.
+func TestConformance(t *testing.T) {
+	t.Setenv("CODEX_HOOK_NAME", "forward_webhook")
+	s := loadSchema(t)
+	for eventType, b := range hooktest.Fixtures() {
+		p := b.WithSessionID("s1").With("timestamp", "2026-01-02T03:04:05.5Z").Build()
+		ce, err := cloudevents.ToCloudEvent(p)
+		if err != nil {
+			t.Errorf("%s: %v", eventType, err)
+			continue
+		}
+		event, err := json.Marshal(ce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := s.violations(event); len(v) > 0 {
+			t.Errorf("%s: %s doesn't conform: %q", eventType, event, v)
+		}
+		if err := ce.Validate(); err != nil {
+			t.Errorf("%s: Validate: %v", eventType, err)
+		}
+		want := cloudevents.CloudEvent{
+			SpecVersion:     "1.0",
+			ID:              p.InvocationID(),
+			Source:          "xcodex/hooks/forward_webhook",
+			Type:            "dev.xcodex.hook." + eventType,
+			Subject:         "s1",
+			Time:            "2026-01-02T03:04:05.5Z",
+			DataContentType: "application/json",
+		}
+		rawJSON, _ := json.Marshal(p.RawPayload)
+		var data, raw any
+		json.Unmarshal(rawJSON, &raw)
+		if err := json.Unmarshal(ce.Data, &data); err != nil || !reflect.DeepEqual(data, raw) {
+			t.Errorf("%s: data = %s, want the raw payload", eventType, ce.Data)
+		}
+		ce.Data = nil
+		if !reflect.DeepEqual(ce, want) {
+			t.Errorf("%s: event = %+v, want %+v", eventType, ce, want)
+		}
+	}
+
+	// The checker does catch events that don't conform.
+	for _, bad := range []string{`{"id":"1","source":"s","type":"t"}`, `{"specversion":"1.0","id":"","source":"s","type":"t"}`,
+		`{"specversion":"1.0","id":"1","source":"s","type":"t","time":"yesterday"}`, `{"specversion":"1.0","id":"1","source":"s","type":"t","Bad_Ext":1}`} {
+		if len(s.violations([]byte(bad))) == 0 {
+			t.Errorf("%s conforms", bad)
+		}
+	}
+}
+
+func TestID(t *testing.T) {
+	// A payload that carries its invocation id keeps it, however often it is wrapped.
+	b := hooktest.SessionStart().With("hook_invocation_id", "inv-1")
+	if ce, err := cloudevents.ToCloudEvent(b.Build()); err != nil || ce.ID != "inv-1" {
+		t.Errorf("ID = %q, %v; want the invocation id", ce.ID, err)
+	}
+
+	// Without one, the id is a hash of the payload.
+	payload := func(session string) *hooksdk.HookPayload {
+		return &hooksdk.HookPayload{XcodexEventType: "session-start", RawPayload: map[string]any{"type": "session-start", "session_id": session, "cwd": "/w"}}
+	}
+	a, _ := cloudevents.ToCloudEvent(payload("a"))
+	again, _ := cloudevents.ToCloudEvent(payload("a"))
+	other, _ := cloudevents.ToCloudEvent(payload("b"))
+	if a.ID == "" || a.ID != again.ID || a.ID == other.ID || len(a.ID) != 32 {
+		t.Errorf("IDs = %q, %q, %q; want a stable hash of each payload", a.ID, again.ID, other.ID)
+	}
+	// Without a timestamp, the time is now.
+	if ts, err := time.Parse(time.RFC3339Nano, a.Time); err != nil || time.Since(ts) > time.Minute {
+		t.Errorf("time = %q, %v", a.Time, err)
+	}
+
+	if _, err := cloudevents.ToCloudEvent(&hooksdk.HookPayload{RawPayload: map[string]any{}}); err == nil {
+		t.Error("ToCloudEvent of a payload without an event type succeeded")
+	}
+}
+
+func TestHeader(t *testing.T) {
+	ce := cloudevents.CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              "inv-1",
+		Source:          "xcodex/hooks/fwd",
+		Type:            "dev.xcodex.hook.session-start",
+		Subject:         `sessión "1" 100%`,
+		Time:            "2026-01-02T03:04:05Z",
+		DataContentType: "application/json",
+		Data:            json.RawMessage(`{"session_id":"1"}`),
+	}
+	h := ce.Header()
+	want := http.Header{
+		"Ce-Specversion": {"1.0"},
+		"Ce-Id":          {"inv-1"},
+		"Ce-Source":      {"xcodex/hooks/fwd"},
+		"Ce-Type":        {"dev.xcodex.hook.session-start"},
+		"Ce-Subject":     {"sessi%C3%B3n%20%221%22%20100%25"},
+		"Ce-Time":        {"2026-01-02T03:04:05Z"},
+		"Content-Type":   {"application/json"},
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("Header = %v, want %v", h, want)
+	}
+	got, err := cloudevents.FromHeader(h, ce.Data)
+	if err != nil || !reflect.DeepEqual(got, ce) {
+		t.Errorf("FromHeader = %+v, %v; want %+v", got, err, ce)
+	}
+
+	// Empty attributes have no header.
+	if h := (cloudevents.CloudEvent{SpecVersion: "1.0", ID: "1", Source: "s", Type: "t"}).Header(); len(h) != 4 {
+		t.Errorf("Header of a minimal event = %v", h)
+	}
+
+	bad := h.Clone()
+	bad.Set("Ce-Subject", "100%")
+	if _, err := cloudevents.FromHeader(bad, nil); err == nil {
+		t.Error("FromHeader with bad percent-encoding succeeded")
+	}
+	bad = h.Clone()
+	bad.Del("Ce-Id")
+	if _, err := cloudevents.FromHeader(bad, nil); err == nil {
+		t.Error("FromHeader without ce-id succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ok := cloudevents.CloudEvent{SpecVersion: "1.0", ID: "1", Source: "s", Type: "t"}
+	if err := ok.Validate(); err != nil {
+		t.Errorf("Validate of a minimal event: %v", err)
+	}
+	for name, change := range map[string]func(*cloudevents.CloudEvent){
+		"no id":         func(ce *cloudevents.CloudEvent) { ce.ID = "" },
+		"no source":     func(ce *cloudevents.CloudEvent) { ce.Source = "" },
+		"no type":       func(ce *cloudevents.CloudEvent) { ce.Type = "" },
+		"version 0.3":   func(ce *cloudevents.CloudEvent) { ce.SpecVersion = "0.3" },
+		"bad time":      func(ce *cloudevents.CloudEvent) { ce.Time = "2026-01-02 03:04" },
+		"data not JSON": func(ce *cloudevents.CloudEvent) { ce.Data = json.RawMessage(`{"a":`) },
+	} {
+		ce := ok
+		change(&ce)
+		if err := ce.Validate(); err == nil {
+			t.Errorf("%s: Validate succeeded", name)
+		}
+	}
+}
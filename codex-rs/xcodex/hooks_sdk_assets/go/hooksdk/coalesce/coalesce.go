@@ -0,0 +1,247 @@
+// Package coalesce combines the chunk events of streamed tool output into one record per tool
+// call, for logs that would otherwise get a line per chunk.
+//
+// Chunks arrive in separate hook processes, so Add buffers each one in a hooksdk/state store, keyed
+// by the call it belongs to, and hands back nothing to log. When the call's finishing event
+// arrives, Add returns it with the chunks' text joined in order under "coalesced". Buffers whose
+// call never finishes are handed back as the chunks they were once they have waited TTL.
+//
+//	c := coalesce.New(logPath + ".chunks.state")
+//	records, err := c.Add(hooksdk.HookPayloadJSON(payload.RawPayload))
+//	for _, rec := range records {
+//		w.Append(rec)
+//	}
+package coalesce
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/state"
+)
+
+// Defaults for a Coalescer's zero fields.
+const (
+	// DefaultChunkType is the event type of output chunks.
+	DefaultChunkType = "tool-call-output-chunk"
+	// DefaultEndType is the event type that ends a call's chunks.
+	DefaultEndType = string(hooksdk.EventToolCallFinished)
+	// DefaultKeyField names the call a chunk (and the end event) belongs to.
+	DefaultKeyField = "tool_use_id"
+	// DefaultSeqField is a chunk's position in its call's output, when the host numbers them.
+	DefaultSeqField = "seq"
+	// DefaultTextField is a chunk's text.
+	DefaultTextField = "chunk"
+	// DefaultTTL is how long a buffer waits for the end of its call after its last chunk.
+	DefaultTTL = 10 * time.Minute
+	// DefaultMaxBufferBytes caps the chunk payloads buffered for one call.
+	DefaultMaxBufferBytes = 1 << 20
+)
+
+// Field is the key of the combined output in the record Add returns for an end event. Its value
+// is an object, so the payload's redaction, projection, and truncation apply to it as to the rest:
+//
+//	"coalesced": {"output": "<the chunks' text>", "chunks": 3, "bytes": 1824}
+//
+// The text is in order: by SeqField where the chunks have one, else as they arrived. Bytes counts
+// the bytes of the text before any truncation.
+const Field = "coalesced"
+
+// stateKey is the one state entry holding every buffer, so an Add sees and changes them all under
+// one lock.
+const stateKey = "buffers"
+
+// Coalescer buffers chunk events in the state store at Path.
+type Coalescer struct {
+	Path string
+	// ChunkType, EndType, KeyField, SeqField, and TextField describe the events; empty means the
+	// Default of each. Fields are dot paths, as for hooksdk.Field.
+	ChunkType, EndType            string
+	KeyField, SeqField, TextField string
+	// TTL is how long a buffer is kept after its last chunk; zero means DefaultTTL.
+	TTL time.Duration
+	// MaxBufferBytes caps the encoded chunks buffered for one call; chunks past it are returned
+	// by Add at once, to be logged on their own. Zero means DefaultMaxBufferBytes.
+	MaxBufferBytes int
+	// Now is the clock; nil means time.Now.
+	Now func() time.Time
+}
+
+// New returns a Coalescer keeping its buffers in the state file at path, with the defaults.
+func New(path string) *Coalescer {
+	return &Coalescer{Path: path}
+}
+
+// buffer is the chunks of one call.
+type buffer struct {
+	Chunks  []chunk   `json:"chunks"`
+	Size    int       `json:"size"`
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+}
+
+type chunk struct {
+	// Seq is the chunk's SeqField, or else its place in arrival order.
+	Seq     float64         `json:"seq"`
+	HasSeq  bool            `json:"has_seq,omitempty"`
+	Arrived int             `json:"arrived"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Add takes the event p and returns the records to log for it, oldest first:
+//
+//   - for a chunk, nothing, unless its buffer is full, in which case the chunk itself;
+//   - for the end event of a call with buffered chunks, p with their text added under Field;
+//   - for any other event, p.
+//
+// Before those come the chunks of any buffer that has waited longer than TTL, as they arrived.
+// When the store can't be read or written, Add returns p with the error, so the event can still
+// be logged on its own.
+func (c *Coalescer) Add(p hooksdk.HookPayloadJSON) ([]hooksdk.HookPayloadJSON, error) {
+	eventType, _ := hooksdk.StringField(p, "xcodex_event_type")
+	key, _ := hooksdk.StringField(p, or(c.KeyField, DefaultKeyField))
+	isChunk := eventType == or(c.ChunkType, DefaultChunkType) && key != ""
+	isEnd := eventType == or(c.EndType, DefaultEndType) && key != ""
+
+	st, err := state.OpenPath(c.Path)
+	if err != nil {
+		return []hooksdk.HookPayloadJSON{p}, err
+	}
+	st.Now = c.Now
+	var out []hooksdk.HookPayloadJSON
+	err = st.Update(stateKey, func(e *state.Entry) error {
+		out = nil
+		buffers := map[string]*buffer{}
+		if _, err := e.Decode(&buffers); err != nil {
+			// A store that can't be decoded is started afresh.
+			buffers = map[string]*buffer{}
+		}
+		now := e.Now()
+		out = append(out, c.expire(buffers, now)...)
+
+		switch {
+		case isChunk:
+			if rec, ok := c.buffer(buffers, key, p, now); !ok {
+				out = append(out, rec)
+			}
+		case isEnd && buffers[key] != nil:
+			out = append(out, combine(p, buffers[key], or(c.TextField, DefaultTextField)))
+			delete(buffers, key)
+		default:
+			out = append(out, p)
+		}
+
+		if len(buffers) == 0 {
+			e.Delete()
+			return nil
+		}
+		return e.Set(buffers, 0)
+	})
+	if err != nil {
+		return []hooksdk.HookPayloadJSON{p}, err
+	}
+	return out, nil
+}
+
+// buffer adds the chunk p to key's buffer; ok is false when it doesn't fit, and rec is then p.
+func (c *Coalescer) buffer(buffers map[string]*buffer, key string, p hooksdk.HookPayloadJSON, now time.Time) (rec hooksdk.HookPayloadJSON, ok bool) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return p, false
+	}
+	b := buffers[key]
+	if b == nil {
+		b = &buffer{Started: now}
+	}
+	limit := c.MaxBufferBytes
+	if limit <= 0 {
+		limit = DefaultMaxBufferBytes
+	}
+	if b.Size+len(data) > limit {
+		return p, false
+	}
+	ch := chunk{Seq: float64(len(b.Chunks)), Arrived: len(b.Chunks), Payload: data}
+	if seq, ok := hooksdk.FloatField(p, or(c.SeqField, DefaultSeqField)); ok {
+		ch.Seq, ch.HasSeq = seq, true
+	}
+	b.Chunks = append(b.Chunks, ch)
+	b.Size += len(data)
+	b.Updated = now
+	buffers[key] = b
+	return nil, true
+}
+
+// expire removes the buffers last changed more than TTL before now and returns their chunks as
+// they arrived, the oldest buffer's first.
+func (c *Coalescer) expire(buffers map[string]*buffer, now time.Time) []hooksdk.HookPayloadJSON {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	var keys []string
+	for key, b := range buffers {
+		if now.Sub(b.Updated) > ttl {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := buffers[keys[i]].Started, buffers[keys[j]].Started
+		return a.Before(b) || a.Equal(b) && keys[i] < keys[j]
+	})
+	var out []hooksdk.HookPayloadJSON
+	for _, key := range keys {
+		for _, ch := range buffers[key].Chunks {
+			if p, err := decode(ch.Payload); err == nil {
+				out = append(out, p)
+			}
+		}
+		delete(buffers, key)
+	}
+	return out
+}
+
+// combine returns the end event p with b's chunks joined under Field.
+func combine(p hooksdk.HookPayloadJSON, b *buffer, textField string) hooksdk.HookPayloadJSON {
+	chunks := append([]chunk(nil), b.Chunks...)
+	sort.SliceStable(chunks, func(i, j int) bool {
+		if chunks[i].HasSeq && chunks[j].HasSeq {
+			return chunks[i].Seq < chunks[j].Seq
+		}
+		return chunks[i].Arrived < chunks[j].Arrived
+	})
+	var text strings.Builder
+	for _, ch := range chunks {
+		payload, err := decode(ch.Payload)
+		if err != nil {
+			continue
+		}
+		s, _ := hooksdk.StringField(payload, textField)
+		text.WriteString(s)
+	}
+	rec := make(hooksdk.HookPayloadJSON, len(p)+1)
+	for k, v := range p {
+		rec[k] = v
+	}
+	rec[Field] = map[string]any{"output": text.String(), "chunks": len(chunks), "bytes": text.Len()}
+	return rec
+}
+
+// decode decodes a buffered chunk, with numbers as json.Number like a parsed payload's.
+func decode(data []byte) (hooksdk.HookPayloadJSON, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var p hooksdk.HookPayloadJSON
+	err := dec.Decode(&p)
+	return p, err
+}
+
+func or(s, def string) string {
+	if s != "" {
+		return s
+	}
+	return def
+}
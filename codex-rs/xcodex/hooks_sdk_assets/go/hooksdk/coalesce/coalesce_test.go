@@ -0,0 +1,168 @@
+package coalesce_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/coalesce"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/state"
+)
+
+// chunk is a chunk event of the call id; a negative seq leaves the field out.
+func chunk(id string, seq int, text string) hooksdk.HookPayloadJSON {
+	b := hooktest.New(coalesce.DefaultChunkType, "").With("tool_use_id", id).With("chunk", text)
+	if seq >= 0 {
+		b = b.With("seq", seq)
+	}
+	return b.Map()
+}
+
+func end(id string) hooksdk.HookPayloadJSON {
+	return hooktest.ToolCallFinished().With("tool_use_id", id).Map()
+}
+
+// add adds p to c, failing the test on an error.
+func add(t *testing.T, c *coalesce.Coalescer, p hooksdk.HookPayloadJSON) []hooksdk.HookPayloadJSON {
+	t.Helper()
+	out, err := c.Add(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// coalesced is rec's Field, as JSON, or "" when it has none.
+func coalesced(rec hooksdk.HookPayloadJSON) string {
+	v, ok := rec[coalesce.Field]
+	if !ok {
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func TestInterleavedCalls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chunks.state")
+	// Each event comes to a new Coalescer, as to a new hook process.
+	next := func(p hooksdk.HookPayloadJSON) []hooksdk.HookPayloadJSON { return add(t, coalesce.New(path), p) }
+
+	// The chunks of two calls, interleaved and out of order; a call without seq keeps arrival order.
+	for _, p := range []hooksdk.HookPayloadJSON{
+		chunk("a", 2, "three "), chunk("b", -1, "one "), chunk("a", 0, "one "),
+		chunk("b", -1, "two"), chunk("a", 1, "two "),
+	} {
+		if out := next(p); out != nil {
+			t.Fatalf("chunk logged: %v", out)
+		}
+	}
+	// Other events pass through, and leave the buffers alone.
+	started := hooksdk.HookPayloadJSON(hooktest.ToolCallStarted().With("tool_use_id", "a").Map())
+	if out := next(started); len(out) != 1 || !reflect.DeepEqual(out[0], started) {
+		t.Fatalf("other event = %v", out)
+	}
+
+	out := next(end("b"))
+	if len(out) != 1 || coalesced(out[0]) != `{"bytes":7,"chunks":2,"output":"one two"}` || out[0]["status"] != "completed" {
+		t.Fatalf("end of b = %v", out)
+	}
+	out = next(end("a"))
+	if len(out) != 1 || coalesced(out[0]) != `{"bytes":14,"chunks":3,"output":"one two three "}` {
+		t.Fatalf("end of a = %v", out)
+	}
+	// The end of a call with nothing buffered is as it came, and the store is gone once empty.
+	if out := next(end("a")); len(out) != 1 || coalesced(out[0]) != "" {
+		t.Errorf("second end of a = %v", out)
+	}
+	st, err := state.OpenPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffers map[string]any
+	if ok, err := st.Get("buffers", &buffers); ok || err != nil {
+		t.Errorf("store still has buffers: %v, %v", buffers, err)
+	}
+}
+
+func TestOrphanExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := now
+	at := func(d time.Duration) { now = start.Add(d) }
+	c := &coalesce.Coalescer{Path: filepath.Join(t.TempDir(), "chunks.state"), TTL: time.Minute, Now: func() time.Time { return now }}
+	add(t, c, chunk("b", 0, "b0"))
+	at(30 * time.Second)
+	add(t, c, chunk("a", 0, "a0"))
+	add(t, c, chunk("a", 1, "a1"))
+	at(50 * time.Second)
+	add(t, c, chunk("c", 0, "c0"))
+
+	// Each buffer's TTL runs from its last chunk: only b has expired.
+	at(75 * time.Second)
+	out := add(t, c, hooktest.SessionStart().Map())
+	if len(out) != 2 || out[0]["chunk"] != "b0" || out[1]["xcodex_event_type"] != "session-start" {
+		t.Fatalf("after b's TTL = %v", out)
+	}
+	// The chunks come back as they arrived, numbers and all.
+	if seq, ok := out[0]["seq"].(json.Number); !ok || seq != "0" {
+		t.Errorf("expired chunk's seq = %#v", out[0]["seq"])
+	}
+
+	// The oldest buffer's chunks first, then the end event, which has nothing left to combine.
+	at(5 * time.Minute)
+	var got []string
+	for _, rec := range add(t, c, end("a")) {
+		s, _ := hooksdk.StringField(rec, "chunk")
+		got = append(got, s+coalesced(rec))
+	}
+	if strings.Join(got, ",") != "a0,a1,c0," {
+		t.Errorf("after the TTL = %q", got)
+	}
+}
+
+func TestBufferLimit(t *testing.T) {
+	c := &coalesce.Coalescer{Path: filepath.Join(t.TempDir(), "chunks.state"), MaxBufferBytes: 600}
+	add(t, c, chunk("a", 0, "first"))
+	// A chunk past the limit is logged on its own; the buffer keeps what fit.
+	big := chunk("a", 1, strings.Repeat("x", 600))
+	if out := add(t, c, big); len(out) != 1 || !reflect.DeepEqual(out[0], big) {
+		t.Errorf("chunk past the limit = %v", out)
+	}
+	if out := add(t, c, end("a")); len(out) != 1 || coalesced(out[0]) != `{"bytes":5,"chunks":1,"output":"first"}` {
+		t.Errorf("end = %v", out)
+	}
+}
+
+func TestCustomFields(t *testing.T) {
+	c := &coalesce.Coalescer{Path: filepath.Join(t.TempDir(), "chunks.state"), ChunkType: "out", EndType: "done",
+		KeyField: "call.id", SeqField: "n", TextField: "data.text"}
+	part := func(seq int, text string) hooksdk.HookPayloadJSON {
+		return hooktest.New("out", "").With("call", map[string]any{"id": "x"}).With("n", seq).
+			With("data", map[string]any{"text": text}).Map()
+	}
+	add(t, c, part(1, "b"))
+	add(t, c, part(0, "a"))
+	// A default chunk event is just another event.
+	if out := add(t, c, chunk("x", 0, "z")); len(out) != 1 {
+		t.Errorf("default chunk type = %v", out)
+	}
+	out := add(t, c, hooktest.New("done", "").With("call", map[string]any{"id": "x"}).Map())
+	if len(out) != 1 || coalesced(out[0]) != `{"bytes":2,"chunks":2,"output":"ab"}` {
+		t.Errorf("end = %v", out)
+	}
+}
+
+func TestStoreFails(t *testing.T) {
+	// A store that can't be opened hands back the event, chunk or not, with the error.
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o644)
+	p := chunk("a", 0, "one")
+	if out, err := coalesce.New(filepath.Join(file, "chunks.state")).Add(p); err == nil || len(out) != 1 || !reflect.DeepEqual(out[0], p) {
+		t.Errorf("Add = %v, %v", out, err)
+	}
+}
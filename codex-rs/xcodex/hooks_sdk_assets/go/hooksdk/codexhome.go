@@ -0,0 +1,170 @@
+package hooksdk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// CodexHomeSource says where Env.CodexHome came from.
+type CodexHomeSource string
+
+// The places Env.CodexHome is taken from, in the order they are tried. Only CODEX_HOME is used as
+// it is; each fallback is used when its directory can be created and written to.
+const (
+	// CodexHomeFromEnv is CODEX_HOME, which xcodex sets on the hooks it runs.
+	CodexHomeFromEnv CodexHomeSource = "CODEX_HOME"
+	// CodexHomeFromXDG is `$XDG_STATE_HOME/xcodex`.
+	CodexHomeFromXDG CodexHomeSource = "XDG_STATE_HOME"
+	// CodexHomeFromHome is `~/.xcodex`.
+	CodexHomeFromHome CodexHomeSource = "HOME"
+	// CodexHomeFromTemp is `xcodex-<uid>` in os.TempDir, for containers and CI sandboxes with no
+	// home directory.
+	CodexHomeFromTemp CodexHomeSource = "temp"
+)
+
+// ErrNoCodexHome is returned (as a *CodexHomeError) when CODEX_HOME is unset and none of its
+// fallbacks, down to the temp dir, can be written to.
+var ErrNoCodexHome = errors.New("no usable CODEX_HOME")
+
+// CodexHomeError reports that no fallback for CODEX_HOME could be used. It matches ErrNoCodexHome
+// with errors.Is and unwraps to the temp dir's error.
+type CodexHomeError struct {
+	// Tried are the directories tried, in order.
+	Tried []string
+	Err   error
+}
+
+func (e *CodexHomeError) Error() string {
+	return fmt.Sprintf("%s is unset and none of %s is writable: %v", CodexHomeEnv, strings.Join(e.Tried, ", "), e.Err)
+}
+
+func (e *CodexHomeError) Unwrap() error { return e.Err }
+
+func (e *CodexHomeError) Is(target error) bool { return target == ErrNoCodexHome }
+
+// codexHomeCandidate is a fallback for CODEX_HOME.
+type codexHomeCandidate struct {
+	dir    string
+	source CodexHomeSource
+}
+
+// codexHome is a resolved CODEX_HOME.
+type codexHome struct {
+	dir    string
+	source CodexHomeSource
+	err    error
+}
+
+var (
+	codexHomesMu sync.Mutex
+	// codexHomes caches the fallback chosen for each list of candidates, so a process probes the
+	// file system (and logs its choice) once, not on every call to Environ.
+	codexHomes = map[string]codexHome{}
+)
+
+// resolveCodexHome returns CODEX_HOME: the variable when it is set, and otherwise the first of
+// `$XDG_STATE_HOME/xcodex`, `~/.xcodex`, and `<temp dir>/xcodex-<uid>` that can be created and
+// written to. XDG_STATE_HOME and the home directory only count when they are absolute paths.
+// When none can, it returns the temp dir's with a *CodexHomeError, so paths built on it still
+// name a place to look.
+func resolveCodexHome(getenv func(string) string, homeDir func() (string, error), tempDir func() string) codexHome {
+	if dir := getenv(CodexHomeEnv); dir != "" {
+		return codexHome{dir: dir, source: CodexHomeFromEnv}
+	}
+	var candidates []codexHomeCandidate
+	if base := getenv("XDG_STATE_HOME"); filepath.IsAbs(base) {
+		candidates = append(candidates, codexHomeCandidate{filepath.Join(base, "xcodex"), CodexHomeFromXDG})
+	}
+	if base, err := homeDir(); err == nil && filepath.IsAbs(base) {
+		candidates = append(candidates, codexHomeCandidate{filepath.Join(base, ".xcodex"), CodexHomeFromHome})
+	}
+	candidates = append(candidates, codexHomeCandidate{filepath.Join(tempDir(), tempCodexHomeName()), CodexHomeFromTemp})
+
+	dirs := make([]string, len(candidates))
+	for i, c := range candidates {
+		dirs[i] = c.dir
+	}
+	key := strings.Join(dirs, "\x00")
+	codexHomesMu.Lock()
+	defer codexHomesMu.Unlock()
+	if h, ok := codexHomes[key]; ok {
+		return h
+	}
+	h := probeCodexHomes(candidates)
+	codexHomes[key] = h
+	logCodexHome(h)
+	return h
+}
+
+// probeCodexHomes returns the first candidate that is usable.
+func probeCodexHomes(candidates []codexHomeCandidate) codexHome {
+	var err error
+	for _, c := range candidates {
+		if err = usableCodexHome(c); err == nil {
+			return codexHome{dir: c.dir, source: c.source}
+		}
+	}
+	last := candidates[len(candidates)-1]
+	tried := make([]string, len(candidates))
+	for i, c := range candidates {
+		tried[i] = c.dir
+	}
+	return codexHome{dir: last.dir, source: last.source, err: &CodexHomeError{Tried: tried, Err: err}}
+}
+
+// usableCodexHome creates c's directory if need be and checks that it can be written to. The
+// temp dir is shared with other users, so there the directory must also be the current user's.
+func usableCodexHome(c codexHomeCandidate) error {
+	perm := os.FileMode(0o755)
+	if c.source == CodexHomeFromTemp {
+		perm = 0o700
+	}
+	if err := os.MkdirAll(c.dir, perm); err != nil {
+		return err
+	}
+	if c.source == CodexHomeFromTemp {
+		fi, err := os.Lstat(c.dir)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%s is not a directory", c.dir)
+		}
+		if why := unsafeOwner(c.dir, fi); why != "" {
+			return errors.New(why)
+		}
+	}
+	return writableDir(c.dir)
+}
+
+// tempCodexHomeName names the fallback in the temp dir, per user where the system has user ids
+// (Windows gives each user a temp dir of their own).
+func tempCodexHomeName() string {
+	if uid := os.Getuid(); uid >= 0 && runtime.GOOS != "windows" {
+		return "xcodex-" + strconv.Itoa(uid)
+	}
+	return "xcodex"
+}
+
+// logCodexHome reports a fallback chosen for CODEX_HOME: at debug level for the usual ones, as a
+// warning for the temp dir, which doesn't outlive a reboot, and as an error when none was usable.
+func logCodexHome(h codexHome) {
+	fields := map[string]any{"codex_home": h.dir, "source": string(h.source)}
+	switch {
+	case h.err != nil:
+		fields["error"] = h.err.Error()
+		hooklog.Log(hooklog.LevelError, "no usable CODEX_HOME; logs and state will not be written", fields)
+	case h.source == CodexHomeFromTemp:
+		hooklog.Log(hooklog.LevelWarn, "CODEX_HOME is unset and there is no writable home directory; using the temp dir", fields)
+	default:
+		hooklog.Log(hooklog.LevelDebug, "CODEX_HOME is unset; using "+h.dir, fields)
+	}
+}
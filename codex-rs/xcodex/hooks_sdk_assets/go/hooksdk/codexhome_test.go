@@ -0,0 +1,138 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// codexHomeMain is the hook HOOKSDK_TEST_CODEX_HOME runs: it prints Environ's CodexHome and its
+// source twice, so a test can see the choice is logged once.
+func codexHomeMain() {
+	for i := 0; i < 2; i++ {
+		e := hooksdk.Environ()
+		fmt.Println(e.CodexHome, e.CodexHomeSource, e.CodexHomeErr != nil)
+	}
+	os.Exit(0)
+}
+
+// tempCodexHome is the fallback in the temp dir tmp.
+func tempCodexHome(tmp string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(tmp, "xcodex")
+	}
+	return filepath.Join(tmp, fmt.Sprintf("xcodex-%d", os.Getuid()))
+}
+
+// unusable is a directory that can't be created, even by root: one under a file.
+func unusable(t *testing.T) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(file, "dir")
+}
+
+func TestCodexHomeFallbacks(t *testing.T) {
+	xdg, home, tmp := t.TempDir(), t.TempDir(), t.TempDir()
+	for _, tt := range []struct {
+		name   string
+		vars   map[string]string
+		dir    string
+		source hooksdk.CodexHomeSource
+	}{
+		// CODEX_HOME is taken as it is, without looking at the file system.
+		{"set", map[string]string{"CODEX_HOME": "/no/such/codex", "XDG_STATE_HOME": xdg}, "/no/such/codex", hooksdk.CodexHomeFromEnv},
+		{"xdg", map[string]string{"XDG_STATE_HOME": xdg, "HOME": home, "TMPDIR": tmp}, filepath.Join(xdg, "xcodex"), hooksdk.CodexHomeFromXDG},
+		{"relative xdg", map[string]string{"XDG_STATE_HOME": "state", "HOME": home, "TMPDIR": tmp}, filepath.Join(home, ".xcodex"), hooksdk.CodexHomeFromHome},
+		{"unusable xdg", map[string]string{"XDG_STATE_HOME": unusable(t), "HOME": home, "TMPDIR": tmp}, filepath.Join(home, ".xcodex"), hooksdk.CodexHomeFromHome},
+		{"relative home", map[string]string{"HOME": "home", "TMPDIR": tmp}, tempCodexHome(tmp), hooksdk.CodexHomeFromTemp},
+		{"unusable home", map[string]string{"HOME": unusable(t), "TMPDIR": tmp}, tempCodexHome(tmp), hooksdk.CodexHomeFromTemp},
+	} {
+		e := hooksdk.FromMap(tt.vars)
+		if e.CodexHome != tt.dir || e.CodexHomeSource != tt.source || e.CodexHomeErr != nil {
+			t.Errorf("%s: CodexHome = %q from %s (%v), want %q from %s", tt.name, e.CodexHome, e.CodexHomeSource, e.CodexHomeErr, tt.dir, tt.source)
+			continue
+		}
+		if tt.source == hooksdk.CodexHomeFromEnv {
+			continue
+		}
+		// A fallback is created, and only the user may use the one in the temp dir.
+		fi, err := os.Stat(e.CodexHome)
+		if err != nil || !fi.IsDir() {
+			t.Errorf("%s: %s wasn't created: %v", tt.name, e.CodexHome, err)
+		} else if runtime.GOOS != "windows" && tt.source == hooksdk.CodexHomeFromTemp && fi.Mode().Perm() != 0o700 {
+			t.Errorf("%s: %s has mode %v, want 0700", tt.name, e.CodexHome, fi.Mode().Perm())
+		}
+	}
+}
+
+func TestCodexHomeUnusable(t *testing.T) {
+	vars := map[string]string{"XDG_STATE_HOME": unusable(t), "HOME": unusable(t), "TMPDIR": unusable(t)}
+	e := hooksdk.FromMap(vars)
+	var herr *hooksdk.CodexHomeError
+	if !errors.Is(e.CodexHomeErr, hooksdk.ErrNoCodexHome) || !errors.As(e.CodexHomeErr, &herr) {
+		t.Fatalf("CodexHomeErr = %v, want a *CodexHomeError", e.CodexHomeErr)
+	}
+	// Paths still name the temp dir's, and the error lists every directory tried.
+	want := []string{filepath.Join(vars["XDG_STATE_HOME"], "xcodex"), filepath.Join(vars["HOME"], ".xcodex"), tempCodexHome(vars["TMPDIR"])}
+	if e.CodexHome != want[2] || e.CodexHomeSource != hooksdk.CodexHomeFromTemp || strings.Join(herr.Tried, " ") != strings.Join(want, " ") {
+		t.Errorf("CodexHome = %q from %s, tried %q; want %q", e.CodexHome, e.CodexHomeSource, herr.Tried, want)
+	}
+	if errors.Unwrap(herr) == nil || !strings.Contains(herr.Error(), "CODEX_HOME is unset and none of "+strings.Join(want, ", ")+" is writable: ") {
+		t.Errorf("Error = %q", herr)
+	}
+
+	// CheckCodexHome fails with it.
+	stdio, _, _ := testIO(nil, vars)
+	if err := hooksdk.CheckCodexHome().Run(context.Background(), stdio.Environ()); !errors.Is(err, hooksdk.ErrNoCodexHome) {
+		t.Errorf("CheckCodexHome = %v, want ErrNoCodexHome", err)
+	}
+}
+
+func TestCodexHomeLogged(t *testing.T) {
+	xdg, tmp := t.TempDir(), t.TempDir()
+	for _, tt := range []struct {
+		name  string
+		env   []string
+		out   string
+		level string
+	}{
+		{"xdg", []string{"XDG_STATE_HOME=" + xdg, "TMPDIR=" + tmp}, filepath.Join(xdg, "xcodex") + " XDG_STATE_HOME false", "debug"},
+		// With no HOME at all, a hook still has somewhere to write.
+		{"temp", []string{"TMPDIR=" + tmp}, tempCodexHome(tmp) + " temp false", "warn"},
+		{"none", []string{"TMPDIR=" + unusable(t)}, "", "error"},
+	} {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(tt.env, "HOOKSDK_TEST_CODEX_HOME=1", "CODEX_HOOK_LOG_FORMAT=json", "CODEX_HOOK_LOG_LEVEL=debug")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%s: %v: %s", tt.name, err, stderr.String())
+		}
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if len(lines) != 2 || lines[0] != lines[1] || tt.out != "" && lines[0] != tt.out {
+			t.Errorf("%s: Environ printed %q, want %q twice", tt.name, lines, tt.out)
+		}
+		// The choice is logged once per process.
+		var rec map[string]any
+		if err := json.Unmarshal(stderr.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: stderr %q: %v", tt.name, stderr.String(), err)
+		}
+		if rec["level"] != tt.level || rec["codex_home"] != strings.Fields(lines[0])[0] || rec["source"] == nil {
+			t.Errorf("%s: log record = %v, want %s", tt.name, rec, tt.level)
+		}
+	}
+}
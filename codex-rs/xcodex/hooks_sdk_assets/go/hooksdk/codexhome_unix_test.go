@@ -0,0 +1,38 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package hooksdk_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestCodexHomeUnsafeTemp(t *testing.T) {
+	// Someone else could have made the fallback in the shared temp dir: a world-writable directory
+	// or a link to one elsewhere isn't used.
+	for name, tt := range map[string]struct {
+		setup func(dir string) error
+		want  string
+	}{
+		"world-writable": {func(dir string) error {
+			if err := os.Mkdir(dir, 0o700); err != nil {
+				return err
+			}
+			return os.Chmod(dir, 0o777)
+		}, " is world-writable"},
+		"symlink": {func(dir string) error { return os.Symlink(t.TempDir(), dir) }, " is not a directory"},
+	} {
+		tmp := t.TempDir()
+		if err := tt.setup(tempCodexHome(tmp)); err != nil {
+			t.Fatal(err)
+		}
+		e := hooksdk.FromMap(map[string]string{"HOME": unusable(t), "TMPDIR": tmp})
+		if !errors.Is(e.CodexHomeErr, hooksdk.ErrNoCodexHome) || !strings.HasSuffix(e.CodexHomeErr.Error(), tempCodexHome(tmp)+tt.want) {
+			t.Errorf("%s: CodexHome = %q, %v; want ErrNoCodexHome", name, e.CodexHome, e.CodexHomeErr)
+		}
+	}
+}
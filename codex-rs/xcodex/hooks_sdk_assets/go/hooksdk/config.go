@@ -0,0 +1,460 @@
+package hooksdk
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/minitoml"
+)
+
+// ConfigError reports a config value that doesn't fit the field it is meant for, or a key the
+// config struct doesn't have.
+type ConfigError struct {
+	// Source is the config file or environment variable the value came from (for a bad `default`
+	// tag, the Go field).
+	Source string
+	// Key is the value's dotted TOML key, with indexes into arrays of tables (`deny[2].regex`).
+	Key string
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", e.Source, e.Key, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// ConfigPath returns the file LoadConfig reads for name: `hooks/config/<name>.toml` under
+// CODEX_HOME.
+func ConfigPath(name string) string {
+	return Environ().Path("hooks", "config", name+".toml")
+}
+
+// LoadConfig fills v, a pointer to a struct, from the hook's config file (see ConfigPath) in three
+// layers, each overriding the one before:
+//
+//  1. `default:"..."` struct tags, for fields that are still zero;
+//  2. the TOML file, if it exists (a missing file is not an error);
+//  3. environment variables CODEX_HOOK_<NAME>_<KEY>, e.g. CODEX_HOOK_WEBHOOK_URL for key `url` of
+//     config "webhook" (CODEX_HOOK_<NAME>_<TABLE>_<KEY> in a nested table). Empty ones are ignored.
+//
+// A field's key is its `toml:"..."` tag, or its name in snake_case; `toml:"-"` skips it. Fields may
+// be strings, bools, numbers, time.Duration (a string such as "30s"), encoding.TextUnmarshaler,
+// slices and string-keyed maps of those, structs (tables) and slices of structs (arrays of tables).
+// Defaults and environment variables are strings in the same syntax, with comma-separated slices;
+// they don't apply to maps and slices of structs.
+//
+// Keys the struct doesn't have and values of the wrong type fail with a *ConfigError naming the
+// file (or variable) and the key. If v has a `Validate() error` method it is called last.
+func LoadConfig(name string, v any) error {
+	return LoadConfigFile(ConfigPath(name), name, v)
+}
+
+// LoadConfigFile is LoadConfig reading path instead of the file in CODEX_HOME; name still picks
+// the environment variables.
+func LoadConfigFile(path, name string, v any) error {
+	return loadConfigFiles([]string{path}, name, v)
+}
+
+// loadConfigFiles is LoadConfigFile with several files, each overriding the ones before it. A
+// Validate error names the last file.
+func loadConfigFiles(paths []string, name string, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("hooksdk: LoadConfig needs a pointer to a struct, got %T", v)
+	}
+	sv := rv.Elem()
+	if err := applyDefaults(sv, ""); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		default:
+			doc, err := minitoml.Parse(string(data))
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if err := decodeTable(path, "", doc, sv); err != nil {
+				return err
+			}
+		}
+	}
+	if err := applyEnv(sv, configEnvPrefix(name), ""); err != nil {
+		return err
+	}
+	if val, ok := v.(interface{ Validate() error }); ok {
+		if err := val.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", paths[len(paths)-1], err)
+		}
+	}
+	return nil
+}
+
+// configEnvPrefix is `CODEX_HOOK_<NAME>_`, with name upper-cased and anything but letters and
+// digits turned into underscores.
+func configEnvPrefix(name string) string {
+	return "CODEX_HOOK_" + envKey(name) + "_"
+}
+
+func envKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+type configField struct {
+	index   int
+	key     string
+	dflt    string
+	hasDflt bool
+}
+
+// configFields lists the settable fields of struct type t with their keys.
+func configFields(t reflect.Type) []configField {
+	var fields []configField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = snakeCase(f.Name)
+		}
+		dflt, hasDflt := f.Tag.Lookup("default")
+		fields = append(fields, configField{index: i, key: key, dflt: dflt, hasDflt: hasDflt})
+	}
+	return fields
+}
+
+// snakeCase turns a Go field name into a TOML key: ProtectedBranches -> protected_branches,
+// URL -> url, HTTPTimeout -> http_timeout.
+func snakeCase(name string) string {
+	rs := []rune(name)
+	var b strings.Builder
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(rs[i-1]) || i+1 < len(rs) && unicode.IsLower(rs[i+1]) && unicode.IsUpper(rs[i-1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func applyDefaults(sv reflect.Value, prefix string) error {
+	for _, f := range configFields(sv.Type()) {
+		fv := sv.Field(f.index)
+		key := joinKey(prefix, f.key)
+		if fv.Kind() == reflect.Struct && !isScalar(fv) {
+			if err := applyDefaults(fv, key); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.hasDflt || !fv.IsZero() {
+			continue
+		}
+		if err := setFromString(fv, f.dflt); err != nil {
+			source := "default tag of " + sv.Type().String() + "." + sv.Type().Field(f.index).Name
+			return &ConfigError{Source: source, Key: key, Err: err}
+		}
+	}
+	return nil
+}
+
+func applyEnv(sv reflect.Value, envPrefix, prefix string) error {
+	for _, f := range configFields(sv.Type()) {
+		fv := sv.Field(f.index)
+		key := joinKey(prefix, f.key)
+		name := envPrefix + envKey(f.key)
+		switch {
+		case fv.Kind() == reflect.Struct && !isScalar(fv):
+			if err := applyEnv(fv, name+"_", key); err != nil {
+				return err
+			}
+			continue
+		case fv.Kind() == reflect.Map, fv.Kind() == reflect.Slice && !isScalar(reflect.New(fv.Type().Elem()).Elem()):
+			continue
+		}
+		s := os.Getenv(name)
+		if s == "" {
+			continue
+		}
+		if err := setFromString(fv, s); err != nil {
+			return &ConfigError{Source: name, Key: key, Err: err}
+		}
+	}
+	return nil
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isScalar reports whether v is set from a single string or TOML value rather than a table.
+func isScalar(v reflect.Value) bool {
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setFromString sets v from a default tag or environment variable.
+func setFromString(v reflect.Value, s string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("expected a duration such as \"30s\", got %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	s = strings.TrimSpace(s)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expected a boolean, got %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.ReplaceAll(s, "_", ""), 0, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.ReplaceAll(s, "_", ""), 0, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected a non-negative integer, got %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(s, "_", ""), v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		out := reflect.MakeSlice(v.Type(), 0, 0)
+		if s != "" {
+			for i, part := range strings.Split(s, ",") {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if !isScalar(elem) {
+					return fmt.Errorf("%s can't be set from a string", v.Type())
+				}
+				if err := setFromString(elem, part); err != nil {
+					return fmt.Errorf("item %d: %w", i+1, err)
+				}
+				out = reflect.Append(out, elem)
+			}
+		}
+		v.Set(out)
+	default:
+		return fmt.Errorf("%s can't be set from a string", v.Type())
+	}
+	return nil
+}
+
+// decodeTable sets the fields of struct sv from a parsed TOML table.
+func decodeTable(source, prefix string, doc map[string]any, sv reflect.Value) error {
+	fields := map[string]configField{}
+	for _, f := range configFields(sv.Type()) {
+		fields[f.key] = f
+	}
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		full := joinKey(prefix, key)
+		f, ok := fields[key]
+		if !ok {
+			return &ConfigError{Source: source, Key: full, Err: errors.New("unknown key")}
+		}
+		if err := setFromTOML(source, full, sv.Field(f.index), doc[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFromTOML sets v from a value parsed by minitoml.
+func setFromTOML(source, key string, v reflect.Value, x any) error {
+	mismatch := func(want string) error {
+		return &ConfigError{Source: source, Key: key, Err: fmt.Errorf("expected %s, got %s", want, tomlDescribe(x))}
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		s, ok := x.(string)
+		if !ok {
+			return mismatch("a string")
+		}
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return &ConfigError{Source: source, Key: key, Err: err}
+		}
+		return nil
+	}
+	if v.Type() == durationType {
+		s, ok := x.(string)
+		if !ok {
+			return mismatch(`a duration string such as "30s"`)
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return mismatch(`a duration string such as "30s"`)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := x.(string)
+		if !ok {
+			return mismatch("a string")
+		}
+		v.SetString(s)
+	case reflect.Bool:
+		b, ok := x.(bool)
+		if !ok {
+			return mismatch("a boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := x.(int64)
+		if !ok {
+			return mismatch("an integer")
+		}
+		if v.OverflowInt(n) {
+			return mismatch(fmt.Sprintf("an integer that fits in %s", v.Type()))
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := x.(int64)
+		if !ok || n < 0 {
+			return mismatch("a non-negative integer")
+		}
+		if v.OverflowUint(uint64(n)) {
+			return mismatch(fmt.Sprintf("an integer that fits in %s", v.Type()))
+		}
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		switch n := x.(type) {
+		case float64:
+			v.SetFloat(n)
+		case int64:
+			v.SetFloat(float64(n))
+		default:
+			return mismatch("a number")
+		}
+	case reflect.Struct:
+		t, ok := x.(map[string]any)
+		if !ok {
+			return mismatch(fmt.Sprintf("a table ([%s])", key))
+		}
+		return decodeTable(source, key, t, v)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return &ConfigError{Source: source, Key: key, Err: fmt.Errorf("unsupported field type %s", v.Type())}
+		}
+		t, ok := x.(map[string]any)
+		if !ok {
+			return mismatch("a table")
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(t))
+		for k, item := range t {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setFromTOML(source, joinKey(key, k), elem, item); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), elem)
+		}
+		v.Set(m)
+	case reflect.Slice:
+		var items []any
+		switch a := x.(type) {
+		case []any:
+			items = a
+		case []map[string]any:
+			for _, t := range a {
+				items = append(items, t)
+			}
+		default:
+			return mismatch("an array")
+		}
+		out := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFromTOML(source, fmt.Sprintf("%s[%d]", key, i+1), out.Index(i), item); err != nil {
+				return err
+			}
+		}
+		v.Set(out)
+	default:
+		return &ConfigError{Source: source, Key: key, Err: fmt.Errorf("unsupported field type %s", v.Type())}
+	}
+	return nil
+}
+
+// tomlDescribe names the type of a parsed TOML value, with the value when it is short.
+func tomlDescribe(x any) string {
+	switch x := x.(type) {
+	case string:
+		return fmt.Sprintf("string %q", TruncateString(x, 40))
+	case int64:
+		return fmt.Sprintf("integer %d", x)
+	case float64:
+		return fmt.Sprintf("float %v", x)
+	case bool:
+		return fmt.Sprintf("boolean %v", x)
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "a table"
+	case []map[string]any:
+		return "an array of tables"
+	}
+	return fmt.Sprintf("%T", x)
+}
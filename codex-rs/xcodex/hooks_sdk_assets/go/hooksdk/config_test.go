@@ -0,0 +1,244 @@
+package hooksdk_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+type testRule struct {
+	Pattern string `toml:"pattern"`
+	Reason  string
+}
+
+type testConfig struct {
+	URL         string
+	HTTPTimeout time.Duration `default:"5s"`
+	Retries     int           `default:"3"`
+	Ratio       float64       `default:"0.5"`
+	Enabled     bool          `default:"true"`
+	Branches    []string      `toml:"branches" default:"main,master"`
+	Limits      map[string]int
+	Rules       []testRule `toml:"rule"`
+	Ignored     string     `toml:"-"`
+	Notify      struct {
+		Channel string `default:"#hooks"`
+		Urgent  bool
+	}
+}
+
+// writeConfig writes data as config name in a new CODEX_HOME and returns its path.
+func writeConfig(t *testing.T, name, data string) string {
+	t.Helper()
+	t.Setenv("CODEX_HOME", t.TempDir())
+	path := hooksdk.ConfigPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	if got, want := hooksdk.ConfigPath("webhook"), filepath.Join(home, "hooks", "config", "webhook.toml"); got != want {
+		t.Errorf("ConfigPath = %s, want %s", got, want)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	t.Setenv("CODEX_HOME", t.TempDir())
+	var cfg testConfig
+	if err := hooksdk.LoadConfig("test", &cfg); err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	if cfg.HTTPTimeout != 5*time.Second || cfg.Retries != 3 || cfg.Ratio != 0.5 || !cfg.Enabled ||
+		!reflect.DeepEqual(cfg.Branches, []string{"main", "master"}) || cfg.Notify.Channel != "#hooks" || cfg.URL != "" {
+		t.Errorf("defaults = %+v", cfg)
+	}
+
+	// Defaults fill only fields that are still zero.
+	cfg = testConfig{Retries: 7, URL: "https://preset"}
+	if err := hooksdk.LoadConfig("test", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Retries != 7 || cfg.URL != "https://preset" {
+		t.Errorf("defaults replaced set fields: %+v", cfg)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	writeConfig(t, "test", `
+url = "https://example.com/hook"
+http_timeout = "30s"
+retries = 0
+ratio = 2
+enabled = false
+branches = ["trunk"]
+
+[limits]
+a = 1
+b = 2
+
+[notify]
+urgent = true
+
+[[rule]]
+pattern = "rm *"
+reason = "no"
+
+[[rule]]
+pattern = "sudo *"
+`)
+	var cfg testConfig
+	if err := hooksdk.LoadConfig("test", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := testConfig{
+		URL:         "https://example.com/hook",
+		HTTPTimeout: 30 * time.Second,
+		Ratio:       2,
+		Branches:    []string{"trunk"},
+		Limits:      map[string]int{"a": 1, "b": 2},
+		Rules:       []testRule{{"rm *", "no"}, {Pattern: "sudo *"}},
+	}
+	want.Notify.Channel, want.Notify.Urgent = "#hooks", true
+	// retries = 0 and enabled = false in the file override their defaults.
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("config = %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	writeConfig(t, "my-hook", "url = \"https://file\"\nretries = 1\n[notify]\nchannel = \"#file\"\n")
+	t.Setenv("CODEX_HOOK_MY_HOOK_URL", "https://env")
+	t.Setenv("CODEX_HOOK_MY_HOOK_HTTP_TIMEOUT", "1m")
+	t.Setenv("CODEX_HOOK_MY_HOOK_BRANCHES", "dev, release")
+	t.Setenv("CODEX_HOOK_MY_HOOK_NOTIFY_CHANNEL", "#env")
+	t.Setenv("CODEX_HOOK_MY_HOOK_NOTIFY_URGENT", "1")
+	// Empty variables are ignored, and fields skipped with toml:"-" have none.
+	t.Setenv("CODEX_HOOK_MY_HOOK_RETRIES", "")
+	t.Setenv("CODEX_HOOK_MY_HOOK_IGNORED", "set")
+	var cfg testConfig
+	if err := hooksdk.LoadConfig("my-hook", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.URL != "https://env" || cfg.HTTPTimeout != time.Minute || cfg.Retries != 1 ||
+		!reflect.DeepEqual(cfg.Branches, []string{"dev", "release"}) || cfg.Notify.Channel != "#env" || !cfg.Notify.Urgent || cfg.Ignored != "" {
+		t.Errorf("config = %+v", cfg)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		key  string
+		want string
+	}{
+		{"string for int", `retries = "three"`, nil, "retries", `expected an integer, got string "three"`},
+		{"int for string", `url = 5`, nil, "url", "expected a string, got integer 5"},
+		{"bad duration", `http_timeout = "soon"`, nil, "http_timeout", `expected a duration string such as "30s"`},
+		{"number for duration", `http_timeout = 30`, nil, "http_timeout", `expected a duration string such as "30s"`},
+		{"scalar for table", `notify = "x"`, nil, "notify", "expected a table ([notify]), got string"},
+		{"scalar for array", `branches = "main"`, nil, "branches", "expected an array"},
+		{"bad array item", `branches = ["a", 2]`, nil, "branches[2]", "expected a string, got integer 2"},
+		{"bad table of array", "[[rule]]\npattern = true\n", nil, "rule[1].pattern", "expected a string, got boolean true"},
+		{"nested", "[notify]\nurgent = \"yes\"\n", nil, "notify.urgent", "expected a boolean"},
+		{"unknown key", `surl = "x"`, nil, "surl", "unknown key"},
+		{"unknown nested key", "[notify]\nchanel = \"x\"\n", nil, "notify.chanel", "unknown key"},
+		{"bad env", "", map[string]string{"CODEX_HOOK_TEST_RETRIES": "many"}, "retries", `expected an integer, got "many"`},
+		{"bad env bool", "", map[string]string{"CODEX_HOOK_TEST_NOTIFY_URGENT": "maybe"}, "notify.urgent", "expected a boolean"},
+	}
+	for _, tt := range tests {
+		path := writeConfig(t, "test", tt.file)
+		source := path
+		for k, v := range tt.env {
+			t.Setenv(k, v)
+			source = k
+		}
+		var cfg testConfig
+		err := hooksdk.LoadConfig("test", &cfg)
+		var ce *hooksdk.ConfigError
+		if !errors.As(err, &ce) {
+			t.Errorf("%s: error = %v, want a *ConfigError", tt.name, err)
+			continue
+		}
+		if ce.Source != source || ce.Key != tt.key || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %q (source %s, key %s), want %s, %s and %q", tt.name, err, ce.Source, ce.Key, source, tt.key, tt.want)
+		}
+		for k := range tt.env {
+			t.Setenv(k, "")
+		}
+	}
+
+	path := writeConfig(t, "test", "url = \n")
+	if err := hooksdk.LoadConfig("test", &testConfig{}); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("bad TOML: error = %v, want one naming %s", err, path)
+	}
+
+	for _, v := range []any{testConfig{}, (*testConfig)(nil), new(int)} {
+		if err := hooksdk.LoadConfig("test", v); err == nil || !strings.Contains(err.Error(), "pointer to a struct") {
+			t.Errorf("LoadConfig(%T): error = %v", v, err)
+		}
+	}
+
+	var badDefault struct {
+		N int `default:"lots"`
+	}
+	var ce *hooksdk.ConfigError
+	if err := hooksdk.LoadConfig("test", &badDefault); !errors.As(err, &ce) || !strings.HasPrefix(ce.Source, "default tag of ") || ce.Key != "n" {
+		t.Errorf("bad default tag: error = %v", err)
+	}
+}
+
+type validatedConfig struct {
+	Mode string `default:"fast"`
+}
+
+func (c *validatedConfig) Validate() error {
+	if c.Mode != "fast" && c.Mode != "slow" {
+		return errors.New(`mode must be "fast" or "slow"`)
+	}
+	return nil
+}
+
+func TestLoadConfigValidate(t *testing.T) {
+	path := writeConfig(t, "test", `mode = "slow"`)
+	var cfg validatedConfig
+	if err := hooksdk.LoadConfig("test", &cfg); err != nil || cfg.Mode != "slow" {
+		t.Errorf("valid config: %+v, %v", cfg, err)
+	}
+	// Validate sees the environment overrides too.
+	t.Setenv("CODEX_HOOK_TEST_MODE", "ludicrous")
+	err := hooksdk.LoadConfig("test", &validatedConfig{})
+	if err == nil || !strings.Contains(err.Error(), path) || !strings.Contains(err.Error(), "mode must be") {
+		t.Errorf("invalid config: error = %v, want the Validate error naming %s", err, path)
+	}
+}
+
+func TestLoadConfigFileElsewhere(t *testing.T) {
+	t.Setenv("CODEX_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "custom.toml")
+	if err := os.WriteFile(path, []byte("retries = 9\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOOK_OTHER_URL", "https://env")
+	var cfg testConfig
+	if err := hooksdk.LoadConfigFile(path, "other", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Retries != 9 || cfg.URL != "https://env" {
+		t.Errorf("config = %+v", cfg)
+	}
+}
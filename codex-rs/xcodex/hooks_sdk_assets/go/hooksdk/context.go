@@ -0,0 +1,68 @@
+package hooksdk
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// SignalContext returns a context that is cancelled when the process receives SIGTERM or SIGINT
+// (the host sends SIGTERM when a hook exceeds its timeout). Call stop to release the signal
+// handler.
+func SignalContext() (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// readAllContext reads r to EOF, returning ctx.Err() as soon as ctx is cancelled. A read that is
+// blocked (e.g. on a stdin pipe) is abandoned rather than interrupted.
+func readAllContext(ctx context.Context, r io.Reader) ([]byte, error) {
+	if ctx.Done() == nil {
+		return io.ReadAll(r)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := io.ReadAll(&contextReader{ctx: ctx, r: r})
+		done <- result{data: data, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.data, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// readFileContext reads at most limit bytes of the file at path, checking ctx between chunks so a
+// huge file stops being read shortly after cancellation.
+func readFileContext(ctx context.Context, path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readAllLimit(ctx, f, limit, "payload_path "+path)
+}
+
+// contextReader fails reads with ctx.Err() once ctx is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,73 @@
+package hooksdk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// cancellingReader is an endless payload that cancels its read after the first chunk.
+type cancellingReader struct {
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads == 2 {
+		r.cancel()
+	}
+	for i := range p {
+		p[i] = ' '
+	}
+	return len(p), nil
+}
+
+func TestReadAllLimitCancelledMidRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &cancellingReader{cancel: cancel}
+	if _, err := readAllLimit(ctx, r, 0, "stdin"); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
+
+func TestReadFileContextCancelled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(path, bytes.Repeat([]byte(" "), 8<<20), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := readFileContext(ctx, path, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
+
+func TestReadPayloadContextBlockedStdin(t *testing.T) {
+	// A host that never finishes writing the payload.
+	r, w := io.Pipe()
+	defer w.Close()
+	go w.Write([]byte(`{"xcodex_event_type":`))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := ReadPayloadContext(ctx, WithIO(IO{In: r, Getenv: func(string) string { return "" }}))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("error = %v, want context.DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadPayloadContext didn't return after its context was done")
+	}
+}
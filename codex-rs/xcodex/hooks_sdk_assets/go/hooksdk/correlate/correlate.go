@@ -0,0 +1,110 @@
+// Package correlate pairs begin events with their end events (a tool call and its result, a model
+// request and its response), across hook invocations.
+//
+// The begin and end events arrive in separate processes, so Start records the begin in a small
+// state file and Finish takes it back out, along with the time in between. Every call holds a lock
+// on the file, so concurrent sessions never overwrite each other's records.
+//
+//	// on tool-call-started (e is a *hooksdk.ToolCallStartedPayload)
+//	correlate.Start("tool:"+e.SessionId+":"+e.ToolUseId, map[string]any{"tool": e.ToolName})
+//
+//	// on tool-call-finished
+//	if started, took, ok := correlate.Finish("tool:" + e.SessionId + ":" + e.ToolUseId); ok {
+//		log.Printf("tool %v took %.1fs", started.Meta["tool"], took.Seconds())
+//	}
+package correlate
+
+import (
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/state"
+)
+
+// DefaultTTL is how long New keeps a begin whose end never arrives (e.g. the session crashed).
+const DefaultTTL = 24 * time.Hour
+
+// Started is a recorded begin event.
+type Started struct {
+	Key  string         `json:"key"`
+	At   time.Time      `json:"at"`
+	Meta map[string]any `json:"meta,omitempty"`
+}
+
+// Store keeps the open begins of every key in one state file, a hooksdk/state store.
+type Store struct {
+	// Path is the state file.
+	Path string
+	// TTL is how long a begin is kept without its end; zero keeps it forever.
+	TTL time.Duration
+	// Now is the clock; nil means time.Now.
+	Now func() time.Time
+}
+
+// New returns a Store storing its state in path, with DefaultTTL.
+func New(path string) *Store {
+	return &Store{Path: path, TTL: DefaultTTL}
+}
+
+// DefaultPath returns `hooks/state/correlate.state` under CODEX_HOME (default `~/.xcodex`), the
+// state file of the package-level Start and Finish.
+func DefaultPath() string {
+	return hooksdk.Environ().Path("hooks", "state", "correlate.state")
+}
+
+// Start records the begin of key now, with meta (any JSON-encodable values) to hand back to
+// Finish. A second Start for the same key replaces the first.
+func (s *Store) Start(key string, meta map[string]any) error {
+	return s.update(key, func(e *state.Entry) error {
+		return e.Set(Started{Key: key, At: e.Now(), Meta: meta}, s.TTL)
+	})
+}
+
+// Finish removes the begin of key and returns it with the time since it started; ok is false when
+// there is none (the begin was never seen, was already finished, or expired). Numbers in Meta come
+// back as float64, as from encoding/json.
+func (s *Store) Finish(key string) (started Started, took time.Duration, ok bool, err error) {
+	err = s.update(key, func(e *state.Entry) error {
+		// A begin that can't be decoded is dropped like one that expired.
+		if ok, _ = e.Decode(&started); ok {
+			if took = e.Now().Sub(started.At); took < 0 {
+				took = 0
+			}
+		}
+		e.Delete()
+		return nil
+	})
+	if err != nil || !ok {
+		return Started{}, 0, false, err
+	}
+	return started, took, true, nil
+}
+
+// update runs fn on key's entry in the state file's store.
+func (s *Store) update(key string, fn func(e *state.Entry) error) error {
+	st, err := state.OpenPath(s.Path)
+	if err != nil {
+		return err
+	}
+	st.Now = s.Now
+	return st.Update(key, fn)
+}
+
+// Start is Store.Start on the state file at DefaultPath. Errors are logged to stderr: a hook
+// shouldn't fail because a duration can't be measured.
+func Start(key string, meta map[string]any) {
+	if err := New(DefaultPath()).Start(key, meta); err != nil {
+		hooklog.Warnf("correlate: %v", err)
+	}
+}
+
+// Finish is Store.Finish on the state file at DefaultPath; errors are logged to stderr and
+// reported as ok == false.
+func Finish(key string) (Started, time.Duration, bool) {
+	started, took, ok, err := New(DefaultPath()).Finish(key)
+	if err != nil {
+		hooklog.Warnf("correlate: %v", err)
+	}
+	return started, took, ok
+}
@@ -0,0 +1,180 @@
+package correlate_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/correlate"
+)
+
+// clock is a settable time for Store.Now.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// store returns a Store on a fresh state file, reading the time from c.
+func store(t *testing.T, c *clock) *correlate.Store {
+	s := correlate.New(filepath.Join(t.TempDir(), "correlate.state"))
+	s.Now = c.now
+	return s
+}
+
+func start(t *testing.T, s *correlate.Store, key string, meta map[string]any) {
+	t.Helper()
+	if err := s.Start(key, meta); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func finish(t *testing.T, s *correlate.Store, key string) (correlate.Started, time.Duration, bool) {
+	t.Helper()
+	started, took, ok, err := s.Finish(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return started, took, ok
+}
+
+func TestInterleavedKeys(t *testing.T) {
+	c := &clock{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := store(t, c)
+	start(t, s, "a", map[string]any{"tool": "Bash", "n": 3})
+	c.advance(time.Second)
+	start(t, s, "b", nil)
+	c.advance(3200 * time.Millisecond)
+
+	started, took, ok := finish(t, s, "a")
+	if !ok || took != 4200*time.Millisecond || started.Key != "a" || started.Meta["tool"] != "Bash" || started.Meta["n"] != float64(3) {
+		t.Errorf("Finish(a) = %+v, %v, %v", started, took, ok)
+	}
+	c.advance(time.Second)
+	if started, took, ok := finish(t, s, "b"); !ok || took != 4200*time.Millisecond || started.Meta != nil {
+		t.Errorf("Finish(b) = %+v, %v, %v", started, took, ok)
+	}
+	// Each begin is finished once.
+	if _, _, ok := finish(t, s, "a"); ok {
+		t.Error("a finished twice")
+	}
+}
+
+func TestMissingBegin(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	if started, took, ok := finish(t, s, "never-started"); ok || took != 0 || started.Key != "" {
+		t.Errorf("Finish without Start = %+v, %v, %v", started, took, ok)
+	}
+	// The file needn't exist yet, or its directory.
+	s.Path = filepath.Join(t.TempDir(), "new", "dir", "correlate.state")
+	if _, _, ok := finish(t, s, "k"); ok {
+		t.Error("Finish on a new store found a begin")
+	}
+}
+
+func TestRestart(t *testing.T) {
+	c := &clock{time.Now()}
+	s := store(t, c)
+	start(t, s, "k", map[string]any{"try": 1})
+	c.advance(time.Minute)
+	start(t, s, "k", map[string]any{"try": 2})
+	c.advance(time.Second)
+	if started, took, ok := finish(t, s, "k"); !ok || took != time.Second || started.Meta["try"] != float64(2) {
+		t.Errorf("Finish after a second Start = %+v, %v, %v; want the second", started, took, ok)
+	}
+	// A clock that went backwards is no time at all.
+	start(t, s, "k", nil)
+	c.advance(-time.Hour)
+	if _, took, ok := finish(t, s, "k"); !ok || took != 0 {
+		t.Errorf("Finish before Start = %v, %v; want 0", took, ok)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c := &clock{time.Now()}
+	s := store(t, c)
+	s.TTL = time.Hour
+	start(t, s, "orphan", nil)
+	start(t, s, "late", nil)
+	c.advance(59 * time.Minute)
+	if _, _, ok := finish(t, s, "late"); !ok {
+		t.Error("begin expired within its TTL")
+	}
+	c.advance(time.Minute)
+	if _, _, ok := finish(t, s, "orphan"); ok {
+		t.Error("begin kept past its TTL")
+	}
+
+	s.TTL = 0
+	start(t, s, "forever", nil)
+	c.advance(10 * 365 * 24 * time.Hour)
+	if _, _, ok := finish(t, s, "forever"); !ok {
+		t.Error("begin with no TTL expired")
+	}
+	if correlate.New("x").TTL != correlate.DefaultTTL {
+		t.Error("New doesn't use DefaultTTL")
+	}
+}
+
+func TestCorruptState(t *testing.T) {
+	c := &clock{time.Now()}
+	s := store(t, c)
+	if err := os.WriteFile(s.Path, []byte("garbage\n{\"key\":\"k\",\"value\":[1]}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := finish(t, s, "k"); ok {
+		t.Error("a begin that doesn't decode was returned")
+	}
+	start(t, s, "k", nil)
+	if _, _, ok := finish(t, s, "k"); !ok {
+		t.Error("Start after corrupt state didn't record")
+	}
+}
+
+func TestConcurrentSessions(t *testing.T) {
+	c := &clock{time.Now()}
+	s := store(t, c)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Each goroutine opens the file itself, as each hook process does.
+			s := correlate.New(s.Path)
+			key := fmt.Sprintf("tool:s%d:call", i)
+			if err := s.Start(key, map[string]any{"i": i}); err != nil {
+				t.Error(err)
+				return
+			}
+			if started, _, ok, err := s.Finish(key); err != nil || !ok || started.Meta["i"] != float64(i) {
+				t.Errorf("%s: Finish = %+v, %v, %v", key, started, ok, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPackageLevel(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	if want := filepath.Join(home, "hooks", "state", "correlate.state"); correlate.DefaultPath() != want {
+		t.Errorf("DefaultPath() = %s, want %s", correlate.DefaultPath(), want)
+	}
+	correlate.Start("k", map[string]any{"tool": "Bash"})
+	if started, _, ok := correlate.Finish("k"); !ok || started.Meta["tool"] != "Bash" {
+		t.Errorf("Finish = %+v, %v", started, ok)
+	}
+
+	// An unusable state file only loses the duration.
+	blocked := filepath.Join(home, "file")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOME", blocked)
+	correlate.Start("k", nil)
+	if _, _, ok := correlate.Finish("k"); ok {
+		t.Error("Finish with an unusable state file found a begin")
+	}
+}
@@ -0,0 +1,123 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// DebugDirEnv names a directory where ReadPayload saves what it reads, for debugging a payload
+// that parses differently than expected (see WithDebugCapture).
+const DebugDirEnv = "CODEX_HOOK_DEBUG_DIR"
+
+// WithDebugCapture makes ReadPayload (and Run) save the exact bytes it reads in dir before
+// parsing them, overriding CODEX_HOOK_DEBUG_DIR (an empty dir turns capturing off). Each read
+// writes three files named after the time, the process id, and a count of reads in the process:
+//
+//   - `<time>-<pid>-<n>.stdin`: stdin as received, an envelope or the payload itself;
+//   - `<time>-<pid>-<n>.payload`: the payload the envelope resolved to (the payload_path file after
+//     decompression, or the inline payload), when it could be resolved;
+//   - `<time>-<pid>-<n>.meta.json`: the hook name, pid, sizes, and whether parsing succeeded or
+//     the error it failed with.
+//
+// Payloads can hold secrets, so the files are only readable by the user. Capturing never changes
+// what ReadPayload returns: a directory that can't be written is skipped (logged at debug level).
+func WithDebugCapture(dir string) Option {
+	return func(o *options) {
+		o.debugDir = dir
+		o.hasDebugDir = true
+	}
+}
+
+// captureSeq numbers the reads of this process, so reads in the same instant get distinct files.
+var captureSeq atomic.Int64
+
+// debugCapture records one payload read. A nil *debugCapture captures nothing.
+type debugCapture struct {
+	prefix string
+	meta   debugCaptureMeta
+}
+
+type debugCaptureMeta struct {
+	Hook         string    `json:"hook"`
+	PID          int       `json:"pid"`
+	Time         time.Time `json:"time"`
+	StdinBytes   int       `json:"stdin_bytes"`
+	PayloadBytes *int      `json:"payload_bytes,omitempty"`
+	PayloadPath  string    `json:"payload_path,omitempty"`
+	EventType    string    `json:"event_type,omitempty"`
+	SessionID    string    `json:"session_id,omitempty"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// startCapture returns the capture for a read with o, or nil when capturing is off or the
+// directory can't be created.
+func (o *options) startCapture() *debugCapture {
+	dir := o.debugDir
+	if !o.hasDebugDir {
+		dir = o.stdio.Environ().DebugDir
+	}
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		hooklog.Debugf("debug capture: %v", err)
+		return nil
+	}
+	now := time.Now().UTC()
+	pid := os.Getpid()
+	return &debugCapture{
+		prefix: filepath.Join(dir, fmt.Sprintf("%s-%d-%d", now.Format("20060102T150405.000000000Z"), pid, captureSeq.Add(1))),
+		meta:   debugCaptureMeta{Hook: hooklog.HookName(), PID: pid, Time: now},
+	}
+}
+
+func (c *debugCapture) stdin(data []byte) {
+	if c == nil {
+		return
+	}
+	c.meta.StdinBytes = len(data)
+	c.write(".stdin", data)
+}
+
+func (c *debugCapture) payload(data []byte, env envelope) {
+	if c == nil {
+		return
+	}
+	n := len(data)
+	c.meta.PayloadBytes = &n
+	c.meta.PayloadPath = env.payloadPath
+	c.write(".payload", data)
+}
+
+// finish writes the metadata file with the outcome of the read.
+func (c *debugCapture) finish(p *HookPayload, err error) {
+	if c == nil {
+		return
+	}
+	c.meta.Outcome = "ok"
+	if err != nil {
+		c.meta.Outcome, c.meta.Error = "error", err.Error()
+	}
+	if p != nil {
+		c.meta.EventType, c.meta.SessionID = p.EventType(), p.SessionID()
+	}
+	data, merr := json.MarshalIndent(c.meta, "", "  ")
+	if merr != nil {
+		hooklog.Debugf("debug capture: %v", merr)
+		return
+	}
+	c.write(".meta.json", append(data, '\n'))
+}
+
+func (c *debugCapture) write(suffix string, data []byte) {
+	if err := os.WriteFile(c.prefix+suffix, data, 0o600); err != nil {
+		hooklog.Debugf("debug capture: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// captured returns the files of the single capture in dir, keyed by suffix.
+func captured(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	metas, _ := filepath.Glob(filepath.Join(dir, "*.meta.json"))
+	if len(metas) != 1 {
+		t.Fatalf("%d captures in %s, want 1", len(metas), dir)
+	}
+	prefix := strings.TrimSuffix(metas[0], ".meta.json")
+	files := map[string][]byte{}
+	for _, suffix := range []string{".stdin", ".payload", ".meta.json"} {
+		if data, err := os.ReadFile(prefix + suffix); err == nil {
+			files[suffix] = data
+		}
+	}
+	return files
+}
+
+// captureMeta decodes the metadata file of a capture.
+func captureMeta(t *testing.T, files map[string][]byte) map[string]any {
+	t.Helper()
+	var meta map[string]any
+	if err := json.Unmarshal(files[".meta.json"], &meta); err != nil {
+		t.Fatalf("meta %s: %v", files[".meta.json"], err)
+	}
+	return meta
+}
+
+func TestDebugCapture(t *testing.T) {
+	t.Setenv("CODEX_HOOK_NAME", "capturer")
+	stdin := hooktest.ToolCallStarted().WithSessionID("s-capture").Bytes()
+	dir := t.TempDir()
+	p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithDebugCapture(dir))
+	if err != nil || p.SessionID() != "s-capture" {
+		t.Fatalf("ReadPayloadFrom = %v, %v", p, err)
+	}
+	files := captured(t, dir)
+	if !bytes.Equal(files[".stdin"], stdin) || !bytes.Equal(files[".payload"], stdin) {
+		t.Errorf("captured stdin %q, payload %q; want the bytes read", files[".stdin"], files[".payload"])
+	}
+	meta := captureMeta(t, files)
+	for k, want := range map[string]any{
+		"hook":          "capturer",
+		"pid":           float64(os.Getpid()),
+		"stdin_bytes":   float64(len(stdin)),
+		"payload_bytes": float64(len(stdin)),
+		"event_type":    string(hooksdk.EventToolCallStarted),
+		"session_id":    "s-capture",
+		"outcome":       "ok",
+	} {
+		if meta[k] != want {
+			t.Errorf("meta %s = %v, want %v", k, meta[k], want)
+		}
+	}
+	if _, ok := meta["error"]; ok {
+		t.Errorf("meta of a successful read has an error: %v", meta)
+	}
+	if runtime.GOOS != "windows" {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0o600 {
+				t.Errorf("%s: mode %v, want 0600", e.Name(), info.Mode().Perm())
+			}
+		}
+	}
+}
+
+func TestDebugCaptureEnvelope(t *testing.T) {
+	payload := hooktest.SessionStart().WithSessionID("s-envelope").Bytes()
+	stdin := pathEnvelope(t, "payload.json.gz", gzipBytes(t, payload), map[string]any{"payload_encoding": "gzip"})
+	dir := t.TempDir()
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithDebugCapture(dir)); err != nil {
+		t.Fatal(err)
+	}
+	files := captured(t, dir)
+	if !bytes.Equal(files[".stdin"], stdin) {
+		t.Errorf("captured stdin %q, want the envelope %q", files[".stdin"], stdin)
+	}
+	if !bytes.Equal(files[".payload"], payload) {
+		t.Errorf("captured payload %q, want the decompressed file %q", files[".payload"], payload)
+	}
+	meta := captureMeta(t, files)
+	if meta["payload_path"] == nil || meta["payload_bytes"] != float64(len(payload)) || meta["session_id"] != "s-envelope" {
+		t.Errorf("meta = %v", meta)
+	}
+}
+
+func TestDebugCaptureError(t *testing.T) {
+	dir := t.TempDir()
+	stdin := []byte(`{"event_type": "session-start",`)
+	_, werr := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin))
+	_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithDebugCapture(dir))
+	if err == nil || werr == nil || err.Error() != werr.Error() {
+		t.Fatalf("error with capture %v, without %v", err, werr)
+	}
+	files := captured(t, dir)
+	if !bytes.Equal(files[".stdin"], stdin) {
+		t.Errorf("captured stdin %q", files[".stdin"])
+	}
+	if meta := captureMeta(t, files); meta["outcome"] != "error" || meta["error"] != err.Error() {
+		t.Errorf("meta = %v, want outcome error with %q", meta, err)
+	}
+}
+
+func TestDebugCaptureEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(hooksdk.DebugDirEnv, dir)
+	stdin := hooktest.SessionStart().Bytes()
+	for i := 0; i < 3; i++ {
+		if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each read gets its own files, even within the same instant.
+	metas, _ := filepath.Glob(filepath.Join(dir, "*.meta.json"))
+	stdins, _ := filepath.Glob(filepath.Join(dir, "*.stdin"))
+	if len(metas) != 3 || len(stdins) != 3 {
+		t.Errorf("captures = %v, %v; want 3 of each", metas, stdins)
+	}
+	sort.Strings(metas)
+	for i := 1; i < len(metas); i++ {
+		if metas[i] == metas[i-1] {
+			t.Errorf("two reads share %s", metas[i])
+		}
+	}
+
+	// An empty WithDebugCapture turns capturing off.
+	off := t.TempDir()
+	t.Setenv(hooksdk.DebugDirEnv, off)
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithDebugCapture("")); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(off); len(entries) != 0 {
+		t.Errorf("captured with WithDebugCapture(\"\"): %v", entries)
+	}
+}
+
+func TestDebugCaptureUnwritable(t *testing.T) {
+	// A regular file can't be the capture directory; the read is unaffected.
+	file := filepath.Join(t.TempDir(), "not-a-dir")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(hooktest.SessionStart().WithSessionID("s-1").Bytes()), hooksdk.WithDebugCapture(filepath.Join(file, "captures")))
+	if err != nil || p.SessionID() != "s-1" {
+		t.Errorf("ReadPayloadFrom = %v, %v", p, err)
+	}
+}
@@ -0,0 +1,249 @@
+// Package decisioncache remembers a hook's decisions for the rest of a session, so a hook that
+// asks about a command doesn't ask again every time the agent runs it.
+//
+// Every event runs in a new process, so decisions are kept in a hooksdk/state store in Dir, one
+// key per session, and every call holds its lock. Decisions can expire after a TTL; the
+// session-end event drops the rest.
+//
+//	key := decisioncache.CommandKey(payload)
+//	if d, ok := decisioncache.Lookup(payload.SessionID(), key); ok {
+//		return hooksdk.Response{Decision: d}, nil
+//	}
+//	// ... decide, then
+//	decisioncache.Remember(payload.SessionID(), key, hooksdk.DecisionAllow, 0)
+//
+// Middleware does the same around a whole handler.
+package decisioncache
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/state"
+)
+
+// DefaultMaxAge is how long New keeps the decisions of a session that never ended (e.g. it
+// crashed) after their last change.
+const DefaultMaxAge = 7 * 24 * time.Hour
+
+// Store keeps each session's decisions under its id in one hooksdk/state store in Dir.
+type Store struct {
+	// Dir holds the store, `decisions.state`, and its lock.
+	Dir string
+	// MaxAge is how long a session's decisions are kept after their last change. Zero keeps them
+	// until the session ends.
+	MaxAge time.Duration
+	// Now is the clock; nil means time.Now.
+	Now func() time.Time
+}
+
+// New returns a Store keeping its state in dir, with DefaultMaxAge.
+func New(dir string) *Store {
+	return &Store{Dir: dir, MaxAge: DefaultMaxAge}
+}
+
+// DefaultDir returns `hooks/state/decisions` under CODEX_HOME (default `~/.xcodex`), the state
+// directory of the package-level functions.
+func DefaultDir() string {
+	return hooksdk.Environ().Path("hooks", "state", "decisions")
+}
+
+type entry struct {
+	Decision hooksdk.Decision `json:"decision"`
+	Reason   string           `json:"reason,omitempty"`
+	// ReasonCode and Reasons are the handler's reason_code and reasons, replayed with the decision.
+	ReasonCode string           `json:"reason_code,omitempty"`
+	Reasons    []hooksdk.Reason `json:"reasons,omitempty"`
+	// Expires is when the entry stops applying; zero means at the end of the session.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// decisions are a session's entries by key.
+type decisions map[string]entry
+
+// Remember records d as the decision for key in session, for ttl (zero: until the session ends).
+// A later Remember of the same key replaces it.
+func (s *Store) Remember(session, key string, d hooksdk.Decision, ttl time.Duration) error {
+	return s.remember(session, key, entry{Decision: d}, ttl)
+}
+
+func (s *Store) remember(session, key string, e entry, ttl time.Duration) error {
+	if session == "" {
+		return nil
+	}
+	return s.store().Update(session, func(se *state.Entry) error {
+		ds := s.load(se)
+		if ttl > 0 {
+			e.Expires = se.Now().Add(ttl)
+		}
+		ds[key] = e
+		return se.Set(ds, s.MaxAge)
+	})
+}
+
+// Lookup returns the decision remembered for key in session; ok is false when there is none or
+// it expired. Sessions never see each other's decisions, even for the same key.
+func (s *Store) Lookup(session, key string) (d hooksdk.Decision, ok bool, err error) {
+	e, ok, err := s.lookup(session, key)
+	return e.Decision, ok, err
+}
+
+func (s *Store) lookup(session, key string) (e entry, ok bool, err error) {
+	if session == "" {
+		return entry{}, false, nil
+	}
+	err = s.store().Update(session, func(se *state.Entry) error {
+		e, ok = s.load(se)[key]
+		return nil
+	})
+	return e, ok, err
+}
+
+// Forget drops every decision of session. Those of sessions that never ended expire MaxAge after
+// their last change.
+func (s *Store) Forget(session string) error {
+	if session == "" {
+		return nil
+	}
+	return s.store().Delete(session)
+}
+
+// store is the state store in Dir. It has no MaxEntries, so a lookup doesn't write.
+func (s *Store) store() *state.Store {
+	return &state.Store{Path: filepath.Join(s.Dir, "decisions.state"), Now: s.Now}
+}
+
+// load returns a session's decisions without the expired ones. A value that isn't decisions
+// counts as none.
+func (s *Store) load(se *state.Entry) decisions {
+	var ds decisions
+	if _, err := se.Decode(&ds); err != nil || ds == nil {
+		ds = decisions{}
+	}
+	for key, e := range ds {
+		if !e.Expires.IsZero() && !se.Now().Before(e.Expires) {
+			delete(ds, key)
+		}
+	}
+	return ds
+}
+
+// Remember is Store.Remember on the store in DefaultDir. Errors are logged to stderr: a hook
+// shouldn't fail because a decision can't be cached.
+func Remember(session, key string, d hooksdk.Decision, ttl time.Duration) {
+	if err := New(DefaultDir()).Remember(session, key, d, ttl); err != nil {
+		hooklog.Warnf("decisioncache: %v", err)
+	}
+}
+
+// Lookup is Store.Lookup on the store in DefaultDir; errors are logged to stderr and
+// reported as ok == false.
+func Lookup(session, key string) (hooksdk.Decision, bool) {
+	d, ok, err := New(DefaultDir()).Lookup(session, key)
+	if err != nil {
+		hooklog.Warnf("decisioncache: %v", err)
+	}
+	return d, ok
+}
+
+// Forget is Store.Forget on the store in DefaultDir; errors are logged to stderr.
+func Forget(session string) {
+	if err := New(DefaultDir()).Forget(session); err != nil {
+		hooklog.Warnf("decisioncache: %v", err)
+	}
+}
+
+// CommandKey is a key function for Middleware: the command of an `approval-requested` event, or
+// the tool and its `tool_input.command` for `tool-call-started`, and "" (not cached) for anything
+// else.
+func CommandKey(p *hooksdk.HookPayload) string {
+	switch p.EventType() {
+	case "approval-requested":
+		if len(p.Command) > 0 {
+			return "command:" + strings.Join(p.Command, "\x00")
+		}
+	case "tool-call-started":
+		command, ok := hooksdk.Field[any](p.RawPayload, "tool_input.command")
+		if !ok || p.ToolName == nil {
+			return ""
+		}
+		data, err := json.Marshal(command)
+		if err != nil {
+			return ""
+		}
+		return "tool:" + *p.ToolName + ":" + string(data)
+	}
+	return ""
+}
+
+// Middleware returns hooksdk middleware that answers an event from s when key(p) has a decision
+// remembered in its session, without calling the handler, and otherwise remembers the handler's
+// decision for ttl (see Store.Remember). An ask is remembered as allow: the user has been asked
+// once, which is what "allow for the rest of this session" means. Events whose key is "",
+// handler errors, and responses that modify the payload are passed through uncached, and a
+// session-end event forgets the session's decisions (see Store.Forget). Cache errors are logged to
+// stderr and otherwise ignored.
+//
+// An ask with a question (see hooksdk.AskQuestion) isn't remembered, because the user may not
+// allow it; the question's id is set to the key instead, when it has none. When the host echoes
+// the answer on a later event (see hooksdk.HookPayload.QuestionAnswer) and the option chosen has
+// scope session, its decision is remembered for that key; other answers hold only once.
+func Middleware(s *Store, key func(*hooksdk.HookPayload) string, ttl time.Duration) hooksdk.Middleware {
+	return func(next hooksdk.Handler) hooksdk.Handler {
+		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			session := p.SessionID()
+			if p.EventType() == "session-end" {
+				if err := s.Forget(session); err != nil {
+					hooklog.Warnf("decisioncache: %v", err)
+				}
+				return next(ctx, p)
+			}
+			if a, ok := p.QuestionAnswer(); ok && a.QuestionID != "" && a.Option.Scope == hooksdk.ScopeSession && session != "" {
+				switch a.Option.Decision {
+				case hooksdk.DecisionAllow, hooksdk.DecisionDeny:
+					if err := s.remember(session, a.QuestionID, entry{Decision: a.Option.Decision}, ttl); err != nil {
+						hooklog.Warnf("decisioncache: %v", err)
+					}
+				}
+			}
+			k := key(p)
+			if k == "" || session == "" {
+				return next(ctx, p)
+			}
+			e, ok, err := s.lookup(session, k)
+			if err != nil {
+				hooklog.Warnf("decisioncache: %v", err)
+			}
+			if ok {
+				hooklog.Debugf("decisioncache: %s (decided earlier in this session)", e.Decision)
+				return hooksdk.Response{Decision: e.Decision, Reason: e.Reason, ReasonCode: e.ReasonCode, Reasons: e.Reasons}, nil
+			}
+			resp, err := next(ctx, p)
+			if err != nil || len(resp.Modify) > 0 {
+				return resp, err
+			}
+			if resp.Decision == hooksdk.DecisionAsk && resp.Question != nil {
+				if resp.Question.ID == "" {
+					q := *resp.Question
+					q.ID = k
+					resp.Question = &q
+				}
+				return resp, nil
+			}
+			e = entry{Decision: resp.Decision, Reason: resp.Reason, ReasonCode: resp.ReasonCode, Reasons: resp.Reasons}
+			switch resp.Decision {
+			case hooksdk.DecisionAsk, "":
+				e = entry{Decision: hooksdk.DecisionAllow}
+			}
+			if err := s.remember(session, k, e, ttl); err != nil {
+				hooklog.Warnf("decisioncache: %v", err)
+			}
+			return resp, nil
+		}
+	}
+}
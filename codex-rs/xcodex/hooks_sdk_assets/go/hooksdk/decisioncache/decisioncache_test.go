@@ -0,0 +1,422 @@
+package decisioncache_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/decisioncache"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// TestMain lets the tests run this binary as a hook process: with DECISIONCACHE_TEST_DIR set, it
+// remembers DECISIONCACHE_TEST_KEY as allow in session "shared" and exits.
+func TestMain(m *testing.M) {
+	if dir := os.Getenv("DECISIONCACHE_TEST_DIR"); dir != "" {
+		if err := decisioncache.New(dir).Remember("shared", os.Getenv("DECISIONCACHE_TEST_KEY"), hooksdk.DecisionAllow, 0); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// clock is a settable time for Store.Now.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// store returns a Store in a fresh directory, reading the time from c.
+func store(t *testing.T, c *clock) *decisioncache.Store {
+	s := decisioncache.New(t.TempDir())
+	s.Now = c.now
+	return s
+}
+
+func remember(t *testing.T, s *decisioncache.Store, session, key string, d hooksdk.Decision, ttl time.Duration) {
+	t.Helper()
+	if err := s.Remember(session, key, d, ttl); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lookup(t *testing.T, s *decisioncache.Store, session, key string) (hooksdk.Decision, bool) {
+	t.Helper()
+	d, ok, err := s.Lookup(session, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, ok
+}
+
+func TestRememberLookup(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	if _, ok := lookup(t, s, "s1", "k"); ok {
+		t.Fatal("found a decision in an empty store")
+	}
+	remember(t, s, "s1", "k", hooksdk.DecisionDeny, 0)
+	if d, ok := lookup(t, s, "s1", "k"); !ok || d != hooksdk.DecisionDeny {
+		t.Errorf("Lookup = %s, %v; want deny", d, ok)
+	}
+	remember(t, s, "s1", "k", hooksdk.DecisionAllow, 0)
+	if d, _ := lookup(t, s, "s1", "k"); d != hooksdk.DecisionAllow {
+		t.Errorf("Lookup after a second Remember = %s, want allow", d)
+	}
+	// A payload without a session id isn't cached.
+	remember(t, s, "", "k", hooksdk.DecisionDeny, 0)
+	if _, ok := lookup(t, s, "", "k"); ok {
+		t.Error("remembered a decision for no session")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := &clock{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := store(t, c)
+	s.MaxAge = 0
+	remember(t, s, "s1", "short", hooksdk.DecisionAllow, time.Minute)
+	remember(t, s, "s1", "session", hooksdk.DecisionAllow, 0)
+	c.advance(59 * time.Second)
+	if _, ok := lookup(t, s, "s1", "short"); !ok {
+		t.Error("expired before its TTL")
+	}
+	c.advance(time.Second)
+	if _, ok := lookup(t, s, "s1", "short"); ok {
+		t.Error("still remembered at its TTL")
+	}
+	c.advance(365 * 24 * time.Hour)
+	if _, ok := lookup(t, s, "s1", "session"); !ok {
+		t.Error("a decision without a TTL expired")
+	}
+}
+
+func TestSessionsDontCollide(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	// Ids that would sanitize to the same file name stay apart.
+	sessions := []string{"s1", "s2", "a/b", "a_b", "a\\b", "../s1", ".s1"}
+	for i, session := range sessions {
+		d := hooksdk.DecisionAllow
+		if i%2 == 1 {
+			d = hooksdk.DecisionDeny
+		}
+		remember(t, s, session, "same-key", d, 0)
+	}
+	for i, session := range sessions {
+		want := hooksdk.DecisionAllow
+		if i%2 == 1 {
+			want = hooksdk.DecisionDeny
+		}
+		if d, ok := lookup(t, s, session, "same-key"); !ok || d != want {
+			t.Errorf("session %q: Lookup = %s, %v; want %s", session, d, ok, want)
+		}
+	}
+	if _, ok := lookup(t, s, "s3", "same-key"); ok {
+		t.Error("a new session saw another's decision")
+	}
+}
+
+func TestCorruptState(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	if err := os.WriteFile(filepath.Join(s.Dir, "decisions.state"), []byte("{not json\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lookup(t, s, "s1", "k"); ok {
+		t.Error("found a decision in a corrupt file")
+	}
+	remember(t, s, "s1", "k", hooksdk.DecisionAllow, 0)
+	if _, ok := lookup(t, s, "s1", "k"); !ok {
+		t.Error("couldn't replace a corrupt file")
+	}
+}
+
+func TestForget(t *testing.T) {
+	c := &clock{time.Now()}
+	s := store(t, c)
+	s.MaxAge = time.Hour
+	remember(t, s, "ended", "k", hooksdk.DecisionAllow, 0)
+	remember(t, s, "stale", "k", hooksdk.DecisionAllow, 0)
+	c.advance(2 * time.Hour)
+	remember(t, s, "live", "k", hooksdk.DecisionAllow, 0)
+	if err := s.Forget("ended"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lookup(t, s, "ended", "k"); ok {
+		t.Error("Forget kept the session's decisions")
+	}
+	if _, ok := lookup(t, s, "stale", "k"); ok {
+		t.Error("kept a session idle for longer than MaxAge")
+	}
+	if _, ok := lookup(t, s, "live", "k"); !ok {
+		t.Error("Forget dropped another live session")
+	}
+	if err := s.Forget("never-seen"); err != nil {
+		t.Errorf("Forget of an unknown session: %v", err)
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		// Hook processes and goroutines each add their own key to the one session's file.
+		go func(i int) {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run=^$")
+			cmd.Env = append(os.Environ(), "DECISIONCACHE_TEST_DIR="+dir, fmt.Sprintf("DECISIONCACHE_TEST_KEY=proc-%d", i))
+			if out, err := cmd.CombinedOutput(); err != nil {
+				errs <- fmt.Errorf("%v: %s", err, out)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			errs <- decisioncache.New(dir).Remember("shared", fmt.Sprintf("goroutine-%d", i), hooksdk.DecisionAllow, 0)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	s := decisioncache.New(dir)
+	for i := 0; i < writers; i++ {
+		for _, key := range []string{fmt.Sprintf("proc-%d", i), fmt.Sprintf("goroutine-%d", i)} {
+			if _, ok := lookup(t, s, "shared", key); !ok {
+				t.Errorf("lost the decision for %s", key)
+			}
+		}
+	}
+}
+
+func TestPackageLevel(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	if want := filepath.Join(home, "hooks", "state", "decisions"); decisioncache.DefaultDir() != want {
+		t.Errorf("DefaultDir() = %s, want %s", decisioncache.DefaultDir(), want)
+	}
+	decisioncache.Remember("s1", "k", hooksdk.DecisionDeny, 0)
+	if d, ok := decisioncache.Lookup("s1", "k"); !ok || d != hooksdk.DecisionDeny {
+		t.Errorf("Lookup = %s, %v", d, ok)
+	}
+	decisioncache.Forget("s1")
+	if _, ok := decisioncache.Lookup("s1", "k"); ok {
+		t.Error("Forget kept the decision")
+	}
+
+	// A store that can't be written doesn't fail the hook.
+	blocked := filepath.Join(home, "file")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOME", blocked)
+	decisioncache.Remember("s1", "k", hooksdk.DecisionDeny, 0)
+	if _, ok := decisioncache.Lookup("s1", "k"); ok {
+		t.Error("found a decision in a store that can't exist")
+	}
+}
+
+func TestCommandKey(t *testing.T) {
+	keys := map[string]string{}
+	for name, b := range map[string]*hooktest.Builder{
+		"approval":       hooktest.ApprovalRequested().WithCommand("rm -rf build"),
+		"other approval": hooktest.ApprovalRequested().WithCommand("rm -rf dist"),
+		"tool":           hooktest.ToolCallStarted().WithToolName("shell").WithCommand("rm -rf build"),
+		"other tool":     hooktest.ToolCallStarted().WithToolName("exec").WithCommand("rm -rf build"),
+	} {
+		key := decisioncache.CommandKey(b.Build())
+		if key == "" {
+			t.Errorf("%s: no key", name)
+		}
+		if other, ok := keys[key]; ok {
+			t.Errorf("%s and %s share the key %q", name, other, key)
+		}
+		keys[key] = name
+	}
+	for name, b := range map[string]*hooktest.Builder{
+		"no command":    hooktest.ToolCallStarted().With("tool_input", map[string]any{"path": "x"}),
+		"no tool name":  hooktest.ToolCallStarted().With("tool_name", nil),
+		"empty argv":    hooktest.ApprovalRequested().With("command", []any{}),
+		"session start": hooktest.SessionStart(),
+	} {
+		if key := decisioncache.CommandKey(b.Build()); key != "" {
+			t.Errorf("%s: key %q, want none", name, key)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	calls := 0
+	decision := hooksdk.Deny("no sudo", hooksdk.WithReasonCode("NO_SUDO"))
+	var handlerErr error
+	h := decisioncache.Middleware(s, decisioncache.CommandKey, 0)(func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		calls++
+		return decision, handlerErr
+	})
+	call := func(b *hooktest.Builder) hooksdk.Response {
+		t.Helper()
+		resp, _ := h(context.Background(), b.Build())
+		return resp
+	}
+	sudo := func(session string) *hooktest.Builder {
+		return hooktest.ApprovalRequested().WithSessionID(session).WithCommand("sudo ls")
+	}
+
+	// The handler decides once; the cache answers after, with the same reasons.
+	first := call(sudo("s1"))
+	second := call(sudo("s1"))
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	if second.Decision != hooksdk.DecisionDeny || second.Reason != "no sudo" || second.ReasonCode != "NO_SUDO" || !reflect.DeepEqual(second.Reasons, first.Reasons) {
+		t.Errorf("cached response = %+v, want %+v", second, first)
+	}
+	// Another session asks the handler again.
+	call(sudo("s2"))
+	if calls != 2 {
+		t.Errorf("another session was answered from the cache")
+	}
+
+	// An ask is remembered as allow.
+	decision = hooksdk.Ask("run it?")
+	call(hooktest.ApprovalRequested().WithSessionID("s1").WithCommand("make"))
+	if resp := call(hooktest.ApprovalRequested().WithSessionID("s1").WithCommand("make")); resp.Decision != hooksdk.DecisionAllow || calls != 3 {
+		t.Errorf("after an ask: %+v (%d calls), want a cached allow", resp, calls)
+	}
+
+	// Errors, modifications and events without a key aren't cached.
+	for name, tt := range map[string]struct {
+		resp hooksdk.Response
+		err  error
+		b    *hooktest.Builder
+	}{
+		"error":   {hooksdk.Allow(), errors.New("boom"), hooktest.ApprovalRequested().WithSessionID("s1").WithCommand("a")},
+		"modify":  {hooksdk.Allow().ReplaceField("command", []string{"b", "--safe"}), nil, hooktest.ApprovalRequested().WithSessionID("s1").WithCommand("b")},
+		"no key":  {hooksdk.Deny("x"), nil, hooktest.SessionStart().WithSessionID("s1")},
+		"no sess": {hooksdk.Deny("x"), nil, hooktest.ApprovalRequested().With("session_id", nil).WithCommand("c")},
+	} {
+		decision, handlerErr = tt.resp, tt.err
+		before := calls
+		call(tt.b)
+		call(tt.b)
+		if calls != before+2 {
+			t.Errorf("%s: handler called %d times for two events, want 2", name, calls-before)
+		}
+	}
+	handlerErr = nil
+
+	// Session end forgets the session's decisions, and still reaches the handler.
+	before := calls
+	call(hooktest.SessionEnd().WithSessionID("s1"))
+	if calls != before+1 {
+		t.Error("session-end didn't reach the handler")
+	}
+	decision = hooksdk.Allow()
+	if resp := call(sudo("s1")); resp.Decision != hooksdk.DecisionAllow || calls != before+2 {
+		t.Errorf("after session end: %+v, want the handler's allow", resp)
+	}
+	if resp := call(sudo("s2")); resp.Decision != hooksdk.DecisionDeny {
+		t.Errorf("session end of s1 forgot s2: %+v", resp)
+	}
+}
+
+func TestMiddlewareQuestions(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	calls := 0
+	var question hooksdk.Question
+	h := decisioncache.Middleware(s, decisioncache.CommandKey, 0)(func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		calls++
+		return hooksdk.AskQuestion(question), nil
+	})
+	deploy := func(session string) *hooktest.Builder {
+		return hooktest.ApprovalRequested().WithSessionID(session).WithCommand("make deploy")
+	}
+	call := func(b *hooktest.Builder) hooksdk.Response {
+		t.Helper()
+		resp, err := h(context.Background(), b.Build())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	answer := func(b *hooktest.Builder, questionID, option string) *hooktest.Builder {
+		o, _ := hooksdk.Question{Options: hooksdk.DefaultOptions()}.Option(option)
+		return b.With(hooksdk.QuestionAnswerField, hooksdk.QuestionAnswer{QuestionID: questionID, Option: o})
+	}
+
+	// The question gets the event's key as its id, and isn't remembered as an allow.
+	question = hooksdk.Question{Title: "Deploy?", Options: hooksdk.DefaultOptions()}
+	resp := call(deploy("s1"))
+	key := decisioncache.CommandKey(deploy("s1").Build())
+	if resp.Decision != hooksdk.DecisionAsk || resp.Question == nil || resp.Question.ID != key {
+		t.Fatalf("response = %+v, want a question with id %q", resp, key)
+	}
+	if question.ID != "" {
+		t.Error("the handler's question was changed")
+	}
+	call(deploy("s1"))
+	if calls != 2 {
+		t.Errorf("handler called %d times, want an ask each time", calls)
+	}
+
+	// "Allow once" holds only for the event that carries it.
+	call(answer(deploy("s1"), key, hooksdk.OptionAllowOnce))
+	call(deploy("s1"))
+	if calls != 4 {
+		t.Errorf("after allow once: %d calls, want 4", calls)
+	}
+
+	// "Allow for session" is remembered for the question's key, from the event that echoes it on.
+	if resp := call(answer(deploy("s1"), key, hooksdk.OptionAllowSession)); resp.Decision != hooksdk.DecisionAllow || calls != 4 {
+		t.Errorf("echoed allow for session: %+v (%d calls)", resp, calls)
+	}
+	if resp := call(deploy("s1")); resp.Decision != hooksdk.DecisionAllow || calls != 4 {
+		t.Errorf("after allow for session: %+v (%d calls)", resp, calls)
+	}
+	if d, ok := lookup(t, s, "s1", key); !ok || d != hooksdk.DecisionAllow {
+		t.Errorf("stored decision = %q, %v", d, ok)
+	}
+	// Other sessions are still asked.
+	if resp := call(deploy("s2")); resp.Decision != hooksdk.DecisionAsk || calls != 5 {
+		t.Errorf("another session: %+v (%d calls)", resp, calls)
+	}
+
+	// An id the handler set is kept, and an answer to it remembers a session-scoped deny too.
+	question.ID = "deploy-prod"
+	if resp := call(deploy("s2")); resp.Question == nil || resp.Question.ID != "deploy-prod" {
+		t.Errorf("question with an id = %+v", resp.Question)
+	}
+	never := hooksdk.QuestionOption{ID: "never", Label: "Not this session", Decision: hooksdk.DecisionDeny, Scope: hooksdk.ScopeSession}
+	call(hooktest.SessionStart().WithSessionID("s2").With(hooksdk.QuestionAnswerField, hooksdk.QuestionAnswer{QuestionID: "deploy-prod", Option: never}))
+	if d, ok := lookup(t, s, "s2", "deploy-prod"); !ok || d != hooksdk.DecisionDeny {
+		t.Errorf("stored decision for deploy-prod = %q, %v", d, ok)
+	}
+
+	// Answers without a question id, a session, or an allow or deny aren't remembered.
+	bogus := hooksdk.QuestionOption{ID: "maybe", Decision: hooksdk.DecisionAsk, Scope: hooksdk.ScopeSession}
+	for name, b := range map[string]*hooktest.Builder{
+		"no question id": answer(hooktest.SessionStart().WithSessionID("s3"), "", hooksdk.OptionAllowSession),
+		"no session":     answer(hooktest.SessionStart().With("session_id", nil), "q3", hooksdk.OptionAllowSession),
+		"ask decision":   hooktest.SessionStart().WithSessionID("s3").With(hooksdk.QuestionAnswerField, hooksdk.QuestionAnswer{QuestionID: "q3", Option: bogus}),
+	} {
+		call(b)
+		for _, k := range []string{"", "q3"} {
+			if d, ok := lookup(t, s, "s3", k); ok {
+				t.Errorf("%s: remembered %q for %q", name, d, k)
+			}
+		}
+	}
+}
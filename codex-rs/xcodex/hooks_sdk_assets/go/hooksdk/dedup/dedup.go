@@ -0,0 +1,128 @@
+// Package dedup suppresses events that repeat one of the last few events, across hook
+// invocations.
+//
+// Each event is hashed after dropping fields that differ between otherwise identical events
+// (by default `event_id` and `timestamp`). The hashes of the last Window events are kept in a
+// hooksdk/state store, so the check works even though every event runs in a new process.
+//
+//	d := dedup.New(logPath+".dedup.json", 8)
+//	dup, summary, err := d.Check(payload.RawPayload)
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/canonicaljson"
+	"example.com/xcodex/hooks-sdk/hooksdk/state"
+)
+
+// DefaultIgnoreFields are the fields New ignores when comparing events.
+var DefaultIgnoreFields = []string{"event_id", "timestamp"}
+
+// DefaultSummaryEvery is how many consecutive suppressions New allows before reporting them.
+const DefaultSummaryEvery = 100
+
+// SummaryType is the `type` of a Summary.
+const SummaryType = "dedup_summary"
+
+// windowKey is the store's one key, holding the window.
+const windowKey = "window"
+
+// Summary reports how many events were suppressed since the last summary, so a log shows that
+// data was dropped rather than silently losing it.
+type Summary struct {
+	Type       string `json:"type"`
+	Suppressed int    `json:"suppressed"`
+}
+
+// Deduper decides whether an event repeats one of the previous Window events.
+type Deduper struct {
+	// StatePath is the sidecar store (see hooksdk/state) holding the recent hashes and the pending
+	// suppression count.
+	StatePath string
+	// Window is how many previous events an event is compared against.
+	Window int
+	// IgnoreFields are dot paths (see hooksdk.Project) left out of the comparison.
+	IgnoreFields []string
+	// SummaryEvery reports a run of suppressions once it reaches this many, even if no new event
+	// ends it. Zero reports only when a different event arrives.
+	SummaryEvery int
+}
+
+// New returns a Deduper with the default ignore fields and summary interval.
+func New(statePath string, window int) *Deduper {
+	return &Deduper{
+		StatePath:    statePath,
+		Window:       window,
+		IgnoreFields: DefaultIgnoreFields,
+		SummaryEvery: DefaultSummaryEvery,
+	}
+}
+
+type window struct {
+	Hashes     []string `json:"hashes"`
+	Suppressed int      `json:"suppressed"`
+}
+
+// Check records payload and reports whether it duplicates one of the previous Window events.
+//
+// summary is non-nil when suppressed events should be reported now: either payload is a new event
+// ending a run of duplicates (write the summary before the event), or the run just reached
+// SummaryEvery. A missing or corrupt state file counts as an empty window.
+func (d *Deduper) Check(payload map[string]any) (duplicate bool, summary *Summary, err error) {
+	if d.Window <= 0 {
+		return false, nil, nil
+	}
+	hash, err := d.Hash(payload)
+	if err != nil {
+		return false, nil, err
+	}
+
+	store := &state.Store{Path: d.StatePath}
+	err = store.Update(windowKey, func(e *state.Entry) error {
+		var w window
+		if _, err := e.Decode(&w); err != nil {
+			w = window{}
+		}
+		for _, h := range w.Hashes {
+			if h == hash {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			w.Suppressed++
+			if d.SummaryEvery > 0 && w.Suppressed >= d.SummaryEvery {
+				summary = &Summary{Type: SummaryType, Suppressed: w.Suppressed}
+				w.Suppressed = 0
+			}
+		} else if w.Suppressed > 0 {
+			summary = &Summary{Type: SummaryType, Suppressed: w.Suppressed}
+			w.Suppressed = 0
+		}
+
+		w.Hashes = append(w.Hashes, hash)
+		if len(w.Hashes) > d.Window {
+			w.Hashes = w.Hashes[len(w.Hashes)-d.Window:]
+		}
+		return e.Set(w, 0)
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return duplicate, summary, nil
+}
+
+// Hash returns the hash Check compares: a SHA-256 of payload's canonical JSON (see
+// canonicaljson) without the IgnoreFields, so payloads that differ only in key order or number
+// formatting hash the same.
+func (d *Deduper) Hash(payload map[string]any) (string, error) {
+	data, err := canonicaljson.Marshal(hooksdk.Omit(hooksdk.HookPayloadJSON(payload), d.IgnoreFields))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16]), nil
+}
@@ -0,0 +1,195 @@
+package dedup_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/dedup"
+)
+
+// TestMain lets the tests run this binary as a hook process: with DEDUP_TEST_STATE=<path> it
+// checks the payload in DEDUP_TEST_PAYLOAD against a window of 4 and prints the result.
+func TestMain(m *testing.M) {
+	if path := os.Getenv("DEDUP_TEST_STATE"); path != "" {
+		var payload map[string]any
+		if err := json.Unmarshal([]byte(os.Getenv("DEDUP_TEST_PAYLOAD")), &payload); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		dup, summary, err := dedup.New(path, 4).Check(payload)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(dup)
+		if summary != nil {
+			fmt.Printf(" %d", summary.Suppressed)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// checkInProcess runs Check for payload in a new process, as each hook invocation is, and returns
+// what it printed: whether the event is a duplicate, and the suppression count of any summary.
+func checkInProcess(t *testing.T, statePath, payload string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "DEDUP_TEST_STATE="+statePath, "DEDUP_TEST_PAYLOAD="+payload)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestCheckAcrossProcesses(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "hooks.jsonl.dedup.json")
+	steps := []struct {
+		payload, want string
+	}{
+		{`{"type":"notification","message":"hi","timestamp":"t1","event_id":"e1"}`, "false"},
+		// Only the ignored fields differ.
+		{`{"type":"notification","message":"hi","timestamp":"t2","event_id":"e2"}`, "true"},
+		{`{"message":"hi","type":"notification","timestamp":"t3","event_id":"e3"}`, "true"},
+		// A different event ends the run and reports it.
+		{`{"type":"notification","message":"bye","timestamp":"t4","event_id":"e4"}`, "false 2"},
+		// "hi" is still in the window of 4.
+		{`{"type":"notification","message":"hi","timestamp":"t5","event_id":"e5"}`, "true"},
+	}
+	for i, step := range steps {
+		if got := checkInProcess(t, statePath, step.payload); got != step.want {
+			t.Errorf("event %d: Check = %q, want %q", i+1, got, step.want)
+		}
+	}
+}
+
+func TestCheckWindow(t *testing.T) {
+	d := dedup.New(filepath.Join(t.TempDir(), "state.json"), 2)
+	d.SummaryEvery = 0
+	check := func(msg string) bool {
+		dup, _, err := d.Check(map[string]any{"message": msg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dup
+	}
+	for _, msg := range []string{"a", "b", "c"} {
+		if check(msg) {
+			t.Errorf("%s: first occurrence is a duplicate", msg)
+		}
+	}
+	// "a" has left the window of 2; "c" hasn't.
+	if check("a") {
+		t.Errorf("a: duplicate of an event outside the window")
+	}
+	if !check("c") {
+		t.Errorf("c: not a duplicate of an event in the window")
+	}
+}
+
+func TestCheckIgnoreFields(t *testing.T) {
+	d := dedup.New(filepath.Join(t.TempDir(), "state.json"), 8)
+	d.IgnoreFields = []string{"tool.started_at"}
+	first := map[string]any{"tool": map[string]any{"name": "shell", "started_at": "1"}, "timestamp": "t1"}
+	second := map[string]any{"tool": map[string]any{"name": "shell", "started_at": "2"}, "timestamp": "t1"}
+	third := map[string]any{"tool": map[string]any{"name": "shell", "started_at": "3"}, "timestamp": "t2"}
+	for i, tt := range []struct {
+		payload map[string]any
+		want    bool
+	}{{first, false}, {second, true}, {third, false}} {
+		dup, _, err := d.Check(tt.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dup != tt.want {
+			t.Errorf("event %d: duplicate = %v, want %v", i+1, dup, tt.want)
+		}
+	}
+	// The payloads themselves are left as they were.
+	if first["tool"].(map[string]any)["started_at"] != "1" {
+		t.Errorf("Check modified its payload")
+	}
+}
+
+func TestCheckSummaryEvery(t *testing.T) {
+	d := dedup.New(filepath.Join(t.TempDir(), "state.json"), 4)
+	d.SummaryEvery = 3
+	var summaries []int
+	for i := 0; i < 8; i++ {
+		_, summary, err := d.Check(map[string]any{"message": "same"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary != nil {
+			if summary.Type != dedup.SummaryType {
+				t.Errorf("summary type = %q", summary.Type)
+			}
+			summaries = append(summaries, summary.Suppressed)
+		}
+	}
+	// 7 duplicates: reported at 3 and 6, with 1 still pending.
+	if fmt.Sprint(summaries) != "[3 3]" {
+		t.Errorf("summaries = %v, want [3 3]", summaries)
+	}
+}
+
+func TestCheckCorruptState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(statePath, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d := dedup.New(statePath, 4)
+	if dup, _, err := d.Check(map[string]any{"message": "x"}); dup || err != nil {
+		t.Errorf("Check with a corrupt state = %v, %v; want a fresh window", dup, err)
+	}
+	data, _ := os.ReadFile(statePath)
+	if !strings.Contains(string(data), `"hashes"`) {
+		t.Errorf("state file not rewritten: %s", data)
+	}
+}
+
+func TestHashCanonical(t *testing.T) {
+	// Key order and the way a number is written don't change the hash; the values do.
+	d := dedup.New(filepath.Join(t.TempDir(), "state.json"), 4)
+	decode := func(s string) map[string]any {
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		var m map[string]any
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	hash := func(m map[string]any) string {
+		h, err := d.Hash(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	want := hash(decode(`{"type":"x","usage":{"tokens":100,"ratio":0.5},"tags":["a","b"]}`))
+	for _, same := range []string{
+		`{"tags":["a","b"],"usage":{"ratio":0.50,"tokens":1e2},"type":"x"}`,
+		`{ "usage" : { "tokens" : 100.0, "ratio" : 5E-1 }, "type" : "x", "tags" : [ "a", "b" ] }`,
+	} {
+		if got := hash(decode(same)); got != want {
+			t.Errorf("Hash(%s) = %s, want %s", same, got, want)
+		}
+	}
+	if got := hash(map[string]any{"type": "x", "usage": map[string]any{"tokens": 100, "ratio": 0.5}, "tags": []any{"a", "b"}}); got != want {
+		t.Errorf("Hash of Go values = %s, want %s", got, want)
+	}
+	if got := hash(decode(`{"type":"x","usage":{"tokens":101,"ratio":0.5},"tags":["a","b"]}`)); got == want {
+		t.Error("different payloads hash the same")
+	}
+	if got := hash(decode(`{"type":"x","usage":{"tokens":100,"ratio":0.5},"tags":["b","a"]}`)); got == want {
+		t.Error("array order doesn't change the hash")
+	}
+}
@@ -0,0 +1,210 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// DetachTimeout bounds the work of a detached hook process; past it the process logs a timeout and
+// exits.
+const DetachTimeout = time.Minute
+
+// ErrDetachUnsupported is returned by Detach on platforms where a process can't outlive its
+// parent's session (it ran the work synchronously instead).
+var ErrDetachUnsupported = errors.New("detaching is not supported on this platform")
+
+// detachedEnv marks the background copy of a hook started by Detach; its value is the spooled
+// envelope the copy reads its payload from.
+const detachedEnv = "CODEX_HOOK_DETACHED"
+
+// maxDetachLogBytes is the size at which the detach log is rotated (one old generation is kept).
+const maxDetachLogBytes = 1 << 20
+
+// runState is what Detach needs to know about the event Run is handling. It is only recorded when
+// Run owns the process's stdin and stdout.
+type runState struct {
+	payload    *HookPayload
+	outputPath string
+}
+
+var currentRun atomic.Pointer[runState]
+
+// Detach lets a hook acknowledge the event at once and do slow work (a webhook delivery, an
+// upload) after the host has stopped waiting. Call it from a handler run by Run:
+//
+//	func handle(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+//		err := hooksdk.Detach(func() { deliver(ctx, p) })
+//		if err != nil {
+//			hooklog.Debugf("ran synchronously: %v", err)
+//		}
+//		return hooksdk.Allow(), nil
+//	}
+//
+// Detach starts a copy of the hook in the background, writes Allow as the response, closes stdout,
+// and exits the process; it doesn't return. The copy gets the same payload and runs the handler
+// again, so code before the Detach call runs twice and must not have side effects. Its Detach call
+// runs work (for at most DetachTimeout) and exits. Output of the work, and a record of how it
+// ended, go to DetachLogPath.
+//
+// When the hook can't be detached (outside Run, e.g. under hooktest or the hook daemon; on
+// platforms without a way to detach; or if the copy can't be started), work runs synchronously and
+// Detach returns nil or the reason, and the handler's response is written as usual.
+func Detach(work func()) error {
+	if spool, ok := os.LookupEnv(detachedEnv); ok {
+		runDetached(spool, work)
+	}
+	rs := currentRun.Load()
+	if rs == nil {
+		work()
+		return nil
+	}
+	if err := startDetached(rs); err != nil {
+		work()
+		return err
+	}
+	if err := writeResponseOutput(os.Stdout, os.Stderr, rs.outputPath, "", rs.payload.InvocationID(), false, Allow()); err != nil {
+		writeErrorLine(os.Stderr, "write_response", err)
+	}
+	os.Stdout.Close()
+	os.Exit(ExitOK)
+	return nil
+}
+
+// DetachLogPath returns the log of detached work: `hooks/detached/<hook name>.log` under
+// CODEX_HOME.
+func DetachLogPath() string {
+	name := hooklog.HookName()
+	if name == "" {
+		name = "hook"
+	}
+	return Environ().Path("hooks", "detached", lockFileName(name)+".log")
+}
+
+// startDetached spools the payload and starts the background copy of this process.
+func startDetached(rs *runState) error {
+	attr, ok := detachAttr()
+	if !ok {
+		return ErrDetachUnsupported
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("detach: %w", err)
+	}
+	logPath := DetachLogPath()
+	dir := filepath.Dir(logPath)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("detach: %w", err)
+	}
+	spool, err := spoolEnvelope(dir, rs.payload)
+	if err != nil {
+		return fmt.Errorf("detach: %w", err)
+	}
+	started := false
+	defer func() {
+		if !started {
+			os.Remove(spool)
+		}
+	}()
+	stdin, err := os.Open(spool)
+	if err != nil {
+		return fmt.Errorf("detach: %w", err)
+	}
+	defer stdin.Close()
+	if info, err := os.Stat(logPath); err == nil && info.Size() > maxDetachLogBytes {
+		os.Rename(logPath, logPath+".1")
+	}
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("detach: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), detachedEnv+"="+spool)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, logFile, logFile
+	cmd.SysProcAttr = attr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("detach: %w", err)
+	}
+	started = true
+	return cmd.Process.Release()
+}
+
+// spoolEnvelope writes the payload as an inline envelope for the background copy to read on
+// stdin, signed with the first key in SecretEnv when there is one so RequireSignature still holds,
+// and with the payload's invocation id so the copy's logs carry it too.
+func spoolEnvelope(dir string, p *HookPayload) (string, error) {
+	raw, err := json.Marshal(p.RawPayload)
+	if err != nil {
+		return "", err
+	}
+	env := struct {
+		Payload      json.RawMessage `json:"payload"`
+		Signature    string          `json:"signature,omitempty"`
+		InvocationID string          `json:"hook_invocation_id,omitempty"`
+	}{Payload: raw, InvocationID: p.InvocationID()}
+	if keys := signatureKeys(Environ()); len(keys) > 0 {
+		env.Signature = SignPayload(keys[0], raw)
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, "payload-*.json")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// runDetached runs work in the background copy and exits with its outcome.
+func runDetached(spool string, work func()) {
+	os.Unsetenv(detachedEnv)
+	os.Remove(spool)
+	if rs := currentRun.Load(); rs != nil {
+		hooklog.Bind(rs.payload)
+	}
+	start := time.Now()
+	done := make(chan map[string]any, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- map[string]any{"panic": fmt.Sprint(r), "stack": string(debug.Stack())}
+			}
+		}()
+		work()
+		done <- nil
+	}()
+	timer := time.NewTimer(DetachTimeout)
+	select {
+	case failure := <-done:
+		if failure != nil {
+			failure["duration_ms"] = time.Since(start).Milliseconds()
+			hooklog.Log(hooklog.LevelError, "detached work panicked", failure)
+			os.Exit(ExitError)
+		}
+		hooklog.Log(hooklog.LevelInfo, "detached work finished", map[string]any{
+			"duration_ms": time.Since(start).Milliseconds(),
+		})
+		os.Exit(ExitOK)
+	case <-timer.C:
+		hooklog.Log(hooklog.LevelError, "detached work timed out", map[string]any{
+			"timeout_ms": DetachTimeout.Milliseconds(),
+		})
+		os.Exit(ExitError)
+	}
+}
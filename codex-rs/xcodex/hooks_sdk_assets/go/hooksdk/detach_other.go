@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package hooksdk
+
+import "syscall"
+
+func detachAttr() (*syscall.SysProcAttr, bool) {
+	return nil, false
+}
@@ -0,0 +1,158 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// detachWork is how long the detached work of detachMain takes.
+const detachWork = 1500 * time.Millisecond
+
+// detachMain is the hook HOOKSDK_TEST_DETACH runs: a handler that detaches work writing the
+// session id to that file after detachWork, or that panics when the session id is "panic".
+func detachMain(marker string) {
+	hooksdk.Run(func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		hooksdk.Detach(func() {
+			if p.SessionID() == "panic" {
+				panic("detached boom")
+			}
+			time.Sleep(detachWork)
+			os.WriteFile(marker, []byte(p.SessionID()), 0o644)
+		})
+		// Detach only returns when it ran the work synchronously.
+		return hooksdk.Deny("not detached"), nil
+	})
+}
+
+// runDetaching runs detachMain on a payload for session, with CODEX_HOME set to home, and returns
+// its response and how long it took.
+func runDetaching(t *testing.T, home, marker, session string) (hooksdk.Response, time.Duration) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "HOOKSDK_TEST_DETACH="+marker, "CODEX_HOME="+home, "CODEX_HOOK_NAME=detacher",
+		"CODEX_HOOK_LOG_FORMAT=json", hooksdk.SecretEnv+"=")
+	cmd.Stdin = bytes.NewReader(hooktest.ToolCallFinished().WithSessionID(session).Bytes())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	start := time.Now()
+	out, err := cmd.Output()
+	took := time.Since(start)
+	if err != nil {
+		t.Fatalf("hook: %v\n%s", err, stderr.String())
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out, &resp); err != nil {
+		t.Fatalf("response %q: %v", out, err)
+	}
+	return resp, took
+}
+
+// waitFor polls until path has content, for up to timeout.
+func waitFor(t *testing.T, path string, timeout time.Duration) string {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		if data, err := os.ReadFile(path); err == nil && len(data) > 0 {
+			return string(data)
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not written within %v", path, timeout)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestDetach(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("detached processes are exercised on Linux and macOS")
+	}
+	home := t.TempDir()
+	marker := filepath.Join(t.TempDir(), "done")
+	resp, took := runDetaching(t, home, marker, "s-detach")
+	if resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("response = %+v, want the allow Detach writes", resp)
+	}
+	if took >= detachWork {
+		t.Errorf("hook took %v, want it to exit before its %v of work", took, detachWork)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("work finished before the hook exited")
+	}
+
+	// The background copy still finishes the work, and logs it.
+	if got := waitFor(t, marker, 10*time.Second); got != "s-detach" {
+		t.Errorf("work wrote %q, want the payload's session id", got)
+	}
+	logPath := filepath.Join(home, "hooks", "detached", "detacher.log")
+	if got := waitFor(t, logPath, 5*time.Second); !strings.Contains(got, "detached work finished") || !strings.Contains(got, "s-detach") {
+		t.Errorf("detach log = %q", got)
+	}
+	// The spooled payload is removed.
+	spooled, _ := filepath.Glob(filepath.Join(home, "hooks", "detached", "payload-*.json"))
+	if len(spooled) != 0 {
+		t.Errorf("spooled payloads left behind: %v", spooled)
+	}
+}
+
+func TestDetachPanicLogged(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("detached processes are exercised on Linux and macOS")
+	}
+	home := t.TempDir()
+	if resp, _ := runDetaching(t, home, filepath.Join(t.TempDir(), "done"), "panic"); resp.Decision != hooksdk.DecisionAllow {
+		t.Errorf("response = %+v, want allow", resp)
+	}
+	logPath := filepath.Join(home, "hooks", "detached", "detacher.log")
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		data, _ := os.ReadFile(logPath)
+		if strings.Contains(string(data), "detached work panicked") {
+			if !strings.Contains(string(data), "detached boom") {
+				t.Errorf("detach log = %s", data)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no panic record in the detach log: %q", data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestDetachOutsideRun(t *testing.T) {
+	// Under RunIO (as under hooktest), Detach runs the work synchronously.
+	ran := false
+	res := hooktest.RunHook(t, func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		if err := hooksdk.Detach(func() { ran = true }); err != nil {
+			return hooksdk.Response{}, err
+		}
+		return hooksdk.Deny("sync"), nil
+	}, hooktest.SessionStart().Bytes())
+	if !ran || res.Response.Reason != "sync" {
+		t.Errorf("Detach under RunIO: ran = %v, response %+v", ran, res.Response)
+	}
+
+	ran = false
+	if err := hooksdk.Detach(func() { ran = true }); err != nil || !ran {
+		t.Errorf("Detach outside any hook: ran = %v, error %v", ran, err)
+	}
+}
+
+func TestDetachLogPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	if got := hooksdk.DetachLogPath(); filepath.Dir(got) != filepath.Join(home, "hooks", "detached") || !strings.HasSuffix(got, ".log") {
+		t.Errorf("DetachLogPath = %s", got)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package hooksdk
+
+import "syscall"
+
+// detachAttr starts the background copy in a new session, so it outlives the hook and isn't
+// killed with the hook's process group.
+func detachAttr() (*syscall.SysProcAttr, bool) {
+	return &syscall.SysProcAttr{Setsid: true}, true
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package hooksdk
+
+import "syscall"
+
+// detachedProcess is DETACHED_PROCESS: the child gets no console of its own or of its parent.
+const detachedProcess = 0x00000008
+
+// detachAttr starts the background copy without a console and in its own process group, so it
+// outlives the hook and doesn't receive the console's Ctrl+C.
+func detachAttr() (*syscall.SysProcAttr, bool) {
+	return &syscall.SysProcAttr{CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP}, true
+}
@@ -0,0 +1,396 @@
+// Package diffview renders the file changes of a tool call as a unified diff, for hooks that show
+// a change to a human: a notification, a chat message, a deny reason.
+//
+//	text, err := diffview.Render(payload, diffview.Options{MaxBytes: 2000})
+//	if errors.Is(err, diffview.ErrNoChanges) { ...not a file change... }
+//
+// It reads patches (apply_patch or unified diffs), whole-file writes, and edits from tool_input
+// (see Parse), and shows created, deleted, renamed, and binary files the way git does. The hunks
+// of apply_patch patches and edits don't say where in the file they are, so they have `@@`
+// headers without line numbers.
+package diffview
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// ErrNoChanges is returned by Render for a payload whose tool_input changes no files.
+var ErrNoChanges = errors.New("diffview: no file changes in the payload")
+
+// DefaultContext is the number of unchanged lines shown around each change when
+// Options.Context is 0, as in `diff -u`.
+const DefaultContext = 3
+
+// Kind is what a change does to a file.
+type Kind string
+
+const (
+	KindModify Kind = "modify"
+	KindCreate Kind = "create"
+	KindDelete Kind = "delete"
+	// KindRename moves a file, maybe changing it too.
+	KindRename Kind = "rename"
+)
+
+// Op is the kind of a diff line, also its prefix in a unified diff.
+type Op byte
+
+const (
+	OpContext Op = ' '
+	OpDelete  Op = '-'
+	OpInsert  Op = '+'
+)
+
+// File is the change to one file.
+type File struct {
+	// OldPath is "" for a created file, and NewPath is "" for a deleted one.
+	OldPath string
+	NewPath string
+	Kind    Kind
+	// Binary is set for binary patches and for content with NUL bytes or invalid UTF-8, whose
+	// lines aren't shown; Hunks is empty then.
+	Binary bool
+	Hunks  []Hunk
+}
+
+// Hunk is a run of lines of a change. Hunks from patches are rendered with the context they
+// carry, up to Options.Context lines.
+type Hunk struct {
+	// OldStart and NewStart are the line numbers of the hunk's first old and new line (the line an
+	// empty side is inserted at). They are only meaningful when Numbered is set: apply_patch
+	// chunks and edits don't say where they are in the file.
+	OldStart, NewStart int
+	Numbered           bool
+	// Header is the text after the `@@` line's ranges, e.g. the function a git hunk is in or an
+	// apply_patch chunk's anchor line.
+	Header string
+	Lines  []Line
+}
+
+// Line is one line of a hunk.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Options control rendering.
+type Options struct {
+	// Context is the number of unchanged lines shown around each change: 0 means DefaultContext,
+	// and a negative value shows none.
+	Context int
+	// MaxBytes bounds the output; 0 means no bound. Past it, lines are elided from the end of each
+	// file's hunks, and files from the end, with a marker saying how many, so every file keeps
+	// its header as long as the headers fit.
+	MaxBytes int
+	// Color adds ANSI colors, for terminals: bold headers, cyan hunk headers, red deletions, and
+	// green insertions. The escape codes count toward MaxBytes.
+	Color bool
+	// Before, when set, returns a file's content before the change, e.g. os.ReadFile on a
+	// tool-call-started event, which runs before the file is written. Whole-file writes and
+	// deletions are then shown against it, and edits with line numbers. Render passes paths
+	// joined to the session's cwd when they are relative.
+	Before func(path string) (string, bool)
+}
+
+// Render renders the file changes of p's tool_input as a unified diff. Paths inside the session's
+// cwd are shown relative to it. It fails with ErrNoChanges when there are none.
+func Render(p *hooksdk.HookPayload, opts Options) (string, error) {
+	cwd := p.WorkingDir()
+	var prev before
+	if opts.Before != nil {
+		prev = func(path string) (string, bool) {
+			if cwd != "" && !filepath.IsAbs(path) {
+				path = filepath.Join(cwd, path)
+			}
+			return opts.Before(path)
+		}
+	}
+	files := parse(p.ToolInput, prev)
+	if len(files) == 0 {
+		return "", ErrNoChanges
+	}
+	if cwd != "" {
+		for i := range files {
+			files[i].OldPath = relPath(cwd, files[i].OldPath)
+			files[i].NewPath = relPath(cwd, files[i].NewPath)
+		}
+	}
+	return RenderFiles(files, opts), nil
+}
+
+// relPath returns path relative to dir, in slash form, when it is inside it.
+func relPath(dir, path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// ANSI escapes used with Options.Color.
+const (
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+	ansiReset  = "\x1b[0m"
+)
+
+// RenderFiles renders files as a unified diff.
+func RenderFiles(files []File, opts Options) string {
+	context := opts.Context
+	if context == 0 {
+		context = DefaultContext
+	} else if context < 0 {
+		context = 0
+	}
+	r := renderer{color: opts.Color}
+	rendered := make([]renderedFile, len(files))
+	for i, f := range files {
+		rendered[i] = r.file(f, context)
+	}
+	return r.join(rendered, opts.MaxBytes)
+}
+
+type renderer struct{ color bool }
+
+// renderedFile is a file's header and body lines, without newlines.
+type renderedFile struct {
+	header, body []string
+}
+
+func (r renderer) paint(color, s string) string {
+	if !r.color || s == "" {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+func (r renderer) file(f File, context int) renderedFile {
+	oldName, newName := "a/"+f.OldPath, "b/"+f.NewPath
+	if f.OldPath == "" {
+		oldName = "/dev/null"
+	}
+	if f.NewPath == "" {
+		newName = "/dev/null"
+	}
+	gitOld, gitNew := f.OldPath, f.NewPath
+	if gitOld == "" {
+		gitOld = gitNew
+	}
+	if gitNew == "" {
+		gitNew = gitOld
+	}
+
+	var out renderedFile
+	out.header = append(out.header, r.paint(ansiBold, "diff --git a/"+gitOld+" b/"+gitNew))
+	if f.Kind == KindRename {
+		out.header = append(out.header, r.paint(ansiBold, "rename from "+f.OldPath), r.paint(ansiBold, "rename to "+f.NewPath))
+	}
+	switch {
+	case f.Binary:
+		out.header = append(out.header, "Binary files "+oldName+" and "+newName+" differ")
+		return out
+	case f.Kind == KindRename && len(f.Hunks) == 0:
+		return out
+	}
+	out.header = append(out.header, r.paint(ansiBold, "--- "+oldName), r.paint(ansiBold, "+++ "+newName))
+	for _, h := range f.Hunks {
+		for _, sub := range withContext(h, context) {
+			out.body = append(out.body, r.paint(ansiCyan, hunkLine(sub)))
+			for _, l := range sub.Lines {
+				text := string(l.Op) + l.Text
+				switch l.Op {
+				case OpDelete:
+					text = r.paint(ansiRed, text)
+				case OpInsert:
+					text = r.paint(ansiGreen, text)
+				}
+				out.body = append(out.body, text)
+			}
+		}
+	}
+	return out
+}
+
+// withContext splits h into the hunks that show its changes with at most context unchanged lines
+// around each, merging changes closer than that.
+func withContext(h Hunk, context int) []Hunk {
+	var out []Hunk
+	oldN, newN := h.OldStart, h.NewStart
+	n := len(h.Lines)
+	for i := 0; i < n; {
+		// Find the next change, and the end of the run of changes each within 2*context
+		// unchanged lines of the next.
+		first := i
+		for first < n && h.Lines[first].Op == OpContext {
+			first++
+		}
+		if first == n {
+			break
+		}
+		last := first
+		for j := first + 1; j < n; j++ {
+			if h.Lines[j].Op != OpContext {
+				if j-last-1 > 2*context {
+					break
+				}
+				last = j
+			}
+		}
+		start := max(first-context, i)
+		end := min(last+context+1, n)
+		for _, l := range h.Lines[i:start] {
+			oldN, newN = advance(l, oldN, newN)
+		}
+		sub := Hunk{OldStart: oldN, NewStart: newN, Numbered: h.Numbered, Header: h.Header, Lines: h.Lines[start:end]}
+		for _, l := range sub.Lines {
+			oldN, newN = advance(l, oldN, newN)
+		}
+		out = append(out, sub)
+		i = end
+	}
+	return out
+}
+
+func advance(l Line, oldN, newN int) (int, int) {
+	if l.Op != OpInsert {
+		oldN++
+	}
+	if l.Op != OpDelete {
+		newN++
+	}
+	return oldN, newN
+}
+
+// hunkLine returns the `@@` line of h.
+func hunkLine(h Hunk) string {
+	line := "@@"
+	if h.Numbered {
+		oldCount, newCount := 0, 0
+		for _, l := range h.Lines {
+			oldCount, newCount = advance(l, oldCount, newCount)
+		}
+		line += " -" + hunkRange(h.OldStart, oldCount) + " +" + hunkRange(h.NewStart, newCount) + " @@"
+	}
+	if h.Header != "" {
+		line += " " + h.Header
+	}
+	return line
+}
+
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return strconv.Itoa(start-1) + ",0"
+	case 1:
+		return strconv.Itoa(start)
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(count)
+}
+
+// join renders the files, eliding lines to fit maxBytes: every file keeps its header while the
+// headers fit, and the body lines are kept in order until the bytes left run out.
+func (r renderer) join(files []renderedFile, maxBytes int) string {
+	size := func(lines []string) int {
+		n := 0
+		for _, l := range lines {
+			n += len(l) + 1
+		}
+		return n
+	}
+	total := 0
+	for _, f := range files {
+		total += size(f.header) + size(f.body)
+	}
+	var b strings.Builder
+	if maxBytes <= 0 || total <= maxBytes {
+		for _, f := range files {
+			writeLines(&b, f.header)
+			writeLines(&b, f.body)
+		}
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+
+	// Every file's header is kept, with room for a marker in place of its body, which is at least
+	// as long as the one written; what is left goes to body lines, in order. When the headers
+	// don't fit, the files past the last that does are elided.
+	reserve := make([]int, len(files))
+	budget := maxBytes
+	keep, cut := len(files), false
+	for i, f := range files {
+		if len(f.body) > 0 {
+			reserve[i] = len(r.linesMarker(len(f.body))) + 1
+		}
+		budget -= size(f.header) + reserve[i]
+	}
+	if budget < 0 {
+		budget = maxBytes
+		for i, f := range files {
+			cost := size(f.header) + reserve[i]
+			if cost+len(r.filesMarker(len(files)-i))+1 > budget {
+				keep = i
+				break
+			}
+			budget -= cost
+		}
+		cut = true
+	}
+	for i, f := range files[:keep] {
+		writeLines(&b, f.header)
+		if rest := size(f.body); !cut && rest <= budget+reserve[i] {
+			writeLines(&b, f.body)
+			budget += reserve[i] - rest
+			continue
+		}
+		shown := 0
+		for _, l := range f.body {
+			if cut || len(l)+1 > budget {
+				break
+			}
+			budget -= len(l) + 1
+			shown++
+		}
+		writeLines(&b, f.body[:shown])
+		if shown < len(f.body) {
+			writeLines(&b, []string{r.linesMarker(len(f.body) - shown)})
+		}
+		cut = true
+	}
+	if keep < len(files) {
+		writeLines(&b, []string{r.filesMarker(len(files) - keep)})
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (r renderer) linesMarker(n int) string {
+	return r.paint(ansiYellow, fmt.Sprintf("… %d %s elided", n, plural(n, "line")))
+}
+
+func (r renderer) filesMarker(n int) string {
+	return r.paint(ansiYellow, fmt.Sprintf("… %d more %s elided", n, plural(n, "file")))
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+func writeLines(b *strings.Builder, lines []string) {
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+}
@@ -0,0 +1,171 @@
+package diffview_test
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/diffview"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/<name>.diff, or rewrites it with -update.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".diff")
+	if *update {
+		if err := os.WriteFile(path, []byte(got+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got+"\n" != string(want) {
+		t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+	}
+}
+
+// toolCall is a tool-call-started payload in /work with input.
+func toolCall(input any) *hooksdk.HookPayload {
+	return hooktest.ToolCallStarted().WithCwd("/work").With("tool_input", input).Build()
+}
+
+// numbered returns n lines, "line 1" to "line n", each ending in a newline.
+func numbered(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+// files are the contents Before knows.
+var files = map[string]string{
+	"/work/main.go":    "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n",
+	"/work/old.txt":    "going\ngone\n",
+	"/work/numbers.go": numbered(30),
+}
+
+func beforeFile(path string) (string, bool) {
+	s, ok := files[path]
+	return s, ok
+}
+
+const modifyPatch = `*** Begin Patch
+*** Update File: main.go
+@@ func main() {
+-	println("hi")
++	println("hello")
++	println("world")
+ }
+*** End Patch`
+
+func TestRenderGolden(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input any
+		opts  diffview.Options
+	}{
+		{"modify", map[string]any{"input": modifyPatch}, diffview.Options{}},
+		{"modify_git", `diff --git a/numbers.go b/numbers.go
+index 1111111..2222222 100644
+--- a/numbers.go
++++ b/numbers.go
+@@ -9,7 +9,7 @@ func numbers() {
+ line 9
+ line 10
+ line 11
+-line 12
++line twelve
+ line 13
+ line 14
+ line 15
+`, diffview.Options{}},
+		{"modify_edit", map[string]any{"file_path": "/work/numbers.go", "old_string": "line 12\n", "new_string": "line twelve\n"}, diffview.Options{Before: beforeFile, Context: 1}},
+		{"create", map[string]any{"input": "*** Begin Patch\n*** Add File: docs/new.md\n+# New\n+\n+Text.\n*** End Patch"}, diffview.Options{}},
+		{"create_write", map[string]any{"file_path": "/work/hello.txt", "content": "hello\nworld"}, diffview.Options{}},
+		{"delete", map[string]any{"input": "*** Begin Patch\n*** Delete File: old.txt\n*** End Patch"}, diffview.Options{Before: beforeFile}},
+		{"rename", map[string]any{"input": "*** Begin Patch\n*** Update File: main.go\n*** Move to: cmd/app/main.go\n@@\n-\tprintln(\"hi\")\n+\tprintln(\"hey\")\n*** End Patch"}, diffview.Options{}},
+		{"rename_only", "diff --git a/a.txt b/b.txt\nsimilarity index 100%\nrename from a.txt\nrename to b.txt\n", diffview.Options{}},
+		{"binary", map[string]any{"file_path": "/work/logo.png", "content": "\x89PNG\r\n\x1a\n\x00\x00"}, diffview.Options{}},
+		{"binary_git", "diff --git a/logo.png b/logo.png\nindex 1111111..2222222 100644\nBinary files a/logo.png and b/logo.png differ\n", diffview.Options{}},
+		{"truncated", map[string]any{"file_path": "/work/numbers.go", "content": strings.ReplaceAll(numbered(30), "line", "LINE")}, diffview.Options{Before: beforeFile, MaxBytes: 400}},
+		{"color", map[string]any{"input": modifyPatch}, diffview.Options{Color: true}},
+		{"shell_heredoc", []any{"bash", "-lc", "apply_patch <<'EOF'\n" + modifyPatch + "\nEOF"}, diffview.Options{}},
+	} {
+		input := tt.input
+		if args, ok := input.([]any); ok {
+			input = map[string]any{"command": args}
+		}
+		got, err := diffview.Render(toolCall(input), tt.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		golden(t, tt.name, got)
+	}
+}
+
+func TestRenderTruncatedFiles(t *testing.T) {
+	var patch strings.Builder
+	patch.WriteString("*** Begin Patch\n")
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&patch, "*** Add File: file%02d.txt\n+content of file %d\n", i, i)
+	}
+	patch.WriteString("*** End Patch")
+	p := toolCall(map[string]any{"input": patch.String()})
+	full, err := diffview.Render(p, diffview.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := diffview.Render(p, diffview.Options{MaxBytes: 600})
+	golden(t, "truncated_files", got)
+	if len(got) > 600 || len(got) >= len(full) {
+		t.Errorf("%d bytes of %d, want at most 600", len(got), len(full))
+	}
+}
+
+func TestRenderNoChanges(t *testing.T) {
+	for _, input := range []any{nil, map[string]any{"command": []any{"ls"}}, "not a patch"} {
+		if got, err := diffview.Render(toolCall(input), diffview.Options{}); !errors.Is(err, diffview.ErrNoChanges) {
+			t.Errorf("Render(%v) = %q, %v; want ErrNoChanges", input, got, err)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	for _, tt := range []struct {
+		oldPath, newPath string
+		kind             diffview.Kind
+	}{
+		{"a", "a", diffview.KindModify},
+		{"", "a", diffview.KindCreate},
+		{"a", "", diffview.KindDelete},
+		{"a", "b", diffview.KindRename},
+	} {
+		if f := diffview.Compare(tt.oldPath, tt.newPath, "x\n", "y\n"); f.Kind != tt.kind {
+			t.Errorf("Compare(%q, %q) is a %s, want %s", tt.oldPath, tt.newPath, f.Kind, tt.kind)
+		}
+	}
+	if f := diffview.Compare("a", "a", "same\n", "same\n"); len(f.Hunks) != 0 && len(f.Hunks[0].Lines) != 1 {
+		t.Errorf("unchanged file = %+v", f)
+	}
+	if f := diffview.Compare("a", "a", "ok", "bad \xff"); !f.Binary || len(f.Hunks) != 0 {
+		t.Errorf("invalid UTF-8 = %+v, want binary", f)
+	}
+	// Context -1 shows no unchanged lines.
+	got := diffview.RenderFiles([]diffview.File{diffview.Compare("n", "n", numbered(5), strings.Replace(numbered(5), "line 3", "three", 1))}, diffview.Options{Context: -1})
+	if !strings.HasSuffix(got, "@@ -3 +3 @@\n-line 3\n+three") {
+		t.Errorf("no context:\n%s", got)
+	}
+}
@@ -0,0 +1,110 @@
+package diffview
+
+// maxEdits bounds the line diff: past that many inserted and deleted lines, the changed region is
+// shown as all of its old lines removed and all of its new lines added. That keeps the work (and
+// the trace, which grows with its square) small for rewrites, where a minimal diff isn't more
+// readable anyway.
+const maxEdits = 1000
+
+// diffLines returns the lines of a full-context hunk turning a into b.
+func diffLines(a, b []string) []Line {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	out := make([]Line, 0, len(a)+len(b)-prefix-suffix)
+	for _, text := range a[:prefix] {
+		out = append(out, Line{Op: OpContext, Text: text})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if mid, ok := myers(midA, midB); ok {
+		out = append(out, mid...)
+	} else {
+		for _, text := range midA {
+			out = append(out, Line{Op: OpDelete, Text: text})
+		}
+		for _, text := range midB {
+			out = append(out, Line{Op: OpInsert, Text: text})
+		}
+	}
+	for _, text := range a[len(a)-suffix:] {
+		out = append(out, Line{Op: OpContext, Text: text})
+	}
+	return out
+}
+
+// myers returns a shortest edit script from a to b (Myers' O(ND) algorithm), or false when it
+// needs more than maxEdits edits.
+func myers(a, b []string) ([]Line, bool) {
+	n, m := len(a), len(b)
+	if n+m == 0 {
+		return nil, true
+	}
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v for k in [-d, d] after step d.
+	var trace [][]int
+	for d := 0; d <= max && d <= maxEdits; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d), true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+	}
+	return nil, false
+}
+
+// backtrack walks the trace of myers back from the end of a and b, reached in step d.
+func backtrack(a, b []string, trace [][]int, d int) []Line {
+	var rev []Line
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			rev = append(rev, Line{Op: OpContext, Text: a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			rev = append(rev, Line{Op: OpInsert, Text: b[prevY]})
+		} else {
+			rev = append(rev, Line{Op: OpDelete, Text: a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		rev = append(rev, Line{Op: OpContext, Text: a[x-1]})
+		x, y = x-1, y-1
+	}
+	out := make([]Line, len(rev))
+	for i, l := range rev {
+		out[len(rev)-1-i] = l
+	}
+	return out
+}
@@ -0,0 +1,432 @@
+package diffview
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Parse finds the file changes in a tool call's input: patches (apply_patch's `input`, a unified
+// diff, or any string holding a `*** Begin Patch` block, such as an `apply_patch` shell heredoc),
+// whole-file writes (`content` with `path`/`file_path`), and edits (`old_string`/`new_string`, or
+// a list of them in `edits`). Paths are as the input names them. A whole-file write is shown as a
+// new file, and a deleted file without its content, since the input has neither the file's
+// previous content (see Options.Before).
+func Parse(input any) []File {
+	return parse(input, nil)
+}
+
+// before returns a file's content before the change, if it is known.
+type before func(path string) (string, bool)
+
+func parse(input any, prev before) []File {
+	switch v := input.(type) {
+	case string:
+		return parsePatch(v, prev)
+	case map[string]any:
+		str := func(keys ...string) (string, bool) {
+			for _, k := range keys {
+				if s, ok := v[k].(string); ok {
+					return s, true
+				}
+			}
+			return "", false
+		}
+		path, _ := str("file_path", "path")
+		if patch, _ := str("input", "patch"); patch != "" {
+			return parsePatch(patch, prev)
+		}
+		if content, ok := str("content"); ok && path != "" {
+			return []File{write(path, content, prev)}
+		}
+		if oldText, ok := str("old_string"); ok && path != "" {
+			newText, _ := str("new_string")
+			return []File{edit(path, []replacement{{oldText, newText}}, prev)}
+		}
+		if edits, ok := v["edits"].([]any); ok && path != "" {
+			var rs []replacement
+			for _, e := range edits {
+				if m, ok := e.(map[string]any); ok {
+					oldText, _ := m["old_string"].(string)
+					newText, _ := m["new_string"].(string)
+					rs = append(rs, replacement{oldText, newText})
+				}
+			}
+			return []File{edit(path, rs, prev)}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var out []File
+		for _, k := range keys {
+			out = append(out, embedded(v[k], prev)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// embedded finds apply_patch blocks in the strings of a value, e.g. the arguments of a shell
+// command.
+func embedded(v any, prev before) []File {
+	switch t := v.(type) {
+	case string:
+		if strings.Contains(t, "*** Begin Patch") {
+			return parseApplyPatch(t, prev)
+		}
+	case []any:
+		var out []File
+		for _, item := range t {
+			out = append(out, embedded(item, prev)...)
+		}
+		return out
+	}
+	return nil
+}
+
+func parsePatch(patch string, prev before) []File {
+	if strings.Contains(patch, "*** Begin Patch") {
+		return parseApplyPatch(patch, prev)
+	}
+	return parseUnifiedDiff(patch)
+}
+
+// write is the File for writing content to path: a modification of the previous content when
+// prev knows it, and otherwise a new file.
+func write(path, content string, prev before) File {
+	if prev != nil {
+		if old, ok := prev(path); ok {
+			return Compare(path, path, old, content)
+		}
+	}
+	return Compare("", path, "", content)
+}
+
+type replacement struct{ old, new string }
+
+// edit is the File for replacing text in path. When prev knows the file and every replacement
+// applies, the hunks are against the whole file, with line numbers; otherwise each replacement is
+// a hunk of its own, without them.
+func edit(path string, rs []replacement, prev before) File {
+	if prev != nil {
+		if old, ok := prev(path); ok {
+			content, applied := old, true
+			for _, r := range rs {
+				if r.old == "" || !strings.Contains(content, r.old) {
+					applied = false
+					break
+				}
+				content = strings.Replace(content, r.old, r.new, 1)
+			}
+			if applied {
+				return Compare(path, path, old, content)
+			}
+		}
+	}
+	f := File{OldPath: path, NewPath: path, Kind: KindModify}
+	for _, r := range rs {
+		if isBinary(r.old) || isBinary(r.new) {
+			return binary(f)
+		}
+		f.Hunks = append(f.Hunks, Hunk{Lines: diffLines(splitLines(r.old), splitLines(r.new))})
+	}
+	return f
+}
+
+// Compare returns the change from before to after. An empty oldPath is a new file, and an empty
+// newPath a deleted one. Content with NUL bytes or invalid UTF-8 is binary.
+func Compare(oldPath, newPath, before, after string) File {
+	f := File{OldPath: oldPath, NewPath: newPath, Kind: kindOf(oldPath, newPath)}
+	if isBinary(before) || isBinary(after) {
+		return binary(f)
+	}
+	lines := diffLines(splitLines(before), splitLines(after))
+	for _, l := range lines {
+		if l.Op != OpContext {
+			f.Hunks = []Hunk{{OldStart: 1, NewStart: 1, Numbered: true, Lines: lines}}
+			break
+		}
+	}
+	return f
+}
+
+func kindOf(oldPath, newPath string) Kind {
+	switch {
+	case oldPath == "":
+		return KindCreate
+	case newPath == "":
+		return KindDelete
+	case oldPath != newPath:
+		return KindRename
+	}
+	return KindModify
+}
+
+func binary(f File) File {
+	f.Binary, f.Hunks = true, nil
+	return f
+}
+
+func isBinary(s string) bool {
+	return strings.IndexByte(s, 0) >= 0 || !utf8.ValidString(s)
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// parseApplyPatch parses the apply_patch format: `*** Add File:`, `*** Delete File:`, and
+// `*** Update File:` (with an optional `*** Move to:`) sections between `*** Begin Patch` and
+// `*** End Patch`, the updates in `@@` chunks without line numbers.
+func parseApplyPatch(patch string, prev before) []File {
+	var files []File
+	var cur *File
+	var added []string // the content of an added file
+	in := false
+	flush := func() {
+		if cur == nil {
+			return
+		}
+		switch {
+		case cur.Kind == KindCreate:
+			*cur = Compare("", cur.NewPath, "", strings.Join(added, "\n"))
+		case cur.Kind == KindDelete && prev != nil:
+			if old, ok := prev(cur.OldPath); ok {
+				*cur = Compare(cur.OldPath, "", old, "")
+			}
+		case cur.Binary:
+			*cur = binary(*cur)
+		}
+		cur, added = nil, nil
+	}
+	start := func(f File) {
+		flush()
+		files = append(files, f)
+		cur = &files[len(files)-1]
+	}
+	for _, line := range splitLines(patch) {
+		if rest, ok := strings.CutPrefix(line, "*** "); ok {
+			switch {
+			case rest == "Begin Patch":
+				in = true
+				continue
+			case rest == "End Patch":
+				flush()
+				in = false
+				continue
+			case !in:
+				continue
+			case strings.HasPrefix(rest, "Add File: "):
+				start(File{NewPath: strings.TrimSpace(strings.TrimPrefix(rest, "Add File: ")), Kind: KindCreate})
+				continue
+			case strings.HasPrefix(rest, "Delete File: "):
+				start(File{OldPath: strings.TrimSpace(strings.TrimPrefix(rest, "Delete File: ")), Kind: KindDelete})
+				continue
+			case strings.HasPrefix(rest, "Update File: "):
+				path := strings.TrimSpace(strings.TrimPrefix(rest, "Update File: "))
+				start(File{OldPath: path, NewPath: path, Kind: KindModify})
+				continue
+			case strings.HasPrefix(rest, "Move to: ") && cur != nil:
+				cur.NewPath = strings.TrimSpace(strings.TrimPrefix(rest, "Move to: "))
+				cur.Kind = kindOf(cur.OldPath, cur.NewPath)
+				continue
+			case rest == "End of File":
+				continue
+			}
+		}
+		if !in || cur == nil || cur.Kind == KindDelete {
+			continue
+		}
+		if cur.Kind == KindCreate {
+			if text, ok := strings.CutPrefix(line, "+"); ok {
+				added = append(added, text)
+			}
+			continue
+		}
+		if header, ok := strings.CutPrefix(line, "@@"); ok {
+			cur.Hunks = append(cur.Hunks, Hunk{Header: strings.TrimSpace(header)})
+			continue
+		}
+		op := OpContext
+		if line != "" {
+			op = Op(line[0])
+		}
+		if op != OpContext && op != OpDelete && op != OpInsert {
+			continue
+		}
+		if len(cur.Hunks) == 0 {
+			cur.Hunks = append(cur.Hunks, Hunk{})
+		}
+		text := ""
+		if line != "" {
+			text = line[1:]
+		}
+		if isBinary(text) {
+			cur.Binary = true
+		}
+		h := &cur.Hunks[len(cur.Hunks)-1]
+		h.Lines = append(h.Lines, Line{Op: op, Text: text})
+	}
+	flush()
+	return files
+}
+
+// parseUnifiedDiff parses a unified diff, with or without git's extended headers (`diff --git`,
+// `new file mode`, `rename from`, `Binary files ... differ`, ...).
+func parseUnifiedDiff(patch string) []File {
+	var files []File
+	var cur *File
+	git := false // cur was started by a `diff --git` line and has no ---/+++ header yet
+	oldLeft, newLeft := 0, 0
+	lines := splitLines(patch)
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if cur != nil && len(cur.Hunks) > 0 && (oldLeft > 0 || newLeft > 0) {
+			h := &cur.Hunks[len(cur.Hunks)-1]
+			switch {
+			case strings.HasPrefix(line, `\`):
+				// `\ No newline at end of file`
+				continue
+			case line == "" || line[0] == ' ':
+				oldLeft, newLeft = oldLeft-1, newLeft-1
+			case line[0] == '-':
+				oldLeft--
+			case line[0] == '+':
+				newLeft--
+			default:
+				oldLeft, newLeft = 0, 0
+				i--
+				continue
+			}
+			text := ""
+			if line != "" {
+				text = line[1:]
+			}
+			op := OpContext
+			if line != "" {
+				op = Op(line[0])
+			}
+			h.Lines = append(h.Lines, Line{Op: op, Text: text})
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldPath, newPath := gitPaths(strings.TrimPrefix(line, "diff --git "))
+			files = append(files, File{OldPath: oldPath, NewPath: newPath, Kind: kindOf(oldPath, newPath)})
+			cur, git = &files[len(files)-1], true
+		case cur != nil && strings.HasPrefix(line, "new file mode"):
+			cur.OldPath, cur.Kind = "", KindCreate
+		case cur != nil && strings.HasPrefix(line, "deleted file mode"):
+			cur.NewPath, cur.Kind = "", KindDelete
+		case cur != nil && strings.HasPrefix(line, "rename from "):
+			cur.OldPath = strings.TrimPrefix(line, "rename from ")
+			cur.Kind = kindOf(cur.OldPath, cur.NewPath)
+		case cur != nil && strings.HasPrefix(line, "rename to "):
+			cur.NewPath = strings.TrimPrefix(line, "rename to ")
+			cur.Kind = kindOf(cur.OldPath, cur.NewPath)
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldPath := headerPath(strings.TrimPrefix(line, "--- "), "a/")
+			newPath := headerPath(strings.TrimPrefix(lines[i+1], "+++ "), "b/")
+			i++
+			if !git {
+				files = append(files, File{})
+				cur = &files[len(files)-1]
+			}
+			cur.OldPath, cur.NewPath, cur.Kind = oldPath, newPath, kindOf(oldPath, newPath)
+			git = false
+		case cur != nil && (strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch"):
+			cur.Binary = true
+			git = false
+		case cur != nil && strings.HasPrefix(line, "@@ "):
+			h, o, n, ok := hunkHeader(line)
+			if ok {
+				cur.Hunks = append(cur.Hunks, h)
+				oldLeft, newLeft = o, n
+				git = false
+			}
+		}
+	}
+	out := files[:0]
+	for _, f := range files {
+		if f.Binary {
+			f = binary(f)
+		}
+		if f.OldPath != "" || f.NewPath != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// gitPaths splits the `a/X b/Y` of a `diff --git` line. Paths with spaces are split in the middle
+// when both sides are the same, as they are unless the file is renamed (whose `rename from` and
+// `rename to` lines then give the paths).
+func gitPaths(s string) (string, string) {
+	if strings.HasPrefix(s, "a/") {
+		if half := (len(s) - 1) / 2; len(s)%2 == 1 && s[half] == ' ' && s[2:half] == s[half+3:] {
+			return s[2:half], s[half+3:]
+		}
+	}
+	oldPath, newPath, _ := strings.Cut(s, " ")
+	return strings.TrimPrefix(oldPath, "a/"), strings.TrimPrefix(newPath, "b/")
+}
+
+// headerPath strips a ---/+++ header's trailing timestamp and its a/ or b/ prefix; /dev/null is "".
+func headerPath(p, prefix string) string {
+	p, _, _ = strings.Cut(p, "\t")
+	p = strings.TrimSpace(p)
+	if p == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(p, prefix)
+}
+
+// hunkHeader parses `@@ -a,b +c,d @@ header` and returns the hunk and its old and new line counts.
+func hunkHeader(line string) (Hunk, int, int, bool) {
+	rest := strings.TrimPrefix(line, "@@ ")
+	ranges, header, ok := strings.Cut(rest, " @@")
+	if !ok {
+		return Hunk{}, 0, 0, false
+	}
+	oldRange, newRange, ok := strings.Cut(ranges, " ")
+	if !ok || !strings.HasPrefix(oldRange, "-") || !strings.HasPrefix(newRange, "+") {
+		return Hunk{}, 0, 0, false
+	}
+	oldStart, oldCount, ok1 := parseRange(oldRange[1:])
+	newStart, newCount, ok2 := parseRange(newRange[1:])
+	if !ok1 || !ok2 {
+		return Hunk{}, 0, 0, false
+	}
+	return Hunk{OldStart: oldStart, NewStart: newStart, Numbered: true, Header: strings.TrimSpace(header)}, oldCount, newCount, true
+}
+
+// parseRange parses `start,count` (or `start` for a count of 1). An empty range starts after its
+// line, so its start is made the line it would be inserted at, as Hunk.OldStart wants.
+func parseRange(s string) (start, count int, ok bool) {
+	startText, countText, hasCount := strings.Cut(s, ",")
+	start, err := strconv.Atoi(startText)
+	if err != nil {
+		return 0, 0, false
+	}
+	count = 1
+	if hasCount {
+		if count, err = strconv.Atoi(countText); err != nil {
+			return 0, 0, false
+		}
+	}
+	if count == 0 {
+		start++
+	}
+	return start, count, true
+}
@@ -0,0 +1,73 @@
+package hooksdk
+
+import (
+	"io"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// DryRunFile is the log, under CODEX_HOME, of the decisions a hook in dry-run mode didn't enforce
+// (see DryRunEnv).
+const DryRunFile = "dryrun.jsonl"
+
+// WouldHave is what a hook in dry-run mode would have answered, in ResponseMetadata.WouldHave and
+// the lines of DryRunFile.
+type WouldHave struct {
+	Decision   Decision       `json:"decision"`
+	Reason     string         `json:"reason,omitempty"`
+	Prompt     string         `json:"prompt,omitempty"`
+	ReasonCode string         `json:"reason_code,omitempty"`
+	Reasons    []Reason       `json:"reasons,omitempty"`
+	Modify     map[string]any `json:"modify,omitempty"`
+}
+
+// dryRunLine is a line of DryRunFile.
+type dryRunLine struct {
+	Metadata
+	SessionID string    `json:"session_id,omitempty"`
+	EventID   string    `json:"event_id,omitempty"`
+	EventType string    `json:"event_type,omitempty"`
+	WouldHave WouldHave `json:"would_have"`
+}
+
+// dryRun returns resp, the response to the invocation invocationID of the event ids, as a hook in
+// dry-run mode writes it: a deny or ask becomes an allow, and a Modify section is dropped, with
+// what was dropped kept in the metadata's WouldHave and appended to DryRunFile (a failed append is
+// reported on stderr). Any other response is returned as it is.
+func dryRun(env Env, stderr io.Writer, ids eventIDs, invocationID string, resp Response) Response {
+	blocks := resp.Decision == DecisionDeny || resp.Decision == DecisionAsk
+	if !blocks && len(resp.Modify) == 0 {
+		return resp
+	}
+	would := WouldHave{Decision: resp.Decision, Modify: resp.Modify}
+	if would.Decision == "" {
+		would.Decision = DecisionAllow
+	}
+	resp.Modify = nil
+	if blocks {
+		would.Reason, would.Prompt, would.ReasonCode, would.Reasons = resp.Reason, resp.Prompt, resp.ReasonCode, resp.Reasons
+		resp.Decision = DecisionAllow
+		resp.Reason, resp.Prompt, resp.Question, resp.ReasonCode, resp.Reasons = "", "", nil, "", nil
+	}
+
+	var m ResponseMetadata
+	if resp.Metadata != nil {
+		m = *resp.Metadata
+	}
+	m.WouldHave = &would
+	resp.Metadata = &m
+
+	line := dryRunLine{Metadata: Meta(), SessionID: env.SessionID, EventID: ids.eventID, EventType: ids.eventType, WouldHave: would}
+	if env.HookName != "" {
+		line.Hook = env.HookName
+	}
+	line.InvocationID = invocationID
+	if ids.sessionID != "" {
+		line.SessionID = ids.sessionID
+	}
+	w := jsonl.New(env.Path(DryRunFile), jsonl.Options{MaxSize: jsonl.DefaultMaxSize, Keep: jsonl.DefaultKeep})
+	if err := w.Append(line); err != nil {
+		writeLogLine(stderr, "warn", "dry_run", err)
+	}
+	return resp
+}
@@ -0,0 +1,153 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// dryRunIn runs handler on stdin in a CODEX_HOME of its own, for a host that can apply
+// modifications and context, with the extra environment env, and returns the exit code, stdout,
+// stderr, and the lines of dryrun.jsonl.
+func dryRunIn(t *testing.T, env map[string]string, handler hooksdk.Handler, stdin []byte, opts ...hooksdk.Option) (int, string, string, []map[string]any) {
+	t.Helper()
+	home := t.TempDir()
+	vars := map[string]string{"CODEX_HOME": home, "CODEX_HOOK_NAME": "guard",
+		hooksdk.CapabilitiesEnv: hooksdk.CapabilityModify + "," + hooksdk.CapabilityAdditionalContext}
+	for k, v := range env {
+		vars[k] = v
+	}
+	stdio, out, errOut := testIO(stdin, vars)
+	code := stdio.Run(context.Background(), handler, opts...)
+	var lines []map[string]any
+	data, err := os.ReadFile(filepath.Join(home, hooksdk.DryRunFile))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var v map[string]any
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("dryrun.jsonl line %q: %v", line, err)
+		}
+		lines = append(lines, v)
+	}
+	return code, out.String(), errOut.String(), lines
+}
+
+func TestDryRunConvertsDecisions(t *testing.T) {
+	stdin := hooktest.ToolCallStarted().WithSessionID("s1").With("event_id", "e1").With("hook_invocation_id", "inv-1").Bytes()
+	deny := hooksdk.Deny("rm -rf", hooksdk.WithReasonCode("GUARD_RM_ROOT"), hooksdk.WithRule("rm-root")).
+		ReplaceField("tool_input.command", "ls")
+	for _, tt := range []struct {
+		name string
+		resp hooksdk.Response
+		want hooksdk.WouldHave
+	}{
+		{"deny", deny, hooksdk.WouldHave{Decision: hooksdk.DecisionDeny, Reason: "rm -rf", ReasonCode: "GUARD_RM_ROOT",
+			Reasons: deny.Reasons, Modify: deny.Modify}},
+		{"ask", hooksdk.Ask("sure?"), hooksdk.WouldHave{Decision: hooksdk.DecisionAsk, Prompt: "sure?"}},
+		{"modify", hooksdk.Response{}.ReplaceField("tool_input.command", "ls"), hooksdk.WouldHave{Decision: hooksdk.DecisionAllow, Modify: deny.Modify}},
+	} {
+		code, out, stderr, lines := dryRunIn(t, map[string]string{hooksdk.DryRunEnv: "1"}, respond(tt.resp, nil), stdin)
+		var resp hooksdk.Response
+		if err := json.Unmarshal([]byte(out), &resp); err != nil {
+			t.Fatalf("%s: response %q: %v", tt.name, out, err)
+		}
+		// What's written only allows; what it would have done is in the metadata and the log.
+		if code != hooksdk.ExitOK || resp.Decision != hooksdk.DecisionAllow || resp.Reason != "" || resp.Prompt != "" ||
+			resp.ReasonCode != "" || resp.Reasons != nil || resp.Modify != nil || stderr != "" {
+			t.Errorf("%s: exit %d, response %s, stderr %q", tt.name, code, out, stderr)
+		}
+		if resp.Metadata == nil || resp.Metadata.WouldHave == nil || !reflect.DeepEqual(*resp.Metadata.WouldHave, tt.want) {
+			t.Errorf("%s: would_have = %+v, want %+v", tt.name, resp.Metadata, tt.want)
+		}
+		if err := hooksdk.ValidateResponse("tool-call-started", resp); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if len(lines) != 1 {
+			t.Fatalf("%s: dryrun.jsonl has %d lines", tt.name, len(lines))
+		}
+		line := lines[0]
+		var want any
+		data, _ := json.Marshal(tt.want)
+		json.Unmarshal(data, &want)
+		if line["hook"] != "guard" || line["session_id"] != "s1" || line["event_id"] != "e1" || line["event_type"] != "tool-call-started" ||
+			line["hook_invocation_id"] != "inv-1" || line["ts"] == nil || !reflect.DeepEqual(line["would_have"], want) {
+			t.Errorf("%s: dryrun.jsonl line = %v", tt.name, line)
+		}
+	}
+}
+
+func TestDryRunAllowUnchanged(t *testing.T) {
+	// An allow is written byte for byte as without dry-run, and nothing is logged.
+	stdin := hooktest.ToolCallStarted().With("hook_invocation_id", "inv-1").Bytes()
+	allow := hooksdk.Allow().InjectContext("checked").AddReason(hooksdk.Reason{Code: "OK", Message: "fine"})
+	allow.SystemMessage = "all good"
+	code, want, _, _ := dryRunIn(t, nil, respond(allow, nil), stdin)
+	for name, env := range map[string]map[string]string{"env": {hooksdk.DryRunEnv: "true"}, "option": nil} {
+		var opts []hooksdk.Option
+		if env == nil {
+			opts = append(opts, hooksdk.WithDryRun())
+		}
+		gotCode, got, stderr, lines := dryRunIn(t, env, respond(allow, nil), stdin, opts...)
+		if gotCode != code || got != want || stderr != "" || lines != nil {
+			t.Errorf("%s: exit %d, %s, stderr %q, %d log lines; want exit %d, %s", name, gotCode, got, stderr, len(lines), code, want)
+		}
+	}
+}
+
+func TestDryRunSelection(t *testing.T) {
+	// The variable lists the hooks it covers, or covers every hook when it is a boolean.
+	for v, on := range map[string]bool{
+		"1": true, "true": true, " TRUE ": true, "0": false, "false": false, "": false,
+		"guard": true, "other,guard": true, " other , guard ": true, "other": false, "guard_exec": false, ",": false,
+	} {
+		code, out, _, _ := dryRunIn(t, map[string]string{hooksdk.DryRunEnv: v}, respond(hooksdk.Deny("no"), nil), hooktest.SessionStart().Bytes())
+		if got := code == hooksdk.ExitOK; got != on || strings.Contains(out, `"would_have"`) != on {
+			t.Errorf("CODEX_HOOK_DRY_RUN=%q: exit %d, %s; want dry-run %v", v, code, out, on)
+		}
+		if got := hooksdk.FromMap(map[string]string{hooksdk.DryRunEnv: v, "CODEX_HOOK_NAME": "guard"}).DryRun; got != on {
+			t.Errorf("CODEX_HOOK_DRY_RUN=%q: Env.DryRun = %v", v, got)
+		}
+	}
+}
+
+func TestDryRunWriteResponse(t *testing.T) {
+	home := t.TempDir()
+	stdio, out, _ := testIO(nil, map[string]string{"CODEX_HOME": home, hooksdk.DryRunEnv: "1", hooksdk.EventTypeEnv: "session-start"})
+	if err := hooksdk.WriteResponse(hooksdk.Deny("no"), hooksdk.WithIO(stdio)); err != nil {
+		t.Fatal(err)
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil || resp.Decision != hooksdk.DecisionAllow || resp.Metadata.WouldHave.Decision != hooksdk.DecisionDeny {
+		t.Errorf("WriteResponse wrote %s, %v", out, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(home, hooksdk.DryRunFile))
+	if !bytes.Contains(data, []byte(`"event_type":"session-start"`)) {
+		t.Errorf("dryrun.jsonl = %s", data)
+	}
+}
+
+func TestDryRunLogFails(t *testing.T) {
+	// A log that can't be written is a warning; the allow is still written.
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o644)
+	code, out, stderr, _ := dryRunIn(t, map[string]string{"CODEX_HOME": file, hooksdk.DryRunEnv: "1"}, respond(hooksdk.Deny("no"), nil), hooktest.SessionStart().Bytes())
+	if code != hooksdk.ExitOK || !strings.Contains(out, `"allow"`) {
+		t.Errorf("exit %d, %s", code, out)
+	}
+	if line := errorLine(t, stderr); line["level"] != "warn" || line["stage"] != "dry_run" {
+		t.Errorf("stderr line = %v", line)
+	}
+}
@@ -0,0 +1,287 @@
+// Package email sends plain-text email over SMTP, for notification hooks: over STARTTLS or
+// implicit TLS, with optional PLAIN authentication, and within a deadline so a slow server can't
+// stall the session.
+//
+//	c := &email.Client{Host: "smtp.example.com", Username: user, Password: pass}
+//	err := c.Send(ctx, &email.Message{
+//		From:    "xcodex <bot@example.com>",
+//		To:      []string{"me@example.com"},
+//		Subject: "session finished",
+//		Body:    "...",
+//	})
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a Send, from connecting to the end of the exchange, when Client.Timeout
+// is zero.
+const DefaultTimeout = 30 * time.Second
+
+// Security is how the connection to the server is secured.
+type Security string
+
+// Securities accepted by ParseSecurity.
+const (
+	// STARTTLS upgrades a plain connection before anything is sent (port 587 by default). A server
+	// that doesn't offer it is an error rather than a reason to send in the clear.
+	STARTTLS Security = "starttls"
+	// ImplicitTLS connects with TLS from the start (port 465 by default).
+	ImplicitTLS Security = "tls"
+	// NoTLS sends in the clear (port 25 by default): only for a relay on the same machine.
+	// Passwords are only sent in the clear to localhost.
+	NoTLS Security = "none"
+)
+
+// ParseSecurity parses a Security name, case-insensitively; "" is STARTTLS.
+func ParseSecurity(s string) (Security, error) {
+	switch sec := Security(strings.ToLower(strings.TrimSpace(s))); sec {
+	case "":
+		return STARTTLS, nil
+	case STARTTLS, ImplicitTLS, NoTLS:
+		return sec, nil
+	}
+	return "", fmt.Errorf("unknown SMTP security %q (want starttls, tls, or none)", s)
+}
+
+// DefaultPort is the usual port for sec.
+func (sec Security) DefaultPort() int {
+	switch sec {
+	case ImplicitTLS:
+		return 465
+	case NoTLS:
+		return 25
+	}
+	return 587
+}
+
+// Message is a plain-text email.
+type Message struct {
+	// From is the sender, an address optionally with a name (`xcodex <bot@example.com>`).
+	From string
+	// To are the recipients, in the same form.
+	To      []string
+	Subject string
+	// Body is the text of the message. Line endings are converted to CRLF.
+	Body string
+	// Date is the message's date; zero means the time it is sent.
+	Date time.Time
+}
+
+// Bytes returns the message in RFC 5322 form: UTF-8 text, quoted-printable, with the subject
+// encoded for non-ASCII text.
+func (m *Message) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("email: from %q: %v", m.From, err)
+	}
+	to := make([]string, len(m.To))
+	for i, addr := range m.To {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("email: to %q: %v", addr, err)
+		}
+		to[i] = a.String()
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", oneLine(m.Subject)))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	body := strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes(), nil
+}
+
+// oneLine keeps a header value on one line.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func messageID(from string) string {
+	domain := "localhost"
+	if _, d, ok := strings.Cut(from, "@"); ok && d != "" {
+		domain = d
+	}
+	var b [12]byte
+	rand.Read(b[:])
+	return "<" + hex.EncodeToString(b[:]) + "@" + domain + ">"
+}
+
+// Client sends messages through one SMTP server.
+type Client struct {
+	Host string
+	// Port defaults to Security.DefaultPort.
+	Port int
+	// Security defaults to STARTTLS.
+	Security Security
+	// Username and Password authenticate with AUTH PLAIN; an empty Username sends without
+	// authenticating.
+	Username string
+	Password string
+	// Timeout bounds each Send. Zero means DefaultTimeout.
+	Timeout time.Duration
+	// TLSConfig configures TLS, e.g. to trust a private CA; nil verifies the server against the
+	// system roots for Host.
+	TLSConfig *tls.Config
+}
+
+// Send delivers m to its recipients.
+func (c *Client) Send(ctx context.Context, m *Message) error {
+	if c.Host == "" {
+		return errors.New("email: no SMTP host")
+	}
+	if len(m.To) == 0 {
+		return errors.New("email: no recipients")
+	}
+	data, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	from, _ := mail.ParseAddress(m.From)
+	rcpts := make([]string, len(m.To))
+	for i, addr := range m.To {
+		a, _ := mail.ParseAddress(addr)
+		rcpts[i] = a.Address
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("email: %v", err)
+	}
+	defer conn.Close()
+	// The SMTP exchange has no context of its own: the deadline bounds it, and cancelling ctx
+	// cuts it short.
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if err := c.exchange(conn, from.Address, rcpts, data); err != nil {
+		// Only ctx sets the connection's deadline, so a timed-out read or write means ctx is done,
+		// or is about to be: its timer can fire just after the connection's.
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			<-ctx.Done()
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("email: %v: %w", err, ctx.Err())
+		}
+		return fmt.Errorf("email: %v", err)
+	}
+	return nil
+}
+
+func (c *Client) security() Security {
+	if c.Security == "" {
+		return STARTTLS
+	}
+	return c.Security
+}
+
+func (c *Client) tlsConfig() *tls.Config {
+	cfg := &tls.Config{}
+	if c.TLSConfig != nil {
+		cfg = c.TLSConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = c.Host
+	}
+	return cfg
+}
+
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	port := c.Port
+	if port == 0 {
+		port = c.security().DefaultPort()
+	}
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(port))
+	var d net.Dialer
+	if c.security() == ImplicitTLS {
+		td := tls.Dialer{NetDialer: &d, Config: c.tlsConfig()}
+		return td.DialContext(ctx, "tcp", addr)
+	}
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+func (c *Client) exchange(conn net.Conn, from string, rcpts []string, data []byte) error {
+	sc, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		return err
+	}
+	defer sc.Close()
+	if c.security() == STARTTLS {
+		if ok, _ := sc.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s doesn't offer STARTTLS (set the security to tls or none)", c.Host)
+		}
+		if err := sc.StartTLS(c.tlsConfig()); err != nil {
+			return err
+		}
+	}
+	if c.Username != "" {
+		// PlainAuth refuses to send the password without TLS, unless to localhost.
+		if err := sc.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return err
+		}
+	}
+	if err := sc.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range rcpts {
+		if err := sc.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("%s: %w", rcpt, err)
+		}
+	}
+	w, err := sc.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return sc.Quit()
+}
@@ -0,0 +1,188 @@
+package email_test
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/email"
+	"example.com/xcodex/hooks-sdk/hooksdk/email/emailtest"
+)
+
+func testMessage() *email.Message {
+	return &email.Message{
+		From:    "xcodex <bot@example.com>",
+		To:      []string{"me@example.com", "Them <them@example.com>"},
+		Subject: "session finished ✓",
+		Body:    "line one\nline two = ok\r\n" + strings.Repeat("x", 100),
+		Date:    time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	data, err := testMessage().Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.ReplaceAll(string(data), "\r\n", ""), "\n") {
+		t.Error("a line doesn't end in CRLF")
+	}
+	m, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"From":                      `"xcodex" <bot@example.com>`,
+		"To":                        `<me@example.com>, "Them" <them@example.com>`,
+		"Subject":                   "=?utf-8?q?session_finished_=E2=9C=93?=",
+		"Date":                      "Wed, 01 Jan 2025 10:00:00 +0000",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	} {
+		if got := m.Header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if id := m.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q", id)
+	}
+
+	// The subject stays on one line, and a zero Date is now.
+	msg := testMessage()
+	msg.Subject, msg.Date = "two\nlines", time.Time{}
+	data, _ = msg.Bytes()
+	m, _ = mail.ReadMessage(strings.NewReader(string(data)))
+	if got := m.Header.Get("Subject"); got != "two lines" {
+		t.Errorf("Subject = %q", got)
+	}
+	if date, err := m.Header.Date(); err != nil || time.Since(date) > time.Minute {
+		t.Errorf("Date = %v, %v", date, err)
+	}
+
+	for _, bad := range []*email.Message{{From: "not an address", To: []string{"me@example.com"}}, {From: "bot@example.com", To: []string{"me@"}}} {
+		if _, err := bad.Bytes(); err == nil {
+			t.Errorf("Bytes of %+v succeeded", bad)
+		}
+	}
+}
+
+func TestParseSecurity(t *testing.T) {
+	for in, want := range map[string]email.Security{"": email.STARTTLS, " StartTLS ": email.STARTTLS, "TLS": email.ImplicitTLS, "none": email.NoTLS} {
+		if got, err := email.ParseSecurity(in); err != nil || got != want {
+			t.Errorf("ParseSecurity(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := email.ParseSecurity("ssl"); err == nil {
+		t.Error("ParseSecurity(ssl) succeeded")
+	}
+	if email.STARTTLS.DefaultPort() != 587 || email.ImplicitTLS.DefaultPort() != 465 || email.NoTLS.DefaultPort() != 25 {
+		t.Error("DefaultPort")
+	}
+}
+
+func TestSend(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		opts     emailtest.Options
+		security email.Security
+		tls      bool
+	}{
+		{"starttls", emailtest.Options{}, email.STARTTLS, true},
+		{"implicit tls", emailtest.Options{ImplicitTLS: true}, email.ImplicitTLS, true},
+		{"none", emailtest.Options{}, email.NoTLS, false},
+	} {
+		srv := emailtest.NewServer(t, tt.opts)
+		c := &email.Client{Host: srv.Host, Port: srv.Port, Security: tt.security, TLSConfig: srv.ClientTLS}
+		if err := c.Send(context.Background(), testMessage()); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got := srv.Wait(t, 1)[0]
+		if got.From != "bot@example.com" || strings.Join(got.To, ",") != "me@example.com,them@example.com" || got.TLS != tt.tls {
+			t.Errorf("%s: from %q to %q, TLS %v", tt.name, got.From, got.To, got.TLS)
+		}
+		if want := "line one\nline two = ok\n" + strings.Repeat("x", 100) + "\n"; got.Subject != "session finished ✓" || got.Body != want {
+			t.Errorf("%s: subject %q, body %q", tt.name, got.Subject, got.Body)
+		}
+	}
+}
+
+func TestSendAuth(t *testing.T) {
+	srv := emailtest.NewServer(t, emailtest.Options{Username: "bot", Password: "secret"})
+	c := &email.Client{Host: srv.Host, Port: srv.Port, Username: "bot", Password: "secret", TLSConfig: srv.ClientTLS}
+	if err := c.Send(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Wait(t, 1)[0]; got.User != "bot" {
+		t.Errorf("authenticated as %q", got.User)
+	}
+	c.Password = "wrong"
+	if err := c.Send(context.Background(), testMessage()); err == nil {
+		t.Error("Send with the wrong password succeeded")
+	}
+	// Without a username, nothing is authenticated.
+	c.Username = ""
+	if err := c.Send(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Wait(t, 2)[1]; got.User != "" {
+		t.Errorf("authenticated as %q without a username", got.User)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	srv := emailtest.NewServer(t, emailtest.Options{NoSTARTTLS: true, RejectRcpt: "them@example.com"})
+	c := &email.Client{Host: srv.Host, Port: srv.Port, TLSConfig: srv.ClientTLS}
+	// STARTTLS isn't given up for sending in the clear.
+	if err := c.Send(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Send without STARTTLS = %v", err)
+	}
+	c.Security = email.NoTLS
+	if err := c.Send(context.Background(), testMessage()); err == nil || !strings.Contains(err.Error(), "them@example.com") {
+		t.Errorf("Send to a rejected recipient = %v", err)
+	}
+	if len(srv.Messages()) != 0 {
+		t.Errorf("messages accepted: %+v", srv.Messages())
+	}
+
+	// The server's certificate has to be trusted.
+	srv = emailtest.NewServer(t, emailtest.Options{})
+	c = &email.Client{Host: srv.Host, Port: srv.Port}
+	if err := c.Send(context.Background(), testMessage()); err == nil {
+		t.Error("Send to an untrusted server succeeded")
+	}
+
+	for name, c := range map[string]*email.Client{"no host": {}, "no server": {Host: "127.0.0.1", Port: 1, Security: email.NoTLS}} {
+		if err := c.Send(context.Background(), testMessage()); err == nil {
+			t.Errorf("%s: Send succeeded", name)
+		}
+	}
+	msg := testMessage()
+	msg.To = nil
+	if err := (&email.Client{Host: "127.0.0.1"}).Send(context.Background(), msg); err == nil {
+		t.Error("Send without recipients succeeded")
+	}
+}
+
+func TestSendDeadline(t *testing.T) {
+	srv := emailtest.NewServer(t, emailtest.Options{Stall: time.Second})
+	c := &email.Client{Host: srv.Host, Port: srv.Port, Security: email.NoTLS, Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	if err := c.Send(context.Background(), testMessage()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send to a stalled server = %v, want a deadline error", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Send took %v with a 100ms timeout", d)
+	}
+
+	// Cancelling the context cuts the exchange short.
+	c.Timeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if err := c.Send(ctx, testMessage()); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Send = %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+// Package emailtest runs an in-process SMTP server for testing hooks that send email with
+// hooksdk/email: it speaks enough SMTP for net/smtp (EHLO, STARTTLS, AUTH PLAIN, MAIL, RCPT,
+// DATA), with a self-signed certificate the client is given, and records the messages it
+// accepts.
+//
+//	srv := emailtest.NewServer(t, emailtest.Options{})
+//	c := &email.Client{Host: srv.Host, Port: srv.Port, TLSConfig: srv.ClientTLS}
+//	err := c.Send(ctx, msg)
+//	got := srv.Wait(t, 1)
+package emailtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Options configure a Server.
+type Options struct {
+	// ImplicitTLS serves TLS from the start, as on port 465; otherwise the connection starts in
+	// the clear and the server offers STARTTLS unless NoSTARTTLS is set.
+	ImplicitTLS bool
+	NoSTARTTLS  bool
+	// Username and Password, when set, are the only credentials AUTH PLAIN accepts; otherwise
+	// any are.
+	Username string
+	Password string
+	// RejectRcpt is a recipient address RCPT refuses.
+	RejectRcpt string
+	// Stall is how long the server waits before its greeting, to test timeouts.
+	Stall time.Duration
+}
+
+// Message is a message the server accepted.
+type Message struct {
+	From string
+	To   []string
+	// TLS is whether the message was sent over TLS, and User who authenticated, if anyone.
+	TLS  bool
+	User string
+	// Data is the message as sent, with LF line endings; Header and Body are Data parsed, the
+	// body decoded from quoted-printable and the subject from its encoded words.
+	Data    string
+	Header  mail.Header
+	Subject string
+	Body    string
+}
+
+// Server is a running SMTP server, stopped when the test ends.
+type Server struct {
+	// Host and Port are where it listens (Host is 127.0.0.1).
+	Host string
+	Port int
+	// ClientTLS is a client config trusting the server's certificate, for email.Client.TLSConfig.
+	ClientTLS *tls.Config
+
+	opts     Options
+	ln       net.Listener
+	tls      *tls.Config
+	mu       sync.Mutex
+	messages []Message
+	notify   chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server on a free local port.
+func NewServer(t testing.TB, opts Options) *Server {
+	t.Helper()
+	cert, pool := certificate(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Host:      "127.0.0.1",
+		Port:      ln.Addr().(*net.TCPAddr).Port,
+		ClientTLS: &tls.Config{RootCAs: pool},
+		opts:      opts,
+		ln:        ln,
+		tls:       &tls.Config{Certificates: []tls.Certificate{cert}},
+		notify:    make(chan struct{}, 1),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(func() {
+		ln.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+// Messages returns the messages accepted so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Wait returns the messages accepted once there are at least n, failing the test if that takes
+// more than ten seconds.
+func (s *Server) Wait(t testing.TB, n int) []Message {
+	t.Helper()
+	deadline := time.After(10 * time.Second)
+	for {
+		if got := s.Messages(); len(got) >= n {
+			return got
+		}
+		select {
+		case <-s.notify:
+		case <-deadline:
+			t.Fatalf("%d message(s) received within 10s, want %d", len(s.Messages()), n)
+		}
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(30 * time.Second))
+			s.session(conn)
+		}()
+	}
+}
+
+// session runs the SMTP dialogue on one connection.
+func (s *Server) session(conn net.Conn) {
+	secure := false
+	if s.opts.ImplicitTLS {
+		conn = tls.Server(conn, s.tls)
+		secure = true
+	}
+	time.Sleep(s.opts.Stall)
+	r := textproto.NewReader(bufio.NewReader(conn))
+	reply := func(msg string) bool {
+		_, err := io.WriteString(conn, msg+"\r\n")
+		return err == nil
+	}
+	if !reply("220 emailtest ready") {
+		return
+	}
+	var msg Message
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			ext := []string{"250-emailtest", "250-8BITMIME"}
+			if !secure && !s.opts.NoSTARTTLS {
+				ext = append(ext, "250-STARTTLS")
+			}
+			ext = append(ext, "250 AUTH PLAIN")
+			if !reply(strings.Join(ext, "\r\n")) {
+				return
+			}
+		case "STARTTLS":
+			if secure || s.opts.NoSTARTTLS {
+				reply("502 not offered")
+				continue
+			}
+			if !reply("220 go ahead") {
+				return
+			}
+			tc := tls.Server(conn, s.tls)
+			if tc.Handshake() != nil {
+				return
+			}
+			conn, secure = tc, true
+			r = textproto.NewReader(bufio.NewReader(conn))
+			msg = Message{}
+		case "AUTH":
+			mech, resp, _ := strings.Cut(arg, " ")
+			if !strings.EqualFold(mech, "PLAIN") {
+				reply("504 unsupported mechanism")
+				continue
+			}
+			if resp == "" {
+				if !reply("334 ") {
+					return
+				}
+				if resp, err = r.ReadLine(); err != nil {
+					return
+				}
+			}
+			creds, err := base64.StdEncoding.DecodeString(resp)
+			parts := strings.Split(string(creds), "\x00")
+			if err != nil || len(parts) != 3 || s.opts.Username != "" && (parts[1] != s.opts.Username || parts[2] != s.opts.Password) {
+				reply("535 authentication failed")
+				continue
+			}
+			msg.User = parts[1]
+			reply("235 authenticated")
+		case "MAIL":
+			msg.From = address(arg)
+			msg.To = nil
+			reply("250 ok")
+		case "RCPT":
+			to := address(arg)
+			if to == s.opts.RejectRcpt {
+				reply("550 no such user")
+				continue
+			}
+			msg.To = append(msg.To, to)
+			reply("250 ok")
+		case "DATA":
+			if !reply("354 end with .") {
+				return
+			}
+			data, err := r.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			msg.Data, msg.TLS = string(data), secure
+			s.accept(msg)
+			msg = Message{User: msg.User}
+			reply("250 queued")
+		case "RSET":
+			msg = Message{User: msg.User}
+			reply("250 ok")
+		case "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("500 unknown command")
+		}
+	}
+}
+
+func (s *Server) accept(msg Message) {
+	if m, err := mail.ReadMessage(strings.NewReader(msg.Data)); err == nil {
+		msg.Header = m.Header
+		msg.Subject, _ = new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+		var body io.Reader = m.Body
+		if strings.EqualFold(m.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			body = quotedprintable.NewReader(body)
+		}
+		data, _ := io.ReadAll(body)
+		msg.Body = string(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")))
+	}
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// address reads the address of `FROM:<a@b>` or `TO:<a@b>`.
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
+
+// certificate makes a self-signed certificate for 127.0.0.1 and localhost, and a pool trusting
+// it.
+func certificate(t testing.TB) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "emailtest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
@@ -0,0 +1,312 @@
+package hooksdk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/invocation"
+)
+
+// envelope is what the stdin envelope told us about where the payload came from.
+type envelope struct {
+	// payloadPath is the file the payload was read from; empty when stdin was the payload.
+	payloadPath string
+	// cleanup is set when the host asked for payloadPath to be removed after reading.
+	cleanup bool
+	// outputPath is where the host wants the response written instead of stdout.
+	outputPath string
+	// schemaVersion is the envelope's schema_version, if it had one.
+	schemaVersion *int
+	// signature is the envelope's HMAC of the payload (see SecretEnv). A bare payload has none.
+	signature string
+	// invocationID is the envelope's hook_invocation_id (a bare payload's own), or else the one
+	// made for the read (see HookPayload.InvocationID).
+	invocationID string
+	// format is the envelope's payload_format: "" for JSON, or PayloadFormatCBOR.
+	format PayloadFormat
+	// decoded is a CBOR payload as it was decoded, byte strings and all, once it has been read.
+	decoded map[string]any
+	// capabilities are the envelope's `capabilities` (see HostSupports).
+	capabilities hostCapabilities
+	// event identifies the payload once it has been parsed, for the dry-run log.
+	event eventIDs
+}
+
+// ParseEnvelope resolves the stdin envelope used for large payloads.
+//
+// If data is a JSON object with an inline `payload` object, that is the payload. If it contains
+// `payload_path` (or the legacy `payload-path`) instead, the file it points to is read and
+// returned along with its path, and `payload_fd` is read from that file descriptor (see
+// PayloadFDEnv); an envelope with more than one of them is an error. Otherwise data itself is the
+// payload and fromPath is empty. Empty input is treated as `{}`, and non-JSON input is returned
+// unchanged. A `signature` is verified as described at SecretEnv, and a `min_sdk_version` newer
+// than Version fails with ErrSDKTooOld. `capabilities`, if present, must be an array of strings
+// (see HostSupports). A payload file in CBOR (`"payload_format": "cbor"`) is returned as it is;
+// parse it with WithPayloadFormat.
+func ParseEnvelope(data []byte) (payloadBytes []byte, fromPath string, err error) {
+	payloadBytes, env, err := parseEnvelope(context.Background(), data, newOptions(nil))
+	return payloadBytes, env.payloadPath, err
+}
+
+func parseEnvelope(ctx context.Context, data []byte, o *options) ([]byte, envelope, error) {
+	payload, env, err := resolveEnvelope(ctx, data, o)
+	if err == nil {
+		err = o.checkSignature(payload, env)
+	}
+	if err != nil {
+		return nil, env, err
+	}
+	return payload, env, nil
+}
+
+func resolveEnvelope(ctx context.Context, data []byte, o *options) ([]byte, envelope, error) {
+	payload, src, env, err := decodeEnvelope(data, o)
+	if err != nil || src == nil {
+		return payload, env, err
+	}
+
+	var payloadBytes []byte
+	if src.fd >= 0 {
+		payloadBytes, err = readPayloadFD(ctx, src.fd, o.maxPayloadBytes)
+	} else {
+		// The host may start the hook before it has finished writing the file.
+		payloadBytes, err = o.readPayloadFileRetry(ctx, env.format, func() ([]byte, error) {
+			if o.restrictPayloadPath {
+				return o.readAllowedPayloadFile(ctx, src.path)
+			}
+			return readFileContext(ctx, src.path, o.maxPayloadBytes)
+		})
+	}
+	if err != nil {
+		return nil, env, src.readError(err)
+	}
+	// The checksum covers the file as written, before any decompression.
+	if src.checksum != "" {
+		if err := verifyChecksum(payloadBytes, src.checksum); err != nil {
+			return nil, env, fmt.Errorf("%s: %w", src.name, err)
+		}
+	}
+	// The host may compress large payloads. Trust the magic bytes over the file name so a plain
+	// file that happens to end in `.gz` still parses.
+	if src.gzip || hasGzipMagic(payloadBytes) {
+		payloadBytes, err = gunzip(ctx, payloadBytes, o.maxPayloadBytes, "decompressed "+src.name)
+		if err != nil {
+			return nil, env, src.readError(fmt.Errorf("decompress: %w", err))
+		}
+	}
+	return payloadBytes, env, nil
+}
+
+// payloadSource is where an envelope says the payload is: a payload_path file or a payload_fd
+// descriptor.
+type payloadSource struct {
+	path string
+	// fd is the payload_fd, or -1 for a payload_path.
+	fd int
+	// name names the source in errors.
+	name string
+	// gzip is set for `"payload_encoding": "gzip"`.
+	gzip bool
+	// checksum is the envelope's payload_sha256, if it has one.
+	checksum string
+}
+
+// readError wraps a failure to read or decompress the payload as the payload_path or payload_fd
+// error.
+func (src *payloadSource) readError(err error) error {
+	if src.fd >= 0 {
+		if errors.Is(err, ErrPayloadFDNotOpen) || errors.Is(err, ErrInvalidEnvelope) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", src.name, err)
+	}
+	return payloadPathError(src.path, err)
+}
+
+// decodeEnvelope decodes the stdin envelope in data without reading the payload it points to. It
+// returns the payload when data holds it, inline or as itself, and otherwise where to read it
+// from.
+func decodeEnvelope(data []byte, o *options) ([]byte, *payloadSource, envelope, error) {
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		// If stdin isn't JSON, treat it as the full payload.
+		return data, nil, envelope{}, nil
+	}
+
+	payloadPathAny := envelopeField(fields, "payload_path", "payload-path")
+	payloadFDAny := envelopeField(fields, "payload_fd", "payload-fd")
+	// output_path is only an envelope field; on a bare payload it would just be payload data.
+	var env envelope
+	env.invocationID, _ = fields[invocation.Field].(string)
+	if n, ok := envelopeField(fields, "schema_version", "schema-version").(float64); ok {
+		v := int(n)
+		env.schemaVersion = &v
+	}
+	if v := envelopeField(fields, "min_sdk_version", "min-sdk-version"); v != nil {
+		if err := checkMinSDKVersion(v); err != nil {
+			return nil, nil, env, err
+		}
+	}
+	if inline, ok, err := inlinePayload(data, fields); ok || err != nil {
+		if err == nil && (payloadPathAny != nil || payloadFDAny != nil) {
+			err = fmt.Errorf("%w: both payload and payload_path (or payload_fd) are set", ErrInvalidEnvelope)
+		}
+		if err == nil {
+			var format PayloadFormat
+			if format, err = payloadFormat(fields); format == PayloadFormatCBOR {
+				err = fmt.Errorf("%w: an inline payload is always JSON; payload_format cbor needs payload_path or payload_fd", ErrInvalidEnvelope)
+			}
+		}
+		env.outputPath, _ = envelopeField(fields, "output_path", "output-path").(string)
+		env.signature, _ = fields["signature"].(string)
+		if err == nil {
+			env.capabilities, err = envelopeCapabilities(fields)
+		}
+		return inline, nil, env, err
+	}
+	if payloadPathAny == nil && payloadFDAny == nil {
+		return data, nil, env, nil
+	}
+	if payloadPathAny != nil && payloadFDAny != nil {
+		return nil, nil, env, fmt.Errorf("%w: both payload_path and payload_fd are set", ErrInvalidEnvelope)
+	}
+
+	src := &payloadSource{fd: -1}
+	if payloadFDAny != nil {
+		n, ok := payloadFDAny.(float64)
+		if !ok || n != float64(int(n)) {
+			return nil, nil, env, fmt.Errorf("%w: payload_fd must be an integer", ErrInvalidEnvelope)
+		}
+		src.fd = int(n)
+		src.name = fmt.Sprintf("payload_fd %d", src.fd)
+	} else {
+		var ok bool
+		src.path, ok = payloadPathAny.(string)
+		if !ok || src.path == "" {
+			return nil, nil, env, fmt.Errorf("%w: payload_path must be a non-empty string", ErrInvalidEnvelope)
+		}
+		src.name = "payload_path " + src.path
+		env.payloadPath = src.path
+		env.cleanup, _ = fields["cleanup"].(bool)
+	}
+	env.outputPath, _ = envelopeField(fields, "output_path", "output-path").(string)
+	env.signature, _ = fields["signature"].(string)
+	var err error
+	if env.capabilities, err = envelopeCapabilities(fields); err != nil {
+		return nil, nil, env, err
+	}
+
+	encoding, _ := envelopeField(fields, "payload_encoding", "payload-encoding").(string)
+	switch encoding {
+	case "", "identity", "gzip":
+	default:
+		return nil, nil, env, fmt.Errorf("%w: unsupported payload_encoding %q", ErrInvalidEnvelope, encoding)
+	}
+	src.gzip = encoding == "gzip"
+	if env.format, err = payloadFormat(fields); err != nil {
+		return nil, nil, env, err
+	}
+
+	src.checksum, _ = envelopeField(fields, "payload_sha256", "payload-sha256").(string)
+	if src.checksum == "" && o.requireChecksum {
+		return nil, nil, env, fmt.Errorf("%w for %s", ErrChecksumMissing, src.name)
+	}
+	return nil, src, env, nil
+}
+
+// payloadFormat returns the envelope's `payload_format`: PayloadFormatCBOR, or "" for JSON, which
+// it also is when the field is absent.
+func payloadFormat(fields map[string]any) (PayloadFormat, error) {
+	format, _ := envelopeField(fields, "payload_format", "payload-format").(string)
+	switch PayloadFormat(format) {
+	case "", PayloadFormatJSON:
+		return "", nil
+	case PayloadFormatCBOR:
+		return PayloadFormatCBOR, nil
+	}
+	return "", fmt.Errorf("%w: unsupported payload_format %q", ErrInvalidEnvelope, format)
+}
+
+// inlinePayload returns the raw bytes of the envelope's `payload` field, if it has one. The host
+// embeds medium-sized payloads this way to avoid a temp file; only objects and arrays are valid.
+func inlinePayload(data []byte, fields map[string]any) ([]byte, bool, error) {
+	if envelopeField(fields, "payload") == nil {
+		return nil, false, nil
+	}
+	var env struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, true, fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+	raw := bytes.TrimSpace(env.Payload)
+	if len(raw) == 0 || (raw[0] != '{' && raw[0] != '[') {
+		return nil, true, fmt.Errorf("%w: inline payload must be a JSON object or array", ErrInvalidEnvelope)
+	}
+	return raw, true, nil
+}
+
+// payloadPathError wraps a failure to read the payload_path file. Cancellation, the size limit, and
+// WithAllowedPayloadDirs refusals are passed through unchanged since they aren't about the file
+// being unreadable.
+func payloadPathError(path string, err error) error {
+	var tooLarge *PayloadTooLargeError
+	if errors.As(err, &tooLarge) || errors.Is(err, ErrPayloadPathNotAllowed) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &PayloadPathError{Path: path, Err: err}
+}
+
+// envelopeField returns the first non-null value among keys (the current name first, then legacy
+// spellings).
+func envelopeField(fields map[string]any, keys ...string) any {
+	for _, key := range keys {
+		if v, ok := fields[key]; ok && v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func verifyChecksum(data []byte, want string) error {
+	sum := sha256.Sum256(data)
+	got := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(got, want) {
+		return fmt.Errorf("%w: want sha256 %s, got %s", ErrChecksumMismatch, want, got)
+	}
+	return nil
+}
+
+func hasGzipMagic(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+func gunzip(ctx context.Context, data []byte, limit int64, source string) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return readAllLimit(ctx, zr, limit, source)
+}
+
+// removePayloadFile deletes a payload file that has already been read. Failing to delete it must
+// not fail the hook, so errors are only logged.
+func removePayloadFile(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		writeLogLine(os.Stderr, "warn", "cleanup_payload", err)
+	}
+}
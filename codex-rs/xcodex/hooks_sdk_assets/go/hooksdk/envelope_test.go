@@ -0,0 +1,214 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// envelopeWith returns the payload_path envelope of payload with fields added, and the file path.
+func envelopeWith(t *testing.T, payload []byte, fields map[string]any) ([]byte, string) {
+	t.Helper()
+	var env map[string]any
+	if err := json.Unmarshal(hooktest.WriteEnvelope(t, payload), &env); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range fields {
+		env[k] = v
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, env["payload_path"].(string)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestPayloadFileCleanup(t *testing.T) {
+	payload := hooktest.ToolCallFinished().Bytes()
+	tests := []struct {
+		name    string
+		fields  map[string]any
+		opts    []hooksdk.Option
+		removed bool
+	}{
+		{"no flag", nil, nil, false},
+		{"cleanup false", map[string]any{"cleanup": false}, nil, false},
+		{"cleanup true", map[string]any{"cleanup": true}, nil, true},
+		{"WithCleanupPayloadFile", nil, []hooksdk.Option{hooksdk.WithCleanupPayloadFile()}, true},
+	}
+	for _, tt := range tests {
+		stdin, path := envelopeWith(t, payload, tt.fields)
+		if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), tt.opts...); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if exists(path) == tt.removed {
+			t.Errorf("%s: file exists = %v, want %v", tt.name, exists(path), !tt.removed)
+		}
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pathEnvelope writes data to name in a temp dir and returns the envelope naming it, with fields.
+func pathEnvelope(t *testing.T, name string, data []byte, fields map[string]any) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]any{"payload_path": path}
+	for k, v := range fields {
+		env[k] = v
+	}
+	stdin, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stdin
+}
+
+func TestGzipPayloadFile(t *testing.T) {
+	payload := hooktest.ToolCallFinished().WithSessionID("gz").Bytes()
+	gz := gzipBytes(t, payload)
+	tests := []struct {
+		name  string
+		stdin []byte
+	}{
+		{"payload_encoding gzip", pathEnvelope(t, "payload.json", gz, map[string]any{"payload_encoding": "gzip"})},
+		{"payload-encoding gzip", pathEnvelope(t, "payload.json", gz, map[string]any{"payload-encoding": "gzip"})},
+		{"sniffed", pathEnvelope(t, "payload.json.gz", gz, nil)},
+		{"plain file named .gz", pathEnvelope(t, "payload.json.gz", payload, nil)},
+	}
+	for _, tt := range tests {
+		p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(tt.stdin))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if p.SessionID() != "gz" {
+			t.Errorf("%s: session id = %q, want gz", tt.name, p.SessionID())
+		}
+	}
+}
+
+func TestGzipPayloadFileTruncated(t *testing.T) {
+	gz := gzipBytes(t, hooktest.ToolCallFinished().Bytes())
+	stdin := pathEnvelope(t, "payload.json.gz", gz[:len(gz)/2], map[string]any{"payload_encoding": "gzip"})
+	_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithPayloadRetry(0))
+	if err == nil || !strings.Contains(err.Error(), "decompress") {
+		t.Errorf("error = %v, want a decompression error", err)
+	}
+}
+
+func TestUnsupportedPayloadEncoding(t *testing.T) {
+	stdin := pathEnvelope(t, "payload.json", hooktest.SessionStart().Bytes(), map[string]any{"payload_encoding": "br"})
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin)); !errors.Is(err, hooksdk.ErrInvalidEnvelope) {
+		t.Errorf("error = %v, want ErrInvalidEnvelope", err)
+	}
+}
+
+func TestPayloadChecksum(t *testing.T) {
+	payload := hooktest.SessionStart().Bytes()
+	sum := sha256.Sum256(payload)
+	good := hex.EncodeToString(sum[:])
+	bad := strings.Repeat("0", len(good))
+	tests := []struct {
+		name    string
+		fields  map[string]any
+		require bool
+		want    error
+	}{
+		{"match", map[string]any{"payload_sha256": good}, false, nil},
+		{"match, dashed key", map[string]any{"payload-sha256": good}, false, nil},
+		{"match, required", map[string]any{"payload_sha256": good}, true, nil},
+		{"mismatch", map[string]any{"payload_sha256": bad}, false, hooksdk.ErrChecksumMismatch},
+		{"absent", nil, false, nil},
+		{"absent, required", nil, true, hooksdk.ErrChecksumMissing},
+	}
+	for _, tt := range tests {
+		stdin := pathEnvelope(t, "payload.json", payload, tt.fields)
+		var opts []hooksdk.Option
+		if tt.require {
+			opts = append(opts, hooksdk.RequireChecksum())
+		}
+		_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), opts...)
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// The checksum covers the file as written, compressed or not.
+	gz := gzipBytes(t, payload)
+	sum = sha256.Sum256(gz)
+	stdin := pathEnvelope(t, "payload.json.gz", gz, map[string]any{"payload_sha256": hex.EncodeToString(sum[:])})
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin)); err != nil {
+		t.Errorf("gzipped file: %v", err)
+	}
+
+	// Payloads on stdin have nothing to verify.
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(payload), hooksdk.RequireChecksum()); err != nil {
+		t.Errorf("inline payload with RequireChecksum: %v", err)
+	}
+}
+
+func TestInlinePayload(t *testing.T) {
+	payload := hooktest.SessionStart().WithSessionID("inline").Map()
+	stdin, _ := json.Marshal(map[string]any{"payload": payload})
+	p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SessionID() != "inline" {
+		t.Errorf("session id = %q, want inline", p.SessionID())
+	}
+
+	// Arrays are passed on as they are, for the parser to judge.
+	got, _, err := hooksdk.ParseEnvelope([]byte(`{"payload": [1, 2]}`))
+	if err != nil || string(got) != "[1, 2]" {
+		t.Errorf("ParseEnvelope(array payload) = %s, %v", got, err)
+	}
+}
+
+func TestInlinePayloadErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.json")
+	tests := map[string]string{
+		"payload and payload_path": `{"payload": {}, "payload_path": "` + path + `"}`,
+		"payload and payload_fd":   `{"payload": {}, "payload_fd": 3}`,
+		"string payload":           `{"payload": "{}"}`,
+		"number payload":           `{"payload": 3}`,
+		"boolean payload":          `{"payload": true}`,
+		"cbor inline payload":      `{"payload": {}, "payload_format": "cbor"}`,
+	}
+	for name, stdin := range tests {
+		if _, _, err := hooksdk.ParseEnvelope([]byte(stdin)); !errors.Is(err, hooksdk.ErrInvalidEnvelope) {
+			t.Errorf("%s: error = %v, want ErrInvalidEnvelope", name, err)
+		}
+	}
+}
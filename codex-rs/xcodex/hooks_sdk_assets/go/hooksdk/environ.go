@@ -0,0 +1,201 @@
+package hooksdk
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// Environment variables read into Env, besides PayloadPathEnv, PayloadFDEnv, MaxPayloadEnv,
+// PayloadRetryEnv, SecretEnv, SocketEnv and DebugDirEnv. xcodex itself sets only CODEX_HOME on hook
+// processes; the others are for wrappers, hook runners, and running a hook by hand.
+const (
+	CodexHomeEnv = "CODEX_HOME"
+	HookNameEnv  = "CODEX_HOOK_NAME"
+	EventTypeEnv = "CODEX_HOOK_EVENT"
+	SessionIDEnv = "CODEX_HOOK_SESSION_ID"
+	DebugEnv     = "CODEX_HOOK_DEBUG"
+	LogLevelEnv  = "CODEX_HOOK_LOG_LEVEL"
+	LogFormatEnv = "CODEX_HOOK_LOG_FORMAT"
+	TimeoutEnv   = "CODEX_HOOK_TIMEOUT_MS"
+	// DryRunEnv turns on dry-run mode (see WithDryRun): for every hook when it is true (1, true,
+	// ...), or for the hooks it lists, comma-separated, by CODEX_HOOK_NAME or executable name.
+	DryRunEnv = "CODEX_HOOK_DRY_RUN"
+	// TZEnv is the IANA name of the time zone (e.g. `Europe/Berlin`) that notifications, emails,
+	// and summaries show times in; unset, they use the machine's zone (see summarize.Location).
+	TZEnv = "CODEX_HOOK_TZ"
+	// CapabilitiesEnv lists, comma-separated, the optional response fields the host acts on, such
+	// as CapabilityTelemetry, for hosts that don't list them in the envelope (see HostSupports).
+	CapabilitiesEnv = "CODEX_HOOK_CAPABILITIES"
+)
+
+// Env holds the CODEX_* environment variables a hook reads. Get it with Environ, or FromMap in
+// tests.
+type Env struct {
+	// CodexHome is CODEX_HOME. When it is unset or empty, it is the first of
+	// `$XDG_STATE_HOME/xcodex`, `~/.xcodex`, and `<temp dir>/xcodex-<uid>` that can be written to
+	// (see CodexHomeSource). Use Path to build paths under it.
+	CodexHome string
+	// CodexHomeSource says which of those CodexHome is; the choice of a fallback is logged with
+	// hooklog.
+	CodexHomeSource CodexHomeSource
+	// CodexHomeErr is a *CodexHomeError when CODEX_HOME is unset and not even the temp dir could
+	// be written to; CodexHome is then the temp dir's, which writes will fail in.
+	CodexHomeErr error
+	// HookName is CODEX_HOOK_NAME. Most hooks want hooklog.HookName, which falls back to the
+	// executable's name.
+	HookName string
+	// EventType and SessionID are hints from CODEX_HOOK_EVENT and CODEX_HOOK_SESSION_ID, for
+	// routing before the payload is read; the payload is authoritative.
+	EventType string
+	SessionID string
+	// Debug is set by a true CODEX_HOOK_DEBUG (1, true, ...) or CODEX_HOOK_LOG_LEVEL=debug.
+	Debug     bool
+	LogLevel  string
+	LogFormat string
+	// DebugDir is CODEX_HOOK_DEBUG_DIR (see DebugDirEnv).
+	DebugDir string
+	// DryRun is set when CODEX_HOOK_DRY_RUN turns dry-run mode on for this hook (see DryRunEnv).
+	DryRun bool
+	// TZ is CODEX_HOOK_TZ (see TZEnv).
+	TZ string
+	// PayloadPath is CODEX_HOOK_PAYLOAD_PATH (see PayloadPathEnv).
+	PayloadPath string
+	// PayloadFD is CODEX_HOOK_PAYLOAD_FD (see PayloadFDEnv), or 0 when it is unset or not a
+	// descriptor of 3 or above.
+	PayloadFD int
+	// MaxPayloadBytes is CODEX_HOOK_MAX_PAYLOAD, or DefaultMaxPayloadBytes when it is unset or not
+	// a byte count; 0 disables the limit.
+	MaxPayloadBytes int64
+	// PayloadRetry is CODEX_HOOK_PAYLOAD_RETRY_MS, or DefaultPayloadRetry when it is unset or not a
+	// number of milliseconds; 0 disables the retry.
+	PayloadRetry time.Duration
+	// Secret is CODEX_HOOK_SECRET (see SecretEnv).
+	Secret string
+	// Socket is CODEX_HOOKD_SOCKET (see SocketEnv); DefaultSocketPath applies the default.
+	Socket string
+	// Timeout is CODEX_HOOK_TIMEOUT_MS, the time the host gives the hook before killing it, or 0
+	// when it is unset or not a positive number of milliseconds (see RunWithTimeout).
+	Timeout time.Duration
+	// Capabilities is CODEX_HOOK_CAPABILITIES, split at commas (see Supports).
+	Capabilities []string
+}
+
+// Environ returns the hook's Env, read from the process environment.
+func Environ() Env {
+	return newEnv(os.Getenv, os.UserHomeDir, os.TempDir)
+}
+
+// FromMap returns the Env described by vars instead of the process environment, for tests. The
+// CodexHome fallbacks use vars' XDG_STATE_HOME, HOME (or USERPROFILE), and TMPDIR (or TEMP or
+// TMP) when present, and the real home and temp directories otherwise.
+func FromMap(vars map[string]string) Env {
+	return envFrom(func(key string) string { return vars[key] })
+}
+
+// envFrom is the Env read with getenv, whose HOME (or USERPROFILE) is the home directory and
+// TMPDIR (or TEMP or TMP) the temp directory when set.
+func envFrom(getenv func(string) string) Env {
+	homeDir := func() (string, error) {
+		for _, key := range []string{"HOME", "USERPROFILE"} {
+			if home := getenv(key); home != "" {
+				return home, nil
+			}
+		}
+		return os.UserHomeDir()
+	}
+	tempDir := func() string {
+		for _, key := range []string{"TMPDIR", "TEMP", "TMP"} {
+			if dir := getenv(key); dir != "" {
+				return dir
+			}
+		}
+		return os.TempDir()
+	}
+	return newEnv(getenv, homeDir, tempDir)
+}
+
+func newEnv(getenv func(string) string, homeDir func() (string, error), tempDir func() string) Env {
+	home := resolveCodexHome(getenv, homeDir, tempDir)
+	e := Env{
+		CodexHome:       home.dir,
+		CodexHomeSource: home.source,
+		CodexHomeErr:    home.err,
+		HookName:        getenv(HookNameEnv),
+		EventType:       strings.TrimSpace(getenv(EventTypeEnv)),
+		SessionID:       strings.TrimSpace(getenv(SessionIDEnv)),
+		LogLevel:        getenv(LogLevelEnv),
+		LogFormat:       getenv(LogFormatEnv),
+		DebugDir:        getenv(DebugDirEnv),
+		PayloadPath:     getenv(PayloadPathEnv),
+		MaxPayloadBytes: DefaultMaxPayloadBytes,
+		PayloadRetry:    DefaultPayloadRetry,
+		Secret:          getenv(SecretEnv),
+		Socket:          getenv(SocketEnv),
+		TZ:              strings.TrimSpace(getenv(TZEnv)),
+	}
+	e.Debug, _ = strconv.ParseBool(getenv(DebugEnv))
+	if strings.EqualFold(strings.TrimSpace(e.LogLevel), "debug") {
+		e.Debug = true
+	}
+	e.DryRun = dryRunFor(getenv(DryRunEnv), e.HookName)
+	if v := getenv(MaxPayloadEnv); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 {
+			e.MaxPayloadBytes = n
+		}
+	}
+	if ms, err := strconv.ParseInt(strings.TrimSpace(getenv(PayloadRetryEnv)), 10, 64); err == nil && ms >= 0 && ms <= math.MaxInt64/int64(time.Millisecond) {
+		e.PayloadRetry = time.Duration(ms) * time.Millisecond
+	}
+	if fd, err := strconv.Atoi(strings.TrimSpace(getenv(PayloadFDEnv))); err == nil && fd >= 3 {
+		e.PayloadFD = fd
+	}
+	if ms, err := strconv.ParseInt(strings.TrimSpace(getenv(TimeoutEnv)), 10, 64); err == nil && ms > 0 && ms <= math.MaxInt64/int64(time.Millisecond) {
+		e.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	for _, c := range strings.Split(getenv(CapabilitiesEnv), ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			e.Capabilities = append(e.Capabilities, c)
+		}
+	}
+	return e
+}
+
+// dryRunFor reports whether the CODEX_HOOK_DRY_RUN value v covers the hook named name, or, when
+// that is empty, hooklog.HookName.
+func dryRunFor(v, name string) bool {
+	if on, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+		return on
+	}
+	if name == "" {
+		name = hooklog.HookName()
+	}
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n != "" && n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Supports reports whether the host said it acts on capability (see CapabilitiesEnv), e.g.
+// CapabilityTelemetry. Hosts that say nothing support none. HostSupports also sees the
+// capabilities of the envelope.
+func (e Env) Supports(capability string) bool {
+	for _, c := range e.Capabilities {
+		if strings.EqualFold(c, capability) {
+			return true
+		}
+	}
+	return false
+}
+
+// Path joins elem onto CodexHome, e.g. Path("hooks", "state") for `$CODEX_HOME/hooks/state`.
+func (e Env) Path(elem ...string) string {
+	return filepath.Join(append([]string{e.CodexHome}, elem...)...)
+}
@@ -0,0 +1,144 @@
+package hooksdk_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestFromMapCodexHome(t *testing.T) {
+	home, profile := t.TempDir(), t.TempDir()
+	tests := []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{"set", map[string]string{"CODEX_HOME": "/srv/codex", "HOME": home}, "/srv/codex"},
+		{"unset", map[string]string{"HOME": home}, filepath.Join(home, ".xcodex")},
+		{"empty", map[string]string{"CODEX_HOME": "", "HOME": home}, filepath.Join(home, ".xcodex")},
+		{"userprofile", map[string]string{"USERPROFILE": profile}, filepath.Join(profile, ".xcodex")},
+		{"home first", map[string]string{"HOME": home, "USERPROFILE": profile}, filepath.Join(home, ".xcodex")},
+		// A Windows path is kept as given.
+		{"windows", map[string]string{"CODEX_HOME": `C:\Users\u\.xcodex`}, `C:\Users\u\.xcodex`},
+	}
+	for _, tt := range tests {
+		if got := hooksdk.FromMap(tt.vars).CodexHome; got != tt.want {
+			t.Errorf("%s: CodexHome = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEnvPath(t *testing.T) {
+	e := hooksdk.FromMap(map[string]string{"CODEX_HOME": "/srv/codex"})
+	if got, want := e.Path("hooks", "state"), filepath.Join("/srv/codex", "hooks", "state"); got != want {
+		t.Errorf("Path = %q, want %q", got, want)
+	}
+	if got := e.Path(); got != filepath.Clean("/srv/codex") {
+		t.Errorf("Path() = %q", got)
+	}
+	if runtime.GOOS == "windows" {
+		e = hooksdk.FromMap(map[string]string{"CODEX_HOME": `C:\Users\u\.xcodex`})
+		if got := e.Path("hooks", "logs"); got != `C:\Users\u\.xcodex\hooks\logs` {
+			t.Errorf("Path on Windows = %q", got)
+		}
+	}
+}
+
+func TestFromMapFields(t *testing.T) {
+	e := hooksdk.FromMap(map[string]string{
+		hooksdk.HookNameEnv:    "guard",
+		hooksdk.EventTypeEnv:   " tool-call-started\n",
+		hooksdk.SessionIDEnv:   " s1 ",
+		hooksdk.LogLevelEnv:    "info",
+		hooksdk.LogFormatEnv:   "json",
+		hooksdk.PayloadPathEnv: "/tmp/payload.json",
+		hooksdk.MaxPayloadEnv:  "1024",
+		hooksdk.SecretEnv:      "key",
+		hooksdk.SocketEnv:      "/tmp/hookd.sock",
+	})
+	got := hooksdk.Env{
+		HookName:        e.HookName,
+		EventType:       e.EventType,
+		SessionID:       e.SessionID,
+		LogLevel:        e.LogLevel,
+		LogFormat:       e.LogFormat,
+		PayloadPath:     e.PayloadPath,
+		MaxPayloadBytes: e.MaxPayloadBytes,
+		Secret:          e.Secret,
+		Socket:          e.Socket,
+	}
+	want := hooksdk.Env{
+		HookName:        "guard",
+		EventType:       "tool-call-started",
+		SessionID:       "s1",
+		LogLevel:        "info",
+		LogFormat:       "json",
+		PayloadPath:     "/tmp/payload.json",
+		MaxPayloadBytes: 1024,
+		Secret:          "key",
+		Socket:          "/tmp/hookd.sock",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FromMap = %+v, want %+v", got, want)
+	}
+
+	if got := hooksdk.FromMap(nil); got.MaxPayloadBytes != hooksdk.DefaultMaxPayloadBytes || got.Debug || got.HookName != "" {
+		t.Errorf("FromMap(nil) = %+v", got)
+	}
+	for v, want := range map[string]int64{"0": 0, "-1": hooksdk.DefaultMaxPayloadBytes, "1MB": hooksdk.DefaultMaxPayloadBytes, "": hooksdk.DefaultMaxPayloadBytes} {
+		if got := hooksdk.FromMap(map[string]string{hooksdk.MaxPayloadEnv: v}).MaxPayloadBytes; got != want {
+			t.Errorf("%s=%q: MaxPayloadBytes = %d, want %d", hooksdk.MaxPayloadEnv, v, got, want)
+		}
+	}
+}
+
+func TestEnvDebug(t *testing.T) {
+	for vars, want := range map[[2]string]bool{
+		{"1", ""}:         true,
+		{"true", ""}:      true,
+		{"0", ""}:         false,
+		{"yes", ""}:       false,
+		{"", "debug"}:     true,
+		{"", " DEBUG "}:   true,
+		{"", "info"}:      false,
+		{"false", "info"}: false,
+	} {
+		e := hooksdk.FromMap(map[string]string{hooksdk.DebugEnv: vars[0], hooksdk.LogLevelEnv: vars[1]})
+		if e.Debug != want {
+			t.Errorf("%s=%q %s=%q: Debug = %v, want %v", hooksdk.DebugEnv, vars[0], hooksdk.LogLevelEnv, vars[1], e.Debug, want)
+		}
+	}
+}
+
+func TestEnvSupports(t *testing.T) {
+	e := hooksdk.FromMap(map[string]string{hooksdk.CapabilitiesEnv: " modify,, Telemetry ,"})
+	if !reflect.DeepEqual(e.Capabilities, []string{"modify", "Telemetry"}) {
+		t.Errorf("Capabilities = %q", e.Capabilities)
+	}
+	if !e.Supports(hooksdk.CapabilityTelemetry) || !e.Supports("MODIFY") || e.Supports("question") || e.Supports("") {
+		t.Errorf("Supports is wrong for %q", e.Capabilities)
+	}
+	// Hosts that say nothing support nothing.
+	if e := hooksdk.FromMap(nil); e.Capabilities != nil || e.Supports(hooksdk.CapabilityTelemetry) {
+		t.Errorf("unset: Capabilities = %q", e.Capabilities)
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv(hooksdk.CodexHomeEnv, "")
+	t.Setenv(hooksdk.HookNameEnv, "from-env")
+	e := hooksdk.Environ()
+	if e.CodexHome != filepath.Join(home, ".xcodex") || e.HookName != "from-env" {
+		t.Errorf("Environ = %+v", e)
+	}
+	t.Setenv(hooksdk.CodexHomeEnv, "/srv/codex")
+	if got := hooksdk.Environ().CodexHome; got != "/srv/codex" {
+		t.Errorf("CodexHome = %q, want /srv/codex", got)
+	}
+}
@@ -0,0 +1,81 @@
+package hooksdk
+
+import (
+	"errors"
+	"io"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// ErrorPolicy is what Run answers when the hook can't decide: the payload can't be read (a bad
+// envelope, an unreadable payload_path, a schema mismatch, ...), the handler returns an error or
+// panics, or its response is invalid. Without one Run writes no response and exits with ExitError,
+// leaving the decision to the host's own default.
+type ErrorPolicy int
+
+const (
+	// FailOpen allows the action, with a system_message saying what failed, for hooks whose work
+	// is best-effort (loggers, notifiers, exporters) and shouldn't stop the agent when they break.
+	// The failure is still reported on stderr, so a sink that is down shows up in the host's log.
+	FailOpen ErrorPolicy = iota + 1
+	// FailClosed denies the action with what failed as the reason, for hooks that guard something
+	// and mustn't let an action through unchecked.
+	FailClosed
+)
+
+// ReasonHookError is the reason code of the responses an ErrorPolicy makes.
+const ReasonHookError = "HOOK_ERROR"
+
+// String returns "fail-open" or "fail-closed", as the stderr record names the policy.
+func (p ErrorPolicy) String() string {
+	switch p {
+	case FailOpen:
+		return "fail-open"
+	case FailClosed:
+		return "fail-closed"
+	}
+	return "none"
+}
+
+// WithErrorPolicy makes Run answer the failures ErrorPolicy lists as p says instead of exiting
+// with ExitError: with an allow (ExitOK) for FailOpen, a deny (ExitDeny) for FailClosed. The
+// failure is still reported as a JSON line on stderr, with the policy in its "policy" field.
+//
+// It also sets the response to a panic, unless WithPanicDecision does, and the answer to an event
+// that needs a newer SDK (ErrSDKTooOld), which is then a deny under FailClosed. A response that
+// can't be written still exits with ExitError.
+func WithErrorPolicy(p ErrorPolicy) Option {
+	return func(o *options) { o.errorPolicy = p }
+}
+
+// policyResponse is the response the error policy gives for err.
+func (o *options) policyResponse(err error) Response {
+	msg := err.Error()
+	if name := hooklog.HookName(); name != "" {
+		msg = name + ": " + msg
+	}
+	code := ReasonHookError
+	if errors.Is(err, ErrSDKTooOld) {
+		code = "SDK_TOO_OLD"
+	}
+	if o.errorPolicy == FailClosed {
+		return Deny(msg, WithReasonCode(code))
+	}
+	resp := Allow()
+	resp.SystemMessage = msg
+	resp.ReasonCode = code
+	return resp
+}
+
+// fail reports err, from stage, on stderr and answers the event as the error policy says,
+// returning the exit code. Without a policy it writes no response and returns ExitError.
+func (o *options) fail(stdout, stderr io.Writer, env envelope, eventType, stage string, err error) int {
+	line := logLine("error", stage, err)
+	if o.errorPolicy == 0 {
+		writeLine(stderr, line)
+		return ExitError
+	}
+	line["policy"] = o.errorPolicy.String()
+	writeLine(stderr, line)
+	return finishRun(stdout, stderr, env, eventType, o, o.policyResponse(err))
+}
@@ -0,0 +1,101 @@
+package hooksdk_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestErrorPolicy(t *testing.T) {
+	t.Setenv("CODEX_HOOK_NAME", "guard")
+	ok := respond(hooksdk.Allow(), nil)
+	missing, _ := filepath.Abs(filepath.Join(t.TempDir(), "missing.json"))
+	failures := []struct {
+		name    string
+		stdin   []byte
+		handler hooksdk.Handler
+		opts    []hooksdk.Option
+		stage   string
+		// code and decision are the answer without a policy.
+		code     int
+		decision hooksdk.Decision
+	}{
+		{"bad JSON", []byte("not json"), ok, nil, "read_payload", hooksdk.ExitError, ""},
+		{"bad payload_format", pathEnvelope(t, "payload.json", hooktest.SessionStart().Bytes(), map[string]any{"payload_format": "msgpack"}), ok, nil, "read_payload", hooksdk.ExitError, ""},
+		{"missing payload_path", []byte(`{"payload_path": "` + filepath.ToSlash(missing) + `"}`), ok, []hooksdk.Option{hooksdk.WithPayloadRetry(0)}, "read_payload", hooksdk.ExitError, ""},
+		{"schema mismatch", hooktest.ToolCallFinished().With("status", "exploded").Bytes(), ok, []hooksdk.Option{hooksdk.WithValidation()}, "read_payload", hooksdk.ExitError, ""},
+		{"SDK too old", minVersionEnvelope(t, "min_sdk_version", "99.0.0"), ok, nil, "read_payload", hooksdk.ExitError, hooksdk.DecisionAllow},
+		{"handler error", hooktest.SessionStart().Bytes(), respond(hooksdk.Response{}, errors.New("boom")), nil, "handler", hooksdk.ExitError, ""},
+		{"panic", hooktest.SessionStart().Bytes(), func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) { panic("oops") }, nil, "handler", hooksdk.ExitOK, hooksdk.DecisionAllow},
+		{"bad modify", hooktest.ToolCallStarted().Bytes(), respond(hooksdk.Allow().ReplaceField("cwd", "/"), nil), nil, "modify", hooksdk.ExitError, ""},
+	}
+	for _, f := range failures {
+		code := "HOOK_ERROR"
+		if f.name == "SDK too old" {
+			code = "SDK_TOO_OLD"
+		}
+		for _, tt := range []struct {
+			policy   hooksdk.ErrorPolicy
+			code     int
+			decision hooksdk.Decision
+		}{
+			{0, f.code, f.decision},
+			{hooksdk.FailOpen, hooksdk.ExitOK, hooksdk.DecisionAllow},
+			{hooksdk.FailClosed, hooksdk.ExitDeny, hooksdk.DecisionDeny},
+		} {
+			opts := f.opts
+			if tt.policy != 0 {
+				opts = append(opts[:len(opts):len(opts)], hooksdk.WithErrorPolicy(tt.policy))
+			}
+			res := hooktest.RunHook(t, f.handler, f.stdin, opts...)
+			if res.ExitCode != tt.code || res.Response.Decision != tt.decision {
+				t.Errorf("%s, %v: exit %d, decision %q; want %d, %q", f.name, tt.policy, res.ExitCode, res.Response.Decision, tt.code, tt.decision)
+			}
+			line := errorLine(t, res.Stderr)
+			if line["level"] != "error" || line["stage"] != f.stage {
+				t.Errorf("%s, %v: stderr line = %v", f.name, tt.policy, line)
+			}
+			if policy, has := line["policy"]; tt.policy == 0 && has || tt.policy != 0 && policy != tt.policy.String() {
+				t.Errorf("%s, %v: stderr policy = %v", f.name, tt.policy, policy)
+			}
+			if tt.policy == 0 {
+				continue
+			}
+			// The response names the hook and the failure, where the host shows it.
+			resp := res.Response
+			msg := resp.SystemMessage
+			if tt.policy == hooksdk.FailClosed {
+				msg = resp.Reason
+			}
+			if resp.ReasonCode != code || !strings.HasPrefix(msg, "guard: ") || len(msg) <= len("guard: ") {
+				t.Errorf("%s, %v: response = %+v", f.name, tt.policy, resp)
+			}
+		}
+	}
+}
+
+func TestErrorPolicyPanicDecision(t *testing.T) {
+	// An explicit panic response wins over the policy's.
+	handler := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) { panic("oops") }
+	res := hooktest.RunHook(t, handler, hooktest.SessionStart().Bytes(),
+		hooksdk.WithErrorPolicy(hooksdk.FailClosed), hooksdk.WithPanicDecision(hooksdk.Allow()))
+	if res.ExitCode != hooksdk.ExitOK || res.Response.Decision != hooksdk.DecisionAllow || res.Response.ReasonCode != "" {
+		t.Errorf("got exit %d, response %+v; want the allow panic response", res.ExitCode, res.Response)
+	}
+	if line := errorLine(t, res.Stderr); line["panic"] != "oops" || line["policy"] != nil {
+		t.Errorf("stderr line = %v", line)
+	}
+}
+
+func TestErrorPolicyString(t *testing.T) {
+	for p, want := range map[hooksdk.ErrorPolicy]string{0: "none", hooksdk.FailOpen: "fail-open", hooksdk.FailClosed: "fail-closed"} {
+		if got := p.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", int(p), got, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package hooksdk
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Errors returned while reading a payload. Match them with errors.Is; the payload_path failures
+// also carry the path as a *PayloadPathError (see errors.As). ErrUnknownEventType is defined with
+// the event types.
+var (
+	// ErrEmptyPayload is returned when the payload itself (not stdin, which defaults to `{}`) is
+	// empty, e.g. a zero-byte payload_path file.
+	ErrEmptyPayload = errors.New("empty hook payload")
+	// ErrNoPayload is returned when stdin is an interactive terminal and no payload file is named
+	// by CODEX_HOOK_PAYLOAD_PATH or the first argument: the hook was run by hand without input, and
+	// reading the terminal would wait for EOF.
+	ErrNoPayload = errors.New("no hook payload")
+	// ErrInvalidEnvelope is returned for a stdin envelope that can't be resolved: a non-string
+	// payload_path, an unsupported payload_encoding, or a conflicting/invalid inline payload.
+	ErrInvalidEnvelope = errors.New("invalid payload envelope")
+	// ErrPayloadPathUnreadable is returned when the payload_path file can't be opened, read, or
+	// decompressed.
+	ErrPayloadPathUnreadable = errors.New("payload_path unreadable")
+	// ErrPayloadFDNotOpen is returned when a stdin envelope's `payload_fd` names a file descriptor
+	// the hook wasn't started with (see PayloadFDEnv).
+	ErrPayloadFDNotOpen = errors.New("payload_fd not open")
+	// ErrChecksumMismatch is returned when the payload_path file doesn't match the envelope's
+	// `payload_sha256`, i.e. it was modified after the host wrote it.
+	ErrChecksumMismatch = errors.New("payload checksum mismatch")
+	// ErrChecksumMissing is returned under RequireChecksum when a payload_path envelope carries no
+	// `payload_sha256`.
+	ErrChecksumMissing = errors.New("payload checksum missing")
+	// ErrBadSignature is returned when the envelope's `signature` doesn't match the payload under
+	// any key in CODEX_HOOK_SECRET, i.e. the caller doesn't know the secret.
+	ErrBadSignature = errors.New("payload signature mismatch")
+	// ErrSignatureMissing is returned under RequireSignature when the payload comes without a
+	// signature to verify.
+	ErrSignatureMissing = errors.New("payload signature missing")
+)
+
+// PayloadPathError reports a payload_path file that couldn't be read. It matches
+// ErrPayloadPathUnreadable with errors.Is and unwraps to the underlying error.
+type PayloadPathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PayloadPathError) Error() string {
+	return "read payload_path " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *PayloadPathError) Unwrap() error { return e.Err }
+
+func (e *PayloadPathError) Is(target error) bool { return target == ErrPayloadPathUnreadable }
+
+func isBlank(data []byte) bool {
+	return len(bytes.TrimSpace(data)) == 0
+}
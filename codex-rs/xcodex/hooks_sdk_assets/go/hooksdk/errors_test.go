@@ -0,0 +1,76 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestReadPayloadErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.json")
+	tests := []struct {
+		name  string
+		stdin string
+		want  error
+	}{
+		{"blank stdin", "  \n", hooksdk.ErrEmptyPayload},
+		{"empty payload file", `{"payload_path": "` + empty + `"}`, hooksdk.ErrEmptyPayload},
+		{"non-string payload_path", `{"payload_path": 3}`, hooksdk.ErrInvalidEnvelope},
+		{"missing payload file", `{"payload_path": "` + missing + `"}`, hooksdk.ErrPayloadPathUnreadable},
+		{"payload_fd not open", `{"payload_fd": 97}`, hooksdk.ErrPayloadFDNotOpen},
+	}
+	for _, tt := range tests {
+		_, err := hooksdk.ReadPayloadFrom(strings.NewReader(tt.stdin), hooksdk.WithPayloadRetry(0))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestPayloadPathError(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	stdin, _ := json.Marshal(map[string]string{"payload_path": missing})
+	_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithPayloadRetry(0))
+	var pathErr *hooksdk.PayloadPathError
+	if !errors.As(err, &pathErr) {
+		t.Fatalf("error = %v, want *PayloadPathError", err)
+	}
+	if pathErr.Path != missing {
+		t.Errorf("Path = %q, want %q", pathErr.Path, missing)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("error = %v, want it to wrap os.ErrNotExist", err)
+	}
+}
+
+func TestParseHookPayloadUnknownEventTypeError(t *testing.T) {
+	_, err := hooksdk.ParseHookPayloadStrict(hooktest.New("plan-updated", "").Bytes())
+	if !errors.Is(err, hooksdk.ErrUnknownEventType) {
+		t.Errorf("error = %v, want ErrUnknownEventType", err)
+	}
+}
+
+func TestMustReadPayload(t *testing.T) {
+	read := func(stdin string) (p *hooksdk.HookPayload, panicked any) {
+		defer func() { panicked = recover() }()
+		return hooksdk.MustReadPayload(hooksdk.WithIO(hooksdk.IO{In: strings.NewReader(stdin), Getenv: func(string) string { return "" }})), nil
+	}
+	if p, panicked := read(string(hooktest.SessionStart().WithSessionID("s").Bytes())); panicked != nil || p.SessionID() != "s" {
+		t.Errorf("MustReadPayload(valid) = %v, panic %v", p, panicked)
+	}
+	if _, panicked := read("not json"); panicked == nil {
+		t.Errorf("MustReadPayload(invalid) didn't panic")
+	}
+}
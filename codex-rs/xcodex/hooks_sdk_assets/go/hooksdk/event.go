@@ -0,0 +1,58 @@
+package hooksdk
+
+import "encoding/json"
+
+//go:generate go run ./internal/gen
+
+// Event is a payload decoded into the struct of its event type (see HookPayload.Event): one of the
+// generated *<EventType>Payload structs in events_gen.go, or an *UnknownPayload for event types
+// the SDK has no schema for. Use a type switch to handle each:
+//
+//	switch e := ev.(type) {
+//	case *hooksdk.ToolCallFinishedPayload:
+//		log.Printf("%s took %dms", e.ToolName, e.DurationMs)
+//	case *hooksdk.UnknownPayload:
+//		// newer event type; e.Raw() has its fields
+//	}
+type Event interface {
+	Type() EventType
+	Raw() map[string]any
+}
+
+var _ Event = (*HookPayload)(nil)
+
+// UnknownPayload is the Event of a payload whose event type this SDK has no schema for, such as
+// one a newer host added: its event type as sent, and all of its fields. ParseHookPayload parses
+// such payloads without error (see ParseHookPayloadStrict to refuse them).
+type UnknownPayload struct {
+	RawPayload      map[string]any
+	XcodexEventType EventType
+}
+
+// Type returns the payload's event type.
+func (p *UnknownPayload) Type() EventType { return p.XcodexEventType }
+
+// Raw returns the full decoded payload object. It is not a copy; see Clone.
+func (p *UnknownPayload) Raw() map[string]any { return p.RawPayload }
+
+// Clone returns a deep copy of the payload.
+func (p *UnknownPayload) Clone() *UnknownPayload { return cloneStruct(p) }
+
+// ParseEvent parses data like ParseHookPayload (with the same options) and decodes it into the
+// struct of its event type.
+func ParseEvent(data []byte, opts ...Option) (Event, error) {
+	p, err := ParseHookPayload(data, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return p.Event()
+}
+
+// decodeRaw decodes a raw payload object into a typed struct.
+func decodeRaw(raw map[string]any, v any) error {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return unmarshalUseNumber(data, v)
+}
@@ -0,0 +1,135 @@
+// Package eventlog writes events to the Windows Event Log, under an event source of their own when
+// it can be registered.
+//
+// Registering a source writes to HKLM, which takes an elevated process. Without one, events go to
+// the Application log under FallbackSource instead. All of this is platform-independent; the calls
+// into Windows go through the System interface, which tests can replace with a fake. Elsewhere
+// than Windows, writes fail with ErrUnsupported.
+//
+//	w := eventlog.New("xcodex")
+//	source, err := w.Write(eventlog.Warning, 6, "approval-requested: rm -rf build")
+package eventlog
+
+import "errors"
+
+// ErrUnsupported is returned by writes on systems without the Windows Event Log.
+var ErrUnsupported = errors.New("eventlog: the Windows Event Log is only available on Windows")
+
+// ErrAccessDenied is returned (wrapped) by System.Install when registering a source needs an
+// elevated process.
+var ErrAccessDenied = errors.New("eventlog: access denied")
+
+// DefaultFallbackSource is the source events are written under when their own can't be
+// registered. Event Viewer finds no description for its events, but shows their message as the
+// event's data.
+const DefaultFallbackSource = "Application"
+
+// MessageFile is the message file sources are registered with. Its messages 1 to 1000 are the
+// text as reported, so Event Viewer shows an event's message as it was written; it is the file
+// `eventcreate` registers sources with.
+const MessageFile = `%SystemRoot%\System32\EventCreate.exe`
+
+// MaxEventID is the highest event id MessageFile has a message for.
+const MaxEventID = 1000
+
+// MaxMessage is the longest message ReportEvent takes, in UTF-16 code units; longer ones are cut.
+const MaxMessage = 31839
+
+// Level is an event's type: its level in Event Viewer.
+type Level int
+
+const (
+	Information Level = iota
+	Warning
+	Error
+)
+
+func (l Level) String() string {
+	switch l {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return "information"
+}
+
+// System is the part of Windows the package uses.
+type System interface {
+	// Installed reports whether source is registered in the Application log.
+	Installed(source string) (bool, error)
+	// Install registers source in the Application log, with messageFile for its messages. It fails
+	// with ErrAccessDenied (wrapped) when that needs elevation.
+	Install(source, messageFile string) error
+	// Report writes an event under source.
+	Report(source string, level Level, eventID uint32, message string) error
+}
+
+// Writer writes events under Source, registering it on first use if it isn't yet.
+type Writer struct {
+	Source string
+	// FallbackSource is used when Source isn't registered and can't be; "" means
+	// DefaultFallbackSource.
+	FallbackSource string
+	// System is Windows; New sets it to the real one.
+	System System
+
+	resolved string
+}
+
+// New returns a Writer for source.
+func New(source string) *Writer {
+	return &Writer{Source: source, System: system()}
+}
+
+// Write writes an event, cutting message to MaxMessage, and returns the source it was written
+// under: Source, or FallbackSource if Source can't be registered.
+func (w *Writer) Write(level Level, eventID uint32, message string) (source string, err error) {
+	source, err = w.source()
+	if err != nil {
+		return "", err
+	}
+	return source, w.System.Report(source, level, eventID, truncate(message, MaxMessage))
+}
+
+// source returns the source to write under, registering Source the first time if need be.
+func (w *Writer) source() (string, error) {
+	if w.resolved != "" {
+		return w.resolved, nil
+	}
+	installed, err := w.System.Installed(w.Source)
+	if err != nil {
+		return "", err
+	}
+	if !installed {
+		if err := w.System.Install(w.Source, MessageFile); err != nil {
+			if !errors.Is(err, ErrAccessDenied) {
+				return "", err
+			}
+			w.resolved = w.FallbackSource
+			if w.resolved == "" {
+				w.resolved = DefaultFallbackSource
+			}
+			return w.resolved, nil
+		}
+	}
+	w.resolved = w.Source
+	return w.resolved, nil
+}
+
+// truncate cuts s to at most max UTF-16 code units, without splitting a surrogate pair.
+func truncate(s string, max int) string {
+	n := 0
+	for i, r := range s {
+		size := 1
+		if r > 0xffff {
+			// A surrogate pair.
+			size = 2
+		}
+		if n+size > max {
+			return s[:i]
+		}
+		n += size
+	}
+	return s
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package eventlog
+
+func system() System { return unsupported{} }
+
+// unsupported is the System of platforms without the Event Log.
+type unsupported struct{}
+
+func (unsupported) Installed(string) (bool, error)             { return false, ErrUnsupported }
+func (unsupported) Install(string, string) error               { return ErrUnsupported }
+func (unsupported) Report(string, Level, uint32, string) error { return ErrUnsupported }
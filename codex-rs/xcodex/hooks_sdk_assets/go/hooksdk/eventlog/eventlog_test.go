@@ -0,0 +1,131 @@
+package eventlog_test
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/eventlog"
+)
+
+// fakeSystem records what a Writer asks of Windows.
+type fakeSystem struct {
+	installed  map[string]bool
+	installErr error
+	installs   int
+	reports    []report
+}
+
+type report struct {
+	source  string
+	level   eventlog.Level
+	id      uint32
+	message string
+}
+
+func (s *fakeSystem) Installed(source string) (bool, error) { return s.installed[source], nil }
+
+func (s *fakeSystem) Install(source, messageFile string) error {
+	s.installs++
+	if s.installErr != nil {
+		return s.installErr
+	}
+	if messageFile != eventlog.MessageFile {
+		return fmt.Errorf("message file %q", messageFile)
+	}
+	if s.installed == nil {
+		s.installed = map[string]bool{}
+	}
+	s.installed[source] = true
+	return nil
+}
+
+func (s *fakeSystem) Report(source string, level eventlog.Level, eventID uint32, message string) error {
+	s.reports = append(s.reports, report{source, level, eventID, message})
+	return nil
+}
+
+func TestWriteRegistersSource(t *testing.T) {
+	sys := &fakeSystem{}
+	w := &eventlog.Writer{Source: "xcodex", System: sys}
+	for i := 0; i < 2; i++ {
+		if source, err := w.Write(eventlog.Warning, 6, "approval-requested"); err != nil || source != "xcodex" {
+			t.Fatalf("Write = %q, %v", source, err)
+		}
+	}
+	if sys.installs != 1 || len(sys.reports) != 2 || sys.reports[0] != (report{"xcodex", eventlog.Warning, 6, "approval-requested"}) {
+		t.Errorf("%d installs, reports %+v", sys.installs, sys.reports)
+	}
+
+	// A registered source isn't registered again.
+	sys = &fakeSystem{installed: map[string]bool{"xcodex": true}, installErr: errors.New("unexpected")}
+	w = &eventlog.Writer{Source: "xcodex", System: sys}
+	if source, err := w.Write(eventlog.Information, 1, "m"); err != nil || source != "xcodex" || sys.installs != 0 {
+		t.Errorf("Write = %q, %v after %d installs", source, err, sys.installs)
+	}
+}
+
+func TestWriteFallsBack(t *testing.T) {
+	denied := fmt.Errorf("RegCreateKeyEx: %w", eventlog.ErrAccessDenied)
+	for _, tt := range []struct{ fallback, want string }{{"", eventlog.DefaultFallbackSource}, {"Codex", "Codex"}} {
+		sys := &fakeSystem{installErr: denied}
+		w := &eventlog.Writer{Source: "xcodex", FallbackSource: tt.fallback, System: sys}
+		w.Write(eventlog.Error, 5, "a")
+		if source, err := w.Write(eventlog.Error, 5, "b"); err != nil || source != tt.want {
+			t.Errorf("fallback %q: Write = %q, %v; want %q", tt.fallback, source, err, tt.want)
+		}
+		// Registration is only tried once.
+		if sys.installs != 1 || sys.reports[1].source != tt.want {
+			t.Errorf("fallback %q: %d installs, reports %+v", tt.fallback, sys.installs, sys.reports)
+		}
+	}
+
+	// Other failures to register are errors, and nothing is written.
+	sys := &fakeSystem{installErr: errors.New("registry corrupt")}
+	w := &eventlog.Writer{Source: "xcodex", System: sys}
+	if _, err := w.Write(eventlog.Error, 5, "a"); err == nil || len(sys.reports) != 0 {
+		t.Errorf("Write = %v with %d reports", err, len(sys.reports))
+	}
+}
+
+func TestWriteTruncates(t *testing.T) {
+	sys := &fakeSystem{installed: map[string]bool{"xcodex": true}}
+	w := &eventlog.Writer{Source: "xcodex", System: sys}
+	for _, msg := range []string{
+		strings.Repeat("a", eventlog.MaxMessage+10),
+		// A surrogate pair straddling the limit is left out whole.
+		strings.Repeat("a", eventlog.MaxMessage-1) + "😀",
+		strings.Repeat("é", eventlog.MaxMessage),
+	} {
+		w.Write(eventlog.Information, 1, msg)
+	}
+	for i, want := range []int{eventlog.MaxMessage, eventlog.MaxMessage - 1, eventlog.MaxMessage} {
+		if n := len(utf16.Encode([]rune(sys.reports[i].message))); n != want {
+			t.Errorf("message %d has %d code units, want %d", i, n, want)
+		}
+	}
+	w.Write(eventlog.Information, 1, "short 😀")
+	if got := sys.reports[3].message; got != "short 😀" {
+		t.Errorf("a short message became %q", got)
+	}
+}
+
+func TestLevelString(t *testing.T) {
+	for level, want := range map[eventlog.Level]string{eventlog.Information: "information", eventlog.Warning: "warning", eventlog.Error: "error"} {
+		if got := level.String(); got != want {
+			t.Errorf("%d: %q, want %q", level, got, want)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the Event Log is supported")
+	}
+	if _, err := eventlog.New("xcodex").Write(eventlog.Information, 1, "m"); !errors.Is(err, eventlog.ErrUnsupported) {
+		t.Errorf("Write = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,137 @@
+//go:build windows
+
+package eventlog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// The Win32 calls the syscall package doesn't wrap.
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procRegCreateKeyExW       = advapi32.NewProc("RegCreateKeyExW")
+	procRegSetValueExW        = advapi32.NewProc("RegSetValueExW")
+	procRegisterEventSourceW  = advapi32.NewProc("RegisterEventSourceW")
+	procDeregisterEventSource = advapi32.NewProc("DeregisterEventSource")
+	procReportEventW          = advapi32.NewProc("ReportEventW")
+)
+
+// sourcesKey holds a key per source of the Application log.
+const sourcesKey = `SYSTEM\CurrentControlSet\Services\EventLog\Application\`
+
+// Event types of ReportEvent.
+const (
+	eventlogErrorType       = 0x0001
+	eventlogWarningType     = 0x0002
+	eventlogInformationType = 0x0004
+)
+
+func system() System { return windows{} }
+
+// windows is the System of Windows itself.
+type windows struct{}
+
+func (windows) Installed(source string) (bool, error) {
+	path, err := syscall.UTF16PtrFromString(sourcesKey + source)
+	if err != nil {
+		return false, err
+	}
+	var key syscall.Handle
+	err = syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE, path, 0, syscall.KEY_READ, &key)
+	if errors.Is(err, syscall.ERROR_FILE_NOT_FOUND) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("eventlog: look up source %q: %w", source, err)
+	}
+	syscall.RegCloseKey(key)
+	return true, nil
+}
+
+func (windows) Install(source, messageFile string) error {
+	path, err := syscall.UTF16PtrFromString(sourcesKey + source)
+	if err != nil {
+		return err
+	}
+	var key syscall.Handle
+	var disposition uint32
+	r, _, _ := procRegCreateKeyExW.Call(uintptr(syscall.HKEY_LOCAL_MACHINE), uintptr(unsafe.Pointer(path)), 0, 0, 0,
+		syscall.KEY_WRITE, 0, uintptr(unsafe.Pointer(&key)), uintptr(unsafe.Pointer(&disposition)))
+	if err := regError(r); err != nil {
+		return fmt.Errorf("eventlog: register source %q: %w", source, err)
+	}
+	defer syscall.RegCloseKey(key)
+
+	file, err := syscall.UTF16FromString(messageFile)
+	if err != nil {
+		return err
+	}
+	types := uint32(eventlogErrorType | eventlogWarningType | eventlogInformationType)
+	for _, v := range []struct {
+		name string
+		typ  uint32
+		data unsafe.Pointer
+		size uintptr
+	}{
+		{"EventMessageFile", syscall.REG_EXPAND_SZ, unsafe.Pointer(&file[0]), uintptr(len(file) * 2)},
+		{"TypesSupported", syscall.REG_DWORD, unsafe.Pointer(&types), unsafe.Sizeof(types)},
+	} {
+		name, err := syscall.UTF16PtrFromString(v.name)
+		if err != nil {
+			return err
+		}
+		r, _, _ := procRegSetValueExW.Call(uintptr(key), uintptr(unsafe.Pointer(name)), 0, uintptr(v.typ), uintptr(v.data), v.size)
+		if err := regError(r); err != nil {
+			return fmt.Errorf("eventlog: register source %q: %s: %w", source, v.name, err)
+		}
+	}
+	return nil
+}
+
+// regError turns a registry call's status into an error, with ErrAccessDenied for a process that
+// isn't elevated.
+func regError(status uintptr) error {
+	switch err := syscall.Errno(status); err {
+	case 0:
+		return nil
+	case syscall.ERROR_ACCESS_DENIED:
+		return fmt.Errorf("%w (%v)", ErrAccessDenied, err)
+	default:
+		return err
+	}
+}
+
+func (windows) Report(source string, level Level, eventID uint32, message string) error {
+	name, err := syscall.UTF16PtrFromString(source)
+	if err != nil {
+		return err
+	}
+	// ReportEvent's strings can't hold NULs.
+	text, err := syscall.UTF16PtrFromString(strings.ReplaceAll(message, "\x00", ""))
+	if err != nil {
+		return err
+	}
+	h, _, err := procRegisterEventSourceW.Call(0, uintptr(unsafe.Pointer(name)))
+	if h == 0 {
+		return fmt.Errorf("eventlog: open source %q: %w", source, err)
+	}
+	defer procDeregisterEventSource.Call(h)
+
+	typ := uintptr(eventlogInformationType)
+	switch level {
+	case Warning:
+		typ = eventlogWarningType
+	case Error:
+		typ = eventlogErrorType
+	}
+	strs := [1]*uint16{text}
+	r, _, err := procReportEventW.Call(h, typ, 0, uintptr(eventID), 0, 1, 0, uintptr(unsafe.Pointer(&strs[0])), 0)
+	if r == 0 {
+		return fmt.Errorf("eventlog: report event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package hooksdk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EventType is an `xcodex_event_type` value. The event types this SDK knows are the generated
+// Event* constants (events_gen.go), such as EventToolCallFinished; other values are event types
+// of a newer host. String literals convert implicitly, so `mux.On("tool-call-finished", h)` and
+// `mux.On(hooksdk.EventToolCallFinished, h)` are the same registration.
+type EventType string
+
+func (t EventType) String() string {
+	return string(t)
+}
+
+// IsKnown reports whether t is one of the event types this SDK knows about.
+func (t EventType) IsKnown() bool {
+	for _, known := range knownEventTypes {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// AllEventTypes returns the event types this SDK knows about, sorted.
+func AllEventTypes() []EventType {
+	return append([]EventType(nil), knownEventTypes...)
+}
+
+// ParseEventType normalizes an event type as hosts and users spell it: surrounding space is
+// trimmed, letters are lowercased, and underscores become hyphens, so ` Tool_Call_Finished `
+// is EventToolCallFinished.
+func ParseEventType(s string) EventType {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return EventType(strings.ReplaceAll(s, "_", "-"))
+}
+
+// ErrUnknownEventType is returned by ParseHookPayloadStrict for event types this SDK doesn't know.
+var ErrUnknownEventType = errors.New("unknown hook event type")
+
+// IsKnownEventType reports whether eventType is one of the event types this SDK knows about.
+func IsKnownEventType(eventType string) bool {
+	return EventType(eventType).IsKnown()
+}
+
+// KnownEventTypes returns the event types this SDK knows about as strings, sorted (see
+// AllEventTypes).
+func KnownEventTypes() []string {
+	out := make([]string, len(knownEventTypes))
+	for i, t := range knownEventTypes {
+		out[i] = string(t)
+	}
+	return out
+}
+
+// IsKnown reports whether the payload's event type is one this SDK knows about. Payloads for
+// unknown (newer) event types still parse; their fields are available via Raw().
+func (p *HookPayload) IsKnown() bool {
+	return p.Type().IsKnown()
+}
+
+// Unknown returns the payload as an *UnknownPayload when its event type isn't one this SDK knows
+// about, as for an event a newer host added; ok is false for known event types.
+func (p *HookPayload) Unknown() (u *UnknownPayload, ok bool) {
+	if p.IsKnown() {
+		return nil, false
+	}
+	return &UnknownPayload{RawPayload: p.RawPayload, XcodexEventType: p.Type()}, true
+}
+
+// ParseHookPayloadStrict is like ParseHookPayload, but fails with ErrUnknownEventType when the
+// payload's event type isn't one this SDK knows about.
+//
+// Most hooks should prefer ParseHookPayload: unknown event types are how newer hosts add events,
+// and a Mux routes them to its OnAny handler.
+func ParseHookPayloadStrict(data []byte, opts ...Option) (*HookPayload, error) {
+	p, err := ParseHookPayload(data, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !p.IsKnown() {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEventType, p.EventType())
+	}
+	return p, nil
+}
@@ -0,0 +1,271 @@
+package hooksdk_test
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// futureEvent is an event type a newer host might send.
+func futureEvent() []byte {
+	return hooktest.New("plan-updated", "PlanUpdated").With("plan", map[string]any{"steps": []any{"a", "b"}}).Bytes()
+}
+
+func TestParseHookPayloadUnknownEventType(t *testing.T) {
+	p, err := hooksdk.ParseHookPayload(futureEvent())
+	if err != nil {
+		t.Fatalf("ParseHookPayload: %v", err)
+	}
+	if p.IsKnown() {
+		t.Errorf("IsKnown() = true for %q", p.EventType())
+	}
+	if got := p.SessionID(); got == "" {
+		t.Errorf("SessionID() is empty")
+	}
+
+	ev, err := p.Event()
+	if err != nil {
+		t.Fatalf("Event: %v", err)
+	}
+	u, ok := ev.(*hooksdk.UnknownPayload)
+	if !ok {
+		t.Fatalf("Event() = %T, want *hooksdk.UnknownPayload", ev)
+	}
+	if pu, ok := p.Unknown(); !ok || pu.Type() != u.Type() {
+		t.Errorf("Unknown() = %+v, %v; want the Event's payload", pu, ok)
+	}
+	if _, ok := hooktest.SessionStart().Build().Unknown(); ok {
+		t.Error("Unknown() = true for session-start")
+	}
+	if u.Type() != "plan-updated" {
+		t.Errorf("Type() = %q, want %q", u.Type(), "plan-updated")
+	}
+	if _, ok := u.Raw()["plan"].(map[string]any); !ok {
+		t.Errorf("Raw()[\"plan\"] = %#v, want the plan object", u.Raw()["plan"])
+	}
+
+	c := u.Clone()
+	c.RawPayload["plan"].(map[string]any)["steps"] = nil
+	if u.RawPayload["plan"].(map[string]any)["steps"] == nil {
+		t.Errorf("changing the clone changed the original")
+	}
+}
+
+func TestParseEventKnownEventType(t *testing.T) {
+	ev, err := hooksdk.ParseEvent(hooktest.ToolCallFinished().Bytes())
+	if err != nil {
+		t.Fatalf("ParseEvent: %v", err)
+	}
+	if _, ok := ev.(*hooksdk.ToolCallFinishedPayload); !ok {
+		t.Fatalf("ParseEvent() = %T, want *hooksdk.ToolCallFinishedPayload", ev)
+	}
+}
+
+func TestParseHookPayloadStrict(t *testing.T) {
+	if _, err := hooksdk.ParseHookPayloadStrict(futureEvent()); !errors.Is(err, hooksdk.ErrUnknownEventType) {
+		t.Errorf("ParseHookPayloadStrict(unknown) error = %v, want ErrUnknownEventType", err)
+	}
+	if _, err := hooksdk.ParseHookPayloadStrict(hooktest.SessionStart().Bytes()); err != nil {
+		t.Errorf("ParseHookPayloadStrict(session-start): %v", err)
+	}
+	// The options apply as they do to ParseHookPayload.
+	extra := hooktest.SessionStart().With("colour", "blue").Bytes()
+	var fieldsErr *hooksdk.UnknownFieldsError
+	if _, err := hooksdk.ParseHookPayloadStrict(extra, hooksdk.WithStrictFields()); !errors.As(err, &fieldsErr) {
+		t.Errorf("ParseHookPayloadStrict with WithStrictFields error = %v, want *UnknownFieldsError", err)
+	}
+}
+
+func TestMuxRoutesUnknownEventTypeToOnAny(t *testing.T) {
+	mux := hooksdk.NewMux()
+	mux.OnToolCallFinished(func(p *hooksdk.HookPayload) hooksdk.Response {
+		t.Errorf("tool-call-finished handler got %q", p.EventType())
+		return hooksdk.Allow()
+	})
+	var got hooksdk.EventType
+	mux.OnAny(func(p *hooksdk.HookPayload) hooksdk.Response {
+		ev, err := p.Event()
+		if err != nil {
+			t.Errorf("Event: %v", err)
+		}
+		if u, ok := ev.(*hooksdk.UnknownPayload); ok {
+			got = u.Type()
+		}
+		return hooksdk.Deny("not yet")
+	})
+
+	res := hooktest.RunHook(t, mux.Handle, futureEvent())
+	if got != "plan-updated" {
+		t.Errorf("OnAny saw event type %q, want plan-updated", got)
+	}
+	if res.ExitCode != hooksdk.ExitDeny || res.Response.Decision != hooksdk.DecisionDeny {
+		t.Errorf("got exit %d, decision %q; want %d, deny", res.ExitCode, res.Response.Decision, hooksdk.ExitDeny)
+	}
+}
+
+func TestIsKnownEventType(t *testing.T) {
+	for _, et := range hooksdk.AllEventTypes() {
+		if !et.IsKnown() || !hooksdk.IsKnownEventType(string(et)) {
+			t.Errorf("%q is not known", et)
+		}
+	}
+	if hooksdk.IsKnownEventType("plan-updated") {
+		t.Errorf("plan-updated is known")
+	}
+}
+
+func TestKnownEventTypes(t *testing.T) {
+	types := hooksdk.KnownEventTypes()
+	if len(types) != len(hooksdk.AllEventTypes()) {
+		t.Fatalf("%d known event types, want %d", len(types), len(hooksdk.AllEventTypes()))
+	}
+	for i, et := range hooksdk.AllEventTypes() {
+		if types[i] != string(et) {
+			t.Errorf("KnownEventTypes()[%d] = %q, want %q", i, types[i], et)
+		}
+	}
+	// The result is a copy.
+	types[0] = "changed"
+	if hooksdk.KnownEventTypes()[0] == "changed" {
+		t.Errorf("KnownEventTypes returned its own slice")
+	}
+}
+
+func TestEventDecodesEveryFixture(t *testing.T) {
+	for eventType, b := range hooktest.Fixtures() {
+		ev, err := b.Build().Event()
+		if err != nil {
+			t.Errorf("%s: Event: %v", eventType, err)
+			continue
+		}
+		if _, unknown := ev.(*hooksdk.UnknownPayload); unknown || string(ev.Type()) != eventType {
+			t.Errorf("%s: Event() = %T of type %q", eventType, ev, ev.Type())
+		}
+		if ev.Raw()["session_id"] != "test-session" {
+			t.Errorf("%s: Raw() lacks the payload", eventType)
+		}
+	}
+
+	// Optional fields are pointers, nil when absent, and their accessors return the zero value.
+	ev, err := hooktest.ToolCallFinished().With("output_preview", nil).Build().Event()
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := ev.(*hooksdk.ToolCallFinishedPayload)
+	if finished.OutputPreview != nil || finished.GetOutputPreview() != "" {
+		t.Errorf("absent output_preview = %v, %q", finished.OutputPreview, finished.GetOutputPreview())
+	}
+	ev, _ = hooktest.ToolCallFinished().With("output_preview", "ok").Build().Event()
+	if got := ev.(*hooksdk.ToolCallFinishedPayload).GetOutputPreview(); got != "ok" {
+		t.Errorf("GetOutputPreview() = %q, want ok", got)
+	}
+}
+
+// generatedTable parses events_gen.go for the Event* constants and the cases of the Event switch,
+// so the test compares AllEventTypes with the code that decodes payloads.
+func generatedTable(t *testing.T) (consts map[string]string, cases []string) {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "events_gen.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consts = map[string]string{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			if len(n.Values) == 1 {
+				if lit, ok := n.Values[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					v, _ := strconv.Unquote(lit.Value)
+					consts[n.Names[0].Name] = v
+				}
+			}
+		case *ast.FuncDecl:
+			if n.Name.Name != "Event" {
+				return false
+			}
+		case *ast.CaseClause:
+			for _, e := range n.List {
+				cases = append(cases, e.(*ast.Ident).Name)
+			}
+		}
+		return true
+	})
+	return consts, cases
+}
+
+func TestAllEventTypesMatchEventSwitch(t *testing.T) {
+	consts, cases := generatedTable(t)
+	var fromSwitch []string
+	for _, name := range cases {
+		fromSwitch = append(fromSwitch, consts[name])
+	}
+	sort.Strings(fromSwitch)
+	var all []string
+	for _, et := range hooksdk.AllEventTypes() {
+		all = append(all, string(et))
+		ev, err := hooktest.New(string(et), "").Build().Event()
+		if err != nil {
+			t.Errorf("%s: Event: %v", et, err)
+		} else if _, unknown := ev.(*hooksdk.UnknownPayload); unknown || ev.Type() != et {
+			t.Errorf("%s decodes to %T of type %q", et, ev, ev.Type())
+		}
+	}
+	if !sort.StringsAreSorted(all) {
+		t.Errorf("AllEventTypes isn't sorted: %v", all)
+	}
+	if !reflect.DeepEqual(all, fromSwitch) {
+		t.Errorf("AllEventTypes = %v, but Event switches on %v", all, fromSwitch)
+	}
+	if len(consts) != len(all) {
+		t.Errorf("%d Event* constants for %d event types", len(consts), len(all))
+	}
+}
+
+func TestParseEventType(t *testing.T) {
+	for in, want := range map[string]hooksdk.EventType{
+		"tool-call-finished":     hooksdk.EventToolCallFinished,
+		" Tool_Call_Finished \n": hooksdk.EventToolCallFinished,
+		"SESSION-START":          hooksdk.EventSessionStart,
+		"plan_updated":           "plan-updated",
+		"":                       "",
+	} {
+		if got := hooksdk.ParseEventType(in); got != want {
+			t.Errorf("ParseEventType(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := hooksdk.EventPreCompact.String(); got != "pre-compact" {
+		t.Errorf("String() = %q", got)
+	}
+	if hooksdk.EventType("plan-updated").IsKnown() || !hooksdk.EventNotification.IsKnown() {
+		t.Errorf("IsKnown is wrong")
+	}
+}
+
+func TestParseHookPayloadNormalizesEventType(t *testing.T) {
+	p, err := hooksdk.ParseHookPayload(hooktest.ToolCallFinished().With("xcodex_event_type", " Tool_Call_Finished ").Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type() != hooksdk.EventToolCallFinished || p.EventType() != "tool-call-finished" {
+		t.Errorf("Type() = %q, EventType() = %q", p.Type(), p.EventType())
+	}
+
+	// A literal registration and a constant one are the same.
+	mux := hooksdk.NewMux()
+	mux.On("tool-call-finished", reply("literal"))
+	if got := mux.Dispatch(p).Reason; got != "literal" {
+		t.Errorf("normalized payload went to %q", got)
+	}
+	mux.On(hooksdk.EventToolCallFinished, reply("constant"))
+	if got := mux.Dispatch(p).Reason; got != "constant" {
+		t.Errorf("after re-registering by constant, went to %q", got)
+	}
+}
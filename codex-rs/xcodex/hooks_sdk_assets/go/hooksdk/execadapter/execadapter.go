@@ -0,0 +1,301 @@
+// Package execadapter runs an existing script (bash, Python, anything executable) as the handler
+// of a Go hook, so the script gets the SDK's envelope handling, timeouts, and response writing
+// without reimplementing them.
+//
+// The script gets the payload three ways: on stdin, in a temporary file named by
+// CODEX_HOOK_PAYLOAD_FILE, and flattened into environment variables for the common fields
+// (CODEX_HOOK_EVENT_TYPE, CODEX_HOOK_SESSION_ID, CODEX_HOOK_CWD, CODEX_HOOK_TOOL_NAME, ...; see
+// Env). Its exit status is the decision, as for a hook the host runs itself:
+//
+//   - 0 allows. If stdout holds a JSON response (`{"decision":"deny","reason":"..."}`) that
+//     response is used instead; any other output is ignored.
+//   - 2 denies, with the script's stderr as the reason.
+//   - anything else, or not finishing in time, is an error (see ExitError).
+//
+// A wrapper is a few lines (see cmd/exec_hook for one configured by the environment):
+//
+//	func main() {
+//		hooksdk.Run(execadapter.Script{Path: "./check.sh", Timeout: 10 * time.Second}.Run)
+//	}
+package execadapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// PayloadFileEnv names the temporary file holding the payload, which is removed once the script
+// exits.
+const PayloadFileEnv = "CODEX_HOOK_PAYLOAD_FILE"
+
+// DefaultTimeout bounds a script when Script.Timeout is 0. The context passed to Run can only
+// shorten it.
+const DefaultTimeout = 30 * time.Second
+
+// maxReasonBytes bounds the deny reason taken from stderr; the start of the output is kept, since
+// scripts usually say why first.
+const maxReasonBytes = 4 << 10
+
+// Script is a script to run as a hook. Its Run method is a hooksdk.Handler.
+type Script struct {
+	// Path is the executable. A relative path with a directory (`./check.sh`) is relative to the
+	// hook's working directory, not Dir; a bare name is looked up in PATH. On Windows, `.ps1` files
+	// are run with powershell and `.sh` files with sh (e.g. Git for Windows'); everything else is
+	// run directly.
+	Path string
+	// Args are passed to the script after Path.
+	Args []string
+	// Dir is the script's working directory; empty means the session's (the payload's cwd), or
+	// the hook's own when the payload has none.
+	Dir string
+	// Env holds extra `KEY=value` variables, added after the hook's environment and the payload
+	// variables, so they override both.
+	Env []string
+	// Timeout bounds the script; 0 means DefaultTimeout.
+	Timeout time.Duration
+	// Stderr, when set, also receives everything the script writes to stderr, e.g. os.Stderr to
+	// keep a script's diagnostics in the hook's log.
+	Stderr io.Writer
+}
+
+// ExitError is returned by Run when the script fails: it exits with a status other than 0 or 2,
+// or is killed, or doesn't finish in time.
+type ExitError struct {
+	Script string
+	// Code is the exit status, or -1 when the script was killed or timed out.
+	Code int
+	// Stderr is what the script wrote to stderr, truncated.
+	Stderr string
+	// TimedOut is set when the script was killed at its deadline.
+	TimedOut bool
+}
+
+func (e *ExitError) Error() string {
+	msg := e.Script + ": exit status " + strconv.Itoa(e.Code)
+	switch {
+	case e.TimedOut:
+		msg = e.Script + ": timed out"
+	case e.Code < 0:
+		msg = e.Script + ": killed"
+	}
+	if s := strings.TrimSpace(e.Stderr); s != "" {
+		msg += ": " + s
+	}
+	return msg
+}
+
+// Run runs the script at path with p and returns its decision, within DefaultTimeout.
+func Run(path string, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+	return Script{Path: path}.Run(context.Background(), p)
+}
+
+// Run runs the script with p and returns its decision; it fails with an *ExitError when the script
+// fails, as described in the package documentation. The script is killed when ctx is done or its
+// Timeout passes.
+func (s Script) Run(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+	if s.Path == "" {
+		return hooksdk.Response{}, errors.New("execadapter: no script")
+	}
+	data, err := payloadJSON(p)
+	if err != nil {
+		return hooksdk.Response{}, fmt.Errorf("execadapter: encode payload: %w", err)
+	}
+	file, err := writePayloadFile(data)
+	if err != nil {
+		return hooksdk.Response{}, fmt.Errorf("execadapter: %w", err)
+	}
+	defer os.Remove(file)
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name, args := s.command()
+	cmd := exec.CommandContext(ctx, name, args...)
+	// A script that leaves a child holding its output open must not hold up the hook.
+	cmd.WaitDelay = time.Second
+	cmd.Dir = s.Dir
+	if cmd.Dir == "" {
+		if dir := p.WorkingDir(); dir != "" {
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				cmd.Dir = dir
+			}
+		}
+	}
+	cmd.Env = append(append(os.Environ(), Env(p)...), PayloadFileEnv+"="+file)
+	cmd.Env = append(cmd.Env, s.Env...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if s.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, s.Stderr)
+	}
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return hooksdk.Response{}, &ExitError{Script: s.Path, Code: -1, Stderr: hooksdk.TruncateString(stderr.String(), maxReasonBytes), TimedOut: ctx.Err() == context.DeadlineExceeded}
+	case err != nil && !errors.As(err, &exitErr):
+		return hooksdk.Response{}, fmt.Errorf("execadapter: run %s: %w", s.Path, err)
+	}
+
+	code := 0
+	if exitErr != nil {
+		code = exitErr.ExitCode()
+	}
+	resp, hasResp := parseResponse(stdout.Bytes())
+	switch code {
+	case hooksdk.ExitOK:
+		if hasResp {
+			return resp, nil
+		}
+		return hooksdk.Allow(), nil
+	case hooksdk.ExitDeny:
+		reason := hooksdk.TruncateString(strings.TrimSpace(stderr.String()), maxReasonBytes)
+		if reason == "" && hasResp {
+			reason = resp.Reason
+		}
+		if reason == "" {
+			reason = "denied by " + filepath.Base(s.Path)
+		}
+		if hasResp {
+			resp.Decision, resp.Reason = hooksdk.DecisionDeny, reason
+			return resp, nil
+		}
+		return hooksdk.Deny(reason), nil
+	default:
+		return hooksdk.Response{}, &ExitError{Script: s.Path, Code: code, Stderr: hooksdk.TruncateString(stderr.String(), maxReasonBytes)}
+	}
+}
+
+// command returns the program and arguments that run the script.
+func (s Script) command() (string, []string) {
+	if !filepath.IsAbs(s.Path) && strings.ContainsAny(s.Path, `/\`) {
+		if abs, err := filepath.Abs(s.Path); err == nil {
+			s.Path = abs
+		}
+	}
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(s.Path)) {
+		case ".ps1":
+			return "powershell", append([]string{"-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", s.Path}, s.Args...)
+		case ".sh":
+			return "sh", append([]string{s.Path}, s.Args...)
+		}
+	}
+	return s.Path, s.Args
+}
+
+// payloadJSON returns the payload as the host sent it when it was kept (WithRawJSON), and p
+// re-encoded otherwise.
+func payloadJSON(p *hooksdk.HookPayload) ([]byte, error) {
+	if raw := p.RawJSON(); raw != nil {
+		return raw, nil
+	}
+	return json.Marshal(p)
+}
+
+func writePayloadFile(data []byte) (string, error) {
+	f, err := os.CreateTemp("", "codex-hook-payload-*.json")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// parseResponse parses stdout as a response. Output that isn't a JSON object with a known
+// decision, such as a script's progress messages, is not a response.
+func parseResponse(stdout []byte) (hooksdk.Response, bool) {
+	out := bytes.TrimSpace(stdout)
+	if len(out) == 0 || out[0] != '{' {
+		return hooksdk.Response{}, false
+	}
+	var resp hooksdk.Response
+	if json.Unmarshal(out, &resp) != nil {
+		return hooksdk.Response{}, false
+	}
+	switch resp.Decision {
+	case hooksdk.DecisionAllow, hooksdk.DecisionDeny, hooksdk.DecisionAsk:
+		return resp, true
+	}
+	return hooksdk.Response{}, false
+}
+
+// Env returns the payload's common fields as `KEY=value` environment variables, for scripts that
+// don't want to parse JSON. Fields the payload doesn't have are left out.
+//
+//	CODEX_HOOK_EVENT_TYPE       xcodex_event_type, e.g. tool-call-finished
+//	CODEX_HOOK_EVENT_NAME       hook_event_name
+//	CODEX_HOOK_EVENT_ID         event_id
+//	CODEX_HOOK_TIMESTAMP        timestamp
+//	CODEX_HOOK_SESSION_ID       session_id
+//	CODEX_HOOK_TURN_ID          turn_id
+//	CODEX_HOOK_CWD              cwd
+//	CODEX_HOOK_TRANSCRIPT_PATH  transcript_path
+//	CODEX_HOOK_TOOL_NAME        tool_name
+//	CODEX_HOOK_CALL_ID          call_id
+//	CODEX_HOOK_COMMAND          command, its arguments joined with spaces
+//	CODEX_HOOK_PATHS            paths, one per line
+//	CODEX_HOOK_SUCCESS          success, true or false
+//	CODEX_HOOK_DURATION_MS      duration_ms
+func Env(p *hooksdk.HookPayload) []string {
+	var env []string
+	add := func(key, value string) {
+		if value != "" {
+			env = append(env, key+"="+value)
+		}
+	}
+	add("CODEX_HOOK_EVENT_TYPE", string(p.Type()))
+	add("CODEX_HOOK_EVENT_NAME", p.HookEventName)
+	add("CODEX_HOOK_EVENT_ID", p.EventId)
+	add("CODEX_HOOK_TIMESTAMP", p.Timestamp)
+	add("CODEX_HOOK_SESSION_ID", p.SessionID())
+	add("CODEX_HOOK_TURN_ID", deref(p.TurnId))
+	add("CODEX_HOOK_CWD", p.WorkingDir())
+	add("CODEX_HOOK_TRANSCRIPT_PATH", p.TranscriptPath)
+	add("CODEX_HOOK_TOOL_NAME", deref(p.ToolName))
+	add("CODEX_HOOK_CALL_ID", deref(p.CallId))
+	add("CODEX_HOOK_COMMAND", strings.Join(p.Command, " "))
+	add("CODEX_HOOK_PATHS", strings.Join(p.Paths, "\n"))
+	if p.Success != nil {
+		add("CODEX_HOOK_SUCCESS", strconv.FormatBool(*p.Success))
+	}
+	if p.DurationMs != nil {
+		add("CODEX_HOOK_DURATION_MS", strconv.Itoa(*p.DurationMs))
+	}
+	return env
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,166 @@
+package execadapter_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/execadapter"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// script returns a Script for the fixture testdata/<name>.sh.
+func script(t *testing.T, name string) execadapter.Script {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fixtures are sh scripts")
+	}
+	return execadapter.Script{Path: filepath.Join("testdata", name+".sh")}
+}
+
+func TestRunDecisions(t *testing.T) {
+	p := hooktest.ApprovalRequested().Build()
+	for _, tt := range []struct {
+		name string
+		want hooksdk.Response
+	}{
+		{"allow", hooksdk.Allow()},
+		{"ask", hooksdk.Ask("are you sure?")},
+		{"deny", hooksdk.Deny("rm -rf is not allowed")},
+		{"deny_response", hooksdk.Response{Decision: hooksdk.DecisionDeny, Reason: "from stdout", ReasonCode: "NOPE"}},
+	} {
+		resp, err := script(t, tt.name).Run(context.Background(), p)
+		if err != nil || resp.Decision != tt.want.Decision || resp.Reason != tt.want.Reason || resp.ReasonCode != tt.want.ReasonCode || resp.Prompt != tt.want.Prompt {
+			t.Errorf("%s: %+v, %v; want %+v", tt.name, resp, err, tt.want)
+		}
+	}
+	if resp, err := execadapter.Run(filepath.Join("testdata", "deny.sh"), p); err != nil || resp.Reason != "rm -rf is not allowed" {
+		t.Errorf("Run = %+v, %v", resp, err)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	p := hooktest.SessionStart().Build()
+	var mirrored bytes.Buffer
+	s := script(t, "fail")
+	s.Stderr = &mirrored
+	_, err := s.Run(context.Background(), p)
+	var ee *execadapter.ExitError
+	if !errors.As(err, &ee) || ee.Code != 3 || ee.TimedOut || ee.Stderr != "config not found\n" || err.Error() != "testdata/fail.sh: exit status 3: config not found" {
+		t.Errorf("fail: %v (%+v)", err, ee)
+	}
+	if mirrored.String() != "config not found\n" {
+		t.Errorf("Stderr got %q", mirrored.String())
+	}
+
+	// The script's child keeps its output open; the hook doesn't wait for it.
+	s = script(t, "slow")
+	s.Timeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err = s.Run(context.Background(), p)
+	if !errors.As(err, &ee) || !ee.TimedOut || ee.Code != -1 || !strings.HasSuffix(err.Error(), ": timed out") {
+		t.Errorf("slow: %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("slow took %s", d)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = script(t, "slow").Run(ctx, p); !errors.As(err, &ee) || ee.TimedOut || !strings.HasSuffix(err.Error(), ": killed") {
+		t.Errorf("cancelled: %v", err)
+	}
+
+	for _, path := range []string{"", filepath.Join("testdata", "missing.sh")} {
+		if _, err := (execadapter.Script{Path: path}).Run(context.Background(), p); err == nil || errors.As(err, &ee) {
+			t.Errorf("%q: %v, want an error running it", path, err)
+		}
+	}
+}
+
+func TestRunInputs(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	cwd := t.TempDir()
+	payload := hooktest.ToolCallFinished().WithSessionID("s1").WithCwd(cwd).With("success", true).With("paths", []string{"a.go", "b.go"})
+	p, err := hooksdk.ParseHookPayload(payload.Bytes(), hooksdk.WithRawJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := script(t, "env")
+	s.Args = []string{"one", "two"}
+	s.Env = []string{"OUT=" + out, "CODEX_HOOK_TOOL_NAME=overridden"}
+	if resp, err := s.Run(context.Background(), p); err != nil || resp.Decision != hooksdk.DecisionAllow {
+		t.Fatalf("env: %+v, %v", resp, err)
+	}
+	read := func(ext string) string {
+		data, err := os.ReadFile(out + ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if read(".stdin") != string(p.RawJSON()) || read(".file") != string(p.RawJSON()) {
+		t.Errorf("stdin %q, payload file %q; want the payload as sent", read(".stdin"), read(".file"))
+	}
+	if _, err := os.Stat(strings.TrimSpace(read(".path"))); !os.IsNotExist(err) {
+		t.Errorf("the payload file is still there: %v", err)
+	}
+	if got, _ := filepath.EvalSymlinks(strings.TrimSpace(read(".pwd"))); got != evalSymlinks(t, cwd) {
+		t.Errorf("ran in %s, want the payload's cwd %s", got, cwd)
+	}
+	if read(".args") != "one two\n" {
+		t.Errorf("args %q", read(".args"))
+	}
+	env := read(".env")
+	for _, want := range []string{
+		"CODEX_HOOK_EVENT_TYPE=tool-call-finished\n",
+		"CODEX_HOOK_SESSION_ID=s1\n",
+		"CODEX_HOOK_CWD=" + cwd + "\n",
+		"CODEX_HOOK_PATHS=a.go\nb.go\n",
+		"CODEX_HOOK_SUCCESS=true\n",
+		"CODEX_HOOK_DURATION_MS=1234\n",
+		"CODEX_HOOK_TOOL_NAME=overridden\n",
+	} {
+		if !strings.Contains(env, want) {
+			t.Errorf("env lacks %q:\n%s", want, env)
+		}
+	}
+
+	// Dir wins over the payload's cwd.
+	s.Dir = t.TempDir()
+	if _, err := s.Run(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := filepath.EvalSymlinks(strings.TrimSpace(read(".pwd"))); got != evalSymlinks(t, s.Dir) {
+		t.Errorf("ran in %s, want Dir %s", got, s.Dir)
+	}
+}
+
+func evalSymlinks(t *testing.T, path string) string {
+	t.Helper()
+	p, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestEnv(t *testing.T) {
+	env := execadapter.Env(hooktest.ApprovalRequested().WithSessionID("s1").WithCommand("git push --force").Build())
+	want := map[string]bool{"CODEX_HOOK_EVENT_TYPE=approval-requested": true, "CODEX_HOOK_SESSION_ID=s1": true, "CODEX_HOOK_COMMAND=git push --force": true, "CODEX_HOOK_CALL_ID=call-1": true}
+	for _, kv := range env {
+		delete(want, kv)
+		if strings.HasPrefix(kv, "CODEX_HOOK_DURATION_MS=") || strings.HasPrefix(kv, "CODEX_HOOK_SUCCESS=") || strings.HasSuffix(kv, "=") {
+			t.Errorf("env has %q, which the payload lacks", kv)
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("env %q lacks %v", env, want)
+	}
+}
@@ -0,0 +1,3 @@
+#!/bin/sh
+# Allows, after output that is not a response.
+echo "checking $CODEX_HOOK_EVENT_TYPE..."
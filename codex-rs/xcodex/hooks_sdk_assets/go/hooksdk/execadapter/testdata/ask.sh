@@ -0,0 +1,3 @@
+#!/bin/sh
+# Asks, with a response on stdout.
+echo '{"decision":"ask","prompt":"are you sure?"}'
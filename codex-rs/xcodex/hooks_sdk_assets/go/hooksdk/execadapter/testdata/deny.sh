@@ -0,0 +1,4 @@
+#!/bin/sh
+# Denies, saying why on stderr.
+echo "rm -rf is not allowed" >&2
+exit 2
@@ -0,0 +1,4 @@
+#!/bin/sh
+# Denies with a response on stdout and nothing on stderr.
+echo '{"decision":"deny","reason":"from stdout","reason_code":"NOPE"}'
+exit 2
@@ -0,0 +1,8 @@
+#!/bin/sh
+# Records what it was given in the files $OUT.*.
+env > "$OUT.env"
+cat > "$OUT.stdin"
+cp "$CODEX_HOOK_PAYLOAD_FILE" "$OUT.file"
+echo "$CODEX_HOOK_PAYLOAD_FILE" > "$OUT.path"
+pwd > "$OUT.pwd"
+echo "$@" > "$OUT.args"
@@ -0,0 +1,4 @@
+#!/bin/sh
+# Fails.
+echo "config not found" >&2
+exit 3
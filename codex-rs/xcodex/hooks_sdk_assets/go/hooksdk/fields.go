@@ -0,0 +1,236 @@
+package hooksdk
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Field looks up a value in an untyped payload by path and asserts it to T.
+//
+// Paths are dot-separated keys with numeric array indexes either as their own segment or in
+// brackets, so `tool_input.command`, `command.0`, and `command[0]` all work. A missing key, an
+// index out of range, a nil intermediate value, or a value that isn't a T returns ok=false.
+//
+// Numbers in untyped payloads are json.Number; use IntField/FloatField (or Field[json.Number])
+// rather than Field[int64].
+func Field[T any](p HookPayloadJSON, path string) (T, bool) {
+	var zero T
+	v, ok := lookupPath(map[string]any(p), path)
+	if !ok {
+		return zero, false
+	}
+	t, ok := v.(T)
+	return t, ok
+}
+
+// StringField returns the string at path.
+func StringField(p HookPayloadJSON, path string) (string, bool) {
+	return Field[string](p, path)
+}
+
+// IntField returns the integer at path, converting json.Number (see AsInt64).
+func IntField(p HookPayloadJSON, path string) (int64, bool) {
+	v, ok := lookupPath(map[string]any(p), path)
+	if !ok {
+		return 0, false
+	}
+	return AsInt64(v)
+}
+
+// FloatField returns the number at path, converting json.Number (see AsFloat64).
+func FloatField(p HookPayloadJSON, path string) (float64, bool) {
+	v, ok := lookupPath(map[string]any(p), path)
+	if !ok {
+		return 0, false
+	}
+	return AsFloat64(v)
+}
+
+// BoolField returns the boolean at path.
+func BoolField(p HookPayloadJSON, path string) (bool, bool) {
+	return Field[bool](p, path)
+}
+
+// Project returns a copy of p that contains only the fields at paths (see Field for the path
+// syntax), keeping their original nesting: `tool.name` yields {"tool": {"name": ...}}. An array
+// index keeps its position, with null in unselected slots before it. Paths that don't exist are
+// omitted. With no paths, p is returned unchanged.
+func Project(p HookPayloadJSON, paths []string) HookPayloadJSON {
+	if len(paths) == 0 {
+		return p
+	}
+	out := map[string]any{}
+	for _, path := range paths {
+		segments, ok := splitPath(path)
+		if !ok {
+			continue
+		}
+		if _, ok := lookupPath(map[string]any(p), path); !ok {
+			continue
+		}
+		out = projectInto(out, map[string]any(p), segments).(map[string]any)
+	}
+	return HookPayloadJSON(out)
+}
+
+// Omit is the inverse of Project: it returns p without the values at paths. Only the containers
+// along each path are copied, so p is not modified. Array elements are set to null rather than
+// removed, keeping the other indexes stable. Missing paths are ignored.
+func Omit(p HookPayloadJSON, paths []string) HookPayloadJSON {
+	if len(paths) == 0 {
+		return p
+	}
+	out := map[string]any(p)
+	for _, path := range paths {
+		segments, ok := splitPath(path)
+		if !ok {
+			continue
+		}
+		out = omitFrom(out, segments).(map[string]any)
+	}
+	return HookPayloadJSON(out)
+}
+
+func omitFrom(src any, segments []string) any {
+	seg, rest := segments[0], segments[1:]
+	switch node := src.(type) {
+	case map[string]any:
+		child, ok := node[seg]
+		if !ok {
+			return src
+		}
+		m := make(map[string]any, len(node))
+		for k, v := range node {
+			m[k] = v
+		}
+		if len(rest) == 0 {
+			delete(m, seg)
+		} else {
+			m[seg] = omitFrom(child, rest)
+		}
+		return m
+	case HookPayloadJSON:
+		return omitFrom(map[string]any(node), segments)
+	case []any:
+		i, err := strconv.Atoi(seg)
+		if err != nil || i < 0 || i >= len(node) {
+			return src
+		}
+		a := append([]any(nil), node...)
+		if len(rest) == 0 {
+			a[i] = nil
+		} else {
+			a[i] = omitFrom(a[i], rest)
+		}
+		return a
+	}
+	return src
+}
+
+// projectInto copies the value at segments from src into dst (creating containers of the same
+// kind as src along the way) and returns the updated dst.
+func projectInto(dst, src any, segments []string) any {
+	if len(segments) == 0 {
+		return src
+	}
+	seg, rest := segments[0], segments[1:]
+	switch node := src.(type) {
+	case map[string]any:
+		m, _ := dst.(map[string]any)
+		if m == nil {
+			m = map[string]any{}
+		}
+		m[seg] = projectInto(m[seg], node[seg], rest)
+		return m
+	case HookPayloadJSON:
+		return projectInto(dst, map[string]any(node), segments)
+	case []any:
+		i, _ := strconv.Atoi(seg)
+		a, _ := dst.([]any)
+		for len(a) <= i {
+			a = append(a, nil)
+		}
+		a[i] = projectInto(a[i], node[i], rest)
+		return a
+	case []string:
+		i, _ := strconv.Atoi(seg)
+		a, _ := dst.([]any)
+		for len(a) <= i {
+			a = append(a, nil)
+		}
+		a[i] = node[i]
+		return a
+	}
+	return dst
+}
+
+func lookupPath(root map[string]any, path string) (any, bool) {
+	segments, ok := splitPath(path)
+	if !ok {
+		return nil, false
+	}
+
+	var cur any = root
+	for _, seg := range segments {
+		switch node := cur.(type) {
+		case map[string]any:
+			next, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case HookPayloadJSON:
+			next, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		case []string:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// splitPath turns `a.b[0].c` into ["a", "b", "0", "c"].
+func splitPath(path string) ([]string, bool) {
+	if path == "" {
+		return nil, false
+	}
+	var segments []string
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		var indexes []string
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			key = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, false
+				}
+				indexes = append(indexes, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		if key != "" {
+			segments = append(segments, key)
+		} else if len(indexes) == 0 || len(segments) == 0 {
+			return nil, false
+		}
+		segments = append(segments, indexes...)
+	}
+	return segments, true
+}
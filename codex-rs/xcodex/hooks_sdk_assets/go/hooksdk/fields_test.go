@@ -0,0 +1,143 @@
+package hooksdk_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func fieldsPayload() hooksdk.HookPayloadJSON {
+	return hooksdk.HookPayloadJSON{
+		"tool": map[string]any{
+			"name": "shell",
+			"command": map[string]any{
+				"args": []any{"ls", "-la", map[string]any{"glob": "*.go"}},
+			},
+		},
+		"attempt":  json.Number("3"),
+		"ratio":    json.Number("0.25"),
+		"large":    json.Number("1e3"),
+		"success":  true,
+		"missing":  nil,
+		"elements": []any{nil, []any{"nested"}},
+	}
+}
+
+func TestField(t *testing.T) {
+	p := fieldsPayload()
+	for path, want := range map[string]string{
+		"tool.name":                 "shell",
+		"tool.command.args.0":       "ls",
+		"tool.command.args[1]":      "-la",
+		"tool.command.args[2].glob": "*.go",
+		"elements[1][0]":            "nested",
+		"elements.1.0":              "nested",
+	} {
+		if got, ok := hooksdk.StringField(p, path); !ok || got != want {
+			t.Errorf("StringField(%q) = %q, %v; want %q", path, got, ok, want)
+		}
+	}
+
+	for _, path := range []string{
+		"tool.missing",          // missing key
+		"tool.command.args[3]",  // index out of range
+		"tool.command.args[-1]", // not an index
+		"tool.name.first",       // through a string
+		"missing.anything",      // nil intermediate
+		"elements[0].x",         // nil array element
+		"tool.command",          // not a string
+		"",                      // no path
+		"tool..name",            // empty segment
+	} {
+		if got, ok := hooksdk.StringField(p, path); ok {
+			t.Errorf("StringField(%q) = %q, want ok=false", path, got)
+		}
+	}
+
+	if args, ok := hooksdk.Field[[]any](p, "tool.command.args"); !ok || len(args) != 3 {
+		t.Errorf("Field[[]any](args) = %v, %v", args, ok)
+	}
+	if n, ok := hooksdk.Field[json.Number](p, "attempt"); !ok || n != "3" {
+		t.Errorf("Field[json.Number](attempt) = %v, %v", n, ok)
+	}
+	// Numbers are json.Number, not int64.
+	if _, ok := hooksdk.Field[int64](p, "attempt"); ok {
+		t.Errorf("Field[int64](attempt) succeeded")
+	}
+}
+
+func TestNumberAndBoolFields(t *testing.T) {
+	p := fieldsPayload()
+	if n, ok := hooksdk.IntField(p, "attempt"); !ok || n != 3 {
+		t.Errorf("IntField(attempt) = %d, %v", n, ok)
+	}
+	if n, ok := hooksdk.IntField(p, "large"); !ok || n != 1000 {
+		t.Errorf("IntField(large) = %d, %v", n, ok)
+	}
+	if _, ok := hooksdk.IntField(p, "ratio"); ok {
+		t.Errorf("IntField(ratio) succeeded for a fraction")
+	}
+	if f, ok := hooksdk.FloatField(p, "ratio"); !ok || f != 0.25 {
+		t.Errorf("FloatField(ratio) = %v, %v", f, ok)
+	}
+	if _, ok := hooksdk.IntField(p, "tool.name"); ok {
+		t.Errorf("IntField(tool.name) succeeded for a string")
+	}
+	if b, ok := hooksdk.BoolField(p, "success"); !ok || !b {
+		t.Errorf("BoolField(success) = %v, %v", b, ok)
+	}
+	if _, ok := hooksdk.BoolField(p, "missing"); ok {
+		t.Errorf("BoolField(missing) succeeded for null")
+	}
+	if _, ok := hooksdk.StringField(nil, "tool.name"); ok {
+		t.Errorf("StringField(nil payload) succeeded")
+	}
+}
+
+func TestProject(t *testing.T) {
+	p := fieldsPayload()
+	got := hooksdk.Project(p, []string{"tool.name", "tool.command.args[2].glob", "elements.1", "attempt", "tool.nope", "bad["})
+	want := hooksdk.HookPayloadJSON{
+		"tool": map[string]any{
+			"name": "shell",
+			"command": map[string]any{
+				"args": []any{nil, nil, map[string]any{"glob": "*.go"}},
+			},
+		},
+		"elements": []any{nil, []any{"nested"}},
+		"attempt":  json.Number("3"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Project = %v\nwant %v", got, want)
+	}
+	if got := hooksdk.Project(p, []string{"nope"}); len(got) != 0 {
+		t.Errorf("Project(unknown path) = %v, want {}", got)
+	}
+	if got := hooksdk.Project(p, nil); !reflect.DeepEqual(got, p) {
+		t.Errorf("Project(no paths) = %v, want the payload unchanged", got)
+	}
+}
+
+func TestOmit(t *testing.T) {
+	p := fieldsPayload()
+	got := hooksdk.Omit(p, []string{"tool.name", "tool.command.args[1]", "attempt", "nope.deeper", "bad["})
+	tool := got["tool"].(map[string]any)
+	if _, ok := tool["name"]; ok {
+		t.Errorf("tool.name is still there: %v", tool)
+	}
+	if args := tool["command"].(map[string]any)["args"].([]any); len(args) != 3 || args[0] != "ls" || args[1] != nil {
+		t.Errorf("args = %v, want the second one nulled in place", args)
+	}
+	if _, ok := got["attempt"]; ok || got["success"] != true {
+		t.Errorf("Omit = %v", got)
+	}
+	// Only copies were changed.
+	if v, _ := hooksdk.StringField(p, "tool.name"); v != "shell" {
+		t.Errorf("Omit modified its input")
+	}
+	if v, _ := hooksdk.StringField(p, "tool.command.args[1]"); v != "-la" {
+		t.Errorf("Omit modified its input's array")
+	}
+}
@@ -0,0 +1,67 @@
+package hooksdk
+
+import "strings"
+
+// Filter selects events by `xcodex_event_type`. Patterns are exact event types or prefixes ending
+// in `*` (e.g. "tool-call-*"; a lone "*" matches everything).
+//
+// An event matches if it matches an Include pattern (or Include is empty) and no Exclude pattern:
+// exclude wins when both match.
+type Filter struct {
+	Include []string
+	Exclude []string
+}
+
+// ParseFilter builds a Filter from comma-separated include and exclude lists, as used by the
+// CODEX_HOOKLOG_INCLUDE / CODEX_HOOKLOG_EXCLUDE settings. Blank entries are ignored.
+func ParseFilter(include, exclude string) Filter {
+	return Filter{Include: splitPatterns(include), Exclude: splitPatterns(exclude)}
+}
+
+// Match reports whether events of eventType pass the filter.
+func (f Filter) Match(eventType string) bool {
+	if matchAny(f.Exclude, eventType) {
+		return false
+	}
+	return len(f.Include) == 0 || matchAny(f.Include, eventType)
+}
+
+// MatchPayload is Match for p's event type.
+func (f Filter) MatchPayload(p *HookPayload) bool {
+	return f.Match(p.EventType())
+}
+
+// WithFilter makes Run answer the events f doesn't match with Allow, from their type alone (see
+// PeekEventType): their payloads aren't decoded and the handler isn't called, so a hook meant for
+// a few event types costs little for the rest. With several WithFilter options, an event must
+// match all of them. Outside Run, RunIO, and Serve the option does nothing.
+func WithFilter(f Filter) Option {
+	return func(o *options) {
+		o.skips = append(o.skips, func(t EventType) (Response, bool) {
+			return Allow(), !f.Match(string(t))
+		})
+	}
+}
+
+func matchAny(patterns []string, eventType string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(eventType, prefix) {
+				return true
+			}
+		} else if pattern == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func splitPatterns(list string) []string {
+	var out []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package hooksdk_test
+
+import (
+	"context"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name, include, exclude string
+		match                  map[string]bool
+	}{
+		{"none", "", "", map[string]bool{"tool-call-started": true, "session-start": true}},
+		{"include only", "tool-call-started, session-end", "", map[string]bool{
+			"tool-call-started": true, "session-end": true, "tool-call-finished": false,
+		}},
+		{"exclude only", "", "notification", map[string]bool{"notification": false, "session-start": true}},
+		{"exclude wins", "tool-*", "tool-call-finished", map[string]bool{
+			"tool-call-started": true, "tool-call-finished": false, "session-start": false,
+		}},
+		{"wildcards", "session-*,model-*", "", map[string]bool{
+			"session-start": true, "session-end": true, "model-request-started": true, "sessions": false, "tool-call-started": false,
+		}},
+		{"everything but", "*", "model-*", map[string]bool{"model-request-started": false, "pre-compact": true}},
+		{"blank entries", " , ,", ",", map[string]bool{"anything": true}},
+	}
+	for _, tt := range tests {
+		f := hooksdk.ParseFilter(tt.include, tt.exclude)
+		for eventType, want := range tt.match {
+			if got := f.Match(eventType); got != want {
+				t.Errorf("%s: Match(%q) = %v, want %v", tt.name, eventType, got, want)
+			}
+		}
+	}
+}
+
+func TestWithFilterSkipsHandler(t *testing.T) {
+	called := false
+	handler := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		called = true
+		return hooksdk.Deny("handled"), nil
+	}
+	f := hooksdk.ParseFilter("tool-*", "")
+	res := hooktest.RunHook(t, handler, hooktest.SessionStart().Bytes(), hooksdk.WithFilter(f))
+	if called || res.ExitCode != hooksdk.ExitOK || res.Response.Decision != hooksdk.DecisionAllow {
+		t.Errorf("excluded event: called = %v, result %+v; want an allow without the handler", called, res)
+	}
+	res = hooktest.RunHook(t, handler, hooktest.ToolCallStarted().Bytes(), hooksdk.WithFilter(f))
+	if !called || res.Response.Reason != "handled" {
+		t.Errorf("included event: called = %v, result %+v", called, res)
+	}
+}
@@ -0,0 +1,336 @@
+// Package filterexpr selects events with a small expression language, for filters that event
+// type lists (hooksdk.Filter) can't express:
+//
+//	expr, err := filterexpr.Compile(`tool_name == "shell" && (exit_code != 0 || duration_ms > 10s)`)
+//	if err != nil { ... } // a syntax error, with its column
+//	ok, err := expr.Eval(hooksdk.HookPayloadJSON(payload.RawPayload))
+//
+// Compile once, when the hook starts, so a mistake is reported there rather than on every event;
+// Eval only fails on a type error, such as comparing a string with a number.
+//
+// The language:
+//
+//   - Fields are dot paths into the payload, as for hooksdk.Field: `tool_input.command`,
+//     `command[0]`.
+//   - Literals are numbers (`0`, `-1.5`), durations (`10s`, `1m30s`, `250ms`), strings (`"..."`
+//     with Go escapes, or `'...'` taken as written, for regular expressions), true, false, and
+//     null.
+//   - `==`, `!=`, `<`, `<=`, `>`, and `>=` compare numbers, strings, and durations;
+//     `a contains b` tests for a substring of a string or an element of an array; and
+//     `a matches 're'` tests a string against a regular expression (RE2 syntax, unanchored).
+//   - `&&` (or `and`), `||` (or `or`), and `!` (or `not`) combine them, binding in the order
+//     not, and, or; `!` applies to the whole comparison after it. Parentheses group.
+//
+// A missing field is null. Null equals only null, and every other comparison with it (`<`,
+// `contains`, `matches`) is false, so `duration_ms > 10s` is false for events without the field
+// and `exit_code != 0` is true; test for the field with `exit_code != null`. Values of different
+// types are never equal, but ordering them is a type error. A number field compares with a
+// duration when its name gives the unit (`_ns`, `_us`, `_ms`, `_s`, `_secs`, `_seconds`), and
+// a string one when it holds a duration such as "1.5s".
+package filterexpr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// Error is a syntax error found by Compile, or a type error found by Eval, at Offset bytes into
+// the expression.
+type Error struct {
+	Offset int
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("filterexpr: column %d: %s", e.Offset+1, e.Msg)
+}
+
+// Expr is a compiled expression. It is safe for concurrent use.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses src. Errors are an *Error.
+func Compile(src string) (*Expr, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the expression's source.
+func (e *Expr) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.src
+}
+
+// Eval reports whether p matches e. A nil e matches everything. Errors are an *Error, for a type
+// error in p; an expression whose value isn't a boolean, such as a bare number field, is one.
+func (e *Expr) Eval(p hooksdk.HookPayloadJSON) (bool, error) {
+	if e == nil {
+		return true, nil
+	}
+	return truth(e.root, p)
+}
+
+// Middleware returns middleware that passes on only the events e matches; the others are
+// allowed without reaching the handler. An event e can't be evaluated on is passed on, with a
+// warning, so a mistake in the filter never silently skips the handler. A nil e passes on
+// everything.
+func (e *Expr) Middleware() hooksdk.Middleware {
+	return func(next hooksdk.Handler) hooksdk.Handler {
+		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			ok, err := e.Eval(hooksdk.HookPayloadJSON(p.RawPayload))
+			if err != nil {
+				hooklog.Warnf("filter %s: %v; handling the event anyway", e, err)
+			} else if !ok {
+				return hooksdk.Allow(), nil
+			}
+			return next(ctx, p)
+		}
+	}
+}
+
+// value is an evaluated operand: nil (null), bool, float64, string, time.Duration, []any, or
+// map[string]any.
+type value struct {
+	v any
+	// unit is the duration of 1 in a number read from a field named with a unit.
+	unit time.Duration
+}
+
+func eval(n node, p hooksdk.HookPayloadJSON) (value, error) {
+	switch n := n.(type) {
+	case *literal:
+		return n.v, nil
+	case *field:
+		v, ok := hooksdk.Field[any](p, n.path)
+		if !ok {
+			return value{}, nil
+		}
+		return value{v: normalize(v), unit: n.unit}, nil
+	case *not:
+		b, err := truth(n.x, p)
+		return value{v: !b}, err
+	case *binary:
+		b, err := evalBinary(n, p)
+		return value{v: b}, err
+	}
+	panic(fmt.Sprintf("filterexpr: unknown node %T", n))
+}
+
+// normalize converts the numbers of a payload to float64 and its objects to map[string]any.
+func normalize(v any) any {
+	switch t := v.(type) {
+	case nil, bool, string, []any, map[string]any:
+		return v
+	case hooksdk.HookPayloadJSON:
+		return map[string]any(t)
+	case []string:
+		a := make([]any, len(t))
+		for i, s := range t {
+			a[i] = s
+		}
+		return a
+	}
+	if f, ok := hooksdk.AsFloat64(v); ok {
+		return f
+	}
+	return v
+}
+
+// truth evaluates n as a condition: a boolean, or null, which is false.
+func truth(n node, p hooksdk.HookPayloadJSON) (bool, error) {
+	v, err := eval(n, p)
+	if err != nil {
+		return false, err
+	}
+	switch b := v.v.(type) {
+	case bool:
+		return b, nil
+	case nil:
+		return false, nil
+	}
+	return false, &Error{Offset: n.pos(), Msg: "expected a boolean, got " + kind(v.v)}
+}
+
+func evalBinary(n *binary, p hooksdk.HookPayloadJSON) (bool, error) {
+	switch n.op {
+	case "&&", "||":
+		x, err := truth(n.x, p)
+		if err != nil || x == (n.op == "||") {
+			return x, err
+		}
+		return truth(n.y, p)
+	}
+	x, err := eval(n.x, p)
+	if err != nil {
+		return false, err
+	}
+	y, err := eval(n.y, p)
+	if err != nil {
+		return false, err
+	}
+	fail := func(format string, args ...any) (bool, error) {
+		return false, &Error{Offset: n.at, Msg: fmt.Sprintf(format, args...)}
+	}
+	switch n.op {
+	case "==", "!=":
+		eq, ok := equal(x, y)
+		if !ok {
+			return fail("can't compare %s and %s with %s", kind(x.v), kind(y.v), n.op)
+		}
+		return eq == (n.op == "=="), nil
+	case "contains":
+		switch t := x.v.(type) {
+		case nil:
+			return false, nil
+		case string:
+			s, ok := y.v.(string)
+			if !ok {
+				return fail("can't test a string for %s", kind(y.v))
+			}
+			return strings.Contains(t, s), nil
+		case []any:
+			for _, elem := range t {
+				if eq, _ := equal(value{v: normalize(elem), unit: x.unit}, y); eq {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return fail("contains takes a string or an array, not %s", kind(x.v))
+	case "matches":
+		switch t := x.v.(type) {
+		case nil:
+			return false, nil
+		case string:
+			return n.re.MatchString(t), nil
+		}
+		return fail("matches takes a string, not %s", kind(x.v))
+	}
+
+	// Ordering.
+	if x.v == nil || y.v == nil {
+		return false, nil
+	}
+	c, ok := order(x, y)
+	if !ok {
+		return fail("can't compare %s and %s with %s", kind(x.v), kind(y.v), n.op)
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+// equal reports whether x and y are equal; ok is false for arrays and objects, which don't
+// compare.
+func equal(x, y value) (eq, ok bool) {
+	if x.v == nil || y.v == nil {
+		return x.v == nil && y.v == nil, true
+	}
+	if isComposite(x.v) || isComposite(y.v) {
+		return false, false
+	}
+	if isDuration(x.v) || isDuration(y.v) {
+		dx, okx := asDuration(x)
+		dy, oky := asDuration(y)
+		return okx && oky && dx == dy, true
+	}
+	return x.v == y.v, true
+}
+
+// order compares x and y, both numbers, strings, or durations; ok is false for other types.
+func order(x, y value) (c int, ok bool) {
+	if isDuration(x.v) || isDuration(y.v) {
+		dx, okx := asDuration(x)
+		dy, oky := asDuration(y)
+		return compare(dx, dy), okx && oky
+	}
+	switch a := x.v.(type) {
+	case float64:
+		if b, ok := y.v.(float64); ok {
+			return compare(a, b), true
+		}
+	case string:
+		if b, ok := y.v.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	}
+	return 0, false
+}
+
+func compare[T float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// asDuration converts v to a duration: a duration, a number from a field named with a unit, or
+// a string such as "1.5s".
+func asDuration(v value) (time.Duration, bool) {
+	switch t := v.v.(type) {
+	case time.Duration:
+		return t, true
+	case float64:
+		return time.Duration(t * float64(v.unit)), v.unit != 0
+	case string:
+		d, err := time.ParseDuration(t)
+		return d, err == nil
+	}
+	return 0, false
+}
+
+func isDuration(v any) bool {
+	_, ok := v.(time.Duration)
+	return ok
+}
+
+func isComposite(v any) bool {
+	switch v.(type) {
+	case []any, map[string]any:
+		return true
+	}
+	return false
+}
+
+// kind names the type of v in errors.
+func kind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case time.Duration:
+		return "a duration"
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,357 @@
+package filterexpr_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/filterexpr"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// payload is a tool call as it arrives on stdin, so its numbers are float64.
+func payload(t *testing.T) hooksdk.HookPayloadJSON {
+	t.Helper()
+	var p hooksdk.HookPayloadJSON
+	err := json.Unmarshal([]byte(`{
+		"tool_name": "shell",
+		"exit_code": 1,
+		"duration_ms": 12000,
+		"wait_s": 3,
+		"attempt": 2,
+		"elapsed": "1.5s",
+		"success": false,
+		"cwd": "/work",
+		"tags": ["a", "b"],
+		"nothing": null,
+		"tool_input": {"command": ["bash", "-lc", "go test ./..."]}
+	}`), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestEval(t *testing.T) {
+	p := payload(t)
+	tests := []struct {
+		src  string
+		want bool
+		err  string // a substring of the type error, if one is expected
+	}{
+		// Comparisons.
+		{`tool_name == "shell"`, true, ""},
+		{`tool_name != "shell"`, false, ""},
+		{`exit_code == 1`, true, ""},
+		{`exit_code != 0`, true, ""},
+		{`attempt <= 2`, true, ""},
+		{`attempt < 2`, false, ""},
+		{`attempt > 1.5`, true, ""},
+		{`-1.5 < attempt`, true, ""},
+		{`cwd < "/x"`, true, ""},
+		{`cwd >= "/x"`, false, ""},
+		{`success == false`, true, ""},
+		{`true == true`, true, ""},
+		{`null == null`, true, ""},
+
+		// Durations, against unit-named number fields and duration strings.
+		{`duration_ms > 10s`, true, ""},
+		{`duration_ms > 12s`, false, ""},
+		{`duration_ms >= 12s`, true, ""},
+		{`duration_ms == 12000ms`, true, ""},
+		{`duration_ms < 1m30s`, true, ""},
+		{`wait_s == 3000ms`, true, ""},
+		{`wait_s < 1m`, true, ""},
+		{`elapsed < 2s`, true, ""},
+		{`elapsed == 1500ms`, true, ""},
+		{`10s < duration_ms`, true, ""},
+		{`exit_code == 1s`, false, ""}, // no unit: a number isn't a duration, so they differ
+
+		// Field paths.
+		{`tool_input.command[0] == "bash"`, true, ""},
+		{`tool_input.command.2 contains "test"`, true, ""},
+		{`tool_input.command[5] == null`, true, ""},
+		{`tool_input.missing.deeper == null`, true, ""},
+
+		// contains and matches.
+		{`cwd contains "wor"`, true, ""},
+		{`cwd contains "x"`, false, ""},
+		{`tags contains "b"`, true, ""},
+		{`tags contains "c"`, false, ""},
+		{`tags contains 1`, false, ""},
+		{`tool_input.command contains "-lc"`, true, ""},
+		{`tool_name matches '^sh'`, true, ""},
+		{`tool_name matches "^(bash|zsh)$"`, false, ""},
+		{`tool_input.command[2] matches '\./\.\.\.$'`, true, ""},
+		{`tool_name matches 'ELL'`, false, ""},
+		{`tool_name matches '(?i)ELL'`, true, ""},
+
+		// Boolean operators and precedence.
+		{`!success`, true, ""},
+		{`not success`, true, ""},
+		{`!!success`, false, ""},
+		{`!exit_code == 1`, false, ""}, // ! applies to the comparison
+		{`!exit_code == 0`, true, ""},
+		{`success || exit_code == 1`, true, ""},
+		{`success or exit_code == 2`, false, ""},
+		{`exit_code == 1 and tool_name == "shell"`, true, ""},
+		{`true || false && false`, true, ""},
+		{`(true || false) && false`, false, ""},
+		{`not (success or exit_code == 2)`, true, ""},
+		{`tool_name == "shell" && (exit_code != 0 || duration_ms > 10s)`, true, ""},
+
+		// Short-circuiting skips the type error on the other side.
+		{`false && tool_name > 1`, false, ""},
+		{`true || tool_name > 1`, true, ""},
+		{`true && tool_name > 1`, false, "can't compare a string and a number with >"},
+
+		// A missing field, or a null one, is null.
+		{`missing == null`, true, ""},
+		{`nothing == null`, true, ""},
+		{`missing != null`, false, ""},
+		{`exit_code != null`, true, ""},
+		{`tool_input != null`, true, ""},
+		{`missing != 0`, true, ""},
+		{`missing == ""`, false, ""},
+		{`missing > 10s`, false, ""},
+		{`missing < 0`, false, ""},
+		{`0 <= missing`, false, ""},
+		{`missing contains "x"`, false, ""},
+		{`missing matches 'x'`, false, ""},
+		{`missing`, false, ""},
+		{`!missing`, true, ""},
+
+		// Values of different types are unequal, but ordering them is an error.
+		{`tool_name == 1`, false, ""},
+		{`exit_code == "1"`, false, ""},
+		{`success != 0`, true, ""},
+		{`tool_name > 1`, false, "can't compare a string and a number with >"},
+		{`exit_code > 1s`, false, "can't compare a number and a duration with >"},
+		{`success < true`, false, "can't compare a boolean and a boolean with <"},
+		{`cwd <= 10s`, false, "can't compare a string and a duration with <="},
+		{`tags == "a"`, false, "can't compare an array and a string with =="},
+		{`tool_input != 1`, false, "can't compare an object and a number with !="},
+		{`exit_code contains 1`, false, "contains takes a string or an array, not a number"},
+		{`tool_input contains "bash"`, false, "contains takes a string or an array, not an object"},
+		{`cwd contains 1`, false, "can't test a string for a number"},
+		{`exit_code matches 'x'`, false, "matches takes a string, not a number"},
+		{`tags matches 'a'`, false, "matches takes a string, not an array"},
+
+		// The expression, and each side of && and ||, must be a boolean.
+		{`exit_code`, false, "expected a boolean, got a number"},
+		{`tool_name`, false, "expected a boolean, got a string"},
+		{`"yes"`, false, "expected a boolean, got a string"},
+		{`10s`, false, "expected a boolean, got a duration"},
+		{`tags || true`, false, "expected a boolean, got an array"},
+		{`!cwd`, false, "expected a boolean, got a string"},
+	}
+	for _, tt := range tests {
+		expr, err := filterexpr.Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", tt.src, err)
+			continue
+		}
+		got, err := expr.Eval(p)
+		if tt.err != "" {
+			var e *filterexpr.Error
+			if !errors.As(err, &e) || !strings.Contains(e.Msg, tt.err) {
+				t.Errorf("%s: error = %v, want %q", tt.src, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %v, %v; want %v", tt.src, got, err, tt.want)
+		}
+	}
+}
+
+// TestEvalErrorOffset checks that a type error points at its operator, or at the operand that
+// isn't a boolean.
+func TestEvalErrorOffset(t *testing.T) {
+	p := payload(t)
+	for src, col := range map[string]int{
+		`tool_name > 1`:             11,
+		`!success && exit_code`:     13,
+		`exit_code == 1 && cwd > 1`: 23,
+	} {
+		expr, err := filterexpr.Compile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = expr.Eval(p)
+		var e *filterexpr.Error
+		if !errors.As(err, &e) || e.Offset+1 != col || !strings.HasPrefix(err.Error(), "filterexpr: column ") {
+			t.Errorf("%s: error = %v, want one at column %d", src, err, col)
+		}
+	}
+}
+
+// TestEvalGoValues checks payloads built in Go, whose numbers, arrays, and objects aren't the
+// types JSON decodes to.
+func TestEvalGoValues(t *testing.T) {
+	p := hooksdk.HookPayloadJSON{
+		"exit_code":   2,
+		"duration_ms": int64(1500),
+		"size":        uint8(7),
+		"command":     []string{"ls", "-la"},
+		"nested":      hooksdk.HookPayloadJSON{"depth": 3.0},
+	}
+	for _, src := range []string{
+		`exit_code == 2`,
+		`duration_ms > 1s && duration_ms < 2s`,
+		`size < 8`,
+		`command contains "-la"`,
+		`command[0] == "ls"`,
+		`nested.depth >= 3`,
+		`nested != null`,
+	} {
+		expr, err := filterexpr.Compile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, err := expr.Eval(p); !ok || err != nil {
+			t.Errorf("%s = %v, %v; want true", src, ok, err)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		col int
+		msg string
+	}{
+		{``, 1, "empty expression"},
+		{`   `, 1, "empty expression"},
+		{`exit_code !=`, 13, "unexpected end of expression"},
+		{`exit_code = 1`, 11, "use == to compare"},
+		{`a == "b`, 6, "unterminated string"},
+		{`a == 'b`, 6, "unterminated string"},
+		{`a == "\q"`, 6, "bad string"},
+		{`(a == 1`, 8, "missing )"},
+		{`a == 1)`, 7, `unexpected ")"`},
+		{`a == 1 b`, 8, `unexpected "b"`},
+		{`a == 1 && && b`, 11, `unexpected "&&"`},
+		{`a < < b`, 5, `unexpected "<"`},
+		{`a @ b`, 3, `unexpected '@'`},
+		{`a matches b`, 11, "matches takes a string literal pattern"},
+		{`a matches 1`, 11, "matches takes a string literal pattern"},
+		{`a matches '('`, 11, "bad pattern"},
+		{`a == 10parsecs`, 6, "bad duration"},
+		{`a == 1.2.3`, 6, "bad number"},
+		{`a..b == 1`, 1, "bad field path"},
+		{`a. == 1`, 1, "bad field path"},
+		{`a[x] == 1`, 1, "bad field path"},
+		{`a] == 1`, 1, "bad field path"},
+		{`x && a[] == 1`, 6, "bad field path"},
+	}
+	for _, tt := range tests {
+		expr, err := filterexpr.Compile(tt.src)
+		var e *filterexpr.Error
+		if !errors.As(err, &e) {
+			t.Errorf("Compile(%q) = %v, %v; want an *Error", tt.src, expr, err)
+			continue
+		}
+		if e.Offset+1 != tt.col || !strings.Contains(e.Msg, tt.msg) {
+			t.Errorf("Compile(%q): %v; want %q at column %d", tt.src, err, tt.msg, tt.col)
+		}
+		if want := "filterexpr: column "; !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("Compile(%q): %q doesn't start with %q", tt.src, err, want)
+		}
+	}
+
+	// Spacing, keywords as operators, and the literal forms all parse.
+	for _, src := range []string{
+		"a==1&&b!=2||!c",
+		"\ta == 1\n\tor b == 2\r\n",
+		`a == 1µs || a == 250ms || a == -0.5 || a == .5`,
+		`a == "tab\tquote\"" || a matches '\d+\s'`,
+		`((a))`,
+	} {
+		if _, err := filterexpr.Compile(src); err != nil {
+			t.Errorf("Compile(%q): %v", src, err)
+		}
+	}
+}
+
+func TestNil(t *testing.T) {
+	var expr *filterexpr.Expr
+	if ok, err := expr.Eval(hooksdk.HookPayloadJSON{}); !ok || err != nil {
+		t.Errorf("nil Eval = %v, %v; want true", ok, err)
+	}
+	if s := expr.String(); s != "" {
+		t.Errorf("nil String = %q", s)
+	}
+	src := `exit_code != 0`
+	if expr, _ := filterexpr.Compile(src); expr.String() != src {
+		t.Errorf("String = %q, want %q", expr.String(), src)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var handled []string
+	handler := func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		handled = append(handled, p.EventId)
+		return hooksdk.Deny("handled"), nil
+	}
+	expr, err := filterexpr.Compile(`exit_code != 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := map[string]*hooksdk.HookPayload{
+		"failed":     hooktest.ToolCallFinished().With("event_id", "failed").With("exit_code", 2).Build(),
+		"ok":         hooktest.ToolCallFinished().With("event_id", "ok").With("exit_code", 0).Build(),
+		"no exit":    hooktest.SessionStart().With("event_id", "no exit").Build(),
+		"mistyped":   hooktest.ToolCallFinished().With("event_id", "mistyped").With("exit_code", []int{1}).Build(),
+		"no payload": {EventId: "no payload"},
+	}
+	wrapped := expr.Middleware()(handler)
+	for id, want := range map[string]hooksdk.Decision{
+		"failed":     hooksdk.DecisionDeny,
+		"ok":         hooksdk.DecisionAllow,
+		"no exit":    hooksdk.DecisionDeny, // null != 0
+		"mistyped":   hooksdk.DecisionDeny, // can't be evaluated, so handled
+		"no payload": hooksdk.DecisionDeny,
+	} {
+		handled = nil
+		resp, err := wrapped(context.Background(), events[id])
+		if err != nil || resp.Decision != want {
+			t.Errorf("%s: %+v, %v; want %s", id, resp, err, want)
+		}
+		if skipped := len(handled) == 0; skipped != (want == hooksdk.DecisionAllow) {
+			t.Errorf("%s: handled = %q", id, handled)
+		}
+	}
+
+	// A nil expression passes everything on.
+	handled = nil
+	if resp, _ := (*filterexpr.Expr)(nil).Middleware()(handler)(context.Background(), events["ok"]); resp.Decision != hooksdk.DecisionDeny || len(handled) != 1 {
+		t.Errorf("nil middleware = %+v, handled %q", resp, handled)
+	}
+}
+
+func TestConcurrentEval(t *testing.T) {
+	expr, err := filterexpr.Compile(`tool_name matches '^sh' && duration_ms > 10s`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := payload(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if ok, err := expr.Eval(p); !ok || err != nil {
+					t.Errorf("Eval = %v, %v", ok, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,398 @@
+package filterexpr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Tokens. Keywords and operators are tokOp, with the keyword or operator as their text.
+const (
+	tokEOF = iota
+	tokOp
+	tokField
+	tokNumber
+	tokDuration
+	tokString
+	tokTrue
+	tokFalse
+	tokNull
+)
+
+type token struct {
+	kind int
+	at   int
+	text string
+	// str is the value of a tokString.
+	str string
+}
+
+// node is a parsed expression; at is the byte offset it is reported at.
+type node interface {
+	pos() int
+}
+
+type literal struct {
+	at int
+	v  value
+}
+
+type field struct {
+	at   int
+	path string
+	// unit is the duration of 1 in a number at path, from its suffix (`_ms`, `_s`, ...), or 0.
+	unit time.Duration
+}
+
+type not struct {
+	at int
+	x  node
+}
+
+type binary struct {
+	at   int
+	op   string
+	x, y node
+	// re is the pattern of a `matches`.
+	re *regexp.Regexp
+}
+
+func (n *literal) pos() int { return n.at }
+func (n *field) pos() int   { return n.at }
+func (n *not) pos() int     { return n.at }
+func (n *binary) pos() int  { return n.at }
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func parse(src string) (node, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if p.peek().kind == tokEOF {
+		return nil, &Error{Offset: 0, Msg: "empty expression"}
+	}
+	n, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.unexpected(t)
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators ops.
+func (p *parser) accept(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return t, false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return p.next(), true
+		}
+	}
+	return t, false
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokEOF {
+		return &Error{Offset: t.at, Msg: "unexpected end of expression"}
+	}
+	return &Error{Offset: t.at, Msg: "unexpected " + strconv.Quote(t.text)}
+}
+
+// or := and (("||" | "or") and)*
+func (p *parser) or() (node, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept("||", "or")
+		if !ok {
+			return x, nil
+		}
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{at: t.at, op: "||", x: x, y: y}
+	}
+}
+
+// and := not (("&&" | "and") not)*
+func (p *parser) and() (node, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept("&&", "and")
+		if !ok {
+			return x, nil
+		}
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{at: t.at, op: "&&", x: x, y: y}
+	}
+}
+
+// not := ("!" | "not") not | comparison
+func (p *parser) not() (node, error) {
+	if t, ok := p.accept("!", "not"); ok {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &not{at: t.at, x: x}, nil
+	}
+	return p.comparison()
+}
+
+// comparison := operand (op operand)?
+func (p *parser) comparison() (node, error) {
+	x, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "contains", "matches")
+	if !ok {
+		return x, nil
+	}
+	y, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	b := &binary{at: t.at, op: t.text, x: x, y: y}
+	if b.op == "matches" {
+		var pattern string
+		isString := false
+		if lit, ok := y.(*literal); ok {
+			pattern, isString = lit.v.v.(string)
+		}
+		if !isString {
+			return nil, &Error{Offset: y.pos(), Msg: "matches takes a string literal pattern"}
+		}
+		if b.re, err = regexp.Compile(pattern); err != nil {
+			return nil, &Error{Offset: y.pos(), Msg: "bad pattern: " + err.Error()}
+		}
+	}
+	return b, nil
+}
+
+// operand := literal | field | "(" or ")"
+func (p *parser) operand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokField:
+		return &field{at: t.at, path: t.text, unit: unitOf(t.text)}, nil
+	case tokString:
+		return &literal{at: t.at, v: value{v: t.str}}, nil
+	case tokTrue, tokFalse:
+		return &literal{at: t.at, v: value{v: t.kind == tokTrue}}, nil
+	case tokNull:
+		return &literal{at: t.at}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &Error{Offset: t.at, Msg: "bad number " + strconv.Quote(t.text)}
+		}
+		return &literal{at: t.at, v: value{v: f}}, nil
+	case tokDuration:
+		d, err := time.ParseDuration(t.text)
+		if err != nil {
+			return nil, &Error{Offset: t.at, Msg: "bad duration " + strconv.Quote(t.text)}
+		}
+		return &literal{at: t.at, v: value{v: d}}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, &Error{Offset: p.peek().at, Msg: "missing )"}
+			}
+			return x, nil
+		}
+	}
+	return nil, p.unexpected(t)
+}
+
+// unitOf is the duration of 1 in a number field named with a unit suffix, such as duration_ms.
+func unitOf(path string) time.Duration {
+	name := path
+	if i := strings.LastIndexAny(path, ".["); i >= 0 {
+		name = path[i+1:]
+	}
+	for _, u := range []struct {
+		suffix string
+		unit   time.Duration
+	}{
+		{"_ns", time.Nanosecond},
+		{"_us", time.Microsecond},
+		{"_ms", time.Millisecond},
+		{"_s", time.Second},
+		{"_sec", time.Second},
+		{"_secs", time.Second},
+		{"_seconds", time.Second},
+	} {
+		if strings.HasSuffix(name, u.suffix) {
+			return u.unit
+		}
+	}
+	return 0
+}
+
+var keywords = map[string]int{
+	"and": tokOp, "or": tokOp, "not": tokOp, "contains": tokOp, "matches": tokOp,
+	"true": tokTrue, "false": tokFalse, "null": tokNull,
+}
+
+// lex splits src into tokens, ending with a tokEOF.
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; ; {
+		for i < len(src) && isSpace(src[i]) {
+			i++
+		}
+		if i == len(src) {
+			return append(toks, token{kind: tokEOF, at: i}), nil
+		}
+		start, c := i, src[i]
+		switch {
+		case isIdentStart(c):
+			i = lexPath(src, i)
+			text := src[start:i]
+			kind, ok := keywords[text]
+			if !ok {
+				if !validPath(text) {
+					return nil, &Error{Offset: start, Msg: "bad field path " + strconv.Quote(text)}
+				}
+				kind = tokField
+			}
+			toks = append(toks, token{kind: kind, at: start, text: text})
+		case isDigit(c) || (c == '-' || c == '.') && i+1 < len(src) && isDigit(src[i+1]):
+			// A number, or a duration such as 10s or 1m30s; µ (0xc2 0xb5) is for 1µs.
+			i++
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.' || isLetter(src[i]) || src[i] == 0xc2 || src[i] == 0xb5) {
+				i++
+			}
+			kind := tokNumber
+			if _, err := strconv.ParseFloat(src[start:i], 64); err != nil && strings.IndexFunc(src[start:i], unicode.IsLetter) >= 0 {
+				kind = tokDuration
+			}
+			toks = append(toks, token{kind: kind, at: start, text: src[start:i]})
+		case c == '"' || c == '\'':
+			s, end, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, token{kind: tokString, at: start, text: src[start:end], str: s})
+			i = end
+		default:
+			op := ""
+			for _, o := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")"} {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				if c == '=' {
+					return nil, &Error{Offset: start, Msg: `unexpected "="; use == to compare`}
+				}
+				return nil, &Error{Offset: start, Msg: "unexpected " + strconv.QuoteRune(rune(c))}
+			}
+			toks = append(toks, token{kind: tokOp, at: start, text: op})
+			i += len(op)
+		}
+	}
+}
+
+// lexPath returns the end of the field path at src[i]: identifiers joined by dots, with numeric
+// indexes as their own segment or in brackets.
+func lexPath(src string, i int) int {
+	for i < len(src) {
+		c := src[i]
+		if isIdentStart(c) || isDigit(c) || c == '.' || c == '[' || c == ']' {
+			i++
+			continue
+		}
+		break
+	}
+	return i
+}
+
+// validPath reports whether path is a complete path: no empty segments, and brackets that hold
+// an index.
+func validPath(path string) bool {
+	if strings.HasSuffix(path, ".") || strings.Contains(path, "..") {
+		return false
+	}
+	for rest := path; ; {
+		open := strings.IndexByte(rest, '[')
+		if open < 0 {
+			return !strings.Contains(rest, "]")
+		}
+		end := strings.IndexByte(rest[open:], ']')
+		if end < 2 {
+			return false
+		}
+		if _, err := strconv.Atoi(rest[open+1 : open+end]); err != nil {
+			return false
+		}
+		rest = rest[open+end+1:]
+	}
+}
+
+// lexString reads the string literal at src[i] and returns its value and end. Double-quoted
+// strings take Go escapes; single-quoted ones are taken as written, which suits regular
+// expressions.
+func lexString(src string, i int) (string, int, error) {
+	quote := src[i]
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			if quote == '"' {
+				j++
+			}
+		case quote:
+			if quote == '\'' {
+				return src[i+1 : j], j + 1, nil
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return "", 0, &Error{Offset: i, Msg: "bad string " + src[i:j+1]}
+			}
+			return s, j + 1, nil
+		}
+	}
+	return "", 0, &Error{Offset: i, Msg: "unterminated string"}
+}
+
+func isSpace(c byte) bool  { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+func isDigit(c byte) bool  { return '0' <= c && c <= '9' }
+func isLetter(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+
+func isIdentStart(c byte) bool { return isLetter(c) || c == '_' }
@@ -0,0 +1,97 @@
+package gha
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// Kinds of annotation, as listed in CODEX_HOOK_GHA_ANNOTATE.
+const (
+	// KindDenial is a command or write blocked by a guard hook.
+	KindDenial = "denial"
+	// KindPatchFailure is a patch that failed to apply.
+	KindPatchFailure = "patch-failure"
+	// KindToolFailure is any other tool call that failed or was aborted.
+	KindToolFailure = "tool-failure"
+	// KindApproval is a request for the user's approval.
+	KindApproval = "approval"
+)
+
+// DefaultKinds are annotated when CODEX_HOOK_GHA_ANNOTATE is unset.
+var DefaultKinds = []string{KindDenial, KindPatchFailure}
+
+// InActions reports whether the process runs in a GitHub Actions job.
+func InActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// Enabled reports whether annotations of kind should be emitted: the job runs in GitHub Actions
+// and kind is listed in CODEX_HOOK_GHA_ANNOTATE (a comma-separated list; `all` enables every kind),
+// or in DefaultKinds when that is unset.
+func Enabled(kind string) bool {
+	if !InActions() {
+		return false
+	}
+	kinds := DefaultKinds
+	if v, ok := os.LookupEnv("CODEX_HOOK_GHA_ANNOTATE"); ok {
+		kinds = strings.Split(v, ",")
+	}
+	for _, k := range kinds {
+		if k = strings.TrimSpace(k); k == kind || k == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// AnnotationsPath is the file Emit appends to: CODEX_HOOK_GHA_ANNOTATIONS, or
+// `$RUNNER_TEMP/xcodex-annotations.txt` (`$CODEX_HOME/hooks/gha/annotations.txt` outside a runner).
+func AnnotationsPath() string {
+	if p := os.Getenv("CODEX_HOOK_GHA_ANNOTATIONS"); p != "" {
+		return p
+	}
+	if tmp := os.Getenv("RUNNER_TEMP"); tmp != "" {
+		return filepath.Join(tmp, "xcodex-annotations.txt")
+	}
+	return hooksdk.Environ().Path("hooks", "gha", "annotations.txt")
+}
+
+// Emit appends a to AnnotationsPath. Each annotation is a single write to a file opened for
+// appending, so hooks running in parallel don't interleave their lines.
+func Emit(a Annotation) error {
+	path := AnnotationsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(a.String() + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// WorkspacePath makes path (absolute, or relative to dir) relative to GITHUB_WORKSPACE, with
+// forward slashes, which is how annotations name files. Paths outside the workspace, or any path
+// when GITHUB_WORKSPACE is unset, are returned cleaned but otherwise as given.
+func WorkspacePath(path, dir string) string {
+	if path == "" {
+		return ""
+	}
+	abs := path
+	if !filepath.IsAbs(abs) && dir != "" {
+		abs = filepath.Join(dir, abs)
+	}
+	if ws := os.Getenv("GITHUB_WORKSPACE"); ws != "" && filepath.IsAbs(abs) {
+		if rel, err := filepath.Rel(ws, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
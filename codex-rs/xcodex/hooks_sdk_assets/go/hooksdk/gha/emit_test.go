@@ -0,0 +1,131 @@
+package gha_test
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+)
+
+func TestEnabled(t *testing.T) {
+	tests := []struct {
+		actions  string
+		annotate *string
+		kind     string
+		want     bool
+	}{
+		{"", nil, gha.KindDenial, false},
+		{"false", nil, gha.KindDenial, false},
+		{"true", nil, gha.KindDenial, true},
+		{"true", nil, gha.KindPatchFailure, true},
+		{"true", nil, gha.KindApproval, false},
+		{"true", ptr("approval, tool-failure"), gha.KindApproval, true},
+		{"true", ptr("approval, tool-failure"), gha.KindDenial, false},
+		{"true", ptr("all"), gha.KindToolFailure, true},
+		// Set but empty turns every kind off.
+		{"true", ptr(""), gha.KindDenial, false},
+	}
+	// Restored after the test, though the cases unset it.
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATE", "")
+	for _, tt := range tests {
+		t.Setenv("GITHUB_ACTIONS", tt.actions)
+		if tt.annotate != nil {
+			t.Setenv("CODEX_HOOK_GHA_ANNOTATE", *tt.annotate)
+		} else {
+			os.Unsetenv("CODEX_HOOK_GHA_ANNOTATE")
+		}
+		if got := gha.Enabled(tt.kind); got != tt.want {
+			t.Errorf("GITHUB_ACTIONS=%q CODEX_HOOK_GHA_ANNOTATE=%v: Enabled(%s) = %v, want %v", tt.actions, tt.annotate, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func ptr(s string) *string { return &s }
+
+func TestAnnotationsPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATIONS", "")
+	t.Setenv("RUNNER_TEMP", "")
+	if got, want := gha.AnnotationsPath(), filepath.Join(home, "hooks", "gha", "annotations.txt"); got != want {
+		t.Errorf("outside a runner: AnnotationsPath = %s, want %s", got, want)
+	}
+	t.Setenv("RUNNER_TEMP", "/runner/tmp")
+	if got, want := gha.AnnotationsPath(), filepath.Join("/runner/tmp", "xcodex-annotations.txt"); got != want {
+		t.Errorf("on a runner: AnnotationsPath = %s, want %s", got, want)
+	}
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATIONS", "/custom.txt")
+	if got := gha.AnnotationsPath(); got != "/custom.txt" {
+		t.Errorf("with CODEX_HOOK_GHA_ANNOTATIONS: AnnotationsPath = %s", got)
+	}
+}
+
+func TestWorkspacePath(t *testing.T) {
+	ws := filepath.Join(t.TempDir(), "repo")
+	t.Setenv("GITHUB_WORKSPACE", ws)
+	tests := []struct {
+		path, dir, want string
+	}{
+		{"", ws, ""},
+		{filepath.Join(ws, "src", "a.go"), "", "src/a.go"},
+		{"b.go", filepath.Join(ws, "pkg"), "pkg/b.go"},
+		{"../c.go", filepath.Join(ws, "pkg"), "c.go"},
+		// Outside the workspace, the path is returned as given.
+		{"/etc/passwd", ws, "/etc/passwd"},
+		{"../../x.go", ws, "../../x.go"},
+		{filepath.Join(ws+"-other", "d.go"), "", filepath.ToSlash(filepath.Join(ws+"-other", "d.go"))},
+	}
+	for _, tt := range tests {
+		if got := gha.WorkspacePath(tt.path, tt.dir); got != tt.want {
+			t.Errorf("WorkspacePath(%q, %q) = %q, want %q", tt.path, tt.dir, got, tt.want)
+		}
+	}
+
+	t.Setenv("GITHUB_WORKSPACE", "")
+	if got := gha.WorkspacePath("./x/../y.go", ws); got != "y.go" {
+		t.Errorf("without a workspace: WorkspacePath = %q, want y.go", got)
+	}
+}
+
+func TestEmit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new", "annotations.txt")
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATIONS", path)
+	const writers, n = 8, 25
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				a := gha.Annotation{Level: gha.Error, File: "a.go", Line: i + 1, Message: fmt.Sprintf("writer %d\nline %d", w, i)}
+				if err := gha.Emit(a); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var w, i int
+		a, ok := gha.ParseAnnotation(sc.Text())
+		if _, err := fmt.Sscanf(a.Message, "writer %d\nline %d", &w, &i); !ok || err != nil || a.Line != i+1 {
+			t.Errorf("torn annotation %q", sc.Text())
+		}
+		lines++
+	}
+	if lines != writers*n {
+		t.Errorf("%d annotations, want %d", lines, writers*n)
+	}
+}
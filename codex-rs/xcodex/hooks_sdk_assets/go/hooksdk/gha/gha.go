@@ -0,0 +1,184 @@
+// Package gha formats GitHub Actions workflow commands (`::warning file=...::message`) and step
+// summary markdown for hooks running in a CI job.
+//
+// Hook output goes to xcodex's hook logs, not to the job log, so a command printed by a hook is
+// never seen by the runner. Emit appends annotations to a file instead (AnnotationsPath); a later
+// step prints it, and the runner turns each line into an annotation:
+//
+//	steps:
+//	  - name: Show xcodex annotations
+//	    if: always()
+//	    run: cat "$RUNNER_TEMP/xcodex-annotations.txt" 2>/dev/null || true
+//
+// A Tracker follows each session's activity across hook invocations, for a step summary written
+// when the session ends.
+package gha
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Level is the severity of an annotation, which is also its workflow command name.
+type Level string
+
+const (
+	Notice  Level = "notice"
+	Warning Level = "warning"
+	Error   Level = "error"
+)
+
+// Property is a `key=value` parameter of a workflow command.
+type Property struct {
+	Key, Value string
+}
+
+// Command is a workflow command: `::name key=value,...::message`.
+type Command struct {
+	Name       string
+	Properties []Property
+	Message    string
+}
+
+// String renders the command on one line, escaping the message and property values.
+func (c Command) String() string {
+	var b strings.Builder
+	b.WriteString("::")
+	b.WriteString(c.Name)
+	for i, p := range c.Properties {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(p.Key)
+		b.WriteByte('=')
+		b.WriteString(EscapeProperty(p.Value))
+	}
+	b.WriteString("::")
+	b.WriteString(EscapeData(c.Message))
+	return b.String()
+}
+
+// ParseCommand reads back a line written by Command.String; ok is false for any other line.
+func ParseCommand(line string) (Command, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), "::")
+	if !ok {
+		return Command{}, false
+	}
+	head, msg, ok := strings.Cut(rest, "::")
+	if !ok {
+		return Command{}, false
+	}
+	name, props, _ := strings.Cut(head, " ")
+	if name == "" {
+		return Command{}, false
+	}
+	c := Command{Name: name, Message: unescape(msg)}
+	if props != "" {
+		for _, kv := range strings.Split(props, ",") {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok || k == "" {
+				return Command{}, false
+			}
+			c.Properties = append(c.Properties, Property{Key: k, Value: unescape(v)})
+		}
+	}
+	return c, true
+}
+
+// Property returns the value of the property key, or "".
+func (c Command) Property(key string) string {
+	for _, p := range c.Properties {
+		if p.Key == key {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+var (
+	dataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	propertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	unescaper       = strings.NewReplacer("%25", "%", "%0D", "\r", "%0A", "\n", "%3A", ":", "%2C", ",")
+)
+
+// EscapeData escapes a command's message: `%`, CR, and LF, so that a multi-line message stays
+// one command (the runner shows the line breaks).
+func EscapeData(s string) string {
+	return dataEscaper.Replace(s)
+}
+
+// EscapeProperty escapes a property value: like EscapeData, plus the `:` and `,` that separate
+// properties.
+func EscapeProperty(s string) string {
+	return propertyEscaper.Replace(s)
+}
+
+// unescape undoes both escapings in a single pass, so `%253A` stays `%3A`.
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
+
+// Annotation is a notice, warning, or error shown on the workflow run and, when File is set, on
+// that file in the pull request diff.
+type Annotation struct {
+	Level Level
+	// File is relative to the repository root (see WorkspacePath).
+	File string
+	// Line and EndLine are 1-based; 0 means unknown.
+	Line, EndLine int
+	Title         string
+	Message       string
+}
+
+// Command is the workflow command for a. An annotation without a level is a warning.
+func (a Annotation) Command() Command {
+	c := Command{Name: string(a.Level), Message: a.Message}
+	if c.Name == "" {
+		c.Name = string(Warning)
+	}
+	if a.File != "" {
+		c.Properties = append(c.Properties, Property{"file", a.File})
+		if a.Line > 0 {
+			c.Properties = append(c.Properties, Property{"line", strconv.Itoa(a.Line)})
+			if a.EndLine > a.Line {
+				c.Properties = append(c.Properties, Property{"endLine", strconv.Itoa(a.EndLine)})
+			}
+		}
+	}
+	if a.Title != "" {
+		c.Properties = append(c.Properties, Property{"title", a.Title})
+	}
+	return c
+}
+
+// String is the workflow command line for a.
+func (a Annotation) String() string {
+	return a.Command().String()
+}
+
+// ParseAnnotation reads back a line written by Annotation.String.
+func ParseAnnotation(line string) (Annotation, bool) {
+	c, ok := ParseCommand(line)
+	if !ok {
+		return Annotation{}, false
+	}
+	switch Level(c.Name) {
+	case Notice, Warning, Error:
+	default:
+		return Annotation{}, false
+	}
+	a := Annotation{Level: Level(c.Name), File: c.Property("file"), Title: c.Property("title"), Message: c.Message}
+	a.Line, _ = strconv.Atoi(c.Property("line"))
+	a.EndLine, _ = strconv.Atoi(c.Property("endLine"))
+	return a, true
+}
+
+// Location is `file:line`, `file`, or "" when the annotation isn't tied to a file.
+func (a Annotation) Location() string {
+	if a.File == "" || a.Line <= 0 {
+		return a.File
+	}
+	return a.File + ":" + strconv.Itoa(a.Line)
+}
@@ -0,0 +1,100 @@
+package gha_test
+
+import (
+	"reflect"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in, data, property string
+	}{
+		{"plain text", "plain text", "plain text"},
+		{"100%", "100%25", "100%25"},
+		{"line one\nline two", "line one%0Aline two", "line one%0Aline two"},
+		{"crlf\r\n", "crlf%0D%0A", "crlf%0D%0A"},
+		{"a:b,c", "a:b,c", "a%3Ab%2Cc"},
+		// Already-escaped text is escaped again, not passed through.
+		{"%0A", "%250A", "%250A"},
+		{"::error::x", "::error::x", "%3A%3Aerror%3A%3Ax"},
+	}
+	for _, tt := range tests {
+		if got := gha.EscapeData(tt.in); got != tt.data {
+			t.Errorf("EscapeData(%q) = %q, want %q", tt.in, got, tt.data)
+		}
+		if got := gha.EscapeProperty(tt.in); got != tt.property {
+			t.Errorf("EscapeProperty(%q) = %q, want %q", tt.in, got, tt.property)
+		}
+	}
+}
+
+func TestCommandString(t *testing.T) {
+	c := gha.Command{
+		Name:       "warning",
+		Properties: []gha.Property{{"file", "src/a,b.go"}, {"title", "Bad: 50%"}},
+		Message:    "first\nsecond",
+	}
+	const want = "::warning file=src/a%2Cb.go,title=Bad%3A 50%25::first%0Asecond"
+	if got := c.String(); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	if got := (gha.Command{Name: "notice", Message: "hi"}).String(); got != "::notice::hi" {
+		t.Errorf("command without properties = %q", got)
+	}
+}
+
+func TestParseCommandRoundTrip(t *testing.T) {
+	for _, c := range []gha.Command{
+		{Name: "error", Message: "x"},
+		{Name: "warning", Properties: []gha.Property{{"file", "a:b,c.go"}, {"line", "3"}}, Message: "multi\r\nline :: 100%"},
+		// %3A written literally must come back as %3A, not as a colon.
+		{Name: "notice", Properties: []gha.Property{{"title", "%3A=%2C"}}, Message: "%0A%25"},
+		{Name: "notice", Message: ""},
+	} {
+		line := c.String()
+		got, ok := gha.ParseCommand(line + "\n")
+		if !ok || !reflect.DeepEqual(got, c) {
+			t.Errorf("ParseCommand(%q) = %+v, %v; want %+v", line, got, ok, c)
+		}
+	}
+	for _, line := range []string{"", "plain output", "::", "::warning", ":: x::y", "::warning file::x"} {
+		if c, ok := gha.ParseCommand(line); ok {
+			t.Errorf("ParseCommand(%q) = %+v, want no command", line, c)
+		}
+	}
+}
+
+func TestAnnotation(t *testing.T) {
+	tests := []struct {
+		a        gha.Annotation
+		line     string
+		location string
+	}{
+		{gha.Annotation{Message: "m"}, "::warning::m", ""},
+		{gha.Annotation{Level: gha.Error, File: "a.go", Message: "m"}, "::error file=a.go::m", "a.go"},
+		{gha.Annotation{Level: gha.Error, File: "a.go", Line: 3, EndLine: 5, Title: "T", Message: "m"}, "::error file=a.go,line=3,endLine=5,title=T::m", "a.go:3"},
+		// An end before the start, or a line without a file, is dropped.
+		{gha.Annotation{Level: gha.Notice, File: "a.go", Line: 3, EndLine: 2, Message: "m"}, "::notice file=a.go,line=3::m", "a.go:3"},
+		{gha.Annotation{Level: gha.Notice, Line: 3, Message: "m"}, "::notice::m", ""},
+	}
+	for _, tt := range tests {
+		if got := tt.a.String(); got != tt.line {
+			t.Errorf("%+v: String = %q, want %q", tt.a, got, tt.line)
+		}
+		if got := tt.a.Location(); got != tt.location {
+			t.Errorf("%+v: Location = %q, want %q", tt.a, got, tt.location)
+		}
+	}
+
+	a := gha.Annotation{Level: gha.Error, File: "dir/x,y.go", Line: 7, EndLine: 9, Title: "Secret: found", Message: "line\nbreak 100%"}
+	if got, ok := gha.ParseAnnotation(a.String()); !ok || got != a {
+		t.Errorf("ParseAnnotation = %+v, %v; want %+v", got, ok, a)
+	}
+	for _, line := range []string{"::group::Build", "::set-output name=x::y", "not a command"} {
+		if got, ok := gha.ParseAnnotation(line); ok {
+			t.Errorf("ParseAnnotation(%q) = %+v, want no annotation", line, got)
+		}
+	}
+}
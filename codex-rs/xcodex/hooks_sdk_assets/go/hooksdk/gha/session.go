@@ -0,0 +1,326 @@
+package gha
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/atomicfile"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+const lockTimeout = 5 * time.Second
+
+// maxListed bounds how many annotations a session summary lists.
+const maxListed = 20
+
+// ToolStats counts one tool's calls in a session.
+type ToolStats struct {
+	Calls      int   `json:"calls"`
+	Failed     int   `json:"failed"`
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// Activity is what happened in a session, as kept in its state file.
+type Activity struct {
+	Session     string                `json:"session"`
+	Start       time.Time             `json:"start"`
+	End         time.Time             `json:"end,omitempty"`
+	Cwd         string                `json:"cwd,omitempty"`
+	Prompts     int                   `json:"prompts"`
+	Turns       int                   `json:"turns"`
+	Approvals   int                   `json:"approvals"`
+	Patches     int                   `json:"patches"`
+	PatchFailed int                   `json:"patch_failed"`
+	Tools       map[string]*ToolStats `json:"tools,omitempty"`
+	// AnnotationsOffset is the size of the annotations file when the session began; Annotations
+	// are the ones written after it.
+	AnnotationsOffset int64 `json:"annotations_offset"`
+}
+
+// Tracker accumulates each session's Activity in per-session state files in Dir.
+type Tracker struct {
+	Dir string
+	// Now is the clock for events without a timestamp; nil means time.Now.
+	Now func() time.Time
+}
+
+// NewTracker returns a Tracker storing its state in dir.
+func NewTracker(dir string) *Tracker {
+	return &Tracker{Dir: dir}
+}
+
+// Observe adds p to its session's activity. On `session-end` the state file is removed and the
+// finished Activity returned; other events return nil. Events without a session id are ignored.
+func (t *Tracker) Observe(p *hooksdk.HookPayload) (*Activity, error) {
+	session := p.SessionID()
+	if session == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	lock, err := filelock.AcquireTimeout(filepath.Join(t.Dir, "gha.lock"), lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	name, _ := jsonl.SafeName(session)
+	path := filepath.Join(t.Dir, "session-"+name+".json")
+	act, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	at := p.Time()
+	if at.IsZero() {
+		if t.Now != nil {
+			at = t.Now()
+		} else {
+			at = time.Now()
+		}
+	}
+	if act.Start.IsZero() {
+		act.Session = session
+		act.Start = at
+		if fi, err := os.Stat(AnnotationsPath()); err == nil {
+			act.AnnotationsOffset = fi.Size()
+		}
+	}
+	if act.Cwd == "" {
+		act.Cwd = p.WorkingDir()
+	}
+	act.observe(p)
+
+	if p.EventType() != "session-end" {
+		return nil, atomicfile.WriteJSON(path, act)
+	}
+	act.End = at
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return act, nil
+}
+
+func (a *Activity) observe(p *hooksdk.HookPayload) {
+	switch p.EventType() {
+	case "user-prompt-submit":
+		a.Prompts++
+	case "agent-turn-complete":
+		a.Turns++
+	case "approval-requested":
+		a.Approvals++
+	case "tool-call-finished":
+		tool, _ := hooksdk.StringField(p.RawPayload, "tool_name")
+		if tool == "" {
+			tool = "(unknown)"
+		}
+		st := a.Tools[tool]
+		if st == nil {
+			st = &ToolStats{}
+			a.Tools[tool] = st
+		}
+		st.Calls++
+		if ms, ok := hooksdk.IntField(p.RawPayload, "duration_ms"); ok {
+			st.DurationMS += ms
+		}
+		_, patch := Patch(p)
+		if patch {
+			a.Patches++
+		}
+		if Failed(p) {
+			st.Failed++
+			if patch {
+				a.PatchFailed++
+			}
+		}
+	}
+}
+
+// Failed reports whether a finished tool call failed or was aborted.
+func Failed(p *hooksdk.HookPayload) bool {
+	if status, _ := hooksdk.StringField(p.RawPayload, "status"); status == "aborted" {
+		return true
+	}
+	ok, found := hooksdk.BoolField(p.RawPayload, "success")
+	return found && !ok
+}
+
+// Patch reports whether a tool call applies a patch (an apply_patch call, or a tool input holding
+// a patch, such as an `apply_patch` shell heredoc) and lists the files the patch names.
+func Patch(p *hooksdk.HookPayload) (paths []string, ok bool) {
+	text := patchText(p.ToolInput)
+	if text != "" {
+		paths = gitsnap.PatchPaths(text)
+	}
+	tool, _ := hooksdk.StringField(p.RawPayload, "tool_name")
+	return paths, tool == "apply_patch" || len(paths) > 0
+}
+
+// patchText finds a patch in the tool input: apply_patch's `input`, or any string holding a
+// `*** Begin Patch` block.
+func patchText(input any) string {
+	switch v := input.(type) {
+	case string:
+		return v
+	case map[string]any:
+		for _, k := range []string{"input", "patch"} {
+			if s, ok := v[k].(string); ok && s != "" {
+				return s
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if s := embeddedPatch(v[k]); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func embeddedPatch(v any) string {
+	switch t := v.(type) {
+	case string:
+		if strings.Contains(t, "*** Begin Patch") {
+			return t
+		}
+	case []any:
+		for _, item := range t {
+			if s := embeddedPatch(item); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Annotations reads the annotations written to AnnotationsPath during the session.
+func (a *Activity) Annotations() ([]Annotation, error) {
+	f, err := os.Open(AnnotationsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(a.AnnotationsOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var out []Annotation
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		if ann, ok := ParseAnnotation(sc.Text()); ok {
+			out = append(out, ann)
+		}
+	}
+	return out, sc.Err()
+}
+
+// Summary renders the session as step summary markdown: an overview, calls per tool, and the
+// given annotations.
+func (a *Activity) Summary(annotations []Annotation) string {
+	var calls, failed int
+	tools := make([]string, 0, len(a.Tools))
+	for name, st := range a.Tools {
+		tools = append(tools, name)
+		calls += st.Calls
+		failed += st.Failed
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		x, y := a.Tools[tools[i]], a.Tools[tools[j]]
+		if x.Calls != y.Calls {
+			return x.Calls > y.Calls
+		}
+		return tools[i] < tools[j]
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "### xcodex session %s\n\n", EscapeCell(a.Session))
+	var overview [][]string
+	if a.Cwd != "" {
+		overview = append(overview, []string{"Directory", a.Cwd})
+	}
+	if !a.End.IsZero() {
+		overview = append(overview, []string{"Duration", summarize.Duration(a.End.Sub(a.Start).Round(time.Second))})
+	}
+	overview = append(overview,
+		[]string{"Prompts", fmt.Sprint(a.Prompts)},
+		[]string{"Turns", fmt.Sprint(a.Turns)},
+		[]string{"Tool calls", withFailed(calls, failed)},
+		[]string{"Patches", withFailed(a.Patches, a.PatchFailed)},
+		[]string{"Approvals requested", fmt.Sprint(a.Approvals)},
+		[]string{"Annotations", fmt.Sprint(len(annotations))},
+	)
+	b.WriteString(Table([]string{"Activity", ""}, overview))
+
+	if len(tools) > 0 {
+		rows := make([][]string, len(tools))
+		for i, name := range tools {
+			st := a.Tools[name]
+			d := time.Duration(st.DurationMS) * time.Millisecond
+			rows[i] = []string{name, fmt.Sprint(st.Calls), fmt.Sprint(st.Failed), summarize.Duration(d)}
+		}
+		b.WriteString("\n")
+		b.WriteString(Table([]string{"Tool", "Calls", "Failed", "Time"}, rows))
+	}
+
+	if len(annotations) > 0 {
+		var rows [][]string
+		for i, ann := range annotations {
+			if i == maxListed {
+				rows = append(rows, []string{"", "", fmt.Sprintf("... and %d more", len(annotations)-maxListed)})
+				break
+			}
+			msg := ann.Message
+			if ann.Title != "" {
+				msg = ann.Title + ": " + msg
+			}
+			rows = append(rows, []string{string(ann.Level), ann.Location(), msg})
+		}
+		b.WriteString("\n")
+		b.WriteString(Table([]string{"Level", "Location", "Message"}, rows))
+	}
+	return b.String()
+}
+
+func withFailed(n, failed int) string {
+	if failed == 0 {
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%d (%d failed)", n, failed)
+}
+
+// load reads a session's activity; a missing or corrupt file starts afresh.
+func load(path string) (*Activity, error) {
+	var act Activity
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 && json.Unmarshal(data, &act) != nil {
+		act = Activity{}
+	}
+	if act.Tools == nil {
+		act.Tools = map[string]*ToolStats{}
+	}
+	return &act, nil
+}
@@ -0,0 +1,153 @@
+package gha_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+const patch = "*** Begin Patch\n*** Update File: src/a.go\n@@\n-x\n+y\n*** Add File: b.go\n+z\n*** End Patch\n"
+
+func TestPatchAndFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		event  *hooktest.Builder
+		paths  []string
+		patch  bool
+		failed bool
+	}{
+		{"shell", hooktest.ToolCallFinished().WithCommand("ls"), nil, false, false},
+		{"failed shell", hooktest.ToolCallFinished().WithCommand("ls").With("success", false), nil, false, true},
+		{"aborted", hooktest.ToolCallFinished().With("status", "aborted").With("success", nil), nil, false, true},
+		{"apply_patch", hooktest.ToolCallFinished().WithToolName("apply_patch").With("tool_input", map[string]any{"input": patch}), []string{"src/a.go", "b.go"}, true, false},
+		{"apply_patch string input", hooktest.ToolCallFinished().WithToolName("apply_patch").With("tool_input", patch).With("success", false), []string{"src/a.go", "b.go"}, true, true},
+		{"heredoc", hooktest.ToolCallFinished().With("tool_input", map[string]any{"command": []any{"apply_patch", patch}}), []string{"src/a.go", "b.go"}, true, false},
+		{"apply_patch without input", hooktest.ToolCallFinished().WithToolName("apply_patch").With("tool_input", map[string]any{}), nil, true, false},
+	}
+	for _, tt := range tests {
+		p := tt.event.Build()
+		paths, ok := gha.Patch(p)
+		if ok != tt.patch || !reflect.DeepEqual(paths, tt.paths) {
+			t.Errorf("%s: Patch = %q, %v; want %q, %v", tt.name, paths, ok, tt.paths, tt.patch)
+		}
+		if got := gha.Failed(p); got != tt.failed {
+			t.Errorf("%s: Failed = %v, want %v", tt.name, got, tt.failed)
+		}
+	}
+}
+
+func TestTrackerSession(t *testing.T) {
+	dir := t.TempDir()
+	annotations := filepath.Join(dir, "annotations.txt")
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATIONS", annotations)
+	// An annotation from before the session isn't the session's.
+	if err := gha.Emit(gha.Annotation{Message: "earlier job step"}); err != nil {
+		t.Fatal(err)
+	}
+
+	start, _ := time.Parse(time.RFC3339, "2025-01-01T00:00:00Z")
+	at := func(b *hooktest.Builder, d time.Duration) *hooktest.Builder {
+		return b.WithSessionID("s1").WithCwd("/work/repo").With("timestamp", start.Add(d).Format(time.RFC3339))
+	}
+	tracker := gha.NewTracker(filepath.Join(dir, "state"))
+	events := []*hooktest.Builder{
+		at(hooktest.SessionStart(), 0),
+		at(hooktest.UserPromptSubmit(), time.Second),
+		at(hooktest.ToolCallFinished().WithToolName("shell").With("duration_ms", 1500), 2*time.Second),
+		at(hooktest.ToolCallFinished().WithToolName("shell").With("duration_ms", 500).With("success", false), 3*time.Second),
+		at(hooktest.ApprovalRequested(), 4*time.Second),
+		at(hooktest.ToolCallFinished().WithToolName("apply_patch").With("tool_input", map[string]any{"input": patch}).With("success", false), 5*time.Second),
+		at(hooktest.AgentTurnComplete(), 6*time.Second),
+		// Another session, tracked apart.
+		hooktest.UserPromptSubmit().WithSessionID("s2"),
+		// No session: ignored.
+		hooktest.Notification().With("session_id", nil),
+	}
+	for i, b := range events {
+		act, err := tracker.Observe(b.Build())
+		if err != nil || act != nil {
+			t.Fatalf("event %d: Observe = %+v, %v; want nothing until the session ends", i, act, err)
+		}
+	}
+	if err := gha.Emit(gha.Annotation{Level: gha.Error, File: "src/a.go", Title: "Patch failed", Message: "no match | context"}); err != nil {
+		t.Fatal(err)
+	}
+
+	act, err := tracker.Observe(at(hooktest.SessionEnd(), 90*time.Second).Build())
+	if err != nil || act == nil {
+		t.Fatalf("session-end: Observe = %v, %v; want the session's activity", act, err)
+	}
+	if act.Prompts != 1 || act.Turns != 1 || act.Approvals != 1 || act.Patches != 1 || act.PatchFailed != 1 {
+		t.Errorf("activity = %+v", act)
+	}
+	if shell := act.Tools["shell"]; shell == nil || *shell != (gha.ToolStats{Calls: 2, Failed: 1, DurationMS: 2000}) {
+		t.Errorf("shell stats = %+v", shell)
+	}
+	if act.Cwd != "/work/repo" || act.End.Sub(act.Start) != 90*time.Second {
+		t.Errorf("cwd %q, %v to %v", act.Cwd, act.Start, act.End)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "state", "session-s1.json")); !os.IsNotExist(err) {
+		t.Errorf("state of the ended session left behind: %v", err)
+	}
+
+	anns, err := act.Annotations()
+	if err != nil || len(anns) != 1 || anns[0].File != "src/a.go" {
+		t.Fatalf("Annotations = %+v, %v; want the patch failure only", anns, err)
+	}
+	summary := act.Summary(anns)
+	for _, want := range []string{
+		"### xcodex session s1\n",
+		"| Directory | /work/repo |",
+		"| Duration | 1m30s |",
+		"| Tool calls | 3 (2 failed) |",
+		"| Patches | 1 (1 failed) |",
+		"| shell | 2 | 1 | 2s |",
+		`| error | src/a.go | Patch failed: no match \| context |`,
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary lacks %q:\n%s", want, summary)
+		}
+	}
+
+	// The other session is still open, with its own counts.
+	act, err = tracker.Observe(hooktest.SessionEnd().WithSessionID("s2").Build())
+	if err != nil || act == nil || act.Prompts != 1 || len(act.Tools) != 0 {
+		t.Errorf("session s2 = %+v, %v", act, err)
+	}
+}
+
+func TestTrackerCorruptState(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CODEX_HOOK_GHA_ANNOTATIONS", filepath.Join(dir, "annotations.txt"))
+	if err := os.WriteFile(filepath.Join(dir, "session-s1.json"), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tracker := gha.NewTracker(dir)
+	if _, err := tracker.Observe(hooktest.UserPromptSubmit().WithSessionID("s1").Build()); err != nil {
+		t.Fatalf("Observe with a corrupt state: %v", err)
+	}
+	act, err := tracker.Observe(hooktest.SessionEnd().WithSessionID("s1").Build())
+	if err != nil || act == nil || act.Prompts != 1 {
+		t.Errorf("after a corrupt state, activity = %+v, %v; want a fresh start", act, err)
+	}
+}
+
+func TestSummaryListsAtMost20Annotations(t *testing.T) {
+	anns := make([]gha.Annotation, 25)
+	for i := range anns {
+		anns[i] = gha.Annotation{Level: gha.Warning, Message: "m"}
+	}
+	summary := (&gha.Activity{Session: "s|1"}).Summary(anns)
+	if n := strings.Count(summary, "| warning |"); n != 20 {
+		t.Errorf("%d annotations listed, want 20", n)
+	}
+	if !strings.Contains(summary, "... and 5 more") || !strings.Contains(summary, `session s\|1`) {
+		t.Errorf("summary:\n%s", summary)
+	}
+}
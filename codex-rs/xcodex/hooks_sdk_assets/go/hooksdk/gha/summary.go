@@ -0,0 +1,69 @@
+package gha
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrNoSummary is returned by AppendSummary outside a job step (GITHUB_STEP_SUMMARY is unset).
+var ErrNoSummary = errors.New("gha: GITHUB_STEP_SUMMARY is not set")
+
+// AppendSummary appends markdown to the job's step summary, shown on the workflow run page.
+func AppendSummary(markdown string) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return ErrNoSummary
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(markdown, "\n") {
+		markdown += "\n"
+	}
+	_, err = f.WriteString(markdown)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+var cellEscaper = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;",
+	"\\", "\\\\", "|", "\\|",
+	"\r\n", "<br>", "\n", "<br>", "\r", "<br>",
+)
+
+// EscapeCell makes s safe as the text of a markdown table cell: pipes can't end the cell, line
+// breaks become <br>, and HTML in agent or tool output is shown rather than rendered.
+func EscapeCell(s string) string {
+	return cellEscaper.Replace(s)
+}
+
+// Table renders a markdown table. Cells are escaped with EscapeCell; rows shorter than the header
+// are padded with empty cells.
+func Table(header []string, rows [][]string) string {
+	var b strings.Builder
+	row := func(cells []string) {
+		b.WriteByte('|')
+		for i := range header {
+			b.WriteByte(' ')
+			if i < len(cells) {
+				b.WriteString(EscapeCell(cells[i]))
+			}
+			b.WriteString(" |")
+		}
+		b.WriteByte('\n')
+	}
+	row(header)
+	b.WriteByte('|')
+	for range header {
+		b.WriteString(" --- |")
+	}
+	b.WriteByte('\n')
+	for _, r := range rows {
+		row(r)
+	}
+	return b.String()
+}
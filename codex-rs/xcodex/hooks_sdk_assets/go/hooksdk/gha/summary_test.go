@@ -0,0 +1,57 @@
+package gha_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/gha"
+)
+
+func TestEscapeCell(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":            "plain",
+		"a | b":            `a \| b`,
+		`back\slash`:       `back\\slash`,
+		`\|`:               `\\\|`,
+		"one\ntwo\r\nsix":  "one<br>two<br>six",
+		"<script>&amp;":    "&lt;script&gt;&amp;amp;",
+		"**bold** `code`":  "**bold** `code`",
+		"carriage\rreturn": "carriage<br>return",
+	} {
+		if got := gha.EscapeCell(in); got != want {
+			t.Errorf("EscapeCell(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	got := gha.Table([]string{"Tool", "Calls"}, [][]string{{"shell", "3"}, {"a|b"}, {"x", "1", "extra"}})
+	const want = "| Tool | Calls |\n" +
+		"| --- | --- |\n" +
+		"| shell | 3 |\n" +
+		`| a\|b |  |` + "\n" +
+		"| x | 1 |\n"
+	if got != want {
+		t.Errorf("Table =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAppendSummary(t *testing.T) {
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	if err := gha.AppendSummary("x"); !errors.Is(err, gha.ErrNoSummary) {
+		t.Errorf("AppendSummary without GITHUB_STEP_SUMMARY = %v, want ErrNoSummary", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv("GITHUB_STEP_SUMMARY", path)
+	for _, md := range []string{"### one", "two\n"} {
+		if err := gha.AppendSummary(md); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "### one\ntwo\n" {
+		t.Errorf("summary = %q", data)
+	}
+}
@@ -0,0 +1,357 @@
+// Package gitsnap records checkpoints of a git working tree as commits on a dedicated ref, without
+// touching the user's HEAD, branches, index, or working tree.
+//
+// Snapshots are built in a temporary index file (GIT_INDEX_FILE) and committed with the previous
+// snapshot as parent. A snapshot of some paths is the previous snapshot plus those files' current
+// content, so each commit's diff shows just what changed in them; a snapshot of everything is the
+// whole working tree. Ignored files are never recorded. To roll a file back:
+//
+//	git log --stat refs/xcodex/snapshots
+//	git restore --source=<commit> -- <path>
+package gitsnap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+)
+
+// DefaultRef is where snapshots are recorded when Options.Ref is empty.
+const DefaultRef = "refs/xcodex/snapshots"
+
+const lockTimeout = 10 * time.Second
+
+// Fallback identity for repositories without user.name/user.email, so commit-tree can't fail.
+const (
+	fallbackName  = "xcodex snapshot"
+	fallbackEmail = "xcodex-snapshot@localhost"
+)
+
+// Options configure a snapshot.
+type Options struct {
+	// Dir is any directory in the working tree.
+	Dir string
+	// Ref receives the snapshot commits, e.g. refs/heads/xcodex-snapshots for a shadow branch;
+	// empty means DefaultRef.
+	Ref string
+	// Paths are the files to record, absolute or relative to Dir; paths outside the working tree
+	// are skipped. The snapshot is the previous one (or, for the first, the user's index) with
+	// these files updated. Nil records the whole working tree: the user's index plus every change.
+	Paths []string
+	// Message is the commit message; the list of changed files is appended to it.
+	Message string
+	// Git is the git executable; empty means "git" from PATH.
+	Git string
+}
+
+// Change is a file recorded by a snapshot, relative to the previous snapshot (or HEAD for the
+// first one).
+type Change struct {
+	// Status is A (added), M (modified), D (deleted), or T (type changed).
+	Status string
+	// Path is relative to the top of the working tree, with forward slashes.
+	Path string
+}
+
+// Result describes a recorded snapshot.
+type Result struct {
+	Commit string
+	// Parent is the previous snapshot, empty for the first one.
+	Parent  string
+	Changes []Change
+}
+
+// Take records a snapshot. It returns a nil Result, and no error, when there is nothing to do: Dir
+// isn't in a git working tree, none of Paths is in it, or the files match the previous snapshot
+// (or HEAD, before the first snapshot).
+func Take(ctx context.Context, opts Options) (*Result, error) {
+	g := &git{bin: opts.Git, dir: opts.Dir}
+	if g.bin == "" {
+		g.bin = "git"
+	}
+	ref := opts.Ref
+	if ref == "" {
+		ref = DefaultRef
+	}
+	if !strings.HasPrefix(ref, "refs/") {
+		return nil, fmt.Errorf("gitsnap: ref %q must start with refs/", ref)
+	}
+
+	top, err := g.run(ctx, nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return nil, nil // not a repository, or a bare one
+		}
+		return nil, err
+	}
+	g.dir = top
+	gitDir, err := g.run(ctx, nil, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return nil, err
+	}
+
+	var pathspecs []string
+	if opts.Paths != nil {
+		pathspecs = relativePaths(top, opts.Dir, opts.Paths)
+		if len(pathspecs) == 0 {
+			return nil, nil
+		}
+	}
+
+	// Parallel hooks of one repository take turns: each snapshot builds on the last.
+	lock, err := filelock.AcquireTimeout(filepath.Join(gitDir, "xcodex-snapshot.lock"), lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	parent := g.verify(ctx, ref+"^{commit}")
+	head := g.verify(ctx, "HEAD^{commit}")
+
+	index := filepath.Join(gitDir, "xcodex-snapshot.index")
+	defer os.Remove(index)
+	seed := ""
+	if pathspecs != nil {
+		seed = parent
+	}
+	if err := seedIndex(ctx, g, index, filepath.Join(gitDir, "index"), seed, head); err != nil {
+		return nil, err
+	}
+	env := []string{"GIT_INDEX_FILE=" + index}
+
+	args := []string{"ls-files", "-z", "--modified", "--deleted", "--others", "--exclude-standard"}
+	if pathspecs != nil {
+		args = append(append(args, "--"), pathspecs...)
+	}
+	changed, err := g.run(ctx, env, args...)
+	if err != nil {
+		return nil, err
+	}
+	if changed != "" {
+		// update-index --remove drops deleted files; ls-files already left out ignored ones.
+		if _, err := g.input(ctx, env, dedupNUL(changed), "update-index", "-z", "--add", "--remove", "--stdin"); err != nil {
+			return nil, err
+		}
+	}
+	tree, err := g.run(ctx, env, "write-tree")
+	if err != nil {
+		return nil, err
+	}
+
+	base := parent
+	if base == "" {
+		base = head
+	}
+	changes, err := g.diff(ctx, base, tree)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	msg := strings.TrimRight(opts.Message, "\n")
+	if msg == "" {
+		msg = "xcodex snapshot"
+	}
+	msg += "\n\nFiles:\n"
+	for _, c := range changes {
+		msg += "  " + c.Status + " " + c.Path + "\n"
+	}
+	commitArgs := []string{"commit-tree", "--no-gpg-sign", tree, "-F", "-"}
+	if parent != "" {
+		commitArgs = append(commitArgs, "-p", parent)
+	}
+	commit, err := g.input(ctx, g.identityEnv(ctx), msg, commitArgs...)
+	if err != nil {
+		return nil, err
+	}
+	// The expected old value makes the update fail rather than drop a snapshot written behind our
+	// back; an empty one means the ref must not exist yet.
+	if _, err := g.run(ctx, nil, "update-ref", "-m", "xcodex snapshot", ref, commit, parent); err != nil {
+		return nil, err
+	}
+	return &Result{Commit: commit, Parent: parent, Changes: changes}, nil
+}
+
+// seedIndex starts the temporary index from the seed commit if there is one, else as a copy of the
+// user's index (keeping its stat data, so only changed files are rehashed), else from HEAD.
+func seedIndex(ctx context.Context, g *git, index, userIndex, seed, head string) error {
+	os.Remove(index)
+	env := []string{"GIT_INDEX_FILE=" + index}
+	if seed != "" {
+		_, err := g.run(ctx, env, "read-tree", seed)
+		return err
+	}
+	src, err := os.Open(userIndex)
+	if err == nil {
+		defer src.Close()
+		dst, err := os.OpenFile(index, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if head == "" {
+		_, err = g.run(ctx, env, "read-tree", "--empty")
+	} else {
+		_, err = g.run(ctx, env, "read-tree", head)
+	}
+	return err
+}
+
+// relativePaths turns paths into literal pathspecs relative to top, dropping those outside it.
+func relativePaths(top, dir string, paths []string) []string {
+	realTop := resolve(top)
+	var out []string
+	seen := map[string]bool{}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		// Only the directories are resolved: a tracked symlink is recorded as the link itself.
+		rel, err := filepath.Rel(realTop, filepath.Join(resolve(filepath.Dir(p)), filepath.Base(p)))
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if !seen[rel] {
+			seen[rel] = true
+			out = append(out, ":(top,literal)"+rel)
+		}
+	}
+	return out
+}
+
+// resolve makes p absolute with symlinks evaluated, like git's --show-toplevel. p may not exist
+// (the directory of a deleted file), so the longest existing prefix is resolved.
+func resolve(p string) string {
+	p, _ = filepath.Abs(p)
+	rest := ""
+	for {
+		if real, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return filepath.Join(p, rest)
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+// dedupNUL removes repeated entries from NUL-terminated ls-files output (a deleted file is listed
+// as both modified and deleted).
+func dedupNUL(s string) string {
+	seen := map[string]bool{}
+	var b strings.Builder
+	for _, p := range strings.Split(s, "\x00") {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			b.WriteString(p)
+			b.WriteByte(0)
+		}
+	}
+	return b.String()
+}
+
+type git struct {
+	bin, dir string
+}
+
+// run runs git in g.dir with extra environment and returns its output without the trailing
+// newline. A GIT_INDEX_FILE inherited from the caller is dropped, so only env can set one.
+func (g *git) run(ctx context.Context, env []string, args ...string) (string, error) {
+	return g.input(ctx, env, "", args...)
+}
+
+func (g *git) input(ctx context.Context, env []string, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, g.bin, args...)
+	cmd.Dir = g.dir
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "GIT_INDEX_FILE=") {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	cmd.Env = append(cmd.Env, env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSuffix(stdout.String(), "\n"), nil
+}
+
+// verify resolves rev to an object id, or "" if it doesn't exist.
+func (g *git) verify(ctx context.Context, rev string) string {
+	oid, err := g.run(ctx, nil, "rev-parse", "-q", "--verify", rev)
+	if err != nil {
+		return ""
+	}
+	return oid
+}
+
+// diff lists the files that differ between base (a commit, or "" for none) and tree.
+func (g *git) diff(ctx context.Context, base, tree string) ([]Change, error) {
+	if base == "" {
+		out, err := g.run(ctx, nil, "ls-tree", "-r", "-z", "--name-only", tree)
+		if err != nil {
+			return nil, err
+		}
+		var changes []Change
+		for _, p := range strings.Split(out, "\x00") {
+			if p != "" {
+				changes = append(changes, Change{Status: "A", Path: p})
+			}
+		}
+		return changes, nil
+	}
+	out, err := g.run(ctx, nil, "diff-tree", "-r", "-z", "--no-renames", "--name-status", base, tree)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	var changes []Change
+	for i := 0; i+1 < len(fields); i += 2 {
+		changes = append(changes, Change{Status: fields[i], Path: fields[i+1]})
+	}
+	return changes, nil
+}
+
+// identityEnv supplies a committer and author for repositories (and users) that configure none.
+func (g *git) identityEnv(ctx context.Context) []string {
+	if _, err := g.run(ctx, nil, "var", "GIT_COMMITTER_IDENT"); err == nil {
+		if _, err := g.run(ctx, nil, "var", "GIT_AUTHOR_IDENT"); err == nil {
+			return nil
+		}
+	}
+	return []string{
+		"GIT_AUTHOR_NAME=" + fallbackName, "GIT_AUTHOR_EMAIL=" + fallbackEmail,
+		"GIT_COMMITTER_NAME=" + fallbackName, "GIT_COMMITTER_EMAIL=" + fallbackEmail,
+	}
+}
@@ -0,0 +1,214 @@
+package gitsnap_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+)
+
+// repo is a throwaway git repository.
+type repo struct {
+	t   *testing.T
+	dir string
+}
+
+// newRepo creates a repository isolated from the user's git config, with an initial commit of
+// tracked.txt unless empty is set.
+func newRepo(t *testing.T, empty bool) *repo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	r := &repo{t: t, dir: t.TempDir()}
+	r.git("init", "-q")
+	r.git("config", "user.name", "Test")
+	r.git("config", "user.email", "test@example.com")
+	r.write(".gitignore", "*.log\n")
+	if !empty {
+		r.write("tracked.txt", "one\n")
+		r.git("add", ".")
+		r.git("commit", "-q", "-m", "initial")
+	}
+	return r
+}
+
+func (r *repo) git(args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (r *repo) write(name, content string) {
+	r.t.Helper()
+	path := filepath.Join(r.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// userState is what a snapshot must leave alone: HEAD, the index file, and the status.
+func (r *repo) userState() string {
+	r.t.Helper()
+	index, _ := os.ReadFile(filepath.Join(r.dir, ".git", "index"))
+	head := ""
+	cmd := exec.Command("git", "rev-parse", "-q", "--verify", "HEAD")
+	cmd.Dir = r.dir
+	if out, err := cmd.Output(); err == nil {
+		head = string(out)
+	}
+	return fmt.Sprintf("HEAD %s\nindex %x\n%s", head, index, r.git("status", "--porcelain", "--untracked-files=all"))
+}
+
+func (r *repo) take(paths []string) *gitsnap.Result {
+	r.t.Helper()
+	res, err := gitsnap.Take(context.Background(), gitsnap.Options{Dir: r.dir, Paths: paths, Message: "checkpoint\n"})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return res
+}
+
+func changes(res *gitsnap.Result) string {
+	var out []string
+	for _, c := range res.Changes {
+		out = append(out, c.Status+" "+c.Path)
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestTakePaths(t *testing.T) {
+	r := newRepo(t, false)
+	r.write("tracked.txt", "one\ntwo\n")
+	r.write("staged.txt", "staged\n")
+	r.git("add", "staged.txt")
+	r.write("sub/new.txt", "new\n")
+	r.write("debug.log", "ignored\n")
+	before := r.userState()
+
+	res := r.take([]string{"tracked.txt", "sub/new.txt", "debug.log", "../outside.txt"})
+	if res == nil {
+		t.Fatal("no snapshot")
+	}
+	// The first snapshot starts from the user's index, hence staged.txt.
+	if got := changes(res); got != "A staged.txt, A sub/new.txt, M tracked.txt" {
+		t.Errorf("changes = %s", got)
+	}
+	if res.Parent != "" || r.git("rev-parse", gitsnap.DefaultRef) != res.Commit {
+		t.Errorf("ref = %s, parent %q; want %s without a parent", r.git("rev-parse", gitsnap.DefaultRef), res.Parent, res.Commit)
+	}
+	if after := r.userState(); after != before {
+		t.Errorf("user state changed:\n%s\nwant\n%s", after, before)
+	}
+	if got := r.git("show", res.Commit+":tracked.txt"); got != "one\ntwo" {
+		t.Errorf("snapshot of tracked.txt = %q", got)
+	}
+	msg := r.git("log", "-1", "--format=%B", res.Commit)
+	if !strings.HasPrefix(msg, "checkpoint\n\nFiles:\n  A staged.txt\n") {
+		t.Errorf("message = %q", msg)
+	}
+
+	// Nothing changed since: no snapshot.
+	if res := r.take([]string{"tracked.txt"}); res != nil {
+		t.Errorf("snapshot of unchanged files: %+v", res)
+	}
+
+	// The next snapshot builds on the last and records only its own paths.
+	r.write("tracked.txt", "three\n")
+	r.write("other.txt", "not asked for\n")
+	os.Remove(filepath.Join(r.dir, "sub", "new.txt"))
+	next := r.take([]string{filepath.Join(r.dir, "tracked.txt"), "sub/new.txt"})
+	if next == nil || next.Parent != res.Commit || changes(next) != "D sub/new.txt, M tracked.txt" {
+		t.Errorf("second snapshot = %+v", next)
+	}
+}
+
+func TestTakeAll(t *testing.T) {
+	r := newRepo(t, false)
+	r.write("tracked.txt", "changed\n")
+	r.write("untracked.txt", "x\n")
+	r.write("build.log", "ignored\n")
+	before := r.userState()
+
+	res := r.take(nil)
+	if res == nil || changes(res) != "M tracked.txt, A untracked.txt" {
+		t.Fatalf("snapshot = %+v", res)
+	}
+	if after := r.userState(); after != before {
+		t.Errorf("user state changed:\n%s\nwant\n%s", after, before)
+	}
+}
+
+func TestTakeNoop(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	// Not a repository.
+	res, err := gitsnap.Take(context.Background(), gitsnap.Options{Dir: t.TempDir()})
+	if res != nil || err != nil {
+		t.Errorf("Take outside a repository = %+v, %v; want nothing", res, err)
+	}
+
+	// A clean repository.
+	r := newRepo(t, false)
+	if res := r.take(nil); res != nil {
+		t.Errorf("snapshot of a clean tree: %+v", res)
+	}
+	if res := r.take([]string{"/elsewhere/file.txt"}); res != nil {
+		t.Errorf("snapshot of paths outside the tree: %+v", res)
+	}
+
+	_, err = gitsnap.Take(context.Background(), gitsnap.Options{Dir: r.dir, Ref: "snapshots"})
+	if err == nil {
+		t.Errorf("Take accepted a ref outside refs/")
+	}
+}
+
+func TestTakeUnbornHead(t *testing.T) {
+	r := newRepo(t, true)
+	r.git("config", "--unset", "user.name")
+	r.git("config", "--unset", "user.email")
+	t.Setenv("EMAIL", "")
+	r.write("a.txt", "a\n")
+
+	res, err := gitsnap.Take(context.Background(), gitsnap.Options{Dir: r.dir, Ref: "refs/heads/shadow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res == nil || changes(res) != "A .gitignore, A a.txt" {
+		t.Fatalf("snapshot = %+v", res)
+	}
+	// A shadow branch; HEAD is still unborn.
+	if r.git("rev-parse", "refs/heads/shadow") != res.Commit {
+		t.Errorf("shadow branch isn't the snapshot")
+	}
+	cmd := exec.Command("git", "rev-parse", "-q", "--verify", "HEAD")
+	cmd.Dir = r.dir
+	if out, err := cmd.Output(); err == nil || len(bytes.TrimSpace(out)) != 0 {
+		t.Errorf("HEAD = %s, want unborn", out)
+	}
+	// Git makes up an identity from the host where it can; where it can't, the fallback is used.
+	ident := exec.Command("git", "var", "GIT_AUTHOR_IDENT")
+	ident.Dir = r.dir
+	if ident.Run() != nil {
+		if author := r.git("log", "-1", "--format=%an <%ae>", "shadow"); author != "xcodex snapshot <xcodex-snapshot@localhost>" {
+			t.Errorf("author = %s, want the fallback identity", author)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package gitsnap
+
+import (
+	"sort"
+	"strings"
+)
+
+// PatchPaths lists the files a patch touches, in order of appearance: both the apply_patch format
+// (`*** Add File:`, `*** Update File:`, `*** Delete File:`, and `*** Move to:` destinations) and
+// unified diffs (`--- a/...` / `+++ b/...` header pairs, ignoring /dev/null).
+func PatchPaths(patch string) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(p string) {
+		p = strings.TrimSpace(p)
+		if p != "" && p != "/dev/null" && !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	lines := strings.Split(patch, "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		for _, prefix := range []string{"*** Add File:", "*** Update File:", "*** Delete File:", "*** Move to:"} {
+			if p, ok := strings.CutPrefix(line, prefix); ok {
+				add(p)
+			}
+		}
+		// A header is a `---` line directly followed by `+++`; a lone `---` is a removed line.
+		old, ok := strings.CutPrefix(line, "--- ")
+		if !ok || i+1 == len(lines) {
+			continue
+		}
+		next, ok := strings.CutPrefix(strings.TrimSuffix(lines[i+1], "\r"), "+++ ")
+		if !ok {
+			continue
+		}
+		add(diffPath(old, "a/"))
+		add(diffPath(next, "b/"))
+	}
+	return out
+}
+
+// diffPath strips a unified diff header's trailing timestamp and its a/ or b/ prefix.
+func diffPath(p, prefix string) string {
+	p, _, _ = strings.Cut(p, "\t")
+	return strings.TrimPrefix(p, prefix)
+}
+
+// TouchedPaths finds the files a tool call wrote: the files of a patch (apply_patch's `input`, or
+// any string holding a `*** Begin Patch` block, such as an `apply_patch` shell heredoc), or the
+// `path`/`file_path` of a whole-file write or edit.
+func TouchedPaths(input any) []string {
+	switch v := input.(type) {
+	case string:
+		return PatchPaths(v)
+	case map[string]any:
+		for _, k := range []string{"input", "patch"} {
+			if s, ok := v[k].(string); ok && s != "" {
+				return PatchPaths(s)
+			}
+		}
+		for _, k := range []string{"file_path", "path"} {
+			if s, ok := v[k].(string); ok && s != "" {
+				return []string{s}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var out []string
+		for _, k := range keys {
+			out = append(out, embeddedPatchPaths(v[k])...)
+		}
+		return out
+	}
+	return nil
+}
+
+func embeddedPatchPaths(v any) []string {
+	switch t := v.(type) {
+	case string:
+		if strings.Contains(t, "*** Begin Patch") {
+			return PatchPaths(t)
+		}
+	case []any:
+		var out []string
+		for _, item := range t {
+			out = append(out, embeddedPatchPaths(item)...)
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package gitsnap_test
+
+import (
+	"fmt"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+)
+
+func TestPatchPaths(t *testing.T) {
+	tests := []struct {
+		patch string
+		want  []string
+	}{
+		{"*** Begin Patch\n*** Add File: a.txt\n+x\n*** Update File: b.go\n*** Move to: c.go\n@@\n-y\n+z\n*** Delete File: d.md\n*** End Patch", []string{"a.txt", "b.go", "c.go", "d.md"}},
+		{"--- a/x.go\t2024-01-01\n+++ b/x.go\n@@ -1 +1 @@\n-a\n+b\n--- /dev/null\n+++ b/new.go\n", []string{"x.go", "new.go"}},
+		// A removed line starting with "--" isn't a header.
+		{"--- a/x.go\n+++ b/x.go\n@@ -1,2 +1 @@\n--- comment\n context\n", []string{"x.go"}},
+		{"just text", nil},
+	}
+	for _, tt := range tests {
+		if got := gitsnap.PatchPaths(tt.patch); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("PatchPaths(%q) = %q, want %q", tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestTouchedPaths(t *testing.T) {
+	patch := "*** Begin Patch\n*** Add File: a.txt\n+x\n*** End Patch"
+	tests := []struct {
+		input any
+		want  []string
+	}{
+		{map[string]any{"input": patch}, []string{"a.txt"}},
+		{patch, []string{"a.txt"}},
+		{map[string]any{"file_path": "/w/b.txt", "content": "x"}, []string{"/w/b.txt"}},
+		{map[string]any{"command": []any{"apply_patch", patch}}, []string{"a.txt"}},
+		{map[string]any{"command": "ls"}, nil},
+	}
+	for _, tt := range tests {
+		if got := gitsnap.TouchedPaths(tt.input); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("TouchedPaths(%v) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package guard
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// Builtin is a rule implemented in code, for patterns a glob can't express reliably.
+type Builtin struct {
+	Name string
+	// Code is the reason code of the rule's verdicts, e.g. "GUARD_RM_ROOT".
+	Code     string
+	Severity hooksdk.Severity
+	// Match judges command i of pipeline p, returning "" when the rule doesn't apply.
+	Match func(e *Engine, p Pipeline, i int) (Action, string)
+}
+
+// Builtins are the rules every Engine starts with; Config.DisableBuiltin turns them off by name.
+var Builtins = []Builtin{
+	{Name: "rm-root", Code: "GUARD_RM_ROOT", Severity: hooksdk.SeverityCritical, Match: rmRoot},
+	{Name: "mkfs", Code: "GUARD_MKFS", Severity: hooksdk.SeverityCritical, Match: mkfs},
+	{Name: "block-device-write", Code: "GUARD_BLOCK_DEVICE_WRITE", Severity: hooksdk.SeverityCritical, Match: blockDeviceWrite},
+	{Name: "git-force-push", Code: "GUARD_GIT_FORCE_PUSH", Severity: hooksdk.SeverityHigh, Match: gitForcePush},
+	{Name: "curl-pipe-shell", Code: "GUARD_CURL_PIPE_SHELL", Severity: hooksdk.SeverityHigh, Match: curlPipeShell},
+}
+
+// systemDirs are top-level directories whose recursive removal breaks the machine.
+var systemDirs = map[string]bool{
+	"/bin": true, "/boot": true, "/dev": true, "/etc": true, "/home": true, "/lib": true,
+	"/lib64": true, "/opt": true, "/proc": true, "/root": true, "/sbin": true, "/srv": true,
+	"/sys": true, "/usr": true, "/var": true,
+	"/Applications": true, "/Library": true, "/System": true, "/Users": true,
+}
+
+// argv0 is the command name, or "" for a bare redirection such as `> file`.
+func argv0(c Command) string {
+	if len(c.Args) == 0 {
+		return ""
+	}
+	return c.Args[0]
+}
+
+func rmRoot(_ *Engine, p Pipeline, i int) (Action, string) {
+	args := p[i].Args
+	if argv0(p[i]) != "rm" {
+		return "", ""
+	}
+	recursive, flags := false, true
+	var targets []string
+	for _, a := range args[1:] {
+		switch {
+		case flags && a == "--":
+			flags = false
+		case flags && a == "--no-preserve-root":
+			return Deny, "rm --no-preserve-root"
+		case flags && a == "--recursive":
+			recursive = true
+		case flags && strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--"):
+			if strings.ContainsAny(a, "rR") {
+				recursive = true
+			}
+		default:
+			targets = append(targets, a)
+		}
+	}
+	if !recursive {
+		return "", ""
+	}
+	for _, t := range targets {
+		if what := dangerousTarget(t); what != "" {
+			return Deny, "recursive delete of " + what
+		}
+	}
+	return "", ""
+}
+
+// dangerousTarget describes t when it is /, the home directory, or a top-level system
+// directory (or everything in one of them).
+func dangerousTarget(t string) string {
+	t = strings.ReplaceAll(t, "${HOME}", "$HOME")
+	if strings.HasSuffix(t, "/*") {
+		t = strings.TrimSuffix(t, "*")
+	}
+	if t == "" {
+		return ""
+	}
+	switch t = path.Clean(t); {
+	case t == "/":
+		return "/"
+	case t == "~" || t == "$HOME":
+		return "the home directory"
+	case systemDirs[t]:
+		return t
+	}
+	return ""
+}
+
+func mkfs(_ *Engine, p Pipeline, i int) (Action, string) {
+	args := p[i].Args
+	switch name := argv0(p[i]); {
+	case strings.HasPrefix(name, "mkfs") || strings.HasPrefix(name, "newfs") ||
+		name == "mke2fs" || name == "mkswap" || name == "wipefs":
+		return Deny, name + " formats or wipes a filesystem"
+	case name == "diskutil" && len(args) > 1:
+		sub := strings.ToLower(args[1])
+		if strings.HasPrefix(sub, "erase") || sub == "zerodisk" || sub == "randomdisk" ||
+			sub == "secureerase" || sub == "partitiondisk" {
+			return Deny, "diskutil " + args[1] + " erases a disk"
+		}
+	}
+	return "", ""
+}
+
+// blockDevicePrefixes are the device nodes of disks and partitions on Linux and macOS.
+var blockDevicePrefixes = []string{
+	"sd", "hd", "vd", "xvd", "nvme", "mmcblk", "md", "dm-", "loop", "mapper/", "disk/",
+	"disk", "rdisk",
+}
+
+func isBlockDevice(t string) bool {
+	rest, ok := strings.CutPrefix(path.Clean(t), "/dev/")
+	if !ok {
+		return false
+	}
+	for _, prefix := range blockDevicePrefixes {
+		if strings.HasPrefix(rest, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func blockDeviceWrite(_ *Engine, p Pipeline, i int) (Action, string) {
+	c := p[i]
+	for _, r := range c.Redirects {
+		if strings.Contains(r.Op, ">") && isBlockDevice(r.Target) {
+			return Deny, "redirects output to block device " + r.Target
+		}
+	}
+	switch argv0(c) {
+	case "dd":
+		for _, a := range c.Args[1:] {
+			if of, ok := strings.CutPrefix(a, "of="); ok && isBlockDevice(of) {
+				return Deny, "dd writes to block device " + of
+			}
+		}
+	case "tee", "cp", "shred":
+		for _, a := range c.Args[1:] {
+			if isBlockDevice(a) {
+				return Deny, c.Args[0] + " writes to block device " + a
+			}
+		}
+	}
+	return "", ""
+}
+
+// gitGlobalFlags are `git` options before the subcommand that take a separate value.
+var gitGlobalFlags = map[string]bool{"-C": true, "-c": true, "--git-dir": true, "--work-tree": true, "--namespace": true}
+
+// pushValueFlags are `git push` options that take a separate value.
+var pushValueFlags = map[string]bool{"--repo": true, "-o": true, "--push-option": true, "--receive-pack": true, "--exec": true}
+
+func gitForcePush(e *Engine, p Pipeline, i int) (Action, string) {
+	args := p[i].Args
+	if argv0(p[i]) != "git" {
+		return "", ""
+	}
+	j := 1
+	for j < len(args) && strings.HasPrefix(args[j], "-") {
+		if gitGlobalFlags[args[j]] {
+			j++
+		}
+		j++
+	}
+	if j >= len(args) || args[j] != "push" {
+		return "", ""
+	}
+
+	force, del, all := false, false, false
+	var positional []string
+	for k := j + 1; k < len(args); k++ {
+		a := args[k]
+		switch {
+		case a == "--force" || a == "--force-if-includes" || strings.HasPrefix(a, "--force-with-lease"):
+			force = true
+		case a == "--delete":
+			del = true
+		case a == "--all" || a == "--mirror" || a == "--branches":
+			all = true
+		case pushValueFlags[a]:
+			k++
+		case strings.HasPrefix(a, "--"):
+		case strings.HasPrefix(a, "-") && len(a) > 1:
+			force = force || strings.ContainsRune(a, 'f')
+			del = del || strings.ContainsRune(a, 'd')
+		default:
+			positional = append(positional, a)
+		}
+	}
+	var refspecs []string
+	if len(positional) > 1 {
+		refspecs = positional[1:]
+	}
+
+	protected := func(branch string) bool {
+		branch = strings.TrimPrefix(branch, "refs/heads/")
+		for _, pattern := range e.cfg.ProtectedBranches {
+			if ok, _ := path.Match(pattern, branch); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for _, spec := range refspecs {
+		plus := strings.HasPrefix(spec, "+")
+		spec = strings.TrimPrefix(spec, "+")
+		src, dst, hasColon := strings.Cut(spec, ":")
+		if !hasColon {
+			dst = src
+		}
+		if dst == "HEAD" || dst == "@" {
+			dst = e.currentBranch()
+		}
+		switch {
+		case (del || hasColon && src == "") && protected(dst):
+			return Deny, "deletes protected branch " + dst
+		case (force || plus) && protected(dst):
+			return Deny, "force-push to protected branch " + dst
+		}
+	}
+	if !force || len(refspecs) > 0 {
+		return "", ""
+	}
+	if all {
+		return Deny, "force-push of all branches"
+	}
+	branch := e.currentBranch()
+	switch {
+	case branch == "":
+		return Ask, "force-push to the current branch, which could not be determined"
+	case protected(branch):
+		return Deny, "force-push to protected branch " + branch
+	}
+	return "", ""
+}
+
+func (e *Engine) currentBranch() string {
+	if e.CurrentBranch == nil {
+		return ""
+	}
+	return e.CurrentBranch()
+}
+
+// downloaders fetch a URL to stdout; interpreters run a script from stdin.
+var (
+	downloaders  = map[string]bool{"curl": true, "wget": true, "fetch": true, "aria2c": true}
+	interpreters = map[string]bool{
+		"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "ash": true, "fish": true,
+		"python": true, "python3": true, "perl": true, "ruby": true, "node": true, "php": true,
+		"eval": true,
+	}
+	downloadSubst = regexp.MustCompile("(\\$\\(|`|<\\()\\s*(curl|wget)\\b")
+)
+
+func curlPipeShell(_ *Engine, p Pipeline, i int) (Action, string) {
+	name := argv0(p[i])
+	if !interpreters[name] {
+		return "", ""
+	}
+	// `bash <(curl ...)`, `sh -c "$(curl ...)"`, `eval "$(wget -O- ...)"`.
+	for _, a := range p[i].Args[1:] {
+		if downloadSubst.MatchString(a) {
+			return Deny, name + " runs a downloaded script"
+		}
+	}
+	for j := 0; j < i; j++ {
+		if downloaders[argv0(p[j])] {
+			return Deny, "pipes " + p[j].Args[0] + " output into " + name
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,250 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/minitoml"
+)
+
+// Config is the rule configuration, usually loaded from a TOML file:
+//
+//	unknown = "ask"                          # or "allow": verdict for unparsable commands
+//	protected_branches = ["main", "release/*"]
+//	disable_builtin = ["curl-pipe-shell"]
+//
+//	[[deny]]
+//	name = "terraform-destroy"
+//	glob = "terraform destroy*"
+//	reason = "destroys infrastructure"
+//	code = "GUARD_TF_DESTROY"                # default GUARD_TERRAFORM_DESTROY (see RuleCode)
+//
+//	[[ask]]
+//	regex = '^kubectl .*\bdelete\b'
+//
+//	[[allow]]
+//	glob = "rm -rf /tmp/*"
+//
+// Rules match each simple command; `scope = "pipeline"` matches the whole pipeline instead.
+type Config struct {
+	Unknown           Action
+	ProtectedBranches []string
+	DisableBuiltin    []string
+	Rules             []Rule
+}
+
+// DefaultConfig asks about unparsable commands and protects main and master.
+func DefaultConfig() *Config {
+	return &Config{Unknown: Ask, ProtectedBranches: []string{"main", "master"}}
+}
+
+// LoadConfig reads a config file. A missing file yields DefaultConfig.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses TOML config text; settings it omits keep their DefaultConfig values.
+func ParseConfig(data string) (*Config, error) {
+	doc, err := minitoml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	def := DefaultConfig()
+	f := &File{Unknown: string(def.Unknown), ProtectedBranches: def.ProtectedBranches}
+	for key, v := range doc {
+		switch key {
+		case "unknown":
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf(`unknown must be "allow" or "ask", got %v`, v)
+			}
+			f.Unknown = s
+		case "protected_branches":
+			if f.ProtectedBranches, err = stringList(key, v); err != nil {
+				return nil, err
+			}
+		case "disable_builtin":
+			if f.DisableBuiltin, err = stringList(key, v); err != nil {
+				return nil, err
+			}
+		case "deny", "ask", "allow":
+			tables, ok := v.([]map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s must be an array of tables ([[%s]])", key, key)
+			}
+			rules := make([]FileRule, len(tables))
+			for n, t := range tables {
+				if rules[n], err = parseFileRule(t); err != nil {
+					return nil, fmt.Errorf("%s rule %d: %w", key, n+1, err)
+				}
+			}
+			switch key {
+			case "deny":
+				f.Deny = rules
+			case "ask":
+				f.Ask = rules
+			default:
+				f.Allow = rules
+			}
+		default:
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	return f.Config()
+}
+
+// File is the config file's layout for hooksdk.LoadConfig, which fills in the defaults and
+// CODEX_HOOK_<NAME>_UNKNOWN, _PROTECTED_BRANCHES and _DISABLE_BUILTIN overrides (see Config for
+// the format). Config converts it.
+type File struct {
+	Unknown           string     `toml:"unknown" default:"ask"`
+	ProtectedBranches []string   `toml:"protected_branches" default:"main,master"`
+	DisableBuiltin    []string   `toml:"disable_builtin"`
+	Deny              []FileRule `toml:"deny"`
+	Ask               []FileRule `toml:"ask"`
+	Allow             []FileRule `toml:"allow"`
+}
+
+// FileRule is a `[[deny]]`, `[[ask]]` or `[[allow]]` table.
+type FileRule struct {
+	Name   string `toml:"name"`
+	Glob   string `toml:"glob"`
+	Regex  string `toml:"regex"`
+	Scope  string `toml:"scope"`
+	Reason string `toml:"reason"`
+	Code   string `toml:"code"`
+}
+
+// Validate reports the problems Config would.
+func (f *File) Validate() error {
+	_, err := f.Config()
+	return err
+}
+
+// Config checks the settings and compiles the rules: deny rules first, then ask, then allow, each
+// in file order.
+func (f *File) Config() (*Config, error) {
+	cfg := &Config{ProtectedBranches: f.ProtectedBranches, DisableBuiltin: f.DisableBuiltin}
+	switch Action(f.Unknown) {
+	case Allow, Ask:
+		cfg.Unknown = Action(f.Unknown)
+	default:
+		return nil, fmt.Errorf(`unknown must be "allow" or "ask", got %q`, f.Unknown)
+	}
+	for _, name := range f.DisableBuiltin {
+		if !isBuiltin(name) {
+			return nil, fmt.Errorf("disable_builtin: no built-in rule %q", name)
+		}
+	}
+	for _, group := range []struct {
+		action Action
+		rules  []FileRule
+	}{{Deny, f.Deny}, {Ask, f.Ask}, {Allow, f.Allow}} {
+		for n, fr := range group.rules {
+			r, err := fr.rule(group.action)
+			if err != nil {
+				return nil, fmt.Errorf("%s rule %d: %w", group.action, n+1, err)
+			}
+			cfg.Rules = append(cfg.Rules, r)
+		}
+	}
+	return cfg, nil
+}
+
+func parseFileRule(t map[string]any) (FileRule, error) {
+	var fr FileRule
+	for key, v := range t {
+		s, ok := v.(string)
+		if !ok {
+			return FileRule{}, fmt.Errorf("%s must be a string", key)
+		}
+		switch key {
+		case "name":
+			fr.Name = s
+		case "glob":
+			fr.Glob = s
+		case "regex":
+			fr.Regex = s
+		case "scope":
+			fr.Scope = s
+		case "reason":
+			fr.Reason = s
+		case "code":
+			fr.Code = s
+		default:
+			return FileRule{}, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	return fr, nil
+}
+
+func (fr FileRule) rule(action Action) (Rule, error) {
+	r := Rule{Action: action, Name: fr.Name, Glob: fr.Glob, Reason: fr.Reason, Code: fr.Code}
+	if r.Code != "" && !hooksdk.ValidReasonCode(r.Code) {
+		return Rule{}, fmt.Errorf("code %q must be upper case letters, digits and underscores, starting with a letter", r.Code)
+	}
+	if fr.Regex != "" {
+		re, err := regexp.Compile(fr.Regex)
+		if err != nil {
+			return Rule{}, err
+		}
+		r.Regex = re
+	}
+	switch fr.Scope {
+	case "", "command":
+	case "pipeline":
+		r.Pipeline = true
+	default:
+		return Rule{}, fmt.Errorf(`scope must be "command" or "pipeline", got %q`, fr.Scope)
+	}
+	if r.Glob == "" && r.Regex == nil {
+		return Rule{}, errors.New("needs a glob or a regex")
+	}
+	if r.Name == "" {
+		r.Name = r.Glob
+		if r.Name == "" {
+			r.Name = r.Regex.String()
+		}
+	}
+	return r, nil
+}
+
+func stringList(key string, v any) ([]string, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of strings", key)
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an array of strings", key)
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+func isBuiltin(name string) bool {
+	for _, b := range Builtins {
+		if b.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package guard_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/guard"
+)
+
+func TestParseConfigDefaults(t *testing.T) {
+	cfg, err := guard.ParseConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, guard.DefaultConfig()) {
+		t.Errorf("ParseConfig(\"\") = %+v, want the defaults", cfg)
+	}
+
+	cfg, err = guard.LoadConfig(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil || !reflect.DeepEqual(cfg, guard.DefaultConfig()) {
+		t.Errorf("LoadConfig of a missing file = %+v, %v; want the defaults", cfg, err)
+	}
+}
+
+func TestParseConfigRuleOrder(t *testing.T) {
+	cfg, err := guard.ParseConfig(`
+[[allow]]
+glob = "a"
+[[ask]]
+glob = "b"
+[[deny]]
+glob = "c"
+[[deny]]
+glob = "d"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range cfg.Rules {
+		got = append(got, string(r.Action)+" "+r.Name)
+	}
+	if want := []string{"deny c", "deny d", "ask b", "allow a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rules = %q, want %q", got, want)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		config, want string
+	}{
+		{`unknown = "deny"`, `unknown must be "allow" or "ask"`},
+		{`protected_branches = "main"`, "protected_branches must be an array of strings"},
+		{`disable_builtin = ["rm-everything"]`, `no built-in rule "rm-everything"`},
+		{`colour = "red"`, `unknown setting "colour"`},
+		{"[deny]\nglob = \"x\"", "deny must be an array of tables"},
+		{"[[deny]]\nname = \"x\"", "deny rule 1: needs a glob or a regex"},
+		{"[[ask]]\nregex = \"(\"", "ask rule 1:"},
+		{"[[deny]]\nglob = \"x\"\nscope = \"line\"", `scope must be "command" or "pipeline"`},
+		{"[[deny]]\nglob = \"x\"\ncode = \"lower\"", `code "lower" must be upper case`},
+		{"[[deny]]\nglob = \"x\"\ncolour = \"red\"", `unknown key "colour"`},
+		{`unknown = `, ""},
+	}
+	for _, tt := range tests {
+		_, err := guard.ParseConfig(tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseConfig(%q) = %v, want an error containing %q", tt.config, err, tt.want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "guard_exec.toml")
+	if err := os.WriteFile(path, []byte(`unknown = "deny"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := guard.LoadConfig(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("LoadConfig of a bad file = %v, want an error naming it", err)
+	}
+}
+
+func TestFileMatchesParseConfig(t *testing.T) {
+	t.Setenv("CODEX_HOOK_GUARD_UNKNOWN", "")
+	t.Setenv("CODEX_HOOK_GUARD_PROTECTED_BRANCHES", "")
+	t.Setenv("CODEX_HOOK_GUARD_DISABLE_BUILTIN", "")
+	for _, data := range []string{
+		"",
+		"unknown = \"allow\"\nprotected_branches = [\"trunk\"]\n",
+		"[[allow]]\nglob = \"a\"\n[[deny]]\nname = \"no-b\"\nregex = \"^b\"\nreason = \"b is bad\"\ncode = \"NO_B\"\n[[ask]]\nglob = \"c\"\nscope = \"command\"\n",
+	} {
+		want, err := guard.ParseConfig(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "guard.toml")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var f guard.File
+		if err := hooksdk.LoadConfigFile(path, "guard", &f); err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Config()
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: File.Config = %+v, %v; ParseConfig = %+v", data, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package guard_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/guard"
+)
+
+// fixture returns the engine of testdata/guard.toml and the corpus of testdata/guard.corpus.
+func fixture(t *testing.T) (*guard.Engine, *guard.Corpus) {
+	t.Helper()
+	cfg, err := guard.LoadConfig(filepath.Join("testdata", "guard.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := guard.LoadCorpus(filepath.Join("testdata", "guard.corpus"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return guard.New(cfg), c
+}
+
+func TestCorpusFixture(t *testing.T) {
+	e, c := fixture(t)
+	if len(c.Examples) != 14 {
+		t.Fatalf("%d examples, want 14", len(c.Examples))
+	}
+	for _, r := range e.Test(c) {
+		if !r.OK() {
+			t.Errorf("line %d: %s", r.Line, r)
+		}
+	}
+}
+
+func TestParseCorpus(t *testing.T) {
+	c, err := guard.ParseCorpus("# comment\n\ndeny rm-root $ rm -rf /\r\n  ask   $   kubectl delete pod x  \n" +
+		"allow - $ ls\nallow `rm -rf /tmp/*` $ rm -rf /tmp/x\ndeny \"a \\\"b\\\"\" $ b\nallow \"$\" $ $HOME/bin/x\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []guard.Example{
+		{Line: 3, Command: "rm -rf /", Action: guard.Deny, Rule: "rm-root"},
+		{Line: 4, Command: "kubectl delete pod x", Action: guard.Ask},
+		{Line: 5, Command: "ls", Action: guard.Allow, Rule: guard.NoRule},
+		{Line: 6, Command: "rm -rf /tmp/x", Action: guard.Allow, Rule: "rm -rf /tmp/*"},
+		{Line: 7, Command: "b", Action: guard.Deny, Rule: `a "b"`},
+		{Line: 8, Command: "$HOME/bin/x", Action: guard.Allow, Rule: "$"},
+	}
+	if !reflect.DeepEqual(c.Examples, want) {
+		t.Errorf("Examples =\n%+v\nwant\n%+v", c.Examples, want)
+	}
+	if c, err := guard.ParseCorpus(""); err != nil || len(c.Examples) != 0 || c.Bytes() != nil {
+		t.Errorf("empty corpus = %+v, %v", c, err)
+	}
+}
+
+func TestParseCorpusErrors(t *testing.T) {
+	for text, want := range map[string]string{
+		"allow - $ ls\nblock $ ls":    `2: want "allow", "ask", or "deny", got "block"`,
+		"deny rm-root rm -rf /":       "1: want `$` and the command after the verdict",
+		"deny":                        "1: want `$` and the command after the verdict",
+		"# x\ndeny rm-root $":         "2: no command after `$`",
+		"deny $   ":                   "1: no command after `$`",
+		"deny `rm-root $ rm -rf /":    "1: rule `rm-root",
+		"deny \"rm\"root $ rm -rf /":  "1: want `$` and the command after the verdict",
+		"Deny rm-root $ rm -rf /":     `1: want "allow", "ask", or "deny", got "Deny"`,
+		"allow - $ ls\n\n\nask x":     "4: want `$` and the command after the verdict",
+		"ask \"a\\qb\" $ kubectl x y": "1: rule ",
+	} {
+		if _, err := guard.ParseCorpus(text); err == nil || !strings.HasPrefix(err.Error(), want) {
+			t.Errorf("ParseCorpus(%q) = %v, want an error starting %q", text, err, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.corpus")
+	if err := os.WriteFile(path, []byte("allow $ ls\nmaybe $ ls\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := guard.LoadCorpus(path); err == nil || !strings.HasPrefix(err.Error(), path+":2: ") {
+		t.Errorf("LoadCorpus = %v, want an error at %s:2", err, path)
+	}
+	if _, err := guard.LoadCorpus(filepath.Join(t.TempDir(), "missing.corpus")); !os.IsNotExist(err) {
+		t.Errorf("LoadCorpus of a missing file = %v", err)
+	}
+}
+
+func TestExampleString(t *testing.T) {
+	// Each example's line reads back as the example.
+	for _, rule := range []string{"", guard.NoRule, "rm-root", "$", "rm -rf /tmp/*", `^kubectl .*\bdelete\b`, "a `b`", `a "b"`, "tab\there", "`\""} {
+		x := guard.Example{Line: 1, Command: "ls -la", Action: guard.Ask, Rule: rule}
+		c, err := guard.ParseCorpus(x.String())
+		if err != nil || len(c.Examples) != 1 || c.Examples[0] != x {
+			t.Errorf("rule %q: %q parses to %+v, %v", rule, x.String(), c, err)
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	e, _ := fixture(t)
+	tests := []struct {
+		line string
+		ok   bool
+		want string
+	}{
+		{"deny $ rm -rf /", true, ""},
+		{"deny rm-root $ rm -rf /", true, ""},
+		{"allow $ rm -rf /", false, "`rm -rf /`: want allow, got deny by rule rm-root ("},
+		{"deny mkfs $ rm -rf /", false, "`rm -rf /`: want deny by rule mkfs, got deny by rule rm-root ("},
+		{"deny - $ rm -rf /", false, "`rm -rf /`: want deny by no rule, got deny by rule rm-root ("},
+		// The rule that fired is named with the simple command it fired on.
+		{"allow - $ make && rm -rf ~", false, "`make && rm -rf ~`: want allow by no rule, got deny by rule rm-root ("},
+		{"allow - $ rm -rf /tmp/x", false, "`rm -rf /tmp/x`: want allow by no rule, got allow by rule tmp ("},
+		{"allow tmp $ ls", false, "`ls`: want allow by rule tmp, got allow by no rule"},
+		{"allow - $ ls", true, ""},
+		{"allow $ rm -rf /tmp/x", true, ""},
+	}
+	for _, tt := range tests {
+		c, err := guard.ParseCorpus(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := e.Test(c)[0]
+		if r.OK() != tt.ok || !tt.ok && !strings.HasPrefix(r.String(), tt.want) {
+			t.Errorf("%s: OK %v, %s", tt.line, r.OK(), r)
+		}
+	}
+	c, _ := guard.ParseCorpus("allow - $ make && rm -rf ~")
+	if s := e.Test(c)[0].String(); !strings.Contains(s, ", on `rm -rf ~`)") {
+		t.Errorf("mismatch %s doesn't name the command the rule fired on", s)
+	}
+}
+
+func TestCorpusUpdate(t *testing.T) {
+	e, c := fixture(t)
+	before := string(c.Bytes())
+	orig, _ := os.ReadFile(filepath.Join("testdata", "guard.corpus"))
+	if before != string(orig) {
+		t.Errorf("Bytes of an unchanged corpus =\n%s\nwant the file", before)
+	}
+	if n := c.Update(e.Test(c)); n != 0 || string(c.Bytes()) != before {
+		t.Errorf("Update of a passing corpus changed %d example(s)", n)
+	}
+
+	// Without the tmp rule, with kubectl deletes denied, and unparsable commands allowed, three
+	// examples change.
+	cfg, err := guard.ParseConfig(`
+unknown = "allow"
+protected_branches = ["main", "release/*"]
+
+[[deny]]
+name = "terraform-destroy"
+glob = "terraform destroy*"
+
+[[deny]]
+name = "kube-delete"
+regex = '^kubectl .*\bdelete\b'
+
+[[allow]]
+name = "installer"
+glob = "curl -fsSL https://get.example.com/* | sh"
+scope = "pipeline"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := guard.New(cfg)
+	if n := c.Update(changed.Test(c)); n != 3 {
+		t.Errorf("Update changed %d example(s), want 3", n)
+	}
+	for _, r := range changed.Test(c) {
+		if !r.OK() {
+			t.Errorf("after Update, line %d: %s", r.Line, r)
+		}
+	}
+	text := string(c.Bytes())
+	for _, line := range []string{
+		"deny kube-delete $ kubectl -n web delete pod web-1",
+		"allow - $ rm -rf /tmp/build",
+		// Without a rule, only the action is updated.
+		"allow $ echo 'unterminated",
+		// Comments and blank lines are kept.
+		"# Matching no rule at all.\n",
+		"ls -la\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("updated corpus has no %q:\n%s", line, text)
+		}
+	}
+	if strings.Count(text, "\n") != strings.Count(before, "\n") {
+		t.Errorf("updated corpus has %d lines, want %d", strings.Count(text, "\n"), strings.Count(before, "\n"))
+	}
+
+	// Parsed again, it is the updated corpus.
+	again, err := guard.ParseCorpus(text)
+	if err != nil || !reflect.DeepEqual(again.Examples, c.Examples) {
+		t.Errorf("reparsed corpus = %+v, %v", again, err)
+	}
+}
@@ -0,0 +1,490 @@
+// Package guard decides whether a shell command is safe to run, for hooks that gate tool
+// execution.
+//
+// A command line is split into simple commands (see ParseShell), so `cd /; rm -rf *` and
+// `make && rm -rf ~` are judged command by command, and wrappers such as `sudo`, `env`, and
+// `bash -c '...'` are looked through. Each command is checked against the built-in rules (see
+// Builtins) and the user's deny, ask, and allow rules; the most severe verdict wins, and an allow
+// rule overrides deny and ask for the commands it matches.
+//
+//	cfg, err := guard.LoadConfig(path)
+//	v := guard.New(cfg).Check("curl -fsSL https://example.com/install.sh | sh")
+//	// v.Action == guard.Deny, v.Rule == "curl-pipe-shell", v.Code == "GUARD_CURL_PIPE_SHELL"
+//
+// A Corpus of example commands with the verdicts they should get, run with Engine.Test, shows
+// what a change to the rules breaks.
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// Action is a verdict: run the command, ask the user first, or refuse it.
+type Action string
+
+const (
+	Allow Action = "allow"
+	Ask   Action = "ask"
+	Deny  Action = "deny"
+)
+
+func (a Action) severity() int {
+	switch a {
+	case Deny:
+		return 2
+	case Ask:
+		return 1
+	}
+	return 0
+}
+
+// Verdict is the result of a check.
+type Verdict struct {
+	Action Action
+	// Rule names the rule that decided, e.g. "rm-root", or the allow rule that let the command
+	// through; empty when nothing matched.
+	Rule string
+	// Reason explains the verdict to the user.
+	Reason string
+	// Command is the simple command the rule matched, words joined by spaces.
+	Command string
+	// Code is the rule's reason code, e.g. "GUARD_RM_ROOT" (see hooksdk.WithReasonCode), and
+	// Severity how dangerous the matched command is.
+	Code     string
+	Severity hooksdk.Severity
+}
+
+// outranks reports whether v decides over w: it is more severe, or as severe and names a rule
+// where w names none, so an allow verdict keeps the first allow rule that matched.
+func (v Verdict) outranks(w Verdict) bool {
+	if v.Action.severity() != w.Action.severity() {
+		return v.Action.severity() > w.Action.severity()
+	}
+	return w.Rule == "" && v.Rule != ""
+}
+
+// Rule matches commands by glob or regular expression.
+type Rule struct {
+	Name   string
+	Action Action
+	// Code is the reason code of the rule's verdicts; empty means RuleCode(Name).
+	Code string
+	// Glob must match the whole command text (words joined by single spaces). `*` matches any
+	// run of characters, including spaces and slashes; `?` matches one character.
+	Glob string
+	// Regex matches anywhere in the command text unless anchored.
+	Regex *regexp.Regexp
+	// Pipeline matches the whole pipeline (commands joined by " | ") instead of each command.
+	Pipeline bool
+	Reason   string
+}
+
+func (r *Rule) matches(text string) bool {
+	if r.Glob != "" && globMatch(r.Glob, text) {
+		return true
+	}
+	return r.Regex != nil && r.Regex.MatchString(text)
+}
+
+func (r *Rule) reason(text string) string {
+	if r.Reason != "" {
+		return r.Reason
+	}
+	return "matches " + string(r.Action) + " rule " + r.Name
+}
+
+func (r *Rule) verdict(text string) Verdict {
+	v := Verdict{Action: r.Action, Rule: r.Name, Reason: r.reason(text), Command: text, Code: r.Code, Severity: hooksdk.SeverityMedium}
+	if v.Code == "" {
+		v.Code = RuleCode(r.Name)
+	}
+	switch r.Action {
+	case Deny:
+		v.Severity = hooksdk.SeverityHigh
+	case Allow:
+		v.Severity = hooksdk.SeverityLow
+	}
+	return v
+}
+
+// RuleCode is the default reason code of a rule: GUARD_ and its name in upper case, with
+// characters other than letters and digits replaced by underscores.
+func RuleCode(name string) string {
+	return "GUARD_" + strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name))
+}
+
+// Engine checks commands against a Config.
+type Engine struct {
+	cfg      *Config
+	builtins []Builtin
+
+	// CurrentBranch reports the checked-out git branch, for `git push --force` without a refspec.
+	// When nil, or when it returns "", such pushes are asked about rather than denied.
+	CurrentBranch func() string
+}
+
+// New returns an Engine for cfg; a nil cfg means DefaultConfig.
+func New(cfg *Config) *Engine {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	e := &Engine{cfg: cfg}
+	for _, b := range Builtins {
+		if !contains(cfg.DisableBuiltin, b.Name) {
+			e.builtins = append(e.builtins, b)
+		}
+	}
+	return e
+}
+
+// Check judges a shell command line. A line that can't be parsed gets Config.Unknown.
+func (e *Engine) Check(line string) Verdict {
+	v, err := e.checkScript(line, 0)
+	if err != nil {
+		return e.unknown(err.Error())
+	}
+	return v
+}
+
+// CheckArgv judges a command given as an argument vector, as in an approval request.
+func (e *Engine) CheckArgv(argv []string) Verdict {
+	if len(argv) == 0 {
+		return e.unknown("empty command")
+	}
+	v, err := e.checkPipelines([]Pipeline{{{Args: argv}}}, 0)
+	if err != nil {
+		return e.unknown(err.Error())
+	}
+	return v
+}
+
+func (e *Engine) unknown(why string) Verdict {
+	return Verdict{
+		Action:   e.cfg.Unknown,
+		Rule:     "unparsable",
+		Reason:   "could not parse command: " + why,
+		Code:     "GUARD_UNPARSABLE",
+		Severity: hooksdk.SeverityMedium,
+	}
+}
+
+func (e *Engine) checkScript(src string, depth int) (Verdict, error) {
+	if depth > maxNesting {
+		return Verdict{}, errors.New("too many nested shells")
+	}
+	pipelines, err := ParseShell(src)
+	if err != nil {
+		return Verdict{}, err
+	}
+	return e.checkPipelines(pipelines, depth)
+}
+
+func (e *Engine) checkPipelines(pipelines []Pipeline, depth int) (Verdict, error) {
+	worst := Verdict{Action: Allow}
+	for _, p := range pipelines {
+		v, err := e.checkPipeline(normalizePipeline(p), depth)
+		if err != nil {
+			return Verdict{}, err
+		}
+		if v.outranks(worst) {
+			worst = v
+		}
+		if worst.Action == Deny {
+			break
+		}
+	}
+	return worst, nil
+}
+
+func (e *Engine) checkPipeline(p Pipeline, depth int) (Verdict, error) {
+	worst := Verdict{Action: Allow}
+	if len(p) == 0 {
+		return worst, nil
+	}
+	texts := make([]string, len(p))
+	for i, c := range p {
+		texts[i] = strings.Join(c.Args, " ")
+	}
+	pipeText := strings.Join(texts, " | ")
+	for _, r := range e.cfg.Rules {
+		if r.Action == Allow && r.Pipeline && r.matches(pipeText) {
+			return r.verdict(pipeText), nil
+		}
+	}
+
+	consider := func(v Verdict) {
+		if v.outranks(worst) {
+			worst = v
+		}
+	}
+	for _, r := range e.cfg.Rules {
+		if r.Action != Allow && r.Pipeline && r.matches(pipeText) {
+			consider(r.verdict(pipeText))
+		}
+	}
+	for i, c := range p {
+		if r := e.allowRule(texts[i]); r != nil {
+			consider(r.verdict(texts[i]))
+			continue
+		}
+		for _, r := range e.cfg.Rules {
+			if r.Action != Allow && !r.Pipeline && r.matches(texts[i]) {
+				consider(r.verdict(texts[i]))
+			}
+		}
+		for _, b := range e.builtins {
+			if action, reason := b.Match(e, p, i); action != "" {
+				consider(Verdict{Action: action, Rule: b.Name, Reason: reason, Command: texts[i], Code: b.Code, Severity: b.Severity})
+			}
+		}
+		// `bash -c '...'` and `eval ...` run a script of their own.
+		if script, ok := innerScript(c.Args); ok {
+			v, err := e.checkScript(script, depth+1)
+			if err != nil {
+				return Verdict{}, err
+			}
+			consider(v)
+		}
+		if worst.Action == Deny {
+			break
+		}
+	}
+	return worst, nil
+}
+
+// allowRule returns the first command allow rule that matches text, or nil.
+func (e *Engine) allowRule(text string) *Rule {
+	for i, r := range e.cfg.Rules {
+		if r.Action == Allow && !r.Pipeline && r.matches(text) {
+			return &e.cfg.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Commands returns the simple commands a shell command line runs, in order, for checks of one's
+// own: wrappers are stripped and the program reduced to its base name, as for rules, and the
+// scripts of `sh -c` and `eval` are followed.
+func Commands(line string) ([]Command, error) {
+	pipelines, err := ParseShell(line)
+	if err != nil {
+		return nil, err
+	}
+	return commands(pipelines, 0)
+}
+
+// CommandsArgv is Commands for a command given as an argument vector.
+func CommandsArgv(argv []string) ([]Command, error) {
+	return commands([]Pipeline{{{Args: argv}}}, 0)
+}
+
+func commands(pipelines []Pipeline, depth int) ([]Command, error) {
+	if depth > maxNesting {
+		return nil, fmt.Errorf("%w: too many nested shells", ErrUnparsable)
+	}
+	var out []Command
+	for _, p := range pipelines {
+		for _, c := range normalizePipeline(p) {
+			if len(c.Args) > 0 {
+				out = append(out, c)
+			}
+			script, ok := innerScript(c.Args)
+			if !ok {
+				continue
+			}
+			inner, err := ParseShell(script)
+			if err != nil {
+				return nil, err
+			}
+			cmds, err := commands(inner, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, cmds...)
+		}
+	}
+	return out, nil
+}
+
+var shells = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "ash": true, "fish": true}
+
+// innerScript returns the script run by `sh -c script` (also `bash -lc`, `-ec`, ...) or `eval`.
+func innerScript(args []string) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	if args[0] == "eval" {
+		return strings.Join(args[1:], " "), len(args) > 1
+	}
+	if !shells[args[0]] {
+		return "", false
+	}
+	sawC := false
+	for _, a := range args[1:] {
+		if strings.HasPrefix(a, "-") && !strings.HasPrefix(a, "--") {
+			if strings.ContainsRune(a, 'c') {
+				sawC = true
+			}
+			continue
+		}
+		if sawC {
+			return a, true
+		}
+		return "", false
+	}
+	return "", false
+}
+
+// normalizePipeline strips wrappers from every command in p.
+func normalizePipeline(p Pipeline) Pipeline {
+	out := make(Pipeline, 0, len(p))
+	for _, c := range p {
+		c.Args, c.Env = normalize(c.Args)
+		if len(c.Args) == 0 && len(c.Redirects) == 0 {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// keywords are shell reserved words that may precede a command, e.g. `if rm -rf /; then`.
+var keywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "do": true, "while": true,
+	"until": true, "!": true, "{": true,
+}
+
+// closers make up commands of their own once the list is split: `fi`, `done`, `}`.
+var closers = map[string]bool{"fi": true, "done": true, "}": true, "esac": true}
+
+// wrapperFlags lists, per wrapper, the flags that take a separate value.
+var wrapperFlags = map[string]string{
+	"sudo":    "-u -g -C -D -h -p -r -t -U -T",
+	"doas":    "-u -C",
+	"env":     "-u -C -S",
+	"command": "",
+	"builtin": "",
+	"exec":    "-a",
+	"nohup":   "",
+	"time":    "-f -o",
+	"nice":    "-n",
+	"ionice":  "-c -n -t",
+	"timeout": "-s -k",
+	"stdbuf":  "-i -o -e",
+	"xargs":   "-I -n -P -d -E -L -s -a",
+}
+
+// normalize drops assignments, keywords, and wrapper commands in front of the real command and
+// reduces it to its base name (`/usr/bin/rm` becomes `rm`). The assignments are returned as env.
+func normalize(args []string) (out, env []string) {
+	i := 0
+	for i < len(args) {
+		a := args[i]
+		if keywords[a] || isAssignment(a) {
+			if isAssignment(a) {
+				env = append(env, a)
+			}
+			i++
+			continue
+		}
+		valued, ok := wrapperFlags[a]
+		if !ok {
+			break
+		}
+		i++
+		for i < len(args) && strings.HasPrefix(args[i], "-") {
+			f := args[i]
+			i++
+			if f == "--" {
+				break
+			}
+			if strings.Contains(" "+valued+" ", " "+f+" ") {
+				i++
+			}
+		}
+		switch a {
+		case "env":
+			for i < len(args) && isAssignment(args[i]) {
+				env = append(env, args[i])
+				i++
+			}
+		case "timeout":
+			// The duration comes before the command.
+			i++
+		}
+	}
+	if i >= len(args) {
+		return nil, env
+	}
+	if i == len(args)-1 && closers[args[i]] {
+		return nil, env
+	}
+	out = append([]string(nil), args[i:]...)
+	out[0] = commandName(out[0])
+	return out, env
+}
+
+func isAssignment(s string) bool {
+	name, _, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// commandName is the base name of a command path, without a Windows `.exe` suffix.
+func commandName(s string) string {
+	s = path.Base(strings.ReplaceAll(s, `\`, "/"))
+	return strings.TrimSuffix(strings.TrimSuffix(s, ".exe"), ".EXE")
+}
+
+// globMatch matches s against a glob in which `*` also crosses `/` and spaces.
+func globMatch(glob, s string) bool {
+	px, sx := 0, 0
+	starP, starS := -1, 0
+	for sx < len(s) {
+		switch {
+		case px < len(glob) && (glob[px] == '?' || glob[px] == s[sx]):
+			px++
+			sx++
+		case px < len(glob) && glob[px] == '*':
+			starP, starS = px, sx
+			px++
+		case starP >= 0:
+			px = starP + 1
+			starS++
+			sx = starS
+		default:
+			return false
+		}
+	}
+	for px < len(glob) && glob[px] == '*' {
+		px++
+	}
+	return px == len(glob)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
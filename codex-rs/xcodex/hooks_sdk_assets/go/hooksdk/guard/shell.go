@@ -0,0 +1,403 @@
+package guard
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Command is one simple command: its words after quote removal, with redirections split out.
+type Command struct {
+	Args      []string
+	Redirects []Redirect
+	// Env holds the `NAME=value` assignments in front of the command, also those given to env,
+	// once Commands has stripped them from Args.
+	Env []string
+}
+
+// Redirect is a redirection such as `> /dev/sda` (Op ">", Target "/dev/sda").
+type Redirect struct {
+	Op     string
+	Target string
+}
+
+// Pipeline is a sequence of commands connected by `|`.
+type Pipeline []Command
+
+// maxNesting bounds how deeply command substitutions and `sh -c` scripts are followed.
+const maxNesting = 16
+
+// ErrUnparsable is wrapped by ParseShell errors.
+var ErrUnparsable = errors.New("unparsable command")
+
+// ParseShell splits a POSIX shell command line into pipelines. Lists (`&&`, `||`, `;`, `&`,
+// newlines) and subshells become separate pipelines; the contents of command and process
+// substitutions (`$(...)`, backticks, `<(...)`) are parsed too and appended, since they run as
+// well. Heredoc bodies are skipped. Variables are not expanded.
+func ParseShell(src string) ([]Pipeline, error) {
+	var out []Pipeline
+	queue := []string{src}
+	for n := 0; len(queue) > 0; n++ {
+		if n > maxNesting {
+			return nil, fmt.Errorf("%w: too many nested substitutions", ErrUnparsable)
+		}
+		l := &lexer{src: queue[0]}
+		queue = queue[1:]
+		pipelines, err := l.parse()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, pipelines...)
+		queue = append(queue, l.subs...)
+	}
+	return out, nil
+}
+
+type lexer struct {
+	src string
+	pos int
+
+	// subs collects the sources of command and process substitutions.
+	subs []string
+	// heredocs are delimiters whose bodies start after the current line.
+	heredocs []heredoc
+
+	pipelines []Pipeline
+	pipe      Pipeline
+	cmd       Command
+	word      strings.Builder
+	inWord    bool
+	redirect  string
+}
+
+type heredoc struct {
+	delim    string
+	stripTab bool
+}
+
+func (l *lexer) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrUnparsable, fmt.Sprintf(format, args...))
+}
+
+func (l *lexer) peekIs(s string) bool {
+	return strings.HasPrefix(l.src[l.pos:], s)
+}
+
+func (l *lexer) flushWord() {
+	if !l.inWord {
+		return
+	}
+	w := l.word.String()
+	l.word.Reset()
+	l.inWord = false
+	if l.redirect != "" {
+		l.cmd.Redirects = append(l.cmd.Redirects, Redirect{Op: l.redirect, Target: w})
+		if strings.HasPrefix(l.redirect, "<<") && l.redirect != "<<<" {
+			l.heredocs = append(l.heredocs, heredoc{delim: w, stripTab: l.redirect == "<<-"})
+		}
+		l.redirect = ""
+		return
+	}
+	l.cmd.Args = append(l.cmd.Args, w)
+}
+
+func (l *lexer) endCommand() error {
+	l.flushWord()
+	if l.redirect != "" {
+		return l.errorf("missing target for %s", l.redirect)
+	}
+	if len(l.cmd.Args) > 0 || len(l.cmd.Redirects) > 0 {
+		l.pipe = append(l.pipe, l.cmd)
+	}
+	l.cmd = Command{}
+	return nil
+}
+
+func (l *lexer) endPipeline() error {
+	if err := l.endCommand(); err != nil {
+		return err
+	}
+	if len(l.pipe) > 0 {
+		l.pipelines = append(l.pipelines, l.pipe)
+	}
+	l.pipe = nil
+	return nil
+}
+
+func (l *lexer) parse() ([]Pipeline, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		var err error
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+			l.flushWord()
+		case c == '\n':
+			l.pos++
+			if err = l.endPipeline(); err == nil {
+				err = l.skipHeredocs()
+			}
+		case c == '#' && !l.inWord:
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == ';' || c == '(' || c == ')':
+			l.pos++
+			err = l.endPipeline()
+		case c == '&':
+			switch {
+			case l.peekIs("&>"):
+				err = l.readRedirect()
+			case l.peekIs("&&"):
+				l.pos += 2
+				err = l.endPipeline()
+			default:
+				l.pos++
+				err = l.endPipeline()
+			}
+		case c == '|':
+			switch {
+			case l.peekIs("||"):
+				l.pos += 2
+				err = l.endPipeline()
+			case l.peekIs("|&"):
+				l.pos += 2
+				err = l.endCommand()
+			default:
+				l.pos++
+				err = l.endCommand()
+			}
+		case (c == '<' || c == '>') && l.pos+1 < len(l.src) && l.src[l.pos+1] == '(':
+			l.pos += 2
+			var inner string
+			if inner, err = l.captureParens(); err == nil {
+				l.subs = append(l.subs, inner)
+				l.word.WriteString(string(c) + "(" + inner + ")")
+				l.inWord = true
+			}
+		case c == '<' || c == '>':
+			err = l.readRedirect()
+		case c == '\'':
+			err = l.singleQuoted()
+		case c == '"':
+			err = l.doubleQuoted()
+		case c == '\\':
+			l.pos++
+			if l.pos < len(l.src) {
+				if l.src[l.pos] != '\n' {
+					l.word.WriteByte(l.src[l.pos])
+					l.inWord = true
+				}
+				l.pos++
+			}
+		case c == '$' || c == '`':
+			err = l.dollarOrBacktick()
+		default:
+			l.word.WriteByte(c)
+			l.inWord = true
+			l.pos++
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := l.endPipeline(); err != nil {
+		return nil, err
+	}
+	return l.pipelines, nil
+}
+
+// readRedirect reads a redirection operator; a word of digits right before it is the fd number.
+func (l *lexer) readRedirect() error {
+	if l.inWord && strings.Trim(l.word.String(), "0123456789") == "" {
+		l.word.Reset()
+		l.inWord = false
+	}
+	l.flushWord()
+	if l.redirect != "" {
+		return l.errorf("missing target for %s", l.redirect)
+	}
+	start := l.pos
+	for l.pos < len(l.src) && strings.IndexByte("<>&|-", l.src[l.pos]) >= 0 {
+		if l.src[l.pos] == '-' && !strings.HasPrefix(l.src[start:l.pos], "<<") {
+			break
+		}
+		l.pos++
+	}
+	op := l.src[start:l.pos]
+	// `2>&1` and `>&-` duplicate or close a descriptor; there is no file target.
+	if strings.HasSuffix(op, "&") && op != "&" {
+		for l.pos < len(l.src) && (l.src[l.pos] >= '0' && l.src[l.pos] <= '9' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if l.pos > start+len(op) {
+			return nil
+		}
+	}
+	l.redirect = op
+	return nil
+}
+
+func (l *lexer) singleQuoted() error {
+	end := strings.IndexByte(l.src[l.pos+1:], '\'')
+	if end < 0 {
+		return l.errorf("unterminated single quote")
+	}
+	l.word.WriteString(l.src[l.pos+1 : l.pos+1+end])
+	l.inWord = true
+	l.pos += end + 2
+	return nil
+}
+
+func (l *lexer) doubleQuoted() error {
+	l.pos++
+	l.inWord = true
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			next := l.src[l.pos+1]
+			switch next {
+			case '$', '`', '"', '\\':
+				l.word.WriteByte(next)
+			case '\n':
+			default:
+				l.word.WriteByte('\\')
+				l.word.WriteByte(next)
+			}
+			l.pos += 2
+		case c == '$' || c == '`':
+			if err := l.dollarOrBacktick(); err != nil {
+				return err
+			}
+		default:
+			l.word.WriteByte(c)
+			l.pos++
+		}
+	}
+	return l.errorf("unterminated double quote")
+}
+
+// dollarOrBacktick handles `$(...)`, `$((...))`, `${...}`, backticks, and plain `$`.
+func (l *lexer) dollarOrBacktick() error {
+	l.inWord = true
+	switch {
+	case l.peekIs("$(("):
+		l.pos += 3
+		inner, err := l.captureParens()
+		if err != nil {
+			return err
+		}
+		// Arithmetic expansion: the closing `)` of `))` is still pending.
+		if l.pos >= len(l.src) || l.src[l.pos] != ')' {
+			// Not arithmetic after all but a subshell inside a substitution: `$( (cmd) )`.
+			l.subs = append(l.subs, "("+inner+")")
+			l.word.WriteString("$((" + inner + ")")
+			return nil
+		}
+		l.pos++
+		l.word.WriteString("$((" + inner + "))")
+	case l.peekIs("$("):
+		l.pos += 2
+		inner, err := l.captureParens()
+		if err != nil {
+			return err
+		}
+		l.subs = append(l.subs, inner)
+		l.word.WriteString("$(" + inner + ")")
+	case l.peekIs("${"):
+		end := strings.IndexByte(l.src[l.pos:], '}')
+		if end < 0 {
+			return l.errorf("unterminated ${")
+		}
+		l.word.WriteString(l.src[l.pos : l.pos+end+1])
+		l.pos += end + 1
+	case l.src[l.pos] == '`':
+		var b strings.Builder
+		for l.pos++; l.pos < len(l.src); l.pos++ {
+			c := l.src[l.pos]
+			if c == '\\' && l.pos+1 < len(l.src) && strings.IndexByte("$`\\", l.src[l.pos+1]) >= 0 {
+				l.pos++
+				b.WriteByte(l.src[l.pos])
+				continue
+			}
+			if c == '`' {
+				l.pos++
+				l.subs = append(l.subs, b.String())
+				l.word.WriteString("`" + b.String() + "`")
+				return nil
+			}
+			b.WriteByte(c)
+		}
+		return l.errorf("unterminated backtick")
+	default:
+		l.word.WriteByte('$')
+		l.pos++
+	}
+	return nil
+}
+
+// captureParens returns the text up to the `)` matching an already consumed `(`, skipping over
+// quoted text.
+func (l *lexer) captureParens() (string, error) {
+	start, depth := l.pos, 1
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; c {
+		case '\\':
+			l.pos++
+		case '\'':
+			end := strings.IndexByte(l.src[l.pos+1:], '\'')
+			if end < 0 {
+				return "", l.errorf("unterminated single quote")
+			}
+			l.pos += end + 1
+		case '"':
+			for l.pos++; l.pos < len(l.src) && l.src[l.pos] != '"'; l.pos++ {
+				if l.src[l.pos] == '\\' {
+					l.pos++
+				}
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				inner := l.src[start:l.pos]
+				l.pos++
+				return inner, nil
+			}
+		}
+		l.pos++
+	}
+	return "", l.errorf("unterminated (")
+}
+
+// skipHeredocs skips the bodies of the heredocs started on the line just ended.
+func (l *lexer) skipHeredocs() error {
+	for _, h := range l.heredocs {
+		for {
+			if l.pos >= len(l.src) {
+				return nil
+			}
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			line := l.src[l.pos:]
+			if end >= 0 {
+				line = l.src[l.pos : l.pos+end]
+				l.pos += end + 1
+			} else {
+				l.pos = len(l.src)
+			}
+			if h.stripTab {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if strings.TrimRight(line, "\r") == h.delim {
+				break
+			}
+		}
+	}
+	l.heredocs = nil
+	return nil
+}
@@ -0,0 +1,73 @@
+package guard_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/guard"
+)
+
+// render shows pipelines one per element, commands joined by " | " with their words quoted, so
+// word boundaries are visible.
+func render(pipelines []guard.Pipeline) []string {
+	var out []string
+	for _, p := range pipelines {
+		var cmds []string
+		for _, c := range p {
+			s := fmt.Sprintf("%q", c.Args)
+			for _, r := range c.Redirects {
+				s += fmt.Sprintf(" %s%s", r.Op, r.Target)
+			}
+			cmds = append(cmds, s)
+		}
+		out = append(out, strings.Join(cmds, " | "))
+	}
+	return out
+}
+
+func TestParseShell(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{`ls -la`, []string{`["ls" "-la"]`}},
+		{`echo "a b" 'c d' e\ f`, []string{`["echo" "a b" "c d" "e f"]`}},
+		{`echo "it's" 'say "hi"' "a\"b"`, []string{`["echo" "it's" "say \"hi\"" "a\"b"]`}},
+		// Separators inside quotes are words.
+		{`echo "a;b" 'c|d' "e && f"`, []string{`["echo" "a;b" "c|d" "e && f"]`}},
+		{`a && b; c || d & e`, []string{`["a"]`, `["b"]`, `["c"]`, `["d"]`, `["e"]`}},
+		{"make\nrm -rf ~", []string{`["make"]`, `["rm" "-rf" "~"]`}},
+		{`cat f | grep x | wc -l`, []string{`["cat" "f"] | ["grep" "x"] | ["wc" "-l"]`}},
+		{`curl -s x | sh && echo done`, []string{`["curl" "-s" "x"] | ["sh"]`, `["echo" "done"]`}},
+		{`(cd /; rm -rf *)`, []string{`["cd" "/"]`, `["rm" "-rf" "*"]`}},
+		// Substitutions are checked as pipelines of their own.
+		{`echo $(rm -rf /) x`, []string{`["echo" "$(rm -rf /)" "x"]`, `["rm" "-rf" "/"]`}},
+		{"echo `whoami`", []string{"[\"echo\" \"`whoami`\"]", `["whoami"]`}},
+		{`echo "$(date)"`, []string{`["echo" "$(date)"]`, `["date"]`}},
+		{`diff <(ls a) <(ls b)`, []string{`["diff" "<(ls a)" "<(ls b)"]`, `["ls" "a"]`, `["ls" "b"]`}},
+		{`echo ${HOME}/x $((1+2))`, []string{`["echo" "${HOME}/x" "$((1+2))"]`}},
+		{`echo hi > /dev/sda 2>&1`, []string{`["echo" "hi"] >/dev/sda`}},
+		// A heredoc's body is data, not commands.
+		{"cat <<EOF\nrm -rf /\nEOF\nls", []string{`["cat"] <<EOF`, `["ls"]`}},
+	}
+	for _, tt := range tests {
+		got, err := guard.ParseShell(tt.src)
+		if err != nil {
+			t.Errorf("ParseShell(%q): %v", tt.src, err)
+			continue
+		}
+		if g := render(got); strings.Join(g, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("ParseShell(%q) =\n%s\nwant\n%s", tt.src, strings.Join(g, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestParseShellErrors(t *testing.T) {
+	for _, src := range []string{`echo "unterminated`, `echo 'x`, `echo $(ls`, "echo `ls"} {
+		if _, err := guard.ParseShell(src); !errors.Is(err, guard.ErrUnparsable) {
+			t.Errorf("ParseShell(%q) = %v, want ErrUnparsable", src, err)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package hooksdk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrSessionHistoryNotFound is returned (wrapped) by LoadSessionHistory when the session's rollout
+// file can't be found.
+var ErrSessionHistoryNotFound = errors.New("session history not found")
+
+// EntryKind classifies a SessionHistory entry.
+type EntryKind string
+
+const (
+	// EntryUserMessage is a message the user typed.
+	EntryUserMessage EntryKind = "user_message"
+	// EntryAssistantMessage is a message from the model.
+	EntryAssistantMessage EntryKind = "assistant_message"
+	// EntryContext is a message the host added for the model rather than one the user typed:
+	// developer and system messages, and user-role messages such as `<environment_context>` or
+	// AGENTS.md instructions.
+	EntryContext EntryKind = "context"
+	// EntryToolCall is a tool call by the model (a function, custom tool, or local shell call).
+	EntryToolCall EntryKind = "tool_call"
+	// EntryToolOutput is the output of a tool call, matched to it by CallID.
+	EntryToolOutput EntryKind = "tool_output"
+	// EntryOther is anything else: session metadata, turn context, reasoning, events.
+	EntryOther EntryKind = "other"
+)
+
+// HistoryEntry is one line of a session's rollout file.
+type HistoryEntry struct {
+	Time time.Time
+	Kind EntryKind
+	// Type is the rollout item type: the response item's `type` (`message`, `function_call`, ...)
+	// for response items, otherwise the line's `type` (`session_meta`, `turn_context`,
+	// `event_msg`, ...).
+	Type string
+	// Role is a message's role (`user`, `assistant`, `developer`).
+	Role string
+	// Text is a message's text, or a tool output's, with multiple parts joined by newlines.
+	Text string
+	// CallID links a tool call to its output. Name and Input are a call's tool name and its
+	// arguments as sent (usually JSON; a local shell call's input is its `action`).
+	CallID string
+	Name   string
+	Input  string
+	// Payload is the line's raw `payload`.
+	Payload json.RawMessage
+}
+
+// ToolCall is a tool call from a SessionHistory with its output, if that was recorded.
+type ToolCall struct {
+	Time      time.Time
+	CallID    string
+	Name      string
+	Input     string
+	Output    string
+	HasOutput bool
+}
+
+// SessionHistory is a session's rollout file (`$CODEX_HOME/sessions/YYYY/MM/DD/rollout-*.jsonl`)
+// parsed into entries, oldest first.
+type SessionHistory struct {
+	// Path is the rollout file, when the history was loaded from one.
+	Path    string
+	Entries []HistoryEntry
+	// Skipped counts lines that couldn't be parsed. Truncated is set when the last line was one
+	// of them and had no trailing newline, i.e. the host was still writing it.
+	Skipped   int
+	Truncated bool
+}
+
+// LoadSessionHistory reads the rollout file of p's session: the payload's `transcript_path` when
+// set, otherwise the `rollout-*-<session id>.jsonl` file under CODEX_HOME (default `~/.xcodex`)
+// in `sessions/` or `archived_sessions/`. The file may be read while the host is appending to it;
+// a partially written last line is skipped (see SessionHistory.Truncated).
+func LoadSessionHistory(p *HookPayload) (*SessionHistory, error) {
+	path := p.TranscriptPath
+	if path == "" {
+		var err error
+		if path, err = findRollout(p.SessionID()); err != nil {
+			return nil, err
+		}
+	}
+	return LoadSessionHistoryFile(path)
+}
+
+// LoadSessionHistoryFile reads a rollout file (see LoadSessionHistory).
+func LoadSessionHistoryFile(path string) (*SessionHistory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h, err := ParseSessionHistory(f)
+	if err != nil {
+		return nil, fmt.Errorf("read session history %s: %w", path, err)
+	}
+	h.Path = path
+	return h, nil
+}
+
+// ParseSessionHistory parses rollout JSONL from r. Lines that aren't valid JSON are counted in
+// Skipped rather than failing the parse.
+func ParseSessionHistory(r io.Reader) (*SessionHistory, error) {
+	h := &SessionHistory{}
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		complete := err == nil
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if entry, ok := parseHistoryLine(line); ok {
+				h.Entries = append(h.Entries, entry)
+			} else {
+				h.Skipped++
+				h.Truncated = !complete
+			}
+		}
+		if !complete {
+			return h, nil
+		}
+	}
+}
+
+// Each calls fn for each entry, oldest first, until fn returns false.
+func (h *SessionHistory) Each(fn func(e HistoryEntry) bool) {
+	for _, e := range h.Entries {
+		if !fn(e) {
+			return
+		}
+	}
+}
+
+// LastUserMessage returns the text of the latest message the user typed.
+func (h *SessionHistory) LastUserMessage() (string, bool) {
+	for i := len(h.Entries) - 1; i >= 0; i-- {
+		if h.Entries[i].Kind == EntryUserMessage {
+			return h.Entries[i].Text, true
+		}
+	}
+	return "", false
+}
+
+// ToolCalls returns the session's tool calls, oldest first, each with its output.
+func (h *SessionHistory) ToolCalls() []ToolCall {
+	var calls []ToolCall
+	index := map[string]int{}
+	for _, e := range h.Entries {
+		switch e.Kind {
+		case EntryToolCall:
+			if e.CallID != "" {
+				index[e.CallID] = len(calls)
+			}
+			calls = append(calls, ToolCall{Time: e.Time, CallID: e.CallID, Name: e.Name, Input: e.Input})
+		case EntryToolOutput:
+			if i, ok := index[e.CallID]; ok {
+				calls[i].Output = e.Text
+				calls[i].HasOutput = true
+			}
+		}
+	}
+	return calls
+}
+
+// rolloutLine is a line of the rollout file: `{"timestamp":...,"type":...,"payload":{...}}`.
+type rolloutLine struct {
+	Timestamp string          `json:"timestamp"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// responseItem holds the fields this SDK reads from a `response_item` payload.
+type responseItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Input     string          `json:"input"`
+	CallID    string          `json:"call_id"`
+	Output    json.RawMessage `json:"output"`
+	Action    json.RawMessage `json:"action"`
+}
+
+func parseHistoryLine(line []byte) (HistoryEntry, bool) {
+	var rl rolloutLine
+	if err := json.Unmarshal(line, &rl); err != nil {
+		return HistoryEntry{}, false
+	}
+	e := HistoryEntry{Kind: EntryOther, Type: rl.Type, Payload: rl.Payload}
+	e.Time, _ = time.Parse(time.RFC3339Nano, rl.Timestamp)
+	if rl.Type != "response_item" {
+		return e, true
+	}
+	var item responseItem
+	if json.Unmarshal(rl.Payload, &item) != nil {
+		return e, true
+	}
+	e.Type = item.Type
+	switch item.Type {
+	case "message":
+		e.Role = item.Role
+		e.Text = contentText(item.Content)
+		switch {
+		case item.Role == "assistant":
+			e.Kind = EntryAssistantMessage
+		case item.Role == "user" && !isContextMessage(e.Text):
+			e.Kind = EntryUserMessage
+		default:
+			e.Kind = EntryContext
+		}
+	case "function_call":
+		e.Kind, e.CallID, e.Name, e.Input = EntryToolCall, item.CallID, item.Name, item.Arguments
+	case "custom_tool_call":
+		e.Kind, e.CallID, e.Name, e.Input = EntryToolCall, item.CallID, item.Name, item.Input
+	case "local_shell_call":
+		e.Kind, e.CallID, e.Name, e.Input = EntryToolCall, item.CallID, "local_shell", string(item.Action)
+	case "function_call_output", "custom_tool_call_output":
+		e.Kind, e.CallID, e.Text = EntryToolOutput, item.CallID, contentText(item.Output)
+	}
+	return e, true
+}
+
+// contentText joins the text of a message's content (or a tool output, which may also be a plain
+// string); images are left out.
+func contentText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &parts) != nil {
+		return ""
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// contextPrefixes start the user-role messages the host adds for the model (see EntryContext).
+var contextPrefixes = []string{
+	"<environment_context>",
+	"<user_instructions>",
+	"<turn_aborted>",
+	"<collaboration_mode>",
+	"<skill>",
+	"# agents.md instructions for ",
+}
+
+func isContextMessage(text string) bool {
+	lowered := strings.ToLower(strings.TrimSpace(text))
+	for _, prefix := range contextPrefixes {
+		if strings.HasPrefix(lowered, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRolloutOf reports whether name is `rollout-<timestamp><suffix>`. The timestamp must be all
+// that comes between, or session `s1` would find the file of session `other-s1`.
+func isRolloutOf(name, suffix string) bool {
+	stamp, ok := strings.CutPrefix(name, "rollout-")
+	if !ok {
+		return false
+	}
+	if stamp, ok = strings.CutSuffix(stamp, suffix); !ok {
+		return false
+	}
+	_, err := time.Parse("2006-01-02T15-04-05", stamp)
+	return err == nil
+}
+
+// findRollout finds the rollout file of a session under CODEX_HOME.
+func findRollout(session string) (string, error) {
+	if session == "" {
+		return "", fmt.Errorf("%w: the payload has no session id", ErrSessionHistoryNotFound)
+	}
+	codexHome := Environ().CodexHome
+	suffix := "-" + session + ".jsonl"
+	for _, sub := range []string{"sessions", "archived_sessions"} {
+		var found string
+		err := filepath.WalkDir(filepath.Join(codexHome, sub), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// A missing or unreadable directory just doesn't have the file.
+				return fs.SkipDir
+			}
+			if !d.IsDir() && isRolloutOf(d.Name(), suffix) {
+				found = path
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if found != "" {
+			return found, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no rollout file for session %s in %s", ErrSessionHistoryNotFound, session, codexHome)
+}
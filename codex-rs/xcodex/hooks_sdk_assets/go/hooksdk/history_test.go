@@ -0,0 +1,158 @@
+package hooksdk_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func loadHistory(t *testing.T, name string) *hooksdk.SessionHistory {
+	t.Helper()
+	h, err := hooksdk.LoadSessionHistoryFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestSessionHistoryEntries(t *testing.T) {
+	h := loadHistory(t, "rollout.jsonl")
+	if h.Skipped != 1 || h.Truncated {
+		t.Errorf("Skipped = %d, Truncated = %v; want the one bad line, not truncated", h.Skipped, h.Truncated)
+	}
+	var kinds []hooksdk.EntryKind
+	h.Each(func(e hooksdk.HistoryEntry) bool {
+		kinds = append(kinds, e.Kind)
+		return true
+	})
+	want := []hooksdk.EntryKind{
+		hooksdk.EntryOther, hooksdk.EntryContext, hooksdk.EntryContext, hooksdk.EntryUserMessage,
+		hooksdk.EntryOther, hooksdk.EntryOther, hooksdk.EntryToolCall, hooksdk.EntryToolOutput,
+		hooksdk.EntryToolCall, hooksdk.EntryToolCall, hooksdk.EntryToolOutput, hooksdk.EntryAssistantMessage,
+		hooksdk.EntryOther, hooksdk.EntryUserMessage, hooksdk.EntryToolCall,
+	}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("kinds =\n%v\nwant\n%v", kinds, want)
+	}
+
+	meta := h.Entries[0]
+	if meta.Type != "session_meta" || !meta.Time.Equal(time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)) || !strings.Contains(string(meta.Payload), `"cwd":"/work"`) {
+		t.Errorf("session_meta entry = %+v", meta)
+	}
+	if e := h.Entries[1]; e.Role != "developer" || e.Type != "message" {
+		t.Errorf("developer message = %+v", e)
+	}
+	if e := h.Entries[5]; e.Type != "reasoning" {
+		t.Errorf("reasoning entry = %+v", e)
+	}
+	if e := h.Entries[11]; e.Role != "assistant" || e.Text != "All tests pass." {
+		t.Errorf("assistant message = %+v", e)
+	}
+
+	// Each stops when fn returns false.
+	n := 0
+	h.Each(func(hooksdk.HistoryEntry) bool { n++; return n < 3 })
+	if n != 3 {
+		t.Errorf("Each ran fn %d times after it returned false, want 3", n)
+	}
+}
+
+func TestSessionHistoryConveniences(t *testing.T) {
+	h := loadHistory(t, "rollout.jsonl")
+	if msg, ok := h.LastUserMessage(); !ok || msg != "now commit\nwith a good message" {
+		t.Errorf("LastUserMessage() = %q, %v", msg, ok)
+	}
+	calls := h.ToolCalls()
+	want := []hooksdk.ToolCall{
+		{CallID: "call_1", Name: "shell", Input: `{"command":["go","test","./..."]}`, Output: "ok  \texample.com/pkg\t0.01s", HasOutput: true},
+		{CallID: "call_2", Name: "apply_patch", Input: "*** Begin Patch\n*** End Patch", Output: "Success.\nUpdated 0 files.", HasOutput: true},
+		{CallID: "call_3", Name: "local_shell", Input: `{"type":"exec","command":["ls"]}`},
+		{CallID: "call_4", Name: "shell", Input: `{"command":["git","commit"]}`},
+	}
+	for i := range calls {
+		calls[i].Time = time.Time{}
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("ToolCalls() =\n%+v\nwant\n%+v", calls, want)
+	}
+
+	empty := &hooksdk.SessionHistory{}
+	if _, ok := empty.LastUserMessage(); ok || empty.ToolCalls() != nil {
+		t.Error("an empty history has a user message or tool calls")
+	}
+}
+
+func TestSessionHistoryTruncated(t *testing.T) {
+	h := loadHistory(t, "rollout-truncated.jsonl")
+	complete := loadHistory(t, "rollout.jsonl")
+	if !h.Truncated || h.Skipped != 2 || !reflect.DeepEqual(h.Entries, complete.Entries) {
+		t.Errorf("Truncated = %v, Skipped = %d, %d entries; want the complete file's %d entries", h.Truncated, h.Skipped, len(h.Entries), len(complete.Entries))
+	}
+	// The call whose output was being written has none yet.
+	if calls := h.ToolCalls(); calls[len(calls)-1].HasOutput {
+		t.Errorf("last call = %+v", calls[len(calls)-1])
+	}
+
+	// A bad line that ends in a newline was written whole, and isn't a truncation.
+	h, err := hooksdk.ParseSessionHistory(strings.NewReader("{\"type\":\"turn_context\"}\n{bad\n"))
+	if err != nil || h.Truncated || h.Skipped != 1 || len(h.Entries) != 1 {
+		t.Errorf("ParseSessionHistory = %+v, %v", h, err)
+	}
+}
+
+// rolloutHome puts the rollout fixture in a CODEX_HOME sessions tree for session, under sub.
+func rolloutHome(t *testing.T, sub, session string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	dir := filepath.Join(home, sub, "2025", "05", "01")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", "rollout.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "rollout-2025-05-01T10-00-00-"+session+".jsonl")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSessionHistory(t *testing.T) {
+	for _, sub := range []string{"sessions", "archived_sessions"} {
+		path := rolloutHome(t, sub, "0196a1b2-0000-7000-8000-000000000001")
+		p := hooktest.UserPromptSubmit().WithSessionID("0196a1b2-0000-7000-8000-000000000001").With("transcript_path", "").Build()
+		h, err := hooksdk.LoadSessionHistory(p)
+		if err != nil || h.Path != path {
+			t.Errorf("%s: LoadSessionHistory = %v, %v; want %s", sub, h, err, path)
+		}
+	}
+
+	// transcript_path wins over the search.
+	rolloutHome(t, "sessions", "s1")
+	p := hooktest.UserPromptSubmit().WithSessionID("s1").With("transcript_path", filepath.Join("testdata", "rollout-truncated.jsonl")).Build()
+	if h, err := hooksdk.LoadSessionHistory(p); err != nil || !h.Truncated {
+		t.Errorf("LoadSessionHistory with transcript_path = %+v, %v", h, err)
+	}
+
+	// Another session's file, or a differently named one, isn't this session's.
+	rolloutHome(t, "sessions", "other-s1")
+	for _, session := range []string{"s1", ""} {
+		_, err := hooksdk.LoadSessionHistory(hooktest.UserPromptSubmit().WithSessionID(session).With("transcript_path", "").Build())
+		if !errors.Is(err, hooksdk.ErrSessionHistoryNotFound) {
+			t.Errorf("session %q: error = %v, want ErrSessionHistoryNotFound", session, err)
+		}
+	}
+	if _, err := hooksdk.LoadSessionHistoryFile(filepath.Join(t.TempDir(), "missing.jsonl")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: error = %v", err)
+	}
+}
@@ -0,0 +1,263 @@
+// Package hooklog writes structured diagnostics from hooks to stderr.
+//
+// Stdout is the response channel, so hooks must not print to it. hooklog emits one JSON object per
+// line on stderr, tagged with the hook name and invocation id and, once Bind is called, the event
+// type and session id:
+//
+//	payload, err := hooksdk.ReadPayload()
+//	...
+//	hooklog.Bind(payload)
+//	hooklog.Infof("processing %d files", n)
+//
+// CODEX_HOOK_LOG_LEVEL (debug, info, warn, error; default info) filters records, and
+// CODEX_HOOK_LOG_FORMAT=text switches to a human-readable format for interactive debugging (the
+// default when stderr is a terminal). The hook name is the executable's base name unless
+// CODEX_HOOK_NAME is set.
+package hooklog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/invocation"
+)
+
+// Level is the severity of a record.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel parses a level name (case-insensitive; "warning" is accepted for warn).
+func ParseLevel(s string) (Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, true
+	case "info":
+		return LevelInfo, true
+	case "warn", "warning":
+		return LevelWarn, true
+	case "error":
+		return LevelError, true
+	}
+	return LevelInfo, false
+}
+
+// Event is the part of a payload the logger attaches to records. *hooksdk.HookPayload implements
+// it.
+type Event interface {
+	EventType() string
+	SessionID() string
+}
+
+// Logger writes leveled records to an io.Writer. The zero value is not usable; use New.
+type Logger struct {
+	mu        sync.Mutex
+	w         io.Writer
+	level     Level
+	text      bool
+	hook      string
+	eventType string
+	sessionID string
+	// invocationID is the bound event's; "" tags records with the process's (see Log).
+	invocationID string
+}
+
+// New returns a logger writing to w, configured from CODEX_HOOK_LOG_LEVEL and
+// CODEX_HOOK_LOG_FORMAT. The hook name defaults to the executable's base name.
+func New(w io.Writer) *Logger {
+	l := &Logger{w: w, level: LevelInfo, hook: HookName()}
+	if lvl, ok := ParseLevel(os.Getenv("CODEX_HOOK_LOG_LEVEL")); ok {
+		l.level = lvl
+	}
+	switch strings.ToLower(os.Getenv("CODEX_HOOK_LOG_FORMAT")) {
+	case "text":
+		l.text = true
+	case "json":
+	default:
+		l.text = isTerminal(w)
+	}
+	return l
+}
+
+// Bind attaches the event type and session id of e to every later record, and its invocation id
+// when it has an InvocationID method, as *hooksdk.HookPayload does.
+func (l *Logger) Bind(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.eventType, l.sessionID = e.EventType(), e.SessionID()
+	l.invocationID = ""
+	if i, ok := e.(interface{ InvocationID() string }); ok {
+		l.invocationID = i.InvocationID()
+	}
+}
+
+// SetLevel sets the minimum level that is written.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// SetHookName overrides the hook name attached to records.
+func (l *Logger) SetHookName(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hook = name
+}
+
+// Enabled reports whether records at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level
+}
+
+// Log writes a record with extra fields (which must be JSON-encodable). Records carry the
+// `hook_invocation_id` of the bound event, or else of the event the process read on stdin.
+func (l *Logger) Log(level Level, msg string, fields map[string]any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level < l.level {
+		return
+	}
+
+	rec := map[string]any{
+		"ts":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level": level.String(),
+		"msg":   msg,
+	}
+	if l.hook != "" {
+		rec["hook"] = l.hook
+	}
+	if l.eventType != "" {
+		rec["event_type"] = l.eventType
+	}
+	if l.sessionID != "" {
+		rec["session_id"] = l.sessionID
+	}
+	id := l.invocationID
+	if id == "" {
+		id = invocation.Current()
+	}
+	if id != "" {
+		rec[invocation.Field] = id
+	}
+	for k, v := range fields {
+		rec[k] = v
+	}
+
+	if l.text {
+		l.writeText(level, msg, rec)
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"level": level.String(), "msg": msg, "log_error": err.Error()})
+	}
+	_, _ = l.w.Write(append(data, '\n'))
+}
+
+func (l *Logger) writeText(level Level, msg string, rec map[string]any) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-5s ", time.Now().Format("15:04:05.000"), strings.ToUpper(level.String()))
+	if l.hook != "" {
+		fmt.Fprintf(&b, "[%s", l.hook)
+		if l.eventType != "" {
+			fmt.Fprintf(&b, " %s", l.eventType)
+		}
+		b.WriteString("] ")
+	}
+	b.WriteString(msg)
+
+	keys := make([]string, 0, len(rec))
+	for k := range rec {
+		switch k {
+		case "ts", "level", "msg", "hook", "event_type", invocation.Field:
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%v", k, rec[k])
+	}
+	b.WriteByte('\n')
+	_, _ = io.WriteString(l.w, b.String())
+}
+
+func (l *Logger) Debugf(format string, args ...any) {
+	l.Log(LevelDebug, fmt.Sprintf(format, args...), nil)
+}
+func (l *Logger) Infof(format string, args ...any) {
+	l.Log(LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+func (l *Logger) Warnf(format string, args ...any) {
+	l.Log(LevelWarn, fmt.Sprintf(format, args...), nil)
+}
+func (l *Logger) Errorf(format string, args ...any) {
+	l.Log(LevelError, fmt.Sprintf(format, args...), nil)
+}
+
+var std = New(os.Stderr)
+
+// Default returns the package-level logger used by the top-level functions.
+func Default() *Logger { return std }
+
+// Bind attaches the event type and session id of e to records from the default logger.
+func Bind(e Event) { std.Bind(e) }
+
+// SetLevel sets the minimum level of the default logger.
+func SetLevel(level Level) { std.SetLevel(level) }
+
+func Log(level Level, msg string, fields map[string]any) { std.Log(level, msg, fields) }
+
+func Debugf(format string, args ...any) { std.Log(LevelDebug, fmt.Sprintf(format, args...), nil) }
+func Infof(format string, args ...any)  { std.Log(LevelInfo, fmt.Sprintf(format, args...), nil) }
+func Warnf(format string, args ...any)  { std.Log(LevelWarn, fmt.Sprintf(format, args...), nil) }
+func Errorf(format string, args ...any) { std.Log(LevelError, fmt.Sprintf(format, args...), nil) }
+
+// HookName returns the name records are attributed to: CODEX_HOOK_NAME, or else the executable's
+// base name (without ".exe").
+func HookName() string {
+	if name := os.Getenv("CODEX_HOOK_NAME"); name != "" {
+		return name
+	}
+	if len(os.Args) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,103 @@
+package hooklog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+type event struct{ eventType, sessionID string }
+
+func (e event) EventType() string { return e.eventType }
+func (e event) SessionID() string { return e.sessionID }
+
+func records(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var recs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("not a JSON record: %q", line)
+		}
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestLoggerJSON(t *testing.T) {
+	t.Setenv("CODEX_HOOK_NAME", "guard")
+	t.Setenv("CODEX_HOOK_LOG_FORMAT", "")
+	var out bytes.Buffer
+	l := hooklog.New(&out)
+	l.Infof("before %s", "bind")
+	l.Bind(event{"tool-call-started", "s1"})
+	l.Log(hooklog.LevelWarn, "slow", map[string]any{"ms": 1200})
+
+	recs := records(t, &out)
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	if r := recs[0]; r["msg"] != "before bind" || r["level"] != "info" || r["hook"] != "guard" || r["event_type"] != nil {
+		t.Errorf("first record = %v", r)
+	}
+	if r := recs[1]; r["level"] != "warn" || r["event_type"] != "tool-call-started" || r["session_id"] != "s1" || r["ms"] != 1200.0 {
+		t.Errorf("second record = %v", r)
+	}
+	if _, ok := recs[1]["ts"].(string); !ok {
+		t.Errorf("record has no timestamp: %v", recs[1])
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	t.Setenv("CODEX_HOOK_LOG_LEVEL", "warning")
+	t.Setenv("CODEX_HOOK_LOG_FORMAT", "json")
+	var out bytes.Buffer
+	l := hooklog.New(&out)
+	l.Debugf("hidden")
+	l.Infof("hidden")
+	l.Warnf("shown")
+	l.Errorf("shown")
+	if n := len(records(t, &out)); n != 2 {
+		t.Errorf("got %d records at CODEX_HOOK_LOG_LEVEL=warning, want 2:\n%s", n, out.String())
+	}
+
+	l.SetLevel(hooklog.LevelDebug)
+	if !l.Enabled(hooklog.LevelDebug) {
+		t.Errorf("debug is disabled after SetLevel(LevelDebug)")
+	}
+}
+
+func TestLoggerText(t *testing.T) {
+	t.Setenv("CODEX_HOOK_LOG_FORMAT", "text")
+	var out bytes.Buffer
+	l := hooklog.New(&out)
+	l.SetHookName("guard")
+	l.Bind(event{"session-end", "s1"})
+	l.Log(hooklog.LevelError, "failed", map[string]any{"path": "/tmp/x"})
+	got := out.String()
+	for _, want := range []string{"ERROR", "[guard session-end] failed", "path=/tmp/x", "session_id=s1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("text record %q doesn't contain %q", got, want)
+		}
+	}
+	if strings.Count(got, "\n") != 1 {
+		t.Errorf("text record %q isn't one line", got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]hooklog.Level{"debug": hooklog.LevelDebug, "INFO": hooklog.LevelInfo, "warning": hooklog.LevelWarn, "error": hooklog.LevelError} {
+		if got, ok := hooklog.ParseLevel(s); !ok || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v", s, got, ok)
+		}
+	}
+	if _, ok := hooklog.ParseLevel("loud"); ok {
+		t.Errorf("ParseLevel(loud) succeeded")
+	}
+}
@@ -9,70 +9,272 @@
 package hooksdk
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/invocation"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/term"
 )
 
+// HookPayloadJSON is an untyped hook payload. Numbers are json.Number values (use AsInt64 /
+// AsFloat64 to convert them) so large integers keep their precision.
 type HookPayloadJSON map[string]any
 
 // ReadPayload reads the hook payload for an external hook invocation and parses it into a typed
 // payload struct.
 //
 // Input: reads stdin. For large payloads, stdin is a small JSON envelope that
-// contains `payload_path`, which points to the full JSON payload file.
+// contains `payload_path`, which points to the full JSON payload file. When stdin is empty or a
+// terminal, the file named by CODEX_HOOK_PAYLOAD_PATH or the first argument is read instead.
 //
 // Output: returns the typed payload (and preserves the raw JSON object for forward compatibility).
-func ReadPayload() (*HookPayload, error) {
-	full, err := readFullPayloadBytes()
+func ReadPayload(opts ...Option) (*HookPayload, error) {
+	return readPayload(context.Background(), nil, opts)
+}
+
+// MustReadPayload is like ReadPayload, but panics if the payload can't be read. It is meant for
+// tiny hooks where crashing (and the resulting nonzero exit) is an acceptable way to fail.
+func MustReadPayload(opts ...Option) *HookPayload {
+	p, err := ReadPayload(opts...)
 	if err != nil {
-		return nil, err
+		panic("hooksdk: " + err.Error())
 	}
+	return p
+}
 
-	return ParseHookPayload(full)
+// ReadPayloadContext is like ReadPayload, but gives up with ctx.Err() when ctx is cancelled while
+// stdin or the payload_path file is still being read.
+//
+// Combine it with SignalContext so a hook stops cleanly when the host sends SIGTERM at its timeout.
+func ReadPayloadContext(ctx context.Context, opts ...Option) (*HookPayload, error) {
+	return readPayload(ctx, nil, opts)
+}
+
+// ReadPayloadFrom is like ReadPayload, but reads the stdin bytes (payload or envelope) from r.
+//
+// This is the entry point to use from tests: pass a strings.Reader/bytes.Buffer instead of
+// spawning the hook as a subprocess.
+func ReadPayloadFrom(r io.Reader, opts ...Option) (*HookPayload, error) {
+	return readPayload(context.Background(), r, opts)
 }
 
 // ReadPayloadJSON reads the hook payload for an external hook invocation and returns it as an
-// untyped map.
-func ReadPayloadJSON() (HookPayloadJSON, error) {
-	full, err := readFullPayloadBytes()
+// untyped map (with numbers decoded as json.Number, and a CBOR payload's byte strings as []byte;
+// see PayloadFormatCBOR). Of the options, those about reading the envelope and WithInvalidUTF8
+// apply.
+func ReadPayloadJSON(opts ...Option) (HookPayloadJSON, error) {
+	o := newOptions(opts)
+	o.capture = o.startCapture()
+	payload, err := readPayloadJSON(o)
+	o.capture.finish(nil, err)
+	return payload, err
+}
+
+func readPayloadJSON(o *options) (HookPayloadJSON, error) {
+	full, env, err := readFullPayloadBytes(context.Background(), o.stdio.in(), o)
 	if err != nil {
 		return nil, err
 	}
+	if env.decoded != nil {
+		return env.decoded, nil
+	}
+
+	if isBlank(full) {
+		return nil, ErrEmptyPayload
+	}
 
+	if full, err = o.fixUTF8(full); err != nil {
+		return nil, err
+	}
 	var payload HookPayloadJSON
-	if err := json.Unmarshal(full, &payload); err != nil {
+	if err := unmarshalUseNumber(full, &payload); err != nil {
 		return nil, err
 	}
 	return payload, nil
 }
 
-func readFullPayloadBytes() ([]byte, error) {
-	stdinBytes, err := os.ReadFile("/dev/stdin")
+// ReadPayloadRaw reads the hook payload like ReadPayloadJSON, but returns it as the bytes the host
+// sent instead of decoding it, for hooks that only forward the payload: keys keep their order and
+// numbers their formatting, and a large payload isn't held twice.
+//
+// The envelope is resolved as by ReadPayload (payload_path, payload_fd, inline payload, gzip,
+// checksum, signature). Only stdin is decoded, to tell an envelope from a bare payload; a
+// payload_path file is returned as read, except that a CBOR one is converted to JSON. Bytes that
+// aren't valid JSON fail with the decoding error.
+func ReadPayloadRaw(opts ...Option) (json.RawMessage, error) {
+	o := newOptions(opts)
+	o.capture = o.startCapture()
+	full, _, err := readFullPayloadBytes(context.Background(), o.stdio.in(), o)
+	if err == nil {
+		err = checkRawJSON(full)
+	}
+	o.capture.finish(nil, err)
 	if err != nil {
 		return nil, err
 	}
-	if len(stdinBytes) == 0 {
-		stdinBytes = []byte("{}")
+	return full, nil
+}
+
+// checkRawJSON returns ErrEmptyPayload for a blank payload, and the decoding error for one that
+// isn't valid JSON.
+func checkRawJSON(data []byte) error {
+	if isBlank(data) {
+		return ErrEmptyPayload
 	}
+	if json.Valid(data) {
+		return nil
+	}
+	// Valid says nothing about where the error is; Unmarshal does.
+	var v json.RawMessage
+	return json.Unmarshal(data, &v)
+}
+
+// readPayload reads the payload from r, or from the WithIO stdin (by default the process's) when r
+// is nil.
+func readPayload(ctx context.Context, r io.Reader, opts []Option) (*HookPayload, error) {
+	p, _, err := readPayloadEnvelope(ctx, r, opts)
+	return p, err
+}
 
-	var envelope map[string]any
-	if err := json.Unmarshal(stdinBytes, &envelope); err != nil {
-		// If stdin isn't JSON, treat it as the full payload.
-		return stdinBytes, nil
+func readPayloadEnvelope(ctx context.Context, r io.Reader, opts []Option) (*HookPayload, envelope, error) {
+	o := newOptions(opts)
+	if r == nil {
+		r = o.stdio.in()
+	}
+	full, env, err := o.readPayloadBytes(ctx, r)
+	if err != nil {
+		return nil, env, err
 	}
+	p, err := o.parsePayload(full, env, r, opts)
+	return p, env, err
+}
 
-	payloadPathAny, ok := envelope["payload_path"]
-	if !ok || payloadPathAny == nil {
-		payloadPathAny, ok = envelope["payload-path"]
+// readPayloadBytes reads the payload's bytes from r, resolving the envelope, for parsePayload. A
+// read that fails is finished here.
+func (o *options) readPayloadBytes(ctx context.Context, r io.Reader) ([]byte, envelope, error) {
+	o.capture = o.startCapture()
+	full, env, err := readFullPayloadBytes(ctx, r, o)
+	if err != nil {
+		o.capture.finish(nil, err)
 	}
-	if !ok || payloadPathAny == nil {
-		return stdinBytes, nil
+	return full, env, err
+}
+
+// parsePayload parses the payload readPayloadBytes read from r, finishing the read.
+func (o *options) parsePayload(full []byte, env envelope, r io.Reader, opts []Option) (*HookPayload, error) {
+	p, err := ParseHookPayload(full, env.parseOptions(opts)...)
+	if err == nil {
+		p.invocationID = env.invocationID
 	}
+	o.capture.finish(p, err)
+	if err == nil && r == io.Reader(os.Stdin) {
+		// WriteResponse checks the response against this event type's schema.
+		stdinEventType.Store(p.EventType())
+		// So does the telemetry EmitTelemetry logs.
+		stdinEventIDs.Store(eventIDs{sessionID: p.SessionID(), eventID: p.EventId, eventType: p.EventType()})
+	}
+	return p, err
+}
 
-	payloadPath, ok := payloadPathAny.(string)
-	if !ok || payloadPath == "" {
-		return nil, errors.New("invalid payload_path")
+func readFullPayloadBytes(ctx context.Context, r io.Reader, o *options) ([]byte, envelope, error) {
+	// Read via an io.Reader rather than `/dev/stdin` so this works on Windows and when stdin is a
+	// pipe that the host writes to incrementally, however slowly. A terminal is never read: that
+	// only happens when the hook is run by hand, and reading would block until ^D.
+	in, source, closeInput := payloadInput(r, o)
+	defer closeInput()
+	var stdinBytes []byte
+	terminal := isTerminal(in)
+	if !terminal {
+		var err error
+		stdinBytes, err = readAllLimit(ctx, in, o.maxPayloadBytes, source)
+		if err != nil {
+			return nil, envelope{}, err
+		}
 	}
-	return os.ReadFile(payloadPath)
+	o.capture.stdin(stdinBytes)
+
+	manual := false
+	if isBlank(stdinBytes) {
+		path := manualPayloadPath(r, o)
+		if path == "" && terminal {
+			return nil, envelope{}, fmt.Errorf("%w: stdin is a terminal; pipe an event to the hook, pass an event file as the first argument, or set %s", ErrNoPayload, PayloadPathEnv)
+		}
+		if path != "" {
+			envelopeBytes, err := json.Marshal(map[string]string{"payload_path": path})
+			if err != nil {
+				return nil, envelope{}, err
+			}
+			stdinBytes, manual = envelopeBytes, true
+		}
+	}
+
+	payload, env, err := parseEnvelope(ctx, stdinBytes, o)
+	if env.invocationID == "" {
+		env.invocationID = invocation.New()
+	}
+	if r == io.Reader(os.Stdin) {
+		// WriteResponse has no payload to look at, so remember where this process should respond,
+		// and hooklog and webhook which invocation this is.
+		stdinOutputPath.Store(env.outputPath)
+		stdinCapabilities.Store(env.capabilities)
+		invocation.SetCurrent(env.invocationID)
+	}
+	if err == nil && env.format == PayloadFormatCBOR {
+		env.decoded, payload, err = o.decodeCBOR(payload)
+		if err != nil && env.payloadPath != "" {
+			err = fmt.Errorf("payload_path %s: %w", env.payloadPath, err)
+		}
+	}
+	if err != nil {
+		return nil, env, err
+	}
+	o.capture.payload(payload, env)
+	// Never delete a file the user pointed at by hand.
+	if env.payloadPath != "" && !manual && (env.cleanup || o.cleanupPayloadFile) {
+		removePayloadFile(env.payloadPath)
+	}
+	return payload, env, nil
+}
+
+// payloadInput returns what to read the payload or envelope from: r, or for the process's stdin
+// the PayloadFDEnv descriptor when it is open, with its name for errors and a func that closes it.
+func payloadInput(r io.Reader, o *options) (in io.Reader, source string, close func()) {
+	if r == io.Reader(os.Stdin) {
+		if fd := o.stdio.Environ().PayloadFD; fd > 0 {
+			f, err := openPayloadFD(fd)
+			if err != nil {
+				hooklog.Debugf("%v; reading stdin", err)
+			} else {
+				return f, f.Name(), func() { f.Close() }
+			}
+		}
+	}
+	return r, "stdin", func() {}
+}
+
+// PayloadPathEnv names a payload file to read when stdin is empty or a terminal, for running a
+// hook by hand (e.g. `CODEX_HOOK_PAYLOAD_PATH=/tmp/event.json ./myhook`).
+const PayloadPathEnv = "CODEX_HOOK_PAYLOAD_PATH"
+
+// manualPayloadPath returns the payload file to read when stdin has nothing: PayloadPathEnv, then
+// the first command-line argument (only when r is the process's stdin, so `./myhook event.json`
+// works).
+func manualPayloadPath(r io.Reader, o *options) string {
+	if path := o.stdio.Environ().PayloadPath; path != "" {
+		return path
+	}
+	if r == io.Reader(os.Stdin) && len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		return os.Args[1]
+	}
+	return ""
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	return ok && term.IsTerminal(f)
 }
@@ -0,0 +1,416 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// TestMain lets the tests run this binary as a hook: with HOOKSDK_TEST_READ_STDIN set, it reads
+// the payload from its real stdin with ReadPayload and prints the session id; with
+// HOOKSDK_TEST_HOLD_LOCK set, it takes that WithLock lock, says so on stdout, and holds it until it
+// is killed; with HOOKSDK_TEST_LOG_REQUESTS, HOOKSDK_TEST_DETACH, HOOKSDK_TEST_SLOW,
+// HOOKSDK_TEST_PAYLOAD_FD, HOOKSDK_TEST_MAIN or HOOKSDK_TEST_CODEX_HOME set, it runs
+// logRequestsMain, detachMain, slowMain, payloadFDMain, multiMain or codexHomeMain.
+func TestMain(m *testing.M) {
+	if d := os.Getenv("HOOKSDK_TEST_SLOW"); d != "" {
+		slowMain(d)
+		os.Exit(0)
+	}
+	if marker := os.Getenv("HOOKSDK_TEST_DETACH"); marker != "" {
+		detachMain(marker)
+		os.Exit(0)
+	}
+	if os.Getenv("HOOKSDK_TEST_MAIN") != "" {
+		multiMain()
+	}
+	if os.Getenv("HOOKSDK_TEST_PAYLOAD_FD") != "" {
+		payloadFDMain()
+	}
+	if mode := os.Getenv("HOOKSDK_TEST_LOG_REQUESTS"); mode != "" {
+		logRequestsMain(mode)
+	}
+	if os.Getenv("HOOKSDK_TEST_TELEMETRY") != "" {
+		telemetryMain()
+	}
+	if os.Getenv("HOOKSDK_TEST_CAPABILITIES") != "" {
+		capabilitiesMain()
+	}
+	if os.Getenv("HOOKSDK_TEST_SELF_TEST") != "" {
+		selfTestMain()
+	}
+	if os.Getenv("HOOKSDK_TEST_REPORT") != "" {
+		reportMain()
+	}
+	if os.Getenv("HOOKSDK_TEST_INVOCATION") != "" {
+		invocationMain()
+	}
+	if os.Getenv("HOOKSDK_TEST_CODEX_HOME") != "" {
+		codexHomeMain()
+	}
+	if os.Getenv("HOOKSDK_TEST_READ_STDIN") != "" {
+		p, err := hooksdk.ReadPayload()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Print(p.SessionID())
+		os.Exit(0)
+	}
+	if name := os.Getenv("HOOKSDK_TEST_HOLD_LOCK"); name != "" {
+		err := hooksdk.WithLock(name, 0, func() error {
+			fmt.Println("locked")
+			time.Sleep(time.Hour)
+			return nil
+		})
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// readStdin runs this test binary as a hook with stdin, and returns its output.
+func readStdin(t *testing.T, stdin *os.File) (string, error) {
+	t.Helper()
+	return runHookProcess(t, stdin, "", "-test.run=^$")
+}
+
+// runHookProcess runs this test binary as a hook with stdin, CODEX_HOOK_PAYLOAD_PATH set to
+// payloadPath, and args, and returns its output.
+func runHookProcess(t *testing.T, stdin *os.File, payloadPath string, args ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "HOOKSDK_TEST_READ_STDIN=1", "CODEX_HOME="+t.TempDir(), hooksdk.PayloadPathEnv+"="+payloadPath)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, stderr.String())
+	}
+	return string(out), nil
+}
+
+func TestReadPayloadPipedStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	go func() {
+		// Written in pieces, as a host streaming a payload does.
+		payload := hooktest.SessionStart().WithSessionID("piped").Bytes()
+		for len(payload) > 0 {
+			n := min(7, len(payload))
+			w.Write(payload[:n])
+			payload = payload[n:]
+		}
+		w.Close()
+	}()
+	got, err := readStdin(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "piped" {
+		t.Errorf("session id = %q, want piped", got)
+	}
+}
+
+func TestReadPayloadClosedStdin(t *testing.T) {
+	// Stdin that is at EOF right away reads as an empty payload, `{}`.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	defer r.Close()
+	got, err := readStdin(t, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "" {
+		t.Errorf("session id = %q, want none", got)
+	}
+
+	// A descriptor that can't be read fails rather than hangs.
+	r.Close()
+	if _, err := hooksdk.ReadPayloadFrom(r); err == nil {
+		t.Errorf("ReadPayloadFrom(closed file) succeeded")
+	}
+}
+
+func TestReadPayloadPathEnvelopeStdin(t *testing.T) {
+	envelope := hooktest.WriteEnvelope(t, hooktest.ToolCallFinished().WithSessionID("from-file").Bytes())
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(envelope); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readStdin(t, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "from-file" {
+		t.Errorf("session id = %q, want from-file", got)
+	}
+}
+
+func TestReadPayloadFrom(t *testing.T) {
+	payload := hooktest.ToolCallStarted().WithSessionID("s1").WithCommand("ls").Bytes()
+	tests := []struct {
+		name    string
+		stdin   []byte
+		session string
+	}{
+		{"inline JSON", payload, "s1"},
+		{"payload_path envelope", hooktest.WriteEnvelope(t, payload), "s1"},
+		{"empty stdin", nil, ""},
+	}
+	for _, tt := range tests {
+		p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(tt.stdin))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if p.SessionID() != tt.session {
+			t.Errorf("%s: session id = %q, want %q", tt.name, p.SessionID(), tt.session)
+		}
+	}
+}
+
+func TestReadPayloadFromMissingFile(t *testing.T) {
+	path := t.TempDir() + "/missing.json"
+	stdin, _ := json.Marshal(map[string]string{"payload_path": path})
+	_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithPayloadRetry(0))
+	if err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("error = %v, want one naming %s", err, path)
+	}
+}
+
+func TestReadPayloadFromNonJSON(t *testing.T) {
+	if _, err := hooksdk.ReadPayloadFrom(strings.NewReader("not json")); err == nil {
+		t.Errorf("ReadPayloadFrom(non-JSON) succeeded")
+	}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	payload := hooktest.SessionEnd().Bytes()
+	tests := []struct {
+		name     string
+		stdin    []byte
+		want     []byte
+		fromPath bool
+	}{
+		{"inline JSON", payload, payload, false},
+		{"payload_path", hooktest.WriteEnvelope(t, payload), payload, true},
+		{"empty", nil, []byte("{}"), false},
+		// Stdin that isn't JSON is passed on as the payload, for the parser to report.
+		{"non-JSON", []byte("not json"), []byte("not json"), false},
+	}
+	for _, tt := range tests {
+		got, fromPath, err := hooksdk.ParseEnvelope(tt.stdin)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(bytes.TrimSpace(got), bytes.TrimSpace(tt.want)) {
+			t.Errorf("%s: payload = %s, want %s", tt.name, got, tt.want)
+		}
+		if (fromPath != "") != tt.fromPath {
+			t.Errorf("%s: fromPath = %q", tt.name, fromPath)
+		}
+	}
+
+	path := t.TempDir() + "/missing.json"
+	stdin, _ := json.Marshal(map[string]string{"payload_path": path})
+	if _, _, err := hooksdk.ParseEnvelope(stdin); err == nil {
+		t.Errorf("ParseEnvelope(missing file) succeeded")
+	}
+}
+
+// eventFile writes a payload with the given session id to a temp file and returns its path.
+func eventFile(t *testing.T, session string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), session+".json")
+	if err := os.WriteFile(path, hooktest.SessionStart().WithSessionID(session).Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// stdinFile returns a file to use as stdin holding data.
+func stdinFile(t *testing.T, data []byte) *os.File {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestReadPayloadManualPathPrecedence(t *testing.T) {
+	fromEnv, fromArg := eventFile(t, "env"), eventFile(t, "argv")
+	piped := hooktest.SessionStart().WithSessionID("stdin").Bytes()
+	tests := []struct {
+		name    string
+		stdin   []byte
+		envPath string
+		args    []string
+		want    string
+	}{
+		{"stdin over env and argv", piped, fromEnv, []string{fromArg}, "stdin"},
+		{"env over argv", nil, fromEnv, []string{fromArg}, "env"},
+		{"argv", nil, "", []string{fromArg}, "argv"},
+		// A flag is not a payload file.
+		{"flag", nil, "", []string{"-test.run=^$"}, ""},
+	}
+	for _, tt := range tests {
+		got, err := runHookProcess(t, stdinFile(t, tt.stdin), tt.envPath, tt.args...)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: session id = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadPayloadFromPayloadPathEnv(t *testing.T) {
+	path := eventFile(t, "env")
+	env := map[string]string{hooksdk.PayloadPathEnv: path}
+	stdio := hooksdk.IO{Getenv: func(k string) string { return env[k] }}
+	p, err := hooksdk.ReadPayloadFrom(strings.NewReader(""), hooksdk.WithIO(stdio), hooksdk.WithCleanupPayloadFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SessionID() != "env" {
+		t.Errorf("session id = %q, want env", p.SessionID())
+	}
+	// A file the user named by hand is never cleaned up.
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("the payload file is gone: %v", err)
+	}
+}
+
+// rawPayload has keys out of order and numbers that decoding would reformat.
+const rawPayload = `{"xcodex_event_type":"session-start","zeta":1.50,"alpha":1e3,"big":12345678901234567890,"session_id":"raw"}`
+
+func readRaw(t *testing.T, stdin []byte) string {
+	t.Helper()
+	stdio, _, _ := testIO(stdin, nil)
+	raw, err := hooksdk.ReadPayloadRaw(hooksdk.WithIO(stdio))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func TestReadPayloadRaw(t *testing.T) {
+	file := rawPayload + "\n"
+	if got := readRaw(t, pathEnvelope(t, "payload.json", []byte(file), nil)); got != file {
+		t.Errorf("payload_path = %q, want the file's bytes", got)
+	}
+	gz := pathEnvelope(t, "payload.json.gz", gzipBytes(t, []byte(file)), map[string]any{"payload_encoding": "gzip"})
+	if got := readRaw(t, gz); got != file {
+		t.Errorf("gzip payload_path = %q, want the file's bytes", got)
+	}
+	if got := readRaw(t, []byte(rawPayload)); got != rawPayload {
+		t.Errorf("bare stdin = %q", got)
+	}
+	if got := readRaw(t, []byte(`{"payload": `+rawPayload+`}`)); got != rawPayload {
+		t.Errorf("inline payload = %q", got)
+	}
+
+	for name, stdin := range map[string][]byte{
+		"blank":    []byte(" \n"),
+		"not JSON": pathEnvelope(t, "payload.json", []byte(`{"a":`), nil),
+		"missing":  []byte(`{"payload_path": "` + filepath.Join(t.TempDir(), "gone.json") + `"}`),
+	} {
+		stdio, _, _ := testIO(stdin, nil)
+		if raw, err := hooksdk.ReadPayloadRaw(hooksdk.WithIO(stdio)); err == nil {
+			t.Errorf("%s: ReadPayloadRaw = %q, want an error", name, raw)
+		}
+	}
+}
+
+func TestParseWithRawJSON(t *testing.T) {
+	p, err := hooksdk.ParseHookPayload([]byte(rawPayload), hooksdk.WithRawJSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p.RawJSON()) != rawPayload || p.SessionID() != "raw" {
+		t.Errorf("RawJSON = %q", p.RawJSON())
+	}
+	if p, _ := hooksdk.ParseHookPayload([]byte(rawPayload)); p.RawJSON() != nil {
+		t.Errorf("RawJSON without WithRawJSON = %q", p.RawJSON())
+	}
+}
+
+// bigPayloadEnvelope writes a payload of about 5 MB and returns the envelope pointing at it.
+func bigPayloadEnvelope(b *testing.B) []byte {
+	lines := make([]string, 50000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d of the tool's output, padded to about a hundred bytes .....................", i)
+	}
+	payload := hooktest.ToolCallFinished().With("output_lines", lines).Bytes()
+	path := filepath.Join(b.TempDir(), "payload.json")
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		b.Fatal(err)
+	}
+	stdin, _ := json.Marshal(map[string]string{"payload_path": path})
+	b.SetBytes(int64(len(payload)))
+	return stdin
+}
+
+func BenchmarkReadPayloadRaw(b *testing.B) {
+	stdin := bigPayloadEnvelope(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stdio, _, _ := testIO(stdin, nil)
+		if _, err := hooksdk.ReadPayloadRaw(hooksdk.WithIO(stdio)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadPayloadJSONMarshal is what a forwarder did before ReadPayloadRaw: decode, then
+// encode again.
+func BenchmarkReadPayloadJSONMarshal(b *testing.B) {
+	stdin := bigPayloadEnvelope(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stdio, _, _ := testIO(stdin, nil)
+		p, err := hooksdk.ReadPayloadJSON(hooksdk.WithIO(stdio))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := json.Marshal(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
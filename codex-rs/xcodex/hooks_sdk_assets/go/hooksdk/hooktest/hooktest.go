@@ -0,0 +1,347 @@
+// Package hooktest provides payload fixtures and an in-process harness for testing hooks built with
+// hooksdk.
+//
+//	func TestDeniesRm(t *testing.T) {
+//		payload := hooktest.ApprovalRequested().WithCommand("rm -rf /").Bytes()
+//		res := hooktest.RunHook(t, handle, payload)
+//		if res.Response.Decision != hooksdk.DecisionDeny {
+//			t.Fatalf("expected deny, got %+v", res)
+//		}
+//	}
+package hooktest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/cbor"
+)
+
+// Builder assembles a hook payload as a JSON object. Start from one of the per-event
+// constructors (e.g. ToolCallStarted) so required fields are already populated.
+type Builder struct {
+	fields map[string]any
+}
+
+// New returns a builder for an arbitrary event type with the fields every payload carries.
+func New(eventType, hookEventName string) *Builder {
+	if hookEventName == "" {
+		hookEventName = eventType
+	}
+	return &Builder{fields: map[string]any{
+		"schema_version":    1,
+		"event_id":          "00000000-0000-0000-0000-000000000001",
+		"timestamp":         "2025-01-01T00:00:00Z",
+		"session_id":        "test-session",
+		"transcript_path":   "",
+		"permission_mode":   "default",
+		"hook_event_name":   hookEventName,
+		"xcodex_event_type": eventType,
+		"cwd":               "/tmp/project",
+	}}
+}
+
+// With sets (or overrides) a top-level field. A nil value removes the field.
+func (b *Builder) With(key string, value any) *Builder {
+	if value == nil {
+		delete(b.fields, key)
+		return b
+	}
+	b.fields[key] = value
+	return b
+}
+
+func (b *Builder) WithSessionID(id string) *Builder { return b.With("session_id", id) }
+
+func (b *Builder) WithCwd(cwd string) *Builder { return b.With("cwd", cwd) }
+
+func (b *Builder) WithToolName(name string) *Builder { return b.With("tool_name", name) }
+
+// WithCommand sets the shell command in the shape the host uses for the event: an argv array in
+// `command` for approval requests, and `tool_input.command` for tool call events.
+func (b *Builder) WithCommand(command string) *Builder {
+	if b.fields["xcodex_event_type"] == "approval-requested" {
+		argv := strings.Fields(command)
+		b.fields["command"] = argv
+		b.fields["tool_input"] = map[string]any{"command": argv}
+		return b
+	}
+	b.fields["tool_input"] = map[string]any{"command": command}
+	return b
+}
+
+// Map returns a copy of the payload fields.
+func (b *Builder) Map() map[string]any {
+	out := make(map[string]any, len(b.fields))
+	for k, v := range b.fields {
+		out[k] = v
+	}
+	return out
+}
+
+// Legacy returns a copy of the payload in the shape of schema version 0, from before
+// `schema_version`: no version field, `type` and `thread-id` for the event type and session id,
+// and kebab-case keys. ParseHookPayload migrates it back to the same typed payload as b.
+func (b *Builder) Legacy() *Builder {
+	out := &Builder{fields: make(map[string]any, len(b.fields))}
+	for k, v := range b.fields {
+		switch k {
+		case "schema_version":
+			continue
+		case "xcodex_event_type":
+			k = "type"
+		case "session_id":
+			k = "thread-id"
+		default:
+			k = strings.ReplaceAll(k, "_", "-")
+		}
+		out.fields[k] = v
+	}
+	return out
+}
+
+// Bytes returns the payload as JSON.
+func (b *Builder) Bytes() []byte {
+	data, err := json.Marshal(b.fields)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// CBOR returns the payload as CBOR, for a payload file read with `"payload_format": "cbor"` (see
+// WriteCBOREnvelope). Values set as []byte are byte strings, where Bytes has base64 strings.
+func (b *Builder) CBOR() []byte {
+	data, err := cbor.Encode(b.fields)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// Build parses the payload with hooksdk.ParseHookPayload.
+func (b *Builder) Build() *hooksdk.HookPayload {
+	p, err := hooksdk.ParseHookPayload(b.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func AgentTurnComplete() *Builder {
+	return New("agent-turn-complete", "Stop").
+		With("turn_id", "turn-1").
+		With("input_messages", []string{"fix the tests"}).
+		With("last_assistant_message", "Done.")
+}
+
+func ApprovalRequested() *Builder {
+	return New("approval-requested", "PermissionRequest").
+		With("turn_id", "turn-1").
+		With("kind", "exec").
+		With("call_id", "call-1").
+		With("reason", "needs network access").
+		With("tool_name", "Bash").
+		With("tool_use_id", "call-1").
+		With("tool_response", json.RawMessage("null")).
+		WithCommand("curl https://example.com")
+}
+
+func SessionStart() *Builder {
+	return New("session-start", "SessionStart").With("session_source", "cli")
+}
+
+func SessionEnd() *Builder {
+	return New("session-end", "SessionEnd").With("session_source", "cli")
+}
+
+func UserPromptSubmit() *Builder {
+	return New("user-prompt-submit", "UserPromptSubmit").With("prompt", "fix the tests")
+}
+
+func PreCompact() *Builder {
+	return New("pre-compact", "PreCompact").With("trigger", "auto")
+}
+
+func Notification() *Builder {
+	return New("notification", "Notification").
+		With("notification_type", "idle").
+		With("message", "waiting for input").
+		With("title", "xcodex")
+}
+
+func SubagentStop() *Builder {
+	return New("subagent-stop", "SubagentStop").
+		With("tool_name", "Task").
+		With("subagent", "review").
+		With("status", "completed")
+}
+
+func ModelRequestStarted() *Builder {
+	return New("model-request-started", "").
+		With("turn_id", "turn-1").
+		With("model_request_id", "req-1").
+		With("attempt", 1).
+		With("model", "gpt-5").
+		With("provider", "openai").
+		With("input_item_count", 3).
+		With("tool_count", 5).
+		With("parallel_tool_calls", true).
+		With("has_output_schema", false)
+}
+
+func ModelResponseCompleted() *Builder {
+	return New("model-response-completed", "").
+		With("turn_id", "turn-1").
+		With("model_request_id", "req-1").
+		With("attempt", 1).
+		With("response_id", "resp-1").
+		With("token_usage", map[string]any{
+			"input_tokens":            1200,
+			"cached_input_tokens":     800,
+			"output_tokens":           300,
+			"reasoning_output_tokens": 100,
+			"total_tokens":            1500,
+		}).
+		With("needs_follow_up", false)
+}
+
+func ToolCallStarted() *Builder {
+	return New("tool-call-started", "PreToolUse").
+		With("turn_id", "turn-1").
+		With("model_request_id", "req-1").
+		With("attempt", 1).
+		With("tool_name", "Bash").
+		With("tool_use_id", "call-1").
+		With("tool_response", json.RawMessage("null")).
+		WithCommand("go test ./...")
+}
+
+func ToolCallFinished() *Builder {
+	return New("tool-call-finished", "PostToolUse").
+		With("turn_id", "turn-1").
+		With("model_request_id", "req-1").
+		With("attempt", 1).
+		With("tool_name", "Bash").
+		With("tool_use_id", "call-1").
+		WithCommand("go test ./...").
+		With("tool_response", map[string]any{"stdout": "ok\n"}).
+		With("status", "completed").
+		With("duration_ms", 1234).
+		With("success", true).
+		With("output_bytes", 3).
+		With("output_preview", "ok\n")
+}
+
+// Fixtures returns a builder for every event type the host emits, keyed by `xcodex_event_type`.
+func Fixtures() map[string]*Builder {
+	return map[string]*Builder{
+		"agent-turn-complete":      AgentTurnComplete(),
+		"approval-requested":       ApprovalRequested(),
+		"session-start":            SessionStart(),
+		"session-end":              SessionEnd(),
+		"user-prompt-submit":       UserPromptSubmit(),
+		"pre-compact":              PreCompact(),
+		"notification":             Notification(),
+		"subagent-stop":            SubagentStop(),
+		"model-request-started":    ModelRequestStarted(),
+		"model-response-completed": ModelResponseCompleted(),
+		"tool-call-started":        ToolCallStarted(),
+		"tool-call-finished":       ToolCallFinished(),
+	}
+}
+
+// WriteEnvelope writes payload to a temp file and returns the small stdin envelope the host sends
+// for large payloads (carrying `payload_path`).
+func WriteEnvelope(t testing.TB, payload []byte) []byte {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		t.Fatalf("hooktest: write payload file: %v", err)
+	}
+
+	envelope := map[string]any{"payload_path": path}
+	var fields map[string]any
+	if err := json.Unmarshal(payload, &fields); err == nil {
+		for _, key := range []string{"schema_version", "event_id", "timestamp", "hook_event_name", "xcodex_event_type"} {
+			if v, ok := fields[key]; ok {
+				envelope[key] = v
+			}
+		}
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("hooktest: marshal envelope: %v", err)
+	}
+	return data
+}
+
+// WriteCBOREnvelope writes payload, CBOR (see Builder.CBOR), to a temp file and returns the stdin
+// envelope naming it with `"payload_format": "cbor"`.
+func WriteCBOREnvelope(t testing.TB, payload []byte) []byte {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "payload.cbor")
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		t.Fatalf("hooktest: write payload file: %v", err)
+	}
+	data, err := json.Marshal(map[string]any{"payload_path": path, "payload_format": hooksdk.PayloadFormatCBOR})
+	if err != nil {
+		t.Fatalf("hooktest: marshal envelope: %v", err)
+	}
+	return data
+}
+
+// SignedEnvelope returns a stdin envelope carrying payload inline with its `signature` under
+// secret, for testing hooks that use hooksdk.RequireSignature (set hooksdk.SecretEnv with t.Setenv).
+func SignedEnvelope(t testing.TB, payload []byte, secret string) []byte {
+	t.Helper()
+
+	// Marshal compacts the inline payload, so sign it compacted.
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, payload); err != nil {
+		t.Fatalf("hooktest: payload is not JSON: %v", err)
+	}
+	data, err := json.Marshal(map[string]any{
+		"payload":   json.RawMessage(compact.Bytes()),
+		"signature": hooksdk.SignPayload(secret, compact.Bytes()),
+	})
+	if err != nil {
+		t.Fatalf("hooktest: marshal envelope: %v", err)
+	}
+	return data
+}
+
+// Result captures what a hook run produced.
+type Result struct {
+	// Response is the decoded stdout response (zero if stdout was empty or not a response).
+	Response hooksdk.Response
+	ExitCode int
+	Stdout   string
+	Stderr   string
+}
+
+// RunHook runs handler through hooksdk.RunIO with stdin (a payload or an envelope from
+// WriteEnvelope) and captures the response and exit code.
+func RunHook(t testing.TB, handler hooksdk.Handler, stdin []byte, opts ...hooksdk.Option) Result {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := hooksdk.RunIO(context.Background(), bytes.NewReader(stdin), &stdout, &stderr, handler, opts...)
+
+	res := Result{ExitCode: code, Stdout: stdout.String(), Stderr: stderr.String()}
+	if out := bytes.TrimSpace(stdout.Bytes()); len(out) > 0 {
+		if err := json.Unmarshal(out, &res.Response); err != nil {
+			t.Fatalf("hooktest: stdout is not a response: %v\n%s", err, out)
+		}
+	}
+	return res
+}
@@ -0,0 +1,71 @@
+package hooktest_test
+
+import (
+	"context"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestFixturesCoverEveryEventType(t *testing.T) {
+	fixtures := hooktest.Fixtures()
+	for _, et := range hooksdk.AllEventTypes() {
+		b, ok := fixtures[string(et)]
+		if !ok {
+			t.Errorf("no fixture for %q", et)
+			continue
+		}
+		// Strict, so a field the fixture has and the SDK doesn't know is schema drift.
+		p, err := hooksdk.ParseHookPayload(b.Bytes(), hooksdk.WithStrictFields())
+		if err != nil {
+			t.Errorf("%s: %v", et, err)
+			continue
+		}
+		if p.Type() != et {
+			t.Errorf("%s fixture has type %q", et, p.Type())
+		}
+	}
+	if len(fixtures) != len(hooksdk.AllEventTypes()) {
+		t.Errorf("%d fixtures for %d event types", len(fixtures), len(hooksdk.AllEventTypes()))
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	b := hooktest.ToolCallStarted().WithSessionID("s1").WithCommand("rm -rf /")
+	p := b.Build()
+	if p.SessionID() != "s1" {
+		t.Errorf("session id = %q, want s1", p.SessionID())
+	}
+
+	m := b.Map()
+	m["session_id"] = "changed"
+	if b.Build().SessionID() != "s1" {
+		t.Errorf("changing Map's result changed the builder")
+	}
+
+	if _, ok := b.With("cwd", nil).Map()["cwd"]; ok {
+		t.Errorf("With(cwd, nil) didn't remove cwd")
+	}
+
+	argv := hooktest.ApprovalRequested().WithCommand("git push origin").Build().Command
+	if len(argv) != 3 || argv[0] != "git" {
+		t.Errorf("approval command = %q, want an argv", argv)
+	}
+}
+
+func TestRunHookWithEnvelope(t *testing.T) {
+	payload := hooktest.SessionStart().WithSessionID("from-file").Bytes()
+	var got string
+	handler := func(_ context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		got = p.SessionID()
+		return hooksdk.Deny("no"), nil
+	}
+	res := hooktest.RunHook(t, handler, hooktest.WriteEnvelope(t, payload))
+	if got != "from-file" {
+		t.Errorf("handler got session %q, want from-file", got)
+	}
+	if res.ExitCode != hooksdk.ExitDeny || res.Response.Decision != hooksdk.DecisionDeny || res.Response.Reason != "no" {
+		t.Errorf("result = %+v, want the deny", res)
+	}
+}
@@ -0,0 +1,48 @@
+// Package atomicfile replaces files whole, for the small state files hooks rewrite on every
+// event: a crash or a concurrent reader sees the old file or the new one, never half of either.
+package atomicfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile replaces the file at path with data, as os.WriteFile would but atomically: data is
+// written to a new file in the same directory and synced, and that file is renamed over path.
+// Writers that race each leave a whole file, the last one renamed. perm is the mode of the new
+// file, whatever the old one had.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// WriteJSON replaces the file at path with v encoded as by json.Marshal, readable by everyone
+// (0644) like the state files it is for.
+func WriteJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return WriteFile(path, data, 0o644)
+}
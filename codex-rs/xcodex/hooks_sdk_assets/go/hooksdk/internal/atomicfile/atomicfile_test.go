@@ -0,0 +1,71 @@
+package atomicfile_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/atomicfile"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	for _, data := range []string{"first", "second, longer", "3"} {
+		if err := atomicfile.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := os.ReadFile(path); err != nil || string(got) != data {
+			t.Errorf("after writing %q: %q, %v", data, got, err)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || runtime.GOOS != "windows" && info.Mode().Perm() != 0o644 {
+		t.Errorf("mode = %v, %v; want 0644", info.Mode(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("files left beside the state: %v", entries)
+	}
+
+	// A failed write leaves the old file and no temporary one.
+	if err := atomicfile.WriteFile(filepath.Join(path, "under-a-file"), nil, 0o644); err == nil {
+		t.Error("WriteFile under a file succeeded")
+	}
+	if err := atomicfile.WriteJSON(path, func() {}); err == nil {
+		t.Error("WriteJSON of a func succeeded")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "3" {
+		t.Errorf("after failed writes: %q", got)
+	}
+}
+
+func TestWriteFileConcurrent(t *testing.T) {
+	// Writers that race never leave a mix of their data, or their temporary files.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := atomicfile.WriteJSON(path, map[string]string{"writer": strings.Repeat(fmt.Sprint(i%10), 4096)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digits := strings.Trim(string(data), `{"writer:}`)
+	if len(digits) != 4096 || strings.Count(digits, digits[:1]) != 4096 {
+		t.Errorf("state is a mix of writers: %.40q...", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("files left beside the state: %v", entries)
+	}
+}
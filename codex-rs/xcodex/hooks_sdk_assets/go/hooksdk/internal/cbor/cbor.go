@@ -0,0 +1,461 @@
+// Package cbor decodes and encodes CBOR (RFC 8949) data items as the values encoding/json works
+// with, for payload files the host writes in CBOR: maps with text keys are map[string]any, arrays
+// []any, text strings string, byte strings []byte, and numbers json.Number, so integers of any
+// size keep their precision. It supports what a JSON-shaped document needs and no more: tags are
+// skipped (bignums, tags 2 and 3, become numbers), and simple values other than false, true,
+// null, and undefined (nil), NaN, and infinities are errors.
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// maxDepth bounds the nesting of arrays, maps, and tags Decode follows.
+const maxDepth = 10000
+
+// Major types.
+const (
+	majorUint = iota
+	majorNegInt
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+// indefinite is the additional information of an indefinite-length string, array, or map.
+const indefinite = 31
+
+// breakByte ends the items of an indefinite-length value.
+const breakByte = 0xff
+
+// Decode decodes the one data item data holds.
+func Decode(data []byte) (any, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(data) {
+		return nil, fmt.Errorf("cbor: %d bytes after the data item", len(data)-d.off)
+	}
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+var errTruncated = errors.New("cbor: unexpected end of data")
+
+func (d *decoder) byte() (byte, error) {
+	if d.off >= len(d.data) {
+		return 0, errTruncated
+	}
+	b := d.data[d.off]
+	d.off++
+	return b, nil
+}
+
+// head reads the initial byte of a data item and the argument after it; for an
+// indefinite-length item, arg is 0 and indef is set.
+func (d *decoder) head() (major byte, info byte, arg uint64, indef bool, err error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	major, info = b>>5, b&0x1f
+	switch {
+	case info < 24:
+		return major, info, uint64(info), false, nil
+	case info <= 27:
+		n := 1 << (info - 24)
+		if len(d.data)-d.off < n {
+			return 0, 0, 0, false, errTruncated
+		}
+		buf := d.data[d.off : d.off+n]
+		d.off += n
+		switch n {
+		case 1:
+			arg = uint64(buf[0])
+		case 2:
+			arg = uint64(binary.BigEndian.Uint16(buf))
+		case 4:
+			arg = uint64(binary.BigEndian.Uint32(buf))
+		default:
+			arg = binary.BigEndian.Uint64(buf)
+		}
+		return major, info, arg, false, nil
+	case info == indefinite && (major == majorBytes || major == majorText || major == majorArray || major == majorMap || major == majorSimple):
+		return major, info, 0, true, nil
+	}
+	return 0, 0, 0, false, fmt.Errorf("cbor: malformed initial byte 0x%02x at offset %d", b, d.off-1)
+}
+
+// count returns n as a length, which must fit in what is left of the data at min bytes an item.
+func (d *decoder) count(n uint64, min int) (int, error) {
+	if n > uint64(len(d.data)-d.off)/uint64(min) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, errors.New("cbor: nested too deeply")
+	}
+	start := d.off
+	major, info, arg, indef, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		return json.Number(strconv.FormatUint(arg, 10)), nil
+	case majorNegInt:
+		return negative(new(big.Int).SetUint64(arg)), nil
+	case majorBytes, majorText:
+		b, err := d.str(major, arg, indef)
+		if err != nil {
+			return nil, err
+		}
+		if major == majorText {
+			return string(b), nil
+		}
+		return b, nil
+	case majorArray:
+		n, err := d.count(arg, 1)
+		if err != nil {
+			return nil, err
+		}
+		a := make([]any, 0, n)
+		for i := 0; indef || i < n; i++ {
+			if indef && d.atBreak() {
+				break
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case majorMap:
+		n, err := d.count(arg, 2)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]any, n)
+		for i := 0; indef || i < n; i++ {
+			if indef && d.atBreak() {
+				break
+			}
+			keyAt := d.off
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("cbor: map key at offset %d is not a text string", keyAt)
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		}
+		return m, nil
+	case majorTag:
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := v.([]byte); ok && (arg == 2 || arg == 3) {
+			n := new(big.Int).SetBytes(b)
+			if arg == 3 {
+				return negative(n), nil
+			}
+			return json.Number(n.String()), nil
+		}
+		return v, nil
+	}
+
+	// majorSimple
+	switch {
+	case indef:
+		return nil, fmt.Errorf("cbor: unexpected break at offset %d", start)
+	case info == 25:
+		return number(halfFloat(uint16(arg)), start)
+	case info == 26:
+		return number(float64(math.Float32frombits(uint32(arg))), start)
+	case info == 27:
+		return number(math.Float64frombits(arg), start)
+	}
+	switch arg {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d at offset %d", arg, start)
+}
+
+// atBreak consumes the break that ends an indefinite-length item, if it is next.
+func (d *decoder) atBreak() bool {
+	if d.off < len(d.data) && d.data[d.off] == breakByte {
+		d.off++
+		return true
+	}
+	return false
+}
+
+// str reads the bytes of a byte or text string; an indefinite-length one is the concatenation of
+// its chunks, definite-length strings of the same major type.
+func (d *decoder) str(major byte, arg uint64, indef bool) ([]byte, error) {
+	if !indef {
+		n, err := d.count(arg, 1)
+		if err != nil {
+			return nil, err
+		}
+		// Never nil: an empty byte string is "" in JSON, not null.
+		b := append([]byte{}, d.data[d.off:d.off+n]...)
+		d.off += n
+		return b, nil
+	}
+	b := []byte{}
+	for !d.atBreak() {
+		at := d.off
+		m, _, n, chunkIndef, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m != major || chunkIndef {
+			return nil, fmt.Errorf("cbor: bad chunk of an indefinite-length string at offset %d", at)
+		}
+		chunk, err := d.str(major, n, false)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, chunk...)
+	}
+	return b, nil
+}
+
+// negative returns -1-n.
+func negative(n *big.Int) json.Number {
+	return json.Number(n.Neg(n).Sub(n, big.NewInt(1)).String())
+}
+
+func number(f float64, at int) (any, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("cbor: %v at offset %d has no JSON equivalent", f, at)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
+
+// halfFloat converts an IEEE 754 half-precision float.
+func halfFloat(h uint16) float64 {
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// Encode encodes v, a value of the kinds Decode returns (nil, bool, string, []byte, json.Number,
+// map[string]any, []any) or a Go number, bool, string, map with string keys, or slice, as
+// deterministic CBOR: shortest heads, definite lengths, and map keys sorted as RFC 8949 section
+// 4.2.1 says. A json.Number is an integer, of any size, when it looks like one, and else a float64;
+// a json.RawMessage is encoded as the value it holds.
+func Encode(v any) ([]byte, error) {
+	var e encoder
+	if err := e.value(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+var (
+	numberType     = reflect.TypeOf(json.Number(""))
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+)
+
+func (e *encoder) head(major byte, arg uint64) {
+	m := major << 5
+	switch {
+	case arg < 24:
+		e.buf = append(e.buf, m|byte(arg))
+	case arg <= math.MaxUint8:
+		e.buf = append(e.buf, m|24, byte(arg))
+	case arg <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, m|25), uint16(arg))
+	case arg <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, m|26), uint32(arg))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, m|27), arg)
+	}
+}
+
+func (e *encoder) value(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, majorSimple<<5|22)
+		return nil
+	}
+	switch v.Type() {
+	case numberType:
+		return e.number(json.Number(v.String()))
+	case rawMessageType:
+		// JSON held as it is, e.g. a fixture's literal `null`.
+		var decoded any
+		dec := json.NewDecoder(bytes.NewReader(v.Bytes()))
+		dec.UseNumber()
+		if err := dec.Decode(&decoded); err != nil {
+			return err
+		}
+		return e.value(reflect.ValueOf(decoded))
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			e.buf = append(e.buf, majorSimple<<5|22)
+			return nil
+		}
+		return e.value(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, majorSimple<<5|21)
+		} else {
+			e.buf = append(e.buf, majorSimple<<5|20)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(big.NewInt(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.head(majorUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return e.float(v.Float())
+	case reflect.String:
+		e.head(majorText, uint64(v.Len()))
+		e.buf = append(e.buf, v.String()...)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.head(majorBytes, uint64(len(b)))
+			e.buf = append(e.buf, b...)
+			return nil
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf = append(e.buf, majorSimple<<5|22)
+			return nil
+		}
+		e.head(majorArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cbor: unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			e.buf = append(e.buf, majorSimple<<5|22)
+			return nil
+		}
+		keys := v.MapKeys()
+		// Encoded keys sort by their bytes, so shorter text strings come first.
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := keys[i].String(), keys[j].String()
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return a < b
+		})
+		e.head(majorMap, uint64(len(keys)))
+		for _, k := range keys {
+			e.head(majorText, uint64(len(k.String())))
+			e.buf = append(e.buf, k.String()...)
+			if err := e.value(v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (e *encoder) number(n json.Number) error {
+	if i, ok := new(big.Int).SetString(string(n), 10); ok {
+		e.int(i)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("cbor: bad number %q", n)
+	}
+	return e.float(f)
+}
+
+// int encodes n as an integer, or a bignum past 64 bits.
+func (e *encoder) int(n *big.Int) {
+	major, tag := byte(majorUint), uint64(2)
+	if n.Sign() < 0 {
+		// -1-n
+		n = new(big.Int).Sub(new(big.Int).Neg(n), big.NewInt(1))
+		major, tag = majorNegInt, 3
+	}
+	if n.IsUint64() {
+		e.head(major, n.Uint64())
+		return
+	}
+	e.head(majorTag, tag)
+	b := n.Bytes()
+	e.head(majorBytes, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// float encodes f as a float64, or a float32 when that is exact.
+func (e *encoder) float(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("cbor: %v has no JSON equivalent", f)
+	}
+	if f32 := float32(f); float64(f32) == f {
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, majorSimple<<5|26), math.Float32bits(f32))
+		return nil
+	}
+	e.buf = binary.BigEndian.AppendUint64(append(e.buf, majorSimple<<5|27), math.Float64bits(f))
+	return nil
+}
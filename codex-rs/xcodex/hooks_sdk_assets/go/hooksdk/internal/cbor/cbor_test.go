@@ -0,0 +1,176 @@
+package cbor_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/cbor"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	// From RFC 8949, Appendix A, and the JSON-shaped values they decode to.
+	tests := []struct {
+		data string
+		want any
+	}{
+		{"00", json.Number("0")},
+		{"17", json.Number("23")},
+		{"1818", json.Number("24")},
+		{"1903e8", json.Number("1000")},
+		{"1a000f4240", json.Number("1000000")},
+		{"1bffffffffffffffff", json.Number("18446744073709551615")},
+		{"c249010000000000000000", json.Number("18446744073709551616")},
+		{"3bffffffffffffffff", json.Number("-18446744073709551616")},
+		{"c349010000000000000000", json.Number("-18446744073709551617")},
+		{"20", json.Number("-1")},
+		{"3903e7", json.Number("-1000")},
+		{"f90000", json.Number("0")},
+		{"f93c00", json.Number("1")},
+		{"f93e00", json.Number("1.5")},
+		{"f90001", json.Number("5.960464477539063e-08")},
+		{"f9c400", json.Number("-4")},
+		{"fa47c35000", json.Number("100000")},
+		{"fb3ff199999999999a", json.Number("1.1")},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f7", nil},
+		{"40", []byte{}},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"6449455446", "IETF"},
+		{"62c3bc", "ü"},
+		{"80", []any{}},
+		{"8301820203820405", []any{json.Number("1"), []any{json.Number("2"), json.Number("3")}, []any{json.Number("4"), json.Number("5")}}},
+		{"a0", map[string]any{}},
+		{"a26161016162820203", map[string]any{"a": json.Number("1"), "b": []any{json.Number("2"), json.Number("3")}}},
+		// Other tags are skipped.
+		{"c074323031332d30332d32315432303a30343a30305a", "2013-03-21T20:04:00Z"},
+		{"d82076687474703a2f2f7777772e6578616d706c652e636f6d", "http://www.example.com"},
+		// Indefinite lengths.
+		{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"9fff", []any{}},
+		{"9f018202039f0405ffff", []any{json.Number("1"), []any{json.Number("2"), json.Number("3")}, []any{json.Number("4"), json.Number("5")}}},
+		{"bf61610161629f0203ffff", map[string]any{"a": json.Number("1"), "b": []any{json.Number("2"), json.Number("3")}}},
+	}
+	for _, tt := range tests {
+		got, err := cbor.Decode(mustHex(t, tt.data))
+		if err != nil {
+			t.Errorf("Decode(%s): %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Decode(%s) = %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for data, want := range map[string]string{
+		"":                   "unexpected end",
+		"19":                 "unexpected end",
+		"62c3":               "unexpected end",
+		"9b7fffffffffffffff": "unexpected end", // a length larger than the data
+		"0102":               "after the data item",
+		"1c":                 "malformed initial byte",
+		"1f":                 "malformed initial byte",
+		"ff":                 "unexpected break",
+		"a10102":             "not a text string",
+		"f97e00":             "no JSON equivalent", // NaN
+		"f97c00":             "no JSON equivalent", // Infinity
+		"f0":                 "unsupported simple value",
+		"5f6161ff":           "bad chunk",
+		"9f01":               "unexpected end",
+	} {
+		if v, err := cbor.Decode(mustHex(t, data)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Decode(%s) = %v, %v; want an error saying %q", data, v, err, want)
+		}
+	}
+
+	// Nesting is bounded, so a deep document is an error and not a stack overflow.
+	deep := mustHex(t, strings.Repeat("81", 20000)+"00")
+	if _, err := cbor.Decode(deep); err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("deep nesting: %v", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	// Deterministic encoding: shortest heads, and map keys by length, then bytes.
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{nil, "f6"},
+		{true, "f5"},
+		{0, "00"},
+		{uint8(24), "1818"},
+		{-1000, "3903e7"},
+		{json.Number("18446744073709551615"), "1bffffffffffffffff"},
+		{json.Number("18446744073709551616"), "c249010000000000000000"},
+		{json.Number("-18446744073709551617"), "c349010000000000000000"},
+		{1.5, "fa3fc00000"},
+		{json.Number("1.1"), "fb3ff199999999999a"},
+		{json.Number("1e3"), "fa447a0000"},
+		{"IETF", "6449455446"},
+		{[]byte{1, 2}, "420102"},
+		{[]string{"a"}, "816161"},
+		{[]any(nil), "f6"},
+		{map[string]any{"bb": 1, "a": 2, "c": []any{}}, "a3616102616380626262" + "01"},
+		{map[string]int(nil), "f6"},
+		{json.RawMessage(`{"n":12345678901234567890}`), "a1616e1bab54a98ceb1f0ad2"},
+		{(*int)(nil), "f6"},
+	}
+	for _, tt := range tests {
+		got, err := cbor.Encode(tt.v)
+		if err != nil {
+			t.Errorf("Encode(%#v): %v", tt.v, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("Encode(%#v) = %x, want %s", tt.v, got, tt.want)
+		}
+	}
+
+	for _, v := range []any{
+		map[int]any{1: 2}, func() {}, json.Number("nope"), []any{1, make(chan int)},
+		json.RawMessage(`{`),
+	} {
+		if data, err := cbor.Encode(v); err == nil {
+			t.Errorf("Encode(%#v) = %x, want an error", v, data)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	v := map[string]any{
+		"big":   json.Number("-123456789012345678901234567890"),
+		"bytes": []byte("\x00\xff"),
+		"float": json.Number("0.1"),
+		"list":  []any{nil, true, "é", map[string]any{}},
+		"max":   json.Number("9007199254740993"),
+	}
+	data, err := cbor.Encode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cbor.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("round trip = %#v, want %#v", got, v)
+	}
+}
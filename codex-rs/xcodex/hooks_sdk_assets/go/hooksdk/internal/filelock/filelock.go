@@ -0,0 +1,92 @@
+// Package filelock provides advisory, cross-process exclusive locks on files.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrTimeout is returned (wrapped) by AcquireTimeout when the lock could not be taken in time.
+var ErrTimeout = errors.New("timed out waiting for file lock")
+
+// Lock is a held lock. Release it with Unlock.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire blocks until it holds an exclusive lock on path, creating the file if needed. The lock
+// file itself is left in place when the lock is released.
+func Acquire(path string) (*Lock, error) {
+	return AcquireTimeout(path, 0)
+}
+
+// AcquireTimeout is like Acquire but gives up after timeout with an error wrapping ErrTimeout.
+// A timeout <= 0 waits indefinitely.
+func AcquireTimeout(path string, timeout time.Duration) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		err = lock(f)
+	} else {
+		err = lockTimeout(f, timeout)
+	}
+	if err != nil {
+		f.Close()
+		if errors.Is(err, ErrTimeout) {
+			return nil, fmt.Errorf("%w: %s still held after %v", ErrTimeout, path, timeout)
+		}
+		return nil, err
+	}
+	return &Lock{f: f}, nil
+}
+
+// TryAcquire takes the lock on path if it is free, without waiting; ok is false when another
+// holder has it.
+func TryAcquire(path string) (l *Lock, ok bool, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok, err = tryLock(f); err != nil || !ok {
+		f.Close()
+		return nil, false, err
+	}
+	return &Lock{f: f}, true, nil
+}
+
+// lockTimeout polls tryLock with a growing backoff, so a waiter neither spins nor sleeps much
+// past the moment the holder releases the lock.
+func lockTimeout(f *os.File, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := time.Millisecond
+	for {
+		ok, err := tryLock(f)
+		if err != nil || ok {
+			return err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return ErrTimeout
+		}
+		if backoff > remaining {
+			backoff = remaining
+		}
+		time.Sleep(backoff)
+		if backoff < 50*time.Millisecond {
+			backoff *= 2
+		}
+	}
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	err := unlock(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
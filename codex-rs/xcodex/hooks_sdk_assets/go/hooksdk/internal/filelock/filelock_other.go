@@ -0,0 +1,13 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package filelock
+
+import "os"
+
+// Platforms without flock fall back to no locking; appends stay atomic via O_APPEND, but
+// concurrent log rotation may race.
+func lock(f *os.File) error { return nil }
+
+func tryLock(f *os.File) (bool, error) { return true, nil }
+
+func unlock(f *os.File) error { return nil }
@@ -0,0 +1,44 @@
+package filelock
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquireTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.lock")
+	held, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := TryAcquire(path); ok || err != nil {
+		t.Errorf("TryAcquire of a held lock = %v, %v; want false", ok, err)
+	}
+	_, err = AcquireTimeout(path, 20*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), path) {
+		t.Errorf("AcquireTimeout of a held lock: %v, want ErrTimeout naming %s", err, path)
+	}
+
+	// A waiter gets the lock soon after it is released.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		held.Unlock()
+	}()
+	l, err := AcquireTimeout(path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("AcquireTimeout after release: %v", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, ok, err := TryAcquire(path)
+	if !ok || err != nil {
+		t.Fatalf("TryAcquire of a free lock = %v, %v", ok, err)
+	}
+	l.Unlock()
+}
@@ -0,0 +1,553 @@
+// Command gen writes events_gen.go, the typed payload struct of each event type, from the JSON
+// Schemas in hooksdk/schemas. It runs from the hooksdk directory via go:generate:
+//
+//	go generate ./hooksdk
+//
+// With -check it writes nothing and exits 1 when events_gen.go differs from what the schemas
+// generate, so CI catches a schema change without the regenerated code.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+func main() {
+	schemas := flag.String("schemas", "schemas", "directory of the event schemas")
+	out := flag.String("out", "events_gen.go", "file to write")
+	check := flag.Bool("check", false, "fail if the file is out of date instead of writing it")
+	flag.Parse()
+
+	src, err := generate(*schemas)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gen: %v\n", err)
+		os.Exit(1)
+	}
+	if *check {
+		current, err := os.ReadFile(*out)
+		if err != nil || !bytes.Equal(current, src) {
+			fmt.Fprintf(os.Stderr, "gen: %s is out of date with %s; run `go generate ./hooksdk`\n", *out, *schemas)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type schema = map[string]any
+
+type event struct {
+	Type   string
+	Const  string
+	Struct string
+	Doc    string
+}
+
+type goStruct struct {
+	Name   string
+	Doc    string
+	Fields []goField
+	// checks are the statements of its checkFields method, computed once all structs are known.
+	checks  []string
+	checked bool
+}
+
+type goField struct {
+	Name, Type, Key, Doc string
+	// Optional fields are pointers (unless the type already has a zero value meaning absent: a
+	// slice, map, or any); they get a Get accessor.
+	Optional bool
+	schema   any
+}
+
+type generator struct {
+	// defs are the definitions of every schema, which must agree where names repeat.
+	defs    map[string]any
+	structs map[string]*goStruct
+	order   []string
+}
+
+func generate(dir string) ([]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no schemas in %s", dir)
+	}
+	sort.Strings(paths)
+
+	g := &generator{defs: map[string]any{}, structs: map[string]*goStruct{}}
+	var events []event
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var root schema
+		if err := json.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		eventType := strings.TrimSuffix(filepath.Base(path), ".json")
+		if props, _ := root["properties"].(schema); props != nil {
+			if tag, _ := props["xcodex_event_type"].(schema); tag["const"] != nil && tag["const"] != eventType {
+				return nil, fmt.Errorf("%s: xcodex_event_type is %v, not %q", path, tag["const"], eventType)
+			}
+		}
+		defs, _ := root["definitions"].(schema)
+		for name, def := range defs {
+			if prev, ok := g.defs[name]; ok && !reflect.DeepEqual(prev, def) {
+				return nil, fmt.Errorf("%s: definition %s differs from another schema's", path, name)
+			}
+			g.defs[name] = def
+		}
+		ev := event{
+			Type:   eventType,
+			Const:  "Event" + camelCase(eventType),
+			Struct: camelCase(eventType) + "Payload",
+		}
+		ev.Doc = fmt.Sprintf("%s is the payload of `%s` events.", ev.Struct, eventType)
+		if desc, _ := root["description"].(string); desc != "" {
+			ev.Doc += " " + desc
+		}
+		if err := g.addStruct(ev.Struct, ev.Doc, root); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		events = append(events, ev)
+	}
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by hooksdk/internal/gen from schemas/*.json. DO NOT EDIT.\n\n")
+	b.WriteString("package hooksdk\n\n")
+	b.WriteString("// The event types this SDK has schemas for.\nconst (\n")
+	for _, ev := range events {
+		fmt.Fprintf(&b, "\t%s EventType = %q\n", ev.Const, ev.Type)
+	}
+	b.WriteString(")\n\n")
+	b.WriteString("// knownEventTypes lists the event types this SDK knows about, sorted. Newer hosts may send\n")
+	b.WriteString("// additional types; HookPayload still parses those (see ParseHookPayloadStrict for the opposite\n")
+	b.WriteString("// behavior).\nvar knownEventTypes = []EventType{\n")
+	for _, ev := range events {
+		fmt.Fprintf(&b, "\t%s,\n", ev.Const)
+	}
+	b.WriteString("}\n")
+	for _, name := range g.order {
+		g.writeStruct(&b, g.structs[name])
+	}
+	b.WriteString("\n// Event decodes the payload into the struct of its event type, such as *ToolCallFinishedPayload.\n")
+	b.WriteString("// Payloads of event types this SDK has no schema for come back as an *UnknownPayload.\n")
+	b.WriteString("func (p *HookPayload) Event() (Event, error) {\n\tswitch p.Type() {\n")
+	for _, ev := range events {
+		fmt.Fprintf(&b, "\tcase %s:\n\t\tt := &%s{}\n\t\tif err := decodeRaw(p.RawPayload, t); err != nil {\n\t\t\treturn nil, err\n\t\t}\n", ev.Const, ev.Struct)
+		fmt.Fprintf(&b, "\t\tt.RawPayload, t.XcodexEventType = p.RawPayload, %s\n\t\treturn t, nil\n", ev.Const)
+	}
+	b.WriteString("\t}\n\treturn &UnknownPayload{RawPayload: p.RawPayload, XcodexEventType: p.Type()}, nil\n}\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format: %w\n%s", err, b.Bytes())
+	}
+	return src, nil
+}
+
+// addStruct records a named struct for an object schema, with a field per property.
+func (g *generator) addStruct(name, doc string, s schema) error {
+	if _, ok := g.structs[name]; ok {
+		return nil
+	}
+	st := &goStruct{Name: name, Doc: doc}
+	g.structs[name] = st
+	g.order = append(g.order, name)
+
+	props, _ := s["properties"].(schema)
+	required := map[string]bool{}
+	if list, ok := s["required"].([]any); ok {
+		for _, r := range list {
+			if key, ok := r.(string); ok {
+				required[key] = true
+			}
+		}
+	}
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		typ, nullable, err := g.goType(props[key], name+camelCase(key))
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		f := goField{Name: camelCase(key), Type: typ, Key: key, schema: props[key]}
+		if key == "xcodex_event_type" && typ == "string" {
+			f.Type = "EventType"
+		}
+		if sub, ok := props[key].(schema); ok {
+			f.Doc, _ = sub["description"].(string)
+		}
+		if (!required[key] || nullable) && !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") && typ != "any" {
+			f.Type, f.Optional = "*"+f.Type, true
+		}
+		st.Fields = append(st.Fields, f)
+	}
+	return nil
+}
+
+// goType maps a schema to a Go type, reporting whether it also allows null. Object schemas with
+// properties become named structs: definitions under their own name, inline objects (and the
+// items of arrays of objects) under name.
+func (g *generator) goType(v any, name string) (string, bool, error) {
+	s, ok := v.(schema)
+	if !ok {
+		return "any", false, nil
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		defName, ok := strings.CutPrefix(ref, "#/definitions/")
+		def, found := g.defs[defName]
+		if !ok || !found {
+			return "", false, fmt.Errorf("unresolved $ref %q", ref)
+		}
+		return g.goType(def, defName)
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf"} {
+		alts, ok := s[key].([]any)
+		if !ok {
+			continue
+		}
+		// One alternative plus null (an Option in the host) is that alternative's type;
+		// alternatives of one primitive type (an enum spelled as oneOf) are that type; anything
+		// else, such as a tagged union of objects, is left as any.
+		var rest []any
+		nullable := false
+		for _, alt := range alts {
+			if sub, ok := alt.(schema); ok && sub["type"] == "null" {
+				nullable = true
+			} else {
+				rest = append(rest, alt)
+			}
+		}
+		if len(rest) == 0 {
+			return "any", nullable, nil
+		}
+		if len(rest) > 1 {
+			kind := g.kind(rest[0])
+			for _, alt := range rest[1:] {
+				if g.kind(alt) != kind {
+					kind = ""
+				}
+			}
+			if kind == "" || kind == "object" || kind == "array" {
+				return "any", nullable, nil
+			}
+		}
+		t, null, err := g.goType(rest[0], name)
+		return t, nullable || null, err
+	}
+	if c, ok := s["const"]; ok {
+		return constType(c), false, nil
+	}
+
+	var types []string
+	nullable := false
+	switch t := s["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+	}
+	var nonNull []string
+	for _, t := range types {
+		if t == "null" {
+			nullable = true
+		} else {
+			nonNull = append(nonNull, t)
+		}
+	}
+	if len(nonNull) != 1 {
+		return "any", nullable, nil
+	}
+	switch nonNull[0] {
+	case "string":
+		return "string", nullable, nil
+	case "boolean":
+		return "bool", nullable, nil
+	case "number":
+		return "float64", nullable, nil
+	case "integer":
+		if f, _ := s["format"].(string); f == "int64" || f == "uint64" {
+			return "int64", nullable, nil
+		}
+		return "int", nullable, nil
+	case "array":
+		item, itemNull, err := g.goType(s["items"], name+"Item")
+		if err != nil {
+			return "", false, err
+		}
+		if itemNull && item != "any" && !strings.HasPrefix(item, "[]") && !strings.HasPrefix(item, "map[") {
+			item = "*" + item
+		}
+		return "[]" + item, nullable, nil
+	case "object":
+		if props, _ := s["properties"].(schema); len(props) > 0 {
+			doc := name + " is an object nested in event payloads."
+			if desc, _ := s["description"].(string); desc != "" {
+				doc = name + ": " + desc
+			}
+			if err := g.addStruct(name, doc, s); err != nil {
+				return "", false, err
+			}
+			return name, nullable, nil
+		}
+		return "map[string]any", nullable, nil
+	}
+	return "any", nullable, nil
+}
+
+// checkLines returns the statements checking st's fields against their schemas. Nested structs
+// are checked through their own checkFields.
+func (g *generator) checkLines(st *goStruct) []string {
+	if st.checked {
+		return st.checks
+	}
+	st.checked = true
+	for _, f := range st.Fields {
+		s := g.resolve(f.schema)
+		ptr := fmt.Sprintf("ptr+%q", "/"+strings.ReplaceAll(strings.ReplaceAll(f.Key, "~", "~0"), "/", "~1"))
+		elem := strings.TrimPrefix(f.Type, "*")
+		val := "p." + f.Name
+		if f.Optional {
+			val = "*" + val
+		}
+		var lines []string
+		switch {
+		case elem == "string":
+			if n, _ := s["minLength"].(float64); n >= 1 {
+				lines = append(lines, fmt.Sprintf("c.nonEmpty(%s, %s)", ptr, val))
+			}
+			if values := g.enumValues(f.schema); len(values) > 0 {
+				quoted := make([]string, len(values))
+				for i, v := range values {
+					quoted[i] = fmt.Sprintf("%q", v)
+				}
+				lines = append(lines, fmt.Sprintf("c.oneOf(%s, %s, %s)", ptr, val, strings.Join(quoted, ", ")))
+			}
+		case elem == "int" || elem == "int64":
+			if min, ok := s["minimum"].(float64); ok {
+				lines = append(lines, fmt.Sprintf("c.atLeast(%s, int64(%s), %d)", ptr, val, int64(min)))
+			}
+		case g.structs[elem] != nil:
+			if len(g.checkLines(g.structs[elem])) > 0 {
+				lines = append(lines, fmt.Sprintf("p.%s.checkFields(c, %s)", f.Name, ptr))
+			}
+		case strings.HasPrefix(elem, "[]"):
+			item := g.structs[strings.TrimPrefix(elem[2:], "*")]
+			if item != nil && len(g.checkLines(item)) > 0 {
+				call := fmt.Sprintf("p.%s[i].checkFields(c, itemPointer(%s, i))", f.Name, ptr)
+				if strings.HasPrefix(elem, "[]*") {
+					call = fmt.Sprintf("if p.%s[i] != nil {\n\t\t\t%s\n\t\t}", f.Name, call)
+				}
+				lines = append(lines, fmt.Sprintf("for i := range p.%s {\n\t\t%s\n\t}", f.Name, call))
+			}
+		}
+		if f.Optional && len(lines) > 0 {
+			lines = []string{fmt.Sprintf("if p.%s != nil {\n\t\t%s\n\t}", f.Name, strings.Join(lines, "\n\t\t"))}
+		}
+		st.checks = append(st.checks, lines...)
+	}
+	return st.checks
+}
+
+// resolve follows a $ref, and picks the non-null alternative of `anyOf: [X, null]`.
+func (g *generator) resolve(v any) schema {
+	s, _ := v.(schema)
+	if ref, ok := s["$ref"].(string); ok {
+		return g.resolve(g.defs[strings.TrimPrefix(ref, "#/definitions/")])
+	}
+	if alts, ok := s["anyOf"].([]any); ok && len(alts) == 2 {
+		for _, alt := range alts {
+			if sub, _ := alt.(schema); sub != nil && sub["type"] != "null" {
+				return g.resolve(sub)
+			}
+		}
+	}
+	return s
+}
+
+// enumValues returns the strings an enum (or a oneOf/anyOf of enums, plus null) allows, or nil.
+func (g *generator) enumValues(v any) []string {
+	s, _ := v.(schema)
+	if ref, ok := s["$ref"].(string); ok {
+		return g.enumValues(g.defs[strings.TrimPrefix(ref, "#/definitions/")])
+	}
+	if enum, ok := s["enum"].([]any); ok {
+		var out []string
+		for _, e := range enum {
+			str, ok := e.(string)
+			if !ok {
+				return nil
+			}
+			out = append(out, str)
+		}
+		return out
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		alts, ok := s[key].([]any)
+		if !ok {
+			continue
+		}
+		var out []string
+		for _, alt := range alts {
+			if sub, _ := alt.(schema); sub != nil && sub["type"] == "null" {
+				continue
+			}
+			values := g.enumValues(alt)
+			if values == nil {
+				return nil
+			}
+			out = append(out, values...)
+		}
+		return out
+	}
+	return nil
+}
+
+// kind is the single JSON type s allows (besides null), or "".
+func (g *generator) kind(v any) string {
+	s, ok := v.(schema)
+	if !ok {
+		return ""
+	}
+	if ref, ok := s["$ref"].(string); ok {
+		return g.kind(g.defs[strings.TrimPrefix(ref, "#/definitions/")])
+	}
+	if c, ok := s["const"]; ok {
+		return constType(c)
+	}
+	switch t := s["type"].(type) {
+	case string:
+		return t
+	case []any:
+		kind := ""
+		for _, item := range t {
+			if name, _ := item.(string); name != "null" {
+				if kind != "" {
+					return ""
+				}
+				kind = name
+			}
+		}
+		return kind
+	}
+	return ""
+}
+
+func constType(c any) string {
+	switch c.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case float64:
+		return "float64"
+	}
+	return "any"
+}
+
+func (g *generator) writeStruct(b *bytes.Buffer, st *goStruct) {
+	fmt.Fprintf(b, "\n%s\ntype %s struct {\n", comment(st.Doc, ""), st.Name)
+	if strings.HasSuffix(st.Name, "Payload") {
+		b.WriteString("\tRawPayload map[string]any `json:\"-\"`\n")
+	}
+	for _, f := range st.Fields {
+		if f.Doc != "" {
+			b.WriteString(comment(f.Doc, "\t") + "\n")
+		}
+		fmt.Fprintf(b, "\t%s %s `json:\"%s\"`\n", f.Name, f.Type, f.Key)
+	}
+	b.WriteString("}\n")
+	if event, ok := strings.CutSuffix(st.Name, "Payload"); ok {
+		fmt.Fprintf(b, "\n// Type returns Event%s.\n", event)
+		fmt.Fprintf(b, "func (p *%s) Type() EventType { return Event%s }\n", st.Name, event)
+		b.WriteString("\n// Raw returns the full decoded payload object. It is not a copy; see Clone.\n")
+		fmt.Fprintf(b, "func (p *%s) Raw() map[string]any { return p.RawPayload }\n", st.Name)
+		b.WriteString("\n// Clone returns a deep copy of p, including RawPayload (see HookPayload.Clone).\n")
+		fmt.Fprintf(b, "func (p *%s) Clone() *%s { return cloneStruct(p) }\n", st.Name, st.Name)
+	}
+	if checks := g.checkLines(st); len(checks) > 0 {
+		fmt.Fprintf(b, "\nfunc (p *%s) checkFields(c *fieldChecks, ptr string) {\n\t%s\n}\n",
+			st.Name, strings.Join(checks, "\n\t"))
+	}
+	if strings.HasSuffix(st.Name, "Payload") {
+		b.WriteString("\n// Validate checks the fields the schema of this event type constrains: required strings must\n")
+		b.WriteString("// not be empty, enums must have one of their values, and counts must not be negative. It\n")
+		b.WriteString("// returns a *SchemaError listing every problem, or nil.\n")
+		fmt.Fprintf(b, "func (p *%s) Validate() error {\n\tvar c fieldChecks\n", st.Name)
+		if len(g.checkLines(st)) > 0 {
+			b.WriteString("\tp.checkFields(&c, \"\")\n")
+		}
+		b.WriteString("\treturn c.err(p.Type())\n}\n")
+	}
+	for _, f := range st.Fields {
+		if !f.Optional {
+			continue
+		}
+		elem := strings.TrimPrefix(f.Type, "*")
+		zero := "var zero " + elem + "\n\t\treturn zero"
+		switch elem {
+		case "string":
+			zero = `return ""`
+		case "bool":
+			zero = "return false"
+		case "int", "int64", "float64":
+			zero = "return 0"
+		}
+		fmt.Fprintf(b, "\n// Get%s returns %s, or its zero value when it is absent.\n", f.Name, f.Key)
+		fmt.Fprintf(b, "func (p *%s) Get%s() %s {\n\tif p == nil || p.%s == nil {\n\t\t%s\n\t}\n\treturn *p.%s\n}\n",
+			st.Name, f.Name, elem, f.Name, zero, f.Name)
+	}
+}
+
+// camelCase turns `tool_use_id` or `tool-call-started` into ToolUseId or ToolCallStarted, the
+// names hooks_go_types.rs gives HookPayload's fields.
+func camelCase(s string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '_' || r == '-' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// comment wraps text into `//` lines of at most 100 columns; blank lines separate paragraphs.
+func comment(text, indent string) string {
+	var lines []string
+	for i, para := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		if i > 0 {
+			lines = append(lines, indent+"//")
+		}
+		line := indent + "//"
+		for _, word := range strings.Fields(para) {
+			if len(line)+1+len(word) > 100 && line != indent+"//" {
+				lines = append(lines, line)
+				line = indent + "//"
+			}
+			line += " " + word
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
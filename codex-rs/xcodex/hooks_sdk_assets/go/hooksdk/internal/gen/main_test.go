@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEventsGenIsCurrent(t *testing.T) {
+	src, err := generate(filepath.Join("..", "..", "schemas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := os.ReadFile(filepath.Join("..", "..", "events_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, current) {
+		t.Fatal("hooksdk/events_gen.go is out of date with hooksdk/schemas; run `go generate ./hooksdk`")
+	}
+}
+
+// schemaDir writes schemas, by file name, to a temporary directory.
+func schemaDir(t *testing.T, schemas map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range schemas {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// structFields parses generated source and returns each struct's fields and their types.
+func structFields(t *testing.T, src []byte) map[string]map[string]string {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "events_gen.go", src, 0)
+	if err != nil {
+		t.Fatalf("generated code doesn't parse: %v\n%s", err, src)
+	}
+	out := map[string]map[string]string{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		if st, ok := spec.Type.(*ast.StructType); ok {
+			fields := map[string]string{}
+			for _, field := range st.Fields.List {
+				for _, name := range field.Names {
+					fields[name.Name] = types.ExprString(field.Type)
+				}
+			}
+			out[spec.Name.Name] = fields
+		}
+		return true
+	})
+	return out
+}
+
+const widgetSchema = `{
+  "description": "A widget was made.",
+  "type": "object",
+  "required": ["xcodex_event_type", "name", "size", "parts", "owner"],
+  "properties": {
+    "xcodex_event_type": {"const": "widget-made"},
+    "name": {"type": "string", "description": "The widget's name."},
+    "count": {"type": "integer", "format": "uint32"},
+    "bytes": {"type": "integer", "format": "uint64"},
+    "size": {"type": ["integer", "null"]},
+    "ratio": {"type": "number"},
+    "done": {"type": "boolean"},
+    "tags": {"type": ["array", "null"], "items": {"type": "string"}},
+    "parts": {"type": "array", "items": {"type": "object", "properties": {"part_id": {"type": "string"}}, "required": ["part_id"]}},
+    "owner": {"$ref": "#/definitions/Person"},
+    "backup_owner": {"anyOf": [{"$ref": "#/definitions/Person"}, {"type": "null"}]},
+    "mode": {"oneOf": [{"type": "string", "enum": ["a"]}, {"type": "string", "enum": ["b"]}]},
+    "shape": {"oneOf": [{"type": "object", "properties": {"kind": {"const": "x"}}}, {"type": "object", "properties": {"kind": {"const": "y"}}}]},
+    "meta": {"type": "object"},
+    "anything": true
+  },
+  "definitions": {
+    "Person": {"type": "object", "required": ["login"], "properties": {"login": {"type": "string"}}}
+  }
+}`
+
+func TestGenerateTypes(t *testing.T) {
+	dir := schemaDir(t, map[string]string{
+		"widget-made.json": widgetSchema,
+		// A second schema sharing the definition, which must agree.
+		"gadget-lost.json": `{"type": "object", "required": ["xcodex_event_type"], "properties": {"xcodex_event_type": {"const": "gadget-lost"}, "by": {"$ref": "#/definitions/Person"}},
+		  "definitions": {"Person": {"type": "object", "required": ["login"], "properties": {"login": {"type": "string"}}}}}`,
+	})
+	src, err := generate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := structFields(t, src)
+	want := map[string]map[string]string{
+		"WidgetMadePayload": {
+			"RawPayload":      "map[string]any",
+			"XcodexEventType": "EventType",
+			"Name":            "string",
+			"Count":           "*int",
+			"Bytes":           "*int64",
+			// Required but nullable: a pointer too.
+			"Size":  "*int",
+			"Ratio": "*float64",
+			"Done":  "*bool",
+			// Slices, maps, and any already have a zero value meaning absent.
+			"Tags":        "[]string",
+			"Parts":       "[]WidgetMadePayloadPartsItem",
+			"Owner":       "Person",
+			"BackupOwner": "*Person",
+			"Mode":        "*string",
+			"Shape":       "any",
+			"Meta":        "map[string]any",
+			"Anything":    "any",
+		},
+		"WidgetMadePayloadPartsItem": {"PartId": "string"},
+		"Person":                     {"Login": "string"},
+		"GadgetLostPayload":          {"RawPayload": "map[string]any", "XcodexEventType": "EventType", "By": "*Person"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("structs =\n%v\nwant\n%v", got, want)
+	}
+
+	text := string(src)
+	for _, line := range []string{
+		"// Code generated by hooksdk/internal/gen from schemas/*.json. DO NOT EDIT.",
+		`EventWidgetMade EventType = "widget-made"`,
+		"// WidgetMadePayload is the payload of `widget-made` events. A widget was made.",
+		"\t// The widget's name.\n\tName ",
+		"func (p *WidgetMadePayload) GetCount() int {",
+		"func (p *WidgetMadePayload) GetBackupOwner() Person {",
+		"case EventWidgetMade:\n\t\tt := &WidgetMadePayload{}",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("generated code lacks %q", line)
+		}
+	}
+	// The schemas are read in name order, whatever the directory listing's.
+	if strings.Index(text, "EventGadgetLost EventType") > strings.Index(text, "EventWidgetMade EventType") {
+		t.Errorf("event types out of order")
+	}
+	if strings.Contains(text, "GetName()") || strings.Contains(text, "GetTags()") {
+		t.Errorf("accessors for required or slice fields")
+	}
+}
+
+func TestGenerateIsStable(t *testing.T) {
+	dir := schemaDir(t, map[string]string{"widget-made.json": widgetSchema})
+	first, err := generate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		again, err := generate(dir)
+		if err != nil || !bytes.Equal(first, again) {
+			t.Fatalf("run %d differs from the first (%v)", i+2, err)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		schemas map[string]string
+		want    string
+	}{
+		{"no schemas", nil, "no schemas in"},
+		{"bad json", map[string]string{"a.json": "{"}, "a.json"},
+		{"wrong const", map[string]string{"a.json": `{"properties": {"xcodex_event_type": {"const": "b"}}}`}, `xcodex_event_type is b, not "a"`},
+		{"unresolved ref", map[string]string{"a.json": `{"properties": {"x": {"$ref": "#/definitions/Missing"}}}`}, `x: unresolved $ref "#/definitions/Missing"`},
+		{"conflicting definitions", map[string]string{
+			"a.json": `{"definitions": {"P": {"type": "string"}}}`,
+			"b.json": `{"definitions": {"P": {"type": "integer"}}}`,
+		}, "definition P differs"},
+	}
+	for _, tt := range tests {
+		_, err := generate(schemaDir(t, tt.schemas))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: generate = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"tool_use_id":       "ToolUseId",
+		"tool-call-started": "ToolCallStarted",
+		"x":                 "X",
+		"__a__b":            "AB",
+	} {
+		if got := camelCase(in); got != want {
+			t.Errorf("camelCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
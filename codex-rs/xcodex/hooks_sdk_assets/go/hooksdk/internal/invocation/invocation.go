@@ -0,0 +1,66 @@
+// Package invocation holds the id of the hook invocation being handled, for the packages that tag
+// their output with it (hooklog, webhook) and can't import hooksdk.
+package invocation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+)
+
+// Field is the name of the id in envelopes, payloads, and the records that carry it.
+const Field = "hook_invocation_id"
+
+// New returns a new UUIDv7: 48 bits of Unix milliseconds followed by random bits, so ids made
+// later sort after earlier ones (within a millisecond they are in no particular order).
+func New() string {
+	var b [16]byte
+	// crypto/rand doesn't fail on the platforms Go supports; if it did, the id would still carry
+	// its time.
+	_, _ = rand.Read(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	b[6] = 0x70 | b[6]&0x0f
+	b[8] = 0x80 | b[8]&0x3f
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	hex.Encode(s[9:13], b[4:6])
+	hex.Encode(s[14:18], b[6:8])
+	hex.Encode(s[19:23], b[8:10])
+	hex.Encode(s[24:], b[10:])
+	s[8], s[13], s[18], s[23] = '-', '-', '-', '-'
+	return string(s[:])
+}
+
+type key struct{}
+
+// WithID returns ctx carrying id.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// FromContext returns the id ctx carries, or else Current.
+func FromContext(ctx context.Context) string {
+	if ctx != nil {
+		if id, ok := ctx.Value(key{}).(string); ok && id != "" {
+			return id
+		}
+	}
+	return Current()
+}
+
+var current atomic.Value
+
+// SetCurrent records id as that of the event the process read on its stdin.
+func SetCurrent(id string) { current.Store(id) }
+
+// Current returns the id SetCurrent recorded, or "" before the process has read an event.
+func Current() string {
+	id, _ := current.Load().(string)
+	return id
+}
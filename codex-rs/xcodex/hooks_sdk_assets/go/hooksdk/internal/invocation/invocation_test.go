@@ -0,0 +1,81 @@
+package invocation_test
+
+import (
+	"context"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/invocation"
+)
+
+var uuidV7 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNew(t *testing.T) {
+	seen := map[string]bool{}
+	before := time.Now().UnixMilli()
+	for i := 0; i < 1000; i++ {
+		id := invocation.New()
+		if !uuidV7.MatchString(id) {
+			t.Fatalf("New = %q, not a UUIDv7", id)
+		}
+		if seen[id] {
+			t.Fatalf("New repeated %q", id)
+		}
+		seen[id] = true
+	}
+	after := time.Now().UnixMilli()
+
+	// The first 48 bits are the Unix time in milliseconds.
+	id := invocation.New()
+	b, err := hex.DecodeString(strings.ReplaceAll(id, "-", "")[:12])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ms int64
+	for _, c := range b {
+		ms = ms<<8 | int64(c)
+	}
+	if ms < before || ms > time.Now().UnixMilli() {
+		t.Errorf("New = %q carries time %d, want between %d and now", id, ms, before)
+	}
+
+	// Ids made in later milliseconds sort after earlier ones.
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, invocation.New())
+		for time.Now().UnixMilli() <= after {
+			time.Sleep(time.Millisecond)
+		}
+		after = time.Now().UnixMilli()
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("ids out of order: %q", ids)
+	}
+}
+
+func TestContextAndCurrent(t *testing.T) {
+	if got := invocation.Current(); got != "" {
+		t.Errorf("Current before SetCurrent = %q", got)
+	}
+	if got := invocation.FromContext(context.Background()); got != "" {
+		t.Errorf("FromContext with nothing set = %q", got)
+	}
+	invocation.SetCurrent("process")
+	ctx := invocation.WithID(context.Background(), "event")
+	if got := invocation.FromContext(ctx); got != "event" {
+		t.Errorf("FromContext = %q, want the context's", got)
+	}
+	// Without an id, or with an empty one, it is the process's.
+	for _, ctx := range []context.Context{context.Background(), invocation.WithID(context.Background(), ""), nil} {
+		if got := invocation.FromContext(ctx); got != "process" {
+			t.Errorf("FromContext = %q, want the process's", got)
+		}
+	}
+	if got := invocation.Current(); got != "process" {
+		t.Errorf("Current = %q", got)
+	}
+}
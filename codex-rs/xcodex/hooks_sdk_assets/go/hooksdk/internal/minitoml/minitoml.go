@@ -0,0 +1,387 @@
+// Package minitoml parses the subset of TOML used by the hook templates' config files, so the SDK
+// stays free of third-party dependencies.
+//
+// Supported: comments, `[table]` and `[[array.of.tables]]` headers (dotted names), bare and
+// quoted keys, basic ("...") and literal ('...') strings, multi-line literal strings (delimited
+// by three single quotes), integers, floats, booleans, and arrays (which may span lines). Dates
+// and inline tables are not supported and are reported as errors.
+package minitoml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parse decodes data into nested maps: tables are map[string]any, arrays are []any, and arrays of
+// tables are []map[string]any.
+func Parse(data string) (map[string]any, error) {
+	p := &parser{src: data, line: 1}
+	root := map[string]any{}
+	cur := root
+	for {
+		p.skipSpaceAndComments(true)
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		switch p.peek() {
+		case '[':
+			cur, err = p.header(root)
+		default:
+			err = p.keyValue(cur)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() byte { return p.src[p.pos] }
+
+func (p *parser) advance() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpaceAndComments skips blanks and comments, and newlines too when newlines is set.
+func (p *parser) skipSpaceAndComments(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.advance()
+		case c == '\n' && newlines:
+			p.advance()
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.advance()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endOfLine requires the rest of the line to be blank or a comment.
+func (p *parser) endOfLine() error {
+	p.skipSpaceAndComments(false)
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q after value", p.peek())
+	}
+	p.advance()
+	return nil
+}
+
+func (p *parser) header(root map[string]any) (map[string]any, error) {
+	p.advance()
+	array := !p.eof() && p.peek() == '['
+	if array {
+		p.advance()
+	}
+	keys, err := p.keyPath(']')
+	if err != nil {
+		return nil, err
+	}
+	if p.eof() || p.advance() != ']' || (array && (p.eof() || p.advance() != ']')) {
+		return nil, p.errorf("unterminated table header")
+	}
+	if err := p.endOfLine(); err != nil {
+		return nil, err
+	}
+
+	parent, err := p.descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	if array {
+		existing, ok := parent[last]
+		if !ok {
+			existing = []map[string]any{}
+		}
+		tables, ok := existing.([]map[string]any)
+		if !ok {
+			return nil, p.errorf("%q is already defined as a non-array", last)
+		}
+		t := map[string]any{}
+		parent[last] = append(tables, t)
+		return t, nil
+	}
+	switch existing := parent[last].(type) {
+	case nil:
+		t := map[string]any{}
+		parent[last] = t
+		return t, nil
+	case map[string]any:
+		return existing, nil
+	}
+	return nil, p.errorf("%q is already defined as a non-table", last)
+}
+
+// descend walks (creating as needed) the tables named by keys; an array of tables resolves to
+// its last element, as in TOML.
+func (p *parser) descend(t map[string]any, keys []string) (map[string]any, error) {
+	for _, k := range keys {
+		switch next := t[k].(type) {
+		case nil:
+			m := map[string]any{}
+			t[k] = m
+			t = m
+		case map[string]any:
+			t = next
+		case []map[string]any:
+			if len(next) == 0 {
+				return nil, p.errorf("%q is an empty array of tables", k)
+			}
+			t = next[len(next)-1]
+		default:
+			return nil, p.errorf("%q is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+func (p *parser) keyValue(t map[string]any) error {
+	keys, err := p.keyPath('=')
+	if err != nil {
+		return err
+	}
+	if p.eof() || p.advance() != '=' {
+		return p.errorf("expected = after key")
+	}
+	p.skipSpaceAndComments(false)
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	parent, err := p.descend(t, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, dup := parent[last]; dup {
+		return p.errorf("duplicate key %q", last)
+	}
+	parent[last] = v
+	return p.endOfLine()
+}
+
+// keyPath parses `a.b."c d"` up to (not including) end.
+func (p *parser) keyPath(end byte) ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpaceAndComments(false)
+		if p.eof() {
+			return nil, p.errorf("unexpected end of input in key")
+		}
+		var key string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case c == '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.advance()
+			}
+			key = p.src[start:p.pos]
+			if key == "" {
+				return nil, p.errorf("invalid key character %q", c)
+			}
+		}
+		keys = append(keys, key)
+		p.skipSpaceAndComments(false)
+		if p.eof() || p.peek() != '.' {
+			break
+		}
+		p.advance()
+	}
+	if p.eof() || p.peek() != end {
+		return nil, p.errorf("expected %q after key", end)
+	}
+	return keys, nil
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *parser) value() (any, error) {
+	if p.eof() {
+		return nil, p.errorf("missing value")
+	}
+	switch c := p.peek(); {
+	case c == '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			return nil, p.errorf("multi-line basic strings are not supported; use '''...'''")
+		}
+		return p.basicString()
+	case c == '\'':
+		if strings.HasPrefix(p.src[p.pos:], "'''") {
+			return p.multilineLiteral()
+		}
+		return p.literalString()
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return nil, p.errorf("inline tables are not supported")
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n#,]", rune(p.peek())) {
+		p.advance()
+	}
+	word := p.src[start:p.pos]
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	clean := strings.ReplaceAll(word, "_", "")
+	if n, err := strconv.ParseInt(clean, 0, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(clean, 64); err == nil {
+		return f, nil
+	}
+	return nil, p.errorf("invalid value %q", word)
+}
+
+func (p *parser) array() ([]any, error) {
+	p.advance()
+	out := []any{}
+	for {
+		p.skipSpaceAndComments(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.advance()
+			return out, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		p.skipSpaceAndComments(true)
+		if p.eof() {
+			return nil, p.errorf("unterminated array")
+		}
+		switch p.advance() {
+		case ',':
+		case ']':
+			return out, nil
+		default:
+			return nil, p.errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *parser) basicString() (string, error) {
+	p.advance()
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.advance()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			switch e := p.advance(); e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if p.pos+n > len(p.src) {
+					return "", p.errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+				if err != nil {
+					return "", p.errorf("invalid unicode escape")
+				}
+				p.pos += n
+				b.WriteRune(rune(r))
+			default:
+				return "", p.errorf("invalid escape \\%c (use a 'literal string' for regexes)", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (p *parser) literalString() (string, error) {
+	p.advance()
+	start := p.pos
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		if p.advance() == '\'' {
+			return p.src[start : p.pos-1], nil
+		}
+	}
+}
+
+func (p *parser) multilineLiteral() (string, error) {
+	p.pos += 3
+	// A newline right after the opening delimiter is trimmed.
+	if strings.HasPrefix(p.src[p.pos:], "\n") {
+		p.advance()
+	} else if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.pos++
+		p.advance()
+	}
+	end := strings.Index(p.src[p.pos:], "'''")
+	if end < 0 {
+		return "", p.errorf("unterminated multi-line string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.line += strings.Count(s, "\n")
+	p.pos += end + 3
+	return s, nil
+}
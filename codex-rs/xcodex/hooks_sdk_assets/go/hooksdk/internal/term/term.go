@@ -0,0 +1,23 @@
+// Package term tells terminals apart from other files, such as pipes or /dev/null.
+package term
+
+import "os"
+
+// IsTerminal reports whether f is an interactive terminal. A character device that isn't a
+// terminal, like /dev/null, is not one.
+func IsTerminal(f *os.File) bool {
+	if f == nil {
+		return false
+	}
+	// SyscallConn, unlike Fd, leaves the file in non-blocking mode, so reads of f can still be
+	// interrupted.
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return false
+	}
+	is := false
+	if err := conn.Control(func(fd uintptr) { is = isTerminal(fd) }); err != nil {
+		return false
+	}
+	return is
+}
@@ -0,0 +1,7 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package term
+
+// Without a terminal ioctl, nothing is a terminal: reading a terminal blocks until EOF, but every
+// other file is read as usual.
+func isTerminal(fd uintptr) bool { return false }
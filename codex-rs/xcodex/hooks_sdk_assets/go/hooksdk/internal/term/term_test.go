@@ -0,0 +1,41 @@
+package term
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsTerminalOtherFiles(t *testing.T) {
+	if IsTerminal(nil) {
+		t.Error("nil is a terminal")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if IsTerminal(r) || IsTerminal(w) {
+		t.Error("a pipe is a terminal")
+	}
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	if IsTerminal(null) {
+		t.Errorf("%s is a terminal", os.DevNull)
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsTerminal(f) {
+		t.Error("a regular file is a terminal")
+	}
+	f.Close()
+	if IsTerminal(f) {
+		t.Error("a closed file is a terminal")
+	}
+}
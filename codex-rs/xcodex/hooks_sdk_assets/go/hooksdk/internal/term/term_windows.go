@@ -0,0 +1,11 @@
+//go:build windows
+
+package term
+
+import "syscall"
+
+// Only consoles have a console mode; NUL and pipes don't.
+func isTerminal(fd uintptr) bool {
+	var mode uint32
+	return syscall.GetConsoleMode(syscall.Handle(fd), &mode) == nil
+}
@@ -0,0 +1,251 @@
+// Package utf8safe finds the strings of a JSON document that aren't valid UTF-8 and keeps their
+// bytes, which encoding/json replaces with U+FFFD on both decode and encode.
+package utf8safe
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Suffix is appended to a key to name the base64 copy of its value's bytes (see Encode).
+const Suffix = "__base64"
+
+// Decode decodes a JSON document like json.Unmarshal into an any, with numbers as json.Number,
+// except that strings keep the bytes that aren't valid UTF-8. Object keys are decoded as usual.
+func Decode(data []byte) (any, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("unexpected end of JSON input")
+	}
+	switch data[0] {
+	case '{':
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		if fields == nil {
+			return nil, nil
+		}
+		m := make(map[string]any, len(fields))
+		for k, raw := range fields {
+			v, err := Decode(raw)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case '[':
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return nil, err
+		}
+		a := make([]any, len(elems))
+		for i, raw := range elems {
+			v, err := Decode(raw)
+			if err != nil {
+				return nil, err
+			}
+			a[i] = v
+		}
+		return a, nil
+	case '"':
+		return unquote(data)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// unquote decodes a JSON string, keeping its invalid bytes. Escapes are ASCII, so an invalid byte
+// never falls inside one: the valid runs between them are decoded by encoding/json.
+func unquote(data []byte) (string, error) {
+	if utf8.Valid(data) {
+		var s string
+		err := json.Unmarshal(data, &s)
+		return s, err
+	}
+	if len(data) < 2 || data[len(data)-1] != '"' {
+		return "", errors.New("unexpected end of JSON input")
+	}
+	body := data[1 : len(data)-1]
+	var out []byte
+	run := 0
+	flush := func(end int) error {
+		if run == end {
+			return nil
+		}
+		var s string
+		if err := json.Unmarshal(append(append([]byte{'"'}, body[run:end]...), '"'), &s); err != nil {
+			return err
+		}
+		out = append(out, s...)
+		return nil
+	}
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRune(body[i:])
+		if r == utf8.RuneError && size == 1 {
+			if err := flush(i); err != nil {
+				return "", err
+			}
+			out = append(out, body[i])
+			run = i + 1
+		}
+		i += size
+	}
+	if err := flush(len(body)); err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Invalid returns the path (`a.b[2]`) of the first string in v, in key order, that isn't valid
+// UTF-8, or "" if there is none.
+func Invalid(v any) string {
+	path, _ := invalid(v, "")
+	return path
+}
+
+func invalid(v any, path string) (string, bool) {
+	switch v := generic(v).(type) {
+	case string:
+		return path, !utf8.ValidString(v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if p, ok := invalid(v[k], p); ok {
+				return p, true
+			}
+		}
+	case []any:
+		for i, e := range v {
+			if p, ok := invalid(e, path+"["+strconv.Itoa(i)+"]"); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Encode returns v with a `<key>__base64` field next to every key whose value is a string that
+// isn't valid UTF-8: the base64 of its bytes. The string itself is left for encoding/json to
+// replace. For an array holding such strings, `<key>__base64` is an array of the same length
+// with the base64 copies in their places and null elsewhere. Objects are copied on the way
+// down; v is not changed. Values other than maps with string keys, slices, and strings are
+// returned as they are.
+func Encode(v any) any {
+	out, _ := encode(v)
+	return out
+}
+
+// encode returns v encoded, and whether anything in it changed.
+func encode(v any) (any, bool) {
+	switch g := generic(v).(type) {
+	case map[string]any:
+		var out map[string]any
+		for k, e := range g {
+			enc, changed := encode(e)
+			dup, hasDup := mirror(e)
+			if !changed && !hasDup {
+				continue
+			}
+			if out == nil {
+				out = make(map[string]any, len(g)+1)
+				for k, e := range g {
+					out[k] = e
+				}
+			}
+			out[k] = enc
+			if hasDup {
+				out[k+Suffix] = dup
+			}
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	case []any:
+		var out []any
+		for i, e := range g {
+			enc, changed := encode(e)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = append([]any(nil), g...)
+			}
+			out[i] = enc
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	}
+	return v, false
+}
+
+// mirror returns the value of `<key>__base64` for a value v: the base64 of a string that isn't
+// valid UTF-8, or an array of the copies of v's elements. ok is false when v holds no such string
+// outside of objects (which get their own copies).
+func mirror(v any) (dup any, ok bool) {
+	switch g := generic(v).(type) {
+	case string:
+		if utf8.ValidString(g) {
+			return nil, false
+		}
+		return base64.StdEncoding.EncodeToString([]byte(g)), true
+	case []any:
+		copies := make([]any, len(g))
+		for i, e := range g {
+			if c, ok2 := mirror(e); ok2 {
+				copies[i], ok = c, true
+			}
+		}
+		if ok {
+			return copies, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	mapType   = reflect.TypeOf(map[string]any(nil))
+	sliceType = reflect.TypeOf([]any(nil))
+)
+
+// generic returns v as a map[string]any, []any, or string when its type is one of those or a type
+// defined on one (e.g. hooksdk.HookPayloadJSON), and v otherwise.
+func generic(v any) any {
+	switch v.(type) {
+	case nil, string, map[string]any, []any:
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	switch {
+	case rv.Kind() == reflect.String:
+		return rv.String()
+	case rv.Kind() == reflect.Map && rv.Type().ConvertibleTo(mapType):
+		return rv.Convert(mapType).Interface()
+	case rv.Kind() == reflect.Slice && rv.Type().ConvertibleTo(sliceType):
+		return rv.Convert(sliceType).Interface()
+	}
+	return v
+}
@@ -0,0 +1,137 @@
+package utf8safe_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/utf8safe"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		data string
+		want any
+	}{
+		{`{"a":"ok","n":1.50,"b":[true,null,"x\u00e9"]}`, map[string]any{"a": "ok", "n": json.Number("1.50"), "b": []any{true, nil, "xé"}}},
+		{"\"raw \xff\xfe bytes\"", "raw \xff\xfe bytes"},
+		// Escapes around invalid bytes, including an escaped NUL, decode as usual.
+		{"\"\\u0000\xc3\\n\\\"\xe9t\\u00e9\"", "\x00\xc3\n\"\xe9té"},
+		{"{\"k\":[\"\xff\",\"ok\"]}", map[string]any{"k": []any{"\xff", "ok"}}},
+		{"  null ", nil},
+		{`{}`, map[string]any{}},
+		{`[]`, []any{}},
+		{"\"\xf0\x9f\x98\"", "\xf0\x9f\x98"}, // a rune cut short
+	}
+	for _, tt := range tests {
+		got, err := utf8safe.Decode([]byte(tt.data))
+		if err != nil {
+			t.Errorf("Decode(%q): %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Decode(%q) = %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+
+	for _, data := range []string{"", "   ", "\"\xff", "\"a\xff\\q\"", `{"a":}`, `[1,`, `nope`} {
+		if v, err := utf8safe.Decode([]byte(data)); err == nil {
+			t.Errorf("Decode(%q) = %#v, want an error", data, v)
+		}
+	}
+}
+
+func TestDecodeLongMixed(t *testing.T) {
+	// A long string mixing ASCII, escapes, multibyte runes, NULs, and invalid bytes keeps every byte.
+	var raw, quoted strings.Builder
+	for i := 0; raw.Len() < 1<<20; i++ {
+		switch i % 5 {
+		case 0:
+			raw.WriteString("plain text ")
+			quoted.WriteString("plain text ")
+		case 1:
+			raw.WriteString("tab\t\x00quote\"")
+			quoted.WriteString(`tab\t\u0000quote\"`)
+		case 2:
+			raw.WriteString("häßlich 😀")
+			quoted.WriteString("häßlich 😀")
+		case 3:
+			raw.WriteString("\xff\x80\xc3")
+			quoted.WriteString("\xff\x80\xc3")
+		case 4:
+			raw.WriteString("\xe2\x82")
+			quoted.WriteString("\xe2\x82")
+		}
+	}
+	got, err := utf8safe.Decode([]byte(`{"out":"` + quoted.String() + `"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := got.(map[string]any)["out"].(string); s != raw.String() {
+		t.Errorf("Decode lost bytes: got %d bytes, want %d", len(s), raw.Len())
+	}
+	if path := utf8safe.Invalid(got); path != "out" {
+		t.Errorf("Invalid = %q, want out", path)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	type named map[string]any
+	for _, tt := range []struct {
+		v    any
+		want string
+	}{
+		{map[string]any{"a": "ok", "b": []any{1, "fine"}}, ""},
+		{map[string]any{"z": "\xff", "a": map[string]any{"b": []any{"ok", "\xfe"}}}, "a.b[1]"},
+		{named{"x": []any{"\xff"}}, "x[0]"},
+		{map[string]any{"nul": "\x00"}, ""},
+		{42, ""},
+	} {
+		if got := utf8safe.Invalid(tt.v); got != tt.want {
+			t.Errorf("Invalid(%#v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	b64 := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	in := map[string]any{
+		"ok":    "fine",
+		"out":   "bin\xff",
+		"argv":  []any{"ls", "\xfe", "-l"},
+		"deep":  map[string]any{"x": "\x80", "n": 1},
+		"clean": []any{"a", map[string]any{"y": "\xc3"}},
+	}
+	got := utf8safe.Encode(in)
+	want := map[string]any{
+		"ok":                     "fine",
+		"out":                    "bin\xff",
+		"out" + utf8safe.Suffix:  b64("bin\xff"),
+		"argv":                   []any{"ls", "\xfe", "-l"},
+		"argv" + utf8safe.Suffix: []any{nil, b64("\xfe"), nil},
+		"deep":                   map[string]any{"x": "\x80", "x" + utf8safe.Suffix: b64("\x80"), "n": 1},
+		"clean":                  []any{"a", map[string]any{"y": "\xc3", "y" + utf8safe.Suffix: b64("\xc3")}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Encode =\n%#v\nwant\n%#v", got, want)
+	}
+	// v isn't changed.
+	if len(in) != 5 || len(in["deep"].(map[string]any)) != 2 || len(in["clean"].([]any)[1].(map[string]any)) != 1 {
+		t.Errorf("Encode changed its input: %#v", in)
+	}
+
+	// Valid values, and values Encode doesn't look into, come back as they are.
+	type rec struct{ S string }
+	valid := map[string]any{"a": "ok"}
+	for _, v := range []any{valid, "\xff", rec{"\xff"}, 3, nil} {
+		if got := utf8safe.Encode(v); !reflect.DeepEqual(got, v) {
+			t.Errorf("Encode(%#v) = %#v", v, got)
+		}
+	}
+	// The strings of an array at the top have no key to copy them under.
+	if got := utf8safe.Encode([]any{"\xff"}); !reflect.DeepEqual(got, []any{"\xff"}) {
+		t.Errorf("Encode of an array = %#v", got)
+	}
+}
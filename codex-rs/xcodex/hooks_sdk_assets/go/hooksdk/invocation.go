@@ -0,0 +1,31 @@
+package hooksdk
+
+import (
+	"context"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/invocation"
+)
+
+// InvocationID returns the id of the hook invocation that read p: the envelope's
+// `hook_invocation_id` when the host sent one (for a bare payload, its own), and otherwise a
+// UUIDv7 made when the payload was read, so ids sort by time. The same id tags the response's
+// metadata, the hooklog records of a logger bound to p, the wrapped lines cmd/log_jsonl writes,
+// the CloudEvents id, and the X-Hook-Invocation-Id header of webhook requests, so one invocation
+// can be followed through all of them. A payload that wasn't parsed by this package has none.
+func (p *HookPayload) InvocationID() string {
+	return p.invocationID
+}
+
+// InvocationIDFrom returns the id of the invocation whose handler ctx was passed to (see
+// HookPayload.InvocationID), or else that of the event the process read on stdin, or "".
+func InvocationIDFrom(ctx context.Context) string {
+	return invocation.FromContext(ctx)
+}
+
+// payloadInvocationID returns the payload's own `hook_invocation_id`, or a new one.
+func payloadInvocationID(raw map[string]any) string {
+	if id, ok := raw[invocation.Field].(string); ok && id != "" {
+		return id
+	}
+	return invocation.New()
+}
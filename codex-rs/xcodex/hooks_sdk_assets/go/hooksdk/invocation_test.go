@@ -0,0 +1,182 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/cloudevents"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/sink"
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+// invocationMain is the hook HOOKSDK_TEST_INVOCATION runs: its handler sends the event down every
+// channel that carries the invocation id, into the directory that variable names, and to the
+// webhook at HOOKSDK_TEST_INVOCATION_URL. The ids it sees are written to ids, and a log record
+// follows the response.
+func invocationMain() {
+	dir := os.Getenv("HOOKSDK_TEST_INVOCATION")
+	code := hooksdk.RunIO(context.Background(), os.Stdin, os.Stdout, os.Stderr, func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		hooklog.Bind(p)
+		hooklog.Infof("handling")
+		if err := sink.NewJSONL(filepath.Join(dir, "events.jsonl"), jsonl.Options{}).Write(ctx, hooksdk.HookPayloadJSON(p.RawPayload)); err != nil {
+			return hooksdk.Response{}, err
+		}
+		ce, err := cloudevents.ToCloudEvent(p)
+		if err != nil {
+			return hooksdk.Response{}, err
+		}
+		client := &webhook.Client{URL: os.Getenv("HOOKSDK_TEST_INVOCATION_URL")}
+		if err := client.Send(ctx, []byte(`{}`)); err != nil {
+			return hooksdk.Response{}, err
+		}
+		ids := fmt.Sprintf("%s %s %s", p.InvocationID(), hooksdk.InvocationIDFrom(ctx), ce.ID)
+		return hooksdk.Allow(), os.WriteFile(filepath.Join(dir, "ids"), []byte(ids), 0o644)
+	})
+	// Outside the handler, the process's event is the one.
+	hooklog.New(os.Stderr).Infof("done")
+	os.Exit(code)
+}
+
+var uuidV7 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// invocationIDs runs invocationMain on stdin and returns the invocation id each channel carried,
+// by channel.
+func invocationIDs(t *testing.T, stdin []byte) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	headers := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Get(webhook.InvocationIDHeader)
+	}))
+	defer srv.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "HOOKSDK_TEST_INVOCATION="+dir, "HOOKSDK_TEST_INVOCATION_URL="+srv.URL,
+		"CODEX_HOME="+t.TempDir(), "CODEX_HOOK_LOG_FORMAT=json", "CODEX_HOOK_LOG_LEVEL=info")
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr.String())
+	}
+
+	got := map[string]string{"webhook header": <-headers}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out, &resp); err != nil || resp.Metadata == nil {
+		t.Fatalf("response %s: %v", out, err)
+	}
+	got["response"] = resp.Metadata.InvocationID
+	ids, err := os.ReadFile(filepath.Join(dir, "ids"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range strings.Fields(string(ids)) {
+		got[[]string{"payload", "handler ctx", "cloudevent"}[i]] = f
+	}
+	for i, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("stderr line %q: %v", line, err)
+		}
+		got[fmt.Sprintf("log record %d", i)], _ = rec["hook_invocation_id"].(string)
+	}
+	var rec map[string]any
+	data, err := os.ReadFile(filepath.Join(dir, "events.jsonl"))
+	if err != nil || json.Unmarshal(data, &rec) != nil {
+		t.Fatalf("jsonl record %q: %v", data, err)
+	}
+	got["jsonl record"], _ = rec["hook_invocation_id"].(string)
+	if len(got) != 8 {
+		t.Fatalf("channels = %v, want 8", got)
+	}
+	return got
+}
+
+// checkSameID checks that every channel carried want, or, when want is "", the same UUIDv7.
+func checkSameID(t *testing.T, name string, got map[string]string, want string) {
+	t.Helper()
+	if want == "" {
+		want = got["response"]
+		if !uuidV7.MatchString(want) {
+			t.Fatalf("%s: response id %q isn't a UUIDv7", name, want)
+		}
+	}
+	for channel, id := range got {
+		if id != want {
+			t.Errorf("%s: %s has id %q, want %q", name, channel, id, want)
+		}
+	}
+}
+
+func TestInvocationIDAcrossChannels(t *testing.T) {
+	payload := hooktest.ToolCallStarted().WithSessionID("s1").Bytes()
+	first := invocationIDs(t, payload)
+	checkSameID(t, "new id", first, "")
+	// Each invocation has its own.
+	if second := invocationIDs(t, payload); second["response"] == first["response"] {
+		t.Errorf("two invocations share id %s", first["response"])
+	}
+
+	// The host's id is kept: the envelope's, or a bare payload's own.
+	own := hooktest.ToolCallStarted().With("hook_invocation_id", "inv-payload").Bytes()
+	checkSameID(t, "payload id", invocationIDs(t, own), "inv-payload")
+	path := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(path, own, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	envelope, _ := json.Marshal(map[string]string{"payload_path": path, "hook_invocation_id": "inv-envelope"})
+	checkSameID(t, "envelope id", invocationIDs(t, envelope), "inv-envelope")
+}
+
+func TestInvocationIDInProcess(t *testing.T) {
+	// A payload parsed on its own has its own id, or a new one each time.
+	p := parse(t, hooktest.SessionStart().With("hook_invocation_id", "inv-1"))
+	if p.InvocationID() != "inv-1" {
+		t.Errorf("InvocationID = %q", p.InvocationID())
+	}
+	a, b := parse(t, hooktest.SessionStart()), parse(t, hooktest.SessionStart())
+	if !uuidV7.MatchString(a.InvocationID()) || a.InvocationID() == b.InvocationID() {
+		t.Errorf("InvocationIDs = %q, %q; want two UUIDv7s", a.InvocationID(), b.InvocationID())
+	}
+	if (&hooksdk.HookPayload{}).InvocationID() != "" {
+		t.Error("a payload that wasn't parsed has an invocation id")
+	}
+
+	// The response's metadata carries the invocation's id, unless the handler set one.
+	stdin := hooktest.SessionStart().With("hook_invocation_id", "inv-2").Bytes()
+	res := hooktest.RunHook(t, func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		if hooksdk.InvocationIDFrom(ctx) != "inv-2" {
+			return hooksdk.Response{}, fmt.Errorf("ctx id = %q", hooksdk.InvocationIDFrom(ctx))
+		}
+		return hooksdk.Allow(), nil
+	}, stdin)
+	if res.Response.Metadata == nil || res.Response.Metadata.InvocationID != "inv-2" || res.Response.Metadata.SDKVersion != hooksdk.Version() {
+		t.Errorf("response = %+v, %s", res.Response.Metadata, res.Stderr)
+	}
+	own := hooksdk.Allow()
+	own.Metadata = &hooksdk.ResponseMetadata{InvocationID: "mine"}
+	res = hooktest.RunHook(t, respond(own, nil), stdin)
+	if m := res.Response.Metadata; m == nil || m.InvocationID != "mine" || m.SDKVersion != hooksdk.Version() {
+		t.Errorf("response with its own id = %+v", m)
+	}
+	// So does one Run answers without decoding the payload.
+	res = hooktest.RunHook(t, respond(hooksdk.Deny("x"), nil), stdin, hooksdk.WithFilter(hooksdk.ParseFilter("tool-*", "")))
+	if m := res.Response.Metadata; m == nil || m.InvocationID != "inv-2" {
+		t.Errorf("filtered response = %+v", m)
+	}
+}
@@ -0,0 +1,78 @@
+package hooksdk
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// IO is the process state a hook talks to: its stdio streams and environment. Hand one to Run,
+// ReadPayload, and WriteResponse with WithIO (or call IO.Run) to drive a whole hook main in-process
+// from a test, with the environment it would see under the host:
+//
+//	func run(stdio hooksdk.IO) int {
+//		return stdio.Run(context.Background(), handle)
+//	}
+//
+//	var out bytes.Buffer
+//	code := run(hooksdk.IO{
+//		In:     bytes.NewReader(payload),
+//		Out:    &out,
+//		Getenv: func(key string) string { return env[key] },
+//	})
+//
+// Nil fields are the process's own (os.Stdin, os.Stdout, os.Stderr, os.Getenv), so the zero IO is
+// the process.
+type IO struct {
+	In     io.Reader
+	Out    io.Writer
+	Err    io.Writer
+	Getenv func(string) string
+}
+
+// WithIO makes Run, ReadPayload, and WriteResponse use the streams and environment of s instead of
+// the process's, for the reads that take options: the payload comes from s.In, the response goes
+// to s.Out, and CODEX_HOOK_* settings (the payload size limit, CODEX_HOOK_SECRET,
+// CODEX_HOOK_TIMEOUT_MS, ...) are looked up with s.Getenv. A reader passed to ReadPayloadFrom or to
+// RunIO takes precedence over s.In, as do RunIO's writers over s.Out and s.Err.
+func WithIO(s IO) Option {
+	return func(o *options) { o.stdio = s }
+}
+
+// Run is RunIO with the streams and environment of s (see WithIO). It returns the exit code, so a
+// hook's main can be a thin wrapper around a function tests call directly:
+//
+//	func main() { os.Exit(run(hooksdk.IO{})) }
+func (s IO) Run(ctx context.Context, handler Handler, opts ...Option) int {
+	return RunIO(ctx, s.in(), s.out(), s.err(), handler, append([]Option{WithIO(s)}, opts...)...)
+}
+
+// Environ returns the Env read with s.Getenv (the process environment when it is nil). The
+// CodexHome fallbacks use s.Getenv's XDG_STATE_HOME, HOME, and TMPDIR, as in FromMap.
+func (s IO) Environ() Env {
+	if s.Getenv == nil {
+		return Environ()
+	}
+	return envFrom(s.Getenv)
+}
+
+func (s IO) in() io.Reader {
+	if s.In == nil {
+		return os.Stdin
+	}
+	return s.In
+}
+
+func (s IO) out() io.Writer {
+	if s.Out == nil {
+		return os.Stdout
+	}
+	return s.Out
+}
+
+func (s IO) err() io.Writer {
+	if s.Err == nil {
+		return os.Stderr
+	}
+	return s.Err
+}
@@ -0,0 +1,110 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// testIO is an IO reading stdin and env, with its output in the returned buffers.
+func testIO(stdin []byte, env map[string]string) (hooksdk.IO, *bytes.Buffer, *bytes.Buffer) {
+	var out, errOut bytes.Buffer
+	return hooksdk.IO{In: bytes.NewReader(stdin), Out: &out, Err: &errOut, Getenv: func(k string) string { return env[k] }}, &out, &errOut
+}
+
+func TestIORun(t *testing.T) {
+	env := map[string]string{"CODEX_HOME": t.TempDir(), "CODEX_HOOK_NAME": "in-process"}
+	stdio, out, _ := testIO(hooktest.ApprovalRequested().WithCommand("rm -rf /").Bytes(), env)
+	code := stdio.Run(context.Background(), func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return hooksdk.Deny(strings.Join(p.Command, " ")), nil
+	})
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		t.Fatalf("response %q: %v", out, err)
+	}
+	if code != hooksdk.ExitDeny || resp.Reason != "rm -rf /" {
+		t.Errorf("exit %d, response %+v", code, resp)
+	}
+
+	// Settings come from Getenv, not the process environment.
+	payload := hooktest.SessionStart().Bytes()
+	t.Setenv(hooksdk.MaxPayloadEnv, "")
+	env[hooksdk.MaxPayloadEnv] = strconv.Itoa(len(payload) - 1)
+	stdio, out, errOut := testIO(payload, env)
+	code = stdio.Run(context.Background(), func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return hooksdk.Allow(), nil
+	})
+	if code != hooksdk.ExitError || out.Len() != 0 || !strings.Contains(errOut.String(), "payload") {
+		t.Errorf("payload over the IO's limit: exit %d, stdout %q, stderr %q", code, out, errOut)
+	}
+}
+
+func TestIORunIOWriters(t *testing.T) {
+	// RunIO's streams take precedence over those of WithIO.
+	stdio, ioOut, _ := testIO([]byte("not read"), map[string]string{"CODEX_HOME": t.TempDir()})
+	var out, errOut bytes.Buffer
+	code := hooksdk.RunIO(context.Background(), bytes.NewReader(hooktest.SessionStart().WithSessionID("s-runio").Bytes()), &out, &errOut,
+		func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			return hooksdk.Deny(p.SessionID()), nil
+		}, hooksdk.WithIO(stdio))
+	if code != hooksdk.ExitDeny || !strings.Contains(out.String(), "s-runio") || ioOut.Len() != 0 {
+		t.Errorf("exit %d, RunIO stdout %q, IO stdout %q", code, out.String(), ioOut)
+	}
+}
+
+func TestWithIO(t *testing.T) {
+	stdio, out, _ := testIO(hooktest.SessionStart().WithSessionID("s-io").Bytes(), map[string]string{})
+	p, err := hooksdk.ReadPayload(hooksdk.WithIO(stdio))
+	if err != nil || p.SessionID() != "s-io" {
+		t.Fatalf("ReadPayload = %v, %v", p, err)
+	}
+	// A reader passed to ReadPayloadFrom takes precedence over In.
+	stdio, _, _ = testIO([]byte("not read"), map[string]string{})
+	if p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(hooktest.SessionStart().WithSessionID("s-from").Bytes()), hooksdk.WithIO(stdio)); err != nil || p.SessionID() != "s-from" {
+		t.Errorf("ReadPayloadFrom = %v, %v", p, err)
+	}
+
+	stdio, out, _ = testIO(nil, map[string]string{})
+	if err := hooksdk.WriteResponse(hooksdk.Deny("to the IO"), hooksdk.WithIO(stdio)); err != nil {
+		t.Fatal(err)
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil || resp.Reason != "to the IO" {
+		t.Errorf("WriteResponse wrote %q: %v", out, err)
+	}
+}
+
+func TestIOEnviron(t *testing.T) {
+	t.Setenv("CODEX_HOOK_NAME", "from-process")
+	if got := (hooksdk.IO{}).Environ().HookName; got != "from-process" {
+		t.Errorf("zero IO: HookName = %q, want the process's", got)
+	}
+	home := t.TempDir()
+	env := map[string]string{"CODEX_HOME": home, "CODEX_HOOK_NAME": "from-getenv"}
+	got := hooksdk.IO{Getenv: func(k string) string { return env[k] }}.Environ()
+	if got.HookName != "from-getenv" || got.CodexHome != home {
+		t.Errorf("IO.Environ = %+v, want the Getenv values", got)
+	}
+}
+
+func TestWriteResponseTo(t *testing.T) {
+	var out bytes.Buffer
+	resp := hooksdk.Deny("line one\nline two")
+	resp.ReasonCode = "CODE"
+	if err := hooksdk.WriteResponseTo(&out, resp); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out.String(), "\n") != 1 || !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("WriteResponseTo wrote %q, want one line", out.String())
+	}
+	var got hooksdk.Response
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil || got.Decision != hooksdk.DecisionDeny || got.Reason != resp.Reason || got.ReasonCode != "CODE" {
+		t.Errorf("WriteResponseTo wrote %q: %v", out.String(), err)
+	}
+}
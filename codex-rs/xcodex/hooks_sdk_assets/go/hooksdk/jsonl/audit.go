@@ -0,0 +1,387 @@
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/canonicaljson"
+)
+
+// An audit log (Options.Audit) chains its records together with SHA-256, so that editing,
+// inserting, or deleting a line after the fact breaks the chain where it happened. Each record is
+// one line:
+//
+//	{"seq":42,"prev":"<hash of record 41>","hash":"<hash of this record>","event":{...}}
+//
+// where hash is the hex SHA-256 of `{"event":E,"prev":P,"seq":N}`, with E the event in canonical
+// form (see Canonical) and P quoted as a JSON string: the record's own canonical form without
+// its hash. Every file starts with a header (see Meta.Chain) that carries the seq and hash of the
+// last record before it, in the previous file, so the chain runs on across rotations; a new log
+// starts from seq 0 and an empty hash.
+//
+// The chain shows that the records are as they were written, in order, since the first one
+// checked. It can't show that the newest records weren't cut off, or that the whole log wasn't
+// rewritten with a new chain: for that, keep the last hash that Verify reports somewhere the log's
+// writers can't change.
+
+// Chain is a link of an audit log's hash chain: the seq and hash of a record, or, in a header, of
+// the last record before the file.
+type Chain struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// AuditRecord is one record of an audit log.
+type AuditRecord struct {
+	Seq   uint64          `json:"seq"`
+	Prev  string          `json:"prev"`
+	Hash  string          `json:"hash"`
+	Event json.RawMessage `json:"event"`
+}
+
+// auditRecordKeys is the number of keys of an AuditRecord line.
+const auditRecordKeys = 4
+
+// auditOverhead is about what wrapping a record as an AuditRecord adds to its size, for rotating
+// before it.
+const auditOverhead = 180
+
+// auditJSON returns the JSON of a record Append encoded: without the `---` line that starts a
+// FormatPretty one.
+func auditJSON(rec []byte) []byte {
+	return bytes.TrimPrefix(rec, []byte(prettySeparator))
+}
+
+// ComputeHash returns the hash r.Hash should hold: the SHA-256 of the record's canonical form
+// without its hash.
+func (r AuditRecord) ComputeHash() (string, error) {
+	event, err := Canonical(r.Event)
+	if err != nil {
+		return "", err
+	}
+	return chainHash(r.Seq, r.Prev, event), nil
+}
+
+// hashMatches reports whether r.Hash is r's hash, as ComputeHash computes it or as the records
+// written before Canonical followed canonicaljson were hashed, so that older logs still verify.
+func (r AuditRecord) hashMatches() bool {
+	if hash, err := r.ComputeHash(); err == nil && hash == r.Hash {
+		return true
+	}
+	event, err := legacyCanonical(r.Event)
+	return err == nil && chainHash(r.Seq, r.Prev, event) == r.Hash
+}
+
+// chainHash hashes a record whose event is already canonical.
+func chainHash(seq uint64, prev string, event []byte) string {
+	var buf bytes.Buffer
+	buf.WriteString(`{"event":`)
+	buf.Write(event)
+	buf.WriteString(`,"prev":`)
+	buf.WriteString(strconv.Quote(prev))
+	buf.WriteString(`,"seq":`)
+	buf.WriteString(strconv.FormatUint(seq, 10))
+	buf.WriteByte('}')
+	sum := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(sum[:])
+}
+
+// Canonical returns the JSON value data in canonical form, as canonicaljson.Marshal writes it:
+// no insignificant whitespace, object keys sorted, strings minimally escaped, and numbers in one
+// form (integers with all their digits). Equal values always give the same bytes, however they
+// were formatted.
+func Canonical(data []byte) ([]byte, error) {
+	if data == nil {
+		return nil, errors.New("jsonl: unexpected end of JSON input")
+	}
+	return canonicaljson.Marshal(json.RawMessage(data))
+}
+
+// legacyCanonical is the canonical form audit records were hashed in before canonicaljson: keys
+// sorted by their bytes, strings as encoding/json writes them but without escaping <, >, and &,
+// and numbers as they were written.
+func legacyCanonical(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("jsonl: invalid character after top-level JSON value")
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// link returns rec as the audit record that follows prev, as a line, and its link.
+func link(rec []byte, prev Chain) ([]byte, Chain, error) {
+	event, err := Canonical(rec)
+	if err != nil {
+		return nil, prev, fmt.Errorf("jsonl: audit log record: %w", err)
+	}
+	next := Chain{Seq: prev.Seq + 1, Hash: chainHash(prev.Seq+1, prev.Hash, event)}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"seq":%d,"prev":%s,"hash":%q,"event":`, next.Seq, strconv.Quote(prev.Hash), next.Hash)
+	buf.Write(event)
+	buf.WriteString("}\n")
+	return buf.Bytes(), next, nil
+}
+
+// linkLines links every line of data after *prev, advancing *prev. Lines that aren't JSON are
+// dropped: they can't be hashed, and only a damaged spool file holds them.
+func linkLines(data []byte, prev *Chain) []byte {
+	var out []byte
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		linked, next, err := link(line, *prev)
+		if err != nil {
+			continue
+		}
+		out = append(out, linked...)
+		*prev = next
+	}
+	return out
+}
+
+// parseLink returns the link of an audit record or header line; ok is false for other lines.
+func parseLink(line []byte) (Chain, bool) {
+	if m, ok := ParseMeta(line); ok {
+		if m.Chain == nil {
+			return Chain{}, false
+		}
+		return *m.Chain, true
+	}
+	r, ok := parseAuditRecord(line)
+	return Chain{Seq: r.Seq, Hash: r.Hash}, ok
+}
+
+// parseAuditRecord parses an audit record line; ok is false for other lines.
+func parseAuditRecord(line []byte) (AuditRecord, bool) {
+	var top map[string]json.RawMessage
+	if json.Unmarshal(line, &top) != nil || len(top) != auditRecordKeys {
+		return AuditRecord{}, false
+	}
+	var r AuditRecord
+	if json.Unmarshal(line, &r) != nil || r.Hash == "" || len(r.Event) == 0 || top["prev"] == nil || top["seq"] == nil {
+		return AuditRecord{}, false
+	}
+	return r, true
+}
+
+// isAuditRecord reports whether a decoded record has the keys of an AuditRecord.
+func isAuditRecord(top map[string]any) bool {
+	if len(top) != auditRecordKeys {
+		return false
+	}
+	for _, k := range []string{"seq", "prev", "hash", "event"} {
+		if _, ok := top[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// lastLink returns the link the next record of an audit log continues from, read under the lock:
+// that of the last record (or header) of the active file, or else of the newest rotated
+// generation. active reports whether the active file has one; a non-empty active file without
+// one was written before the log was an audit log.
+func (w *Writer) lastLink() (prev Chain, active bool, err error) {
+	prev, ok, err := lastLinkIn(w.Path())
+	if err != nil || ok {
+		return prev, ok, err
+	}
+	for _, path := range []string{w.generation(1), w.generation(1) + gzExt} {
+		if prev, ok, err := lastLinkIn(path); err != nil || ok {
+			return prev, false, err
+		}
+	}
+	return Chain{}, false, nil
+}
+
+// lastLinkIn returns the link of the last audit record or header in the file at path; ok is
+// false if it has none, or doesn't exist. A plain file is read from the end; a gzipped one is
+// read from the start, since its members can't be found from the end.
+func lastLinkIn(path string) (prev Chain, ok bool, err error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return Chain{}, false, nil
+	}
+	if err != nil {
+		return Chain{}, false, err
+	}
+	defer f.Close()
+
+	var magic [2]byte
+	if n, _ := f.ReadAt(magic[:], 0); n == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		r, err := NewReader(f)
+		if err != nil {
+			return Chain{}, false, err
+		}
+		err = ScanRecords(r, func(rec []byte) error {
+			if c, found := parseLink(rec); found {
+				prev, ok = c, true
+			}
+			return nil
+		})
+		return prev, ok, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return Chain{}, false, err
+	}
+	size := info.Size()
+	for n := int64(64 << 10); ; n *= 2 {
+		if n > size {
+			n = size
+		}
+		buf := make([]byte, n)
+		if _, err := f.ReadAt(buf, size-n); err != nil && err != io.EOF {
+			return Chain{}, false, err
+		}
+		lines := bytes.Split(buf, []byte{'\n'})
+		first := 0
+		if n < size {
+			// The first line read may be the end of a longer one.
+			first = 1
+		}
+		for i := len(lines) - 1; i >= first; i-- {
+			if c, found := parseLink(lines[i]); found {
+				return c, true, nil
+			}
+		}
+		if n == size {
+			return Chain{}, false, nil
+		}
+	}
+}
+
+// auditHeader is the header that starts a new audit log file after prev: Options.Header with
+// prev as its Chain, or a header of its own when Options.Header isn't a Meta header.
+func (w *Writer) auditHeader(prev Chain) ([]byte, error) {
+	m, ok := ParseMeta(auditJSON(bytes.TrimSpace(w.opts.Header)))
+	if !ok {
+		m = Meta{Created: time.Now().UTC().Format(time.RFC3339)}
+	}
+	m.Chain = &prev
+	return m.Header(FormatJSONL)
+}
+
+// ChainBreak is where Verify found an audit log's chain broken.
+type ChainBreak struct {
+	File string
+	// Line is the line of File, counting from 1; 0 for a break between two files.
+	Line int
+	// Seq is the seq the record at Line should have had.
+	Seq    uint64
+	Reason string
+}
+
+func (b *ChainBreak) Error() string {
+	if b.Line == 0 {
+		return fmt.Sprintf("%s: %s", b.File, b.Reason)
+	}
+	return fmt.Sprintf("%s:%d: %s", b.File, b.Line, b.Reason)
+}
+
+// VerifyReport is what Verify checked; after a break, up to the last record before it.
+type VerifyReport struct {
+	Files, Records int
+	// First is the link the oldest file's header continues from, and Last the last record's (or
+	// First, with no records).
+	First, Last Chain
+}
+
+// Verify walks the audit log files paths, oldest first (see Files), and checks that each record
+// links to the one before it and holds the hash of its content, and that each file's header
+// continues from the end of the file before it. It returns a *ChainBreak for the first place
+// that doesn't hold: a line that was edited (its hash, or the next line's prev, doesn't match), a
+// line inserted or deleted (a seq out of order), a file missing from the middle of the set, or a
+// line that isn't an audit record at all, such as one cut short by a crash. The oldest file's
+// header is taken as the start of the chain, since older generations may have been rotated out.
+func Verify(paths []string) (VerifyReport, error) {
+	var report VerifyReport
+	for i, path := range paths {
+		prev, err := verifyFile(path, i == 0, &report)
+		report.Last = prev
+		if err != nil {
+			return report, err
+		}
+		report.Files++
+	}
+	return report, nil
+}
+
+func verifyFile(path string, oldest bool, report *VerifyReport) (Chain, error) {
+	f, err := Open(path)
+	if err != nil {
+		return report.Last, err
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 64<<10)
+	prev, lineNo := report.Last, 0
+	fail := func(seq uint64, format string, args ...any) (Chain, error) {
+		return prev, &ChainBreak{File: path, Line: lineNo, Seq: seq, Reason: fmt.Sprintf(format, args...)}
+	}
+	for {
+		line, rerr := br.ReadBytes('\n')
+		if len(line) > 0 {
+			lineNo++
+			line = bytes.TrimRight(line, "\r\n")
+			if lineNo == 1 {
+				m, ok := ParseMeta(line)
+				if !ok || m.Chain == nil {
+					return fail(prev.Seq+1, "no audit log header")
+				}
+				if oldest {
+					report.First, prev = *m.Chain, *m.Chain
+				} else if *m.Chain != prev {
+					lineNo = 0
+					return fail(prev.Seq+1, "header continues from seq %d (%.12s), but the file before it ends at seq %d (%.12s): records or files are missing between them",
+						m.Chain.Seq, m.Chain.Hash, prev.Seq, prev.Hash)
+				}
+			} else if len(bytes.TrimSpace(line)) > 0 {
+				r, ok := parseAuditRecord(line)
+				switch {
+				case !ok:
+					return fail(prev.Seq+1, "not an audit record (edited, or cut short by a crash)")
+				case r.Seq != prev.Seq+1:
+					return fail(prev.Seq+1, "seq %d, expected %d: records were inserted or deleted", r.Seq, prev.Seq+1)
+				case r.Prev != prev.Hash:
+					return fail(prev.Seq+1, "seq %d doesn't link to the record before it: that record was edited, or records were replaced", r.Seq)
+				}
+				if !r.hashMatches() {
+					return fail(prev.Seq+1, "seq %d doesn't match its hash: the record was edited", r.Seq)
+				}
+				prev = Chain{Seq: r.Seq, Hash: r.Hash}
+				report.Records++
+			}
+		}
+		if rerr == io.EOF {
+			if lineNo == 0 {
+				return fail(prev.Seq+1, "empty file")
+			}
+			return prev, nil
+		}
+		if rerr != nil {
+			return prev, rerr
+		}
+	}
+}
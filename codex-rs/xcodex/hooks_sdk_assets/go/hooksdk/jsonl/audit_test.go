@@ -0,0 +1,404 @@
+package jsonl_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+func auditOptions() jsonl.Options {
+	return jsonl.Options{Audit: true, Keep: 100, LockTimeout: time.Minute}
+}
+
+// auditLog writes n records to a new audit log in one file and returns its path.
+func auditLog(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	if err := appendRecords(path, auditOptions(), "w", n, 0); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fileLines returns the lines of the plain file at path.
+func fileLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parseRecord(t *testing.T, line string) jsonl.AuditRecord {
+	t.Helper()
+	var r jsonl.AuditRecord
+	if err := json.Unmarshal([]byte(line), &r); err != nil {
+		t.Fatalf("record %q: %v", line, err)
+	}
+	return r
+}
+
+func TestCanonical(t *testing.T) {
+	want := `{"a":[1,2,{"c":"x y","d":null}],"b":true,"e":{}}`
+	for _, in := range []string{
+		want,
+		`{"b":true,"e":{},"a":[1,2,{"d":null,"c":"x y"}]}`,
+		"{\n  \"e\" : { },\n  \"a\" : [ 1 , 2 , { \"c\" : \"x y\" , \"d\" : null } ],\n  \"b\" : true\n}\n",
+		`{"a":[1,2,{"c":"x y","d":null}],"b":true,"e":{}}`,
+	} {
+		got, err := jsonl.Canonical([]byte(in))
+		if err != nil || string(got) != want {
+			t.Errorf("Canonical(%s) = %s, %v; want %s", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", `{"a":1`, `{"a":1} {"b":2}`, `{"a":1} x`, "not json"} {
+		if got, err := jsonl.Canonical([]byte(in)); err == nil {
+			t.Errorf("Canonical(%q) = %s, want an error", in, got)
+		}
+	}
+	if _, err := jsonl.Canonical(nil); err == nil {
+		t.Error("Canonical(nil) succeeded")
+	}
+}
+
+func TestCanonicalForm(t *testing.T) {
+	// Numbers have one form, and only what must be escaped is.
+	got, err := jsonl.Canonical([]byte(`{"z":1.50,"a":1E2,"big":12345678901234567891,"s":"<&>\u2028\u00e9\/","neg":-0.0}`))
+	want := "{\"a\":100,\"big\":12345678901234567891,\"neg\":0,\"s\":\"<&>\u2028\u00e9/\",\"z\":1.5}"
+	if err != nil || string(got) != want {
+		t.Errorf("Canonical = %s, %v; want %s", got, err, want)
+	}
+}
+
+func TestAuditRecords(t *testing.T) {
+	path := auditLog(t, 3)
+	lines := fileLines(t, path)
+	if len(lines) != 4 {
+		t.Fatalf("log = %q, want a header and 3 records", lines)
+	}
+	m, ok := jsonl.ParseMeta([]byte(lines[0]))
+	if !ok || m.Chain == nil || *m.Chain != (jsonl.Chain{}) {
+		t.Errorf("header = %s, want one starting the chain at seq 0", lines[0])
+	}
+	prev := ""
+	for i, line := range lines[1:] {
+		r := parseRecord(t, line)
+		if r.Seq != uint64(i+1) || r.Prev != prev {
+			t.Errorf("record %d = seq %d, prev %q; want %d, %q", i, r.Seq, r.Prev, i+1, prev)
+		}
+		if hash, err := r.ComputeHash(); err != nil || hash != r.Hash || len(hash) != 64 {
+			t.Errorf("record %d: hash %q, computed %q, %v", i, r.Hash, hash, err)
+		}
+		// The event is kept in canonical form, so the hash can be checked from the line alone.
+		if canonical, _ := jsonl.Canonical(r.Event); !bytes.Equal(canonical, r.Event) {
+			t.Errorf("record %d: event %s isn't canonical", i, r.Event)
+		}
+		prev = r.Hash
+	}
+
+	// Readers see the events, not the chain.
+	var d jsonl.Decoder
+	for i, line := range lines {
+		e, err := d.Decode([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && (e.Payload["writer"] != "w" || e.Payload["n"] != json.Number(string(rune('0'+i-1)))) {
+			t.Errorf("Decode(%s) = %v, want the event", line, e.Payload)
+		}
+	}
+	if report, err := jsonl.Verify([]string{path}); err != nil || report.Records != 3 || report.Files != 1 || report.Last.Hash != prev || report.Last.Seq != 3 {
+		t.Errorf("Verify = %+v, %v", report, err)
+	}
+}
+
+// TestAuditAcrossRotations checks that the chain runs on through size rotation, Rotate, and
+// compressed generations.
+func TestAuditAcrossRotations(t *testing.T) {
+	for _, compress := range []string{"", "gzip", "stream"} {
+		path := filepath.Join(t.TempDir(), "hooks.jsonl")
+		opts := rotatingOptions()
+		opts.Audit = true
+		opts.Compress = compress == "gzip"
+		opts.GzipStream = compress == "stream"
+		if err := appendRecords(path, opts, "w", 20, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := jsonl.New(path, opts).Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := appendRecords(path, opts, "x", 5, 0); err != nil {
+			t.Fatal(err)
+		}
+		files := jsonl.Files(path)
+		report, err := jsonl.Verify(files)
+		if err != nil || report.Records != 25 || report.Last.Seq != 25 || report.Files != len(files) || len(files) < 3 {
+			t.Errorf("%s: Verify(%d files) = %+v, %v", compress, len(files), report, err)
+		}
+	}
+}
+
+func TestAuditConcurrentProcesses(t *testing.T) {
+	t.Setenv("JSONL_TEST_AUDIT", "1")
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	const writers, n = 4, 25
+	appendFromProcesses(t, path, writers, n, 0)
+	report, err := jsonl.Verify(jsonl.Files(path))
+	if err != nil || report.Records != writers*n {
+		t.Errorf("Verify = %+v, %v", report, err)
+	}
+}
+
+func TestAuditSpool(t *testing.T) {
+	path, fix := unwritableLog(t)
+	opts := spoolOptions(t)
+	opts.Audit = true
+	for i := 0; i < 3; i++ {
+		if err := jsonl.New(path, opts).Append(record{Writer: "w", N: i}); !errors.Is(err, jsonl.ErrSpooled) {
+			t.Fatalf("Append: %v, want ErrSpooled", err)
+		}
+	}
+	fix()
+	if err := jsonl.New(path, opts).Append(record{Writer: "w", N: 3}); err != nil {
+		t.Fatal(err)
+	}
+	// The spooled records are linked into the chain as they are drained, before the new one.
+	report, err := jsonl.Verify([]string{path})
+	if err != nil || report.Records != 4 {
+		t.Errorf("Verify = %+v, %v", report, err)
+	}
+	for i, line := range fileLines(t, path)[1:] {
+		var r record
+		json.Unmarshal(parseRecord(t, line).Event, &r)
+		if r.N != i {
+			t.Errorf("record %d is event %d", i, r.N)
+		}
+	}
+}
+
+// TestAuditStartsNewFile checks that a log written before Audit was set is rotated away, so the
+// chain starts in a file of its own.
+func TestAuditStartsNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	if err := appendRecords(path, jsonl.Options{Keep: 100}, "plain", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendRecords(path, auditOptions(), "w", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, path+".1")["plain"]; len(got) != 2 {
+		t.Errorf("hooks.jsonl.1 has %v, want the plain records", got)
+	}
+	if report, err := jsonl.Verify([]string{path}); err != nil || report.Records != 2 {
+		t.Errorf("Verify = %+v, %v", report, err)
+	}
+	// Including the old file fails: it has no audit log header.
+	var b *jsonl.ChainBreak
+	if _, err := jsonl.Verify(jsonl.Files(path)); !errors.As(err, &b) || b.File != path+".1" || b.Line != 1 || b.Reason != "no audit log header" {
+		t.Errorf("Verify with the plain file = %v", err)
+	}
+}
+
+func TestVerifyTampering(t *testing.T) {
+	edit := func(line string, change func(*jsonl.AuditRecord)) string {
+		r := parseRecord(t, line)
+		change(&r)
+		data, _ := json.Marshal(r)
+		return string(data)
+	}
+	// The log's lines are the header, then seq 1 to 6 on lines 2 to 7.
+	tests := []struct {
+		name   string
+		tamper func([]string) []string
+		line   int
+		seq    uint64
+		reason string
+	}{
+		{"modified", func(l []string) []string {
+			l[3] = strings.Replace(l[3], `"n":2`, `"n":9`, 1)
+			return l
+		}, 4, 3, "seq 3 doesn't match its hash"},
+		{"modified and rehashed", func(l []string) []string {
+			l[3] = edit(l[3], func(r *jsonl.AuditRecord) {
+				r.Event = json.RawMessage(`{"n":9,"writer":"w"}`)
+				r.Hash, _ = r.ComputeHash()
+			})
+			return l
+		}, 5, 4, "seq 4 doesn't link to the record before it"},
+		{"reformatted", func(l []string) []string {
+			l[3] = strings.Replace(l[3], `"event":{`, `"event": {`, 1)
+			return l[:4]
+		}, 0, 0, ""}, // canonical form is what's hashed: whitespace isn't tampering
+		{"deleted", func(l []string) []string {
+			return append(l[:3:3], l[4:]...)
+		}, 4, 3, "seq 4, expected 3: records were inserted or deleted"},
+		{"duplicated", func(l []string) []string {
+			return append(l[:4:4], l[3:]...)
+		}, 5, 4, "seq 3, expected 4: records were inserted or deleted"},
+		{"inserted", func(l []string) []string {
+			forged := edit(l[3], func(r *jsonl.AuditRecord) {
+				r.Seq = 4
+				r.Prev = r.Hash
+				r.Event = json.RawMessage(`{"forged":true}`)
+				r.Hash, _ = r.ComputeHash()
+			})
+			return append(l[:4:4], append([]string{forged}, l[4:]...)...)
+		}, 6, 5, "seq 4, expected 5"},
+		{"swapped", func(l []string) []string {
+			l[2], l[3] = l[3], l[2]
+			return l
+		}, 3, 2, "seq 3, expected 2"},
+		{"cut short", func(l []string) []string {
+			l[4] = l[4][:len(l[4])/2]
+			return l
+		}, 5, 4, "not an audit record"},
+		{"not a record", func(l []string) []string {
+			l[4] = `{"writer":"w","n":3}`
+			return l
+		}, 5, 4, "not an audit record"},
+		{"no header", func(l []string) []string {
+			return l[1:]
+		}, 1, 1, "no audit log header"},
+		{"empty", func(l []string) []string {
+			return nil
+		}, 0, 1, "empty file"},
+	}
+	for _, tt := range tests {
+		path := auditLog(t, 6)
+		lines := tt.tamper(fileLines(t, path))
+		if lines == nil {
+			writeFile(t, path, nil)
+		} else {
+			writeLines(t, path, lines)
+		}
+		report, err := jsonl.Verify([]string{path})
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("%s: Verify = %v", tt.name, err)
+			}
+			continue
+		}
+		var b *jsonl.ChainBreak
+		if !errors.As(err, &b) || b.File != path || b.Line != tt.line || b.Seq != tt.seq || !strings.HasPrefix(b.Reason, tt.reason) {
+			t.Errorf("%s: Verify = %#v, want line %d seq %d %q", tt.name, err, tt.line, tt.seq, tt.reason)
+			continue
+		}
+		// The report covers the records before the break.
+		if report.Records != int(tt.seq)-1 || report.Last.Seq != tt.seq-1 {
+			t.Errorf("%s: report = %+v", tt.name, report)
+		}
+	}
+
+	// Records cut off the end don't show: Verify reports the last hash to keep elsewhere.
+	path := auditLog(t, 6)
+	lines := fileLines(t, path)
+	writeLines(t, path, lines[:len(lines)-1])
+	if report, err := jsonl.Verify([]string{path}); err != nil || report.Last.Seq != 5 {
+		t.Errorf("Verify of a cut-off log = %+v, %v", report, err)
+	}
+}
+
+// legacyRecord returns the audit record line for event as records were written before Canonical
+// followed canonicaljson: event is in that older form, and hashed as it is.
+func legacyRecord(seq uint64, prev, event string) (line, hash string) {
+	sum := sha256.Sum256([]byte(`{"event":` + event + `,"prev":` + strconv.Quote(prev) + `,"seq":` + strconv.FormatUint(seq, 10) + `}`))
+	hash = hex.EncodeToString(sum[:])
+	return fmt.Sprintf(`{"seq":%d,"prev":%q,"hash":%q,"event":%s}`, seq, prev, hash, event), hash
+}
+
+func TestVerifyLegacyRecords(t *testing.T) {
+	// Events whose older canonical form isn't today's: numbers as written, U+2028 escaped.
+	events := []string{`{"n":1.50,"writer":"w"}`, `{"n":1E2,"writer":"w"}`, `{"s":"a\u2028b","writer":"w"}`}
+	path := auditLog(t, 1)
+	lines := fileLines(t, path)[:1]
+	prev := ""
+	for i, event := range events {
+		var line string
+		line, prev = legacyRecord(uint64(i+1), prev, event)
+		lines = append(lines, line)
+	}
+	writeLines(t, path, lines)
+	if report, err := jsonl.Verify([]string{path}); err != nil || report.Records != 3 || report.Last.Hash != prev {
+		t.Fatalf("Verify of a log hashed the old way = %+v, %v", report, err)
+	}
+
+	// New records go on from the old ones.
+	if err := appendRecords(path, auditOptions(), "w", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if r := parseRecord(t, fileLines(t, path)[4]); r.Seq != 4 || r.Prev != prev {
+		t.Errorf("next record = seq %d, prev %q; want 4, %q", r.Seq, r.Prev, prev)
+	}
+	if report, err := jsonl.Verify([]string{path}); err != nil || report.Records != 5 {
+		t.Errorf("Verify of old and new records = %+v, %v", report, err)
+	}
+
+	// An edited old record is still caught.
+	lines = fileLines(t, path)
+	lines[2] = strings.Replace(lines[2], `1E2`, `1E3`, 1)
+	writeLines(t, path, lines)
+	var b *jsonl.ChainBreak
+	if _, err := jsonl.Verify([]string{path}); !errors.As(err, &b) || b.Seq != 2 || !strings.HasPrefix(b.Reason, "seq 2 doesn't match its hash") {
+		t.Errorf("Verify of an edited old record = %v", err)
+	}
+}
+
+func TestVerifyFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	opts := auditOptions()
+	for i := 0; i < 3; i++ {
+		if err := appendRecords(path, opts, "w", 2, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := jsonl.New(path, opts).Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := appendRecords(path, opts, "w", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	files := jsonl.Files(path)
+	if len(files) != 4 {
+		t.Fatalf("files = %q", files)
+	}
+
+	// The oldest file may have had generations before it rotated out.
+	if report, err := jsonl.Verify(files[1:]); err != nil || report.First.Seq != 2 || report.Records != 6 || report.Last.Seq != 8 {
+		t.Errorf("Verify without the oldest file = %+v, %v", report, err)
+	}
+
+	// A file missing from the middle breaks the chain between the files either side.
+	var b *jsonl.ChainBreak
+	_, err := jsonl.Verify([]string{files[0], files[2], files[3]})
+	if !errors.As(err, &b) || b.File != files[2] || b.Line != 0 || !strings.Contains(b.Reason, "records or files are missing") {
+		t.Errorf("Verify without a middle file = %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), ":0:") {
+		t.Errorf("break between files = %q, with a line number", err)
+	}
+	if _, err := jsonl.Verify([]string{files[1], files[0]}); !errors.As(err, &b) || b.File != files[0] {
+		t.Errorf("Verify out of order = %v", err)
+	}
+	if _, err := jsonl.Verify([]string{path + ".missing"}); err == nil || errors.As(err, &b) {
+		t.Errorf("Verify of a missing file = %v, want the open error", err)
+	}
+}
@@ -0,0 +1,221 @@
+package jsonl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	gzExt  = ".gz"
+	tmpExt = ".tmp"
+
+	// staleTmpAge is how old a leftover compression temp file must be before it is assumed to be
+	// from a crashed process rather than one still compressing.
+	staleTmpAge = time.Hour
+)
+
+// gzipMember returns data compressed as one complete gzip member, for Options.GzipStream.
+func gzipMember(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// compressGenerations gzips every uncompressed rotated generation and legacy file.
+//
+// The slow part runs without the lock: the generation is compressed into a temp file, then the
+// lock is retaken to swap it in. A crash at any point leaves the uncompressed file intact (at
+// worst next to a stray temp file or a complete .gz, both resolved by a later pass).
+func (w *Writer) compressGenerations() error {
+	if err := w.cleanupCompression(); err != nil {
+		return err
+	}
+	gens, err := w.generations()
+	if err != nil {
+		return err
+	}
+	numbers := make([]int, 0, len(gens))
+	for n, g := range gens {
+		if g.plain && !g.gz {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	paths := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		paths = append(paths, w.generation(n))
+	}
+	legacy, err := w.legacyFiles()
+	if err != nil {
+		return err
+	}
+	for n, f := range legacy {
+		if f.plain && !f.gz {
+			paths = append(paths, w.legacyName(n))
+		}
+	}
+	for _, path := range paths {
+		if err := w.compressGeneration(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) compressGeneration(plain string) error {
+	src, err := os.Open(plain)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Another process compressed or pruned it first.
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+	srcInfo, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(plain), filepath.Base(plain)+gzExt+tmpExt+"-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	zw := gzip.NewWriter(tmp)
+	if _, err := io.Copy(zw, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	src.Close()
+
+	lock, err := w.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// A rotation may have shifted the file to a higher generation while it was being compressed,
+	// so find where it is now.
+	current, ok, err := w.findGeneration(srcInfo)
+	if err != nil || !ok {
+		return err
+	}
+	if err := os.Rename(tmpPath, current+gzExt); err != nil {
+		return err
+	}
+	if w.opts.Sync {
+		// The .gz must be in place before the plain copy goes.
+		if err := syncDir(filepath.Dir(current)); err != nil {
+			return err
+		}
+	}
+	return os.Remove(current)
+}
+
+// findGeneration returns the path of the uncompressed rotated generation or legacy file that is
+// the same file as info.
+func (w *Writer) findGeneration(info os.FileInfo) (string, bool, error) {
+	gens, err := w.generations()
+	if err != nil {
+		return "", false, err
+	}
+	var paths []string
+	for n, g := range gens {
+		if g.plain {
+			paths = append(paths, w.generation(n))
+		}
+	}
+	legacy, err := w.legacyFiles()
+	if err != nil {
+		return "", false, err
+	}
+	for n, f := range legacy {
+		if f.plain {
+			paths = append(paths, w.legacyName(n))
+		}
+	}
+	for _, path := range paths {
+		if cur, err := os.Stat(path); err == nil && os.SameFile(cur, info) {
+			return path, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// cleanupCompression resolves what a crashed compression can leave behind: a generation (or
+// legacy file) with both a plain file and a complete .gz (the .gz is only renamed into place once
+// fully written, so the plain copy is redundant) and stale temp files.
+func (w *Writer) cleanupCompression() error {
+	lock, err := w.lock()
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	gens, err := w.generations()
+	if err != nil {
+		return err
+	}
+	for n, g := range gens {
+		if g.plain && g.gz {
+			if err := os.Remove(w.generation(n)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	legacy, err := w.legacyFiles()
+	if err != nil {
+		return err
+	}
+	for n, f := range legacy {
+		if f.plain && f.gz {
+			if err := os.Remove(w.legacyName(n)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	dir := filepath.Dir(w.path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	prefix := filepath.Base(w.path) + "."
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.Contains(name, gzExt+tmpExt+"-") {
+			continue
+		}
+		info, err := e.Info()
+		if err == nil && time.Since(info.ModTime()) > staleTmpAge {
+			_ = os.Remove(filepath.Join(dir, name))
+		}
+	}
+	return nil
+}
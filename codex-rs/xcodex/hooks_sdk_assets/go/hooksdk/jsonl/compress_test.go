@@ -0,0 +1,278 @@
+package jsonl_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+func gunzipFile(t *testing.T, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return data
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompressRotatedGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	w := jsonl.New(path, jsonl.Options{Keep: 3, Compress: true})
+	var rotated [][]byte
+	for gen := 0; gen < 3; gen++ {
+		for i := 0; i < 5; i++ {
+			if err := w.Append(record{Writer: "w", N: gen*10 + i}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rotated = append(rotated, data)
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// hooks.jsonl.1.gz is the newest rotated file.
+	for i, want := range rotated {
+		gen := path + "." + strconv.Itoa(len(rotated)-i)
+		if got := gunzipFile(t, gen+".gz"); !bytes.Equal(got, want) {
+			t.Errorf("%s.gz = %q, want %q", gen, got, want)
+		}
+		if _, err := os.Stat(gen); !os.IsNotExist(err) {
+			t.Errorf("%s: the uncompressed copy is still there", gen)
+		}
+	}
+}
+
+func TestCompressAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	content := []byte(`{"writer":"w","n":1}` + "\n")
+	// A crash after the .gz was renamed into place, before the plain copy was removed, and the
+	// temp file of a compression that never finished.
+	writeFile(t, path+".1", content)
+	writeFile(t, path+".1.gz", gzipData(t, content))
+	stale := path + ".2.gz.tmp-123"
+	writeFile(t, stale, []byte("partial"))
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	w := jsonl.New(path, jsonl.Options{Keep: 5, Compress: true})
+	if err := w.Append(record{Writer: "w", N: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzipFile(t, path+".2.gz"); !bytes.Equal(got, content) {
+		t.Errorf("hooks.jsonl.2.gz = %q, want %q", got, content)
+	}
+	for _, leftover := range []string{path + ".2", stale} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("%s wasn't cleaned up", leftover)
+		}
+	}
+}
+
+func TestPruneCountsCompressedAndPlain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	line := []byte(`{"writer":"w","n":0}` + "\n")
+	writeFile(t, path+".1.gz", gzipData(t, line))
+	writeFile(t, path+".2", line)
+	writeFile(t, path+".3.gz", gzipData(t, line))
+	writeFile(t, path+".4", line)
+
+	w := jsonl.New(path, jsonl.Options{Keep: 2, Compress: true})
+	if err := w.Append(record{Writer: "w", N: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(path + ".[0-9]*")
+	want := map[string]bool{path + ".1.gz": true, path + ".2.gz": true}
+	if len(files) != len(want) {
+		t.Errorf("rotated files = %q, want %d", files, len(want))
+	}
+	for _, f := range files {
+		if !want[f] {
+			t.Errorf("unexpected rotated file %s", f)
+		}
+	}
+}
+
+// members decompresses each gzip member of the file at path on its own.
+func members(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	var out []string
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return out
+		}
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			t.Fatalf("%s: member %d: %v", path, len(out), err)
+		}
+		zr.Multistream(false)
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("%s: member %d: %v", path, len(out), err)
+		}
+		out = append(out, string(data))
+	}
+}
+
+// checkStream fails unless every file of the gzip-streamed log at path is a stream of members
+// that each hold one whole record, and every writer's n records are in it exactly once.
+func checkStream(t *testing.T, path string, writers, n int) {
+	t.Helper()
+	files, err := filepath.Glob(path + "*.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s was written uncompressed", path)
+	}
+	got := map[string]map[int]bool{}
+	for _, file := range files {
+		ms := members(t, file)
+		// Read as one stream, as zcat does, the file holds the members in order.
+		if all := gunzipFile(t, file); string(all) != strings.Join(ms, "") {
+			t.Errorf("%s: the stream differs from its members", file)
+		}
+		for _, m := range ms {
+			var r record
+			if strings.Count(m, "\n") != 1 || !strings.HasSuffix(m, "\n") || json.Unmarshal([]byte(m), &r) != nil {
+				t.Errorf("%s: member %q isn't one record", file, m)
+				continue
+			}
+			if got[r.Writer] == nil {
+				got[r.Writer] = map[int]bool{}
+			}
+			if got[r.Writer][r.N] {
+				t.Errorf("writer %s: record %d written twice", r.Writer, r.N)
+			}
+			got[r.Writer][r.N] = true
+		}
+	}
+	for w := 0; w < writers; w++ {
+		if len(got[strconv.Itoa(w)]) != n {
+			t.Errorf("writer %d: %d of %d records in the log", w, len(got[strconv.Itoa(w)]), n)
+		}
+	}
+}
+
+func TestGzipStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	w := jsonl.New(path, jsonl.Options{Keep: 2, GzipStream: true, Header: []byte("# header\n")})
+	if w.Path() != path+".gz" {
+		t.Errorf("Path = %s, want %s.gz", w.Path(), path)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.Append(record{Writer: "w", N: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The header is a member of its own, then one member per record.
+	want := []string{"# header\n", `{"writer":"w","n":0}` + "\n", `{"writer":"w","n":1}` + "\n", `{"writer":"w","n":2}` + "\n"}
+	if got := members(t, w.Path()); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("members = %q, want %q", got, want)
+	}
+
+	// A rotated stream becomes hooks.jsonl.1.gz, and the next file starts with the header again.
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Append(record{Writer: "w", N: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := members(t, path+".1.gz"); len(got) != 4 {
+		t.Errorf("hooks.jsonl.1.gz has %d members, want 4", len(got))
+	}
+	if got := members(t, w.Path()); len(got) != 2 || got[0] != "# header\n" {
+		t.Errorf("members after rotation = %q", got)
+	}
+	for _, plain := range []string{path, path + ".1"} {
+		if _, err := os.Stat(plain); !os.IsNotExist(err) {
+			t.Errorf("%s exists", plain)
+		}
+	}
+}
+
+func TestGzipStreamConcurrentAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	opts := rotatingOptions()
+	opts.GzipStream = true
+	const writers, n = 8, 40
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			if err := appendRecords(path, opts, strconv.Itoa(w), n, 0); err != nil {
+				t.Error(err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if files, _ := filepath.Glob(path + ".*.gz"); len(files) == 0 {
+		t.Error("the stream never rotated")
+	}
+	checkStream(t, path, writers, n)
+}
+
+func TestGzipStreamConcurrentProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	t.Setenv("JSONL_TEST_GZIP", "1")
+	const writers, n = 6, 30
+	appendFromProcesses(t, path, writers, n, 100)
+	checkStream(t, path, writers, n)
+}
@@ -0,0 +1,306 @@
+package jsonl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultFollowInterval is how often Follower.Follow checks the log for new records.
+const DefaultFollowInterval = 250 * time.Millisecond
+
+// followTail is how many of the bytes last read a Follower keeps, to tell the file it reads from
+// a new one with the same identity.
+const followTail = 64
+
+// Follower reads the records appended to a log as they are written, as `tail -F` does. It follows
+// the path, not the file: when the log is rotated it reads what was written to the old file before
+// the rotation (found as `<path>.1`, or `<path>.1.gz` once compressed), then the new file from its
+// start; when the log is truncated it starts over. Logs written with Options.GzipStream and
+// FormatPretty are read too. Records a rotation deletes (Keep is 0), or that two rotations between
+// polls move out of reach, are missed.
+//
+// The file is only open while it is read, so a Follower never keeps a writer from rotating it
+// (Windows can't rename an open file).
+type Follower struct {
+	// Path is the active log file: Writer.Path.
+	Path string
+	// Interval is how often Follow polls; zero means DefaultFollowInterval.
+	Interval time.Duration
+	// FromStart reads the records already in the log first. By default only those appended after
+	// the first Poll are read.
+	FromStart bool
+
+	started  bool
+	info     os.FileInfo // the file being read; nil until it exists
+	off      int64       // how much of it has been read
+	detected bool        // whether gz is known yet
+	gz       bool        // the file is a stream of gzip members
+	raw      []byte      // gz: the start of a member not completely written yet
+	partial  []byte      // the start of a line not completely written yet
+	tail     []byte      // the last bytes read, ending at off
+	split    splitter
+}
+
+// NewFollower returns a Follower of the log at path, starting at its end.
+func NewFollower(path string) *Follower {
+	return &Follower{Path: path}
+}
+
+// Follow calls fn with each record appended to the log (see ScanRecords) until ctx is done, when
+// it returns nil, or fn or reading the log fails.
+func (f *Follower) Follow(ctx context.Context, fn func(rec []byte) error) error {
+	interval := f.Interval
+	if interval <= 0 {
+		interval = DefaultFollowInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := f.Poll(fn); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll calls fn with each record appended to the log since the last Poll. The first Poll only
+// notes where the log ends, unless FromStart is set. A log that doesn't exist yet has no records.
+func (f *Follower) Poll(fn func(rec []byte) error) error {
+	info, err := stat(f.Path)
+	if err != nil {
+		return err
+	}
+	if !f.started {
+		f.started = true
+		if info != nil && !f.FromStart {
+			f.info, f.off = info, info.Size()
+			f.tail = f.readTail()
+			return nil
+		}
+	}
+	// The log was rotated or deleted, or it shrank: truncated, or a new file reusing the identity
+	// of the old one, deleted once compressed. Finish the old file, wherever it went, then start
+	// on the new one.
+	if f.info != nil && (info == nil || !os.SameFile(f.info, info) || info.Size() < f.off ||
+		info.Size() > f.off && f.replaced()) {
+		if err := f.drainRotated(fn); err != nil {
+			return err
+		}
+		f.restart()
+	}
+	if info == nil {
+		return nil
+	}
+	f.info = info
+	file, err := os.Open(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	return f.read(file, fn)
+}
+
+// readTail reads the followTail bytes of the file at f.Path that end at f.off.
+func (f *Follower) readTail() []byte {
+	n := int64(followTail)
+	if f.off < n {
+		n = f.off
+	}
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	tail := make([]byte, n)
+	if _, err := file.ReadAt(tail, f.off-n); err != nil {
+		return nil
+	}
+	return tail
+}
+
+// replaced reports whether the file at f.Path, which has the identity of the file being read and
+// has grown, is a new file: the file deleted once compressed may have its identity reused by the
+// next one, which then has other bytes where the old one ended.
+func (f *Follower) replaced() bool {
+	if len(f.tail) == 0 {
+		return false
+	}
+	tail := f.readTail()
+	return tail != nil && !bytes.Equal(tail, f.tail)
+}
+
+// restart forgets the file being read, to read the one at f.Path from its start.
+func (f *Follower) restart() {
+	*f = Follower{Path: f.Path, Interval: f.Interval, FromStart: f.FromStart, started: true}
+}
+
+// stat is os.Stat, with a nil FileInfo for a file that doesn't exist.
+func stat(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// On Windows the file's identity is only looked up (by path) when it is first compared; do it
+	// now, before a rotation changes which file the path names.
+	os.SameFile(info, info)
+	return info, nil
+}
+
+// read reads file, the file f.info, from f.off to its end.
+func (f *Follower) read(file *os.File, fn func(rec []byte) error) error {
+	if !f.detected {
+		var magic [2]byte
+		if n, _ := file.ReadAt(magic[:], 0); n < len(magic) {
+			// Too little written yet to tell.
+			return nil
+		}
+		f.gz, f.detected = magic[0] == 0x1f && magic[1] == 0x8b, true
+	}
+	if _, err := file.Seek(f.off, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			f.off += int64(n)
+			tail := append(f.tail, buf[:n]...)
+			if len(tail) > followTail {
+				tail = tail[len(tail)-followTail:]
+			}
+			f.tail = append([]byte(nil), tail...)
+			if err := f.consume(buf[:n], fn); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// Writers append a record with one write, so when everything read ends a line, a pretty record
+	// that is valid JSON is complete, without waiting for the separator of the next one.
+	if len(f.partial) == 0 && len(f.raw) == 0 && f.split.inPretty && json.Valid(f.split.pretty) {
+		return f.split.flush(fn)
+	}
+	return nil
+}
+
+// consume takes data read from the file.
+func (f *Follower) consume(data []byte, fn func(rec []byte) error) error {
+	if !f.gz {
+		return f.lines(data, fn)
+	}
+	f.raw = append(f.raw, data...)
+	for len(f.raw) > 0 {
+		// A bytes.Reader is read byte by byte, so its position after a member is the end of the
+		// member.
+		r := bytes.NewReader(f.raw)
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		zr.Multistream(false)
+		out, err := io.ReadAll(zr)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f.raw = f.raw[len(f.raw)-r.Len():]
+		if err := f.lines(out, fn); err != nil {
+			return err
+		}
+	}
+	f.raw = nil
+	return nil
+}
+
+// lines splits data (decompressed, for gz) into lines for the splitter, keeping an incomplete last line for
+// later.
+func (f *Follower) lines(data []byte, fn func(rec []byte) error) error {
+	f.partial = append(f.partial, data...)
+	for {
+		i := bytes.IndexByte(f.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := f.partial[:i+1]
+		if err := f.split.line(line, fn); err != nil {
+			return err
+		}
+		f.partial = f.partial[i+1:]
+	}
+	if len(f.partial) == 0 {
+		f.partial = nil
+	} else {
+		f.partial = append([]byte(nil), f.partial...)
+	}
+	return nil
+}
+
+// drainRotated reads the rest of the file f.info, which is no longer at f.Path: renamed to the
+// first generation, or, once compressed, gone with a gzipped copy in its place.
+func (f *Follower) drainRotated(fn func(rec []byte) error) error {
+	base := strings.TrimSuffix(f.Path, gzExt)
+	for _, gen := range []string{base + ".1", base + ".1" + gzExt} {
+		info, err := stat(gen)
+		if err != nil || info == nil {
+			continue
+		}
+		if os.SameFile(f.info, info) {
+			file, err := os.Open(gen)
+			if err != nil {
+				return nil
+			}
+			defer file.Close()
+			if err := f.read(file, fn); err != nil {
+				return err
+			}
+			return f.split.flush(fn)
+		}
+		// The compressed copy of a plain file is new, written after the rotation.
+		if !f.gz && strings.HasSuffix(gen, gzExt) && !info.ModTime().Before(f.info.ModTime()) {
+			r, err := Open(gen)
+			if err != nil {
+				return nil
+			}
+			defer r.Close()
+			if _, err := io.CopyN(io.Discard, r, f.off); err != nil {
+				return nil
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil
+			}
+			if err := f.lines(data, fn); err != nil {
+				return err
+			}
+			return f.split.flush(fn)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package jsonl_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// follower collects what a Follower reads.
+type follower struct {
+	*jsonl.Follower
+	got []string
+}
+
+// newFollower returns a follower of path that has polled once.
+func newFollower(t *testing.T, path string, fromStart bool) *follower {
+	t.Helper()
+	f := &follower{Follower: jsonl.NewFollower(path)}
+	f.FromStart = fromStart
+	f.poll(t)
+	return f
+}
+
+// poll polls once and returns the records read.
+func (f *follower) poll(t *testing.T) []string {
+	t.Helper()
+	f.got = nil
+	if err := f.Poll(func(rec []byte) error {
+		f.got = append(f.got, string(rec))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return f.got
+}
+
+// line is the line appendN writes for record n.
+func line(n int) string {
+	return `{"writer":"w","n":` + strconv.Itoa(n) + `}`
+}
+
+func appendN(t *testing.T, w *jsonl.Writer, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		if err := w.Append(record{Writer: "w", N: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// appendRaw appends data to path as it is, bypassing the Writer.
+func appendRaw(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	w := jsonl.New(path, jsonl.Options{})
+	appendN(t, w, 0, 2)
+
+	// A new Follower starts at the end of the log.
+	f := newFollower(t, path, false)
+	if len(f.got) != 0 {
+		t.Errorf("first poll read %q", f.got)
+	}
+	appendN(t, w, 2, 4)
+	if got := f.poll(t); !reflect.DeepEqual(got, []string{line(2), line(3)}) {
+		t.Errorf("appended records = %q", got)
+	}
+	if got := f.poll(t); len(got) != 0 {
+		t.Errorf("nothing appended, read %q", got)
+	}
+
+	// A line is only read once it is complete.
+	appendRaw(t, path, `{"writer":"w",`)
+	if got := f.poll(t); len(got) != 0 {
+		t.Errorf("partial line read: %q", got)
+	}
+	appendRaw(t, path, `"n":4}`+"\n\n")
+	if got := f.poll(t); !reflect.DeepEqual(got, []string{line(4)}) {
+		t.Errorf("completed line = %q", got)
+	}
+
+	// FromStart reads the records already there.
+	if got := newFollower(t, path, true).got; len(got) != 5 || got[0] != line(0) {
+		t.Errorf("FromStart read %q", got)
+	}
+}
+
+func TestFollowMissingLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	f := newFollower(t, path, false)
+	if got := f.poll(t); len(got) != 0 {
+		t.Errorf("missing log read %q", got)
+	}
+	// A log created after the first poll is read from its start.
+	appendN(t, jsonl.New(path, jsonl.Options{}), 0, 2)
+	if got := f.poll(t); !reflect.DeepEqual(got, []string{line(0), line(1)}) {
+		t.Errorf("new log = %q", got)
+	}
+	// A deleted log, then a new one.
+	os.Remove(path)
+	if got := f.poll(t); len(got) != 0 {
+		t.Errorf("deleted log read %q", got)
+	}
+	appendN(t, jsonl.New(path, jsonl.Options{}), 5, 6)
+	if got := f.poll(t); !reflect.DeepEqual(got, []string{line(5)}) {
+		t.Errorf("recreated log = %q", got)
+	}
+}
+
+func TestFollowRotation(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts jsonl.Options
+	}{
+		{"plain", jsonl.Options{Keep: 3}},
+		{"compressed", jsonl.Options{Keep: 3, Compress: true}},
+		{"gzip stream", jsonl.Options{Keep: 3, GzipStream: true}},
+	} {
+		path := filepath.Join(t.TempDir(), "hooks.jsonl")
+		w := jsonl.New(path, tt.opts)
+		appendN(t, w, 0, 1)
+		f := newFollower(t, w.Path(), false)
+
+		// Records written before a rotation and after it, all between two polls.
+		appendN(t, w, 1, 3)
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		appendN(t, w, 3, 5)
+		want := []string{line(1), line(2), line(3), line(4)}
+		if got := f.poll(t); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: across a rotation read %q, want %q", tt.name, got, want)
+		}
+		appendN(t, w, 5, 6)
+		if got := f.poll(t); !reflect.DeepEqual(got, []string{line(5)}) {
+			t.Errorf("%s: after the rotation read %q", tt.name, got)
+		}
+	}
+}
+
+func TestFollowTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	appendRaw(t, path, line(0)+"\n"+line(1)+"\n")
+	f := newFollower(t, path, false)
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendRaw(t, path, line(2)+"\n")
+	if got := f.poll(t); !reflect.DeepEqual(got, []string{line(2)}) {
+		t.Errorf("after truncation read %q", got)
+	}
+}
+
+func TestFollowGzipStreamPartialMember(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	w := jsonl.New(path, jsonl.Options{GzipStream: true})
+	appendN(t, w, 0, 1)
+	f := newFollower(t, w.Path(), false)
+
+	member := gzipData(t, []byte(line(1)+"\n"))
+	appendRaw(t, w.Path(), string(member[:len(member)/2]))
+	if got := f.poll(t); len(got) != 0 {
+		t.Errorf("half a member read: %q", got)
+	}
+	appendRaw(t, w.Path(), string(member[len(member)/2:]))
+	appendN(t, w, 2, 3)
+	if got := f.poll(t); !reflect.DeepEqual(got, []string{line(1), line(2)}) {
+		t.Errorf("completed members = %q", got)
+	}
+}
+
+func TestFollowPretty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	w := jsonl.New(path, jsonl.Options{Format: jsonl.FormatPretty})
+	f := newFollower(t, path, false)
+	appendN(t, w, 0, 2)
+	// The last record is read without waiting for the next separator.
+	got := f.poll(t)
+	if len(got) != 2 {
+		t.Fatalf("pretty records = %q", got)
+	}
+	for i, rec := range got {
+		var r record
+		if err := json.Unmarshal([]byte(rec), &r); err != nil || r.N != i {
+			t.Errorf("record %d = %q: %v", i, rec, err)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	w := jsonl.New(path, jsonl.Options{})
+	f := jsonl.NewFollower(path)
+	f.Interval = 10 * time.Millisecond
+	f.FromStart = true
+	appendN(t, w, 0, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- f.Follow(ctx, func(rec []byte) error {
+			got <- string(rec)
+			return nil
+		})
+	}()
+	if rec := <-got; rec != line(0) {
+		t.Errorf("first record = %q", rec)
+	}
+	appendN(t, w, 1, 2)
+	select {
+	case rec := <-got:
+		if rec != line(1) {
+			t.Errorf("followed record = %q", rec)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the appended record wasn't followed")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Follow = %v after cancel, want nil", err)
+	}
+
+	// An error from fn ends Follow.
+	boom := errors.New("boom")
+	f = jsonl.NewFollower(path)
+	f.FromStart = true
+	if err := f.Follow(context.Background(), func([]byte) error { return boom }); !errors.Is(err, boom) {
+		t.Errorf("Follow = %v, want fn's error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package jsonl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Format is how Writer.Append encodes a record.
+type Format string
+
+// Formats accepted by ParseFormat and CODEX_HOOKLOG_FORMAT.
+const (
+	// FormatJSONL is one line of JSON per record, as encoding/json writes it (the default).
+	FormatJSONL Format = "jsonl"
+	// FormatPretty is indented JSON for reading by eye, each record starting with a `---` line.
+	// Records span lines, so the file is no longer JSON Lines; split it on the `---` lines.
+	FormatPretty Format = "pretty"
+	// FormatCompactKeys is one line of JSON per record with the keys of every object sorted,
+	// struct fields included, so identical records are byte-identical.
+	FormatCompactKeys Format = "compactkeys"
+)
+
+// prettySeparator starts every FormatPretty record.
+const prettySeparator = "---\n"
+
+// ParseFormat parses a Format name, case-insensitively; "" is FormatJSONL.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FormatJSONL, nil
+	case FormatJSONL, FormatPretty, FormatCompactKeys:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown log format %q (want jsonl, pretty, or compactkeys)", s)
+}
+
+// Marshal encodes v as one record in format f, ending in a newline. An empty or unknown Format is
+// FormatJSONL.
+func (f Format) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	switch f {
+	case FormatPretty:
+		var buf bytes.Buffer
+		buf.WriteString(prettySeparator)
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	case FormatCompactKeys:
+		// Decoding into maps and encoding again sorts the keys; json.Number keeps numbers as they
+		// were written.
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var generic any
+		if err := dec.Decode(&generic); err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(generic); err != nil {
+			return nil, err
+		}
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,134 @@
+package jsonl_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// fixtureEvent is the payload the format snapshots encode: struct fields out of key order, a
+// nested map, and a number that must keep its formatting.
+type fixtureEvent struct {
+	Type      string         `json:"xcodex_event_type"`
+	SessionID string         `json:"session_id"`
+	ToolInput map[string]any `json:"tool_input"`
+	ExitCode  int            `json:"exit_code"`
+	Duration  json.Number    `json:"duration_ms"`
+}
+
+var fixture = fixtureEvent{
+	Type:      "tool-call-finished",
+	SessionID: "s1",
+	ToolInput: map[string]any{"cwd": "/tmp", "command": "ls"},
+	Duration:  "1.50",
+}
+
+func TestFormatMarshal(t *testing.T) {
+	tests := map[jsonl.Format]string{
+		jsonl.FormatJSONL: `{"xcodex_event_type":"tool-call-finished","session_id":"s1","tool_input":{"command":"ls","cwd":"/tmp"},"exit_code":0,"duration_ms":1.50}` + "\n",
+		jsonl.FormatPretty: `---
+{
+  "xcodex_event_type": "tool-call-finished",
+  "session_id": "s1",
+  "tool_input": {
+    "command": "ls",
+    "cwd": "/tmp"
+  },
+  "exit_code": 0,
+  "duration_ms": 1.50
+}
+`,
+		jsonl.FormatCompactKeys: `{"duration_ms":1.50,"exit_code":0,"session_id":"s1","tool_input":{"command":"ls","cwd":"/tmp"},"xcodex_event_type":"tool-call-finished"}` + "\n",
+		// An empty or unknown Format is FormatJSONL.
+		"":        `{"xcodex_event_type":"tool-call-finished","session_id":"s1","tool_input":{"command":"ls","cwd":"/tmp"},"exit_code":0,"duration_ms":1.50}` + "\n",
+		"unknown": `{"xcodex_event_type":"tool-call-finished","session_id":"s1","tool_input":{"command":"ls","cwd":"/tmp"},"exit_code":0,"duration_ms":1.50}` + "\n",
+	}
+	for f, want := range tests {
+		got, err := f.Marshal(fixture)
+		if err != nil || string(got) != want {
+			t.Errorf("%q: Marshal = %s, %v; want\n%s", f, got, err, want)
+		}
+	}
+	if _, err := jsonl.FormatPretty.Marshal(func() {}); err == nil {
+		t.Error("Marshal of a func succeeded")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for s, want := range map[string]jsonl.Format{
+		"":              jsonl.FormatJSONL,
+		"jsonl":         jsonl.FormatJSONL,
+		" Pretty ":      jsonl.FormatPretty,
+		"COMPACTKEYS":   jsonl.FormatCompactKeys,
+		"compactkeys\n": jsonl.FormatCompactKeys,
+	} {
+		if got, err := jsonl.ParseFormat(s); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"json", "yaml", "pretty-ish"} {
+		if _, err := jsonl.ParseFormat(s); err == nil {
+			t.Errorf("ParseFormat(%q) succeeded", s)
+		}
+	}
+
+	t.Setenv("CODEX_HOOKLOG_FORMAT", "pretty")
+	if o := jsonl.OptionsFromEnv(); o.Format != jsonl.FormatPretty {
+		t.Errorf("Format = %q, want pretty", o.Format)
+	}
+	t.Setenv("CODEX_HOOKLOG_FORMAT", "fancy")
+	if o := jsonl.OptionsFromEnv(); o.Format != "" {
+		t.Errorf("unknown format gave %q, want the default", o.Format)
+	}
+}
+
+func TestConcurrentPrettyAppends(t *testing.T) {
+	// Records span lines, and still never interleave.
+	path := filepath.Join(t.TempDir(), "hooks.log")
+	opts := jsonl.Options{Format: jsonl.FormatPretty, LockTimeout: time.Minute}
+	const writers, n = 8, 40
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if err := jsonl.New(path, opts).Append(record{Writer: strconv.Itoa(w), N: i, Pad: strings.Repeat("p", 2048)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "---\n") {
+		t.Fatalf("log doesn't start with a separator: %.40q", data)
+	}
+	next := map[string]int{}
+	for _, chunk := range strings.Split(string(data), "---\n")[1:] {
+		var r record
+		if err := json.Unmarshal([]byte(chunk), &r); err != nil {
+			t.Fatalf("record %.60q: %v", chunk, err)
+		}
+		if r.N != next[r.Writer] {
+			t.Errorf("writer %s: record %d after %d", r.Writer, r.N, next[r.Writer]-1)
+		}
+		next[r.Writer] = r.N + 1
+	}
+	for w := 0; w < writers; w++ {
+		if got := next[strconv.Itoa(w)]; got != n {
+			t.Errorf("writer %d: %d records, want %d", w, got, n)
+		}
+	}
+}
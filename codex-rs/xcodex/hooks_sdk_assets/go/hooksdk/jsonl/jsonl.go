@@ -0,0 +1,574 @@
+// Package jsonl appends JSON records to a log file, one per line (or indented, see Format), with
+// size-based rotation.
+//
+// It is safe to use from many hook processes at once: every append (and any rotation it triggers)
+// happens under an exclusive lock on `<path>.lock`, so no line is lost or split when several
+// processes rotate at the same moment. Waiting for the lock is bounded (Options.LockTimeout), so a
+// stuck writer makes other hooks fail with ErrLockTimeout instead of hanging the host.
+//
+// A writer killed in the middle of a line (or a power loss) can leave the file ending in a partial
+// line. The next append finishes that line with a newline before writing its own, so the damage
+// stays one unparsable line: readers that skip lines that aren't valid JSON lose only that record.
+// Without Options.Sync, records the OS hasn't written to disk yet are lost on a power loss; with
+// it, every append returns only once its record, and the directory entry of a new or rotated
+// file, are on disk. A GzipStream log isn't repaired this way: readers stop at a member cut short
+// (see NewReader), and members appended after it aren't read.
+//
+// With Options.Audit the records are hash-chained, so tampering with the log shows (see Verify).
+package jsonl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/utf8safe"
+)
+
+// Defaults used by OptionsFromEnv.
+const (
+	DefaultMaxSize     int64 = 50 << 20
+	DefaultKeep              = 5
+	DefaultLockTimeout       = 5 * time.Second
+)
+
+// ErrLockTimeout is returned (wrapped, with the lock file and timeout) when another process held
+// the log's lock for longer than Options.LockTimeout.
+var ErrLockTimeout = filelock.ErrTimeout
+
+// Options configures rotation.
+type Options struct {
+	// MaxSize is the size in bytes past which the file is rotated before the next append. Zero
+	// disables rotation.
+	MaxSize int64
+	// Keep is the number of rotated generations (`<path>.1` is the newest) to keep; older ones
+	// are deleted. Zero means rotated files are deleted right away.
+	Keep int
+	// Compress gzips each rotated generation (`<path>.1.gz`, ...) after it has been moved aside.
+	Compress bool
+	// GzipStream writes the active file compressed from the start, as `<path>.gz`: every record
+	// (and the Header) is appended as an independent gzip member, so the file is always a valid
+	// multi-member gzip stream (zcat reads it) and a failed append never leaves a partial member
+	// behind. Rotated generations are `<path>.1.gz`, ... as with Compress, which it makes
+	// unnecessary. Each record is compressed on its own, so the file is larger than one
+	// compressed after rotation.
+	GzipStream bool
+	// SpoolDir, when set, receives lines that can't be written to the log (e.g. a full or
+	// read-only filesystem); they are moved back into the log by the next successful append.
+	SpoolDir string
+	// LockTimeout bounds how long an append or rotation waits for the lock. Zero means
+	// DefaultLockTimeout; a negative value waits indefinitely.
+	LockTimeout time.Duration
+	// Header, when set, starts every new file (the first one and each one after a rotation), e.g.
+	// the header row of a CSV log. It should end with a newline.
+	Header []byte
+	// MigrateLegacy moves an active file without a header line, from before there were headers,
+	// aside as `<path>.legacy` (`<path>.legacy.2`, ... if that is taken) before appending, so the
+	// record goes to a new file that starts with the Header. Only one of the processes appending at
+	// once moves it. With Compress the legacy file is gzipped after, like a rotated generation. It
+	// takes a Header that is a Meta header (see Meta.Header), or Audit; otherwise the new file
+	// would be headerless too.
+	MigrateLegacy bool
+	// Format is how Append encodes records; empty means FormatJSONL. AppendLine and AppendRecord
+	// write their bytes as given.
+	Format Format
+	// Sync fsyncs the file after every append, and its directory when a file is created, rotated,
+	// or compressed, for logs kept as an audit trail that must survive a power loss. Each append
+	// then waits for the disk.
+	Sync bool
+	// Audit wraps every record as an AuditRecord chained to the one before it by its hash, across
+	// rotations, so that editing, inserting, or deleting records shows (see Verify). Records must
+	// be JSON; they are written as one line each whatever the Format, and every file starts with a
+	// header carrying the chain (see Meta.Chain), built from Header when it is a Meta header. A
+	// file that isn't an audit log yet is rotated away first.
+	Audit bool
+	// ReplaceInvalidUTF8 lets Append replace the bytes of strings that aren't valid UTF-8 with
+	// U+FFFD, as encoding/json does, losing them. By default they are kept: next to a key whose
+	// value is such a string, Append adds `<key>__base64` with its bytes base64-encoded (see
+	// hooksdk.InvalidUTF8Base64). Only maps, slices, and strings are looked into, not structs.
+	ReplaceInvalidUTF8 bool
+}
+
+// OptionsFromEnv returns the defaults overridden by CODEX_HOOKLOG_MAX_SIZE (bytes, or with a
+// K/M/G suffix such as `50M`; `0` disables rotation), CODEX_HOOKLOG_KEEP,
+// CODEX_HOOKLOG_COMPRESS (`1`/`true` to gzip rotated files, `gzip` for GzipStream),
+// CODEX_HOOKLOG_LOCK_TIMEOUT (a Go
+// duration such as `2s`), CODEX_HOOKLOG_SPOOL_DIR (default DefaultSpoolDir()),
+// CODEX_HOOKLOG_FORMAT (see ParseFormat), CODEX_HOOKLOG_SYNC (`1`/`true` for Sync), and
+// CODEX_HOOKLOG_AUDIT (`1`/`true` for Audit).
+func OptionsFromEnv() Options {
+	o := Options{MaxSize: DefaultMaxSize, Keep: DefaultKeep, LockTimeout: DefaultLockTimeout, SpoolDir: DefaultSpoolDir()}
+	if v := os.Getenv("CODEX_HOOKLOG_MAX_SIZE"); v != "" {
+		if n, err := ParseSize(v); err == nil {
+			o.MaxSize = n
+		}
+	}
+	if v := os.Getenv("CODEX_HOOKLOG_KEEP"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			o.Keep = n
+		}
+	}
+	if v := os.Getenv("CODEX_HOOKLOG_COMPRESS"); strings.EqualFold(v, "gzip") {
+		o.GzipStream = true
+	} else if v != "" {
+		o.Compress, _ = strconv.ParseBool(v)
+	}
+	if v := os.Getenv("CODEX_HOOKLOG_LOCK_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			o.LockTimeout = d
+		}
+	}
+	if v := os.Getenv("CODEX_HOOKLOG_SPOOL_DIR"); v != "" {
+		o.SpoolDir = v
+	}
+	if f, err := ParseFormat(os.Getenv("CODEX_HOOKLOG_FORMAT")); err == nil {
+		o.Format = f
+	}
+	o.Sync, _ = strconv.ParseBool(os.Getenv("CODEX_HOOKLOG_SYNC"))
+	o.Audit, _ = strconv.ParseBool(os.Getenv("CODEX_HOOKLOG_AUDIT"))
+	return o
+}
+
+// ParseSize parses a byte count with an optional K, M, or G suffix (powers of 1024; a trailing
+// `B`/`iB` is accepted, e.g. `64MiB`).
+func ParseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "I")
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(t, "K"):
+		mult, t = 1<<10, strings.TrimSuffix(t, "K")
+	case strings.HasSuffix(t, "M"):
+		mult, t = 1<<20, strings.TrimSuffix(t, "M")
+	case strings.HasSuffix(t, "G"):
+		mult, t = 1<<30, strings.TrimSuffix(t, "G")
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// Writer appends records to a file. It holds no open file between appends, so a Writer is cheap
+// to create per invocation.
+type Writer struct {
+	path string
+	opts Options
+}
+
+// New returns a writer for path. Parent directories are created on the first append.
+func New(path string, opts Options) *Writer {
+	return &Writer{path: path, opts: opts}
+}
+
+// Path returns the active log file: the path given to New, with `.gz` appended for
+// Options.GzipStream.
+func (w *Writer) Path() string {
+	if w.opts.GzipStream {
+		return w.path + gzExt
+	}
+	return w.path
+}
+
+// Append encodes v in Options.Format (one line of JSON by default) and appends it as one record.
+func (w *Writer) Append(v any) error {
+	if !w.opts.ReplaceInvalidUTF8 {
+		v = utf8safe.Encode(v)
+	}
+	data, err := w.opts.Format.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.AppendRecord(data)
+}
+
+// AppendLine appends line, adding the trailing newline if it is missing. line must not contain
+// other newlines. With Options.SpoolDir set, a line that can't be written is spooled instead and
+// the error wraps ErrSpooled.
+func (w *Writer) AppendLine(line []byte) error {
+	return w.AppendRecord(line)
+}
+
+// AppendRecord is AppendLine for formats whose records may span lines, such as a CSV row with a
+// quoted newline: rec is appended in one piece, never split by a rotation or another writer.
+func (w *Writer) AppendRecord(rec []byte) error {
+	line := rec
+	if w.opts.Audit {
+		// Made one line now, since a spooled record is only linked into the chain when it is
+		// drained, and the spool is read a line at a time.
+		var err error
+		if line, err = Canonical(auditJSON(rec)); err != nil {
+			return fmt.Errorf("jsonl: audit log record: %w", err)
+		}
+	}
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line[:len(line):len(line)], '\n')
+	}
+	rotated, legacy, err := w.appendLocked(line)
+	if err != nil {
+		if w.opts.SpoolDir == "" {
+			return err
+		}
+		return w.spool(line, err)
+	}
+	// Compress outside the lock so other processes can keep appending meanwhile.
+	if (rotated || legacy != "") && w.opts.Compress {
+		return w.compressGenerations()
+	}
+	return nil
+}
+
+func (w *Writer) appendLocked(line []byte) (rotated bool, legacy string, err error) {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil {
+		return false, "", err
+	}
+	lock, err := w.lock()
+	if err != nil {
+		return false, "", err
+	}
+	defer lock.Unlock()
+
+	if w.opts.MigrateLegacy && (w.opts.Audit || w.metaHeader()) {
+		if legacy, err = w.migrateLegacy(); err != nil {
+			return false, "", err
+		}
+	}
+
+	var prev Chain
+	size := int64(len(line))
+	if w.opts.Audit {
+		var continues bool
+		if prev, continues, err = w.lastLink(); err != nil {
+			return false, "", err
+		}
+		if info, err := os.Stat(w.Path()); !continues && err == nil && info.Size() > 0 {
+			if rotated, err = w.rotate(); err != nil {
+				return rotated, legacy, err
+			}
+		}
+		size += auditOverhead
+	}
+
+	r, err := w.rotateIfNeeded(size)
+	rotated = rotated || r
+	if err != nil {
+		return rotated, legacy, err
+	}
+
+	// Read access is for finishing a partial last line.
+	f, err := os.OpenFile(w.Path(), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return rotated, legacy, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return rotated, legacy, err
+	}
+	created := info.Size() == 0
+	if err := w.finishPartialLine(f, info.Size()); err != nil {
+		f.Close()
+		return rotated, legacy, err
+	}
+	header := w.opts.Header
+	if w.opts.Audit && created {
+		if header, err = w.auditHeader(prev); err != nil {
+			f.Close()
+			return rotated, legacy, err
+		}
+	}
+	if len(header) > 0 {
+		if err := w.writeHeader(f, header); err != nil {
+			f.Close()
+			return rotated, legacy, err
+		}
+	}
+	if w.opts.SpoolDir != "" {
+		if err := w.drainSpool(f, &prev); err != nil {
+			f.Close()
+			return rotated, legacy, err
+		}
+	}
+	if w.opts.Audit {
+		if line, _, err = link(line, prev); err != nil {
+			f.Close()
+			return rotated, legacy, err
+		}
+	}
+	if err := w.write(f, line); err != nil {
+		f.Close()
+		return rotated, legacy, err
+	}
+	if !w.opts.Sync {
+		return rotated, legacy, f.Close()
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return rotated, legacy, err
+	}
+	if err := f.Close(); err != nil {
+		return rotated, legacy, err
+	}
+	// The rotation's or migration's renames and the new file's entry are in the directory.
+	if rotated || legacy != "" || created {
+		return rotated, legacy, syncDir(filepath.Dir(w.path))
+	}
+	return rotated, legacy, nil
+}
+
+// finishPartialLine ends f, opened under the lock and size bytes long, with a newline if its last
+// line is cut short, as a writer killed mid-append leaves it, so the next record starts a line of
+// its own. GzipStream files are left alone.
+func (w *Writer) finishPartialLine(f *os.File, size int64) error {
+	if w.opts.GzipStream || size == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, size-1); err != nil {
+		return err
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+	_, err := f.Write([]byte{'\n'})
+	return err
+}
+
+// write appends data to f, opened for appending under the lock, as one gzip member for
+// Options.GzipStream. A member is written in one piece; if that fails, f is truncated back so the
+// stream stays valid.
+func (w *Writer) write(f *os.File, data []byte) error {
+	if !w.opts.GzipStream {
+		_, err := f.Write(data)
+		return err
+	}
+	member, err := gzipMember(data)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(member); err != nil {
+		f.Truncate(info.Size())
+		return err
+	}
+	return nil
+}
+
+// writeHeader writes header if f, opened for appending under the lock, is empty.
+func (w *Writer) writeHeader(f *os.File, header []byte) error {
+	info, err := f.Stat()
+	if err != nil || info.Size() > 0 {
+		return err
+	}
+	if err := w.write(f, header); err != nil {
+		f.Truncate(0)
+		return err
+	}
+	return nil
+}
+
+// Rotate rotates the file now, regardless of its size.
+func (w *Writer) Rotate() error {
+	lock, err := w.lock()
+	if err != nil {
+		return err
+	}
+	rotated, err := w.rotate()
+	if err == nil && rotated && w.opts.Sync {
+		err = syncDir(filepath.Dir(w.path))
+	}
+	lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if rotated && w.opts.Compress {
+		return w.compressGenerations()
+	}
+	return nil
+}
+
+// RemoveRotated deletes the rotated generation or legacy file (see Options.MigrateLegacy), plain
+// or gzipped, that is the same file as info (from os.Stat of it earlier), holding the lock so a
+// rotation can't shift another file into its place first, and returns the path it had. It reports
+// false, removing nothing, when no such file is that file any more: it was pruned, or compressed
+// into a new file.
+func (w *Writer) RemoveRotated(info os.FileInfo) (string, bool, error) {
+	lock, err := w.lock()
+	if err != nil {
+		return "", false, err
+	}
+	defer lock.Unlock()
+
+	gens, err := w.generations()
+	if err != nil {
+		return "", false, err
+	}
+	legacy, err := w.legacyFiles()
+	if err != nil {
+		return "", false, err
+	}
+	var paths []string
+	for n, g := range gens {
+		paths = appendExisting(paths, g, w.generation(n))
+	}
+	for n, f := range legacy {
+		paths = appendExisting(paths, f, w.legacyName(n))
+	}
+	for _, path := range paths {
+		if cur, err := os.Stat(path); err == nil && os.SameFile(cur, info) {
+			return path, true, os.Remove(path)
+		}
+	}
+	return "", false, nil
+}
+
+// appendExisting appends to paths the files of g, plain at path and gzipped next to it, that
+// exist.
+func appendExisting(paths []string, g genFiles, path string) []string {
+	if g.plain {
+		paths = append(paths, path)
+	}
+	if g.gz {
+		paths = append(paths, path+gzExt)
+	}
+	return paths
+}
+
+func (w *Writer) lockPath() string {
+	return w.path + ".lock"
+}
+
+// lock takes the writer's lock, waiting at most Options.LockTimeout.
+func (w *Writer) lock() (*filelock.Lock, error) {
+	return filelock.AcquireTimeout(w.lockPath(), w.lockTimeout())
+}
+
+func (w *Writer) lockTimeout() time.Duration {
+	if w.opts.LockTimeout == 0 {
+		return DefaultLockTimeout
+	}
+	return w.opts.LockTimeout
+}
+
+func (w *Writer) rotateIfNeeded(incoming int64) (bool, error) {
+	if w.opts.MaxSize <= 0 {
+		return false, nil
+	}
+	info, err := os.Stat(w.Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	// Never rotate an empty file, even if a single record is larger than MaxSize.
+	if info.Size() == 0 || info.Size()+incoming <= w.opts.MaxSize {
+		return false, nil
+	}
+	return w.rotate()
+}
+
+// rotate shifts `<path>.N` (and `<path>.N.gz`) to generation N+1, moves the active file to
+// `<path>.1` (`<path>.1.gz` for GzipStream), and prunes generations beyond Keep. The caller holds
+// the lock.
+func (w *Writer) rotate() (bool, error) {
+	active := w.Path()
+	if _, err := os.Stat(active); os.IsNotExist(err) {
+		return false, nil
+	}
+	if w.opts.Keep <= 0 {
+		if err := os.Remove(active); err != nil {
+			return false, err
+		}
+		return true, w.prune()
+	}
+
+	for n := w.opts.Keep - 1; n >= 1; n-- {
+		for _, ext := range []string{"", gzExt} {
+			from := w.generation(n) + ext
+			if _, err := os.Stat(from); err == nil {
+				if err := os.Rename(from, w.generation(n+1)+ext); err != nil {
+					return false, err
+				}
+			}
+		}
+	}
+	first := w.generation(1)
+	if w.opts.GzipStream {
+		first += gzExt
+	}
+	if err := os.Rename(active, first); err != nil {
+		return false, err
+	}
+	return true, w.prune()
+}
+
+func (w *Writer) generation(n int) string {
+	return w.path + "." + strconv.Itoa(n)
+}
+
+// generations lists the rotated generations on disk: for each number, whether a plain and/or a
+// compressed file exists.
+func (w *Writer) generations() (map[int]genFiles, error) {
+	entries, err := os.ReadDir(filepath.Dir(w.path))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(w.path) + "."
+	gens := make(map[int]genFiles)
+	for _, e := range entries {
+		suffix, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok {
+			continue
+		}
+		suffix, gz := strings.CutSuffix(suffix, gzExt)
+		n, err := strconv.Atoi(suffix)
+		if err != nil || n < 1 {
+			continue
+		}
+		g := gens[n]
+		if gz {
+			g.gz = true
+		} else {
+			g.plain = true
+		}
+		gens[n] = g
+	}
+	return gens, nil
+}
+
+type genFiles struct{ plain, gz bool }
+
+// prune deletes rotated generations, compressed or not, numbered above Keep (left behind by a
+// larger Keep earlier).
+func (w *Writer) prune() error {
+	gens, err := w.generations()
+	if err != nil {
+		return err
+	}
+	for n, g := range gens {
+		if n <= w.opts.Keep {
+			continue
+		}
+		for _, f := range []struct {
+			exists bool
+			path   string
+		}{{g.plain, w.generation(n)}, {g.gz, w.generation(n) + gzExt}} {
+			if !f.exists {
+				continue
+			}
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package jsonl_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// TestMain lets the tests run this binary as a hook process appending to a shared log: with
+// JSONL_TEST_APPEND=<path> it appends JSONL_TEST_COUNT records tagged JSONL_TEST_WRITER, each
+// padded with JSONL_TEST_PAD bytes. With JSONL_TEST_GZIP set it writes a gzip stream, with
+// JSONL_TEST_HEADER set it starts each file with testMeta's header, with JSONL_TEST_MIGRATE set
+// it moves a headerless log aside first, with JSONL_TEST_SYNC set it syncs every append, and with
+// JSONL_TEST_AUDIT set it writes an audit log.
+func TestMain(m *testing.M) {
+	if path := os.Getenv("JSONL_TEST_APPEND"); path != "" {
+		n, _ := strconv.Atoi(os.Getenv("JSONL_TEST_COUNT"))
+		pad, _ := strconv.Atoi(os.Getenv("JSONL_TEST_PAD"))
+		opts := rotatingOptions()
+		opts.GzipStream = os.Getenv("JSONL_TEST_GZIP") != ""
+		opts.Sync = os.Getenv("JSONL_TEST_SYNC") != ""
+		opts.Audit = os.Getenv("JSONL_TEST_AUDIT") != ""
+		opts.MigrateLegacy = os.Getenv("JSONL_TEST_MIGRATE") != ""
+		if os.Getenv("JSONL_TEST_HEADER") != "" {
+			opts.Header, _ = testMeta.Header(jsonl.FormatJSONL)
+		}
+		if err := appendRecords(path, opts, os.Getenv("JSONL_TEST_WRITER"), n, pad); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// rotatingOptions rotate every few records and keep every generation, so no record is pruned.
+func rotatingOptions() jsonl.Options {
+	return jsonl.Options{MaxSize: 512, Keep: 10000, LockTimeout: time.Minute}
+}
+
+type record struct {
+	Writer string `json:"writer"`
+	N      int    `json:"n"`
+	Pad    string `json:"pad,omitempty"`
+}
+
+func appendRecords(path string, opts jsonl.Options, writer string, n, pad int) error {
+	for i := 0; i < n; i++ {
+		// A new Writer for each record, as each hook invocation is a new process.
+		if err := jsonl.New(path, opts).Append(record{Writer: writer, N: i, Pad: strings.Repeat("p", pad)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAll returns the records in path and its rotated generations, by writer.
+func readAll(t *testing.T, path string) map[string][]int {
+	t.Helper()
+	files, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]int{}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			var r record
+			if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+				t.Errorf("%s: bad line %q", file, sc.Text())
+				continue
+			}
+			got[r.Writer] = append(got[r.Writer], r.N)
+		}
+		if err := sc.Err(); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+		f.Close()
+	}
+	return got
+}
+
+// checkAll fails unless every writer's n records are in the log exactly once.
+func checkAll(t *testing.T, path string, writers, n int) {
+	t.Helper()
+	got := readAll(t, path)
+	for w := 0; w < writers; w++ {
+		seen := map[int]bool{}
+		for _, i := range got[strconv.Itoa(w)] {
+			if seen[i] {
+				t.Errorf("writer %d: record %d written twice", w, i)
+			}
+			seen[i] = true
+		}
+		if len(seen) != n {
+			t.Errorf("writer %d: %d of %d records in the log", w, len(seen), n)
+		}
+	}
+}
+
+func TestRotationAndRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	w := jsonl.New(path, jsonl.Options{MaxSize: 100, Keep: 2})
+	for i := 0; i < 20; i++ {
+		if err := w.Append(record{Writer: "w", N: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"hooks.jsonl", "hooks.jsonl.1", "hooks.jsonl.2"} {
+		info, err := os.Stat(filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if info.Size() > 100+64 {
+			t.Errorf("%s is %d bytes, past the rotation size", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("hooks.jsonl.3 wasn't pruned: %v", err)
+	}
+
+	// Pruning dropped the oldest records and kept every newer one.
+	got := map[int]bool{}
+	for _, i := range readAll(t, path)["w"] {
+		got[i] = true
+	}
+	for i := 8; i < 20; i++ {
+		if !got[i] {
+			t.Errorf("record %d is missing: %v", i, got)
+		}
+	}
+	if got[0] {
+		t.Errorf("the oldest record wasn't pruned")
+	}
+}
+
+func TestConcurrentAppendsAcrossRotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	const writers, n = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			if err := appendRecords(path, rotatingOptions(), strconv.Itoa(w), n, 0); err != nil {
+				t.Error(err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	checkAll(t, path, writers, n)
+}
+
+// appendFromProcesses runs writers hook processes at once, each appending n records of pad bytes.
+func appendFromProcesses(t *testing.T, path string, writers, n, pad int) {
+	t.Helper()
+	cmds := make([]*exec.Cmd, writers)
+	for w := range cmds {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "JSONL_TEST_APPEND="+path, "JSONL_TEST_COUNT="+strconv.Itoa(n),
+			"JSONL_TEST_WRITER="+strconv.Itoa(w), "JSONL_TEST_PAD="+strconv.Itoa(pad))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds[w] = cmd
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConcurrentProcessesAcrossRotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	const writers, n = 4, 40
+	appendFromProcesses(t, path, writers, n, 0)
+	checkAll(t, path, writers, n)
+}
+
+func TestConcurrentProcessesLargeLines(t *testing.T) {
+	// Lines far past the size a single write is atomic for (PIPE_BUF, 4K on Linux) still don't
+	// interleave, and every one parses.
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	const writers, n = 16, 3
+	appendFromProcesses(t, path, writers, n, 300<<10)
+	checkAll(t, path, writers, n)
+}
+
+func TestHeaderStartsEveryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.csv")
+	header := "n,note\n"
+	opts := jsonl.Options{MaxSize: 64, Keep: 100, Header: []byte(header)}
+	for i := 0; i < 10; i++ {
+		// A record spanning two lines is appended whole, never split by a rotation.
+		rec := fmt.Sprintf("%d,\"multi\nline\"", i)
+		if err := jsonl.New(path, opts).AppendRecord([]byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(path + ".[0-9]*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, path)
+	if len(files) < 2 {
+		t.Fatalf("%d files; the log never rotated", len(files))
+	}
+	records := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, ok := strings.CutPrefix(string(data), header)
+		if !ok {
+			t.Errorf("%s doesn't start with the header: %q", file, data)
+			continue
+		}
+		if strings.Contains(body, header) {
+			t.Errorf("%s has the header twice: %q", file, data)
+		}
+		for _, rec := range strings.SplitAfter(body, "line\"\n") {
+			if rec == "" {
+				continue
+			}
+			if !strings.HasSuffix(rec, ",\"multi\nline\"\n") {
+				t.Errorf("%s: split record %q", file, rec)
+			}
+			records++
+		}
+	}
+	if records != 10 {
+		t.Errorf("%d of 10 records in the log", records)
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	held, err := filelock.Acquire(path + ".lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = jsonl.New(path, jsonl.Options{LockTimeout: 50 * time.Millisecond}).Append(record{Writer: "w"})
+	if !errors.Is(err, jsonl.ErrLockTimeout) || !strings.Contains(err.Error(), path+".lock") {
+		t.Errorf("Append with the lock held: %v, want ErrLockTimeout naming the lock file", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Append waited %v, past its timeout", elapsed)
+	}
+
+	if err := held.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := jsonl.New(path, jsonl.Options{LockTimeout: 50 * time.Millisecond}).Append(record{Writer: "w"}); err != nil {
+		t.Errorf("Append after the lock was released: %v", err)
+	}
+}
+
+func TestRemoveRotated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	w := jsonl.New(path, jsonl.Options{Keep: 2})
+	w.Append(record{Writer: "w", N: 0})
+	w.Rotate()
+	info, err := os.Stat(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A rotation since the Stat shifted the file to .2; it is still the one removed.
+	w.Append(record{Writer: "w", N: 1})
+	w.Rotate()
+	removed, ok, err := w.RemoveRotated(info)
+	if err != nil || !ok || removed != path+".2" {
+		t.Fatalf("RemoveRotated = %q, %v, %v; want %s.2", removed, ok, err, path)
+	}
+	if files := jsonl.Files(path); len(files) != 1 || files[0] != path+".1" {
+		t.Errorf("files left: %q", files)
+	}
+
+	// A file no generation is any more is left alone.
+	if _, ok, err := w.RemoveRotated(info); ok || err != nil {
+		t.Errorf("RemoveRotated of a removed file = %v, %v", ok, err)
+	}
+	w.Append(record{Writer: "w", N: 2})
+	active, _ := os.Stat(path)
+	if _, ok, _ := w.RemoveRotated(active); ok {
+		t.Error("RemoveRotated removed the active log")
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv("CODEX_HOOKLOG_MAX_SIZE", "10M")
+	t.Setenv("CODEX_HOOKLOG_KEEP", "3")
+	o := jsonl.OptionsFromEnv()
+	if o.MaxSize != 10<<20 || o.Keep != 3 {
+		t.Errorf("MaxSize, Keep = %d, %d; want 10M, 3", o.MaxSize, o.Keep)
+	}
+
+	t.Setenv("CODEX_HOOKLOG_MAX_SIZE", "lots")
+	t.Setenv("CODEX_HOOKLOG_KEEP", "-1")
+	o = jsonl.OptionsFromEnv()
+	if o.MaxSize != jsonl.DefaultMaxSize || o.Keep != jsonl.DefaultKeep {
+		t.Errorf("invalid values gave MaxSize, Keep = %d, %d; want the defaults", o.MaxSize, o.Keep)
+	}
+
+	for v, want := range map[string]bool{"": false, "1": true, "true": true, "0": false, "always": false} {
+		t.Setenv("CODEX_HOOKLOG_SYNC", v)
+		if o := jsonl.OptionsFromEnv(); o.Sync != want {
+			t.Errorf("CODEX_HOOKLOG_SYNC=%q: Sync = %v, want %v", v, o.Sync, want)
+		}
+		t.Setenv("CODEX_HOOKLOG_AUDIT", v)
+		if o := jsonl.OptionsFromEnv(); o.Audit != want {
+			t.Errorf("CODEX_HOOKLOG_AUDIT=%q: Audit = %v, want %v", v, o.Audit, want)
+		}
+	}
+
+	for v, want := range map[string][2]bool{"": {}, "1": {true, false}, "true": {true, false}, "0": {}, "gzip": {false, true}, "GZIP": {false, true}, "zstd": {}} {
+		t.Setenv("CODEX_HOOKLOG_COMPRESS", v)
+		if o := jsonl.OptionsFromEnv(); o.Compress != want[0] || o.GzipStream != want[1] {
+			t.Errorf("CODEX_HOOKLOG_COMPRESS=%q: Compress, GzipStream = %v, %v; want %v", v, o.Compress, o.GzipStream, want)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{"0": 0, "512": 512, "4K": 4 << 10, "50M": 50 << 20, "1G": 1 << 30} {
+		if got, err := jsonl.ParseSize(s); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "big", "-1", "5T"} {
+		if _, err := jsonl.ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q) succeeded", s)
+		}
+	}
+}
+
+func TestAppendInvalidUTF8(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	record := map[string]any{"out": "bin\xff\x00", "argv": []any{"x", "\xfe"}, "ok": "fine"}
+
+	// By default the bytes are kept in a base64 copy beside the replaced string.
+	if err := jsonl.New(path, jsonl.Options{}).Append(record); err != nil {
+		t.Fatal(err)
+	}
+	// With ReplaceInvalidUTF8 they are lost, as encoding/json loses them.
+	if err := jsonl.New(path, jsonl.Options{ReplaceInvalidUTF8: true}).Append(record); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		`{"argv":["x","�"],"argv__base64":[null,"/g=="],"ok":"fine","out":"bin�\u0000","out__base64":"Ymlu/wA="}`,
+		`{"argv":["x","�"],"ok":"fine","out":"bin�\u0000"}`,
+	}
+	if len(lines) != 2 || lines[0] != want[0] || lines[1] != want[1] {
+		t.Errorf("lines =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	if _, found := record["out__base64"]; found {
+		t.Error("Append changed the record")
+	}
+}
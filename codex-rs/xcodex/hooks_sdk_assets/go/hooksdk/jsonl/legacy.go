@@ -0,0 +1,194 @@
+package jsonl
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// legacyExt names the files a headerless active file is moved to (see Options.MigrateLegacy):
+// `<path>.legacy`, then `<path>.legacy.2`, ... should that be taken, each plain or gzipped.
+const legacyExt = ".legacy"
+
+// errStop ends ScanRecords once the record looked for has been read.
+var errStop = errors.New("jsonl: stop")
+
+// LegacyFiles returns the files of the log at path that a migration moved aside (see
+// Options.MigrateLegacy), oldest first.
+func LegacyFiles(path string) []string {
+	type legacy struct {
+		n    int
+		gz   bool
+		path string
+	}
+	var files []legacy
+	matches, _ := filepath.Glob(path + legacyExt + "*")
+	for _, m := range matches {
+		if n, gz, ok := legacyNumber(filepath.Base(m), filepath.Base(path)); ok {
+			files = append(files, legacy{n, gz, m})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].n != files[j].n {
+			return files[i].n < files[j].n
+		}
+		return !files[i].gz && files[j].gz
+	})
+	var out []string
+	for _, f := range files {
+		out = append(out, f.path)
+	}
+	return out
+}
+
+// legacyNumber parses name, a file in the log's directory, as the nth legacy file of the log whose
+// base name is base; gz is whether it is the gzipped one.
+func legacyNumber(name, base string) (n int, gz, ok bool) {
+	suffix, ok := strings.CutPrefix(name, base+legacyExt)
+	if !ok {
+		return 0, false, false
+	}
+	suffix, gz = strings.CutSuffix(suffix, gzExt)
+	if suffix == "" {
+		return 1, gz, true
+	}
+	suffix, ok = strings.CutPrefix(suffix, ".")
+	if !ok {
+		return 0, false, false
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n < 2 || strconv.Itoa(n) != suffix {
+		return 0, false, false
+	}
+	return n, gz, true
+}
+
+func (w *Writer) legacyName(n int) string {
+	if n == 1 {
+		return w.path + legacyExt
+	}
+	return w.path + legacyExt + "." + strconv.Itoa(n)
+}
+
+// legacyFiles lists the legacy files on disk, as generations does the rotated ones.
+func (w *Writer) legacyFiles() (map[int]genFiles, error) {
+	entries, err := os.ReadDir(filepath.Dir(w.path))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[int]genFiles)
+	for _, e := range entries {
+		n, gz, ok := legacyNumber(e.Name(), filepath.Base(w.path))
+		if !ok {
+			continue
+		}
+		f := files[n]
+		if gz {
+			f.gz = true
+		} else {
+			f.plain = true
+		}
+		files[n] = f
+	}
+	return files, nil
+}
+
+// StartsWithHeader reports whether the first record read from r is a header line (see
+// ParseMeta); empty is true when r has no records at all. Only the first record is read.
+func StartsWithHeader(r io.Reader) (header, empty bool, err error) {
+	empty = true
+	err = ScanRecords(r, func(rec []byte) error {
+		_, header = ParseMeta(rec)
+		empty = false
+		return errStop
+	})
+	if err == errStop {
+		err = nil
+	}
+	return header, empty, err
+}
+
+// isLegacy reports whether the file at path has records but no header line before them: it was
+// written before cmd/log_jsonl wrote headers, or with them turned off. A file whose first record
+// can't be read (a gzip member cut short) is left to the append, as it would be without
+// migrating.
+func isLegacy(path string) (bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return false, nil
+	}
+	header, empty, err := StartsWithHeader(r)
+	return err == nil && !header && !empty, nil
+}
+
+// MigrateLegacy moves the active file aside, as Options.MigrateLegacy does before an append,
+// without appending anything, and returns the file it is now; "" when there was nothing to move.
+// With Options.Compress the file is gzipped after, and the path returned is the .gz. The next
+// append starts a new file, with Options.Header.
+func (w *Writer) MigrateLegacy() (string, error) {
+	lock, err := w.lock()
+	if err != nil {
+		return "", err
+	}
+	legacy, err := w.migrateLegacy()
+	if err == nil && legacy != "" && w.opts.Sync {
+		err = syncDir(filepath.Dir(w.path))
+	}
+	lock.Unlock()
+	if err != nil || legacy == "" {
+		return legacy, err
+	}
+	if w.opts.Compress && !strings.HasSuffix(legacy, gzExt) {
+		if err := w.compressGenerations(); err != nil {
+			return legacy, err
+		}
+		legacy += gzExt
+	}
+	return legacy, nil
+}
+
+// migrateLegacy moves the active file to the first free legacy name if it has records but no
+// header, and returns that name; "" when it was left alone. The caller holds the lock, so of the
+// processes appending at once, only the first moves the file, and the others find the new one.
+func (w *Writer) migrateLegacy() (string, error) {
+	legacy, err := isLegacy(w.Path())
+	if err != nil || !legacy {
+		return "", err
+	}
+	files, err := w.legacyFiles()
+	if err != nil {
+		return "", err
+	}
+	n := 1
+	for f := files[n]; f.plain || f.gz; f = files[n] {
+		n++
+	}
+	dest := w.legacyName(n)
+	if w.opts.GzipStream {
+		dest += gzExt
+	}
+	if err := os.Rename(w.Path(), dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// metaHeader reports whether Options.Header is a Meta header, which marks the files that start
+// with it as new.
+func (w *Writer) metaHeader() bool {
+	header, _, _ := StartsWithHeader(bytes.NewReader(w.opts.Header))
+	return header
+}
@@ -0,0 +1,225 @@
+package jsonl_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// legacyLog writes n records of writer "legacy" to path, without a header, as log_jsonl did before
+// headers, and returns the file's contents.
+func legacyLog(t *testing.T, path string, n int) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	for i := 0; i < n; i++ {
+		data, _ := json.Marshal(record{Writer: "legacy", N: i})
+		b.Write(append(data, '\n'))
+	}
+	writeFile(t, path, b.Bytes())
+	return b.Bytes()
+}
+
+// migrating returns Options that start each file with testMeta's header and move a legacy log
+// aside.
+func migrating(t *testing.T) jsonl.Options {
+	t.Helper()
+	header, err := testMeta.Header(jsonl.FormatJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jsonl.Options{Header: header, MigrateLegacy: true}
+}
+
+func TestMigrateLegacyOnAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	legacy := legacyLog(t, path, 20000)
+	opts := migrating(t)
+	for i := 0; i < 2; i++ {
+		if err := jsonl.New(path, opts).Append(record{Writer: "new", N: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The old file is moved aside whole, once; the records go to a new file after a header.
+	if got, _ := os.ReadFile(path + ".legacy"); !bytes.Equal(got, legacy) {
+		t.Errorf("legacy file has %d bytes, want the %d of the old log", len(got), len(legacy))
+	}
+	data, _ := os.ReadFile(path)
+	if want := string(opts.Header) + `{"writer":"new","n":0}` + "\n" + `{"writer":"new","n":1}` + "\n"; string(data) != want {
+		t.Errorf("new log = %q, want %q", data, want)
+	}
+	if files := jsonl.Files(path); !reflect.DeepEqual(files, []string{path + ".legacy", path}) {
+		t.Errorf("Files = %q", files)
+	}
+
+	// Another legacy log later takes the next name, and is listed after the first.
+	legacyLog(t, path, 3)
+	jsonl.New(path, opts).Append(record{Writer: "new", N: 2})
+	if files := jsonl.LegacyFiles(path); !reflect.DeepEqual(files, []string{path + ".legacy", path + ".legacy.2"}) {
+		t.Errorf("LegacyFiles = %q", files)
+	}
+}
+
+func TestMigrateLegacyLeavesOthersAlone(t *testing.T) {
+	meta := migrating(t)
+	for name, tt := range map[string]struct {
+		opts jsonl.Options
+		log  string
+	}{
+		// Without MigrateLegacy, or without a header marking new files, the log is appended to.
+		"off":        {jsonl.Options{Header: meta.Header}, "{\"writer\":\"old\"}\n"},
+		"csv header": {jsonl.Options{Header: []byte("n,note\n"), MigrateLegacy: true}, "1,old\n"},
+		// A file with a header, or without records, isn't legacy.
+		"headered": {meta, string(meta.Header) + "{\"writer\":\"old\"}\n"},
+		"empty":    {meta, ""},
+		"blank":    {meta, "\n\n"},
+	} {
+		path := filepath.Join(t.TempDir(), "hooks.jsonl")
+		writeFile(t, path, []byte(tt.log))
+		if err := jsonl.New(path, tt.opts).AppendRecord([]byte(`{"writer":"new"}`)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if files := jsonl.LegacyFiles(path); files != nil {
+			t.Errorf("%s: moved aside as %q", name, files)
+		}
+		if data, _ := os.ReadFile(path); !strings.HasPrefix(string(data), strings.TrimRight(tt.log, "\n")) {
+			t.Errorf("%s: log = %q", name, data)
+		}
+	}
+}
+
+func TestMigrateLegacyConcurrent(t *testing.T) {
+	for _, processes := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "hooks.jsonl")
+		legacy := legacyLog(t, path, 100000)
+		const writers, n = 8, 5
+		if processes {
+			t.Setenv("JSONL_TEST_HEADER", "1")
+			t.Setenv("JSONL_TEST_MIGRATE", "1")
+			appendFromProcesses(t, path, writers, n, 0)
+		} else {
+			opts := rotatingOptions()
+			opts.Header, opts.MigrateLegacy = migrating(t).Header, true
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					if err := appendRecords(path, opts, fmt.Sprint(w), n, 0); err != nil {
+						t.Error(err)
+					}
+				}(w)
+			}
+			wg.Wait()
+		}
+		// One of them moved the log, whole; the others appended to the new one.
+		if files := jsonl.LegacyFiles(path); len(files) != 1 {
+			t.Fatalf("processes %v: legacy files %q", processes, files)
+		}
+		if got, _ := os.ReadFile(path + ".legacy"); !bytes.Equal(got, legacy) {
+			t.Errorf("processes %v: the legacy file isn't the old log", processes)
+		}
+		checkAll(t, path, writers, n)
+		if got := readAll(t, path)["legacy"]; len(got) != 100000 {
+			t.Errorf("processes %v: %d legacy records", processes, len(got))
+		}
+		for _, file := range jsonl.Files(path)[1:] {
+			if header, _, err := startsWithHeader(file); err != nil || !header {
+				t.Errorf("processes %v: %s has no header: %v", processes, file, err)
+			}
+		}
+	}
+}
+
+func startsWithHeader(path string) (header, empty bool, err error) {
+	f, err := jsonl.Open(path)
+	if err != nil {
+		return false, false, err
+	}
+	defer f.Close()
+	return jsonl.StartsWithHeader(f)
+}
+
+func TestWriterMigrateLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	legacy := legacyLog(t, path, 100)
+	opts := migrating(t)
+	opts.Compress = true
+	w := jsonl.New(path, opts)
+	// The move is made without appending, gzipped with Compress; a second does nothing.
+	moved, err := w.MigrateLegacy()
+	if err != nil || moved != path+".legacy.gz" {
+		t.Fatalf("MigrateLegacy = %q, %v", moved, err)
+	}
+	if got := gunzipFile(t, moved); !bytes.Equal(got, legacy) {
+		t.Errorf("gzipped legacy file has %d bytes, want %d", len(got), len(legacy))
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("active file left after the move: %v", err)
+	}
+	if moved, err := w.MigrateLegacy(); moved != "" || err != nil {
+		t.Errorf("second MigrateLegacy = %q, %v", moved, err)
+	}
+	if files := jsonl.LegacyFiles(path); !reflect.DeepEqual(files, []string{path + ".legacy.gz"}) {
+		t.Errorf("LegacyFiles = %q", files)
+	}
+
+	// Legacy files are removed like rotated generations.
+	info, err := os.Stat(path + ".legacy.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed, ok, err := w.RemoveRotated(info); err != nil || !ok || removed != path+".legacy.gz" {
+		t.Errorf("RemoveRotated = %q, %v, %v", removed, ok, err)
+	}
+
+	// A crashed compression left both copies: the next compression drops the plain one.
+	writeFile(t, path+".legacy.3", legacy)
+	writeFile(t, path+".legacy.3.gz", gzipData(t, legacy))
+	legacyLog(t, path, 1)
+	if _, err := w.MigrateLegacy(); err != nil {
+		t.Fatal(err)
+	}
+	if files := jsonl.LegacyFiles(path); !reflect.DeepEqual(files, []string{path + ".legacy.gz", path + ".legacy.3.gz"}) {
+		t.Errorf("after a crashed compression: %q", files)
+	}
+}
+
+func TestLegacyFilesNames(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hooks.jsonl")
+	for _, name := range []string{
+		"hooks.jsonl.legacy.10", "hooks.jsonl.legacy.2.gz", "hooks.jsonl.legacy", "hooks.jsonl.legacy.gz",
+		// Not legacy files of this log.
+		"hooks.jsonl.legacy.1", "hooks.jsonl.legacy.02", "hooks.jsonl.legacyx", "hooks.jsonl.legacy.2.tmp", "other.jsonl.legacy",
+	} {
+		writeFile(t, filepath.Join(dir, name), nil)
+	}
+	want := []string{path + ".legacy", path + ".legacy.gz", path + ".legacy.2.gz", path + ".legacy.10"}
+	if files := jsonl.LegacyFiles(path); !reflect.DeepEqual(files, want) {
+		t.Errorf("LegacyFiles = %q, want %q", files, want)
+	}
+}
+
+func TestStartsWithHeader(t *testing.T) {
+	header, _ := testMeta.Header(jsonl.FormatPretty)
+	for in, want := range map[string][2]bool{
+		"":                           {false, true},
+		"\n":                         {false, true},
+		string(header) + "---\n{}\n": {true, false},
+		"{\"a\":1}\n" + "{\"b\":2}":  {false, false},
+		"not json\n":                 {false, false},
+	} {
+		header, empty, err := jsonl.StartsWithHeader(strings.NewReader(in))
+		if err != nil || [2]bool{header, empty} != want {
+			t.Errorf("StartsWithHeader(%q) = %v, %v, %v; want %v", in, header, empty, err, want)
+		}
+	}
+}
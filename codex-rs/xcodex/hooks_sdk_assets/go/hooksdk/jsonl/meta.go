@@ -0,0 +1,126 @@
+package jsonl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// MetaKey is the only key of a log's header line, `{"_meta":{...}}`.
+const MetaKey = "_meta"
+
+// Record layouts a header declares in Meta.Format.
+const (
+	// MetaFormatPlain files hold one bare payload per record.
+	MetaFormatPlain = 1
+	// MetaFormatWrapped files hold payloads wrapped with the metadata of the hook that logged
+	// them (see hooksdk.Record): `{"ts","host","pid","hook","hook_invocation_id","event"}`.
+	MetaFormatWrapped = 2
+)
+
+// Meta describes a log file. cmd/log_jsonl writes it as the header line of every file it starts
+// (see Options.Header), so readers know how its records are laid out instead of guessing.
+type Meta struct {
+	// Format is MetaFormatPlain or MetaFormatWrapped.
+	Format int `json:"format"`
+	// SDK is the version of the SDK that wrote the file.
+	SDK string `json:"sdk"`
+	// Created is when the file was started, in RFC 3339.
+	Created string `json:"created"`
+	Host    string `json:"host"`
+	// Chain, in an audit log (see Options.Audit), is the link the file's first record continues
+	// from: the last record of the file before it.
+	Chain *Chain `json:"chain,omitempty"`
+}
+
+// Header returns m as a header line in format f, for Options.Header.
+func (m Meta) Header(f Format) ([]byte, error) {
+	return f.Marshal(map[string]Meta{MetaKey: m})
+}
+
+// ParseMeta returns the metadata of a header line; ok is false for any other record.
+func ParseMeta(rec []byte) (m Meta, ok bool) {
+	if !bytes.Contains(rec, []byte(`"`+MetaKey+`"`)) {
+		return Meta{}, false
+	}
+	var top map[string]json.RawMessage
+	if json.Unmarshal(rec, &top) != nil || len(top) != 1 || top[MetaKey] == nil {
+		return Meta{}, false
+	}
+	if json.Unmarshal(top[MetaKey], &m) != nil {
+		return Meta{}, false
+	}
+	return m, true
+}
+
+// ErrNotObject is returned by Decoder.Decode for a record that isn't a JSON object: a line cut
+// short by a crash, or one that isn't JSON at all.
+var ErrNotObject = errors.New("jsonl: record is not a JSON object")
+
+// Event is one logged event.
+type Event struct {
+	// Payload is the event's payload, with numbers as json.Number. It is nil for the header line.
+	Payload map[string]any
+	// TS is when the event was logged (RFC 3339), from the wrapper; "" for plain records.
+	TS string
+}
+
+// Decoder reads the events of one log file from its records (see ScanRecords), in the layout the
+// file's header declares. Files without a header, from before there were headers, are read by
+// guessing each record's layout: an object with an `event` object and no `xcodex_event_type` is a
+// wrapper. The records of an audit log are unwrapped to the record they chain. The zero Decoder
+// is ready to use; use one per file, since each file has its own header.
+type Decoder struct {
+	meta *Meta
+}
+
+// Meta returns the header of the file, once Decode has read it.
+func (d *Decoder) Meta() (Meta, bool) {
+	if d.meta == nil {
+		return Meta{}, false
+	}
+	return *d.meta, true
+}
+
+// Decode returns the event rec holds. For the header line it returns an Event with a nil
+// Payload, and reads the records after it in the layout it declares. A record that isn't a JSON
+// object fails with ErrNotObject.
+func (d *Decoder) Decode(rec []byte) (Event, error) {
+	var top map[string]any
+	dec := json.NewDecoder(bytes.NewReader(rec))
+	dec.UseNumber()
+	if dec.Decode(&top) != nil || top == nil {
+		return Event{}, ErrNotObject
+	}
+	if _, ok := top[MetaKey]; ok && len(top) == 1 {
+		if m, ok := ParseMeta(rec); ok {
+			d.meta = &m
+			return Event{}, nil
+		}
+	}
+
+	if (d.meta != nil && d.meta.Chain != nil) || isAuditRecord(top) {
+		if event, ok := top["event"].(map[string]any); ok {
+			top = event
+		}
+	}
+
+	format := 0
+	if d.meta != nil {
+		format = d.meta.Format
+	}
+	event, wrapped := top["event"].(map[string]any)
+	switch format {
+	case MetaFormatPlain:
+		wrapped = false
+	case MetaFormatWrapped:
+		// A hook logging plain payloads may share the file; its records have no `event` object.
+	default:
+		wrapped = wrapped && top["xcodex_event_type"] == nil
+	}
+	if !wrapped {
+		return Event{Payload: top}, nil
+	}
+	ts, _ := top["ts"].(string)
+	return Event{Payload: event, TS: ts}, nil
+}
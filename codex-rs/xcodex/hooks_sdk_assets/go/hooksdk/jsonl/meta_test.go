@@ -0,0 +1,150 @@
+package jsonl_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+var testMeta = jsonl.Meta{Format: jsonl.MetaFormatWrapped, SDK: "1.2.3", Created: "2025-01-01T00:00:00Z", Host: "laptop"}
+
+func TestMetaHeader(t *testing.T) {
+	for _, f := range []jsonl.Format{jsonl.FormatJSONL, jsonl.FormatPretty, jsonl.FormatCompactKeys} {
+		header, err := testMeta.Header(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs := scanAll(t, strings.NewReader(string(header)+string(header)))
+		if len(recs) != 2 {
+			t.Fatalf("%s: header %q makes %d records", f, header, len(recs))
+		}
+		if m, ok := jsonl.ParseMeta([]byte(recs[0])); !ok || m != testMeta {
+			t.Errorf("%s: ParseMeta(%q) = %+v, %v", f, recs[0], m, ok)
+		}
+	}
+	if header, _ := testMeta.Header(jsonl.FormatJSONL); string(header) != `{"_meta":{"format":2,"sdk":"1.2.3","created":"2025-01-01T00:00:00Z","host":"laptop"}}`+"\n" {
+		t.Errorf("header = %q", header)
+	}
+
+	for _, rec := range []string{
+		`{"xcodex_event_type":"session-start"}`,
+		`{"_meta":{"format":2},"event":{}}`,
+		`{"_meta":"old"}`,
+		`{"message":"\"_meta\""}`,
+		`not json`,
+	} {
+		if m, ok := jsonl.ParseMeta([]byte(rec)); ok {
+			t.Errorf("ParseMeta(%s) = %+v, want no header", rec, m)
+		}
+	}
+}
+
+// decodeAll decodes records as one file, returning each event's type and TS.
+func decodeAll(t *testing.T, recs ...string) (*jsonl.Decoder, []string) {
+	t.Helper()
+	var dec jsonl.Decoder
+	var got []string
+	for _, rec := range recs {
+		ev, err := dec.Decode([]byte(rec))
+		if err != nil {
+			got = append(got, "error: "+err.Error())
+			continue
+		}
+		if ev.Payload == nil {
+			got = append(got, "header")
+			continue
+		}
+		typ, _ := ev.Payload["xcodex_event_type"].(string)
+		got = append(got, typ+"@"+ev.TS)
+	}
+	return &dec, got
+}
+
+const (
+	wrappedRec = `{"ts":"2025-01-01T10:00:00Z","host":"h","pid":1,"hook":"log_jsonl","event":{"xcodex_event_type":"session-start"}}`
+	plainRec   = `{"xcodex_event_type":"session-end","event":{"note":"a field called event"}}`
+	// eventRec is a plain payload that has an `event` object and no event type: headerless, it
+	// reads as a wrapper.
+	eventRec = `{"event":{"xcodex_event_type":"inner"},"ts":"t"}`
+)
+
+func TestDecodeLegacy(t *testing.T) {
+	dec, got := decodeAll(t, wrappedRec, plainRec, eventRec, `{"a":`, `[1,2]`)
+	want := []string{"session-start@2025-01-01T10:00:00Z", "session-end@", "inner@t", "error: " + jsonl.ErrNotObject.Error(), "error: " + jsonl.ErrNotObject.Error()}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("headerless file = %q, want %q", got, want)
+	}
+	if _, ok := dec.Meta(); ok {
+		t.Error("a headerless file has a header")
+	}
+}
+
+func TestDecodeHeadered(t *testing.T) {
+	header, _ := testMeta.Header(jsonl.FormatJSONL)
+	// A plain payload in a wrapped file is one with no `event` object.
+	dec, got := decodeAll(t, string(header), wrappedRec, `{"xcodex_event_type":"session-end"}`)
+	if want := []string{"header", "session-start@2025-01-01T10:00:00Z", "session-end@"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrapped file = %q, want %q", got, want)
+	}
+	if m, ok := dec.Meta(); !ok || m != testMeta {
+		t.Errorf("Meta = %+v, %v", m, ok)
+	}
+
+	// In a plain file, nothing is a wrapper.
+	plain := testMeta
+	plain.Format = jsonl.MetaFormatPlain
+	header, _ = plain.Header(jsonl.FormatJSONL)
+	if _, got := decodeAll(t, string(header), eventRec); !reflect.DeepEqual(got, []string{"header", "@"}) {
+		t.Errorf("plain file = %q", got)
+	}
+
+	// Numbers are json.Number.
+	var dec2 jsonl.Decoder
+	ev, _ := dec2.Decode([]byte(`{"xcodex_event_type":"x","duration_ms":12}`))
+	if n, ok := ev.Payload["duration_ms"].(json.Number); !ok || n != "12" {
+		t.Errorf("duration_ms = %#v", ev.Payload["duration_ms"])
+	}
+}
+
+func TestHeaderAcrossRotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	header, _ := testMeta.Header(jsonl.FormatJSONL)
+	opts := rotatingOptions()
+	opts.Header = header
+	if err := appendRecords(path, opts, "first", 40, 0); err != nil {
+		t.Fatal(err)
+	}
+	// Processes racing to start each file still write its header once.
+	t.Setenv("JSONL_TEST_HEADER", "1")
+	appendFromProcesses(t, path, 4, 40, 0)
+
+	files := jsonl.Files(path)
+	if len(files) < 3 {
+		t.Fatalf("%d files; the log barely rotated", len(files))
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), string(header)) || strings.Count(string(data), `"_meta"`) != 1 {
+			t.Errorf("%s: %d headers, starting %q", file, strings.Count(string(data), `"_meta"`), data[:min(len(data), 80)])
+		}
+	}
+	checkAll(t, path, 4, 40)
+}
+
+func TestDecodeNotObject(t *testing.T) {
+	var dec jsonl.Decoder
+	for _, rec := range []string{"", "null", `"s"`, "{"} {
+		if _, err := dec.Decode([]byte(rec)); !errors.Is(err, jsonl.ErrNotObject) {
+			t.Errorf("Decode(%q) = %v, want ErrNotObject", rec, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package jsonl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// maxNameLen keeps generated file names well under common file system limits, leaving room for
+// the `.jsonl.N.gz` suffixes added by rotation.
+const maxNameLen = 128
+
+// SafeName turns an untrusted identifier (such as a session id from a payload) into a single path
+// element that is safe to use as a file name: characters other than letters, digits, `-`, `_`,
+// and `.` become `_`, leading dots are replaced (no hidden files, no `..`), and overly long names
+// are truncated with a hash suffix so distinct ids stay distinct. It returns false for an empty
+// id.
+func SafeName(id string) (string, bool) {
+	var b strings.Builder
+	for i, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		case r == '.' && i > 0 && !strings.HasSuffix(b.String(), "."):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	name := strings.TrimRight(b.String(), ".")
+	if strings.Trim(name, "_") == "" {
+		if strings.TrimSpace(id) == "" {
+			return "", false
+		}
+		// Nothing printable survived (e.g. an id in another script); fall back to the hash.
+		name = "id"
+	}
+	if len(name) > maxNameLen || name != id {
+		// Sanitizing can map two ids to the same name (e.g. `a/b` and `a_b`); the hash keeps them
+		// apart.
+		sum := sha256.Sum256([]byte(id))
+		suffix := "-" + hex.EncodeToString(sum[:4])
+		if len(name) > maxNameLen-len(suffix) {
+			name = name[:maxNameLen-len(suffix)]
+		}
+		name += suffix
+	}
+	return name, true
+}
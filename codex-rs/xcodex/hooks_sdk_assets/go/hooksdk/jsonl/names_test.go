@@ -0,0 +1,48 @@
+package jsonl_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+func TestSafeName(t *testing.T) {
+	for id, want := range map[string]string{
+		"019a-session_1": "019a-session_1",
+		"v1.2":           "v1.2",
+	} {
+		if got, ok := jsonl.SafeName(id); !ok || got != want {
+			t.Errorf("SafeName(%q) = %q, %v; want %q", id, got, ok, want)
+		}
+	}
+
+	seen := map[string]string{}
+	for _, id := range []string{
+		"../../etc/passwd", "..", ".hidden", "a/b", "a_b", `a\b`, "a\x00b", "C:evil", "séance", "会话",
+		strings.Repeat("x", 1000), strings.Repeat("x", 1001), "trailing.",
+	} {
+		name, ok := jsonl.SafeName(id)
+		if !ok {
+			t.Errorf("SafeName(%q) failed", id)
+			continue
+		}
+		if name != filepath.Base(name) || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\:`+"\x00") {
+			t.Errorf("SafeName(%q) = %q, not a safe file name", id, name)
+		}
+		if len(name) > 128 {
+			t.Errorf("SafeName(%q) is %d bytes long", id, len(name))
+		}
+		if other, dup := seen[name]; dup {
+			t.Errorf("SafeName(%q) = SafeName(%q) = %q", id, other, name)
+		}
+		seen[name] = id
+	}
+
+	for _, id := range []string{"", "  "} {
+		if name, ok := jsonl.SafeName(id); ok {
+			t.Errorf("SafeName(%q) = %q, want ok=false", id, name)
+		}
+	}
+}
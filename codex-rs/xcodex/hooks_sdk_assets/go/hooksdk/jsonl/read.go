@@ -0,0 +1,153 @@
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Files returns the files of the log at path that exist, oldest first: the files a migration
+// moved aside (see LegacyFiles), its rotated generations (`<path>.N` down to `<path>.1`, plain or
+// gzipped), then path itself and `<path>.gz` (see Options.GzipStream).
+func Files(path string) []string {
+	type gen struct {
+		n    int
+		path string
+	}
+	var gens []gen
+	matches, _ := filepath.Glob(path + ".*")
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, path+"."), gzExt)
+		if n, err := strconv.Atoi(suffix); err == nil && n > 0 {
+			gens = append(gens, gen{n, m})
+		}
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i].n > gens[j].n })
+	out := LegacyFiles(path)
+	for _, g := range gens {
+		out = append(out, g.path)
+	}
+	for _, p := range []string{path, path + gzExt} {
+		if _, err := os.Stat(p); err == nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Open opens a log file for reading, decompressing it if it is gzipped (see NewReader).
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{r, f}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	f *os.File
+}
+
+func (r readCloser) Close() error { return r.f.Close() }
+
+// NewReader returns r, decompressed if it starts like a gzip stream: a rotated generation, or a
+// log of any number of gzip members (Options.GzipStream). A member cut short, as a crash can leave
+// the last one, ends the stream instead of failing it.
+func NewReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	if magic, _ := br.Peek(2); len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return truncatedReader{zr}, nil
+}
+
+// truncatedReader ends a gzip stream at a member that is cut short instead of failing.
+type truncatedReader struct {
+	r io.Reader
+}
+
+func (t truncatedReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// ScanRecords calls fn with each record read from r, without its trailing newline: every line,
+// or, in a FormatPretty log, the text between separator lines. Blank records are skipped. It
+// stops at the first error from fn or from r. rec is only valid until fn returns.
+func ScanRecords(r io.Reader, fn func(rec []byte) error) error {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, 64<<10)
+	}
+	var s splitter
+	for {
+		line, rerr := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if err := s.line(line, fn); err != nil {
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			return s.flush(fn)
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+}
+
+// splitter splits a log into records, fed one line at a time (see ScanRecords).
+type splitter struct {
+	pretty   []byte
+	inPretty bool
+}
+
+var prettySeparatorLine = strings.TrimSuffix(prettySeparator, "\n")
+
+func (s *splitter) line(line []byte, fn func(rec []byte) error) error {
+	trimmed := bytes.TrimRight(line, "\r\n")
+	switch {
+	case string(trimmed) == prettySeparatorLine:
+		err := s.flush(fn)
+		s.inPretty = true
+		return err
+	case s.inPretty:
+		s.pretty = append(s.pretty, line...)
+		return nil
+	}
+	return emit(trimmed, fn)
+}
+
+// flush ends the pretty record being read, if any.
+func (s *splitter) flush(fn func(rec []byte) error) error {
+	rec := s.pretty
+	s.pretty = s.pretty[:0]
+	return emit(rec, fn)
+}
+
+func emit(rec []byte, fn func(rec []byte) error) error {
+	if len(bytes.TrimSpace(rec)) == 0 {
+		return nil
+	}
+	return fn(rec)
+}
@@ -0,0 +1,108 @@
+package jsonl_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+func scanAll(t *testing.T, r io.Reader) []string {
+	t.Helper()
+	var got []string
+	if err := jsonl.ScanRecords(r, func(rec []byte) error {
+		got = append(got, string(rec))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestScanRecords(t *testing.T) {
+	in := "{\"a\":1}\r\n\n   \n{\"b\":2}\n---\n{\n  \"c\": 3\n}\n---\n{\"d\":\n4}\n"
+	want := []string{`{"a":1}`, `{"b":2}`, "{\n  \"c\": 3\n}\n", "{\"d\":\n4}\n"}
+	if got := scanAll(t, strings.NewReader(in)); !reflect.DeepEqual(got, want) {
+		t.Errorf("records = %q, want %q", got, want)
+	}
+	// A last line without a newline is still a record.
+	if got := scanAll(t, strings.NewReader(`{"a":1}`+"\n"+`{"b":2}`)); len(got) != 2 || got[1] != `{"b":2}` {
+		t.Errorf("records = %q", got)
+	}
+
+	boom := errors.New("boom")
+	if err := jsonl.ScanRecords(strings.NewReader("x\ny\n"), func([]byte) error { return boom }); !errors.Is(err, boom) {
+		t.Errorf("ScanRecords = %v, want fn's error", err)
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	data := line(0) + "\n" + line(1) + "\n"
+	plain, err := jsonl.NewReader(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scanAll(t, plain); len(got) != 2 {
+		t.Errorf("plain records = %q", got)
+	}
+
+	// Many members, the last cut short: the records before it are read.
+	stream := append(gzipData(t, []byte(line(0)+"\n")), gzipData(t, []byte(line(1)+"\n"))...)
+	last := gzipData(t, []byte(line(2)+"\n"))
+	stream = append(stream, last[:len(last)/2]...)
+	zr, err := jsonl.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scanAll(t, zr); !reflect.DeepEqual(got[:2], []string{line(0), line(1)}) || len(got) > 3 {
+		t.Errorf("gzip records = %q", got)
+	}
+
+	// Too short to tell, or empty, is read as plain.
+	for _, in := range []string{"", "{"} {
+		r, err := jsonl.NewReader(strings.NewReader(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := io.ReadAll(r); string(got) != in {
+			t.Errorf("NewReader(%q) read %q", in, got)
+		}
+	}
+	if _, err := jsonl.NewReader(bytes.NewReader([]byte{0x1f, 0x8b, 0})); err == nil {
+		t.Error("a broken gzip header was accepted")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hooks.jsonl")
+	for _, name := range []string{"hooks.jsonl", "hooks.jsonl.gz", "hooks.jsonl.1", "hooks.jsonl.2.gz", "hooks.jsonl.10", "hooks.jsonl.lock", "hooks.jsonl.x.gz", "other.jsonl"} {
+		writeFile(t, filepath.Join(dir, name), []byte(line(0)+"\n"))
+	}
+	want := []string{path + ".10", path + ".2.gz", path + ".1", path, path + ".gz"}
+	if got := jsonl.Files(path); !reflect.DeepEqual(got, want) {
+		t.Errorf("Files = %q, want %q", got, want)
+	}
+	if got := jsonl.Files(filepath.Join(dir, "missing.jsonl")); len(got) != 0 {
+		t.Errorf("Files of a missing log = %q", got)
+	}
+
+	writeFile(t, path+".1", gzipData(t, []byte(line(1)+"\n")))
+	r, err := jsonl.Open(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got := scanAll(t, r); !reflect.DeepEqual(got, []string{line(1)}) {
+		t.Errorf("Open read %q", got)
+	}
+	if _, err := jsonl.Open(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("Open(missing) = %v", err)
+	}
+}
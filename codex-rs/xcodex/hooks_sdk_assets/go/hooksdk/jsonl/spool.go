@@ -0,0 +1,125 @@
+package jsonl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+)
+
+// ErrSpooled is returned (wrapped, with the spool file and the original error) when a line could
+// not be written to the log and was saved to the spool directory instead.
+var ErrSpooled = errors.New("line spooled")
+
+// DefaultSpoolDir is where OptionsFromEnv spools lines when CODEX_HOOKLOG_SPOOL_DIR is unset:
+// `<os.TempDir()>/xcodex-hooks-spool`.
+func DefaultSpoolDir() string {
+	return filepath.Join(os.TempDir(), "xcodex-hooks-spool")
+}
+
+// spool saves line to today's spool file for w, after the log itself failed with cause.
+func (w *Writer) spool(line []byte, cause error) error {
+	dir := w.opts.SpoolDir
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("%w (spooling to %s also failed: %v)", cause, dir, err)
+	}
+	lock, err := filelock.AcquireTimeout(w.spoolLockPath(), w.lockTimeout())
+	if err != nil {
+		return fmt.Errorf("%w (spooling to %s also failed: %v)", cause, dir, err)
+	}
+	defer lock.Unlock()
+
+	path := filepath.Join(dir, time.Now().UTC().Format("2006-01-02")+"-"+w.spoolKey()+".jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%w (spooling to %s also failed: %v)", cause, path, err)
+	}
+	_, err = f.Write(line)
+	if err == nil && w.opts.Sync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("%w (spooling to %s also failed: %v)", cause, path, err)
+	}
+	return fmt.Errorf("%w to %s: %w", ErrSpooled, path, cause)
+}
+
+// drainSpool moves the lines spooled for w into f, which is the log opened for appending under
+// the log's lock. Spool files are drained oldest first and each one is removed right after its
+// lines are written; if either step fails the log is truncated back, so a line is never logged
+// twice. Problems with the spool itself are ignored: they must not keep the new event out. In an
+// audit log the lines are linked into the chain after *prev, which is advanced past them.
+func (w *Writer) drainSpool(f *os.File, prev *Chain) error {
+	pattern := filepath.Join(w.opts.SpoolDir, "*-"+w.spoolKey()+".jsonl")
+	if files, _ := filepath.Glob(pattern); len(files) == 0 {
+		return nil
+	}
+	lock, err := filelock.AcquireTimeout(w.spoolLockPath(), w.lockTimeout())
+	if err != nil {
+		return nil
+	}
+	defer lock.Unlock()
+
+	// List again under the lock: another process may have drained the spool meanwhile.
+	files, _ := filepath.Glob(pattern)
+	sort.Strings(files)
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		if data[len(data)-1] != '\n' {
+			data = append(data, '\n')
+		}
+		next := *prev
+		if w.opts.Audit {
+			if data = linkLines(data, &next); len(data) == 0 {
+				os.Remove(path)
+				continue
+			}
+		}
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if err := w.write(f, data); err != nil {
+			f.Truncate(info.Size())
+			return err
+		}
+		// The lines must be on disk in the log before they are removed from the spool.
+		if w.opts.Sync {
+			if err := f.Sync(); err != nil {
+				f.Truncate(info.Size())
+				return err
+			}
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return f.Truncate(info.Size())
+		}
+		*prev = next
+	}
+	return nil
+}
+
+// spoolKey distinguishes the spool files of different logs sharing a spool directory.
+func (w *Writer) spoolKey() string {
+	path, err := filepath.Abs(w.path)
+	if err != nil {
+		path = w.path
+	}
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (w *Writer) spoolLockPath() string {
+	return filepath.Join(w.opts.SpoolDir, w.spoolKey()+".lock")
+}
@@ -0,0 +1,124 @@
+package jsonl_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// unwritableLog returns the path of a log that can't be written, because a file is in the way of
+// its directory (a read-only directory would do too, but not when the tests run as root), and a
+// function that makes it writable.
+func unwritableLog(t *testing.T) (path string, fix func()) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "home")
+	if err := os.WriteFile(dir, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "hooks.jsonl"), func() {
+		if err := os.Remove(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func spoolOptions(t *testing.T) jsonl.Options {
+	return jsonl.Options{SpoolDir: filepath.Join(t.TempDir(), "spool"), LockTimeout: time.Minute}
+}
+
+func spoolFiles(t *testing.T, opts jsonl.Options) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(opts.SpoolDir, "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSpoolAndDrain(t *testing.T) {
+	path, fix := unwritableLog(t)
+	opts := spoolOptions(t)
+	for i := 0; i < 3; i++ {
+		err := jsonl.New(path, opts).Append(record{Writer: "w", N: i})
+		if !errors.Is(err, jsonl.ErrSpooled) {
+			t.Fatalf("Append to an unwritable log: %v, want ErrSpooled", err)
+		}
+	}
+	if files := spoolFiles(t, opts); len(files) != 1 {
+		t.Fatalf("spool files = %v, want one", files)
+	}
+
+	// The next append that succeeds moves the spooled lines into the log first.
+	fix()
+	if err := jsonl.New(path, opts).Append(record{Writer: "w", N: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, path)["w"]; len(got) != 4 || got[0] != 0 || got[3] != 3 {
+		t.Errorf("log records = %v, want 0 1 2 3", got)
+	}
+	if files := spoolFiles(t, opts); len(files) != 0 {
+		t.Errorf("spool files = %v after draining, want none", files)
+	}
+
+	// Without a spool directory, the error is returned as is.
+	blocked, _ := unwritableLog(t)
+	if err := jsonl.New(blocked, jsonl.Options{}).Append(record{}); err == nil || errors.Is(err, jsonl.ErrSpooled) {
+		t.Errorf("Append without a spool: %v, want the write error", err)
+	}
+}
+
+func TestSpoolIsPerLog(t *testing.T) {
+	a, fixA := unwritableLog(t)
+	b, fixB := unwritableLog(t)
+	opts := spoolOptions(t)
+	jsonl.New(a, opts).Append(record{Writer: "a"})
+	jsonl.New(b, opts).Append(record{Writer: "b"})
+	fixA()
+	fixB()
+	jsonl.New(a, opts).Append(record{Writer: "a", N: 1})
+	if got := readAll(t, a); len(got["a"]) != 2 || len(got["b"]) != 0 {
+		t.Errorf("log a = %v, want only its own records", got)
+	}
+	if files := spoolFiles(t, opts); len(files) != 1 {
+		t.Errorf("spool files = %v, want b's left", files)
+	}
+}
+
+func TestConcurrentDrain(t *testing.T) {
+	path, fix := unwritableLog(t)
+	opts := spoolOptions(t)
+	const spooled = 20
+	for i := 0; i < spooled; i++ {
+		jsonl.New(path, opts).Append(record{Writer: "spooled", N: i})
+	}
+	fix()
+
+	// Many hooks find the spool at once; each spooled line still ends up in the log once.
+	const writers = 8
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			if err := jsonl.New(path, opts).Append(record{Writer: strconv.Itoa(w)}); err != nil {
+				t.Error(err)
+			}
+		}(w)
+	}
+	wg.Wait()
+	checkAll(t, path, writers, 1)
+	got := readAll(t, path)["spooled"]
+	seen := map[int]bool{}
+	for _, i := range got {
+		seen[i] = true
+	}
+	if len(got) != spooled || len(seen) != spooled {
+		t.Errorf("spooled records in the log = %v, want each of %d once", got, spooled)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package jsonl
+
+import "os"
+
+// syncDir fsyncs a directory, so the files created or renamed in it survive a power loss.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,150 @@
+package jsonl_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// badLines returns the lines of path and its rotated generations that aren't valid JSON.
+func badLines(t *testing.T, path string) []string {
+	t.Helper()
+	files, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bad []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		sc.Buffer(nil, 1<<20)
+		for sc.Scan() {
+			if !json.Valid(sc.Bytes()) {
+				bad = append(bad, sc.Text())
+			}
+		}
+	}
+	return bad
+}
+
+func TestSyncAppends(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "hooks.jsonl")
+		opts := rotatingOptions()
+		opts.Sync, opts.Compress = true, compress
+		if err := appendRecords(path, opts, "0", 40, 0); err != nil {
+			t.Fatalf("compress %v: %v", compress, err)
+		}
+		if err := jsonl.New(path, opts).Rotate(); err != nil {
+			t.Fatalf("compress %v: Rotate: %v", compress, err)
+		}
+		got := 0
+		for _, line := range readLines(t, path) {
+			if json.Valid(line) {
+				got++
+			}
+		}
+		if got != 40 {
+			t.Errorf("compress %v: %d of 40 records in the log", compress, got)
+		}
+	}
+}
+
+// readLines returns the lines of path and its rotated generations, decompressing gzipped ones.
+func readLines(t *testing.T, path string) [][]byte {
+	t.Helper()
+	files, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines [][]byte
+	for _, file := range files {
+		r, err := jsonl.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			lines = append(lines, append([]byte(nil), sc.Bytes()...))
+		}
+		r.Close()
+	}
+	return lines
+}
+
+func TestAppendFinishesPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	if err := os.WriteFile(path, []byte(`{"writer":"0","n":0}`+"\n"+`{"writer":"0","n":1,"pa`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w := jsonl.New(path, jsonl.Options{})
+	if err := w.Append(record{Writer: "0", N: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Append(record{Writer: "0", N: 3}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	want := `{"writer":"0","n":0}` + "\n" + `{"writer":"0","n":1,"pa` + "\n" + `{"writer":"0","n":2}` + "\n" + `{"writer":"0","n":3}` + "\n"
+	if string(data) != want {
+		t.Errorf("log = %q, want %q", data, want)
+	}
+}
+
+// TestKilledWriter kills a syncing writer process mid-stream, then checks that later appends
+// parse: at most the line the kill cut short is lost.
+func TestKilledWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "JSONL_TEST_APPEND="+path, "JSONL_TEST_COUNT=1000000",
+		"JSONL_TEST_WRITER=killed", "JSONL_TEST_PAD=20000", "JSONL_TEST_SYNC=1")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Wait for a rotation or two, so the kill can land on any step of an append.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if _, err := os.Stat(path + ".2"); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	// A torn line, as a kill in the middle of a write leaves, whether or not this one did.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"writer":"killed","n":-1,"pad":"ppp`)
+	f.Close()
+
+	// Without rotation, so the next record lands right after the torn line.
+	if err := appendRecords(path, jsonl.Options{Sync: true, LockTimeout: time.Minute}, "after", 5, 0); err != nil {
+		t.Fatal(err)
+	}
+	if bad := badLines(t, path); len(bad) < 1 || len(bad) > 2 {
+		t.Errorf("%d bad lines, want the torn one, and at most one the kill cut: %.80q", len(bad), bad)
+	}
+	var after []int
+	for _, line := range readLines(t, path) {
+		var r record
+		if json.Unmarshal(line, &r) == nil && r.Writer == "after" {
+			after = append(after, r.N)
+		}
+	}
+	if len(after) != 5 {
+		t.Errorf("records appended after the kill = %v, want 5", after)
+	}
+}
@@ -0,0 +1,5 @@
+package jsonl
+
+// syncDir does nothing on Windows, where directories can't be opened for syncing; NTFS journals
+// the renames and creations Options.Sync cares about.
+func syncDir(dir string) error { return nil }
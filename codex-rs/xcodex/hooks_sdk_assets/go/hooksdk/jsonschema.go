@@ -0,0 +1,441 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// schemaNode is a JSON Schema (a map, or a boolean schema) within the document root. It checks the
+// draft-07 keywords the embedded schemas use: type, const, enum, minLength, pattern, minimum,
+// maximum, format (integer widths), required, properties, additionalProperties, items, allOf,
+// anyOf, oneOf, and $ref to `#/definitions/...`. Annotations such as title and description are ignored.
+type schemaNode struct {
+	def  any
+	root map[string]any
+}
+
+// integerFormats bound the integer formats schemars emits.
+var integerFormats = map[string][2]float64{
+	"uint32": {0, math.MaxUint32},
+	"int32":  {math.MinInt32, math.MaxInt32},
+}
+
+func (s *schemaNode) child(def any) *schemaNode {
+	return &schemaNode{def: def, root: s.root}
+}
+
+// validate returns the violations of v (at JSON pointer ptr), sorted by pointer.
+func (s *schemaNode) validate(v any, ptr string) []Violation {
+	out := s.check(v, ptr)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Pointer < out[j].Pointer })
+	return out
+}
+
+func (s *schemaNode) check(v any, ptr string) []Violation {
+	switch def := s.def.(type) {
+	case bool:
+		if def {
+			return nil
+		}
+		return []Violation{{ptr, "not allowed"}}
+	case map[string]any:
+		if ref, ok := def["$ref"].(string); ok {
+			target, err := s.resolve(ref)
+			if err != nil {
+				return []Violation{{ptr, err.Error()}}
+			}
+			return s.child(target).check(v, ptr)
+		}
+		if vs, ok := s.checkType(def, v, ptr); !ok {
+			return vs
+		}
+		var out []Violation
+		out = append(out, s.checkValue(def, v, ptr)...)
+		out = append(out, s.checkObject(def, v, ptr)...)
+		if items, ok := def["items"]; ok {
+			if arr, ok := v.([]any); ok {
+				for i, item := range arr {
+					out = append(out, s.child(items).check(item, ptr+"/"+strconv.Itoa(i))...)
+				}
+			}
+		}
+		if all, ok := def["allOf"].([]any); ok {
+			for _, sub := range all {
+				out = append(out, s.child(sub).check(v, ptr)...)
+			}
+		}
+		if anyOf, ok := def["anyOf"].([]any); ok {
+			out = append(out, s.checkAlternatives(anyOf, v, ptr, false)...)
+		}
+		if oneOf, ok := def["oneOf"].([]any); ok {
+			out = append(out, s.checkAlternatives(oneOf, v, ptr, true)...)
+		}
+		return out
+	}
+	return nil
+}
+
+// checkType reports a value of the wrong JSON type; nothing else is checked then.
+func (s *schemaNode) checkType(def map[string]any, v any, ptr string) ([]Violation, bool) {
+	var types []string
+	switch t := def["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+	default:
+		return nil, true
+	}
+	for _, t := range types {
+		if hasType(v, t) {
+			return nil, true
+		}
+	}
+	return []Violation{{ptr, fmt.Sprintf("must be %s, not %s", strings.Join(types, " or "), jsonType(v))}}, false
+}
+
+func (s *schemaNode) checkValue(def map[string]any, v any, ptr string) []Violation {
+	var out []Violation
+	if c, ok := def["const"]; ok && !jsonEqual(c, v) {
+		out = append(out, Violation{ptr, "must be " + jsonText(c)})
+	}
+	if enum, ok := def["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			values := make([]string, len(enum))
+			for i, e := range enum {
+				values[i] = jsonText(e)
+			}
+			out = append(out, Violation{ptr, "must be one of " + strings.Join(values, ", ")})
+		}
+	}
+	if str, ok := v.(string); ok {
+		if min, ok := number(def["minLength"]); ok && float64(utf8.RuneCountInString(str)) < min {
+			msg := fmt.Sprintf("must be at least %v characters", min)
+			if min == 1 {
+				msg = "must not be empty"
+			}
+			out = append(out, Violation{ptr, msg})
+		}
+		if pattern, ok := def["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			switch {
+			case err != nil:
+				out = append(out, Violation{ptr, "schema pattern " + strconv.Quote(pattern) + " is invalid"})
+			case !re.MatchString(str):
+				out = append(out, Violation{ptr, "must match " + pattern})
+			}
+		}
+	}
+	n, isNum := number(v)
+	if !isNum {
+		return out
+	}
+	if min, ok := number(def["minimum"]); ok && n < min {
+		out = append(out, Violation{ptr, fmt.Sprintf("must be at least %v", min)})
+	}
+	if max, ok := number(def["maximum"]); ok && n > max {
+		out = append(out, Violation{ptr, fmt.Sprintf("must be at most %v", max)})
+	}
+	if format, _ := def["format"].(string); format != "" {
+		if r, ok := integerFormats[format]; ok && (n < r[0] || n > r[1]) {
+			out = append(out, Violation{ptr, "out of range for " + format})
+		}
+	}
+	return out
+}
+
+func (s *schemaNode) checkObject(def map[string]any, v any, ptr string) []Violation {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	var out []Violation
+	if required, ok := def["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := obj[name]; !present {
+					out = append(out, Violation{ptr + "/" + escapePointer(name), "required"})
+				}
+			}
+		}
+	}
+	props, _ := def["properties"].(map[string]any)
+	additional, hasAdditional := def["additionalProperties"]
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		sub, ok := props[k]
+		if !ok {
+			if !hasAdditional {
+				continue
+			}
+			sub = additional
+		}
+		out = append(out, s.child(sub).check(obj[k], ptr+"/"+escapePointer(k))...)
+	}
+	return out
+}
+
+// checkAlternatives applies anyOf (or, with exactlyOne, oneOf). When no alternative matches, the
+// violations of the one alternative that was meant are reported if it can be told: the only one
+// of the right type (the object branch of `{"anyOf": [{"$ref": ...}, {"type": "null"}]}`), or the
+// only one whose tag field (such as SandboxPolicy's `type`) matches.
+func (s *schemaNode) checkAlternatives(alts []any, v any, ptr string, exactlyOne bool) []Violation {
+	matched := 0
+	var candidates, tagged [][]Violation
+	var types []string
+	for _, alt := range alts {
+		vs := s.child(alt).check(v, ptr)
+		if len(vs) == 0 {
+			matched++
+			continue
+		}
+		if t := s.child(alt).declaredType(v); t != "" {
+			types = append(types, t)
+			continue
+		}
+		candidates = append(candidates, vs)
+		if s.child(alt).tagMatches(v) {
+			tagged = append(tagged, vs)
+		}
+	}
+	if matched == 0 && len(tagged) == 1 {
+		return tagged[0]
+	}
+	switch {
+	case matched == 1 || (matched > 1 && !exactlyOne):
+		return nil
+	case matched > 1:
+		return []Violation{{ptr, fmt.Sprintf("matches %d of the allowed forms; it must match exactly one", matched)}}
+	case len(candidates) == 0:
+		return []Violation{{ptr, fmt.Sprintf("must be %s, not %s", strings.Join(types, " or "), jsonType(v))}}
+	case len(candidates) == 1:
+		return candidates[0]
+	}
+	// Alternatives told apart by one field (a `type` tag, say) fail on that field alone: merge
+	// their allowed values into one violation.
+	var values []string
+	for _, vs := range candidates {
+		msg, ok := strings.CutPrefix(vs[0].Message, "must be one of ")
+		if !ok {
+			msg, ok = strings.CutPrefix(vs[0].Message, "must be ")
+		}
+		if len(vs) != 1 || vs[0].Pointer != candidates[0][0].Pointer || !ok {
+			return []Violation{{ptr, fmt.Sprintf("matches none of the %d allowed forms", len(alts))}}
+		}
+		values = append(values, msg)
+	}
+	return []Violation{{candidates[0][0].Pointer, "must be one of " + strings.Join(values, ", ")}}
+}
+
+// tagMatches reports whether v has every const or single-value enum property the schema declares
+// with the declared value, and at least one such property.
+func (s *schemaNode) tagMatches(v any) bool {
+	def, ok := s.def.(map[string]any)
+	if !ok {
+		return false
+	}
+	if ref, ok := def["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		return err == nil && s.child(target).tagMatches(v)
+	}
+	obj, ok := v.(map[string]any)
+	props, _ := def["properties"].(map[string]any)
+	if !ok || props == nil {
+		return false
+	}
+	tags := 0
+	for name, sub := range props {
+		sub, _ := sub.(map[string]any)
+		want, ok := sub["const"]
+		if enum, isEnum := sub["enum"].([]any); !ok && isEnum && len(enum) == 1 {
+			want, ok = enum[0], true
+		}
+		if !ok {
+			continue
+		}
+		if got, present := obj[name]; !present || !jsonEqual(want, got) {
+			return false
+		}
+		tags++
+	}
+	return tags > 0
+}
+
+// declaredType returns the JSON types the schema allows when v has none of them, else "".
+func (s *schemaNode) declaredType(v any) string {
+	def, ok := s.def.(map[string]any)
+	if !ok {
+		return ""
+	}
+	if ref, ok := def["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		if err != nil {
+			return ""
+		}
+		return s.child(target).declaredType(v)
+	}
+	if _, ok := def["type"]; !ok {
+		return ""
+	}
+	vs, ok := s.checkType(def, v, "")
+	if ok || len(vs) == 0 {
+		return ""
+	}
+	msg := strings.TrimPrefix(vs[0].Message, "must be ")
+	msg, _, _ = strings.Cut(msg, ", not ")
+	return msg
+}
+
+// resolve finds a `#/...` reference in the document root.
+func (s *schemaNode) resolve(ref string) (any, error) {
+	path, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	var cur any = s.root
+	for _, seg := range strings.Split(path, "/") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolved $ref %q", ref)
+		}
+		seg = strings.ReplaceAll(strings.ReplaceAll(seg, "~1", "/"), "~0", "~")
+		if cur, ok = m[seg]; !ok {
+			return nil, fmt.Errorf("unresolved $ref %q", ref)
+		}
+	}
+	return cur, nil
+}
+
+func hasType(v any, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "number":
+		_, ok := number(v)
+		return ok
+	case "integer":
+		if n, ok := v.(json.Number); ok {
+			if _, err := n.Int64(); err == nil {
+				return true
+			}
+		}
+		f, ok := number(v)
+		return ok && !math.IsInf(f, 0) && f == math.Trunc(f)
+	}
+	return false
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	if _, ok := number(v); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// jsonEqual compares JSON values, treating numbers by value (payload numbers are json.Number,
+// schema numbers float64).
+func jsonEqual(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, xv := range x {
+			yv, ok := y[k]
+			if !ok || !jsonEqual(xv, yv) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func jsonText(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// escapePointer escapes a key as a JSON pointer segment (RFC 6901).
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
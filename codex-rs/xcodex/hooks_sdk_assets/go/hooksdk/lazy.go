@@ -0,0 +1,217 @@
+package hooksdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// LazyPayload is a payload whose top-level fields are located but not decoded. Common metadata is
+// decoded eagerly; everything else (tool output, file contents, ...) is decoded only when asked
+// for, straight from the original bytes.
+//
+// Use it for hooks that only look at metadata of events that can carry megabytes of tool output.
+type LazyPayload struct {
+	SchemaVersion   int64
+	EventID         string
+	Timestamp       string
+	HookEventName   string
+	XcodexEventType string
+	SessionID       string
+	Cwd             string
+	TurnID          string
+	ToolName        string
+
+	data   []byte
+	fields map[string]span
+}
+
+// span is the byte range of a top-level value in LazyPayload.data.
+type span struct{ start, end int }
+
+// ReadPayloadLazy is like ReadPayload, but returns a LazyPayload.
+func ReadPayloadLazy(opts ...Option) (*LazyPayload, error) {
+	o := newOptions(opts)
+	o.capture = o.startCapture()
+	full, _, err := readFullPayloadBytes(context.Background(), o.stdio.in(), o)
+	if err != nil {
+		o.capture.finish(nil, err)
+		return nil, err
+	}
+	l, err := ParseLazyPayload(full)
+	o.capture.finish(nil, err)
+	return l, err
+}
+
+// ParseLazyPayload indexes the top-level fields of a payload object without decoding them. data
+// must stay unmodified while the LazyPayload is in use.
+func ParseLazyPayload(data []byte) (*LazyPayload, error) {
+	if isBlank(data) {
+		return nil, ErrEmptyPayload
+	}
+	if !json.Valid(data) {
+		var v any
+		return nil, json.Unmarshal(data, &v)
+	}
+
+	fields, err := indexObject(data)
+	if err != nil {
+		return nil, err
+	}
+	l := &LazyPayload{data: data, fields: fields}
+
+	for key, dst := range map[string]*string{
+		"event_id":          &l.EventID,
+		"timestamp":         &l.Timestamp,
+		"hook_event_name":   &l.HookEventName,
+		"xcodex_event_type": &l.XcodexEventType,
+		"session_id":        &l.SessionID,
+		"cwd":               &l.Cwd,
+		"turn_id":           &l.TurnID,
+		"tool_name":         &l.ToolName,
+	} {
+		if raw, ok := l.Raw(key); ok {
+			_ = json.Unmarshal(raw, dst)
+		}
+	}
+	if raw, ok := l.Raw("schema_version"); ok {
+		_ = json.Unmarshal(raw, &l.SchemaVersion)
+	}
+	return l, nil
+}
+
+// Keys returns the top-level field names, sorted.
+func (l *LazyPayload) Keys() []string {
+	keys := make([]string, 0, len(l.fields))
+	for k := range l.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Raw returns the undecoded JSON of a top-level field. The slice aliases the payload bytes.
+func (l *LazyPayload) Raw(key string) (json.RawMessage, bool) {
+	s, ok := l.fields[key]
+	if !ok {
+		return nil, false
+	}
+	return json.RawMessage(l.data[s.start:s.end]), true
+}
+
+// Decode decodes a top-level field into v (numbers in untyped values decode as json.Number).
+func (l *LazyPayload) Decode(key string, v any) error {
+	raw, ok := l.Raw(key)
+	if !ok {
+		return fmt.Errorf("field %q not present", key)
+	}
+	return unmarshalUseNumber(raw, v)
+}
+
+// String decodes a top-level string field.
+func (l *LazyPayload) String(key string) (string, error) {
+	var s string
+	if err := l.Decode(key, &s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// Lazy returns a thunk that decodes the string field key when called, so a handler can pass a large
+// field around without paying for it unless it is used.
+func (l *LazyPayload) Lazy(key string) func() (string, error) {
+	return func() (string, error) { return l.String(key) }
+}
+
+// Payload fully decodes the payload, exactly as ParseHookPayload would.
+func (l *LazyPayload) Payload(opts ...Option) (*HookPayload, error) {
+	return ParseHookPayload(l.data, opts...)
+}
+
+// indexObject records the span of every top-level value in a JSON object. data must be valid
+// JSON, so the scanner only needs to find value boundaries, not validate them.
+func indexObject(data []byte) (map[string]span, error) {
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return nil, errors.New("payload is not a JSON object")
+	}
+	fields := make(map[string]span)
+	i = skipSpace(data, i+1)
+	for i < len(data) && data[i] != '}' {
+		keyEnd := skipValue(data, i)
+		var key string
+		if err := json.Unmarshal(data[i:keyEnd], &key); err != nil {
+			return nil, err
+		}
+		i = skipSpace(data, keyEnd)
+		i = skipSpace(data, i+1) // ':'
+		end := skipValue(data, i)
+		fields[key] = span{start: i, end: end}
+		i = skipSpace(data, end)
+		if i < len(data) && data[i] == ',' {
+			i = skipSpace(data, i+1)
+		}
+	}
+	return fields, nil
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipValue returns the index just past the JSON value starting at i.
+func skipValue(data []byte, i int) int {
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for i < len(data) {
+			switch data[i] {
+			case '"':
+				i = skipString(data, i)
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+			i++
+		}
+		return i
+	default:
+		for i < len(data) {
+			switch data[i] {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				return i
+			}
+			i++
+		}
+		return i
+	}
+}
+
+func skipString(data []byte, i int) int {
+	for i++; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return i
+}
@@ -0,0 +1,120 @@
+package hooksdk_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// lazyPayload is a tool-call-finished payload whose output is size bytes of text with escapes.
+func lazyPayload(size int) []byte {
+	output := strings.Repeat("line with \"quotes\", a \\ backslash, tabs\t and ünïcødé {not: json}\n", size/64+1)
+	return hooktest.ToolCallFinished().WithSessionID("lazy").WithToolName("shell").
+		With("turn_id", "t1").
+		With("tool_response", map[string]any{"output": output[:size], "exit_code": 0}).
+		With("output_preview", output[:size]).
+		Bytes()
+}
+
+func TestParseLazyPayloadMatchesFullParse(t *testing.T) {
+	data := lazyPayload(1 << 16)
+	full, err := hooksdk.ParseHookPayload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := hooksdk.ParseLazyPayload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l.XcodexEventType != full.EventType() || l.SessionID != full.SessionID() || l.Cwd != full.WorkingDir() ||
+		l.EventID != full.EventId || l.Timestamp != full.Timestamp || l.HookEventName != full.HookEventName ||
+		l.ToolName != *full.ToolName || l.TurnID != *full.TurnId || l.SchemaVersion != int64(full.SchemaVersion) {
+		t.Errorf("metadata = %+v, doesn't match the full parse", l)
+	}
+
+	preview, err := l.Lazy("output_preview")()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview != *full.OutputPreview {
+		t.Errorf("lazy output_preview differs from the full parse")
+	}
+	var response map[string]any
+	if err := l.Decode("tool_response", &response); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(response, full.Raw()["tool_response"]) {
+		t.Errorf("lazy tool_response differs from the full parse")
+	}
+
+	keys := make([]string, 0, len(full.Raw()))
+	for k := range full.Raw() {
+		keys = append(keys, k)
+	}
+	if got := l.Keys(); len(got) != len(keys) {
+		t.Errorf("Keys() = %q, want the %d top-level fields", got, len(keys))
+	}
+
+	p, err := l.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := json.Marshal(p)
+	b, _ := json.Marshal(full)
+	if string(a) != string(b) {
+		t.Errorf("Payload() differs from ParseHookPayload")
+	}
+}
+
+func TestParseLazyPayloadMissingAndWrongType(t *testing.T) {
+	l, err := hooksdk.ParseLazyPayload(hooktest.SessionStart().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.Raw("tool_response"); ok {
+		t.Errorf("Raw(tool_response) found a field the payload doesn't have")
+	}
+	if _, err := l.String("tool_response"); err == nil {
+		t.Errorf("String(missing) succeeded")
+	}
+	if _, err := l.String("schema_version"); err == nil {
+		t.Errorf("String(number) succeeded")
+	}
+}
+
+func TestParseLazyPayloadErrors(t *testing.T) {
+	for _, data := range []string{"", "  ", "[1, 2]", `{"a": `, `"str"`} {
+		if _, err := hooksdk.ParseLazyPayload([]byte(data)); err == nil {
+			t.Errorf("ParseLazyPayload(%q) succeeded", data)
+		}
+	}
+}
+
+const benchmarkPayloadSize = 10 << 20
+
+func BenchmarkParseHookPayload(b *testing.B) {
+	data := lazyPayload(benchmarkPayloadSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := hooksdk.ParseHookPayload(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseLazyPayload(b *testing.B) {
+	data := lazyPayload(benchmarkPayloadSize)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := hooksdk.ParseLazyPayload(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
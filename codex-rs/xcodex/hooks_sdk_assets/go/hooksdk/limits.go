@@ -0,0 +1,47 @@
+package hooksdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxPayloadBytes is the largest payload (or envelope) the SDK reads unless overridden with
+// WithMaxPayloadBytes or the CODEX_HOOK_MAX_PAYLOAD environment variable.
+const DefaultMaxPayloadBytes int64 = 64 << 20
+
+// MaxPayloadEnv overrides DefaultMaxPayloadBytes (a byte count; 0 disables the limit).
+const MaxPayloadEnv = "CODEX_HOOK_MAX_PAYLOAD"
+
+// PayloadTooLargeError is returned when stdin, the payload_path file, or its decompressed contents
+// exceed the configured limit.
+type PayloadTooLargeError struct {
+	// Source is "stdin", "payload_path <path>", "payload_fd <n>", "decompressed payload_path
+	// <path>" (or payload_fd), or "socket" for a line sent to Serve.
+	Source string
+	Limit  int64
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("%s exceeds max payload size of %d bytes", e.Source, e.Limit)
+}
+
+func defaultMaxPayloadBytes() int64 {
+	return Environ().MaxPayloadBytes
+}
+
+// readAllLimit is readAllContext with a size cap. A limit of 0 or less means unlimited.
+func readAllLimit(ctx context.Context, r io.Reader, limit int64, source string) ([]byte, error) {
+	if limit <= 0 {
+		return readAllContext(ctx, r)
+	}
+	// Read one byte past the limit so an input of exactly limit bytes is still accepted.
+	data, err := readAllContext(ctx, io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &PayloadTooLargeError{Source: source, Limit: limit}
+	}
+	return data, nil
+}
@@ -0,0 +1,76 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func tooLarge(t *testing.T, err error) *hooksdk.PayloadTooLargeError {
+	t.Helper()
+	var e *hooksdk.PayloadTooLargeError
+	if !errors.As(err, &e) {
+		t.Fatalf("error = %v, want *PayloadTooLargeError", err)
+	}
+	return e
+}
+
+func TestMaxPayloadBytesStdin(t *testing.T) {
+	payload := hooktest.SessionStart().Bytes()
+	limit := int64(len(payload))
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(payload), hooksdk.WithMaxPayloadBytes(limit)); err != nil {
+		t.Errorf("payload of exactly the limit: %v", err)
+	}
+	_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(payload), hooksdk.WithMaxPayloadBytes(limit-1))
+	if e := tooLarge(t, err); e.Source != "stdin" || e.Limit != limit-1 {
+		t.Errorf("error = %+v, want stdin and the limit", e)
+	}
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(payload), hooksdk.WithMaxPayloadBytes(0)); err != nil {
+		t.Errorf("no limit: %v", err)
+	}
+}
+
+func TestMaxPayloadBytesFile(t *testing.T) {
+	payload := hooktest.ToolCallFinished().With("tool_response", string(bytes.Repeat([]byte("x"), 4096))).Bytes()
+	path := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// The envelope itself fits; the file it names doesn't.
+	stdin, _ := json.Marshal(map[string]string{"payload_path": path})
+	_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithMaxPayloadBytes(1024), hooksdk.WithPayloadRetry(0))
+	if e := tooLarge(t, err); e.Source != "payload_path "+path || e.Limit != 1024 {
+		t.Errorf("error = %+v, want the payload file and the limit", e)
+	}
+}
+
+func TestMaxPayloadBytesDecompressed(t *testing.T) {
+	payload := hooktest.ToolCallFinished().With("tool_response", string(bytes.Repeat([]byte("x"), 1<<16))).Bytes()
+	gz := gzipBytes(t, payload)
+	stdin := pathEnvelope(t, "payload.json.gz", gz, nil)
+	_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.WithMaxPayloadBytes(int64(len(gz))+1024))
+	if e := tooLarge(t, err); !strings.HasPrefix(e.Source, "decompressed payload_path ") {
+		t.Errorf("source = %q, want the decompressed file", e.Source)
+	}
+}
+
+func TestMaxPayloadEnv(t *testing.T) {
+	payload := hooktest.SessionStart().Bytes()
+	env := map[string]string{hooksdk.MaxPayloadEnv: strconv.Itoa(len(payload) - 1)}
+	stdio := hooksdk.IO{Getenv: func(k string) string { return env[k] }}
+	_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(payload), hooksdk.WithIO(stdio))
+	tooLarge(t, err)
+
+	// The option takes precedence.
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(payload), hooksdk.WithIO(stdio), hooksdk.WithMaxPayloadBytes(0)); err != nil {
+		t.Errorf("WithMaxPayloadBytes(0) over %s: %v", hooksdk.MaxPayloadEnv, err)
+	}
+}
@@ -0,0 +1,74 @@
+package hooksdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+)
+
+// ErrLockTimeout is returned (wrapped) by WithLock when the lock is still held by another hook
+// after the timeout.
+var ErrLockTimeout = errors.New("timed out waiting for hook lock")
+
+// WithLock runs fn while holding an exclusive lock named name, shared by every hook process on the
+// machine, so hooks that must not overlap (e.g. two snapshots of one repo) run one at a time.
+//
+// name may be any string; use a per-key name such as "git-snapshot:"+repoPath to serialize only
+// the events for one key. It waits at most timeout for the lock (timeout <= 0 waits indefinitely)
+// and then fails with an error wrapping ErrLockTimeout without running fn.
+//
+// The lock is an advisory OS file lock (flock, or LockFileEx on Windows) on a file in LockPath's
+// directory. The OS releases it when the holder exits, so a hook that crashed never leaves a stale
+// lock behind.
+func WithLock(name string, timeout time.Duration, fn func() error) (err error) {
+	path := LockPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	lock, err := filelock.AcquireTimeout(path, timeout)
+	if err != nil {
+		if errors.Is(err, filelock.ErrTimeout) {
+			return fmt.Errorf("%w %q after %v", ErrLockTimeout, name, timeout)
+		}
+		return err
+	}
+	defer func() {
+		if uerr := lock.Unlock(); err == nil {
+			err = uerr
+		}
+	}()
+	return fn()
+}
+
+// LockPath returns the file WithLock locks for name: `hooks/locks/<name>.lock` under CODEX_HOME
+// (default `~/.xcodex`). Names that aren't a plain file name (path separators, spaces, more than
+// 64 bytes, ...) are shortened and suffixed with a hash of the whole name, so distinct names never
+// share a file.
+func LockPath(name string) string {
+	return Environ().Path("hooks", "locks", lockFileName(name)+".lock")
+}
+
+func lockFileName(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	if safe == name && name != "" && len(name) <= 64 && !strings.HasPrefix(name, ".") {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	if len(safe) > 32 {
+		safe = safe[:32]
+	}
+	return strings.TrimLeft(safe, ".") + "-" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,132 @@
+package hooksdk_test
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestWithLockSerializes(t *testing.T) {
+	t.Setenv("CODEX_HOME", t.TempDir())
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		running int
+		peak    int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := hooksdk.WithLock("snapshot:/repo", 10*time.Second, func() error {
+				mu.Lock()
+				running++
+				peak = max(peak, running)
+				mu.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Errorf("%d holders of one lock at once", peak)
+	}
+}
+
+func TestWithLockTimeout(t *testing.T) {
+	t.Setenv("CODEX_HOME", t.TempDir())
+	err := hooksdk.WithLock("a", 0, func() error {
+		ran := false
+		err := hooksdk.WithLock("a", 20*time.Millisecond, func() error { ran = true; return nil })
+		if !errors.Is(err, hooksdk.ErrLockTimeout) || !strings.Contains(err.Error(), `"a"`) || ran {
+			t.Errorf("WithLock of a held lock = %v (ran: %v), want ErrLockTimeout", err, ran)
+		}
+		// Other names are other locks.
+		return hooksdk.WithLock("b", 20*time.Millisecond, func() error { return nil })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fn's error is WithLock's, and the lock is released after it.
+	boom := errors.New("boom")
+	if err := hooksdk.WithLock("a", time.Second, func() error { return boom }); err != boom {
+		t.Errorf("WithLock = %v, want fn's error", err)
+	}
+	if err := hooksdk.WithLock("a", 20*time.Millisecond, func() error { return nil }); err != nil {
+		t.Errorf("lock not released after fn failed: %v", err)
+	}
+}
+
+// A hook that dies holding the lock leaves no stale lock: the OS releases it with the process, and
+// the next hook takes it though the lock file is still there.
+func TestWithLockReleasedWhenHolderDies(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "HOOKSDK_TEST_HOLD_LOCK=git-snapshot")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); line != "locked\n" {
+		t.Fatalf("holder said %q, %v", line, err)
+	}
+
+	if err := hooksdk.WithLock("git-snapshot", 50*time.Millisecond, func() error { return nil }); !errors.Is(err, hooksdk.ErrLockTimeout) {
+		t.Fatalf("WithLock while another process holds it = %v, want ErrLockTimeout", err)
+	}
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	if _, err := os.Stat(hooksdk.LockPath("git-snapshot")); err != nil {
+		t.Fatalf("lock file: %v", err)
+	}
+	if err := hooksdk.WithLock("git-snapshot", 5*time.Second, func() error { return nil }); err != nil {
+		t.Errorf("WithLock after the holder died: %v", err)
+	}
+}
+
+func TestLockPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	dir := filepath.Join(home, "hooks", "locks")
+	if got := hooksdk.LockPath("git-snapshot_1.x"); got != filepath.Join(dir, "git-snapshot_1.x.lock") {
+		t.Errorf("LockPath of a plain name = %s", got)
+	}
+	names := []string{"git-snapshot:/home/u/repo", "git-snapshot:/home/u/repo2", "git-snapshot:/home/u/rep", "a b", "a_b", "..", ".hidden", "", strings.Repeat("x", 65), strings.Repeat("x", 66)}
+	seen := map[string]string{}
+	for _, name := range names {
+		path := hooksdk.LockPath(name)
+		base := filepath.Base(path)
+		if filepath.Dir(path) != dir || strings.HasPrefix(base, ".") || len(base) > 64 {
+			t.Errorf("LockPath(%q) = %s", name, path)
+		}
+		if other, ok := seen[path]; ok {
+			t.Errorf("%q and %q share %s", name, other, path)
+		}
+		seen[path] = name
+	}
+	if hooksdk.LockPath("a b") != hooksdk.LockPath("a b") {
+		t.Error("LockPath isn't stable")
+	}
+}
@@ -0,0 +1,44 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// MarshalJSON encodes the payload without dropping fields the struct doesn't model.
+//
+// The typed fields are merged over RawPayload: a struct field wins over the raw value with the same
+// key, so mutating a field and re-marshaling forwards the new value. Keys that exist only in
+// RawPayload (unknown/newer fields) are kept as-is. Zero-valued struct fields are only written
+// when the key was present in RawPayload, so re-marshaling doesn't add empty entries for fields the
+// host never sent.
+func (p HookPayload) MarshalJSON() ([]byte, error) {
+	type Alias HookPayload
+	typed, err := json.Marshal(Alias(p))
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	if err := unmarshalUseNumber(typed, &fields); err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]any, len(p.RawPayload)+len(fields))
+	for k, v := range p.RawPayload {
+		merged[k] = v
+	}
+
+	v := reflect.ValueOf(p)
+	for key, field := range jsonFields(v.Type()) {
+		value, ok := fields[key]
+		if !ok {
+			continue
+		}
+		if _, inRaw := p.RawPayload[key]; !inRaw && v.FieldByIndex(field.Index).IsZero() {
+			continue
+		}
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
@@ -0,0 +1,58 @@
+package hooksdk_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestMarshalJSONKeepsUnknownFields(t *testing.T) {
+	extra := map[string]any{"nested": map[string]any{"deep": []any{1.0, "two"}}, "flag": true}
+	b := hooktest.ToolCallStarted().With("future", extra).WithToolName("shell")
+	p, err := hooksdk.ParseHookPayload(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Cwd = "/elsewhere"
+	tool := "apply_patch"
+	p.ToolName = &tool
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// The struct fields win over the raw values; the rest is as it was sent.
+	want := b.Map()
+	want["cwd"] = "/elsewhere"
+	want["tool_name"] = "apply_patch"
+	var wantJSON map[string]any
+	data, _ = json.Marshal(want)
+	json.Unmarshal(data, &wantJSON)
+	if !reflect.DeepEqual(got, wantJSON) {
+		t.Errorf("marshaled payload:\n%v\nwant:\n%v", got, wantJSON)
+	}
+}
+
+func TestMarshalJSONAddsNoEmptyFields(t *testing.T) {
+	p, err := hooksdk.ParseHookPayload([]byte(`{"schema_version":1,"xcodex_event_type":"session-start","session_id":"s"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	json.Unmarshal(data, &got)
+	if len(got) != 3 {
+		t.Errorf("marshaled payload = %s, want only the fields that were sent", data)
+	}
+}
@@ -0,0 +1,180 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Headers of the streamable HTTP transport.
+const (
+	sessionHeader  = "Mcp-Session-Id"
+	protocolHeader = "MCP-Protocol-Version"
+)
+
+// StatusError is returned when an HTTP server answers a message with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	// Body is the start of the response body, for diagnostics.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("mcp: server returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("mcp: server returned %d: %s", e.StatusCode, e.Body)
+}
+
+type httpTransport struct {
+	url    string
+	header http.Header
+	client *http.Client
+
+	mu       sync.Mutex
+	session  string
+	protocol string
+}
+
+func newHTTP(s Server) *httpTransport {
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpTransport{url: s.URL, header: s.Header, client: client}
+}
+
+func (t *httpTransport) do(ctx context.Context, method string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range t.header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.mu.Lock()
+	if t.session != "" {
+		req.Header.Set(sessionHeader, t.session)
+	}
+	if t.protocol != "" {
+		req.Header.Set(protocolHeader, t.protocol)
+	}
+	t.mu.Unlock()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if s := resp.Header.Get(sessionHeader); s != "" {
+		t.mu.Lock()
+		t.session = s
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// call POSTs a request. The server answers with the response as JSON, or with an event stream
+// that carries it, maybe after messages of its own.
+func (t *httpTransport) call(ctx context.Context, id string, msg []byte) (incoming, error) {
+	resp, err := t.do(ctx, http.MethodPost, msg)
+	if err != nil {
+		return incoming{}, err
+	}
+	defer resp.Body.Close()
+	body := io.LimitReader(resp.Body, maxMessageBytes)
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == "text/event-stream" {
+		return readEventStream(body, id)
+	}
+	var in incoming
+	if err := json.NewDecoder(body).Decode(&in); err != nil {
+		return incoming{}, fmt.Errorf("mcp: read response: %w", err)
+	}
+	if string(in.ID) != id {
+		return incoming{}, fmt.Errorf("mcp: response has id %s, want %s", in.ID, id)
+	}
+	return in, nil
+}
+
+// readEventStream reads server-sent events until the response with id.
+func readEventStream(r io.Reader, id string) (incoming, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxMessageBytes)
+	var data strings.Builder
+	dispatch := func() (incoming, bool) {
+		defer data.Reset()
+		var in incoming
+		if data.Len() == 0 || json.Unmarshal([]byte(data.String()), &in) != nil {
+			return incoming{}, false
+		}
+		return in, in.Method == "" && string(in.ID) == id
+	}
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" {
+			if in, ok := dispatch(); ok {
+				return in, nil
+			}
+			continue
+		}
+		if v, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(v, " "))
+		}
+	}
+	if in, ok := dispatch(); ok {
+		return in, nil
+	}
+	if err := sc.Err(); err != nil {
+		return incoming{}, fmt.Errorf("mcp: read event stream: %w", err)
+	}
+	return incoming{}, fmt.Errorf("mcp: event stream ended without the response to %s", id)
+}
+
+// send POSTs a notification, which the server acknowledges with 202 Accepted.
+func (t *httpTransport) send(ctx context.Context, msg []byte) error {
+	resp, err := t.do(ctx, http.MethodPost, msg)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) negotiated(protocol string) {
+	t.mu.Lock()
+	t.protocol = protocol
+	t.mu.Unlock()
+}
+
+// close ends the session with a DELETE, when the server started one. Servers that don't allow
+// that answer 405, which is fine.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	session := t.session
+	t.mu.Unlock()
+	if session == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	resp, err := t.do(ctx, http.MethodDelete, nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// Package mcp is a small Model Context Protocol client for pushing hook events to an MCP server:
+// it connects over stdio (the server as a subprocess) or streamable HTTP, performs the initialize
+// handshake, and sends JSON-RPC notifications.
+//
+//	c, err := mcp.Dial(ctx, mcp.Server{Command: []string{"node", "events-server.js"}})
+//	if err != nil { ... }
+//	defer c.Close()
+//	err = c.Notify(ctx, "notifications/xcodex/hook_event", map[string]any{"payload": p.RawPayload})
+//
+// It implements only what a notifying client needs: no tools, resources, or sampling. Requests the
+// server sends over stdio are answered (ping with an empty result, anything else with "method not
+// found"), and its notifications are ignored.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// ProtocolVersion is the MCP revision the client asks for in initialize. The server may answer
+// with another revision it supports; the client accepts any, since notifications are the same in
+// all of them.
+const ProtocolVersion = "2025-06-18"
+
+// ErrClosed is returned for requests on a connection that has been closed, or whose server has
+// exited or hung up.
+var ErrClosed = errors.New("mcp: connection closed")
+
+// RPCError is a JSON-RPC error response from the server.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return "mcp: server error " + strconv.Itoa(e.Code) + ": " + e.Message
+}
+
+// Server says how to reach an MCP server: Command for one on stdio, or URL for one on streamable
+// HTTP.
+type Server struct {
+	// Command starts the server, which then speaks newline-delimited JSON-RPC on its stdin and
+	// stdout. It runs until Close.
+	Command []string
+	// Env holds extra `KEY=value` variables for Command, added to the hook's environment.
+	Env []string
+	// Stderr receives the server's stderr (its log); nil discards it.
+	Stderr io.Writer
+
+	// URL is the server's streamable HTTP endpoint; each message is POSTed to it.
+	URL string
+	// Header is added to every HTTP request, e.g. an Authorization header.
+	Header http.Header
+	// HTTPClient sends the requests; nil means http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Implementation names a client or server, as exchanged in initialize.
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Client is a connection to an MCP server, initialized and ready for notifications. It is safe
+// for concurrent use.
+type Client struct {
+	t      transport
+	nextID atomic.Int64
+	// ServerInfo and Protocol are the server's answer to initialize.
+	ServerInfo Implementation
+	Protocol   string
+}
+
+// transport carries JSON-RPC messages to and from the server.
+type transport interface {
+	// call sends a request and returns the response with its id.
+	call(ctx context.Context, id string, msg []byte) (incoming, error)
+	// send sends a notification.
+	send(ctx context.Context, msg []byte) error
+	// negotiated records the protocol revision initialize settled on.
+	negotiated(protocol string)
+	close() error
+}
+
+// incoming is any message from the server: a response (ID with Result or Error), a request (ID
+// and Method), or a notification (Method only).
+type incoming struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
+}
+
+// Dial connects to the server and performs the initialize handshake. On failure nothing is left
+// running.
+func Dial(ctx context.Context, s Server) (*Client, error) {
+	var t transport
+	switch {
+	case len(s.Command) > 0 && s.URL != "":
+		return nil, errors.New("mcp: both a command and a URL are set")
+	case len(s.Command) > 0:
+		st, err := startStdio(s)
+		if err != nil {
+			return nil, err
+		}
+		t = st
+	case s.URL != "":
+		t = newHTTP(s)
+	default:
+		return nil, errors.New("mcp: no server command or URL")
+	}
+	c := &Client{t: t}
+	if err := c.initialize(ctx); err != nil {
+		t.close()
+		return nil, fmt.Errorf("mcp: initialize: %w", err)
+	}
+	return c, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	var result struct {
+		ProtocolVersion string         `json:"protocolVersion"`
+		ServerInfo      Implementation `json:"serverInfo"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      Implementation{Name: "xcodex-hooks", Version: hooksdk.SDKVersion},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	if result.ProtocolVersion == "" {
+		return errors.New("the server's answer has no protocolVersion")
+	}
+	c.ServerInfo, c.Protocol = result.ServerInfo, result.ProtocolVersion
+	c.t.negotiated(result.ProtocolVersion)
+	return c.Notify(ctx, "notifications/initialized", nil)
+}
+
+// call sends a request and decodes its result into result.
+func (c *Client) call(ctx context.Context, method string, params, result any) error {
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	msg, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": json.RawMessage(id), "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	resp, err := c.t.call(ctx, id, msg)
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Notify sends a notification, e.g. `notifications/xcodex/hook_event`; params is encoded as JSON
+// and omitted when nil. Notifications get no answer, so Notify only fails when the message can't
+// be delivered.
+func (c *Client) Notify(ctx context.Context, method string, params any) error {
+	m := map[string]any{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		m["params"] = params
+	}
+	msg, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return c.t.send(ctx, msg)
+}
+
+// Close ends the connection: it closes a stdio server's stdin and waits briefly for it to exit
+// before killing it, or ends an HTTP session.
+func (c *Client) Close() error {
+	return c.t.close()
+}
+
+// reply is the answer to a request from the server: ping gets an empty result, as the protocol
+// requires, and anything else "method not found".
+func reply(req incoming) []byte {
+	m := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	if req.Method == "ping" {
+		m["result"] = map[string]any{}
+	} else {
+		m["error"] = RPCError{Code: -32601, Message: "method not found: " + req.Method}
+	}
+	data, _ := json.Marshal(m)
+	return data
+}
@@ -0,0 +1,247 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/mcp"
+	"example.com/xcodex/hooks-sdk/hooksdk/mcp/mcptest"
+)
+
+func TestMain(m *testing.M) {
+	mcptest.Main()
+	os.Exit(m.Run())
+}
+
+const hookEvent = "notifications/xcodex/hook_event"
+
+// methods lists the messages received by method, and the client's answers by id.
+func methods(srv *mcptest.Server) []string {
+	var out []string
+	for _, m := range srv.Messages() {
+		if m.Method == "" {
+			out = append(out, "answer "+string(m.ID))
+			continue
+		}
+		out = append(out, m.Method)
+	}
+	return out
+}
+
+func checkFraming(t *testing.T, srv *mcptest.Server) {
+	t.Helper()
+	for _, p := range srv.Problems() {
+		t.Error(p)
+	}
+}
+
+// dialNotify connects to srv and sends two notifications, the first without params.
+func dialNotify(t *testing.T, srv *mcptest.Server) *mcp.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := mcp.Dial(ctx, srv.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ServerInfo != (mcp.Implementation{Name: "mcptest", Version: "1.0.0"}) {
+		t.Errorf("ServerInfo = %+v", c.ServerInfo)
+	}
+	if err := c.Notify(ctx, hookEvent, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Notify(ctx, hookEvent, map[string]any{"payload": json.RawMessage(`{"type":"session-start"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func checkNotifications(t *testing.T, srv *mcptest.Server) {
+	t.Helper()
+	got := srv.Notifications(hookEvent)
+	if len(got) != 2 || got[0].Params != nil || string(got[1].Params) != `{"payload":{"type":"session-start"}}` {
+		t.Errorf("notifications = %+v", got)
+	}
+}
+
+func TestStdio(t *testing.T) {
+	srv := mcptest.NewStdio(t, mcptest.Options{Protocol: "2025-03-26"})
+	c := dialNotify(t, srv)
+	if c.Protocol != "2025-03-26" {
+		t.Errorf("Protocol = %q", c.Protocol)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The server's requests are answered before the client goes on with initialized.
+	want := []string{"initialize", `answer "srv-1"`, `answer "srv-2"`, "notifications/initialized", hookEvent, hookEvent}
+	if got := methods(srv); !reflect.DeepEqual(got, want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+	checkFraming(t, srv)
+	checkNotifications(t, srv)
+
+	if err := c.Notify(context.Background(), hookEvent, nil); !errors.Is(err, mcp.ErrClosed) {
+		t.Errorf("Notify after Close = %v, want ErrClosed", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestStdioConcurrent(t *testing.T) {
+	srv := mcptest.NewStdio(t, mcptest.Options{})
+	c, err := mcp.Dial(context.Background(), srv.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := c.Notify(context.Background(), hookEvent, map[string]int{"n": i}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	c.Close()
+	checkFraming(t, srv)
+	seen := map[string]bool{}
+	for _, m := range srv.Notifications(hookEvent) {
+		seen[string(m.Params)] = true
+	}
+	for i := 0; i < 20; i++ {
+		if !seen[`{"n":`+strconv.Itoa(i)+`}`] {
+			t.Errorf("notification %d missing; got %v", i, seen)
+		}
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		srv := mcptest.NewHTTP(t, mcptest.Options{Stream: stream})
+		c := dialNotify(t, srv)
+		if c.Protocol != mcp.ProtocolVersion {
+			t.Errorf("stream %v: Protocol = %q", stream, c.Protocol)
+		}
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := methods(srv), []string{"initialize", "notifications/initialized", hookEvent, hookEvent}; !reflect.DeepEqual(got, want) {
+			t.Errorf("stream %v: messages = %q, want %q", stream, got, want)
+		}
+		if started, ended := srv.Sessions(); started != 1 || ended != 1 {
+			t.Errorf("stream %v: %d sessions started, %d ended", stream, started, ended)
+		}
+		checkFraming(t, srv)
+		checkNotifications(t, srv)
+	}
+}
+
+func TestHTTPSessionEnded(t *testing.T) {
+	srv := mcptest.NewHTTP(t, mcptest.Options{})
+	c, err := mcp.Dial(context.Background(), srv.Server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	srv.EndSession()
+	var se *mcp.StatusError
+	if err := c.Notify(context.Background(), hookEvent, nil); !errors.As(err, &se) || se.StatusCode != 404 {
+		t.Errorf("Notify to an ended session = %v, want a 404", err)
+	}
+	checkFraming(t, srv)
+}
+
+func TestDialFailures(t *testing.T) {
+	initErr := &mcp.RPCError{Code: -32602, Message: "unsupported"}
+	for _, tt := range []struct {
+		name string
+		srv  *mcptest.Server
+		want []string
+	}{
+		{"stdio", mcptest.NewStdio(t, mcptest.Options{InitError: initErr}), []string{"initialize", `answer "srv-1"`, `answer "srv-2"`}},
+		{"http", mcptest.NewHTTP(t, mcptest.Options{InitError: initErr}), []string{"initialize"}},
+	} {
+		_, err := mcp.Dial(context.Background(), tt.srv.Server)
+		var rpcErr *mcp.RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Code != -32602 || err.Error() != "mcp: initialize: mcp: server error -32602: unsupported" {
+			t.Errorf("%s init error: Dial = %v", tt.name, err)
+		}
+		// No initialized follows a failed initialize.
+		if got := methods(tt.srv); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s init error: messages = %q, want %q", tt.name, got, tt.want)
+		}
+		checkFraming(t, tt.srv)
+	}
+
+	if _, err := mcp.Dial(context.Background(), mcptest.NewStdio(t, mcptest.Options{HangUp: true}).Server); !errors.Is(err, mcp.ErrClosed) {
+		t.Errorf("stdio server exiting: Dial = %v, want ErrClosed", err)
+	}
+	if _, err := mcp.Dial(context.Background(), mcptest.NewHTTP(t, mcptest.Options{HangUp: true}).Server); err == nil {
+		t.Error("http server hanging up: Dial succeeded")
+	}
+	for name, srv := range map[string]mcp.Server{
+		"stdio": mcptest.NewStdio(t, mcptest.Options{Stall: true}).Server,
+		"http":  mcptest.NewHTTP(t, mcptest.Options{Stall: true}).Server,
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		start := time.Now()
+		_, err := mcp.Dial(ctx, srv)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+			t.Errorf("%s server not answering: Dial = %v after %v", name, err, time.Since(start))
+		}
+	}
+
+	for name, s := range map[string]mcp.Server{
+		"both":        {Command: []string{"server"}, URL: "http://localhost"},
+		"neither":     {},
+		"no command":  {Command: []string{"/nonexistent/mcp-server"}},
+		"bad address": {URL: "http://127.0.0.1:1/mcp"},
+	} {
+		if c, err := mcp.Dial(context.Background(), s); err == nil {
+			c.Close()
+			t.Errorf("%s: Dial succeeded", name)
+		}
+	}
+
+	srv := mcptest.NewHTTP(t, mcptest.Options{})
+	srv.Header = map[string][]string{"Content-Type": {"text/plain"}}
+	if _, err := mcp.Dial(context.Background(), srv.Server); err != nil {
+		t.Errorf("Dial with a Content-Type header = %v, want the client's to win", err)
+	}
+	checkFraming(t, srv)
+}
+
+// TestFakeServerChecks makes sure the fake server catches bad framing, so the tests above mean
+// something.
+func TestFakeServerChecks(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"jsonrpc":"1.0","id":1,"method":"initialize"}`:                                                                      `jsonrpc is "1.0", want "2.0"`,
+		`{"jsonrpc":"2.0","id":null,"method":"initialize"}`:                                                                   "id null isn't a string or an integer",
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"capabilities":{},"clientInfo":{"name":"x","version":"1"}}}`: "initialize has no protocolVersion",
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`:                                                              "no Mcp-Session-Id; notifications/initialized out of turn",
+	} {
+		srv := mcptest.NewHTTP(t, mcptest.Options{})
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if got := srv.Problems(); len(got) != 1 || !strings.HasSuffix(got[0], want) || resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %d, problems %q, want %q", body, resp.StatusCode, got, want)
+		}
+	}
+}
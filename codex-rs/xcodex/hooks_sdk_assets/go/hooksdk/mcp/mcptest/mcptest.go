@@ -0,0 +1,480 @@
+// Package mcptest runs fake MCP servers for testing clients made with hooksdk/mcp: one on stdio,
+// which is the test binary run again as a subprocess, and one on streamable HTTP. Both answer
+// initialize, record every message the client sends, and check its JSON-RPC and MCP framing.
+//
+//	func TestMain(m *testing.M) {
+//		mcptest.Main()
+//		os.Exit(m.Run())
+//	}
+//
+//	srv := mcptest.NewStdio(t, mcptest.Options{})
+//	c, err := mcp.Dial(ctx, srv.Server)
+//	...
+//	if problems := srv.Problems(); len(problems) > 0 { t.Error(problems) }
+package mcptest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/mcp"
+)
+
+// stdioEnv holds a stdio server's config, for the test binary Main runs it in.
+const stdioEnv = "MCPTEST_STDIO"
+
+// Options configure a Server.
+type Options struct {
+	// Protocol is the revision initialize is answered with; "" means mcp.ProtocolVersion.
+	Protocol string
+	// InitError, when set, is the answer to initialize instead of a result.
+	InitError *mcp.RPCError
+	// HangUp makes the server exit (stdio) or drop the connection (HTTP) when asked to
+	// initialize; Stall makes it never answer.
+	HangUp bool
+	Stall  bool
+	// Stream makes the HTTP server answer requests with an event stream that carries a
+	// notification and a request of its own before the response, which is split over several
+	// data lines.
+	Stream bool
+}
+
+// Message is a message the client sent.
+type Message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *mcp.RPCError   `json:"error,omitempty"`
+	// Problem says how the message breaks the JSON-RPC or MCP framing; it is empty for a good
+	// one.
+	Problem string `json:"problem,omitempty"`
+}
+
+// Server is a fake MCP server. Its Server field is what to Dial; an HTTP one is stopped when the
+// test ends, and a stdio one runs until the client closes it.
+type Server struct {
+	mcp.Server
+	opts Options
+	// log is the file a stdio server appends the messages to.
+	log string
+
+	mu       sync.Mutex
+	messages []Message
+	sessions map[string]*checker
+	started  int
+	ended    int
+}
+
+// NewStdio returns a stdio server: its Command runs the test binary, which must call Main first
+// thing in TestMain. Each Dial starts a new process.
+func NewStdio(t testing.TB, opts Options) *Server {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{opts: opts, log: filepath.Join(t.TempDir(), "mcptest.jsonl")}
+	spec, err := json.Marshal(stdioConfig{Log: s.log, Options: opts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Server = mcp.Server{Command: []string{exe}, Env: []string{stdioEnv + "=" + string(spec)}}
+	return s
+}
+
+// NewHTTP starts a streamable HTTP server.
+func NewHTTP(t testing.TB, opts Options) *Server {
+	s := &Server{opts: opts, sessions: map[string]*checker{}}
+	srv := httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(srv.Close)
+	s.Server = mcp.Server{URL: srv.URL}
+	return s
+}
+
+// Messages returns the messages received, in order, from every connection.
+func (s *Server) Messages() []Message {
+	if s.log != "" {
+		data, _ := os.ReadFile(s.log)
+		var msgs []Message
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			var m Message
+			if json.Unmarshal(line, &m) == nil {
+				msgs = append(msgs, m)
+			}
+		}
+		return msgs
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Notifications returns the notifications received with method.
+func (s *Server) Notifications(method string) []Message {
+	var out []Message
+	for _, m := range s.Messages() {
+		if m.Method == method && m.ID == nil {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Problems returns the Problem of each bad message received.
+func (s *Server) Problems() []string {
+	var out []string
+	for _, m := range s.Messages() {
+		if m.Problem != "" {
+			out = append(out, m.Problem)
+		}
+	}
+	return out
+}
+
+// Sessions returns the number of HTTP sessions started by initialize, and how many of them the
+// client ended with a DELETE.
+func (s *Server) Sessions() (started, ended int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started, s.ended
+}
+
+// EndSession forgets the HTTP sessions, as a restarted server does: the next message of each is
+// answered 404 Not Found.
+func (s *Server) EndSession() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = map[string]*checker{}
+}
+
+type stdioConfig struct {
+	Log string `json:"log"`
+	Options
+}
+
+// Main runs the stdio server and exits when the test binary was started as one by a client
+// dialing a NewStdio server; otherwise it returns at once.
+func Main() {
+	spec := os.Getenv(stdioEnv)
+	if spec == "" {
+		return
+	}
+	var cfg stdioConfig
+	if err := json.Unmarshal([]byte(spec), &cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "mcptest: %s: %v\n", stdioEnv, err)
+		os.Exit(2)
+	}
+	log, err := os.OpenFile(cfg.Log, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mcptest: %v\n", err)
+		os.Exit(2)
+	}
+	serveStdio(os.Stdin, os.Stdout, log, cfg.Options)
+	os.Exit(0)
+}
+
+// serveStdio reads newline-delimited messages from in until it ends, records each to log, and
+// answers requests on out. Before the answer to initialize it sends a ping, a request the client
+// doesn't know, and a notification, to check the client answers the requests.
+func serveStdio(in io.Reader, out io.Writer, log io.Writer, opts Options) {
+	c := newChecker()
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for sc.Scan() {
+		m := c.check(sc.Bytes())
+		data, _ := json.Marshal(m)
+		log.Write(append(data, '\n'))
+		if m.Method == "" || m.ID == nil {
+			continue
+		}
+		if m.Method == "initialize" {
+			switch {
+			case opts.HangUp:
+				return
+			case opts.Stall:
+				continue
+			}
+			for _, msg := range [][]byte{
+				c.request("ping"),
+				c.request("sampling/createMessage"),
+				notification("notifications/message"),
+			} {
+				out.Write(append(msg, '\n'))
+			}
+		}
+		out.Write(append(c.answer(m, opts), '\n'))
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	m, status, session := s.receive(r, body)
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if m.Method == "" || m.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if m.Method == "initialize" {
+		switch {
+		case s.opts.HangUp:
+			if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		case s.opts.Stall:
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Mcp-Session-Id", session)
+	}
+	s.mu.Lock()
+	c := s.sessions[session]
+	if c == nil {
+		// EndSession came in between.
+		c = newChecker()
+	}
+	resp := c.answer(m, s.opts)
+	s.mu.Unlock()
+	if !s.opts.Stream {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	var indented bytes.Buffer
+	json.Indent(&indented, resp, "", "  ")
+	fmt.Fprintf(w, ": mcptest\n\nevent: message\ndata: %s\n\ndata: %s\r\n\r\n", notification("notifications/message"),
+		`{"jsonrpc":"2.0","id":"srv-stream","method":"ping"}`)
+	fmt.Fprintf(w, "event: message\nid: 1\ndata: %s\n\n", strings.ReplaceAll(indented.String(), "\n", "\ndata:"))
+}
+
+// receive checks and records an HTTP message, returning it with the session it belongs to, or
+// the status to refuse it with.
+func (s *Server) receive(r *http.Request, body []byte) (m Message, status int, session string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session = r.Header.Get("Mcp-Session-Id")
+	c := s.sessions[session]
+	if r.Method == http.MethodDelete {
+		if c == nil {
+			return Message{}, http.StatusNotFound, ""
+		}
+		delete(s.sessions, session)
+		s.ended++
+		return Message{}, 0, session
+	}
+	if r.Method != http.MethodPost {
+		return Message{}, http.StatusMethodNotAllowed, ""
+	}
+
+	var problems []string
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+		problems = append(problems, "Content-Type "+ct)
+	}
+	if accept := r.Header.Get("Accept"); !strings.Contains(accept, "application/json") || !strings.Contains(accept, "text/event-stream") {
+		problems = append(problems, "Accept "+accept)
+	}
+	switch {
+	case session == "" && bytes.Contains(body, []byte(`"initialize"`)):
+		s.started++
+		session = "mcptest-" + strconv.Itoa(s.started)
+		c = newChecker()
+		s.sessions[session] = c
+	case session == "":
+		problems = append(problems, "no Mcp-Session-Id")
+		c = newChecker()
+	case c == nil:
+		return Message{}, http.StatusNotFound, ""
+	case r.Header.Get("MCP-Protocol-Version") != c.protocol:
+		problems = append(problems, "MCP-Protocol-Version "+r.Header.Get("MCP-Protocol-Version")+", want "+c.protocol)
+	}
+	m = c.check(body)
+	if m.Problem != "" {
+		problems = append(problems, m.Problem)
+	}
+	m.Problem = strings.Join(problems, "; ")
+	s.messages = append(s.messages, m)
+	if m.Problem != "" {
+		return m, http.StatusBadRequest, ""
+	}
+	return m, 0, session
+}
+
+// checker follows the messages of one session and finds what is wrong with each.
+type checker struct {
+	// state is 0 before initialize, 1 once it has been answered, and 2 after the client's
+	// notifications/initialized.
+	state    int
+	protocol string
+	ids      map[string]bool
+	// sent maps the ids of the server's requests, not yet answered, to their methods.
+	sent   map[string]string
+	nextID int
+}
+
+func newChecker() *checker {
+	return &checker{ids: map[string]bool{}, sent: map[string]string{}}
+}
+
+func (c *checker) check(data []byte) Message {
+	var m Message
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		m.Problem = "not a JSON object: " + string(data)
+		return m
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		m.Problem = err.Error()
+		return m
+	}
+	m.Problem = c.problem(fields, m)
+	return m
+}
+
+func (c *checker) problem(fields map[string]json.RawMessage, m Message) string {
+	if string(fields["jsonrpc"]) != `"2.0"` {
+		return "jsonrpc is " + string(fields["jsonrpc"]) + `, want "2.0"`
+	}
+	for k := range fields {
+		switch k {
+		case "jsonrpc", "id", "method", "params", "result", "error":
+		default:
+			return "unknown member " + k
+		}
+	}
+	id, hasID := fields["id"]
+	if hasID && !validID(id) {
+		return "id " + string(id) + " isn't a string or an integer"
+	}
+	if params, ok := fields["params"]; ok && !bytes.HasPrefix(params, []byte("{")) {
+		return m.Method + ": params " + string(params) + " isn't an object"
+	}
+	_, hasResult := fields["result"]
+	_, hasError := fields["error"]
+	switch {
+	case m.Method == "" && hasID:
+		method, ok := c.sent[string(id)]
+		delete(c.sent, string(id))
+		switch {
+		case !ok:
+			return "answer to unknown request " + string(id)
+		case hasResult == hasError:
+			return "answer to " + string(id) + " needs one of result and error"
+		case method == "ping" && string(m.Result) != "{}":
+			return "answer to ping isn't an empty result"
+		case method != "ping" && (m.Error == nil || m.Error.Code != -32601):
+			return "answer to " + method + " isn't method not found"
+		}
+	case m.Method == "":
+		return "no method"
+	case hasResult || hasError:
+		return m.Method + " has a result or an error"
+	case hasID:
+		if c.ids[string(id)] {
+			return "id " + string(id) + " reused"
+		}
+		c.ids[string(id)] = true
+		if m.Method == "initialize" {
+			if c.state != 0 {
+				return "initialize again"
+			}
+			return checkInitialize(m.Params)
+		}
+		if c.state == 0 {
+			return m.Method + " before initialize"
+		}
+	default:
+		if m.Method == "notifications/initialized" {
+			if c.state != 1 {
+				return "notifications/initialized out of turn"
+			}
+			c.state = 2
+			return ""
+		}
+		if c.state != 2 {
+			return m.Method + " before notifications/initialized"
+		}
+	}
+	return ""
+}
+
+func validID(id json.RawMessage) bool {
+	if len(id) > 0 && id[0] == '"' {
+		return true
+	}
+	_, err := strconv.ParseInt(string(id), 10, 64)
+	return err == nil
+}
+
+func checkInitialize(params json.RawMessage) string {
+	var p struct {
+		ProtocolVersion string              `json:"protocolVersion"`
+		Capabilities    *map[string]any     `json:"capabilities"`
+		ClientInfo      *mcp.Implementation `json:"clientInfo"`
+	}
+	switch {
+	case json.Unmarshal(params, &p) != nil:
+		return "initialize params " + string(params)
+	case p.ProtocolVersion == "":
+		return "initialize has no protocolVersion"
+	case p.Capabilities == nil:
+		return "initialize has no capabilities"
+	case p.ClientInfo == nil || p.ClientInfo.Name == "" || p.ClientInfo.Version == "":
+		return "initialize has no clientInfo"
+	}
+	return ""
+}
+
+// answer is the response to request m.
+func (c *checker) answer(m Message, opts Options) []byte {
+	resp := map[string]any{"jsonrpc": "2.0", "id": m.ID}
+	switch {
+	case m.Method == "initialize" && opts.InitError != nil:
+		resp["error"] = opts.InitError
+	case m.Method == "initialize":
+		c.protocol = opts.Protocol
+		if c.protocol == "" {
+			c.protocol = mcp.ProtocolVersion
+		}
+		c.state = 1
+		resp["result"] = map[string]any{
+			"protocolVersion": c.protocol,
+			"capabilities":    map[string]any{},
+			"serverInfo":      mcp.Implementation{Name: "mcptest", Version: "1.0.0"},
+		}
+	case m.Method == "ping":
+		resp["result"] = map[string]any{}
+	default:
+		resp["error"] = mcp.RPCError{Code: -32601, Message: "method not found"}
+	}
+	data, _ := json.Marshal(resp)
+	return data
+}
+
+// request is a request from the server, which the client must answer.
+func (c *checker) request(method string) []byte {
+	c.nextID++
+	id := "srv-" + strconv.Itoa(c.nextID)
+	c.sent[strconv.Quote(id)] = method
+	data, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": map[string]any{}})
+	return data
+}
+
+func notification(method string) []byte {
+	data, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": method, "params": map[string]any{"level": "info", "data": "mcptest"}})
+	return data
+}
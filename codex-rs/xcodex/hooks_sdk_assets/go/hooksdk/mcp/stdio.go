@@ -0,0 +1,148 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// closeTimeout is how long Close waits for a stdio server to exit once its stdin is closed, and
+// again after killing it.
+const closeTimeout = 2 * time.Second
+
+// maxMessageBytes bounds one message from the server.
+const maxMessageBytes = 16 << 20
+
+type stdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	wmu sync.Mutex // serializes writes to stdin
+
+	mu      sync.Mutex
+	pending map[string]chan incoming
+	done    chan struct{} // closed when the server's stdout ends
+	closing sync.Once
+	closed  error
+}
+
+func startStdio(s Server) (*stdioTransport, error) {
+	cmd := exec.Command(s.Command[0], s.Command[1:]...)
+	if len(s.Env) > 0 {
+		cmd.Env = append(os.Environ(), s.Env...)
+	}
+	cmd.Stderr = s.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	t := &stdioTransport{cmd: cmd, stdin: stdin, pending: map[string]chan incoming{}, done: make(chan struct{})}
+	go t.read(stdout)
+	return t, nil
+}
+
+// read dispatches the server's messages until its stdout ends.
+func (t *stdioTransport) read(stdout io.Reader) {
+	defer close(t.done)
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 0, 64<<10), maxMessageBytes)
+	for sc.Scan() {
+		var msg incoming
+		if json.Unmarshal(sc.Bytes(), &msg) != nil {
+			continue
+		}
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			t.write(reply(msg))
+		case msg.Method != "":
+			// A notification from the server, e.g. a log message.
+		default:
+			t.mu.Lock()
+			ch := t.pending[string(msg.ID)]
+			delete(t.pending, string(msg.ID))
+			t.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+		}
+	}
+}
+
+func (t *stdioTransport) write(msg []byte) error {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	if _, err := t.stdin.Write(append(msg, '\n')); err != nil {
+		return ErrClosed
+	}
+	return nil
+}
+
+func (t *stdioTransport) call(ctx context.Context, id string, msg []byte) (incoming, error) {
+	ch := make(chan incoming, 1)
+	t.mu.Lock()
+	t.pending[id] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+	}()
+	if err := t.write(msg); err != nil {
+		return incoming{}, err
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		return incoming{}, ErrClosed
+	case <-ctx.Done():
+		return incoming{}, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg []byte) error {
+	select {
+	case <-t.done:
+		return ErrClosed
+	default:
+	}
+	return t.write(msg)
+}
+
+func (t *stdioTransport) negotiated(string) {}
+
+// close closes the server's stdin, which asks it to exit, and kills it if it hasn't within
+// closeTimeout.
+func (t *stdioTransport) close() error {
+	t.closing.Do(func() {
+		t.stdin.Close()
+		select {
+		case <-t.done:
+		case <-time.After(closeTimeout):
+			t.cmd.Process.Kill()
+			select {
+			case <-t.done:
+			case <-time.After(closeTimeout):
+				// A child of the server still holds its stdout; Wait closes it.
+			}
+		}
+		if err := t.cmd.Wait(); err != nil {
+			if _, ok := err.(*exec.ExitError); !ok {
+				t.closed = err
+			}
+		}
+	})
+	return t.closed
+}
@@ -0,0 +1,63 @@
+package hooksdk
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/invocation"
+)
+
+// SDKVersion is the version of this SDK, the xcodex release it ships with. It is recorded in the
+// header of the logs cmd/log_jsonl writes. Version is what a build actually reports.
+const SDKVersion = "0.4.0"
+
+// Metadata describes the hook process handling an event: when it ran, on which machine, and as
+// which hook. It is useful when logs from several workstations or hooks are aggregated.
+type Metadata struct {
+	// TS is the time Meta was called, in RFC 3339 with nanoseconds.
+	TS   string `json:"ts"`
+	Host string `json:"host"`
+	PID  int    `json:"pid"`
+	// Hook is CODEX_HOOK_NAME, or else the executable's base name.
+	Hook string `json:"hook"`
+	// InvocationID is the id of the invocation whose event the process read on stdin (see
+	// HookPayload.InvocationID); empty until it has read one.
+	InvocationID string `json:"hook_invocation_id,omitempty"`
+}
+
+// Meta returns the metadata for the current process at the current time.
+func Meta() Metadata {
+	return Metadata{
+		TS:           time.Now().UTC().Format(time.RFC3339Nano),
+		Host:         hostname(),
+		PID:          os.Getpid(),
+		Hook:         hooklog.HookName(),
+		InvocationID: invocation.Current(),
+	}
+}
+
+// Record is an event wrapped with the metadata of the process that handled it. It marshals as
+// `{"ts":...,"host":...,"pid":...,"hook":...,"hook_invocation_id":...,"event":...}`.
+type Record struct {
+	Metadata
+	Event any `json:"event"`
+}
+
+// Wrap returns event wrapped with m.
+func (m Metadata) Wrap(event any) Record {
+	return Record{Metadata: m, Event: event}
+}
+
+var (
+	hostnameOnce sync.Once
+	hostnameVal  string
+)
+
+func hostname() string {
+	hostnameOnce.Do(func() {
+		hostnameVal, _ = os.Hostname()
+	})
+	return hostnameVal
+}
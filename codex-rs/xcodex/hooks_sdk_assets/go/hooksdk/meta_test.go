@@ -0,0 +1,38 @@
+package hooksdk_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestMeta(t *testing.T) {
+	t.Setenv("CODEX_HOOK_NAME", "my-hook")
+	before := time.Now().UTC()
+	m := hooksdk.Meta()
+	ts, err := time.Parse(time.RFC3339Nano, m.TS)
+	if err != nil || ts.Before(before.Truncate(time.Second)) {
+		t.Errorf("TS = %q, %v", m.TS, err)
+	}
+	if m.PID != os.Getpid() || m.Hook != "my-hook" {
+		t.Errorf("Meta = %+v", m)
+	}
+	if host, _ := os.Hostname(); m.Host != host {
+		t.Errorf("Host = %q, want %q", m.Host, host)
+	}
+}
+
+func TestMetadataWrap(t *testing.T) {
+	m := hooksdk.Metadata{TS: "2025-01-01T00:00:00Z", Host: "box", PID: 42, Hook: "h"}
+	data, err := json.Marshal(m.Wrap(map[string]any{"session_id": "s1"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"ts":"2025-01-01T00:00:00Z","host":"box","pid":42,"hook":"h","event":{"session_id":"s1"}}`
+	if string(data) != want {
+		t.Errorf("Wrap marshals as %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,188 @@
+// Package metrics keeps Prometheus counters and histograms of hook events across invocations and
+// writes them in the text exposition format, for node_exporter's textfile collector.
+//
+// Each hook runs in a fresh process, so metric values live in a JSON state file. A Recorder
+// updates that file under a lock and rewrites the `.prom` output atomically on every event, so
+// the collector never reads a half-written file and concurrent hooks never lose an increment.
+//
+//	r := metrics.NewRecorder(statePath, promPath)
+//	err := r.Observe(payload)
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Counter describes a counter family.
+type Counter struct {
+	Name, Help string
+	Labels     []string
+}
+
+// Histogram describes a histogram family; Buckets are the upper bounds, ascending. The +Inf bucket
+// is implied.
+type Histogram struct {
+	Name, Help string
+	Labels     []string
+	Buckets    []float64
+}
+
+// histogramValue is one histogram series. Counts are per bucket (not cumulative), with the +Inf
+// bucket last.
+type histogramValue struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// Values holds the value of every series, keyed by family name and then by the series' rendered
+// label set (`tool="shell",status="success"`).
+type Values struct {
+	Counters   map[string]map[string]float64         `json:"counters,omitempty"`
+	Histograms map[string]map[string]*histogramValue `json:"histograms,omitempty"`
+}
+
+// Add adds v to the counter series with the given label values (in c.Labels order).
+func (vs *Values) Add(c Counter, v float64, labelValues ...string) {
+	if vs.Counters == nil {
+		vs.Counters = map[string]map[string]float64{}
+	}
+	series := vs.Counters[c.Name]
+	if series == nil {
+		series = map[string]float64{}
+		vs.Counters[c.Name] = series
+	}
+	series[labelSet(c.Labels, labelValues)] += v
+}
+
+// Observe records v in the histogram series with the given label values. A series recorded with
+// other buckets (the configuration changed) starts over.
+func (vs *Values) Observe(h Histogram, v float64, labelValues ...string) {
+	if vs.Histograms == nil {
+		vs.Histograms = map[string]map[string]*histogramValue{}
+	}
+	series := vs.Histograms[h.Name]
+	if series == nil {
+		series = map[string]*histogramValue{}
+		vs.Histograms[h.Name] = series
+	}
+	key := labelSet(h.Labels, labelValues)
+	hv := series[key]
+	if hv == nil || !sameBounds(hv.Bounds, h.Buckets) || len(hv.Counts) != len(h.Buckets)+1 {
+		hv = &histogramValue{Bounds: append([]float64(nil), h.Buckets...), Counts: make([]uint64, len(h.Buckets)+1)}
+		series[key] = hv
+	}
+	i := sort.SearchFloat64s(h.Buckets, v) // first bound >= v; len(Buckets) is +Inf
+	hv.Counts[i]++
+	hv.Sum += v
+	hv.Count++
+}
+
+func sameBounds(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteText writes the families in the Prometheus text exposition format (version 0.0.4). Every
+// family gets its HELP and TYPE lines even before it has series; series are sorted by labels.
+func (vs *Values) WriteText(w io.Writer, counters []Counter, histograms []Histogram) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range counters {
+		header(bw, c.Name, c.Help, "counter")
+		series := vs.Counters[c.Name]
+		for _, key := range sortedKeys(series) {
+			fmt.Fprintf(bw, "%s%s %s\n", c.Name, braces(key), formatFloat(series[key]))
+		}
+	}
+	for _, h := range histograms {
+		header(bw, h.Name, h.Help, "histogram")
+		series := vs.Histograms[h.Name]
+		for _, key := range sortedKeys(series) {
+			hv := series[key]
+			var cumulative uint64
+			for i, n := range hv.Counts {
+				cumulative += n
+				le := "+Inf"
+				if i < len(hv.Bounds) {
+					le = formatFloat(hv.Bounds[i])
+				}
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", h.Name, braces(joinLabels(key, `le="`+le+`"`)), cumulative)
+			}
+			fmt.Fprintf(bw, "%s_sum%s %s\n", h.Name, braces(key), formatFloat(hv.Sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", h.Name, braces(key), hv.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+func header(w io.Writer, name, help, typ string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// labelSet renders label pairs with escaped values. Missing values are empty, which Prometheus
+// treats the same as an absent label.
+func labelSet(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs[i] = name + `="` + escapeLabel(v) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,191 @@
+package metrics_test
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/metrics"
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelRE      = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)="((?:[^"\\\n]|\\[\\"n])*)"`)
+)
+
+// parseText parses the Prometheus text exposition format as strictly as Prometheus' own parser:
+// every sample belongs to a family declared by a preceding TYPE line, names, labels and values
+// are well formed, and histogram buckets are cumulative, end in +Inf, and match _count. It
+// returns the samples keyed by `name{labels}` as written.
+func parseText(t *testing.T, text string) map[string]float64 {
+	t.Helper()
+	samples := map[string]float64{}
+	types := map[string]string{}
+	var family string
+	// histogram tracks a histogram series' buckets so far: the last bound and cumulative count,
+	// and whether the +Inf bucket was seen.
+	type histogram struct {
+		bound, count float64
+		done         bool
+	}
+	hists := map[string]*histogram{}
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		fail := func(format string, args ...any) {
+			t.Fatalf("line %d %q: %s", n, line, fmt.Sprintf(format, args...))
+		}
+		if rest, ok := strings.CutPrefix(line, "# "); ok {
+			fields := strings.SplitN(rest, " ", 3)
+			if len(fields) < 3 || !metricNameRE.MatchString(fields[1]) {
+				fail("malformed comment")
+			}
+			switch fields[0] {
+			case "HELP":
+			case "TYPE":
+				if _, dup := types[fields[1]]; dup {
+					fail("second TYPE for %s", fields[1])
+				}
+				if fields[2] != "counter" && fields[2] != "histogram" && fields[2] != "gauge" {
+					fail("type %q", fields[2])
+				}
+				types[fields[1]], family = fields[2], fields[1]
+			default:
+				fail("unknown comment")
+			}
+			continue
+		}
+
+		end := strings.IndexAny(line, "{ ")
+		if end < 0 {
+			fail("no value")
+		}
+		name, rest := line[:end], line[end:]
+		if !metricNameRE.MatchString(name) {
+			fail("bad metric name")
+		}
+		labels := map[string]string{}
+		var others []string
+		if strings.HasPrefix(rest, "{") {
+			rest = rest[1:]
+			for !strings.HasPrefix(rest, "}") {
+				m := labelRE.FindStringSubmatch(rest)
+				if m == nil {
+					fail("bad label at %q", rest)
+				}
+				if _, dup := labels[m[1]]; dup {
+					fail("duplicate label %s", m[1])
+				}
+				labels[m[1]] = m[2]
+				if m[1] != "le" {
+					others = append(others, m[0])
+				}
+				rest = strings.TrimPrefix(rest[len(m[0]):], ",")
+			}
+			rest = rest[1:]
+		}
+		value, ok := strings.CutPrefix(rest, " ")
+		v, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil {
+			fail("bad value %q", value)
+		}
+
+		switch types[family] {
+		case "counter", "gauge":
+			if name != family {
+				fail("sample of %s under TYPE %s", name, family)
+			}
+		case "histogram":
+			series := family + "{" + strings.Join(others, ",") + "}"
+			h := hists[series]
+			if h == nil {
+				h = &histogram{bound: math.Inf(-1)}
+				hists[series] = h
+			}
+			switch name {
+			case family + "_bucket":
+				le, ok := labels["le"]
+				if !ok || h.done {
+					fail("bucket without le, or after +Inf")
+				}
+				bound, err := strconv.ParseFloat(le, 64)
+				if err != nil || bound <= h.bound || v < h.count {
+					fail("buckets not ascending and cumulative")
+				}
+				h.bound, h.count, h.done = bound, v, math.IsInf(bound, 1)
+			case family + "_count":
+				if !h.done || v != h.count {
+					fail("_count %v, but the +Inf bucket is %v", v, h.count)
+				}
+			case family + "_sum":
+			default:
+				fail("sample of %s under histogram %s", name, family)
+			}
+		default:
+			fail("sample before any TYPE")
+		}
+		key := line[:len(line)-len(value)-1]
+		if _, dup := samples[key]; dup {
+			fail("duplicate sample")
+		}
+		samples[key] = v
+	}
+	return samples
+}
+
+func TestWriteText(t *testing.T) {
+	c := metrics.Counter{Name: "test_total", Help: "Things.\nCounted \\ here.", Labels: []string{"kind"}}
+	h := metrics.Histogram{Name: "test_seconds", Help: "Durations.", Labels: []string{"tool"}, Buckets: []float64{0.5, 1, 2.5}}
+	empty := metrics.Counter{Name: "test_unused_total", Help: "Never incremented."}
+	var vs metrics.Values
+	vs.Add(c, 1, "b")
+	vs.Add(c, 2, `say "hi"`+"\n")
+	vs.Add(c, 1, "b")
+	for _, d := range []float64{0.1, 0.5, 2, 9} {
+		vs.Observe(h, d, "shell")
+	}
+
+	var b strings.Builder
+	if err := vs.WriteText(&b, []metrics.Counter{c, empty}, []metrics.Histogram{h}); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_total Things.\nCounted \\ here.
+# TYPE test_total counter
+test_total{kind="b"} 2
+test_total{kind="say \"hi\"\n"} 2
+# HELP test_unused_total Never incremented.
+# TYPE test_unused_total counter
+# HELP test_seconds Durations.
+# TYPE test_seconds histogram
+test_seconds_bucket{tool="shell",le="0.5"} 2
+test_seconds_bucket{tool="shell",le="1"} 2
+test_seconds_bucket{tool="shell",le="2.5"} 3
+test_seconds_bucket{tool="shell",le="+Inf"} 4
+test_seconds_sum{tool="shell"} 11.6
+test_seconds_count{tool="shell"} 4
+`
+	if b.String() != want {
+		t.Errorf("WriteText =\n%s\nwant\n%s", b.String(), want)
+	}
+	parseText(t, b.String())
+}
+
+func TestObserveBucketsChanged(t *testing.T) {
+	h := metrics.Histogram{Name: "d", Buckets: []float64{1, 2}}
+	var vs metrics.Values
+	vs.Observe(h, 1.5)
+	vs.Observe(h, 1.5)
+	// With other buckets the series starts over rather than mixing bounds.
+	h.Buckets = []float64{1, 5}
+	vs.Observe(h, 3)
+	var b strings.Builder
+	vs.WriteText(&b, nil, []metrics.Histogram{h})
+	samples := parseText(t, b.String())
+	if samples[`d_bucket{le="5"}`] != 1 || samples["d_count"] != 1 {
+		t.Errorf("series after a bucket change:\n%s", b.String())
+	}
+}
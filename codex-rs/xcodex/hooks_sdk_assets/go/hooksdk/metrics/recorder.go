@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/atomicfile"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+)
+
+const lockTimeout = 5 * time.Second
+
+// openTTL bounds how long a started tool call is remembered; calls whose finish never arrives
+// (a crashed session) are dropped after it.
+const openTTL = 24 * time.Hour
+
+// DefaultBuckets are the tool duration histogram's bounds, in seconds.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// The families a Recorder maintains.
+var (
+	EventsTotal = Counter{
+		Name:   "xcodex_hook_events_total",
+		Help:   "Hook events received, by event type.",
+		Labels: []string{"event"},
+	}
+	ToolExecutionsTotal = Counter{
+		Name:   "xcodex_tool_executions_total",
+		Help:   "Finished tool calls, by tool and status (success, failure, or aborted).",
+		Labels: []string{"tool", "status"},
+	}
+)
+
+const (
+	toolDurationName = "xcodex_tool_duration_seconds"
+	toolDurationHelp = "Tool call duration in seconds, from the start and finish events."
+)
+
+// Recorder updates the metric values in StatePath for each event and rewrites OutPath.
+type Recorder struct {
+	StatePath string
+	// OutPath is the exposition file; node_exporter only reads files ending in `.prom`.
+	OutPath string
+	// Buckets are the tool duration bounds; nil means DefaultBuckets.
+	Buckets []float64
+	// Now is the clock for events without a timestamp; nil means time.Now.
+	Now func() time.Time
+}
+
+// NewRecorder returns a Recorder keeping its state in statePath and writing outPath.
+func NewRecorder(statePath, outPath string) *Recorder {
+	return &Recorder{StatePath: statePath, OutPath: outPath}
+}
+
+// ToolDuration is the tool duration histogram with r's buckets.
+func (r *Recorder) ToolDuration() Histogram {
+	buckets := r.Buckets
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return Histogram{Name: toolDurationName, Help: toolDurationHelp, Labels: []string{"tool"}, Buckets: buckets}
+}
+
+// state is the state file: the metric values, plus the start of tool calls still running.
+type state struct {
+	Values
+	Open map[string]openCall `json:"open,omitempty"`
+}
+
+type openCall struct {
+	Tool  string    `json:"tool"`
+	Start time.Time `json:"start"`
+}
+
+// Observe counts p and, for tool calls, records the outcome and duration, then rewrites OutPath.
+//
+// The duration is the time between a call's `tool-call-started` and `tool-call-finished`
+// timestamps; if the start wasn't seen, the finish event's `duration_ms` is used instead.
+func (r *Recorder) Observe(p *hooksdk.HookPayload) error {
+	return r.locked(func() error {
+		st, err := r.load()
+		if err != nil {
+			return err
+		}
+		r.update(st, p)
+		if err := writeAtomic(r.StatePath, func(buf *bytes.Buffer) error {
+			return json.NewEncoder(buf).Encode(st)
+		}); err != nil {
+			return err
+		}
+		return r.write(&st.Values)
+	})
+}
+
+func (r *Recorder) update(st *state, p *hooksdk.HookPayload) {
+	event := p.EventType()
+	if event == "" {
+		event = "unknown"
+	}
+	st.Add(EventsTotal, 1, event)
+
+	now := r.eventTime(p)
+	for id, c := range st.Open {
+		if now.Sub(c.Start) > openTTL {
+			delete(st.Open, id)
+		}
+	}
+
+	callID, _ := hooksdk.StringField(p.RawPayload, "tool_use_id")
+	tool, _ := hooksdk.StringField(p.RawPayload, "tool_name")
+	switch event {
+	case "tool-call-started":
+		if callID != "" {
+			st.Open[callID] = openCall{Tool: tool, Start: now}
+		}
+	case "tool-call-finished":
+		start, started := st.Open[callID]
+		delete(st.Open, callID)
+		if tool == "" {
+			tool = start.Tool
+		}
+		st.Add(ToolExecutionsTotal, 1, tool, toolStatus(p))
+
+		var d time.Duration
+		if started && callID != "" && !now.Before(start.Start) {
+			d = now.Sub(start.Start)
+		} else if ms, ok := hooksdk.IntField(p.RawPayload, "duration_ms"); ok && ms >= 0 {
+			d = time.Duration(ms) * time.Millisecond
+		} else {
+			return
+		}
+		st.Observe(r.ToolDuration(), d.Seconds(), tool)
+	}
+}
+
+// toolStatus is "aborted" for aborted calls, else "success" or "failure".
+func toolStatus(p *hooksdk.HookPayload) string {
+	if status, _ := hooksdk.StringField(p.RawPayload, "status"); status == "aborted" {
+		return status
+	}
+	if ok, found := hooksdk.BoolField(p.RawPayload, "success"); found && !ok {
+		return "failure"
+	}
+	return "success"
+}
+
+// write renders the exposition file.
+func (r *Recorder) write(vs *Values) error {
+	if err := os.MkdirAll(filepath.Dir(r.OutPath), 0o755); err != nil {
+		return err
+	}
+	return writeAtomic(r.OutPath, func(buf *bytes.Buffer) error {
+		return vs.WriteText(buf, []Counter{EventsTotal, ToolExecutionsTotal}, []Histogram{r.ToolDuration()})
+	})
+}
+
+func (r *Recorder) eventTime(p *hooksdk.HookPayload) time.Time {
+	if t := p.Time(); !t.IsZero() {
+		return t
+	}
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// locked runs fn holding `<StatePath>.lock`.
+func (r *Recorder) locked(fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(r.StatePath), 0o755); err != nil {
+		return err
+	}
+	lock, err := filelock.AcquireTimeout(r.StatePath+".lock", lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return fn()
+}
+
+// load reads the state file. A missing or corrupt file starts from zero, which Prometheus handles
+// like an exporter restart (rate() and increase() account for counter resets).
+func (r *Recorder) load() (*state, error) {
+	var st state
+	data, err := os.ReadFile(r.StatePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 && json.Unmarshal(data, &st) != nil {
+		st = state{}
+	}
+	if st.Open == nil {
+		st.Open = map[string]openCall{}
+	}
+	return &st, nil
+}
+
+// writeAtomic replaces the file at path with what fill writes. The temporary file's name doesn't
+// end in `.prom`, so the textfile collector never picks it up.
+func writeAtomic(path string, fill func(*bytes.Buffer) error) error {
+	var buf bytes.Buffer
+	if err := fill(&buf); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, buf.Bytes(), 0o644)
+}
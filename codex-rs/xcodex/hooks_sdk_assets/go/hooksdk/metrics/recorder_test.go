@@ -0,0 +1,156 @@
+package metrics_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/metrics"
+)
+
+// TestMain lets the tests run this binary as a hook process: with METRICS_TEST_DIR set, it
+// records METRICS_TEST_COUNT tool calls in the recorder there.
+func TestMain(m *testing.M) {
+	if dir := os.Getenv("METRICS_TEST_DIR"); dir != "" {
+		var n int
+		fmt.Sscan(os.Getenv("METRICS_TEST_COUNT"), &n)
+		if err := recordCalls(recorder(dir), os.Getenv("METRICS_TEST_ID"), n); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func recorder(dir string) *metrics.Recorder {
+	return metrics.NewRecorder(filepath.Join(dir, "state.json"), filepath.Join(dir, "out", "xcodex.prom"))
+}
+
+func recordCalls(r *metrics.Recorder, prefix string, n int) error {
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("%s-%d", prefix, i)
+		for _, b := range []*hooktest.Builder{hooktest.ToolCallStarted(), hooktest.ToolCallFinished()} {
+			if err := r.Observe(b.With("tool_use_id", id).Build()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exposition reads and parses the recorder's output.
+func exposition(t *testing.T, r *metrics.Recorder) map[string]float64 {
+	t.Helper()
+	data, err := os.ReadFile(r.OutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parseText(t, string(data))
+}
+
+func TestRecorder(t *testing.T) {
+	r := recorder(t.TempDir())
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := func(d time.Duration) string { return t0.Add(d).Format(time.RFC3339Nano) }
+	events := []*hooktest.Builder{
+		hooktest.SessionStart(),
+		// 2s between start and finish, whatever duration_ms says.
+		hooktest.ToolCallStarted().With("tool_use_id", "a").With("timestamp", ts(0)),
+		hooktest.ToolCallFinished().With("tool_use_id", "a").With("timestamp", ts(2*time.Second)),
+		// The start wasn't seen: duration_ms (1.234s) is used.
+		hooktest.ToolCallFinished().With("tool_use_id", "b").With("success", false),
+		hooktest.ToolCallStarted().With("tool_use_id", "c").WithToolName("apply_patch"),
+		hooktest.ToolCallFinished().With("tool_use_id", "c").With("tool_name", nil).With("status", "aborted").With("duration_ms", nil),
+	}
+	for _, b := range events {
+		if err := r.Observe(b.Build()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := exposition(t, r)
+	for key, want := range map[string]float64{
+		`xcodex_hook_events_total{event="session-start"}`:                   1,
+		`xcodex_hook_events_total{event="tool-call-started"}`:               2,
+		`xcodex_hook_events_total{event="tool-call-finished"}`:              3,
+		`xcodex_tool_executions_total{tool="Bash",status="success"}`:        1,
+		`xcodex_tool_executions_total{tool="Bash",status="failure"}`:        1,
+		`xcodex_tool_executions_total{tool="apply_patch",status="aborted"}`: 1,
+		`xcodex_tool_duration_seconds_bucket{tool="Bash",le="1"}`:           0,
+		`xcodex_tool_duration_seconds_bucket{tool="Bash",le="2.5"}`:         2,
+		`xcodex_tool_duration_seconds_count{tool="Bash"}`:                   2,
+		`xcodex_tool_duration_seconds_sum{tool="Bash"}`:                     3.234,
+		`xcodex_tool_duration_seconds_bucket{tool="apply_patch",le="+Inf"}`: 1,
+	} {
+		if v, ok := got[key]; !ok || v != want {
+			t.Errorf("%s = %v (present %v), want %v", key, v, ok, want)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(filepath.Dir(r.OutPath), "*")); len(files) != 1 {
+		t.Errorf("output directory holds %v, want only the .prom file", files)
+	}
+}
+
+func TestRecorderConcurrentUpdates(t *testing.T) {
+	dir := t.TempDir()
+	const procs, goroutines, n = 4, 4, 10
+
+	var cmds []*exec.Cmd
+	for p := 0; p < procs; p++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "METRICS_TEST_DIR="+dir, fmt.Sprint("METRICS_TEST_COUNT=", n), fmt.Sprint("METRICS_TEST_ID=p", p))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			if err := recordCalls(recorder(dir), fmt.Sprint("g", g), n); err != nil {
+				t.Error(err)
+			}
+		}(g)
+	}
+	wg.Wait()
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := exposition(t, recorder(dir))
+	const calls = (procs + goroutines) * n
+	for key, want := range map[string]float64{
+		`xcodex_hook_events_total{event="tool-call-started"}`:        calls,
+		`xcodex_hook_events_total{event="tool-call-finished"}`:       calls,
+		`xcodex_tool_executions_total{tool="Bash",status="success"}`: calls,
+		`xcodex_tool_duration_seconds_count{tool="Bash"}`:            calls,
+	} {
+		if got[key] != want {
+			t.Errorf("%s = %v, want %v", key, got[key], want)
+		}
+	}
+}
+
+func TestRecorderCorruptState(t *testing.T) {
+	r := recorder(t.TempDir())
+	if err := os.WriteFile(r.StatePath, []byte("{nope"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Observe(hooktest.SessionStart().Build()); err != nil {
+		t.Fatal(err)
+	}
+	if got := exposition(t, r); got[`xcodex_hook_events_total{event="session-start"}`] != 1 {
+		t.Errorf("after a corrupt state: %v", got)
+	}
+}
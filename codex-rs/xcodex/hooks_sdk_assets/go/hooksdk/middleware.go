@@ -0,0 +1,91 @@
+package hooksdk
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// Middleware wraps a Handler with behavior shared by every event: logging, rate limiting,
+// redaction, recovery. It may short-circuit by returning without calling next, wrap next's error,
+// or change its response.
+//
+//	func requireSession(next hooksdk.Handler) hooksdk.Handler {
+//		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+//			if p.SessionID() == "" {
+//				return hooksdk.Allow(), nil // next is never called
+//			}
+//			return next(ctx, p)
+//		}
+//	}
+type Middleware func(next Handler) Handler
+
+// Chain wraps h in mw, the first outermost: Chain(h, a, b) runs a, then b, then h, and their
+// responses come back in the opposite order.
+func Chain(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Use adds middleware around every event the Mux handles, including those that fall through to
+// OnAny or Default. Middleware runs in the order registered, the first outermost (see Chain).
+func (m *Mux) Use(mw ...Middleware) {
+	m.middleware = append(m.middleware, mw...)
+}
+
+// LogRequests returns middleware that binds each payload to hooklog (see hooklog.Bind) and logs
+// one record per event when the handler returns: its decision, reason code and structured
+// reasons, and duration at info level, or its error at error level.
+func LogRequests() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, p *HookPayload) (Response, error) {
+			hooklog.Bind(p)
+			start := time.Now()
+			resp, err := next(ctx, p)
+			fields := map[string]any{"duration_ms": time.Since(start).Milliseconds()}
+			if err != nil {
+				fields["error"] = err.Error()
+				hooklog.Log(hooklog.LevelError, "handler failed", fields)
+				return resp, err
+			}
+			decision := resp.Decision
+			if decision == "" {
+				decision = DecisionAllow
+			}
+			fields["decision"] = decision
+			if resp.ReasonCode != "" {
+				fields["reason_code"] = resp.ReasonCode
+			}
+			if len(resp.Reasons) > 0 {
+				fields["reasons"] = resp.Reasons
+			}
+			hooklog.Log(hooklog.LevelInfo, "handled event", fields)
+			return resp, nil
+		}
+	}
+}
+
+// Recover returns middleware that turns a panic in the handlers it wraps into resp, logging the
+// panic and its stack trace. Run already recovers panics (see WithPanicDecision); Recover lets
+// the middleware outside it, such as LogRequests, still see a response.
+func Recover(resp Response) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, p *HookPayload) (out Response, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					hooklog.Log(hooklog.LevelError, "handler panicked", map[string]any{
+						"panic": fmt.Sprint(r),
+						"stack": string(debug.Stack()),
+					})
+					out, err = resp, nil
+				}
+			}()
+			return next(ctx, p)
+		}
+	}
+}
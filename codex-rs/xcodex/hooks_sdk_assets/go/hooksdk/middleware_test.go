@@ -0,0 +1,229 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// trace returns middleware that records name on the way in and out in *calls.
+func trace(calls *[]string, name string) hooksdk.Middleware {
+	return func(next hooksdk.Handler) hooksdk.Handler {
+		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			*calls = append(*calls, name+">")
+			resp, err := next(ctx, p)
+			*calls = append(*calls, "<"+name)
+			return resp, err
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	h := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		calls = append(calls, "h")
+		return hooksdk.Allow(), nil
+	}
+	if _, err := hooksdk.Chain(h, trace(&calls, "a"), trace(&calls, "b"), trace(&calls, "c"))(context.Background(), parse(t, hooktest.SessionStart())); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a>", "b>", "c>", "h", "<c", "<b", "<a"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	calls = nil
+	hooksdk.Chain(h)(context.Background(), parse(t, hooktest.SessionStart()))
+	if !reflect.DeepEqual(calls, []string{"h"}) {
+		t.Errorf("Chain with no middleware: calls = %v", calls)
+	}
+}
+
+func TestMuxUse(t *testing.T) {
+	var calls []string
+	mux := hooksdk.NewMux()
+	mux.OnToolCallStarted(func(*hooksdk.HookPayload) hooksdk.Response {
+		calls = append(calls, "h")
+		return hooksdk.Deny("started")
+	})
+	// Order holds across several Use calls.
+	mux.Use(trace(&calls, "a"))
+	mux.Use(trace(&calls, "b"), trace(&calls, "c"))
+
+	resp, err := mux.Handle(context.Background(), parse(t, hooktest.ToolCallStarted()))
+	if err != nil || resp.Reason != "started" {
+		t.Fatalf("Handle = %+v, %v", resp, err)
+	}
+	if want := []string{"a>", "b>", "c>", "h", "<c", "<b", "<a"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	// Events that fall through to OnAny or Default are wrapped too.
+	calls = nil
+	mux.Handle(context.Background(), parse(t, hooktest.SessionEnd()))
+	if want := []string{"a>", "b>", "c>", "<c", "<b", "<a"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("default: calls = %v, want %v", calls, want)
+	}
+	calls = nil
+	mux.OnAny(reply("any"))
+	if resp, _ := mux.Handle(context.Background(), parse(t, hooktest.SessionEnd())); resp.Reason != "any" || len(calls) != 6 {
+		t.Errorf("OnAny: %+v, calls = %v", resp, calls)
+	}
+
+	// Dispatch skips the middleware.
+	calls = nil
+	mux.Dispatch(parse(t, hooktest.ToolCallStarted()))
+	if !reflect.DeepEqual(calls, []string{"h"}) {
+		t.Errorf("Dispatch: calls = %v", calls)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	var calls []string
+	block := func(next hooksdk.Handler) hooksdk.Handler {
+		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			calls = append(calls, "block")
+			return hooksdk.Deny("blocked"), nil
+		}
+	}
+	mux := hooksdk.NewMux()
+	mux.OnAny(func(*hooksdk.HookPayload) hooksdk.Response {
+		calls = append(calls, "h")
+		return hooksdk.Allow()
+	})
+	mux.Use(trace(&calls, "outer"), block, trace(&calls, "inner"))
+	resp, err := mux.Handle(context.Background(), parse(t, hooktest.SessionStart()))
+	if err != nil || resp.Decision != hooksdk.DecisionDeny || resp.Reason != "blocked" {
+		t.Errorf("Handle = %+v, %v; want the short-circuit's deny", resp, err)
+	}
+	if want := []string{"outer>", "block", "<outer"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestMiddlewareWrapsErrorsAndResponses(t *testing.T) {
+	errFail := errors.New("fail")
+	failing := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return hooksdk.Response{}, errFail
+	}
+	wrap := func(next hooksdk.Handler) hooksdk.Handler {
+		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			resp, err := next(ctx, p)
+			if err != nil {
+				return resp, fmt.Errorf("wrapped: %w", err)
+			}
+			resp.Reason = "decorated: " + resp.Reason
+			return resp, nil
+		}
+	}
+	p := parse(t, hooktest.SessionStart())
+	if _, err := hooksdk.Chain(failing, wrap)(context.Background(), p); !errors.Is(err, errFail) || err.Error() != "wrapped: fail" {
+		t.Errorf("error = %v, want the wrapped error", err)
+	}
+	deny := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) { return hooksdk.Deny("no"), nil }
+	if resp, _ := hooksdk.Chain(deny, wrap)(context.Background(), p); resp.Reason != "decorated: no" {
+		t.Errorf("reason = %q, want the decorated one", resp.Reason)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	panicking := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) { panic("boom") }
+	var calls []string
+	h := hooksdk.Chain(panicking, trace(&calls, "outer"), hooksdk.Recover(hooksdk.Ask("crashed")))
+	resp, err := h(context.Background(), parse(t, hooktest.SessionStart()))
+	if err != nil || resp.Decision != hooksdk.DecisionAsk || resp.Prompt != "crashed" {
+		t.Errorf("Recover = %+v, %v; want the given response", resp, err)
+	}
+	// The middleware outside Recover still returns normally.
+	if !reflect.DeepEqual(calls, []string{"outer>", "<outer"}) {
+		t.Errorf("calls = %v", calls)
+	}
+
+	ok := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return hooksdk.Deny("fine"), nil
+	}
+	if resp, _ := hooksdk.Chain(ok, hooksdk.Recover(hooksdk.Allow()))(context.Background(), parse(t, hooktest.SessionStart())); resp.Reason != "fine" {
+		t.Errorf("Recover changed a normal response: %+v", resp)
+	}
+}
+
+// logRequestsMain is the hook HOOKSDK_TEST_LOG_REQUESTS runs: LogRequests around Recover around a
+// handler that, by that variable, denies, fails or panics.
+func logRequestsMain(mode string) {
+	h := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		switch mode {
+		case "error":
+			return hooksdk.Response{}, errors.New("disk full")
+		case "panic":
+			panic("boom")
+		}
+		return hooksdk.Deny("no", hooksdk.WithReasonCode("TEST_NO"), hooksdk.WithSeverity(hooksdk.SeverityLow)), nil
+	}
+	os.Exit(hooksdk.RunIO(context.Background(), os.Stdin, os.Stdout, os.Stderr, hooksdk.Chain(h, hooksdk.LogRequests(), hooksdk.Recover(hooksdk.Allow()))))
+}
+
+func TestLogRequests(t *testing.T) {
+	records := func(mode string) []map[string]any {
+		t.Helper()
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "HOOKSDK_TEST_LOG_REQUESTS="+mode, "CODEX_HOME="+t.TempDir(),
+			"CODEX_HOOK_LOG_FORMAT=json", "CODEX_HOOK_LOG_LEVEL=info", "CODEX_HOOK_NAME=logged")
+		cmd.Stdin = bytes.NewReader(hooktest.ToolCallStarted().WithSessionID("s-log").Bytes())
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		cmd.Run()
+		var out []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+			var rec map[string]any
+			if json.Unmarshal([]byte(line), &rec) == nil {
+				out = append(out, rec)
+			}
+		}
+		return out
+	}
+	find := func(recs []map[string]any, msg string) map[string]any {
+		for _, r := range recs {
+			if r["msg"] == msg {
+				return r
+			}
+		}
+		t.Fatalf("no %q record in %v", msg, recs)
+		return nil
+	}
+
+	rec := find(records("deny"), "handled event")
+	if rec["level"] != "info" || rec["decision"] != "deny" || rec["reason_code"] != "TEST_NO" || rec["session_id"] != "s-log" ||
+		rec["event_type"] != "tool-call-started" || rec["hook"] != "logged" {
+		t.Errorf("deny record = %v", rec)
+	}
+	if reasons, _ := json.Marshal(rec["reasons"]); string(reasons) != `[{"code":"TEST_NO","message":"no","severity":"low"}]` {
+		t.Errorf("deny record reasons = %s", reasons)
+	}
+	if _, ok := rec["duration_ms"].(float64); !ok {
+		t.Errorf("deny record has no duration: %v", rec)
+	}
+
+	rec = find(records("error"), "handler failed")
+	if rec["level"] != "error" || rec["error"] != "disk full" {
+		t.Errorf("error record = %v", rec)
+	}
+
+	// Recover, inside LogRequests, turns the panic into the logged decision.
+	recs := records("panic")
+	rec = find(recs, "handler panicked")
+	if stack, _ := rec["stack"].(string); rec["panic"] != "boom" || !strings.Contains(stack, "goroutine") {
+		t.Errorf("panic record = %v", rec)
+	}
+	if rec := find(recs, "handled event"); rec["decision"] != "allow" {
+		t.Errorf("record after a panic = %v, want the recovered allow", rec)
+	}
+}
@@ -0,0 +1,239 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CurrentSchemaVersion is the payload `schema_version` this SDK's types describe.
+// ParseHookPayload migrates payloads of older versions (see SupportedSchemaRange) to it before
+// decoding them.
+const CurrentSchemaVersion = 1
+
+// A Migration rewrites a raw payload of one schema version, in place, into the shape of the next
+// version. The SDK updates `schema_version` itself.
+type Migration func(raw map[string]any) error
+
+var (
+	migrationMu sync.RWMutex
+	// migrations maps a version to the migration from it to the next version.
+	migrations = map[int]Migration{0: migrateV0}
+)
+
+// RegisterMigration sets the migration from schema version `from` to from+1, for hooks that must
+// read payloads older than the SDK's own migrations go back. from must be below
+// CurrentSchemaVersion.
+func RegisterMigration(from int, m Migration) {
+	if from < 0 || from >= CurrentSchemaVersion || m == nil {
+		panic(fmt.Sprintf("hooksdk: bad migration from schema version %d", from))
+	}
+	migrationMu.Lock()
+	defer migrationMu.Unlock()
+	migrations[from] = m
+}
+
+// SupportedSchemaRange returns the oldest and newest schema versions ParseHookPayload decodes into
+// the current shape. Payloads outside the range are decoded as they are: a hook that can't trust
+// that should check Version and refuse the payload.
+func SupportedSchemaRange() (oldest, newest int) {
+	migrationMu.RLock()
+	defer migrationMu.RUnlock()
+	oldest = CurrentSchemaVersion
+	for oldest > 0 && migrations[oldest-1] != nil {
+		oldest--
+	}
+	return oldest, CurrentSchemaVersion
+}
+
+// Version returns the schema version the payload was sent as: its `schema_version` (or the
+// legacy `schema-version`, or the envelope's), before any migration. When neither says, it is 0
+// for a payload with version 0 keys (see migrateV0) and CurrentSchemaVersion otherwise. Migration
+// updates a `schema_version` the payload carries to CurrentSchemaVersion, and adds none.
+func (p *HookPayload) Version() int {
+	if p.sentVersion != nil {
+		return *p.sentVersion
+	}
+	return p.SchemaVersion
+}
+
+// parseOptions adds the envelope's schema version to opts for ParseHookPayload, for payload files
+// that don't carry one, and a CBOR payload's decoded map, so it isn't decoded again.
+func (env envelope) parseOptions(opts []Option) []Option {
+	if env.schemaVersion == nil && env.decoded == nil {
+		return opts
+	}
+	version, decoded := env.schemaVersion, env.decoded
+	return append(opts[:len(opts):len(opts)], func(o *options) {
+		if version != nil {
+			v := *version
+			o.envelopeVersion = &v
+		}
+		o.decoded = decoded
+	})
+}
+
+// migrate returns data in the shape of CurrentSchemaVersion, and the version it was sent as.
+// Input that isn't a JSON object is returned as it is, for the decoder to report.
+func (o *options) migrate(data []byte) ([]byte, int, error) {
+	var probe versionProbe
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return data, 0, nil
+	}
+	version, ok := probe.version(o.envelopeVersion)
+	if !ok {
+		return data, 0, nil
+	}
+	if !needsMigration(version) {
+		return data, version, nil
+	}
+
+	var raw map[string]any
+	if err := unmarshalUseNumber(data, &raw); err != nil || raw == nil {
+		return data, version, nil
+	}
+	if !probe.stated(o.envelopeVersion) && !hasV0Keys(raw) {
+		return data, CurrentSchemaVersion, nil
+	}
+	if err := migrateRaw(raw, version); err != nil {
+		return nil, version, err
+	}
+	out, err := json.Marshal(raw)
+	if err != nil {
+		return nil, version, err
+	}
+	return out, version, nil
+}
+
+// migrateMap is migrate for a payload already decoded (from CBOR), which it migrates in place.
+func (o *options) migrateMap(raw map[string]any) (int, error) {
+	var probe versionProbe
+	var ok bool
+	if v, found := raw["schema_version"]; found {
+		probe.Snake = new(json.Number)
+		*probe.Snake, ok = v.(json.Number)
+	} else if v, found := raw["schema-version"]; found {
+		probe.Kebab = new(json.Number)
+		*probe.Kebab, ok = v.(json.Number)
+	} else {
+		ok = true
+	}
+	if !ok {
+		// A version that isn't a number leaves the payload as it is, as in migrate.
+		return 0, nil
+	}
+	version, ok := probe.version(o.envelopeVersion)
+	if !ok {
+		return 0, nil
+	}
+	if !needsMigration(version) {
+		return version, nil
+	}
+	if !probe.stated(o.envelopeVersion) && !hasV0Keys(raw) {
+		return CurrentSchemaVersion, nil
+	}
+	if err := migrateRaw(raw, version); err != nil {
+		return version, err
+	}
+	return version, nil
+}
+
+// migrateRaw runs the migrations from version up to CurrentSchemaVersion on raw.
+func migrateRaw(raw map[string]any, version int) error {
+	migrationMu.RLock()
+	chain := make([]Migration, 0, CurrentSchemaVersion-version)
+	for v := version; v < CurrentSchemaVersion; v++ {
+		chain = append(chain, migrations[v])
+	}
+	migrationMu.RUnlock()
+	for i, m := range chain {
+		if err := m(raw); err != nil {
+			return fmt.Errorf("hooksdk: migrate payload from schema version %d: %w", version+i, err)
+		}
+	}
+	if v, ok := raw["schema-version"]; ok {
+		delete(raw, "schema-version")
+		if _, exists := raw["schema_version"]; !exists {
+			raw["schema_version"] = v
+		}
+	}
+	// Only a version the payload carried is updated, so migration adds no field the host didn't
+	// send. Numbers in RawPayload are json.Number, as migrate's output decodes to.
+	if _, ok := raw["schema_version"]; ok {
+		raw["schema_version"] = json.Number(strconv.Itoa(CurrentSchemaVersion))
+	}
+	return nil
+}
+
+// versionProbe is what migrate decodes of a payload to learn its schema version.
+type versionProbe struct {
+	Snake *json.Number `json:"schema_version"`
+	Kebab *json.Number `json:"schema-version"`
+}
+
+// version returns the schema version the payload says it has, or else envelopeVersion, or else 0.
+// ok is false when the payload's version isn't an integer: such a payload is decoded as it is.
+func (p versionProbe) version(envelopeVersion *int) (version int, ok bool) {
+	switch {
+	case p.Snake != nil:
+		n, err := p.Snake.Int64()
+		return int(n), err == nil
+	case p.Kebab != nil:
+		n, err := p.Kebab.Int64()
+		return int(n), err == nil
+	case envelopeVersion != nil:
+		return *envelopeVersion, true
+	}
+	return 0, true
+}
+
+// stated reports whether the payload, or else the envelope, says what schema version it has.
+func (p versionProbe) stated(envelopeVersion *int) bool {
+	return p.Snake != nil || p.Kebab != nil || envelopeVersion != nil
+}
+
+// needsMigration reports whether payloads of schema version are migrated before they are decoded.
+func needsMigration(version int) bool {
+	oldest, _ := SupportedSchemaRange()
+	return version < CurrentSchemaVersion && version >= oldest
+}
+
+// v0Renames are the keys of version 0 payloads (from before `schema_version`, shaped like the
+// legacy notify payload) that version 1 renamed, beyond kebab-case becoming snake_case.
+var v0Renames = map[string]string{
+	"type":      "xcodex_event_type",
+	"thread_id": "session_id",
+}
+
+// hasV0Keys reports whether raw has a key migrateV0 renames, which only version 0 payloads use. A
+// payload that doesn't say its version is only migrated as version 0 when it has one.
+func hasV0Keys(raw map[string]any) bool {
+	for key := range raw {
+		if _, ok := v0Renames[strings.ReplaceAll(key, "-", "_")]; ok || strings.Contains(key, "-") {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateV0 brings a version 0 payload to version 1: `thread-id` is `session_id`, `type` is
+// `xcodex_event_type`, and the other kebab-case keys (`turn-id`, `last-assistant-message`, ...)
+// are snake_case. A key already present in its new spelling wins.
+func migrateV0(raw map[string]any) error {
+	for key, value := range raw {
+		name := strings.ReplaceAll(key, "-", "_")
+		if renamed, ok := v0Renames[name]; ok {
+			name = renamed
+		}
+		if name == key {
+			continue
+		}
+		delete(raw, key)
+		if _, exists := raw[name]; !exists {
+			raw[name] = value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// withoutVersion returns b's payload without its schema_version.
+func withoutVersion(t *testing.T, b *hooktest.Builder) []byte {
+	t.Helper()
+	m := b.Map()
+	delete(m, "schema_version")
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var x, y any
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatal(err)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func TestUnversionedCurrentPayloadIsNotMigrated(t *testing.T) {
+	for name, b := range hooktest.Fixtures() {
+		data := withoutVersion(t, b)
+		p, err := hooksdk.ParseHookPayload(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, ok := p.RawPayload["schema_version"]; ok {
+			t.Errorf("%s: RawPayload has schema_version %v, which the host didn't send", name, p.RawPayload["schema_version"])
+		}
+		if got := p.Version(); got != hooksdk.CurrentSchemaVersion {
+			t.Errorf("%s: Version() = %d, want %d", name, got, hooksdk.CurrentSchemaVersion)
+		}
+		out, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("%s: MarshalJSON: %v", name, err)
+		}
+		if !jsonEqual(t, out, data) {
+			t.Errorf("%s: round trip changed the payload:\n got %s\nwant %s", name, out, data)
+		}
+	}
+}
+
+func TestLegacyPayloadIsMigrated(t *testing.T) {
+	b := hooktest.ToolCallFinished().WithSessionID("sess-1")
+	for _, format := range []string{"json", "cbor"} {
+		data, opts := b.Legacy().Bytes(), []hooksdk.Option(nil)
+		if format == "cbor" {
+			data, opts = b.Legacy().CBOR(), []hooksdk.Option{hooksdk.WithPayloadFormat(hooksdk.PayloadFormatCBOR)}
+		}
+		p, err := hooksdk.ParseHookPayload(data, opts...)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if p.Version() != 0 {
+			t.Errorf("%s: Version() = %d, want 0", format, p.Version())
+		}
+		if p.SessionID() != "sess-1" || p.Type() != hooksdk.EventToolCallFinished {
+			t.Errorf("%s: got session %q, type %q", format, p.SessionID(), p.Type())
+		}
+		if _, ok := p.RawPayload["thread-id"]; ok {
+			t.Errorf("%s: RawPayload still has thread-id", format)
+		}
+		if _, ok := p.RawPayload["schema_version"]; ok {
+			t.Errorf("%s: migration added schema_version to RawPayload", format)
+		}
+	}
+}
+
+func TestStatedVersionIsUpdated(t *testing.T) {
+	m := hooktest.SessionStart().Legacy().Map()
+	m["schema-version"] = 0
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := hooksdk.ParseHookPayload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version() != 0 || p.SchemaVersion != hooksdk.CurrentSchemaVersion {
+		t.Errorf("Version() = %d, SchemaVersion = %d; want 0, %d", p.Version(), p.SchemaVersion, hooksdk.CurrentSchemaVersion)
+	}
+	if v := p.RawPayload["schema_version"]; v != json.Number("1") {
+		t.Errorf("RawPayload schema_version = %#v, want 1", v)
+	}
+	if _, ok := p.RawPayload["schema-version"]; ok {
+		t.Errorf("RawPayload still has schema-version")
+	}
+}
+
+func TestLegacyAndCurrentDecodeTheSame(t *testing.T) {
+	for name, b := range hooktest.Fixtures() {
+		current, err := hooksdk.ParseHookPayload(b.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		legacy, err := hooksdk.ParseHookPayload(b.Legacy().Bytes())
+		if err != nil {
+			t.Fatalf("%s legacy: %v", name, err)
+		}
+		want, err := current.Event()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := legacy.Event()
+		if err != nil {
+			t.Fatalf("%s legacy: %v", name, err)
+		}
+		// The legacy payload has no schema_version; apart from that the typed payloads agree.
+		delete(want.Raw(), "schema_version")
+		reflect.ValueOf(want).Elem().FieldByName("SchemaVersion").SetInt(0)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: legacy payload decoded to\n%+v\nwant\n%+v", name, got, want)
+		}
+	}
+}
+
+func TestMigrationKeepsNewSpelling(t *testing.T) {
+	m := hooktest.SessionStart().WithSessionID("new").Legacy().Map()
+	m["session_id"] = "new"
+	m["thread-id"] = "old"
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := hooksdk.ParseHookPayload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SessionID() != "new" {
+		t.Errorf("SessionID() = %q, want the snake_case spelling's", p.SessionID())
+	}
+}
+
+func TestEnvelopeSchemaVersion(t *testing.T) {
+	// A payload file saying nothing of its version takes the envelope's.
+	env, _ := envelopeWith(t, hooktest.ToolCallStarted().Legacy().Bytes(), map[string]any{"schema_version": 0})
+	p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version() != 0 || p.Type() != hooksdk.EventToolCallStarted || p.SessionID() != "test-session" {
+		t.Errorf("payload = version %d, type %q, session %q", p.Version(), p.Type(), p.SessionID())
+	}
+
+	// The payload's own version wins.
+	env, _ = envelopeWith(t, hooktest.ToolCallStarted().Bytes(), map[string]any{"schema-version": 0})
+	if p, err = hooksdk.ReadPayloadFrom(bytes.NewReader(env)); err != nil || p.Version() != hooksdk.CurrentSchemaVersion {
+		t.Errorf("versioned payload in a version 0 envelope: %v, %v", p, err)
+	}
+}
+
+func TestUnsupportedVersionDecodedAsIs(t *testing.T) {
+	for _, version := range []int{hooksdk.CurrentSchemaVersion + 1, -1} {
+		b := hooktest.Notification().Legacy().With("schema_version", version)
+		p, err := hooksdk.ParseHookPayload(b.Bytes())
+		if err != nil {
+			t.Fatalf("version %v: %v", version, err)
+		}
+		// Nothing was renamed.
+		if _, ok := p.RawPayload["thread-id"]; !ok || p.Version() != version {
+			t.Errorf("version %v: payload migrated to version %d: %v", version, p.Version(), p.RawPayload)
+		}
+	}
+	// A version that isn't a number isn't migrated either, and then fails to decode.
+	if _, err := hooksdk.ParseHookPayload(hooktest.Notification().Legacy().With("schema_version", "one").Bytes()); err == nil {
+		t.Errorf("payload with schema_version \"one\" decoded")
+	}
+}
+
+func TestSupportedSchemaRange(t *testing.T) {
+	if oldest, newest := hooksdk.SupportedSchemaRange(); oldest != 0 || newest != hooksdk.CurrentSchemaVersion {
+		t.Errorf("SupportedSchemaRange() = %d, %d; want 0, %d", oldest, newest, hooksdk.CurrentSchemaVersion)
+	}
+	for _, from := range []int{-1, hooksdk.CurrentSchemaVersion} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterMigration(%d) didn't panic", from)
+				}
+			}()
+			hooksdk.RegisterMigration(from, func(map[string]any) error { return nil })
+		}()
+	}
+}
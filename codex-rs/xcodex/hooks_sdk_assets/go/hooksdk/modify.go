@@ -0,0 +1,177 @@
+package hooksdk
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrModificationNotPermitted is returned by CheckModify (and logged by Run, which then fails the
+// hook) when a response's Modify section touches a field the event type doesn't let hooks change.
+var ErrModificationNotPermitted = errors.New("payload modification not permitted")
+
+// modifiableFields are the top-level payload fields a hook may rewrite, per event type.
+var modifiableFields = map[EventType][]string{
+	EventApprovalRequested: {"command"},
+	EventToolCallStarted:   {"tool_input"},
+	EventUserPromptSubmit:  {"prompt"},
+}
+
+// ModifiableFields returns the top-level payload fields a response may change for events of type
+// t (see Response.ModifyPayload); for most event types there are none.
+func ModifiableFields(t EventType) []string {
+	return append([]string(nil), modifiableFields[t]...)
+}
+
+// ModifyPayload returns r with patch merged into its Modify section, asking the host to change
+// the payload before it acts on it, e.g. to rewrite the command a tool call runs:
+//
+//	hooksdk.Allow().ModifyPayload(map[string]any{
+//		"tool_input": map[string]any{"command": rewritten, "timeout_ms": nil},
+//	})
+//
+// The patch is a JSON merge patch (RFC 7386): objects are merged key by key, anything else
+// (including an array) replaces the value, and nil deletes the key. Calls accumulate, later ones
+// winning. Only the fields in ModifiableFields may be touched; Run checks this (see CheckModify).
+// To a host that doesn't support modifications (see CapabilityModify), WriteResponse sends a
+// deny instead, so the action isn't run unchanged.
+func (r Response) ModifyPayload(patch map[string]any) Response {
+	merged := cloneMap(r.Modify)
+	for k, v := range patch {
+		merged[k] = combinePatches(merged[k], cloneValue(v))
+	}
+	r.Modify = merged
+	return r
+}
+
+// ReplaceField returns r with the payload field at path (dot-separated keys, like
+// `tool_input.command`) set to value, or deleted if value is nil (see ModifyPayload). Array
+// elements can't be addressed; replace the whole array instead. A map value is merged into the
+// object at path rather than replacing it. An invalid path is reported by CheckModify.
+func (r Response) ReplaceField(path string, value any) Response {
+	keys := strings.Split(path, ".")
+	for _, k := range keys {
+		if k == "" || strings.ContainsAny(k, "[]") {
+			r.modifyErr = fmt.Errorf("invalid field path %q", path)
+			return r
+		}
+	}
+	patch := map[string]any{keys[len(keys)-1]: value}
+	for i := len(keys) - 2; i >= 0; i-- {
+		patch = map[string]any{keys[i]: patch}
+	}
+	return r.ModifyPayload(patch)
+}
+
+// CheckModify reports whether r's Modify section only touches fields the event type t permits
+// (see ModifiableFields), with values of the right shape: `command` must be an array of strings,
+// `prompt` a string, and `tool_input` present. The error wraps ErrModificationNotPermitted.
+func (r Response) CheckModify(t EventType) error {
+	if r.modifyErr != nil {
+		return fmt.Errorf("%w: %v", ErrModificationNotPermitted, r.modifyErr)
+	}
+	if len(r.Modify) == 0 {
+		return nil
+	}
+	permitted := modifiableFields[t]
+	keys := make([]string, 0, len(r.Modify))
+	for k := range r.Modify {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !containsString(permitted, k) {
+			return fmt.Errorf("%w: %s events can't change %q", ErrModificationNotPermitted, t, k)
+		}
+		v := r.Modify[k]
+		ok := true
+		switch k {
+		case "command":
+			ok = isStringArray(v)
+		case "prompt":
+			_, ok = v.(string)
+		default:
+			ok = v != nil
+		}
+		if !ok {
+			return fmt.Errorf("%w: invalid value for %q", ErrModificationNotPermitted, k)
+		}
+	}
+	return nil
+}
+
+// MergePatch applies patch to target as a JSON merge patch (RFC 7386) and returns the result:
+// when both are objects their keys are merged recursively, with nil values in patch deleting
+// keys; otherwise patch replaces target (with any nils inside it removed). Neither argument is
+// modified. It is how hosts apply a response's Modify section to the payload.
+func MergePatch(target, patch any) any {
+	p, ok := asObject(patch)
+	if !ok {
+		return cloneValue(patch)
+	}
+	t, ok := asObject(target)
+	if !ok {
+		t = map[string]any{}
+	}
+	out := cloneMap(t)
+	for k, v := range p {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		out[k] = MergePatch(out[k], v)
+	}
+	return out
+}
+
+// combinePatches merges patch b into patch a, so that applying the result has the effect of
+// applying a and then b for the usual cases. Unlike MergePatch, nils are kept.
+func combinePatches(a, b any) any {
+	bo, ok := asObject(b)
+	if !ok {
+		return b
+	}
+	ao, ok := asObject(a)
+	if !ok {
+		return bo
+	}
+	for k, v := range bo {
+		ao[k] = combinePatches(ao[k], v)
+	}
+	return ao
+}
+
+func asObject(v any) (map[string]any, bool) {
+	switch t := v.(type) {
+	case map[string]any:
+		return t, true
+	case HookPayloadJSON:
+		return map[string]any(t), true
+	}
+	return nil, false
+}
+
+func isStringArray(v any) bool {
+	switch t := v.(type) {
+	case []string:
+		return true
+	case []any:
+		for _, item := range t {
+			if _, ok := item.(string); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
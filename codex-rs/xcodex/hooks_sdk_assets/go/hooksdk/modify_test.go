@@ -0,0 +1,157 @@
+package hooksdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name                string
+		target, patch, want any
+	}{
+		{"merge objects", map[string]any{"a": "b", "c": "d"}, map[string]any{"a": "z"}, map[string]any{"a": "z", "c": "d"}},
+		{"add key", map[string]any{"a": "b"}, map[string]any{"c": "d"}, map[string]any{"a": "b", "c": "d"}},
+		{"null deletes", map[string]any{"a": "b", "c": "d"}, map[string]any{"a": nil}, map[string]any{"c": "d"}},
+		{"null for a missing key", map[string]any{"a": "b"}, map[string]any{"x": nil}, map[string]any{"a": "b"}},
+		{"array replaces", map[string]any{"a": []any{"x", "y"}}, map[string]any{"a": []any{"z"}}, map[string]any{"a": []any{"z"}}},
+		{"array replaces an object", map[string]any{"a": map[string]any{"b": "c"}}, map[string]any{"a": []any{"z"}}, map[string]any{"a": []any{"z"}}},
+		{"object replaces an array", map[string]any{"a": []any{"x"}}, map[string]any{"a": map[string]any{"b": "c"}}, map[string]any{"a": map[string]any{"b": "c"}}},
+		{"nested", map[string]any{"a": map[string]any{"b": "c", "d": "e"}}, map[string]any{"a": map[string]any{"b": nil, "f": "g"}},
+			map[string]any{"a": map[string]any{"d": "e", "f": "g"}}},
+		// Nils inside a value that replaces the target are removed.
+		{"nested nulls in a new object", map[string]any{}, map[string]any{"a": map[string]any{"b": nil, "c": "d"}}, map[string]any{"a": map[string]any{"c": "d"}}},
+		{"non-object target", "scalar", map[string]any{"a": "b"}, map[string]any{"a": "b"}},
+		{"non-object patch", map[string]any{"a": "b"}, "replaced", "replaced"},
+		{"empty patch", map[string]any{"a": "b"}, map[string]any{}, map[string]any{"a": "b"}},
+		{"payload map", hooksdk.HookPayloadJSON{"a": "b"}, hooksdk.HookPayloadJSON{"c": "d"}, map[string]any{"a": "b", "c": "d"}},
+	}
+	for _, tt := range tests {
+		if got := hooksdk.MergePatch(tt.target, tt.patch); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: MergePatch = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+
+	target := map[string]any{"a": map[string]any{"b": "c"}, "list": []any{"x"}}
+	patch := map[string]any{"a": map[string]any{"b": nil}, "list": []any{"y"}}
+	got := hooksdk.MergePatch(target, patch).(map[string]any)
+	got["list"].([]any)[0] = "changed"
+	if !reflect.DeepEqual(target, map[string]any{"a": map[string]any{"b": "c"}, "list": []any{"x"}}) ||
+		!reflect.DeepEqual(patch, map[string]any{"a": map[string]any{"b": nil}, "list": []any{"y"}}) {
+		t.Errorf("MergePatch changed its arguments: %v, %v", target, patch)
+	}
+}
+
+func TestModifyPayload(t *testing.T) {
+	patch := map[string]any{"tool_input": map[string]any{"command": "ls", "timeout_ms": nil, "env": map[string]any{"A": "1"}}}
+	r := hooksdk.Allow().ModifyPayload(patch).
+		ModifyPayload(map[string]any{"tool_input": map[string]any{"command": "ls -l", "env": map[string]any{"B": "2"}}})
+	want := map[string]any{"tool_input": map[string]any{"command": "ls -l", "timeout_ms": nil, "env": map[string]any{"A": "1", "B": "2"}}}
+	if !reflect.DeepEqual(r.Modify, want) {
+		t.Errorf("Modify = %v, want %v", r.Modify, want)
+	}
+	// The patch is copied, and the response isn't aliased by later calls.
+	patch["tool_input"].(map[string]any)["command"] = "rm"
+	r2 := r.ModifyPayload(map[string]any{"tool_input": []any{"x"}})
+	if !reflect.DeepEqual(r.Modify, want) {
+		t.Errorf("Modify changed by the caller's patch or a later call: %v", r.Modify)
+	}
+	if !reflect.DeepEqual(r2.Modify, map[string]any{"tool_input": []any{"x"}}) {
+		t.Errorf("a later array didn't replace the object: %v", r2.Modify)
+	}
+
+	// Nils survive in the section, for the host to delete with.
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"modify":{"tool_input":{"command":"ls -l","env":{"A":"1","B":"2"},"timeout_ms":null}}`) {
+		t.Errorf("response JSON = %s", data)
+	}
+	if data, _ := json.Marshal(hooksdk.Allow()); strings.Contains(string(data), "modify") {
+		t.Errorf("a response without modifications has a section: %s", data)
+	}
+}
+
+func TestReplaceField(t *testing.T) {
+	r := hooksdk.Allow().ReplaceField("tool_input.command", "ls").ReplaceField("tool_input.timeout_ms", nil)
+	if want := map[string]any{"tool_input": map[string]any{"command": "ls", "timeout_ms": nil}}; !reflect.DeepEqual(r.Modify, want) {
+		t.Errorf("Modify = %v, want %v", r.Modify, want)
+	}
+	if err := r.CheckModify(hooksdk.EventToolCallStarted); err != nil {
+		t.Error(err)
+	}
+	for _, path := range []string{"", "tool_input.", "tool_input..command", "command[0]"} {
+		r := hooksdk.Allow().ReplaceField(path, "x")
+		if err := r.CheckModify(hooksdk.EventToolCallStarted); !errors.Is(err, hooksdk.ErrModificationNotPermitted) || !strings.Contains(err.Error(), "invalid field path") {
+			t.Errorf("ReplaceField(%q): CheckModify = %v", path, err)
+		}
+	}
+}
+
+func TestCheckModify(t *testing.T) {
+	tests := []struct {
+		name  string
+		event hooksdk.EventType
+		resp  hooksdk.Response
+		ok    bool
+	}{
+		{"nothing", hooksdk.EventSessionStart, hooksdk.Allow(), true},
+		{"command argv", hooksdk.EventApprovalRequested, hooksdk.Allow().ReplaceField("command", []string{"ls"}), true},
+		{"command from JSON", hooksdk.EventApprovalRequested, hooksdk.Allow().ReplaceField("command", []any{"ls", "-l"}), true},
+		{"command string", hooksdk.EventApprovalRequested, hooksdk.Allow().ReplaceField("command", "ls"), false},
+		{"command deleted", hooksdk.EventApprovalRequested, hooksdk.Allow().ReplaceField("command", nil), false},
+		{"command with a number", hooksdk.EventApprovalRequested, hooksdk.Allow().ReplaceField("command", []any{"ls", 1}), false},
+		{"prompt", hooksdk.EventUserPromptSubmit, hooksdk.Allow().ReplaceField("prompt", "be brief"), true},
+		{"prompt not a string", hooksdk.EventUserPromptSubmit, hooksdk.Allow().ReplaceField("prompt", map[string]any{"x": "y"}), false},
+		{"tool input", hooksdk.EventToolCallStarted, hooksdk.Allow().ReplaceField("tool_input.command", "ls"), true},
+		{"tool input deleted", hooksdk.EventToolCallStarted, hooksdk.Allow().ReplaceField("tool_input", nil), false},
+		{"other field", hooksdk.EventToolCallStarted, hooksdk.Allow().ReplaceField("cwd", "/"), false},
+		{"other event", hooksdk.EventToolCallFinished, hooksdk.Allow().ReplaceField("tool_input.command", "ls"), false},
+		{"field of another event", hooksdk.EventApprovalRequested, hooksdk.Allow().ReplaceField("prompt", "x"), false},
+	}
+	for _, tt := range tests {
+		err := tt.resp.CheckModify(tt.event)
+		if tt.ok && err != nil || !tt.ok && !errors.Is(err, hooksdk.ErrModificationNotPermitted) {
+			t.Errorf("%s: CheckModify(%s) = %v", tt.name, tt.event, err)
+		}
+	}
+
+	if got := hooksdk.ModifiableFields(hooksdk.EventToolCallStarted); !reflect.DeepEqual(got, []string{"tool_input"}) {
+		t.Errorf("ModifiableFields(tool-call-started) = %v", got)
+	}
+	if got := hooksdk.ModifiableFields(hooksdk.EventSessionEnd); len(got) != 0 {
+		t.Errorf("ModifiableFields(session-end) = %v", got)
+	}
+	fields := hooksdk.ModifiableFields(hooksdk.EventApprovalRequested)
+	fields[0] = "cwd"
+	if hooksdk.ModifiableFields(hooksdk.EventApprovalRequested)[0] != "command" {
+		t.Error("ModifiableFields returned its own slice")
+	}
+}
+
+func TestRunRejectsForbiddenModify(t *testing.T) {
+	t.Setenv(hooksdk.CapabilitiesEnv, hooksdk.CapabilityModify)
+	handler := func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return hooksdk.Allow().ReplaceField("cwd", "/"), nil
+	}
+	res := hooktest.RunHook(t, handler, hooktest.ToolCallStarted().Bytes())
+	if res.ExitCode != hooksdk.ExitError || res.Stdout != "" || !strings.Contains(res.Stderr, `"stage":"modify"`) {
+		t.Errorf("forbidden modification: exit %d, stdout %q, stderr %s", res.ExitCode, res.Stdout, res.Stderr)
+	}
+
+	handler = func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return hooksdk.Allow().ReplaceField("tool_input.command", "ls -l"), nil
+	}
+	res = hooktest.RunHook(t, handler, hooktest.ToolCallStarted().Bytes())
+	if res.ExitCode != hooksdk.ExitOK || !reflect.DeepEqual(res.Response.Modify, map[string]any{"tool_input": map[string]any{"command": "ls -l"}}) {
+		t.Errorf("permitted modification: exit %d, response %+v", res.ExitCode, res.Response)
+	}
+}
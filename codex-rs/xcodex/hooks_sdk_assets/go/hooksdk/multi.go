@@ -0,0 +1,131 @@
+package hooksdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// Hook is one of the hooks bundled in a binary that Main runs.
+type Hook struct {
+	Handler Handler
+	// Options are passed to Run after Main's own, for this hook only.
+	Options []Option
+}
+
+// ErrUnknownHook is returned by SelectHook when none of the binary's hooks is selected, or
+// CODEX_HOOK_NAME or the first argument names one it doesn't have.
+var ErrUnknownHook = errors.New("unknown hook")
+
+// Main runs one of several hooks bundled in one binary, so they are built and installed once.
+// The hook is the first of:
+//
+//   - the first argument: `hooks guard` runs guard. The argument is removed from os.Args, so a
+//     payload file can still follow it (`hooks guard event.json`).
+//   - the executable's name, without ".exe" and then without a "hook-" prefix, busybox-style: a
+//     symlink `hook-guard` (or `guard`) to the binary runs guard.
+//   - CODEX_HOOK_NAME.
+//
+// The payload is read once, by Run, for the hook selected; opts apply to every hook, before its
+// own Options. Main sets CODEX_HOOK_NAME to the hook's name, so logs are attributed to it and the
+// background copy Detach starts runs the same hook. When no hook is selected, the error (with
+// the names of the binary's hooks) is reported on stderr as Run reports errors, and the process
+// exits with ExitError; `hooks --self-test` with no hook selected runs the self-test of each hook
+// in turn instead (see WithSelfTest), and exits with ExitError if any check failed.
+//
+//	func main() {
+//		hooksdk.Main(map[string]hooksdk.Hook{
+//			"guard": {Handler: guard},
+//			"log":   {Handler: logEvent},
+//		})
+//	}
+func Main(hooks map[string]Hook, opts ...Option) {
+	s := newOptions(opts).stdio
+	env := s.Environ()
+	name, args, err := SelectHook(hooks, os.Args, env)
+	if err != nil && SelfTestRequested() && env.HookName == "" {
+		ctx, stop := SignalContext()
+		code := selfTestHooks(ctx, hooks, opts)
+		stop()
+		os.Exit(code)
+	}
+	if err != nil {
+		writeErrorLine(s.err(), "select_hook", err)
+		os.Exit(ExitError)
+	}
+	os.Args = args
+	os.Setenv(HookNameEnv, name)
+	hooklog.Default().SetHookName(name)
+	h := hooks[name]
+	Run(h.Handler, append(append([]Option(nil), opts...), h.Options...)...)
+}
+
+// selfTestHooks runs the self-test of each of hooks, in the order of their names, as Main would
+// run it for that hook alone, and returns ExitError if any of them failed.
+func selfTestHooks(ctx context.Context, hooks map[string]Hook, opts []Option) int {
+	code := ExitOK
+	for i, name := range sortedHookNames(hooks) {
+		os.Setenv(HookNameEnv, name)
+		hooklog.Default().SetHookName(name)
+		o := newOptions(append(append([]Option(nil), opts...), hooks[name].Options...))
+		out := o.stdio.out()
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		if o.runSelfTest(ctx, out) != ExitOK {
+			code = ExitError
+		}
+	}
+	return code
+}
+
+// SelectHook returns the name of the hook in hooks that args (as in os.Args) and env select, as
+// described at Main, and args without the argument that named it. It fails with ErrUnknownHook.
+func SelectHook(hooks map[string]Hook, args []string, env Env) (name string, rest []string, err error) {
+	if len(args) > 1 {
+		if _, ok := hooks[args[1]]; ok {
+			return args[1], append([]string{args[0]}, args[2:]...), nil
+		}
+	}
+	if len(args) > 0 {
+		base := strings.TrimSuffix(filepath.Base(args[0]), ".exe")
+		for _, name := range []string{base, strings.TrimPrefix(base, "hook-")} {
+			if _, ok := hooks[name]; ok {
+				return name, args, nil
+			}
+		}
+	}
+	if env.HookName != "" {
+		if _, ok := hooks[env.HookName]; ok {
+			return env.HookName, args, nil
+		}
+		return "", args, fmt.Errorf("%w %q (from %s); the hooks are %s", ErrUnknownHook, env.HookName, HookNameEnv, hookNames(hooks))
+	}
+	if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		// Name the argument, unless it is the payload file of a hook run by hand.
+		if _, err := os.Stat(args[1]); err != nil {
+			return "", args, fmt.Errorf("%w %q; the hooks are %s", ErrUnknownHook, args[1], hookNames(hooks))
+		}
+	}
+	return "", args, fmt.Errorf("%w: none selected; pass its name as the first argument, run the binary through a link named after it, or set %s (the hooks are %s)", ErrUnknownHook, HookNameEnv, hookNames(hooks))
+}
+
+// hookNames lists the names of hooks, sorted.
+func hookNames(hooks map[string]Hook) string {
+	return strings.Join(sortedHookNames(hooks), ", ")
+}
+
+func sortedHookNames(hooks map[string]Hook) []string {
+	names := make([]string, 0, len(hooks))
+	for name := range hooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
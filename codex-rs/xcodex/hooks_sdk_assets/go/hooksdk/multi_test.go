@@ -0,0 +1,172 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// multiMain is the binary HOOKSDK_TEST_MAIN runs: hooks alpha and beta, which deny naming
+// themselves, CODEX_HOOK_NAME, and the payload's session. Each has a self-test check, which fails
+// when MULTI_SELF_TEST_FAIL names the hook.
+func multiMain() {
+	deny := func(name string) hooksdk.Hook {
+		return hooksdk.Hook{Handler: func(_ context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			return hooksdk.Deny(name + " " + os.Getenv(hooksdk.HookNameEnv) + " " + p.SessionID()), nil
+		}, Options: []hooksdk.Option{hooksdk.WithSelfTest(func() []hooksdk.Check {
+			return []hooksdk.Check{{Name: name + " is set up", Run: func(_ context.Context, env hooksdk.Env) error {
+				if os.Getenv("MULTI_SELF_TEST_FAIL") == name || env.HookName != name {
+					return errors.New("broken")
+				}
+				return nil
+			}}}
+		})}}
+	}
+	hooksdk.Main(map[string]hooksdk.Hook{"alpha": deny("alpha"), "beta": deny("beta")})
+}
+
+var testHooks = map[string]hooksdk.Hook{"guard": {}, "log": {}, "if": {}}
+
+func TestSelectHook(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		hookName string
+		name     string
+		rest     []string
+	}{
+		{[]string{"/bin/hooks", "guard"}, "", "guard", []string{"/bin/hooks"}},
+		{[]string{"/bin/hooks", "log", "event.json"}, "", "log", []string{"/bin/hooks", "event.json"}},
+		{[]string{"/usr/local/bin/guard"}, "", "guard", []string{"/usr/local/bin/guard"}},
+		{[]string{"/bin/hook-log", "event.json"}, "", "log", []string{"/bin/hook-log", "event.json"}},
+		{[]string{"/opt/hooks/hook-guard.exe"}, "", "guard", []string{"/opt/hooks/hook-guard.exe"}},
+		{[]string{"/bin/hooks"}, "log", "log", []string{"/bin/hooks"}},
+		// The argument wins over the binary's name, which wins over CODEX_HOOK_NAME.
+		{[]string{"/bin/hook-guard", "log"}, "if", "log", []string{"/bin/hook-guard"}},
+		{[]string{"/bin/hook-guard", "event.json"}, "log", "guard", []string{"/bin/hook-guard", "event.json"}},
+	} {
+		name, rest, err := hooksdk.SelectHook(testHooks, tt.args, hooksdk.Env{HookName: tt.hookName})
+		if err != nil || name != tt.name || !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("SelectHook(%q, %q) = %q, %q, %v; want %q, %q", tt.args, tt.hookName, name, rest, err, tt.name, tt.rest)
+		}
+	}
+}
+
+func TestSelectHookUnknown(t *testing.T) {
+	payload := eventFile(t, "s")
+	for _, tt := range []struct {
+		args     []string
+		hookName string
+		want     string
+	}{
+		{[]string{"/bin/hooks", "gaurd"}, "", `unknown hook "gaurd"; the hooks are guard, if, log`},
+		{[]string{"/bin/hooks"}, "notify", `unknown hook "notify" (from CODEX_HOOK_NAME)`},
+		{[]string{"/bin/hooks"}, "", "unknown hook: none selected"},
+		// A payload file or a flag isn't taken for a hook name.
+		{[]string{"/bin/hooks", payload}, "", "unknown hook: none selected"},
+		{[]string{"/bin/hooks", "--verbose"}, "", "unknown hook: none selected"},
+		{nil, "", "unknown hook: none selected"},
+	} {
+		_, _, err := hooksdk.SelectHook(testHooks, tt.args, hooksdk.Env{HookName: tt.hookName})
+		if !errors.Is(err, hooksdk.ErrUnknownHook) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("SelectHook(%q, %q) = %v, want %q", tt.args, tt.hookName, err, tt.want)
+		}
+	}
+}
+
+// runMain runs multiMain as exe with args and env, giving it stdin, and returns its exit code,
+// stdout and stderr.
+func runMain(t *testing.T, exe string, stdin []byte, args []string, env ...string) (int, string, string) {
+	t.Helper()
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), append([]string{"HOOKSDK_TEST_MAIN=1", "CODEX_HOME=" + t.TempDir(), hooksdk.HookNameEnv + "="}, env...)...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return cmd.ProcessState.ExitCode(), stdout.String(), stderr.String()
+}
+
+func TestMainSelects(t *testing.T) {
+	payload := hooktest.SessionStart().WithSessionID("s1").Bytes()
+	link := filepath.Join(t.TempDir(), "hook-beta")
+	if err := os.Symlink(os.Args[0], link); err != nil {
+		if runtime.GOOS != "windows" {
+			t.Fatal(err)
+		}
+		link = ""
+	}
+	for name, tt := range map[string]struct {
+		exe  string
+		args []string
+		env  []string
+	}{
+		"argument":        {os.Args[0], []string{"beta"}, nil},
+		"link":            {link, nil, nil},
+		"CODEX_HOOK_NAME": {os.Args[0], nil, []string{hooksdk.HookNameEnv + "=beta"}},
+	} {
+		if tt.exe == "" {
+			continue
+		}
+		code, stdout, stderr := runMain(t, tt.exe, payload, tt.args, tt.env...)
+		if code != hooksdk.ExitDeny || !strings.Contains(stdout, `"beta beta s1"`) {
+			t.Errorf("%s: exit %d, stdout %q, stderr %s", name, code, stdout, stderr)
+		}
+	}
+
+	// The payload file can follow the hook's name.
+	cmdArgs := []string{"alpha", eventFile(t, "from-file")}
+	if code, stdout, stderr := runMain(t, os.Args[0], nil, cmdArgs); code != hooksdk.ExitDeny || !strings.Contains(stdout, `"alpha alpha from-file"`) {
+		t.Errorf("payload file: exit %d, stdout %q, stderr %s", code, stdout, stderr)
+	}
+
+	code, stdout, stderr := runMain(t, os.Args[0], payload, []string{"gamma"})
+	if code != hooksdk.ExitError || stdout != "" || !strings.Contains(stderr, `unknown hook \"gamma\"; the hooks are alpha, beta`) {
+		t.Errorf("unknown hook: exit %d, stdout %q, stderr %s", code, stdout, stderr)
+	}
+}
+
+func TestMainSelfTest(t *testing.T) {
+	// With no hook selected, --self-test checks them all.
+	code, stdout, stderr := runMain(t, os.Args[0], nil, []string{hooksdk.SelfTestFlag})
+	if code != hooksdk.ExitOK {
+		t.Errorf("exit %d, stderr %s", code, stderr)
+	}
+	alpha, beta := strings.Index(stdout, "self-test of alpha\n"), strings.Index(stdout, "self-test of beta\n")
+	if alpha < 0 || beta < alpha || !strings.Contains(stdout, "PASS  alpha is set up\n") || !strings.Contains(stdout, "PASS  beta is set up\n") {
+		t.Errorf("stdout:\n%s", stdout)
+	}
+
+	// A failing hook fails the run, and the others are still checked.
+	code, stdout, _ = runMain(t, os.Args[0], nil, []string{hooksdk.SelfTestFlag}, "MULTI_SELF_TEST_FAIL=alpha")
+	if code != hooksdk.ExitError || !strings.Contains(stdout, "FAIL  alpha is set up: broken") || !strings.Contains(stdout, "PASS  beta is set up") {
+		t.Errorf("failing alpha: exit %d, stdout:\n%s", code, stdout)
+	}
+
+	// A selected hook checks only itself.
+	for name, tt := range map[string]struct {
+		args []string
+		env  []string
+	}{
+		"argument":        {[]string{"beta", hooksdk.SelfTestFlag}, nil},
+		"CODEX_HOOK_NAME": {[]string{hooksdk.SelfTestFlag}, []string{hooksdk.HookNameEnv + "=beta"}},
+	} {
+		code, stdout, stderr := runMain(t, os.Args[0], nil, tt.args, append(tt.env, "MULTI_SELF_TEST_FAIL=alpha")...)
+		if code != hooksdk.ExitOK || strings.Contains(stdout, "alpha") || !strings.Contains(stdout, "PASS  beta is set up") {
+			t.Errorf("%s: exit %d, stdout:\n%s\nstderr: %s", name, code, stdout, stderr)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package hooksdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// Failure is one of the errors of a MultiError.
+type Failure struct {
+	// Component names what failed: a sink, a middleware, a self-test check.
+	Component string
+	// Err is the failure. Its message should say what failed on its own; Component is the name
+	// for the structured form.
+	Err error
+	// Fatal is whether the failure decided the outcome, e.g. failed the event, rather than being
+	// reported alongside it.
+	Fatal bool
+}
+
+// MultiError is several failures reported as one error, e.g. by the sinks of a sink.Tee, so none
+// of them hides the others. errors.Is and errors.As look through it at every failure, and it
+// encodes to JSON as
+//
+//	{"failures":[{"component":"webhook","error":"sink webhook: 502 Bad Gateway","fatal":false}]}
+//
+// with the failures in the order they were added, so the same failures always encode the same.
+type MultiError struct {
+	Failures []Failure
+}
+
+// Add adds err as a failure of component; a nil err is ignored. The failures of a *MultiError
+// err are added one by one, keeping their components; fatal marks them fatal too.
+func (e *MultiError) Add(component string, err error, fatal bool) {
+	if err == nil {
+		return
+	}
+	if inner, ok := err.(*MultiError); ok {
+		for _, f := range inner.Failures {
+			e.Failures = append(e.Failures, Failure{Component: f.Component, Err: f.Err, Fatal: f.Fatal || fatal})
+		}
+		return
+	}
+	e.Failures = append(e.Failures, Failure{Component: component, Err: err, Fatal: fatal})
+}
+
+// Err returns e, or nil when it has no failures, so a function can return its MultiError as its
+// error either way.
+func (e *MultiError) Err() error {
+	if e == nil || len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Fatal reports whether any failure is fatal.
+func (e *MultiError) Fatal() bool {
+	for _, f := range e.Failures {
+		if f.Fatal {
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns the failures' messages, one for a single failure and otherwise their count
+// followed by them, separated by "; ".
+func (e *MultiError) Error() string {
+	if len(e.Failures) == 1 {
+		return e.Failures[0].Err.Error()
+	}
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.Err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(e.Failures), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the failures' errors, for errors.Is and errors.As.
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// failureJSON is the JSON form of a Failure.
+type failureJSON struct {
+	Component string `json:"component"`
+	Error     string `json:"error"`
+	Fatal     bool   `json:"fatal"`
+}
+
+func (e *MultiError) failures() []failureJSON {
+	out := make([]failureJSON, len(e.Failures))
+	for i, f := range e.Failures {
+		out[i] = failureJSON{Component: f.Component, Error: f.Err.Error(), Fatal: f.Fatal}
+	}
+	return out
+}
+
+// MarshalJSON encodes e as `{"failures":[...]}`, each failure with its component, its error's
+// message, and whether it was fatal.
+func (e *MultiError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Failures []failureJSON `json:"failures"`
+	}{e.failures()})
+}
+
+type failuresKey struct{}
+
+// reported collects the failures ReportError records during one Mux.Handle call.
+type reported struct {
+	mu  sync.Mutex
+	err MultiError
+}
+
+// ReportError records err as a failure of component that didn't stop the event, e.g. a cache a
+// middleware couldn't update, for the Mux whose Handle is running the event. When the handler
+// then fails too, the Mux returns them together as a *MultiError; when it doesn't, it logs them
+// as one warning. Outside Mux.Handle, err is logged as a warning at once.
+func ReportError(ctx context.Context, component string, err error) {
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("%s: %w", component, err)
+	r, ok := ctx.Value(failuresKey{}).(*reported)
+	if !ok {
+		hooklog.Warnf("%v", err)
+		return
+	}
+	r.mu.Lock()
+	r.err.Add(component, err, false)
+	r.mu.Unlock()
+}
+
+// collectFailures runs h with a context for ReportError, and returns its error together with the
+// failures reported, or logs those when h succeeded.
+func collectFailures(ctx context.Context, p *HookPayload, h Handler) (Response, error) {
+	r := &reported{}
+	resp, err := h(context.WithValue(ctx, failuresKey{}, r), p)
+	r.mu.Lock()
+	multi := &MultiError{Failures: append([]Failure(nil), r.err.Failures...)}
+	r.mu.Unlock()
+	if len(multi.Failures) == 0 {
+		return resp, err
+	}
+	if err != nil {
+		multi.Add("handler", err, true)
+		return resp, multi
+	}
+	hooklog.Default().Log(hooklog.LevelWarn, multi.Error(), map[string]any{"failures": multi.failures()})
+	return resp, nil
+}
@@ -0,0 +1,188 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+type codeError struct{ code int }
+
+func (e *codeError) Error() string { return fmt.Sprintf("code %d", e.code) }
+
+// reporting is a mux whose middleware reports a failure of "cache" that doesn't stop the event,
+// and whose session-start handler returns err.
+func reporting(err error) *hooksdk.Mux {
+	mux := hooksdk.NewMux()
+	mux.Use(func(next hooksdk.Handler) hooksdk.Handler {
+		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			hooksdk.ReportError(ctx, "cache", errors.New("disk full"))
+			hooksdk.ReportError(ctx, "ignored", nil)
+			return next(ctx, p)
+		}
+	})
+	hooksdk.Handle(mux, func(context.Context, *hooksdk.SessionStartPayload) (hooksdk.Response, error) {
+		return hooksdk.Allow(), err
+	})
+	return mux
+}
+
+// reportMain is the hook HOOKSDK_TEST_REPORT runs: the reporting mux with a handler that
+// succeeds, so the reported failure is logged as a warning, followed by a failure reported
+// outside any Mux.
+func reportMain() {
+	code := hooksdk.RunIO(context.Background(), os.Stdin, os.Stdout, os.Stderr, reporting(nil).Handle)
+	hooksdk.ReportError(context.Background(), "cleanup", errors.New("stale lock"))
+	os.Exit(code)
+}
+
+func TestMultiError(t *testing.T) {
+	var multi hooksdk.MultiError
+	if multi.Err() != nil || multi.Fatal() {
+		t.Errorf("empty MultiError: Err %v, Fatal %v", multi.Err(), multi.Fatal())
+	}
+	if (*hooksdk.MultiError)(nil).Err() != nil {
+		t.Error("nil MultiError has an Err")
+	}
+
+	multi.Add("only", nil, true)
+	multi.Add("webhook", fmt.Errorf("sink webhook: %w", fs.ErrNotExist), false)
+	if multi.Fatal() || multi.Error() != "sink webhook: file does not exist" {
+		t.Errorf("one failure: Fatal %v, Error %q", multi.Fatal(), multi.Error())
+	}
+
+	// The failures of a MultiError added are added one by one, keeping their components.
+	var inner hooksdk.MultiError
+	inner.Add("decode", &codeError{7}, false)
+	inner.Add("policy", errors.New("no rule"), true)
+	multi.Add("ignored", &inner, false)
+	var fatal hooksdk.MultiError
+	fatal.Add("jsonl", errors.New("sink jsonl: read-only"), false)
+	multi.Add("ignored", &fatal, true)
+
+	var components []string
+	for _, f := range multi.Failures {
+		components = append(components, fmt.Sprintf("%s:%v", f.Component, f.Fatal))
+	}
+	if got := strings.Join(components, " "); got != "webhook:false decode:false policy:true jsonl:true" {
+		t.Errorf("failures = %s", got)
+	}
+	if !multi.Fatal() {
+		t.Error("Fatal = false with fatal failures")
+	}
+	want := "4 errors: sink webhook: file does not exist; code 7; no rule; sink jsonl: read-only"
+	if multi.Error() != want {
+		t.Errorf("Error = %q, want %q", multi.Error(), want)
+	}
+
+	// errors.Is and errors.As see every failure, also through a wrapper.
+	err := fmt.Errorf("writing: %w", multi.Err())
+	var cerr *codeError
+	if !errors.Is(err, fs.ErrNotExist) || !errors.As(err, &cerr) || cerr.code != 7 {
+		t.Errorf("errors.Is/As through %v: %v", err, cerr)
+	}
+	var back *hooksdk.MultiError
+	if !errors.As(err, &back) || back != &multi {
+		t.Errorf("errors.As didn't find the MultiError in %v", err)
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		t.Error("errors.Is matched an error that isn't there")
+	}
+}
+
+func TestMultiErrorJSON(t *testing.T) {
+	build := func() *hooksdk.MultiError {
+		var multi hooksdk.MultiError
+		multi.Add("webhook", errors.New("sink webhook: 502 Bad Gateway"), false)
+		multi.Add("handler", errors.New("no rule"), true)
+		return &multi
+	}
+	want := `{"failures":[{"component":"webhook","error":"sink webhook: 502 Bad Gateway","fatal":false},` +
+		`{"component":"handler","error":"no rule","fatal":true}]}`
+	for i := 0; i < 20; i++ {
+		data, err := json.Marshal(build())
+		if err != nil || string(data) != want {
+			t.Fatalf("Marshal #%d = %s, %v\nwant %s", i, data, err, want)
+		}
+	}
+	// As a field, through the pointer.
+	data, err := json.Marshal(map[string]any{"err": build()})
+	if err != nil || string(data) != `{"err":`+want+`}` {
+		t.Errorf("Marshal as a field = %s, %v", data, err)
+	}
+}
+
+func TestMuxReportError(t *testing.T) {
+	// With the handler failing too, both come back together, the handler's as the fatal one.
+	boom := errors.New("boom")
+	_, err := reporting(boom).Handle(context.Background(), parse(t, hooktest.SessionStart()))
+	var multi *hooksdk.MultiError
+	if !errors.As(err, &multi) || len(multi.Failures) != 2 || !errors.Is(err, boom) {
+		t.Fatalf("Handle = %v, want the reported failure and the handler's", err)
+	}
+	if f := multi.Failures[0]; f.Component != "cache" || f.Fatal || f.Err.Error() != "cache: disk full" {
+		t.Errorf("reported failure = %+v", f)
+	}
+	if f := multi.Failures[1]; f.Component != "handler" || !f.Fatal || f.Err != boom {
+		t.Errorf("handler failure = %+v", f)
+	}
+
+	// Run's stderr line lists them.
+	res := hooktest.RunHook(t, reporting(boom).Handle, hooktest.SessionStart().Bytes())
+	line := errorLine(t, res.Stderr)
+	failures, _ := line["failures"].([]any)
+	if line["stage"] != "handler" || line["error"] != "2 errors: cache: disk full; boom" || len(failures) != 2 {
+		t.Fatalf("stderr line = %v", line)
+	}
+	if f := failures[1].(map[string]any); f["component"] != "handler" || f["error"] != "boom" || f["fatal"] != true {
+		t.Errorf("handler failure = %v", f)
+	}
+
+	// A plain error has no "failures".
+	res = hooktest.RunHook(t, respond(hooksdk.Response{}, boom), hooktest.SessionStart().Bytes())
+	if line := errorLine(t, res.Stderr); line["failures"] != nil {
+		t.Errorf("stderr line = %v", line)
+	}
+}
+
+func TestReportErrorLogged(t *testing.T) {
+	// When the handler succeeds, the reported failures are one warning, and the event goes on;
+	// outside a Mux, a failure is a warning at once.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "HOOKSDK_TEST_REPORT=1", "CODEX_HOOK_LOG_FORMAT=json", "CODEX_HOME="+t.TempDir())
+	cmd.Stdin = bytes.NewReader(hooktest.SessionStart().Bytes())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil || !strings.Contains(string(out), `"allow"`) {
+		t.Fatalf("hook: %v, %s\n%s", err, out, stderr.String())
+	}
+	var warnings []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("stderr line %q: %v", line, err)
+		}
+		warnings = append(warnings, rec)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("stderr has %d lines, want 2:\n%s", len(warnings), stderr.String())
+	}
+	failures, _ := warnings[0]["failures"].([]any)
+	if warnings[0]["level"] != "warn" || warnings[0]["msg"] != "cache: disk full" || len(failures) != 1 {
+		t.Errorf("warning = %v", warnings[0])
+	}
+	if warnings[1]["level"] != "warn" || warnings[1]["msg"] != "cleanup: stale lock" {
+		t.Errorf("warning outside a Mux = %v", warnings[1])
+	}
+}
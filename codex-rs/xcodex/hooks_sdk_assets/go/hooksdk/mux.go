@@ -0,0 +1,221 @@
+package hooksdk
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Mux routes a payload to a handler based on its `xcodex_event_type`.
+//
+// Routing precedence is: the handler registered for the exact event type, then the OnAny
+// catch-all, then Default (Allow unless changed). Middleware added with Use wraps all of them.
+// The package-level Handle registers a handler that takes the event's typed payload instead of a
+// *HookPayload.
+//
+//	mux := hooksdk.NewMux()
+//	mux.Use(hooksdk.LogRequests(), hooksdk.Recover(hooksdk.Allow()))
+//	mux.OnToolCallFinished(func(p *hooksdk.HookPayload) hooksdk.Response { ... })
+//	mux.OnSessionEnd(func(p *hooksdk.HookPayload) hooksdk.Response { ... })
+//	hooksdk.Run(mux.Handle)
+type Mux struct {
+	handlers   map[EventType]func(p *HookPayload) Response
+	typed      map[EventType]Handler
+	anyHandler func(p *HookPayload) Response
+	middleware []Middleware
+
+	// Default is returned for events with no matching handler and no OnAny handler.
+	Default Response
+}
+
+// NewMux returns an empty Mux whose default response is Allow.
+func NewMux() *Mux {
+	return &Mux{
+		handlers: make(map[EventType]func(p *HookPayload) Response),
+		Default:  Allow(),
+	}
+}
+
+// On registers h for the given `xcodex_event_type` (e.g. EventToolCallFinished, or the literal
+// "tool-call-finished"), replacing any previously registered handler for that type.
+func (m *Mux) On(eventType EventType, h func(p *HookPayload) Response) {
+	if m.handlers == nil {
+		m.handlers = make(map[EventType]func(p *HookPayload) Response)
+	}
+	m.handlers[eventType] = h
+	delete(m.typed, eventType)
+}
+
+// TypedPayload is the constraint of Handle: a pointer to a payload struct whose Type method
+// returns its event type without reading the payload, as the generated payload structs (such as
+// *ToolCallStartedPayload) do. A hook can declare its own for event types this SDK has no
+// struct for.
+type TypedPayload[T any] interface {
+	*T
+	Event
+}
+
+// Handle registers h for the event type of its payload type P, so it gets the payload decoded
+// into the struct instead of a *HookPayload:
+//
+//	hooksdk.Handle(mux, func(ctx context.Context, p *hooksdk.ToolCallStartedPayload) (hooksdk.Response, error) {
+//		...
+//	})
+//
+// The generated structs are decoded as by HookPayload.Event; other structs are decoded from the
+// raw payload, and their RawPayload field, if they have a map[string]any one, is set to it.
+// Handle panics if the event type has a handler already, from Handle or On, or if P's Type returns
+// "". A payload that doesn't decode into P fails with the decoding error and isn't passed to h.
+func Handle[T any, P TypedPayload[T]](m *Mux, h func(ctx context.Context, p P) (Response, error)) {
+	eventType := P(new(T)).Type()
+	if eventType == "" {
+		panic(fmt.Sprintf("hooksdk: Handle: %T has no event type", P(nil)))
+	}
+	if _, ok := m.typed[eventType]; ok || m.handlers[eventType] != nil {
+		panic(fmt.Sprintf("hooksdk: Handle: multiple handlers for event type %q", eventType))
+	}
+	if m.typed == nil {
+		m.typed = make(map[EventType]Handler)
+	}
+	m.typed[eventType] = func(ctx context.Context, p *HookPayload) (Response, error) {
+		t, err := decodeTyped[T, P](p)
+		if err != nil {
+			return Response{}, fmt.Errorf("decode %s payload: %w", eventType, err)
+		}
+		return h(ctx, t)
+	}
+}
+
+// decodeTyped decodes p into a new P.
+func decodeTyped[T any, P TypedPayload[T]](p *HookPayload) (P, error) {
+	ev, err := p.Event()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := ev.(P); ok {
+		return t, nil
+	}
+	t := P(new(T))
+	if err := decodeRaw(p.RawPayload, t); err != nil {
+		return nil, err
+	}
+	if v := reflect.ValueOf(t).Elem(); v.Kind() == reflect.Struct {
+		if f := v.FieldByName("RawPayload"); f.CanSet() && f.Type() == reflect.TypeOf(p.RawPayload) {
+			f.Set(reflect.ValueOf(p.RawPayload))
+		}
+	}
+	return t, nil
+}
+
+// OnAny registers a catch-all handler for events without a type-specific handler.
+func (m *Mux) OnAny(h func(p *HookPayload) Response) {
+	m.anyHandler = h
+}
+
+func (m *Mux) OnAgentTurnComplete(h func(p *HookPayload) Response) {
+	m.On(EventAgentTurnComplete, h)
+}
+
+func (m *Mux) OnApprovalRequested(h func(p *HookPayload) Response) {
+	m.On(EventApprovalRequested, h)
+}
+
+func (m *Mux) OnSessionStart(h func(p *HookPayload) Response) {
+	m.On(EventSessionStart, h)
+}
+
+func (m *Mux) OnSessionEnd(h func(p *HookPayload) Response) {
+	m.On(EventSessionEnd, h)
+}
+
+func (m *Mux) OnUserPromptSubmit(h func(p *HookPayload) Response) {
+	m.On(EventUserPromptSubmit, h)
+}
+
+func (m *Mux) OnPreCompact(h func(p *HookPayload) Response) {
+	m.On(EventPreCompact, h)
+}
+
+func (m *Mux) OnNotification(h func(p *HookPayload) Response) {
+	m.On(EventNotification, h)
+}
+
+func (m *Mux) OnSubagentStop(h func(p *HookPayload) Response) {
+	m.On(EventSubagentStop, h)
+}
+
+func (m *Mux) OnModelRequestStarted(h func(p *HookPayload) Response) {
+	m.On(EventModelRequestStarted, h)
+}
+
+func (m *Mux) OnModelResponseCompleted(h func(p *HookPayload) Response) {
+	m.On(EventModelResponseCompleted, h)
+}
+
+func (m *Mux) OnToolCallStarted(h func(p *HookPayload) Response) {
+	m.On(EventToolCallStarted, h)
+}
+
+func (m *Mux) OnToolCallFinished(h func(p *HookPayload) Response) {
+	m.On(EventToolCallFinished, h)
+}
+
+// Dispatch routes p to the matching handler and returns its response. Handlers registered with
+// Handle run with context.Background(), and their errors are dropped; use DispatchContext to get
+// them.
+func (m *Mux) Dispatch(p *HookPayload) Response {
+	resp, _ := m.DispatchContext(context.Background(), p)
+	return resp
+}
+
+// DispatchContext is like Dispatch, but passes ctx to handlers registered with Handle and returns
+// their errors. It doesn't run the middleware added with Use; Handle does.
+func (m *Mux) DispatchContext(ctx context.Context, p *HookPayload) (Response, error) {
+	if h, ok := m.typed[p.Type()]; ok {
+		return h(ctx, p)
+	}
+	if h, ok := m.handlers[p.Type()]; ok && h != nil {
+		return h(p), nil
+	}
+	if m.anyHandler != nil {
+		return m.anyHandler(p), nil
+	}
+	if m.Default.Decision == "" {
+		return Allow(), nil
+	}
+	return m.Default, nil
+}
+
+// Handle adapts Dispatch to the Handler signature used by Run, running it through the middleware
+// added with Use. Failures reported with ReportError along the way are returned with the
+// handler's error as a *MultiError, or logged as a warning when there is none.
+func (m *Mux) Handle(ctx context.Context, p *HookPayload) (Response, error) {
+	return collectFailures(ctx, p, Chain(m.handle, m.middleware...))
+}
+
+func (m *Mux) handle(ctx context.Context, p *HookPayload) (Response, error) {
+	return m.DispatchContext(ctx, p)
+}
+
+// Run runs m as the hook, as Run(m.Handle, opts...) does, with SkipUnhandled.
+func (m *Mux) Run(opts ...Option) {
+	Run(m.Handle, append(opts[:len(opts):len(opts)], m.SkipUnhandled())...)
+}
+
+// SkipUnhandled makes Run answer the events m has no handler for with m.Default, from their type
+// alone (see PeekEventType), without decoding their payloads. It only does so while m has no
+// OnAny handler and no middleware, which see every event; handlers added later are taken into
+// account.
+func (m *Mux) SkipUnhandled() Option {
+	return func(o *options) {
+		o.skips = append(o.skips, func(t EventType) (Response, bool) {
+			if m.anyHandler != nil || len(m.middleware) > 0 || m.typed[t] != nil || m.handlers[t] != nil {
+				return Response{}, false
+			}
+			if m.Default.Decision == "" {
+				return Allow(), true
+			}
+			return m.Default, true
+		})
+	}
+}
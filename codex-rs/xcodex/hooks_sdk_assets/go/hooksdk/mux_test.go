@@ -0,0 +1,171 @@
+package hooksdk_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func parse(t *testing.T, b *hooktest.Builder) *hooksdk.HookPayload {
+	t.Helper()
+	p, err := hooksdk.ParseHookPayload(b.Bytes())
+	if err != nil {
+		t.Fatalf("ParseHookPayload: %v", err)
+	}
+	return p
+}
+
+// reply is a mux handler that answers with a deny naming it, so tests can tell which one ran.
+func reply(name string) func(*hooksdk.HookPayload) hooksdk.Response {
+	return func(*hooksdk.HookPayload) hooksdk.Response { return hooksdk.Deny(name) }
+}
+
+func TestMuxRoutingPrecedence(t *testing.T) {
+	mux := hooksdk.NewMux()
+	mux.OnToolCallStarted(reply("started"))
+	mux.OnAny(reply("any"))
+
+	if got := mux.Dispatch(parse(t, hooktest.ToolCallStarted())).Reason; got != "started" {
+		t.Errorf("tool-call-started went to %q, want the type's handler", got)
+	}
+	if got := mux.Dispatch(parse(t, hooktest.SessionEnd())).Reason; got != "any" {
+		t.Errorf("session-end went to %q, want OnAny", got)
+	}
+
+	// Registering a type again replaces its handler.
+	mux.On(hooksdk.EventToolCallStarted, reply("again"))
+	if got := mux.Dispatch(parse(t, hooktest.ToolCallStarted())).Reason; got != "again" {
+		t.Errorf("tool-call-started went to %q, want the newer handler", got)
+	}
+}
+
+func TestMuxDefault(t *testing.T) {
+	mux := hooksdk.NewMux()
+	mux.OnSessionStart(reply("start"))
+	if got := mux.Dispatch(parse(t, hooktest.SessionEnd())); got.Decision != hooksdk.DecisionAllow {
+		t.Errorf("unhandled event = %+v, want allow", got)
+	}
+
+	mux.Default = hooksdk.Deny("unhandled")
+	if got := mux.Dispatch(parse(t, hooktest.SessionEnd())); got.Reason != "unhandled" {
+		t.Errorf("unhandled event = %+v, want the default", got)
+	}
+
+	// The zero Mux allows too.
+	var zero hooksdk.Mux
+	if got := zero.Dispatch(parse(t, hooktest.SessionEnd())); got.Decision != hooksdk.DecisionAllow {
+		t.Errorf("zero Mux = %+v, want allow", got)
+	}
+}
+
+func TestMuxHandleTyped(t *testing.T) {
+	mux := hooksdk.NewMux()
+	mux.OnAny(reply("any"))
+	hooksdk.Handle(mux, func(_ context.Context, p *hooksdk.ToolCallStartedPayload) (hooksdk.Response, error) {
+		return hooksdk.Deny("typed " + p.Type().String()), nil
+	})
+	res := hooktest.RunHook(t, mux.Handle, hooktest.ToolCallStarted().Bytes())
+	if res.Response.Reason != "typed tool-call-started" {
+		t.Errorf("response = %+v, want the typed handler's", res.Response)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering the type twice didn't panic")
+		}
+	}()
+	hooksdk.Handle(mux, func(context.Context, *hooksdk.ToolCallStartedPayload) (hooksdk.Response, error) {
+		return hooksdk.Allow(), nil
+	})
+}
+
+func TestMuxSkipUnhandled(t *testing.T) {
+	mux := hooksdk.NewMux()
+	mux.OnSessionStart(reply("start"))
+	mux.Default = hooksdk.Deny("skipped")
+	// Not even decoded: the payload's session id is of the wrong type.
+	res := hooktest.RunHook(t, mux.Handle, hooktest.SessionEnd().With("session_id", 7).Bytes(), mux.SkipUnhandled())
+	if res.Response.Reason != "skipped" {
+		t.Errorf("response = %+v, want the default; stderr: %s", res.Response, res.Stderr)
+	}
+}
+
+// deployPayload is the payload of an event type the SDK has no struct for, as a hook would declare
+// it.
+type deployPayload struct {
+	Target     string         `json:"target"`
+	Replicas   int            `json:"replicas"`
+	RawPayload map[string]any `json:"-"`
+}
+
+func (*deployPayload) Type() hooksdk.EventType { return "deploy-requested" }
+
+func (p *deployPayload) Raw() map[string]any { return p.RawPayload }
+
+func TestMuxHandleCustomPayload(t *testing.T) {
+	mux := hooksdk.NewMux()
+	mux.OnAny(reply("any"))
+	var got *deployPayload
+	hooksdk.Handle(mux, func(_ context.Context, p *deployPayload) (hooksdk.Response, error) {
+		got = p
+		return hooksdk.Deny("deploy to " + p.Target), nil
+	})
+	b := hooktest.New("deploy-requested", "DeployRequested").With("target", "prod").With("replicas", 3)
+	if resp := mux.Dispatch(parse(t, b)); resp.Reason != "deploy to prod" {
+		t.Fatalf("deploy-requested went to %q, want the typed handler", resp.Reason)
+	}
+	if got.Replicas != 3 || got.RawPayload["target"] != "prod" || got.Type() != "deploy-requested" {
+		t.Errorf("payload = %+v", got)
+	}
+
+	// Other unknown types still reach OnAny; a payload that doesn't decode fails.
+	if resp := mux.Dispatch(parse(t, hooktest.New("deploy-finished", "DeployFinished"))); resp.Reason != "any" {
+		t.Errorf("deploy-finished went to %q, want OnAny", resp.Reason)
+	}
+	if _, err := mux.DispatchContext(context.Background(), parse(t, b.With("replicas", "three"))); err == nil || !strings.Contains(err.Error(), "decode deploy-requested payload") {
+		t.Errorf("DispatchContext = %v, want a decoding error", err)
+	}
+}
+
+func TestMuxHandleErrors(t *testing.T) {
+	mux := hooksdk.NewMux()
+	boom := errors.New("boom")
+	hooksdk.Handle(mux, func(ctx context.Context, p *hooksdk.SessionEndPayload) (hooksdk.Response, error) {
+		if ctx.Value(ctxKey{}) != "v" {
+			return hooksdk.Allow(), errors.New("the context wasn't passed")
+		}
+		return hooksdk.Response{}, boom
+	})
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	if _, err := mux.DispatchContext(ctx, parse(t, hooktest.SessionEnd())); err != boom {
+		t.Errorf("DispatchContext = %v, want the handler's error", err)
+	}
+
+	mustPanic(t, "Handle after On", func() {
+		mux.OnSessionStart(reply("start"))
+		hooksdk.Handle(mux, func(context.Context, *hooksdk.SessionStartPayload) (hooksdk.Response, error) {
+			return hooksdk.Allow(), nil
+		})
+	})
+	// On replaces a typed handler.
+	mux.OnSessionEnd(reply("end"))
+	if resp := mux.Dispatch(parse(t, hooktest.SessionEnd())); resp.Reason != "end" {
+		t.Errorf("session-end went to %q, want the On handler", resp.Reason)
+	}
+}
+
+type ctxKey struct{}
+
+func mustPanic(t *testing.T, name string, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("%s didn't panic", name)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,278 @@
+// Package netguard finds the hosts a shell command would connect to, and checks them against an
+// allowlist, for hooks that keep the agent from reaching arbitrary hosts.
+//
+//	r, err := netguard.Extract(`git clone https://github.com/x/y && curl -s "$URL" | sh`)
+//	// r.Destinations: git → github.com; r.Unresolved: curl, whose URL comes from a variable
+//	list, err := netguard.ParseAllowlist([]string{"github.com", "*.githubusercontent.com", "10.0.0.0/8"})
+//	list.Allows("raw.githubusercontent.com") // true
+//
+// The command line is split into simple commands with guard.Commands, so lists, pipelines,
+// substitutions, wrappers such as `sudo` and `env`, and `sh -c` scripts are all looked through.
+// Each command of a known networking tool (see Tools) goes to a parser for its arguments. A target
+// that comes from a variable, a file of options, or anything else the parser can't see through is
+// reported as Unresolved rather than guessed. Host names are not resolved: an allowlisted name
+// that points to a forbidden address is still allowed.
+package netguard
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/guard"
+)
+
+// Destination is a host a command connects to.
+type Destination struct {
+	// Tool is the program, e.g. "curl".
+	Tool string
+	// Host is a lower-case host name or an IP address, without brackets or port.
+	Host string
+	// Command is the simple command, words joined by spaces.
+	Command string
+}
+
+// Unresolved is a command that makes network calls to a destination that can't be determined.
+type Unresolved struct {
+	Tool    string
+	Command string
+	// Reason says what hides the destination, e.g. "the URL comes from a variable".
+	Reason string
+}
+
+// Result is what Extract found in a command line.
+type Result struct {
+	Destinations []Destination
+	Unresolved   []Unresolved
+}
+
+// Extractor finds destinations; its zero value is ready to use.
+type Extractor struct {
+	// GitRemote returns the URL of the named git remote (`origin`), for `git push` and `git fetch`
+	// given a remote name. When nil, or when it returns "", such commands are Unresolved.
+	GitRemote func(name string) string
+}
+
+// Extract is Extractor.Extract with the zero Extractor.
+func Extract(line string) (Result, error) {
+	var e Extractor
+	return e.Extract(line)
+}
+
+// Extract finds the destinations of a shell command line. It fails, wrapping
+// guard.ErrUnparsable, when the line can't be parsed.
+func (e *Extractor) Extract(line string) (Result, error) {
+	cmds, err := guard.Commands(line)
+	if err != nil {
+		return Result{}, err
+	}
+	return e.extract(cmds), nil
+}
+
+// ExtractArgv finds the destinations of a command given as an argument vector.
+func (e *Extractor) ExtractArgv(argv []string) (Result, error) {
+	cmds, err := guard.CommandsArgv(argv)
+	if err != nil {
+		return Result{}, err
+	}
+	return e.extract(cmds), nil
+}
+
+func (e *Extractor) extract(cmds []guard.Command) Result {
+	var r Result
+	for _, c := range cmds {
+		tool, args := c.Args[0], c.Args[1:]
+		if strings.HasPrefix(tool, "python") && len(args) >= 2 && args[0] == "-m" {
+			// `python3 -m pip install ...`
+			tool, args = args[1], args[2:]
+		}
+		parse, ok := parsers[tool]
+		if !ok {
+			continue
+		}
+		text := strings.Join(c.Args, " ")
+		targets, reason := parse(e, &call{args: args, env: c.Env})
+		if reason != "" {
+			r.Unresolved = append(r.Unresolved, Unresolved{Tool: tool, Command: text, Reason: reason})
+		}
+		seen := map[string]bool{}
+		for _, t := range targets {
+			host, why := hostOf(t.addr, t.kind)
+			switch {
+			case why != "":
+				r.Unresolved = append(r.Unresolved, Unresolved{Tool: tool, Command: text, Reason: why})
+			case host != "" && !seen[host]:
+				seen[host] = true
+				r.Destinations = append(r.Destinations, Destination{Tool: tool, Host: host, Command: text})
+			}
+		}
+	}
+	return r
+}
+
+// addrKind tells hostOf how to read an address without a scheme.
+type addrKind int
+
+const (
+	// kindURL is a URL; without a scheme, `host[:port][/path]` as curl and wget read it.
+	kindURL addrKind = iota
+	// kindRemote is an ssh-style remote: `[user@]host:path`, or a URL.
+	kindRemote
+	// kindHost is a bare `[user@]host`, as ssh and nc take it.
+	kindHost
+)
+
+type target struct {
+	addr string
+	kind addrKind
+}
+
+// hostOf returns the host in addr, or "" for a local one (a file:// URL, a path). why is set
+// when the host can't be told.
+func hostOf(addr string, kind addrKind) (host, why string) {
+	if strings.ContainsAny(addr, "$`") {
+		return "", fmt.Sprintf("%q comes from a variable or substitution", addr)
+	}
+	switch {
+	case strings.Contains(addr, "://"):
+		scheme, _, _ := strings.Cut(addr, "://")
+		if strings.EqualFold(strings.TrimPrefix(scheme, "git+"), "file") {
+			return "", ""
+		}
+		u, err := url.Parse(addr)
+		if err != nil {
+			return "", fmt.Sprintf("can't parse URL %q", addr)
+		}
+		host = u.Hostname()
+	case kind == kindRemote:
+		h, ok := remoteHost(addr)
+		if !ok {
+			return "", ""
+		}
+		host = h
+	case kind == kindHost:
+		host = addr
+		if _, h, ok := strings.Cut(host, "@"); ok {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	default:
+		u, err := url.Parse("//" + addr)
+		if err != nil {
+			return "", fmt.Sprintf("can't parse URL %q", addr)
+		}
+		host = u.Hostname()
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", fmt.Sprintf("no host in %q", addr)
+	}
+	if !validHost(host) {
+		return "", fmt.Sprintf("can't tell the host of %q", addr)
+	}
+	return host, ""
+}
+
+// remoteHost returns the host of an scp-style `[user@]host:path`; ok is false for a local path.
+func remoteHost(addr string) (string, bool) {
+	colon := strings.IndexByte(addr, ':')
+	if colon <= 0 || strings.ContainsRune(addr[:colon], '/') {
+		return "", false
+	}
+	host := addr[:colon]
+	if strings.HasPrefix(host, "[") {
+		// `[::1]:path` or `user@[::1]:path`: take the bracketed address whole.
+		if end := strings.IndexByte(addr, ']'); end > 0 {
+			return addr[1:end], true
+		}
+	}
+	if _, h, ok := strings.Cut(host, "@"); ok {
+		host = h
+	}
+	if len(host) == 1 && colon == 1 {
+		// A Windows drive letter, `C:\src`.
+		return "", false
+	}
+	return host, true
+}
+
+// validHost reports whether host is a plain host name or IP address, not a pattern such as curl's
+// `{a,b}.example.com` globs.
+func validHost(host string) bool {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return true
+	}
+	for _, r := range host {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Allowlist is a set of permitted destinations.
+type Allowlist struct {
+	exact    map[string]bool
+	suffixes []string
+	prefixes []netip.Prefix
+}
+
+// ParseAllowlist parses allowlist entries: an exact host name (`github.com`), a wildcard for its
+// subdomains at any depth (`*.github.com`, which doesn't include github.com itself), an IP address,
+// or a CIDR range (`10.0.0.0/8`, `fd00::/8`) that raw IP addresses are matched against.
+func ParseAllowlist(entries []string) (*Allowlist, error) {
+	l := &Allowlist{exact: map[string]bool{}}
+	for _, entry := range entries {
+		e := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(entry)), ".")
+		switch {
+		case e == "":
+			continue
+		case strings.Contains(e, "/"):
+			p, err := netip.ParsePrefix(e)
+			if err != nil {
+				return nil, fmt.Errorf("allowlist entry %q: %v", entry, err)
+			}
+			l.prefixes = append(l.prefixes, p.Masked())
+		case strings.HasPrefix(e, "*."):
+			if !validHost(e[2:]) || strings.Contains(e[2:], "*") {
+				return nil, fmt.Errorf("allowlist entry %q: only a leading `*.` wildcard is supported", entry)
+			}
+			l.suffixes = append(l.suffixes, e[1:])
+		default:
+			e = strings.TrimSuffix(strings.TrimPrefix(e, "["), "]")
+			if addr, err := netip.ParseAddr(e); err == nil {
+				l.prefixes = append(l.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+				continue
+			}
+			if !validHost(e) {
+				return nil, fmt.Errorf("allowlist entry %q is not a host name, IP address, or CIDR range", entry)
+			}
+			l.exact[e] = true
+		}
+	}
+	return l, nil
+}
+
+// Allows reports whether host, as in a Destination, is on the list.
+func (l *Allowlist) Allows(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addr = addr.Unmap().WithZone("")
+		for _, p := range l.prefixes {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	if l.exact[host] {
+		return true
+	}
+	for _, s := range l.suffixes {
+		if strings.HasSuffix(host, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,561 @@
+package netguard
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// parser returns the addresses a command of one tool connects to. reason is set when some of
+// them can't be determined.
+type parser func(e *Extractor, c *call) (targets []target, reason string)
+
+// parsers are the known tools. `python -m pip` is handled as pip.
+var parsers = map[string]parser{
+	"curl":   curl,
+	"wget":   wget,
+	"git":    git,
+	"pip":    pip,
+	"pip3":   pip,
+	"npm":    npm("registry.npmjs.org", npmCommand),
+	"pnpm":   npm("registry.npmjs.org", npmCommand),
+	"npx":    npm("registry.npmjs.org", npmAlways),
+	"yarn":   npm("registry.yarnpkg.com", npmBare),
+	"ssh":    ssh,
+	"scp":    remotes(flagSpec{short: "cFiJloPSX"}),
+	"sftp":   sftp,
+	"rsync":  remotes(rsyncFlags),
+	"nc":     netcat,
+	"ncat":   netcat,
+	"netcat": netcat,
+	"telnet": hostArg(flagSpec{short: "lnbe"}),
+	"ftp":    hostArg(flagSpec{}),
+}
+
+// Tools returns the names of the programs whose destinations Extract determines, sorted.
+func Tools() []string {
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// call is one command of a tool: its arguments after the program, and the variables set for it.
+type call struct {
+	args []string
+	env  []string
+}
+
+// getenv returns the value of the variable assigned for the command, the last one winning. Names
+// are matched case-insensitively, as tools such as npm and curl read both cases.
+func (c *call) getenv(name string) (string, bool) {
+	value, found := "", false
+	for _, kv := range c.env {
+		if k, v, _ := strings.Cut(kv, "="); strings.EqualFold(k, name) {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
+
+// proxies returns the proxies set for the command with the usual variables, which most tools use.
+func (c *call) proxies() []target {
+	var out []target
+	for _, name := range []string{"http_proxy", "https_proxy", "all_proxy"} {
+		if v, ok := c.getenv(name); ok && v != "" {
+			out = append(out, target{v, kindURL})
+		}
+	}
+	return out
+}
+
+// flagSpec says which of a tool's flags take a value: short ones by letter, long ones by name
+// (without dashes). Flags not listed are taken to have none; values given as `--name=value`
+// are recognized either way.
+type flagSpec struct {
+	short string
+	long  []string
+}
+
+func (s flagSpec) longValued(name string) bool {
+	for _, l := range s.long {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+// scan walks args, calling flag (if not nil) for each flag with its name and value (empty for
+// flags without one), and returns the other arguments. With stop set, it returns at the first
+// of them, with everything from there on.
+func (s flagSpec) scan(args []string, stop bool, flag func(name, value string)) []string {
+	if flag == nil {
+		flag = func(string, string) {}
+	}
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			return append(positional, args[i+1:]...)
+		case strings.HasPrefix(a, "--"):
+			name, value, inline := strings.Cut(a[2:], "=")
+			if !inline && s.longValued(name) && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			flag(name, value)
+		case strings.HasPrefix(a, "-") && len(a) > 1:
+			for j := 1; j < len(a); j++ {
+				letter := a[j : j+1]
+				if !strings.Contains(s.short, letter) {
+					flag(letter, "")
+					continue
+				}
+				value := a[j+1:]
+				if value == "" && i+1 < len(args) {
+					i++
+					value = args[i]
+				}
+				flag(letter, value)
+				break
+			}
+		default:
+			if stop {
+				return append(positional, args[i:]...)
+			}
+			positional = append(positional, a)
+		}
+	}
+	return positional
+}
+
+var curlFlags = flagSpec{
+	short: "AbcCdDeEFHKmoPQrtTuUwxXYyz",
+	long: []string{
+		"abstract-unix-socket", "aws-sigv4", "cacert", "capath", "cert", "cert-type", "ciphers",
+		"config", "connect-timeout", "connect-to", "continue-at", "cookie", "cookie-jar", "data",
+		"data-ascii", "data-binary", "data-raw", "data-urlencode", "dns-servers", "dump-header",
+		"expect100-timeout", "form", "form-string", "ftp-port", "header", "interface", "json",
+		"keepalive-time", "key", "key-type", "limit-rate", "local-port", "mail-from", "mail-rcpt",
+		"max-filesize", "max-redirs", "max-time", "netrc-file", "noproxy", "oauth2-bearer",
+		"output", "output-dir", "pass", "pinnedpubkey", "preproxy", "proto", "proto-redir", "proxy",
+		"proxy-user", "quote", "range", "referer", "request", "resolve", "retry", "retry-delay",
+		"retry-max-time", "socks4", "socks4a", "socks5", "socks5-hostname", "speed-limit",
+		"speed-time", "stderr", "telnet-option", "time-cond", "trace", "trace-ascii",
+		"unix-socket", "upload-file", "url", "user", "user-agent", "variable", "write-out",
+	},
+}
+
+func curl(_ *Extractor, c *call) ([]target, string) {
+	targets := c.proxies()
+	reason := ""
+	positional := curlFlags.scan(c.args, false, func(name, value string) {
+		switch name {
+		case "url":
+			targets = append(targets, target{value, kindURL})
+		case "x", "proxy", "preproxy", "socks4", "socks4a", "socks5", "socks5-hostname":
+			targets = append(targets, target{value, kindURL})
+		case "K", "config":
+			reason = "curl reads options from a config file"
+		case "connect-to", "resolve":
+			reason = "curl --" + name + " redirects connections"
+		}
+	})
+	for _, p := range positional {
+		targets = append(targets, target{p, kindURL})
+	}
+	return targets, reason
+}
+
+var wgetFlags = flagSpec{
+	short: "ABDIOPQRTUXaeilotw",
+	long: []string{
+		"accept", "accept-regex", "append-output", "base", "bind-address", "body-data",
+		"body-file", "ca-certificate", "certificate", "config", "connect-timeout", "default-page",
+		"directory-prefix", "dns-timeout", "domains", "exclude-directories", "exclude-domains",
+		"execute", "header", "http-password", "http-user", "include-directories", "input-file",
+		"level", "limit-rate", "load-cookies", "method", "output-document", "output-file",
+		"password", "post-data", "post-file", "private-key", "progress", "quota", "read-timeout",
+		"referer", "reject", "reject-regex", "restrict-file-names", "save-cookies", "timeout",
+		"tries", "user", "user-agent", "wait", "waitretry",
+	},
+}
+
+func wget(_ *Extractor, c *call) ([]target, string) {
+	targets := c.proxies()
+	reason := ""
+	positional := wgetFlags.scan(c.args, false, func(name, value string) {
+		switch name {
+		case "i", "input-file":
+			reason = "wget reads its URLs from a file"
+		case "config":
+			reason = "wget reads options from a config file"
+		case "e", "execute":
+			// `-e https_proxy=host:port`
+			if k, v, ok := strings.Cut(value, "="); ok && strings.HasSuffix(strings.ToLower(k), "_proxy") {
+				targets = append(targets, target{v, kindURL})
+			}
+		}
+	})
+	for _, p := range positional {
+		targets = append(targets, target{p, kindURL})
+	}
+	return targets, reason
+}
+
+var (
+	gitGlobalFlags = flagSpec{short: "Cc", long: []string{"git-dir", "work-tree", "namespace", "config-env"}}
+	gitCloneFlags  = flagSpec{short: "objuc", long: []string{
+		"origin", "branch", "depth", "reference", "reference-if-able", "separate-git-dir",
+		"template", "config", "jobs", "filter", "upload-pack", "shallow-since", "shallow-exclude",
+		"server-option", "bundle-uri", "ref-format",
+	}}
+	gitFetchFlags = flagSpec{short: "josX", long: []string{
+		"depth", "deepen", "shallow-since", "shallow-exclude", "jobs", "upload-pack", "refmap",
+		"server-option", "negotiation-tip", "recurse-submodules-default", "strategy",
+		"strategy-option", "filter", "receive-pack", "exec", "push-option", "repo",
+	}}
+	gitRemoteFlags    = flagSpec{short: "tm"}
+	gitSubmoduleFlags = flagSpec{short: "b", long: []string{"branch", "name", "reference", "depth"}}
+)
+
+func git(e *Extractor, c *call) ([]target, string) {
+	rest := gitGlobalFlags.scan(c.args, true, nil)
+	if len(rest) == 0 {
+		return nil, ""
+	}
+	sub, args := rest[0], rest[1:]
+	switch sub {
+	case "clone":
+		positional := gitCloneFlags.scan(args, false, nil)
+		if len(positional) == 0 {
+			return nil, ""
+		}
+		return e.gitRepo(positional[0], 0)
+	case "fetch", "pull", "push", "ls-remote":
+		repo, all := "", false
+		positional := gitFetchFlags.scan(args, false, func(name, value string) {
+			switch name {
+			case "repo":
+				repo = value
+			case "all", "multiple":
+				all = true
+			}
+		})
+		if all {
+			return nil, "git " + sub + " --all uses every remote"
+		}
+		if len(positional) > 0 {
+			repo = positional[0]
+		}
+		if repo == "" {
+			// Without a remote, the current branch's upstream is used; usually origin's.
+			repo = "origin"
+		}
+		return e.gitRepo(repo, 0)
+	case "remote":
+		positional := gitRemoteFlags.scan(args, false, nil)
+		switch {
+		case len(positional) >= 3 && positional[0] == "add":
+			return e.gitRepo(positional[2], 0)
+		case len(positional) >= 3 && positional[0] == "set-url":
+			return e.gitRepo(positional[2], 0)
+		}
+	case "submodule":
+		positional := gitSubmoduleFlags.scan(args, false, nil)
+		if len(positional) >= 2 && positional[0] == "add" {
+			return e.gitRepo(positional[1], 0)
+		}
+	}
+	return nil, ""
+}
+
+// gitRepo returns the address of a repository argument: a URL, an scp-style remote, a local path
+// (no address), or the name of a remote, looked up with GitRemote.
+func (e *Extractor) gitRepo(repo string, depth int) ([]target, string) {
+	switch {
+	case strings.Contains(repo, "://") || strings.ContainsAny(repo, "$`"):
+		return []target{{repo, kindRemote}}, ""
+	case strings.HasPrefix(repo, "/") || strings.HasPrefix(repo, ".") || strings.HasPrefix(repo, "~"):
+		return nil, ""
+	}
+	if _, ok := remoteHost(repo); ok {
+		return []target{{repo, kindRemote}}, ""
+	}
+	if strings.ContainsAny(repo, `/\`) {
+		return nil, ""
+	}
+	if e.GitRemote != nil && depth == 0 {
+		if u := e.GitRemote(repo); u != "" {
+			return e.gitRepo(u, depth+1)
+		}
+	}
+	return nil, fmt.Sprintf("the URL of git remote %q is unknown", repo)
+}
+
+var pipFlags = flagSpec{
+	short: "rcteifCdw",
+	long: []string{
+		"requirement", "constraint", "target", "prefix", "root", "editable", "src", "platform",
+		"python-version", "implementation", "abi", "upgrade-strategy", "progress-bar", "log",
+		"cache-dir", "cert", "client-cert", "timeout", "retries", "trusted-host", "exists-action",
+		"report", "config-settings", "global-option", "index-url", "extra-index-url",
+		"find-links", "proxy", "only-binary", "no-binary", "python", "keyring-provider", "dest",
+		"wheel-dir", "use-feature", "use-deprecated", "root-user-action",
+	},
+}
+
+// pipCommands are the pip commands that download packages.
+var pipCommands = map[string]bool{"install": true, "download": true, "wheel": true, "index": true}
+
+// pypi is where packages come from without an --index-url: the index and its file host.
+var pypi = []string{"pypi.org", "files.pythonhosted.org"}
+
+func pip(_ *Extractor, c *call) ([]target, string) {
+	rest := pipFlags.scan(c.args, true, nil)
+	if len(rest) == 0 || !pipCommands[rest[0]] {
+		return nil, ""
+	}
+	targets := c.proxies()
+	index := []target{}
+	for _, h := range pypi {
+		index = append(index, target{h, kindHost})
+	}
+	if v, ok := c.getenv("PIP_INDEX_URL"); ok {
+		index = []target{{v, kindURL}}
+	}
+	if v, ok := c.getenv("PIP_EXTRA_INDEX_URL"); ok {
+		for _, u := range strings.Fields(v) {
+			targets = append(targets, target{u, kindURL})
+		}
+	}
+	if v, ok := c.getenv("PIP_PROXY"); ok {
+		targets = append(targets, target{v, kindURL})
+	}
+	noIndex := false
+	if v, ok := c.getenv("PIP_NO_INDEX"); ok && v != "" && v != "0" && !strings.EqualFold(v, "false") {
+		noIndex = true
+	}
+	positional := pipFlags.scan(rest[1:], false, func(name, value string) {
+		switch name {
+		case "i", "index-url":
+			index = []target{{value, kindURL}}
+		case "extra-index-url", "proxy":
+			targets = append(targets, target{value, kindURL})
+		case "no-index":
+			noIndex = true
+		case "f", "find-links", "e", "editable":
+			if u, ok := embeddedURL(value); ok {
+				targets = append(targets, target{u, kindURL})
+			}
+		}
+	})
+	if !noIndex {
+		targets = append(targets, index...)
+	}
+	for _, p := range positional {
+		if u, ok := embeddedURL(p); ok {
+			targets = append(targets, target{u, kindURL})
+		}
+	}
+	return targets, ""
+}
+
+// urlStart finds the scheme of a URL inside a word, as in `pkg @ https://...` or `git+https://...`.
+var urlStart = regexp.MustCompile(`[A-Za-z][A-Za-z0-9+.-]*://`)
+
+// embeddedURL returns the URL in a requirement such as `pkg @ https://host/pkg.whl`, or a
+// variable the requirement is taken from, which the caller reports as unresolved.
+func embeddedURL(s string) (string, bool) {
+	if loc := urlStart.FindStringIndex(s); loc != nil {
+		return s[loc[0]:], true
+	}
+	if strings.HasPrefix(s, "$") {
+		return s, true
+	}
+	return "", false
+}
+
+// npmCommands are the npm, pnpm and yarn commands that download packages.
+var npmCommands = map[string]bool{
+	"install": true, "i": true, "in": true, "ci": true, "clean-install": true, "add": true,
+	"update": true, "up": true, "upgrade": true, "exec": true, "x": true, "install-test": true,
+	"it": true, "dlx": true, "create": true,
+}
+
+var npmFlags = flagSpec{short: "wCF", long: []string{
+	"registry", "prefix", "workspace", "tag", "cache", "loglevel", "omit", "include",
+	"install-strategy", "save-prefix", "filter", "dir", "cwd", "package",
+}}
+
+// githubShorthand is npm's `user/repo` form for a GitHub repository.
+var githubShorthand = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+(#.*)?$`)
+
+// gitHosts are npm's hosted-git prefixes.
+var gitHosts = map[string]string{"github:": "github.com", "gitlab:": "gitlab.com", "bitbucket:": "bitbucket.org", "gist:": "gist.github.com"}
+
+// npmMode says when a package manager downloads.
+type npmMode int
+
+const (
+	npmCommand npmMode = iota // with one of npmCommands: npm, pnpm
+	npmBare                   // also without a command: yarn, which installs by default
+	npmAlways                 // always: npx
+)
+
+func npm(registry string, mode npmMode) parser {
+	return func(_ *Extractor, c *call) ([]target, string) {
+		args := c.args
+		if mode != npmAlways {
+			rest := npmFlags.scan(c.args, true, nil)
+			switch {
+			case len(rest) > 0 && npmCommands[rest[0]]:
+				args = rest[1:]
+			case len(rest) == 0 && mode == npmBare:
+			default:
+				return nil, ""
+			}
+		}
+		return npmTargets(c, registry, args)
+	}
+}
+
+// npmTargets returns the registry, or the one set with --registry or the environment, and the
+// hosts of git and URL package specs in args.
+func npmTargets(c *call, registry string, args []string) ([]target, string) {
+	targets := c.proxies()
+	reg := target{registry, kindHost}
+	for _, name := range []string{"npm_config_registry", "YARN_REGISTRY", "YARN_NPM_REGISTRY_SERVER"} {
+		if v, ok := c.getenv(name); ok {
+			reg = target{v, kindURL}
+		}
+	}
+	positional := npmFlags.scan(args, false, func(name, value string) {
+		if name == "registry" {
+			reg = target{value, kindURL}
+		}
+	})
+	targets = append(targets, reg)
+	for _, p := range positional {
+		if u, ok := embeddedURL(p); ok {
+			targets = append(targets, target{u, kindURL})
+			continue
+		}
+		for prefix, host := range gitHosts {
+			if strings.HasPrefix(p, prefix) {
+				targets = append(targets, target{host, kindHost})
+			}
+		}
+		if !strings.HasPrefix(p, "@") && !strings.HasPrefix(p, ".") && githubShorthand.MatchString(p) {
+			targets = append(targets, target{"github.com", kindHost})
+		}
+	}
+	return targets, ""
+}
+
+var sshFlags = flagSpec{short: "BbcDEeFIiJLlmOopQRSWw"}
+
+func ssh(_ *Extractor, c *call) ([]target, string) {
+	var targets []target
+	reason := ""
+	positional := sshFlags.scan(c.args, true, func(name, value string) {
+		switch name {
+		case "J":
+			for _, hop := range strings.Split(value, ",") {
+				targets = append(targets, sshDestination(hop))
+			}
+		case "o":
+			k, v, _ := strings.Cut(strings.ReplaceAll(value, " ", "="), "=")
+			switch strings.ToLower(k) {
+			case "proxyjump":
+				for _, hop := range strings.Split(v, ",") {
+					targets = append(targets, sshDestination(hop))
+				}
+			case "proxycommand":
+				reason = "ssh connects through a ProxyCommand"
+			}
+		}
+	})
+	if len(positional) > 0 {
+		targets = append(targets, sshDestination(positional[0]))
+	}
+	return targets, reason
+}
+
+// sshDestination reads `[user@]host[:port]` or an ssh:// URL.
+func sshDestination(s string) target {
+	return target{s, kindURL}
+}
+
+var rsyncFlags = flagSpec{
+	short: "eBfTM",
+	long: []string{
+		"exclude", "include", "exclude-from", "include-from", "files-from", "filter", "rsh",
+		"rsync-path", "temp-dir", "compare-dest", "copy-dest", "link-dest", "partial-dir",
+		"log-file", "password-file", "port", "sockopts", "timeout", "contimeout", "bwlimit",
+		"chmod", "chown", "usermap", "groupmap", "out-format", "backup-dir", "suffix", "max-size",
+		"min-size", "block-size", "info", "debug", "address", "remote-option",
+	},
+}
+
+// remotes handles tools whose arguments are local paths or `[user@]host:path` remotes.
+func remotes(flags flagSpec) parser {
+	return func(_ *Extractor, c *call) ([]target, string) {
+		var targets []target
+		for _, p := range flags.scan(c.args, false, nil) {
+			targets = append(targets, target{p, kindRemote})
+		}
+		return targets, ""
+	}
+}
+
+func sftp(_ *Extractor, c *call) ([]target, string) {
+	positional := flagSpec{short: "BbcDFiJloPRSs"}.scan(c.args, false, nil)
+	if len(positional) == 0 {
+		return nil, ""
+	}
+	if _, ok := remoteHost(positional[0]); ok || strings.Contains(positional[0], "://") {
+		return []target{{positional[0], kindRemote}}, ""
+	}
+	return []target{{positional[0], kindHost}}, ""
+}
+
+// hostArg handles tools whose first argument is the host.
+func hostArg(flags flagSpec) parser {
+	return func(_ *Extractor, c *call) ([]target, string) {
+		positional := flags.scan(c.args, false, nil)
+		if len(positional) == 0 {
+			return nil, ""
+		}
+		if strings.Contains(positional[0], "://") {
+			return []target{{positional[0], kindURL}}, ""
+		}
+		return []target{{positional[0], kindHost}}, ""
+	}
+}
+
+func netcat(_ *Extractor, c *call) ([]target, string) {
+	var targets []target
+	listen := false
+	positional := flagSpec{short: "eiIOpqsTVwXx", long: []string{"proxy", "exec", "sh-exec", "source"}}.scan(c.args, false, func(name, value string) {
+		switch name {
+		case "l", "listen":
+			listen = true
+		case "x", "proxy":
+			targets = append(targets, target{value, kindURL})
+		}
+	})
+	if listen {
+		// A server: it accepts connections rather than making them.
+		return nil, ""
+	}
+	if len(positional) > 0 {
+		targets = append(targets, target{positional[0], kindHost})
+	}
+	return targets, ""
+}
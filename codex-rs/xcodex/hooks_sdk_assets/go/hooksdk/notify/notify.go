@@ -0,0 +1,130 @@
+// Package notify shows native desktop notifications: notify-send on Linux and the BSDs,
+// osascript on macOS, and a toast via PowerShell on Windows.
+//
+// The platform, PATH lookup, environment, and command runner are fields of Notifier, so the
+// dispatch can be exercised without a desktop:
+//
+//	n := notify.New()
+//	n.Run = func(ctx context.Context, name string, args ...string) error { ...record... }
+//	n.Notify(ctx, "xcodex", "turn complete")
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrUnavailable is returned when no notification mechanism is present, e.g. on a headless
+// server without a display or notify-send.
+var ErrUnavailable = errors.New("notify: no desktop notification mechanism available")
+
+// Runner runs an external command.
+type Runner func(ctx context.Context, name string, args ...string) error
+
+// Notifier dispatches a notification to the platform's mechanism.
+type Notifier struct {
+	// GOOS selects the mechanism (runtime.GOOS by default).
+	GOOS     string
+	LookPath func(file string) (string, error)
+	Getenv   func(key string) string
+	Run      Runner
+}
+
+// New returns a Notifier for the current platform that runs real commands.
+func New() *Notifier {
+	return &Notifier{
+		GOOS:     runtime.GOOS,
+		LookPath: exec.LookPath,
+		Getenv:   os.Getenv,
+		Run:      runCommand,
+	}
+}
+
+func runCommand(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return errors.New(err.Error() + ": " + strings.TrimSpace(string(out)))
+	}
+	return err
+}
+
+// Notify shows a notification with title and body. It returns ErrUnavailable (wrapped) when the
+// platform has no usable mechanism.
+func (n *Notifier) Notify(ctx context.Context, title, body string) error {
+	name, args, err := n.Command(title, body)
+	if err != nil {
+		return err
+	}
+	return n.Run(ctx, name, args...)
+}
+
+// Command returns the command Notify would run.
+func (n *Notifier) Command(title, body string) (string, []string, error) {
+	switch n.GOOS {
+	case "darwin":
+		if _, err := n.LookPath("osascript"); err != nil {
+			return "", nil, ErrUnavailable
+		}
+		script := "display notification " + appleScriptString(body) + " with title " + appleScriptString(title)
+		return "osascript", []string{"-e", script}, nil
+	case "windows":
+		ps, err := n.LookPath("powershell")
+		if err != nil {
+			if ps, err = n.LookPath("pwsh"); err != nil {
+				return "", nil, ErrUnavailable
+			}
+		}
+		return ps, []string{"-NoProfile", "-NonInteractive", "-EncodedCommand", encodePowerShell(toastScript(title, body))}, nil
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		// Without a graphical session notify-send has nowhere to show the notification.
+		if n.Getenv("DISPLAY") == "" && n.Getenv("WAYLAND_DISPLAY") == "" && n.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+			return "", nil, ErrUnavailable
+		}
+		if _, err := n.LookPath("notify-send"); err != nil {
+			return "", nil, ErrUnavailable
+		}
+		return "notify-send", []string{"--app-name=xcodex", "--", title, body}, nil
+	}
+	return "", nil, ErrUnavailable
+}
+
+// appleScriptString quotes s as an AppleScript string literal.
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// toastScript builds a PowerShell script showing a toast through the WinRT notification API.
+func toastScript(title, body string) string {
+	return `$ErrorActionPreference = 'Stop'
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode(` + powerShellString(title) + `)) | Out-Null
+$text.Item(1).AppendChild($template.CreateTextNode(` + powerShellString(body) + `)) | Out-Null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('xcodex').Show($toast)
+`
+}
+
+// powerShellString quotes s as a single-quoted (non-interpolating) PowerShell string.
+func powerShellString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// encodePowerShell encodes script for -EncodedCommand (base64 of UTF-16LE), which sidesteps
+// command-line quoting entirely.
+func encodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		b[2*i] = byte(u)
+		b[2*i+1] = byte(u >> 8)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,114 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/notify"
+)
+
+// fakeNotifier returns a Notifier for goos with the given commands installed and environment,
+// and the commands it runs.
+func fakeNotifier(goos string, installed []string, env map[string]string) (*notify.Notifier, *[][]string) {
+	var ran [][]string
+	return &notify.Notifier{
+		GOOS: goos,
+		LookPath: func(file string) (string, error) {
+			for _, name := range installed {
+				if name == file {
+					return "/usr/bin/" + file, nil
+				}
+			}
+			return "", exec.ErrNotFound
+		},
+		Getenv: func(key string) string { return env[key] },
+		Run: func(ctx context.Context, name string, args ...string) error {
+			ran = append(ran, append([]string{name}, args...))
+			return nil
+		},
+	}, &ran
+}
+
+func TestNotifyLinux(t *testing.T) {
+	n, ran := fakeNotifier("linux", []string{"notify-send"}, map[string]string{"WAYLAND_DISPLAY": "wayland-0"})
+	if err := n.Notify(context.Background(), "xcodex: turn complete", "-rf done"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"notify-send", "--app-name=xcodex", "--", "xcodex: turn complete", "-rf done"}
+	if len(*ran) != 1 || strings.Join((*ran)[0], "|") != strings.Join(want, "|") {
+		t.Errorf("ran %q, want %q", *ran, want)
+	}
+}
+
+func TestNotifyDarwin(t *testing.T) {
+	n, ran := fakeNotifier("darwin", []string{"osascript"}, nil)
+	if err := n.Notify(context.Background(), `say "hi"`, `C:\path`); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"osascript", "-e", `display notification "C:\\path" with title "say \"hi\""`}
+	if len(*ran) != 1 || strings.Join((*ran)[0], "|") != strings.Join(want, "|") {
+		t.Errorf("ran %q, want %q", *ran, want)
+	}
+}
+
+func TestNotifyWindows(t *testing.T) {
+	// pwsh is used when Windows PowerShell isn't on PATH.
+	n, ran := fakeNotifier("windows", []string{"pwsh"}, nil)
+	if err := n.Notify(context.Background(), "it's done", "body"); err != nil {
+		t.Fatal(err)
+	}
+	cmd := (*ran)[0]
+	if cmd[0] != "/usr/bin/pwsh" || cmd[len(cmd)-2] != "-EncodedCommand" {
+		t.Fatalf("ran %q", cmd)
+	}
+	data, err := base64.StdEncoding.DecodeString(cmd[len(cmd)-1])
+	if err != nil || len(data)%2 != 0 {
+		t.Fatalf("encoded command: %v", err)
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	script := string(utf16.Decode(units))
+	if !strings.Contains(script, `CreateTextNode('it''s done')`) || !strings.Contains(script, "ToastNotificationManager") {
+		t.Errorf("script doesn't show the toast:\n%s", script)
+	}
+}
+
+func TestNotifyUnavailable(t *testing.T) {
+	tests := []struct {
+		name      string
+		goos      string
+		installed []string
+		env       map[string]string
+	}{
+		{"headless linux", "linux", []string{"notify-send"}, nil},
+		{"linux without notify-send", "linux", nil, map[string]string{"DISPLAY": ":0"}},
+		{"macOS without osascript", "darwin", nil, nil},
+		{"windows without PowerShell", "windows", nil, nil},
+		{"other platform", "plan9", nil, nil},
+	}
+	for _, tt := range tests {
+		n, ran := fakeNotifier(tt.goos, tt.installed, tt.env)
+		if err := n.Notify(context.Background(), "t", "b"); !errors.Is(err, notify.ErrUnavailable) {
+			t.Errorf("%s: Notify = %v, want ErrUnavailable", tt.name, err)
+		}
+		if len(*ran) != 0 {
+			t.Errorf("%s: ran %q", tt.name, *ran)
+		}
+	}
+}
+
+func TestNotifyRunError(t *testing.T) {
+	n, _ := fakeNotifier("linux", []string{"notify-send"}, map[string]string{"DISPLAY": ":0"})
+	failed := errors.New("exit status 1")
+	n.Run = func(context.Context, string, ...string) error { return failed }
+	if err := n.Notify(context.Background(), "t", "b"); !errors.Is(err, failed) {
+		t.Errorf("Notify = %v, want the command's error", err)
+	}
+}
@@ -0,0 +1,217 @@
+// Package ntfy publishes messages to an ntfy topic (ntfy.sh, or a self-hosted or compatible
+// server) and reads what is posted to a topic afterwards, for hooks that ask someone away from the
+// terminal for a decision.
+//
+//	c := &ntfy.Client{Token: token}
+//	sent, err := c.Publish(ctx, ntfy.Message{Topic: "my-secret-topic", Message: "Run make deploy?"})
+//	err = c.Subscribe(ctx, "my-secret-topic", sent.ID, func(m ntfy.Event) bool {
+//		return m.Message == "yes" // true stops reading
+//	})
+package ntfy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultServer is used when Client.Server is empty.
+const DefaultServer = "https://ntfy.sh"
+
+// reconnectDelay is the pause before Subscribe reconnects a stream the server closed.
+const reconnectDelay = time.Second
+
+// Client talks to one ntfy server; its zero value uses DefaultServer without authentication.
+type Client struct {
+	// Server is the base URL, e.g. "https://ntfy.example.com".
+	Server string
+	// Token is an access token sent as a bearer token, for topics that need one.
+	Token string
+	// HTTPClient defaults to http.DefaultClient. Subscribe holds a request open as long as its
+	// context, so the client shouldn't set a Timeout shorter than that.
+	HTTPClient *http.Client
+}
+
+// Message is published with Publish.
+type Message struct {
+	Topic   string   `json:"topic"`
+	Title   string   `json:"title,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	// Priority is 1 (min) to 5 (max); 0 leaves the server's default, 3.
+	Priority int      `json:"priority,omitempty"`
+	Actions  []Action `json:"actions,omitempty"`
+}
+
+// Action is an `http` action button: tapping it sends a request from the phone.
+type Action struct {
+	Label  string            `json:"label"`
+	URL    string            `json:"url"`
+	Method string            `json:"method,omitempty"` // POST by default
+	Body   string            `json:"body,omitempty"`
+	Header map[string]string `json:"headers,omitempty"`
+	// Clear dismisses the notification once the request succeeds.
+	Clear bool `json:"clear,omitempty"`
+}
+
+// MarshalJSON adds the action type.
+func (a Action) MarshalJSON() ([]byte, error) {
+	type action Action
+	return json.Marshal(struct {
+		Action string `json:"action"`
+		action
+	}{"http", action(a)})
+}
+
+// Event is a message as the server returns it.
+type Event struct {
+	ID    string `json:"id"`
+	Time  int64  `json:"time"`
+	Event string `json:"event"` // "message"; "open" and "keepalive" events aren't passed on
+	Topic string `json:"topic"`
+	Title string `json:"title,omitempty"`
+	// Message is the text, or the body of the request an action button sent.
+	Message string `json:"message"`
+}
+
+// StatusError is returned when the server answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	// Body is the start of the response body, for diagnostics.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("ntfy: server returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("ntfy: server returned %d: %s", e.StatusCode, e.Body)
+}
+
+// Publish sends m and returns it as stored, with its ID.
+func (c *Client) Publish(ctx context.Context, m Message) (Event, error) {
+	if m.Topic == "" {
+		return Event{}, errors.New("ntfy: no topic")
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		return Event{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.server(), bytes.NewReader(body))
+	if err != nil {
+		return Event{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.do(req)
+	if err != nil {
+		return Event{}, err
+	}
+	defer resp.Body.Close()
+	var sent Event
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&sent); err != nil {
+		return Event{}, fmt.Errorf("ntfy: decode publish response: %w", err)
+	}
+	return sent, nil
+}
+
+// Subscribe calls fn with each message posted to topic after the message with ID since (all the
+// cached ones when since is ""), in order, until fn returns true or ctx is done; then it returns
+// nil or ctx's error. The stream is reconnected when the server closes it, resuming after the last
+// message seen.
+func (c *Client) Subscribe(ctx context.Context, topic, since string, fn func(Event) bool) error {
+	if topic == "" {
+		return errors.New("ntfy: no topic")
+	}
+	if since == "" {
+		since = "all"
+	}
+	for {
+		done, last, err := c.stream(ctx, topic, since, fn)
+		if last != "" {
+			since = last
+		}
+		switch {
+		case done:
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			var status *StatusError
+			if errors.As(err, &status) {
+				return err
+			}
+		}
+		select {
+		case <-time.After(reconnectDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// stream reads one connection's messages. last is the ID of the last message read.
+func (c *Client) stream(ctx context.Context, topic, since string, fn func(Event) bool) (done bool, last string, err error) {
+	u := c.server() + "/" + url.PathEscape(topic) + "/json?since=" + url.QueryEscape(since)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || e.Event != "message" {
+			continue
+		}
+		last = e.ID
+		if fn(e) {
+			return true, last, nil
+		}
+	}
+	return false, last, sc.Err()
+}
+
+func (c *Client) server() string {
+	if c.Server == "" {
+		return DefaultServer
+	}
+	return strings.TrimRight(c.Server, "/")
+}
+
+// TopicURL is the URL messages are published to with a plain POST, as action buttons do.
+func (c *Client) TopicURL(topic string) string {
+	return c.server() + "/" + url.PathEscape(topic)
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
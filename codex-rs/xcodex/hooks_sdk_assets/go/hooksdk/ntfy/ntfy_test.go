@@ -0,0 +1,158 @@
+package ntfy_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/ntfy"
+	"example.com/xcodex/hooks-sdk/hooksdk/ntfy/ntfytest"
+)
+
+func checkProblems(t *testing.T, srv *ntfytest.Server) {
+	t.Helper()
+	for _, p := range srv.Problems() {
+		t.Error(p)
+	}
+}
+
+// collect subscribes to topic from since until it has n messages, and returns their texts.
+func collect(t *testing.T, c *ntfy.Client, topic, since string, n int) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var got []string
+	err := c.Subscribe(ctx, topic, since, func(e ntfy.Event) bool {
+		if e.Event != "message" || e.Topic != topic || e.ID == "" {
+			t.Errorf("event passed on: %+v", e)
+		}
+		got = append(got, e.Message)
+		return len(got) == n
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v after %q", err, got)
+	}
+	return got
+}
+
+func TestPublish(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{Token: "tk"})
+	m := ntfy.Message{
+		Topic:    "requests",
+		Title:    "Approve?",
+		Message:  "make deploy",
+		Tags:     []string{"question"},
+		Priority: 4,
+		Actions:  []ntfy.Action{{Label: "Yes", URL: srv.URL + "/answers", Body: "yes 1", Clear: true}},
+	}
+	sent, err := srv.Client().Publish(context.Background(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.ID == "" || sent.Topic != "requests" || sent.Message != "make deploy" || sent.Event != "message" {
+		t.Errorf("Publish = %+v", sent)
+	}
+	if got := srv.Published(); !reflect.DeepEqual(got, []ntfy.Message{m}) {
+		t.Errorf("published %+v, want %+v", got, m)
+	}
+	checkProblems(t, srv)
+
+	// Without the token, the server refuses; errors carry the status and body.
+	anon := &ntfy.Client{Server: srv.URL + "/"}
+	var status *ntfy.StatusError
+	if _, err := anon.Publish(context.Background(), m); !errors.As(err, &status) || status.StatusCode != 401 || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("Publish without the token = %v", err)
+	}
+	if _, err := srv.Client().Publish(context.Background(), ntfy.Message{Message: "x"}); err == nil {
+		t.Error("Publish without a topic succeeded")
+	}
+}
+
+func TestActionJSON(t *testing.T) {
+	data, err := json.Marshal(ntfy.Action{Label: "Deny", URL: "https://ntfy.sh/t", Body: "deny 1", Header: map[string]string{"X": "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"action":"http","label":"Deny","url":"https://ntfy.sh/t","body":"deny 1","headers":{"X":"y"}}`; string(data) != want {
+		t.Errorf("Action JSON = %s, want %s", data, want)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{})
+	c := srv.Client()
+	srv.Post("t", "old")
+	mark := srv.Post("t", "mark")
+	srv.Post("other", "elsewhere")
+	srv.Post("t", "new")
+
+	// Cached messages since an ID, or all of them.
+	if got := collect(t, c, "t", mark.ID, 1); !reflect.DeepEqual(got, []string{"new"}) {
+		t.Errorf("since %s = %q", mark.ID, got)
+	}
+	if got := collect(t, c, "t", "", 3); !reflect.DeepEqual(got, []string{"old", "mark", "new"}) {
+		t.Errorf("since all = %q", got)
+	}
+
+	// Then messages as they are posted, including those an action button sends.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		srv.Post("t", "live")
+		if _, err := c.Publish(context.Background(), ntfy.Message{Topic: "t", Message: "published"}); err != nil {
+			t.Error(err)
+		}
+	}()
+	last := srv.Events("t")[2]
+	if got := collect(t, c, "t", last.ID, 2); !reflect.DeepEqual(got, []string{"live", "published"}) {
+		t.Errorf("live messages = %q", got)
+	}
+	checkProblems(t, srv)
+}
+
+func TestSubscribeReconnects(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{Hangup: true})
+	srv.Post("t", "one")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		srv.Post("t", "two")
+	}()
+	// The stream ends after "one" is sent; the client reconnects after it, not from the start.
+	if got := collect(t, srv.Client(), "t", "", 2); !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("messages = %q", got)
+	}
+	if n := srv.Subscriptions(); n < 2 {
+		t.Errorf("%d subscriptions, want a reconnect", n)
+	}
+	checkProblems(t, srv)
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	srv := ntfytest.NewServer(t, ntfytest.Options{})
+	c := srv.Client()
+
+	// A status error ends the subscription.
+	srv.Fail(403)
+	var status *ntfy.StatusError
+	if err := c.Subscribe(context.Background(), "t", "", func(ntfy.Event) bool { return true }); !errors.As(err, &status) || status.StatusCode != 403 {
+		t.Errorf("Subscribe to a forbidden topic = %v", err)
+	}
+
+	// Otherwise it lasts as long as the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := c.Subscribe(ctx, "t", "", func(ntfy.Event) bool { return true }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Subscribe to a quiet topic = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Subscribe returned after %v", elapsed)
+	}
+
+	if err := c.Subscribe(context.Background(), "", "", func(ntfy.Event) bool { return true }); err == nil {
+		t.Error("Subscribe without a topic succeeded")
+	}
+}
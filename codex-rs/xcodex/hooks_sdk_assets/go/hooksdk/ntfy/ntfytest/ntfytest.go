@@ -0,0 +1,254 @@
+// Package ntfytest runs a fake ntfy server for testing hooks that use hooksdk/ntfy. It takes
+// JSON publishes at the root and plain ones at a topic's URL, as action buttons send them, and
+// streams a topic's messages to subscribers from `since` on, as ntfy does.
+//
+//	srv := ntfytest.NewServer(t, ntfytest.Options{
+//		OnPublish: func(srv *ntfytest.Server, m ntfy.Message) { srv.Post(m.Topic, "yes") },
+//	})
+//	sent, err := srv.Client().Publish(ctx, ntfy.Message{Topic: "t", Message: "Run it?"})
+//	srv.Published() // the messages as the client sent them
+package ntfytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/ntfy"
+)
+
+// Options configure a Server.
+type Options struct {
+	// Token, when set, must come with every request as a bearer token; others get a 401.
+	Token string
+	// OnPublish is called after each JSON publish is stored, with the message as sent, without
+	// holding the server's lock: it can Post an answer, as someone tapping a button would.
+	OnPublish func(srv *Server, m ntfy.Message)
+	// Hangup closes each subscription once the cached messages are sent, rather than streaming
+	// new ones, so subscribers have to reconnect.
+	Hangup bool
+}
+
+// Server is a running fake, stopped when the test ends.
+type Server struct {
+	*httptest.Server
+	opts Options
+
+	mu        sync.Mutex
+	changed   chan struct{} // closed and replaced when a message is stored
+	events    []ntfy.Event
+	published []ntfy.Message
+	fails     []int
+	streams   int
+	problems  []string
+}
+
+// NewServer starts a fake server.
+func NewServer(t testing.TB, opts Options) *Server {
+	s := &Server{opts: opts, changed: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(func() {
+		// Subscriptions a test left open would keep Close waiting.
+		s.CloseClientConnections()
+		s.Close()
+	})
+	return s
+}
+
+// Client returns a client for the server, with the token of Options.
+func (s *Server) Client() *ntfy.Client {
+	return &ntfy.Client{Server: s.URL, Token: s.opts.Token}
+}
+
+// Post stores a plain message on topic, as a POST to the topic's URL does, and returns it.
+func (s *Server) Post(topic, text string) ntfy.Event {
+	return s.store(ntfy.Event{Topic: topic, Message: text})
+}
+
+// Fail answers the next requests with the given statuses, in order.
+func (s *Server) Fail(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fails = append(s.fails, statuses...)
+}
+
+// Published returns the JSON-published messages, in order.
+func (s *Server) Published() []ntfy.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ntfy.Message(nil), s.published...)
+}
+
+// Events returns the messages stored on topic, in order.
+func (s *Server) Events(topic string) []ntfy.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []ntfy.Event
+	for _, e := range s.events {
+		if e.Topic == topic {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Subscriptions returns the number of subscriptions opened so far.
+func (s *Server) Subscriptions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams
+}
+
+// Problems lists the requests the server found malformed.
+func (s *Server) Problems() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.problems...)
+}
+
+func (s *Server) problem(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.problems = append(s.problems, fmt.Sprintf(format, args...))
+}
+
+func (s *Server) store(e ntfy.Event) ntfy.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.ID = fmt.Sprintf("msg%04d", len(s.events)+1)
+	e.Time = time.Now().Unix()
+	e.Event = "message"
+	s.events = append(s.events, e)
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return e
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var status int
+	if len(s.fails) > 0 {
+		status, s.fails = s.fails[0], s.fails[1:]
+	}
+	s.mu.Unlock()
+	if status != 0 {
+		http.Error(w, `{"error":"injected failure"}`, status)
+		return
+	}
+	if s.opts.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.opts.Token {
+		http.Error(w, `{"code":40101,"error":"unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodPost && path == "":
+		s.publish(w, r)
+	case r.Method == http.MethodPost && !strings.Contains(path, "/"):
+		body, _ := io.ReadAll(r.Body)
+		writeJSON(w, s.Post(path, string(body)))
+	case r.Method == http.MethodGet && strings.HasSuffix(path, "/json"):
+		s.subscribe(w, r, strings.TrimSuffix(path, "/json"))
+	default:
+		s.problem("unexpected request %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) publish(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+		s.problem("publish with Content-Type %q", ct)
+	}
+	var m ntfy.Message
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil || m.Topic == "" {
+		s.problem("publish body isn't a message with a topic: %v", err)
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	e := s.store(ntfy.Event{Topic: m.Topic, Title: m.Title, Message: m.Message})
+	s.mu.Lock()
+	s.published = append(s.published, m)
+	s.mu.Unlock()
+	writeJSON(w, e)
+	if s.opts.OnPublish != nil {
+		s.opts.OnPublish(s, m)
+	}
+}
+
+// subscribe streams the messages on topic from since on: "all", a message ID (those after it), or
+// a Unix time (those at or after it).
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request, topic string) {
+	since := r.URL.Query().Get("since")
+	s.mu.Lock()
+	s.streams++
+	next := -1
+	switch unix, err := strconv.ParseInt(since, 10, 64); {
+	case since == "all":
+		next = 0
+	case err == nil:
+		next = len(s.events)
+		for i, e := range s.events {
+			if e.Time >= unix {
+				next = i
+				break
+			}
+		}
+	default:
+		for i, e := range s.events {
+			if e.ID == since {
+				next = i + 1
+			}
+		}
+	}
+	s.mu.Unlock()
+	if next < 0 {
+		s.problem("subscribe to %s since unknown message %q", topic, since)
+		http.Error(w, `{"error":"invalid since"}`, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	writeLine(w, ntfy.Event{ID: "open", Time: time.Now().Unix(), Event: "open", Topic: topic})
+	writeLine(w, ntfy.Event{ID: "keepalive", Time: time.Now().Unix(), Event: "keepalive", Topic: topic})
+	flush()
+	for {
+		s.mu.Lock()
+		pending, changed := s.events[next:], s.changed
+		next = len(s.events)
+		s.mu.Unlock()
+		for _, e := range pending {
+			if e.Topic == topic {
+				writeLine(w, e)
+			}
+		}
+		flush()
+		if s.opts.Hangup {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeLine(w io.Writer, e ntfy.Event) {
+	json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,99 @@
+package hooksdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+)
+
+// unmarshalUseNumber is json.Unmarshal with numbers decoded as json.Number instead of float64, so
+// integers above 2^53 (token counts, byte offsets) survive a decode/encode round trip unchanged.
+func unmarshalUseNumber(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid character after top-level JSON value")
+	}
+	return nil
+}
+
+// AsInt64 converts a number from an untyped payload (json.Number, or any Go integer/float type) to
+// an int64. It returns false for non-numbers, non-integral values, and values out of range.
+func AsInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, true
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return 0, false
+		}
+		return floatToInt64(f)
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return uintToInt64(uint64(n))
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return uintToInt64(n)
+	case float32:
+		return floatToInt64(float64(n))
+	case float64:
+		return floatToInt64(n)
+	}
+	return 0, false
+}
+
+// AsFloat64 converts a number from an untyped payload (json.Number, or any Go integer/float type)
+// to a float64. It returns false for non-numbers.
+func AsFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	}
+	if i, ok := AsInt64(v); ok {
+		return float64(i), true
+	}
+	if u, ok := v.(uint64); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
+
+func floatToInt64(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func uintToInt64(u uint64) (int64, bool) {
+	if u > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(u), true
+}
@@ -0,0 +1,82 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+const bigInt = "1234567890123456789" // 19 digits, well past 2^53
+
+func TestReadPayloadJSONKeepsIntegerPrecision(t *testing.T) {
+	payload := `{"xcodex_event_type":"tool-call-finished","output_bytes":` + bigInt + `}`
+	env := map[string]string{"CODEX_HOME": t.TempDir()}
+	raw, err := hooksdk.ReadPayloadJSON(hooksdk.WithIO(hooksdk.IO{In: strings.NewReader(payload), Getenv: func(k string) string { return env[k] }}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, ok := hooksdk.AsInt64(raw["output_bytes"]); !ok || n != 1234567890123456789 {
+		t.Errorf("AsInt64(output_bytes) = %d, %v", n, ok)
+	}
+
+	var out bytes.Buffer
+	if err := json.NewEncoder(&out).Encode(raw); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"output_bytes":`+bigInt) {
+		t.Errorf("re-encoded payload = %s, want output_bytes unchanged", out.String())
+	}
+}
+
+func TestRawPayloadKeepsIntegerPrecision(t *testing.T) {
+	p, err := hooksdk.ParseHookPayload(hooktest.ToolCallFinished().With("offset", json.Number(bigInt)).Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := p.Raw()["offset"].(json.Number); !ok || got.String() != bigInt {
+		t.Errorf("Raw()[offset] = %#v, want json.Number %s", p.Raw()["offset"], bigInt)
+	}
+}
+
+func TestAsInt64(t *testing.T) {
+	tests := []struct {
+		v    any
+		want int64
+		ok   bool
+	}{
+		{json.Number(bigInt), 1234567890123456789, true},
+		{json.Number("3.0"), 3, true},
+		{json.Number("3.5"), 0, false},
+		{json.Number("1e30"), 0, false},
+		{float64(7), 7, true},
+		{uint64(math.MaxUint64), 0, false},
+		{int32(-2), -2, true},
+		{"7", 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := hooksdk.AsInt64(tt.v)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("AsInt64(%#v) = %d, %v; want %d, %v", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAsFloat64(t *testing.T) {
+	for _, v := range []any{json.Number("2.5"), float32(2.5), 2.5} {
+		if got, ok := hooksdk.AsFloat64(v); !ok || got != 2.5 {
+			t.Errorf("AsFloat64(%#v) = %v, %v", v, got, ok)
+		}
+	}
+	if got, ok := hooksdk.AsFloat64(uint64(math.MaxUint64)); !ok || got != math.MaxUint64 {
+		t.Errorf("AsFloat64(MaxUint64) = %v, %v", got, ok)
+	}
+	if _, ok := hooksdk.AsFloat64(true); ok {
+		t.Errorf("AsFloat64(true) succeeded")
+	}
+}
@@ -0,0 +1,538 @@
+package hooksdk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// openPayloadMemory is how much input OpenPayload holds in memory before it moves it to a
+// temporary file.
+const openPayloadMemory = 1 << 20
+
+// OpenPayload opens the hook payload as a stream of the bytes ReadPayloadRaw would return, with
+// their size, for hooks that pass the payload along (io.Copy to a request body or an upload)
+// without decoding it: memory use stays the same whatever the payload's size. Close the reader
+// once done.
+//
+// The envelope is resolved as by ReadPayload (payload_path, payload_fd, inline payload, gzip,
+// checksum, signature), and the checksum and signature are checked before OpenPayload returns. A
+// payload_path file is read where it is when there is neither to check. What can't be read twice,
+// or mustn't change once checked, is copied on the way, to a temporary file once it is larger
+// than 1 MiB: stdin, which must be read to its end to tell an envelope from a bare payload, a
+// payload_fd, and a payload_path file that is gzipped (after decompression) or checked. The
+// temporary file is removed by Close, and so is a payload_path file the envelope marks for
+// cleanup. An inline payload is in the envelope, so it is read into memory with it. A CBOR payload
+// (see PayloadFormatCBOR) is read into memory too, and streamed as JSON.
+//
+// Unlike ReadPayloadRaw, OpenPayload doesn't check that the bytes are JSON, and waits for a
+// payload_path file only until it exists and isn't empty (see WithPayloadRetry), not until it
+// holds complete JSON, since that would mean reading it. WithDebugCapture saves stdin and the
+// payload only when they are held in memory.
+func OpenPayload(opts ...Option) (io.ReadCloser, int64, error) {
+	o := newOptions(opts)
+	o.capture = o.startCapture()
+	rc, size, err := openPayload(context.Background(), o.stdio.in(), o)
+	o.capture.finish(nil, err)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rc, size, nil
+}
+
+func openPayload(ctx context.Context, r io.Reader, o *options) (*payloadReader, int64, error) {
+	in, source, closeInput := payloadInput(r, o)
+	defer closeInput()
+	stdin := &spooled{}
+	terminal := isTerminal(in)
+	if !terminal {
+		var err error
+		if stdin, err = spool(ctx, in, o.maxPayloadBytes, source); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	manual := false
+	if stdin.file != nil {
+		// A large stdin is almost always the payload itself; only an envelope is read into memory.
+		isEnvelope, err := hasEnvelopeKeys(stdin.file)
+		if err == nil {
+			_, err = stdin.file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			stdin.reader().Close()
+			return nil, 0, err
+		}
+		if !isEnvelope {
+			if r == io.Reader(os.Stdin) {
+				stdinOutputPath.Store("")
+				stdinCapabilities.Store(hostCapabilities{})
+			}
+			// A bare payload carries no signature, which only RequireSignature minds.
+			if err := o.checkSignature(nil, envelope{}); err != nil {
+				stdin.reader().Close()
+				return nil, 0, err
+			}
+			return stdin.reader(), stdin.size, nil
+		}
+		data, err := io.ReadAll(stdin.file)
+		stdin.reader().Close()
+		if err != nil {
+			return nil, 0, err
+		}
+		stdin = &spooled{data: data, size: int64(len(data))}
+	} else if isBlank(stdin.data) {
+		path := manualPayloadPath(r, o)
+		if path == "" && terminal {
+			return nil, 0, fmt.Errorf("%w: stdin is a terminal; pipe an event to the hook, pass an event file as the first argument, or set %s", ErrNoPayload, PayloadPathEnv)
+		}
+		if path != "" {
+			envelopeBytes, err := json.Marshal(map[string]string{"payload_path": path})
+			if err != nil {
+				return nil, 0, err
+			}
+			stdin, manual = &spooled{data: envelopeBytes}, true
+		}
+	}
+	o.capture.stdin(stdin.data)
+
+	payload, src, env, err := decodeEnvelope(stdin.data, o)
+	if r == io.Reader(os.Stdin) {
+		stdinOutputPath.Store(env.outputPath)
+		stdinCapabilities.Store(env.capabilities)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if src == nil {
+		if err := o.checkSignature(payload, env); err != nil {
+			return nil, 0, err
+		}
+		if isBlank(payload) {
+			return nil, 0, ErrEmptyPayload
+		}
+		o.capture.payload(payload, env)
+		return (&spooled{data: payload}).reader(), int64(len(payload)), nil
+	}
+
+	var f *os.File
+	if src.fd >= 0 {
+		f, err = openPayloadFD(src.fd)
+	} else {
+		f, err = o.openPayloadFile(ctx, src.path)
+	}
+	if err != nil {
+		return nil, 0, src.readError(err)
+	}
+	p, size, err := o.streamPayload(ctx, f, src, env)
+	if err != nil {
+		return nil, 0, err
+	}
+	if env.format == PayloadFormatCBOR {
+		// The stream is the payload as JSON, which takes decoding all of it first.
+		data, err := io.ReadAll(p)
+		p.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+		_, view, err := o.decodeCBOR(data)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", src.name, err)
+		}
+		p, size = (&spooled{data: view}).reader(), int64(len(view))
+	}
+	// Never delete a file the user pointed at by hand.
+	if env.payloadPath != "" && !manual && (env.cleanup || o.cleanupPayloadFile) {
+		p.cleanup = env.payloadPath
+	}
+	return p, size, nil
+}
+
+// openPayloadFile opens the payload_path file at path, waiting, for the retry budget (see
+// WithPayloadRetry), while it doesn't exist or is empty.
+func (o *options) openPayloadFile(ctx context.Context, path string) (*os.File, error) {
+	start := time.Now()
+	pause := payloadRetryFirstPause
+	for attempt := 1; ; attempt++ {
+		var f *os.File
+		var err error
+		if o.restrictPayloadPath {
+			f, err = o.openAllowedPayloadFile(path)
+		} else {
+			f, err = os.Open(path)
+		}
+		last := time.Since(start)+pause > o.payloadRetry
+		switch {
+		case err == nil:
+			info, err := f.Stat()
+			if err != nil {
+				f.Close()
+				return nil, err
+			}
+			if info.Size() > 0 || !info.Mode().IsRegular() || last {
+				return f, nil
+			}
+			f.Close()
+		case !errors.Is(err, fs.ErrNotExist) || last && attempt == 1:
+			return nil, err
+		case last:
+			return nil, fmt.Errorf("%w (after %d attempts in %v)", err, attempt, time.Since(start).Round(time.Millisecond))
+		}
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if pause *= 2; pause > payloadRetryMaxPause {
+			pause = payloadRetryMaxPause
+		}
+	}
+}
+
+// streamPayload returns the payload in f, the payload_path file or payload_fd descriptor of src,
+// and its size, once its checksum and signature are checked. It takes f over, closing it on
+// failure.
+func (o *options) streamPayload(ctx context.Context, f *os.File, src *payloadSource, env envelope) (*payloadReader, int64, error) {
+	fail := func(err error) (*payloadReader, int64, error) {
+		f.Close()
+		return nil, 0, err
+	}
+	check, err := o.signatureCheck(env)
+	if err != nil {
+		return fail(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return fail(src.readError(err))
+	}
+	br := bufio.NewReaderSize(&contextReader{ctx: ctx, r: f}, 64<<10)
+	// As for ReadPayload, the magic bytes are trusted over the envelope.
+	magic, _ := br.Peek(2)
+	compressed := src.gzip || hasGzipMagic(magic)
+
+	// With nothing to check, a plain file is read where it is. Otherwise it is copied as it is
+	// checked, like a pipe: the file could change between a check and the caller's read.
+	if info.Mode().IsRegular() && !compressed && src.checksum == "" && check == nil {
+		size := info.Size()
+		if o.maxPayloadBytes > 0 && size > o.maxPayloadBytes {
+			return fail(&PayloadTooLargeError{Source: src.name, Limit: o.maxPayloadBytes})
+		}
+		if size == 0 {
+			return fail(ErrEmptyPayload)
+		}
+		// Back to the start, past what was peeked through br.
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return fail(src.readError(err))
+		}
+		return &payloadReader{Reader: f, f: f}, size, nil
+	}
+
+	// Compressed, checked, or from a pipe: the payload is copied as it is read.
+	sum := sha256.New()
+	raw := io.TeeReader(br, sum)
+	in, limitSource := raw, src.name
+	if compressed {
+		zr, err := gzip.NewReader(raw)
+		if err != nil {
+			return fail(src.readError(fmt.Errorf("decompress: %w", err)))
+		}
+		in, limitSource = zr, "decompressed "+src.name
+	}
+	if check != nil {
+		in = io.TeeReader(in, check)
+	}
+	payload, err := spool(ctx, in, o.maxPayloadBytes, limitSource)
+	if err == nil {
+		// Hash what follows a complete gzip stream too.
+		_, err = io.Copy(io.Discard, raw)
+	}
+	f.Close()
+	if err != nil {
+		// A file that isn't what the host wrote fails its checksum rather than its decompression.
+		var tooLarge *PayloadTooLargeError
+		if src.checksum != "" && !errors.As(err, &tooLarge) {
+			io.Copy(io.Discard, raw)
+			if err := verifySum(sum, src); err != nil {
+				return nil, 0, err
+			}
+		}
+		if compressed {
+			err = fmt.Errorf("decompress: %w", err)
+		}
+		return nil, 0, src.readError(err)
+	}
+	if err := verifySum(sum, src); err != nil {
+		payload.reader().Close()
+		return nil, 0, err
+	}
+	if check != nil {
+		if err := check.verify(env); err != nil {
+			payload.reader().Close()
+			return nil, 0, err
+		}
+	}
+	if payload.size == 0 {
+		payload.reader().Close()
+		return nil, 0, ErrEmptyPayload
+	}
+	return payload.reader(), payload.size, nil
+}
+
+// verifySum checks sum, the SHA-256 of the payload as read, against src's checksum, if it has
+// one.
+func verifySum(sum hash.Hash, src *payloadSource) error {
+	if src.checksum == "" {
+		return nil
+	}
+	if got := hex.EncodeToString(sum.Sum(nil)); !strings.EqualFold(got, src.checksum) {
+		return fmt.Errorf("%s: %w: want sha256 %s, got %s", src.name, ErrChecksumMismatch, src.checksum, got)
+	}
+	return nil
+}
+
+// spooled is input read to its end: in memory while it is at most openPayloadMemory bytes,
+// otherwise in a temporary file, positioned at its start.
+type spooled struct {
+	data []byte
+	file *os.File
+	size int64
+}
+
+// spool reads r to its end, failing with a *PayloadTooLargeError, naming source, past limit
+// bytes (when limit is positive).
+func spool(ctx context.Context, r io.Reader, limit int64, source string) (*spooled, error) {
+	r = &contextReader{ctx: ctx, r: r}
+	if limit > 0 {
+		// Read one byte past the limit so an input of exactly limit bytes is still accepted.
+		r = io.LimitReader(r, limit+1)
+	}
+	tooLarge := func(n int64) bool { return limit > 0 && n > limit }
+	head, err := io.ReadAll(io.LimitReader(r, openPayloadMemory+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(head) <= openPayloadMemory {
+		if tooLarge(int64(len(head))) {
+			return nil, &PayloadTooLargeError{Source: source, Limit: limit}
+		}
+		return &spooled{data: head, size: int64(len(head))}, nil
+	}
+
+	// Payloads can hold secrets; CreateTemp makes the file readable only by the user.
+	f, err := os.CreateTemp("", "xcodex-hook-payload-*")
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(f, io.MultiReader(bytes.NewReader(head), r))
+	if err == nil && tooLarge(n) {
+		err = &PayloadTooLargeError{Source: source, Limit: limit}
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &spooled{file: f, size: n}, nil
+}
+
+func (s *spooled) reader() *payloadReader {
+	if s.file == nil {
+		return &payloadReader{Reader: bytes.NewReader(s.data)}
+	}
+	return &payloadReader{Reader: s.file, f: s.file, temp: s.file.Name()}
+}
+
+// payloadReader is the payload OpenPayload returns. Close closes its file, and removes it when it
+// is temporary, and the payload_path file marked for cleanup.
+type payloadReader struct {
+	io.Reader
+	f             *os.File
+	temp, cleanup string
+}
+
+func (p *payloadReader) Close() error {
+	var err error
+	if p.f != nil {
+		err = p.f.Close()
+	}
+	if p.temp != "" {
+		os.Remove(p.temp)
+	}
+	if p.cleanup != "" {
+		removePayloadFile(p.cleanup)
+	}
+	return err
+}
+
+// envelopeKeys are the top-level keys that make stdin an envelope to be decoded, rather than the
+// payload itself (see decodeEnvelope).
+var envelopeKeys = map[string]bool{
+	"payload":         true,
+	"payload_path":    true,
+	"payload-path":    true,
+	"payload_fd":      true,
+	"payload-fd":      true,
+	"min_sdk_version": true,
+	"min-sdk-version": true,
+}
+
+// maxEnvelopeKey bounds the keys hasEnvelopeKeys reads; longer ones are no envelope key.
+const maxEnvelopeKey = 64
+
+// hasEnvelopeKeys reports whether r holds a JSON object with one of envelopeKeys at its top level,
+// reading it through without holding its values. Input that isn't a JSON object has none; the
+// rest of it isn't checked to be valid.
+func hasEnvelopeKeys(r io.Reader) (bool, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	// next returns the next byte that isn't whitespace; ok is false at the end of the input.
+	next := func() (c byte, ok bool, err error) {
+		for {
+			c, err := br.ReadByte()
+			if err == io.EOF {
+				return 0, false, nil
+			}
+			if err != nil {
+				return 0, false, err
+			}
+			if !isJSONSpace(c) {
+				return c, true, nil
+			}
+		}
+	}
+	if c, ok, err := next(); !ok || c != '{' {
+		return false, err
+	}
+	for {
+		c, ok, err := next()
+		if !ok || c != '"' {
+			return false, err
+		}
+		key, err := readKey(br)
+		if err != nil {
+			return false, ignoreEOF(err)
+		}
+		if envelopeKeys[key] {
+			return true, nil
+		}
+		if c, ok, err := next(); !ok || c != ':' {
+			return false, err
+		}
+		if err := skipStreamValue(br); err != nil {
+			return false, ignoreEOF(err)
+		}
+		if c, ok, err := next(); !ok || c != ',' {
+			return false, err
+		}
+	}
+}
+
+// readKey reads an object key, after its opening quote, and returns it decoded, or "" when it is
+// longer than maxEnvelopeKey bytes.
+func readKey(br *bufio.Reader) (string, error) {
+	raw := []byte{'"'}
+	escaped := false
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if len(raw) <= maxEnvelopeKey {
+			raw = append(raw, c)
+		}
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			var key string
+			if len(raw) > maxEnvelopeKey || json.Unmarshal(raw, &key) != nil {
+				return "", nil
+			}
+			return key, nil
+		}
+	}
+}
+
+// skipStreamValue reads past one JSON value, stopping before the comma or closing bracket after it.
+func skipStreamValue(br *bufio.Reader) error {
+	depth := 0
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case '"':
+			if err := skipStreamString(br); err != nil {
+				return err
+			}
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return br.UnreadByte()
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return br.UnreadByte()
+			}
+		}
+	}
+}
+
+// skipStreamString reads past the rest of a string, after its opening quote, a buffer at a time.
+func skipStreamString(br *bufio.Reader) error {
+	// backslashes counts the backslashes just before what is read next; an odd number escapes it.
+	backslashes := 0
+	for {
+		chunk, err := br.ReadSlice('"')
+		if err != nil && err != bufio.ErrBufferFull {
+			return err
+		}
+		body := chunk
+		if err == nil {
+			body = chunk[:len(chunk)-1]
+		}
+		n := 0
+		for n < len(body) && body[len(body)-1-n] == '\\' {
+			n++
+		}
+		if n == len(body) {
+			backslashes += n
+		} else {
+			backslashes = n
+		}
+		if err == nil {
+			if backslashes%2 == 0 {
+				return nil
+			}
+			backslashes = 0
+		}
+	}
+}
+
+func isJSONSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,334 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// openAll reads the payload in stdin with OpenPayload, checking the size it gives and reporting
+// the temporary files open while the reader is.
+func openAll(t *testing.T, stdin []byte, env map[string]string, opts ...hooksdk.Option) (payload string, temps int, err error) {
+	t.Helper()
+	stdio, _, _ := testIO(stdin, env)
+	rc, size, err := hooksdk.OpenPayload(append(opts, hooksdk.WithIO(stdio))...)
+	if err != nil {
+		return "", 0, err
+	}
+	temps = len(tempPayloads(t))
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if size != int64(len(data)) {
+		t.Errorf("size = %d, read %d bytes", size, len(data))
+	}
+	if left := tempPayloads(t); len(left) != 0 {
+		t.Errorf("temporary files left after Close: %q", left)
+	}
+	return string(data), temps, nil
+}
+
+// tempPayloads returns OpenPayload's temporary files; the tests point TMPDIR at a directory of
+// their own.
+func tempPayloads(t *testing.T) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(os.TempDir(), "xcodex-hook-payload-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TestOpenPayloadMatchesRaw checks that OpenPayload streams what ReadPayloadRaw returns, for
+// every way a payload can arrive, and that only what can't be read twice or is checked, and is
+// past 1 MiB, is copied to a temporary file.
+func TestOpenPayloadMatchesRaw(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	small := []byte(rawPayload + "\n")
+	big := hooktest.ToolCallFinished().With("output", strings.Repeat("x", 2<<20)).Bytes()
+	env := map[string]string{hooksdk.SecretEnv: "key"}
+	for _, tt := range []struct {
+		name  string
+		stdin []byte
+		temp  bool
+	}{
+		{"bare", small, false},
+		{"bare, large", big, true},
+		{"inline", []byte(`{"payload": ` + rawPayload + `}`), false},
+		{"inline, large", inlineEnvelope(t, big, nil), false},
+		{"payload_path", pathEnvelope(t, "payload.json", small, nil), false},
+		{"payload_path, large", pathEnvelope(t, "payload.json", big, nil), false},
+		{"payload_path, gzip", pathEnvelope(t, "payload.json.gz", gzipBytes(t, small), map[string]any{"payload_encoding": "gzip"}), false},
+		{"payload_path, gzip magic", pathEnvelope(t, "payload.json", gzipBytes(t, small), nil), false},
+		{"payload_path, large gzip", pathEnvelope(t, "payload.json.gz", gzipBytes(t, big), nil), true},
+		{"payload_path, checksum", pathEnvelope(t, "payload.json", small, map[string]any{"payload_sha256": sha256Hex(small)}), false},
+		{"payload_path, large checksum", pathEnvelope(t, "payload.json", big, map[string]any{"payload_sha256": sha256Hex(big)}), true},
+		{"payload_path, gzip checksum", pathEnvelope(t, "payload.json.gz", gzipBytes(t, small), map[string]any{"payload-sha256": strings.ToUpper(sha256Hex(gzipBytes(t, small)))}), false},
+		{"payload_path, signed", pathEnvelope(t, "payload.json", big, map[string]any{"signature": hooksdk.SignPayload("key", big)}), true},
+		{"payload_path, gzip signed", pathEnvelope(t, "payload.json.gz", gzipBytes(t, small), map[string]any{"signature": hooksdk.SignPayload("key", small)}), false},
+		{"inline, signed", hooktest.SignedEnvelope(t, small, "key"), false},
+	} {
+		stdio, _, _ := testIO(tt.stdin, env)
+		want, err := hooksdk.ReadPayloadRaw(hooksdk.WithIO(stdio))
+		if err != nil {
+			t.Fatalf("%s: ReadPayloadRaw: %v", tt.name, err)
+		}
+		got, temps, err := openAll(t, tt.stdin, env)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != string(want) {
+			t.Errorf("%s: OpenPayload read %d bytes, ReadPayloadRaw %d; they differ", tt.name, len(got), len(want))
+		}
+		if (temps > 0) != tt.temp {
+			t.Errorf("%s: %d temporary files open, want temporary %v", tt.name, temps, tt.temp)
+		}
+	}
+
+	// Unlike ReadPayloadRaw, OpenPayload doesn't check that the payload is JSON.
+	stdin := pathEnvelope(t, "payload.json", []byte(`{"a":`), nil)
+	if got, _, err := openAll(t, stdin, nil); err != nil || got != `{"a":` {
+		t.Errorf("not JSON: %q, %v", got, err)
+	}
+}
+
+func TestOpenPayloadCheckedFile(t *testing.T) {
+	// What the caller reads of a checked file is what was checked, even if the file changes after.
+	t.Setenv("TMPDIR", t.TempDir())
+	env := map[string]string{hooksdk.SecretEnv: "key"}
+	small := hooktest.SessionStart().Bytes()
+	big := hooktest.ToolCallFinished().With("output", strings.Repeat("x", 2<<20)).Bytes()
+	for name, payload := range map[string][]byte{"small": small, "large": big} {
+		for check, fields := range map[string]map[string]any{
+			"checksum": {"payload_sha256": sha256Hex(payload)},
+			"signed":   {"signature": hooksdk.SignPayload("key", payload)},
+		} {
+			stdin := pathEnvelope(t, "payload.json", payload, fields)
+			var envelope map[string]any
+			if err := json.Unmarshal(stdin, &envelope); err != nil {
+				t.Fatal(err)
+			}
+			stdio, _, _ := testIO(stdin, env)
+			rc, size, err := hooksdk.OpenPayload(hooksdk.WithIO(stdio))
+			if err != nil {
+				t.Fatalf("%s, %s: %v", name, check, err)
+			}
+			swapped := bytes.Repeat([]byte("y"), len(payload))
+			if err := os.WriteFile(envelope["payload_path"].(string), swapped, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil || !bytes.Equal(got, payload) || size != int64(len(payload)) {
+				t.Errorf("%s, %s: read %d bytes (size %d), %v; want the payload as checked", name, check, len(got), size, err)
+			}
+		}
+	}
+	if n := len(tempPayloads(t)); n != 0 {
+		t.Errorf("%d temporary files left", n)
+	}
+}
+
+func TestOpenPayloadErrors(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	payload := hooktest.SessionStart().Bytes()
+	big := hooktest.ToolCallFinished().With("output", strings.Repeat("x", 2<<20)).Bytes()
+	env := map[string]string{hooksdk.SecretEnv: "key"}
+	var tooLarge *hooksdk.PayloadTooLargeError
+	for _, tt := range []struct {
+		name  string
+		stdin []byte
+		opts  []hooksdk.Option
+		is    error
+		as    any
+	}{
+		{"empty file", pathEnvelope(t, "payload.json", nil, nil), nil, hooksdk.ErrEmptyPayload, nil},
+		{"empty stdin", []byte(" \n"), nil, hooksdk.ErrEmptyPayload, nil},
+		{"missing file", []byte(`{"payload_path": "` + filepath.Join(t.TempDir(), "gone.json") + `"}`), nil, os.ErrNotExist, nil},
+		{"checksum", pathEnvelope(t, "payload.json", payload, map[string]any{"payload_sha256": sha256Hex([]byte("other"))}), nil, hooksdk.ErrChecksumMismatch, nil},
+		{"gzip checksum", pathEnvelope(t, "payload.json.gz", gzipBytes(t, big), map[string]any{"payload_sha256": sha256Hex(big)}), nil, hooksdk.ErrChecksumMismatch, nil},
+		{"not gzip", pathEnvelope(t, "payload.json", payload, map[string]any{"payload_encoding": "gzip"}), nil, nil, nil},
+		{"signature", pathEnvelope(t, "payload.json", payload, map[string]any{"signature": hooksdk.SignPayload("other", payload)}), nil, hooksdk.ErrBadSignature, nil},
+		{"large signature", pathEnvelope(t, "payload.json.gz", gzipBytes(t, big), map[string]any{"signature": hooksdk.SignPayload("other", big)}), nil, hooksdk.ErrBadSignature, nil},
+		{"unsigned", payload, []hooksdk.Option{hooksdk.RequireSignature()}, hooksdk.ErrSignatureMissing, nil},
+		{"unsigned, large", big, []hooksdk.Option{hooksdk.RequireSignature()}, hooksdk.ErrSignatureMissing, nil},
+		{"too large stdin", big, []hooksdk.Option{hooksdk.WithMaxPayloadBytes(1 << 20)}, nil, &tooLarge},
+		{"too large file", pathEnvelope(t, "payload.json", big, nil), []hooksdk.Option{hooksdk.WithMaxPayloadBytes(1 << 20)}, nil, &tooLarge},
+		{"too large gzip", pathEnvelope(t, "payload.json.gz", gzipBytes(t, big), nil), []hooksdk.Option{hooksdk.WithMaxPayloadBytes(1 << 20)}, nil, &tooLarge},
+		{"bad envelope", []byte(`{"payload_path": 7}`), nil, hooksdk.ErrInvalidEnvelope, nil},
+	} {
+		_, _, err := openAll(t, tt.stdin, env, tt.opts...)
+		switch {
+		case err == nil:
+			t.Errorf("%s: OpenPayload succeeded", tt.name)
+		case tt.is != nil && !errors.Is(err, tt.is):
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.is)
+		case tt.as != nil && !errors.As(err, tt.as):
+			t.Errorf("%s: error = %v, want a %T", tt.name, err, tt.as)
+		}
+		// ReadPayloadRaw fails the same way.
+		stdio, _, _ := testIO(tt.stdin, env)
+		if _, rawErr := hooksdk.ReadPayloadRaw(append(tt.opts, hooksdk.WithIO(stdio))...); rawErr == nil {
+			t.Errorf("%s: ReadPayloadRaw succeeded", tt.name)
+		}
+		if left := tempPayloads(t); len(left) != 0 {
+			t.Errorf("%s: temporary files left: %q", tt.name, left)
+		}
+	}
+}
+
+func TestOpenPayloadCleanup(t *testing.T) {
+	payload := hooktest.SessionStart().Bytes()
+	path := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdin, _ := json.Marshal(map[string]any{"payload_path": path, "cleanup": true})
+	stdio, _, _ := testIO(stdin, nil)
+	rc, _, err := hooksdk.OpenPayload(hooksdk.WithIO(stdio))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file is read where it is, so it stays until Close.
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("payload file removed before Close: %v", err)
+	}
+	io.Copy(io.Discard, rc)
+	rc.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("payload file marked for cleanup is still there: %v", err)
+	}
+}
+
+func TestOpenPayloadFD(t *testing.T) {
+	skipWithoutFDs(t)
+	payload := hooktest.ToolCallStarted().WithSessionID("s-fd").With("output", strings.Repeat("y", 2<<20)).Bytes()
+	for name, extra := range map[string][]byte{"plain": payload, "gzip": gzipBytes(t, payload)} {
+		got, err := runWithFD(t, []byte(`{"payload_fd": 3}`), extra, "HOOKSDK_TEST_OPEN_PAYLOAD=1")
+		if err != nil || got != fmt.Sprintf("%d|%s", len(payload), sha256Hex(payload)) {
+			t.Errorf("%s payload_fd: %q, %v", name, got, err)
+		}
+	}
+}
+
+// TestOpenPayloadMemory checks that streaming a large payload_path file takes about the same
+// memory however large it is, where ReadPayloadRaw holds all of it.
+func TestOpenPayloadMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes a 32 MB payload")
+	}
+	stdin := largePayloadEnvelope(t, 32<<20)
+	allocated := func(read func()) uint64 {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		read()
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+	streamed := allocated(func() {
+		stdio, _, _ := testIO(stdin, nil)
+		rc, _, err := hooksdk.OpenPayload(hooksdk.WithIO(stdio))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rc.Close()
+		if _, err := io.Copy(io.Discard, rc); err != nil {
+			t.Fatal(err)
+		}
+	})
+	buffered := allocated(func() {
+		stdio, _, _ := testIO(stdin, nil)
+		if _, err := hooksdk.ReadPayloadRaw(hooksdk.WithIO(stdio)); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if streamed > 4<<20 || buffered < 32<<20 {
+		t.Errorf("OpenPayload allocated %d bytes, ReadPayloadRaw %d, for a 32 MB payload", streamed, buffered)
+	}
+}
+
+// largePayloadEnvelope writes a payload of size bytes to a payload_path file and returns the
+// envelope pointing at it.
+func largePayloadEnvelope(t testing.TB, size int) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "payload.json")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := `{"xcodex_event_type":"tool-call-finished","output":"`
+	chunk := strings.Repeat("x", 1<<10)
+	fmt.Fprint(f, head)
+	for n := len(head) + 2; n < size; n += len(chunk) {
+		fmt.Fprint(f, chunk)
+	}
+	fmt.Fprint(f, `"}`)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	stdin, _ := json.Marshal(map[string]string{"payload_path": path})
+	return stdin
+}
+
+// BenchmarkOpenPayload streams a 100 MB payload_path payload, past the default limit: the
+// allocations per op stay at a few buffers, where BenchmarkReadPayloadRaw's grow with the payload.
+func BenchmarkOpenPayload(b *testing.B) {
+	stdin := largePayloadEnvelope(b, 100<<20)
+	b.SetBytes(100 << 20)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stdio, _, _ := testIO(stdin, nil)
+		rc, _, err := hooksdk.OpenPayload(hooksdk.WithIO(stdio), hooksdk.WithMaxPayloadBytes(200<<20))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, rc); err != nil {
+			b.Fatal(err)
+		}
+		rc.Close()
+	}
+}
+
+// BenchmarkOpenPayloadStdin streams a 100 MB bare payload from stdin, through a temporary file.
+func BenchmarkOpenPayloadStdin(b *testing.B) {
+	b.Setenv("TMPDIR", b.TempDir())
+	payload := hooktest.ToolCallFinished().With("output", strings.Repeat("x", 100<<20)).Bytes()
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stdio, _, _ := testIO(payload, nil)
+		rc, _, err := hooksdk.OpenPayload(hooksdk.WithIO(stdio), hooksdk.WithMaxPayloadBytes(200<<20))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, rc); err != nil {
+			b.Fatal(err)
+		}
+		rc.Close()
+	}
+}
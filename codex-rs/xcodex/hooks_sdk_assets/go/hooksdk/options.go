@@ -0,0 +1,169 @@
+package hooksdk
+
+import "time"
+
+// Option configures how payloads are read and parsed (and, for Run, how the handler is run).
+// Options are accepted by ReadPayload, ReadPayloadFrom, ParseHookPayload, and Run (and, for
+// WithIO and WithDryRun, by WriteResponse).
+type Option func(*options)
+
+type options struct {
+	strictFields       bool
+	validate           bool
+	rawJSON            bool
+	cleanupPayloadFile bool
+	requireChecksum    bool
+	requireSignature   bool
+	hasMaxPayloadBytes bool
+	maxPayloadBytes    int64
+	hasPayloadRetry    bool
+	payloadRetry       time.Duration
+	panicResponse      Response
+	hasPanicResponse   bool
+	// errorPolicy is set by WithErrorPolicy; 0 means none.
+	errorPolicy     ErrorPolicy
+	hasTimeout      bool
+	timeout         time.Duration
+	timeoutResponse Response
+	shutdownGrace   time.Duration
+	invalidUTF8     InvalidUTF8Policy
+	dryRun          bool
+	hasDebugDir     bool
+	debugDir        string
+	// envelopeVersion is the stdin envelope's schema_version, if it had one.
+	envelopeVersion *int
+	// payloadFormat is set by WithPayloadFormat.
+	payloadFormat PayloadFormat
+	// decoded is the envelope's CBOR payload as it was decoded, for ParseHookPayload.
+	decoded map[string]any
+	// capture records the read for WithDebugCapture, if it is on.
+	capture *debugCapture
+	// restrictPayloadPath is set by WithAllowedPayloadDirs; allowedPayloadDirs are its dirs.
+	restrictPayloadPath bool
+	allowedPayloadDirs  []string
+	// selfTest builds the checks of WithSelfTest.
+	selfTest func() []Check
+	// stdio is the process state set with WithIO.
+	stdio IO
+	// reloads are the WithReload functions, for Serve.
+	reloads []reloader
+	// skips are the WithFilter and Mux.SkipUnhandled checks, for Run.
+	skips []func(t EventType) (Response, bool)
+}
+
+// skip returns the response for an event of type t that Run answers without decoding it; skip is
+// false when the handler should see it.
+func (o *options) skip(t EventType) (resp Response, skip bool) {
+	for _, check := range o.skips {
+		if resp, skip := check(t); skip {
+			return resp, true
+		}
+	}
+	return Response{}, false
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{panicResponse: Allow()}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	if !o.hasMaxPayloadBytes {
+		o.maxPayloadBytes = o.stdio.Environ().MaxPayloadBytes
+	}
+	if !o.hasPayloadRetry {
+		o.payloadRetry = o.stdio.Environ().PayloadRetry
+	}
+	return o
+}
+
+// WithStrictFields makes parsing fail with an *UnknownFieldsError when the payload contains fields
+// the typed HookPayload doesn't model. By default such fields are kept in RawPayload (see
+// HookPayload.UnknownFields to log drift without failing).
+func WithStrictFields() Option {
+	return func(o *options) { o.strictFields = true }
+}
+
+// WithValidation checks the raw payload against the embedded JSON Schema of its event type (see
+// ValidatePayload) before decoding it, so a malformed payload fails with a *SchemaError listing
+// every violation instead of decoding to zero values. Unknown event types are not validated.
+func WithValidation() Option {
+	return func(o *options) { o.validate = true }
+}
+
+// WithRawJSON keeps the payload's bytes as they were read, before any schema migration, so
+// HookPayload.RawJSON can return them, e.g. to forward the payload exactly as the host sent it.
+func WithRawJSON() Option {
+	return func(o *options) { o.rawJSON = true }
+}
+
+// WithCleanupPayloadFile removes the `payload_path` file after it has been read successfully, even
+// when the envelope doesn't set `"cleanup": true`. A failed removal is logged to stderr and does not
+// fail the read.
+func WithCleanupPayloadFile() Option {
+	return func(o *options) { o.cleanupPayloadFile = true }
+}
+
+// RequireChecksum rejects payload_path envelopes that don't carry a `payload_sha256` with
+// ErrChecksumMissing. Payloads sent directly on stdin are not affected. A checksum that is present
+// is always verified, with or without this option.
+func RequireChecksum() Option {
+	return func(o *options) { o.requireChecksum = true }
+}
+
+// RequireSignature rejects payloads that can't be authenticated: one without an envelope
+// `signature` fails with ErrSignatureMissing, and so does any payload when CODEX_HOOK_SECRET is
+// unset. Use it for hooks with side effects (webhooks, audit records) that a crafted payload must
+// not trigger. A signature that is present is verified whenever the secret is set.
+func RequireSignature() Option {
+	return func(o *options) { o.requireSignature = true }
+}
+
+// WithMaxPayloadBytes caps how many bytes are read from stdin and from the payload_path file
+// (after decompression), failing with a *PayloadTooLargeError beyond it. It takes precedence over
+// CODEX_HOOK_MAX_PAYLOAD; n <= 0 disables the limit.
+func WithMaxPayloadBytes(n int64) Option {
+	return func(o *options) {
+		o.maxPayloadBytes = n
+		o.hasMaxPayloadBytes = true
+	}
+}
+
+// WithPanicDecision sets the response Run writes when the handler panics (Allow by default, or
+// that of WithErrorPolicy), e.g. WithPanicDecision(Deny("hook crashed")) for hooks that must fail
+// closed.
+func WithPanicDecision(resp Response) Option {
+	return func(o *options) {
+		o.panicResponse = resp
+		o.hasPanicResponse = true
+	}
+}
+
+// WithDryRun puts the hook in dry-run mode, to watch what a new rule would do before enforcing
+// it: the handler runs as usual, but Run and WriteResponse write a deny or ask as an allow and
+// leave out Modify sections. What they leave out is kept in the response's Metadata.WouldHave and
+// appended to `$CODEX_HOME/dryrun.jsonl` (DryRunFile) with the hook's metadata. Responses that
+// allow without changing anything are written exactly as without it. CODEX_HOOK_DRY_RUN turns
+// the mode on without rebuilding the hook (see DryRunEnv).
+func WithDryRun() Option {
+	return func(o *options) { o.dryRun = true }
+}
+
+// checkRaw applies the checks selected by the options to a payload before it is decoded.
+func (o *options) checkRaw(data []byte) error {
+	if o.validate {
+		return ValidatePayload(data)
+	}
+	return nil
+}
+
+// checkPayload applies the parse-time checks selected by the options to a decoded payload.
+func (o *options) checkPayload(p *HookPayload) error {
+	if o.strictFields {
+		if unknown := p.UnknownFields(); len(unknown) > 0 {
+			return &UnknownFieldsError{EventType: p.EventType(), Fields: unknown}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package otel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+const scopeName = "xcodex-hooks-sdk/otel"
+
+// Protocols an Exporter speaks. gRPC needs a gRPC stack and is not supported.
+const (
+	ProtocolProtobuf = "http/protobuf"
+	ProtocolJSON     = "http/json"
+)
+
+const (
+	defaultEndpoint    = "http://localhost:4318"
+	defaultTimeout     = 10 * time.Second
+	defaultServiceName = "xcodex"
+)
+
+// Exporter sends spans to an OTLP/HTTP traces endpoint.
+type Exporter struct {
+	// Endpoint is the full traces URL, e.g. http://localhost:4318/v1/traces.
+	Endpoint string
+	// Protocol is ProtocolProtobuf (the default when empty) or ProtocolJSON.
+	Protocol string
+	Headers  http.Header
+	// Gzip compresses request bodies.
+	Gzip bool
+	// Timeout bounds an Export, retries included.
+	Timeout time.Duration
+	// Resource describes the process producing the spans (service.name and friends).
+	Resource []Attribute
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// ExporterFromEnv configures an Exporter from the standard OTLP environment variables; the
+// traces-specific form of each wins over the general one:
+//
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT   full URL, used as is
+//	OTEL_EXPORTER_OTLP_ENDPOINT          base URL, /v1/traces is appended (default http://localhost:4318)
+//	OTEL_EXPORTER_OTLP_[TRACES_]HEADERS      key=value,key2=value2 (values URL-encoded)
+//	OTEL_EXPORTER_OTLP_[TRACES_]PROTOCOL     http/protobuf (default) or http/json
+//	OTEL_EXPORTER_OTLP_[TRACES_]TIMEOUT      milliseconds (default 10000)
+//	OTEL_EXPORTER_OTLP_[TRACES_]COMPRESSION  gzip or none
+//	OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES
+func ExporterFromEnv() (*Exporter, error) {
+	e := &Exporter{Protocol: ProtocolProtobuf, Timeout: defaultTimeout}
+
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); v != "" {
+		e.Endpoint = v
+	} else {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			base = defaultEndpoint
+		}
+		e.Endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if _, err := url.ParseRequestURI(e.Endpoint); err != nil {
+		return nil, fmt.Errorf("otel: bad endpoint %q: %w", e.Endpoint, err)
+	}
+
+	if v := tracesEnv("HEADERS"); v != "" {
+		pairs, err := parsePairs(v)
+		if err != nil {
+			return nil, fmt.Errorf("otel: OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+		}
+		e.Headers = http.Header{}
+		for _, p := range pairs {
+			e.Headers.Add(p.Key, p.Value.(string))
+		}
+	}
+
+	switch v := tracesEnv("PROTOCOL"); v {
+	case "", ProtocolProtobuf:
+	case ProtocolJSON:
+		e.Protocol = ProtocolJSON
+	default:
+		return nil, fmt.Errorf("otel: unsupported protocol %q (want %s or %s)", v, ProtocolProtobuf, ProtocolJSON)
+	}
+
+	if v := tracesEnv("TIMEOUT"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("otel: bad timeout %q (want milliseconds)", v)
+		}
+		if ms > 0 {
+			e.Timeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	switch v := tracesEnv("COMPRESSION"); v {
+	case "", "none":
+	case "gzip":
+		e.Gzip = true
+	default:
+		return nil, fmt.Errorf("otel: unsupported compression %q", v)
+	}
+
+	resource, err := resourceFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	e.Resource = resource
+	return e, nil
+}
+
+// tracesEnv reads OTEL_EXPORTER_OTLP_TRACES_<name>, falling back to OTEL_EXPORTER_OTLP_<name>.
+func tracesEnv(name string) string {
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_" + name); v != "" {
+		return v
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + name)
+}
+
+// resourceFromEnv reads OTEL_RESOURCE_ATTRIBUTES; OTEL_SERVICE_NAME overrides its service.name.
+func resourceFromEnv() ([]Attribute, error) {
+	attrs, err := parsePairs(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("otel: OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	out := []Attribute{{Key: "service.name", Value: defaultServiceName}}
+	for _, a := range attrs {
+		if a.Key == "service.name" {
+			if service == "" {
+				out[0].Value = a.Value
+			}
+			continue
+		}
+		out = append(out, a)
+	}
+	if service != "" {
+		out[0].Value = service
+	}
+	return out, nil
+}
+
+// parsePairs parses the `key=value,key2=value2` lists of the OTEL variables; values are
+// percent-decoded and blank entries skipped.
+func parsePairs(s string) ([]Attribute, error) {
+	var out []Attribute
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("malformed entry %q (want key=value)", item)
+		}
+		dv, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %w", item, err)
+		}
+		out = append(out, Attribute{Key: k, Value: dv})
+	}
+	return out, nil
+}
+
+// Export sends spans in one request. Transient failures (connection errors, 408, 429, 5xx) are retried
+// until the timeout.
+func (e *Exporter) Export(ctx context.Context, spans []Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	header := http.Header{}
+	for k, vs := range e.Headers {
+		header[k] = append([]string(nil), vs...)
+	}
+	var body []byte
+	if e.Protocol == ProtocolJSON {
+		b, err := encodeJSON(e.Resource, spans)
+		if err != nil {
+			return fmt.Errorf("otel: encode: %w", err)
+		}
+		body = b
+		header.Set("Content-Type", "application/json")
+	} else {
+		body = encodeProto(e.Resource, spans)
+		header.Set("Content-Type", "application/x-protobuf")
+	}
+	if e.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("otel: compress: %w", err)
+		}
+		body = buf.Bytes()
+		header.Set("Content-Encoding", "gzip")
+	}
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	client := &webhook.Client{URL: e.Endpoint, Header: header, Deadline: timeout, HTTPClient: e.HTTPClient}
+	if err := client.Send(ctx, body); err != nil {
+		return fmt.Errorf("otel: export %d span(s) to %s: %w", len(spans), e.Endpoint, err)
+	}
+	return nil
+}
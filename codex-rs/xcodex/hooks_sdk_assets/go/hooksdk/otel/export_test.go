@@ -0,0 +1,460 @@
+package otel_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/otel"
+)
+
+// gotSpan is a span as a collector decoded it, ids in hex.
+type gotSpan struct {
+	Trace, ID, Parent, Name string
+	Kind                    int
+	Start, End              uint64
+	Attrs                   map[string]any
+	Events                  []string
+	Status                  int
+}
+
+// gotRequest is an export request as a collector decoded it.
+type gotRequest struct {
+	header   http.Header
+	resource map[string]any
+	spans    []gotSpan
+}
+
+// collector is an OTLP/HTTP traces endpoint that decodes both protocols. Its first fail
+// requests are answered 503.
+func collector(t *testing.T, fail int32) (url string, requests chan gotRequest) {
+	t.Helper()
+	requests = make(chan gotRequest, 16)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		if calls.Add(1) <= fail {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		data, _ := io.ReadAll(body)
+		req := gotRequest{header: r.Header}
+		var err error
+		switch r.Header.Get("Content-Type") {
+		case "application/x-protobuf":
+			req.resource, req.spans, err = decodeProto(data)
+		case "application/json":
+			req.resource, req.spans, err = decodeJSON(data)
+		default:
+			err = fmt.Errorf("content type %q", r.Header.Get("Content-Type"))
+		}
+		if err != nil {
+			t.Errorf("collector: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- req
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, requests
+}
+
+// pbField is a decoded protobuf field: an integer for varint and fixed64 fields, bytes otherwise.
+type pbField struct {
+	num   int
+	n     uint64
+	bytes []byte
+}
+
+func pbFields(b []byte) ([]pbField, error) {
+	var out []pbField
+	for len(b) > 0 {
+		tag, k := binary.Uvarint(b)
+		if k <= 0 {
+			return nil, fmt.Errorf("bad tag")
+		}
+		b = b[k:]
+		f := pbField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case 0:
+			f.n, k = binary.Uvarint(b)
+			if k <= 0 {
+				return nil, fmt.Errorf("bad varint")
+			}
+			b = b[k:]
+		case 1:
+			if len(b) < 8 {
+				return nil, fmt.Errorf("short fixed64")
+			}
+			f.n, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 2:
+			n, k := binary.Uvarint(b)
+			if k <= 0 || uint64(len(b)-k) < n {
+				return nil, fmt.Errorf("bad length")
+			}
+			f.bytes, b = b[k:k+int(n)], b[k+int(n):]
+		default:
+			return nil, fmt.Errorf("wire type %d", tag&7)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// pbEach calls fn with each field numbered num of msg, decoded as a message.
+func pbEach(msg []byte, num int, fn func([]pbField) error) error {
+	fields, err := pbFields(msg)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		if f.num != num {
+			continue
+		}
+		sub, err := pbFields(f.bytes)
+		if err != nil {
+			return err
+		}
+		if err := fn(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pbAttr(kv []pbField, attrs map[string]any) error {
+	var key string
+	for _, f := range kv {
+		switch f.num {
+		case 1:
+			key = string(f.bytes)
+		case 2:
+			v, err := pbFields(f.bytes)
+			if err != nil || len(v) != 1 {
+				return fmt.Errorf("bad AnyValue")
+			}
+			switch v[0].num {
+			case 1:
+				attrs[key] = string(v[0].bytes)
+			case 2:
+				attrs[key] = v[0].n == 1
+			case 3:
+				attrs[key] = int64(v[0].n)
+			case 4:
+				attrs[key] = math.Float64frombits(v[0].n)
+			}
+		}
+	}
+	return nil
+}
+
+func decodeProto(data []byte) (map[string]any, []gotSpan, error) {
+	resource := map[string]any{}
+	var spans []gotSpan
+	err := pbEach(data, 1, func(rs []pbField) error { // ExportTraceServiceRequest.resource_spans
+		for _, f := range rs {
+			var err error
+			switch f.num {
+			case 1: // ResourceSpans.resource
+				err = pbEach(f.bytes, 1, func(kv []pbField) error { return pbAttr(kv, resource) })
+			case 2: // ResourceSpans.scope_spans
+				err = pbEach(f.bytes, 2, func(sf []pbField) error {
+					s := gotSpan{Attrs: map[string]any{}}
+					for _, f := range sf {
+						switch f.num {
+						case 1:
+							s.Trace = hex.EncodeToString(f.bytes)
+						case 2:
+							s.ID = hex.EncodeToString(f.bytes)
+						case 4:
+							s.Parent = hex.EncodeToString(f.bytes)
+						case 5:
+							s.Name = string(f.bytes)
+						case 6:
+							s.Kind = int(f.n)
+						case 7:
+							s.Start = f.n
+						case 8:
+							s.End = f.n
+						case 9:
+							kv, err := pbFields(f.bytes)
+							if err != nil {
+								return err
+							}
+							pbAttr(kv, s.Attrs)
+						case 11:
+							ev, err := pbFields(f.bytes)
+							if err != nil {
+								return err
+							}
+							for _, e := range ev {
+								if e.num == 2 {
+									s.Events = append(s.Events, string(e.bytes))
+								}
+							}
+						case 15:
+							st, err := pbFields(f.bytes)
+							if err != nil {
+								return err
+							}
+							for _, f := range st {
+								if f.num == 3 {
+									s.Status = int(f.n)
+								}
+							}
+						}
+					}
+					spans = append(spans, s)
+					return nil
+				})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return resource, spans, err
+}
+
+type jsonKV struct {
+	Key   string
+	Value struct {
+		StringValue *string
+		BoolValue   *bool
+		IntValue    *string
+		DoubleValue *float64
+	}
+}
+
+func jsonAttrs(kvs []jsonKV, attrs map[string]any) {
+	for _, kv := range kvs {
+		v := kv.Value
+		switch {
+		case v.StringValue != nil:
+			attrs[kv.Key] = *v.StringValue
+		case v.BoolValue != nil:
+			attrs[kv.Key] = *v.BoolValue
+		case v.IntValue != nil:
+			attrs[kv.Key], _ = strconv.ParseInt(*v.IntValue, 10, 64)
+		case v.DoubleValue != nil:
+			attrs[kv.Key] = *v.DoubleValue
+		}
+	}
+}
+
+func decodeJSON(data []byte) (map[string]any, []gotSpan, error) {
+	var req struct {
+		ResourceSpans []struct {
+			Resource   struct{ Attributes []jsonKV }
+			ScopeSpans []struct {
+				Scope struct{ Name string }
+				Spans []struct {
+					TraceID, SpanID, ParentSpanID, Name string
+					Kind                                int
+					StartTimeUnixNano, EndTimeUnixNano  string
+					Attributes                          []jsonKV
+					Events                              []struct{ Name string }
+					Status                              struct{ Code int }
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, nil, err
+	}
+	resource := map[string]any{}
+	var spans []gotSpan
+	for _, rs := range req.ResourceSpans {
+		jsonAttrs(rs.Resource.Attributes, resource)
+		for _, ss := range rs.ScopeSpans {
+			for _, js := range ss.Spans {
+				s := gotSpan{Trace: js.TraceID, ID: js.SpanID, Parent: js.ParentSpanID, Name: js.Name, Kind: js.Kind, Attrs: map[string]any{}, Status: js.Status.Code}
+				s.Start, _ = strconv.ParseUint(js.StartTimeUnixNano, 10, 64)
+				s.End, _ = strconv.ParseUint(js.EndTimeUnixNano, 10, 64)
+				jsonAttrs(js.Attributes, s.Attrs)
+				for _, e := range js.Events {
+					s.Events = append(s.Events, e.Name)
+				}
+				spans = append(spans, s)
+			}
+		}
+	}
+	return resource, spans, nil
+}
+
+func testSpans() []otel.Span {
+	trace := otel.TraceIDFor("s1")
+	root, child := otel.NewSpanID(), otel.NewSpanID()
+	return []otel.Span{
+		{TraceID: trace, SpanID: root, Name: "session", Kind: otel.KindInternal, Start: t0, End: t0.Add(time.Minute)},
+		{
+			TraceID: trace, SpanID: child, ParentSpanID: root, Name: "chat gpt-5", Kind: otel.KindClient,
+			Start: t0.Add(time.Second), End: t0.Add(3 * time.Second),
+			Attributes: []otel.Attribute{{Key: "model", Value: "gpt-5"}, {Key: "tokens", Value: 1200}, {Key: "ok", Value: true}, {Key: "ratio", Value: 0.5}},
+			Events:     []otel.Event{{Time: t0.Add(2 * time.Second), Name: "first-token"}},
+			Status:     otel.StatusError,
+		},
+	}
+}
+
+func wantSpans(spans []otel.Span) []gotSpan {
+	var out []gotSpan
+	for _, s := range spans {
+		g := gotSpan{Trace: s.TraceID.String(), ID: s.SpanID.String(), Name: s.Name, Kind: int(s.Kind),
+			Start: uint64(s.Start.UnixNano()), End: uint64(s.End.UnixNano()), Attrs: map[string]any{}, Status: int(s.Status)}
+		if !s.ParentSpanID.IsZero() {
+			g.Parent = s.ParentSpanID.String()
+		}
+		for _, a := range s.Attributes {
+			v := a.Value
+			if n, ok := v.(int); ok {
+				v = int64(n)
+			}
+			g.Attrs[a.Key] = v
+		}
+		for _, e := range s.Events {
+			g.Events = append(g.Events, e.Name)
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+func TestExport(t *testing.T) {
+	url, requests := collector(t, 0)
+	spans := testSpans()
+	for _, protocol := range []string{otel.ProtocolProtobuf, otel.ProtocolJSON} {
+		for _, gz := range []bool{false, true} {
+			e := &otel.Exporter{
+				Endpoint: url + "/v1/traces",
+				Protocol: protocol,
+				Gzip:     gz,
+				Headers:  http.Header{"Authorization": {"Bearer t"}},
+				Resource: []otel.Attribute{{Key: "service.name", Value: "xcodex"}},
+			}
+			if err := e.Export(context.Background(), spans); err != nil {
+				t.Fatalf("%s gzip=%v: %v", protocol, gz, err)
+			}
+			r := <-requests
+			if r.header.Get("Authorization") != "Bearer t" {
+				t.Errorf("%s: headers = %v", protocol, r.header)
+			}
+			if r.resource["service.name"] != "xcodex" {
+				t.Errorf("%s: resource = %v", protocol, r.resource)
+			}
+			if want := wantSpans(spans); !reflect.DeepEqual(r.spans, want) {
+				t.Errorf("%s gzip=%v: collector got\n%+v\nwant\n%+v", protocol, gz, r.spans, want)
+			}
+		}
+	}
+
+	// No spans, no request.
+	if err := (&otel.Exporter{Endpoint: url + "/v1/traces"}).Export(context.Background(), nil); err != nil || len(requests) != 0 {
+		t.Errorf("Export(nil) = %v with %d requests", err, len(requests))
+	}
+}
+
+func TestExportRetries(t *testing.T) {
+	url, requests := collector(t, 2)
+	if err := (&otel.Exporter{Endpoint: url + "/v1/traces"}).Export(context.Background(), testSpans()); err != nil {
+		t.Fatalf("Export after two 503s: %v", err)
+	}
+	if r := <-requests; len(r.spans) != 2 {
+		t.Errorf("spans = %+v", r.spans)
+	}
+
+	err := (&otel.Exporter{Endpoint: url + "/wrong"}).Export(context.Background(), testSpans())
+	if err == nil || !strings.Contains(err.Error(), "2 span(s)") {
+		t.Errorf("Export to a 404 = %v", err)
+	}
+}
+
+func TestExporterFromEnv(t *testing.T) {
+	for _, k := range []string{"ENDPOINT", "HEADERS", "PROTOCOL", "TIMEOUT", "COMPRESSION"} {
+		t.Setenv("OTEL_EXPORTER_OTLP_"+k, "")
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_"+k, "")
+	}
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "")
+
+	e, err := otel.ExporterFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Endpoint != "http://localhost:4318/v1/traces" || e.Protocol != otel.ProtocolProtobuf || e.Timeout != 10*time.Second || e.Gzip {
+		t.Errorf("defaults = %+v", e)
+	}
+	if !reflect.DeepEqual(e.Resource, []otel.Attribute{{Key: "service.name", Value: "xcodex"}}) {
+		t.Errorf("default resource = %v", e.Resource)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "https://otel.example.com:4318/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-api-key=a%20b, x-team=infra")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "http/json")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+	t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "2500")
+	t.Setenv("OTEL_EXPORTER_OTLP_COMPRESSION", "gzip")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "service.name=ignored,deployment.environment=ci")
+	t.Setenv("OTEL_SERVICE_NAME", "agents")
+	if e, err = otel.ExporterFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if e.Endpoint != "https://otel.example.com:4318/v1/traces" || e.Protocol != otel.ProtocolJSON || e.Timeout != 2500*time.Millisecond || !e.Gzip {
+		t.Errorf("exporter = %+v", e)
+	}
+	if e.Headers.Get("X-Api-Key") != "a b" || e.Headers.Get("X-Team") != "infra" {
+		t.Errorf("headers = %v", e.Headers)
+	}
+	want := []otel.Attribute{{Key: "service.name", Value: "agents"}, {Key: "deployment.environment", Value: "ci"}}
+	if !reflect.DeepEqual(e.Resource, want) {
+		t.Errorf("resource = %v, want %v", e.Resource, want)
+	}
+
+	// The traces endpoint is used as is.
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://collector/custom")
+	if e, _ := otel.ExporterFromEnv(); e.Endpoint != "http://collector/custom" {
+		t.Errorf("endpoint = %s", e.Endpoint)
+	}
+
+	for k, v := range map[string]string{
+		"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL": "grpc",
+		"OTEL_EXPORTER_OTLP_TIMEOUT":         "soon",
+		"OTEL_EXPORTER_OTLP_COMPRESSION":     "zstd",
+		"OTEL_EXPORTER_OTLP_HEADERS":         "novalue",
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "not a url",
+		"OTEL_RESOURCE_ATTRIBUTES":           "a=%zz",
+	} {
+		t.Run(k, func(t *testing.T) {
+			t.Setenv(k, v)
+			if _, err := otel.ExporterFromEnv(); err == nil {
+				t.Errorf("%s=%q accepted", k, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package otel
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// The OTLP/JSON encoding: protobuf JSON with lowerCamelCase names, hex trace and span ids, and
+// 64-bit integers as strings.
+
+type jsonRequest struct {
+	ResourceSpans []jsonResourceSpans `json:"resourceSpans"`
+}
+
+type jsonResourceSpans struct {
+	Resource   jsonResource     `json:"resource"`
+	ScopeSpans []jsonScopeSpans `json:"scopeSpans"`
+}
+
+type jsonResource struct {
+	Attributes []jsonKeyValue `json:"attributes,omitempty"`
+}
+
+type jsonScopeSpans struct {
+	Scope jsonScope  `json:"scope"`
+	Spans []jsonSpan `json:"spans"`
+}
+
+type jsonScope struct {
+	Name string `json:"name"`
+}
+
+type jsonSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []jsonKeyValue `json:"attributes,omitempty"`
+	Events            []jsonEvent    `json:"events,omitempty"`
+	Status            *jsonStatus    `json:"status,omitempty"`
+}
+
+type jsonEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []jsonKeyValue `json:"attributes,omitempty"`
+}
+
+type jsonStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+type jsonKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// encodeJSON encodes the same request as encodeProto.
+func encodeJSON(resource []Attribute, spans []Span) ([]byte, error) {
+	ss := jsonScopeSpans{Scope: jsonScope{Name: scopeName}, Spans: []jsonSpan{}}
+	for _, s := range spans {
+		js := jsonSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              int(s.Kind),
+			StartTimeUnixNano: strconv.FormatUint(unixNano(s.Start), 10),
+			EndTimeUnixNano:   strconv.FormatUint(unixNano(s.End), 10),
+			Attributes:        jsonAttributes(s.Attributes),
+		}
+		if !s.ParentSpanID.IsZero() {
+			js.ParentSpanID = s.ParentSpanID.String()
+		}
+		for _, e := range s.Events {
+			js.Events = append(js.Events, jsonEvent{
+				TimeUnixNano: strconv.FormatUint(unixNano(e.Time), 10),
+				Name:         e.Name,
+				Attributes:   jsonAttributes(e.Attributes),
+			})
+		}
+		if s.Status != StatusUnset || s.StatusMessage != "" {
+			js.Status = &jsonStatus{Message: s.StatusMessage, Code: int(s.Status)}
+		}
+		ss.Spans = append(ss.Spans, js)
+	}
+	return json.Marshal(jsonRequest{ResourceSpans: []jsonResourceSpans{{
+		Resource:   jsonResource{Attributes: jsonAttributes(resource)},
+		ScopeSpans: []jsonScopeSpans{ss},
+	}}})
+}
+
+func jsonAttributes(attrs []Attribute) []jsonKeyValue {
+	var out []jsonKeyValue
+	for _, a := range attrs {
+		var v map[string]any
+		switch x := normalizeValue(a.Value).(type) {
+		case string:
+			v = map[string]any{"stringValue": x}
+		case bool:
+			v = map[string]any{"boolValue": x}
+		case int64:
+			v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+		case float64:
+			v = map[string]any{"doubleValue": x}
+		}
+		out = append(out, jsonKeyValue{Key: a.Key, Value: v})
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+// Package otel turns hook events into OpenTelemetry spans and exports them over OTLP/HTTP, using
+// only the standard library.
+//
+// Paired events become spans: session-start/session-end, user-prompt-submit/agent-turn-complete
+// (a turn), model-request-started/model-response-completed, and tool-call-started/finished. Other
+// events become zero-length spans carrying a span event of the same name. Every span of a session
+// shares one trace id; tool calls and model requests are children of their turn, and turns of the
+// session span. Because each hook runs in a fresh process, a Tracer keeps the ids of open spans
+// in a per-session state file.
+//
+//	exp, err := otel.ExporterFromEnv() // OTEL_EXPORTER_OTLP_* settings
+//	spans, err := otel.NewTracer(stateDir).Observe(payload)
+//	err = exp.Export(ctx, spans)
+package otel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// TraceID identifies a trace (see TraceIDFor).
+type TraceID [16]byte
+
+// SpanID identifies a span; the zero SpanID means "no parent".
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// IsZero reports whether id is unset.
+func (id SpanID) IsZero() bool { return id == SpanID{} }
+
+// NewSpanID returns a random span id.
+func NewSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
+
+// parseSpanID decodes an id stored as hex; invalid input yields the zero id.
+func parseSpanID(s string) SpanID {
+	var id SpanID
+	if b, err := hex.DecodeString(s); err == nil && len(b) == len(id) {
+		copy(id[:], b)
+	}
+	return id
+}
+
+// SpanKind is the OTLP span kind.
+type SpanKind int
+
+const (
+	KindUnspecified SpanKind = 0
+	KindInternal    SpanKind = 1
+	KindServer      SpanKind = 2
+	KindClient      SpanKind = 3
+)
+
+// StatusCode is the OTLP span status code.
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key/value pair. Value is a string, bool, int64, or float64; other types are
+// exported as their fmt.Sprint string.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Event is a timestamped annotation on a span.
+type Event struct {
+	Time       time.Time
+	Name       string
+	Attributes []Attribute
+}
+
+// Span is a finished span, ready to export.
+type Span struct {
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Name         string
+	Kind         SpanKind
+	Start, End   time.Time
+	Attributes   []Attribute
+	Events       []Event
+	Status       StatusCode
+	// StatusMessage describes an error status.
+	StatusMessage string
+}
@@ -0,0 +1,139 @@
+package otel
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// The protobuf encoding of opentelemetry.proto.collector.trace.v1.ExportTraceServiceRequest,
+// written by hand to keep the SDK free of dependencies. Only the fields we produce are encoded.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+type pbuf []byte
+
+func (b pbuf) tag(field, wire int) pbuf {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wire))
+}
+
+func (b pbuf) varint(field int, v uint64) pbuf {
+	if v == 0 {
+		return b
+	}
+	return binary.AppendUvarint(b.tag(field, wireVarint), v)
+}
+
+func (b pbuf) fixed64(field int, v uint64) pbuf {
+	if v == 0 {
+		return b
+	}
+	return binary.LittleEndian.AppendUint64(b.tag(field, wireFixed64), v)
+}
+
+func (b pbuf) bytes(field int, v []byte) pbuf {
+	b = binary.AppendUvarint(b.tag(field, wireBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func (b pbuf) str(field int, s string) pbuf {
+	if s == "" {
+		return b
+	}
+	return b.bytes(field, []byte(s))
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// encodeProto encodes one ResourceSpans holding spans under a single instrumentation scope.
+func encodeProto(resource []Attribute, spans []Span) []byte {
+	var res pbuf
+	for _, a := range resource {
+		res = res.bytes(1, protoKeyValue(a)) // Resource.attributes
+	}
+	scope := pbuf(nil).str(1, scopeName) // InstrumentationScope.name
+	ss := pbuf(nil).bytes(1, scope)      // ScopeSpans.scope
+	for _, s := range spans {
+		ss = ss.bytes(2, protoSpan(s)) // ScopeSpans.spans
+	}
+	rs := pbuf(nil).bytes(1, res).bytes(2, ss) // ResourceSpans.resource, .scope_spans
+	return pbuf(nil).bytes(1, rs)              // ExportTraceServiceRequest.resource_spans
+}
+
+func protoSpan(s Span) []byte {
+	var b pbuf
+	b = b.bytes(1, s.TraceID[:]).bytes(2, s.SpanID[:])
+	if !s.ParentSpanID.IsZero() {
+		b = b.bytes(4, s.ParentSpanID[:])
+	}
+	b = b.str(5, s.Name).varint(6, uint64(s.Kind))
+	b = b.fixed64(7, unixNano(s.Start)).fixed64(8, unixNano(s.End))
+	for _, a := range s.Attributes {
+		b = b.bytes(9, protoKeyValue(a))
+	}
+	for _, e := range s.Events {
+		ev := pbuf(nil).fixed64(1, unixNano(e.Time)).str(2, e.Name)
+		for _, a := range e.Attributes {
+			ev = ev.bytes(3, protoKeyValue(a))
+		}
+		b = b.bytes(11, ev)
+	}
+	if s.Status != StatusUnset || s.StatusMessage != "" {
+		st := pbuf(nil).str(2, s.StatusMessage).varint(3, uint64(s.Status))
+		b = b.bytes(15, st)
+	}
+	return b
+}
+
+func protoKeyValue(a Attribute) []byte {
+	var v pbuf
+	switch x := normalizeValue(a.Value).(type) {
+	case string:
+		v = v.bytes(1, []byte(x)) // string_value; written even when empty to keep the type
+	case bool:
+		v = binary.AppendUvarint(v.tag(2, wireVarint), boolInt(x))
+	case int64:
+		v = binary.AppendUvarint(v.tag(3, wireVarint), uint64(x))
+	case float64:
+		v = binary.LittleEndian.AppendUint64(v.tag(4, wireFixed64), math.Float64bits(x))
+	}
+	return pbuf(nil).str(1, a.Key).bytes(2, v)
+}
+
+func boolInt(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// normalizeValue maps attribute values onto the four types OTLP attributes are exported as.
+func normalizeValue(v any) any {
+	switch x := v.(type) {
+	case string, bool, int64, float64:
+		return x
+	case int:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case uint32:
+		return int64(x)
+	case float32:
+		return float64(x)
+	case time.Duration:
+		return int64(x)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,410 @@
+package otel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/atomicfile"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+const lockTimeout = 5 * time.Second
+
+// IncompleteAttribute marks spans that were still open when their session (or turn) ended, so
+// their end time is when that was noticed rather than when the work finished.
+const IncompleteAttribute = "xcodex.incomplete"
+
+// TraceIDFor is the trace id of a session: derived from the session id, so spans of one session
+// share a trace even if the state file is lost.
+func TraceIDFor(session string) TraceID {
+	sum := sha256.Sum256([]byte("xcodex-session:" + session))
+	var id TraceID
+	copy(id[:], sum[:])
+	return id
+}
+
+// Tracer turns events into spans, keeping the spans that are still open in per-session state
+// files in Dir.
+type Tracer struct {
+	Dir string
+	// Now is the clock for events without a timestamp; nil means time.Now.
+	Now func() time.Time
+}
+
+// NewTracer returns a Tracer storing its state in dir.
+func NewTracer(dir string) *Tracer {
+	return &Tracer{Dir: dir}
+}
+
+// openSpan is a started span, as kept in the state file.
+type openSpan struct {
+	SpanID string     `json:"span_id"`
+	Parent string     `json:"parent,omitempty"`
+	Name   string     `json:"name"`
+	Kind   SpanKind   `json:"kind,omitempty"`
+	Start  time.Time  `json:"start"`
+	Attrs  attributes `json:"attrs,omitempty"`
+}
+
+// state is one session's state file.
+type state struct {
+	Session *openSpan `json:"session,omitempty"`
+	Turn    *openSpan `json:"turn,omitempty"`
+	// Open holds model requests ("model:<id>") and tool calls ("tool:<call id>").
+	Open map[string]*openSpan `json:"open,omitempty"`
+}
+
+// attributes survive a JSON round trip with their types: numbers come back as int64 when integral.
+type attributes []Attribute
+
+func (a *attributes) UnmarshalJSON(data []byte) error {
+	var raw []struct {
+		Key   string `json:"Key"`
+		Value any    `json:"Value"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	*a = make(attributes, 0, len(raw))
+	for _, kv := range raw {
+		v := kv.Value
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				v = i
+			} else {
+				v, _ = n.Float64()
+			}
+		}
+		*a = append(*a, Attribute{Key: kv.Key, Value: v})
+	}
+	return nil
+}
+
+// Observe records p in the session's state and returns the spans it finished: an end event
+// (`session-end`, `agent-turn-complete`, `model-response-completed`, `tool-call-finished`)
+// finishes its span, `session-end` also finishes whatever is left open, and events without a
+// partner become zero-length spans holding a span event. Begin events return no spans. Events
+// without a session id are ignored.
+func (t *Tracer) Observe(p *hooksdk.HookPayload) ([]Span, error) {
+	session := p.SessionID()
+	if session == "" {
+		return nil, nil
+	}
+	var spans []Span
+	err := t.locked(func() error {
+		path := t.statePath(session)
+		st, err := load(path)
+		if err != nil {
+			return err
+		}
+		b := &builder{trace: TraceIDFor(session), session: session, st: st, at: t.eventTime(p)}
+		b.observe(p)
+		spans = b.spans
+		if p.EventType() == "session-end" {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			return nil
+		}
+		return atomicfile.WriteJSON(path, st)
+	})
+	return spans, err
+}
+
+// builder applies one event to a session's state.
+type builder struct {
+	trace   TraceID
+	session string
+	st      *state
+	at      time.Time
+	spans   []Span
+}
+
+func (b *builder) observe(p *hooksdk.HookPayload) {
+	raw := p.RawPayload
+	str := func(key string) string {
+		s, _ := hooksdk.StringField(raw, key)
+		return s
+	}
+	event := p.EventType()
+	b.ensureSession(p)
+
+	switch event {
+	case "session-start":
+		// Opened by ensureSession.
+	case "session-end":
+		b.endAll()
+		b.finish(b.st.Session, b.at, eventAttrs(p), StatusUnset, "")
+		b.st.Session = nil
+	case "user-prompt-submit":
+		if b.st.Turn != nil {
+			b.closeIncomplete(b.st.Turn)
+		}
+		attrs := attributes{{Key: "xcodex.turn.prompt_length", Value: int64(len(str("prompt")))}}
+		b.st.Turn = b.open("turn", KindInternal, b.st.Session.SpanID, attrs)
+	case "agent-turn-complete":
+		turn := b.st.Turn
+		if turn == nil {
+			b.single(p)
+			return
+		}
+		// Work the turn left unfinished can't outlive it.
+		for key, s := range b.st.Open {
+			if s.Parent == turn.SpanID {
+				b.closeIncomplete(s)
+				delete(b.st.Open, key)
+			}
+		}
+		b.finish(turn, b.at, eventAttrs(p), StatusUnset, "")
+		b.st.Turn = nil
+	case "model-request-started":
+		id := str("model_request_id")
+		if id == "" {
+			b.single(p)
+			return
+		}
+		model := str("model")
+		attrs := attributes{
+			{Key: "gen_ai.operation.name", Value: "chat"},
+			{Key: "gen_ai.request.model", Value: model},
+		}
+		if provider := str("provider"); provider != "" {
+			attrs = append(attrs, Attribute{Key: "gen_ai.provider.name", Value: provider})
+		}
+		if attempt, ok := hooksdk.IntField(raw, "attempt"); ok {
+			attrs = append(attrs, Attribute{Key: "xcodex.model_request.attempt", Value: attempt})
+		}
+		b.st.Open["model:"+id] = b.open(spanName("chat", model), KindClient, b.parent(), attrs)
+	case "model-response-completed":
+		id := str("model_request_id")
+		s := b.st.Open["model:"+id]
+		if id == "" || s == nil {
+			s = b.open(spanName("chat", str("model")), KindClient, b.parent(), nil)
+		}
+		delete(b.st.Open, "model:"+id)
+		attrs := attributes{}
+		if v := str("response_id"); v != "" {
+			attrs = append(attrs, Attribute{Key: "gen_ai.response.id", Value: v})
+		}
+		for _, u := range []struct{ field, attr string }{
+			{"input_tokens", "gen_ai.usage.input_tokens"},
+			{"output_tokens", "gen_ai.usage.output_tokens"},
+			{"cached_input_tokens", "xcodex.usage.cached_input_tokens"},
+			{"reasoning_output_tokens", "xcodex.usage.reasoning_output_tokens"},
+		} {
+			if n, ok := hooksdk.IntField(raw, "token_usage."+u.field); ok {
+				attrs = append(attrs, Attribute{Key: u.attr, Value: n})
+			}
+		}
+		b.finish(s, b.at, attrs, StatusUnset, "")
+	case "tool-call-started":
+		id := callID(p)
+		if id == "" {
+			b.single(p)
+			return
+		}
+		b.st.Open["tool:"+id] = b.open(spanName("execute_tool", str("tool_name")), KindInternal, b.parent(), toolAttrs(p))
+	case "tool-call-finished":
+		id := callID(p)
+		s := b.st.Open["tool:"+id]
+		if id == "" || s == nil {
+			// The start was missed (or recorded elsewhere); the duration still places the span.
+			s = b.open(spanName("execute_tool", str("tool_name")), KindInternal, b.parent(), toolAttrs(p))
+			if ms, ok := hooksdk.IntField(raw, "duration_ms"); ok && ms > 0 {
+				s.Start = b.at.Add(-time.Duration(ms) * time.Millisecond)
+			}
+		}
+		delete(b.st.Open, "tool:"+id)
+		attrs := attributes{}
+		if v := str("status"); v != "" {
+			attrs = append(attrs, Attribute{Key: "xcodex.tool.status", Value: v})
+		}
+		if n, ok := hooksdk.IntField(raw, "output_bytes"); ok {
+			attrs = append(attrs, Attribute{Key: "xcodex.tool.output_bytes", Value: n})
+		}
+		status, msg := StatusUnset, ""
+		if ok, found := hooksdk.BoolField(raw, "success"); found && !ok {
+			status, msg = StatusError, "tool call failed"
+		}
+		b.finish(s, b.at, attrs, status, msg)
+	default:
+		b.single(p)
+	}
+}
+
+// ensureSession opens the session span if it isn't (the tracer may start mid-session).
+func (b *builder) ensureSession(p *hooksdk.HookPayload) {
+	if b.st.Session != nil {
+		return
+	}
+	attrs := attributes{{Key: "session.id", Value: b.session}}
+	if src, _ := hooksdk.StringField(p.RawPayload, "session_source"); src != "" {
+		attrs = append(attrs, Attribute{Key: "xcodex.session.source", Value: src})
+	}
+	if cwd := p.WorkingDir(); cwd != "" {
+		attrs = append(attrs, Attribute{Key: "xcodex.session.cwd", Value: cwd})
+	}
+	b.st.Session = b.open("session", KindInternal, "", attrs)
+}
+
+// parent is the innermost open span new spans belong to: the turn, else the session.
+func (b *builder) parent() string {
+	if b.st.Turn != nil {
+		return b.st.Turn.SpanID
+	}
+	return b.st.Session.SpanID
+}
+
+func (b *builder) open(name string, kind SpanKind, parent string, attrs attributes) *openSpan {
+	return &openSpan{SpanID: NewSpanID().String(), Parent: parent, Name: name, Kind: kind, Start: b.at, Attrs: attrs}
+}
+
+// single records an event without a partner as a zero-length span carrying it as a span event,
+// under the tool call or model request it names, else the innermost open span.
+func (b *builder) single(p *hooksdk.HookPayload) {
+	parent := b.parent()
+	modelRequest, _ := hooksdk.StringField(p.RawPayload, "model_request_id")
+	if s := b.st.Open["tool:"+callID(p)]; s != nil {
+		parent = s.SpanID
+	} else if s := b.st.Open["model:"+modelRequest]; s != nil {
+		parent = s.SpanID
+	}
+	s := b.open(p.EventType(), KindInternal, parent, nil)
+	b.finish(s, b.at, nil, StatusUnset, "")
+	b.spans[len(b.spans)-1].Events = []Event{{Time: b.at, Name: p.EventType(), Attributes: eventAttrs(p)}}
+}
+
+// endAll closes every span left open under the session.
+func (b *builder) endAll() {
+	keys := make([]string, 0, len(b.st.Open))
+	for k := range b.st.Open {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.closeIncomplete(b.st.Open[k])
+	}
+	b.st.Open = map[string]*openSpan{}
+	if b.st.Turn != nil {
+		b.closeIncomplete(b.st.Turn)
+		b.st.Turn = nil
+	}
+}
+
+func (b *builder) closeIncomplete(s *openSpan) {
+	b.finish(s, b.at, attributes{{Key: IncompleteAttribute, Value: true}}, StatusUnset, "")
+}
+
+func (b *builder) finish(s *openSpan, end time.Time, extra attributes, status StatusCode, msg string) {
+	if end.Before(s.Start) {
+		end = s.Start
+	}
+	attrs := append(append([]Attribute{}, s.Attrs...), extra...)
+	b.spans = append(b.spans, Span{
+		TraceID:       b.trace,
+		SpanID:        parseSpanID(s.SpanID),
+		ParentSpanID:  parseSpanID(s.Parent),
+		Name:          s.Name,
+		Kind:          s.Kind,
+		Start:         s.Start,
+		End:           end,
+		Attributes:    attrs,
+		Status:        status,
+		StatusMessage: msg,
+	})
+}
+
+func spanName(op, target string) string {
+	if target == "" {
+		return op
+	}
+	return op + " " + target
+}
+
+func toolAttrs(p *hooksdk.HookPayload) attributes {
+	attrs := attributes{{Key: "gen_ai.operation.name", Value: "execute_tool"}}
+	if v, _ := hooksdk.StringField(p.RawPayload, "tool_name"); v != "" {
+		attrs = append(attrs, Attribute{Key: "gen_ai.tool.name", Value: v})
+	}
+	if v := callID(p); v != "" {
+		attrs = append(attrs, Attribute{Key: "gen_ai.tool.call.id", Value: v})
+	}
+	return attrs
+}
+
+// callID is the tool call an event belongs to: `tool_use_id` on tool call events, `call_id` on
+// approval requests.
+func callID(p *hooksdk.HookPayload) string {
+	if id, _ := hooksdk.StringField(p.RawPayload, "tool_use_id"); id != "" {
+		return id
+	}
+	id, _ := hooksdk.StringField(p.RawPayload, "call_id")
+	return id
+}
+
+// eventAttrs are the attributes every event contributes: its type and, when present, the ids it
+// carries.
+func eventAttrs(p *hooksdk.HookPayload) []Attribute {
+	attrs := []Attribute{{Key: "xcodex.event.type", Value: p.EventType()}}
+	for _, key := range []string{"turn_id", "call_id", "model_request_id", "tool_name", "reason"} {
+		if v, _ := hooksdk.StringField(p.RawPayload, key); v != "" {
+			attrs = append(attrs, Attribute{Key: "xcodex." + key, Value: v})
+		}
+	}
+	return attrs
+}
+
+func (t *Tracer) eventTime(p *hooksdk.HookPayload) time.Time {
+	if ts := p.Time(); !ts.IsZero() {
+		return ts
+	}
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+func (t *Tracer) statePath(session string) string {
+	name, _ := jsonl.SafeName(session)
+	return filepath.Join(t.Dir, "session-"+name+".json")
+}
+
+// locked runs fn under the lock shared by all sessions' state files.
+func (t *Tracer) locked(fn func() error) error {
+	if err := os.MkdirAll(t.Dir, 0o755); err != nil {
+		return err
+	}
+	lock, err := filelock.AcquireTimeout(filepath.Join(t.Dir, "otel.lock"), lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return fn()
+}
+
+// load reads a session's state; a missing or corrupt file starts afresh.
+func load(path string) (*state, error) {
+	var st state
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 && json.Unmarshal(data, &st) != nil {
+		st = state{}
+	}
+	if st.Open == nil {
+		st.Open = map[string]*openSpan{}
+	}
+	return &st, nil
+}
@@ -0,0 +1,176 @@
+package otel_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/otel"
+)
+
+var t0 = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// at stamps b as happening n seconds after t0 in session s1.
+func at(n int, b *hooktest.Builder) *hooktest.Builder {
+	return b.WithSessionID("s1").With("timestamp", t0.Add(time.Duration(n)*time.Second).Format(time.RFC3339))
+}
+
+// session is a session with one turn: a model request, a failed tool call with an approval, and
+// a tool call the turn ends before it finishes.
+func session() []*hooktest.Builder {
+	return []*hooktest.Builder{
+		at(0, hooktest.SessionStart()),
+		at(1, hooktest.UserPromptSubmit()),
+		at(2, hooktest.ModelRequestStarted()),
+		at(4, hooktest.ModelResponseCompleted()),
+		at(5, hooktest.ToolCallStarted().With("tool_use_id", "call-1")),
+		at(6, hooktest.ApprovalRequested().With("call_id", "call-1")),
+		at(8, hooktest.ToolCallFinished().With("tool_use_id", "call-1").With("success", false)),
+		at(9, hooktest.ToolCallStarted().With("tool_use_id", "call-2")),
+		at(10, hooktest.AgentTurnComplete()),
+		at(11, hooktest.Notification()),
+		at(12, hooktest.SessionEnd()),
+	}
+}
+
+// observe runs each event through a new Tracer, as separate hook processes do, and returns the
+// spans by name.
+func observe(t *testing.T, dir string, events []*hooktest.Builder) map[string]otel.Span {
+	t.Helper()
+	spans := map[string]otel.Span{}
+	for _, b := range events {
+		got, err := otel.NewTracer(dir).Observe(b.Build())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range got {
+			name := s.Name
+			for _, a := range s.Attributes {
+				if a.Key == "gen_ai.tool.call.id" {
+					name += " " + a.Value.(string)
+				}
+			}
+			if _, dup := spans[name]; dup {
+				t.Fatalf("two %q spans", name)
+			}
+			spans[name] = s
+		}
+	}
+	return spans
+}
+
+func attr(s otel.Span, key string) any {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+func TestTracerSession(t *testing.T) {
+	dir := t.TempDir()
+	spans := observe(t, dir, session())
+
+	tests := []struct {
+		name, parent string
+		start, end   int
+	}{
+		{"session", "", 0, 12},
+		{"turn", "session", 1, 10},
+		{"chat gpt-5", "turn", 2, 4},
+		{"execute_tool Bash call-1", "turn", 5, 8},
+		{"approval-requested", "execute_tool Bash call-1", 6, 6},
+		{"execute_tool Bash call-2", "turn", 9, 10},
+		{"notification", "session", 11, 11},
+	}
+	if len(spans) != len(tests) {
+		t.Errorf("got %d spans, want %d", len(spans), len(tests))
+	}
+	trace := otel.TraceIDFor("s1")
+	for _, tt := range tests {
+		s, ok := spans[tt.name]
+		if !ok {
+			t.Errorf("no %q span", tt.name)
+			continue
+		}
+		if s.TraceID != trace {
+			t.Errorf("%s: trace %s, want the session's %s", tt.name, s.TraceID, trace)
+		}
+		var parent otel.SpanID
+		if tt.parent != "" {
+			parent = spans[tt.parent].SpanID
+		}
+		if s.ParentSpanID != parent {
+			t.Errorf("%s: parent %s, want %q's %s", tt.name, s.ParentSpanID, tt.parent, parent)
+		}
+		if start, end := s.Start.Sub(t0), s.End.Sub(t0); start != time.Duration(tt.start)*time.Second || end != time.Duration(tt.end)*time.Second {
+			t.Errorf("%s: %v to %v, want %ds to %ds", tt.name, start, end, tt.start, tt.end)
+		}
+	}
+
+	model := spans["chat gpt-5"]
+	if model.Kind != otel.KindClient || attr(model, "gen_ai.usage.input_tokens") != int64(1200) || attr(model, "gen_ai.request.model") != "gpt-5" {
+		t.Errorf("model span = %+v", model)
+	}
+	if failed := spans["execute_tool Bash call-1"]; failed.Status != otel.StatusError {
+		t.Errorf("failed tool call status = %v, want error", failed.Status)
+	}
+	if open := spans["execute_tool Bash call-2"]; attr(open, otel.IncompleteAttribute) != true {
+		t.Errorf("tool call cut off by the turn's end isn't marked incomplete: %+v", open.Attributes)
+	}
+	if n := spans["notification"]; len(n.Events) != 1 || n.Events[0].Name != "notification" {
+		t.Errorf("notification span events = %+v", n.Events)
+	}
+
+	// The session's state is gone once it ends.
+	if files, _ := filepath.Glob(filepath.Join(dir, "session-*")); len(files) != 0 {
+		t.Errorf("state files left: %v", files)
+	}
+}
+
+func TestTracerEndsOpenSpans(t *testing.T) {
+	spans := observe(t, t.TempDir(), []*hooktest.Builder{
+		at(0, hooktest.UserPromptSubmit()),
+		at(1, hooktest.ToolCallStarted()),
+		at(3, hooktest.SessionEnd()),
+	})
+	// The session span is opened by the first event seen.
+	for _, name := range []string{"turn", "execute_tool Bash call-1"} {
+		s := spans[name]
+		if attr(s, otel.IncompleteAttribute) != true || s.End.Sub(t0) != 3*time.Second {
+			t.Errorf("%s = %+v, want it ended incomplete with the session", name, s)
+		}
+	}
+	if s := spans["session"]; s.Start != t0 || !s.ParentSpanID.IsZero() {
+		t.Errorf("session span = %+v", s)
+	}
+}
+
+func TestTracerMissedStart(t *testing.T) {
+	// Without its start, a finished tool call is placed by its duration.
+	spans := observe(t, t.TempDir(), []*hooktest.Builder{at(10, hooktest.ToolCallFinished())})
+	s := spans["execute_tool Bash call-1"]
+	if d := s.End.Sub(s.Start); d != 1234*time.Millisecond {
+		t.Errorf("duration = %v, want the event's 1.234s", d)
+	}
+}
+
+func TestTracerCorruptState(t *testing.T) {
+	dir := t.TempDir()
+	observe(t, dir, session()[:2])
+	files, _ := filepath.Glob(filepath.Join(dir, "session-*"))
+	if len(files) != 1 {
+		t.Fatalf("state files = %v, want one", files)
+	}
+	if err := os.WriteFile(files[0], []byte("{oops"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A fresh session span, in the same trace.
+	spans := observe(t, dir, []*hooktest.Builder{at(3, hooktest.SessionEnd())})
+	if s := spans["session"]; s.TraceID != otel.TraceIDFor("s1") || s.Start.Sub(t0) != 3*time.Second {
+		t.Errorf("session span after a corrupt state = %+v", s)
+	}
+}
@@ -0,0 +1,225 @@
+// Package outbox is a durable queue of messages waiting for a destination that may be down, such
+// as a webhook endpoint. Each message is a file in the outbox directory; it is added before the
+// first attempt to send it and removed only once it has been sent, so neither an outage nor a
+// crash loses it. Delivery is at least once: a message whose send succeeded but whose file
+// couldn't be removed is sent again, so receivers should drop duplicates by an id in the message.
+//
+//	box := outbox.New(hooksdk.Environ().Path("hooks", "outbox", "webhook"))
+//	box.Budget = 20
+//	if _, err := box.Add(body); err != nil { ... }
+//	stats, err := box.Drain(ctx, func(ctx context.Context, m outbox.Message) error {
+//		return client.Send(ctx, m.Data)
+//	})
+//
+// Drain sends the oldest messages first and stops at the first failure, so messages arrive in
+// the order they were added. One process drains an outbox at a time; Drain returns at once (with
+// Stats.Busy) while another does, since that one also sends the messages added meanwhile.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+)
+
+// ErrReject is returned (wrapped) by a send function for a message the destination will never
+// take, e.g. one answered with 400: Drain drops it rather than retrying it forever, which would
+// hold up every message after it.
+var ErrReject = errors.New("outbox: message rejected")
+
+// Message files are named `<added, Unix nanoseconds, 20 digits>-<random>.msg`, so they sort in
+// the order they were added. Files being written are `.tmp-*`; ones a crash left behind are
+// removed by Drain once they are staleTemp old.
+const (
+	messageExt = ".msg"
+	tempPrefix = ".tmp-"
+	lockName   = ".lock"
+	staleTemp  = time.Hour
+)
+
+// Outbox is a queue of messages in Dir.
+type Outbox struct {
+	Dir string
+	// MaxAge drops messages older than this unsent, counting them in Stats.Expired. Zero keeps
+	// them until they are sent.
+	MaxAge time.Duration
+	// Budget caps the messages one Drain sends, so a large backlog doesn't hold up the hook that
+	// drains it; the rest wait for the next Drain. Zero means no limit.
+	Budget int
+}
+
+// New returns an outbox in dir, which is created by the first Add.
+func New(dir string) *Outbox {
+	return &Outbox{Dir: dir}
+}
+
+// Message is a queued message.
+type Message struct {
+	// ID is the message's file name in the outbox.
+	ID    string
+	Added time.Time
+	Data  []byte
+}
+
+// Stats reports what a Drain did.
+type Stats struct {
+	// Sent messages were sent and removed; Rejected ones were dropped with ErrReject, and Expired
+	// ones dropped unsent for being older than MaxAge.
+	Sent, Rejected, Expired int
+	// Left is the number of messages still queued when Drain returned.
+	Left int
+	// Busy is set when another process was draining the outbox, and this Drain did nothing.
+	Busy bool
+}
+
+// Add queues data as a new message and returns its ID. The message is on disk when Add returns.
+func (o *Outbox) Add(data []byte) (string, error) {
+	if err := os.MkdirAll(o.Dir, 0o700); err != nil {
+		return "", err
+	}
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", err
+	}
+	id := fmt.Sprintf("%020d-%s%s", time.Now().UnixNano(), hex.EncodeToString(suffix[:]), messageExt)
+
+	f, err := os.CreateTemp(o.Dir, tempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(o.Dir, id))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return id, nil
+}
+
+// Len returns the number of queued messages.
+func (o *Outbox) Len() (int, error) {
+	ids, err := o.list()
+	return len(ids), err
+}
+
+// Drain sends queued messages with send, oldest first, removing each once send returns nil, until
+// the outbox is empty, Budget messages have been tried, or ctx is done. A send error wrapping
+// ErrReject drops the message and Drain goes on; any other error stops it, leaving that message
+// and the ones after it queued, and is returned.
+func (o *Outbox) Drain(ctx context.Context, send func(ctx context.Context, m Message) error) (stats Stats, err error) {
+	lock, ok, err := filelock.TryAcquire(filepath.Join(o.Dir, lockName))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing was ever added.
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	if !ok {
+		stats.Busy = true
+		return stats, nil
+	}
+	defer lock.Unlock()
+	defer func() { stats.Left, _ = o.Len() }()
+	o.removeStaleTemp()
+
+	tried := 0
+	for {
+		ids, err := o.list()
+		if err != nil || len(ids) == 0 {
+			return stats, err
+		}
+		for _, id := range ids {
+			if o.Budget > 0 && tried >= o.Budget {
+				return stats, nil
+			}
+			if ctx.Err() != nil {
+				return stats, nil
+			}
+			m := Message{ID: id, Added: addedAt(id)}
+			path := filepath.Join(o.Dir, id)
+			if o.MaxAge > 0 && time.Since(m.Added) > o.MaxAge {
+				if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return stats, err
+				}
+				stats.Expired++
+				continue
+			}
+			if m.Data, err = os.ReadFile(path); err != nil {
+				return stats, err
+			}
+			tried++
+			err := send(ctx, m)
+			switch {
+			case err == nil:
+				stats.Sent++
+			case errors.Is(err, ErrReject):
+				stats.Rejected++
+			default:
+				return stats, err
+			}
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return stats, err
+			}
+		}
+		// Go round again for the messages added while these were sent.
+	}
+}
+
+// list returns the IDs of the queued messages, oldest first.
+func (o *Outbox) list() ([]string, error) {
+	entries, err := os.ReadDir(o.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if name := e.Name(); strings.HasSuffix(name, messageExt) && !strings.HasPrefix(name, ".") {
+			ids = append(ids, name)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// removeStaleTemp removes the temporary files of Adds that crashed.
+func (o *Outbox) removeStaleTemp() {
+	temps, _ := filepath.Glob(filepath.Join(o.Dir, tempPrefix+"*"))
+	for _, path := range temps {
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleTemp {
+			os.Remove(path)
+		}
+	}
+}
+
+// addedAt is the time in a message ID, or the zero time for a file named some other way.
+func addedAt(id string) time.Time {
+	stamp, _, _ := strings.Cut(id, "-")
+	n, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,272 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+	"example.com/xcodex/hooks-sdk/hooksdk/outbox"
+)
+
+// add queues each of msgs in box.
+func add(t *testing.T, box *outbox.Outbox, msgs ...string) {
+	t.Helper()
+	for _, m := range msgs {
+		if _, err := box.Add([]byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// recorder is a send function that records what it sends, failing with the errors in fail by
+// message.
+type recorder struct {
+	mu   sync.Mutex
+	sent []string
+	fail map[string]error
+}
+
+func (r *recorder) send(ctx context.Context, m outbox.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail[string(m.Data)]; err != nil {
+		return err
+	}
+	r.sent = append(r.sent, string(m.Data))
+	return nil
+}
+
+func TestDrainOrder(t *testing.T) {
+	box := outbox.New(filepath.Join(t.TempDir(), "outbox"))
+	add(t, box, "1", "2", "3", "4", "5")
+	if n, err := box.Len(); n != 5 || err != nil {
+		t.Fatalf("Len = %d, %v", n, err)
+	}
+	var r recorder
+	stats, err := box.Drain(context.Background(), r.send)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "2", "3", "4", "5"}; !reflect.DeepEqual(r.sent, want) {
+		t.Errorf("sent %q, want %q", r.sent, want)
+	}
+	if stats != (outbox.Stats{Sent: 5}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	if entries, _ := os.ReadDir(box.Dir); len(entries) != 1 {
+		t.Errorf("outbox holds %v, want only its lock", entries)
+	}
+}
+
+func TestDrainStopsAtFailure(t *testing.T) {
+	box := outbox.New(t.TempDir())
+	add(t, box, "1", "2", "3")
+	down := errors.New("connection refused")
+	r := recorder{fail: map[string]error{"2": down}}
+	stats, err := box.Drain(context.Background(), r.send)
+	if !errors.Is(err, down) || !reflect.DeepEqual(r.sent, []string{"1"}) || stats.Sent != 1 || stats.Left != 2 {
+		t.Errorf("Drain = %+v, %v; sent %q", stats, err, r.sent)
+	}
+
+	// The failed message goes first once the endpoint is back: at least once, in order.
+	r.fail = nil
+	add(t, box, "4")
+	if _, err := box.Drain(context.Background(), r.send); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"1", "2", "3", "4"}; !reflect.DeepEqual(r.sent, want) {
+		t.Errorf("sent %q, want %q", r.sent, want)
+	}
+}
+
+func TestDrainRejects(t *testing.T) {
+	box := outbox.New(t.TempDir())
+	add(t, box, "1", "bad", "3")
+	r := recorder{fail: map[string]error{"bad": fmt.Errorf("%w: 400 Bad Request", outbox.ErrReject)}}
+	stats, err := box.Drain(context.Background(), r.send)
+	if err != nil || !reflect.DeepEqual(r.sent, []string{"1", "3"}) || stats != (outbox.Stats{Sent: 2, Rejected: 1}) {
+		t.Errorf("Drain = %+v, %v; sent %q", stats, err, r.sent)
+	}
+}
+
+func TestDrainBudget(t *testing.T) {
+	box := outbox.New(t.TempDir())
+	box.Budget = 2
+	add(t, box, "1", "2", "3", "4", "5")
+	var r recorder
+	for _, wantLeft := range []int{3, 1, 0} {
+		stats, err := box.Drain(context.Background(), r.send)
+		if err != nil || stats.Left != wantLeft {
+			t.Errorf("Drain = %+v, %v; want %d left", stats, err, wantLeft)
+		}
+	}
+	if want := []string{"1", "2", "3", "4", "5"}; !reflect.DeepEqual(r.sent, want) {
+		t.Errorf("sent %q, want %q", r.sent, want)
+	}
+}
+
+func TestDrainMaxAge(t *testing.T) {
+	box := outbox.New(t.TempDir())
+	box.MaxAge = time.Hour
+	add(t, box, "new")
+	// A message queued two hours ago, named as Add names them.
+	old := fmt.Sprintf("%020d-00000000.msg", time.Now().Add(-2*time.Hour).UnixNano())
+	if err := os.WriteFile(filepath.Join(box.Dir, old), []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var r recorder
+	stats, err := box.Drain(context.Background(), r.send)
+	if err != nil || !reflect.DeepEqual(r.sent, []string{"new"}) || stats != (outbox.Stats{Sent: 1, Expired: 1}) {
+		t.Errorf("Drain = %+v, %v; sent %q", stats, err, r.sent)
+	}
+}
+
+func TestDrainEmpty(t *testing.T) {
+	box := outbox.New(filepath.Join(t.TempDir(), "never-created"))
+	stats, err := box.Drain(context.Background(), func(context.Context, outbox.Message) error {
+		t.Error("send called for an empty outbox")
+		return nil
+	})
+	if err != nil || stats != (outbox.Stats{}) {
+		t.Errorf("Drain = %+v, %v", stats, err)
+	}
+	if _, err := os.Stat(box.Dir); !os.IsNotExist(err) {
+		t.Errorf("Drain created the outbox: %v", err)
+	}
+}
+
+func TestDrainCanceled(t *testing.T) {
+	box := outbox.New(t.TempDir())
+	add(t, box, "1", "2", "3")
+	ctx, cancel := context.WithCancel(context.Background())
+	stats, err := box.Drain(ctx, func(ctx context.Context, m outbox.Message) error {
+		cancel()
+		return nil
+	})
+	if err != nil || stats.Sent != 1 || stats.Left != 2 {
+		t.Errorf("Drain = %+v, %v; want one sent before the cancel", stats, err)
+	}
+}
+
+func TestDrainSendsMessagesAddedMeanwhile(t *testing.T) {
+	box := outbox.New(t.TempDir())
+	add(t, box, "1")
+	var r recorder
+	stats, err := box.Drain(context.Background(), func(ctx context.Context, m outbox.Message) error {
+		if string(m.Data) == "1" {
+			add(t, box, "2")
+		}
+		return r.send(ctx, m)
+	})
+	if err != nil || !reflect.DeepEqual(r.sent, []string{"1", "2"}) || stats.Left != 0 {
+		t.Errorf("Drain = %+v, %v; sent %q", stats, err, r.sent)
+	}
+}
+
+func TestDrainBusy(t *testing.T) {
+	box := outbox.New(t.TempDir())
+	add(t, box, "1")
+	lock, err := filelock.Acquire(filepath.Join(box.Dir, ".lock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r recorder
+	if stats, err := box.Drain(context.Background(), r.send); err != nil || !stats.Busy || len(r.sent) != 0 {
+		t.Errorf("Drain while another drains = %+v, %v; sent %q", stats, err, r.sent)
+	}
+	lock.Unlock()
+	if stats, err := box.Drain(context.Background(), r.send); err != nil || stats.Busy || stats.Sent != 1 {
+		t.Errorf("Drain after = %+v, %v", stats, err)
+	}
+}
+
+func TestDrainRemovesStaleTemp(t *testing.T) {
+	box := outbox.New(t.TempDir())
+	add(t, box, "1")
+	stale, fresh := filepath.Join(box.Dir, ".tmp-stale"), filepath.Join(box.Dir, ".tmp-fresh")
+	for _, path := range []string{stale, fresh} {
+		if err := os.WriteFile(path, []byte("partial"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(stale, old, old)
+	var r recorder
+	if _, err := box.Drain(context.Background(), r.send); err != nil || !reflect.DeepEqual(r.sent, []string{"1"}) {
+		t.Errorf("Drain: %v; sent %q", err, r.sent)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale temporary file kept: %v", err)
+	}
+	// One an Add may still be writing stays.
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh temporary file removed: %v", err)
+	}
+}
+
+// TestConcurrentDrainers adds messages from several writers while several drainers drain the
+// outbox, each with its own Outbox as separate hook processes would: every message is sent, once,
+// and each writer's in the order it added them.
+func TestConcurrentDrainers(t *testing.T) {
+	dir := t.TempDir()
+	const writers, n, drainers = 4, 25, 4
+	var r recorder
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			box := outbox.New(dir)
+			for i := 0; i < n; i++ {
+				if _, err := box.Add([]byte(fmt.Sprintf("%d:%d", w, i))); err != nil {
+					t.Error(err)
+				}
+				box.Drain(context.Background(), r.send)
+			}
+		}(w)
+	}
+	for d := 0; d < drainers; d++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			box := outbox.New(dir)
+			box.Budget = 3
+			for i := 0; i < n; i++ {
+				if _, err := box.Drain(context.Background(), r.send); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := outbox.New(dir).Drain(context.Background(), r.send); err != nil {
+		t.Fatal(err)
+	}
+
+	next := make([]int, writers)
+	for _, m := range r.sent {
+		var w, i int
+		if _, err := fmt.Sscanf(m, "%d:%d", &w, &i); err != nil {
+			t.Fatalf("sent %q", m)
+		}
+		if i != next[w] {
+			t.Errorf("writer %d: sent %d, want %d next", w, i, next[w])
+		}
+		next[w] = i + 1
+	}
+	for w, got := range next {
+		if got != n {
+			t.Errorf("writer %d: %d of %d messages sent", w, got, n)
+		}
+	}
+	if left, _ := outbox.New(dir).Len(); left != 0 {
+		t.Errorf("%d messages left", left)
+	}
+}
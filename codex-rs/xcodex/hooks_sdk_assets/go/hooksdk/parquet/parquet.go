@@ -0,0 +1,576 @@
+// Package parquet writes Apache Parquet files with a flat schema, for loading hook events into
+// DuckDB, pandas, Spark, and the like without parsing JSON.
+//
+// Rows are buffered per column and written as a row group every RowGroupRows rows (or once
+// RowGroupBytes are buffered), so memory stays bounded however many rows a file holds. Columns
+// are plain-encoded and gzip-compressed, one page per column per row group; integer and
+// timestamp columns carry min/max statistics, so readers can skip row groups by time.
+//
+//	w, err := parquet.NewWriter(f, []parquet.Column{
+//		{Name: "timestamp", Type: parquet.Timestamp, Optional: true},
+//		{Name: "event_type", Type: parquet.String},
+//		{Name: "duration_ms", Type: parquet.Int64, Optional: true},
+//	})
+//	err = w.Write([]any{time.Now(), "tool-call-finished", nil})
+//	err = w.Close() // writes the footer; f is left open
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Type is the type of a column's values.
+type Type int
+
+const (
+	// Int32 columns hold int32 values (ints and int64s are accepted within range).
+	Int32 Type = iota + 1
+	// Int64 columns hold int64 values (ints and int32s are accepted).
+	Int64
+	// String columns hold UTF-8 strings (string or []byte values).
+	String
+	// Timestamp columns hold time.Time values, stored as microseconds since the Unix epoch, UTC.
+	Timestamp
+)
+
+func (t Type) String() string {
+	switch t {
+	case Int32:
+		return "int32"
+	case Int64:
+		return "int64"
+	case String:
+		return "string"
+	case Timestamp:
+		return "timestamp"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Column is one column of the schema.
+type Column struct {
+	Name string
+	Type Type
+	// Optional columns accept nil values, written as nulls.
+	Optional bool
+}
+
+// Codec is a page compression codec. The values are Parquet's.
+type Codec int
+
+const (
+	Uncompressed Codec = 0
+	Gzip         Codec = 2
+)
+
+// Defaults for a new Writer.
+const (
+	DefaultRowGroupRows  = 100_000
+	DefaultRowGroupBytes = 64 << 20
+)
+
+// createdBy names the writer in the footer.
+const createdBy = "xcodex-hooks-sdk"
+
+var magic = []byte("PAR1")
+
+// The Parquet enums we write (parquet.thrift).
+const (
+	typeInt32     = 1
+	typeInt64     = 2
+	typeByteArray = 6
+
+	repRequired = 0
+	repOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	pageData = 0
+)
+
+// Writer writes rows to a Parquet file. Set its exported fields before the first Write.
+type Writer struct {
+	// RowGroupRows and RowGroupBytes bound the rows and the encoded bytes buffered before a row
+	// group is written. Zero means the defaults.
+	RowGroupRows  int
+	RowGroupBytes int
+	// Codec compresses the pages; NewWriter sets Gzip.
+	Codec Codec
+	// Metadata is written to the footer as key/value metadata.
+	Metadata map[string]string
+
+	w         io.Writer
+	offset    int64
+	columns   []Column
+	chunks    []*chunk
+	rows      int
+	buffered  int
+	totalRows int64
+	groups    []rowGroup
+	err       error
+	closed    bool
+}
+
+// chunk buffers one column of the current row group.
+type chunk struct {
+	defs   []byte // definition levels, 0 for null and 1 for a value; optional columns only
+	values []byte // plain-encoded values
+	nulls  int64
+	// min and max are the statistics of integer and timestamp columns.
+	min, max int64
+	hasStats bool
+}
+
+type rowGroup struct {
+	rows    int64
+	columns []columnChunk
+}
+
+type columnChunk struct {
+	offset           int64
+	values           int64
+	nulls            int64
+	uncompressedSize int64
+	compressedSize   int64
+	min, max         int64
+	hasStats         bool
+}
+
+// NewWriter writes the file header to w and returns a Writer for rows of columns.
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("parquet: no columns")
+	}
+	seen := map[string]bool{}
+	for _, c := range columns {
+		if c.Name == "" {
+			return nil, errors.New("parquet: column without a name")
+		}
+		if seen[c.Name] {
+			return nil, fmt.Errorf("parquet: duplicate column %q", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Type < Int32 || c.Type > Timestamp {
+			return nil, fmt.Errorf("parquet: column %s: unknown type %v", c.Name, c.Type)
+		}
+	}
+	pw := &Writer{Codec: Gzip, w: w, columns: append([]Column(nil), columns...)}
+	pw.reset()
+	if err := pw.write(magic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// Write adds a row: one value per column, in schema order, nil for a null.
+func (w *Writer) Write(row []any) error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.closed {
+		return errors.New("parquet: write after Close")
+	}
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(row), len(w.columns))
+	}
+	// Check the whole row first, so a bad value doesn't leave the columns misaligned.
+	for i, v := range row {
+		if err := w.columns[i].check(v); err != nil {
+			return err
+		}
+	}
+	for i, v := range row {
+		w.buffered += w.chunks[i].add(w.columns[i], v)
+	}
+	w.rows++
+	if w.rows >= w.rowGroupRows() || w.buffered >= w.rowGroupBytes() {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Rows returns how many rows have been written, buffered ones included.
+func (w *Writer) Rows() int64 {
+	return w.totalRows + int64(w.rows)
+}
+
+// Flush writes the buffered rows as a row group.
+func (w *Writer) Flush() error {
+	if w.err != nil || w.rows == 0 {
+		return w.err
+	}
+	group := rowGroup{rows: int64(w.rows)}
+	for i, c := range w.chunks {
+		cc, err := w.writeChunk(w.columns[i], c)
+		if err != nil {
+			w.err = err
+			return err
+		}
+		group.columns = append(group.columns, cc)
+	}
+	w.groups = append(w.groups, group)
+	w.totalRows += int64(w.rows)
+	w.reset()
+	return nil
+}
+
+// Close flushes the buffered rows and writes the footer. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.closed = true
+	footer := w.footer()
+	var trailer [4]byte
+	binary.LittleEndian.PutUint32(trailer[:], uint32(len(footer)))
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	if err := w.write(trailer[:]); err != nil {
+		return err
+	}
+	return w.write(magic)
+}
+
+func (w *Writer) rowGroupRows() int {
+	if w.RowGroupRows > 0 {
+		return w.RowGroupRows
+	}
+	return DefaultRowGroupRows
+}
+
+func (w *Writer) rowGroupBytes() int {
+	if w.RowGroupBytes > 0 {
+		return w.RowGroupBytes
+	}
+	return DefaultRowGroupBytes
+}
+
+func (w *Writer) reset() {
+	w.chunks = make([]*chunk, len(w.columns))
+	for i := range w.chunks {
+		w.chunks[i] = &chunk{}
+	}
+	w.rows, w.buffered = 0, 0
+}
+
+func (w *Writer) write(p []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+// check reports whether v fits the column.
+func (c Column) check(v any) error {
+	if v == nil {
+		if !c.Optional {
+			return fmt.Errorf("parquet: column %s: null in a required column", c.Name)
+		}
+		return nil
+	}
+	ok := false
+	switch c.Type {
+	case Int32:
+		n, isInt := toInt64(v)
+		ok = isInt && n >= math.MinInt32 && n <= math.MaxInt32
+	case Int64:
+		_, ok = toInt64(v)
+	case String:
+		switch v.(type) {
+		case string, []byte:
+			ok = true
+		}
+	case Timestamp:
+		_, ok = v.(time.Time)
+	}
+	if !ok {
+		return fmt.Errorf("parquet: column %s: %T value %v doesn't fit a %v column", c.Name, v, v, c.Type)
+	}
+	return nil
+}
+
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	}
+	return 0, false
+}
+
+// add appends v, already checked, returning how many bytes it took.
+func (c *chunk) add(col Column, v any) int {
+	before := len(c.values)
+	if v == nil {
+		c.defs = append(c.defs, 0)
+		c.nulls++
+		return 1
+	}
+	if col.Optional {
+		c.defs = append(c.defs, 1)
+	}
+	switch col.Type {
+	case Int32:
+		n, _ := toInt64(v)
+		c.values = binary.LittleEndian.AppendUint32(c.values, uint32(int32(n)))
+		c.stat(n)
+	case Int64:
+		n, _ := toInt64(v)
+		c.values = binary.LittleEndian.AppendUint64(c.values, uint64(n))
+		c.stat(n)
+	case Timestamp:
+		n := v.(time.Time).UnixMicro()
+		c.values = binary.LittleEndian.AppendUint64(c.values, uint64(n))
+		c.stat(n)
+	case String:
+		var b []byte
+		switch s := v.(type) {
+		case string:
+			b = []byte(s)
+		case []byte:
+			b = s
+		}
+		c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(b)))
+		c.values = append(c.values, b...)
+	}
+	return len(c.values) - before + 1
+}
+
+func (c *chunk) stat(n int64) {
+	if !c.hasStats || n < c.min {
+		c.min = n
+	}
+	if !c.hasStats || n > c.max {
+		c.max = n
+	}
+	c.hasStats = true
+}
+
+// writeChunk writes the column chunk of the current row group as one data page.
+func (w *Writer) writeChunk(col Column, c *chunk) (columnChunk, error) {
+	var body []byte
+	if col.Optional {
+		// Data page v1: the definition levels come first, RLE-encoded with a length prefix.
+		levels := rleLevels(c.defs)
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(levels)))
+		body = append(body, levels...)
+	}
+	body = append(body, c.values...)
+
+	page := body
+	if w.Codec == Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return columnChunk{}, err
+		}
+		if err := zw.Close(); err != nil {
+			return columnChunk{}, err
+		}
+		page = buf.Bytes()
+	}
+	if len(body) > math.MaxInt32 || len(page) > math.MaxInt32 {
+		return columnChunk{}, fmt.Errorf("parquet: column %s: page of %d bytes is too large; lower RowGroupBytes", col.Name, len(body))
+	}
+
+	rows := int64(w.rows)
+	var h compact
+	h.begin(0)
+	h.i32(1, pageData)
+	h.i32(2, int32(len(body)))
+	h.i32(3, int32(len(page)))
+	h.begin(5) // data_page_header
+	h.i32(1, int32(rows))
+	h.i32(2, encodingPlain)
+	h.i32(3, encodingRLE)
+	h.i32(4, encodingRLE)
+	h.end()
+	h.end()
+
+	cc := columnChunk{
+		offset:           w.offset,
+		values:           rows,
+		nulls:            c.nulls,
+		uncompressedSize: int64(len(h.buf) + len(body)),
+		compressedSize:   int64(len(h.buf) + len(page)),
+		min:              c.min,
+		max:              c.max,
+		hasStats:         c.hasStats,
+	}
+	if err := w.write(h.buf); err != nil {
+		return cc, err
+	}
+	return cc, w.write(page)
+}
+
+// rleLevels encodes definition levels (bit width 1) in the RLE/bit-packing hybrid encoding, as
+// runs of repeated values.
+func rleLevels(defs []byte) []byte {
+	var out []byte
+	for i := 0; i < len(defs); {
+		j := i + 1
+		for j < len(defs) && defs[j] == defs[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		out = append(out, defs[i])
+		i = j
+	}
+	return out
+}
+
+// footer encodes the FileMetaData.
+func (w *Writer) footer() []byte {
+	var c compact
+	c.begin(0)
+	c.i32(1, 1) // version
+
+	c.list(2, ctStruct, len(w.columns)+1) // schema: the root, then the columns
+	c.begin(-1)
+	c.str(4, "schema")
+	c.i32(5, int32(len(w.columns)))
+	c.end()
+	for _, col := range w.columns {
+		c.begin(-1)
+		schemaElement(&c, col)
+		c.end()
+	}
+
+	c.i64(3, w.totalRows)
+	c.list(4, ctStruct, len(w.groups))
+	for _, g := range w.groups {
+		c.begin(-1)
+		var size int64
+		c.list(1, ctStruct, len(g.columns))
+		for i, cc := range g.columns {
+			c.begin(-1)
+			c.i64(2, cc.offset) // file_offset
+			c.begin(3)          // meta_data
+			columnMetaData(&c, w.columns[i], cc, w.Codec)
+			c.end()
+			c.end()
+			size += cc.uncompressedSize
+		}
+		c.i64(2, size)
+		c.i64(3, g.rows)
+		if len(g.columns) > 0 {
+			c.i64(5, g.columns[0].offset)
+		}
+		c.end()
+	}
+
+	if len(w.Metadata) > 0 {
+		keys := make([]string, 0, len(w.Metadata))
+		for k := range w.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		c.list(5, ctStruct, len(keys))
+		for _, k := range keys {
+			c.begin(-1)
+			c.str(1, k)
+			c.str(2, w.Metadata[k])
+			c.end()
+		}
+	}
+	c.str(6, createdBy)
+	// Every column is ordered by its type, which makes its min/max statistics usable.
+	c.list(7, ctStruct, len(w.columns))
+	for range w.columns {
+		c.begin(-1)
+		c.begin(1) // TYPE_ORDER
+		c.end()
+		c.end()
+	}
+	c.end()
+	return c.buf
+}
+
+func schemaElement(c *compact, col Column) {
+	c.i32(1, physicalType(col.Type))
+	rep := int32(repRequired)
+	if col.Optional {
+		rep = repOptional
+	}
+	c.i32(3, rep)
+	c.str(4, col.Name)
+	switch col.Type {
+	case String:
+		c.i32(6, convertedUTF8)
+		c.begin(10) // logicalType
+		c.begin(1)  // STRING
+		c.end()
+		c.end()
+	case Timestamp:
+		c.i32(6, convertedTimestampMicros)
+		c.begin(10) // logicalType
+		c.begin(8)  // TIMESTAMP
+		c.bool(1, true)
+		c.begin(2) // unit
+		c.begin(2) // MICROS
+		c.end()
+		c.end()
+		c.end()
+		c.end()
+	}
+}
+
+func columnMetaData(c *compact, col Column, cc columnChunk, codec Codec) {
+	c.i32(1, physicalType(col.Type))
+	c.i32List(2, []int32{encodingPlain, encodingRLE})
+	c.strList(3, []string{col.Name})
+	c.i32(4, int32(codec))
+	c.i64(5, cc.values)
+	c.i64(6, cc.uncompressedSize)
+	c.i64(7, cc.compressedSize)
+	c.i64(9, cc.offset) // data_page_offset
+	c.begin(12)         // statistics
+	c.i64(3, cc.nulls)
+	if cc.hasStats {
+		c.binary(5, plainInt(col.Type, cc.max))
+		c.binary(6, plainInt(col.Type, cc.min))
+	}
+	c.end()
+}
+
+// physicalType is the Parquet type t is stored as.
+func physicalType(t Type) int32 {
+	switch t {
+	case Int32:
+		return typeInt32
+	case Int64, Timestamp:
+		return typeInt64
+	}
+	return typeByteArray
+}
+
+func plainInt(t Type, n int64) []byte {
+	if t == Int32 {
+		return binary.LittleEndian.AppendUint32(nil, uint32(int32(n)))
+	}
+	return binary.LittleEndian.AppendUint64(nil, uint64(n))
+}
@@ -0,0 +1,242 @@
+package parquet_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/parquet"
+	"example.com/xcodex/hooks-sdk/hooksdk/parquet/parquettest"
+)
+
+var testColumns = []parquet.Column{
+	{Name: "ts", Type: parquet.Timestamp, Optional: true},
+	{Name: "name", Type: parquet.String},
+	{Name: "n64", Type: parquet.Int64, Optional: true},
+	{Name: "n32", Type: parquet.Int32, Optional: true},
+}
+
+// write writes rows with w's settings changed by set, and decodes the file.
+func write(t *testing.T, columns []parquet.Column, rows [][]any, set func(w *parquet.Writer)) *parquettest.File {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := parquet.NewWriter(&buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set != nil {
+		set(w)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := parquettest.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestRoundTrip(t *testing.T) {
+	ts := time.Date(2025, 1, 31, 10, 0, 0, 123456789, time.FixedZone("x", 3600))
+	rows := [][]any{
+		{ts, "session-start", int64(5), int32(-1)},
+		{nil, "", nil, nil},
+		{ts.Add(time.Hour), []byte("bytes ✓"), 7, 2},
+		{time.Unix(0, 0), strings.Repeat("x", 10000), int64(math.MinInt64), int64(math.MaxInt32)},
+	}
+	for _, codec := range []parquet.Codec{parquet.Gzip, parquet.Uncompressed} {
+		f := write(t, testColumns, rows, func(w *parquet.Writer) {
+			w.Codec = codec
+			w.Metadata = map[string]string{"b": "2", "a": "1"}
+		})
+		if !reflect.DeepEqual(f.Columns, testColumns) {
+			t.Errorf("codec %d: schema = %+v", codec, f.Columns)
+		}
+		// Timestamps come back in UTC, to the microsecond; ints and []byte as their column's type.
+		want := [][]any{
+			{ts.UTC().Truncate(time.Microsecond), "session-start", int64(5), int32(-1)},
+			{nil, "", nil, nil},
+			{ts.Add(time.Hour).UTC().Truncate(time.Microsecond), "bytes ✓", int64(7), int32(2)},
+			{time.Unix(0, 0).UTC(), strings.Repeat("x", 10000), int64(math.MinInt64), int32(math.MaxInt32)},
+		}
+		if !reflect.DeepEqual(f.Rows, want) {
+			t.Errorf("codec %d: rows = %v", codec, f.Rows)
+		}
+		if f.NumRows != 4 || !reflect.DeepEqual(f.RowGroups, []int64{4}) {
+			t.Errorf("codec %d: %d rows in groups %v", codec, f.NumRows, f.RowGroups)
+		}
+		if !reflect.DeepEqual(f.Metadata, map[string]string{"a": "1", "b": "2"}) || f.CreatedBy != "xcodex-hooks-sdk" {
+			t.Errorf("codec %d: metadata %v, created by %q", codec, f.Metadata, f.CreatedBy)
+		}
+		for _, c := range f.Chunks[0] {
+			if c.Codec != codec || c.Values != 4 {
+				t.Errorf("codec %d: chunk %+v", codec, c)
+			}
+		}
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	ts := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := write(t, testColumns, [][]any{
+		{ts.Add(time.Minute), "a", int64(-3), nil},
+		{nil, "b", int64(10), nil},
+		{ts, "c", nil, nil},
+	}, nil)
+	chunks := f.Chunks[0]
+	if c := chunks[0]; !c.HasMinMax || c.Min != ts.UnixMicro() || c.Max != ts.Add(time.Minute).UnixMicro() || c.Nulls != 1 {
+		t.Errorf("timestamp stats = %+v", c)
+	}
+	if c := chunks[1]; c.HasMinMax || c.Nulls != 0 {
+		t.Errorf("string stats = %+v, want no min/max", c)
+	}
+	if c := chunks[2]; !c.HasMinMax || c.Min != -3 || c.Max != 10 || c.Nulls != 1 {
+		t.Errorf("int64 stats = %+v", c)
+	}
+	// An all-null chunk has no min/max.
+	if c := chunks[3]; c.HasMinMax || c.Nulls != 3 {
+		t.Errorf("null int32 stats = %+v", c)
+	}
+}
+
+func TestRowGroups(t *testing.T) {
+	var rows [][]any
+	for i := 0; i < 25; i++ {
+		rows = append(rows, []any{nil, "row", i, nil})
+	}
+	f := write(t, testColumns, rows, func(w *parquet.Writer) { w.RowGroupRows = 10 })
+	if !reflect.DeepEqual(f.RowGroups, []int64{10, 10, 5}) || f.NumRows != 25 {
+		t.Errorf("row groups = %v, %d rows", f.RowGroups, f.NumRows)
+	}
+	for i, row := range f.Rows {
+		if row[2] != int64(i) {
+			t.Errorf("row %d = %v", i, row)
+		}
+	}
+	if c := f.Chunks[1][2]; c.Min != 10 || c.Max != 19 {
+		t.Errorf("second group's stats = %+v", c)
+	}
+
+	// RowGroupBytes bounds the buffered values too.
+	f = write(t, testColumns, rows, func(w *parquet.Writer) { w.RowGroupBytes = 100 })
+	if len(f.RowGroups) < 3 || f.NumRows != 25 || len(f.Rows) != 25 {
+		t.Errorf("byte-bounded row groups = %v, %d rows", f.RowGroups, f.NumRows)
+	}
+
+	// An explicit Flush ends a row group, and Rows counts buffered rows.
+	var buf bytes.Buffer
+	w, _ := parquet.NewWriter(&buf, testColumns)
+	w.Write([]any{nil, "a", nil, nil})
+	w.Flush()
+	w.Flush()
+	w.Write([]any{nil, "b", nil, nil})
+	if w.Rows() != 2 {
+		t.Errorf("Rows = %d, want 2", w.Rows())
+	}
+	w.Close()
+	if f, err := parquettest.Decode(buf.Bytes()); err != nil || !reflect.DeepEqual(f.RowGroups, []int64{1, 1}) {
+		t.Errorf("flushed row groups: %v", err)
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	f := write(t, testColumns, nil, nil)
+	if f.NumRows != 0 || len(f.RowGroups) != 0 || !reflect.DeepEqual(f.Columns, testColumns) {
+		t.Errorf("empty file: %+v", f)
+	}
+}
+
+func TestNewWriterErrors(t *testing.T) {
+	for name, cols := range map[string][]parquet.Column{
+		"no columns":   nil,
+		"no name":      {{Type: parquet.String}},
+		"duplicate":    {{Name: "a", Type: parquet.String}, {Name: "a", Type: parquet.Int32}},
+		"unknown type": {{Name: "a", Type: parquet.Type(9)}},
+	} {
+		if _, err := parquet.NewWriter(&bytes.Buffer{}, cols); err == nil {
+			t.Errorf("%s: NewWriter succeeded", name)
+		}
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := parquet.NewWriter(&buf, testColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, row := range map[string][]any{
+		"short row":        {nil, "a"},
+		"null required":    {nil, nil, nil, nil},
+		"string as int":    {nil, "a", "5", nil},
+		"int32 overflow":   {nil, "a", nil, int64(math.MaxInt32) + 1},
+		"time as string":   {"2025-01-01", "a", nil, nil},
+		"int as string":    {nil, 5, nil, nil},
+		"float as integer": {nil, "a", 1.5, nil},
+	} {
+		if err := w.Write(row); err == nil {
+			t.Errorf("%s: Write succeeded", name)
+		}
+	}
+	// A rejected row left nothing behind.
+	if err := w.Write([]any{nil, "ok", 1, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if err := w.Write([]any{nil, "late", nil, nil}); err == nil {
+		t.Error("Write after Close succeeded")
+	}
+	f, err := parquettest.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f.Rows, [][]any{{nil, "ok", int64(1), int32(1)}}) {
+		t.Errorf("rows = %v", f.Rows)
+	}
+}
+
+// failingWriter fails every write after the first n bytes.
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteFailureSticks(t *testing.T) {
+	if _, err := parquet.NewWriter(&failingWriter{}, testColumns); err == nil {
+		t.Error("NewWriter succeeded without writing the header")
+	}
+	w, err := parquet.NewWriter(&failingWriter{n: 4}, testColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.RowGroupRows = 1
+	if err := w.Write([]any{nil, "a", nil, nil}); err == nil {
+		t.Fatal("a row group was written to a full disk")
+	}
+	if err := w.Write([]any{nil, "b", nil, nil}); err == nil {
+		t.Error("Write succeeded after a failure")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close succeeded after a failure")
+	}
+}
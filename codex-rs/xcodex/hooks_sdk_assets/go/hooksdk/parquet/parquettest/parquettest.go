@@ -0,0 +1,434 @@
+// Package parquettest reads back the Parquet files hooksdk/parquet writes, for tests that check
+// their schema and rows without a Parquet library.
+//
+// It decodes the Thrift footer and page headers generically, then the plain-encoded, optionally
+// gzipped data pages, so only the subset of Parquet the writer produces is supported.
+//
+//	f := parquettest.ReadFile(t, "hooks.parquet")
+//	if f.NumRows != 2 || f.Columns[0].Name != "timestamp" {
+//		t.Errorf("schema %v, %d rows", f.Columns, f.NumRows)
+//	}
+package parquettest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/parquet"
+)
+
+// File is a decoded Parquet file.
+type File struct {
+	Columns []parquet.Column
+	// NumRows is the row count of the footer, and Rows the rows read from the pages, one value
+	// per column: int32, int64, string, time.Time (UTC), or nil for a null.
+	NumRows int64
+	Rows    [][]any
+	// RowGroups holds the row count of each row group.
+	RowGroups []int64
+	// Chunks holds the column chunks of each row group, in schema order.
+	Chunks    [][]Chunk
+	Metadata  map[string]string
+	CreatedBy string
+}
+
+// Chunk is the metadata of one column chunk.
+type Chunk struct {
+	Codec     parquet.Codec
+	Values    int64
+	Nulls     int64
+	Min, Max  int64
+	HasMinMax bool
+}
+
+// ReadFile reads the Parquet file at path, failing the test if it isn't valid.
+func ReadFile(t testing.TB, path string) *File {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Decode(data)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return f
+}
+
+// Decode decodes a whole Parquet file.
+func Decode(data []byte) (*File, error) {
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		return nil, errors.New("not a Parquet file")
+	}
+	n := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if n > len(data)-12 {
+		return nil, fmt.Errorf("footer of %d bytes in a file of %d", n, len(data))
+	}
+	d := &decoder{buf: data[len(data)-8-n : len(data)-8]}
+	meta := d.strct()
+	if d.err != nil {
+		return nil, fmt.Errorf("footer: %v", d.err)
+	}
+	if d.off != len(d.buf) {
+		return nil, fmt.Errorf("footer: %d bytes left over", len(d.buf)-d.off)
+	}
+
+	f := &File{NumRows: i64(meta[3]), Metadata: map[string]string{}, CreatedBy: str(meta[6])}
+	schema := list(meta[2])
+	if len(schema) == 0 {
+		return nil, errors.New("no schema")
+	}
+	if root := strct(schema[0]); int(i64(root[5])) != len(schema)-1 {
+		return nil, fmt.Errorf("schema root has %d children for %d columns", i64(root[5]), len(schema)-1)
+	}
+	for _, el := range schema[1:] {
+		col, err := column(strct(el))
+		if err != nil {
+			return nil, err
+		}
+		f.Columns = append(f.Columns, col)
+	}
+	for _, kv := range list(meta[5]) {
+		kv := strct(kv)
+		f.Metadata[str(kv[1])] = str(kv[2])
+	}
+
+	for g, rg := range list(meta[4]) {
+		rg := strct(rg)
+		rows := i64(rg[3])
+		f.RowGroups = append(f.RowGroups, rows)
+		chunks := list(rg[1])
+		if len(chunks) != len(f.Columns) {
+			return nil, fmt.Errorf("row group %d has %d chunks for %d columns", g, len(chunks), len(f.Columns))
+		}
+		group := make([][]any, rows)
+		for i := range group {
+			group[i] = make([]any, len(f.Columns))
+		}
+		var metas []Chunk
+		for c, cc := range chunks {
+			md := strct(strct(cc)[3])
+			ch := Chunk{Codec: parquet.Codec(i64(md[4])), Values: i64(md[5])}
+			stats := strct(md[12])
+			ch.Nulls = i64(stats[3])
+			if max, ok := stats[5].([]byte); ok {
+				ch.Max, ch.Min, ch.HasMinMax = plainInt(max), plainInt(stats[6].([]byte)), true
+			}
+			metas = append(metas, ch)
+			values, err := readChunk(data, f.Columns[c], ch.Codec, i64(md[9]), rows)
+			if err != nil {
+				return nil, fmt.Errorf("row group %d, column %s: %v", g, f.Columns[c].Name, err)
+			}
+			for r, v := range values {
+				group[r][c] = v
+			}
+		}
+		f.Chunks = append(f.Chunks, metas)
+		f.Rows = append(f.Rows, group...)
+	}
+	if int64(len(f.Rows)) != f.NumRows {
+		return nil, fmt.Errorf("footer counts %d rows, the row groups %d", f.NumRows, len(f.Rows))
+	}
+	return f, nil
+}
+
+// column reads a SchemaElement.
+func column(el map[int16]any) (parquet.Column, error) {
+	col := parquet.Column{Name: str(el[4]), Optional: i64(el[3]) == 1}
+	switch typ, conv := i64(el[1]), el[6]; {
+	case typ == 1 && conv == nil:
+		col.Type = parquet.Int32
+	case typ == 2 && conv == nil:
+		col.Type = parquet.Int64
+	case typ == 2 && i64(conv) == 10:
+		col.Type = parquet.Timestamp
+	case typ == 6 && i64(conv) == 0:
+		col.Type = parquet.String
+	default:
+		return col, fmt.Errorf("column %s: unsupported type %d (converted %v)", col.Name, typ, conv)
+	}
+	return col, nil
+}
+
+// readChunk reads the single data page of a column chunk starting at offset.
+func readChunk(data []byte, col parquet.Column, codec parquet.Codec, offset, rows int64) ([]any, error) {
+	if offset < 4 || offset >= int64(len(data)) {
+		return nil, fmt.Errorf("page offset %d out of range", offset)
+	}
+	d := &decoder{buf: data[offset:]}
+	h := d.strct()
+	if d.err != nil {
+		return nil, fmt.Errorf("page header: %v", d.err)
+	}
+	if i64(h[1]) != 0 {
+		return nil, fmt.Errorf("page type %d, want a data page", i64(h[1]))
+	}
+	if n := i64(strct(h[5])[1]); n != rows {
+		return nil, fmt.Errorf("page of %d values in a row group of %d rows", n, rows)
+	}
+	size := int(i64(h[3]))
+	if d.off+size > len(d.buf) {
+		return nil, errors.New("page runs past the end of the file")
+	}
+	body := d.buf[d.off : d.off+size]
+	switch codec {
+	case parquet.Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if body, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	case parquet.Uncompressed:
+	default:
+		return nil, fmt.Errorf("unsupported codec %d", codec)
+	}
+	if want := int(i64(h[2])); len(body) != want {
+		return nil, fmt.Errorf("page is %d bytes uncompressed, the header says %d", len(body), want)
+	}
+
+	defs := make([]byte, rows)
+	for i := range defs {
+		defs[i] = 1
+	}
+	if col.Optional {
+		if len(body) < 4 {
+			return nil, errors.New("page too short for its levels")
+		}
+		n := int(binary.LittleEndian.Uint32(body))
+		if 4+n > len(body) {
+			return nil, errors.New("levels run past the page")
+		}
+		var err error
+		if defs, err = levels(body[4:4+n], int(rows)); err != nil {
+			return nil, err
+		}
+		body = body[4+n:]
+	}
+
+	values := make([]any, rows)
+	for i := range values {
+		if defs[i] == 0 {
+			continue
+		}
+		var ok bool
+		if values[i], body, ok = plainValue(col.Type, body); !ok {
+			return nil, fmt.Errorf("value %d runs past the page", i)
+		}
+	}
+	if len(body) != 0 {
+		return nil, fmt.Errorf("%d bytes left over in the page", len(body))
+	}
+	return values, nil
+}
+
+// levels decodes n definition levels of bit width 1 in the RLE/bit-packing hybrid encoding.
+func levels(data []byte, n int) ([]byte, error) {
+	var out []byte
+	for len(out) < n {
+		header, k := binary.Uvarint(data)
+		if k <= 0 {
+			return nil, errors.New("bad level run header")
+		}
+		data = data[k:]
+		if header&1 == 1 {
+			// Bit-packed groups of eight.
+			count := int(header>>1) * 8
+			if len(data) < count/8 {
+				return nil, errors.New("bit-packed levels run past the page")
+			}
+			for i := 0; i < count; i++ {
+				out = append(out, data[i/8]>>(i%8)&1)
+			}
+			data = data[count/8:]
+			continue
+		}
+		if len(data) < 1 || data[0] > 1 {
+			return nil, errors.New("bad level run value")
+		}
+		for i := uint64(0); i < header>>1; i++ {
+			out = append(out, data[0])
+		}
+		data = data[1:]
+	}
+	// Bit-packing pads the last group to eight levels.
+	return out[:n], nil
+}
+
+func plainValue(t parquet.Type, b []byte) (any, []byte, bool) {
+	switch t {
+	case parquet.Int32:
+		if len(b) < 4 {
+			return nil, b, false
+		}
+		return int32(binary.LittleEndian.Uint32(b)), b[4:], true
+	case parquet.Int64, parquet.Timestamp:
+		if len(b) < 8 {
+			return nil, b, false
+		}
+		n := int64(binary.LittleEndian.Uint64(b))
+		if t == parquet.Timestamp {
+			return time.UnixMicro(n).UTC(), b[8:], true
+		}
+		return n, b[8:], true
+	}
+	if len(b) < 4 {
+		return nil, b, false
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	if 4+n > len(b) {
+		return nil, b, false
+	}
+	return string(b[4 : 4+n]), b[4+n:], true
+}
+
+func plainInt(b []byte) int64 {
+	if len(b) == 4 {
+		return int64(int32(binary.LittleEndian.Uint32(b)))
+	}
+	if len(b) == 8 {
+		return int64(binary.LittleEndian.Uint64(b))
+	}
+	return math.MinInt64
+}
+
+// decoder reads the Thrift compact protocol into generic values: int64 for the integer types,
+// bool, []byte, []any for lists and sets, and map[int16]any, by field id, for structs.
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf("offset %d: "+format, append([]any{d.off}, args...)...)
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || d.off >= len(d.buf) {
+		d.fail("unexpected end")
+		return 0
+	}
+	b := d.buf[d.off]
+	d.off++
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf[d.off:])
+	if n <= 0 {
+		d.fail("bad varint")
+		return 0
+	}
+	d.off += n
+	return v
+}
+
+func (d *decoder) zigzag() int64 {
+	v := d.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *decoder) strct() map[int16]any {
+	m := map[int16]any{}
+	var id int16
+	for d.err == nil {
+		b := d.byte()
+		typ := b & 0x0f
+		if typ == 0 {
+			return m
+		}
+		if delta := b >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			id = int16(d.zigzag())
+		}
+		switch typ {
+		case 1:
+			m[id] = true
+		case 2:
+			m[id] = false
+		default:
+			m[id] = d.value(typ)
+		}
+	}
+	return m
+}
+
+func (d *decoder) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return d.byte() == 1
+	case 3:
+		return int64(int8(d.byte()))
+	case 4, 5, 6:
+		return d.zigzag()
+	case 7:
+		if d.off+8 > len(d.buf) {
+			d.fail("unexpected end")
+			return nil
+		}
+		d.off += 8
+		return math.Float64frombits(binary.LittleEndian.Uint64(d.buf[d.off-8:]))
+	case 8:
+		n := int(d.uvarint())
+		if d.err != nil || n < 0 || d.off+n > len(d.buf) {
+			d.fail("binary runs past the end")
+			return nil
+		}
+		d.off += n
+		return d.buf[d.off-n : d.off]
+	case 9, 10:
+		b := d.byte()
+		n := int(b >> 4)
+		if n == 15 {
+			n = int(d.uvarint())
+		}
+		out := make([]any, 0, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			out = append(out, d.value(b&0x0f))
+		}
+		return out
+	case 12:
+		return d.strct()
+	}
+	d.fail("unsupported type %d", typ)
+	return nil
+}
+
+func i64(v any) int64 {
+	n, _ := v.(int64)
+	return n
+}
+
+func str(v any) string {
+	b, _ := v.([]byte)
+	return string(b)
+}
+
+func list(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
+
+func strct(v any) map[int16]any {
+	m, _ := v.(map[int16]any)
+	if m == nil {
+		return map[int16]any{}
+	}
+	return m
+}
@@ -0,0 +1,119 @@
+package parquet
+
+import "encoding/binary"
+
+// The Thrift compact protocol, which Parquet uses for its page headers and footer, written by hand
+// (as hooksdk/otel writes protobuf) to keep the SDK free of dependencies. Only the types the
+// Parquet metadata we produce needs are encoded.
+
+// Compact protocol type ids.
+const (
+	ctStop   = 0
+	ctTrue   = 1
+	ctFalse  = 2
+	ctI32    = 5
+	ctI64    = 6
+	ctBinary = 8
+	ctList   = 9
+	ctStruct = 12
+)
+
+// compact builds one Thrift struct. Field ids are encoded relative to the previous field of the
+// same struct, so last keeps one entry per struct being written.
+type compact struct {
+	buf  []byte
+	last []int
+}
+
+func (c *compact) uvarint(v uint64) {
+	c.buf = binary.AppendUvarint(c.buf, v)
+}
+
+func (c *compact) zigzag(v int64) {
+	c.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (c *compact) field(id int, typ byte) {
+	prev := 0
+	if n := len(c.last); n > 0 {
+		prev = c.last[n-1]
+		c.last[n-1] = id
+	}
+	if delta := id - prev; delta > 0 && delta <= 15 {
+		c.buf = append(c.buf, byte(delta<<4)|typ)
+		return
+	}
+	c.buf = append(c.buf, typ)
+	c.zigzag(int64(id))
+}
+
+func (c *compact) i32(id int, v int32) {
+	c.field(id, ctI32)
+	c.zigzag(int64(v))
+}
+
+func (c *compact) i64(id int, v int64) {
+	c.field(id, ctI64)
+	c.zigzag(v)
+}
+
+func (c *compact) bool(id int, v bool) {
+	typ := byte(ctFalse)
+	if v {
+		typ = ctTrue
+	}
+	c.field(id, typ)
+}
+
+func (c *compact) binary(id int, v []byte) {
+	c.field(id, ctBinary)
+	c.uvarint(uint64(len(v)))
+	c.buf = append(c.buf, v...)
+}
+
+func (c *compact) str(id int, s string) {
+	c.binary(id, []byte(s))
+}
+
+// begin starts a struct: a struct field, or, with an id <= 0 (no field header), the top-level
+// struct or an element of a list of structs.
+func (c *compact) begin(id int) {
+	if id > 0 {
+		c.field(id, ctStruct)
+	}
+	c.last = append(c.last, 0)
+}
+
+// end ends the struct begun last.
+func (c *compact) end() {
+	c.buf = append(c.buf, ctStop)
+	c.last = c.last[:len(c.last)-1]
+}
+
+// list starts a list field of n elements of type elem, which the caller then writes.
+func (c *compact) list(id int, elem byte, n int) {
+	c.field(id, ctList)
+	if n < 15 {
+		c.buf = append(c.buf, byte(n<<4)|elem)
+		return
+	}
+	c.buf = append(c.buf, 0xf0|elem)
+	c.uvarint(uint64(n))
+}
+
+// i32List is a list<i32> field.
+func (c *compact) i32List(id int, vs []int32) {
+	c.list(id, ctI32, len(vs))
+	for _, v := range vs {
+		c.zigzag(int64(v))
+	}
+}
+
+// strList is a list<string> field.
+func (c *compact) strList(id int, vs []string) {
+	c.list(id, ctBinary, len(vs))
+	for _, v := range vs {
+		c.uvarint(uint64(len(v)))
+		c.buf = append(c.buf, v...)
+	}
+}
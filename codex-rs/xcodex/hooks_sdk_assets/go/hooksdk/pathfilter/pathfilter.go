@@ -0,0 +1,196 @@
+// Package pathfilter tells which paths git ignores, so hooks can skip file events for
+// node_modules, build output, and the like:
+//
+//	f := pathfilter.New(payload.WorkingDir())
+//	if f.Ignored("node_modules/left-pad/index.js") { ... }
+//
+// The patterns come from the .gitignore files of the repository the directory is in, from its
+// root down to each path's own directory, and from .git/info/exclude, with gitignore(5) semantics:
+// `!` negation, directory-only patterns with a trailing slash, patterns anchored by a slash, `**`,
+// character classes, escapes, and trailing spaces. Git's global excludes file (core.excludesFile)
+// isn't read; pass its patterns as extra patterns to apply them. Parsed files are cached in the
+// process and re-read when they change.
+package pathfilter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+)
+
+// Filter answers whether paths are ignored under one directory.
+type Filter struct {
+	// root is the top of the repository the directory is in, or the directory itself outside a
+	// repository.
+	root  string
+	dir   string
+	extra []pattern
+	// exclude is .git/info/exclude, or "" outside a repository.
+	exclude string
+}
+
+// New returns a Filter for paths under dir (the session's cwd, usually), which finds the
+// repository dir is in by looking upward for .git. Outside a repository, the .gitignore files of
+// dir and the directories below it apply, but not those above it. extra patterns, in .gitignore
+// syntax and relative to the repository root, take precedence over the files, as patterns given
+// to git on the command line do.
+func New(dir string, extra ...string) *Filter {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	f := &Filter{root: dir, dir: dir}
+	for d := dir; ; {
+		if info, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			f.root = d
+			if info.IsDir() {
+				f.exclude = filepath.Join(d, ".git", "info", "exclude")
+			}
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	for _, line := range extra {
+		if p, ok := compile(line); ok {
+			f.extra = append(f.extra, p)
+		}
+	}
+	return f
+}
+
+// Root returns the directory the patterns are relative to: the repository root, or the directory
+// given to New outside a repository.
+func (f *Filter) Root() string { return f.root }
+
+// Ignored reports whether git ignores path, absolute or relative to the directory given to New. A
+// path inside an ignored directory is ignored whatever the patterns say about it, as in git, and
+// paths outside the root, as well as the .git directory itself, are never ignored. A path that
+// doesn't exist (a deleted file) is matched as a file.
+func (f *Filter) Ignored(path string) bool {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(f.dir, path)
+	}
+	rel, err := filepath.Rel(f.root, filepath.Clean(path))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if parts[0] == ".git" {
+		return false
+	}
+	isDir := false
+	if info, err := os.Stat(path); err == nil {
+		isDir = info.IsDir()
+	}
+	// Directories are checked top down: git doesn't look inside an ignored one.
+	for i := range parts {
+		last := i == len(parts)-1
+		if f.excluded(parts[:i+1], !last || isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded applies the patterns to one path, given by its components: the extra patterns, then
+// the .gitignore files from the path's directory up to the root, then .git/info/exclude. The last
+// matching pattern of the first source with one decides.
+func (f *Filter) excluded(parts []string, isDir bool) bool {
+	rel := strings.Join(parts, "/")
+	if ignored, ok := decide(f.extra, rel, isDir); ok {
+		return ignored
+	}
+	for i := len(parts) - 1; i >= 0; i-- {
+		dir := filepath.Join(f.root, filepath.FromSlash(strings.Join(parts[:i], "/")))
+		if ignored, ok := decide(load(filepath.Join(dir, ".gitignore")), strings.Join(parts[i:], "/"), isDir); ok {
+			return ignored
+		}
+	}
+	if f.exclude != "" {
+		if ignored, ok := decide(load(f.exclude), rel, isDir); ok {
+			return ignored
+		}
+	}
+	return false
+}
+
+// decide returns the verdict of the last of patterns matching path; ok is false when none does.
+func decide(patterns []pattern, path string, isDir bool) (ignored, ok bool) {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if patterns[i].match(path, isDir) {
+			return !patterns[i].negate, true
+		}
+	}
+	return false, false
+}
+
+// cache holds parsed pattern files by path, for the life of the process.
+var cache sync.Map
+
+type cached struct {
+	modTime  time.Time
+	size     int64
+	patterns []pattern
+}
+
+// load returns the patterns of the file at path, or none when it doesn't exist. A file is parsed
+// again when its modification time or size changes.
+func load(path string) []pattern {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	if v, ok := cache.Load(path); ok {
+		c := v.(*cached)
+		if c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+			return c.patterns
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	c := &cached{modTime: info.ModTime(), size: info.Size(), patterns: parse(data)}
+	cache.Store(path, c)
+	return c.patterns
+}
+
+// Paths returns the files an event is about: the `paths` of an approval request, or the files a
+// tool call writes (see gitsnap.TouchedPaths).
+func Paths(p *hooksdk.HookPayload) []string {
+	if len(p.Paths) > 0 {
+		return p.Paths
+	}
+	return gitsnap.TouchedPaths(p.ToolInput)
+}
+
+// Middleware returns hooksdk middleware that allows file events whose paths are all ignored (see
+// Paths and Filter.Ignored) without calling the handler, so hooks don't react to changes in
+// node_modules or build output. Events without paths are passed through. extra patterns are
+// passed to New.
+func Middleware(extra ...string) hooksdk.Middleware {
+	return func(next hooksdk.Handler) hooksdk.Handler {
+		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			paths := Paths(p)
+			if len(paths) == 0 {
+				return next(ctx, p)
+			}
+			f := New(p.WorkingDir(), extra...)
+			for _, path := range paths {
+				if !f.Ignored(path) {
+					return next(ctx, p)
+				}
+			}
+			return hooksdk.Allow(), nil
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package pathfilter_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/pathfilter"
+)
+
+// writeFiles creates files under dir, with their directories.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testRepo creates a repository with nested .gitignore files and returns its root.
+func testRepo(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		".git/HEAD":         "ref: refs/heads/main\n",
+		".git/info/exclude": "*.local\n",
+		".gitignore":        "node_modules/\n/build\n*.log\n!keep.log\nvendor/\n!vendor/mine.go\n",
+		"src/.gitignore":    "*.gen.go\n!*.log\ngenerated/\n",
+		"src/main.go":       "package main\n",
+		"src/a.gen.go":      "",
+		"src/generated/x":   "",
+		"node_modules/x.js": "",
+		"build/out":         "",
+		"docs/build/index":  "",
+		"vendor/mine.go":    "",
+	})
+	return root
+}
+
+func TestIgnored(t *testing.T) {
+	root := testRepo(t)
+	f := pathfilter.New(filepath.Join(root, "src"))
+	if f.Root() != root {
+		t.Fatalf("Root = %s, want %s", f.Root(), root)
+	}
+	for path, want := range map[string]bool{
+		"main.go":                      false,
+		"a.gen.go":                     true,
+		"generated/x":                  true,
+		"debug.log":                    false, // src/.gitignore re-includes it
+		"../debug.log":                 true,
+		"../keep.log":                  false,
+		"../node_modules/x.js":         true,
+		"../node_modules":              true,
+		"../a/node_modules/y.js":       true, // a directory, since a path is under it
+		"../build/out":                 true,
+		"../docs/build/index":          false, // /build is anchored
+		"../vendor/mine.go":            true,  // a file in an ignored directory can't be re-included
+		"../settings.local":            true,
+		"../a/node_modules":            false, // doesn't exist, so it is matched as a file
+		"../.git/HEAD":                 false,
+		"../../elsewhere/x.log":        false,
+		filepath.Join(root, "x.o"):     false,
+		filepath.Join(root, "new.log"): true,
+	} {
+		if got := f.Ignored(path); got != want {
+			t.Errorf("Ignored(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestIgnoredExtra(t *testing.T) {
+	root := testRepo(t)
+	// Extra patterns, relative to the root, win over the files.
+	f := pathfilter.New(root, "*.md", "!debug.log", "# not a pattern")
+	for path, want := range map[string]bool{"README.md": true, "docs/guide.md": true, "debug.log": false, "other.log": true} {
+		if got := f.Ignored(path); got != want {
+			t.Errorf("Ignored(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestIgnoredOutsideRepository(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "project")
+	writeFiles(t, parent, map[string]string{
+		".gitignore":         "*.txt\n",
+		"project/.gitignore": "tmp/\n",
+		"project/tmp/x":      "",
+	})
+	f := pathfilter.New(dir)
+	if f.Root() != dir || !f.Ignored("tmp/x") || f.Ignored("notes.txt") {
+		t.Errorf("outside a repository: root %s, tmp/x %v, notes.txt %v", f.Root(), f.Ignored("tmp/x"), f.Ignored("notes.txt"))
+	}
+}
+
+func TestIgnoredReloads(t *testing.T) {
+	root := testRepo(t)
+	if pathfilter.New(root).Ignored("notes.txt") {
+		t.Fatal("notes.txt ignored before the pattern was added")
+	}
+	gitignore := filepath.Join(root, ".gitignore")
+	data, _ := os.ReadFile(gitignore)
+	os.WriteFile(gitignore, append(data, "notes.txt\n"...), 0o644)
+	// A size change alone is noticed, but move the time on too, for coarse file systems.
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(gitignore, later, later)
+	if !pathfilter.New(root).Ignored("notes.txt") {
+		t.Error("the changed .gitignore wasn't read again")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	root := testRepo(t)
+	called := 0
+	h := pathfilter.Middleware("*.tmp")(func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		called++
+		return hooksdk.Deny("handled"), nil
+	})
+	for _, tt := range []struct {
+		name   string
+		b      *hooktest.Builder
+		called bool
+	}{
+		{"all ignored", hooktest.ApprovalRequested().With("paths", []string{"node_modules/x.js", "src/a.gen.go", "x.tmp"}), false},
+		{"one not ignored", hooktest.ApprovalRequested().With("paths", []string{"node_modules/x.js", "src/main.go"}), true},
+		{"apply_patch", hooktest.ToolCallStarted().WithToolName("apply_patch").With("tool_input", map[string]any{"input": "*** Begin Patch\n*** Add File: build/out2\n+x\n*** End Patch"}), false},
+		{"no paths", hooktest.SessionStart(), true},
+	} {
+		called = 0
+		resp, err := h(context.Background(), tt.b.WithCwd(root).Build())
+		if err != nil || (called == 1) != tt.called || (resp.Decision == hooksdk.DecisionDeny) != tt.called {
+			t.Errorf("%s: %+v, %v, handler called %d times", tt.name, resp, err, called)
+		}
+	}
+}
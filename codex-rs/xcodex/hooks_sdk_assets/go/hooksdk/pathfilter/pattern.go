@@ -0,0 +1,173 @@
+package pathfilter
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// pattern is one line of a .gitignore file.
+type pattern struct {
+	re *regexp.Regexp
+	// negate is set for `!` patterns, which re-include what an earlier one excluded.
+	negate bool
+	// dirOnly is set for patterns with a trailing slash, which only match directories.
+	dirOnly bool
+}
+
+// parse returns the patterns of a .gitignore file's content, in order.
+func parse(data []byte) []pattern {
+	var out []pattern
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 4096), 1<<20)
+	for sc.Scan() {
+		if p, ok := compile(sc.Text()); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// compile compiles one pattern, as gitignore(5) describes them. ok is false for blank lines,
+// comments, and patterns that can't match anything.
+func compile(line string) (pattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	line = trimTrailingSpaces(line)
+	if line == "" || line[0] == '#' {
+		return pattern{}, false
+	}
+	var p pattern
+	if line[0] == '!' {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+	// A slash at the start or in the middle anchors the pattern to the .gitignore's directory;
+	// without one it matches at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == '*':
+			start := i
+			for i < len(line) && line[i] == '*' {
+				i++
+			}
+			// A run of asterisks that is a whole component matches across directories, as in git:
+			// leading `**/` and inner `/**/` match any number of them, trailing `/**` everything
+			// inside. Other runs are plain asterisks.
+			switch whole := i-start >= 2 && (start == 0 || line[start-1] == '/'); {
+			case whole && i == len(line):
+				re.WriteString(".*")
+			case whole && line[i] == '/':
+				re.WriteString("(?:.*/)?")
+				i++
+			default:
+				re.WriteString("[^/]*")
+			}
+		case c == '?':
+			re.WriteString("[^/]")
+			i++
+		case c == '[':
+			class, n, ok := bracket(line[i:])
+			if !ok {
+				re.WriteString(`\[`)
+				i++
+				continue
+			}
+			re.WriteString(class)
+			i += n
+		case c == '\\' && i+1 < len(line):
+			re.WriteString(regexp.QuoteMeta(line[i+1 : i+2]))
+			i += 2
+		default:
+			re.WriteString(regexp.QuoteMeta(line[i : i+1]))
+			i++
+		}
+	}
+	re.WriteString("$")
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return pattern{}, false
+	}
+	p.re = compiled
+	return p, true
+}
+
+// trimTrailingSpaces removes trailing spaces, except one escaped with a backslash.
+func trimTrailingSpaces(line string) string {
+	end := len(line)
+	for end > 0 && line[end-1] == ' ' {
+		if end >= 2 && line[end-2] == '\\' {
+			break
+		}
+		end--
+	}
+	return line[:end]
+}
+
+// bracket translates the character class at the start of s (`[a-z]`, `[!0-9]`, `[]x]`,
+// `[[:alpha:]]`) to a regexp class, and returns its length in s. A negated class never matches a
+// slash. ok is false when the class isn't closed.
+func bracket(s string) (class string, n int, ok bool) {
+	i := 1
+	negate := false
+	if i < len(s) && (s[i] == '!' || s[i] == '^') {
+		negate = true
+		i++
+	}
+	var body strings.Builder
+	first := true
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ']' && !first:
+			if negate {
+				return "[^/" + body.String() + "]", i + 1, true
+			}
+			return "[" + body.String() + "]", i + 1, true
+		case c == '[' && strings.HasPrefix(s[i:], "[:"):
+			end := strings.Index(s[i+2:], ":]")
+			if end < 0 {
+				return "", 0, false
+			}
+			body.WriteString(s[i : i+2+end+2])
+			i += 2 + end + 2
+		case c == '\\' && i+1 < len(s):
+			body.WriteString(regexp.QuoteMeta(s[i+1 : i+2]))
+			i += 2
+		case c == '-' && !first && i+1 < len(s) && s[i+1] != ']':
+			body.WriteByte('-')
+			i++
+		case c == '-':
+			body.WriteString(`\-`)
+			i++
+		default:
+			body.WriteString(regexp.QuoteMeta(s[i : i+1]))
+			i++
+		}
+		first = false
+	}
+	return "", 0, false
+}
+
+// match reports whether p matches path, relative to the pattern's .gitignore and in slash form.
+func (p pattern) match(path string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	return p.re.MatchString(path)
+}
@@ -0,0 +1,91 @@
+package pathfilter
+
+import "testing"
+
+// TestPatternMatch runs gitignore edge cases, most from git's own wildmatch and check-ignore
+// tests. paths ending in a slash are directories.
+func TestPatternMatch(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{"foo", []string{"foo", "a/foo", "a/b/foo/", "foo/"}, []string{"foobar", "afoo", "foo.c"}},
+		{"/foo", []string{"foo", "foo/"}, []string{"a/foo"}},
+		{"foo/", []string{"foo/", "a/foo/"}, []string{"foo", "a/foo"}},
+		{"a/b", []string{"a/b", "a/b/"}, []string{"x/a/b", "a/x/b"}},
+		{"doc/*.txt", []string{"doc/notes.txt"}, []string{"doc/server/arch.txt", "a/doc/notes.txt"}},
+		{"*.o", []string{"main.o", "a/b/main.o", ".o"}, []string{"main.oo", "main.o.c"}},
+		{"f?o", []string{"foo", "fxo"}, []string{"fo", "f/o", "fooo"}},
+		{"*", []string{"anything", "a/b"}, nil},
+		{"a*", []string{"abc", "x/abc"}, []string{"ba"}},
+
+		// `**`.
+		{"**/foo", []string{"foo", "a/foo", "a/b/foo"}, []string{"foobar"}},
+		{"**/foo/bar", []string{"foo/bar", "a/b/foo/bar"}, []string{"foo/x/bar"}},
+		{"abc/**", []string{"abc/x", "abc/x/y/"}, []string{"abc", "x/abc/y"}},
+		{"a/**/b", []string{"a/b", "a/x/b", "a/x/y/b"}, []string{"a/xb", "ab", "x/a/b"}},
+		{"a**b", []string{"ab", "axxb"}, []string{"a/b", "a/x/b"}},
+		{"**", []string{"x", "x/y"}, nil},
+		{"foo/**/", []string{"foo/x/", "foo/x/y/"}, []string{"foo/x"}},
+
+		// Character classes and escapes.
+		{"[abc].txt", []string{"a.txt", "c.txt"}, []string{"d.txt", "ab.txt"}},
+		{"[a-c]x", []string{"bx"}, []string{"dx"}},
+		{"[!a-c]x", []string{"dx", "zx"}, []string{"ax", "/x"}},
+		{"[^a]x", []string{"bx"}, []string{"ax"}},
+		{"[]]x", []string{"]x"}, []string{"ax"}},
+		{"[[:digit:]]*", []string{"1abc"}, []string{"abc"}},
+		{"[[:upper:][:digit:]]", []string{"A", "7"}, []string{"a"}},
+		{"[unclosed", []string{"[unclosed"}, []string{"u"}},
+		{`\#hash`, []string{"#hash"}, []string{"hash"}},
+		{`\!bang`, []string{"!bang"}, []string{"bang"}},
+		{`\*star`, []string{"*star"}, []string{"xstar"}},
+		{`a\?`, []string{"a?"}, []string{"ab"}},
+		{"a.b", []string{"a.b"}, []string{"axb"}},
+		{"(x)+", []string{"(x)+"}, []string{"xx"}},
+
+		// Trailing spaces are dropped unless escaped; other whitespace is kept.
+		{"trail  ", []string{"trail"}, []string{"trail  "}},
+		{`trail\ `, []string{"trail "}, []string{"trail"}},
+		{`trail\  `, []string{"trail "}, []string{"trail", "trail  "}},
+		{" lead", []string{" lead"}, []string{"lead"}},
+		{"crlf\r", []string{"crlf"}, []string{"crlf\r"}},
+	} {
+		p, ok := compile(tt.pattern)
+		if !ok {
+			t.Errorf("compile(%q) failed", tt.pattern)
+			continue
+		}
+		check := func(path string, want bool) {
+			isDir := len(path) > 1 && path[len(path)-1] == '/'
+			if isDir {
+				path = path[:len(path)-1]
+			}
+			if got := p.match(path, isDir); got != want {
+				t.Errorf("%q matches %q (dir %v) = %v, want %v", tt.pattern, path, isDir, got, want)
+			}
+		}
+		for _, path := range tt.match {
+			check(path, true)
+		}
+		for _, path := range tt.noMatch {
+			check(path, false)
+		}
+	}
+}
+
+func TestCompileSkips(t *testing.T) {
+	for _, line := range []string{"", "   ", "# comment", "#", "!", "/", "!/"} {
+		if p, ok := compile(line); ok {
+			t.Errorf("compile(%q) = %v, want no pattern", line, p.re)
+		}
+	}
+	p, ok := compile("!keep.log")
+	if !ok || !p.negate || !p.match("keep.log", false) {
+		t.Errorf("negated pattern = %+v, %v", p, ok)
+	}
+	if got := parse([]byte("# build output\nbuild/\n\n*.log\r\n!keep.log\n")); len(got) != 3 || !got[0].dirOnly || !got[2].negate {
+		t.Errorf("parse = %+v", got)
+	}
+}
@@ -0,0 +1,87 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Common is the set of accessors every payload returned by the SDK supports, so code that only
+// needs the event type, session id, or cwd doesn't depend on a concrete payload shape.
+type Common interface {
+	EventType() string
+	SessionID() string
+	WorkingDir() string
+	Time() time.Time
+	Raw() map[string]any
+}
+
+var _ Common = (*HookPayload)(nil)
+
+// EventType returns the `xcodex_event_type` (e.g. "tool-call-finished").
+//
+// For payloads that don't carry the field it falls back to the legacy `type` key from the raw map.
+func (p *HookPayload) EventType() string {
+	if p.XcodexEventType != "" {
+		return p.XcodexEventType
+	}
+	return rawString(p.RawPayload, "type")
+}
+
+// Type returns p.EventType() as an EventType, for comparing with the Event* constants.
+func (p *HookPayload) Type() EventType {
+	return EventType(p.EventType())
+}
+
+// SessionID returns the session (thread) id, falling back to legacy raw keys when `session_id` is
+// absent.
+func (p *HookPayload) SessionID() string {
+	if p.SessionId != "" {
+		return p.SessionId
+	}
+	return rawString(p.RawPayload, "thread_id", "thread-id", "session-id")
+}
+
+// WorkingDir returns the working directory of the session. (The method can't be named Cwd because
+// that is the generated field name.)
+func (p *HookPayload) WorkingDir() string {
+	if p.Cwd != "" {
+		return p.Cwd
+	}
+	return rawString(p.RawPayload, "cwd")
+}
+
+// Time parses the payload timestamp (RFC 3339). It returns the zero time if the timestamp is
+// missing or malformed.
+func (p *HookPayload) Time() time.Time {
+	ts := p.Timestamp
+	if ts == "" {
+		ts = rawString(p.RawPayload, "timestamp")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Raw returns the full decoded payload object, including fields the typed struct doesn't know
+// about. It is the payload's own map, not a copy: Clone the payload before mutating it if the
+// original is still needed.
+func (p *HookPayload) Raw() map[string]any {
+	return p.RawPayload
+}
+
+// RawJSON returns the payload's bytes as they were read, before any schema migration, when it was
+// parsed with WithRawJSON, and nil otherwise. Like Raw, it is not a copy; don't modify it.
+func (p *HookPayload) RawJSON() json.RawMessage {
+	return p.rawJSON
+}
+
+func rawString(raw map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := raw[key].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,55 @@
+package hooksdk_test
+
+import (
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestCommonAccessorsConsistent(t *testing.T) {
+	want := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	for name, b := range hooktest.Fixtures() {
+		b.WithSessionID("s1").WithCwd("/work").With("timestamp", want.Format(time.RFC3339))
+		p, err := hooksdk.ParseHookPayload(b.Bytes())
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if p.EventType() != name || p.SessionID() != "s1" || p.WorkingDir() != "/work" || !p.Time().Equal(want) {
+			t.Errorf("%s: accessors = %q, %q, %q, %v", name, p.EventType(), p.SessionID(), p.WorkingDir(), p.Time())
+		}
+
+		ev, err := p.Event()
+		if err != nil {
+			t.Errorf("%s: Event: %v", name, err)
+			continue
+		}
+		if ev.Type() != p.Type() {
+			t.Errorf("%s: Event().Type() = %q", name, ev.Type())
+		}
+		raw := ev.Raw()
+		if raw["session_id"] != "s1" || raw["cwd"] != "/work" || raw["xcodex_event_type"] != name {
+			t.Errorf("%s: Event().Raw() doesn't match the accessors: %v", name, raw)
+		}
+	}
+}
+
+func TestCommonAccessorsFallBackToRawKeys(t *testing.T) {
+	b := hooktest.New("", "").With("xcodex_event_type", nil).With("session_id", nil).With("timestamp", "not a time").
+		With("type", "future-event").With("thread_id", "t1")
+	p, err := hooksdk.ParseHookPayload(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.EventType() != "future-event" || p.SessionID() != "t1" {
+		t.Errorf("accessors = %q, %q; want the legacy keys", p.EventType(), p.SessionID())
+	}
+	if !p.Time().IsZero() {
+		t.Errorf("Time() = %v, want zero for a malformed timestamp", p.Time())
+	}
+	if p.Raw()["thread_id"] != "t1" {
+		t.Errorf("Raw() = %v, want every field", p.Raw())
+	}
+}
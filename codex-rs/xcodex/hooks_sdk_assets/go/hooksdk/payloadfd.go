@@ -0,0 +1,40 @@
+package hooksdk
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// PayloadFDEnv names a file descriptor (3 or above) to read the hook's input from instead of
+// stdin, leaving stdin to the hook, e.g. for a hook that wraps an interactive tool and forwards
+// its own stdin to it. The descriptor carries what stdin would (the payload or an envelope) and is
+// closed once read. When it isn't open, stdin is read as usual. A stdin envelope can also point at
+// a descriptor with `payload_fd`, like `payload_path`, in which case the descriptor must be open.
+//
+// Passing descriptors to a child is a Unix feature (exec.Cmd.ExtraFiles); elsewhere the
+// descriptor is never open.
+const PayloadFDEnv = "CODEX_HOOK_PAYLOAD_FD"
+
+// openPayloadFD returns the open file for fd, or an error matching ErrPayloadFDNotOpen. The fd is
+// checked before it is wrapped in an *os.File, so a closed number is never closed later by the
+// file's finalizer, after something else reused it.
+func openPayloadFD(fd int) (*os.File, error) {
+	if fd < 3 {
+		return nil, fmt.Errorf("%w: fd %d is one of stdin, stdout, and stderr", ErrInvalidEnvelope, fd)
+	}
+	if !fdOpen(fd) {
+		return nil, fmt.Errorf("%w: fd %d", ErrPayloadFDNotOpen, fd)
+	}
+	return os.NewFile(uintptr(fd), fmt.Sprintf("payload_fd %d", fd)), nil
+}
+
+// readPayloadFD reads fd to EOF, at most limit bytes, and closes it.
+func readPayloadFD(ctx context.Context, fd int, limit int64) ([]byte, error) {
+	f, err := openPayloadFD(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readAllLimit(ctx, f, limit, f.Name())
+}
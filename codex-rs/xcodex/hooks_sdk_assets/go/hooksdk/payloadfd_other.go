@@ -0,0 +1,6 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package hooksdk
+
+// Only Unix hands descriptors to child processes by number.
+func fdOpen(fd int) bool { return false }
@@ -0,0 +1,144 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// payloadFDMain is the hook HOOKSDK_TEST_PAYLOAD_FD runs: it reads the payload with ReadPayload,
+// then the rest of its stdin, and prints `<session id>|<stdin>`. With HOOKSDK_TEST_OPEN_PAYLOAD
+// set it streams the payload with OpenPayload instead, and prints `<size>|<sha256>`.
+func payloadFDMain() {
+	if os.Getenv("HOOKSDK_TEST_OPEN_PAYLOAD") != "" {
+		rc, size, err := hooksdk.OpenPayload()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		sum := sha256.New()
+		io.Copy(sum, rc)
+		rc.Close()
+		fmt.Printf("%d|%x", size, sum.Sum(nil))
+		os.Exit(0)
+	}
+	p, err := hooksdk.ReadPayload()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	rest, _ := io.ReadAll(os.Stdin)
+	fmt.Printf("%s|%s", p.SessionID(), rest)
+	os.Exit(0)
+}
+
+func skipWithoutFDs(t *testing.T) {
+	t.Helper()
+	switch runtime.GOOS {
+	case "windows", "plan9", "js", "wasip1":
+		t.Skipf("descriptors aren't passed by number on %s", runtime.GOOS)
+	}
+}
+
+// runWithFD runs payloadFDMain with stdin, and fd 3 reading extra when it isn't nil, and returns
+// its output.
+func runWithFD(t *testing.T, stdin, extra []byte, env ...string) (string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(append(os.Environ(), "HOOKSDK_TEST_PAYLOAD_FD=1", "CODEX_HOME="+t.TempDir(), hooksdk.PayloadPathEnv+"=", hooksdk.PayloadFDEnv+"="), env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	if extra != nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		go func() {
+			w.Write(extra)
+			w.Close()
+		}()
+		cmd.ExtraFiles = []*os.File{r}
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%v: %s", err, stderr.String())
+	}
+	return string(out), nil
+}
+
+func TestPayloadFDEnv(t *testing.T) {
+	skipWithoutFDs(t)
+	payload := hooktest.ToolCallStarted().WithSessionID("s-fd").Bytes()
+
+	// The payload comes on fd 3, and stdin is left to the hook.
+	got, err := runWithFD(t, []byte("typed by the user"), payload, hooksdk.PayloadFDEnv+"=3")
+	if err != nil || got != "s-fd|typed by the user" {
+		t.Errorf("payload on fd 3: %q, %v", got, err)
+	}
+	// An envelope on fd 3 is resolved as one on stdin.
+	envelope := hooktest.WriteEnvelope(t, payload)
+	if got, err := runWithFD(t, nil, envelope, hooksdk.PayloadFDEnv+"=3"); err != nil || got != "s-fd|" {
+		t.Errorf("envelope on fd 3: %q, %v", got, err)
+	}
+	// When the descriptor isn't open, stdin is read as usual.
+	stdinPayload := hooktest.ToolCallStarted().WithSessionID("s-stdin").Bytes()
+	if got, err := runWithFD(t, stdinPayload, nil, hooksdk.PayloadFDEnv+"=3"); err != nil || got != "s-stdin|" {
+		t.Errorf("fd 3 not open: %q, %v", got, err)
+	}
+}
+
+func TestPayloadFDEnvelope(t *testing.T) {
+	skipWithoutFDs(t)
+	payload := hooktest.ToolCallStarted().WithSessionID("s-envelope-fd").Bytes()
+	if got, err := runWithFD(t, []byte(`{"payload_fd": 3}`), payload); err != nil || got != "s-envelope-fd|" {
+		t.Errorf("payload_fd 3: %q, %v", got, err)
+	}
+	gz := gzipBytes(t, payload)
+	if got, err := runWithFD(t, []byte(`{"payload_fd": 3, "payload_encoding": "gzip"}`), gz); err != nil || got != "s-envelope-fd|" {
+		t.Errorf("gzipped payload_fd 3: %q, %v", got, err)
+	}
+	// An envelope naming a descriptor that isn't open fails, saying so.
+	_, err := runWithFD(t, []byte(`{"payload_fd": 3}`), nil)
+	if err == nil || !strings.Contains(err.Error(), "payload_fd not open: fd 3") {
+		t.Errorf("payload_fd 3 not open: %v", err)
+	}
+}
+
+func TestPayloadFDEnvelopeErrors(t *testing.T) {
+	for _, stdin := range []string{
+		`{"payload_fd": 0}`,
+		`{"payload_fd": 2}`,
+		`{"payload_fd": "3"}`,
+		`{"payload_fd": 3.5}`,
+		`{"payload_fd": 3, "payload_path": "/tmp/payload.json"}`,
+		`{"payload_fd": 3, "payload": {"session_id": "s1"}}`,
+	} {
+		if _, err := hooksdk.ReadPayloadFrom(strings.NewReader(stdin)); !errors.Is(err, hooksdk.ErrInvalidEnvelope) {
+			t.Errorf("%s: err = %v, want ErrInvalidEnvelope", stdin, err)
+		}
+	}
+	// A number nothing is open on, well past what a test process has.
+	if _, err := hooksdk.ReadPayloadFrom(strings.NewReader(`{"payload_fd": 1000000}`)); !errors.Is(err, hooksdk.ErrPayloadFDNotOpen) {
+		t.Errorf("closed payload_fd: err = %v, want ErrPayloadFDNotOpen", err)
+	}
+}
+
+func TestEnvPayloadFD(t *testing.T) {
+	for v, want := range map[string]int{"3": 3, " 9 ": 9, "": 0, "2": 0, "0": 0, "-3": 0, "fd3": 0} {
+		if got := hooksdk.FromMap(map[string]string{hooksdk.PayloadFDEnv: v}).PayloadFD; got != want {
+			t.Errorf("%s=%q: PayloadFD = %d, want %d", hooksdk.PayloadFDEnv, v, got, want)
+		}
+	}
+}
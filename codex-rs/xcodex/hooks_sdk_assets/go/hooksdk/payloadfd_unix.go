@@ -0,0 +1,10 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package hooksdk
+
+import "syscall"
+
+func fdOpen(fd int) bool {
+	var st syscall.Stat_t
+	return syscall.Fstat(fd, &st) == nil
+}
@@ -0,0 +1,148 @@
+package hooksdk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrPayloadPathNotAllowed is returned under WithAllowedPayloadDirs for a payload_path outside the
+// allowed directories, or one that isn't a regular file. The failure is a
+// *PayloadPathNotAllowedError (see errors.As).
+var ErrPayloadPathNotAllowed = errors.New("payload_path not allowed")
+
+// PayloadPathNotAllowedError reports a payload_path WithAllowedPayloadDirs refused. It matches
+// ErrPayloadPathNotAllowed with errors.Is.
+type PayloadPathNotAllowedError struct {
+	// Path is the path as the envelope named it.
+	Path string
+	// Resolved is Path made absolute, cleaned, and with its symlinks resolved, as far as it exists.
+	Resolved string
+	// Reason is "outside the allowed directories", "not a regular file", or "changed while it was
+	// checked".
+	Reason string
+}
+
+func (e *PayloadPathNotAllowedError) Error() string {
+	if e.Resolved != "" && e.Resolved != e.Path {
+		return "payload_path " + e.Path + " (" + e.Resolved + ") not allowed: " + e.Reason
+	}
+	return "payload_path " + e.Path + " not allowed: " + e.Reason
+}
+
+func (e *PayloadPathNotAllowedError) Is(target error) bool { return target == ErrPayloadPathNotAllowed }
+
+// WithAllowedPayloadDirs only reads a payload_path file inside dirs, or, with no dirs, inside
+// os.TempDir() and CODEX_HOME (where the host writes them), so a caller can't make the hook read,
+// and maybe log or forward, any file it can open. The path is made absolute, cleaned, and its
+// symlinks are resolved before it is compared with the directories (whose symlinks are resolved
+// too), so neither `..` nor a link escapes them. Device files, FIFOs, and other files that aren't
+// regular are refused as well. A refused path fails with a *PayloadPathNotAllowedError, and is
+// never removed for "cleanup": true.
+//
+// The check also applies to a payload file named by hand (CODEX_HOOK_PAYLOAD_PATH or the first
+// argument); payload_fd and payloads on stdin aren't affected.
+func WithAllowedPayloadDirs(dirs ...string) Option {
+	return func(o *options) {
+		o.restrictPayloadPath = true
+		o.allowedPayloadDirs = append([]string(nil), dirs...)
+	}
+}
+
+// readAllowedPayloadFile is readFileContext for WithAllowedPayloadDirs.
+func (o *options) readAllowedPayloadFile(ctx context.Context, path string) ([]byte, error) {
+	f, err := o.openAllowedPayloadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readAllLimit(ctx, f, o.maxPayloadBytes, "payload_path "+path)
+}
+
+// openAllowedPayloadFile opens the payload_path file at path under WithAllowedPayloadDirs.
+func (o *options) openAllowedPayloadFile(path string) (*os.File, error) {
+	resolved, info, err := o.checkPayloadPath(path)
+	if err != nil {
+		return nil, err
+	}
+	// A FIFO would block the open, so it is refused before; the open file must be the one checked,
+	// not one a symlink was swapped to in the meantime.
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if opened, err := f.Stat(); err != nil {
+		f.Close()
+		return nil, err
+	} else if !os.SameFile(info, opened) {
+		f.Close()
+		return nil, &PayloadPathNotAllowedError{Path: path, Resolved: resolved, Reason: "changed while it was checked"}
+	}
+	return f, nil
+}
+
+// checkPayloadPath resolves path and checks it against the allowed directories, returning the
+// resolved path and its file info.
+func (o *options) checkPayloadPath(path string) (string, os.FileInfo, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", nil, err
+	}
+	resolved, resolveErr := filepath.EvalSymlinks(abs)
+	if resolveErr != nil {
+		// Compare the path as named, so a missing file outside the directories is refused the same
+		// way as an existing one and the error doesn't tell which it is.
+		resolved = abs
+	}
+	if !o.payloadPathAllowed(resolved) {
+		return "", nil, &PayloadPathNotAllowedError{Path: path, Resolved: resolved, Reason: "outside the allowed directories"}
+	}
+	if resolveErr != nil {
+		return "", nil, resolveErr
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil, &PayloadPathNotAllowedError{Path: path, Resolved: resolved, Reason: "not a regular file"}
+	}
+	return resolved, info, nil
+}
+
+// payloadPathAllowed reports whether the resolved path is inside one of the allowed directories.
+func (o *options) payloadPathAllowed(resolved string) bool {
+	dirs := o.allowedPayloadDirs
+	if len(dirs) == 0 {
+		dirs = []string{os.TempDir(), o.stdio.Environ().CodexHome}
+	}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		root, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if r, err := filepath.EvalSymlinks(root); err == nil {
+			root = r
+		}
+		if withinDir(root, resolved) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinDir reports whether path is root or inside it. Both must be absolute and clean. On
+// Windows, filepath.Rel compares case-insensitively, accepts either separator, and fails for paths
+// on different volumes.
+func withinDir(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
@@ -0,0 +1,159 @@
+package hooksdk_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// readFromPath reads the payload an envelope naming path points at, with opts and CODEX_HOME set
+// to codexHome.
+func readFromPath(path, codexHome string, opts ...hooksdk.Option) (*hooksdk.HookPayload, error) {
+	stdin, _ := json.Marshal(map[string]any{"payload_path": path, "cleanup": true})
+	stdio, _, _ := testIO(stdin, map[string]string{"CODEX_HOME": codexHome})
+	return hooksdk.ReadPayload(append(opts, hooksdk.WithIO(stdio))...)
+}
+
+// refusal returns why err refused a payload_path, or "" if it didn't.
+func refusal(err error) string {
+	var pe *hooksdk.PayloadPathNotAllowedError
+	if !errors.As(err, &pe) || !errors.Is(err, hooksdk.ErrPayloadPathNotAllowed) {
+		return ""
+	}
+	return pe.Reason
+}
+
+func writePayload(t *testing.T, path, session string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, hooktest.SessionStart().WithSessionID(session).Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		if runtime.GOOS == "windows" {
+			t.Skipf("symlinks: %v", err)
+		}
+		t.Fatal(err)
+	}
+}
+
+func TestAllowedPayloadDirs(t *testing.T) {
+	allowed, outside := t.TempDir(), t.TempDir()
+	inside := writePayload(t, filepath.Join(allowed, "in", "payload.json"), "in")
+	secret := writePayload(t, filepath.Join(outside, "secret.json"), "secret")
+	opt := hooksdk.WithAllowedPayloadDirs(allowed)
+
+	if p, err := readFromPath(inside, "", opt); err != nil || p.SessionID() != "in" {
+		t.Fatalf("inside: %v, %v", p, err)
+	}
+	for name, path := range map[string]string{
+		"outside":   secret,
+		"..":        filepath.Join(allowed, "in", "..", "..", filepath.Base(outside), "secret.json"),
+		"prefix":    writePayload(t, allowed+"x"+string(filepath.Separator)+"payload.json", "prefix"),
+		"missing":   filepath.Join(outside, "gone.json"),
+		"directory": filepath.Join(allowed, "in"),
+	} {
+		_, err := readFromPath(path, "", opt)
+		want := "outside the allowed directories"
+		if name == "directory" {
+			want = "not a regular file"
+		}
+		if got := refusal(err); got != want {
+			t.Errorf("%s: %v, want it refused as %s", name, err, want)
+		}
+	}
+	if _, err := os.Stat(secret); err != nil {
+		t.Errorf("a refused file was cleaned up: %v", err)
+	}
+	// A missing file inside is just missing.
+	var pe *hooksdk.PayloadPathError
+	if _, err := readFromPath(filepath.Join(allowed, "gone.json"), "", opt); !errors.As(err, &pe) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing inside: %v", err)
+	}
+	// Without the option, any path is read.
+	if p, err := readFromPath(secret, ""); err != nil || p.SessionID() != "secret" {
+		t.Errorf("unrestricted: %v, %v", p, err)
+	}
+}
+
+func TestAllowedPayloadDirsSymlinks(t *testing.T) {
+	allowed, outside := t.TempDir(), t.TempDir()
+	inside := writePayload(t, filepath.Join(allowed, "payload.json"), "in")
+	secret := writePayload(t, filepath.Join(outside, "secret.json"), "secret")
+	symlink(t, secret, filepath.Join(allowed, "escape.json"))
+	symlink(t, outside, filepath.Join(allowed, "escape-dir"))
+	symlink(t, inside, filepath.Join(allowed, "alias.json"))
+	symlink(t, allowed, filepath.Join(outside, "allowed-link"))
+	opt := hooksdk.WithAllowedPayloadDirs(allowed)
+
+	for _, path := range []string{filepath.Join(allowed, "escape.json"), filepath.Join(allowed, "escape-dir", "secret.json")} {
+		if _, err := readFromPath(path, "", opt); refusal(err) != "outside the allowed directories" {
+			t.Errorf("%s: %v, want it refused", path, err)
+		}
+	}
+	if _, err := os.Stat(secret); err != nil {
+		t.Errorf("a refused link's target was cleaned up: %v", err)
+	}
+	// Links that stay inside are fine, as is a directory allowed through a link. (cleanup removes
+	// the link, then the file.)
+	if p, err := readFromPath(filepath.Join(allowed, "alias.json"), "", opt); err != nil || p.SessionID() != "in" {
+		t.Errorf("link inside: %v, %v", p, err)
+	}
+	if p, err := readFromPath(inside, "", hooksdk.WithAllowedPayloadDirs(filepath.Join(outside, "allowed-link"))); err != nil || p.SessionID() != "in" {
+		t.Errorf("directory allowed through a link: %v, %v", p, err)
+	}
+}
+
+func TestAllowedPayloadDirsDefaults(t *testing.T) {
+	outside, tmp, home := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("TMP", tmp)
+	opt := hooksdk.WithAllowedPayloadDirs()
+	for _, path := range []string{filepath.Join(tmp, "payload.json"), filepath.Join(home, "payloads", "payload.json")} {
+		writePayload(t, path, "default")
+		if p, err := readFromPath(path, home, opt); err != nil || p.SessionID() != "default" {
+			t.Errorf("%s: %v, %v", path, p, err)
+		}
+	}
+	path := writePayload(t, filepath.Join(outside, "payload.json"), "outside")
+	if _, err := readFromPath(path, home, opt); refusal(err) == "" {
+		t.Errorf("outside TMPDIR and CODEX_HOME: %v, want it refused", err)
+	}
+	if _, err := readFromPath(path, "", opt); refusal(err) == "" {
+		t.Errorf("without CODEX_HOME: %v, want it refused", err)
+	}
+	if err := (&hooksdk.PayloadPathNotAllowedError{Path: "p", Resolved: "/r/p", Reason: "why"}).Error(); !strings.Contains(err, "p (/r/p) not allowed: why") {
+		t.Errorf("Error() = %q", err)
+	}
+}
+
+func TestAllowedPayloadDirsByHand(t *testing.T) {
+	allowed, outside := t.TempDir(), t.TempDir()
+	secret := writePayload(t, filepath.Join(outside, "secret.json"), "secret")
+	env := map[string]string{hooksdk.PayloadPathEnv: secret}
+	stdio := hooksdk.IO{Getenv: func(k string) string { return env[k] }}
+	_, err := hooksdk.ReadPayloadFrom(strings.NewReader(""), hooksdk.WithIO(stdio), hooksdk.WithAllowedPayloadDirs(allowed))
+	if refusal(err) == "" {
+		t.Errorf("%s: %v, want it refused", hooksdk.PayloadPathEnv, err)
+	}
+	// An inline payload isn't a path.
+	stdin, _ := json.Marshal(map[string]any{"payload": hooktest.SessionStart().WithSessionID("inline").Map()})
+	stdio, _, _ = testIO(stdin, nil)
+	if p, err := hooksdk.ReadPayload(hooksdk.WithIO(stdio), hooksdk.WithAllowedPayloadDirs(allowed)); err != nil || p.SessionID() != "inline" {
+		t.Errorf("inline: %v, %v", p, err)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package hooksdk_test
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestAllowedPayloadDirsSpecialFiles(t *testing.T) {
+	dir := t.TempDir()
+	fifo := filepath.Join(dir, "payload.fifo")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Opening the FIFO would block until a writer came; it is refused first.
+	if _, err := readFromPath(fifo, "", hooksdk.WithAllowedPayloadDirs(dir)); refusal(err) != "not a regular file" {
+		t.Errorf("FIFO: %v, want it refused", err)
+	}
+	if _, err := readFromPath("/dev/null", "", hooksdk.WithAllowedPayloadDirs("/dev")); refusal(err) != "not a regular file" {
+		t.Errorf("/dev/null: %v, want it refused", err)
+	}
+}
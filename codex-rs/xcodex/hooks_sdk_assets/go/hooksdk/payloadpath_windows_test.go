@@ -0,0 +1,25 @@
+package hooksdk
+
+import "testing"
+
+func TestWithinDirWindows(t *testing.T) {
+	for _, tt := range []struct {
+		root, path string
+		want       bool
+	}{
+		{`C:\Temp`, `C:\Temp\payload.json`, true},
+		{`C:\Temp`, `c:\TEMP\xcodex\payload.json`, true},
+		{`C:\Temp`, `C:\Temp/xcodex/payload.json`, true},
+		{`C:\Temp`, `C:\Temp`, true},
+		{`C:\Temp`, `C:\Temp\..\Windows\win.ini`, false},
+		{`C:\Temp`, `C:\TempX\payload.json`, false},
+		{`C:\Temp`, `D:\Temp\payload.json`, false},
+		{`C:\Temp`, `\\server\share\Temp\payload.json`, false},
+		{`\\server\share\hooks`, `\\server\share\hooks\payload.json`, true},
+		{`\\server\share\hooks`, `\\server\other\hooks\payload.json`, false},
+	} {
+		if got := withinDir(tt.root, tt.path); got != tt.want {
+			t.Errorf("withinDir(%q, %q) = %v, want %v", tt.root, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package hooksdk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/cbor"
+)
+
+// DefaultPayloadRetry is how long a payload_path file that is missing, or whose contents are cut
+// short, is read again before the read fails, unless overridden with WithPayloadRetry or the
+// CODEX_HOOK_PAYLOAD_RETRY_MS environment variable.
+const DefaultPayloadRetry = 250 * time.Millisecond
+
+// PayloadRetryEnv overrides DefaultPayloadRetry (milliseconds; 0 disables the retry).
+const PayloadRetryEnv = "CODEX_HOOK_PAYLOAD_RETRY_MS"
+
+// Pauses between reads of a payload_path file that isn't ready, doubling from the first. Contents
+// that haven't changed for payloadRetryStable are final, however incomplete: the file is
+// malformed rather than still being written. An empty file never is.
+const (
+	payloadRetryFirstPause = 5 * time.Millisecond
+	payloadRetryMaxPause   = 50 * time.Millisecond
+	payloadRetryStable     = 50 * time.Millisecond
+)
+
+// WithPayloadRetry sets how long a payload_path file is read again while it doesn't exist yet or
+// doesn't hold a complete payload (JSON, or CBOR with `"payload_format": "cbor"`), for hosts that
+// start the hook before the file is fully written. Reading stops once the file's contents are
+// complete, or stop changing. It takes precedence over CODEX_HOOK_PAYLOAD_RETRY_MS; d <= 0 fails
+// on the first read.
+func WithPayloadRetry(d time.Duration) Option {
+	return func(o *options) {
+		o.payloadRetry = d
+		o.hasPayloadRetry = true
+	}
+}
+
+// readPayloadFileRetry calls read until the payload_path file exists and its contents are
+// complete in format or stable, for at most the retry budget (without one, read is called once). A
+// file that never appears fails with read's error, annotated with the number of attempts and the
+// time spent; contents that stay incomplete are returned as they are, for the caller's parse to
+// report.
+func (o *options) readPayloadFileRetry(ctx context.Context, format PayloadFormat, read func() ([]byte, error)) ([]byte, error) {
+	if o.payloadRetry <= 0 {
+		return read()
+	}
+	start := time.Now()
+	pause := payloadRetryFirstPause
+	var last []byte
+	var changed time.Time
+	for attempt := 1; ; attempt++ {
+		data, err := read()
+		if err != nil || len(data) == 0 || !bytes.Equal(data, last) {
+			changed = time.Now()
+		}
+		switch {
+		case err == nil && (time.Since(changed) >= payloadRetryStable || payloadComplete(data, format, o.maxPayloadBytes)):
+			return data, nil
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			return nil, err
+		}
+		elapsed := time.Since(start)
+		if elapsed+pause > o.payloadRetry {
+			if err != nil {
+				if attempt == 1 {
+					return nil, err
+				}
+				return nil, fmt.Errorf("%w (after %d attempts in %v)", err, attempt, elapsed.Round(time.Millisecond))
+			}
+			return data, nil
+		}
+		last = data
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if pause *= 2; pause > payloadRetryMaxPause {
+			pause = payloadRetryMaxPause
+		}
+	}
+}
+
+// payloadComplete reports whether data is a whole payload file: valid JSON, or a CBOR data item
+// when format is PayloadFormatCBOR, or a gzip stream that decompresses to its end.
+func payloadComplete(data []byte, format PayloadFormat, limit int64) bool {
+	if !hasGzipMagic(data) {
+		if format == PayloadFormatCBOR {
+			_, err := cbor.Decode(data)
+			return err == nil
+		}
+		return json.Valid(data)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+	defer zr.Close()
+	var r io.Reader = zr
+	if limit > 0 {
+		// Past the limit the read fails anyway; there is no need to find the end.
+		r = io.LimitReader(zr, limit+1)
+	}
+	_, err = io.Copy(io.Discard, r)
+	return err == nil
+}
@@ -0,0 +1,218 @@
+package hooksdk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/cbor"
+)
+
+func TestPayloadComplete(t *testing.T) {
+	payload := map[string]any{"xcodex_event_type": "session-start", "session_id": "s"}
+	cborData, err := cbor.Encode(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(cborData)
+	zw.Close()
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format PayloadFormat
+		want   bool
+	}{
+		{"json", []byte(`{"session_id":"s"}`), "", true},
+		{"truncated json", []byte(`{"session_id":`), "", false},
+		{"cbor", cborData, PayloadFormatCBOR, true},
+		{"truncated cbor", cborData[:len(cborData)-3], PayloadFormatCBOR, false},
+		{"cbor read as json", cborData, "", false},
+		{"gzipped cbor", gz.Bytes(), PayloadFormatCBOR, true},
+		{"truncated gzip", gz.Bytes()[:gz.Len()-4], PayloadFormatCBOR, false},
+	}
+	for _, tt := range tests {
+		if got := payloadComplete(tt.data, tt.format, 0); got != tt.want {
+			t.Errorf("%s: payloadComplete = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadPayloadFileRetryCompleteCBOR(t *testing.T) {
+	data, err := cbor.Encode(map[string]any{"session_id": "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newOptions([]Option{WithPayloadRetry(time.Second)})
+	reads := 0
+	start := time.Now()
+	got, err := o.readPayloadFileRetry(context.Background(), PayloadFormatCBOR, func() ([]byte, error) {
+		reads++
+		return data, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("read %x, want %x", got, data)
+	}
+	// A complete file is returned from the first read, without waiting for it to stay unchanged.
+	if reads != 1 {
+		t.Errorf("read the file %d times, want 1", reads)
+	}
+	if elapsed := time.Since(start); elapsed >= payloadRetryStable {
+		t.Errorf("took %v, want less than the stability window %v", elapsed, payloadRetryStable)
+	}
+}
+
+func TestReadPayloadFileRetryGrowingCBOR(t *testing.T) {
+	data, err := cbor.Encode(map[string]any{"session_id": "s", "cwd": "/tmp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newOptions([]Option{WithPayloadRetry(time.Second)})
+	reads := 0
+	got, err := o.readPayloadFileRetry(context.Background(), PayloadFormatCBOR, func() ([]byte, error) {
+		reads++
+		if reads < 3 {
+			return data[:len(data)*reads/3], nil
+		}
+		return data, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) || reads != 3 {
+		t.Errorf("read %x after %d reads, want %x after 3", got, reads, data)
+	}
+}
+
+const retryPayload = `{"xcodex_event_type":"session-start","session_id":"late"}`
+
+// pathStdin returns an envelope naming path as the payload_path.
+func pathStdin(t *testing.T, path string) *bytes.Reader {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"payload_path": path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(data)
+}
+
+// writeLater writes data to path after d, through a rename as hosts do.
+func writeLater(t *testing.T, path string, data []byte, d time.Duration) {
+	t.Helper()
+	done := make(chan struct{})
+	t.Cleanup(func() { <-done })
+	go func() {
+		defer close(done)
+		time.Sleep(d)
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0o600); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Error(err)
+		}
+	}()
+}
+
+func TestPayloadFileAppearsLate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.json")
+	writeLater(t, path, []byte(retryPayload), 30*time.Millisecond)
+	p, err := ReadPayloadFrom(pathStdin(t, path), WithPayloadRetry(time.Second))
+	if err != nil || p.SessionID() != "late" {
+		t.Fatalf("ReadPayloadFrom = %v, %v", p, err)
+	}
+}
+
+func TestPayloadFileCompletedLate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(path, []byte(retryPayload[:20]), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	writeLater(t, path, []byte(retryPayload), 20*time.Millisecond)
+	p, err := ReadPayloadFrom(pathStdin(t, path), WithPayloadRetry(time.Second))
+	if err != nil || p.SessionID() != "late" {
+		t.Fatalf("ReadPayloadFrom = %v, %v", p, err)
+	}
+}
+
+func TestPayloadFileNeverReady(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.json")
+
+	// Without a retry, a missing file fails at once.
+	_, err := ReadPayloadFrom(pathStdin(t, missing), WithPayloadRetry(0))
+	if !errors.Is(err, fs.ErrNotExist) || strings.Contains(err.Error(), "attempts") {
+		t.Errorf("no retry: %v", err)
+	}
+
+	// With one, it fails once the budget is spent, saying where and for how long it looked.
+	start := time.Now()
+	_, err = ReadPayloadFrom(pathStdin(t, missing), WithPayloadRetry(60*time.Millisecond))
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond || elapsed > time.Second {
+		t.Errorf("gave up after %v, want about 60ms", elapsed)
+	}
+	if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), missing) || !strings.Contains(err.Error(), "attempts in") {
+		t.Errorf("retry: %v", err)
+	}
+
+	// Contents that stay cut short are parsed as they are once they stop changing.
+	truncated := filepath.Join(dir, "truncated.json")
+	if err := os.WriteFile(truncated, []byte(retryPayload[:20]), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	if _, err := ReadPayloadFrom(pathStdin(t, truncated), WithPayloadRetry(time.Second)); err == nil {
+		t.Error("read a truncated payload")
+	}
+	if elapsed := time.Since(start); elapsed < payloadRetryStable || elapsed > 900*time.Millisecond {
+		t.Errorf("truncated file: gave up after %v, want once it was stable for %v", elapsed, payloadRetryStable)
+	}
+
+	// Other errors aren't retried.
+	o := newOptions([]Option{WithPayloadRetry(time.Second)})
+	reads := 0
+	boom := errors.New("permission denied")
+	if _, err := o.readPayloadFileRetry(context.Background(), "", func() ([]byte, error) { reads++; return nil, boom }); err != boom || reads != 1 {
+		t.Errorf("other error = %v after %d reads", err, reads)
+	}
+
+	// Nor is the wait longer than the context.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := ReadPayloadContext(ctx, WithIO(IO{In: pathStdin(t, missing), Getenv: func(string) string { return "" }}), WithPayloadRetry(time.Minute)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("canceled: %v", err)
+	}
+}
+
+func TestPayloadRetryEnv(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	for ms, wantAttempts := range map[string]bool{"0": false, "40": true, "": true, "soon": true} {
+		stdio := IO{In: pathStdin(t, missing), Getenv: func(k string) string {
+			if k == PayloadRetryEnv {
+				return ms
+			}
+			return ""
+		}}
+		_, err := ReadPayload(WithIO(stdio))
+		if !errors.Is(err, fs.ErrNotExist) || strings.Contains(err.Error(), "attempts") != wantAttempts {
+			t.Errorf("%s=%q: %v", PayloadRetryEnv, ms, err)
+		}
+	}
+	if got := newOptions([]Option{WithIO(IO{Getenv: func(string) string { return "7" }}), WithPayloadRetry(0)}).payloadRetry; got != 0 {
+		t.Errorf("WithPayloadRetry(0) with the variable set: retry %v, want 0", got)
+	}
+}
@@ -0,0 +1,160 @@
+package hooksdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// PeekEventType reads the hook payload like ReadPayloadRaw and returns its event type, as
+// ParseHookPayload would give it, together with the payload's bytes, without decoding the rest of
+// it. A hook that handles few event types can return at once for the others, and parse the bytes
+// with ParseHookPayload only for its own:
+//
+//	t, data, err := hooksdk.PeekEventType()
+//	if err != nil {
+//		return err
+//	}
+//	if t != hooksdk.EventToolCallStarted {
+//		return hooksdk.WriteResponse(hooksdk.Allow())
+//	}
+//	payload, err := hooksdk.ParseHookPayload(data)
+//
+// Only the top-level keys are looked at; the other values are skipped over, not decoded, though
+// the bytes must still be valid JSON. A payload of an older schema version, which has to be
+// migrated first, is parsed in full. The checks WithStrictFields, WithValidation, and
+// WithInvalidUTF8 ask for are not made: ParseHookPayload makes them on the bytes. Run does this
+// itself for the events WithFilter or Mux.Run leave out.
+func PeekEventType(opts ...Option) (EventType, []byte, error) {
+	o := newOptions(opts)
+	o.capture = o.startCapture()
+	full, env, err := readFullPayloadBytes(context.Background(), o.stdio.in(), o)
+	var t EventType
+	if err == nil {
+		t, err = peekEventType(full, env.parseOptions(opts))
+	}
+	o.capture.finish(nil, err)
+	if err != nil {
+		return "", nil, err
+	}
+	return t, full, nil
+}
+
+// peekFields are the top-level values of a payload that decide its event type.
+type peekFields struct {
+	eventType, legacyType json.RawMessage
+	probe                 versionProbe
+	probeErr              bool
+	hasVersion            bool
+}
+
+// peekEventType returns the event type of the payload data as ParseHookPayload(data, opts...)
+// would, scanning only its top-level keys. When that isn't enough to tell (a payload to migrate, a
+// type or schema version of the wrong kind, or data that isn't a JSON object), it parses data in
+// full instead.
+func peekEventType(data []byte, opts []Option) (EventType, error) {
+	if isBlank(data) {
+		return "", ErrEmptyPayload
+	}
+	f, ok := scanPeekFields(data)
+	if ok {
+		var envelopeVersion *int
+		if !f.hasVersion {
+			envelopeVersion = newOptions(opts).envelopeVersion
+		}
+		version, probed := f.probe.version(envelopeVersion)
+		if !f.probeErr && probed && !needsMigration(version) {
+			if t, ok := f.chooseType(); ok {
+				return ParseEventType(t), nil
+			}
+		}
+	}
+	p, err := ParseHookPayload(data, opts...)
+	if err != nil {
+		return "", err
+	}
+	return p.Type(), nil
+}
+
+// scanPeekFields reads the top-level values of the object data that peekEventType needs, and
+// skips over the rest. Keys match as they do for ParseHookPayload: the struct fields case-
+// insensitively, the raw `type` exactly, and the last of several wins. ok is false when data
+// isn't a single JSON object.
+func scanPeekFields(data []byte) (f peekFields, ok bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return f, false
+	}
+	var skip json.RawMessage
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return f, false
+		}
+		key, _ := tok.(string)
+		var dst *json.RawMessage
+		switch {
+		case strings.EqualFold(key, "xcodex_event_type"):
+			dst = &f.eventType
+		case key == "type":
+			dst = &f.legacyType
+		case strings.EqualFold(key, "schema_version"), strings.EqualFold(key, "schema-version"):
+			f.hasVersion = true
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return f, false
+			}
+			target := &f.probe.Snake
+			if strings.EqualFold(key, "schema-version") {
+				target = &f.probe.Kebab
+			}
+			// A quoted version reads as a json.Number but fails to decode into the payload, which
+			// ParseHookPayload then reports.
+			if json.Unmarshal(raw, target) != nil || raw[0] == '"' {
+				f.probeErr = true
+			}
+			continue
+		default:
+			// Decoded into the same buffer every time, so skipping costs no allocations.
+			if err := dec.Decode(&skip); err != nil {
+				return f, false
+			}
+			continue
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return f, false
+		}
+		if dst == &f.eventType && string(raw) == "null" {
+			// null leaves a string field as it was.
+			continue
+		}
+		*dst = raw
+	}
+	if _, err := dec.Token(); err != nil {
+		return f, false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return f, false
+	}
+	return f, true
+}
+
+// chooseType returns the type HookPayload.EventType would: `xcodex_event_type`, or else the raw
+// `type` when it is a non-empty string. ok is false when `xcodex_event_type` isn't a string, which
+// ParseHookPayload reports as an error.
+func (f peekFields) chooseType() (string, bool) {
+	var t string
+	if f.eventType != nil && json.Unmarshal(f.eventType, &t) != nil {
+		return "", false
+	}
+	if t == "" && f.legacyType != nil {
+		var legacy any
+		if json.Unmarshal(f.legacyType, &legacy) == nil {
+			t, _ = legacy.(string)
+		}
+	}
+	return t, true
+}
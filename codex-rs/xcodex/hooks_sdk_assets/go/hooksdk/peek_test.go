@@ -0,0 +1,195 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// peek runs PeekEventType on stdin.
+func peek(stdin []byte) (hooksdk.EventType, []byte, error) {
+	stdio, _, _ := testIO(stdin, nil)
+	return hooksdk.PeekEventType(hooksdk.WithIO(stdio))
+}
+
+// checkPeekAgrees checks that PeekEventType gives the type ParseHookPayload does for the payload
+// data, sent as stdin, or fails when it does.
+func checkPeekAgrees(t *testing.T, name string, stdin, data []byte) {
+	t.Helper()
+	got, raw, err := peek(stdin)
+	p, perr := hooksdk.ParseHookPayload(data)
+	switch {
+	case perr != nil:
+		if err == nil {
+			t.Errorf("%s: PeekEventType = %q, but ParseHookPayload fails: %v", name, got, perr)
+		}
+	case err != nil:
+		t.Errorf("%s: PeekEventType: %v; ParseHookPayload gives %q", name, err, p.Type())
+	case got != p.Type():
+		t.Errorf("%s: PeekEventType = %q, ParseHookPayload = %q", name, got, p.Type())
+	case !bytes.Equal(raw, data):
+		t.Errorf("%s: PeekEventType returned\n%s\nwant the payload\n%s", name, raw, data)
+	}
+}
+
+func TestPeekEventTypeFixtures(t *testing.T) {
+	for name, b := range hooktest.Fixtures() {
+		data := b.Bytes()
+		if got, _, err := peek(data); err != nil || string(got) != name {
+			t.Errorf("%s: PeekEventType = %q, %v", name, got, err)
+		}
+		checkPeekAgrees(t, name, data, data)
+		checkPeekAgrees(t, name+" (legacy)", b.Legacy().Bytes(), b.Legacy().Bytes())
+		checkPeekAgrees(t, name+" (payload_path)", hooktest.WriteEnvelope(t, data), data)
+	}
+}
+
+func TestPeekEventTypeEdgeCases(t *testing.T) {
+	current := `"schema_version":1`
+	for name, data := range map[string]string{
+		"case-variant key":      `{"XCODEX_EVENT_TYPE":"session-start",` + current + `}`,
+		"later key wins":        `{"xcodex_event_type":"session-start","xcodex_event_type":"session-end",` + current + `}`,
+		"null type":             `{"xcodex_event_type":null,"type":"session-end",` + current + `}`,
+		"null after a type":     `{"xcodex_event_type":"session-start","xcodex_event_type":null,` + current + `}`,
+		"numeric type":          `{"xcodex_event_type":7,` + current + `}`,
+		"numeric raw type":      `{"type":7,` + current + `}`,
+		"raw type only":         `{"type":"session-end",` + current + `}`,
+		"raw type case":         `{"TYPE":"session-end",` + current + `}`,
+		"empty type":            `{"xcodex_event_type":"","type":"notification",` + current + `}`,
+		"no type":               `{` + current + `}`,
+		"unknown type":          `{"xcodex_event_type":"deploy-requested",` + current + `}`,
+		"nested values skipped": `{"a":{"xcodex_event_type":"x"},"b":[1,{"type":"y"}],"xcodex_event_type":"session-end",` + current + `}`,
+		"kebab version":         `{"xcodex_event_type":"session-start","schema-version":1}`,
+		"version 0":             `{"type":"session-start","schema_version":0}`,
+		"no version":            `{"type":"session-start","thread-id":"t"}`,
+		"quoted version":        `{"xcodex_event_type":"session-start","schema_version":"1"}`,
+		"fractional version":    `{"xcodex_event_type":"session-start","schema_version":1.5}`,
+		"newer version":         `{"xcodex_event_type":"session-start","schema_version":99}`,
+		"trailing data":         `{"xcodex_event_type":"session-start",` + current + `} {}`,
+		"trailing garbage":      `{"xcodex_event_type":"session-start",` + current + `} x`,
+		"truncated":             `{"xcodex_event_type":"session-start","cwd":"/tm`,
+		"bad value":             `{"xcodex_event_type":"session-start","cwd":nope,` + current + `}`,
+		"array":                 `[{"xcodex_event_type":"session-start"}]`,
+		"string":                `"session-start"`,
+		"null":                  `null`,
+		"blank":                 " \n\t",
+		"whitespace around":     "\n {\"xcodex_event_type\" : \"session-end\" , " + current + " }\n",
+	} {
+		checkPeekAgrees(t, name, []byte(data), []byte(data))
+	}
+
+	// No input is `{}`, as for ReadPayloadRaw.
+	if got, raw, err := peek(nil); err != nil || got != "" || string(raw) != "{}" {
+		t.Errorf("PeekEventType of no input = %q, %s, %v", got, raw, err)
+	}
+	// Values other than the type aren't decoded, so only ParseHookPayload finds one of the wrong
+	// type.
+	data := `{"xcodex_event_type":"session-start","session_id":7,` + current + `}`
+	if got, _, err := peek([]byte(data)); err != nil || got != hooksdk.EventSessionStart {
+		t.Errorf("PeekEventType(%s) = %q, %v", data, got, err)
+	}
+}
+
+func TestRunSkipsWithoutDecoding(t *testing.T) {
+	called := 0
+	handler := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		called++
+		return hooksdk.Deny("handled"), nil
+	}
+	only := hooksdk.WithFilter(hooksdk.ParseFilter("tool-call-started", ""))
+
+	// A filtered-out payload isn't decoded: its session id is of the wrong type.
+	res := hooktest.RunHook(t, handler, hooktest.ToolCallFinished().With("session_id", 7).Bytes(), only)
+	if called != 0 || res.ExitCode != hooksdk.ExitOK || res.Response.Decision != hooksdk.DecisionAllow || res.Stderr != "" {
+		t.Errorf("filtered event: called %d, %+v", called, res)
+	}
+	// Several filters must all match.
+	res = hooktest.RunHook(t, handler, hooktest.ToolCallStarted().Bytes(), only, hooksdk.WithFilter(hooksdk.ParseFilter("", "tool-*")))
+	if called != 0 || res.Response.Decision != hooksdk.DecisionAllow {
+		t.Errorf("event one filter leaves out: called %d, %+v", called, res)
+	}
+	// Malformed input still fails, and a payload whose type needs a full parse still gets one.
+	res = hooktest.RunHook(t, handler, []byte(`{"xcodex_event_type":"tool-call-finished"`), only)
+	if called != 0 || res.ExitCode != hooksdk.ExitError || errorLine(t, res.Stderr)["stage"] != "read_payload" {
+		t.Errorf("malformed payload: called %d, %+v", called, res)
+	}
+	res = hooktest.RunHook(t, handler, hooktest.ToolCallStarted().Legacy().Bytes(), only)
+	if called != 1 || res.Response.Reason != "handled" {
+		t.Errorf("legacy tool-call-started: called %d, %+v", called, res)
+	}
+
+	// A Mux with middleware or OnAny sees every event.
+	for name, setup := range map[string]func(*hooksdk.Mux){
+		"middleware": func(m *hooksdk.Mux) {
+			m.Use(func(next hooksdk.Handler) hooksdk.Handler { return next })
+		},
+		"OnAny": func(m *hooksdk.Mux) { m.OnAny(reply("any")) },
+	} {
+		mux := hooksdk.NewMux()
+		mux.Default = hooksdk.Deny("default")
+		setup(mux)
+		res := hooktest.RunHook(t, mux.Handle, hooktest.SessionEnd().With("session_id", 7).Bytes(), mux.SkipUnhandled())
+		if res.ExitCode != hooksdk.ExitError {
+			t.Errorf("%s: %+v, want the payload decoded (and failing)", name, res)
+		}
+	}
+	// Handlers added after SkipUnhandled count.
+	mux := hooksdk.NewMux()
+	skip := mux.SkipUnhandled()
+	mux.OnSessionEnd(reply("end"))
+	if res := hooktest.RunHook(t, mux.Handle, hooktest.SessionEnd().Bytes(), skip); res.Response.Reason != "end" {
+		t.Errorf("handler added later: %+v", res)
+	}
+}
+
+// BenchmarkRunFiltered measures a hook that handles only tool-call-started, fed tool-call-finished
+// events: "decoded" checks the type in its handler, as hooks did before WithFilter, "filtered"
+// leaves the event to WithFilter. ns/op is the time per event.
+func BenchmarkRunFiltered(b *testing.B) {
+	big := hooktest.ToolCallFinished().With("output_preview", strings.Repeat("line of output\n", 2500))
+	only := hooksdk.ParseFilter("tool-call-started", "")
+	handler := func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		if !only.MatchPayload(p) {
+			return hooksdk.Allow(), nil
+		}
+		return hooksdk.Deny("handled"), nil
+	}
+	for _, size := range []struct {
+		name    string
+		payload []byte
+	}{{"small", hooktest.ToolCallFinished().Bytes()}, {"40KB", big.Bytes()}} {
+		for _, mode := range []struct {
+			name string
+			opts []hooksdk.Option
+		}{{"decoded", nil}, {"filtered", []hooksdk.Option{hooksdk.WithFilter(only)}}} {
+			b.Run(size.name+"/"+mode.name, func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(size.payload)))
+				for i := 0; i < b.N; i++ {
+					code := hooksdk.RunIO(context.Background(), bytes.NewReader(size.payload), io.Discard, io.Discard, handler, mode.opts...)
+					if code != hooksdk.ExitOK {
+						b.Fatalf("exit %d", code)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPeekEventTypeJSON(t *testing.T) {
+	// The bytes returned are the payload's, ready for ParseHookPayload.
+	_, data, err := peek(hooktest.ApprovalRequested().WithCommand("ls").Bytes())
+	if err != nil || !json.Valid(data) {
+		t.Fatalf("PeekEventType = %s, %v", data, err)
+	}
+	p, err := hooksdk.ParseHookPayload(data)
+	if err != nil || strings.Join(p.Command, " ") != "ls" {
+		t.Errorf("ParseHookPayload of the peeked bytes = %v, %v", p, err)
+	}
+}
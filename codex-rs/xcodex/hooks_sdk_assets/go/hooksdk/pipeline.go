@@ -0,0 +1,194 @@
+package hooksdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Stage is one step of a Pipeline: a Handler, or a Transform.
+type Stage struct {
+	// Name names the stage in errors and in the response's Metadata.Stages.
+	Name    string
+	Handler Handler
+	// Transform, for a stage without a Handler, returns the payload the stages after it see, e.g.
+	// with secrets redacted before a logging stage. Unlike a Modify section, which later stages
+	// see too, the host never sees the change. The returned payload keeps p's invocation id.
+	Transform func(ctx context.Context, p *HookPayload) (*HookPayload, error)
+}
+
+// Pipeline runs several handlers in order as one hook, reading the payload once: a redactor, a
+// guard, and a logger, say.
+//
+//	pl := &hooksdk.Pipeline{Stages: []hooksdk.Stage{
+//		{Name: "redact", Transform: redactPayload},
+//		{Name: "guard", Handler: guard},
+//		{Name: "log", Handler: logEvent},
+//	}}
+//	hooksdk.Run(pl.Handle)
+//
+// The stages' responses are combined into one:
+//
+//   - The decision is the strongest of theirs: deny, then ask, then allow. The first deny stops
+//     the pipeline, so the stages after it don't run, unless ContinueOnDeny is set. The reason,
+//     prompt, question, and reason code are those of the stage that decided; with ContinueOnDeny,
+//     the reasons of every deny are joined with "; ".
+//   - Structured reasons, system messages, additional context, queued user messages, and
+//     telemetry accumulate, in stage order (paragraphs of text are joined by newlines).
+//   - Modify sections are merged, the later on top (see ModifyPayload), and each is applied to
+//     the payload the stages after it see, so they act on what the host will.
+//   - Metadata.Stages records each stage that ran, with its decision and how long it took.
+//
+// A stage that fails ends the pipeline with its error, naming the stage.
+type Pipeline struct {
+	Stages []Stage
+	// ContinueOnDeny runs every stage even after one denies, collecting their reasons, e.g. to show
+	// all the checks a command fails at once.
+	ContinueOnDeny bool
+}
+
+// StageTiming is a stage's entry in ResponseMetadata.Stages.
+type StageTiming struct {
+	Name string `json:"name"`
+	// Decision is the stage's decision, or "" for a Transform.
+	Decision Decision `json:"decision,omitempty"`
+	// DurationMs is how long the stage took, in milliseconds.
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// Handle runs the stages for p and returns their combined response. It is a Handler, for Run,
+// Mux.OnAny, or an outer Pipeline.
+func (pl *Pipeline) Handle(ctx context.Context, p *HookPayload) (Response, error) {
+	out := Allow()
+	var timings []StageTiming
+	for i, s := range pl.Stages {
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("stage-%d", i+1)
+		}
+		start := time.Now()
+		if s.Handler == nil {
+			if s.Transform == nil {
+				return Response{}, fmt.Errorf("pipeline stage %s: no Handler or Transform", name)
+			}
+			next, err := s.Transform(ctx, p)
+			if err == nil && next == nil {
+				err = errors.New("transform returned no payload")
+			}
+			if err != nil {
+				return Response{}, fmt.Errorf("pipeline stage %s: %w", name, err)
+			}
+			timings = append(timings, StageTiming{Name: name, DurationMs: sinceMs(start)})
+			if next != p {
+				c := *next
+				c.invocationID = p.invocationID
+				p = &c
+			}
+			continue
+		}
+
+		resp, err := s.Handler(ctx, p)
+		if err != nil {
+			return Response{}, fmt.Errorf("pipeline stage %s: %w", name, err)
+		}
+		decision := resp.Decision
+		if decision == "" {
+			decision = DecisionAllow
+		}
+		timings = append(timings, StageTiming{Name: name, Decision: decision, DurationMs: sinceMs(start)})
+		out = combineStage(out, resp)
+		if decision == DecisionDeny && !pl.ContinueOnDeny {
+			break
+		}
+		if len(resp.Modify) > 0 && i < len(pl.Stages)-1 {
+			if p, err = p.patched(resp.Modify); err != nil {
+				return Response{}, fmt.Errorf("pipeline stage %s: apply modify: %w", name, err)
+			}
+		}
+	}
+	out.Metadata = &ResponseMetadata{Stages: timings}
+	return out, nil
+}
+
+func sinceMs(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// decisionRank orders decisions by strength for combineStage.
+func decisionRank(d Decision) int {
+	switch d {
+	case DecisionDeny:
+		return 2
+	case DecisionAsk:
+		return 1
+	}
+	return 0
+}
+
+// combineStage adds the response r of a stage to out, the response of the stages before it.
+func combineStage(out, r Response) Response {
+	switch rank := decisionRank(r.Decision); {
+	case rank > decisionRank(out.Decision):
+		out.Decision, out.Reason, out.Prompt, out.Question = r.Decision, r.Reason, r.Prompt, r.Question
+		out.ReasonCode = r.ReasonCode
+	case rank == 2:
+		if out.Reason == "" {
+			out.Reason = r.Reason
+		} else if r.Reason != "" {
+			out.Reason += "; " + r.Reason
+		}
+	}
+	for _, reason := range r.Reasons {
+		out = out.AddReason(reason)
+	}
+	out.SystemMessage = joinLines(out.SystemMessage, r.SystemMessage)
+	if r.AdditionalContext != "" {
+		out = out.InjectContext(r.AdditionalContext)
+	}
+	out.QueuedUserMessages = append(out.QueuedUserMessages[:len(out.QueuedUserMessages):len(out.QueuedUserMessages)], r.QueuedUserMessages...)
+	if len(r.Modify) > 0 {
+		out = out.ModifyPayload(r.Modify)
+	}
+	for _, t := range r.Telemetry {
+		if err := telemetryFits(out.Telemetry, t); err != nil {
+			if out.telemetryErr == nil {
+				out.telemetryErr = err
+			}
+			continue
+		}
+		out.Telemetry = append(out.Telemetry[:len(out.Telemetry):len(out.Telemetry)], t)
+	}
+	if out.telemetryErr == nil {
+		out.telemetryErr = r.telemetryErr
+	}
+	if out.modifyErr == nil {
+		out.modifyErr = r.modifyErr
+	}
+	return out
+}
+
+func joinLines(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + "\n" + b
+}
+
+// patched returns p with the merge patch applied, as the host would apply a Modify section.
+func (p *HookPayload) patched(patch map[string]any) (*HookPayload, error) {
+	data, err := json.Marshal(MergePatch(p.RawPayload, patch))
+	if err != nil {
+		return nil, err
+	}
+	next, err := ParseHookPayload(data)
+	if err != nil {
+		return nil, err
+	}
+	next.sentVersion, next.rawJSON, next.invocationID = p.sentVersion, p.rawJSON, p.invocationID
+	return next, nil
+}
@@ -0,0 +1,205 @@
+package hooksdk_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// pipeline returns a Pipeline of a stage per response, each named after its index, and the names
+// of the stages that ran, in order.
+func pipeline(responses ...hooksdk.Response) (*hooksdk.Pipeline, *[]string) {
+	var ran []string
+	pl := &hooksdk.Pipeline{}
+	for i, resp := range responses {
+		name, resp := fmt.Sprint(i), resp
+		pl.Stages = append(pl.Stages, hooksdk.Stage{Name: name, Handler: func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+			ran = append(ran, name)
+			return resp, nil
+		}})
+	}
+	return pl, &ran
+}
+
+// stages is the names and decisions in resp's Metadata.Stages.
+func stages(resp hooksdk.Response) string {
+	if resp.Metadata == nil {
+		return "<no metadata>"
+	}
+	var s []string
+	for _, st := range resp.Metadata.Stages {
+		s = append(s, st.Name+":"+string(st.Decision))
+	}
+	return strings.Join(s, " ")
+}
+
+func TestPipelineDecisions(t *testing.T) {
+	p := parse(t, hooktest.ToolCallStarted())
+	for _, tt := range []struct {
+		name      string
+		responses []hooksdk.Response
+		continues bool
+		decision  hooksdk.Decision
+		reason    string
+		// stages is Metadata.Stages; ran, the stages that were called.
+		stages, ran string
+	}{
+		{"all allow", []hooksdk.Response{hooksdk.Allow(), {}}, false, hooksdk.DecisionAllow, "", "0:allow 1:allow", "0 1"},
+		{"first deny stops", []hooksdk.Response{hooksdk.Allow(), hooksdk.Deny("a"), hooksdk.Deny("b")}, false, hooksdk.DecisionDeny, "a", "0:allow 1:deny", "0 1"},
+		{"continue on deny", []hooksdk.Response{hooksdk.Deny("a"), hooksdk.Allow(), hooksdk.Deny("b")}, true, hooksdk.DecisionDeny, "a; b", "0:deny 1:allow 2:deny", "0 1 2"},
+		{"ask beats allow", []hooksdk.Response{hooksdk.Allow(), hooksdk.Ask("sure?"), hooksdk.Ask("really?")}, false, hooksdk.DecisionAsk, "", "0:allow 1:ask 2:ask", "0 1 2"},
+		{"deny beats ask", []hooksdk.Response{hooksdk.Ask("sure?"), hooksdk.Deny("no")}, false, hooksdk.DecisionDeny, "no", "0:ask 1:deny", "0 1"},
+	} {
+		pl, ran := pipeline(tt.responses...)
+		pl.ContinueOnDeny = tt.continues
+		resp, err := pl.Handle(context.Background(), p)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.Decision != tt.decision || resp.Reason != tt.reason || stages(resp) != tt.stages || strings.Join(*ran, " ") != tt.ran {
+			t.Errorf("%s: %s %q, stages %s, ran %q", tt.name, resp.Decision, resp.Reason, stages(resp), *ran)
+		}
+	}
+
+	// The stage that decided gives the prompt and the reason code.
+	pl, _ := pipeline(hooksdk.Ask("first?"), hooksdk.Ask("second?"), hooksdk.Deny("no", hooksdk.WithReasonCode("POLICY")))
+	pl.ContinueOnDeny = true
+	resp, _ := pl.Handle(context.Background(), p)
+	if resp.Prompt != "" || resp.ReasonCode != "POLICY" {
+		t.Errorf("prompt %q, reason code %q; want the deny's", resp.Prompt, resp.ReasonCode)
+	}
+	pl, _ = pipeline(hooksdk.Ask("first?"), hooksdk.Ask("second?"))
+	if resp, _ := pl.Handle(context.Background(), p); resp.Prompt != "first?" {
+		t.Errorf("prompt = %q, want the first ask's", resp.Prompt)
+	}
+}
+
+func TestPipelineAccumulates(t *testing.T) {
+	first := hooksdk.Allow().InjectContext("ctx 1").QueueUserMessage("msg 1").AddTelemetry("one", nil).
+		AddReason(hooksdk.Reason{Code: "A", Message: "a"})
+	first.SystemMessage = "sys 1"
+	second := hooksdk.Deny("no").InjectContext("ctx 2").QueueUserMessage("msg 2").AddTelemetry("two", nil).
+		AddReason(hooksdk.Reason{Code: "B", Message: "b"})
+	second.SystemMessage = "sys 2"
+	pl, _ := pipeline(first, hooksdk.Allow(), second)
+	resp, err := pl.Handle(context.Background(), parse(t, hooktest.ToolCallStarted()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var telemetry, reasons []string
+	for _, tr := range resp.Telemetry {
+		telemetry = append(telemetry, tr.Name)
+	}
+	for _, r := range resp.Reasons {
+		reasons = append(reasons, r.Code)
+	}
+	if resp.SystemMessage != "sys 1\nsys 2" || resp.AdditionalContext != "ctx 1\nctx 2" ||
+		strings.Join(resp.QueuedUserMessages, ",") != "msg 1,msg 2" || strings.Join(telemetry, ",") != "one,two" ||
+		strings.Join(reasons, ",") != "A,B" {
+		t.Errorf("combined response = %+v", resp)
+	}
+
+	// The limits apply to the whole: the record past them is left out and reported.
+	var many []hooksdk.Response
+	for i := 0; i < 2; i++ {
+		r := hooksdk.Allow()
+		for j := 0; j < hooksdk.MaxTelemetryRecords-1; j++ {
+			r = r.AddTelemetry(fmt.Sprintf("r%d_%d", i, j), nil)
+		}
+		many = append(many, r)
+	}
+	pl, _ = pipeline(many...)
+	resp, _ = pl.Handle(context.Background(), parse(t, hooktest.ToolCallStarted()))
+	var limit *hooksdk.TelemetryLimitError
+	if len(resp.Telemetry) != hooksdk.MaxTelemetryRecords || !errors.As(resp.CheckTelemetry(), &limit) {
+		t.Errorf("%d records, CheckTelemetry %v", len(resp.Telemetry), resp.CheckTelemetry())
+	}
+}
+
+func TestPipelineModifyVisible(t *testing.T) {
+	p := parse(t, hooktest.ToolCallStarted().With("hook_invocation_id", "inv-1"))
+	var seen []string
+	see := func(resp hooksdk.Response) hooksdk.Handler {
+		return func(_ context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			command, _ := hooksdk.StringField(p.RawPayload, "tool_input.command")
+			secret, _ := hooksdk.StringField(p.RawPayload, "secret")
+			seen = append(seen, command+"|"+secret+"|"+p.InvocationID())
+			return resp, nil
+		}
+	}
+	redact := func(_ context.Context, p *hooksdk.HookPayload) (*hooksdk.HookPayload, error) {
+		return parse(t, hooktest.ToolCallStarted().With("secret", "***").WithCommand("ls -l")), nil
+	}
+	pl := &hooksdk.Pipeline{Stages: []hooksdk.Stage{
+		{Name: "quote", Handler: see(hooksdk.Allow().ReplaceField("tool_input.command", "ls -l 'x'"))},
+		{Name: "check", Handler: see(hooksdk.Allow().ModifyPayload(map[string]any{"extra": "1"}))},
+		{Name: "redact", Transform: redact},
+		{Name: "log", Handler: see(hooksdk.Allow())},
+	}}
+	resp, err := pl.Handle(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A Modify is what later stages see; a Transform's payload replaces it, keeping the id.
+	want := []string{"go test ./...||inv-1", "ls -l 'x'||inv-1", "ls -l|***|inv-1"}
+	if strings.Join(seen, "\n") != strings.Join(want, "\n") {
+		t.Errorf("stages saw\n%s\nwant\n%s", strings.Join(seen, "\n"), strings.Join(want, "\n"))
+	}
+	// The host gets the Modify sections merged, not the Transform.
+	if resp.Modify["extra"] != "1" || resp.Modify["secret"] != nil || stages(resp) != "quote:allow check:allow redact: log:allow" {
+		t.Errorf("response = %+v, stages %s", resp, stages(resp))
+	}
+	if command, _ := hooksdk.StringField(p.RawPayload, "tool_input.command"); command != "go test ./..." {
+		t.Errorf("the original payload changed: %q", command)
+	}
+}
+
+func TestPipelineErrors(t *testing.T) {
+	p := parse(t, hooktest.ToolCallStarted())
+	boom := errors.New("boom")
+	ran := false
+	after := hooksdk.Stage{Name: "after", Handler: func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		ran = true
+		return hooksdk.Allow(), nil
+	}}
+	for _, tt := range []struct {
+		stage hooksdk.Stage
+		want  string
+	}{
+		{hooksdk.Stage{Name: "guard", Handler: respond(hooksdk.Allow(), boom)}, "pipeline stage guard: boom"},
+		{hooksdk.Stage{Transform: func(context.Context, *hooksdk.HookPayload) (*hooksdk.HookPayload, error) { return nil, boom }}, "pipeline stage stage-1: boom"},
+		{hooksdk.Stage{Transform: func(context.Context, *hooksdk.HookPayload) (*hooksdk.HookPayload, error) { return nil, nil }}, "pipeline stage stage-1: transform returned no payload"},
+		{hooksdk.Stage{Name: "empty"}, "pipeline stage empty: no Handler or Transform"},
+	} {
+		pl := &hooksdk.Pipeline{Stages: []hooksdk.Stage{tt.stage, after}}
+		if _, err := pl.Handle(context.Background(), p); err == nil || err.Error() != tt.want || ran {
+			t.Errorf("Handle = %v (later stage ran: %v), want %q", err, ran, tt.want)
+		}
+	}
+	if _, err := (&hooksdk.Pipeline{Stages: []hooksdk.Stage{{Name: "guard", Handler: respond(hooksdk.Allow(), boom)}}}).Handle(context.Background(), p); !errors.Is(err, boom) {
+		t.Errorf("stage error doesn't unwrap: %v", err)
+	}
+}
+
+func TestPipelineRun(t *testing.T) {
+	// Run keeps the stages in the response's metadata, next to the SDK's.
+	pl, _ := pipeline(hooksdk.Allow(), hooksdk.Deny("no"))
+	res := hooktest.RunHook(t, pl.Handle, hooktest.ToolCallStarted().Bytes())
+	m := res.Response.Metadata
+	if res.ExitCode != hooksdk.ExitDeny || m == nil || m.SDKVersion != hooksdk.Version() || !uuidV7.MatchString(m.InvocationID) || stages(res.Response) != "0:allow 1:deny" {
+		t.Fatalf("result = %+v, metadata %+v", res, m)
+	}
+	for _, st := range m.Stages {
+		if st.DurationMs < 0 {
+			t.Errorf("stage %s took %vms", st.Name, st.DurationMs)
+		}
+	}
+	if err := hooksdk.ValidateResponse("tool-call-started", res.Response); err != nil {
+		t.Errorf("response with stages doesn't validate: %v", err)
+	}
+}
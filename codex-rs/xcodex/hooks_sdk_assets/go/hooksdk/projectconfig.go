@@ -0,0 +1,173 @@
+package hooksdk
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ProjectConfigDir is where, in a project, LoadProjectConfig looks for `<name>.toml`.
+const ProjectConfigDir = ".xcodex/hooks"
+
+// TrustedProjectsFile is the list, under CODEX_HOME, of the projects whose config
+// LoadProjectConfig loads: one directory per line, covering the directories below it too. Blank
+// lines and lines starting with # are ignored, and `~/` is the home directory.
+const TrustedProjectsFile = "hooks/trusted_projects"
+
+// ErrUntrustedProject is returned (as an *UntrustedProjectError) for project config that
+// LoadProjectConfig didn't load.
+var ErrUntrustedProject = errors.New("untrusted project config")
+
+// UntrustedProjectError reports project config that wasn't loaded, because the project isn't in
+// TrustedProjectsFile or someone else could have written the file. It matches ErrUntrustedProject
+// with errors.Is.
+type UntrustedProjectError struct {
+	// Path is the project's config file.
+	Path string
+	// Reason says why it wasn't loaded.
+	Reason string
+}
+
+func (e *UntrustedProjectError) Error() string {
+	return fmt.Sprintf("%s: not loaded: %s", e.Path, e.Reason)
+}
+
+func (e *UntrustedProjectError) Is(target error) bool { return target == ErrUntrustedProject }
+
+// LoadProjectConfig is LoadConfig with a layer for the project the event is about: the first
+// `.xcodex/hooks/<name>.toml` (see ProjectConfigDir) found in the payload's cwd or a directory
+// above it, up to the filesystem root. The project file overrides the global one key by key;
+// arrays and maps in it replace the global ones. Environment variables still override both.
+//
+// A cloned repository must not be able to change how hooks treat it, so the project file is only
+// loaded from a project listed in TrustedProjectsFile, and on Unix only if it and the directories
+// from it up to the project are owned by the current user (or root) and not world-writable.
+// Otherwise v is loaded without it and the error is an *UntrustedProjectError, which the hook can
+// report and carry on with.
+func LoadProjectConfig(p *HookPayload, name string, v any) error {
+	return LoadProjectConfigFile(ConfigPath(name), p, name, v)
+}
+
+// LoadProjectConfigFile is LoadProjectConfig with path instead of the global file in CODEX_HOME.
+func LoadProjectConfigFile(path string, p *HookPayload, name string, v any) error {
+	project := ""
+	if p != nil {
+		project = findProjectConfig(p.WorkingDir(), name)
+	}
+	if project == "" {
+		return LoadConfigFile(path, name, v)
+	}
+	if err := trustProjectConfig(Environ(), project); err != nil {
+		if lerr := LoadConfigFile(path, name, v); lerr != nil {
+			return lerr
+		}
+		return err
+	}
+	return loadConfigFiles([]string{path, project}, name, v)
+}
+
+// findProjectConfig returns the first `.xcodex/hooks/<name>.toml` in dir or a directory above it,
+// or "" if there is none.
+func findProjectConfig(dir, name string) string {
+	if dir == "" {
+		return ""
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, filepath.FromSlash(ProjectConfigDir), name+".toml")
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// trustProjectConfig returns an *UntrustedProjectError unless the project config at path may be
+// loaded.
+func trustProjectConfig(env Env, path string) error {
+	// path is <project>/.xcodex/hooks/<name>.toml.
+	project := filepath.Dir(filepath.Dir(filepath.Dir(path)))
+	trusted, err := trustedProjects(env)
+	if err != nil {
+		return &UntrustedProjectError{Path: path, Reason: fmt.Sprintf("reading the trusted projects: %v", err)}
+	}
+	if !underAny(resolve(project), trusted) {
+		return &UntrustedProjectError{Path: path, Reason: fmt.Sprintf("%s is not listed in %s", project, env.Path(TrustedProjectsFile))}
+	}
+	for p := path; ; p = filepath.Dir(p) {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return &UntrustedProjectError{Path: path, Reason: err.Error()}
+		}
+		if reason := unsafeOwner(p, fi); reason != "" {
+			return &UntrustedProjectError{Path: path, Reason: reason}
+		}
+		if p == project {
+			return nil
+		}
+	}
+}
+
+// trustedProjects reads TrustedProjectsFile; a missing file trusts nothing.
+func trustedProjects(env Env) ([]string, error) {
+	f, err := os.Open(env.Path(TrustedProjectsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var dirs []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "~" {
+			line = "~/"
+		}
+		if rest, ok := strings.CutPrefix(line, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				continue
+			}
+			line = filepath.Join(home, rest)
+		}
+		if filepath.IsAbs(line) {
+			dirs = append(dirs, resolve(line))
+		}
+	}
+	return dirs, sc.Err()
+}
+
+// resolve returns path cleaned, with symbolic links resolved where they can be.
+func resolve(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return filepath.Clean(path)
+}
+
+// underAny reports whether path is one of dirs or below one of them.
+func underAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package hooksdk_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// projectConfig writes data as project's config name and returns its path.
+func projectConfig(t *testing.T, project, name, data string) string {
+	t.Helper()
+	path := filepath.Join(project, filepath.FromSlash(hooksdk.ProjectConfigDir), name+".toml")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// trust writes lines as the trusted projects of CODEX_HOME.
+func trust(t *testing.T, lines ...string) {
+	t.Helper()
+	path := hooksdk.Environ().Path(hooksdk.TrustedProjectsFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func inDir(dir string) *hooksdk.HookPayload {
+	return hooktest.ToolCallStarted().WithCwd(dir).Build()
+}
+
+func TestLoadProjectConfig(t *testing.T) {
+	writeConfig(t, "test", `
+url = "https://global"
+retries = 5
+branches = ["main", "release"]
+
+[limits]
+a = 1
+
+[notify]
+channel = "#global"
+urgent = true
+`)
+	project := t.TempDir()
+	projectConfig(t, project, "test", `
+retries = 1
+branches = ["dev"]
+
+[limits]
+b = 2
+
+[notify]
+channel = "#project"
+`)
+	trust(t, "# the projects I work on", "", project)
+	t.Setenv("CODEX_HOOK_TEST_URL", "https://env")
+
+	// The project's file is found from a directory below it.
+	dir := filepath.Join(project, "src", "pkg")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var cfg testConfig
+	if err := hooksdk.LoadProjectConfig(inDir(dir), "test", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	// Defaults < global < project < environment; arrays and maps in the project replace the global ones.
+	want := testConfig{
+		URL:         "https://env",
+		HTTPTimeout: cfg.HTTPTimeout,
+		Retries:     1,
+		Ratio:       0.5,
+		Enabled:     true,
+		Branches:    []string{"dev"},
+		Limits:      map[string]int{"b": 2},
+	}
+	want.Notify.Channel, want.Notify.Urgent = "#project", true
+	if !reflect.DeepEqual(cfg, want) || cfg.HTTPTimeout == 0 {
+		t.Errorf("config = %+v\nwant %+v", cfg, want)
+	}
+
+	// The nearest project wins.
+	inner := filepath.Join(project, "src")
+	projectConfig(t, inner, "test", "retries = 2\n")
+	trust(t, project)
+	cfg = testConfig{}
+	if err := hooksdk.LoadProjectConfig(inDir(dir), "test", &cfg); err != nil || cfg.Retries != 2 || cfg.Notify.Channel != "#global" {
+		t.Errorf("nested project config = %+v, %v", cfg, err)
+	}
+
+	// Other hooks' project config isn't read.
+	cfg = testConfig{}
+	if err := hooksdk.LoadProjectConfig(inDir(dir), "other", &cfg); err != nil || cfg.Retries != 3 {
+		t.Errorf("config of another hook = %+v, %v", cfg, err)
+	}
+}
+
+func TestLoadProjectConfigUntrusted(t *testing.T) {
+	writeConfig(t, "test", "retries = 5\n")
+	project := t.TempDir()
+	path := projectConfig(t, project, "test", "retries = 1\n")
+	other := t.TempDir()
+
+	tests := []struct {
+		name    string
+		lines   []string
+		trusted bool
+	}{
+		{"no trust list", nil, false},
+		{"another project", []string{other}, false},
+		{"a relative path", []string{"relative/" + filepath.Base(project)}, false},
+		{"the directory above", []string{filepath.Dir(project)}, true},
+	}
+	for _, tt := range tests {
+		if tt.lines != nil {
+			trust(t, tt.lines...)
+		}
+		var cfg testConfig
+		err := hooksdk.LoadProjectConfig(inDir(project), "test", &cfg)
+		if tt.trusted {
+			if err != nil || cfg.Retries != 1 {
+				t.Errorf("%s: %+v, %v", tt.name, cfg, err)
+			}
+			continue
+		}
+		// The global config still loads.
+		var uerr *hooksdk.UntrustedProjectError
+		if !errors.Is(err, hooksdk.ErrUntrustedProject) || !errors.As(err, &uerr) || uerr.Path != path || cfg.Retries != 5 {
+			t.Errorf("%s: %+v, %v", tt.name, cfg, err)
+		} else if !strings.Contains(err.Error(), "not listed in") {
+			t.Errorf("%s: error %q", tt.name, err)
+		}
+	}
+
+	// A broken global config is still reported first.
+	writeConfig(t, "test", "retries = \"many\"\n")
+	trust(t, other)
+	var cfg testConfig
+	if err := hooksdk.LoadProjectConfig(inDir(project), "test", &cfg); err == nil || errors.Is(err, hooksdk.ErrUntrustedProject) {
+		t.Errorf("untrusted project with a broken global config = %v", err)
+	}
+}
+
+func TestLoadProjectConfigTrustHome(t *testing.T) {
+	t.Setenv("CODEX_HOME", t.TempDir())
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	project := filepath.Join(home, "src", "app")
+	projectConfig(t, project, "test", "retries = 1\n")
+	for _, line := range []string{"~/src", "~", "~/src/app/"} {
+		trust(t, line)
+		var cfg testConfig
+		if err := hooksdk.LoadProjectConfig(inDir(project), "test", &cfg); err != nil || cfg.Retries != 1 {
+			t.Errorf("trusting %s: %+v, %v", line, cfg, err)
+		}
+	}
+	// A sibling whose name starts the same isn't below it.
+	trust(t, "~/src/ap")
+	var cfg testConfig
+	if err := hooksdk.LoadProjectConfig(inDir(project), "test", &cfg); !errors.Is(err, hooksdk.ErrUntrustedProject) {
+		t.Errorf("trusting a sibling = %v", err)
+	}
+}
+
+func TestLoadProjectConfigWithoutProject(t *testing.T) {
+	writeConfig(t, "test", "retries = 5\n")
+	// The walk up ends at the filesystem root, whether it starts there or deep below.
+	deep := filepath.Join(t.TempDir(), "a", "b", "c")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.VolumeName(deep) + string(filepath.Separator)
+	for _, p := range []*hooksdk.HookPayload{inDir(deep), inDir(root), inDir(filepath.Join(deep, "missing")), hooktest.SessionStart().With("cwd", nil).Build(), nil} {
+		var cfg testConfig
+		if err := hooksdk.LoadProjectConfig(p, "test", &cfg); err != nil || cfg.Retries != 5 {
+			t.Errorf("without a project: %+v, %v", cfg, err)
+		}
+	}
+
+	// A directory named like the config file isn't one.
+	project := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(project, filepath.FromSlash(hooksdk.ProjectConfigDir), "test.toml"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	trust(t, project)
+	var cfg testConfig
+	if err := hooksdk.LoadProjectConfig(inDir(project), "test", &cfg); err != nil || cfg.Retries != 5 {
+		t.Errorf("with a directory for the file: %+v, %v", cfg, err)
+	}
+}
+
+func TestLoadProjectConfigFile(t *testing.T) {
+	t.Setenv("CODEX_HOME", t.TempDir())
+	global := filepath.Join(t.TempDir(), "custom.toml")
+	if err := os.WriteFile(global, []byte("retries = 9\nurl = \"https://global\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	project := t.TempDir()
+	projectConfig(t, project, "test", "retries = 1\n")
+	trust(t, project)
+	var cfg testConfig
+	if err := hooksdk.LoadProjectConfigFile(global, inDir(project), "test", &cfg); err != nil || cfg.Retries != 1 || cfg.URL != "https://global" {
+		t.Errorf("config = %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package hooksdk
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// unsafeOwner says why someone other than the current user could have written path, or "".
+func unsafeOwner(path string, fi fs.FileInfo) string {
+	if fi.Mode().Perm()&0o002 != 0 {
+		return path + " is world-writable"
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	if uid := os.Getuid(); int(st.Uid) != uid && st.Uid != 0 {
+		return fmt.Sprintf("%s is owned by uid %d, not the current user (uid %d)", path, st.Uid, uid)
+	}
+	return ""
+}
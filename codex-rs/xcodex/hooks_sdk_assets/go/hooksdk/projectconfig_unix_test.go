@@ -0,0 +1,63 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package hooksdk_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestLoadProjectConfigUnsafeOwner(t *testing.T) {
+	writeConfig(t, "test", "retries = 5\n")
+	project := t.TempDir()
+	path := projectConfig(t, project, "test", "retries = 1\n")
+	trust(t, project)
+	dirs := filepath.Join(project, filepath.FromSlash(hooksdk.ProjectConfigDir))
+
+	load := func() (testConfig, error) {
+		var cfg testConfig
+		return cfg, hooksdk.LoadProjectConfig(inDir(project), "test", &cfg)
+	}
+	if cfg, err := load(); err != nil || cfg.Retries != 1 {
+		t.Fatalf("trusted project config = %+v, %v", cfg, err)
+	}
+
+	// World-writable: the file, a directory between it and the project, or the project itself.
+	for _, p := range []string{path, dirs, filepath.Dir(dirs), project} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, fi.Mode().Perm()|0o002); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := load()
+		if !errors.Is(err, hooksdk.ErrUntrustedProject) || !strings.Contains(err.Error(), p+" is world-writable") || cfg.Retries != 5 {
+			t.Errorf("with %s world-writable: %+v, %v", p, cfg, err)
+		}
+		if err := os.Chmod(p, fi.Mode().Perm()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Above the project, the directories aren't checked: the temporary directory may well be
+	// world-writable.
+	if cfg, err := load(); err != nil || cfg.Retries != 1 {
+		t.Errorf("after restoring the modes: %+v, %v", cfg, err)
+	}
+
+	// Owned by someone else. Only root can give files away; root's own files are trusted.
+	if os.Getuid() != 0 {
+		t.Skip("chown needs root")
+	}
+	if err := os.Chown(path, 4242, 4242); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := load(); !errors.Is(err, hooksdk.ErrUntrustedProject) || !strings.Contains(err.Error(), "owned by uid 4242") || cfg.Retries != 5 {
+		t.Errorf("with a foreign owner: %+v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,177 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Scope is how long the answer to a question holds.
+type Scope string
+
+const (
+	// ScopeOnce answers only the event that asked.
+	ScopeOnce Scope = "once"
+	// ScopeSession answers the same question for the rest of the session (see decisioncache).
+	ScopeSession Scope = "session"
+)
+
+// The ids of the options DefaultOptions returns.
+const (
+	OptionAllowOnce    = "allow_once"
+	OptionAllowSession = "allow_session"
+	OptionDeny         = "deny"
+)
+
+// QuestionAnswerField is the payload field in which a host that showed a question echoes the
+// option the user chose, on the event that follows it (see QuestionAnswer).
+const QuestionAnswerField = "question_answer"
+
+// Question is the `question` of an ask response: a dialog for hosts that can show one, with a
+// title, a markdown detail, and options to choose from. Hosts that can't show it fall back to the
+// response's prompt.
+type Question struct {
+	// ID identifies the question in the answer the host echoes (see QuestionAnswer).
+	// decisioncache.Middleware sets it to the event's cache key when it is empty.
+	ID    string `json:"id,omitempty"`
+	Title string `json:"title"`
+	// Detail is markdown shown under the title, e.g. the command and why it needs approval.
+	Detail  string           `json:"detail,omitempty"`
+	Options []QuestionOption `json:"options"`
+	// Default is the id of the option selected to begin with.
+	Default string `json:"default,omitempty"`
+	// TimeoutSeconds, when positive, is how long the host waits for an answer before choosing
+	// TimeoutOption (or Default, when that is empty).
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+	TimeoutOption  string `json:"timeout_option,omitempty"`
+}
+
+// QuestionOption is an answer the user can choose.
+type QuestionOption struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	// Decision is what choosing the option decides: DecisionAllow or DecisionDeny.
+	Decision Decision `json:"decision"`
+	// Scope is how long the choice holds; empty means ScopeOnce.
+	Scope Scope `json:"scope,omitempty"`
+}
+
+// DefaultOptions returns "Allow once", "Allow for session" (ScopeSession), and "Deny".
+func DefaultOptions() []QuestionOption {
+	return []QuestionOption{
+		{ID: OptionAllowOnce, Label: "Allow once", Decision: DecisionAllow, Scope: ScopeOnce},
+		{ID: OptionAllowSession, Label: "Allow for session", Decision: DecisionAllow, Scope: ScopeSession},
+		{ID: OptionDeny, Label: "Deny", Decision: DecisionDeny, Scope: ScopeOnce},
+	}
+}
+
+// Option returns the option of q with id.
+func (q Question) Option(id string) (QuestionOption, bool) {
+	for _, o := range q.Options {
+		if o.ID == id {
+			return o, true
+		}
+	}
+	return QuestionOption{}, false
+}
+
+// Validate reports what keeps q from being shown: an empty title, no options, an option without
+// an id or label, a repeated id, a decision other than allow or deny, an unknown scope, or a
+// Default or TimeoutOption that isn't one of the options.
+func (q Question) Validate() error {
+	var errs []string
+	if q.Title == "" {
+		errs = append(errs, "question has no title")
+	}
+	if len(q.Options) == 0 {
+		errs = append(errs, "question has no options")
+	}
+	seen := map[string]bool{}
+	for i, o := range q.Options {
+		switch {
+		case o.ID == "":
+			errs = append(errs, fmt.Sprintf("option %d has no id", i+1))
+		case seen[o.ID]:
+			errs = append(errs, fmt.Sprintf("option id %q is used twice", o.ID))
+		}
+		seen[o.ID] = true
+		if o.Label == "" {
+			errs = append(errs, fmt.Sprintf("option %q has no label", o.ID))
+		}
+		if o.Decision != DecisionAllow && o.Decision != DecisionDeny {
+			errs = append(errs, fmt.Sprintf("option %q: decision must be allow or deny, got %q", o.ID, o.Decision))
+		}
+		if o.Scope != "" && o.Scope != ScopeOnce && o.Scope != ScopeSession {
+			errs = append(errs, fmt.Sprintf("option %q: scope must be once or session, got %q", o.ID, o.Scope))
+		}
+	}
+	if q.Default != "" && !seen[q.Default] {
+		errs = append(errs, fmt.Sprintf("default %q is not one of the options", q.Default))
+	}
+	if q.TimeoutSeconds < 0 {
+		errs = append(errs, fmt.Sprintf("timeout_seconds must not be negative, got %d", q.TimeoutSeconds))
+	}
+	if q.TimeoutOption != "" && !seen[q.TimeoutOption] {
+		errs = append(errs, fmt.Sprintf("timeout_option %q is not one of the options", q.TimeoutOption))
+	}
+	if q.TimeoutSeconds > 0 && q.TimeoutOption == "" && q.Default == "" {
+		errs = append(errs, "a question with a timeout needs a timeout_option or a default")
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// AskQuestion returns a response that asks the user q, e.g.
+//
+//	hooksdk.AskQuestion(hooksdk.Question{
+//		Title:   "Run `terraform apply`?",
+//		Detail:  "It changes **production**.",
+//		Options: hooksdk.DefaultOptions(),
+//		Default: hooksdk.OptionDeny,
+//	})
+//
+// The title is the prompt for hosts that can't show questions. Run reports a question that
+// doesn't pass Question.Validate on stderr; CheckQuestion tells a handler beforehand.
+func AskQuestion(q Question) Response {
+	q.Options = append([]QuestionOption(nil), q.Options...)
+	return Response{Decision: DecisionAsk, Prompt: q.Title, Question: &q}
+}
+
+// CheckQuestion returns what is wrong with r's question (see Question.Validate), or nil if it has
+// none or it is fine.
+func (r Response) CheckQuestion() error {
+	if r.Question == nil {
+		return nil
+	}
+	if r.Decision != DecisionAsk {
+		return fmt.Errorf("a question needs decision ask, got %q", r.Decision)
+	}
+	return r.Question.Validate()
+}
+
+// QuestionAnswer is the answer a host echoes in QuestionAnswerField after showing a question:
+// the question's id and the option chosen.
+type QuestionAnswer struct {
+	QuestionID string         `json:"question_id"`
+	Option     QuestionOption `json:"option"`
+}
+
+// QuestionAnswer returns the answer p carries to an earlier question, if any.
+func (p *HookPayload) QuestionAnswer() (QuestionAnswer, bool) {
+	raw, ok := p.RawPayload[QuestionAnswerField]
+	if !ok {
+		return QuestionAnswer{}, false
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return QuestionAnswer{}, false
+	}
+	var a QuestionAnswer
+	if err := json.Unmarshal(data, &a); err != nil || a.Option.ID == "" {
+		return QuestionAnswer{}, false
+	}
+	return a, true
+}
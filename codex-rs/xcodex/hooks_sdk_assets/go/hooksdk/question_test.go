@@ -0,0 +1,193 @@
+package hooksdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestAskQuestionJSON(t *testing.T) {
+	resp := hooksdk.AskQuestion(hooksdk.Question{
+		Title:          "Run `terraform apply`?",
+		Detail:         "It changes **production**.",
+		Options:        hooksdk.DefaultOptions(),
+		Default:        hooksdk.OptionDeny,
+		TimeoutSeconds: 30,
+	})
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"decision":"ask","prompt":"Run ` + "`terraform apply`" + `?","question":{"title":"Run ` + "`terraform apply`" + `?",` +
+		`"detail":"It changes **production**.","options":[` +
+		`{"id":"allow_once","label":"Allow once","decision":"allow","scope":"once"},` +
+		`{"id":"allow_session","label":"Allow for session","decision":"allow","scope":"session"},` +
+		`{"id":"deny","label":"Deny","decision":"deny","scope":"once"}],` +
+		`"default":"deny","timeout_seconds":30}}`
+	if string(data) != want {
+		t.Errorf("AskQuestion JSON =\n%s\nwant\n%s", data, want)
+	}
+	if err := resp.CheckQuestion(); err != nil {
+		t.Errorf("CheckQuestion = %v", err)
+	}
+	for _, eventType := range []string{"approval-requested", "tool-call-started"} {
+		if err := hooksdk.ValidateResponse(eventType, resp); err != nil {
+			t.Errorf("%s: %v", eventType, err)
+		}
+	}
+
+	// The response has its own copy of the options.
+	opts := hooksdk.DefaultOptions()
+	resp = hooksdk.AskQuestion(hooksdk.Question{Title: "t", Options: opts})
+	opts[0].Label = "changed"
+	if resp.Question.Options[0].Label != "Allow once" {
+		t.Error("AskQuestion shares the caller's options")
+	}
+	if o, ok := resp.Question.Option(hooksdk.OptionAllowSession); !ok || o.Scope != hooksdk.ScopeSession || o.Decision != hooksdk.DecisionAllow {
+		t.Errorf("Option(%s) = %+v, %v", hooksdk.OptionAllowSession, o, ok)
+	}
+	if _, ok := resp.Question.Option("missing"); ok {
+		t.Error("Option found a missing id")
+	}
+}
+
+func TestQuestionValidate(t *testing.T) {
+	valid := func() hooksdk.Question {
+		return hooksdk.Question{Title: "Deploy?", Options: hooksdk.DefaultOptions(), Default: hooksdk.OptionDeny}
+	}
+	tests := []struct {
+		name   string
+		change func(q *hooksdk.Question)
+		want   string
+		// pointer is where the response schema finds the problem, or "" when only Validate does.
+		pointer string
+	}{
+		{"no title", func(q *hooksdk.Question) { q.Title = "" }, "question has no title", "/question/title"},
+		{"no options", func(q *hooksdk.Question) { q.Options, q.Default = nil, "" }, "question has no options", "/question/options"},
+		{"no id", func(q *hooksdk.Question) { q.Options[1].ID = "" }, "option 2 has no id", "/question/options/1/id"},
+		{"repeated id", func(q *hooksdk.Question) { q.Options[1].ID = q.Options[0].ID }, `option id "allow_once" is used twice`, ""},
+		{"no label", func(q *hooksdk.Question) { q.Options[0].Label = "" }, `option "allow_once" has no label`, "/question/options/0/label"},
+		{"ask option", func(q *hooksdk.Question) { q.Options[2].Decision = hooksdk.DecisionAsk }, `option "deny": decision must be allow or deny, got "ask"`, "/question/options/2/decision"},
+		{"bad scope", func(q *hooksdk.Question) { q.Options[0].Scope = "forever" }, `option "allow_once": scope must be once or session, got "forever"`, "/question/options/0/scope"},
+		{"unknown default", func(q *hooksdk.Question) { q.Default = "maybe" }, `default "maybe" is not one of the options`, ""},
+		{"negative timeout", func(q *hooksdk.Question) { q.TimeoutSeconds = -1 }, "timeout_seconds must not be negative, got -1", "/question/timeout_seconds"},
+		{"unknown timeout option", func(q *hooksdk.Question) { q.TimeoutSeconds, q.TimeoutOption = 10, "later" }, `timeout_option "later" is not one of the options`, ""},
+		{"timeout without a choice", func(q *hooksdk.Question) { q.TimeoutSeconds, q.Default = 10, "" }, "a question with a timeout needs a timeout_option or a default", ""},
+	}
+	for _, tt := range tests {
+		q := valid()
+		tt.change(&q)
+		err := q.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Validate = %v, want %q", tt.name, err, tt.want)
+		}
+		resp := hooksdk.AskQuestion(q)
+		if err := resp.CheckQuestion(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: CheckQuestion = %v", tt.name, err)
+		}
+		if tt.pointer == "" {
+			continue
+		}
+		err = hooksdk.ValidateResponse("approval-requested", resp)
+		if got := pointers(t, err); !reflect.DeepEqual(got, []string{tt.pointer}) {
+			t.Errorf("%s: schema violations at %v, want %s (%v)", tt.name, got, tt.pointer, err)
+		}
+	}
+
+	// All the problems are reported at once.
+	err := hooksdk.Question{Options: []hooksdk.QuestionOption{{ID: "a"}}}.Validate()
+	if err == nil || err.Error() != `question has no title; option "a" has no label; option "a": decision must be allow or deny, got ""` {
+		t.Errorf("Validate = %v", err)
+	}
+
+	// A timeout falls to its option, or else to the default.
+	for _, q := range []hooksdk.Question{
+		{Title: "t", Options: hooksdk.DefaultOptions(), TimeoutSeconds: 5, TimeoutOption: hooksdk.OptionDeny},
+		{Title: "t", Options: hooksdk.DefaultOptions(), TimeoutSeconds: 5, Default: hooksdk.OptionAllowOnce},
+	} {
+		if err := q.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v", q, err)
+		}
+	}
+}
+
+func TestCheckQuestion(t *testing.T) {
+	if err := hooksdk.Ask("sure?").CheckQuestion(); err != nil {
+		t.Errorf("an ask without a question: %v", err)
+	}
+	resp := hooksdk.AskQuestion(hooksdk.Question{Title: "t", Options: hooksdk.DefaultOptions()})
+	resp.Decision = hooksdk.DecisionDeny
+	if err := resp.CheckQuestion(); err == nil || err.Error() != `a question needs decision ask, got "deny"` {
+		t.Errorf("a question with a deny: %v", err)
+	}
+	// Only the events that ask can carry questions.
+	resp.Decision = hooksdk.DecisionAsk
+	if got := pointers(t, hooksdk.ValidateResponse("tool-call-finished", resp)); !reflect.DeepEqual(got, []string{"/decision", "/question"}) {
+		t.Errorf("schema violations of a question for tool-call-finished at %v", got)
+	}
+}
+
+func TestRunWarnsAboutQuestions(t *testing.T) {
+	run := func(resp hooksdk.Response) (hooksdk.Response, string) {
+		t.Helper()
+		stdio, out, errOut := testIO(hooktest.ApprovalRequested().Bytes(), map[string]string{"CODEX_HOME": t.TempDir(), hooksdk.CapabilitiesEnv: "question"})
+		stdio.Run(context.Background(), func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+			return resp, nil
+		})
+		var got hooksdk.Response
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("response %q: %v", out, err)
+		}
+		return got, errOut.String()
+	}
+
+	// A bad question is reported, and still written for the host to judge.
+	got, stderr := run(hooksdk.AskQuestion(hooksdk.Question{Title: "Deploy?"}))
+	if !strings.Contains(stderr, `"stage":"question"`) || !strings.Contains(stderr, "question has no options") {
+		t.Errorf("stderr = %q", stderr)
+	}
+	if got.Decision != hooksdk.DecisionAsk || got.Question == nil || got.Question.Title != "Deploy?" {
+		t.Errorf("response = %+v", got)
+	}
+
+	got, stderr = run(hooksdk.AskQuestion(hooksdk.Question{Title: "Deploy?", Options: hooksdk.DefaultOptions()}))
+	if strings.Contains(stderr, `"stage":"question"`) || got.Question == nil || len(got.Question.Options) != 3 {
+		t.Errorf("a good question: %+v, stderr %q", got, stderr)
+	}
+}
+
+func TestQuestionAnswer(t *testing.T) {
+	answer := map[string]any{
+		"question_id": "make deploy",
+		"option":      map[string]any{"id": "allow_session", "label": "Allow for session", "decision": "allow", "scope": "session"},
+	}
+	p := hooktest.ApprovalRequested().With(hooksdk.QuestionAnswerField, answer).Build()
+	a, ok := p.QuestionAnswer()
+	want := hooksdk.QuestionAnswer{
+		QuestionID: "make deploy",
+		Option:     hooksdk.QuestionOption{ID: "allow_session", Label: "Allow for session", Decision: hooksdk.DecisionAllow, Scope: hooksdk.ScopeSession},
+	}
+	if !ok || !reflect.DeepEqual(a, want) {
+		t.Errorf("QuestionAnswer = %+v, %v; want %+v", a, ok, want)
+	}
+
+	for name, v := range map[string]any{
+		"missing":       nil,
+		"not an object": "allow_session",
+		"no option id":  map[string]any{"question_id": "q", "option": map[string]any{"decision": "allow"}},
+		"bad types":     map[string]any{"question_id": 1, "option": "x"},
+	} {
+		b := hooktest.ApprovalRequested()
+		if v != nil {
+			b.With(hooksdk.QuestionAnswerField, v)
+		}
+		if a, ok := b.Build().QuestionAnswer(); ok {
+			t.Errorf("%s: QuestionAnswer = %+v", name, a)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Package ratelimit limits how often a hook does something expensive (a network call, a
+// notification), across hook invocations.
+//
+// Every event runs in a new process, so the limiter keeps its state in a small file, and every
+// check holds a lock on it, so hooks running at the same time never both take the last token.
+//
+//	if ratelimit.Allow("webhook", ratelimit.Every(time.Minute), 5) { // 5 at once, then 1 a minute
+//		post(payload)
+//	}
+//	if ratelimit.Once("notify:"+payload.SessionID(), 10*time.Minute) {
+//		notify(payload)
+//	}
+package ratelimit
+
+import (
+	"math"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/state"
+)
+
+// Limiter keeps the token buckets and Once windows of every key in one state file, a
+// hooksdk/state store.
+type Limiter struct {
+	// Path is the state file.
+	Path string
+	// Now is the clock; nil means time.Now.
+	Now func() time.Time
+}
+
+// New returns a Limiter storing its state in path.
+func New(path string) *Limiter {
+	return &Limiter{Path: path}
+}
+
+// DefaultPath returns `hooks/state/ratelimit.state` under CODEX_HOME (default `~/.xcodex`), the
+// state file of the package-level Allow and Once.
+func DefaultPath() string {
+	return hooksdk.Environ().Path("hooks", "state", "ratelimit.state")
+}
+
+// Every returns the rate of one event per interval, for Allow.
+func Every(interval time.Duration) float64 {
+	if interval <= 0 {
+		return math.Inf(1)
+	}
+	return float64(time.Second) / float64(interval)
+}
+
+type bucket struct {
+	Tokens float64   `json:"tokens"`
+	At     time.Time `json:"at"`
+}
+
+// Allow reports whether an event for key may happen now, taking a token from key's bucket if so.
+// The bucket holds up to burst tokens (at least 1) and refills at rate tokens per second (see
+// Every); a key seen for the first time starts full. A corrupt state file counts as empty.
+func (l *Limiter) Allow(key string, rate float64, burst int) (bool, error) {
+	if burst < 1 {
+		burst = 1
+	}
+	allowed := false
+	err := l.update("bucket:"+key, func(e *state.Entry) error {
+		now := e.Now()
+		var b bucket
+		if ok, err := e.Decode(&b); err != nil || !ok {
+			b = bucket{Tokens: float64(burst), At: now}
+		}
+		if elapsed := now.Sub(b.At).Seconds(); elapsed > 0 {
+			b.Tokens += elapsed * rate
+		}
+		b.Tokens = math.Min(b.Tokens, float64(burst))
+		b.At = now
+		if b.Tokens >= 1 {
+			b.Tokens--
+			allowed = true
+		}
+		refill := math.Inf(1)
+		if missing := float64(burst) - b.Tokens; missing <= 0 {
+			refill = 0
+		} else if rate > 0 {
+			refill = missing / rate * float64(time.Second)
+		}
+		switch {
+		case refill < 1:
+			// Full again already: a new bucket would be the same.
+			e.Delete()
+			return nil
+		case refill >= math.MaxInt64:
+			// A bucket that never refills (or takes centuries to) is kept.
+			return e.Set(b, 0)
+		}
+		// Once it has refilled, the bucket is dropped from the file.
+		return e.Set(b, time.Duration(refill))
+	})
+	return allowed, err
+}
+
+// Once reports whether key was not seen within the last window, and starts a new window if so:
+// the first call for a key returns true, and later ones false until window has passed.
+func (l *Limiter) Once(key string, window time.Duration) (bool, error) {
+	first := false
+	err := l.update("once:"+key, func(e *state.Entry) error {
+		if e.Value != nil {
+			return nil
+		}
+		first = true
+		if window <= 0 {
+			return nil
+		}
+		return e.Set(true, window)
+	})
+	return first, err
+}
+
+// update runs fn on key's entry in the state file's store.
+func (l *Limiter) update(key string, fn func(e *state.Entry) error) error {
+	st, err := state.OpenPath(l.Path)
+	if err != nil {
+		return err
+	}
+	st.Now = l.Now
+	return st.Update(key, fn)
+}
+
+// Allow is Limiter.Allow on the state file at DefaultPath. If the state can't be read or saved,
+// the event is allowed (a limiter must not silence a hook) and the error is logged to stderr.
+func Allow(key string, rate float64, burst int) bool {
+	ok, err := New(DefaultPath()).Allow(key, rate, burst)
+	if err != nil {
+		hooklog.Warnf("ratelimit: %v", err)
+		return true
+	}
+	return ok
+}
+
+// Once is Limiter.Once on the state file at DefaultPath, allowing the event when the state can't
+// be read or saved (see Allow).
+func Once(key string, window time.Duration) bool {
+	ok, err := New(DefaultPath()).Once(key, window)
+	if err != nil {
+		hooklog.Warnf("ratelimit: %v", err)
+		return true
+	}
+	return ok
+}
@@ -0,0 +1,235 @@
+package ratelimit_test
+
+import (
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/ratelimit"
+)
+
+// TestMain lets the tests run this binary as a hook process: with RATELIMIT_TEST_PATH set, it
+// calls Allow once on that state file and exits 0 if allowed, 3 if not.
+func TestMain(m *testing.M) {
+	if path := os.Getenv("RATELIMIT_TEST_PATH"); path != "" {
+		ok, err := ratelimit.New(path).Allow("shared", 0, 5)
+		switch {
+		case err != nil:
+			os.Stderr.WriteString(err.Error())
+			os.Exit(1)
+		case !ok:
+			os.Exit(3)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// clock is a settable time for Limiter.Now.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// limiter returns a Limiter on a fresh state file, reading the time from c.
+func limiter(t *testing.T, c *clock) *ratelimit.Limiter {
+	l := ratelimit.New(filepath.Join(t.TempDir(), "ratelimit.state"))
+	l.Now = c.now
+	return l
+}
+
+func allow(t *testing.T, l *ratelimit.Limiter, key string, rate float64, burst int) bool {
+	t.Helper()
+	ok, err := l.Allow(key, rate, burst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestAllowBurstAndRefill(t *testing.T) {
+	c := &clock{time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := limiter(t, c)
+	rate := ratelimit.Every(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		if !allow(t, l, "k", rate, 3) {
+			t.Fatalf("call %d of the burst denied", i+1)
+		}
+	}
+	if allow(t, l, "k", rate, 3) {
+		t.Fatal("call past the burst allowed")
+	}
+	// Another key has its own bucket.
+	if !allow(t, l, "other", rate, 3) {
+		t.Error("a new key was denied")
+	}
+
+	c.advance(9 * time.Second)
+	if allow(t, l, "k", rate, 3) {
+		t.Error("allowed before a token refilled")
+	}
+	c.advance(time.Second)
+	if !allow(t, l, "k", rate, 3) || allow(t, l, "k", rate, 3) {
+		t.Error("a refilled token wasn't allowed exactly once")
+	}
+
+	// A long wait refills the bucket to burst, no further.
+	c.advance(time.Hour)
+	n := 0
+	for allow(t, l, "k", rate, 3) {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("after an hour, %d calls allowed, want 3", n)
+	}
+}
+
+func TestAllowWithoutRefill(t *testing.T) {
+	c := &clock{time.Now()}
+	l := limiter(t, c)
+	// A burst below 1 is 1.
+	if !allow(t, l, "k", 0, 0) {
+		t.Fatal("first call denied")
+	}
+	c.advance(24 * 365 * time.Hour)
+	if allow(t, l, "k", 0, 0) {
+		t.Error("a bucket with rate 0 refilled")
+	}
+	// An infinite rate never limits.
+	for i := 0; i < 10; i++ {
+		if !allow(t, l, "fast", ratelimit.Every(0), 1) {
+			t.Fatalf("call %d at an infinite rate denied", i+1)
+		}
+	}
+}
+
+func TestOnce(t *testing.T) {
+	c := &clock{time.Now()}
+	l := limiter(t, c)
+	once := func(key string, window time.Duration) bool {
+		ok, err := l.Once(key, window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	if !once("k", time.Minute) || once("k", time.Minute) {
+		t.Fatal("Once didn't allow exactly the first call")
+	}
+	if !once("j", time.Minute) {
+		t.Error("another key was suppressed")
+	}
+	c.advance(59 * time.Second)
+	if once("k", time.Minute) {
+		t.Error("allowed within the window")
+	}
+	c.advance(time.Second)
+	if !once("k", time.Minute) {
+		t.Error("suppressed after the window")
+	}
+	// Once and Allow keep separate state for the same key.
+	if !allow(t, l, "k", 0, 1) {
+		t.Error("Once's key limited Allow")
+	}
+	for i := 0; i < 3; i++ {
+		if !once("none", 0) {
+			t.Error("Once with no window suppressed a call")
+		}
+	}
+}
+
+func TestCorruptState(t *testing.T) {
+	c := &clock{time.Now()}
+	l := limiter(t, c)
+	if err := os.WriteFile(l.Path, []byte("not json\n{\"key\":\"bucket:k\",\"value\":\"zero\"}\n\x00\xff"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A bucket that doesn't decode starts full, as a new one.
+	if !allow(t, l, "k", 0, 2) || !allow(t, l, "k", 0, 2) || allow(t, l, "k", 0, 2) {
+		t.Error("corrupt state didn't count as empty")
+	}
+}
+
+func TestConcurrentAllow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.state")
+	const callers = 12
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	record := func(ok bool, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			t.Error(err)
+		} else if ok {
+			allowed++
+		}
+	}
+	for i := 0; i < callers; i++ {
+		wg.Add(2)
+		// Hook processes and goroutines share the one state file.
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run=^$")
+			cmd.Env = append(os.Environ(), "RATELIMIT_TEST_PATH="+path)
+			err := cmd.Run()
+			var exit *exec.ExitError
+			if errors.As(err, &exit) && exit.ExitCode() == 3 {
+				record(false, nil)
+				return
+			}
+			record(err == nil, err)
+		}()
+		go func() {
+			defer wg.Done()
+			record(ratelimit.New(path).Allow("shared", 0, 5))
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Errorf("%d of %d concurrent calls allowed, want the burst of 5", allowed, 2*callers)
+	}
+}
+
+func TestPackageLevel(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	if want := filepath.Join(home, "hooks", "state", "ratelimit.state"); ratelimit.DefaultPath() != want {
+		t.Errorf("DefaultPath() = %s, want %s", ratelimit.DefaultPath(), want)
+	}
+	if !ratelimit.Allow("k", 0, 1) || ratelimit.Allow("k", 0, 1) {
+		t.Error("Allow didn't limit to the burst")
+	}
+	if !ratelimit.Once("k", time.Hour) || ratelimit.Once("k", time.Hour) {
+		t.Error("Once didn't suppress the second call")
+	}
+	if _, err := os.Stat(ratelimit.DefaultPath()); err != nil {
+		t.Error(err)
+	}
+
+	// State that can't be saved allows the event.
+	blocked := filepath.Join(home, "file")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CODEX_HOME", blocked)
+	if !ratelimit.Allow("k", 0, 1) || !ratelimit.Allow("k", 0, 1) || !ratelimit.Once("k", time.Hour) || !ratelimit.Once("k", time.Hour) {
+		t.Error("a limiter that can't save its state denied an event")
+	}
+}
+
+func TestEvery(t *testing.T) {
+	if got := ratelimit.Every(500 * time.Millisecond); got != 2 {
+		t.Errorf("Every(500ms) = %v, want 2", got)
+	}
+	if got := ratelimit.Every(-time.Second); !math.IsInf(got, 1) {
+		t.Errorf("Every(-1s) = %v, want +Inf", got)
+	}
+}
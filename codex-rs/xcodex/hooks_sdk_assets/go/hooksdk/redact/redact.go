@@ -0,0 +1,187 @@
+// Package redact masks secrets in hook payloads before they are written anywhere.
+//
+// Secrets are replaced with `[REDACTED:sha256:<prefix>]`, where the prefix is the start of the
+// secret's SHA-256, so two occurrences of the same secret can still be correlated without
+// revealing it.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// DefaultKeys are the key names whose values are always redacted. A key matches when, lowercased
+// and with `-` read as `_`, it equals a name or ends in `_<name>` (so `db_password` matches
+// `password`, but `input_tokens` doesn't match `token`).
+var DefaultKeys = []string{
+	"password", "passwd", "secret", "token", "api_key", "apikey", "access_key", "secret_key",
+	"private_key", "authorization", "client_secret", "cookie",
+}
+
+// DefaultPatterns match well-known credential formats inside any string value.
+var DefaultPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),                   // AWS access key id
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),                  // GitHub tokens
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),                // GitHub fine-grained PAT
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}\b`),                       // OpenAI-style API keys
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),                // Slack tokens
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{8,}=*`),         // Authorization headers
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[^-]*-----END`), // PEM private keys
+}
+
+// candidateRe finds tokens long enough to be checked for high entropy.
+var candidateRe = regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`)
+
+// Redactor masks secrets in untyped payloads. The zero value redacts nothing; use New for the
+// defaults.
+type Redactor struct {
+	// Keys are key names whose values are redacted wholesale, at any depth.
+	Keys []string
+	// Patterns are matched against every string value; matches are replaced.
+	Patterns []*regexp.Regexp
+	// HighEntropy also redacts long random-looking tokens (mixed case and digits with high
+	// Shannon entropy), which catches secrets that have no recognizable prefix.
+	HighEntropy bool
+}
+
+// New returns a Redactor with DefaultKeys, DefaultPatterns, and high-entropy detection, plus any
+// extra key names.
+func New(extraKeys ...string) *Redactor {
+	keys := append(append([]string(nil), DefaultKeys...), extraKeys...)
+	return &Redactor{Keys: keys, Patterns: DefaultPatterns, HighEntropy: true}
+}
+
+// Redact returns a copy of payload with secrets masked using the default Redactor. The input is
+// not modified.
+func Redact(payload hooksdk.HookPayloadJSON) hooksdk.HookPayloadJSON {
+	return New().Redact(payload)
+}
+
+// Redact returns a copy of payload with secrets masked. The input is not modified.
+func (r *Redactor) Redact(payload hooksdk.HookPayloadJSON) hooksdk.HookPayloadJSON {
+	if payload == nil {
+		return nil
+	}
+	return hooksdk.HookPayloadJSON(r.value(map[string]any(payload)).(map[string]any))
+}
+
+// String masks secrets inside a single string.
+func (r *Redactor) String(s string) string {
+	for _, re := range r.Patterns {
+		s = re.ReplaceAllStringFunc(s, Marker)
+	}
+	if r.HighEntropy {
+		s = candidateRe.ReplaceAllStringFunc(s, func(tok string) string {
+			if !LooksRandom(tok) {
+				return tok
+			}
+			return Marker(tok)
+		})
+	}
+	return s
+}
+
+// Marker returns the replacement for secret.
+func Marker(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "[REDACTED:sha256:" + hex.EncodeToString(sum[:6]) + "]"
+}
+
+func (r *Redactor) value(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, child := range t {
+			if r.sensitiveKey(k) {
+				out[k] = redactWhole(child)
+				continue
+			}
+			out[k] = r.value(child)
+		}
+		return out
+	case hooksdk.HookPayloadJSON:
+		return hooksdk.HookPayloadJSON(r.value(map[string]any(t)).(map[string]any))
+	case []any:
+		out := make([]any, len(t))
+		for i, child := range t {
+			out[i] = r.value(child)
+		}
+		return out
+	case []string:
+		out := make([]string, len(t))
+		for i, child := range t {
+			out[i] = r.String(child)
+		}
+		return out
+	case string:
+		return r.String(t)
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) sensitiveKey(key string) bool {
+	k := strings.ReplaceAll(strings.ToLower(key), "-", "_")
+	for _, name := range r.Keys {
+		name = strings.ToLower(name)
+		if k == name || strings.HasSuffix(k, "_"+name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactWhole masks the value of a sensitive key. Null and empty values are kept so the log still
+// shows the key was unset.
+func redactWhole(v any) any {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case string:
+		if t == "" {
+			return t
+		}
+		return Marker(t)
+	default:
+		data, err := json.Marshal(t)
+		if err != nil {
+			data = []byte(fmt.Sprint(t))
+		}
+		return Marker(string(data))
+	}
+}
+
+// LooksRandom reports whether tok mixes lowercase, uppercase, and digits with high entropy.
+// Requiring all three classes skips hex digests, UUIDs, and ordinary identifiers.
+func LooksRandom(tok string) bool {
+	var lower, upper, digit bool
+	counts := make(map[rune]int)
+	for _, c := range tok {
+		switch {
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		counts[c]++
+	}
+	if !lower || !upper || !digit {
+		return false
+	}
+	var entropy float64
+	n := float64(len(tok))
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= 4.0
+}
@@ -0,0 +1,129 @@
+package hooksdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// DefaultReloadInterval is how often Serve checks the files given to WithReload for changes.
+const DefaultReloadInterval = time.Second
+
+type reloader struct {
+	fn    func() error
+	paths []string
+}
+
+// WithReload makes Serve call fn when one of paths changes (its modification time or size, or it
+// appears or goes away), checked every DefaultReloadInterval, and when the daemon gets SIGHUP on
+// Unix. fn should load the config again and swap it in, e.g. into an atomic.Pointer the handler
+// loads once per event, so events already running finish with the config they started with:
+//
+//	var rules atomic.Pointer[Rules]
+//	reload := func() error {
+//		var r Rules
+//		if err := hooksdk.LoadConfig("my_guard", &r); err != nil {
+//			return err
+//		}
+//		rules.Store(&r)
+//		return nil
+//	}
+//	if err := reload(); err != nil {
+//		return err
+//	}
+//	hooksdk.Serve(socketPath, handle, hooksdk.WithReload(reload, hooksdk.ConfigPath("my_guard")))
+//
+// An error from fn, or a panic, is logged to stderr and nothing else happens: the daemon keeps
+// the config it had, and fn is called again on the next change. Calls to fn never overlap, and
+// fn is not called at startup. Options other than WithReload apply to each event, as for RunIO.
+// Outside Serve and ServeListener the option does nothing.
+func WithReload(fn func() error, paths ...string) Option {
+	return func(o *options) {
+		if fn != nil {
+			o.reloads = append(o.reloads, reloader{fn: fn, paths: append([]string(nil), paths...)})
+		}
+	}
+}
+
+// fileStamp is what a reload watch compares between checks.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func stampFile(path string) fileStamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: fi.Size(), modTime: fi.ModTime()}
+}
+
+// watchReloads stamps the WithReload files and starts watching for SIGHUP, then returns a
+// function that runs the WithReload functions until ctx is done: one whose files changed since
+// the last check, and all of them on SIGHUP. The files are stamped before it returns, so a change
+// made once the daemon accepts connections isn't missed.
+func watchReloads(reloads []reloader, interval time.Duration, stderr io.Writer) func(ctx context.Context) {
+	stamps := make([][]fileStamp, len(reloads))
+	for i, r := range reloads {
+		for _, path := range r.paths {
+			stamps[i] = append(stamps[i], stampFile(path))
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	notifyHangup(hup)
+	return func(ctx context.Context) {
+		defer signal.Stop(hup)
+		watch(ctx, reloads, stamps, hup, interval, stderr)
+	}
+}
+
+func watch(ctx context.Context, reloads []reloader, stamps [][]fileStamp, hup <-chan os.Signal, interval time.Duration, stderr io.Writer) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			for i, r := range reloads {
+				for j, path := range r.paths {
+					stamps[i][j] = stampFile(path)
+				}
+				runReload(r.fn, stderr)
+			}
+		case <-tick.C:
+			for i, r := range reloads {
+				changed := false
+				for j, path := range r.paths {
+					if s := stampFile(path); s != stamps[i][j] {
+						stamps[i][j], changed = s, true
+					}
+				}
+				if changed {
+					runReload(r.fn, stderr)
+				}
+			}
+		}
+	}
+}
+
+// runReload calls fn, logging its error or panic.
+func runReload(fn func() error, stderr io.Writer) {
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return fn()
+	}()
+	if err != nil {
+		writeErrorLine(stderr, "reload", fmt.Errorf("%w; keeping the previous config", err))
+	}
+}
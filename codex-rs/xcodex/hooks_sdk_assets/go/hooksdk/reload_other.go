@@ -0,0 +1,8 @@
+//go:build !unix
+
+package hooksdk
+
+import "os"
+
+// Elsewhere there is no SIGHUP; only changes to the files reload.
+func notifyHangup(c chan<- os.Signal) {}
@@ -0,0 +1,246 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// syncBuffer is a bytes.Buffer safe to write from the daemon while the test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+type guardRules struct {
+	Deny string
+}
+
+// reloadingGuard is a daemon handler denying the commands its config file names, as
+// WithReload's example has it: the handler loads the rules once per event.
+type reloadingGuard struct {
+	path    string
+	rules   atomic.Pointer[guardRules]
+	reloads atomic.Int32
+}
+
+func (g *reloadingGuard) reload() error {
+	g.reloads.Add(1)
+	var r guardRules
+	if err := hooksdk.LoadConfigFile(g.path, "reload_test", &r); err != nil {
+		return err
+	}
+	g.rules.Store(&r)
+	return nil
+}
+
+func (g *reloadingGuard) handle(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+	return check(g.rules.Load(), p), nil
+}
+
+func check(rules *guardRules, p *hooksdk.HookPayload) hooksdk.Response {
+	if rules.Deny != "" && strings.Contains(strings.Join(p.Command, " "), rules.Deny) {
+		return hooksdk.Deny("denied by " + rules.Deny)
+	}
+	return hooksdk.Allow()
+}
+
+// writeRules writes the guard's config and moves its modification time on, so the change is seen
+// however coarse the file system's clock.
+func writeRules(t *testing.T, path, deny string) {
+	t.Helper()
+	before, _ := os.Stat(path)
+	if err := os.WriteFile(path, []byte("deny = "+deny+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if before != nil {
+		later := before.ModTime().Add(time.Second)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newGuard(t *testing.T, deny string) *reloadingGuard {
+	t.Helper()
+	t.Setenv("CODEX_HOOK_RELOAD_TEST_DENY", "")
+	g := &reloadingGuard{path: filepath.Join(t.TempDir(), "guard.toml")}
+	writeRules(t, g.path, deny)
+	if err := g.reload(); err != nil {
+		t.Fatal(err)
+	}
+	g.reloads.Store(0)
+	return g
+}
+
+// decide forwards a command to the daemon and returns its exit code and output.
+func decide(path, session, command string) (int, string) {
+	return forward(path, hooktest.ApprovalRequested().WithSessionID(session).WithCommand(command).Bytes())
+}
+
+// waitUntil polls cond until it holds or a deadline passes.
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(3*hooksdk.DefaultReloadInterval + 5*time.Second); !cond(); time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestReloadSwapsConfigMidServe(t *testing.T) {
+	g := newGuard(t, `"rm -rf"`)
+	hold := make(chan struct{})
+	held := make(chan struct{})
+	handler := func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		rules := g.rules.Load()
+		if p.SessionID() == "held" {
+			close(held)
+			<-hold
+		}
+		return check(rules, p), nil
+	}
+	var stderr syncBuffer
+	path := serve(t, handler, hooksdk.WithReload(g.reload, g.path), hooksdk.WithIO(hooksdk.IO{Err: &stderr}))
+
+	if code, out := decide(path, "s", "rm -rf build"); code != hooksdk.ExitDeny || !strings.Contains(out, "denied by rm -rf") {
+		t.Fatalf("before the change: exit %d, %q", code, out)
+	}
+	// An event that starts under the old rules finishes with them.
+	type result struct {
+		code int
+		out  string
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		code, out := decide(path, "held", "rm -rf build")
+		inFlight <- result{code, out}
+	}()
+	<-held
+
+	writeRules(t, g.path, `"git push --force"`)
+	waitUntil(t, "the reload", func() bool { return g.reloads.Load() > 0 })
+	if code, out := decide(path, "s", "git push --force origin"); code != hooksdk.ExitDeny || !strings.Contains(out, "denied by git push --force") {
+		t.Errorf("after the change: exit %d, %q", code, out)
+	}
+	if code, _ := decide(path, "s", "rm -rf build"); code != hooksdk.ExitOK {
+		t.Errorf("after the change, the old rule still applies: exit %d", code)
+	}
+	close(hold)
+	if res := <-inFlight; res.code != hooksdk.ExitDeny || !strings.Contains(res.out, "denied by rm -rf") {
+		t.Errorf("in-flight event: exit %d, %q; want the old rule", res.code, res.out)
+	}
+	if s := stderr.String(); s != "" {
+		t.Errorf("stderr = %q", s)
+	}
+	// Nothing changed since, so nothing is reloaded.
+	n := g.reloads.Load()
+	time.Sleep(2 * hooksdk.DefaultReloadInterval)
+	if g.reloads.Load() != n {
+		t.Errorf("reloaded %d times without a change", g.reloads.Load()-n)
+	}
+}
+
+func TestReloadFailureKeepsConfig(t *testing.T) {
+	g := newGuard(t, `"rm -rf"`)
+	var stderr syncBuffer
+	path := serve(t, g.handle, hooksdk.WithReload(g.reload, g.path), hooksdk.WithIO(hooksdk.IO{Err: &stderr}))
+	if code, _ := decide(path, "s", "ls"); code != hooksdk.ExitOK {
+		t.Fatalf("daemon not up: exit %d", code)
+	}
+
+	// A broken file is logged, and the daemon keeps the rules it had.
+	writeRules(t, g.path, `"unterminated`)
+	waitUntil(t, "the failed reload", func() bool { return strings.Contains(stderr.String(), `"stage":"reload"`) })
+	if s := stderr.String(); !strings.Contains(s, "keeping the previous config") || !strings.Contains(s, g.path) {
+		t.Errorf("stderr = %q", s)
+	}
+	if code, out := decide(path, "s", "rm -rf build"); code != hooksdk.ExitDeny {
+		t.Errorf("after a failed reload: exit %d, %q; want the old rule", code, out)
+	}
+
+	// Removing the file is a change too; fixing it then reloads.
+	n := g.reloads.Load()
+	if err := os.Remove(g.path); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, "the reload on removal", func() bool { return g.reloads.Load() > n })
+	writeRules(t, g.path, `"shutdown"`)
+	waitUntil(t, "the fixed rules", func() bool {
+		code, _ := decide(path, "s", "shutdown now")
+		return code == hooksdk.ExitDeny
+	})
+}
+
+func TestReloadPanicAndSerialCalls(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.toml"), filepath.Join(dir, "b.toml")
+	var stderr syncBuffer
+	var running, overlaps, calls atomic.Int32
+	slow := func() error {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		defer running.Add(-1)
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+	panics := func() error { panic("bad config") }
+	path := serve(t, allow,
+		hooksdk.WithReload(slow, a),
+		hooksdk.WithReload(slow, b),
+		hooksdk.WithReload(panics, b),
+		hooksdk.WithReload(nil, a), // ignored
+		hooksdk.WithIO(hooksdk.IO{Err: &stderr}))
+	if code, _ := decide(path, "s", "ls"); code != hooksdk.ExitOK {
+		t.Fatalf("daemon not up: exit %d", code)
+	}
+
+	// Both a and b appear: each of their reloads runs, one after the other, and a panic is logged
+	// like an error.
+	os.WriteFile(a, []byte("x"), 0o644)
+	os.WriteFile(b, []byte("x"), 0o644)
+	waitUntil(t, "both reloads", func() bool { return calls.Load() >= 2 && strings.Contains(stderr.String(), "panic: bad config") })
+	if overlaps.Load() != 0 {
+		t.Errorf("%d reloads overlapped", overlaps.Load())
+	}
+	if !strings.Contains(stderr.String(), "keeping the previous config") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+}
+
+func TestReloadOutsideServe(t *testing.T) {
+	// Elsewhere WithReload does nothing, and fn isn't called at startup.
+	called := false
+	stdio, out, _ := testIO(hooktest.SessionStart().Bytes(), nil)
+	code := stdio.Run(context.Background(), allow, hooksdk.WithReload(func() error {
+		called = true
+		return errors.New("no")
+	}, "/nonexistent"))
+	if code != hooksdk.ExitOK || called || !strings.Contains(out.String(), "allow") {
+		t.Errorf("Run with WithReload: exit %d, called %v, %q", code, called, out)
+	}
+}
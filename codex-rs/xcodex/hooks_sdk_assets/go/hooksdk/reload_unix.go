@@ -0,0 +1,13 @@
+//go:build unix
+
+package hooksdk
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func notifyHangup(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGHUP)
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package hooksdk_test
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	// Until the daemon's watcher is listening, the test keeps SIGHUP from ending the process.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	g := newGuard(t, `"rm -rf"`)
+	path := serve(t, g.handle, hooksdk.WithReload(g.reload, g.path))
+
+	// The file changes in a way polling can't see (same size, same time); SIGHUP reloads it at once.
+	fi, err := os.Stat(g.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(g.path, []byte("deny = \"reboot\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(g.path, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		if code, _ := decide(path, "s", "reboot"); code == hooksdk.ExitDeny {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("SIGHUP didn't reload the config")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if code, _ := decide(path, "s", "rm -rf build"); code != hooksdk.ExitOK {
+		t.Errorf("after SIGHUP, the old rule still applies: exit %d", code)
+	}
+}
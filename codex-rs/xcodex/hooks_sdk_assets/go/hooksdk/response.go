@@ -0,0 +1,365 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/invocation"
+)
+
+// Decision is the outcome a hook reports back to the host.
+type Decision string
+
+const (
+	DecisionAllow Decision = "allow"
+	DecisionDeny  Decision = "deny"
+	DecisionAsk   Decision = "ask"
+)
+
+// Response is the JSON object a hook writes to stdout to report its decision.
+//
+// Hosts that treat hooks as observers ignore stdout entirely, so writing a response is always
+// safe. Only `decision` is required; empty optional fields are omitted from the JSON.
+type Response struct {
+	Decision Decision `json:"decision"`
+	// Reason explains a deny decision (shown to the user and/or the agent).
+	Reason string `json:"reason,omitempty"`
+	// Prompt is the question to show the user for an ask decision.
+	Prompt string `json:"prompt,omitempty"`
+	// Question is a structured dialog for an ask decision, for hosts that can show one (see
+	// AskQuestion).
+	Question *Question `json:"question,omitempty"`
+	// SystemMessage is an optional note the host may surface alongside the decision.
+	SystemMessage string `json:"system_message,omitempty"`
+	// ReasonCode is an optional machine-readable identifier for the decision (e.g. `GUARD_RM_ROOT`),
+	// upper case (see ValidReasonCode). AddReason sets it to the first reason's code.
+	ReasonCode string `json:"reason_code,omitempty"`
+	// Reasons are structured reasons for the decision, for analytics and for agents that retry
+	// (see Deny and AddReason).
+	Reasons []Reason `json:"reasons,omitempty"`
+	// AdditionalContext is text for the agent to see before it continues, e.g. the output of a
+	// failed test run (see InjectContext).
+	AdditionalContext string `json:"additional_context,omitempty"`
+	// QueuedUserMessages are sent to the agent as user input once the current turn ends (see
+	// QueueUserMessage).
+	QueuedUserMessages []string `json:"queued_user_messages,omitempty"`
+	// Modify is a JSON merge patch for the host to apply to the payload before acting on it, e.g.
+	// a rewritten command (see ModifyPayload and ReplaceField).
+	Modify map[string]any `json:"modify,omitempty"`
+	// Telemetry are facts the hook worked out about the event, for the host to record with the
+	// session (see AddTelemetry and EmitTelemetry).
+	Telemetry []Telemetry `json:"telemetry,omitempty"`
+	// Metadata describes the hook that wrote the response. WriteResponse fills it in.
+	Metadata *ResponseMetadata `json:"metadata,omitempty"`
+
+	// modifyErr records an invalid ReplaceField path for CheckModify.
+	modifyErr error
+	// telemetryErr records the first record AddTelemetry left out, for CheckTelemetry.
+	telemetryErr error
+}
+
+// ResponseMetadata is the `metadata` of a response, for the host to log and to tell which SDK a
+// misbehaving hook was built with.
+type ResponseMetadata struct {
+	// SDKVersion is Version.
+	SDKVersion string `json:"sdk_version"`
+	// InvocationID is the id of the invocation the response answers (see
+	// HookPayload.InvocationID).
+	InvocationID string `json:"hook_invocation_id,omitempty"`
+	// Stages are the stages of a Pipeline that made the response, in the order they ran.
+	Stages []StageTiming `json:"stages,omitempty"`
+	// WouldHave is the response a hook in dry-run mode didn't write (see WithDryRun).
+	WouldHave *WouldHave `json:"would_have,omitempty"`
+}
+
+// withMetadata returns resp with its metadata filled in, for the invocation invocationID.
+func withMetadata(resp Response, invocationID string) Response {
+	var m ResponseMetadata
+	if resp.Metadata != nil {
+		m = *resp.Metadata
+	}
+	if m.SDKVersion == "" {
+		m.SDKVersion = Version()
+	}
+	if m.InvocationID == "" {
+		m.InvocationID = invocationID
+	}
+	resp.Metadata = &m
+	return resp
+}
+
+// Limits WriteResponse applies to the text a response feeds back to the agent, so a hook can't
+// flood the model's context: longer texts are truncated (see TruncateString), and queued
+// messages past MaxQueuedUserMessages are dropped, with a warning on stderr.
+const (
+	MaxAdditionalContextBytes = 16 << 10
+	MaxQueuedUserMessageBytes = 16 << 10
+	MaxQueuedUserMessages     = 4
+)
+
+// InjectContext returns r with text added to its AdditionalContext (on a new line if there
+// already was some), e.g. `hooksdk.Allow().InjectContext("tests failed:\n" + output)`. WriteResponse
+// drops it, with a warning, for hosts that don't support additional context (see
+// CapabilityAdditionalContext).
+func (r Response) InjectContext(text string) Response {
+	if r.AdditionalContext != "" {
+		text = r.AdditionalContext + "\n" + text
+	}
+	r.AdditionalContext = text
+	return r
+}
+
+// QueueUserMessage returns r with text queued as a user message for the agent after the current
+// turn. WriteResponse drops it, with a warning, for hosts that don't support queued messages (see
+// CapabilityQueuedUserMessages).
+func (r Response) QueueUserMessage(text string) Response {
+	r.QueuedUserMessages = append(r.QueuedUserMessages[:len(r.QueuedUserMessages):len(r.QueuedUserMessages)], text)
+	return r
+}
+
+// limitAgentText applies the limits above to resp, and removes control characters (other than
+// newlines and tabs) from the text meant for the agent, so it can't carry terminal escape
+// sequences into the host's UI. Duplicate Reasons, e.g. appended directly by two middlewares,
+// are merged as AddReason would.
+func limitAgentText(resp Response, stderr io.Writer) Response {
+	if len(resp.Reasons) > 1 {
+		merged := Response{ReasonCode: resp.ReasonCode}
+		for _, r := range resp.Reasons {
+			merged = merged.AddReason(r)
+		}
+		resp.Reasons = merged.Reasons
+	}
+	if resp.AdditionalContext != "" {
+		resp.AdditionalContext = TruncateString(stripControl(resp.AdditionalContext), MaxAdditionalContextBytes)
+	}
+	if n := len(resp.QueuedUserMessages); n > 0 {
+		if n > MaxQueuedUserMessages {
+			writeLogLine(stderr, "warn", "queued_user_messages",
+				fmt.Errorf("dropping %d of %d queued messages (limit %d)", n-MaxQueuedUserMessages, n, MaxQueuedUserMessages))
+			n = MaxQueuedUserMessages
+		}
+		msgs := make([]string, n)
+		for i := range msgs {
+			msgs[i] = TruncateString(stripControl(resp.QueuedUserMessages[i]), MaxQueuedUserMessageBytes)
+		}
+		resp.QueuedUserMessages = msgs
+	}
+	return resp
+}
+
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// Allow returns a response that lets the action proceed.
+func Allow() Response {
+	return Response{Decision: DecisionAllow}
+}
+
+// Deny returns a response that blocks the action with a human-readable reason. Options add a
+// structured Reason with that message (see AddReason):
+//
+//	hooksdk.Deny("dangerous command", hooksdk.WithReasonCode("GUARD_RM_ROOT"),
+//		hooksdk.WithRule("rm-root"), hooksdk.WithSeverity(hooksdk.SeverityCritical))
+func Deny(reason string, opts ...ReasonOption) Response {
+	r := Response{Decision: DecisionDeny, Reason: reason}
+	if len(opts) == 0 {
+		return r
+	}
+	structured := Reason{Message: reason}
+	for _, opt := range opts {
+		opt(&structured)
+	}
+	return r.AddReason(structured)
+}
+
+// Severity grades a Reason.
+type Severity string
+
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// Reason is one entry of a response's `reasons` array.
+type Reason struct {
+	// Code is a machine-readable identifier such as `GUARD_RM_ROOT` (see ValidReasonCode).
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Rule names what decided, e.g. a rule in a config file.
+	Rule     string   `json:"rule,omitempty"`
+	Severity Severity `json:"severity,omitempty"`
+	// DocsURL points to an explanation of the rule, or what to do instead.
+	DocsURL string `json:"docs_url,omitempty"`
+}
+
+// ReasonOption sets a field of the Reason that Deny adds.
+type ReasonOption func(*Reason)
+
+// WithReasonCode sets Reason.Code.
+func WithReasonCode(code string) ReasonOption { return func(r *Reason) { r.Code = code } }
+
+// WithRule sets Reason.Rule.
+func WithRule(rule string) ReasonOption { return func(r *Reason) { r.Rule = rule } }
+
+// WithSeverity sets Reason.Severity.
+func WithSeverity(s Severity) ReasonOption { return func(r *Reason) { r.Severity = s } }
+
+// WithDocsURL sets Reason.DocsURL.
+func WithDocsURL(url string) ReasonOption { return func(r *Reason) { r.DocsURL = url } }
+
+// reasonCodePattern is the form of reason codes: upper-case letters, digits, and underscores.
+var reasonCodePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// ValidReasonCode reports whether code has the form reason codes take, like `GUARD_RM_ROOT`:
+// an upper-case letter, then upper-case letters, digits, and underscores. Responses with other
+// codes fail ValidateResponse.
+func ValidReasonCode(code string) bool {
+	return reasonCodePattern.MatchString(code)
+}
+
+// AddReason returns r with reason appended to its Reasons, so middleware can add to what the
+// handler (or other middleware) said. A reason with the same code as one already there, or with
+// no code and the same message, is merged into it instead: fields the earlier one leaves empty are
+// taken from reason. ReasonCode is set to reason's code when it is still empty.
+func (r Response) AddReason(reason Reason) Response {
+	if r.ReasonCode == "" {
+		r.ReasonCode = reason.Code
+	}
+	reasons := append([]Reason(nil), r.Reasons...)
+	for i := range reasons {
+		existing := &reasons[i]
+		if !sameReason(*existing, reason) {
+			continue
+		}
+		fillEmpty(&existing.Message, reason.Message)
+		fillEmpty(&existing.Rule, reason.Rule)
+		fillEmpty(&existing.DocsURL, reason.DocsURL)
+		if existing.Severity == "" {
+			existing.Severity = reason.Severity
+		}
+		r.Reasons = reasons
+		return r
+	}
+	r.Reasons = append(reasons, reason)
+	return r
+}
+
+func sameReason(a, b Reason) bool {
+	if a.Code != "" || b.Code != "" {
+		return a.Code == b.Code
+	}
+	return a.Message == b.Message
+}
+
+func fillEmpty(dst *string, src string) {
+	if *dst == "" {
+		*dst = src
+	}
+}
+
+// Ask returns a response that asks the user to confirm the action.
+func Ask(prompt string) Response {
+	return Response{Decision: DecisionAsk, Prompt: prompt}
+}
+
+// WriteResponse writes resp to stdout as a single line of JSON, with Metadata set to the SDK's
+// version and the invocation id of the payload ReadPayload read.
+//
+// Telemetry emitted with EmitTelemetry for the host is added to resp, within the limits. Fields
+// the host doesn't support (see HostSupports) are taken out first, with a warning on stderr for
+// each: a modification turns the response into a deny with ReasonCapabilityMissing, a question
+// into its prompt, and telemetry is appended to TelemetryFile instead; additional context and
+// queued user messages are dropped.
+//
+// If the stdin envelope read by ReadPayload carried `output_path`, the response is written to that
+// file instead and stdout only gets a small acknowledgment (`{"decision":...,"output_path":...}`).
+// If the file can't be written, a warning goes to stderr and the full response is written to stdout
+// so it isn't lost. With WithIO, the streams of its IO stand in for stdout and stderr.
+//
+// resp is first checked with ValidateResponse against the event type of the payload ReadPayload
+// read (or CODEX_HOOK_EVENT). A response that doesn't match is reported on stderr and written
+// anyway; in debug mode (CODEX_HOOK_DEBUG) it isn't written and the error is returned.
+func WriteResponse(resp Response, opts ...Option) error {
+	outputPath, _ := stdinOutputPath.Load().(string)
+	o := newOptions(opts)
+	s := o.stdio
+	env := s.Environ()
+	eventType, _ := stdinEventType.Load().(string)
+	if eventType == "" {
+		eventType = env.EventType
+	}
+	resp = downgrade(resp, s.hostEnv(), s.err())
+	if o.dryRun || env.DryRun {
+		ids, _ := stdinEventIDs.Load().(eventIDs)
+		ids.eventType = eventType
+		resp = dryRun(env, s.err(), ids, invocation.Current(), resp)
+	}
+	return writeResponseOutput(s.out(), s.err(), outputPath, eventType, invocation.Current(), env.Debug, resp)
+}
+
+// WriteResponseTo writes resp to w as a single line of JSON, with the limits WriteResponse applies
+// (warnings go to stderr) but regardless of any `output_path`.
+func WriteResponseTo(w io.Writer, resp Response) error {
+	resp = downgrade(resp, IO{}.hostEnv(), os.Stderr)
+	return writeResponse(w, withMetadata(limitAgentText(withPendingTelemetry(resp, os.Stderr), os.Stderr), invocation.Current()))
+}
+
+// stdinOutputPath is the `output_path` from the envelope this process read on stdin, if any, and
+// stdinEventType the event type of its payload.
+var stdinOutputPath, stdinEventType atomic.Value
+
+// responseAck is written to stdout when the response itself went to output_path.
+type responseAck struct {
+	Decision   Decision `json:"decision"`
+	OutputPath string   `json:"output_path"`
+}
+
+// writeResponseOutput writes resp to stdout, or to outputPath with an acknowledgment on stdout.
+// A response that doesn't match the response schema of eventType is written with a warning, or,
+// when strict, returned as an error without writing anything.
+func writeResponseOutput(stdout, stderr io.Writer, outputPath, eventType, invocationID string, strict bool, resp Response) error {
+	resp = withMetadata(limitAgentText(withPendingTelemetry(resp, stderr), stderr), invocationID)
+	if err := ValidateResponse(eventType, resp); err != nil {
+		if strict {
+			return fmt.Errorf("%w (not written: debug mode is on)", err)
+		}
+		writeLogLine(stderr, "warn", "validate_response", err)
+	}
+	if outputPath == "" {
+		return writeResponse(stdout, resp)
+	}
+	if resp.Decision == "" {
+		resp.Decision = DecisionAllow
+	}
+
+	data, err := json.Marshal(resp)
+	if err == nil {
+		err = os.WriteFile(outputPath, append(data, '\n'), 0o600)
+	}
+	if err != nil {
+		writeLogLine(stderr, "warn", "write_output_path", err)
+		return writeResponse(stdout, resp)
+	}
+	return json.NewEncoder(stdout).Encode(responseAck{Decision: resp.Decision, OutputPath: outputPath})
+}
+
+func writeResponse(w io.Writer, resp Response) error {
+	if resp.Decision == "" {
+		resp.Decision = DecisionAllow
+	}
+	return json.NewEncoder(w).Encode(resp)
+}
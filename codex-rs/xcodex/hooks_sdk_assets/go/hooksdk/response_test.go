@@ -0,0 +1,267 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestResponseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		resp hooksdk.Response
+	}{
+		{"allow", hooksdk.Allow()},
+		{"deny", hooksdk.Deny("not today")},
+		{"deny with reason", hooksdk.Deny("rm -rf /", hooksdk.WithReasonCode("GUARD_RM_ROOT"),
+			hooksdk.WithRule("rm-root"), hooksdk.WithSeverity(hooksdk.SeverityCritical))},
+		{"ask", hooksdk.Ask("push to main?")},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := hooksdk.WriteResponseTo(&out, tt.resp); err != nil {
+			t.Errorf("%s: WriteResponseTo: %v", tt.name, err)
+			continue
+		}
+		if n := bytes.Count(out.Bytes(), []byte("\n")); n != 1 {
+			t.Errorf("%s: wrote %d lines, want 1: %s", tt.name, n, out.Bytes())
+		}
+		var got hooksdk.Response
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.Metadata == nil || got.Metadata.SDKVersion != hooksdk.Version() {
+			t.Errorf("%s: metadata = %+v, want the SDK version", tt.name, got.Metadata)
+		}
+		got.Metadata = nil
+		if !reflect.DeepEqual(got, tt.resp) {
+			t.Errorf("%s: round trip = %+v, want %+v", tt.name, got, tt.resp)
+		}
+	}
+}
+
+func TestResponseOmitsEmptyFields(t *testing.T) {
+	data, err := json.Marshal(hooksdk.Allow())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"decision":"allow"}` {
+		t.Errorf("Allow() = %s, want only the decision", data)
+	}
+
+	// A response with no decision is written as an allow.
+	var out bytes.Buffer
+	if err := hooksdk.WriteResponseTo(&out, hooksdk.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	var got hooksdk.Response
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Decision != hooksdk.DecisionAllow {
+		t.Errorf("decision = %q, want allow", got.Decision)
+	}
+}
+
+func TestAddReasonMerges(t *testing.T) {
+	resp := hooksdk.Deny("blocked", hooksdk.WithReasonCode("GUARD_RM_ROOT")).
+		AddReason(hooksdk.Reason{Code: "GUARD_RM_ROOT", Rule: "rm-root"}).
+		AddReason(hooksdk.Reason{Code: "GUARD_SUDO", Message: "sudo"})
+	if resp.ReasonCode != "GUARD_RM_ROOT" {
+		t.Errorf("ReasonCode = %q, want the first reason's code", resp.ReasonCode)
+	}
+	want := []hooksdk.Reason{
+		{Code: "GUARD_RM_ROOT", Message: "blocked", Rule: "rm-root"},
+		{Code: "GUARD_SUDO", Message: "sudo"},
+	}
+	if !reflect.DeepEqual(resp.Reasons, want) {
+		t.Errorf("Reasons = %+v, want %+v", resp.Reasons, want)
+	}
+}
+
+func TestDenyJSON(t *testing.T) {
+	resp := hooksdk.Deny("recursive delete of /", hooksdk.WithReasonCode("GUARD_RM_ROOT"), hooksdk.WithRule("rm-root"),
+		hooksdk.WithSeverity(hooksdk.SeverityCritical), hooksdk.WithDocsURL("https://example.com/rm-root"))
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"decision":"deny","reason":"recursive delete of /","reason_code":"GUARD_RM_ROOT","reasons":[` +
+		`{"code":"GUARD_RM_ROOT","message":"recursive delete of /","rule":"rm-root","severity":"critical","docs_url":"https://example.com/rm-root"}]}`
+	if string(data) != want {
+		t.Errorf("Deny = %s\nwant %s", data, want)
+	}
+}
+
+func TestWriteResponseMergesReasons(t *testing.T) {
+	// Two middlewares appending the same code directly, bypassing AddReason.
+	resp := hooksdk.Deny("blocked")
+	resp.Reasons = []hooksdk.Reason{
+		{Code: "NO_SUDO", Message: "blocked"},
+		{Code: "NO_SUDO", Rule: "sudo", Severity: hooksdk.SeverityHigh},
+		{Message: "also odd"},
+		{Message: "also odd", DocsURL: "https://example.com"},
+	}
+	var out bytes.Buffer
+	if err := hooksdk.WriteResponseTo(&out, resp); err != nil {
+		t.Fatal(err)
+	}
+	var got hooksdk.Response
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []hooksdk.Reason{
+		{Code: "NO_SUDO", Message: "blocked", Rule: "sudo", Severity: hooksdk.SeverityHigh},
+		{Message: "also odd", DocsURL: "https://example.com"},
+	}
+	if !reflect.DeepEqual(got.Reasons, want) {
+		t.Errorf("written reasons = %+v, want %+v", got.Reasons, want)
+	}
+	if resp.Reasons[1].Rule != "sudo" || len(resp.Reasons) != 4 {
+		t.Errorf("writing changed the caller's reasons: %+v", resp.Reasons)
+	}
+}
+
+func TestValidReasonCode(t *testing.T) {
+	for code, want := range map[string]bool{"GUARD_RM_ROOT": true, "E2": true, "guard": false, "_X": false, "": false} {
+		if got := hooksdk.ValidReasonCode(code); got != want {
+			t.Errorf("ValidReasonCode(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+// outputPathEnvelope returns an inline envelope for a session-start payload that asks for the
+// response at outputPath.
+func outputPathEnvelope(t *testing.T, outputPath string) []byte {
+	t.Helper()
+	stdin, err := json.Marshal(map[string]any{"payload": hooktest.SessionStart().Map(), "output_path": outputPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stdin
+}
+
+func denyLong(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+	return hooksdk.Deny(strings.Repeat("long reason ", 1000)), nil
+}
+
+func TestResponseToOutputPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "response.json")
+	res := hooktest.RunHook(t, denyLong, outputPathEnvelope(t, path))
+	if res.ExitCode != hooksdk.ExitDeny {
+		t.Errorf("exit code = %d, want %d", res.ExitCode, hooksdk.ExitDeny)
+	}
+	var ack map[string]any
+	if err := json.Unmarshal([]byte(res.Stdout), &ack); err != nil {
+		t.Fatal(err)
+	}
+	if len(ack) != 2 || ack["decision"] != "deny" || ack["output_path"] != path {
+		t.Errorf("stdout = %s, want only the acknowledgment", res.Stdout)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Decision != hooksdk.DecisionDeny || !strings.HasPrefix(resp.Reason, "long reason") {
+		t.Errorf("response file = %s", data)
+	}
+}
+
+func TestResponseWithoutOutputPath(t *testing.T) {
+	res := hooktest.RunHook(t, denyLong, hooktest.SessionStart().Bytes())
+	if !strings.HasPrefix(res.Response.Reason, "long reason") {
+		t.Errorf("stdout = %s, want the full response", res.Stdout)
+	}
+}
+
+func TestResponseUnwritableOutputPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "response.json")
+	res := hooktest.RunHook(t, denyLong, outputPathEnvelope(t, path))
+	if res.Response.Decision != hooksdk.DecisionDeny || !strings.HasPrefix(res.Response.Reason, "long reason") {
+		t.Errorf("stdout = %s, want the full response", res.Stdout)
+	}
+	if !strings.Contains(res.Stderr, "write_output_path") {
+		t.Errorf("stderr = %q, want a warning", res.Stderr)
+	}
+}
+
+func TestInjectContextAndQueueUserMessage(t *testing.T) {
+	resp := hooksdk.Allow().InjectContext("tests failed").InjectContext("FAIL pkg")
+	if resp.AdditionalContext != "tests failed\nFAIL pkg" {
+		t.Errorf("AdditionalContext = %q", resp.AdditionalContext)
+	}
+	// Responses are values: queuing on one doesn't change another built from the same base.
+	base := hooksdk.Allow().QueueUserMessage("a")
+	b, c := base.QueueUserMessage("b"), base.QueueUserMessage("c")
+	if !reflect.DeepEqual(base.QueuedUserMessages, []string{"a"}) || !reflect.DeepEqual(b.QueuedUserMessages, []string{"a", "b"}) ||
+		!reflect.DeepEqual(c.QueuedUserMessages, []string{"a", "c"}) {
+		t.Errorf("queued = %q, %q, %q", base.QueuedUserMessages, b.QueuedUserMessages, c.QueuedUserMessages)
+	}
+
+	data, err := json.Marshal(resp.QueueUserMessage("run the tests again"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"decision":"allow","additional_context":"tests failed\nFAIL pkg","queued_user_messages":["run the tests again"]}`; string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+}
+
+func TestAgentTextLimits(t *testing.T) {
+	t.Setenv(hooksdk.CapabilitiesEnv, hooksdk.CapabilityAdditionalContext+","+hooksdk.CapabilityQueuedUserMessages)
+	long := strings.Repeat("x", hooksdk.MaxAdditionalContextBytes+100)
+	handler := func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		resp := hooksdk.Allow().InjectContext("\x1b[31mred\x1b[0m\tand\r\nplain\x07" + long)
+		for i := 0; i < hooksdk.MaxQueuedUserMessages+2; i++ {
+			resp = resp.QueueUserMessage(strings.Repeat("m", hooksdk.MaxQueuedUserMessageBytes*2))
+		}
+		return resp, nil
+	}
+	res := hooktest.RunHook(t, handler, hooktest.ToolCallFinished().Bytes())
+	if res.ExitCode != 0 {
+		t.Fatalf("exit code %d: %s", res.ExitCode, res.Stderr)
+	}
+	ctx := res.Response.AdditionalContext
+	if !strings.HasPrefix(ctx, "[31mred[0m\tand\nplainxxx") || strings.ContainsAny(ctx, "\x1b\r\x07") {
+		t.Errorf("control characters kept: %.40q", ctx)
+	}
+	// Texts are cut at the limit and marked (see TruncateString).
+	stripped := "[31mred[0m\tand\nplain" + long
+	if want := hooksdk.TruncateString(stripped, hooksdk.MaxAdditionalContextBytes); ctx != want || !strings.Contains(ctx, "…[truncated ") {
+		t.Errorf("additional context = %d bytes ending %q, want %d bytes", len(ctx), ctx[len(ctx)-50:], len(want))
+	}
+	msgs := res.Response.QueuedUserMessages
+	if len(msgs) != hooksdk.MaxQueuedUserMessages {
+		t.Errorf("%d queued messages, want %d", len(msgs), hooksdk.MaxQueuedUserMessages)
+	}
+	for _, m := range msgs {
+		if want := hooksdk.TruncateString(strings.Repeat("m", hooksdk.MaxQueuedUserMessageBytes*2), hooksdk.MaxQueuedUserMessageBytes); m != want {
+			t.Errorf("queued message is %d bytes, want %d", len(m), len(want))
+		}
+	}
+	if !strings.Contains(res.Stderr, "dropping 2 of 6 queued messages (limit 4)") {
+		t.Errorf("no warning about dropped messages: %s", res.Stderr)
+	}
+
+	// Text within the limits is written as it is.
+	res = hooktest.RunHook(t, func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return hooksdk.Allow().InjectContext("ok ✓\n\tdone").QueueUserMessage("“quoted”"), nil
+	}, hooktest.ToolCallFinished().Bytes())
+	if res.Response.AdditionalContext != "ok ✓\n\tdone" || !reflect.DeepEqual(res.Response.QueuedUserMessages, []string{"“quoted”"}) || res.Stderr != "" {
+		t.Errorf("response = %+v, stderr %q", res.Response, res.Stderr)
+	}
+}
@@ -0,0 +1,214 @@
+// Package retry calls a function again after transient failures, with exponential backoff and
+// jitter, within limits on the attempts and the time spent, for hooks that talk to the network.
+//
+//	err := retry.Do(ctx, retry.Policy{MaxAttempts: 4, MaxElapsed: 5 * time.Second}, func() error {
+//		resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+//		if err != nil {
+//			return retry.Retryable(err) // connection errors are worth another try
+//		}
+//		resp.Body.Close()
+//		if resp.StatusCode >= 500 {
+//			return retry.Retryable(fmt.Errorf("server returned %d", resp.StatusCode))
+//		}
+//		return nil
+//	})
+//
+// Set Policy.Classify instead of wrapping errors to decide from the error itself, e.g. with
+// HTTPStatus.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// Backoff defaults, when the Policy leaves them zero.
+const (
+	DefaultInitialBackoff = 200 * time.Millisecond
+	DefaultMaxBackoff     = 2 * time.Second
+	DefaultMultiplier     = 2
+)
+
+// Policy says when and how often Do tries again. The zero Policy retries errors marked with
+// Retryable until ctx is done, from DefaultInitialBackoff doubling up to DefaultMaxBackoff, with
+// no jitter.
+type Policy struct {
+	// MaxAttempts bounds the calls, the first included; zero means no limit.
+	MaxAttempts int
+	// MaxElapsed bounds the time from the first call: Do gives up rather than wait past it. Zero
+	// means no limit besides ctx's deadline, which Do never waits past either.
+	MaxElapsed time.Duration
+	// InitialBackoff is the wait after the first failure, growing by Multiplier after each later
+	// one up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter spreads each wait at random by up to this fraction either way (0.2: ±20%), so hooks
+	// that failed together don't all retry together. It is clamped to [0, 1].
+	Jitter float64
+	// Classify reports whether an error is worth another call; nil means IsRetryable.
+	Classify func(error) bool
+	// OnRetry, if set, is called before each wait, with the attempt that failed (1 for the first
+	// call), its error, and the wait, e.g. to log the retry.
+	OnRetry func(attempt int, err error, wait time.Duration)
+
+	// Sleep waits d or until ctx is done, returning ctx.Err() then; nil means a timer. Tests set
+	// it, with Now, to run without waiting.
+	Sleep func(ctx context.Context, d time.Duration) error
+	// Now is the clock for MaxElapsed and ctx's deadline; nil means time.Now.
+	Now func() time.Time
+	// Rand returns a number in [0, 1) for Jitter; nil means math/rand.
+	Rand func() float64
+}
+
+// RetryableError marks an error as transient for IsRetryable. Make one with Retryable.
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string { return e.Err.Error() }
+
+func (e *RetryableError) Unwrap() error { return e.Err }
+
+// Retryable marks err as worth another call under the default classifier. It returns nil for a
+// nil err.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// IsRetryable reports whether err, or an error it wraps, was marked with Retryable.
+func IsRetryable(err error) bool {
+	var re *RetryableError
+	return errors.As(err, &re)
+}
+
+// HTTPStatus reports whether a response with status code is worth retrying: 408 (request
+// timeout), 429 (too many requests), and 5xx are; other codes, the 4xx in particular, won't
+// change on another try.
+func HTTPStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// GiveUpError is returned by Do when every attempt it could make failed with a retryable error.
+// It wraps the last error.
+type GiveUpError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *GiveUpError) Error() string {
+	return fmt.Sprintf("giving up after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *GiveUpError) Unwrap() error { return e.Err }
+
+// Do calls fn until it succeeds, fails with an error p doesn't retry, or p's limits or ctx's
+// deadline leave no time for another wait. A non-retryable error is returned as fn returned it
+// (without a Retryable mark); running out of attempts or time returns a *GiveUpError wrapping the
+// last error, and so does ctx being done during a wait.
+func Do(ctx context.Context, p Policy, fn func() error) error {
+	classify := p.Classify
+	if classify == nil {
+		classify = IsRetryable
+	}
+	now := p.Now
+	if now == nil {
+		now = time.Now
+	}
+	sleep := p.Sleep
+	if sleep == nil {
+		sleep = sleepTimer
+	}
+	start := now()
+	backoff := p.initialBackoff()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if !classify(err) {
+			return unmark(err)
+		}
+		if (p.MaxAttempts > 0 && attempt >= p.MaxAttempts) || ctx.Err() != nil {
+			return &GiveUpError{Attempts: attempt, Err: unmark(err)}
+		}
+		wait := p.jitter(backoff)
+		at := now().Add(wait)
+		if dl, ok := ctx.Deadline(); ok && at.After(dl) {
+			return &GiveUpError{Attempts: attempt, Err: unmark(err)}
+		}
+		if p.MaxElapsed > 0 && at.Sub(start) > p.MaxElapsed {
+			return &GiveUpError{Attempts: attempt, Err: unmark(err)}
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, wait)
+		}
+		if sleep(ctx, wait) != nil {
+			return &GiveUpError{Attempts: attempt, Err: unmark(err)}
+		}
+		backoff = p.next(backoff)
+	}
+}
+
+// unmark strips a top-level Retryable mark, which only matters to Do.
+func unmark(err error) error {
+	if re, ok := err.(*RetryableError); ok {
+		return re.Err
+	}
+	return err
+}
+
+func (p Policy) initialBackoff() time.Duration {
+	if p.InitialBackoff > 0 {
+		return p.InitialBackoff
+	}
+	return DefaultInitialBackoff
+}
+
+func (p Policy) next(d time.Duration) time.Duration {
+	m := p.Multiplier
+	if m < 1 {
+		m = DefaultMultiplier
+	}
+	max := p.MaxBackoff
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	if next := time.Duration(float64(d) * m); next < max {
+		return next
+	}
+	return max
+}
+
+func (p Policy) jitter(d time.Duration) time.Duration {
+	j := p.Jitter
+	if j <= 0 {
+		return d
+	}
+	if j > 1 {
+		j = 1
+	}
+	r := p.Rand
+	if r == nil {
+		r = rand.Float64
+	}
+	return time.Duration(float64(d) * (1 + j*(2*r()-1)))
+}
+
+func sleepTimer(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,235 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/retry"
+)
+
+// fakeClock is a Policy's Now and Sleep on a clock that only moves when Sleep is called.
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func newClock() *fakeClock {
+	return &fakeClock{now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) policy(p retry.Policy) retry.Policy {
+	p.Now = func() time.Time { return c.now }
+	p.Sleep = func(ctx context.Context, d time.Duration) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.waits = append(c.waits, d)
+		c.now = c.now.Add(d)
+		return nil
+	}
+	return p
+}
+
+// failing returns a function failing with err the first n calls, and counting them in calls.
+func failing(n int, err error, calls *int) func() error {
+	return func() error {
+		*calls++
+		if *calls <= n {
+			return err
+		}
+		return nil
+	}
+}
+
+var errBusy = errors.New("busy")
+
+func TestDoBackoff(t *testing.T) {
+	c := newClock()
+	calls := 0
+	err := retry.Do(context.Background(), c.policy(retry.Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}), failing(6, retry.Retryable(errBusy), &calls))
+	if err != nil || calls != 7 {
+		t.Fatalf("Do = %v after %d calls, want success on the 7th", err, calls)
+	}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i := range want {
+		want[i] *= time.Millisecond
+	}
+	if !reflect.DeepEqual(c.waits, want) {
+		t.Errorf("waits = %v, want %v", c.waits, want)
+	}
+
+	// The defaults: from 200ms, doubling, up to 2s.
+	c, calls = newClock(), 0
+	retry.Do(context.Background(), c.policy(retry.Policy{}), failing(5, retry.Retryable(errBusy), &calls))
+	if want := []time.Duration{200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, 1600 * time.Millisecond, 2 * time.Second}; !reflect.DeepEqual(c.waits, want) {
+		t.Errorf("default waits = %v, want %v", c.waits, want)
+	}
+
+	c, calls = newClock(), 0
+	retry.Do(context.Background(), c.policy(retry.Policy{InitialBackoff: time.Second, Multiplier: 3, MaxBackoff: time.Minute}), failing(3, retry.Retryable(errBusy), &calls))
+	if want := []time.Duration{time.Second, 3 * time.Second, 9 * time.Second}; !reflect.DeepEqual(c.waits, want) {
+		t.Errorf("waits with multiplier 3 = %v, want %v", c.waits, want)
+	}
+}
+
+func TestDoJitter(t *testing.T) {
+	for _, tt := range []struct {
+		jitter, rand float64
+		want         time.Duration
+	}{
+		{0.2, 0, 800 * time.Millisecond},
+		{0.2, 0.5, time.Second},
+		{0.2, 0.75, 1100 * time.Millisecond},
+		{0, 0, time.Second},
+		{-1, 0.9, time.Second},
+		// Clamped to 1.
+		{5, 0, 0},
+		{5, 0.75, 1500 * time.Millisecond},
+	} {
+		c := newClock()
+		calls := 0
+		p := c.policy(retry.Policy{InitialBackoff: time.Second, Jitter: tt.jitter, Rand: func() float64 { return tt.rand }})
+		retry.Do(context.Background(), p, failing(1, retry.Retryable(errBusy), &calls))
+		if len(c.waits) != 1 || c.waits[0] != tt.want {
+			t.Errorf("jitter %v, rand %v: waits %v, want [%v]", tt.jitter, tt.rand, c.waits, tt.want)
+		}
+	}
+}
+
+func TestDoClassify(t *testing.T) {
+	// By default only errors marked Retryable are retried, and they come back unmarked.
+	c, calls := newClock(), 0
+	err := retry.Do(context.Background(), c.policy(retry.Policy{}), failing(1, errBusy, &calls))
+	if err != errBusy || calls != 1 {
+		t.Errorf("unmarked error: Do = %v after %d calls, want it at once", err, calls)
+	}
+	c, calls = newClock(), 0
+	err = retry.Do(context.Background(), c.policy(retry.Policy{MaxAttempts: 2}), failing(5, retry.Retryable(errBusy), &calls))
+	var giveUp *retry.GiveUpError
+	if !errors.As(err, &giveUp) || giveUp.Attempts != 2 || giveUp.Err != errBusy || !errors.Is(err, errBusy) || retry.IsRetryable(giveUp.Err) {
+		t.Errorf("Do = %#v, want a GiveUpError after 2 attempts wrapping the unmarked error", err)
+	}
+	if err.Error() != "giving up after 2 attempts: busy" {
+		t.Errorf("Error() = %q", err)
+	}
+
+	// A classifier decides from the error: 4xx statuses fail at once, 429 and 5xx are retried.
+	for code, retried := range map[int]bool{400: false, 401: false, 404: false, 408: true, 429: true, 500: true, 503: true} {
+		calls := 0
+		status := statusErr(code)
+		p := newClock().policy(retry.Policy{MaxAttempts: 3, Classify: func(err error) bool {
+			var se *httpError
+			return errors.As(err, &se) && retry.HTTPStatus(se.code)
+		}})
+		err := retry.Do(context.Background(), p, failing(5, status, &calls))
+		if want := map[bool]int{false: 1, true: 3}[retried]; calls != want || !errors.Is(err, status) {
+			t.Errorf("status %d: Do = %v after %d calls, want %d", code, err, calls, want)
+		}
+	}
+
+	if retry.Retryable(nil) != nil {
+		t.Error("Retryable(nil) isn't nil")
+	}
+	if wrapped := errors.Join(errors.New("context"), retry.Retryable(errBusy)); !retry.IsRetryable(wrapped) {
+		t.Error("a wrapped Retryable isn't retryable")
+	}
+}
+
+type httpError struct{ code int }
+
+func (e *httpError) Error() string { return http.StatusText(e.code) }
+
+func statusErr(code int) error { return &httpError{code} }
+
+func TestDoMaxElapsed(t *testing.T) {
+	// Waits of 1s, 2s, 4s: a third wait would end 7s in, past the 5s limit.
+	c, calls := newClock(), 0
+	err := retry.Do(context.Background(), c.policy(retry.Policy{InitialBackoff: time.Second, MaxBackoff: time.Minute, MaxElapsed: 5 * time.Second}), failing(10, retry.Retryable(errBusy), &calls))
+	var giveUp *retry.GiveUpError
+	if !errors.As(err, &giveUp) || calls != 3 || giveUp.Attempts != 3 || len(c.waits) != 2 {
+		t.Errorf("Do = %v after %d calls and waits %v, want to give up after 3", err, calls, c.waits)
+	}
+
+	// The time fn itself takes counts too.
+	c, calls = newClock(), 0
+	slow := func() error {
+		calls++
+		c.now = c.now.Add(3 * time.Second)
+		return retry.Retryable(errBusy)
+	}
+	retry.Do(context.Background(), c.policy(retry.Policy{InitialBackoff: time.Second, MaxElapsed: 5 * time.Second}), slow)
+	// The first wait ends 4s in; the second call ends at 7s, and leaves none.
+	if calls != 2 {
+		t.Errorf("slow calls: %d, want 2", calls)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	// A wait past ctx's deadline isn't started. The clock starts at the real time, which ctx
+	// checks its deadline against.
+	c, calls := &fakeClock{now: time.Now()}, 0
+	ctx, cancel := context.WithDeadline(context.Background(), c.now.Add(5*time.Second))
+	defer cancel()
+	err := retry.Do(ctx, c.policy(retry.Policy{InitialBackoff: 2 * time.Second, MaxBackoff: time.Minute}), failing(10, retry.Retryable(errBusy), &calls))
+	var giveUp *retry.GiveUpError
+	if !errors.As(err, &giveUp) || calls != 2 || !reflect.DeepEqual(c.waits, []time.Duration{2 * time.Second}) {
+		t.Errorf("Do = %v after %d calls and waits %v, want to stop before a wait past the deadline", err, calls, c.waits)
+	}
+
+	// A cancelled ctx stops retrying after the attempt that saw it.
+	ctx, cancel = context.WithCancel(context.Background())
+	calls = 0
+	err = retry.Do(ctx, newClock().policy(retry.Policy{}), func() error {
+		calls++
+		cancel()
+		return retry.Retryable(errBusy)
+	})
+	if !errors.As(err, &giveUp) || calls != 1 {
+		t.Errorf("cancelled: Do = %v after %d calls", err, calls)
+	}
+
+	// The real timer returns when ctx is done.
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	calls = 0
+	err = retry.Do(ctx, retry.Policy{InitialBackoff: 40 * time.Millisecond, MaxBackoff: 40 * time.Millisecond}, failing(100, retry.Retryable(errBusy), &calls))
+	if !errors.As(err, &giveUp) || time.Since(start) > time.Second {
+		t.Errorf("timer: Do = %v after %v", err, time.Since(start))
+	}
+}
+
+func TestDoOnRetry(t *testing.T) {
+	type retried struct {
+		attempt int
+		err     error
+		wait    time.Duration
+	}
+	var got []retried
+	c, calls := newClock(), 0
+	errs := []error{retry.Retryable(errors.New("first")), retry.Retryable(errors.New("second"))}
+	p := c.policy(retry.Policy{InitialBackoff: time.Second, MaxAttempts: 3, OnRetry: func(attempt int, err error, wait time.Duration) {
+		got = append(got, retried{attempt, err, wait})
+	}})
+	retry.Do(context.Background(), p, func() error {
+		calls++
+		return errs[min(calls, 2)-1]
+	})
+	// Called before each wait, not after the last attempt.
+	if len(got) != 2 || got[0].attempt != 1 || got[0].err.Error() != "first" || got[0].wait != time.Second ||
+		got[1].attempt != 2 || got[1].err.Error() != "second" || got[1].wait != 2*time.Second {
+		t.Errorf("OnRetry calls = %+v", got)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	for code, want := range map[int]bool{200: false, 400: false, 403: false, 404: false, 408: true, 409: false, 429: true, 500: true, 502: true, 503: true, 504: true} {
+		if got := retry.HTTPStatus(code); got != want {
+			t.Errorf("HTTPStatus(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
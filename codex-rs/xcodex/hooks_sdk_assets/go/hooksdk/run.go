@@ -0,0 +1,201 @@
+package hooksdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/invocation"
+)
+
+// Exit codes used by Run.
+//
+// The host only needs the response on stdout, but a distinct exit status makes it possible to tell
+// a deny apart from a crashed hook when reading logs (or when the host ignores stdout).
+const (
+	// ExitOK means the handler ran and allowed the action (or asked the user).
+	ExitOK = 0
+	// ExitError means the SDK or the handler failed; no decision was made by the hook.
+	ExitError = 1
+	// ExitDeny means the handler ran and denied the action.
+	ExitDeny = 2
+)
+
+// Handler is the signature of a hook's main logic. ctx is cancelled when the host asks the hook to
+// stop (SIGTERM/SIGINT), so long-running work should honor it.
+type Handler func(ctx context.Context, p *HookPayload) (Response, error)
+
+// Run reads the payload, invokes handler, writes its response to stdout, and exits the process.
+//
+// Errors never panic: they are reported as a single JSON line on stderr (for example
+// `{"level":"error","stage":"handler","error":"..."}`) and the process exits with ExitError.
+// Otherwise the exit code is derived from the response decision (ExitDeny for deny, ExitOK for
+// allow/ask). A response whose Modify section the event type doesn't permit (see CheckModify)
+// is an error too. An envelope that requires a newer SDK (ErrSDKTooOld) also gets an allow
+// response saying so.
+//
+// A panic in handler is recovered and logged to stderr with its stack trace, and the panic
+// response (Allow unless set with WithPanicDecision or WithErrorPolicy) is written instead, with
+// the exit code that response maps to. Panics in goroutines started by the handler can't be
+// recovered.
+//
+// WithErrorPolicy answers errors with an allow or a deny response instead of ExitError.
+//
+// opts configure how the payload is read, as for ReadPayload; with WithIO, Run uses its streams
+// but still exits the process (IO.Run returns the code instead).
+func Run(handler Handler, opts ...Option) {
+	ctx, stop := SignalContext()
+	s := newOptions(opts).stdio
+	code := RunIO(ctx, s.in(), s.out(), s.err(), handler, opts...)
+	stop()
+	os.Exit(code)
+}
+
+// RunIO is like Run, but uses the given stdio streams and returns the exit code instead of exiting.
+// It is mainly useful for driving a hook in-process from tests (see the hooktest package).
+func RunIO(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, handler Handler, opts ...Option) int {
+	// Like a payload file named as the first argument, --self-test only counts for the process's
+	// own stdin.
+	if stdin == io.Reader(os.Stdin) && SelfTestRequested() {
+		return newOptions(opts).runSelfTest(ctx, stdout)
+	}
+	o := newOptions(opts)
+	in := stdin
+	if in == nil {
+		in = o.stdio.in()
+	}
+	full, env, err := o.readPayloadBytes(ctx, in)
+	if err == nil && len(o.skips) > 0 {
+		// A payload peek can't read is parsed in full below, which reports the error.
+		if t, perr := peekEventType(full, env.parseOptions(opts)); perr == nil {
+			if resp, skip := o.skip(t); skip {
+				o.capture.finish(nil, nil)
+				return finishRun(stdout, stderr, env, string(t), o, resp)
+			}
+		}
+	}
+	var payload *HookPayload
+	if err == nil {
+		if payload, err = o.parsePayload(full, env, in, opts); err == nil {
+			env.event = eventIDs{sessionID: payload.SessionID(), eventID: payload.EventId}
+		}
+	}
+	if err != nil {
+		if o.errorPolicy != 0 {
+			return o.fail(stdout, stderr, env, "", "read_payload", err)
+		}
+		writeErrorLine(stderr, "read_payload", err)
+		if errors.Is(err, ErrSDKTooOld) {
+			// The hook can't judge an event it may not understand, but the host can still show
+			// the user why it didn't.
+			resp := Allow()
+			resp.SystemMessage = hooklog.HookName() + ": " + err.Error()
+			resp.ReasonCode = "SDK_TOO_OLD"
+			_ = writeResponseOutput(stdout, stderr, env.outputPath, "", env.invocationID, false, resp)
+		}
+		return ExitError
+	}
+	if stdin == io.Reader(os.Stdin) && stdout == io.Writer(os.Stdout) {
+		// Only a hook that owns the process's stdio can hand the rest of its work off (see Detach).
+		currentRun.Store(&runState{payload: payload, outputPath: env.outputPath})
+		defer currentRun.Store(nil)
+	}
+
+	call := callHandler
+	if o.hasTimeout {
+		call = callHandlerTimeout
+	}
+	resp, err := call(invocation.WithID(ctx, payload.InvocationID()), stderr, handler, payload, o)
+	if err != nil {
+		return o.fail(stdout, stderr, env, payload.EventType(), "handler", err)
+	}
+	return finishRun(stdout, stderr, env, payload.EventType(), o, resp)
+}
+
+// finishRun checks resp and writes it as the response to an event of eventType, returning the
+// exit code.
+func finishRun(stdout, stderr io.Writer, env envelope, eventType string, o *options, resp Response) int {
+	if err := resp.CheckModify(EventType(eventType)); err != nil {
+		return o.fail(stdout, stderr, env, eventType, "modify", err)
+	}
+	if err := resp.CheckTelemetry(); err != nil {
+		writeLogLine(stderr, "warn", "telemetry", err)
+	}
+	if err := resp.CheckQuestion(); err != nil {
+		writeLogLine(stderr, "warn", "question", err)
+	}
+
+	e := o.stdio.Environ()
+	resp = downgrade(resp, env.capabilities.withCapabilities(e), stderr)
+	if o.dryRun || e.DryRun {
+		ids := env.event
+		ids.eventType = eventType
+		resp = dryRun(e, stderr, ids, env.invocationID, resp)
+	}
+	if err := writeResponseOutput(stdout, stderr, env.outputPath, eventType, env.invocationID, e.Debug, resp); err != nil {
+		writeErrorLine(stderr, "write_response", err)
+		return ExitError
+	}
+	return exitCodeFor(resp)
+}
+
+// callHandler runs handler, converting a panic into the configured panic response.
+func callHandler(ctx context.Context, stderr io.Writer, handler Handler, p *HookPayload, o *options) (resp Response, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger := hooklog.New(stderr)
+			logger.Bind(p)
+			fields := map[string]any{
+				"stage": "handler",
+				"panic": fmt.Sprint(r),
+				"stack": string(debug.Stack()),
+			}
+			resp, err = o.panicResponse, nil
+			if !o.hasPanicResponse && o.errorPolicy != 0 {
+				fields["policy"] = o.errorPolicy.String()
+				resp = o.policyResponse(fmt.Errorf("handler panicked: %v", r))
+			}
+			logger.Log(hooklog.LevelError, "handler panicked", fields)
+		}
+	}()
+	return handler(ctx, p)
+}
+
+func exitCodeFor(resp Response) int {
+	if resp.Decision == DecisionDeny {
+		return ExitDeny
+	}
+	return ExitOK
+}
+
+func writeErrorLine(w io.Writer, stage string, err error) {
+	writeLogLine(w, "error", stage, err)
+}
+
+// writeLogLine writes a structured stderr line for err, with the failures of a *MultiError in it
+// listed under "failures".
+func writeLogLine(w io.Writer, level, stage string, err error) {
+	writeLine(w, logLine(level, stage, err))
+}
+
+func logLine(level, stage string, err error) map[string]any {
+	line := map[string]any{
+		"level": level,
+		"stage": stage,
+		"error": err.Error(),
+	}
+	var multi *MultiError
+	if errors.As(err, &multi) {
+		line["failures"] = multi.failures()
+	}
+	return line
+}
+
+func writeLine(w io.Writer, line map[string]any) {
+	_ = json.NewEncoder(w).Encode(line)
+}
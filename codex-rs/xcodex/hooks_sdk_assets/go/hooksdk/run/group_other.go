@@ -0,0 +1,22 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package run
+
+import "os/exec"
+
+func setGroup(cmd *exec.Cmd) {}
+
+// group is the started program alone, where processes can't be grouped.
+type group struct {
+	cmd *exec.Cmd
+}
+
+func attachGroup(cmd *exec.Cmd) *group {
+	return &group{cmd: cmd}
+}
+
+func (g *group) kill() {
+	g.cmd.Process.Kill()
+}
+
+func (g *group) close() {}
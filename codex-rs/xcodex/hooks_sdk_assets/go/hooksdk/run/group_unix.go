@@ -0,0 +1,30 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package run
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setGroup starts the program as the leader of a new process group, which the processes it
+// starts join.
+func setGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// group is the process group of a started program.
+type group struct {
+	pid int
+}
+
+func attachGroup(cmd *exec.Cmd) *group {
+	return &group{pid: cmd.Process.Pid}
+}
+
+// kill kills every process in the group.
+func (g *group) kill() {
+	syscall.Kill(-g.pid, syscall.SIGKILL)
+}
+
+func (g *group) close() {}
@@ -0,0 +1,67 @@
+//go:build windows
+
+package run
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+)
+
+const (
+	processTerminate = 0x0001
+	processSetQuota  = 0x0100
+)
+
+// setGroup does nothing on Windows: the program is put in a job object once it has started.
+func setGroup(cmd *exec.Cmd) {}
+
+// group is the job object of a started program, which the processes it starts inherit. It is
+// assigned just after the program starts, so processes the program starts before that aren't in
+// it. job is 0 when the job object couldn't be made, and kill kills the program alone.
+type group struct {
+	cmd *exec.Cmd
+	job syscall.Handle
+}
+
+func attachGroup(cmd *exec.Cmd) *group {
+	g := &group{cmd: cmd}
+	job, _, _ := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		return g
+	}
+	process, err := syscall.OpenProcess(processTerminate|processSetQuota, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		syscall.CloseHandle(syscall.Handle(job))
+		return g
+	}
+	defer syscall.CloseHandle(process)
+	if r, _, _ := procAssignProcessToJobObject.Call(job, uintptr(process)); r == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		return g
+	}
+	g.job = syscall.Handle(job)
+	return g
+}
+
+// kill terminates every process in the job.
+func (g *group) kill() {
+	if g.job == 0 {
+		g.cmd.Process.Kill()
+		return
+	}
+	procTerminateJobObject.Call(uintptr(g.job), 1)
+}
+
+// close releases the job object. Processes still in it keep running.
+func (g *group) close() {
+	if g.job != 0 {
+		syscall.CloseHandle(g.job)
+	}
+}
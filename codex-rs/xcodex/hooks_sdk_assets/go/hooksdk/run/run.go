@@ -0,0 +1,277 @@
+// Package run starts the programs a hook shells out to (formatters, git, test runners) the way
+// they should be started from a hook: in the session's directory, with a scrubbed environment,
+// within a deadline, with bounded output, and killed along with every process they started when
+// the deadline passes.
+//
+//	cmd := run.Command(ctx, "gofmt", "-l", ".")
+//	cmd.Payload = payload
+//	res, err := cmd.Run()
+//
+// The environment starts empty and gets only the variables of the hook's that DefaultAllow (or
+// Cmd.Allow) names, never a CODEX_* one, so the agent's API keys, proxy settings, and the
+// payload's envelope variables don't leak to the program; Cmd.Env adds variables of its own.
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// DefaultTimeout bounds a command whose Timeout is 0. The context given to Command can only
+// shorten it.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxOutput is how much of each of stdout and stderr is kept when MaxOutput is 0.
+const DefaultMaxOutput = 1 << 20
+
+// waitDelay is how long Run waits, after the program exits or is killed, for the processes it
+// left behind to close its output.
+const waitDelay = time.Second
+
+// DefaultAllow is the allowlist of a Cmd whose Allow is nil: what programs need to find
+// themselves, their caches, and the user's locale, and nothing that carries credentials or proxy
+// settings. A name ending in `*` is a prefix.
+var DefaultAllow = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TZ", "LANG", "LC_*",
+	"TMPDIR", "TMP", "TEMP", "XDG_*",
+	"GOPATH", "GOROOT", "GOCACHE", "GOMODCACHE", "GOBIN", "CARGO_HOME", "RUSTUP_HOME", "NVM_DIR",
+	// Windows can't start most programs without these.
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "PATHEXT", "USERPROFILE", "HOMEDRIVE",
+	"HOMEPATH", "APPDATA", "LOCALAPPDATA", "PROGRAMDATA", "PROGRAMFILES", "PROGRAMFILES(X86)",
+	"NUMBER_OF_PROCESSORS", "PROCESSOR_ARCHITECTURE", "OS",
+}
+
+// Cmd is a program to run. Make one with Command and set its fields before calling Run.
+type Cmd struct {
+	// Name is the program, looked up in PATH when it has no directory; Args follow it.
+	Name string
+	Args []string
+	// Dir is the working directory; empty means the Payload's Cwd(), or the hook's own when there
+	// is no payload or its directory doesn't exist.
+	Dir string
+	// Payload is the event being handled, for Dir.
+	Payload *hooksdk.HookPayload
+	// Allow names the variables of the hook's environment the program gets; nil means
+	// DefaultAllow. A name ending in `*` is a prefix, so `*` alone passes everything but CODEX_*.
+	// Names are case-insensitive on Windows.
+	Allow []string
+	// Env holds `KEY=value` variables added after the allowed ones, so they override them. They
+	// may be CODEX_* ones.
+	Env []string
+	// Stdin is the program's input; nil means none (the null device), never the hook's stdin.
+	Stdin io.Reader
+	// Timeout bounds the program; 0 means DefaultTimeout.
+	Timeout time.Duration
+	// MaxOutput is how much of each of stdout and stderr is kept; 0 means DefaultMaxOutput. The
+	// rest is read and dropped, so the program never blocks on a full pipe.
+	MaxOutput int
+	// Tail keeps the last MaxOutput bytes instead of the first, as a test run's summary comes last.
+	Tail bool
+	// MergeStderr captures stderr with stdout, interleaved as written, in Result.Stdout.
+	MergeStderr bool
+
+	ctx context.Context
+}
+
+// Command returns a Cmd running name with args, killed once ctx is done.
+func Command(ctx context.Context, name string, args ...string) *Cmd {
+	return &Cmd{Name: name, Args: args, ctx: ctx}
+}
+
+// Result is what a command did. Run returns it even when the command fails.
+type Result struct {
+	// ExitCode is the exit status, or -1 when the program didn't start or was killed.
+	ExitCode int
+	// Stdout and Stderr are the output kept (see Cmd.MaxOutput); StdoutTruncated and
+	// StderrTruncated are set when some was dropped.
+	Stdout          []byte
+	Stderr          []byte
+	StdoutTruncated bool
+	StderrTruncated bool
+	// Duration is how long the program ran.
+	Duration time.Duration
+	// TimedOut is set when the program was killed at its Timeout (or the context's deadline).
+	TimedOut bool
+}
+
+// Run runs the command and waits for it. The error is nil when the program exits with status 0,
+// an *exec.ExitError when it exits with another, the context's error (wrapped) when it was killed
+// because the context was done or the Timeout passed, and the error from starting it otherwise.
+//
+// When the program is killed, so is every process it started: they share a process group (a job
+// object on Windows) of their own. This also means the host killing the hook's own process group
+// doesn't reach them, so a hook should run with hooksdk.SignalContext (Run does) for its context to
+// be done at the host's timeout.
+func (c *Cmd) Run() (*Result, error) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	maxOutput := c.MaxOutput
+	if maxOutput <= 0 {
+		maxOutput = DefaultMaxOutput
+	}
+	stdout := &capture{max: maxOutput, tail: c.Tail}
+	stderr := stdout
+	if !c.MergeStderr {
+		stderr = &capture{max: maxOutput, tail: c.Tail}
+	}
+
+	cmd := exec.Command(c.Name, c.Args...)
+	cmd.Dir = c.dir()
+	cmd.Env = append(scrub(os.Environ(), c.allow()), c.Env...)
+	cmd.Stdin = c.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = waitDelay
+	setGroup(cmd)
+
+	res := &Result{ExitCode: -1}
+	if err := ctx.Err(); err != nil {
+		return res, fmt.Errorf("%s: %w", c.Name, err)
+	}
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return res, err
+	}
+	g := attachGroup(cmd)
+	defer g.close()
+	exited, watched := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-ctx.Done():
+			g.kill()
+		case <-exited:
+		}
+	}()
+	err := cmd.Wait()
+	close(exited)
+	<-watched
+	res.Duration = time.Since(start)
+
+	res.Stdout, res.StdoutTruncated = stdout.bytes()
+	if !c.MergeStderr {
+		res.Stderr, res.StderrTruncated = stderr.bytes()
+	}
+	if err != nil && ctx.Err() != nil {
+		res.TimedOut = ctx.Err() == context.DeadlineExceeded
+		return res, fmt.Errorf("%s: %w", c.Name, ctx.Err())
+	}
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// The program exited, but something it started held its output open past waitDelay.
+		err = nil
+	}
+	return res, err
+}
+
+// dir returns the working directory (see Cmd.Dir).
+func (c *Cmd) dir() string {
+	if c.Dir != "" || c.Payload == nil {
+		return c.Dir
+	}
+	if dir := c.Payload.WorkingDir(); dir != "" {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+func (c *Cmd) allow() []string {
+	if c.Allow == nil {
+		return DefaultAllow
+	}
+	return c.Allow
+}
+
+// scrub returns the `KEY=value` entries of environ whose key allow names, leaving out CODEX_*.
+func scrub(environ, allow []string) []string {
+	out := []string{}
+	for _, kv := range environ {
+		key, _, ok := strings.Cut(kv, "=")
+		// Windows has entries like `=C:=C:\`, for the drive's directory.
+		if !ok || key == "" {
+			continue
+		}
+		if hasPrefix(key, "CODEX_") {
+			continue
+		}
+		for _, name := range allow {
+			prefix, isPrefix := strings.CutSuffix(name, "*")
+			if isPrefix && hasPrefix(key, prefix) || !isPrefix && equal(key, name) {
+				out = append(out, kv)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// equal and hasPrefix compare variable names as the OS does: case-insensitively on Windows.
+func equal(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func hasPrefix(s, prefix string) bool {
+	return len(s) >= len(prefix) && equal(s[:len(prefix)], prefix)
+}
+
+// capture keeps at most max bytes of what is written to it: the first ones, or with tail the last
+// ones.
+type capture struct {
+	max       int
+	tail      bool
+	buf       []byte
+	truncated bool
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	n := len(p)
+	if !c.tail {
+		if room := c.max - len(c.buf); len(p) > room {
+			p = p[:room]
+			c.truncated = true
+		}
+		c.buf = append(c.buf, p...)
+		return n, nil
+	}
+	c.buf = append(c.buf, p...)
+	if len(c.buf) > c.max {
+		c.truncated = true
+		// Dropping the start only once it is as long as what is kept copies each byte once.
+		if len(c.buf) >= 2*c.max {
+			c.buf = append(c.buf[:0], c.buf[len(c.buf)-c.max:]...)
+		}
+	}
+	return n, nil
+}
+
+func (c *capture) bytes() ([]byte, bool) {
+	if len(c.buf) > c.max {
+		return c.buf[len(c.buf)-c.max:], c.truncated
+	}
+	return c.buf, c.truncated
+}
@@ -0,0 +1,306 @@
+package run_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/run"
+)
+
+// modeEnv makes the test binary a program for Cmd to run: what it does is in the variable's value.
+// It is passed with Cmd.Env, as the scrubbed environment would drop anything else.
+const modeEnv = "RUN_TEST_MODE"
+
+// TestMain runs the program a test asked for when modeEnv is set.
+func TestMain(m *testing.M) {
+	mode, arg, _ := strings.Cut(os.Getenv(modeEnv), ":")
+	switch mode {
+	case "":
+		os.Exit(m.Run())
+	case "env":
+		env := os.Environ()
+		sort.Strings(env)
+		fmt.Println(strings.Join(env, "\n"))
+	case "pwd":
+		dir, _ := os.Getwd()
+		fmt.Print(dir)
+	case "cat":
+		io.Copy(os.Stdout, os.Stdin)
+	case "output":
+		// arg bytes of a counting pattern to stdout, and to stderr in capitals.
+		n, _ := strconv.Atoi(arg)
+		for i := 0; i < n; i += 10 {
+			line := fmt.Sprintf("%09d\n", i)
+			os.Stdout.WriteString(line)
+			os.Stderr.WriteString(strings.ToUpper("e" + line[1:]))
+		}
+	case "exit":
+		code, _ := strconv.Atoi(arg)
+		fmt.Print("bye")
+		os.Exit(code)
+	case "hang":
+		time.Sleep(time.Minute)
+	case "spawn", "background":
+		// A child ticking in the file arg, then hang, or with background exit at once, leaving the
+		// child holding stdout open.
+		exe, _ := os.Executable()
+		child := exec.Command(exe, "-test.run=^$")
+		child.Env = []string{modeEnv + "=tick:" + arg}
+		child.Stdout = os.Stdout
+		if err := child.Start(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if mode == "spawn" {
+			time.Sleep(time.Minute)
+		}
+	case "tick":
+		// Its pid, then a byte every 10ms for 10s, so a test sees whether it is still running.
+		f, err := os.OpenFile(arg, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			os.Exit(2)
+		}
+		fmt.Fprintf(f, "%d\n", os.Getpid())
+		for i := 0; i < 1000; i++ {
+			f.WriteString(".")
+			time.Sleep(10 * time.Millisecond)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown %s %q\n", modeEnv, mode)
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+// self is a Cmd running the test binary in mode.
+func self(t *testing.T, ctx context.Context, mode string) *run.Cmd {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := run.Command(ctx, exe, "-test.run=^$")
+	cmd.Env = []string{modeEnv + "=" + mode}
+	return cmd
+}
+
+func TestEnvironmentScrubbed(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("LC_TIME", "C")
+	t.Setenv("OPENAI_API_KEY", "sk-secret")
+	t.Setenv("HTTPS_PROXY", "http://proxy:3128")
+	t.Setenv("CODEX_HOOK_PAYLOAD_PATH", "/tmp/payload.json")
+	t.Setenv("CODEX_HOME", "/home/me/.codex")
+	t.Setenv("XDG_CONFIG_HOME", "/home/me/.config")
+	env := func(cmd *run.Cmd) map[string]string {
+		t.Helper()
+		res, err := cmd.Run()
+		if err != nil {
+			t.Fatalf("%v: %s", err, res.Stderr)
+		}
+		vars := map[string]string{}
+		for _, kv := range strings.Split(strings.TrimSpace(string(res.Stdout)), "\n") {
+			key, value, _ := strings.Cut(kv, "=")
+			vars[key] = value
+		}
+		return vars
+	}
+
+	// The default allowlist passes what programs need, and nothing with credentials in it.
+	vars := env(self(t, context.Background(), "env"))
+	for _, key := range []string{"HOME", "LC_TIME", "XDG_CONFIG_HOME", "PATH"} {
+		if _, ok := vars[key]; !ok && (key != "PATH" || os.Getenv("PATH") != "") {
+			t.Errorf("%s wasn't passed: %v", key, vars)
+		}
+	}
+	for key := range vars {
+		if key == "OPENAI_API_KEY" || key == "HTTPS_PROXY" || strings.HasPrefix(key, "CODEX_") {
+			t.Errorf("%s was passed", key)
+		}
+	}
+
+	// Allow replaces the list, and `*` passes everything but CODEX_*. Env comes last and may set
+	// anything.
+	cmd := self(t, context.Background(), "env")
+	cmd.Allow = []string{"OPENAI_*"}
+	cmd.Env = append(cmd.Env, "CODEX_HOOK_NAME=sub", "OPENAI_API_KEY=override")
+	vars = env(cmd)
+	if vars["OPENAI_API_KEY"] != "override" || vars["CODEX_HOOK_NAME"] != "sub" || vars["HOME"] != "" {
+		t.Errorf("Allow OPENAI_*: %v", vars)
+	}
+	if got := strings.Count(fmt.Sprint(cmd.Env), "OPENAI_API_KEY"); got != 1 {
+		t.Errorf("Env changed: %q", cmd.Env)
+	}
+	cmd = self(t, context.Background(), "env")
+	cmd.Allow = []string{"*"}
+	vars = env(cmd)
+	if vars["HTTPS_PROXY"] == "" || vars["CODEX_HOME"] != "" {
+		t.Errorf("Allow *: %v", vars)
+	}
+	if runtime.GOOS == "windows" {
+		cmd = self(t, context.Background(), "env")
+		cmd.Allow = []string{"openai_api_key"}
+		if vars = env(cmd); vars["OPENAI_API_KEY"] == "" {
+			t.Errorf("names aren't case-insensitive: %v", vars)
+		}
+	}
+}
+
+func TestWorkingDirectory(t *testing.T) {
+	pwd := func(cmd *run.Cmd) string {
+		t.Helper()
+		res, err := cmd.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir, _ := filepath.EvalSymlinks(string(res.Stdout))
+		return dir
+	}
+	real := func(dir string) string {
+		dir, _ = filepath.EvalSymlinks(dir)
+		return dir
+	}
+	own, _ := os.Getwd()
+	session, other := t.TempDir(), t.TempDir()
+
+	// The payload's directory, unless Dir is set; the hook's own when it is gone.
+	cmd := self(t, context.Background(), "pwd")
+	cmd.Payload = hooktest.SessionStart().WithCwd(session).Build()
+	if got := pwd(cmd); got != real(session) {
+		t.Errorf("payload cwd: ran in %s, want %s", got, session)
+	}
+	cmd.Dir = other
+	if got := pwd(cmd); got != real(other) {
+		t.Errorf("Dir: ran in %s, want %s", got, other)
+	}
+	cmd = self(t, context.Background(), "pwd")
+	cmd.Payload = hooktest.SessionStart().WithCwd(filepath.Join(session, "gone")).Build()
+	if got := pwd(cmd); got != real(own) {
+		t.Errorf("missing cwd: ran in %s, want %s", got, own)
+	}
+	if got := pwd(self(t, context.Background(), "pwd")); got != real(own) {
+		t.Errorf("no payload: ran in %s, want %s", got, own)
+	}
+}
+
+func TestStdin(t *testing.T) {
+	// Without Stdin the program reads nothing, not the hook's own stdin.
+	res, err := self(t, context.Background(), "cat").Run()
+	if err != nil || len(res.Stdout) != 0 {
+		t.Errorf("no stdin: %q, %v", res.Stdout, err)
+	}
+	cmd := self(t, context.Background(), "cat")
+	cmd.Stdin = strings.NewReader("input")
+	if res, err := cmd.Run(); err != nil || string(res.Stdout) != "input" {
+		t.Errorf("stdin: %q, %v", res.Stdout, err)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	res, err := self(t, context.Background(), "exit:3").Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || res.ExitCode != 3 || string(res.Stdout) != "bye" || res.TimedOut || res.Duration <= 0 {
+		t.Errorf("exit 3: %+v, %v", res, err)
+	}
+	if res, err := self(t, context.Background(), "exit:0").Run(); err != nil || res.ExitCode != 0 {
+		t.Errorf("exit 0: %+v, %v", res, err)
+	}
+
+	// A program that can't start has no exit status.
+	res, err = run.Command(context.Background(), filepath.Join(t.TempDir(), "missing")).Run()
+	if err == nil || res.ExitCode != -1 {
+		t.Errorf("missing program: %+v, %v", res, err)
+	}
+}
+
+func TestOutputCaps(t *testing.T) {
+	const n = 100000
+	var stdout, stderr bytes.Buffer
+	for i := 0; i < n; i += 10 {
+		line := fmt.Sprintf("%09d\n", i)
+		stdout.WriteString(line)
+		stderr.WriteString(strings.ToUpper("e" + line[1:]))
+	}
+	mode := "output:" + strconv.Itoa(n)
+
+	// Everything, when it fits.
+	res, err := self(t, context.Background(), mode).Run()
+	if err != nil || !bytes.Equal(res.Stdout, stdout.Bytes()) || !bytes.Equal(res.Stderr, stderr.Bytes()) ||
+		res.StdoutTruncated || res.StderrTruncated {
+		t.Errorf("uncapped: %d and %d bytes, truncated %v %v, %v", len(res.Stdout), len(res.Stderr), res.StdoutTruncated, res.StderrTruncated, err)
+	}
+
+	// The head, or with Tail the end, of each.
+	cmd := self(t, context.Background(), mode)
+	cmd.MaxOutput = 1000
+	res, _ = cmd.Run()
+	if !bytes.Equal(res.Stdout, stdout.Bytes()[:1000]) || !bytes.Equal(res.Stderr, stderr.Bytes()[:1000]) || !res.StdoutTruncated || !res.StderrTruncated {
+		t.Errorf("head: %q..., %q..., truncated %v %v", res.Stdout[:20], res.Stderr[:20], res.StdoutTruncated, res.StderrTruncated)
+	}
+	cmd = self(t, context.Background(), mode)
+	cmd.MaxOutput, cmd.Tail = 1005, true
+	res, _ = cmd.Run()
+	if !bytes.Equal(res.Stdout, stdout.Bytes()[n-1005:]) || !bytes.Equal(res.Stderr, stderr.Bytes()[n-1005:]) || !res.StdoutTruncated {
+		t.Errorf("tail: ...%q, ...%q", res.Stdout[len(res.Stdout)-20:], res.Stderr[len(res.Stderr)-20:])
+	}
+	cmd = self(t, context.Background(), mode)
+	cmd.MaxOutput, cmd.Tail = n, true
+	if res, _ = cmd.Run(); res.StdoutTruncated || !bytes.Equal(res.Stdout, stdout.Bytes()) {
+		t.Errorf("tail of exactly MaxOutput: %d bytes, truncated %v", len(res.Stdout), res.StdoutTruncated)
+	}
+
+	// Merged, both streams are in Stdout under one cap.
+	cmd = self(t, context.Background(), mode)
+	cmd.MergeStderr = true
+	res, _ = cmd.Run()
+	if len(res.Stdout) != 2*n || res.Stderr != nil || !bytes.Contains(res.Stdout, []byte("E00000010\n")) {
+		t.Errorf("merged: %d bytes of stdout, stderr %q", len(res.Stdout), res.Stderr)
+	}
+	cmd = self(t, context.Background(), mode)
+	cmd.MergeStderr, cmd.MaxOutput = true, n
+	if res, _ = cmd.Run(); len(res.Stdout) != n || !res.StdoutTruncated {
+		t.Errorf("merged and capped: %d bytes, truncated %v", len(res.Stdout), res.StdoutTruncated)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	cmd := self(t, context.Background(), "hang")
+	cmd.Timeout = 200 * time.Millisecond
+	start := time.Now()
+	res, err := cmd.Run()
+	if !errors.Is(err, context.DeadlineExceeded) || !res.TimedOut || res.ExitCode != -1 {
+		t.Errorf("timeout: %+v, %v", res, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("killed after %v with a 200ms timeout", elapsed)
+	}
+
+	// The context's deadline is a timeout too; cancelling isn't.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if res, err := self(t, ctx, "hang").Run(); !errors.Is(err, context.DeadlineExceeded) || !res.TimedOut {
+		t.Errorf("context deadline: %+v, %v", res, err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	if res, err := self(t, ctx, "hang").Run(); !errors.Is(err, context.Canceled) || res.TimedOut || res.ExitCode != -1 {
+		t.Errorf("cancelled: %+v, %v", res, err)
+	}
+	// A context already done starts nothing.
+	if res, err := self(t, ctx, "exit:0").Run(); !errors.Is(err, context.Canceled) || res.Duration != 0 {
+		t.Errorf("done context: %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,98 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package run_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// ticker waits for the tick-mode child writing to path to start, kills it when the test ends,
+// and returns a function that reports whether it is still running.
+func ticker(t *testing.T, path string) (running func() bool) {
+	t.Helper()
+	var pid int
+	for deadline := time.Now().Add(10 * time.Second); pid == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the child never started")
+		}
+		data, _ := os.ReadFile(path)
+		if line, _, ok := strings.Cut(string(data), "\n"); ok {
+			pid, _ = strconv.Atoi(line)
+		}
+	}
+	t.Cleanup(func() { syscall.Kill(pid, syscall.SIGKILL) })
+	size := func() int64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	return func() bool {
+		// A killed child may still be a zombie, so watch its ticks rather than its pid.
+		before := size()
+		time.Sleep(200 * time.Millisecond)
+		return size() != before
+	}
+}
+
+func TestTimeoutKillsGroup(t *testing.T) {
+	for _, cancelled := range []bool{false, true} {
+		ticks := filepath.Join(t.TempDir(), "ticks")
+		ctx, cancel := context.WithCancel(context.Background())
+		cmd := self(t, ctx, "spawn:"+ticks)
+		cmd.Timeout = time.Minute
+		if !cancelled {
+			cmd.Timeout = 500 * time.Millisecond
+		}
+		done := make(chan error, 1)
+		go func() {
+			_, err := cmd.Run()
+			done <- err
+		}()
+		running := ticker(t, ticks)
+		if !running() {
+			t.Fatal("the child isn't ticking")
+		}
+		if cancelled {
+			cancel()
+		}
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("cancelled %v: Run succeeded", cancelled)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("cancelled %v: Run didn't return", cancelled)
+		}
+		cancel()
+		// The program's child went with it.
+		if running() {
+			t.Errorf("cancelled %v: the program's child outlived it", cancelled)
+		}
+	}
+}
+
+func TestBackgroundChildHoldingOutput(t *testing.T) {
+	// The program exits at once; its child keeps stdout open. Run waits a little for it, then
+	// returns the program's own result, leaving the child be.
+	ticks := filepath.Join(t.TempDir(), "ticks")
+	start := time.Now()
+	res, err := self(t, context.Background(), "background:"+ticks).Run()
+	if err != nil || res.ExitCode != 0 || res.TimedOut {
+		t.Errorf("Run = %+v, %v", res, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run waited %v for the child", elapsed)
+	}
+	if running := ticker(t, ticks); !running() {
+		t.Error("the child of a program that exited was killed")
+	}
+}
@@ -0,0 +1,110 @@
+package hooksdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func respond(resp hooksdk.Response, err error) hooksdk.Handler {
+	return func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) { return resp, err }
+}
+
+func TestRunIOExitCodes(t *testing.T) {
+	payload := hooktest.ToolCallStarted().Bytes()
+	tests := []struct {
+		name     string
+		handler  hooksdk.Handler
+		code     int
+		decision hooksdk.Decision
+	}{
+		{"allow", respond(hooksdk.Allow(), nil), hooksdk.ExitOK, hooksdk.DecisionAllow},
+		{"ask", respond(hooksdk.Ask("sure?"), nil), hooksdk.ExitOK, hooksdk.DecisionAsk},
+		{"deny", respond(hooksdk.Deny("no"), nil), hooksdk.ExitDeny, hooksdk.DecisionDeny},
+		{"error", respond(hooksdk.Response{}, errors.New("boom")), hooksdk.ExitError, ""},
+	}
+	for _, tt := range tests {
+		res := hooktest.RunHook(t, tt.handler, payload)
+		if res.ExitCode != tt.code || res.Response.Decision != tt.decision {
+			t.Errorf("%s: got exit %d, decision %q; want %d, %q", tt.name, res.ExitCode, res.Response.Decision, tt.code, tt.decision)
+		}
+	}
+}
+
+// errorLine decodes the single JSON line an error is reported as on stderr.
+func errorLine(t *testing.T, stderr string) map[string]any {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("stderr has %d lines, want 1:\n%s", len(lines), stderr)
+	}
+	var line map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatalf("stderr is not a JSON line: %v\n%s", err, stderr)
+	}
+	return line
+}
+
+func TestRunIOHandlerError(t *testing.T) {
+	res := hooktest.RunHook(t, respond(hooksdk.Response{}, errors.New("boom")), hooktest.SessionStart().Bytes())
+	if res.Stdout != "" {
+		t.Errorf("stdout = %q, want nothing", res.Stdout)
+	}
+	line := errorLine(t, res.Stderr)
+	if line["level"] != "error" || line["stage"] != "handler" || line["error"] != "boom" {
+		t.Errorf("stderr line = %v", line)
+	}
+}
+
+func TestRunIOBadPayload(t *testing.T) {
+	called := false
+	handler := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		called = true
+		return hooksdk.Allow(), nil
+	}
+	res := hooktest.RunHook(t, handler, []byte("not json"))
+	if called {
+		t.Errorf("handler was called for a payload that doesn't parse")
+	}
+	if res.ExitCode != hooksdk.ExitError {
+		t.Errorf("exit code = %d, want %d", res.ExitCode, hooksdk.ExitError)
+	}
+	if line := errorLine(t, res.Stderr); line["stage"] != "read_payload" {
+		t.Errorf("stderr line = %v, want stage read_payload", line)
+	}
+}
+
+func TestRunIOHandlerPanic(t *testing.T) {
+	handler := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) { panic("oops") }
+	res := hooktest.RunHook(t, handler, hooktest.SessionStart().Bytes())
+	if res.ExitCode != hooksdk.ExitOK || res.Response.Decision != hooksdk.DecisionAllow {
+		t.Errorf("got exit %d, decision %q; want the allow panic response", res.ExitCode, res.Response.Decision)
+	}
+	if !strings.Contains(res.Stderr, "oops") {
+		t.Errorf("stderr doesn't report the panic:\n%s", res.Stderr)
+	}
+}
+
+func TestRunIOPanicDecision(t *testing.T) {
+	handler := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) { panic("oops") }
+	res := hooktest.RunHook(t, handler, hooktest.ApprovalRequested().Bytes(), hooksdk.WithPanicDecision(hooksdk.Deny("hook crashed")))
+	if res.ExitCode != hooksdk.ExitDeny || res.Response.Decision != hooksdk.DecisionDeny || res.Response.Reason != "hook crashed" {
+		t.Errorf("got exit %d, response %+v; want the deny panic response", res.ExitCode, res.Response)
+	}
+	if !json.Valid([]byte(res.Stdout)) {
+		t.Errorf("stdout is not a JSON response: %q", res.Stdout)
+	}
+
+	line := errorLine(t, res.Stderr)
+	if line["level"] != "error" || line["panic"] != "oops" || line["stage"] != "handler" {
+		t.Errorf("stderr line = %v", line)
+	}
+	if stack, _ := line["stack"].(string); !strings.Contains(stack, "TestRunIOPanicDecision") {
+		t.Errorf("stderr line has no stack trace of the panic: %v", line)
+	}
+}
@@ -0,0 +1,386 @@
+// Package s3 uploads objects to Amazon S3 or an S3-compatible store (MinIO, R2, Ceph, ...) with
+// a plain net/http client, signing each request with AWS Signature Version 4.
+//
+// Every upload carries Content-MD5, so the store rejects a body that arrived cut short or
+// corrupted, and Put checks the ETag the store returns against the MD5 too: an object Put
+// succeeded for holds exactly the bytes given. Failed and partial uploads are retried.
+//
+//	c := &s3.Client{
+//		Region:      "eu-west-1",
+//		Bucket:      "my-logs",
+//		Credentials: s3.Credentials{AccessKeyID: id, SecretAccessKey: secret},
+//	}
+//	etag, err := c.Put(ctx, "hooks/laptop/hooks.jsonl.gz", data, "application/gzip")
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/retry"
+)
+
+// DefaultTimeout bounds a Put, retries included, when Client.Timeout is zero.
+const DefaultTimeout = 5 * time.Minute
+
+// DefaultMaxAttempts bounds the requests of a Put when Client.MaxAttempts is zero.
+const DefaultMaxAttempts = 5
+
+// The retry timing of Put.
+const (
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+	backoffJitter  = 0.2
+)
+
+// Signature Version 4 constants.
+const (
+	algorithm   = "AWS4-HMAC-SHA256"
+	amzDate     = "20060102T150405Z"
+	scopeDate   = "20060102"
+	service     = "s3"
+	dateHeader  = "X-Amz-Date"
+	hashHeader  = "X-Amz-Content-Sha256"
+	tokenHeader = "X-Amz-Security-Token"
+)
+
+// Credentials sign requests. SessionToken is only set for temporary credentials (from STS or an
+// SSO login).
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Sign signs req for region with Signature Version 4 at time t, setting its X-Amz-Date,
+// X-Amz-Content-Sha256, X-Amz-Security-Token (with a session token), and Authorization headers.
+// payloadHash is the hex SHA-256 of the body.
+//
+// The signature covers the method, path, query, the host, and every header already on req, so set
+// the headers to sign before calling Sign and add none after. A server checks a request by
+// rebuilding it from the headers listed in its Authorization and signing it again.
+func Sign(req *http.Request, creds Credentials, region string, t time.Time, payloadHash string) {
+	t = t.UTC()
+	req.Header.Del("Authorization")
+	req.Header.Set(dateHeader, t.Format(amzDate))
+	req.Header.Set(hashHeader, payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set(tokenHeader, creds.SessionToken)
+	}
+
+	names, canonicalHeaders := canonicalHeaders(req)
+	signedHeaders := strings.Join(names, ";")
+	canonical := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{t.Format(scopeDate), region, service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{algorithm, t.Format(amzDate), scope, hexSHA256([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), t.Format(scopeDate))
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalHeaders returns the sorted lowercase names of the host and req's headers, and their
+// canonical `name:value` lines.
+func canonicalHeaders(req *http.Request) ([]string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for k, vs := range req.Header {
+		trimmed := make([]string, len(vs))
+		for i, v := range vs {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		values[strings.ToLower(k)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, k := range names {
+		b.WriteString(k + ":" + values[k] + "\n")
+	}
+	return names, b.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	var pairs []string
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// escapePath is S3's URI encoding of a path: every byte but the unreserved characters and `/`
+// percent-encoded.
+func escapePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return escape(path, false)
+}
+
+func escape(s string, slash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// StatusError is returned when the store answers an upload with a non-2xx status that isn't
+// retried (or still fails after the last attempt).
+type StatusError struct {
+	StatusCode int
+	// Code is the S3 error code of the response (`AccessDenied`, `NoSuchBucket`, ...), if it had
+	// one.
+	Code string
+	// Message is the error message of the response, or the start of its body.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("s3: store returned %d", e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// ETagError is returned when the store accepted an upload but its ETag isn't the MD5 of the body,
+// so the stored object can't be trusted to be the bytes sent. It is retried.
+type ETagError struct {
+	Got, Want string
+}
+
+func (e *ETagError) Error() string {
+	return fmt.Sprintf("s3: stored object's ETag %q doesn't match the upload's MD5 %q", e.Got, e.Want)
+}
+
+// Client uploads to one bucket.
+type Client struct {
+	// Endpoint is the store's base URL, e.g. `https://s3.eu-west-1.amazonaws.com` or
+	// `http://localhost:9000`; "" is AWS's endpoint for Region.
+	Endpoint string
+	// Region signs requests; "" is us-east-1, which most S3-compatible stores accept whatever
+	// their location.
+	Region string
+	Bucket string
+	// PathStyle addresses the bucket in the path (`<endpoint>/<bucket>/<key>`), as most
+	// S3-compatible stores need, rather than in the host (`<bucket>.<endpoint host>/<key>`).
+	PathStyle   bool
+	Credentials Credentials
+	// Timeout bounds each Put, retries included. Zero means DefaultTimeout.
+	Timeout time.Duration
+	// MaxAttempts bounds the requests of each Put. Zero means DefaultMaxAttempts.
+	MaxAttempts int
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// OnRetry, if set, is called before each retry with the attempt that failed, its error, and
+	// the wait (see retry.Policy), e.g. to log it.
+	OnRetry func(attempt int, err error, wait time.Duration)
+	// Now is the clock requests are signed with; nil means time.Now.
+	Now func() time.Time
+	// Sleep waits between attempts (see retry.Policy); nil means a timer. Tests set it to retry
+	// without waiting.
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// Put uploads body as the object key, with contentType (`application/octet-stream` if ""), and
+// returns its ETag. Connection errors, timeouts, 408, 429, and 5xx responses, S3's 400s for a
+// body that arrived incomplete or corrupted, and an ETag that doesn't match are retried with
+// exponential backoff; other non-2xx responses fail at once with a *StatusError.
+func (c *Client) Put(ctx context.Context, key string, body []byte, contentType string) (string, error) {
+	if c.Bucket == "" {
+		return "", errors.New("s3: no bucket")
+	}
+	u, err := c.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	sum := md5.Sum(body)
+	md5Hex := hex.EncodeToString(sum[:])
+	md5B64 := base64.StdEncoding.EncodeToString(sum[:])
+	payloadHash := hexSHA256(body)
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	attempts := c.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultMaxAttempts
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	policy := retry.Policy{
+		MaxAttempts:    attempts,
+		InitialBackoff: initialBackoff,
+		MaxBackoff:     maxBackoff,
+		Jitter:         backoffJitter,
+		Classify:       retryable,
+		OnRetry:        c.OnRetry,
+		Sleep:          c.Sleep,
+	}
+	var etag string
+	err = retry.Do(ctx, policy, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Content-MD5", md5B64)
+		Sign(req, c.Credentials, c.region(), c.now(), payloadHash)
+		etag, err = c.do(req)
+		if err != nil {
+			return err
+		}
+		if got := strings.Trim(etag, `"`); !strings.EqualFold(got, md5Hex) {
+			return &ETagError{Got: etag, Want: md5Hex}
+		}
+		return nil
+	})
+	var giveUp *retry.GiveUpError
+	if errors.As(err, &giveUp) {
+		return "", fmt.Errorf("s3: put %s: %w", key, err)
+	}
+	if err != nil {
+		return "", err
+	}
+	return etag, nil
+}
+
+// do sends req and returns the response's ETag.
+func (c *Client) do(req *http.Request) (string, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.Header.Get("ETag"), nil
+	}
+	se := &StatusError{StatusCode: resp.StatusCode}
+	var body struct {
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		se.Code, se.Message = body.Code, body.Message
+	} else {
+		se.Message = strings.TrimSpace(string(data[:min(len(data), 512)]))
+	}
+	return "", se
+}
+
+// objectURL returns the URL of key, in the path or host style.
+func (c *Client) objectURL(key string) (string, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + c.region() + ".amazonaws.com"
+	}
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return "", fmt.Errorf("s3: endpoint %q isn't an http(s) URL", endpoint)
+	}
+	path := strings.TrimPrefix(key, "/")
+	if c.PathStyle {
+		path = c.Bucket + "/" + path
+	} else {
+		base.Host = c.Bucket + "." + base.Host
+	}
+	return base.Scheme + "://" + base.Host + escapePath(base.Path+"/"+path), nil
+}
+
+func (c *Client) region() string {
+	if c.Region == "" {
+		return "us-east-1"
+	}
+	return c.Region
+}
+
+func (c *Client) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// retryable reports whether a Put attempt's error is worth another attempt.
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		if se.StatusCode == http.StatusBadRequest {
+			// S3 answers 400 when the body it got was incomplete, didn't match its Content-MD5, or
+			// came in too slowly: the upload was cut short rather than wrong.
+			switch se.Code {
+			case "IncompleteBody", "BadDigest", "RequestTimeout":
+				return true
+			}
+		}
+		return retry.HTTPStatus(se.StatusCode)
+	}
+	// ETag mismatches and transport errors: refused connections, resets, timeouts.
+	return true
+}
@@ -0,0 +1,209 @@
+// Package s3test runs an S3 stub for testing uploads made with hooksdk/s3. It checks the Signature
+// Version 4 signature and Content-MD5 of every PUT the way S3 does, stores the objects, and
+// answers with failures it is given first.
+//
+//	srv := s3test.NewServer(t, creds, "us-east-1")
+//	srv.Fail(s3test.Failure{Status: 503})
+//	etag, err := srv.Client("logs").Put(ctx, "a/b.jsonl", data, "")
+//	obj, ok := srv.Object("logs/a/b.jsonl")
+package s3test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/s3"
+)
+
+// Object is an object the stub stores.
+type Object struct {
+	Data        []byte
+	ContentType string
+}
+
+// Failure is an answer to give a PUT instead of storing it: a Status with an S3 error Code, or,
+// with ETag set, a 200 whose ETag is ETag rather than the body's MD5 (the object is stored).
+type Failure struct {
+	Status int
+	Code   string
+	ETag   string
+}
+
+// Server is a running stub, with path-style addressing (`<URL>/<bucket>/<key>`), stopped when the
+// test ends.
+type Server struct {
+	*httptest.Server
+	Credentials s3.Credentials
+	Region      string
+
+	mu       sync.Mutex
+	objects  map[string]Object
+	failures []Failure
+	requests int
+	rejected []string
+}
+
+// NewServer starts a stub that accepts requests signed with creds for region.
+func NewServer(t testing.TB, creds s3.Credentials, region string) *Server {
+	s := &Server{Credentials: creds, Region: region, objects: map[string]Object{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns a client for bucket on the stub that retries without waiting.
+func (s *Server) Client(bucket string) *s3.Client {
+	return &s3.Client{
+		Endpoint:    s.URL,
+		Region:      s.Region,
+		Bucket:      bucket,
+		PathStyle:   true,
+		Credentials: s.Credentials,
+		Sleep:       func(ctx context.Context, _ time.Duration) error { return ctx.Err() },
+	}
+}
+
+// Fail queues failures to answer the next PUTs with, in order.
+func (s *Server) Fail(failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failures...)
+}
+
+// Object returns the object stored at path, `<bucket>/<key>`.
+func (s *Server) Object(path string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[path]
+	return obj, ok
+}
+
+// Objects returns the objects stored, by `<bucket>/<key>`.
+func (s *Server) Objects() map[string]Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]Object, len(s.objects))
+	for k, v := range s.objects {
+		out[k] = v
+	}
+	return out
+}
+
+// Requests returns the number of requests received.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Rejected returns why requests were refused for a bad signature or digest, one reason per
+// request.
+func (s *Server) Rejected() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.rejected...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if err != nil {
+		return
+	}
+	if r.Method != http.MethodPut {
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+		return
+	}
+	if reason := s.verify(r, body); reason != "" {
+		s.rejected = append(s.rejected, reason)
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	sum := md5.Sum(body)
+	if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+		s.rejected = append(s.rejected, "Content-MD5 doesn't match the body")
+		writeError(w, http.StatusBadRequest, "BadDigest")
+		return
+	}
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	if len(s.failures) > 0 {
+		f := s.failures[0]
+		s.failures = s.failures[1:]
+		if f.ETag == "" {
+			writeError(w, f.Status, f.Code)
+			return
+		}
+		etag = f.ETag
+	}
+	s.objects[strings.TrimPrefix(r.URL.Path, "/")] = Object{Data: body, ContentType: r.Header.Get("Content-Type")}
+	w.Header().Set("ETag", etag)
+}
+
+// verify checks r's signature by signing a copy of it, made from the headers its Authorization
+// lists, again; it returns why the signature is wrong, or "".
+func (s *Server) verify(r *http.Request, body []byte) string {
+	auth := r.Header.Get("Authorization")
+	fields := map[string]string{}
+	rest, ok := strings.CutPrefix(auth, "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return "Authorization " + auth
+	}
+	for _, f := range strings.Split(rest, ", ") {
+		k, v, _ := strings.Cut(f, "=")
+		fields[k] = v
+	}
+	if id, _, _ := strings.Cut(fields["Credential"], "/"); id != s.Credentials.AccessKeyID {
+		return "access key " + id
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	if r.Header.Get("X-Amz-Content-Sha256") != hash {
+		return "X-Amz-Content-Sha256 doesn't match the body"
+	}
+	at, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return "X-Amz-Date: " + err.Error()
+	}
+
+	signed, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		return err.Error()
+	}
+	signed.Host = r.Host
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		switch name {
+		case "host", "x-amz-date", "x-amz-content-sha256", "x-amz-security-token":
+			// Sign sets these.
+		default:
+			signed.Header[http.CanonicalHeaderKey(name)] = r.Header.Values(name)
+		}
+	}
+	s3.Sign(signed, s.Credentials, s.Region, at, hash)
+	if got := signed.Header.Get("Authorization"); got != auth {
+		return "Authorization " + auth + ", want " + got
+	}
+	return ""
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: "s3test: " + http.StatusText(status)})
+}
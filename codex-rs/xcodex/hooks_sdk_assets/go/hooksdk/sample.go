@@ -0,0 +1,76 @@
+package hooksdk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Sampler keeps a fraction of events per event type, e.g. to log only 1% of notifications.
+//
+// Rates are keyed by event type patterns (exact types, or prefixes ending in `*` as in Filter); the
+// most specific match wins and unlisted types are always kept (rate 1.0).
+type Sampler struct {
+	Rates map[string]float64
+	// Deterministic decides by hashing the event id instead of rolling a die, so replaying the
+	// same events keeps the same sample. Events without an id are sampled randomly.
+	Deterministic bool
+}
+
+// ParseSampleRates parses a comma-separated `type:rate` list such as
+// "notification:0.01,tool-call-*:0.1". Rates must be between 0 and 1.
+func ParseSampleRates(list string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, item := range splitPatterns(list) {
+		pattern, rateStr, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid sample rate %q: want type:rate", item)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateStr), 64)
+		if err != nil || rate < 0 || rate > 1 || math.IsNaN(rate) {
+			return nil, fmt.Errorf("invalid sample rate %q: rate must be between 0 and 1", item)
+		}
+		rates[strings.TrimSpace(pattern)] = rate
+	}
+	return rates, nil
+}
+
+// Rate returns the sampling rate that applies to eventType.
+func (s Sampler) Rate(eventType string) float64 {
+	if rate, ok := s.Rates[eventType]; ok {
+		return rate
+	}
+	best, rate := -1, 1.0
+	for pattern, r := range s.Rates {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(eventType, prefix) && len(prefix) > best {
+			best, rate = len(prefix), r
+		}
+	}
+	return rate
+}
+
+// Keep reports whether the event should be kept.
+func (s Sampler) Keep(eventType, eventID string) bool {
+	rate := s.Rate(eventType)
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	}
+	if s.Deterministic && eventID != "" {
+		sum := sha256.Sum256([]byte(eventID))
+		return float64(binary.BigEndian.Uint64(sum[:8]))/float64(math.MaxUint64) < rate
+	}
+	return rand.Float64() < rate
+}
+
+// KeepPayload is Keep for p's event type and `event_id`.
+func (s Sampler) KeepPayload(p *HookPayload) bool {
+	return s.Keep(p.EventType(), p.EventId)
+}
@@ -0,0 +1,91 @@
+package hooksdk_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestParseSampleRates(t *testing.T) {
+	rates, err := hooksdk.ParseSampleRates(" notification:0.01, tool-call-*:0.1 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 2 || rates["notification"] != 0.01 || rates["tool-call-*"] != 0.1 {
+		t.Errorf("rates = %v", rates)
+	}
+	if rates, err := hooksdk.ParseSampleRates(""); err != nil || len(rates) != 0 {
+		t.Errorf("ParseSampleRates(\"\") = %v, %v; want no rates", rates, err)
+	}
+	for _, bad := range []string{"notification", "notification:x", "notification:1.5", "notification:-0.1", "notification:NaN"} {
+		if _, err := hooksdk.ParseSampleRates(bad); err == nil {
+			t.Errorf("ParseSampleRates(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSamplerRate(t *testing.T) {
+	s := hooksdk.Sampler{Rates: map[string]float64{
+		"tool-*":             0.5,
+		"tool-call-*":        0.2,
+		"tool-call-finished": 0.1,
+		"approval-requested": 0,
+	}}
+	for eventType, want := range map[string]float64{
+		"tool-call-finished": 0.1,
+		"tool-call-started":  0.2,
+		"tool-output":        0.5,
+		"approval-requested": 0,
+		"session-start":      1,
+	} {
+		if got := s.Rate(eventType); got != want {
+			t.Errorf("Rate(%s) = %v, want %v", eventType, got, want)
+		}
+	}
+	if s.Keep("approval-requested", "e1") {
+		t.Errorf("Keep at rate 0 kept the event")
+	}
+	if !s.Keep("session-start", "e1") {
+		t.Errorf("Keep of an unlisted type dropped the event")
+	}
+}
+
+func TestSamplerDeterministic(t *testing.T) {
+	const n = 10000
+	s := hooksdk.Sampler{Rates: map[string]float64{"notification": 0.1}, Deterministic: true}
+	first := make([]bool, n)
+	kept := 0
+	for i := range first {
+		first[i] = s.Keep("notification", fmt.Sprintf("event-%d", i))
+		if first[i] {
+			kept++
+		}
+	}
+	// Replaying the same events picks the same ones.
+	for run := 0; run < 3; run++ {
+		for i, want := range first {
+			if got := s.Keep("notification", fmt.Sprintf("event-%d", i)); got != want {
+				t.Fatalf("run %d: Keep(event-%d) = %v, want %v as before", run, i, got, want)
+			}
+		}
+	}
+	if frac := float64(kept) / n; math.Abs(frac-0.1) > 0.02 {
+		t.Errorf("kept %.3f of events, want about 0.1", frac)
+	}
+}
+
+func TestSamplerRandom(t *testing.T) {
+	const n = 10000
+	s := hooksdk.Sampler{Rates: map[string]float64{"notification": 0.25}}
+	kept := 0
+	for i := 0; i < n; i++ {
+		if s.Keep("notification", "same-id") {
+			kept++
+		}
+	}
+	if frac := float64(kept) / n; math.Abs(frac-0.25) > 0.03 {
+		t.Errorf("kept %.3f of events, want about 0.25", frac)
+	}
+}
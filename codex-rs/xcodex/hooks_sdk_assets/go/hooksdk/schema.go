@@ -0,0 +1,188 @@
+package hooksdk
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// The schemas in schemas/ describe the payload of each event type as the host builds it
+// (`HookPayload::from_event` in codex-core): the fields every payload carries, plus the ones the
+// host always sets for that event. Fields a schema doesn't list are allowed, so payloads from newer
+// hosts still validate.
+//
+//go:embed schemas/*.json
+var schemaFS embed.FS
+
+// The schemas in schemas/responses/ describe the response a hook writes for each event type: the
+// decisions it takes, and the fields a modify patch may change (those of ModifiableFields). Unlike
+// the payload schemas they allow no other fields, since the host ignores a misspelled one.
+//
+//go:embed schemas/responses/*.json
+var responseSchemaFS embed.FS
+
+// SchemaFor returns the JSON Schema (draft-07) of an event type's payload, or false for event
+// types this SDK doesn't know.
+func SchemaFor(eventType string) ([]byte, bool) {
+	data, err := schemaFS.ReadFile("schemas/" + eventType + ".json")
+	if err != nil || !IsKnownEventType(eventType) {
+		return nil, false
+	}
+	return data, true
+}
+
+// ResponseSchemaFor returns the JSON Schema (draft-07) of the response to an event type, or false
+// for event types this SDK doesn't know.
+func ResponseSchemaFor(eventType string) ([]byte, bool) {
+	data, err := responseSchemaFS.ReadFile("schemas/responses/" + eventType + ".json")
+	if err != nil || !IsKnownEventType(eventType) {
+		return nil, false
+	}
+	return data, true
+}
+
+// Violation is one way a payload doesn't match its schema.
+type Violation struct {
+	// Pointer is the JSON pointer (RFC 6901) of the offending value, e.g. `/tool_input/command`,
+	// or of the missing field; "" is the payload itself.
+	Pointer string
+	Message string
+}
+
+func (v Violation) Error() string {
+	if v.Pointer == "" {
+		return v.Message
+	}
+	return v.Pointer + ": " + v.Message
+}
+
+// SchemaError is returned by ValidatePayload (and parsing under WithValidation) for a payload
+// that doesn't match the schema of its event type, and by ValidateResponse for a response. It
+// lists every violation, sorted by pointer, and unwraps to them (errors.As reaches each Violation).
+type SchemaError struct {
+	EventType string
+	// Response is set when the document is a response rather than a payload.
+	Response   bool
+	Violations []Violation
+}
+
+func (e *SchemaError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Error()
+	}
+	switch {
+	case e.Response:
+		return fmt.Sprintf("hook response to %q does not match its schema: %s", e.EventType, strings.Join(msgs, "; "))
+	case e.EventType == "":
+		return "hook payload does not match its schema: " + strings.Join(msgs, "; ")
+	}
+	return fmt.Sprintf("hook payload %q does not match its schema: %s", e.EventType, strings.Join(msgs, "; "))
+}
+
+func (e *SchemaError) Unwrap() []error {
+	errs := make([]error, len(e.Violations))
+	for i, v := range e.Violations {
+		errs[i] = v
+	}
+	return errs
+}
+
+// ValidatePayload checks a raw payload against the schema of its `xcodex_event_type`, returning a
+// *SchemaError listing every violation. Payloads of event types this SDK doesn't know are not
+// validated (nil), since a newer host may send them; a payload without an event type is a
+// violation.
+func ValidatePayload(raw []byte) error {
+	if isBlank(raw) {
+		return ErrEmptyPayload
+	}
+	var doc any
+	if err := unmarshalUseNumber(raw, &doc); err != nil {
+		return err
+	}
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return &SchemaError{Violations: []Violation{{Message: "payload must be a JSON object"}}}
+	}
+	eventType, ok := obj["xcodex_event_type"].(string)
+	if !ok {
+		msg := "required"
+		if _, present := obj["xcodex_event_type"]; present {
+			msg = "must be a string"
+		}
+		return &SchemaError{Violations: []Violation{{Pointer: "/xcodex_event_type", Message: msg}}}
+	}
+	s, err := compiledSchema(eventType, false)
+	if err != nil || s == nil {
+		return err
+	}
+	if vs := s.validate(doc, ""); len(vs) > 0 {
+		return &SchemaError{EventType: eventType, Violations: vs}
+	}
+	return nil
+}
+
+// ValidateResponse checks resp, as WriteResponse serializes it, against the response schema of
+// eventType (see ResponseSchemaFor), returning a *SchemaError listing every violation: a decision
+// the event type doesn't take, say, or a modify patch of a field it doesn't let hooks change.
+// Responses to event types this SDK doesn't know are not validated (nil). WriteResponse and Run
+// call it before writing.
+func ValidateResponse(eventType string, resp Response) error {
+	s, err := compiledSchema(eventType, true)
+	if err != nil || s == nil {
+		return err
+	}
+	if resp.Decision == "" {
+		resp.Decision = DecisionAllow
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := unmarshalUseNumber(data, &doc); err != nil {
+		return err
+	}
+	if vs := s.validate(doc, ""); len(vs) > 0 {
+		return &SchemaError{EventType: eventType, Response: true, Violations: vs}
+	}
+	return nil
+}
+
+type schemaKey struct {
+	eventType string
+	response  bool
+}
+
+var (
+	schemaMu    sync.Mutex
+	schemaCache = map[schemaKey]*schemaNode{}
+)
+
+// compiledSchema parses the payload schema of eventType, or its response schema, once; nil means
+// the type has no schema.
+func compiledSchema(eventType string, response bool) (*schemaNode, error) {
+	key := schemaKey{eventType, response}
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+	if s, ok := schemaCache[key]; ok {
+		return s, nil
+	}
+	lookup := SchemaFor
+	if response {
+		lookup = ResponseSchemaFor
+	}
+	data, ok := lookup(eventType)
+	if !ok {
+		return nil, nil
+	}
+	var root map[string]any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("hooksdk: schema for %q: %w", eventType, err)
+	}
+	s := &schemaNode{def: root, root: root}
+	schemaCache[key] = s
+	return s, nil
+}
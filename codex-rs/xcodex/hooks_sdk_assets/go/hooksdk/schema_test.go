@@ -0,0 +1,351 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// pointers returns the JSON pointers of the violations in err, failing unless it is a *SchemaError.
+func pointers(t *testing.T, err error) []string {
+	t.Helper()
+	var se *hooksdk.SchemaError
+	if !errors.As(err, &se) {
+		t.Fatalf("error = %v, want a *SchemaError", err)
+	}
+	out := make([]string, len(se.Violations))
+	for i, v := range se.Violations {
+		out[i] = v.Pointer
+	}
+	return out
+}
+
+// required lists the fields the schema of eventType requires.
+func required(t *testing.T, eventType string) []string {
+	t.Helper()
+	data, ok := hooksdk.SchemaFor(eventType)
+	if !ok {
+		t.Fatalf("no schema for %s", eventType)
+	}
+	var schema struct {
+		Required []string `json:"required"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema for %s: %v", eventType, err)
+	}
+	return schema.Required
+}
+
+func TestValidatePayloadFixtures(t *testing.T) {
+	// With changes its builder, so each case starts from a fresh fixture.
+	fixture := func(eventType string) *hooktest.Builder { return hooktest.Fixtures()[eventType] }
+	for eventType, b := range hooktest.Fixtures() {
+		if err := hooksdk.ValidatePayload(b.Bytes()); err != nil {
+			t.Errorf("%s fixture: %v", eventType, err)
+		}
+		// Each required field, left out, is a violation at its pointer.
+		for _, field := range required(t, eventType) {
+			if field == "xcodex_event_type" {
+				continue
+			}
+			err := hooksdk.ValidatePayload(fixture(eventType).With(field, nil).Bytes())
+			if got := pointers(t, err); !reflect.DeepEqual(got, []string{"/" + field}) || !strings.Contains(err.Error(), "/"+field+": required") {
+				t.Errorf("%s without %s: %v", eventType, field, err)
+			}
+		}
+		// So is a string field of another type.
+		if got := pointers(t, hooksdk.ValidatePayload(fixture(eventType).With("session_id", 42).Bytes())); !reflect.DeepEqual(got, []string{"/session_id"}) {
+			t.Errorf("%s with a numeric session_id: violations at %v", eventType, got)
+		}
+	}
+}
+
+func TestValidatePayloadViolations(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload *hooktest.Builder
+		want    []string
+	}{
+		{"bad enum", hooktest.ToolCallFinished().With("status", "exploded"), []string{"/status"}},
+		{"negative duration", hooktest.ToolCallFinished().With("duration_ms", -1), []string{"/duration_ms"}},
+		{"fractional attempt", hooktest.ToolCallFinished().With("attempt", 1.5), []string{"/attempt"}},
+		{"empty cwd", hooktest.SessionStart().WithCwd(""), []string{"/cwd"}},
+		// Every violation is listed, sorted by pointer.
+		{"several", hooktest.ToolCallFinished().With("success", "yes").With("cwd", nil).With("attempt", "1"),
+			[]string{"/attempt", "/cwd", "/success"}},
+		{"argv of numbers", hooktest.ApprovalRequested().With("command", []any{"ls", 1}), []string{"/command/1"}},
+		{"nested token usage", hooktest.ModelResponseCompleted().With("token_usage", map[string]any{"input_tokens": "many"}),
+			[]string{"/token_usage/cached_input_tokens", "/token_usage/input_tokens", "/token_usage/output_tokens",
+				"/token_usage/reasoning_output_tokens", "/token_usage/total_tokens"}},
+		{"tagged sandbox policy", hooktest.ApprovalRequested().With("sandbox_policy", map[string]any{"type": "external-sandbox", "network_access": "sometimes"}),
+			[]string{"/sandbox_policy/network_access"}},
+		{"null where allowed", hooktest.ApprovalRequested().With("sandbox_policy", nil).With("token_usage", nil), nil},
+		// Fields the schema doesn't list are allowed, for newer hosts.
+		{"extra field", hooktest.SessionStart().With("colour", "blue"), nil},
+	}
+	for _, tt := range tests {
+		err := hooksdk.ValidatePayload(tt.payload.Bytes())
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if got := pointers(t, err); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: violations at %v, want %v (%v)", tt.name, got, tt.want, err)
+		}
+	}
+}
+
+func TestValidatePayloadUnknownAndMalformed(t *testing.T) {
+	// An event type this SDK doesn't know isn't validated.
+	if err := hooksdk.ValidatePayload(futureEvent()); err != nil {
+		t.Errorf("unknown event type: %v", err)
+	}
+	if err := hooksdk.ValidatePayload(hooktest.New("plan-updated", "").With("session_id", 1).Bytes()); err != nil {
+		t.Errorf("unknown event type with odd fields: %v", err)
+	}
+
+	if err := hooksdk.ValidatePayload(nil); !errors.Is(err, hooksdk.ErrEmptyPayload) {
+		t.Errorf("empty payload: %v, want ErrEmptyPayload", err)
+	}
+	if err := hooksdk.ValidatePayload([]byte("{")); err == nil {
+		t.Errorf("invalid JSON validated")
+	}
+	for raw, want := range map[string]string{
+		`[1, 2]`:                      "payload must be a JSON object",
+		`{"session_id": "s"}`:         "/xcodex_event_type: required",
+		`{"xcodex_event_type": 7}`:    "/xcodex_event_type: must be a string",
+		`{"xcodex_event_type": null}`: "/xcodex_event_type: must be a string",
+	} {
+		err := hooksdk.ValidatePayload([]byte(raw))
+		var se *hooksdk.SchemaError
+		if !errors.As(err, &se) || len(se.Violations) != 1 || se.Violations[0].Error() != want {
+			t.Errorf("ValidatePayload(%s) = %v, want %q", raw, err, want)
+		}
+	}
+}
+
+func TestSchemaErrorUnwrapsToViolations(t *testing.T) {
+	err := hooksdk.ValidatePayload(hooktest.ToolCallFinished().With("status", "exploded").With("success", nil).Bytes())
+	var v hooksdk.Violation
+	if !errors.As(err, &v) || v.Pointer != "/status" {
+		t.Errorf("errors.As(Violation) = %+v from %v", v, err)
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, `hook payload "tool-call-finished" does not match its schema: `) || !strings.Contains(msg, "; /success: required") {
+		t.Errorf("Error() = %q", msg)
+	}
+}
+
+func TestSchemaFor(t *testing.T) {
+	for _, et := range hooksdk.AllEventTypes() {
+		data, ok := hooksdk.SchemaFor(string(et))
+		if !ok {
+			t.Errorf("no schema for %s", et)
+			continue
+		}
+		var schema struct {
+			Schema     string `json:"$schema"`
+			Properties struct {
+				EventType struct {
+					Const string `json:"const"`
+				} `json:"xcodex_event_type"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(data, &schema); err != nil {
+			t.Errorf("%s: %v", et, err)
+			continue
+		}
+		if !strings.Contains(schema.Schema, "draft-07") || schema.Properties.EventType.Const != string(et) {
+			t.Errorf("%s: schema is for %q (%s)", et, schema.Properties.EventType.Const, schema.Schema)
+		}
+	}
+	for _, et := range []string{"plan-updated", "", "../schema", "responses/session-start"} {
+		if _, ok := hooksdk.SchemaFor(et); ok {
+			t.Errorf("SchemaFor(%q) found a schema", et)
+		}
+	}
+}
+
+func TestWithValidation(t *testing.T) {
+	bad := hooktest.ToolCallFinished().With("duration_ms", "slow").Bytes()
+	if _, err := hooksdk.ParseHookPayload(bad, hooksdk.WithValidation()); !reflect.DeepEqual(pointers(t, err), []string{"/duration_ms"}) {
+		t.Errorf("ParseHookPayload with WithValidation: %v", err)
+	}
+	if _, err := hooksdk.ParseHookPayload(hooktest.ToolCallFinished().Bytes(), hooksdk.WithValidation()); err != nil {
+		t.Errorf("valid payload: %v", err)
+	}
+	if p, err := hooksdk.ParseHookPayload(futureEvent(), hooksdk.WithValidation()); err != nil || p.EventType() != "plan-updated" {
+		t.Errorf("unknown event type: %v", err)
+	}
+}
+
+// responseFixture reads a response from testdata/responses.
+func responseFixture(t *testing.T, name string) hooksdk.Response {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "responses", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return resp
+}
+
+func TestValidateResponseFixtures(t *testing.T) {
+	var all []string
+	for eventType := range hooktest.Fixtures() {
+		all = append(all, eventType)
+	}
+	asks := []string{"approval-requested", "tool-call-started"}
+	tests := []struct {
+		fixture string
+		// accepted lists the event types whose schema takes the response.
+		accepted []string
+		// reject is where a schema that doesn't take it finds the violations; for a modify patch
+		// (modify set), it is /modify where nothing may be changed, and /modify/<field> where other
+		// fields may.
+		reject []string
+		modify string
+	}{
+		{"allow.json", all, nil, ""},
+		{"deny.json", all, nil, ""},
+		{"ask.json", asks, []string{"/decision"}, ""},
+		{"ask-question.json", asks, []string{"/decision", "/question"}, ""},
+		{"modify-command.json", []string{"approval-requested"}, nil, "command"},
+		{"modify-tool-input.json", []string{"tool-call-started"}, nil, "tool_input"},
+		{"modify-prompt.json", []string{"user-prompt-submit"}, nil, "prompt"},
+		// `command` is an argv, not a string.
+		{"bad-modify-command.json", nil, nil, "command"},
+		{"bad-decision.json", nil, []string{"/decision"}, ""},
+		{"bad-reason-code.json", nil, []string{"/reason_code"}, ""},
+	}
+	for _, tt := range tests {
+		resp := responseFixture(t, tt.fixture)
+		accepted := map[string]bool{}
+		for _, eventType := range tt.accepted {
+			accepted[eventType] = true
+		}
+		for _, eventType := range all {
+			err := hooksdk.ValidateResponse(eventType, resp)
+			if accepted[eventType] {
+				if err != nil {
+					t.Errorf("%s for %s: %v", tt.fixture, eventType, err)
+				}
+				continue
+			}
+			want := tt.reject
+			if tt.modify != "" {
+				want = []string{"/modify"}
+				if len(hooksdk.ModifiableFields(hooksdk.EventType(eventType))) > 0 {
+					want = []string{"/modify/" + tt.modify}
+				}
+			}
+			if err == nil {
+				t.Errorf("%s for %s: valid, want violations at %v", tt.fixture, eventType, want)
+				continue
+			}
+			if got := pointers(t, err); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s for %s: violations at %v, want %v (%v)", tt.fixture, eventType, got, want, err)
+			}
+			if !strings.HasPrefix(err.Error(), `hook response to "`+eventType+`" does not match its schema: `) {
+				t.Errorf("%s for %s: error %q", tt.fixture, eventType, err)
+			}
+		}
+	}
+}
+
+func TestValidateResponseBuilt(t *testing.T) {
+	// The responses the constructors build are valid where they apply; an unset decision is allow.
+	for eventType, resp := range map[string]hooksdk.Response{
+		"session-start":      {},
+		"tool-call-finished": hooksdk.Deny("no", hooksdk.WithReasonCode("POLICY_X")).InjectContext("why"),
+		"tool-call-started":  hooksdk.Allow().ReplaceField("tool_input.command", "ls"),
+		"approval-requested": hooksdk.Ask("sure?").AddTelemetry("checked", map[string]any{"n": 1}),
+		"user-prompt-submit": hooksdk.Allow().ReplaceField("prompt", "hi").QueueUserMessage("later"),
+	} {
+		if err := hooksdk.ValidateResponse(eventType, resp); err != nil {
+			t.Errorf("%s: %v", eventType, err)
+		}
+	}
+	// Event types without a response schema aren't checked.
+	if err := hooksdk.ValidateResponse("plan-updated", hooksdk.Ask("?")); err != nil {
+		t.Errorf("unknown event type: %v", err)
+	}
+	if err := hooksdk.ValidateResponse("", hooksdk.Response{Decision: "block"}); err != nil {
+		t.Errorf("no event type: %v", err)
+	}
+}
+
+func TestResponseSchemaFor(t *testing.T) {
+	for eventType := range hooktest.Fixtures() {
+		data, ok := hooksdk.ResponseSchemaFor(eventType)
+		if !ok {
+			t.Errorf("no response schema for %s", eventType)
+			continue
+		}
+		var schema struct {
+			Title                string `json:"title"`
+			AdditionalProperties *bool  `json:"additionalProperties"`
+		}
+		if err := json.Unmarshal(data, &schema); err != nil {
+			t.Errorf("%s: %v", eventType, err)
+		}
+		if schema.Title != "Response "+eventType || schema.AdditionalProperties == nil || *schema.AdditionalProperties {
+			t.Errorf("%s: title %q, additionalProperties %v", eventType, schema.Title, schema.AdditionalProperties)
+		}
+	}
+	for _, eventType := range []string{"plan-updated", "", "../session-start"} {
+		if _, ok := hooksdk.ResponseSchemaFor(eventType); ok {
+			t.Errorf("ResponseSchemaFor(%q) found a schema", eventType)
+		}
+	}
+}
+
+// TestWriteResponseValidates checks that a response that doesn't match its schema is written with
+// a warning, or in debug mode not written at all.
+func TestWriteResponseValidates(t *testing.T) {
+	bad := hooksdk.Ask("sure?")
+	for _, debug := range []string{"", "1"} {
+		var stdout, stderr bytes.Buffer
+		env := map[string]string{hooksdk.EventTypeEnv: "session-start", hooksdk.DebugEnv: debug}
+		s := hooksdk.IO{Out: &stdout, Err: &stderr, Getenv: func(k string) string { return env[k] }}
+		err := hooksdk.WriteResponse(bad, hooksdk.WithIO(s))
+		if debug == "" {
+			if err != nil || !strings.Contains(stdout.String(), `"decision":"ask"`) || !strings.Contains(stderr.String(), "validate_response") {
+				t.Errorf("lenient: err %v, stdout %q, stderr %q", err, stdout.String(), stderr.String())
+			}
+			continue
+		}
+		var se *hooksdk.SchemaError
+		if !errors.As(err, &se) || se.EventType != "session-start" || !se.Response || stdout.Len() != 0 {
+			t.Errorf("debug: err %v, stdout %q", err, stdout.String())
+		}
+	}
+
+	// Run checks against the event it read.
+	handler := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) { return bad, nil }
+	res := hooktest.RunHook(t, handler, hooktest.SessionStart().Bytes())
+	if res.ExitCode != hooksdk.ExitOK || res.Response.Decision != hooksdk.DecisionAsk || !strings.Contains(res.Stderr, `"validate_response"`) {
+		t.Errorf("Run: %+v", res)
+	}
+	if res := hooktest.RunHook(t, handler, hooktest.ToolCallStarted().Bytes()); strings.Contains(res.Stderr, "validate_response") {
+		t.Errorf("Run warned about a valid response: %s", res.Stderr)
+	}
+	t.Setenv(hooksdk.DebugEnv, "1")
+	if res := hooktest.RunHook(t, handler, hooktest.SessionStart().Bytes()); res.ExitCode != hooksdk.ExitError || res.Stdout != "" || !strings.Contains(res.Stderr, "debug mode is on") {
+		t.Errorf("Run in debug mode: %+v", res)
+	}
+}
@@ -0,0 +1,210 @@
+package secrets
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/minitoml"
+)
+
+// Config adds detectors and exclusions, usually loaded from a TOML file:
+//
+//	disable_builtin = ["high-entropy-token"]
+//	skip_paths = ["*.lock", "testdata/"]
+//
+//	[[detector]]
+//	name = "internal-token"
+//	regex = 'itk_[a-z0-9]{32}'
+//
+//	[[detector]]
+//	name = "db-url-password"
+//	regex = 'postgres://[^:/]+:([^@]+)@'
+//	group = 1                     # only the password is the secret
+type Config struct {
+	DisableBuiltin []string
+	SkipPaths      []string
+	Detectors      []Detector
+}
+
+// LoadConfig reads a config file. A missing file yields an empty Config.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses TOML config text.
+func ParseConfig(data string) (*Config, error) {
+	doc, err := minitoml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	for key, v := range doc {
+		switch key {
+		case "disable_builtin":
+			if cfg.DisableBuiltin, err = stringList(key, v); err != nil {
+				return nil, err
+			}
+			for _, name := range cfg.DisableBuiltin {
+				if !isBuiltin(name) {
+					return nil, fmt.Errorf("disable_builtin: no built-in detector %q", name)
+				}
+			}
+		case "skip_paths":
+			if cfg.SkipPaths, err = stringList(key, v); err != nil {
+				return nil, err
+			}
+		case "detector":
+			tables, ok := v.([]map[string]any)
+			if !ok {
+				return nil, errors.New("detector must be an array of tables ([[detector]])")
+			}
+			for n, t := range tables {
+				d, err := parseDetector(t)
+				if err != nil {
+					return nil, fmt.Errorf("detector %d: %w", n+1, err)
+				}
+				cfg.Detectors = append(cfg.Detectors, d)
+			}
+		default:
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	return cfg, nil
+}
+
+func parseDetector(t map[string]any) (Detector, error) {
+	var d Detector
+	for key, v := range t {
+		switch key {
+		case "name":
+			s, ok := v.(string)
+			if !ok {
+				return Detector{}, errors.New("name must be a string")
+			}
+			d.Name = s
+		case "regex":
+			s, ok := v.(string)
+			if !ok {
+				return Detector{}, errors.New("regex must be a string")
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				return Detector{}, err
+			}
+			d.Regex = re
+		case "group":
+			n, ok := v.(int64)
+			if !ok || n < 0 {
+				return Detector{}, errors.New("group must be a non-negative integer")
+			}
+			d.Group = int(n)
+		default:
+			return Detector{}, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	switch {
+	case d.Name == "":
+		return Detector{}, errors.New("needs a name")
+	case d.Regex == nil:
+		return Detector{}, errors.New("needs a regex")
+	case d.Group > d.Regex.NumSubexp():
+		return Detector{}, fmt.Errorf("group %d, but the regex has %d", d.Group, d.Regex.NumSubexp())
+	}
+	return d, nil
+}
+
+func stringList(key string, v any) ([]string, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of strings", key)
+	}
+	out := make([]string, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an array of strings", key)
+		}
+		out[i] = s
+	}
+	return out, nil
+}
+
+func isBuiltin(name string) bool {
+	for _, d := range Builtins {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowlist is a set of finding fingerprints that are known false positives.
+//
+// On disk it is a text file with one fingerprint per line; anything after `#` is a comment
+// (AddToAllowlist writes its note there).
+type Allowlist map[string]bool
+
+// LoadAllowlist reads an allowlist file. A missing file yields an empty Allowlist.
+func LoadAllowlist(path string) (Allowlist, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Allowlist{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	a := Allowlist{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if fp := strings.TrimSpace(line); fp != "" {
+			a[fp] = true
+		}
+	}
+	return a, sc.Err()
+}
+
+// AddToAllowlist appends fingerprint to the allowlist file at path, creating it if needed, with
+// note as a comment.
+func AddToAllowlist(path, fingerprint, note string) error {
+	fingerprint = strings.TrimSpace(fingerprint)
+	if _, err := hex.DecodeString(fingerprint); err != nil || len(fingerprint) != 16 {
+		return fmt.Errorf("invalid fingerprint %q (want 16 hex digits)", fingerprint)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	line := fingerprint
+	if note = strings.ReplaceAll(note, "\n", " "); note != "" {
+		line += "  # " + note
+	}
+	_, err = f.WriteString(line + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package secrets_test
+
+import (
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/secrets"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := secrets.ParseConfig(`
+disable_builtin = ["high-entropy-token"]
+skip_paths = ["*.lock"]
+
+[[detector]]
+name = "internal-token"
+regex = 'itk_([a-z0-9]{12})'
+group = 1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := secrets.New(cfg, nil)
+	findings := s.Scan([]secrets.Change{secrets.WholeFile("a.go", `t := "itk_abcdef123456"; k := "q8Zr3vK1xP0wLm7Tn4Yb6Hc2Jd9Fs5Ga"`)})
+	if got := detectors(findings); got != "internal-token" {
+		t.Errorf("detectors = %q, want the user's only", got)
+	}
+	if want := secrets.Fingerprint("internal-token", "a.go", "abcdef123456"); findings[0].Fingerprint != want {
+		t.Errorf("fingerprint is not of the group: %s, want %s", findings[0].Fingerprint, want)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		config, want string
+	}{
+		{`disable_builtin = ["nope"]`, `no built-in detector "nope"`},
+		{`skip_paths = "*.lock"`, "skip_paths must be an array of strings"},
+		{`colour = "red"`, `unknown setting "colour"`},
+		{"[detector]\nname = \"x\"", "array of tables"},
+		{"[[detector]]\nregex = \"x\"", "detector 1: needs a name"},
+		{"[[detector]]\nname = \"x\"", "detector 1: needs a regex"},
+		{"[[detector]]\nname = \"x\"\nregex = \"(\"", "detector 1:"},
+		{"[[detector]]\nname = \"x\"\nregex = \"(a)\"\ngroup = 2", "group 2, but the regex has 1"},
+		{"[[detector]]\nname = \"x\"\nregex = \"a\"\nflags = \"i\"", `unknown key "flags"`},
+	}
+	for _, tt := range tests {
+		_, err := secrets.ParseConfig(tt.config)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseConfig(%q) = %v, want an error containing %q", tt.config, err, tt.want)
+		}
+	}
+}
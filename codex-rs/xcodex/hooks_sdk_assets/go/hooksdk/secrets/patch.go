@@ -0,0 +1,166 @@
+package secrets
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Change is the content a patch or write adds to one file.
+type Change struct {
+	Path  string
+	Added []Line
+	// Binary is set for binary patches and for content with NUL bytes or invalid UTF-8; Scan
+	// skips such files.
+	Binary bool
+}
+
+// Line is one added line.
+type Line struct {
+	// N is the line number in the new file, or 0 when the patch doesn't say (apply_patch update
+	// hunks carry no line numbers).
+	N int
+	// PatchLine is the 1-based line number within the patch or written content.
+	PatchLine int
+	Text      string
+}
+
+// ParsePatch extracts the added lines per file from an apply_patch patch (`*** Begin Patch`) or
+// a unified diff. Deleted files contribute nothing.
+func ParsePatch(patch string) []Change {
+	if strings.Contains(patch, "*** Begin Patch") {
+		return parseApplyPatch(patch)
+	}
+	return parseUnifiedDiff(patch)
+}
+
+// WholeFile is the Change for writing content to path.
+func WholeFile(path, content string) Change {
+	c := Change{Path: path}
+	for i, text := range splitLines(content) {
+		c.add(Line{N: i + 1, PatchLine: i + 1, Text: text})
+	}
+	return c
+}
+
+func (c *Change) add(l Line) {
+	if strings.IndexByte(l.Text, 0) >= 0 || !utf8.ValidString(l.Text) {
+		c.Binary = true
+	}
+	c.Added = append(c.Added, l)
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+func parseApplyPatch(patch string) []Change {
+	var changes []Change
+	var cur *Change
+	newFile, n := false, 0
+	for i, line := range splitLines(patch) {
+		if rest, ok := strings.CutPrefix(line, "*** "); ok {
+			switch {
+			case strings.HasPrefix(rest, "Add File: "):
+				changes = append(changes, Change{Path: strings.TrimSpace(strings.TrimPrefix(rest, "Add File: "))})
+				cur, newFile, n = &changes[len(changes)-1], true, 0
+				continue
+			case strings.HasPrefix(rest, "Update File: "):
+				changes = append(changes, Change{Path: strings.TrimSpace(strings.TrimPrefix(rest, "Update File: "))})
+				cur, newFile = &changes[len(changes)-1], false
+				continue
+			case strings.HasPrefix(rest, "Move to: ") && cur != nil:
+				cur.Path = strings.TrimSpace(strings.TrimPrefix(rest, "Move to: "))
+				continue
+			case strings.HasPrefix(rest, "Delete File: "):
+				cur = nil
+				continue
+			case rest == "Begin Patch" || rest == "End Patch" || rest == "End of File":
+				continue
+			}
+		}
+		if cur == nil || !strings.HasPrefix(line, "+") {
+			continue
+		}
+		l := Line{PatchLine: i + 1, Text: line[1:]}
+		if newFile {
+			n++
+			l.N = n
+		}
+		cur.add(l)
+	}
+	return nonEmpty(changes)
+}
+
+func parseUnifiedDiff(patch string) []Change {
+	var changes []Change
+	var cur *Change
+	lines := splitLines(patch)
+	n := 0
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			// A binary file's section has no ---/+++ header; its marker mustn't flag the file
+			// before it.
+			cur = nil
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			i++
+			path := strings.TrimSpace(strings.TrimPrefix(lines[i], "+++ "))
+			if tab := strings.IndexByte(path, '\t'); tab >= 0 {
+				path = path[:tab]
+			}
+			if path == "/dev/null" {
+				cur = nil
+				continue
+			}
+			changes = append(changes, Change{Path: strings.TrimPrefix(path, "b/")})
+			cur = &changes[len(changes)-1]
+		case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+			if cur != nil {
+				cur.Binary = true
+			}
+		case strings.HasPrefix(line, "@@ "):
+			n = hunkStart(line)
+		case cur == nil:
+		case strings.HasPrefix(line, "+"):
+			cur.add(Line{N: n, PatchLine: i + 1, Text: line[1:]})
+			n++
+		case strings.HasPrefix(line, " ") || line == "":
+			n++
+		}
+	}
+	return nonEmpty(changes)
+}
+
+// hunkStart returns the new-file start line of a `@@ -a,b +c,d @@` header.
+func hunkStart(header string) int {
+	_, rest, ok := strings.Cut(header, " +")
+	if !ok {
+		return 0
+	}
+	end := strings.IndexAny(rest, ", ")
+	if end < 0 {
+		end = len(rest)
+	}
+	n, _ := strconv.Atoi(rest[:end])
+	return n
+}
+
+func nonEmpty(changes []Change) []Change {
+	out := changes[:0]
+	for _, c := range changes {
+		if len(c.Added) > 0 || c.Binary {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package secrets_test
+
+import (
+	"fmt"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/secrets"
+)
+
+// summary shows each change as its path and added lines, `N:text`, with Binary marked.
+func summary(changes []secrets.Change) []string {
+	var out []string
+	for _, c := range changes {
+		s := c.Path
+		if c.Binary {
+			s += " (binary)"
+		}
+		for _, l := range c.Added {
+			s += fmt.Sprintf(" %d:%s", l.N, l.Text)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestParseApplyPatch(t *testing.T) {
+	patch := `*** Begin Patch
+*** Add File: config/.env
++DEBUG=1
++API_KEY=abc
+*** Update File: src/main.go
+@@ func main() {
+-	old()
++	new()
+ }
+*** Delete File: gone.txt
+*** Update File: a.txt
+*** Move to: b.txt
+@@
++moved
+*** End Patch`
+	got := summary(secrets.ParsePatch(patch))
+	// Lines added to an existing file have no known line number.
+	want := []string{"config/.env 1:DEBUG=1 2:API_KEY=abc", "src/main.go 0:\tnew()", "b.txt 0:moved"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ParsePatch = %q, want %q", got, want)
+	}
+}
+
+func TestParseUnifiedDiff(t *testing.T) {
+	patch := `diff --git a/app.py b/app.py
+--- a/app.py
++++ b/app.py
+@@ -10,3 +10,4 @@ def f():
+ x = 1
+-y = 2
++y = 3
++z = 4
+ w = 5
+diff --git a/logo.png b/logo.png
+Binary files a/logo.png and b/logo.png differ
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+--- /dev/null
++++ b/new.txt	2024-01-01
+@@ -0,0 +1,2 @@
++one
++two
+`
+	got := summary(secrets.ParsePatch(patch))
+	want := []string{"app.py 11:y = 3 12:z = 4", "new.txt 1:one 2:two"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ParsePatch = %q, want %q", got, want)
+	}
+}
+
+func TestWholeFileBinary(t *testing.T) {
+	if c := secrets.WholeFile("a.txt", "one\r\ntwo\n"); c.Binary || fmt.Sprint(summary([]secrets.Change{c})) != "[a.txt 1:one 2:two]" {
+		t.Errorf("WholeFile = %q", summary([]secrets.Change{c}))
+	}
+	for _, content := range []string{"PNG\x00\x01\x02", "caf\xe9"} {
+		if c := secrets.WholeFile("blob", content); !c.Binary {
+			t.Errorf("WholeFile(%q) isn't binary", content)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Package secrets finds credentials in the lines a patch or file write adds, for hooks that stop
+// the agent from committing them.
+//
+//	changes := secrets.ParsePatch(patch)
+//	for _, f := range secrets.New(cfg, allow).Scan(changes) {
+//		fmt.Println(f.Location(), f.Detector, f.Fingerprint)
+//	}
+//
+// Every finding has a fingerprint (a hash of the detector, the path, and the matched text), so a
+// known false positive can be allowlisted without storing the secret itself.
+package secrets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/redact"
+)
+
+// Detector finds one kind of secret.
+type Detector struct {
+	Name  string
+	Regex *regexp.Regexp
+	// Group is the capture group holding the secret; 0 means the whole match.
+	Group int
+	// Valid, when set, rejects matches that aren't secrets after all (placeholders, low entropy).
+	Valid func(secret string) bool
+}
+
+// Builtins are the detectors every Scanner starts with; Config.DisableBuiltin turns them off by
+// name.
+var Builtins = []Detector{
+	{Name: "aws-access-key-id", Regex: regexp.MustCompile(`\b(?:AKIA|ASIA|AIDA|AROA|AIPA|ANPA|ANVA|AGPA)[0-9A-Z]{16}\b`)},
+	{
+		Name:  "aws-secret-access-key",
+		Regex: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})(?:[^A-Za-z0-9/+]|$)`),
+		Group: 1,
+	},
+	{Name: "private-key", Regex: regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+	{Name: "github-token", Regex: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{Name: "slack-token", Regex: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+	{
+		Name:  "env-assignment",
+		Regex: regexp.MustCompile(`^\s*(?:export\s+)?[A-Z0-9_]*(?:SECRET|TOKEN|PASSWORD|PASSWD|API_?KEY|PRIVATE_?KEY|ACCESS_?KEY|CREDENTIALS?)[A-Z0-9_]*\s*=\s*["']?([^\s"'#]{8,})`),
+		Group: 1,
+		Valid: notPlaceholder,
+	},
+	{Name: "high-entropy-token", Regex: regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`), Valid: redact.LooksRandom},
+}
+
+// placeholders are values of documented-but-unset settings, not secrets.
+var placeholders = []string{"changeme", "change_me", "example", "placeholder", "your_", "your-", "redacted", "dummy", "xxxx", "****", "replace"}
+
+func notPlaceholder(v string) bool {
+	if strings.ContainsAny(v, "$<>{}()[]") {
+		return false
+	}
+	lower := strings.ToLower(v)
+	for _, p := range placeholders {
+		if strings.Contains(lower, p) {
+			return false
+		}
+	}
+	return strings.Trim(v, v[:1]) != ""
+}
+
+// Finding is a suspected secret.
+type Finding struct {
+	Path string
+	// Line is the line number in the new file, or 0 when unknown (see Line.N).
+	Line      int
+	PatchLine int
+	Detector  string
+	// Fingerprint identifies the finding for an Allowlist.
+	Fingerprint string
+}
+
+// Location is `path:line`, or `path (patch line N)` when the file line is unknown.
+func (f Finding) Location() string {
+	if f.Line > 0 {
+		return f.Path + ":" + strconv.Itoa(f.Line)
+	}
+	return f.Path + " (patch line " + strconv.Itoa(f.PatchLine) + ")"
+}
+
+// Fingerprint is the allowlist key for secret found by detector in path.
+func Fingerprint(detector, path, secret string) string {
+	sum := sha256.Sum256([]byte(detector + "\x00" + path + "\x00" + secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Scanner runs detectors over changes.
+type Scanner struct {
+	Detectors []Detector
+	// SkipPaths are globs of files not to scan (see Config).
+	SkipPaths []string
+	Allowlist Allowlist
+}
+
+// New returns a Scanner for cfg (nil means the built-in detectors only) and allowlist.
+func New(cfg *Config, allowlist Allowlist) *Scanner {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	s := &Scanner{SkipPaths: cfg.SkipPaths, Allowlist: allowlist}
+	for _, d := range Builtins {
+		if !contains(cfg.DisableBuiltin, d.Name) {
+			s.Detectors = append(s.Detectors, d)
+		}
+	}
+	s.Detectors = append(s.Detectors, cfg.Detectors...)
+	return s
+}
+
+// Scan returns the findings in changes that aren't allowlisted, skipping binary files and
+// SkipPaths. A span claimed by one detector isn't reported again by a later one.
+func (s *Scanner) Scan(changes []Change) []Finding {
+	var out []Finding
+	for _, c := range changes {
+		if c.Binary || s.skipped(c.Path) {
+			continue
+		}
+		for _, l := range c.Added {
+			var claimed [][2]int
+			for _, d := range s.Detectors {
+				for _, m := range d.Regex.FindAllStringSubmatchIndex(l.Text, -1) {
+					start, end := m[0], m[1]
+					if g := 2 * d.Group; g+1 < len(m) && m[g] >= 0 {
+						start, end = m[g], m[g+1]
+					}
+					if overlaps(claimed, start, end) {
+						continue
+					}
+					secret := l.Text[start:end]
+					if d.Valid != nil && !d.Valid(secret) {
+						continue
+					}
+					claimed = append(claimed, [2]int{start, end})
+					fp := Fingerprint(d.Name, c.Path, secret)
+					if s.Allowlist[fp] {
+						continue
+					}
+					out = append(out, Finding{Path: c.Path, Line: l.N, PatchLine: l.PatchLine, Detector: d.Name, Fingerprint: fp})
+				}
+			}
+		}
+	}
+	return out
+}
+
+func overlaps(spans [][2]int, start, end int) bool {
+	for _, s := range spans {
+		if start < s[1] && s[0] < end {
+			return true
+		}
+	}
+	return false
+}
+
+// skipped reports whether p matches a SkipPaths glob. Globs without a slash match the base name;
+// a glob ending in `/` matches everything under that directory.
+func (s *Scanner) skipped(p string) bool {
+	p = strings.ReplaceAll(p, `\`, "/")
+	for _, glob := range s.SkipPaths {
+		if dir, ok := strings.CutSuffix(glob, "/"); ok {
+			if strings.HasPrefix(p, dir+"/") || strings.Contains(p, "/"+dir+"/") {
+				return true
+			}
+			continue
+		}
+		target := p
+		if !strings.Contains(glob, "/") {
+			target = path.Base(p)
+		}
+		if ok, _ := path.Match(glob, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package hooksdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+)
+
+// SelfTestFlag is the argument that makes Run check the hook's environment instead of handling an
+// event (see WithSelfTest).
+const SelfTestFlag = "--self-test"
+
+// selfTestTimeout bounds each check that talks to the network.
+const selfTestTimeout = 5 * time.Second
+
+// ErrSkipped is returned (wrapped, with the reason) by a Check that doesn't apply, e.g. to an
+// output that isn't configured. SelfTest reports it as SKIP rather than FAIL.
+var ErrSkipped = errors.New("skipped")
+
+// Check is one test of SelfTest. Name says what is expected, e.g. "SMTP server smtp.example.com:587
+// is reachable"; Run returns nil when it is.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context, env Env) error
+}
+
+// WithSelfTest makes Run answer `hook --self-test` with a report of checks, after the CODEX_HOME
+// check every self-test starts with, instead of reading an event. checks is only called then, so
+// building the checks (loading the config, say) costs nothing on ordinary events. Without this
+// option `--self-test` runs the CODEX_HOME check alone.
+func WithSelfTest(checks func() []Check) Option {
+	return func(o *options) { o.selfTest = checks }
+}
+
+// SelfTestRequested reports whether the process was started with SelfTestFlag, for hooks whose
+// main doesn't go through Run.
+func SelfTestRequested() bool {
+	return len(os.Args) > 1 && os.Args[1] == SelfTestFlag
+}
+
+// SelfTest runs CheckCodexHome and checks, prints a PASS/FAIL line for each to stdout, and exits
+// with ExitError if any failed (ExitOK otherwise). The failures are also logged to stderr as one
+// structured line, listing each (see MultiError).
+func SelfTest(checks ...Check) {
+	ctx, stop := SignalContext()
+	code := IO{}.SelfTest(ctx, checks...)
+	stop()
+	os.Exit(code)
+}
+
+// SelfTest is SelfTest with the streams and environment of s, returning the exit code, so tests
+// can run a hook's checks against an environment of their choosing.
+func (s IO) SelfTest(ctx context.Context, checks ...Check) int {
+	env := s.Environ()
+	out := s.out()
+	name := env.HookName
+	if name == "" {
+		name = hooklog.HookName()
+	}
+	fmt.Fprintf(out, "self-test of %s\n", name)
+	var passed, skipped int
+	var failed MultiError
+	for _, c := range append([]Check{CheckCodexHome()}, checks...) {
+		err := c.Run(ctx, env)
+		switch {
+		case err == nil:
+			passed++
+			fmt.Fprintf(out, "PASS  %s\n", c.Name)
+		case errors.Is(err, ErrSkipped):
+			skipped++
+			fmt.Fprintf(out, "SKIP  %s: %v\n", c.Name, err)
+		default:
+			failed.Add(c.Name, fmt.Errorf("%s: %w", c.Name, err), true)
+			fmt.Fprintf(out, "FAIL  %s: %v\n", c.Name, err)
+		}
+	}
+	fmt.Fprintf(out, "%d passed, %d failed, %d skipped\n", passed, len(failed.Failures), skipped)
+	if err := failed.Err(); err != nil {
+		writeErrorLine(s.err(), "self_test", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// runSelfTest runs the checks of WithSelfTest for RunIO.
+func (o *options) runSelfTest(ctx context.Context, stdout io.Writer) int {
+	var checks []Check
+	if o.selfTest != nil {
+		checks = o.selfTest()
+	}
+	s := o.stdio
+	s.Out = stdout
+	return s.SelfTest(ctx, checks...)
+}
+
+// CheckCodexHome checks that CODEX_HOME (or its fallback, see Env.CodexHome) is an existing
+// directory, where the host looks for hooks and their config.
+func CheckCodexHome() Check {
+	return Check{
+		Name: "CODEX_HOME is a directory",
+		Run: func(ctx context.Context, env Env) error {
+			if env.CodexHomeErr != nil {
+				return env.CodexHomeErr
+			}
+			if !filepath.IsAbs(env.CodexHome) {
+				return fmt.Errorf("%q is not an absolute path", env.CodexHome)
+			}
+			info, err := os.Stat(env.CodexHome)
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", env.CodexHome)
+			}
+			return nil
+		},
+	}
+}
+
+// CheckConfig reports the result of loading the hook's config (see LoadConfig): err is what that
+// returned.
+func CheckConfig(name string, err error) Check {
+	return CheckConfigFile(ConfigPath(name), err)
+}
+
+// CheckConfigFile is CheckConfig for a config read from path, such as one read with
+// LoadConfigFile or a parser of its own.
+func CheckConfigFile(path string, err error) Check {
+	return Check{
+		Name: "config " + path + " is valid",
+		Run:  func(context.Context, Env) error { return err },
+	}
+}
+
+// CheckWritable checks that the file at path can be created or appended to: that it, or its
+// nearest existing parent directory (the hook creates the rest), is writable. The test file it
+// creates in the directory is removed again.
+func CheckWritable(label, path string) Check {
+	return Check{
+		Name: checkName(label, path, "is writable"),
+		Run: func(context.Context, Env) error {
+			if path == "" {
+				return fmt.Errorf("%w: no path set", ErrSkipped)
+			}
+			if info, err := os.Stat(path); err == nil {
+				if info.IsDir() {
+					return writableDir(path)
+				}
+				f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+				if err != nil {
+					return err
+				}
+				return f.Close()
+			}
+			dir := filepath.Dir(path)
+			for {
+				info, err := os.Stat(dir)
+				if err == nil {
+					if !info.IsDir() {
+						return fmt.Errorf("%s is not a directory", dir)
+					}
+					return writableDir(dir)
+				}
+				parent := filepath.Dir(dir)
+				if parent == dir {
+					return err
+				}
+				dir = parent
+			}
+		},
+	}
+}
+
+// checkName is "label subject claim", leaving out a subject that is empty or the label itself.
+func checkName(label, subject, claim string) string {
+	if subject == "" || subject == label {
+		return label + " " + claim
+	}
+	return label + " " + subject + " " + claim
+}
+
+// writableDir creates and removes a file in dir.
+func writableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".hook-self-test-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// CheckHTTP checks that rawURL answers a HEAD request. Any HTTP response counts, since endpoints
+// that only take POST often refuse HEAD; only failing to connect (or a TLS error) fails. An empty
+// rawURL is skipped. The report leaves out the URL's query and user info.
+func CheckHTTP(label, rawURL string) Check {
+	return Check{
+		Name: checkName(label, redactURL(rawURL), "is reachable"),
+		Run: func(ctx context.Context, env Env) error {
+			if rawURL == "" {
+				return fmt.Errorf("%w: no URL set", ErrSkipped)
+			}
+			ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+			if err == nil {
+				var resp *http.Response
+				if resp, err = http.DefaultClient.Do(req); err == nil {
+					resp.Body.Close()
+				}
+			}
+			var uerr *url.Error
+			if errors.As(err, &uerr) {
+				uerr.URL = redactURL(uerr.URL)
+			}
+			return err
+		},
+	}
+}
+
+// redactURL drops the query and any user info from u for the report: webhook URLs often carry a
+// token.
+func redactURL(u string) string {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	if scheme, rest, ok := strings.Cut(u, "://"); ok {
+		if at := strings.LastIndex(strings.SplitN(rest, "/", 2)[0], "@"); at >= 0 {
+			u = scheme + "://" + rest[at+1:]
+		}
+	}
+	return u
+}
+
+// CheckDial checks that a connection to addr can be opened, e.g. CheckDial("SMTP server", "tcp",
+// "smtp.example.com:587"), or ("hookd", "unix", socket). An empty addr is skipped.
+func CheckDial(label, network, addr string) Check {
+	return Check{
+		Name: checkName(label, addr, "is reachable"),
+		Run: func(ctx context.Context, env Env) error {
+			if addr == "" {
+				return fmt.Errorf("%w: no address set", ErrSkipped)
+			}
+			d := net.Dialer{Timeout: selfTestTimeout}
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+	}
+}
+
+// CheckCommand checks that the program the hook runs is found on PATH (or exists, as a path). An
+// empty name is skipped.
+func CheckCommand(label, name string) Check {
+	return Check{
+		Name: checkName(label, name, "is installed"),
+		Run: func(context.Context, Env) error {
+			if name == "" {
+				return fmt.Errorf("%w: no command set", ErrSkipped)
+			}
+			_, err := exec.LookPath(name)
+			return err
+		},
+	}
+}
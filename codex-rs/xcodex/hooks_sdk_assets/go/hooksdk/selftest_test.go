@@ -0,0 +1,234 @@
+package hooksdk_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// selfTestMain is the hook HOOKSDK_TEST_SELF_TEST runs: one with a check of its own that fails
+// when that variable is "fail".
+func selfTestMain() {
+	hooksdk.Run(func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		return hooksdk.Deny("handled"), nil
+	}, hooksdk.WithSelfTest(func() []hooksdk.Check {
+		return []hooksdk.Check{{Name: "custom check", Run: func(context.Context, hooksdk.Env) error {
+			if os.Getenv("HOOKSDK_TEST_SELF_TEST") == "fail" {
+				return errors.New("broken on purpose")
+			}
+			return nil
+		}}}
+	}))
+}
+
+// runCheck runs c with CODEX_HOME set to home.
+func runCheck(c hooksdk.Check, home string) error {
+	stdio, _, _ := testIO(nil, map[string]string{"CODEX_HOME": home})
+	return c.Run(context.Background(), stdio.Environ())
+}
+
+func TestIOSelfTest(t *testing.T) {
+	home := t.TempDir()
+	fail := hooksdk.Check{Name: "database is up", Run: func(context.Context, hooksdk.Env) error { return errors.New("connection refused") }}
+	skip := hooksdk.Check{Name: "webhook is reachable", Run: func(context.Context, hooksdk.Env) error {
+		return fmt.Errorf("%w: no URL set", hooksdk.ErrSkipped)
+	}}
+	pass := hooksdk.Check{Name: "works", Run: func(context.Context, hooksdk.Env) error { return nil }}
+
+	stdio, out, errOut := testIO(nil, map[string]string{"CODEX_HOME": home, "CODEX_HOOK_NAME": "checked"})
+	if code := stdio.SelfTest(context.Background(), pass, skip, fail); code != hooksdk.ExitError {
+		t.Errorf("exit code = %d, want %d", code, hooksdk.ExitError)
+	}
+	want := "self-test of checked\n" +
+		"PASS  CODEX_HOME is a directory\n" +
+		"PASS  works\n" +
+		"SKIP  webhook is reachable: skipped: no URL set\n" +
+		"FAIL  database is up: connection refused\n" +
+		"2 passed, 1 failed, 1 skipped\n"
+	if out.String() != want {
+		t.Errorf("report =\n%s\nwant\n%s", out, want)
+	}
+	line := errorLine(t, errOut.String())
+	failures, _ := line["failures"].([]any)
+	if line["stage"] != "self_test" || line["error"] != "database is up: connection refused" || len(failures) != 1 {
+		t.Fatalf("stderr line = %v, want the failure logged", line)
+	}
+	if f := failures[0].(map[string]any); f["component"] != "database is up" || f["fatal"] != true {
+		t.Errorf("failure = %v", f)
+	}
+
+	stdio, out, errOut = testIO(nil, map[string]string{"CODEX_HOME": home})
+	if code := stdio.SelfTest(context.Background(), pass, skip); code != hooksdk.ExitOK || errOut.Len() != 0 {
+		t.Errorf("passing self-test: exit code %d, stderr %q\n%s", code, errOut, out)
+	}
+}
+
+func TestCheckCodexHome(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o644)
+	for home, want := range map[string]string{
+		t.TempDir():                           "",
+		filepath.Join(t.TempDir(), "missing"): "no such file",
+		file:                                  "is not a directory",
+		"relative/home":                       "is not an absolute path",
+	} {
+		err := runCheck(hooksdk.CheckCodexHome(), home)
+		if want == "" && err != nil || want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("CODEX_HOME=%s: %v, want %q", home, err, want)
+		}
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "log.jsonl")
+	os.WriteFile(file, nil, 0o644)
+	for name, tt := range map[string]struct {
+		path string
+		ok   bool
+	}{
+		"existing file":      {file, true},
+		"new file":           {filepath.Join(dir, "new.jsonl"), true},
+		"new subdirectories": {filepath.Join(dir, "a", "b", "log.jsonl"), true},
+		"directory":          {dir, true},
+		"under a file":       {filepath.Join(file, "log.jsonl"), false},
+	} {
+		if err := runCheck(hooksdk.CheckWritable("log", tt.path), dir); (err == nil) != tt.ok {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("the check left files behind: %v", entries)
+	}
+	if err := runCheck(hooksdk.CheckWritable("log", ""), dir); !errors.Is(err, hooksdk.ErrSkipped) {
+		t.Errorf("no path: %v, want skipped", err)
+	}
+
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		return
+	}
+	locked := filepath.Join(dir, "locked")
+	os.Mkdir(locked, 0o555)
+	if err := runCheck(hooksdk.CheckWritable("log", filepath.Join(locked, "log.jsonl")), dir); err == nil {
+		t.Error("a read-only directory passed")
+	}
+}
+
+func TestCheckHTTP(t *testing.T) {
+	// Any answer counts, even a refusal of HEAD.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method %s, want HEAD", r.Method)
+		}
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer srv.Close()
+	c := hooksdk.CheckHTTP("webhook", srv.URL+"/hook?token=secret")
+	if err := runCheck(c, ""); err != nil {
+		t.Errorf("reachable: %v", err)
+	}
+	if c.Name != "webhook "+srv.URL+"/hook is reachable" {
+		t.Errorf("name = %q, want the URL without its query", c.Name)
+	}
+
+	// A closed port fails, without the token in the error.
+	closed := closedAddr(t)
+	c = hooksdk.CheckHTTP("webhook", "http://user:pw@"+closed+"/hook?token=secret")
+	err := runCheck(c, "")
+	if err == nil || strings.Contains(err.Error(), "secret") || strings.Contains(err.Error(), "pw") || strings.Contains(c.Name, "pw") {
+		t.Errorf("unreachable: %q: %v", c.Name, err)
+	}
+	if err := runCheck(hooksdk.CheckHTTP("webhook", ""), ""); !errors.Is(err, hooksdk.ErrSkipped) {
+		t.Errorf("no URL: %v, want skipped", err)
+	}
+}
+
+// closedAddr returns a local address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestCheckDial(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if err := runCheck(hooksdk.CheckDial("SMTP server", "tcp", ln.Addr().String()), ""); err != nil {
+		t.Errorf("listening: %v", err)
+	}
+	if err := runCheck(hooksdk.CheckDial("SMTP server", "tcp", closedAddr(t)), ""); err == nil {
+		t.Error("closed port passed")
+	}
+	if err := runCheck(hooksdk.CheckDial("SMTP server", "tcp", ""), ""); !errors.Is(err, hooksdk.ErrSkipped) {
+		t.Errorf("no address: %v, want skipped", err)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	if err := runCheck(hooksdk.CheckCommand("notifier", "no-such-notifier-xyz"), ""); err == nil {
+		t.Error("a missing command passed")
+	}
+	if err := runCheck(hooksdk.CheckCommand("test binary", os.Args[0]), ""); err != nil {
+		t.Errorf("a path: %v", err)
+	}
+	if err := runCheck(hooksdk.CheckCommand("notifier", ""), ""); !errors.Is(err, hooksdk.ErrSkipped) {
+		t.Errorf("no command: %v, want skipped", err)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	home := t.TempDir()
+	c := hooksdk.CheckConfigFile("/etc/hook.toml", errors.New("line 3: bad value"))
+	if err := runCheck(c, home); err == nil || c.Name != "config /etc/hook.toml is valid" {
+		t.Errorf("%s: %v", c.Name, err)
+	}
+	if err := runCheck(hooksdk.CheckConfig("webhook", nil), home); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestRunSelfTest runs a hook process with --self-test, in working and broken environments.
+func TestRunSelfTest(t *testing.T) {
+	run := func(mode, home string) (string, error) {
+		cmd := exec.Command(os.Args[0], hooksdk.SelfTestFlag)
+		cmd.Env = append(os.Environ(), "HOOKSDK_TEST_SELF_TEST="+mode, "CODEX_HOME="+home, "CODEX_HOOK_NAME=checked")
+		// Stdin holds an event, which self-test mode doesn't read.
+		cmd.Stdin = strings.NewReader(string(hooktest.SessionStart().Bytes()))
+		out, err := cmd.Output()
+		return string(out), err
+	}
+	out, err := run("pass", t.TempDir())
+	if err != nil || !strings.Contains(out, "PASS  custom check") || !strings.Contains(out, "2 passed, 0 failed") || strings.Contains(out, "handled") {
+		t.Errorf("working environment: %v\n%s", err, out)
+	}
+	for name, tt := range map[string][2]string{
+		"failing check": {"fail", t.TempDir()},
+		"no CODEX_HOME": {"pass", filepath.Join(t.TempDir(), "missing")},
+	} {
+		out, err := run(tt[0], tt[1])
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || exit.ExitCode() != hooksdk.ExitError || !strings.Contains(out, "FAIL  ") {
+			t.Errorf("%s: %v\n%s", name, err, out)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package hooksdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SocketEnv overrides the socket path used by DefaultSocketPath.
+const SocketEnv = "CODEX_HOOKD_SOCKET"
+
+// connReadTimeout bounds how long a daemon connection may take to send its payload line.
+const connReadTimeout = 30 * time.Second
+
+// DefaultSocketPath returns the socket a hook daemon listens on: CODEX_HOOKD_SOCKET if set,
+// otherwise `hookd.sock` under CODEX_HOME (default `~/.xcodex`).
+func DefaultSocketPath() string {
+	env := Environ()
+	if env.Socket != "" {
+		return env.Socket
+	}
+	return env.Path("hookd.sock")
+}
+
+// daemonReply is the single JSON line the daemon writes back on each connection. It carries
+// exactly what Run would have produced, so the forwarder can replay it.
+type daemonReply struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr,omitempty"`
+}
+
+// Serve runs handler as a long-lived daemon on a unix domain socket, so events don't pay for a
+// process spawn and Go runtime startup each time. The host execs a small forwarder (see Forward)
+// that relays stdin to the socket.
+//
+// Each connection sends one payload (or payload_path envelope) as a single JSON line and gets
+// back one reply line; connections are handled concurrently. A line longer than the max payload
+// size (see WithMaxPayloadBytes) gets an error reply instead of being read to its end. Serve
+// returns after SIGTERM/SIGINT once in-flight events have finished, and removes the socket file.
+// opts apply to each event as for RunIO; with WithReload, the daemon also reloads its config when
+// it changes or on SIGHUP.
+//
+// Unix sockets are also used on Windows (supported since Windows 10 1803).
+func Serve(socketPath string, handler Handler, opts ...Option) error {
+	ctx, stop := SignalContext()
+	defer stop()
+
+	ln, err := listenUnix(socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socketPath)
+	return ServeListener(ctx, ln, handler, opts...)
+}
+
+// ServeListener is like Serve, but accepts connections on ln until ctx is cancelled. ln is closed
+// on return.
+func ServeListener(ctx context.Context, ln net.Listener, handler Handler, opts ...Option) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	if o := newOptions(opts); len(o.reloads) > 0 {
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		defer stopWatch()
+		go watchReloads(o.reloads, DefaultReloadInterval, o.stdio.err())(watchCtx)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveConn(ctx, conn, handler, opts)
+		}()
+	}
+}
+
+func serveConn(ctx context.Context, conn net.Conn, handler Handler, opts []Option) {
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(connReadTimeout))
+	line, err := readFrame(conn, newOptions(opts).maxPayloadBytes)
+	var tooLarge *PayloadTooLargeError
+	if errors.As(err, &tooLarge) {
+		var stderr bytes.Buffer
+		writeErrorLine(&stderr, "read_payload", err)
+		_ = json.NewEncoder(conn).Encode(daemonReply{ExitCode: ExitError, Stderr: stderr.String()})
+		return
+	}
+	if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+		return
+	}
+
+	var stdout, stderr bytes.Buffer
+	// The newline frames the payload; it isn't part of it, nor counted against the limit.
+	code := RunIO(ctx, bytes.NewReader(bytes.TrimSuffix(line, []byte("\n"))), &stdout, &stderr, handler, opts...)
+	_ = json.NewEncoder(conn).Encode(daemonReply{
+		ExitCode: code,
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	})
+}
+
+// readFrame reads the line a connection sends, of at most limit bytes before the newline (any
+// length if limit <= 0), so a peer that never sends one can't make the daemon buffer without end.
+func readFrame(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return bufio.NewReader(r).ReadBytes('\n')
+	}
+	line, err := bufio.NewReader(io.LimitReader(r, limit+1)).ReadBytes('\n')
+	if int64(len(bytes.TrimSuffix(line, []byte("\n")))) > limit {
+		return nil, &PayloadTooLargeError{Source: "socket", Limit: limit}
+	}
+	return line, err
+}
+
+func listenUnix(socketPath string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0o700); err != nil {
+		return nil, err
+	}
+	// A socket file left behind by a crashed daemon would make Listen fail; only remove it if
+	// nothing is answering on it.
+	if _, err := os.Stat(socketPath); err == nil {
+		if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("hook daemon already listening on %s", socketPath)
+		}
+		_ = os.Remove(socketPath)
+	}
+	return net.Listen("unix", socketPath)
+}
+
+// Forward relays stdin to the hook daemon on socketPath and replays its reply: the response goes
+// to stdout, diagnostics to stderr, and the returned value is the exit code the daemon's Run
+// produced. It is the body of the forwarder binary the host execs in daemon mode.
+func Forward(ctx context.Context, socketPath string, stdin io.Reader, stdout, stderr io.Writer) int {
+	reply, err := forward(ctx, socketPath, stdin)
+	if err != nil {
+		writeErrorLine(stderr, "forward", err)
+		return ExitError
+	}
+	_, _ = io.WriteString(stdout, reply.Stdout)
+	_, _ = io.WriteString(stderr, reply.Stderr)
+	return reply.ExitCode
+}
+
+func forward(ctx context.Context, socketPath string, stdin io.Reader) (*daemonReply, error) {
+	data, err := readAllLimit(ctx, stdin, defaultMaxPayloadBytes(), "stdin")
+	if err != nil {
+		return nil, err
+	}
+	// The daemon reads one line per event, so send the payload as compact JSON.
+	var line bytes.Buffer
+	if isBlank(data) {
+		line.WriteString("{}")
+	} else if err := json.Compact(&line, data); err != nil {
+		return nil, fmt.Errorf("%w: stdin is not JSON: %v", ErrInvalidEnvelope, err)
+	}
+	line.WriteByte('\n')
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := conn.Write(line.Bytes()); err != nil {
+		return nil, err
+	}
+	var reply daemonReply
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("read daemon reply: %w", err)
+	}
+	return &reply, nil
+}
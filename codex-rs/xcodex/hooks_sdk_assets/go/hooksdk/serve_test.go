@@ -0,0 +1,127 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// socketPath returns a path for a socket in a temp dir removed when the test ends.
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "hookd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	// Socket paths are limited to about 100 bytes, which t.TempDir can exceed.
+	return filepath.Join(dir, "s")
+}
+
+// serve runs handler on a socket in a temp dir until the test ends, and returns its path.
+func serve(t *testing.T, handler hooksdk.Handler, opts ...hooksdk.Option) string {
+	t.Helper()
+	path := socketPath(t)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- hooksdk.ServeListener(ctx, ln, handler, opts...) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ServeListener: %v", err)
+		}
+	})
+	return path
+}
+
+func allow(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+	return hooksdk.Allow(), nil
+}
+
+func TestServeRejectsOversizedFrame(t *testing.T) {
+	path := serve(t, allow, hooksdk.WithMaxPayloadBytes(1024))
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// More than the limit, and no newline: the daemon must answer rather than keep reading.
+	if _, err := conn.Write(bytes.Repeat([]byte("x"), 4096)); err != nil {
+		t.Fatal(err)
+	}
+	var reply struct {
+		ExitCode int    `json:"exit_code"`
+		Stderr   string `json:"stderr"`
+	}
+	if err := json.NewDecoder(conn).Decode(&reply); err != nil {
+		t.Fatalf("reading the reply: %v", err)
+	}
+	if reply.ExitCode != hooksdk.ExitError || !strings.Contains(reply.Stderr, "exceeds max payload size of 1024 bytes") {
+		t.Errorf("got exit %d, stderr %q; want %d and the size error", reply.ExitCode, reply.Stderr, hooksdk.ExitError)
+	}
+}
+
+func TestServeAcceptsFrameAtLimit(t *testing.T) {
+	payload := hooktest.SessionStart().Bytes()
+	path := serve(t, allow, hooksdk.WithMaxPayloadBytes(int64(len(payload))))
+
+	var stdout, stderr bytes.Buffer
+	code := hooksdk.Forward(context.Background(), path, bytes.NewReader(payload), &stdout, &stderr)
+	if code != hooksdk.ExitOK || !strings.Contains(stdout.String(), `"decision":"allow"`) {
+		t.Errorf("got exit %d, stdout %q, stderr %q", code, stdout.String(), stderr.String())
+	}
+}
+
+// forward sends payload to the daemon on path and returns the exit code and stdout.
+func forward(path string, payload []byte) (int, string) {
+	var stdout, stderr bytes.Buffer
+	code := hooksdk.Forward(context.Background(), path, bytes.NewReader(payload), &stdout, &stderr)
+	return code, stdout.String() + stderr.String()
+}
+
+func TestServeConcurrentConnections(t *testing.T) {
+	const n = 8
+	// Every handler waits until all n events have arrived, which only happens when the daemon
+	// handles connections at the same time.
+	var arrived sync.WaitGroup
+	arrived.Add(n)
+	all := make(chan struct{})
+	go func() { arrived.Wait(); close(all) }()
+	path := serve(t, func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		arrived.Done()
+		select {
+		case <-all:
+			return hooksdk.Deny(p.SessionID()), nil
+		case <-time.After(5 * time.Second):
+			return hooksdk.Response{}, context.DeadlineExceeded
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(session string) {
+			defer wg.Done()
+			code, out := forward(path, hooktest.ToolCallStarted().WithSessionID(session).Bytes())
+			if code != hooksdk.ExitDeny || !strings.Contains(out, `"reason":"`+session+`"`) {
+				t.Errorf("session %s: got exit %d, output %q", session, code, out)
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,106 @@
+//go:build unix
+
+package hooksdk_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// The tests here send SIGTERM to the test process, which a running Serve turns into a shutdown.
+
+// waitForSocket waits for a daemon to answer on path.
+func waitForSocket(t *testing.T, path string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nothing listens on %s", path)
+		}
+	}
+}
+
+func TestServeShutdownOnSIGTERM(t *testing.T) {
+	path := socketPath(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		close(started)
+		<-release
+		return hooksdk.Deny("finished"), nil
+	}
+	served := make(chan error, 1)
+	go func() { served <- hooksdk.Serve(path, handler) }()
+	// Serve handles signals from before it listens.
+	waitForSocket(t, path)
+
+	type result struct {
+		code int
+		out  string
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		code, out := forward(path, hooktest.ToolCallStarted().Bytes())
+		inFlight <- result{code, out}
+	}()
+	<-started
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-served:
+		t.Fatalf("Serve returned with an event in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if res := <-inFlight; res.code != hooksdk.ExitDeny || !strings.Contains(res.out, "finished") {
+		t.Errorf("in-flight event: got exit %d, output %q", res.code, res.out)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve didn't return after SIGTERM")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+}
+
+func TestServeReplacesStaleSocket(t *testing.T) {
+	path := socketPath(t)
+	// A socket file nothing listens on, as a crashed daemon leaves.
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- hooksdk.Serve(path, allow) }()
+	waitForSocket(t, path)
+	if code, out := forward(path, hooktest.SessionStart().Bytes()); code != hooksdk.ExitOK {
+		t.Errorf("got exit %d, output %q", code, out)
+	}
+
+	// A second daemon on the same socket refuses to start.
+	if err := hooksdk.Serve(path, allow); err == nil || !strings.Contains(err.Error(), "already listening") {
+		t.Errorf("second Serve error = %v, want already listening", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package hooksdk
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// ShortIDLen is the length of a ShortID.
+const ShortIDLen = 8
+
+// shortIDEncoding is RFC 4648 base32 in lower case: a-z and 2-7, no padding.
+var shortIDEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// ShortID returns the 8-character id shown for id (a session, turn, or event id) in output meant
+// for people: notification titles, summaries, hooktail, the per-session logs of
+// CODEX_HOOKLOG_SPLIT=session, and hookdigest. It is "" for "".
+//
+// It is the first 40 bits of the SHA-256 digest of id's bytes in lower-case base32 (RFC 4648
+// alphabet, a-z and 2-7), so other tools reproduce it with e.g.
+//
+//	printf %s "$id" | sha256sum | cut -c1-10 | xxd -r -p | base32 | cut -c1-8 | tr A-Z a-z
+//
+// Ids of any form and length get one, and similar ids get unrelated ones. Two ids share one by
+// chance about once in 2^40 pairs, which is rare among the ids of one machine, but ids chosen to
+// collide can be found: a short id names an id for reading, and ResolveShortID lists every id it
+// could stand for.
+func ShortID(id string) string {
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(id))
+	return shortIDEncoding.EncodeToString(sum[:5])
+}
+
+// IsShortID reports whether s has the form of a ShortID (upper case allowed).
+func IsShortID(s string) bool {
+	if len(s) != ShortIDLen {
+		return false
+	}
+	_, err := shortIDEncoding.DecodeString(strings.ToLower(s))
+	return err == nil
+}
+
+// ErrInvalidShortID is returned by ResolveShortID for a string that isn't a ShortID.
+var ErrInvalidShortID = errors.New("not a short id")
+
+// ShortIDMatch is an id ResolveShortID found.
+type ShortIDMatch struct {
+	ID string
+	// Kind is what the id names: "session", "turn", or "event".
+	Kind string
+}
+
+// shortIDFields are the payload fields holding the ids ResolveShortID looks at, by kind.
+var shortIDFields = []struct {
+	kind string
+	keys []string
+}{
+	{"session", []string{"session_id", "thread_id", "thread-id", "session-id"}},
+	{"turn", []string{"turn_id", "turn-id"}},
+	{"event", []string{"event_id", "event-id"}},
+}
+
+// ResolveShortID returns the ids whose ShortID is short, in the order they are first seen in the
+// logs files, read as cmd/hookq reads them. With no files it reads the recent logs in CODEX_HOME:
+// `hooks.jsonl` and the per-session logs in `hooks/sessions`, with their rotated generations.
+//
+// More than one match means a collision, and none that the id is older than the logs kept. Files
+// that can't be read are skipped; the error is the first of their errors when nothing was found.
+func ResolveShortID(short string, files ...string) ([]ShortIDMatch, error) {
+	if !IsShortID(short) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidShortID, short)
+	}
+	short = strings.ToLower(short)
+	if len(files) == 0 {
+		files = recentLogs()
+	}
+	var matches []ShortIDMatch
+	seen := map[ShortIDMatch]bool{}
+	var firstErr error
+	for _, path := range files {
+		err := scanLog(path, func(p map[string]any) {
+			for _, f := range shortIDFields {
+				for _, key := range f.keys {
+					id, ok := p[key].(string)
+					if !ok || id == "" {
+						continue
+					}
+					m := ShortIDMatch{ID: id, Kind: f.kind}
+					if !seen[m] && ShortID(id) == short {
+						seen[m] = true
+						matches = append(matches, m)
+					}
+					break
+				}
+			}
+		})
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, firstErr
+	}
+	return matches, nil
+}
+
+// recentLogs returns the log files in CODEX_HOME, oldest first within each log.
+func recentLogs() []string {
+	e := Environ()
+	files := jsonl.Files(e.Path("hooks.jsonl"))
+	sessions, _ := filepath.Glob(filepath.Join(e.Path("hooks", "sessions"), "*.jsonl"))
+	for _, path := range sessions {
+		files = append(files, jsonl.Files(path)...)
+	}
+	return files
+}
+
+// scanLog calls fn with the payload of each event in the log file at path.
+func scanLog(path string, fn func(p map[string]any)) error {
+	f, err := jsonl.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	var dec jsonl.Decoder
+	return jsonl.ScanRecords(f, func(rec []byte) error {
+		if ev, err := dec.Decode(rec); err == nil && ev.Payload != nil {
+			fn(ev.Payload)
+		}
+		return nil
+	})
+}
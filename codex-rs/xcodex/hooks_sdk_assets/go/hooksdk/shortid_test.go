@@ -0,0 +1,173 @@
+package hooksdk_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+// fixtureLog is a log with wrapped and plain records, lines that aren't events, and two sessions
+// whose ids share a short id (session-300066 and session-1021806, found by brute force).
+const fixtureLog = "testdata/shortid.jsonl"
+
+const fixtureSession = "019a2b3c-4d5e-7f60-8a9b-0c1d2e3f4a5b"
+
+func TestShortID(t *testing.T) {
+	// Vectors from the documented one-liner:
+	//	printf %s "$id" | sha256sum | cut -c1-10 | xxd -r -p | base32 | cut -c1-8 | tr A-Z a-z
+	for id, want := range map[string]string{
+		"":             "",
+		fixtureSession: "olkqrvbm",
+		"turn-7":       "zamw7mji",
+		"evt-42":       "5u3ix3ra",
+		"sess-plain":   "5l6vwyj4",
+	} {
+		if got := hooksdk.ShortID(id); got != want {
+			t.Errorf("ShortID(%q) = %q, want %q", id, got, want)
+		}
+	}
+
+	for s, want := range map[string]bool{
+		"olkqrvbm":  true,
+		"OLKQRVBM":  true,
+		"olkqrvb":   false,
+		"olkqrvbmx": false,
+		"olkqrvb1":  false, // 0, 1, 8, and 9 aren't in the alphabet
+		"olkqrvb=":  false,
+		"":          false,
+	} {
+		if got := hooksdk.IsShortID(s); got != want {
+			t.Errorf("IsShortID(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestShortIDSpread(t *testing.T) {
+	// Ids built to look alike get unrelated short ids: sequential ids, ids one byte apart, long
+	// ids with a shared prefix, and ids that differ only in case, whitespace, or normalization.
+	var ids []string
+	for i := 0; i < 10000; i++ {
+		ids = append(ids, fmt.Sprintf("019a2b3c-4d5e-7f60-8a9b-%012x", i))
+	}
+	base := []byte(fixtureSession)
+	for i := range base {
+		for _, b := range []byte{base[i] ^ 1, base[i] ^ 0x80} {
+			id := append([]byte{}, base...)
+			id[i] = b
+			ids = append(ids, string(id))
+		}
+	}
+	long := strings.Repeat("x", 4096)
+	for i := 0; i < 100; i++ {
+		ids = append(ids, long+fmt.Sprint(i), fmt.Sprint(i)+long)
+	}
+	ids = append(ids, strings.ToUpper(fixtureSession), " "+fixtureSession, fixtureSession+"\x00", "\u00e9", "e\u0301")
+
+	seen := map[string]string{hooksdk.ShortID(fixtureSession): fixtureSession}
+	for _, id := range ids {
+		if id == fixtureSession {
+			continue
+		}
+		short := hooksdk.ShortID(id)
+		if !hooksdk.IsShortID(short) || short != strings.ToLower(short) {
+			t.Fatalf("ShortID(%q) = %q", id, short)
+		}
+		if other, ok := seen[short]; ok {
+			t.Errorf("%q and %q share short id %s", id, other, short)
+		}
+		seen[short] = id
+	}
+}
+
+func TestResolveShortID(t *testing.T) {
+	tests := []struct {
+		short string
+		want  []hooksdk.ShortIDMatch
+	}{
+		{"olkqrvbm", []hooksdk.ShortIDMatch{{ID: fixtureSession, Kind: "session"}}},
+		{"OLKQRVBM", []hooksdk.ShortIDMatch{{ID: fixtureSession, Kind: "session"}}},
+		{"zamw7mji", []hooksdk.ShortIDMatch{{ID: "turn-7", Kind: "turn"}}},
+		{"5u3ix3ra", []hooksdk.ShortIDMatch{{ID: "evt-42", Kind: "event"}}},
+		{"5l6vwyj4", []hooksdk.ShortIDMatch{{ID: "sess-plain", Kind: "session"}}},
+		// A collision lists both ids, in the order they are logged.
+		{hooksdk.ShortID("session-300066"), []hooksdk.ShortIDMatch{{ID: "session-300066", Kind: "session"}, {ID: "session-1021806", Kind: "session"}}},
+		{"aaaaaaaa", nil},
+	}
+	for _, tt := range tests {
+		got, err := hooksdk.ResolveShortID(tt.short, fixtureLog)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ResolveShortID(%s) = %v, %v; want %v", tt.short, got, err, tt.want)
+		}
+	}
+	if hooksdk.ShortID("session-300066") != hooksdk.ShortID("session-1021806") {
+		t.Fatal("the fixture's colliding ids don't collide")
+	}
+
+	// Every id in the log resolves back to itself.
+	for _, id := range []string{fixtureSession, "turn-7", "evt-42", "sess-plain", "session-300066"} {
+		got, err := hooksdk.ResolveShortID(hooksdk.ShortID(id), fixtureLog)
+		if err != nil || len(got) == 0 || got[0].ID != id {
+			t.Errorf("round trip of %q: %v, %v", id, got, err)
+		}
+	}
+
+	for _, s := range []string{"", "olkqrvb", "olkqrvb1", fixtureSession} {
+		if _, err := hooksdk.ResolveShortID(s, fixtureLog); !errors.Is(err, hooksdk.ErrInvalidShortID) {
+			t.Errorf("ResolveShortID(%q) = %v, want ErrInvalidShortID", s, err)
+		}
+	}
+
+	// A missing file is no error, an unreadable one is only when nothing was found.
+	dir := t.TempDir()
+	notFile := filepath.Join(fixtureLog, "hooks.jsonl")
+	if got, err := hooksdk.ResolveShortID("olkqrvbm", filepath.Join(dir, "missing.jsonl"), notFile, fixtureLog); err != nil || len(got) != 1 {
+		t.Errorf("with a bad file: %v, %v", got, err)
+	}
+	if _, err := hooksdk.ResolveShortID("olkqrvbm", notFile); err == nil || !strings.Contains(err.Error(), notFile) {
+		t.Errorf("only a bad file: %v", err)
+	}
+	if got, err := hooksdk.ResolveShortID("olkqrvbm", filepath.Join(dir, "missing.jsonl")); got != nil || err != nil {
+		t.Errorf("only a missing file: %v, %v", got, err)
+	}
+}
+
+func TestResolveShortIDRecentLogs(t *testing.T) {
+	// Without files, the logs in CODEX_HOME: hooks.jsonl, the per-session logs, and their
+	// rotated generations.
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	fixture, err := os.ReadFile(fixtureLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := filepath.Join(home, "hooks", "sessions")
+	if err := os.MkdirAll(sessions, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range map[string]string{
+		filepath.Join(home, "hooks.jsonl.1"):        string(fixture),
+		filepath.Join(home, "hooks.jsonl"):          `{"xcodex_event_type":"session-start","session_id":"active"}` + "\n",
+		filepath.Join(sessions, "r3pp5pmg.jsonl"):   `{"xcodex_event_type":"session-start","session_id":"session-1021806","turn_id":"split"}` + "\n",
+		filepath.Join(sessions, "r3pp5pmg.jsonl.1"): `{"xcodex_event_type":"session-start","session_id":"session-300066"}` + "\n",
+	} {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id, kind := range map[string]string{"active": "session", "turn-7": "turn", "split": "turn"} {
+		got, err := hooksdk.ResolveShortID(hooksdk.ShortID(id))
+		if err != nil || !reflect.DeepEqual(got, []hooksdk.ShortIDMatch{{ID: id, Kind: kind}}) {
+			t.Errorf("%s: %v, %v", id, got, err)
+		}
+	}
+	got, err := hooksdk.ResolveShortID("r3pp5pmg")
+	if err != nil || len(got) != 2 {
+		t.Errorf("collision across the logs: %v, %v", got, err)
+	}
+}
@@ -0,0 +1,135 @@
+package hooksdk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// SecretEnv holds the key(s) for envelope signatures. When it is set and the envelope carries a
+// `signature` (hex HMAC-SHA256 of the payload, optionally prefixed `sha256=`), the payload is
+// verified before parsing and a mismatch fails with ErrBadSignature. The signature covers the
+// payload bytes the hook parses: the inline `payload` as it appears in the envelope, or the
+// payload_path file after decompression. An envelope that also sets `output_path` or `cleanup`
+// must sign them too (see SignEnvelope), since they name files the hook writes and removes.
+//
+// To rotate the secret, list the new and old keys separated by commas; a signature made with any
+// of them is accepted.
+const SecretEnv = "CODEX_HOOK_SECRET"
+
+// SignPayload returns the `signature` for payload under secret, as the host computes it.
+func SignPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignEnvelope returns the `signature` for payload in an envelope that also carries outputPath
+// and cleanup, as the host computes it. The HMAC covers the two fields before the payload; with
+// neither set, it is SignPayload's.
+func SignEnvelope(secret string, payload []byte, outputPath string, cleanup bool) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(signedFields(envelope{outputPath: outputPath, cleanup: cleanup}))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedFields is what a signature covers of the envelope besides the payload: nil without
+// output_path and cleanup, else a tag and the fields as JSON, each ended by a NUL. No payload the
+// host sends (a JSON object or a CBOR map) starts with the tag, so a payload's signature can't be
+// passed off as that of an envelope with output_path.
+func signedFields(env envelope) []byte {
+	if env.outputPath == "" && !env.cleanup {
+		return nil
+	}
+	fields, _ := json.Marshal(struct {
+		Cleanup    bool   `json:"cleanup"`
+		OutputPath string `json:"output_path"`
+	}{env.cleanup, env.outputPath})
+	return append(append([]byte("xcodex-envelope\x00"), fields...), 0)
+}
+
+// checkSignature verifies the envelope's signature of payload (see SecretEnv and
+// RequireSignature).
+func (o *options) checkSignature(payload []byte, env envelope) error {
+	check, err := o.signatureCheck(env)
+	if err != nil || check == nil {
+		return err
+	}
+	check.Write(payload)
+	return check.verify(env)
+}
+
+// signatureCheck returns a check of the envelope's signature, to be written the payload, or nil
+// when there is nothing to check.
+func (o *options) signatureCheck(env envelope) (*sigCheck, error) {
+	keys := signatureKeys(o.stdio.Environ())
+	if len(keys) == 0 {
+		if o.requireSignature {
+			return nil, fmt.Errorf("%w: %s is not set", ErrSignatureMissing, SecretEnv)
+		}
+		return nil, nil
+	}
+	if env.signature == "" {
+		if o.requireSignature {
+			return nil, ErrSignatureMissing
+		}
+		return nil, nil
+	}
+	want, err := hex.DecodeString(strings.TrimPrefix(env.signature, "sha256="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature is not hex", ErrBadSignature)
+	}
+	check := &sigCheck{want: want}
+	for _, key := range keys {
+		check.macs = append(check.macs, hmac.New(sha256.New, []byte(key)))
+	}
+	check.Write(signedFields(env))
+	return check, nil
+}
+
+// sigCheck computes the HMAC of the payload written to it under each key.
+type sigCheck struct {
+	macs []hash.Hash
+	want []byte
+}
+
+func (c *sigCheck) Write(p []byte) (int, error) {
+	for _, mac := range c.macs {
+		mac.Write(p)
+	}
+	return len(p), nil
+}
+
+// verify reports whether the payload written matches the signature under one of the keys.
+func (c *sigCheck) verify(env envelope) error {
+	// Check every key, so the time taken doesn't reveal which one matched.
+	ok := false
+	for _, mac := range c.macs {
+		if hmac.Equal(mac.Sum(nil), c.want) {
+			ok = true
+		}
+	}
+	if !ok {
+		if env.payloadPath != "" {
+			return fmt.Errorf("payload_path %s: %w", env.payloadPath, ErrBadSignature)
+		}
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// signatureKeys returns the keys listed in SecretEnv.
+func signatureKeys(env Env) []string {
+	var keys []string
+	for _, key := range strings.Split(env.Secret, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,190 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// inlineEnvelope returns an envelope carrying payload inline, with fields added.
+func inlineEnvelope(t *testing.T, payload []byte, fields map[string]any) []byte {
+	t.Helper()
+	env := map[string]any{"payload": json.RawMessage(payload)}
+	for k, v := range fields {
+		env[k] = v
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSignedEnvelope(t *testing.T) {
+	payload := hooktest.ToolCallStarted().WithSessionID("signed").Bytes()
+	t.Setenv(hooksdk.SecretEnv, "new-key, old-key")
+	for _, key := range []string{"new-key", "old-key"} {
+		p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(hooktest.SignedEnvelope(t, payload, key)), hooksdk.RequireSignature())
+		if err != nil || p.SessionID() != "signed" {
+			t.Errorf("signed with %s: %v, %v", key, p, err)
+		}
+	}
+	prefixed := inlineEnvelope(t, payload, map[string]any{"signature": "sha256=" + hooksdk.SignPayload("old-key", payload)})
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(prefixed)); err != nil {
+		t.Errorf("sha256= signature: %v", err)
+	}
+}
+
+func TestBadSignature(t *testing.T) {
+	payload := hooktest.ToolCallStarted().Bytes()
+	good := hooksdk.SignPayload("key", payload)
+	t.Setenv(hooksdk.SecretEnv, "key")
+	for name, stdin := range map[string][]byte{
+		"wrong key": hooktest.SignedEnvelope(t, payload, "other-key"),
+		"tampered":  inlineEnvelope(t, hooktest.ToolCallStarted().WithCommand("rm -rf /").Bytes(), map[string]any{"signature": good}),
+		"truncated": inlineEnvelope(t, payload, map[string]any{"signature": good[:len(good)-2]}),
+		"not hex":   inlineEnvelope(t, payload, map[string]any{"signature": "zz" + good[2:]}),
+		"empty key": inlineEnvelope(t, payload, map[string]any{"signature": hooksdk.SignPayload("", payload)}),
+	} {
+		if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin)); !errors.Is(err, hooksdk.ErrBadSignature) {
+			t.Errorf("%s: error = %v, want ErrBadSignature", name, err)
+		}
+	}
+}
+
+func TestSignatureCoversPayloadFile(t *testing.T) {
+	payload := hooktest.SessionStart().WithSessionID("from-file").Bytes()
+	t.Setenv(hooksdk.SecretEnv, "key")
+	// The signature is of the decompressed payload, not of the file.
+	stdin := pathEnvelope(t, "payload.json", gzipBytes(t, payload), map[string]any{
+		"payload_encoding": "gzip",
+		"signature":        hooksdk.SignPayload("key", payload),
+	})
+	p, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.RequireSignature())
+	if err != nil || p.SessionID() != "from-file" {
+		t.Errorf("signed payload file: %v, %v", p, err)
+	}
+
+	stdin = pathEnvelope(t, "payload.json", hooktest.SessionStart().WithSessionID("swapped").Bytes(), map[string]any{
+		"signature": hooksdk.SignPayload("key", payload),
+	})
+	_, err = hooksdk.ReadPayloadFrom(bytes.NewReader(stdin))
+	if !errors.Is(err, hooksdk.ErrBadSignature) || !strings.Contains(err.Error(), "payload.json") {
+		t.Errorf("replaced payload file: error = %v, want ErrBadSignature naming the file", err)
+	}
+}
+
+func TestRequireSignature(t *testing.T) {
+	payload := hooktest.ToolCallStarted().Bytes()
+	signed := hooktest.SignedEnvelope(t, payload, "key")
+
+	// Without RequireSignature, a payload is read unchecked unless it is signed and the secret set.
+	t.Setenv(hooksdk.SecretEnv, "")
+	for name, stdin := range map[string][]byte{"bare": payload, "signed, no secret": signed, "bad signature, no secret": hooktest.SignedEnvelope(t, payload, "x")} {
+		if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(signed), hooksdk.RequireSignature()); !errors.Is(err, hooksdk.ErrSignatureMissing) ||
+		!strings.Contains(err.Error(), hooksdk.SecretEnv) {
+		t.Errorf("RequireSignature with no secret: error = %v, want ErrSignatureMissing naming %s", err, hooksdk.SecretEnv)
+	}
+
+	// A secret of only separators lists no keys.
+	t.Setenv(hooksdk.SecretEnv, " , ")
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(signed), hooksdk.RequireSignature()); !errors.Is(err, hooksdk.ErrSignatureMissing) {
+		t.Errorf("RequireSignature with an empty key list: error = %v, want ErrSignatureMissing", err)
+	}
+
+	t.Setenv(hooksdk.SecretEnv, "key")
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(payload)); err != nil {
+		t.Errorf("bare payload with a secret: %v", err)
+	}
+	for name, stdin := range map[string][]byte{"bare": payload, "unsigned envelope": inlineEnvelope(t, payload, nil)} {
+		if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(stdin), hooksdk.RequireSignature()); !errors.Is(err, hooksdk.ErrSignatureMissing) {
+			t.Errorf("RequireSignature, %s: error = %v, want ErrSignatureMissing", name, err)
+		}
+	}
+}
+
+func TestSignatureCoversEnvelopeFields(t *testing.T) {
+	payload := hooktest.ToolCallStarted().Bytes()
+	t.Setenv(hooksdk.SecretEnv, "key")
+	if hooksdk.SignEnvelope("key", payload, "", false) != hooksdk.SignPayload("key", payload) {
+		t.Error("SignEnvelope without output_path or cleanup isn't SignPayload")
+	}
+
+	// A signature of the payload alone doesn't let output_path be added: the response isn't written.
+	out := filepath.Join(t.TempDir(), "response.json")
+	for name, sig := range map[string]string{
+		"payload only": hooksdk.SignPayload("key", payload),
+		"another path": hooksdk.SignEnvelope("key", payload, out+".other", false),
+		"cleanup set":  hooksdk.SignEnvelope("key", payload, out, true),
+		"another key":  hooksdk.SignEnvelope("other-key", payload, out, false),
+	} {
+		stdin := inlineEnvelope(t, payload, map[string]any{"output_path": out, "signature": sig})
+		res := hooktest.RunHook(t, respond(hooksdk.Allow(), nil), stdin)
+		if res.ExitCode != hooksdk.ExitError || !strings.Contains(res.Stderr, hooksdk.ErrBadSignature.Error()) {
+			t.Errorf("%s: exit %d, stderr %s", name, res.ExitCode, res.Stderr)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Fatalf("%s: output_path written: %v", name, err)
+		}
+	}
+	stdin := inlineEnvelope(t, payload, map[string]any{"output_path": out, "signature": hooksdk.SignEnvelope("key", payload, out, false)})
+	if res := hooktest.RunHook(t, respond(hooksdk.Allow(), nil), stdin, hooksdk.RequireSignature()); res.ExitCode != hooksdk.ExitOK {
+		t.Errorf("signed output_path: exit %d, stderr %s", res.ExitCode, res.Stderr)
+	}
+	if data, err := os.ReadFile(out); err != nil || !bytes.Contains(data, []byte(`"decision"`)) {
+		t.Errorf("signed output_path: response file %q, %v", data, err)
+	}
+
+	// Nor can cleanup be added, so the payload file stays.
+	file := pathEnvelope(t, "payload.json", payload, map[string]any{"cleanup": true, "signature": hooksdk.SignPayload("key", payload)})
+	var fields map[string]any
+	if err := json.Unmarshal(file, &fields); err != nil {
+		t.Fatal(err)
+	}
+	path := fields["payload_path"].(string)
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(file)); !errors.Is(err, hooksdk.ErrBadSignature) {
+		t.Errorf("unsigned cleanup: error = %v, want ErrBadSignature", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("unsigned cleanup removed the payload file: %v", err)
+	}
+	fields["signature"] = hooksdk.SignEnvelope("key", payload, "", true)
+	file, _ = json.Marshal(fields)
+	if _, err := hooksdk.ReadPayloadFrom(bytes.NewReader(file), hooksdk.RequireSignature()); err != nil {
+		t.Errorf("signed cleanup: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("signed cleanup kept the payload file: %v", err)
+	}
+
+	// A streamed payload is checked the same way.
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fields["signature"] = hooksdk.SignPayload("key", payload)
+	file, _ = json.Marshal(fields)
+	stdio, _, _ := testIO(file, map[string]string{hooksdk.SecretEnv: "key"})
+	rc, _, err := hooksdk.OpenPayload(hooksdk.WithIO(stdio))
+	if err == nil {
+		_, err = io.ReadAll(rc)
+		rc.Close()
+	}
+	if !errors.Is(err, hooksdk.ErrBadSignature) {
+		t.Errorf("OpenPayload, unsigned cleanup: error = %v, want ErrBadSignature", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("OpenPayload, unsigned cleanup removed the payload file: %v", err)
+	}
+}
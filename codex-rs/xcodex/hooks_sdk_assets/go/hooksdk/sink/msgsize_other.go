@@ -0,0 +1,12 @@
+//go:build !plan9
+
+package sink
+
+import (
+	"errors"
+	"syscall"
+)
+
+func isMsgTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE)
+}
@@ -0,0 +1,315 @@
+// Package sink sends each event to several destinations from one hook, instead of one hook
+// process per destination re-reading the same payload:
+//
+//	var tee sink.Tee
+//	tee.Add("file", sink.NewJSONL(filepath.Join(codexHome, "hooks.jsonl"), jsonl.OptionsFromEnv()))
+//	tee.Add("webhook", sink.Filter(&sink.Webhook{Client: &webhook.Client{URL: url}}, failures))
+//	tee.Add("socket", &sink.Datagram{Path: "/run/collector.sock"})
+//	err := tee.Write(ctx, hooksdk.HookPayloadJSON(payload.RawPayload))
+//
+// A Tee writes to its sinks concurrently, and a sink that fails or is slow doesn't keep the event
+// from the others. When ctx is done part-way through (Run cancels it when the host sends SIGTERM),
+// the sinks still writing get Tee.Grace to finish, and if the event then reached some sinks but
+// not all, those it reached get an InterruptedMarker naming the others, so reconciliation can
+// tell the gap from a lost record.
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/filterexpr"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+// Sink receives events. Write should give up when ctx is done.
+type Sink interface {
+	Write(ctx context.Context, p hooksdk.HookPayloadJSON) error
+}
+
+// Func adapts a function to Sink.
+type Func func(ctx context.Context, p hooksdk.HookPayloadJSON) error
+
+func (f Func) Write(ctx context.Context, p hooksdk.HookPayloadJSON) error { return f(ctx, p) }
+
+// Filter returns a sink that passes on to s only the events expr matches (see filterexpr). An
+// event expr can't be evaluated on is passed on, with a warning, as is an InterruptedMarker, which
+// is only written to sinks that took the event it is about. A nil expr passes on everything.
+func Filter(s Sink, expr *filterexpr.Expr) Sink {
+	if expr == nil {
+		return s
+	}
+	return Func(func(ctx context.Context, p hooksdk.HookPayloadJSON) error {
+		if IsInterruptedMarker(p) {
+			return s.Write(ctx, p)
+		}
+		ok, err := expr.Eval(p)
+		if err != nil {
+			hooklog.Warnf("filter %s: %v; writing the event anyway", expr, err)
+		} else if !ok {
+			return nil
+		}
+		return s.Write(ctx, p)
+	})
+}
+
+// Error is a failure of one of a Tee's sinks.
+type Error struct {
+	Sink string
+	Err  error
+}
+
+func (e *Error) Error() string { return "sink " + e.Sink + ": " + e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Tee writes each event to all of its sinks. The zero Tee has no sinks.
+type Tee struct {
+	// Grace is how long the sinks still writing an event when ctx is done get to finish it, and
+	// then how long the InterruptedMarker gets. Zero means DefaultGrace; a negative Grace stops
+	// the sinks as soon as ctx is done and writes no marker.
+	Grace time.Duration
+
+	names []string
+	sinks []Sink
+}
+
+// DefaultGrace is Tee.Grace when it is zero.
+const DefaultGrace = 500 * time.Millisecond
+
+// InterruptedType is the `type` of an InterruptedMarker.
+const InterruptedType = "hook_interrupted"
+
+// InterruptedMarker returns the record a Tee writes, after an event it was interrupted writing,
+// to the sinks that took the event:
+//
+//	{"type":"hook_interrupted","event_id":"...","event_type":"tool-call-finished","session_id":"...",
+//	 "delivered":["file"],"missed":["webhook"],"reason":"context canceled"}
+//
+// delivered and missed name the sinks that did and didn't take the event, and reason is why the
+// write was cut short.
+func InterruptedMarker(p hooksdk.HookPayloadJSON, delivered, missed []string, reason error) hooksdk.HookPayloadJSON {
+	marker := hooksdk.HookPayloadJSON{
+		"type":      InterruptedType,
+		"delivered": delivered,
+		"missed":    missed,
+	}
+	for key, field := range map[string]string{"event_id": "event_id", "event_type": "xcodex_event_type", "session_id": "session_id"} {
+		if v, ok := hooksdk.StringField(p, field); ok {
+			marker[key] = v
+		}
+	}
+	if reason != nil {
+		marker["reason"] = reason.Error()
+	}
+	return marker
+}
+
+// IsInterruptedMarker reports whether p is an InterruptedMarker.
+func IsInterruptedMarker(p hooksdk.HookPayloadJSON) bool {
+	t, _ := hooksdk.StringField(p, "type")
+	return t == InterruptedType && p["xcodex_event_type"] == nil
+}
+
+// Add adds s, named name in errors.
+func (t *Tee) Add(name string, s Sink) {
+	t.names = append(t.names, name)
+	t.sinks = append(t.sinks, s)
+}
+
+// Len returns the number of sinks.
+func (t *Tee) Len() int { return len(t.sinks) }
+
+// Write writes p to every sink concurrently and returns the failures as a *hooksdk.MultiError,
+// each an *Error naming its sink, in the order the sinks were added; nil means every sink took
+// the event. It returns once every sink is done, so events written one after another reach each
+// sink in that order.
+func (t *Tee) Write(ctx context.Context, p hooksdk.HookPayloadJSON) error {
+	var multi hooksdk.MultiError
+	for i, err := range t.WriteEach(ctx, p) {
+		multi.Add(t.names[i], err, false)
+	}
+	return multi.Err()
+}
+
+// WriteEach is Write returning each sink's error, indexed in the order the sinks were added, with
+// nil for the sinks that took the event. A sink that panics fails with the panic as its error.
+//
+// Once ctx is done, the sinks still writing get Grace more to finish. If some of them still fail,
+// each sink that took the event is then written an InterruptedMarker; a sink that fails to take
+// the marker is reported with hooklog, since its error is for the event.
+func (t *Tee) WriteEach(ctx context.Context, p hooksdk.HookPayloadJSON) []error {
+	all := make([]int, len(t.sinks))
+	for i := range all {
+		all[i] = i
+	}
+	wctx, cancel := t.graceContext(ctx)
+	errs := t.write(wctx, all, p)
+	cancel()
+	if ctx.Err() != nil && t.grace() > 0 {
+		t.markInterrupted(ctx, p, errs)
+	}
+	return errs
+}
+
+// write writes p to the sinks of t at indexes concurrently, returning the error of each sink.
+func (t *Tee) write(ctx context.Context, indexes []int, p hooksdk.HookPayloadJSON) []error {
+	errs := make([]error, len(t.sinks))
+	var wg sync.WaitGroup
+	for _, i := range indexes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = &Error{Sink: t.names[i], Err: fmt.Errorf("panic: %v", r)}
+				}
+			}()
+			if err := t.sinks[i].Write(ctx, p); err != nil {
+				errs[i] = &Error{Sink: t.names[i], Err: err}
+			}
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+func (t *Tee) grace() time.Duration {
+	if t.Grace == 0 {
+		return DefaultGrace
+	}
+	return t.Grace
+}
+
+// graceContext returns the context the sinks write an event under: one that is done Grace after
+// ctx is, rather than with it, so a sink part-way through the event can finish it.
+func (t *Tee) graceContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	grace := t.grace()
+	if grace < 0 {
+		return context.WithCancel(ctx)
+	}
+	wctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() { time.AfterFunc(grace, cancel) })
+	return wctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// markInterrupted writes an InterruptedMarker to the sinks that took p, when ctx ended the write
+// before the others did, giving them Grace.
+func (t *Tee) markInterrupted(ctx context.Context, p hooksdk.HookPayloadJSON, errs []error) {
+	var delivered []int
+	var names, missed []string
+	for i, err := range errs {
+		if err == nil {
+			delivered = append(delivered, i)
+			names = append(names, t.names[i])
+		} else {
+			missed = append(missed, t.names[i])
+		}
+	}
+	if len(delivered) == 0 || len(missed) == 0 {
+		return
+	}
+	marker := InterruptedMarker(p, names, missed, context.Cause(ctx))
+	mctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), t.grace())
+	defer cancel()
+	for _, err := range t.write(mctx, delivered, marker) {
+		if err != nil {
+			hooklog.Warnf("%s marker: %v", InterruptedType, err)
+		}
+	}
+}
+
+// JSONL appends each event to a log file, wrapped as
+// `{"ts","host","pid","hook","hook_invocation_id","event":...}` (see hooksdk.Meta, with the
+// invocation id of ctx) like cmd/log_jsonl's records, or bare with Plain. The writer serializes
+// appends across processes, so each event is one whole record, in the order it was written.
+type JSONL struct {
+	W     *jsonl.Writer
+	Plain bool
+}
+
+// NewJSONL returns a JSONL sink appending to path.
+func NewJSONL(path string, opts jsonl.Options) *JSONL {
+	return &JSONL{W: jsonl.New(path, opts)}
+}
+
+func (s *JSONL) Write(ctx context.Context, p hooksdk.HookPayloadJSON) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.Plain {
+		return s.W.Append(p)
+	}
+	m := hooksdk.Meta()
+	m.InvocationID = hooksdk.InvocationIDFrom(ctx)
+	return s.W.Append(m.Wrap(p))
+}
+
+// Webhook POSTs each event as JSON with Client, adding the X-Hook-Event and X-Hook-Event-Id
+// headers cmd/forward_webhook sends.
+type Webhook struct {
+	Client *webhook.Client
+}
+
+func (s *Webhook) Write(ctx context.Context, p hooksdk.HookPayloadJSON) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	c := *s.Client
+	c.Header = c.Header.Clone()
+	if c.Header == nil {
+		c.Header = http.Header{}
+	}
+	eventType, _ := hooksdk.StringField(p, "xcodex_event_type")
+	eventID, _ := hooksdk.StringField(p, "event_id")
+	c.Header.Set("X-Hook-Event", eventType)
+	c.Header.Set("X-Hook-Event-Id", eventID)
+	return c.Send(ctx, body)
+}
+
+// Datagram sends each event as one JSON datagram to the unix datagram socket at Path, for
+// collectors such as a local agent. An event too large for one datagram fails.
+type Datagram struct {
+	Path string
+	// Timeout bounds each send when ctx has no earlier deadline. Zero means DefaultDatagramTimeout.
+	Timeout time.Duration
+}
+
+// DefaultDatagramTimeout is the Datagram send timeout when Datagram.Timeout is zero.
+const DefaultDatagramTimeout = 2 * time.Second
+
+func (s *Datagram) Write(ctx context.Context, p hooksdk.HookPayloadJSON) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDatagramTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unixgram", s.Path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+	_, err = conn.Write(data)
+	return err
+}
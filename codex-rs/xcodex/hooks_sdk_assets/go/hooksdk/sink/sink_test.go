@@ -0,0 +1,503 @@
+package sink_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/filterexpr"
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+	"example.com/xcodex/hooks-sdk/hooksdk/sink"
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+func event(id string) hooksdk.HookPayloadJSON {
+	return hooksdk.HookPayloadJSON{"xcodex_event_type": "tool-call-finished", "event_id": id, "session_id": "s1"}
+}
+
+// recorder is a sink that keeps the ids of the events it takes.
+type recorder struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (r *recorder) Write(ctx context.Context, p hooksdk.HookPayloadJSON) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, _ := hooksdk.StringField(p, "event_id")
+	r.ids = append(r.ids, id)
+	return nil
+}
+
+func (r *recorder) got() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ids...)
+}
+
+// readLines returns the records of the log at path.
+func readLines(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var v map[string]any
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		lines = append(lines, v)
+	}
+	return lines
+}
+
+func TestTeePartialFailure(t *testing.T) {
+	var tee sink.Tee
+	first, last := &recorder{}, &recorder{}
+	boom := errors.New("boom")
+	tee.Add("first", first)
+	tee.Add("broken", sink.Func(func(context.Context, hooksdk.HookPayloadJSON) error { return boom }))
+	tee.Add("panics", sink.Func(func(context.Context, hooksdk.HookPayloadJSON) error { panic("oops") }))
+	tee.Add("last", last)
+	if tee.Len() != 4 {
+		t.Errorf("Len = %d", tee.Len())
+	}
+
+	errs := tee.WriteEach(context.Background(), event("e1"))
+	if len(errs) != 4 || errs[0] != nil || errs[3] != nil {
+		t.Fatalf("WriteEach = %v", errs)
+	}
+	var serr *sink.Error
+	if !errors.As(errs[1], &serr) || serr.Sink != "broken" || !errors.Is(errs[1], boom) || errs[1].Error() != "sink broken: boom" {
+		t.Errorf("broken sink error = %v", errs[1])
+	}
+	if errs[2] == nil || errs[2].Error() != "sink panics: panic: oops" {
+		t.Errorf("panicking sink error = %v", errs[2])
+	}
+	// The failures don't keep the event from the other sinks.
+	if got := first.got(); len(got) != 1 || got[0] != "e1" {
+		t.Errorf("first got %q", got)
+	}
+	if got := last.got(); len(got) != 1 || got[0] != "e1" {
+		t.Errorf("last got %q", got)
+	}
+
+	err := tee.Write(context.Background(), event("e2"))
+	var multi *hooksdk.MultiError
+	if !errors.As(err, &multi) || len(multi.Failures) != 2 || multi.Failures[0].Component != "broken" || multi.Failures[1].Component != "panics" || multi.Fatal() {
+		t.Errorf("Write = %v, want the failures of broken and panics in order", err)
+	}
+	if !errors.Is(err, boom) {
+		t.Errorf("Write = %v, doesn't wrap the sink's error", err)
+	}
+
+	var empty sink.Tee
+	if err := empty.Write(context.Background(), event("e1")); err != nil || empty.Len() != 0 {
+		t.Errorf("empty Tee: Write = %v, Len = %d", err, empty.Len())
+	}
+}
+
+// TestTeeConcurrent checks that the sinks are written concurrently: each waits for the other to
+// start, which would never happen one after the other.
+func TestTeeConcurrent(t *testing.T) {
+	var tee sink.Tee
+	started := map[string]chan struct{}{"a": make(chan struct{}), "b": make(chan struct{})}
+	for name, other := range map[string]string{"a": "b", "b": "a"} {
+		name, other := name, other
+		tee.Add(name, sink.Func(func(ctx context.Context, _ hooksdk.HookPayloadJSON) error {
+			close(started[name])
+			select {
+			case <-started[other]:
+				return nil
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("%s never started", other)
+			}
+		}))
+	}
+	if err := tee.Write(context.Background(), event("e1")); err != nil {
+		t.Error(err)
+	}
+
+	// A slow sink doesn't hold up a quick one, though Write waits for both.
+	var tee2 sink.Tee
+	quick := make(chan time.Time, 1)
+	tee2.Add("slow", sink.Func(func(context.Context, hooksdk.HookPayloadJSON) error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	}))
+	tee2.Add("quick", sink.Func(func(context.Context, hooksdk.HookPayloadJSON) error {
+		quick <- time.Now()
+		return nil
+	}))
+	start := time.Now()
+	tee2.Write(context.Background(), event("e1"))
+	if took := time.Since(start); took < 200*time.Millisecond {
+		t.Errorf("Write returned after %v, before the slow sink was done", took)
+	}
+	if at := (<-quick).Sub(start); at > 150*time.Millisecond {
+		t.Errorf("quick sink written after %v", at)
+	}
+}
+
+// TestJSONLOrder checks that events written one after another are logged in that order, and that
+// events written at once from several goroutines are whole lines, each goroutine's in its order.
+func TestJSONLOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	var tee sink.Tee
+	tee.Add("file", &sink.JSONL{W: jsonl.New(path, jsonl.Options{}), Plain: true})
+	mirror := &recorder{}
+	tee.Add("mirror", mirror)
+	var want []string
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("e%02d", i)
+		want = append(want, id)
+		if err := tee.Write(context.Background(), event(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, line := range readLines(t, path) {
+		got = append(got, line["event_id"].(string))
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") || strings.Join(mirror.got(), ",") != strings.Join(want, ",") {
+		t.Errorf("logged %q, mirrored %q; want %q", got, mirror.got(), want)
+	}
+
+	path = filepath.Join(t.TempDir(), "hooks.jsonl")
+	s := &sink.JSONL{W: jsonl.New(path, jsonl.Options{}), Plain: true}
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				p := event(fmt.Sprintf("w%d-%02d", w, i))
+				p["padding"] = strings.Repeat("x", 4096)
+				if err := s.Write(context.Background(), p); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	lines := readLines(t, path)
+	last := map[string]string{}
+	for _, line := range lines {
+		id := line["event_id"].(string)
+		writer := id[:2]
+		if id <= last[writer] {
+			t.Errorf("%s logged after %s", id, last[writer])
+		}
+		last[writer] = id
+	}
+	if len(lines) != 200 {
+		t.Errorf("logged %d lines, want 200", len(lines))
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	t.Setenv("CODEX_HOOK_NAME", "multi")
+	path := filepath.Join(t.TempDir(), "hooks.jsonl")
+	s := sink.NewJSONL(path, jsonl.Options{})
+	if err := s.Write(context.Background(), event("e1")); err != nil {
+		t.Fatal(err)
+	}
+	line := readLines(t, path)[0]
+	if _, err := time.Parse(time.RFC3339Nano, line["ts"].(string)); err != nil || line["hook"] != "multi" || line["pid"] != float64(os.Getpid()) {
+		t.Errorf("record = %v, want the metadata", line)
+	}
+	if host, _ := os.Hostname(); line["host"] != host {
+		t.Errorf("host = %v, want %s", line["host"], host)
+	}
+	if ev, _ := line["event"].(map[string]any); ev["event_id"] != "e1" {
+		t.Errorf("event = %v", line["event"])
+	}
+
+	// A canceled write doesn't log.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Write(ctx, event("e2")); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled Write = %v", err)
+	}
+	if n := len(readLines(t, path)); n != 1 {
+		t.Errorf("%d lines after a canceled write", n)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan request, 4)
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- request{r.Header, body}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	client := &webhook.Client{URL: srv.URL, Secret: []byte("s3cret"), Header: http.Header{"X-Team": {"infra"}}}
+	s := &sink.Webhook{Client: client}
+	if err := s.Write(context.Background(), event("e1")); err != nil {
+		t.Fatal(err)
+	}
+	r := <-got
+	if r.header.Get("X-Hook-Event") != "tool-call-finished" || r.header.Get("X-Hook-Event-Id") != "e1" || r.header.Get("X-Team") != "infra" {
+		t.Errorf("headers = %v", r.header)
+	}
+	if !webhook.Verify([]byte("s3cret"), r.body, r.header.Get(webhook.SignatureHeader)) {
+		t.Errorf("signature %q doesn't verify", r.header.Get(webhook.SignatureHeader))
+	}
+	var body map[string]any
+	if err := json.Unmarshal(r.body, &body); err != nil || body["event_id"] != "e1" {
+		t.Errorf("body = %s", r.body)
+	}
+	// The client is shared between events, so its headers are left alone.
+	if len(client.Header) != 1 {
+		t.Errorf("client headers changed: %v", client.Header)
+	}
+
+	status = http.StatusBadRequest
+	if err := s.Write(context.Background(), event("e2")); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Write to a 400 = %v", err)
+	}
+}
+
+func TestDatagram(t *testing.T) {
+	dir, err := os.MkdirTemp("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "collector.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("no unix datagram sockets: %v", err)
+	}
+	defer conn.Close()
+
+	s := &sink.Datagram{Path: path}
+	for _, id := range []string{"e1", "e2"} {
+		if err := s.Write(context.Background(), event(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := make([]byte, 64<<10)
+	for _, want := range []string{"e1", "e2"} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]any
+		if err := json.Unmarshal(buf[:n], &got); err != nil || got["event_id"] != want {
+			t.Errorf("datagram %s, want event %s", buf[:n], want)
+		}
+	}
+
+	big := event("big")
+	big["padding"] = strings.Repeat("x", 4<<20)
+	if err := s.Write(context.Background(), big); err == nil {
+		t.Error("Write of a 4MB event succeeded")
+	}
+	if err := (&sink.Datagram{Path: filepath.Join(dir, "missing.sock")}).Write(context.Background(), event("e3")); err == nil {
+		t.Error("Write to a missing socket succeeded")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	r := &recorder{}
+	if s := sink.Filter(r, nil); s != sink.Sink(r) {
+		t.Error("Filter with a nil expression wrapped the sink")
+	}
+	expr, err := filterexpr.Compile(`exit_code != 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sink.Filter(r, expr)
+	failed, ok, mistyped := event("failed"), event("ok"), event("mistyped")
+	failed["exit_code"] = 1
+	ok["exit_code"] = 0
+	mistyped["exit_code"] = []any{1}
+	for _, p := range []hooksdk.HookPayloadJSON{failed, ok, mistyped} {
+		if err := s.Write(context.Background(), p); err != nil {
+			t.Error(err)
+		}
+	}
+	// An event the filter can't be evaluated on is written anyway.
+	if got := r.got(); strings.Join(got, ",") != "failed,mistyped" {
+		t.Errorf("filtered sink got %q", got)
+	}
+}
+
+// collector is a sink that keeps the events it takes, after waiting delay for each; ctx ending
+// first fails the write.
+type collector struct {
+	delay  time.Duration
+	mu     sync.Mutex
+	events []hooksdk.HookPayloadJSON
+}
+
+func (c *collector) Write(ctx context.Context, p hooksdk.HookPayloadJSON) error {
+	select {
+	case <-time.After(c.delay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, p)
+	return nil
+}
+
+// got returns the events c took, as JSON.
+func (c *collector) got() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []string
+	for _, p := range c.events {
+		data, _ := json.Marshal(p)
+		out = append(out, string(data))
+	}
+	return out
+}
+
+// interruptedAfter returns a context cancelled, with cause, after d.
+func interruptedAfter(t *testing.T, d time.Duration, cause error) context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	timer := time.AfterFunc(d, func() { cancel(cause) })
+	t.Cleanup(func() {
+		timer.Stop()
+		cancel(nil)
+	})
+	return ctx
+}
+
+func TestTeeGrace(t *testing.T) {
+	tee := sink.Tee{Grace: 300 * time.Millisecond}
+	fast, slow, stuck := &collector{}, &collector{delay: 100 * time.Millisecond}, &collector{delay: time.Hour}
+	tee.Add("fast", fast)
+	tee.Add("slow", slow)
+	tee.Add("stuck", stuck)
+	start := time.Now()
+	errs := tee.WriteEach(interruptedAfter(t, 30*time.Millisecond, errors.New("SIGTERM")), event("e1"))
+	elapsed := time.Since(start)
+
+	// The slow sink finishes within the grace period; the stuck one is stopped at its end.
+	if errs[0] != nil || errs[1] != nil || !errors.Is(errs[2], context.Canceled) {
+		t.Fatalf("errors = %v", errs)
+	}
+	if elapsed < 300*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("WriteEach took %v, want the grace period", elapsed)
+	}
+	ev := `{"event_id":"e1","session_id":"s1","xcodex_event_type":"tool-call-finished"}`
+	marker := `{"delivered":["fast","slow"],"event_id":"e1","event_type":"tool-call-finished","missed":["stuck"],"reason":"SIGTERM","session_id":"s1","type":"hook_interrupted"}`
+	for name, c := range map[string]*collector{"fast": fast, "slow": slow} {
+		if got := c.got(); strings.Join(got, "\n") != ev+"\n"+marker {
+			t.Errorf("%s got %q", name, got)
+		}
+	}
+	if got := stuck.got(); len(got) != 0 {
+		t.Errorf("stuck got %q", got)
+	}
+}
+
+func TestTeeGraceWithoutMarker(t *testing.T) {
+	// With a negative Grace, the sinks stop with ctx and there's no marker.
+	tee := sink.Tee{Grace: -1}
+	fast, slow := &collector{}, &collector{delay: time.Second}
+	tee.Add("fast", fast)
+	tee.Add("slow", slow)
+	start := time.Now()
+	errs := tee.WriteEach(interruptedAfter(t, 30*time.Millisecond, nil), event("e1"))
+	if errs[0] != nil || !errors.Is(errs[1], context.Canceled) || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("errors = %v after %v", errs, time.Since(start))
+	}
+	if got := fast.got(); len(got) != 1 {
+		t.Errorf("fast got %q", got)
+	}
+
+	// Every sink finishing in the grace period needs no marker, and neither does none of them.
+	for name, delays := range map[string][2]time.Duration{"all": {0, 100 * time.Millisecond}, "none": {time.Hour, time.Hour}} {
+		tee := sink.Tee{Grace: 200 * time.Millisecond}
+		a, b := &collector{delay: delays[0]}, &collector{delay: delays[1]}
+		tee.Add("a", a)
+		tee.Add("b", b)
+		tee.WriteEach(interruptedAfter(t, 30*time.Millisecond, nil), event("e1"))
+		for _, c := range []*collector{a, b} {
+			for _, got := range c.got() {
+				if strings.Contains(got, sink.InterruptedType) {
+					t.Errorf("%s: marker written: %s", name, got)
+				}
+			}
+		}
+	}
+
+	// A sink that can't take the marker doesn't change the event's errors.
+	tee = sink.Tee{Grace: 100 * time.Millisecond}
+	tee.Add("refuses markers", sink.Func(func(ctx context.Context, p hooksdk.HookPayloadJSON) error {
+		if sink.IsInterruptedMarker(p) {
+			return errors.New("no markers")
+		}
+		return nil
+	}))
+	tee.Add("stuck", &collector{delay: time.Hour})
+	if errs := tee.WriteEach(interruptedAfter(t, 10*time.Millisecond, nil), event("e1")); errs[0] != nil || errs[1] == nil {
+		t.Errorf("errors = %v", errs)
+	}
+}
+
+func TestTeeDefaultGrace(t *testing.T) {
+	var tee sink.Tee
+	fast := &collector{}
+	tee.Add("fast", fast)
+	tee.Add("stuck", &collector{delay: time.Hour})
+	start := time.Now()
+	errs := tee.WriteEach(interruptedAfter(t, 10*time.Millisecond, nil), event("e1"))
+	if elapsed := time.Since(start); errs[1] == nil || elapsed < sink.DefaultGrace || elapsed > sink.DefaultGrace+2*time.Second {
+		t.Errorf("errors %v after %v, want DefaultGrace", errs, elapsed)
+	}
+	if got := fast.got(); len(got) != 2 || !strings.Contains(got[1], `"reason":"context canceled"`) {
+		t.Errorf("fast got %q", got)
+	}
+}
+
+func TestInterruptedMarker(t *testing.T) {
+	marker := sink.InterruptedMarker(hooksdk.HookPayloadJSON{"xcodex_event_type": "session-start"}, []string{"a"}, []string{"b"}, nil)
+	data, _ := json.Marshal(marker)
+	if string(data) != `{"delivered":["a"],"event_type":"session-start","missed":["b"],"type":"hook_interrupted"}` {
+		t.Errorf("marker = %s", data)
+	}
+	// An event with its own type field is no marker.
+	ev := event("e1")
+	ev["type"] = sink.InterruptedType
+	if !sink.IsInterruptedMarker(marker) || sink.IsInterruptedMarker(ev) || sink.IsInterruptedMarker(event("e1")) {
+		t.Error("IsInterruptedMarker is wrong")
+	}
+
+	// A filter passes markers on whatever it matches.
+	expr, err := filterexpr.Compile(`exit_code != 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{}
+	if err := sink.Filter(r, expr).Write(context.Background(), marker); err != nil || len(r.got()) != 1 {
+		t.Errorf("filter took %q, %v", r.got(), err)
+	}
+}
@@ -0,0 +1,383 @@
+package sink
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/outbox"
+)
+
+// Overflow says what a Socket does with an event that doesn't fit in its buffer.
+type Overflow string
+
+const (
+	// OverflowDropOldest drops the oldest buffered event to make room, counting it in
+	// SocketStats.Dropped.
+	OverflowDropOldest Overflow = "drop-oldest"
+	// OverflowSpool moves the oldest buffered event to the outbox, which the next Socket with the
+	// same Outbox sends before its own events.
+	OverflowSpool Overflow = "spool"
+	// OverflowBlock makes Write wait for room, until ctx is done or the budget runs out.
+	OverflowBlock Overflow = "block"
+)
+
+// ParseOverflow returns the Overflow named s, for config files.
+func ParseOverflow(s string) (Overflow, error) {
+	switch o := Overflow(s); o {
+	case OverflowDropOldest, OverflowSpool, OverflowBlock:
+		return o, nil
+	}
+	return "", fmt.Errorf("overflow must be %s, %s, or %s, not %q", OverflowDropOldest, OverflowSpool, OverflowBlock, s)
+}
+
+// Defaults for a Socket's zero fields.
+const (
+	DefaultSocketBuffer = 64
+	DefaultSocketBudget = 2 * time.Second
+)
+
+// ErrOverflow is returned (wrapped) by Socket.Write under OverflowBlock when no room came up in
+// time, and by Socket.Close when events were dropped.
+var ErrOverflow = errors.New("sink: socket buffer overflow")
+
+// socketRetryWait is how long a Socket waits after a failed send before it dials again.
+const socketRetryWait = 50 * time.Millisecond
+
+// Socket sends each event to a local collector on the unix socket at Path without letting a
+// stalled collector hang the hook. Write puts the event in a buffer of Buffer events, which a
+// goroutine sends in order; a collector that stops reading fills the buffer, and the events that
+// don't fit are handled as Overflow says. The sends of one Socket share a time budget, counted
+// from its first Write: once it is spent, nothing more is sent, and the events still buffered are
+// spooled (with OverflowSpool) or dropped. Close waits for the buffer to empty, within the budget;
+// call it before the hook exits, or buffered events are lost:
+//
+//	s := &sink.Socket{Path: "/run/collector.sock", Overflow: sink.OverflowSpool}
+//	defer s.Close(ctx)
+//	tee.Add("socket", s)
+//
+// Because events are buffered, a nil error from Write means the event was taken, not that it was
+// delivered. A Socket is for one invocation; after Close it drops what it is given.
+type Socket struct {
+	Path string
+	// Stream sends to a stream socket (network "unix"), each event framed by its length as a
+	// 4-byte big-endian integer, instead of one datagram per event ("unixgram").
+	Stream bool
+	// Buffer is the number of events held in memory. Zero means DefaultSocketBuffer.
+	Buffer int
+	// Budget bounds the time spent sending, from the first Write. Zero means DefaultSocketBudget.
+	Budget time.Duration
+	// Overflow is what to do when the buffer is full. Empty means OverflowDropOldest.
+	Overflow Overflow
+	// Outbox holds the events OverflowSpool spools; nil means `$CODEX_HOME/hooks/outbox/socket`.
+	Outbox *outbox.Outbox
+
+	once     sync.Once
+	mu       sync.Mutex
+	queue    [][]byte
+	conn     net.Conn
+	deadline time.Time
+	timer    *time.Timer
+	spooled  int // events in the outbox when s started
+	expired  bool
+	closed   bool
+	stats    SocketStats
+	lastErr  error
+	wake     chan struct{} // signals the sender that the queue changed
+	room     chan struct{} // signals blocked Writes that the queue shrank
+	stop     chan struct{} // closed when the budget runs out or Close gives up
+	done     chan struct{} // closed when the sender returns
+}
+
+// SocketStats counts what happened to a Socket's events.
+type SocketStats struct {
+	// Sent events were written to the socket; Dropped ones were lost to overflow, an expired budget,
+	// or a datagram too large to send; Spooled ones were left in the outbox.
+	Sent, Dropped, Spooled int
+	// Resent are spooled events from earlier invocations sent from the outbox.
+	Resent int
+}
+
+func (s *Socket) start() {
+	s.once.Do(func() {
+		budget := s.Budget
+		if budget <= 0 {
+			budget = DefaultSocketBudget
+		}
+		s.mu.Lock()
+		s.deadline = time.Now().Add(budget)
+		s.wake = make(chan struct{}, 1)
+		s.room = make(chan struct{}, 1)
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		s.timer = time.AfterFunc(budget, s.expire)
+		if s.Overflow == OverflowSpool {
+			s.spooled, _ = s.outbox().Len()
+		}
+		s.mu.Unlock()
+		go s.run()
+	})
+}
+
+func (s *Socket) Write(ctx context.Context, p hooksdk.HookPayloadJSON) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	s.start()
+	limit := s.Buffer
+	if limit <= 0 {
+		limit = DefaultSocketBuffer
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.Overflow == OverflowBlock && len(s.queue) >= limit && !s.expired && !s.closed {
+		s.mu.Unlock()
+		select {
+		case <-s.room:
+		case <-s.stop:
+		case <-ctx.Done():
+			s.mu.Lock()
+			return fmt.Errorf("%w: %v", ErrOverflow, context.Cause(ctx))
+		}
+		s.mu.Lock()
+	}
+	if s.expired || s.closed {
+		if s.Overflow == OverflowBlock {
+			return fmt.Errorf("%w: send budget spent", ErrOverflow)
+		}
+		s.overflow(data)
+		return nil
+	}
+	if len(s.queue) >= limit {
+		s.overflow(s.queue[0])
+		s.queue = s.queue[1:]
+	}
+	s.queue = append(s.queue, data)
+	signal(s.wake)
+	return nil
+}
+
+// overflow spools or drops data, an event that won't be sent. s.mu is held.
+func (s *Socket) overflow(data []byte) {
+	if s.Overflow == OverflowSpool {
+		_, err := s.outbox().Add(data)
+		if err == nil {
+			s.stats.Spooled++
+			return
+		}
+		s.lastErr = err
+	}
+	s.stats.Dropped++
+}
+
+func (s *Socket) outbox() *outbox.Outbox {
+	if s.Outbox == nil {
+		s.Outbox = outbox.New(hooksdk.Environ().Path("hooks", "outbox", "socket"))
+	}
+	return s.Outbox
+}
+
+// Close waits until the buffered events have been sent, the budget is spent, or ctx is done,
+// then spools or drops what is left and closes the connection. It returns an error wrapping
+// ErrOverflow, and the last send error, when events were dropped.
+func (s *Socket) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	started := s.done != nil
+	s.mu.Unlock()
+	if !started {
+		return nil
+	}
+	signal(s.wake)
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		s.expire()
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timer.Stop()
+	for _, data := range s.queue {
+		s.overflow(data)
+	}
+	s.queue = nil
+	if s.stats.Dropped == 0 {
+		return nil
+	}
+	err := fmt.Errorf("%w: %d of %d events dropped", ErrOverflow, s.stats.Dropped, s.stats.Sent+s.stats.Dropped+s.stats.Spooled)
+	if s.lastErr != nil {
+		err = fmt.Errorf("%w (last error: %v)", err, s.lastErr)
+	}
+	return err
+}
+
+// Stats returns the counts so far; after Close they are final.
+func (s *Socket) Stats() SocketStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// expire ends sending: the budget is spent, or Close gave up waiting. A send in progress is
+// interrupted.
+func (s *Socket) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expired {
+		return
+	}
+	s.expired = true
+	close(s.stop)
+	if s.conn != nil {
+		s.conn.SetWriteDeadline(time.Now())
+	}
+}
+
+// run sends the spooled events, then the buffered ones, until the budget is spent or Close has
+// been called and the buffer is empty.
+func (s *Socket) run() {
+	defer close(s.done)
+	defer func() {
+		s.mu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.mu.Unlock()
+	}()
+
+	if s.Overflow == OverflowSpool {
+		s.resend()
+	}
+
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 {
+			if s.closed || s.expired {
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+			case <-s.stop:
+			}
+			s.mu.Lock()
+		}
+		if s.expired {
+			s.mu.Unlock()
+			return
+		}
+		data := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		signal(s.room)
+
+		err := s.send(data)
+		s.mu.Lock()
+		switch {
+		case err == nil:
+			s.stats.Sent++
+		case isMsgTooLarge(err):
+			// Retrying won't make it fit.
+			s.stats.Dropped++
+			s.lastErr = err
+		default:
+			// Put it back for the next try, or for Close to spool.
+			s.queue = append([][]byte{data}, s.queue...)
+			s.lastErr = err
+		}
+		s.mu.Unlock()
+		if err != nil && !isMsgTooLarge(err) {
+			select {
+			case <-time.After(socketRetryWait):
+			case <-s.stop:
+			}
+		}
+	}
+}
+
+// resend sends the events spooled in the outbox before s started, oldest first. The ones s
+// spools itself come after the events it still has buffered, so they wait for the next Socket.
+func (s *Socket) resend() {
+	s.mu.Lock()
+	box, n := *s.outbox(), s.spooled
+	s.mu.Unlock()
+	if n == 0 {
+		return
+	}
+	box.Budget = n
+	ctx, cancel := context.WithDeadline(context.Background(), s.deadline)
+	defer cancel()
+	stats, err := box.Drain(ctx, func(ctx context.Context, m outbox.Message) error {
+		return s.send(m.Data)
+	})
+	s.mu.Lock()
+	s.stats.Resent += stats.Sent
+	s.mu.Unlock()
+	if err != nil {
+		hooklog.Debugf("socket %s: resend spooled events: %v", s.Path, err)
+	}
+}
+
+// send writes one event, dialing first when there is no connection. A failed send closes the
+// connection, so the next one dials again.
+func (s *Socket) send(data []byte) error {
+	s.mu.Lock()
+	conn, deadline := s.conn, s.deadline
+	s.mu.Unlock()
+	if conn == nil {
+		network := "unixgram"
+		if s.Stream {
+			network = "unix"
+		}
+		d := net.Dialer{Deadline: deadline}
+		var err error
+		if conn, err = d.Dial(network, s.Path); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.conn = conn
+		if s.expired {
+			conn.SetWriteDeadline(time.Now())
+		} else {
+			conn.SetWriteDeadline(deadline)
+		}
+		s.mu.Unlock()
+	}
+	msg := data
+	if s.Stream {
+		msg = make([]byte, 4+len(data))
+		binary.BigEndian.PutUint32(msg, uint32(len(data)))
+		copy(msg[4:], data)
+	}
+	_, err := conn.Write(msg)
+	if err != nil {
+		s.mu.Lock()
+		conn.Close()
+		s.conn = nil
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// signal wakes whoever waits on ch, without blocking when it is already signalled.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
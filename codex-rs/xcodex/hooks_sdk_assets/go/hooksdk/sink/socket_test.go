@@ -0,0 +1,335 @@
+package sink_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/outbox"
+	"example.com/xcodex/hooks-sdk/hooksdk/sink"
+)
+
+// fakeCollector is a collector on a unix socket that can be slow or stalled. It keeps the ids of
+// the events it reads, in order.
+type fakeCollector struct {
+	path string
+	// delay is how long it waits before each read; stall makes it never read.
+	delay time.Duration
+	stall bool
+
+	mu  sync.Mutex
+	ids []string
+}
+
+// socketDir returns a short directory for sockets, whose paths are limited to about 100 bytes.
+func socketDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// listenStream starts c on a stream socket, reading each frame by its 4-byte length.
+func (c *fakeCollector) listenStream(t *testing.T) *fakeCollector {
+	t.Helper()
+	c.path = filepath.Join(socketDir(t), "c.sock")
+	ln, err := net.Listen("unix", c.path)
+	if err != nil {
+		t.Skipf("no unix sockets: %v", err)
+	}
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done); ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if c.stall {
+					<-done
+					return
+				}
+				var size [4]byte
+				for {
+					time.Sleep(c.delay)
+					if _, err := io.ReadFull(conn, size[:]); err != nil {
+						return
+					}
+					data := make([]byte, binary.BigEndian.Uint32(size[:]))
+					if _, err := io.ReadFull(conn, data); err != nil {
+						return
+					}
+					c.add(t, data)
+				}
+			}()
+		}
+	}()
+	return c
+}
+
+// listenDatagram starts c on a datagram socket.
+func (c *fakeCollector) listenDatagram(t *testing.T) *fakeCollector {
+	t.Helper()
+	c.path = filepath.Join(socketDir(t), "c.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: c.path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("no unix datagram sockets: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 64<<10)
+		for {
+			time.Sleep(c.delay)
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			c.add(t, buf[:n])
+		}
+	}()
+	return c
+}
+
+func (c *fakeCollector) add(t *testing.T, data []byte) {
+	var v map[string]any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Errorf("collector got %q: %v", data, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, _ := v["event_id"].(string)
+	c.ids = append(c.ids, id)
+}
+
+// waitFor waits until c has read n events, and returns their ids.
+func (c *fakeCollector) waitFor(t *testing.T, n int) []string {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		c.mu.Lock()
+		ids := append([]string(nil), c.ids...)
+		c.mu.Unlock()
+		if len(ids) >= n || time.Now().After(deadline) {
+			return ids
+		}
+	}
+}
+
+// bigEvent is an event too large for a socket's kernel buffer, so a collector that doesn't read
+// holds up its send.
+func bigEvent(id string) hooksdk.HookPayloadJSON {
+	e := event(id)
+	e["padding"] = strings.Repeat("x", 1<<20)
+	return e
+}
+
+// writeAll writes the events named by ids to s, failing the test on an error or when the writes
+// take longer than max.
+func writeAll(t *testing.T, s *sink.Socket, max time.Duration, make func(string) hooksdk.HookPayloadJSON, ids ...string) {
+	t.Helper()
+	start := time.Now()
+	for _, id := range ids {
+		if err := s.Write(context.Background(), make(id)); err != nil {
+			t.Fatalf("Write(%s): %v", id, err)
+		}
+	}
+	if took := time.Since(start); took > max {
+		t.Errorf("writes took %v, want under %v", took, max)
+	}
+}
+
+func ids(n int) []string {
+	var ids []string
+	for i := 0; i < n; i++ {
+		ids = append(ids, fmt.Sprintf("e%d", i))
+	}
+	return ids
+}
+
+func TestSocketSends(t *testing.T) {
+	for name, listen := range map[string]func(*fakeCollector, *testing.T) *fakeCollector{
+		"stream":   (*fakeCollector).listenStream,
+		"datagram": (*fakeCollector).listenDatagram,
+	} {
+		c := listen(&fakeCollector{delay: time.Millisecond}, t)
+		s := &sink.Socket{Path: c.path, Stream: name == "stream"}
+		writeAll(t, s, time.Second, event, ids(10)...)
+		if err := s.Close(context.Background()); err != nil {
+			t.Fatalf("%s: Close: %v", name, err)
+		}
+		// Every event arrives, in order, framed as one event.
+		if got := c.waitFor(t, 10); strings.Join(got, ",") != strings.Join(ids(10), ",") {
+			t.Errorf("%s: collector got %q", name, got)
+		}
+		if st := s.Stats(); st != (sink.SocketStats{Sent: 10}) {
+			t.Errorf("%s: stats = %+v", name, st)
+		}
+	}
+}
+
+func TestSocketDropOldest(t *testing.T) {
+	// A slow collector: Write never waits, the oldest buffered events are dropped, and the newest
+	// arrives.
+	c := (&fakeCollector{delay: 20 * time.Millisecond}).listenStream(t)
+	s := &sink.Socket{Path: c.path, Stream: true, Buffer: 2, Budget: 10 * time.Second}
+	writeAll(t, s, 2*time.Second, bigEvent, ids(8)...)
+	err := s.Close(context.Background())
+	st := s.Stats()
+	if !errors.Is(err, sink.ErrOverflow) || !strings.Contains(err.Error(), fmt.Sprintf("%d of 8 events dropped", st.Dropped)) {
+		t.Errorf("Close = %v, want the drops reported", err)
+	}
+	got := c.waitFor(t, st.Sent)
+	if st.Dropped == 0 || st.Sent+st.Dropped != 8 || len(got) != st.Sent || got[len(got)-1] != "e7" || !sort.StringsAreSorted(got) {
+		t.Errorf("stats %+v, collector got %q", st, got)
+	}
+
+	// A stalled one: whatever is still buffered when the budget runs out is dropped.
+	c = (&fakeCollector{stall: true}).listenStream(t)
+	s = &sink.Socket{Path: c.path, Stream: true, Buffer: 2, Budget: 2 * time.Second}
+	writeAll(t, s, time.Second, bigEvent, ids(5)...)
+	start := time.Now()
+	err = s.Close(context.Background())
+	if took := time.Since(start); took > 4*time.Second {
+		t.Errorf("Close took %v with a 2s budget", took)
+	}
+	if st := s.Stats(); !errors.Is(err, sink.ErrOverflow) || st.Sent != 0 || st.Dropped != 5 {
+		t.Errorf("Close = %v, stats %+v", err, st)
+	}
+	// After Close, events are dropped at once.
+	if err := s.Write(context.Background(), event("late")); err != nil || s.Stats().Dropped != 6 {
+		t.Errorf("Write after Close = %v, stats %+v", err, s.Stats())
+	}
+}
+
+func TestSocketSpool(t *testing.T) {
+	box := outbox.New(filepath.Join(t.TempDir(), "outbox"))
+	c := (&fakeCollector{stall: true}).listenStream(t)
+	s := &sink.Socket{Path: c.path, Stream: true, Buffer: 2, Budget: 2 * time.Second, Overflow: sink.OverflowSpool, Outbox: box}
+	writeAll(t, s, time.Second, bigEvent, ids(5)...)
+	// Nothing is lost: what doesn't fit, and what is left at the end of the budget, is spooled.
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n, _ := box.Len(); n != 5 || s.Stats() != (sink.SocketStats{Spooled: 5}) {
+		t.Fatalf("outbox has %d events, stats %+v", n, s.Stats())
+	}
+
+	// The next Socket sends them before its own events.
+	c = (&fakeCollector{}).listenStream(t)
+	s = &sink.Socket{Path: c.path, Stream: true, Overflow: sink.OverflowSpool, Outbox: box}
+	writeAll(t, s, time.Second, event, "next")
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := c.waitFor(t, 6)
+	if len(got) != 6 || got[5] != "next" {
+		t.Fatalf("collector got %q", got)
+	}
+	sort.Strings(got[:5])
+	if strings.Join(got[:5], ",") != strings.Join(ids(5), ",") {
+		t.Errorf("resent %q, want the spooled events", got[:5])
+	}
+	if n, _ := box.Len(); n != 0 || s.Stats() != (sink.SocketStats{Sent: 1, Resent: 5}) {
+		t.Errorf("outbox has %d events, stats %+v", n, s.Stats())
+	}
+}
+
+func TestSocketBlock(t *testing.T) {
+	// With a stalled collector, a Write that doesn't fit waits, until the budget runs out.
+	c := (&fakeCollector{stall: true}).listenStream(t)
+	s := &sink.Socket{Path: c.path, Stream: true, Buffer: 1, Budget: 300 * time.Millisecond, Overflow: sink.OverflowBlock}
+	start := time.Now()
+	var err error
+	for _, id := range ids(3) {
+		if err = s.Write(context.Background(), bigEvent(id)); err != nil {
+			break
+		}
+	}
+	took := time.Since(start)
+	if !errors.Is(err, sink.ErrOverflow) || !strings.Contains(err.Error(), "send budget spent") || took < 250*time.Millisecond || took > 2*time.Second {
+		t.Errorf("Write = %v after %v, want the budget spent after 300ms", err, took)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Close(ctx); !errors.Is(err, sink.ErrOverflow) {
+		t.Errorf("Close = %v", err)
+	}
+
+	// Or until ctx is done.
+	c = (&fakeCollector{stall: true}).listenStream(t)
+	s = &sink.Socket{Path: c.path, Stream: true, Buffer: 1, Budget: 10 * time.Second, Overflow: sink.OverflowBlock}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	for _, id := range ids(3) {
+		if err = s.Write(ctx, bigEvent(id)); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, sink.ErrOverflow) || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) || time.Since(start) > 2*time.Second {
+		t.Errorf("Write = %v after %v, want ctx's deadline", err, time.Since(start))
+	}
+	// Close gives up with its ctx, well before the budget.
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	s.Close(ctx)
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("Close took %v", took)
+	}
+}
+
+func TestSocketFailures(t *testing.T) {
+	// No collector: the events are dropped when the budget runs out, with the dial's error.
+	s := &sink.Socket{Path: filepath.Join(socketDir(t), "missing.sock"), Budget: 200 * time.Millisecond}
+	writeAll(t, s, 100*time.Millisecond, event, "e0")
+	if err := s.Close(context.Background()); !errors.Is(err, sink.ErrOverflow) || !strings.Contains(err.Error(), "1 of 1 events dropped (last error: ") {
+		t.Errorf("Close = %v", err)
+	}
+
+	// A datagram too large to send is dropped at once, without retrying until the budget.
+	c := (&fakeCollector{}).listenDatagram(t)
+	s = &sink.Socket{Path: c.path, Budget: 10 * time.Second}
+	writeAll(t, s, time.Second, bigEvent, "big")
+	writeAll(t, s, time.Second, event, "small")
+	start := time.Now()
+	err := s.Close(context.Background())
+	if took := time.Since(start); took > 2*time.Second || !errors.Is(err, sink.ErrOverflow) || s.Stats() != (sink.SocketStats{Sent: 1, Dropped: 1}) {
+		t.Errorf("Close = %v after %v, stats %+v", err, took, s.Stats())
+	}
+	if got := c.waitFor(t, 1); strings.Join(got, ",") != "small" {
+		t.Errorf("collector got %q", got)
+	}
+
+	// A Socket never written to has nothing to close.
+	if err := (&sink.Socket{Path: "unused"}).Close(context.Background()); err != nil {
+		t.Errorf("Close of an unused Socket = %v", err)
+	}
+}
+
+func TestParseOverflow(t *testing.T) {
+	for _, o := range []sink.Overflow{sink.OverflowDropOldest, sink.OverflowSpool, sink.OverflowBlock} {
+		if got, err := sink.ParseOverflow(string(o)); err != nil || got != o {
+			t.Errorf("ParseOverflow(%q) = %q, %v", o, got, err)
+		}
+	}
+	if _, err := sink.ParseOverflow("drop"); err == nil || err.Error() != `overflow must be drop-oldest, spool, or block, not "drop"` {
+		t.Errorf("ParseOverflow(drop) = %v", err)
+	}
+}
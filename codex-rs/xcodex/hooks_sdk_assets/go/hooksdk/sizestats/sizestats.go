@@ -0,0 +1,197 @@
+// Package sizestats keeps running statistics of event sizes per event type (count, total bytes,
+// and a quantile sketch for p50/p95) across hook invocations, to see which events make a log
+// grow.
+//
+// Every event runs in a new process, so the statistics live in a small JSON file, and every
+// update holds a lock on it, so hooks recording at the same time never lose each other's samples.
+//
+//	sizestats.Record(payload.EventType(), len(line)) // after logging line
+//
+//	stats, err := sizestats.New(sizestats.DefaultPath()).Load()
+//	for _, row := range stats.Rows() {
+//		fmt.Println(row.EventType, row.Count, row.TotalBytes, row.P50, row.P95, row.Max)
+//	}
+package sizestats
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/atomicfile"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+	"example.com/xcodex/hooks-sdk/hooksdk/sketch"
+)
+
+const lockTimeout = 5 * time.Second
+
+// Store keeps the statistics of every event type in one state file.
+type Store struct {
+	// Path is the state file.
+	Path string
+	// Now is the clock; nil means time.Now.
+	Now func() time.Time
+}
+
+// New returns a Store keeping its statistics in path.
+func New(path string) *Store {
+	return &Store{Path: path}
+}
+
+// DefaultPath returns `hooks/stats.json` under CODEX_HOME (default `~/.xcodex`), the state file of
+// the package-level Record.
+func DefaultPath() string {
+	return hooksdk.Environ().Path("hooks", "stats.json")
+}
+
+// Stats are the statistics kept in a state file.
+type Stats struct {
+	// Since is when the first size was recorded (after the last Reset).
+	Since time.Time `json:"since"`
+	// Updated is when the last size was recorded.
+	Updated time.Time `json:"updated"`
+	// Events maps event types to the sketch of their sizes in bytes. Its Count and Sum are exact.
+	Events map[string]*sketch.Sketch `json:"events"`
+}
+
+// Row is the summary of one event type.
+type Row struct {
+	EventType  string
+	Count      uint64
+	TotalBytes uint64
+	// P50 and P95 are estimates, within sketch.DefaultRelativeAccuracy.
+	P50 float64
+	P95 float64
+	Max float64
+}
+
+// Rows summarizes every event type, the largest total first (ties by event type).
+func (s *Stats) Rows() []Row {
+	rows := make([]Row, 0, len(s.Events))
+	for typ, sk := range s.Events {
+		rows = append(rows, Row{
+			EventType:  typ,
+			Count:      sk.Count,
+			TotalBytes: uint64(sk.Sum),
+			P50:        sk.Quantile(0.5),
+			P95:        sk.Quantile(0.95),
+			Max:        sk.Max,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].TotalBytes != rows[j].TotalBytes {
+			return rows[i].TotalBytes > rows[j].TotalBytes
+		}
+		return rows[i].EventType < rows[j].EventType
+	})
+	return rows
+}
+
+// Record adds an event of eventType that took size bytes.
+func (s *Store) Record(eventType string, size int) error {
+	if eventType == "" {
+		eventType = "unknown"
+	}
+	return s.update(func(st *Stats, now time.Time) {
+		sk, ok := st.Events[eventType]
+		if !ok {
+			sk = sketch.New(0)
+			st.Events[eventType] = sk
+		}
+		sk.Add(float64(size))
+		if st.Since.IsZero() {
+			st.Since = now
+		}
+		st.Updated = now
+	})
+}
+
+// Load returns the statistics recorded so far. A missing state file has none; a corrupt one is an
+// error here, so it is noticed, while Record starts it afresh.
+func (s *Store) Load() (*Stats, error) {
+	data, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// read returns the state file's contents, or nil if there is none.
+func (s *Store) read() ([]byte, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func decode(data []byte) (*Stats, error) {
+	st := &Stats{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, st); err != nil {
+			return nil, err
+		}
+	}
+	if st.Events == nil {
+		st.Events = map[string]*sketch.Sketch{}
+	}
+	return st, nil
+}
+
+// Reset deletes the statistics.
+func (s *Store) Reset() error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	lock, err := filelock.AcquireTimeout(s.Path+".lock", lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	if err := os.Remove(s.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// update runs fn on the statistics under the lock and saves the result. A missing or corrupt state
+// file counts as empty.
+func (s *Store) update(fn func(st *Stats, now time.Time)) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	lock, err := filelock.AcquireTimeout(s.Path+".lock", lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+	st, err := decode(data)
+	if err != nil {
+		st, _ = decode(nil)
+	}
+	fn(st, now)
+	return atomicfile.WriteJSON(s.Path, st)
+}
+
+// Record is Store.Record on the state file at DefaultPath. Statistics must not get in the way of
+// a hook, so an error is only logged to stderr.
+func Record(eventType string, size int) {
+	if err := New(DefaultPath()).Record(eventType, size); err != nil {
+		hooklog.Warnf("sizestats: %v", err)
+	}
+}
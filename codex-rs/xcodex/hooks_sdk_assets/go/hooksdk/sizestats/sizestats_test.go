@@ -0,0 +1,170 @@
+package sizestats_test
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/sizestats"
+)
+
+// TestMain lets the tests run this binary as a hook process recording sizes: with
+// SIZESTATS_TEST_PATH set, it records SIZESTATS_TEST_COUNT sizes of 100 bytes.
+func TestMain(m *testing.M) {
+	if path := os.Getenv("SIZESTATS_TEST_PATH"); path != "" {
+		n, _ := strconv.Atoi(os.Getenv("SIZESTATS_TEST_COUNT"))
+		for i := 0; i < n; i++ {
+			if err := sizestats.New(path).Record("tool-call-finished", 100); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func statsPath(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "hooks", "stats.json")
+}
+
+func TestRecordAndRows(t *testing.T) {
+	s := sizestats.New(statsPath(t))
+	clock := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time { clock = clock.Add(time.Minute); return clock }
+	for i := 1; i <= 100; i++ {
+		if err := s.Record("tool-call-finished", i*100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, typ := range []string{"session-start", "session-end", ""} {
+		if err := s.Record(typ, 50); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 1, 1, 10, 1, 0, 0, time.UTC); !stats.Since.Equal(want) {
+		t.Errorf("Since = %v, want the first record's %v", stats.Since, want)
+	}
+	if want := time.Date(2026, 1, 1, 11, 43, 0, 0, time.UTC); !stats.Updated.Equal(want) {
+		t.Errorf("Updated = %v, want the last record's %v", stats.Updated, want)
+	}
+	rows := stats.Rows()
+	var types []string
+	for _, r := range rows {
+		types = append(types, r.EventType)
+	}
+	// The largest total first, then by type.
+	if fmt.Sprint(types) != "[tool-call-finished session-end session-start unknown]" {
+		t.Errorf("rows in order %v", types)
+	}
+	r := rows[0]
+	if r.Count != 100 || r.TotalBytes != 505000 || r.Max != 10000 {
+		t.Errorf("row = %+v", r)
+	}
+	if math.Abs(r.P50-5000) > 50 || math.Abs(r.P95-9500) > 95 {
+		t.Errorf("p50, p95 = %v, %v; want about 5000, 9500", r.P50, r.P95)
+	}
+}
+
+func TestLoadMissingAndCorrupt(t *testing.T) {
+	s := sizestats.New(statsPath(t))
+	if stats, err := s.Load(); err != nil || len(stats.Rows()) != 0 {
+		t.Errorf("no state file: %v, %v", stats, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.Path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(); err == nil {
+		t.Error("Load of a corrupt state file succeeded")
+	}
+	// Record starts a corrupt file afresh.
+	if err := s.Record("session-start", 10); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := s.Load(); err != nil || len(stats.Rows()) != 1 || stats.Rows()[0].Count != 1 {
+		t.Errorf("after Record: %v, %v", stats, err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	s := sizestats.New(statsPath(t))
+	if err := s.Reset(); err != nil {
+		t.Errorf("Reset without statistics: %v", err)
+	}
+	s.Record("session-start", 10)
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := s.Load()
+	if err != nil || len(stats.Events) != 0 || !stats.Since.IsZero() {
+		t.Errorf("after Reset: %+v, %v", stats, err)
+	}
+}
+
+func TestConcurrentRecords(t *testing.T) {
+	// No sample is lost when goroutines and hook processes record at once.
+	path := statsPath(t)
+	const goroutines, processes, n = 4, 4, 25
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if err := sizestats.New(path).Record("tool-call-finished", 100); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	cmds := make([]*exec.Cmd, processes)
+	for p := range cmds {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), "SIZESTATS_TEST_PATH="+path, "SIZESTATS_TEST_COUNT="+strconv.Itoa(n))
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds[p] = cmd
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Error(err)
+		}
+	}
+	wg.Wait()
+	stats, err := sizestats.New(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sk := stats.Events["tool-call-finished"]; sk == nil || sk.Count != (goroutines+processes)*n || sk.Sum != (goroutines+processes)*n*100 {
+		t.Errorf("recorded %+v, want %d samples", sk, (goroutines+processes)*n)
+	}
+}
+
+func TestPackageRecord(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	if want := filepath.Join(home, "hooks", "stats.json"); sizestats.DefaultPath() != want {
+		t.Errorf("DefaultPath = %s, want %s", sizestats.DefaultPath(), want)
+	}
+	sizestats.Record("session-start", 42)
+	stats, err := sizestats.New(sizestats.DefaultPath()).Load()
+	if err != nil || stats.Events["session-start"] == nil || stats.Events["session-start"].Sum != 42 {
+		t.Errorf("after Record: %+v, %v", stats, err)
+	}
+}
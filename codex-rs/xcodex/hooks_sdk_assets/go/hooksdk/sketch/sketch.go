@@ -0,0 +1,183 @@
+// Package sketch estimates quantiles (p50, p95, ...) of a stream of non-negative values in little
+// space, with a bounded relative error, so a distribution can be kept in a state file and updated
+// by one hook process after another.
+//
+// A Sketch counts values in logarithmically sized bins, as DDSketch does: a quantile it reports is
+// within RelativeAccuracy of the true value (1% by default), however skewed the values are.
+// Sketches with the same accuracy merge exactly, and they encode to JSON.
+//
+//	s := sketch.New(0)
+//	for _, size := range sizes {
+//		s.Add(float64(size))
+//	}
+//	fmt.Println(s.Quantile(0.5), s.Quantile(0.95), s.Max)
+package sketch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// DefaultRelativeAccuracy is the accuracy of New(0).
+const DefaultRelativeAccuracy = 0.01
+
+// MaxBins bounds the bins of a Sketch. Past it the lowest bins are merged, which only costs
+// accuracy on the smallest values; at 1% accuracy it takes values spanning a factor of 10^17 to
+// get there.
+const MaxBins = 2048
+
+// Sketch is a quantile sketch. Its fields are exported for encoding; use the methods to change
+// them.
+type Sketch struct {
+	// RelativeAccuracy is the bound on a quantile's relative error, in (0, 1).
+	RelativeAccuracy float64 `json:"relative_accuracy"`
+	Count            uint64  `json:"count"`
+	Sum              float64 `json:"sum"`
+	Min              float64 `json:"min"`
+	Max              float64 `json:"max"`
+	// Zeros counts the values too small for a bin (zero, and negative values, counted as zero).
+	Zeros uint64 `json:"zeros,omitempty"`
+	// Bins maps a bin index i to the count of values in (γ^(i-1), γ^i], for
+	// γ = (1+RelativeAccuracy)/(1-RelativeAccuracy).
+	Bins map[int]uint64 `json:"bins,omitempty"`
+}
+
+// New returns an empty Sketch with the given relative accuracy; values outside (0, 1) mean
+// DefaultRelativeAccuracy.
+func New(relativeAccuracy float64) *Sketch {
+	if !(relativeAccuracy > 0 && relativeAccuracy < 1) {
+		relativeAccuracy = DefaultRelativeAccuracy
+	}
+	return &Sketch{RelativeAccuracy: relativeAccuracy}
+}
+
+// minIndexable is the smallest value given a bin; anything below it counts as zero.
+const minIndexable = 1e-9
+
+func (s *Sketch) gamma() float64 {
+	return (1 + s.RelativeAccuracy) / (1 - s.RelativeAccuracy)
+}
+
+func (s *Sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+// value is the estimate for bin i: the point within relative accuracy of both of its ends.
+func (s *Sketch) value(i int) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+// Add records v. NaN is ignored, and negative values count as zero.
+func (s *Sketch) Add(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	if v < 0 {
+		v = 0
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+	if v < minIndexable {
+		s.Zeros++
+		return
+	}
+	if s.Bins == nil {
+		s.Bins = map[int]uint64{}
+	}
+	s.Bins[s.index(v)]++
+	s.collapse()
+}
+
+// Merge adds the values of o to s. Both must have the same RelativeAccuracy.
+func (s *Sketch) Merge(o *Sketch) error {
+	if o == nil || o.Count == 0 {
+		return nil
+	}
+	if s.RelativeAccuracy != o.RelativeAccuracy {
+		return fmt.Errorf("sketch: can't merge relative accuracy %v into %v", o.RelativeAccuracy, s.RelativeAccuracy)
+	}
+	if s.Count == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Count == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.Count += o.Count
+	s.Sum += o.Sum
+	s.Zeros += o.Zeros
+	if len(o.Bins) > 0 && s.Bins == nil {
+		s.Bins = map[int]uint64{}
+	}
+	for i, n := range o.Bins {
+		s.Bins[i] += n
+	}
+	s.collapse()
+	return nil
+}
+
+// collapse merges the lowest bins into the next one until at most MaxBins remain.
+func (s *Sketch) collapse() {
+	if len(s.Bins) <= MaxBins {
+		return
+	}
+	keys := s.sortedBins()
+	excess := len(keys) - MaxBins
+	into := keys[excess]
+	for _, i := range keys[:excess] {
+		s.Bins[into] += s.Bins[i]
+		delete(s.Bins, i)
+	}
+}
+
+func (s *Sketch) sortedBins() []int {
+	keys := make([]int, 0, len(s.Bins))
+	for i := range s.Bins {
+		keys = append(keys, i)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// Quantile returns an estimate of the q-quantile (0.5 for the median), within RelativeAccuracy of
+// a value at that rank, and always within [Min, Max]. q is clamped to [0, 1]; an empty Sketch
+// returns 0.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return s.Min
+	}
+	if q >= 1 {
+		return s.Max
+	}
+	// The value of rank floor(q*(n-1)), counting from 0.
+	rank := uint64(q * float64(s.Count-1))
+	seen := s.Zeros
+	if rank < seen {
+		return s.Min
+	}
+	for _, i := range s.sortedBins() {
+		seen += s.Bins[i]
+		if rank < seen {
+			return math.Max(s.Min, math.Min(s.Max, s.value(i)))
+		}
+	}
+	return s.Max
+}
+
+// Mean returns the mean of the values, or 0 for an empty Sketch.
+func (s *Sketch) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
@@ -0,0 +1,196 @@
+package sketch_test
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/sketch"
+)
+
+// exactQuantile is the value of rank floor(q*(n-1)) of sorted, as Quantile estimates it.
+func exactQuantile(sorted []float64, q float64) float64 {
+	return sorted[int(q*float64(len(sorted)-1))]
+}
+
+// checkAccuracy checks every percentile of s against the exact ones of values.
+func checkAccuracy(t *testing.T, name string, s *sketch.Sketch, values []float64) {
+	t.Helper()
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	for p := 1; p < 100; p++ {
+		q := float64(p) / 100
+		want, got := exactQuantile(sorted, q), s.Quantile(q)
+		// A little slack for floating-point error at bin edges.
+		if math.Abs(got-want) > want*s.RelativeAccuracy*1.0001 {
+			t.Errorf("%s: p%d = %v, want %v within %v", name, p, got, want, s.RelativeAccuracy)
+		}
+	}
+	if s.Quantile(0) != sorted[0] || s.Quantile(1) != sorted[len(sorted)-1] {
+		t.Errorf("%s: p0, p100 = %v, %v; want the min and max %v, %v", name, s.Quantile(0), s.Quantile(1), sorted[0], sorted[len(sorted)-1])
+	}
+}
+
+func TestQuantileAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	distributions := map[string]func() float64{
+		"uniform":     func() float64 { return 1 + rng.Float64()*1e6 },
+		"exponential": func() float64 { return 1 + rng.ExpFloat64()*4096 },
+		// Payload sizes: mostly small, with a long tail of huge ones.
+		"lognormal": func() float64 { return math.Exp(rng.NormFloat64()*2 + 8) },
+		"pareto":    func() float64 { return 100 / math.Pow(1-rng.Float64(), 1/1.1) },
+		"constant":  func() float64 { return 4242 },
+		"integers":  func() float64 { return float64(rng.Intn(50) + 1) },
+	}
+	for name, next := range distributions {
+		for _, accuracy := range []float64{0.01, 0.05} {
+			s := sketch.New(accuracy)
+			values := make([]float64, 20000)
+			for i := range values {
+				values[i] = next()
+				s.Add(values[i])
+			}
+			checkAccuracy(t, name, s, values)
+			if s.Count != uint64(len(values)) {
+				t.Errorf("%s: Count = %d, want %d", name, s.Count, len(values))
+			}
+		}
+	}
+}
+
+func TestSmallSketches(t *testing.T) {
+	s := sketch.New(0)
+	if s.RelativeAccuracy != sketch.DefaultRelativeAccuracy || s.Quantile(0.5) != 0 || s.Mean() != 0 {
+		t.Errorf("empty sketch: %+v, p50 %v", s, s.Quantile(0.5))
+	}
+	for _, v := range []float64{-1, 2} {
+		if sketch.New(v).RelativeAccuracy != sketch.DefaultRelativeAccuracy {
+			t.Errorf("New(%v) didn't default the accuracy", v)
+		}
+	}
+
+	s.Add(100)
+	if s.Quantile(0.5) != 100 || s.Min != 100 || s.Max != 100 {
+		t.Errorf("one value: p50 %v, min %v, max %v", s.Quantile(0.5), s.Min, s.Max)
+	}
+
+	// Zero and negative values count as zero, NaN isn't counted.
+	s = sketch.New(0)
+	for _, v := range []float64{0, -5, math.NaN(), 10, 20} {
+		s.Add(v)
+	}
+	if s.Count != 4 || s.Zeros != 2 || s.Min != 0 || s.Max != 20 || s.Sum != 30 || s.Mean() != 7.5 {
+		t.Errorf("sketch = %+v", s)
+	}
+	if s.Quantile(0.25) != 0 || math.Abs(s.Quantile(0.75)-10) > 0.1 {
+		t.Errorf("p25, p75 = %v, %v; want 0, 10", s.Quantile(0.25), s.Quantile(0.75))
+	}
+	// Estimates stay within [Min, Max].
+	s = sketch.New(0.2)
+	s.Add(1000)
+	s.Add(1001)
+	if q := s.Quantile(0.99); q < 1000 || q > 1001 {
+		t.Errorf("p99 = %v, outside [1000, 1001]", q)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	a, b, all := sketch.New(0), sketch.New(0), sketch.New(0)
+	var values []float64
+	for i := 0; i < 5000; i++ {
+		v := math.Exp(rng.NormFloat64()*3 + 6)
+		values = append(values, v)
+		all.Add(v)
+		if i%3 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+	}
+	b.Add(0)
+	all.Add(0)
+	values = append(values, 0)
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if a.Count != all.Count || a.Zeros != all.Zeros || a.Min != all.Min || a.Max != all.Max || math.Abs(a.Sum-all.Sum) > 1e-6*all.Sum {
+		t.Errorf("merged %+v, want %+v", a, all)
+	}
+	for i, n := range all.Bins {
+		if a.Bins[i] != n {
+			t.Errorf("bin %d: merged %d, want %d", i, a.Bins[i], n)
+		}
+	}
+	checkAccuracy(t, "merged", a, values)
+
+	// Into an empty sketch, and from an empty or nil one.
+	empty := sketch.New(0)
+	if err := empty.Merge(b); err != nil || empty.Count != b.Count || empty.Min != b.Min {
+		t.Errorf("merge into empty: %+v, %v", empty, err)
+	}
+	before := *b
+	if err := b.Merge(sketch.New(0.5)); err != nil || b.Count != before.Count {
+		t.Errorf("merge of an empty sketch: %+v, %v", b, err)
+	}
+	if err := b.Merge(nil); err != nil {
+		t.Errorf("merge of nil: %v", err)
+	}
+	other := sketch.New(0.05)
+	other.Add(1)
+	if err := b.Merge(other); err == nil {
+		t.Error("merged sketches of different accuracy")
+	}
+}
+
+func TestMaxBins(t *testing.T) {
+	// Values spanning 40 decades, more than twice what MaxBins covers at 1%: the lowest bins are
+	// merged, and the quantiles in the upper 17 decades stay accurate.
+	s := sketch.New(0.01)
+	var values []float64
+	for e := 0.0; e < 40; e += 0.01 {
+		v := math.Pow(10, e)
+		values = append(values, v)
+		s.Add(v)
+	}
+	if len(s.Bins) > sketch.MaxBins {
+		t.Errorf("%d bins, want at most %d", len(s.Bins), sketch.MaxBins)
+	}
+	if s.Count != uint64(len(values)) {
+		t.Errorf("Count = %d, want %d", s.Count, len(values))
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	for _, q := range []float64{0.6, 0.9, 0.99} {
+		if want, got := exactQuantile(sorted, q), s.Quantile(q); math.Abs(got-want) > want*0.0101 {
+			t.Errorf("p%v = %v, want %v", q*100, got, want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	s := sketch.New(0)
+	for _, v := range []float64{0, 12, 1500, 1500, 70000} {
+		s.Add(v)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back sketch.Sketch
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []float64{0, 0.25, 0.5, 0.95, 1} {
+		if back.Quantile(q) != s.Quantile(q) {
+			t.Errorf("p%v after JSON = %v, want %v", q*100, back.Quantile(q), s.Quantile(q))
+		}
+	}
+	// A decoded sketch keeps counting.
+	back.Add(3)
+	if back.Count != 6 || back.Min != 0 {
+		t.Errorf("decoded sketch after Add: %+v", back)
+	}
+}
@@ -0,0 +1,373 @@
+// Package state is a small keyed store for hooks that keep state between events: rate limits,
+// begins waiting for their end, and the like.
+//
+// Every event runs in a new process, so a store lives in a file, and every call holds a lock on
+// it, so concurrent hooks see each other's changes and never lose one. Values are JSON; each can
+// expire after a TTL, and a store past its MaxEntries drops the keys used least recently.
+//
+//	st, err := state.Open("my_hook")
+//	if err != nil {
+//		return err
+//	}
+//	err = st.Update("count:"+payload.SessionID(), func(e *state.Entry) error {
+//		var n int
+//		if _, err := e.Decode(&n); err != nil {
+//			return err
+//		}
+//		return e.Set(n+1, 24*time.Hour)
+//	})
+//
+// The file is a log: each change appends one line of JSON, and once most lines are stale the
+// log is compacted, by writing the live entries to a new file that replaces it. A crash while
+// appending leaves at most a torn last line, which is skipped; a crash while compacting leaves the
+// old log in place.
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/filelock"
+)
+
+// DefaultMaxEntries is the MaxEntries of stores made by Open and OpenPath.
+const DefaultMaxEntries = 10000
+
+// DefaultLockTimeout is how long a call waits for the store's lock when LockTimeout is zero.
+const DefaultLockTimeout = 5 * time.Second
+
+// compactSlack is how many stale lines a log may carry beyond its live entries before it is
+// compacted, so a small store isn't rewritten on every change.
+const compactSlack = 64
+
+// Store is a keyed store in one file. Its methods may be called from any number of processes at
+// once.
+type Store struct {
+	// Path is the store's file; the lock is `<Path>.lock` and compaction writes `<Path>.tmp`.
+	Path string
+	// MaxEntries caps the number of keys: past it, the keys read or written least recently are
+	// dropped. Zero is no cap.
+	MaxEntries int
+	// LockTimeout bounds how long a call waits for the lock; zero means DefaultLockTimeout.
+	LockTimeout time.Duration
+	// Now is the clock; nil means time.Now.
+	Now func() time.Time
+}
+
+// Open returns the store called name, `hooks/state/<name>.state` under CODEX_HOME (default
+// `~/.xcodex`), with DefaultMaxEntries. name must be a plain file name.
+func Open(name string) (*Store, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("state: invalid store name %q", name)
+	}
+	return OpenPath(hooksdk.Environ().Path("hooks", "state", name+".state"))
+}
+
+// OpenPath returns a store kept in the file at path, with DefaultMaxEntries, creating the
+// directory it is in. The file itself is created by the first change.
+func OpenPath(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{Path: path, MaxEntries: DefaultMaxEntries}, nil
+}
+
+// Entry is a key's value as Update sees it, to read and change.
+type Entry struct {
+	Key string
+	// Value is the key's JSON value, or nil when it has none (or it expired). Setting it to nil
+	// deletes the key.
+	Value json.RawMessage
+	// Expires is when the value expires; zero is never.
+	Expires time.Time
+
+	now time.Time
+}
+
+// Now returns the time of the call, the store's clock when it took the lock.
+func (e *Entry) Now() time.Time { return e.now }
+
+// Decode decodes the value into v, as by json.Unmarshal; ok is false, and v untouched, when the
+// key has no value.
+func (e *Entry) Decode(v any) (ok bool, err error) {
+	if e.Value == nil {
+		return false, nil
+	}
+	return true, json.Unmarshal(e.Value, v)
+}
+
+// Set sets the value to v, encoded as by json.Marshal, expiring ttl from now (zero: never).
+func (e *Entry) Set(v any, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.Value, e.Expires = data, time.Time{}
+	if ttl > 0 {
+		e.Expires = e.now.Add(ttl)
+	}
+	return nil
+}
+
+// Delete removes the key.
+func (e *Entry) Delete() { e.Value = nil }
+
+// Get decodes key's value into v, as by json.Unmarshal; ok is false when it has none.
+func (s *Store) Get(key string, v any) (ok bool, err error) {
+	err = s.Update(key, func(e *Entry) error {
+		ok, err = e.Decode(v)
+		return err
+	})
+	return ok, err
+}
+
+// Put sets key's value to v, expiring ttl from now (zero: never).
+func (s *Store) Put(key string, v any, ttl time.Duration) error {
+	return s.Update(key, func(e *Entry) error { return e.Set(v, ttl) })
+}
+
+// Delete removes key.
+func (s *Store) Delete(key string) error {
+	return s.Update(key, func(e *Entry) error {
+		e.Delete()
+		return nil
+	})
+}
+
+// Update calls fn with key's entry under the store's lock and saves what fn changed, so no other
+// call can change the key in between. When fn returns an error, nothing is saved and Update
+// returns it.
+func (s *Store) Update(key string, fn func(e *Entry) error) error {
+	if key == "" {
+		return errors.New("state: empty key")
+	}
+	return s.locked(func(l *log, now time.Time) error {
+		old, had := l.entries[key]
+		e := &Entry{Key: key, now: now}
+		if had {
+			e.Value, e.Expires = old.value, fromMillis(old.expires)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+		var rec record
+		switch {
+		case e.Value == nil && !had:
+			return nil
+		case e.Value == nil:
+			rec = record{Key: key, Deleted: true}
+		case had && bytes.Equal(e.Value, old.value) && toMillis(e.Expires) == old.expires:
+			if s.MaxEntries <= 0 || old.seq == l.seq {
+				return nil
+			}
+			// Only recency changed, which eviction needs to know.
+			rec = record{Key: key}
+		default:
+			rec = record{Key: key, Value: append(json.RawMessage(nil), e.Value...), Expires: toMillis(e.Expires)}
+		}
+		return s.commit(l, rec)
+	})
+}
+
+// record is one line of the log: a value for Key, its deletion, or (with neither) a use of it.
+type record struct {
+	Key   string          `json:"k"`
+	Value json.RawMessage `json:"v,omitempty"`
+	// Expires is in Unix milliseconds; zero is never.
+	Expires int64 `json:"e,omitempty"`
+	Deleted bool  `json:"d,omitempty"`
+}
+
+type entry struct {
+	value   json.RawMessage
+	expires int64
+	// seq is the line that last set or used the entry, for eviction.
+	seq int
+}
+
+// log is the store's file as read: its live entries, the lines it has, and whether the last one is
+// missing its newline.
+type log struct {
+	entries map[string]*entry
+	seq     int
+	torn    bool
+}
+
+func (l *log) apply(rec record) {
+	l.seq++
+	switch {
+	case rec.Deleted:
+		delete(l.entries, rec.Key)
+	case rec.Value != nil:
+		l.entries[rec.Key] = &entry{value: rec.Value, expires: rec.Expires, seq: l.seq}
+	default:
+		if e, ok := l.entries[rec.Key]; ok {
+			e.seq = l.seq
+		}
+	}
+}
+
+// locked runs fn on the log read under the lock.
+func (s *Store) locked(fn func(l *log, now time.Time) error) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	timeout := s.LockTimeout
+	if timeout == 0 {
+		timeout = DefaultLockTimeout
+	}
+	lock, err := filelock.AcquireTimeout(s.Path+".lock", timeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	l, err := s.load(now)
+	if err != nil {
+		return err
+	}
+	return fn(l, now)
+}
+
+// load reads the log, without the entries that expired by now. A missing file is an empty log;
+// lines that aren't records (a torn write, or a file that isn't a log) are skipped.
+func (s *Store) load(now time.Time) (*log, error) {
+	l := &log{entries: map[string]*entry{}}
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.torn = len(data) > 0 && data[len(data)-1] != '\n'
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		var rec record
+		if json.Unmarshal(line, &rec) != nil || rec.Key == "" {
+			l.seq++
+			continue
+		}
+		l.apply(rec)
+	}
+	for key, e := range l.entries {
+		if e.expires != 0 && now.UnixMilli() >= e.expires {
+			delete(l.entries, key)
+		}
+	}
+	return l, nil
+}
+
+// commit saves rec: appended to the log, or, when that leaves the log mostly stale or the store
+// past MaxEntries, by compacting it.
+func (s *Store) commit(l *log, rec record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	l.apply(rec)
+	evicted := s.evict(l)
+	if evicted || l.seq > 2*len(l.entries)+compactSlack {
+		return s.compact(l)
+	}
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if l.torn {
+		// End the torn line, so it stays one skipped line rather than spoiling this one.
+		line = append([]byte{'\n'}, line...)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// evict drops the entries used least recently past MaxEntries, reporting whether there were any.
+func (s *Store) evict(l *log) bool {
+	extra := len(l.entries) - s.MaxEntries
+	if s.MaxEntries <= 0 || extra <= 0 {
+		return false
+	}
+	for _, key := range l.byUse()[:extra] {
+		delete(l.entries, key)
+	}
+	return true
+}
+
+// byUse returns the keys of l, used least recently first.
+func (l *log) byUse() []string {
+	keys := make([]string, 0, len(l.entries))
+	for key := range l.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return l.entries[keys[i]].seq < l.entries[keys[j]].seq })
+	return keys
+}
+
+// compact replaces the log with one line per live entry, least recently used first so the order
+// survives. The new log is written to a temporary file and synced before it replaces the old one,
+// so a crash at any point leaves one or the other whole.
+func (s *Store) compact(l *log) error {
+	var buf bytes.Buffer
+	for _, key := range l.byUse() {
+		e := l.entries[key]
+		line, err := json.Marshal(record{Key: key, Value: e.value, Expires: e.expires})
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	tmp := s.Path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+func toMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,440 @@
+package state_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/state"
+)
+
+// TestMain lets the tests run this binary as a hook process: with STATE_TEST_PATH set, it
+// increments the counter "n" STATE_TEST_COUNT times (forever when it is 0), putting a key per
+// increment beside it so the log keeps compacting, and exits.
+func TestMain(m *testing.M) {
+	if path := os.Getenv("STATE_TEST_PATH"); path != "" {
+		n, _ := strconv.Atoi(os.Getenv("STATE_TEST_COUNT"))
+		s := state.Store{Path: path, MaxEntries: 20, LockTimeout: time.Minute}
+		for i := 0; n == 0 || i < n; i++ {
+			if err := increment(&s, "n"); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			if err := s.Put(fmt.Sprintf("key%d-%d", os.Getpid(), i), strings.Repeat("x", 100), 0); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func increment(s *state.Store, key string) error {
+	return s.Update(key, func(e *state.Entry) error {
+		var n int
+		if _, err := e.Decode(&n); err != nil {
+			return err
+		}
+		return e.Set(n+1, 0)
+	})
+}
+
+// clock is a settable time for Store.Now.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// store returns a store in a fresh directory, reading the time from c.
+func store(t *testing.T, c *clock) *state.Store {
+	t.Helper()
+	s, err := state.OpenPath(filepath.Join(t.TempDir(), "test.state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Now = c.now
+	return s
+}
+
+func get(t *testing.T, s *state.Store, key string) (string, bool) {
+	t.Helper()
+	var v string
+	ok, err := s.Get(key, &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, ok
+}
+
+func put(t *testing.T, s *state.Store, key, v string, ttl time.Duration) {
+	t.Helper()
+	if err := s.Put(key, v, ttl); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lines(t *testing.T, s *state.Store) int {
+	t.Helper()
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestGetPutDelete(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	if v, ok := get(t, s, "a"); ok {
+		t.Errorf("Get of a missing key = %q", v)
+	}
+	if _, err := os.Stat(s.Path); err == nil {
+		t.Error("a read created the file")
+	}
+	put(t, s, "a", "one", 0)
+	put(t, s, "b", "two", 0)
+	put(t, s, "a", "uno", 0)
+	if v, ok := get(t, s, "a"); !ok || v != "uno" {
+		t.Errorf("Get(a) = %q, %v", v, ok)
+	}
+	if err := s.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := get(t, s, "a"); ok {
+		t.Error("a deleted key is still there")
+	}
+	// Deleting a missing key changes nothing.
+	before := lines(t, s)
+	if err := s.Delete("missing"); err != nil || lines(t, s) != before {
+		t.Errorf("Delete of a missing key: %v, %d lines from %d", err, lines(t, s), before)
+	}
+	// Another Store on the file sees the same values.
+	other := &state.Store{Path: s.Path}
+	if v, ok := get(t, other, "b"); !ok || v != "two" {
+		t.Errorf("another store: Get(b) = %q, %v", v, ok)
+	}
+
+	if err := s.Put("", "x", 0); err == nil {
+		t.Error("Put with an empty key succeeded")
+	}
+	if err := s.Put("f", func() {}, 0); err == nil {
+		t.Error("Put of a value JSON can't encode succeeded")
+	}
+	var n int
+	if _, err := s.Get("b", &n); err == nil {
+		t.Error("Get into the wrong type succeeded")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c := &clock{time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	s := store(t, c)
+	put(t, s, "k", "v", time.Hour)
+
+	err := s.Update("k", func(e *state.Entry) error {
+		if e.Key != "k" || string(e.Value) != `"v"` || !e.Expires.Equal(c.t.Add(time.Hour)) || !e.Now().Equal(c.t) {
+			t.Errorf("entry = %+v (now %v)", e, e.Now())
+		}
+		return e.Set(map[string]int{"n": 1}, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]int
+	if ok, err := s.Get("k", &m); !ok || err != nil || m["n"] != 1 {
+		t.Errorf("after Update: %v, %v, %v", m, ok, err)
+	}
+
+	// An error from fn saves nothing.
+	boom := errors.New("boom")
+	before := lines(t, s)
+	if err := s.Update("k", func(e *state.Entry) error {
+		e.Delete()
+		return boom
+	}); err != boom {
+		t.Errorf("Update = %v, want fn's error", err)
+	}
+	if ok, _ := s.Get("k", &m); !ok || lines(t, s) != before {
+		t.Error("a failed Update changed the store")
+	}
+	// Setting Value to nil deletes the key.
+	if err := s.Update("k", func(e *state.Entry) error { e.Value = nil; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.Get("k", &m); ok {
+		t.Error("a nil Value didn't delete the key")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := &clock{time.Now()}
+	s := store(t, c)
+	put(t, s, "short", "s", time.Minute)
+	put(t, s, "long", "l", time.Hour)
+	put(t, s, "forever", "f", 0)
+
+	c.advance(time.Minute - time.Millisecond)
+	if _, ok := get(t, s, "short"); !ok {
+		t.Error("expired early")
+	}
+	c.advance(time.Millisecond)
+	if _, ok := get(t, s, "short"); ok {
+		t.Error("didn't expire after its TTL")
+	}
+	c.advance(24 * time.Hour)
+	if _, ok := get(t, s, "long"); ok {
+		t.Error("long didn't expire")
+	}
+	if v, ok := get(t, s, "forever"); !ok || v != "f" {
+		t.Errorf("a value without a TTL expired: %q, %v", v, ok)
+	}
+	// An expired key reads as new to Update.
+	if err := s.Update("short", func(e *state.Entry) error {
+		if e.Value != nil || !e.Expires.IsZero() {
+			t.Errorf("expired entry = %+v", e)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	s.MaxEntries = 3
+	put(t, s, "a", "1", 0)
+	put(t, s, "b", "2", 0)
+	put(t, s, "c", "3", 0)
+	// Reading a makes b the least recently used.
+	get(t, s, "a")
+	put(t, s, "d", "4", 0)
+	// A store without a cap reads without recording a use, leaving the order alone.
+	peek := &state.Store{Path: s.Path}
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, ok := get(t, peek, key); ok != want {
+			t.Errorf("%s kept = %v, want %v", key, ok, want)
+		}
+	}
+	// The order survives the compaction eviction does: c is now the oldest.
+	put(t, s, "e", "5", 0)
+	if _, ok := get(t, peek, "c"); ok {
+		t.Error("c survived; recency was lost in compaction")
+	}
+	if n := lines(t, s); n > 3+64 {
+		t.Errorf("%d lines for 3 entries", n)
+	}
+
+	// Without a cap nothing is evicted, and reads don't write.
+	s = store(t, &clock{time.Now()})
+	s.MaxEntries = 0
+	for i := 0; i < 50; i++ {
+		put(t, s, fmt.Sprint(i), "v", 0)
+	}
+	before := lines(t, s)
+	get(t, s, "0")
+	if _, ok := get(t, s, "0"); !ok || lines(t, s) != before {
+		t.Errorf("uncapped: %d lines after reads, want %d", lines(t, s), before)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	for i := 0; i < 1000; i++ {
+		put(t, s, "hot", fmt.Sprint(i), 0)
+		put(t, s, fmt.Sprint("k", i%10), "v", 0)
+	}
+	// 11 live entries; the log stays within their slack rather than growing to 2000 lines.
+	if n := lines(t, s); n > 2*11+64+1 {
+		t.Errorf("%d lines after 2000 writes of 11 keys", n)
+	}
+	if v, ok := get(t, s, "hot"); !ok || v != "999" {
+		t.Errorf("hot = %q, %v", v, ok)
+	}
+	if _, err := os.Stat(s.Path + ".tmp"); err == nil {
+		t.Error("compaction left its temporary file")
+	}
+}
+
+func TestTornAndCorrupt(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	put(t, s, "a", "1", 0)
+	put(t, s, "b", "2", 0)
+
+	// A crash while appending leaves a torn last line: it is skipped, and the next write starts a
+	// line of its own.
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"k":"a","v":"torn`)
+	f.Close()
+	if v, ok := get(t, s, "a"); !ok || v != "1" {
+		t.Errorf("after a torn line: a = %q, %v", v, ok)
+	}
+	put(t, s, "c", "3", 0)
+	for key, want := range map[string]string{"a": "1", "b": "2", "c": "3"} {
+		if v, _ := get(t, s, key); v != want {
+			t.Errorf("%s = %q, want %q", key, v, want)
+		}
+	}
+
+	// A file that isn't a log at all reads as empty and can be written.
+	if err := os.WriteFile(s.Path, []byte("not a log\n{\"x\":1}\n\x00\x01"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := get(t, s, "a"); ok {
+		t.Error("garbage read as a value")
+	}
+	put(t, s, "a", "new", 0)
+	if v, ok := get(t, s, "a"); !ok || v != "new" {
+		t.Errorf("after garbage: a = %q, %v", v, ok)
+	}
+}
+
+func TestCrashDuringCompaction(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	put(t, s, "a", "1", 0)
+
+	// A crash before the rename leaves a half-written temporary file beside the whole log: it is
+	// ignored, and the next compaction writes over it.
+	if err := os.WriteFile(s.Path+".tmp", []byte(`{"k":"a","v":"half`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := get(t, s, "a"); !ok || v != "1" {
+		t.Errorf("beside a half-written compaction: a = %q, %v", v, ok)
+	}
+	s.MaxEntries = 1
+	put(t, s, "b", "2", 0) // evicts a, compacting
+	if _, err := os.Stat(s.Path + ".tmp"); err == nil {
+		t.Error("the temporary file is still there after compacting")
+	}
+	if v, ok := get(t, s, "b"); !ok || v != "2" {
+		t.Errorf("after compacting: b = %q, %v", v, ok)
+	}
+
+	// A process killed at any point, compacting or appending, leaves a store that reads and counts on.
+	path := filepath.Join(t.TempDir(), "killed.state")
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "STATE_TEST_PATH="+path, "STATE_TEST_COUNT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	cmd.Process.Kill()
+	cmd.Wait()
+	if stderr.Len() > 0 {
+		t.Fatalf("the writer failed: %s", stderr.String())
+	}
+	killed := &state.Store{Path: path, MaxEntries: 20}
+	var n int
+	if ok, err := killed.Get("n", &n); err != nil || !ok || n == 0 {
+		t.Fatalf("after a kill: n = %d, %v, %v", n, ok, err)
+	}
+	if err := increment(killed, "n"); err != nil {
+		t.Fatal(err)
+	}
+	var after int
+	if _, err := killed.Get("n", &after); err != nil || after != n+1 {
+		t.Errorf("after a kill: n went from %d to %d, %v", n, after, err)
+	}
+}
+
+func TestConcurrentUpdates(t *testing.T) {
+	// Hook processes and goroutines, each with a store of its own, share the one file; no
+	// increment is lost, through appends and compactions alike.
+	path := filepath.Join(t.TempDir(), "shared.state")
+	const (
+		procs      = 4
+		goroutines = 8
+		each       = 25
+	)
+	var wg sync.WaitGroup
+	errs := make(chan error, procs+goroutines)
+	for i := 0; i < procs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run=^$")
+			cmd.Env = append(os.Environ(), "STATE_TEST_PATH="+path, "STATE_TEST_COUNT="+strconv.Itoa(each))
+			if out, err := cmd.CombinedOutput(); err != nil {
+				errs <- fmt.Errorf("%v: %s", err, out)
+			}
+		}()
+	}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := state.Store{Path: path, MaxEntries: 20, LockTimeout: time.Minute}
+			for j := 0; j < each; j++ {
+				if err := increment(&s, "n"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	var n int
+	if _, err := (&state.Store{Path: path}).Get("n", &n); err != nil || n != (procs+goroutines)*each {
+		t.Errorf("n = %d, %v; want %d", n, err, (procs+goroutines)*each)
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	s := store(t, &clock{time.Now()})
+	s.LockTimeout = 50 * time.Millisecond
+	err := s.Update("outer", func(*state.Entry) error {
+		// The store's lock is held; another call can't take it.
+		inner := &state.Store{Path: s.Path, LockTimeout: 50 * time.Millisecond}
+		return inner.Put("inner", "x", 0)
+	})
+	if err == nil {
+		t.Error("a call got the lock another held")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	s, err := state.Open("my_hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, "hooks", "state", "my_hook.state"); s.Path != want || s.MaxEntries != state.DefaultMaxEntries {
+		t.Errorf("Open = %+v, want path %s", s, want)
+	}
+	if fi, err := os.Stat(filepath.Dir(s.Path)); err != nil || !fi.IsDir() {
+		t.Errorf("Open didn't create the directory: %v", err)
+	}
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`, "../escape"} {
+		if _, err := state.Open(name); err == nil {
+			t.Errorf("Open(%q) succeeded", name)
+		}
+	}
+
+	// The log is one record per line.
+	if err := s.Put("k", []int{1, 2}, 0); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(s.Path)
+	var rec map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(data), &rec); err != nil || rec["k"] != "k" {
+		t.Errorf("log = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,480 @@
+// Package summarize describes an event for a human, in the same words wherever it is shown: one
+// line for a notification title or a chat message, and a few lines for a body.
+//
+//	summarize.OneLine(payload)      // ran `go test ./...` in ~/proj, exit 1, 3.2s
+//	summarize.Detail(payload, 1000) // that line, then the command, output, files, and session
+//
+// Every event type the host emits has its own wording; other types get their type and the most
+// telling field they have. Durations and sizes are formatted the same way in every locale (see
+// Duration and Size), and text is cut at a character boundary, never inside one. Times are shown
+// in the zone of CODEX_HOOK_TZ, or a template's own setting (see Location and Time).
+package summarize
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/gitsnap"
+)
+
+// fragmentMax is the most bytes of a command, message, or file list that OneLine quotes.
+const fragmentMax = 80
+
+// A describer returns the line OneLine shows for an event.
+type describer func(e event) string
+
+// describers are the per-event-type describers; other types use describeDefault.
+var describers = map[hooksdk.EventType]describer{
+	hooksdk.EventSessionStart:           describeSessionStart,
+	hooksdk.EventSessionEnd:             describeSessionEnd,
+	hooksdk.EventUserPromptSubmit:       describePrompt,
+	hooksdk.EventToolCallStarted:        describeToolCallStarted,
+	hooksdk.EventToolCallFinished:       describeToolCallFinished,
+	hooksdk.EventApprovalRequested:      describeApproval,
+	hooksdk.EventModelRequestStarted:    describeModelRequest,
+	hooksdk.EventModelResponseCompleted: describeModelResponse,
+	hooksdk.EventAgentTurnComplete:      describeTurnComplete,
+	hooksdk.EventNotification:           describeNotification,
+	hooksdk.EventPreCompact:             describePreCompact,
+	hooksdk.EventSubagentStop:           describeSubagentStop,
+}
+
+// OneLine returns a one-line summary of p, e.g. "ran `go test ./...` in ~/proj, exit 1, 3.2s" for
+// a tool call or "approval needed to run `curl https://example.com` in ~/proj: needs network
+// access". Quoted commands and messages are shortened, so the line stays short enough for a title.
+func OneLine(p *hooksdk.HookPayload) string {
+	e := newEvent(p)
+	describe, ok := describers[p.Type()]
+	if !ok {
+		describe = describeDefault
+	}
+	return collapse(describe(e))
+}
+
+// Detail returns a summary of p of a few lines: OneLine, then what it shortened or left out (the
+// whole command, the prompt or message, the files a tool call changes, its output) and the session
+// (as its hooksdk.ShortID) and turn. It is cut to at most maxBytes, ending with "…" when it was;
+// maxBytes <= 0 doesn't limit it.
+func Detail(p *hooksdk.HookPayload, maxBytes int) string {
+	e := newEvent(p)
+	line := OneLine(p)
+	lines := []string{line}
+	// more adds text, unless OneLine already shows all of it.
+	more := func(label, text string) {
+		if text = strings.TrimSpace(text); text != "" && !strings.Contains(line, collapse(text)) {
+			lines = append(lines, label+text)
+		}
+	}
+	more("command: ", e.command())
+	more("files: ", strings.Join(e.paths(), ", "))
+	switch p.Type() {
+	case hooksdk.EventToolCallFinished:
+		if out := strings.TrimSpace(e.str("output_preview")); out != "" {
+			label := "output"
+			if n, ok := e.int("output_bytes"); ok {
+				label += " (" + Size(n) + ")"
+			}
+			lines = append(lines, label+":", out)
+		}
+	case hooksdk.EventApprovalRequested:
+		more("", e.str("reason", "message"))
+	case hooksdk.EventNotification:
+		more("", e.str("message"))
+	default:
+		more("", e.str("prompt", "last_assistant_message", "message", "reason"))
+	}
+	lines = append(lines, join(", ", prefixed("session ", hooksdk.ShortID(p.SessionID())), prefixed("turn ", e.str("turn_id"))))
+	return Truncate(join("\n", lines...), maxBytes)
+}
+
+// Duration formats d for reading, the same in every locale: 120ms, 3.2s, 1m4s, 2h5m. Every
+// human-facing duration the SDK shows goes through it.
+func Duration(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "-" + Duration(-d)
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d.Round(100*time.Millisecond) < time.Minute:
+		r := d.Round(100 * time.Millisecond)
+		return strings.TrimSuffix(strconv.FormatFloat(r.Seconds(), 'f', 1, 64), ".0") + "s"
+	case d.Round(time.Second) < time.Hour:
+		s := d.Round(time.Second).String()
+		if strings.HasSuffix(s, "m0s") {
+			s = strings.TrimSuffix(s, "0s")
+		}
+		return s
+	}
+	s := strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// Location returns the zone for human-facing times: the one named name (a template's own
+// setting), else the one in CODEX_HOOK_TZ (see hooksdk.TZEnv), else time.Local. A name
+// time.LoadLocation doesn't know is an error.
+func Location(name string) (*time.Location, error) {
+	if name == "" {
+		name = hooksdk.Environ().TZ
+	}
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// Time formats t for reading in loc (nil means time.Local), with the zone's abbreviation so that
+// readers elsewhere can tell: 2026-03-29 03:30:00 CEST. Machine-readable output uses MachineTime
+// instead, wherever the hook runs.
+func Time(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.Local
+	}
+	return t.In(loc).Format("2006-01-02 15:04:05 MST")
+}
+
+// Timestamp is Time for an RFC 3339 timestamp such as a payload's `timestamp`; s is returned as it
+// is when it doesn't parse.
+func Timestamp(s string, loc *time.Location) string {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return s
+	}
+	return Time(t, loc)
+}
+
+// MachineTime formats t for machine-readable output: RFC 3339 in UTC, whatever the zone settings.
+func MachineTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Size formats n bytes for reading, the same in every locale: 512 B, 1.5 KiB, 3.2 MiB.
+func Size(n int64) string {
+	if n < 1024 && n > -1024 {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	v := float64(n)
+	unit := 0
+	for ; unit < len(units)-1 && (v >= 1024 || v <= -1024); unit++ {
+		v /= 1024
+	}
+	return strings.TrimSuffix(strconv.FormatFloat(v, 'f', 1, 64), ".0") + " " + units[unit]
+}
+
+var units = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// Truncate shortens s to at most maxBytes, ending with "…" when it was cut, never splitting a
+// UTF-8 sequence. maxBytes <= 0 returns s unchanged.
+func Truncate(s string, maxBytes int) string {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s
+	}
+	const ellipsis = "…"
+	cut := maxBytes - len(ellipsis)
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	cut = len(strings.TrimRightFunc(s[:cut], isSpace))
+	if cut+len(ellipsis) > maxBytes {
+		return s[:cut]
+	}
+	return s[:cut] + ellipsis
+}
+
+func isSpace(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' }
+
+// event is the payload being summarized, with the lookups the describers share.
+type event struct {
+	p   *hooksdk.HookPayload
+	raw hooksdk.HookPayloadJSON
+}
+
+func newEvent(p *hooksdk.HookPayload) event {
+	return event{p: p, raw: hooksdk.HookPayloadJSON(p.RawPayload)}
+}
+
+// str returns the first of the string fields at paths that is set.
+func (e event) str(paths ...string) string {
+	for _, path := range paths {
+		if s, ok := hooksdk.StringField(e.raw, path); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+func (e event) int(path string) (int64, bool) { return hooksdk.IntField(e.raw, path) }
+
+// command is the shell command of the event: `command` (an approval's argv), or the command in
+// its tool_input.
+func (e event) command() string {
+	if c := commandText(e.raw["command"]); c != "" {
+		return c
+	}
+	if input, ok := e.raw["tool_input"].(map[string]any); ok {
+		return commandText(input["command"])
+	}
+	return ""
+}
+
+// paths are the files the event is about: an approval's `paths`, or those the tool call writes.
+func (e event) paths() []string {
+	if items, ok := e.raw["paths"].([]any); ok && len(items) > 0 {
+		out := make([]string, 0, len(items))
+		for _, item := range items {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	}
+	if e.command() != "" {
+		return nil
+	}
+	return gitsnap.TouchedPaths(e.raw["tool_input"])
+}
+
+// subject is what a tool call does, for the describers: running its command, editing its files,
+// or else calling the tool. past picks the past tense.
+func (e event) subject(past bool) string {
+	verbs := [3]string{"running", "editing", "calling"}
+	if past {
+		verbs = [3]string{"ran", "edited", "called"}
+	}
+	if c := e.command(); c != "" {
+		return verbs[0] + " " + quote(c)
+	}
+	if paths := e.paths(); len(paths) > 0 {
+		return verbs[1] + " " + fragment(strings.Join(paths, ", "))
+	}
+	tool := e.str("tool_name")
+	if tool == "" {
+		tool = "a tool"
+	}
+	return verbs[2] + " " + tool
+}
+
+// where is " in DIR" for the session's directory, with the home directory shown as ~, or "".
+func (e event) where() string {
+	cwd := e.p.WorkingDir()
+	if cwd == "" {
+		return ""
+	}
+	return " in " + tildePath(cwd)
+}
+
+// outcome is how a finished tool call went: "ok", "failed", "exit N", or its status.
+func (e event) outcome() string {
+	for _, path := range []string{"exit_code", "tool_response.exit_code", "tool_response.metadata.exit_code"} {
+		if n, ok := e.int(path); ok && n != 0 {
+			return "exit " + strconv.FormatInt(n, 10)
+		}
+	}
+	if ok, present := hooksdk.BoolField(e.raw, "success"); present {
+		if ok {
+			return "ok"
+		}
+		return "failed"
+	}
+	return e.str("status")
+}
+
+// describeDefault: `hook-interrupted: reviewer in ~/proj`, the type and the most telling field.
+func describeDefault(e event) string {
+	typ := e.p.EventType()
+	if typ == "" {
+		typ = "event"
+	}
+	return join(": ", typ, fragment(e.str("tool_name", "message", "reason", "status"))) + e.where()
+}
+
+// describeSessionStart: `session started in ~/proj (cli)`.
+func describeSessionStart(e event) string {
+	return "session started" + e.where() + parenthesized(e.str("session_source"))
+}
+
+// describeSessionEnd: `session ended in ~/proj (cli)`.
+func describeSessionEnd(e event) string {
+	return "session ended" + e.where() + parenthesized(e.str("session_source"))
+}
+
+// describePrompt: `prompt in ~/proj: fix the tests`.
+func describePrompt(e event) string {
+	return join(": ", "prompt"+e.where(), fragment(e.str("prompt")))
+}
+
+// describeToolCallStarted: "running `go test ./...` in ~/proj".
+func describeToolCallStarted(e event) string {
+	return e.subject(false) + e.where()
+}
+
+// describeToolCallFinished: "ran `go test ./...` in ~/proj, exit 1, 3.2s".
+func describeToolCallFinished(e event) string {
+	var took string
+	if ms, ok := e.int("duration_ms"); ok {
+		took = Duration(time.Duration(ms) * time.Millisecond)
+	}
+	return join(", ", e.subject(true)+e.where(), e.outcome(), took)
+}
+
+// describeApproval: "approval needed to run `rm -rf build` in ~/proj: outside the workspace".
+func describeApproval(e event) string {
+	what := "approval needed"
+	if c := e.command(); c != "" {
+		what += " to run " + quote(c)
+	} else if paths := e.paths(); len(paths) > 0 {
+		what += " to edit " + fragment(strings.Join(paths, ", "))
+	} else if tool := e.str("tool_name"); tool != "" {
+		what += " for " + tool
+	}
+	return join(": ", what+e.where(), fragment(e.str("reason", "message")))
+}
+
+// describeModelRequest: `model request to openai/gpt-5: 3 items, 5 tools, attempt 2`.
+func describeModelRequest(e event) string {
+	var counts []string
+	if n, ok := e.int("input_item_count"); ok {
+		counts = append(counts, plural(n, "item"))
+	}
+	if n, ok := e.int("tool_count"); ok {
+		counts = append(counts, plural(n, "tool"))
+	}
+	if n, ok := e.int("attempt"); ok && n > 1 {
+		counts = append(counts, "attempt "+strconv.FormatInt(n, 10))
+	}
+	model := join("/", e.str("provider"), e.str("model"))
+	return join(": ", join(" to ", "model request", model), join(", ", counts...))
+}
+
+// describeModelResponse: `model response: 1500 tokens (300 out), needs follow-up`.
+func describeModelResponse(e event) string {
+	var parts []string
+	if total, ok := e.int("token_usage.total_tokens"); ok {
+		tokens := plural(total, "token")
+		if out, ok := e.int("token_usage.output_tokens"); ok {
+			tokens += " (" + strconv.FormatInt(out, 10) + " out)"
+		}
+		parts = append(parts, tokens)
+	}
+	if followUp, _ := hooksdk.BoolField(e.raw, "needs_follow_up"); followUp {
+		parts = append(parts, "needs follow-up")
+	}
+	return join(": ", "model response", join(", ", parts...))
+}
+
+// describeTurnComplete: `turn complete in ~/proj: Done.`, with the last assistant message.
+func describeTurnComplete(e event) string {
+	return join(": ", "turn complete"+e.where(), fragment(e.str("last_assistant_message")))
+}
+
+// describeNotification: `xcodex: waiting for input`, the title and the message.
+func describeNotification(e event) string {
+	if line := join(": ", e.str("title"), fragment(e.str("message"))); line != "" {
+		return line
+	}
+	return join(" ", e.str("notification_type"), "notification")
+}
+
+// describePreCompact: `compacting the context (auto)`.
+func describePreCompact(e event) string {
+	return "compacting the context" + parenthesized(e.str("trigger"))
+}
+
+// describeSubagentStop: `subagent review completed`.
+func describeSubagentStop(e event) string {
+	return join(" ", "subagent", e.str("subagent", "tool_name"), e.str("status"))
+}
+
+// commandText renders a command given as an argv array or a string.
+func commandText(v any) string {
+	switch c := v.(type) {
+	case string:
+		return c
+	case []any:
+		parts := make([]string, len(c))
+		for i, item := range c {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, " ")
+	case []string:
+		return strings.Join(c, " ")
+	case nil:
+		return ""
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// quote returns s, shortened, in backticks.
+func quote(s string) string {
+	return "`" + fragment(s) + "`"
+}
+
+// fragment collapses s onto one line of at most fragmentMax bytes.
+func fragment(s string) string {
+	return Truncate(collapse(s), fragmentMax)
+}
+
+// collapse replaces each run of whitespace in s with a single space.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// tildePath shows path under the home directory as ~/....
+func tildePath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	rel, err := filepath.Rel(home, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	if rel == "." {
+		return "~"
+	}
+	return "~/" + filepath.ToSlash(rel)
+}
+
+func parenthesized(s string) string {
+	if s == "" {
+		return ""
+	}
+	return " (" + s + ")"
+}
+
+func prefixed(prefix, s string) string {
+	if s == "" {
+		return ""
+	}
+	return prefix + s
+}
+
+// join joins the non-empty parts with sep.
+func join(sep string, parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+func plural(n int64, noun string) string {
+	s := strconv.FormatInt(n, 10) + " " + noun
+	if n != 1 {
+		s += "s"
+	}
+	return s
+}
@@ -0,0 +1,235 @@
+package summarize_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/summarize"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got with testdata/<name>.txt, or rewrites it with -update.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".txt")
+	if *update {
+		if err := os.WriteFile(path, []byte(got+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got+"\n" != string(want) {
+		t.Errorf("%s: got\n%s\nwant\n%s", name, got, want)
+	}
+}
+
+// home makes the fixtures' /tmp/project show as ~/project.
+func home(t *testing.T) {
+	t.Setenv("HOME", filepath.Dir(filepath.FromSlash("/tmp/project")))
+	t.Setenv("USERPROFILE", filepath.Dir(filepath.FromSlash("/tmp/project")))
+}
+
+const patch = "*** Begin Patch\n*** Update File: src/main.go\n@@\n-old\n+new\n*** Add File: docs/notes.md\n+hello\n*** End Patch"
+
+// cases are the events the golden files describe: every fixture, and the variants with their own
+// wording.
+func cases() map[string]*hooktest.Builder {
+	out := hooktest.Fixtures()
+	out["tool-call-finished-failed"] = hooktest.ToolCallFinished().With("success", false).With("exit_code", 1).With("duration_ms", 3200).
+		With("output_preview", "--- FAIL: TestX\nFAIL").With("output_bytes", 5321)
+	out["tool-call-started-patch"] = hooktest.ToolCallStarted().WithToolName("apply_patch").With("tool_input", map[string]any{"input": patch})
+	out["tool-call-started-tool"] = hooktest.ToolCallStarted().WithToolName("web_search").With("tool_input", map[string]any{"query": "go"})
+	out["approval-requested-paths"] = hooktest.ApprovalRequested().With("command", nil).With("tool_input", nil).With("paths", []string{"/etc/hosts"}).With("reason", "outside the workspace")
+	out["approval-requested-long"] = hooktest.ApprovalRequested().WithCommand("echo " + strings.Repeat("héllo wörld ", 12))
+	out["model-request-retry"] = hooktest.ModelRequestStarted().With("attempt", 2).With("tool_count", 1)
+	out["notification-untitled"] = hooktest.Notification().With("title", nil).With("message", nil).With("notification_type", "idle")
+	out["unknown-type"] = hooktest.ToolCallStarted().With("xcodex_event_type", "hook-interrupted").WithToolName("reviewer")
+	out["no-type"] = hooktest.SessionStart().With("xcodex_event_type", nil).With("cwd", nil)
+	out["outside-home"] = hooktest.SessionStart().WithCwd(filepath.FromSlash("/srv/repo"))
+	return out
+}
+
+func TestGolden(t *testing.T) {
+	home(t)
+	for name, b := range cases() {
+		p := b.Build()
+		golden(t, name, summarize.OneLine(p)+"\n---\n"+summarize.Detail(p, 0))
+	}
+}
+
+func TestOneLineIsOneLine(t *testing.T) {
+	home(t)
+	for name, b := range cases() {
+		p := b.With("last_assistant_message", "line one\n\tline two").With("prompt", "a\nb").Build()
+		if line := summarize.OneLine(p); strings.ContainsAny(line, "\n\t") || len(line) > 300 {
+			t.Errorf("%s: OneLine = %q", name, line)
+		}
+	}
+}
+
+func TestDetailLimit(t *testing.T) {
+	home(t)
+	p := hooktest.ToolCallFinished().WithCommand("printf "+strings.Repeat("日本語のテキスト ", 20)).
+		With("output_preview", strings.Repeat("ünïcödé ", 40)).Build()
+	full := summarize.Detail(p, 0)
+	for max := 1; max <= 400; max++ {
+		got := summarize.Detail(p, max)
+		if len(got) > max || !utf8.ValidString(got) || !strings.HasPrefix(full, strings.TrimSuffix(got, "…")) {
+			t.Fatalf("Detail(%d) = %q", max, got)
+		}
+		if max >= len("…") && !strings.HasSuffix(got, "…") {
+			t.Fatalf("Detail(%d) = %q, want it to end with …", max, got)
+		}
+	}
+	if got := summarize.Detail(p, len(full)); got != full {
+		t.Errorf("Detail at its own length = %q", got)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                                       "0s",
+		1500 * time.Microsecond:                 "2ms",
+		120 * time.Millisecond:                  "120ms",
+		time.Second:                             "1s",
+		3200 * time.Millisecond:                 "3.2s",
+		59940 * time.Millisecond:                "59.9s",
+		time.Minute:                             "1m",
+		64 * time.Second:                        "1m4s",
+		59*time.Minute + 59600*time.Millisecond: "1h",
+		59960 * time.Millisecond:                "1m",
+		time.Hour:                               "1h",
+		2*time.Hour + 5*time.Minute + 10*time.Second: "2h5m",
+		-3200 * time.Millisecond:                     "-3.2s",
+	} {
+		if got := summarize.Duration(d); got != want {
+			t.Errorf("Duration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:       "0 B",
+		512:     "512 B",
+		1023:    "1023 B",
+		1024:    "1 KiB",
+		1536:    "1.5 KiB",
+		3355443: "3.2 MiB",
+		5 << 30: "5 GiB",
+		-2048:   "-2 KiB",
+		1 << 62: "4 EiB",
+	} {
+		if got := summarize.Size(n); got != want {
+			t.Errorf("Size(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 8, "hello…"},
+		// Trailing space before the cut goes.
+		{"hello world", 9, "hello…"},
+		{"héllo", 4, "h…"},
+		{"日本語", 6, "日…"},
+		{"日本語", 5, "…"},
+		// Too short for the ellipsis.
+		{"日本語", 2, ""},
+		{"abc", 2, "ab"[:0]},
+	} {
+		got := summarize.Truncate(tt.s, tt.max)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	t.Setenv(hooksdk.TZEnv, "")
+	if loc, err := summarize.Location(""); loc != time.Local || err != nil {
+		t.Errorf("Location with nothing set = %v, %v; want time.Local", loc, err)
+	}
+	t.Setenv(hooksdk.TZEnv, " America/New_York ")
+	if loc, err := summarize.Location(""); err != nil || loc.String() != "America/New_York" {
+		t.Errorf("Location from CODEX_HOOK_TZ = %v, %v", loc, err)
+	}
+	// A template's own setting comes first.
+	if loc, err := summarize.Location("Europe/Berlin"); err != nil || loc.String() != "Europe/Berlin" {
+		t.Errorf("Location(Europe/Berlin) = %v, %v", loc, err)
+	}
+	if _, err := summarize.Location("Mars/Olympus"); err == nil {
+		t.Error("Location of an unknown zone succeeded")
+	}
+	t.Setenv(hooksdk.TZEnv, "Mars/Olympus")
+	if _, err := summarize.Location(""); err == nil {
+		t.Error("Location of an unknown CODEX_HOOK_TZ succeeded")
+	}
+}
+
+func TestTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no zone data: %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no zone data: %v", err)
+	}
+	// Either side of each zone's spring and autumn changes in 2026.
+	for _, tt := range []struct {
+		utc  string
+		loc  *time.Location
+		want string
+	}{
+		{"2026-03-29T00:59:59Z", berlin, "2026-03-29 01:59:59 CET"},
+		{"2026-03-29T01:00:00Z", berlin, "2026-03-29 03:00:00 CEST"},
+		{"2026-10-25T00:59:59Z", berlin, "2026-10-25 02:59:59 CEST"},
+		{"2026-10-25T01:00:00Z", berlin, "2026-10-25 02:00:00 CET"},
+		{"2026-03-08T06:59:59Z", newYork, "2026-03-08 01:59:59 EST"},
+		{"2026-03-08T07:00:00Z", newYork, "2026-03-08 03:00:00 EDT"},
+		{"2026-11-01T05:59:59Z", newYork, "2026-11-01 01:59:59 EDT"},
+		{"2026-11-01T06:00:00Z", newYork, "2026-11-01 01:00:00 EST"},
+		{"2026-06-01T12:00:00Z", time.UTC, "2026-06-01 12:00:00 UTC"},
+	} {
+		at, _ := time.Parse(time.RFC3339, tt.utc)
+		if got := summarize.Time(at, tt.loc); got != tt.want {
+			t.Errorf("Time(%s, %v) = %q, want %q", tt.utc, tt.loc, got, tt.want)
+		}
+		// A timestamp in another zone is the same instant.
+		if got := summarize.Timestamp(at.In(newYork).Format(time.RFC3339Nano), tt.loc); got != tt.want {
+			t.Errorf("Timestamp(%s, %v) = %q, want %q", tt.utc, tt.loc, got, tt.want)
+		}
+		if got := summarize.MachineTime(at.In(berlin)); got != tt.utc {
+			t.Errorf("MachineTime(%s) = %q", tt.utc, got)
+		}
+	}
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if got, want := summarize.Time(at, nil), at.In(time.Local).Format("2006-01-02 15:04:05 MST"); got != want {
+		t.Errorf("Time(nil) = %q, want the machine's zone, %q", got, want)
+	}
+	if got := summarize.Timestamp("2026-01-02T03:04:05.123456789Z", time.UTC); got != "2026-01-02 03:04:05 UTC" {
+		t.Errorf("Timestamp with nanoseconds = %q", got)
+	}
+	if got := summarize.Timestamp("yesterday", berlin); got != "yesterday" {
+		t.Errorf("Timestamp of a bad timestamp = %q, want it as it is", got)
+	}
+}
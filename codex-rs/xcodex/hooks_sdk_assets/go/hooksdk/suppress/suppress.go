@@ -0,0 +1,171 @@
+// Package suppress answers an action the hook just denied with the same deny, without running the
+// handler again, for a short window. An agent often retries a denied command several times in a
+// row, and each retry would otherwise repeat the hook's side effects: notifications, annotations,
+// telemetry, an expensive check.
+//
+// Every event runs in a new process, so the denies are kept in a hooksdk/state store, keyed by the
+// session and a canonical hash of the action (see ActionKey).
+//
+//	s := suppress.New(suppress.DefaultPath())
+//	hooksdk.Run(hooksdk.Chain(handle, suppress.Middleware(s, suppress.ActionKey, time.Minute)))
+package suppress
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/canonicaljson"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooklog"
+	"example.com/xcodex/hooks-sdk/hooksdk/state"
+)
+
+// DefaultWindow is how long a deny is repeated when Middleware is given no window.
+const DefaultWindow = time.Minute
+
+// Note is appended to the reason of a repeated deny, so the agent (and whoever reads its
+// transcript) can tell the hook didn't check the action again.
+const Note = "repeated; notifications suppressed"
+
+// Store keeps the recent denies of every session in one state file, a hooksdk/state store.
+type Store struct {
+	// Path is the state file.
+	Path string
+	// Now is the clock; nil means time.Now.
+	Now func() time.Time
+}
+
+// New returns a Store keeping its denies in the state file at path.
+func New(path string) *Store {
+	return &Store{Path: path}
+}
+
+// DefaultPath returns `hooks/state/suppress.state` under CODEX_HOME (default `~/.xcodex`).
+func DefaultPath() string {
+	return hooksdk.Environ().Path("hooks", "state", "suppress.state")
+}
+
+// deny is a remembered deny.
+type deny struct {
+	Reason     string           `json:"reason,omitempty"`
+	ReasonCode string           `json:"reason_code,omitempty"`
+	Reasons    []hooksdk.Reason `json:"reasons,omitempty"`
+	// Repeats counts the times the deny was repeated.
+	Repeats int `json:"repeats"`
+}
+
+// repeat returns the deny remembered for key and counts the repeat, leaving its expiry as it is;
+// ok is false when there is none, or its window has passed.
+func (s *Store) repeat(key string) (d deny, ok bool, err error) {
+	err = s.update(key, func(e *state.Entry) error {
+		// The store drops a deny once its window has passed; one that can't be decoded is dropped
+		// the same way.
+		var decodeErr error
+		if ok, decodeErr = e.Decode(&d); !ok || decodeErr != nil {
+			ok = false
+			e.Delete()
+			return nil
+		}
+		d.Repeats++
+		return e.Set(d, e.Expires.Sub(e.Now()))
+	})
+	return d, ok, err
+}
+
+// remember records resp, a deny, for key for window from now.
+func (s *Store) remember(key string, resp hooksdk.Response, window time.Duration) error {
+	d := deny{Reason: resp.Reason, ReasonCode: resp.ReasonCode, Reasons: resp.Reasons}
+	return s.update(key, func(e *state.Entry) error { return e.Set(d, window) })
+}
+
+func (s *Store) update(key string, fn func(e *state.Entry) error) error {
+	st, err := state.OpenPath(s.Path)
+	if err != nil {
+		return err
+	}
+	st.Now = s.Now
+	return st.Update(key, fn)
+}
+
+// ActionKey is a key function for Middleware: a hash of the canonical JSON of what an
+// `approval-requested` event asks to run (its command and directory) or a `tool-call-started`
+// event calls (the tool and its whole input), and "" (never suppressed) for anything else. Equal
+// actions get the same key however their JSON was written.
+func ActionKey(p *hooksdk.HookPayload) string {
+	var action map[string]any
+	switch p.EventType() {
+	case "approval-requested":
+		if len(p.Command) == 0 {
+			return ""
+		}
+		command := make([]any, len(p.Command))
+		for i, arg := range p.Command {
+			command[i] = arg
+		}
+		action = map[string]any{"command": command, "cwd": p.WorkingDir()}
+	case "tool-call-started":
+		if p.ToolName == nil {
+			return ""
+		}
+		action = map[string]any{"tool": *p.ToolName, "input": p.RawPayload["tool_input"]}
+	default:
+		return ""
+	}
+	action["type"] = p.EventType()
+	data, err := canonicaljson.Marshal(action)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// Middleware returns hooksdk middleware that, for window (zero: DefaultWindow) after the handler
+// denies an event, answers events of the same session with the same key(p) with that deny,
+// without calling the handler, so none of its side effects run. The repeated deny has the
+// handler's reason with Note appended, its reason code, and its structured reasons.
+//
+// Repeats don't extend the window: once it has passed since the handler's deny, the next event
+// goes to the handler again, whose answer is then current, and a deny starts a new window. So a
+// changed rule takes effect within window, and an action the agent keeps retrying is checked (and
+// notified about) once per window. Events whose key is "" or without a session, handler errors,
+// and answers other than deny pass through. Store errors are logged to stderr and the handler is
+// called as without the middleware.
+func Middleware(s *Store, key func(*hooksdk.HookPayload) string, window time.Duration) hooksdk.Middleware {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return func(next hooksdk.Handler) hooksdk.Handler {
+		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			session, k := p.SessionID(), key(p)
+			if session == "" || k == "" {
+				return next(ctx, p)
+			}
+			k = session + "\x00" + k
+			d, ok, err := s.repeat(k)
+			if err != nil {
+				hooklog.Warnf("suppress: %v", err)
+			}
+			if ok {
+				hooklog.Debugf("suppress: repeating a deny (repeat %d)", d.Repeats)
+				reason := Note
+				if d.Reason != "" {
+					reason = fmt.Sprintf("%s (%s)", d.Reason, Note)
+				}
+				return hooksdk.Response{Decision: hooksdk.DecisionDeny, Reason: reason, ReasonCode: d.ReasonCode, Reasons: d.Reasons}, nil
+			}
+
+			resp, err := next(ctx, p)
+			if err != nil || resp.Decision != hooksdk.DecisionDeny {
+				return resp, err
+			}
+			if err := s.remember(k, resp, window); err != nil {
+				hooklog.Warnf("suppress: %v", err)
+			}
+			return resp, nil
+		}
+	}
+}
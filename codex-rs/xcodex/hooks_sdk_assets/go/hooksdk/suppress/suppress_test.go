@@ -0,0 +1,193 @@
+package suppress_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/suppress"
+)
+
+// guard is a handler that denies commands starting with rm and counts its calls.
+type guard struct {
+	calls int
+	resp  hooksdk.Response
+	err   error
+}
+
+func (g *guard) handle(_ context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+	g.calls++
+	if g.err != nil {
+		return hooksdk.Response{}, g.err
+	}
+	if len(p.Command) > 0 && p.Command[0] == "rm" {
+		return g.resp, nil
+	}
+	return hooksdk.Allow(), nil
+}
+
+// suppressed returns g's handle behind the middleware, with a store of its own on a clock the
+// test moves with the returned function.
+func suppressed(t *testing.T, g *guard, window time.Duration) (hooksdk.Handler, func(time.Duration)) {
+	t.Helper()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := suppress.New(filepath.Join(t.TempDir(), "suppress.state"))
+	s.Now = func() time.Time { return now }
+	return hooksdk.Chain(g.handle, suppress.Middleware(s, suppress.ActionKey, window)), func(d time.Duration) { now = now.Add(d) }
+}
+
+func approval(session, command string) *hooksdk.HookPayload {
+	return hooktest.ApprovalRequested().WithSessionID(session).WithCommand(command).Build()
+}
+
+// call runs h on p and returns its response, failing the test on an error.
+func call(t *testing.T, h hooksdk.Handler, p *hooksdk.HookPayload) hooksdk.Response {
+	t.Helper()
+	resp, err := h(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestRepeatedDeny(t *testing.T) {
+	g := &guard{resp: hooksdk.Deny("no rm", hooksdk.WithReasonCode("GUARD_RM"), hooksdk.WithRule("rm"))}
+	h, advance := suppressed(t, g, time.Minute)
+	rm := approval("s1", "rm -rf build")
+	if resp := call(t, h, rm); resp.Reason != "no rm" || g.calls != 1 {
+		t.Fatalf("first deny = %+v after %d calls", resp, g.calls)
+	}
+
+	// Retries get the deny back without the handler, noted as repeats.
+	want := hooksdk.Response{Decision: hooksdk.DecisionDeny, Reason: "no rm (" + suppress.Note + ")", ReasonCode: "GUARD_RM", Reasons: g.resp.Reasons}
+	for i := 0; i < 3; i++ {
+		advance(15 * time.Second)
+		if resp := call(t, h, rm); !reflect.DeepEqual(resp, want) || g.calls != 1 {
+			t.Errorf("retry %d = %+v after %d calls, want %+v", i, resp, g.calls, want)
+		}
+	}
+	// They don't extend the window: a minute after the handler's deny, it is asked again, and its
+	// deny starts a new window.
+	advance(16 * time.Second)
+	if resp := call(t, h, rm); resp.Reason != "no rm" || g.calls != 2 {
+		t.Errorf("after the window: %+v after %d calls", resp, g.calls)
+	}
+	advance(30 * time.Second)
+	if call(t, h, rm); g.calls != 2 {
+		t.Errorf("the new window isn't suppressing: %d calls", g.calls)
+	}
+
+	// Once the handler stops denying, nothing is repeated after the window.
+	advance(time.Minute)
+	g.resp = hooksdk.Allow()
+	for i := 0; i < 2; i++ {
+		if resp := call(t, h, rm); resp.Decision != hooksdk.DecisionAllow || g.calls != 3+i {
+			t.Errorf("allowed retry %d = %+v after %d calls", i, resp, g.calls)
+		}
+	}
+
+	// A deny without a reason is repeated with the note alone.
+	g = &guard{resp: hooksdk.Response{Decision: hooksdk.DecisionDeny}}
+	h, _ = suppressed(t, g, 0)
+	call(t, h, rm)
+	if resp := call(t, h, rm); resp.Reason != suppress.Note || g.calls != 1 {
+		t.Errorf("repeat of a bare deny = %+v", resp)
+	}
+}
+
+func TestOnlySameAction(t *testing.T) {
+	g := &guard{resp: hooksdk.Deny("no rm")}
+	h, advance := suppressed(t, g, time.Minute)
+	call(t, h, approval("s1", "rm -rf build"))
+	for name, p := range map[string]*hooksdk.HookPayload{
+		"another command":   approval("s1", "rm -rf dist"),
+		"another directory": hooktest.ApprovalRequested().WithSessionID("s1").WithCommand("rm -rf build").WithCwd("/elsewhere").Build(),
+		"another session":   approval("s2", "rm -rf build"),
+		"no session":        hooktest.ApprovalRequested().With("session_id", nil).WithCommand("rm -rf build").Build(),
+	} {
+		before := g.calls
+		if resp := call(t, h, p); resp.Reason != "no rm" || g.calls != before+1 {
+			t.Errorf("%s was suppressed: %+v", name, resp)
+		}
+		advance(time.Second)
+	}
+
+	// Events without a key, and handler errors, pass through.
+	before := g.calls
+	call(t, h, hooktest.SessionStart().Build())
+	call(t, h, hooktest.SessionStart().Build())
+	if g.calls != before+2 {
+		t.Errorf("events without a key called the handler %d times, want 2", g.calls-before)
+	}
+	boom := errors.New("boom")
+	g.err = boom
+	if _, err := h(context.Background(), approval("s3", "rm x")); !errors.Is(err, boom) {
+		t.Errorf("handler error = %v", err)
+	}
+	g.err = nil
+	if call(t, h, approval("s3", "rm x")); g.calls != before+4 {
+		t.Error("an error was remembered as a deny")
+	}
+}
+
+func TestStoreFails(t *testing.T) {
+	// A store that can't be written is skipped: the handler answers every time.
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o644)
+	g := &guard{resp: hooksdk.Deny("no rm")}
+	h := hooksdk.Chain(g.handle, suppress.Middleware(suppress.New(filepath.Join(file, "suppress.state")), suppress.ActionKey, time.Minute))
+	for i := 0; i < 2; i++ {
+		if resp := call(t, h, approval("s1", "rm -rf build")); resp.Reason != "no rm" {
+			t.Errorf("call %d = %+v", i, resp)
+		}
+	}
+	if g.calls != 2 {
+		t.Errorf("handler called %d times, want 2", g.calls)
+	}
+}
+
+func TestActionKey(t *testing.T) {
+	key := func(b *hooktest.Builder) string { return suppress.ActionKey(b.Build()) }
+	// The same tool input, however it was written, is the same action.
+	a := hooktest.ToolCallStarted().With("tool_input", map[string]any{"command": "ls", "timeout": 1.0, "env": map[string]any{"A": "1", "B": "2"}})
+	b := hooktest.ToolCallStarted().With("tool_input", map[string]any{"env": map[string]any{"B": "2", "A": "1"}, "timeout": 1, "command": "ls"})
+	if ka, kb := key(a), key(b); ka == "" || ka != kb {
+		t.Errorf("equal inputs: keys %q and %q", ka, kb)
+	}
+	// The session and event id aren't part of it.
+	if key(a) != key(a.WithSessionID("other").With("event_id", "other")) {
+		t.Error("the key depends on the session or event id")
+	}
+	// Every other action has a key of its own.
+	seen := map[string]string{}
+	for name, other := range map[string]*hooktest.Builder{
+		"a call":            hooktest.ToolCallStarted().WithCommand("ls"),
+		"another input":     hooktest.ToolCallStarted().WithCommand("ls -l"),
+		"another tool":      hooktest.ToolCallStarted().WithCommand("ls").WithToolName("Shell"),
+		"an approval":       hooktest.ApprovalRequested().WithCommand("ls"),
+		"another directory": hooktest.ApprovalRequested().WithCommand("ls").WithCwd("/elsewhere"),
+	} {
+		k := key(other)
+		if k == "" || seen[k] != "" {
+			t.Errorf("%s: key %q, the same as %s's", name, k, seen[k])
+		}
+		seen[k] = name
+	}
+	// Anything else is never suppressed.
+	for name, b := range map[string]*hooktest.Builder{
+		"session-start":   hooktest.SessionStart(),
+		"no command":      hooktest.ApprovalRequested().With("command", nil),
+		"no tool":         hooktest.ToolCallStarted().With("tool_name", nil),
+		"a finished call": hooktest.ToolCallFinished(),
+	} {
+		if k := key(b); k != "" {
+			t.Errorf("%s: key %q, want none", name, k)
+		}
+	}
+}
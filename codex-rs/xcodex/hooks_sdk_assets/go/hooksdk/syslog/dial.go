@@ -0,0 +1,118 @@
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// JournalSocket is the systemd journal's native protocol socket.
+const JournalSocket = "/run/systemd/journal/socket"
+
+// localSockets are where syslog daemons usually listen, in the order they are tried.
+var localSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+const dialTimeout = 5 * time.Second
+
+type transport int
+
+const (
+	datagram    transport = iota
+	stream                // remote TCP: RFC 6587 octet-counting framing
+	localStream           // local unix stream socket: newline-terminated
+	journal
+)
+
+// Writer sends messages over one connection. It is not safe for concurrent use.
+type Writer struct {
+	conn      net.Conn
+	transport transport
+}
+
+// Dial connects to addr:
+//
+//   - "udp://host:port" or "tcp://host:port" (port defaults to 514) for a remote collector,
+//   - "unix:///path" for a specific local socket,
+//   - "journald" for the systemd journal,
+//   - "" for the journal when it is running, or else the local syslog daemon.
+func Dial(addr string) (*Writer, error) {
+	switch {
+	case addr == "":
+		if w, err := dialJournal(); err == nil {
+			return w, nil
+		}
+		return dialLocal(localSockets)
+	case addr == "journald":
+		return dialJournal()
+	case strings.HasPrefix(addr, "unix://"):
+		return dialLocal([]string{strings.TrimPrefix(addr, "unix://")})
+	}
+
+	network, hostport, ok := strings.Cut(addr, "://")
+	if !ok || (network != "udp" && network != "tcp") {
+		return nil, fmt.Errorf("syslog: unsupported address %q (want udp://, tcp://, unix://, or journald)", addr)
+	}
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		hostport = net.JoinHostPort(hostport, "514")
+	}
+	conn, err := net.DialTimeout(network, hostport, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if network == "tcp" {
+		return &Writer{conn: conn, transport: stream}, nil
+	}
+	return &Writer{conn: conn, transport: datagram}, nil
+}
+
+func dialJournal() (*Writer, error) {
+	if _, err := os.Stat(JournalSocket); err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("unixgram", JournalSocket)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{conn: conn, transport: journal}, nil
+}
+
+func dialLocal(paths []string) (*Writer, error) {
+	var err error
+	for _, path := range paths {
+		var conn net.Conn
+		if conn, err = net.Dial("unixgram", path); err == nil {
+			return &Writer{conn: conn, transport: datagram}, nil
+		}
+		if conn, err = net.Dial("unix", path); err == nil {
+			return &Writer{conn: conn, transport: localStream}, nil
+		}
+	}
+	return nil, fmt.Errorf("syslog: no local syslog daemon (tried %s): %w", strings.Join(paths, ", "), err)
+}
+
+// Send writes m, filling in its time, host, and pid if unset.
+func (w *Writer) Send(m *Message) error {
+	m.fillDefaults()
+	var data []byte
+	switch w.transport {
+	case journal:
+		data = m.journalFields()
+	case stream:
+		msg := m.Format()
+		data = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	case localStream:
+		data = append(m.Format(), '\n')
+	default:
+		data = m.Format()
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	_, err := w.conn.Write(data)
+	return err
+}
+
+// Close closes the connection.
+func (w *Writer) Close() error {
+	return w.conn.Close()
+}
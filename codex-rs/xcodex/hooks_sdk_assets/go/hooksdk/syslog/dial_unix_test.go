@@ -0,0 +1,76 @@
+//go:build unix
+
+package syslog_test
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/syslog"
+)
+
+func TestDialUnixDatagram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Skipf("unixgram sockets: %v", err)
+	}
+	defer conn.Close()
+	w, err := syslog.Dial("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Send(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf[:n]), string(testMessage().Format()); got != want {
+		t.Errorf("datagram = %q, want %q", got, want)
+	}
+}
+
+func TestDialUnixStream(t *testing.T) {
+	// Some daemons (e.g. on macOS or in containers) listen on a stream socket, where messages are
+	// newline-terminated.
+	path := filepath.Join(t.TempDir(), "log")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets: %v", err)
+	}
+	defer ln.Close()
+	w, err := syslog.Dial("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := w.Send(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := string(testMessage().Format()) + "\n"; line != want {
+		t.Errorf("line = %q, want %q", line, want)
+	}
+}
+
+func TestDialUnixMissing(t *testing.T) {
+	if _, err := syslog.Dial("unix://" + filepath.Join(t.TempDir(), "none")); err == nil {
+		t.Errorf("Dial of a missing socket succeeded")
+	}
+}
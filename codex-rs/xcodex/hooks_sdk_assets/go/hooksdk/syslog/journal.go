@@ -0,0 +1,72 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// journalFields encodes m in the journal's native datagram format. Structured-data params become
+// upper-case fields prefixed with the element name, so `session_id` in `xcodex@32473` is
+// `XCODEX_SESSION_ID`.
+func (m *Message) journalFields() []byte {
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", m.Text)
+	writeJournalField(&b, "PRIORITY", strconv.Itoa(int(m.Severity)))
+	writeJournalField(&b, "SYSLOG_FACILITY", strconv.Itoa(int(m.Facility)))
+	if m.AppName != "" {
+		writeJournalField(&b, "SYSLOG_IDENTIFIER", m.AppName)
+	}
+	if m.ProcID != "" {
+		writeJournalField(&b, "SYSLOG_PID", m.ProcID)
+	}
+	if m.MsgID != "" {
+		writeJournalField(&b, "SYSLOG_MSGID", m.MsgID)
+	}
+	for _, e := range m.Data {
+		prefix, _, _ := strings.Cut(e.ID, "@")
+		for _, p := range e.Params {
+			writeJournalField(&b, journalName(prefix+"_"+p.Name), p.Value)
+		}
+	}
+	return b.Bytes()
+}
+
+// writeJournalField writes `NAME=value\n`, or the length-prefixed binary form for values that
+// contain a newline.
+func writeJournalField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalName makes s a valid journal field name: upper-case letters, digits, and underscores,
+// not starting with an underscore or digit.
+func journalName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, s)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	if name == "" {
+		return "FIELD"
+	}
+	return name
+}
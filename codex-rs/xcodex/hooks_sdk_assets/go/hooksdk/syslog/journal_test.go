@@ -0,0 +1,44 @@
+package syslog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestJournalFields(t *testing.T) {
+	m := &Message{
+		Facility: Local0,
+		Severity: Warning,
+		AppName:  "xcodex",
+		ProcID:   "42",
+		MsgID:    "tool-call-finished",
+		Data: []Element{{ID: "xcodex@32473", Params: []Param{
+			{Name: "session_id", Value: "s1"},
+			{Name: "tool-name", Value: "Bash"},
+		}}},
+		Text: "one\ntwo",
+	}
+	var want bytes.Buffer
+	want.WriteString("MESSAGE\n")
+	binary.Write(&want, binary.LittleEndian, uint64(len("one\ntwo")))
+	want.WriteString("one\ntwo\n")
+	want.WriteString("PRIORITY=4\nSYSLOG_FACILITY=16\nSYSLOG_IDENTIFIER=xcodex\nSYSLOG_PID=42\n" +
+		"SYSLOG_MSGID=tool-call-finished\nXCODEX_SESSION_ID=s1\nXCODEX_TOOL_NAME=Bash\n")
+	if got := m.journalFields(); !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("journalFields =\n%q\nwant\n%q", got, want.Bytes())
+	}
+}
+
+func TestJournalName(t *testing.T) {
+	for in, want := range map[string]string{
+		"xcodex_session_id": "XCODEX_SESSION_ID",
+		"_private":          "PRIVATE",
+		"1st-field":         "ST_FIELD",
+		"___":               "FIELD",
+	} {
+		if got := journalName(in); got != want {
+			t.Errorf("journalName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
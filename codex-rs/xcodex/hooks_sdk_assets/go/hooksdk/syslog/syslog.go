@@ -0,0 +1,191 @@
+// Package syslog sends RFC 5424 messages with structured data to a local or remote syslog
+// daemon, or to the systemd journal with equivalent fields.
+//
+// The standard library's log/syslog speaks the older BSD format, has no structured data, and
+// isn't available on Windows; this package covers what audit pipelines usually need:
+//
+//	w, err := syslog.Dial(os.Getenv("CODEX_HOOK_SYSLOG_ADDR")) // "" = journald or local daemon
+//	err = w.Send(&syslog.Message{Severity: syslog.Notice, AppName: "xcodex", Text: "..."})
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Facility is the syslog facility code.
+type Facility int
+
+const (
+	Kern Facility = iota
+	User
+	Mail
+	Daemon
+	Auth
+	Syslog
+	LPR
+	News
+	UUCP
+	Cron
+	AuthPriv
+	FTP
+)
+
+const (
+	Local0 Facility = iota + 16
+	Local1
+	Local2
+	Local3
+	Local4
+	Local5
+	Local6
+	Local7
+)
+
+var facilityNames = map[string]Facility{
+	"kern": Kern, "user": User, "mail": Mail, "daemon": Daemon, "auth": Auth, "syslog": Syslog,
+	"lpr": LPR, "news": News, "uucp": UUCP, "cron": Cron, "authpriv": AuthPriv, "ftp": FTP,
+	"local0": Local0, "local1": Local1, "local2": Local2, "local3": Local3,
+	"local4": Local4, "local5": Local5, "local6": Local6, "local7": Local7,
+}
+
+// ParseFacility parses a facility name such as "local0" or "auth" (case-insensitive), or its
+// numeric code.
+func ParseFacility(s string) (Facility, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if f, ok := facilityNames[s]; ok {
+		return f, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 23 {
+		return Facility(n), nil
+	}
+	return 0, fmt.Errorf("unknown syslog facility %q", s)
+}
+
+// Severity is the syslog severity; lower is more severe.
+type Severity int
+
+const (
+	Emergency Severity = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Info
+	Debug
+)
+
+// Param is one structured-data parameter.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Element is one structured-data element, e.g. `[xcodex@32473 session_id="..."]`. IDs without
+// an `@` are reserved by RFC 5424, so custom elements use `name@<enterprise number>`.
+type Element struct {
+	ID     string
+	Params []Param
+}
+
+// Message is a syslog message. Zero Time, Hostname, and ProcID are filled in by Send with the
+// current time, host, and pid.
+type Message struct {
+	Time     time.Time
+	Facility Facility
+	Severity Severity
+	Hostname string
+	AppName  string
+	ProcID   string
+	// MsgID identifies the type of message, e.g. the event type.
+	MsgID string
+	Data  []Element
+	Text  string
+}
+
+func (m *Message) fillDefaults() {
+	if m.Time.IsZero() {
+		m.Time = time.Now()
+	}
+	if m.Hostname == "" {
+		m.Hostname, _ = os.Hostname()
+	}
+	if m.ProcID == "" {
+		m.ProcID = strconv.Itoa(os.Getpid())
+	}
+}
+
+// Format renders m in the RFC 5424 format:
+// `<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD...] MSG`.
+func (m *Message) Format() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s ",
+		int(m.Facility)*8+int(m.Severity),
+		m.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(m.Hostname, 255),
+		headerField(m.AppName, 48),
+		headerField(m.ProcID, 128),
+		headerField(m.MsgID, 32),
+	)
+	if len(m.Data) == 0 {
+		b.WriteByte('-')
+	}
+	for _, e := range m.Data {
+		b.WriteByte('[')
+		b.WriteString(sdName(e.ID))
+		for _, p := range e.Params {
+			b.WriteByte(' ')
+			b.WriteString(sdName(p.Name))
+			b.WriteString(`="`)
+			b.WriteString(sdValueEscaper.Replace(p.Value))
+			b.WriteByte('"')
+		}
+		b.WriteByte(']')
+	}
+	if m.Text != "" {
+		b.WriteByte(' ')
+		b.WriteString(m.Text)
+	}
+	return b.Bytes()
+}
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// headerField makes s a valid header field: printable ASCII without spaces, at most max bytes,
+// or "-" when empty.
+func headerField(s string, max int) string {
+	s = printable(s, nil)
+	if s == "" {
+		return "-"
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+// sdName makes s a valid SD-ID or PARAM-NAME (which also exclude `=`, `]`, and `"`).
+func sdName(s string) string {
+	s = printable(s, func(r rune) bool { return r == '=' || r == ']' || r == '"' })
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+func printable(s string, reject func(rune) bool) string {
+	return strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || (reject != nil && reject(r)) {
+			return '_'
+		}
+		return r
+	}, s)
+}
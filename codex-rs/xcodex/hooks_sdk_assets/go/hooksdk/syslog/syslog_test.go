@@ -0,0 +1,139 @@
+package syslog_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/syslog"
+)
+
+func testMessage() *syslog.Message {
+	return &syslog.Message{
+		Time:     time.Date(2025, 1, 2, 3, 4, 5, 6000, time.UTC),
+		Facility: syslog.Local4,
+		Severity: syslog.Notice,
+		Hostname: "box",
+		AppName:  "xcodex",
+		ProcID:   "42",
+		MsgID:    "tool-call-finished",
+		Data: []syslog.Element{{ID: "xcodex@32473", Params: []syslog.Param{
+			{Name: "session_id", Value: "s1"},
+			{Name: "cwd", Value: `C:\work "a" [b]`},
+		}}},
+		Text: "tool-call-finished tool=Bash",
+	}
+}
+
+func TestFormat(t *testing.T) {
+	// local4 (20) * 8 + notice (5) = 165.
+	want := `<165>1 2025-01-02T03:04:05.000006Z box xcodex 42 tool-call-finished ` +
+		`[xcodex@32473 session_id="s1" cwd="C:\\work \"a\" [b\]"] tool-call-finished tool=Bash`
+	if got := string(testMessage().Format()); got != want {
+		t.Errorf("Format =\n%s\nwant\n%s", got, want)
+	}
+
+	// Empty header fields are "-", spaces in them are replaced, and names lose `=`, `]`, `"`.
+	m := &syslog.Message{Time: time.Unix(0, 0).UTC(), Hostname: "my box", Data: []syslog.Element{{ID: `a=b"c]`}}}
+	want = `<0>1 1970-01-01T00:00:00.000000Z my_box - - - [a_b_c_]`
+	if got := string(m.Format()); got != want {
+		t.Errorf("Format =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseFacility(t *testing.T) {
+	for s, want := range map[string]syslog.Facility{"user": syslog.User, " LOCAL7 ": syslog.Local7, "authpriv": syslog.AuthPriv, "16": syslog.Local0} {
+		if got, err := syslog.ParseFacility(s); err != nil || got != want {
+			t.Errorf("ParseFacility(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "local8", "24", "-1"} {
+		if _, err := syslog.ParseFacility(s); err == nil {
+			t.Errorf("ParseFacility(%q) succeeded", s)
+		}
+	}
+}
+
+func TestDialUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	w, err := syslog.Dial("udp://" + conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Send(testMessage()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf[:n]), string(testMessage().Format()); got != want {
+		t.Errorf("datagram = %q, want %q", got, want)
+	}
+}
+
+func TestDialTCPOctetCounting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	w, err := syslog.Dial("tcp://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Two messages on one connection are framed as `<len> <msg>` each.
+	first := testMessage()
+	second := testMessage()
+	second.Text = "second\nline"
+	for _, m := range []*syslog.Message{first, second} {
+		if err := w.Send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	r := bufio.NewReader(conn)
+	for _, m := range []*syslog.Message{first, second} {
+		want := string(m.Format())
+		prefix, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+		if err != nil {
+			t.Fatalf("frame length %q: %v", prefix, err)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		if string(msg) != want {
+			t.Errorf("frame = %q, want %q", msg, want)
+		}
+	}
+}
+
+func TestDialBadAddress(t *testing.T) {
+	for _, addr := range []string{"http://host:514", "host:514"} {
+		if _, err := syslog.Dial(addr); err == nil {
+			t.Errorf("Dial(%q) succeeded", addr)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/jsonl"
+)
+
+// CapabilityTelemetry is the capability (see HostSupports) of a host that attaches the telemetry
+// of a response to the session's record.
+const CapabilityTelemetry = "telemetry"
+
+// TelemetryFile is the log, under CODEX_HOME, that EmitTelemetry appends to when the host doesn't
+// support telemetry.
+const TelemetryFile = "telemetry.jsonl"
+
+// Limits on the telemetry of one event, so a hook can't bloat the session's record: at most
+// MaxTelemetryRecords records, of at most MaxTelemetryBytes of JSON together. They apply to a
+// response's records (AddTelemetry) and to those a process emits (EmitTelemetry).
+const (
+	MaxTelemetryRecords = 16
+	MaxTelemetryBytes   = 16 << 10
+)
+
+// ErrTelemetryLimit is returned (as a *TelemetryLimitError) for a telemetry record that would take
+// an event past MaxTelemetryRecords or MaxTelemetryBytes.
+var ErrTelemetryLimit = errors.New("telemetry limit exceeded")
+
+// TelemetryLimitError reports a telemetry record that wasn't recorded because of the limits. It
+// matches ErrTelemetryLimit with errors.Is.
+type TelemetryLimitError struct {
+	// Name is the record's name.
+	Name string
+	// Records and Bytes are what the event's telemetry would have come to with the record.
+	Records, Bytes int
+}
+
+func (e *TelemetryLimitError) Error() string {
+	if e.Records > MaxTelemetryRecords {
+		return fmt.Sprintf("telemetry record %q dropped: it would be record %d of the event (limit %d)", e.Name, e.Records, MaxTelemetryRecords)
+	}
+	return fmt.Sprintf("telemetry record %q dropped: it would make the event's telemetry %d bytes (limit %d)", e.Name, e.Bytes, MaxTelemetryBytes)
+}
+
+func (e *TelemetryLimitError) Is(target error) bool { return target == ErrTelemetryLimit }
+
+// Telemetry is one entry of a response's `telemetry` array: a fact the hook worked out about the
+// event, such as a patch's lint score, for the host to record with the session.
+type Telemetry struct {
+	Name string `json:"name"`
+	// Time is when the record was made, in RFC 3339 with nanoseconds.
+	Time string `json:"time"`
+	// Attrs is the JSON object of the attributes the record was made with.
+	Attrs json.RawMessage `json:"attrs,omitempty"`
+}
+
+// NewTelemetry returns the record named name with attrs, as of now. attrs is marshaled right away,
+// so later changes to it don't show; attrs that don't marshal are an error, as is an empty name.
+func NewTelemetry(name string, attrs map[string]any) (Telemetry, error) {
+	if name == "" {
+		return Telemetry{}, errors.New("telemetry record without a name")
+	}
+	t := Telemetry{Name: name, Time: time.Now().UTC().Format(time.RFC3339Nano)}
+	if len(attrs) > 0 {
+		data, err := json.Marshal(attrs)
+		if err != nil {
+			return Telemetry{}, fmt.Errorf("telemetry record %q: %v", name, err)
+		}
+		t.Attrs = data
+	}
+	return t, nil
+}
+
+// size is the length of t's JSON, as the limits count it.
+func (t Telemetry) size() int {
+	data, _ := json.Marshal(t)
+	return len(data)
+}
+
+// telemetryFits returns a *TelemetryLimitError if t can't follow the records of an event.
+func telemetryFits(records []Telemetry, t Telemetry) error {
+	bytes := t.size()
+	for _, r := range records {
+		bytes += r.size()
+	}
+	if len(records)+1 > MaxTelemetryRecords || bytes > MaxTelemetryBytes {
+		return &TelemetryLimitError{Name: t.Name, Records: len(records) + 1, Bytes: bytes}
+	}
+	return nil
+}
+
+// AddTelemetry returns r with a telemetry record named name with attrs (see NewTelemetry), e.g.
+// `hooksdk.Allow().AddTelemetry("lint_score", map[string]any{"score": 0.92, "files": 3})`. For
+// hosts that don't support telemetry (see CapabilityTelemetry), WriteResponse appends it to
+// TelemetryFile instead, as EmitTelemetry does. A record that would take r past
+// MaxTelemetryRecords or MaxTelemetryBytes, or can't be made, isn't added; CheckTelemetry reports
+// the first such record, and Run logs it.
+func (r Response) AddTelemetry(name string, attrs map[string]any) Response {
+	t, err := NewTelemetry(name, attrs)
+	if err == nil {
+		err = telemetryFits(r.Telemetry, t)
+	}
+	if err != nil {
+		if r.telemetryErr == nil {
+			r.telemetryErr = err
+		}
+		return r
+	}
+	r.Telemetry = append(r.Telemetry[:len(r.Telemetry):len(r.Telemetry)], t)
+	return r
+}
+
+// CheckTelemetry returns why AddTelemetry left out a record of r, a *TelemetryLimitError when the
+// limits did, or nil if it added them all.
+func (r Response) CheckTelemetry() error {
+	return r.telemetryErr
+}
+
+// emitted is the telemetry EmitTelemetry has taken in this process: all of it counts against the
+// limits, and pending is what the next response carries to the host.
+var emitted struct {
+	sync.Mutex
+	records []Telemetry
+	pending []Telemetry
+}
+
+// EmitTelemetry records a telemetry record named name with attrs (see NewTelemetry) for the event
+// being handled, from anywhere in the hook rather than on a particular response. When the host
+// supports telemetry (see CapabilityTelemetry), the record goes with the next response WriteResponse
+// (or Run) writes; otherwise it is appended to `$CODEX_HOME/telemetry.jsonl` (TelemetryFile),
+// with the hook's metadata and the event's session and event ids. The limits count every record
+// the process emits: past them, the record fails with a *TelemetryLimitError and isn't recorded.
+func EmitTelemetry(name string, attrs map[string]any) error {
+	return IO{}.EmitTelemetry(name, attrs)
+}
+
+// EmitTelemetry is EmitTelemetry with the environment of s, for tests.
+func (s IO) EmitTelemetry(name string, attrs map[string]any) error {
+	t, err := NewTelemetry(name, attrs)
+	if err != nil {
+		return err
+	}
+	env := s.hostEnv()
+	emitted.Lock()
+	defer emitted.Unlock()
+	if err := telemetryFits(emitted.records, t); err != nil {
+		return err
+	}
+	if env.Supports(CapabilityTelemetry) {
+		emitted.pending = append(emitted.pending, t)
+	} else if err := appendTelemetry(env, t); err != nil {
+		return fmt.Errorf("telemetry record %q: %w", name, err)
+	}
+	emitted.records = append(emitted.records, t)
+	return nil
+}
+
+// telemetryLine is a line of TelemetryFile.
+type telemetryLine struct {
+	Metadata
+	SessionID string          `json:"session_id,omitempty"`
+	EventID   string          `json:"event_id,omitempty"`
+	EventType string          `json:"event_type,omitempty"`
+	Name      string          `json:"name"`
+	Attrs     json.RawMessage `json:"attrs,omitempty"`
+}
+
+// appendTelemetry appends t to TelemetryFile.
+func appendTelemetry(env Env, t Telemetry) error {
+	line := telemetryLine{Metadata: Meta(), SessionID: env.SessionID, EventType: env.EventType, Name: t.Name, Attrs: t.Attrs}
+	line.TS = t.Time
+	if ids, ok := stdinEventIDs.Load().(eventIDs); ok {
+		line.SessionID, line.EventID, line.EventType = ids.sessionID, ids.eventID, ids.eventType
+	}
+	w := jsonl.New(env.Path(TelemetryFile), jsonl.Options{MaxSize: jsonl.DefaultMaxSize, Keep: jsonl.DefaultKeep})
+	return w.Append(line)
+}
+
+// eventIDs identify the event this process read on stdin, for the telemetry it emits.
+type eventIDs struct {
+	sessionID, eventID, eventType string
+}
+
+var stdinEventIDs atomic.Value
+
+// withPendingTelemetry returns resp with the telemetry emitted since the last response, as far as
+// it fits; records that don't are reported on stderr.
+func withPendingTelemetry(resp Response, stderr io.Writer) Response {
+	emitted.Lock()
+	pending := emitted.pending
+	emitted.pending = nil
+	emitted.Unlock()
+	for _, t := range pending {
+		if err := telemetryFits(resp.Telemetry, t); err != nil {
+			writeLogLine(stderr, "warn", "telemetry", err)
+			continue
+		}
+		resp.Telemetry = append(resp.Telemetry[:len(resp.Telemetry):len(resp.Telemetry)], t)
+	}
+	return resp
+}
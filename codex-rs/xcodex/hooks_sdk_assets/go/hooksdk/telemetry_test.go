@@ -0,0 +1,254 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// telemetryMain is the hook HOOKSDK_TEST_TELEMETRY runs: its handler emits that many records with
+// EmitTelemetry, each padded by HOOKSDK_TEST_TELEMETRY_PAD bytes, reporting failures on stderr as
+// `emit <i>: <error>`, and answers with a record of its own. A second response follows, to show
+// the emitted records went with the first.
+func telemetryMain() {
+	n, _ := strconv.Atoi(os.Getenv("HOOKSDK_TEST_TELEMETRY"))
+	pad, _ := strconv.Atoi(os.Getenv("HOOKSDK_TEST_TELEMETRY_PAD"))
+	code := hooksdk.RunIO(context.Background(), os.Stdin, os.Stdout, os.Stderr, func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		for i := 1; i <= n; i++ {
+			if err := hooksdk.EmitTelemetry(fmt.Sprintf("emitted-%d", i), map[string]any{"i": i, "pad": strings.Repeat("x", pad)}); err != nil {
+				fmt.Fprintf(os.Stderr, "emit %d: %v\n", i, err)
+			}
+		}
+		return hooksdk.Allow().AddTelemetry("own", map[string]any{"n": n}), nil
+	})
+	hooksdk.WriteResponseTo(os.Stdout, hooksdk.Allow())
+	os.Exit(code)
+}
+
+// runTelemetry runs telemetryMain with CODEX_HOME set to home and returns the responses it wrote
+// and its stderr.
+func runTelemetry(t *testing.T, home string, n, pad int, env ...string) ([]hooksdk.Response, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(append(os.Environ(), "HOOKSDK_TEST_TELEMETRY="+strconv.Itoa(n), "HOOKSDK_TEST_TELEMETRY_PAD="+strconv.Itoa(pad),
+		"CODEX_HOME="+home, "CODEX_HOOK_NAME=scorer", hooksdk.CapabilitiesEnv+"="), env...)
+	cmd.Stdin = bytes.NewReader(hooktest.ToolCallFinished().WithSessionID("s-tel").With("event_id", "e-tel").Bytes())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr.String())
+	}
+	var resps []hooksdk.Response
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		var resp hooksdk.Response
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("response %q: %v", line, err)
+		}
+		resps = append(resps, resp)
+	}
+	if len(resps) != 2 {
+		t.Fatalf("%d responses, want 2: %s", len(resps), out)
+	}
+	return resps, stderr.String()
+}
+
+func names(records []hooksdk.Telemetry) string {
+	var out []string
+	for _, r := range records {
+		out = append(out, r.Name)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestAddTelemetry(t *testing.T) {
+	attrs := map[string]any{"score": 0.92, "files": 3}
+	resp := hooksdk.Allow().AddTelemetry("lint_score", attrs)
+	attrs["score"] = 0.1
+	if err := resp.CheckTelemetry(); err != nil || len(resp.Telemetry) != 1 {
+		t.Fatalf("AddTelemetry = %+v, %v", resp.Telemetry, err)
+	}
+	rec := resp.Telemetry[0]
+	if when, err := time.Parse(time.RFC3339Nano, rec.Time); rec.Name != "lint_score" || string(rec.Attrs) != `{"files":3,"score":0.92}` || err != nil || time.Since(when) > time.Minute {
+		t.Errorf("record = %+v (attrs are marshaled when added)", rec)
+	}
+	if data, _ := json.Marshal(hooksdk.Allow().AddTelemetry("bare", nil)); !strings.Contains(string(data), `"telemetry":[{"name":"bare","time":"`) || strings.Contains(string(data), "attrs") {
+		t.Errorf("record without attrs = %s", data)
+	}
+	if data, _ := json.Marshal(hooksdk.Allow()); strings.Contains(string(data), "telemetry") {
+		t.Errorf("response without telemetry = %s", data)
+	}
+
+	// Responses built from the same one don't share records.
+	base := hooksdk.Allow().AddTelemetry("a", nil).AddTelemetry("b", nil)
+	x, y := base.AddTelemetry("x", nil), base.AddTelemetry("y", nil)
+	if names(base.Telemetry) != "a,b" || names(x.Telemetry) != "a,b,x" || names(y.Telemetry) != "a,b,y" {
+		t.Errorf("records %q, %q, %q", names(base.Telemetry), names(x.Telemetry), names(y.Telemetry))
+	}
+
+	// Records that can't be made are left out, and the first reported.
+	resp = hooksdk.Allow().AddTelemetry("", nil).AddTelemetry("bad", map[string]any{"f": func() {}}).AddTelemetry("ok", nil)
+	if err := resp.CheckTelemetry(); err == nil || !strings.Contains(err.Error(), "without a name") || errors.Is(err, hooksdk.ErrTelemetryLimit) || names(resp.Telemetry) != "ok" {
+		t.Errorf("invalid records: %q, %v", names(resp.Telemetry), err)
+	}
+	if _, err := hooksdk.NewTelemetry("bad", map[string]any{"f": func() {}}); err == nil || !strings.Contains(err.Error(), `telemetry record "bad"`) {
+		t.Errorf("NewTelemetry with unmarshalable attrs = %v", err)
+	}
+}
+
+func TestAddTelemetryLimits(t *testing.T) {
+	// At most MaxTelemetryRecords records.
+	resp := hooksdk.Allow()
+	for i := 1; i <= hooksdk.MaxTelemetryRecords+2; i++ {
+		resp = resp.AddTelemetry(fmt.Sprintf("r%d", i), map[string]any{"i": i})
+	}
+	var limit *hooksdk.TelemetryLimitError
+	err := resp.CheckTelemetry()
+	if len(resp.Telemetry) != hooksdk.MaxTelemetryRecords || !errors.As(err, &limit) || !errors.Is(err, hooksdk.ErrTelemetryLimit) {
+		t.Fatalf("%d records, %v", len(resp.Telemetry), err)
+	}
+	if limit.Name != "r17" || limit.Records != 17 || err.Error() != `telemetry record "r17" dropped: it would be record 17 of the event (limit 16)` {
+		t.Errorf("count limit error = %+v: %v", limit, err)
+	}
+
+	// Of at most MaxTelemetryBytes together; a small record can still follow a large one left
+	// out.
+	pad := strings.Repeat("x", hooksdk.MaxTelemetryBytes/2)
+	resp = hooksdk.Allow().AddTelemetry("big1", map[string]any{"pad": pad}).AddTelemetry("big2", map[string]any{"pad": pad}).AddTelemetry("small", nil)
+	err = resp.CheckTelemetry()
+	if names(resp.Telemetry) != "big1,small" || !errors.As(err, &limit) || limit.Name != "big2" || limit.Records != 2 || limit.Bytes <= hooksdk.MaxTelemetryBytes {
+		t.Fatalf("byte limit: %q, %+v", names(resp.Telemetry), err)
+	}
+	if want := fmt.Sprintf(`telemetry record "big2" dropped: it would make the event's telemetry %d bytes (limit 16384)`, limit.Bytes); err.Error() != want {
+		t.Errorf("byte limit error = %q, want %q", err, want)
+	}
+	data, _ := json.Marshal(resp.Telemetry[0])
+	if len(data) > hooksdk.MaxTelemetryBytes || len(data) < hooksdk.MaxTelemetryBytes/2 {
+		t.Errorf("record of %d bytes", len(data))
+	}
+	// A single record over the limit never fits.
+	resp = hooksdk.Allow().AddTelemetry("huge", map[string]any{"pad": pad + pad})
+	if len(resp.Telemetry) != 0 || !errors.Is(resp.CheckTelemetry(), hooksdk.ErrTelemetryLimit) {
+		t.Errorf("huge record: %d records, %v", len(resp.Telemetry), resp.CheckTelemetry())
+	}
+}
+
+// TestRunTelemetry checks that Run writes a response's records for a host that supports them,
+// warning about those left out.
+func TestRunTelemetry(t *testing.T) {
+	env := map[string]string{"CODEX_HOME": t.TempDir(), hooksdk.CapabilitiesEnv: "modify, Telemetry"}
+	stdio, out, errOut := testIO(hooktest.ToolCallFinished().Bytes(), env)
+	code := stdio.Run(context.Background(), func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		resp := hooksdk.Deny("lint failed")
+		for i := 0; i < hooksdk.MaxTelemetryRecords+1; i++ {
+			resp = resp.AddTelemetry("lint", map[string]any{"i": i})
+		}
+		return resp, nil
+	})
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if code != hooksdk.ExitDeny || resp.Decision != hooksdk.DecisionDeny || len(resp.Telemetry) != hooksdk.MaxTelemetryRecords {
+		t.Errorf("Run = %d, %+v", code, resp)
+	}
+	if !strings.Contains(errOut.String(), `"level":"warn"`) || !strings.Contains(errOut.String(), `"stage":"telemetry"`) || !strings.Contains(errOut.String(), "record 17 of the event") {
+		t.Errorf("stderr = %s", errOut)
+	}
+	if err := hooksdk.ValidateResponse("tool-call-finished", resp); err != nil {
+		t.Errorf("response with telemetry doesn't match its schema: %v", err)
+	}
+}
+
+// TestEmitTelemetryHost checks that, for a host that supports telemetry, emitted records go with
+// the next response written, once.
+func TestEmitTelemetryHost(t *testing.T) {
+	home := t.TempDir()
+	resps, stderr := runTelemetry(t, home, 2, 0, hooksdk.CapabilitiesEnv+"=telemetry")
+	if got := names(resps[0].Telemetry); got != "own,emitted-1,emitted-2" || len(resps[1].Telemetry) != 0 || stderr != "" {
+		t.Errorf("responses carry %q then %q; stderr %q", got, names(resps[1].Telemetry), stderr)
+	}
+	if string(resps[0].Telemetry[2].Attrs) != `{"i":2,"pad":""}` {
+		t.Errorf("emitted record = %+v", resps[0].Telemetry[2])
+	}
+	if _, err := os.Stat(filepath.Join(home, hooksdk.TelemetryFile)); !os.IsNotExist(err) {
+		t.Errorf("%s written for a host that supports telemetry: %v", hooksdk.TelemetryFile, err)
+	}
+
+	// Emitted records that don't fit in the response beside its own are dropped with a warning.
+	resps, stderr = runTelemetry(t, home, hooksdk.MaxTelemetryRecords, 0, hooksdk.CapabilitiesEnv+"=telemetry")
+	if n := len(resps[0].Telemetry); n != hooksdk.MaxTelemetryRecords || !strings.Contains(stderr, `telemetry record \"emitted-16\" dropped`) {
+		t.Errorf("%d records; stderr %q", n, stderr)
+	}
+}
+
+// TestEmitTelemetryFile checks that, for a host that doesn't support telemetry, emitted records
+// are appended to TelemetryFile with the hook and event they came from.
+func TestEmitTelemetryFile(t *testing.T) {
+	home := t.TempDir()
+	resps, stderr := runTelemetry(t, home, 2, 0)
+	if len(resps[0].Telemetry) != 0 || strings.Contains(stderr, "emit ") {
+		t.Errorf("response carries %q; stderr %q", names(resps[0].Telemetry), stderr)
+	}
+	data, err := os.ReadFile(filepath.Join(home, hooksdk.TelemetryFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		lines = append(lines, rec)
+	}
+	var got []string
+	for _, rec := range lines {
+		got = append(got, rec["name"].(string))
+		if rec["hook"] != "scorer" || rec["session_id"] != "s-tel" || rec["event_id"] != "e-tel" || rec["event_type"] != "tool-call-finished" || rec["ts"] == nil || rec["pid"] == nil {
+			t.Errorf("line = %v", rec)
+		}
+	}
+	if strings.Join(got, ",") != "emitted-1,emitted-2,own" {
+		t.Errorf("logged %q", got)
+	}
+	if attrs, _ := json.Marshal(lines[1]["attrs"]); string(attrs) != `{"i":2,"pad":""}` {
+		t.Errorf("attrs = %s", attrs)
+	}
+
+	// Appending to a file CODEX_HOME can't hold fails.
+	blocked := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr := runTelemetry(t, blocked, 1, 0); !strings.Contains(stderr, `emit 1: telemetry record "emitted-1": `) {
+		t.Errorf("stderr = %q", stderr)
+	}
+}
+
+// TestEmitTelemetryLimits checks that the limits count every record a process emits.
+func TestEmitTelemetryLimits(t *testing.T) {
+	for _, capabilities := range []string{"", "telemetry"} {
+		_, stderr := runTelemetry(t, t.TempDir(), hooksdk.MaxTelemetryRecords+2, 0, hooksdk.CapabilitiesEnv+"="+capabilities)
+		if !strings.Contains(stderr, `emit 17: telemetry record "emitted-17" dropped: it would be record 17 of the event (limit 16)`) || !strings.Contains(stderr, "emit 18:") || strings.Contains(stderr, "emit 16:") {
+			t.Errorf("capabilities %q: stderr %q", capabilities, stderr)
+		}
+
+		_, stderr = runTelemetry(t, t.TempDir(), 3, hooksdk.MaxTelemetryBytes/2, hooksdk.CapabilitiesEnv+"="+capabilities)
+		if !strings.Contains(stderr, "emit 2: ") || !strings.Contains(stderr, "emit 3: ") || !strings.Contains(stderr, "bytes (limit 16384)") || strings.Contains(stderr, "emit 1:") {
+			t.Errorf("capabilities %q: stderr %q", capabilities, stderr)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package hooksdk_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/term"
+)
+
+// openPTY returns the terminal end of a new pseudo-terminal, skipping the test when there is none.
+func openPTY(t *testing.T) *os.File {
+	t.Helper()
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	t.Cleanup(func() { ptmx.Close() })
+	var n, unlock uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, ptmx.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		t.Skipf("unlock pty: %v", errno)
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, ptmx.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); errno != 0 {
+		t.Skipf("pty number: %v", errno)
+	}
+	tty, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("open pty: %v", err)
+	}
+	t.Cleanup(func() { tty.Close() })
+	return tty
+}
+
+func TestReadPayloadTerminal(t *testing.T) {
+	tty := openPTY(t)
+	if !term.IsTerminal(tty) {
+		t.Fatal("a pty isn't a terminal")
+	}
+
+	// Nothing is ever typed; the read must not wait for it.
+	noEnv := hooksdk.WithIO(hooksdk.IO{Getenv: func(string) string { return "" }})
+	done := make(chan error, 1)
+	go func() {
+		_, err := hooksdk.ReadPayloadFrom(tty, noEnv)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, hooksdk.ErrNoPayload) || !strings.Contains(err.Error(), hooksdk.PayloadPathEnv) {
+			t.Errorf("ReadPayloadFrom(terminal) = %v, want ErrNoPayload with a hint", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ReadPayloadFrom(terminal) is waiting for input")
+	}
+
+	// CODEX_HOOK_PAYLOAD_PATH is read instead of the terminal.
+	path := filepath.Join(t.TempDir(), "event.json")
+	if err := os.WriteFile(path, hooktest.SessionStart().WithSessionID("by-hand").Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{hooksdk.PayloadPathEnv: path}
+	p, err := hooksdk.ReadPayloadFrom(tty, hooksdk.WithIO(hooksdk.IO{Getenv: func(k string) string { return env[k] }}))
+	if err != nil || p.SessionID() != "by-hand" {
+		t.Errorf("ReadPayloadFrom(terminal) with %s = %v, %v", hooksdk.PayloadPathEnv, p, err)
+	}
+}
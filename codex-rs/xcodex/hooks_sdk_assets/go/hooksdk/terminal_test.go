@@ -0,0 +1,45 @@
+package hooksdk_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestReadPayloadSlowPipe(t *testing.T) {
+	// Only a terminal is given up on: a pipe is read to EOF, however long the host takes.
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	payload := hooktest.SessionStart().WithSessionID("slow").Bytes()
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		w.Write(payload[:10])
+		time.Sleep(300 * time.Millisecond)
+		w.Write(payload[10:])
+		w.Close()
+	}()
+	p, err := hooksdk.ReadPayloadFrom(r, hooksdk.WithIO(hooksdk.IO{Getenv: func(string) string { return "" }}))
+	if err != nil || p.SessionID() != "slow" {
+		t.Errorf("ReadPayloadFrom(slow pipe) = %v, %v", p, err)
+	}
+}
+
+func TestReadPayloadDevNull(t *testing.T) {
+	// /dev/null is a character device, not a terminal: it is empty stdin, `{}`.
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	p, err := hooksdk.ReadPayloadFrom(null, hooksdk.WithIO(hooksdk.IO{Getenv: func(string) string { return "" }}))
+	if errors.Is(err, hooksdk.ErrNoPayload) || err != nil || p.SessionID() != "" {
+		t.Errorf("ReadPayloadFrom(%s) = %v, %v", os.DevNull, p, err)
+	}
+}
@@ -0,0 +1,111 @@
+package hooksdk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Bounds of the margin RunWithTimeout keeps below CODEX_HOOK_TIMEOUT_MS: a tenth of the host's
+// timeout, but at least MinTimeoutMargin and at most MaxTimeoutMargin, so the response is written
+// and the process has exited before the host gives up on it.
+const (
+	MinTimeoutMargin = 50 * time.Millisecond
+	MaxTimeoutMargin = time.Second
+)
+
+// RunWithTimeout is like Run, but gives handler at most d: past it, the handler's context is
+// cancelled, resp is written instead of the handler's response, and the process exits with the
+// code resp maps to, abandoning the handler. Use it for hooks whose outcome on a slow run should
+// be their own decision rather than whatever the host does with a killed hook:
+//
+//	hooksdk.RunWithTimeout(2*time.Second, handle, hooksdk.Allow().InjectContext("hook timed out"))
+//
+// When CODEX_HOOK_TIMEOUT_MS is set, the deadline is also kept that far below it (less a margin,
+// see MinTimeoutMargin); d <= 0 uses only that. With neither, the handler runs without a
+// deadline.
+func RunWithTimeout(d time.Duration, handler Handler, resp Response, opts ...Option) {
+	Run(handler, append(opts, WithTimeout(d, resp))...)
+}
+
+// WithTimeout makes Run and RunIO write resp when the handler hasn't returned after d (see
+// RunWithTimeout). Under RunIO the abandoned handler keeps running in its goroutine until it
+// returns, so it should honor its context.
+func WithTimeout(d time.Duration, resp Response) Option {
+	return func(o *options) {
+		o.timeout = d
+		o.timeoutResponse = resp
+		o.hasTimeout = true
+	}
+}
+
+// WithShutdownGrace gives a handler that WithTimeout gives up on d more to return once its context
+// is cancelled, before the timeout response is written and the process exits, so work it is
+// part-way through can finish, or record that it didn't: a sink.Tee, say, lets its sinks complete
+// the event and marks the ones that missed it. The handler's response is still ignored. d comes
+// out of the host's timeout, so keep it well below the margin RunWithTimeout leaves.
+func WithShutdownGrace(d time.Duration) Option {
+	return func(o *options) { o.shutdownGrace = d }
+}
+
+// handlerDeadline is the time the handler gets under WithTimeout: d, capped by the host's
+// timeout less a margin.
+func handlerDeadline(d time.Duration, env Env) time.Duration {
+	if env.Timeout <= 0 {
+		return d
+	}
+	margin := env.Timeout / 10
+	if margin < MinTimeoutMargin {
+		margin = MinTimeoutMargin
+	}
+	if margin > MaxTimeoutMargin {
+		margin = MaxTimeoutMargin
+	}
+	host := env.Timeout - margin
+	if host <= 0 {
+		host = env.Timeout / 2
+	}
+	if d <= 0 || host < d {
+		return host
+	}
+	return d
+}
+
+// callHandlerTimeout runs callHandler in a goroutine and gives up on it after the WithTimeout
+// deadline, returning the timeout response.
+func callHandlerTimeout(ctx context.Context, stderr io.Writer, handler Handler, p *HookPayload, o *options) (Response, error) {
+	d := handlerDeadline(o.timeout, o.stdio.Environ())
+	if d <= 0 {
+		return callHandler(ctx, stderr, handler, p, o)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		resp Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := callHandler(ctx, stderr, handler, p, o)
+		done <- result{resp, err}
+	}()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.resp, r.err
+	case <-timer.C:
+		writeLogLine(stderr, "warn", "handler", fmt.Errorf("handler timed out after %v; writing the timeout response", d))
+		if o.shutdownGrace > 0 {
+			cancel()
+			grace := time.NewTimer(o.shutdownGrace)
+			defer grace.Stop()
+			select {
+			case <-done:
+			case <-grace.C:
+			}
+		}
+		return o.timeoutResponse, nil
+	}
+}
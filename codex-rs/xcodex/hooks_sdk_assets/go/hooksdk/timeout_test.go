@@ -0,0 +1,192 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// timedOut is the timeout response of these tests.
+var timedOut = hooksdk.Response{Decision: hooksdk.DecisionAllow, SystemMessage: "hook timed out"}
+
+// slowMain is the hook HOOKSDK_TEST_SLOW runs: RunWithTimeout with a handler that ignores its
+// context and never returns, and the deadline in that variable.
+func slowMain(d string) {
+	deadline, err := time.ParseDuration(d)
+	if err != nil {
+		panic(err)
+	}
+	hooksdk.RunWithTimeout(deadline, func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		time.Sleep(time.Hour)
+		return hooksdk.Deny("too late"), nil
+	}, timedOut)
+}
+
+// slow is a handler sleeping for d, or until its context is cancelled, which it reports on
+// cancelled.
+func slow(d time.Duration, cancelled chan<- bool) hooksdk.Handler {
+	return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+		select {
+		case <-time.After(d):
+			cancelled <- false
+			return hooksdk.Deny("finished"), nil
+		case <-ctx.Done():
+			cancelled <- true
+			return hooksdk.Deny("cancelled"), nil
+		}
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	t.Setenv(hooksdk.TimeoutEnv, "")
+	cancelled := make(chan bool, 1)
+	start := time.Now()
+	res := hooktest.RunHook(t, slow(time.Hour, cancelled), hooktest.ToolCallStarted().Bytes(), hooksdk.WithTimeout(100*time.Millisecond, timedOut))
+	took := time.Since(start)
+	if res.ExitCode != hooksdk.ExitOK || res.Response.SystemMessage != "hook timed out" || res.Response.Decision != hooksdk.DecisionAllow {
+		t.Errorf("timed out hook: exit %d, response %+v", res.ExitCode, res.Response)
+	}
+	if took < 100*time.Millisecond || took > time.Second {
+		t.Errorf("timed out after %v, want about 100ms", took)
+	}
+	if !strings.Contains(res.Stderr, "handler timed out after 100ms") {
+		t.Errorf("stderr = %q", res.Stderr)
+	}
+	select {
+	case c := <-cancelled:
+		if !c {
+			t.Error("the handler finished instead of being cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Error("the abandoned handler's context wasn't cancelled")
+	}
+
+	// A handler that returns in time has its own response written.
+	res = hooktest.RunHook(t, slow(time.Millisecond, make(chan bool, 1)), hooktest.ToolCallStarted().Bytes(), hooksdk.WithTimeout(time.Second, timedOut))
+	if res.Response.Reason != "finished" || res.ExitCode != hooksdk.ExitDeny || strings.Contains(res.Stderr, "timed out") {
+		t.Errorf("fast hook: exit %d, response %+v, stderr %q", res.ExitCode, res.Response, res.Stderr)
+	}
+
+	// The timeout response's decision sets the exit code.
+	res = hooktest.RunHook(t, slow(time.Hour, make(chan bool, 1)), hooktest.ToolCallStarted().Bytes(), hooksdk.WithTimeout(10*time.Millisecond, hooksdk.Deny("slow")))
+	if res.ExitCode != hooksdk.ExitDeny || res.Response.Reason != "slow" {
+		t.Errorf("deny on timeout: exit %d, response %+v", res.ExitCode, res.Response)
+	}
+}
+
+func TestWithTimeoutHostDeadline(t *testing.T) {
+	tests := []struct {
+		name     string
+		d        time.Duration
+		hostMS   string
+		min, max time.Duration
+	}{
+		// A tenth of the host's timeout is kept back.
+		{"host only", 0, "1000", 850 * time.Millisecond, 1000 * time.Millisecond},
+		{"shorter than the host", 100 * time.Millisecond, "1000", 100 * time.Millisecond, 500 * time.Millisecond},
+		{"longer than the host", time.Hour, "400", 300 * time.Millisecond, 400 * time.Millisecond},
+		// The margin is at least MinTimeoutMargin.
+		{"short host timeout", 0, "200", 100 * time.Millisecond, 200 * time.Millisecond},
+		// An unusable CODEX_HOOK_TIMEOUT_MS is ignored.
+		{"bad host timeout", 100 * time.Millisecond, "soon", 100 * time.Millisecond, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Setenv(hooksdk.TimeoutEnv, tt.hostMS)
+		start := time.Now()
+		res := hooktest.RunHook(t, slow(time.Hour, make(chan bool, 1)), hooktest.SessionStart().Bytes(), hooksdk.WithTimeout(tt.d, timedOut))
+		took := time.Since(start)
+		if res.Response.SystemMessage != "hook timed out" {
+			t.Errorf("%s: response %+v", tt.name, res.Response)
+		}
+		if took < tt.min || took >= tt.max {
+			t.Errorf("%s: timed out after %v, want within [%v, %v)", tt.name, took, tt.min, tt.max)
+		}
+	}
+
+	// With no deadline at all, the handler runs to the end.
+	t.Setenv(hooksdk.TimeoutEnv, "")
+	res := hooktest.RunHook(t, slow(50*time.Millisecond, make(chan bool, 1)), hooktest.SessionStart().Bytes(), hooksdk.WithTimeout(0, timedOut))
+	if res.Response.Reason != "finished" {
+		t.Errorf("no deadline: %+v", res.Response)
+	}
+}
+
+func TestWithShutdownGrace(t *testing.T) {
+	t.Setenv(hooksdk.TimeoutEnv, "")
+	// flushing is a handler that takes 100ms to wrap up once its context is cancelled.
+	flushing := func(flushed chan struct{}) hooksdk.Handler {
+		return func(ctx context.Context, p *hooksdk.HookPayload) (hooksdk.Response, error) {
+			<-ctx.Done()
+			time.Sleep(100 * time.Millisecond)
+			close(flushed)
+			return hooksdk.Deny("flushed"), nil
+		}
+	}
+	for _, tt := range []struct {
+		grace   time.Duration
+		flushed bool
+	}{{time.Second, true}, {10 * time.Millisecond, false}, {0, false}} {
+		flushed := make(chan struct{})
+		start := time.Now()
+		res := hooktest.RunHook(t, flushing(flushed), hooktest.ToolCallFinished().Bytes(),
+			hooksdk.WithTimeout(50*time.Millisecond, timedOut), hooksdk.WithShutdownGrace(tt.grace))
+		took := time.Since(start)
+		done := false
+		select {
+		case <-flushed:
+			done = true
+		default:
+		}
+		// The handler's response is still ignored.
+		if done != tt.flushed || res.Response.SystemMessage != "hook timed out" || res.ExitCode != hooksdk.ExitOK {
+			t.Errorf("grace %v: flushed %v, exit %d, response %+v", tt.grace, done, res.ExitCode, res.Response)
+		}
+		if tt.flushed && (took < 150*time.Millisecond || took > time.Second) {
+			t.Errorf("grace %v: returned after %v, want once the handler did", tt.grace, took)
+		}
+		<-flushed
+	}
+}
+
+func TestEnvTimeout(t *testing.T) {
+	for v, want := range map[string]time.Duration{
+		"1500":                 1500 * time.Millisecond,
+		" 20 ":                 20 * time.Millisecond,
+		"":                     0,
+		"0":                    0,
+		"-5":                   0,
+		"1.5":                  0,
+		"99999999999999999999": 0,
+	} {
+		if got := hooksdk.FromMap(map[string]string{hooksdk.TimeoutEnv: v}).Timeout; got != want {
+			t.Errorf("%s=%q: Timeout = %v, want %v", hooksdk.TimeoutEnv, v, got, want)
+		}
+	}
+}
+
+func TestRunWithTimeoutProcess(t *testing.T) {
+	// The host would kill the hook at 2s; its own deadline is 200ms.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "HOOKSDK_TEST_SLOW=200ms", "CODEX_HOME="+t.TempDir(), hooksdk.TimeoutEnv+"=2000")
+	cmd.Stdin = bytes.NewReader(hooktest.ToolCallStarted().Bytes())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("hook: %v (killed by the deadline: %v)\n%s", err, ctx.Err() != nil, stderr.String())
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out, &resp); err != nil || resp.SystemMessage != "hook timed out" {
+		t.Errorf("response %q: %v", out, err)
+	}
+}
@@ -0,0 +1,61 @@
+package hooksdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"unicode/utf8"
+)
+
+// TruncateStrings returns a copy of p in which every string value (at any depth) longer than
+// maxBytes is cut to at most maxBytes, never splitting a UTF-8 sequence, and followed by a marker
+// such as `…[truncated 19934821 bytes, sha256=2c26b46b68ff]`. The hash is of the full original
+// string, so the value can still be matched against its source. maxBytes <= 0 returns p unchanged.
+func TruncateStrings(p HookPayloadJSON, maxBytes int) HookPayloadJSON {
+	if maxBytes <= 0 || p == nil {
+		return p
+	}
+	return HookPayloadJSON(truncateValue(map[string]any(p), maxBytes).(map[string]any))
+}
+
+// TruncateString is TruncateStrings for a single string.
+func TruncateString(s string, maxBytes int) string {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	sum := sha256.Sum256([]byte(s))
+	return s[:cut] + "…[truncated " + strconv.Itoa(len(s)-cut) + " bytes, sha256=" + hex.EncodeToString(sum[:6]) + "]"
+}
+
+func truncateValue(v any, maxBytes int) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, child := range t {
+			out[k] = truncateValue(child, maxBytes)
+		}
+		return out
+	case HookPayloadJSON:
+		return HookPayloadJSON(truncateValue(map[string]any(t), maxBytes).(map[string]any))
+	case []any:
+		out := make([]any, len(t))
+		for i, child := range t {
+			out[i] = truncateValue(child, maxBytes)
+		}
+		return out
+	case []string:
+		out := make([]string, len(t))
+		for i, child := range t {
+			out[i] = TruncateString(child, maxBytes)
+		}
+		return out
+	case string:
+		return TruncateString(t, maxBytes)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,80 @@
+package hooksdk_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+)
+
+func TestTruncateString(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	sum := sha256.Sum256([]byte(long))
+	want := strings.Repeat("a", 10) + "…[truncated 90 bytes, sha256=" + hex.EncodeToString(sum[:6]) + "]"
+	if got := hooksdk.TruncateString(long, 10); got != want {
+		t.Errorf("TruncateString = %q, want %q", got, want)
+	}
+	for _, max := range []int{0, -1, 100, 200} {
+		if got := hooksdk.TruncateString(long, max); got != long {
+			t.Errorf("TruncateString(max %d) = %q, want it unchanged", max, got)
+		}
+	}
+}
+
+func TestTruncateStringRuneBoundaries(t *testing.T) {
+	// "é" is 2 bytes, "€" 3, and "😀" 4; no cut may land inside one.
+	s := strings.Repeat("aé€😀", 20)
+	for max := 1; max < len(s); max++ {
+		got := hooksdk.TruncateString(s, max)
+		kept, _, ok := strings.Cut(got, "…[truncated ")
+		if !ok {
+			t.Fatalf("max %d: no marker in %q", max, got)
+		}
+		if !utf8.ValidString(kept) || len(kept) > max || !strings.HasPrefix(s, kept) {
+			t.Fatalf("max %d: kept %q, want a valid prefix of at most %d bytes", max, kept, max)
+		}
+		if len(kept) < max-3 {
+			t.Fatalf("max %d: kept only %d bytes", max, len(kept))
+		}
+	}
+}
+
+func TestTruncateStrings(t *testing.T) {
+	long := strings.Repeat("x", 1000)
+	p := hooksdk.HookPayloadJSON{
+		"short": "ok",
+		"tool_response": map[string]any{
+			"stdout": long,
+			"chunks": []any{map[string]any{"data": []any{long}}, 7.0},
+		},
+		"argv": []string{"echo", long},
+		"n":    3.0,
+	}
+	got := hooksdk.TruncateStrings(p, 16)
+	truncated := hooksdk.TruncateString(long, 16)
+
+	resp := got["tool_response"].(map[string]any)
+	if resp["stdout"] != truncated {
+		t.Errorf("stdout = %q", resp["stdout"])
+	}
+	chunks := resp["chunks"].([]any)
+	if v := chunks[0].(map[string]any)["data"].([]any)[0]; v != truncated {
+		t.Errorf("nested data = %q", v)
+	}
+	if chunks[1] != 7.0 || got["n"] != 3.0 || got["short"] != "ok" {
+		t.Errorf("other values changed: %v", got)
+	}
+	if argv := got["argv"].([]string); argv[0] != "echo" || argv[1] != truncated {
+		t.Errorf("argv = %q", argv)
+	}
+	// The input is not modified.
+	if p["tool_response"].(map[string]any)["stdout"] != long {
+		t.Errorf("TruncateStrings modified its input")
+	}
+	if got := hooksdk.TruncateStrings(p, 0); got["argv"].([]string)[1] != long {
+		t.Errorf("TruncateStrings(0) truncated")
+	}
+}
@@ -16,9 +16,17 @@ import (
 )
 
 // HookPayload models the JSON payload shape emitted by xcodex hooks.
-// Unknown fields are preserved in RawPayload for forward compatibility.
+// Unknown fields are preserved in RawPayload for forward compatibility. Numbers in RawPayload are
+// json.Number values so large integers keep their precision.
 type HookPayload struct {
 	RawPayload map[string]any `json:"-"`
+	// sentVersion is the schema version the payload was sent as, set by ParseHookPayload (see
+	// Version).
+	sentVersion *int
+	// rawJSON is the payload as read, kept by ParseHookPayload with WithRawJSON (see RawJSON).
+	rawJSON json.RawMessage
+	// invocationID identifies the hook invocation that read the payload (see InvocationID).
+	invocationID string
 	ApprovalPolicy any `json:"approval_policy"`
 	Attempt *int `json:"attempt"`
 	CallId *string `json:"call_id"`
@@ -73,13 +81,13 @@ type HookPayload struct {
 
 func (p *HookPayload) UnmarshalJSON(data []byte) error {
 	var raw map[string]any
-	if err := json.Unmarshal(data, &raw); err != nil {
+	if err := unmarshalUseNumber(data, &raw); err != nil {
 		return err
 	}
 
 	type Alias HookPayload
 	var a Alias
-	if err := json.Unmarshal(data, &a); err != nil {
+	if err := unmarshalUseNumber(data, &a); err != nil {
 		return err
 	}
 
@@ -88,11 +96,40 @@ func (p *HookPayload) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-// ParseHookPayload parses a hook JSON payload into a HookPayload.
-func ParseHookPayload(data []byte) (*HookPayload, error) {
+// ParseHookPayload parses a hook JSON payload into a HookPayload, or a CBOR one with
+// WithPayloadFormat(PayloadFormatCBOR).
+func ParseHookPayload(data []byte, opts ...Option) (*HookPayload, error) {
+	if isBlank(data) {
+		return nil, ErrEmptyPayload
+	}
+	o := newOptions(opts)
+	if o.decoded != nil || o.payloadFormat == PayloadFormatCBOR {
+		return o.parseDecoded(data)
+	}
+	sent := data
+	data, err := o.fixUTF8(data)
+	if err != nil {
+		return nil, err
+	}
+	data, version, err := o.migrate(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.checkRaw(data); err != nil {
+		return nil, err
+	}
 	var p HookPayload
 	if err := json.Unmarshal(data, &p); err != nil {
 		return nil, err
 	}
+	p.sentVersion = &version
+	p.invocationID = payloadInvocationID(p.RawPayload)
+	if o.rawJSON {
+		p.rawJSON = sent
+	}
+	p.XcodexEventType = string(ParseEventType(p.EventType()))
+	if err := o.checkPayload(&p); err != nil {
+		return nil, err
+	}
 	return &p, nil
 }
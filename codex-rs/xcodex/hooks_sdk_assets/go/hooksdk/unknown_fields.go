@@ -0,0 +1,101 @@
+package hooksdk
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnknownFieldsError is returned in strict-fields mode when a payload carries fields the typed
+// HookPayload doesn't model.
+type UnknownFieldsError struct {
+	EventType string
+	// Fields lists the unexpected keys as JSON paths (e.g. `new_field`, `token_usage.extra`,
+	// `items[2].name`), sorted.
+	Fields []string
+}
+
+func (e *UnknownFieldsError) Error() string {
+	return fmt.Sprintf("hook payload %q has unknown fields: %s", e.EventType, strings.Join(e.Fields, ", "))
+}
+
+// UnknownFields returns the JSON paths of fields in the raw payload that the typed HookPayload
+// doesn't model, sorted. Fields typed as `any` accept arbitrary nested content, so only keys
+// inside structured (struct-typed) fields are reported below the top level. The `<key>__base64`
+// copies WithInvalidUTF8 adds for modeled fields are not reported.
+func (p *HookPayload) UnknownFields() []string {
+	var out []string
+	collectUnknownFields(p.RawPayload, reflect.TypeOf(HookPayload{}), "", &out)
+	sort.Strings(out)
+	return out
+}
+
+func collectUnknownFields(raw any, t reflect.Type, path string, out *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for key, value := range obj {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			field, ok := fields[key]
+			if !ok {
+				// The bytes of a modeled field, added by InvalidUTF8Base64.
+				if base, copied := strings.CutSuffix(key, Base64Suffix); copied {
+					if _, modeled := fields[base]; modeled {
+						continue
+					}
+				}
+				*out = append(*out, childPath)
+				continue
+			}
+			collectUnknownFields(value, field.Type, childPath, out)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := raw.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			collectUnknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), out)
+		}
+	case reflect.Map:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return
+		}
+		for key, value := range obj {
+			collectUnknownFields(value, t.Elem(), path+"."+key, out)
+		}
+	}
+}
+
+// jsonFields maps JSON keys to the struct fields that decode them.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
@@ -0,0 +1,63 @@
+package hooksdk
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestUnknownFields(t *testing.T) {
+	data := []byte(`{"xcodex_event_type":"session-start","session_id":"s","colour":"blue","tool_input":{"anything":1}}`)
+	p, err := ParseHookPayload(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// tool_input is typed as any, so what is inside it isn't reported.
+	if got := p.UnknownFields(); !reflect.DeepEqual(got, []string{"colour"}) {
+		t.Errorf("UnknownFields() = %q, want [colour]", got)
+	}
+
+	_, err = ParseHookPayload(data, WithStrictFields())
+	var fieldsErr *UnknownFieldsError
+	if !errors.As(err, &fieldsErr) {
+		t.Fatalf("strict parse error = %v, want *UnknownFieldsError", err)
+	}
+	if fieldsErr.EventType != "session-start" || !reflect.DeepEqual(fieldsErr.Fields, []string{"colour"}) {
+		t.Errorf("error = %+v", fieldsErr)
+	}
+}
+
+func TestUnknownFieldsNestedPaths(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+	type usage struct {
+		Input int `json:"input"`
+	}
+	type payload struct {
+		Usage   *usage          `json:"token_usage"`
+		Items   []item          `json:"items"`
+		ByName  map[string]item `json:"by_name"`
+		Opaque  any             `json:"opaque"`
+		Counted int             `json:"counted"`
+	}
+	raw := map[string]any{
+		"token_usage": map[string]any{"input": 1, "extra": 2},
+		"items":       []any{map[string]any{"name": "a"}, map[string]any{"name": "b", "size": 3}},
+		"by_name":     map[string]any{"x": map[string]any{"colour": "red"}},
+		"opaque":      map[string]any{"whatever": true},
+		"counted":     4,
+		"new_field":   "?",
+	}
+	var got []string
+	collectUnknownFields(raw, reflect.TypeOf(payload{}), "", &got)
+	want := map[string]bool{"token_usage.extra": true, "items[1].size": true, "by_name.x.colour": true, "new_field": true}
+	if len(got) != len(want) {
+		t.Errorf("unknown fields = %q, want %d of them", got, len(want))
+	}
+	for _, path := range got {
+		if !want[path] {
+			t.Errorf("unexpected unknown field %q", path)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package usage
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvHeader names the columns of usage.csv. The cost is empty when a model had no price.
+var csvHeader = []string{
+	"ended_at", "started_at", "session_id", "models", "input_tokens", "cached_input_tokens",
+	"output_tokens", "reasoning_output_tokens", "total_tokens", "estimated_cost_usd",
+}
+
+// appendCSV appends s to the CSV at path, writing the header first if the file is new.
+func appendCSV(path string, s *Summary) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if info.Size() == 0 {
+		w.Write(csvHeader)
+	}
+	cost := ""
+	if s.CostKnown {
+		cost = strconv.FormatFloat(s.Cost, 'f', 4, 64)
+	}
+	itoa := func(n int64) string { return strconv.FormatInt(n, 10) }
+	w.Write([]string{
+		s.EndedAt.UTC().Format(time.RFC3339),
+		s.StartedAt.UTC().Format(time.RFC3339),
+		s.SessionID,
+		strings.Join(s.ModelNames(), ";"),
+		itoa(s.Total.Input),
+		itoa(s.Total.CachedInput),
+		itoa(s.Total.Output),
+		itoa(s.Total.ReasoningOutput),
+		itoa(s.Total.Total),
+		cost,
+	})
+	w.Flush()
+	err = w.Error()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
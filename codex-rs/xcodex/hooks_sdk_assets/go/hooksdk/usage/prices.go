@@ -0,0 +1,135 @@
+package usage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/minitoml"
+)
+
+// Price is what a model costs, in USD per million tokens.
+type Price struct {
+	Input float64
+	// CachedInput applies to the cached part of the input.
+	CachedInput float64
+	// Output includes reasoning tokens, which are billed as output.
+	Output float64
+}
+
+// Cost is the estimated cost of t in USD.
+func (p Price) Cost(t Tokens) float64 {
+	uncached := t.Input - t.CachedInput
+	if uncached < 0 {
+		uncached = 0
+	}
+	return (float64(uncached)*p.Input + float64(t.CachedInput)*p.CachedInput + float64(t.Output)*p.Output) / 1e6
+}
+
+// Prices maps model names to prices. A key may be a glob (`gpt-5*`); an exact name wins over
+// globs, and a longer glob over a shorter one.
+type Prices map[string]Price
+
+// Lookup returns the price for model.
+func (p Prices) Lookup(model string) (Price, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+	best, found := "", false
+	for pattern := range p {
+		if ok, _ := path.Match(pattern, model); ok && (!found || len(pattern) > len(best)) {
+			best, found = pattern, true
+		}
+	}
+	return p[best], found
+}
+
+// LoadPrices reads a price table. A missing file yields an empty table.
+//
+//	[models."gpt-5"]
+//	input = 1.25          # USD per million input tokens
+//	cached_input = 0.125  # defaults to input
+//	output = 10.0
+//
+//	[models."gpt-5-mini*"]
+//	input = 0.25
+//	output = 2.0
+func LoadPrices(path string) (Prices, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Prices{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prices, err := ParsePrices(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return prices, nil
+}
+
+// ParsePrices parses a price table (see LoadPrices).
+func ParsePrices(data string) (Prices, error) {
+	doc, err := minitoml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	prices := Prices{}
+	for key, v := range doc {
+		if key != "models" {
+			return nil, fmt.Errorf("unknown setting %q", key)
+		}
+		models, ok := v.(map[string]any)
+		if !ok {
+			return nil, errors.New(`models must be tables ([models."name"])`)
+		}
+		for model, v := range models {
+			t, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("models.%s must be a table", model)
+			}
+			price, err := parsePrice(t)
+			if err != nil {
+				return nil, fmt.Errorf("models.%s: %w", model, err)
+			}
+			prices[model] = price
+		}
+	}
+	return prices, nil
+}
+
+func parsePrice(t map[string]any) (Price, error) {
+	var p Price
+	cached := false
+	for key, v := range t {
+		var n float64
+		switch x := v.(type) {
+		case int64:
+			n = float64(x)
+		case float64:
+			n = x
+		default:
+			return Price{}, fmt.Errorf("%s must be a number", key)
+		}
+		if n < 0 {
+			return Price{}, fmt.Errorf("%s must not be negative", key)
+		}
+		switch key {
+		case "input":
+			p.Input = n
+		case "cached_input":
+			p.CachedInput, cached = n, true
+		case "output":
+			p.Output = n
+		default:
+			return Price{}, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if !cached {
+		p.CachedInput = p.Input
+	}
+	return p, nil
+}
@@ -0,0 +1,74 @@
+package usage_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/usage"
+)
+
+func TestParsePrices(t *testing.T) {
+	prices, err := usage.ParsePrices(`
+[models."gpt-5"]
+input = 1.25
+cached_input = 0.125
+output = 10
+
+[models."gpt-5*"]
+input = 2
+output = 20
+
+[models."gpt-5-mini*"]
+input = 0.25
+output = 2.0
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		model string
+		want  usage.Price
+		ok    bool
+	}{
+		{"gpt-5", usage.Price{Input: 1.25, CachedInput: 0.125, Output: 10}, true},
+		// The longer glob wins; cached input defaults to the input price.
+		{"gpt-5-mini-2025", usage.Price{Input: 0.25, CachedInput: 0.25, Output: 2}, true},
+		{"gpt-5-codex", usage.Price{Input: 2, CachedInput: 2, Output: 20}, true},
+		{"o3", usage.Price{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := prices.Lookup(tt.model)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %+v, %v; want %+v, %v", tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPriceCost(t *testing.T) {
+	p := usage.Price{Input: 1.25, CachedInput: 0.125, Output: 10}
+	// 400 uncached and 800 cached input tokens, 300 output tokens.
+	got := p.Cost(usage.Tokens{Input: 1200, CachedInput: 800, Output: 300, ReasoningOutput: 100})
+	if want := 0.0036; math.Abs(got-want) > 1e-12 {
+		t.Errorf("Cost = %v, want %v", got, want)
+	}
+}
+
+func TestParsePricesErrors(t *testing.T) {
+	tests := []struct {
+		data, want string
+	}{
+		{`currency = "eur"`, `unknown setting "currency"`},
+		{`models = 1`, "models must be tables"},
+		{"[models]\nx = 1", "models.x must be a table"},
+		{"[models.x]\ninput = \"1\"", "models.x: input must be a number"},
+		{"[models.x]\ninput = -1", "must not be negative"},
+		{"[models.x]\nprompt = 1", `models.x: unknown key "prompt"`},
+	}
+	for _, tt := range tests {
+		_, err := usage.ParsePrices(tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParsePrices(%q) = %v, want an error containing %q", tt.data, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package usage accumulates token usage per session across hook invocations and summarizes it
+// when the session ends.
+//
+// Token counts arrive on `model-response-completed` events; the model they were spent on is only
+// named by the matching `model-request-started` event, so the Tracker remembers each request's
+// model until its response arrives. Sessions are kept in a hooksdk/state store, one key each, and
+// every update holds its lock, so concurrent sessions (and parallel hooks of one session) never
+// overwrite each other.
+//
+//	t := usage.NewTracker(filepath.Join(codexHome, "hooks", "usage"))
+//	err := t.Observe(payload)                          // for every event
+//	summary, err := t.End(payload.SessionID(), prices) // on session-end
+package usage
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/state"
+)
+
+// UnknownModel is the model of usage whose request was never seen (e.g. the tracker was installed
+// mid-session).
+const UnknownModel = "unknown"
+
+// Tokens are token counts, as in the host's `token_usage`. CachedInput is part of Input, and
+// ReasoningOutput is part of Output.
+type Tokens struct {
+	Input           int64 `json:"input_tokens"`
+	CachedInput     int64 `json:"cached_input_tokens"`
+	Output          int64 `json:"output_tokens"`
+	ReasoningOutput int64 `json:"reasoning_output_tokens"`
+	Total           int64 `json:"total_tokens"`
+}
+
+// Add returns the sum of t and u.
+func (t Tokens) Add(u Tokens) Tokens {
+	return Tokens{
+		Input:           t.Input + u.Input,
+		CachedInput:     t.CachedInput + u.CachedInput,
+		Output:          t.Output + u.Output,
+		ReasoningOutput: t.ReasoningOutput + u.ReasoningOutput,
+		Total:           t.Total + u.Total,
+	}
+}
+
+// FromPayload reads the `token_usage` object of an event; ok is false when there is none.
+func FromPayload(p hooksdk.HookPayloadJSON) (t Tokens, ok bool) {
+	if _, ok := hooksdk.Field[map[string]any](p, "token_usage"); !ok {
+		return Tokens{}, false
+	}
+	get := func(name string) int64 {
+		n, _ := hooksdk.IntField(p, "token_usage."+name)
+		return n
+	}
+	t = Tokens{
+		Input:           get("input_tokens"),
+		CachedInput:     get("cached_input_tokens"),
+		Output:          get("output_tokens"),
+		ReasoningOutput: get("reasoning_output_tokens"),
+		Total:           get("total_tokens"),
+	}
+	if t.Total == 0 {
+		t.Total = t.Input + t.Output
+	}
+	return t, true
+}
+
+// Tracker keeps the state of running sessions, and the CSV of finished ones, in Dir.
+type Tracker struct {
+	Dir string
+	// Now is the clock; nil means time.Now.
+	Now func() time.Time
+}
+
+// NewTracker returns a Tracker storing its state in dir.
+func NewTracker(dir string) *Tracker {
+	return &Tracker{Dir: dir}
+}
+
+// session is one session's state.
+type session struct {
+	SessionID string    `json:"session_id"`
+	StartedAt time.Time `json:"started_at"`
+	// Requests maps model request ids to their model, until the response arrives.
+	Requests map[string]string `json:"requests,omitempty"`
+	// Models holds the accumulated usage per model.
+	Models map[string]Tokens `json:"models,omitempty"`
+}
+
+// Summary is a session's usage, as returned by End.
+type Summary struct {
+	SessionID string
+	StartedAt time.Time
+	EndedAt   time.Time
+	// Models is the usage per model; Total is their sum.
+	Models map[string]Tokens
+	Total  Tokens
+	// Cost is the estimated cost in USD of the models with a price. CostKnown is false when some
+	// model had none, so Cost undercounts.
+	Cost      float64
+	CostKnown bool
+}
+
+func newSummary(st *session, end time.Time, prices Prices) *Summary {
+	s := &Summary{SessionID: st.SessionID, StartedAt: st.StartedAt, EndedAt: end, Models: st.Models, CostKnown: true}
+	for model, u := range st.Models {
+		s.Total = s.Total.Add(u)
+		if p, ok := prices.Lookup(model); ok {
+			s.Cost += p.Cost(u)
+		} else {
+			s.CostKnown = false
+		}
+	}
+	return s
+}
+
+// ModelNames returns the models in s, sorted.
+func (s *Summary) ModelNames() []string {
+	names := make([]string, 0, len(s.Models))
+	for m := range s.Models {
+		names = append(names, m)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Message is a one-line summary for people, e.g. for a response's system message.
+func (s *Summary) Message() string {
+	msg := fmt.Sprintf("Session usage: %s input (%s cached), %s output tokens",
+		count(s.Total.Input), count(s.Total.CachedInput), count(s.Total.Output))
+	switch {
+	case s.CostKnown:
+		msg += fmt.Sprintf(", about $%.2f", s.Cost)
+	case s.Cost > 0:
+		msg += fmt.Sprintf(", at least $%.2f (some models have no price)", s.Cost)
+	}
+	return msg
+}
+
+// count abbreviates n: 950, 12.3K, 4.5M.
+func count(n int64) string {
+	switch {
+	case n >= 1e6:
+		return strconv.FormatFloat(float64(n)/1e6, 'f', 1, 64) + "M"
+	case n >= 1e4:
+		return strconv.FormatFloat(float64(n)/1e3, 'f', 1, 64) + "K"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// Observe updates the session's state from an event: `model-request-started` records the
+// request's model, and events with `token_usage` add to that model's totals. Other events (and
+// events without a session id) are ignored.
+func (t *Tracker) Observe(p *hooksdk.HookPayload) error {
+	id := p.SessionID()
+	if id == "" {
+		return nil
+	}
+	requestID, _ := hooksdk.StringField(p.RawPayload, "model_request_id")
+	tokens, hasTokens := FromPayload(p.RawPayload)
+	model, _ := hooksdk.StringField(p.RawPayload, "model")
+	if !hasTokens && (p.EventType() != "model-request-started" || requestID == "" || model == "") {
+		return nil
+	}
+	return t.store().Update(id, func(e *state.Entry) error {
+		st := t.load(e, id)
+		if !hasTokens {
+			st.Requests[requestID] = model
+			return e.Set(st, 0)
+		}
+		if m, ok := st.Requests[requestID]; ok && model == "" {
+			model = m
+		}
+		if model == "" {
+			model = UnknownModel
+		}
+		delete(st.Requests, requestID)
+		st.Models[model] = st.Models[model].Add(tokens)
+		return e.Set(st, 0)
+	})
+}
+
+// End removes the session's state and, if it recorded any usage, appends the session's summary
+// to CSVPath and returns it (otherwise the summary is nil). Costs are estimated from prices. When
+// the summary can't be appended, the state is kept.
+func (t *Tracker) End(id string, prices Prices) (*Summary, error) {
+	if id == "" {
+		return nil, nil
+	}
+	var summary *Summary
+	err := t.store().Update(id, func(e *state.Entry) error {
+		st := t.load(e, id)
+		e.Delete()
+		if len(st.Models) == 0 {
+			return nil
+		}
+		summary = newSummary(st, t.now(), prices)
+		return appendCSV(t.CSVPath(), summary)
+	})
+	return summary, err
+}
+
+// CSVPath is the session summary file, `usage.csv` in Dir.
+func (t *Tracker) CSVPath() string {
+	return filepath.Join(t.Dir, "usage.csv")
+}
+
+func (t *Tracker) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+// store is the state of every running session, `usage.state` in Dir. Its lock also guards the
+// CSV, which End appends to under it.
+func (t *Tracker) store() *state.Store {
+	return &state.Store{Path: filepath.Join(t.Dir, "usage.state"), Now: t.Now}
+}
+
+// load reads a session's state; a missing or corrupt one starts the session afresh.
+func (t *Tracker) load(e *state.Entry, id string) *session {
+	var st session
+	if ok, err := e.Decode(&st); !ok || err != nil {
+		st = session{SessionID: id, StartedAt: t.now()}
+	}
+	if st.Requests == nil {
+		st.Requests = map[string]string{}
+	}
+	if st.Models == nil {
+		st.Models = map[string]Tokens{}
+	}
+	return &st
+}
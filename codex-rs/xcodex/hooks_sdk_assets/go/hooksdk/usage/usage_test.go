@@ -0,0 +1,138 @@
+package usage_test
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+	"example.com/xcodex/hooks-sdk/hooksdk/usage"
+)
+
+var prices = usage.Prices{"gpt-5": {Input: 1.25, CachedInput: 0.125, Output: 10}}
+
+// turn observes a model request and its response in session. It can run in any goroutine.
+func turn(t *testing.T, tr *usage.Tracker, session, requestID, model string) {
+	t.Helper()
+	for _, b := range []*hooktest.Builder{
+		hooktest.ModelRequestStarted().With("model", model),
+		hooktest.ModelResponseCompleted(),
+	} {
+		if err := tr.Observe(b.WithSessionID(session).With("model_request_id", requestID).Build()); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestTrackerSession(t *testing.T) {
+	tr := usage.NewTracker(filepath.Join(t.TempDir(), "usage"))
+	start := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	tr.Now = func() time.Time { return now }
+
+	turn(t, tr, "s1", "req-1", "gpt-5")
+	now = now.Add(time.Minute)
+	turn(t, tr, "s1", "req-2", "gpt-5")
+	// A response whose request wasn't seen counts for the unknown model.
+	if err := tr.Observe(hooktest.ModelResponseCompleted().WithSessionID("s1").With("model_request_id", "req-x").Build()); err != nil {
+		t.Fatal(err)
+	}
+	// Events without usage change nothing.
+	if err := tr.Observe(hooktest.ToolCallStarted().WithSessionID("s1").Build()); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Hour)
+	s, err := tr.End("s1", prices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := usage.Tokens{Input: 3600, CachedInput: 2400, Output: 900, ReasoningOutput: 300, Total: 4500}
+	if s.Total != want || !s.StartedAt.Equal(start) || !s.EndedAt.Equal(now) {
+		t.Errorf("summary = %+v", s)
+	}
+	if s.CostKnown || fmt.Sprintf("%.4f", s.Cost) != "0.0072" {
+		t.Errorf("cost = %v, known %v; want 0.0072 for gpt-5 and unknown for the rest", s.Cost, s.CostKnown)
+	}
+	if msg := s.Message(); msg != "Session usage: 3600 input (2400 cached), 900 output tokens, at least $0.01 (some models have no price)" {
+		t.Errorf("Message = %q", msg)
+	}
+
+	rows := readCSV(t, tr.CSVPath())
+	wantRow := []string{"2025-01-02T04:05:05Z", "2025-01-02T03:04:05Z", "s1", "gpt-5;unknown", "3600", "2400", "900", "300", "4500", ""}
+	if len(rows) != 2 || rows[0][0] != "ended_at" || fmt.Sprint(rows[1]) != fmt.Sprint(wantRow) {
+		t.Errorf("usage.csv = %q, want the header and %q", rows, wantRow)
+	}
+
+	// The state is gone: ending again records nothing.
+	if s, err := tr.End("s1", prices); s != nil || err != nil {
+		t.Errorf("second End = %+v, %v; want nil", s, err)
+	}
+}
+
+func TestTrackerEndKeepsStateOnError(t *testing.T) {
+	tr := usage.NewTracker(t.TempDir())
+	turn(t, tr, "s1", "req-1", "gpt-5")
+	// A directory in the CSV's place can't be appended to, so the session isn't ended.
+	if err := os.Mkdir(tr.CSVPath(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.End("s1", prices); err == nil {
+		t.Fatal("End with an unwritable CSV succeeded")
+	}
+	if err := os.Remove(tr.CSVPath()); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := tr.End("s1", prices); err != nil || s == nil || s.Total.Total == 0 {
+		t.Errorf("End after the CSV was fixed = %+v, %v; want the session's usage", s, err)
+	}
+}
+
+func TestTrackerConcurrentSessions(t *testing.T) {
+	dir := t.TempDir()
+	const sessions, turns = 6, 10
+	var wg sync.WaitGroup
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+		go func(session string) {
+			defer wg.Done()
+			// A tracker per hook invocation, as each is its own process.
+			for j := 0; j < turns; j++ {
+				turn(t, usage.NewTracker(dir), session, fmt.Sprint("req-", j), "gpt-5")
+			}
+		}(fmt.Sprint("s", i))
+	}
+	wg.Wait()
+
+	for i := 0; i < sessions; i++ {
+		s, err := usage.NewTracker(dir).End(fmt.Sprint("s", i), prices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Total.Input != turns*1200 || !s.CostKnown {
+			t.Errorf("session s%d: %+v, want %d input tokens", i, s.Total, turns*1200)
+		}
+	}
+	if rows := readCSV(t, filepath.Join(dir, "usage.csv")); len(rows) != sessions+1 {
+		t.Errorf("usage.csv has %d rows, want %d", len(rows), sessions+1)
+	}
+}
@@ -0,0 +1,75 @@
+package hooksdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/utf8safe"
+)
+
+// InvalidUTF8Policy is what reading a payload does with a string that isn't valid UTF-8, e.g. raw
+// bytes of a binary diff in a tool's output (see WithInvalidUTF8).
+type InvalidUTF8Policy int
+
+const (
+	// InvalidUTF8Replace replaces the invalid bytes with U+FFFD, as encoding/json does (the
+	// default). The bytes are lost.
+	InvalidUTF8Replace InvalidUTF8Policy = iota
+	// InvalidUTF8Base64 replaces them too, and adds the field's bytes, base64-encoded, under
+	// `<key>__base64` (see Base64Suffix) next to it. For an array of strings, `<key>__base64` is an
+	// array of the same length with null for the strings that were valid.
+	InvalidUTF8Base64
+	// InvalidUTF8Fail fails the read with an *InvalidUTF8Error.
+	InvalidUTF8Fail
+)
+
+// Base64Suffix is appended to the key of a field that isn't valid UTF-8 to name the copy of its
+// bytes InvalidUTF8Base64 adds, e.g. `output_preview__base64`.
+const Base64Suffix = utf8safe.Suffix
+
+// ErrInvalidUTF8 is returned (as an *InvalidUTF8Error) for a payload with invalid UTF-8 read with
+// InvalidUTF8Fail.
+var ErrInvalidUTF8 = errors.New("payload string is not valid UTF-8")
+
+// InvalidUTF8Error reports a payload field that isn't valid UTF-8. It matches ErrInvalidUTF8 with
+// errors.Is.
+type InvalidUTF8Error struct {
+	// Field is the path of the first such field, e.g. `tool_input.command[2]`.
+	Field string
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("payload field %s is not valid UTF-8", e.Field)
+}
+
+func (e *InvalidUTF8Error) Is(target error) bool { return target == ErrInvalidUTF8 }
+
+// WithInvalidUTF8 sets what ReadPayload, ReadPayloadJSON, and ParseHookPayload do with payload
+// strings that aren't valid UTF-8 (InvalidUTF8Replace by default). Object keys are always
+// replaced. Payloads that are valid UTF-8 throughout, which is nearly all of them, are decoded as
+// before, so the option costs nothing until it is needed.
+func WithInvalidUTF8(policy InvalidUTF8Policy) Option {
+	return func(o *options) { o.invalidUTF8 = policy }
+}
+
+// fixUTF8 applies the WithInvalidUTF8 policy to a payload's bytes before they are decoded.
+func (o *options) fixUTF8(data []byte) ([]byte, error) {
+	if o.invalidUTF8 == InvalidUTF8Replace || utf8.Valid(data) {
+		return data, nil
+	}
+	v, err := utf8safe.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	field := utf8safe.Invalid(v)
+	if field == "" {
+		// Only keys were invalid.
+		return data, nil
+	}
+	if o.invalidUTF8 == InvalidUTF8Fail {
+		return nil, &InvalidUTF8Error{Field: field}
+	}
+	return json.Marshal(utf8safe.Encode(v))
+}
@@ -0,0 +1,125 @@
+package hooksdk_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// binaryPayload is a tool-call-finished payload whose output has raw bytes that aren't UTF-8.
+func binaryPayload(output string) []byte {
+	data := hooktest.ToolCallFinished().With("output_preview", "OUTPUT").With("argv", []string{"diff", "ARG"}).Bytes()
+	data = []byte(strings.Replace(string(data), `"OUTPUT"`, `"`+output+`"`, 1))
+	return []byte(strings.Replace(string(data), `"ARG"`, "\"a\xffb\"", 1))
+}
+
+func TestInvalidUTF8Policies(t *testing.T) {
+	output := "Binary files differ\\n\xff\xd8\xff\xe0 JFIF\\u0000 ok é"
+	raw := "Binary files differ\n\xff\xd8\xff\xe0 JFIF\x00 ok é"
+	// encoding/json replaces each invalid byte, as ranging over the string does.
+	var replaced string
+	for _, r := range raw {
+		replaced += string(r)
+	}
+	data := binaryPayload(output)
+
+	// Replace, the default, is what encoding/json does.
+	for _, opts := range [][]hooksdk.Option{nil, {hooksdk.WithInvalidUTF8(hooksdk.InvalidUTF8Replace)}} {
+		p, err := hooksdk.ParseHookPayload(data, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.RawPayload["output_preview"] != replaced || p.RawPayload["output_preview"+hooksdk.Base64Suffix] != nil {
+			t.Errorf("replace: output = %q, copy %v", p.RawPayload["output_preview"], p.RawPayload["output_preview"+hooksdk.Base64Suffix])
+		}
+	}
+
+	// Base64 adds the bytes alongside, for strings and arrays of them.
+	p, err := hooksdk.ParseHookPayload(data, hooksdk.WithInvalidUTF8(hooksdk.InvalidUTF8Base64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.RawPayload["output_preview"] != replaced {
+		t.Errorf("base64: output = %q, want %q", p.RawPayload["output_preview"], replaced)
+	}
+	if got, _ := base64.StdEncoding.DecodeString(p.RawPayload["output_preview__base64"].(string)); string(got) != raw {
+		t.Errorf("base64 copy = %q, want %q", got, raw)
+	}
+	if got := p.RawPayload["argv__base64"]; !reflect.DeepEqual(got, []any{nil, base64.StdEncoding.EncodeToString([]byte("a\xffb"))}) {
+		t.Errorf("argv copy = %#v", got)
+	}
+	// The copy of a modeled field isn't an unknown one; that of an unknown field is.
+	if got := p.UnknownFields(); !reflect.DeepEqual(got, []string{"argv", "argv__base64"}) {
+		t.Errorf("UnknownFields = %q", got)
+	}
+
+	// Fail names the first such field.
+	_, err = hooksdk.ParseHookPayload(data, hooksdk.WithInvalidUTF8(hooksdk.InvalidUTF8Fail))
+	var uerr *hooksdk.InvalidUTF8Error
+	if !errors.Is(err, hooksdk.ErrInvalidUTF8) || !errors.As(err, &uerr) || uerr.Field != "argv[1]" || err.Error() != "payload field argv[1] is not valid UTF-8" {
+		t.Errorf("fail: %v", err)
+	}
+}
+
+func TestInvalidUTF8Valid(t *testing.T) {
+	// NUL bytes, escaped as they must be, are valid; nothing is added or refused.
+	data := hooktest.ToolCallFinished().With("output_preview", "a\x00b\x00").Bytes()
+	for _, policy := range []hooksdk.InvalidUTF8Policy{hooksdk.InvalidUTF8Replace, hooksdk.InvalidUTF8Base64, hooksdk.InvalidUTF8Fail} {
+		p, err := hooksdk.ParseHookPayload(data, hooksdk.WithInvalidUTF8(policy))
+		if err != nil {
+			t.Fatalf("policy %d: %v", policy, err)
+		}
+		if p.RawPayload["output_preview"] != "a\x00b\x00" || p.RawPayload["output_preview__base64"] != nil {
+			t.Errorf("policy %d: %#v", policy, p.RawPayload)
+		}
+	}
+
+	// Invalid keys are replaced whatever the policy.
+	data = []byte(strings.Replace(string(hooktest.SessionStart().With("KEY", "v").Bytes()), "KEY", "k\xff", 1))
+	p, err := hooksdk.ParseHookPayload(data, hooksdk.WithInvalidUTF8(hooksdk.InvalidUTF8Fail))
+	if err != nil || p.RawPayload["k�"] != "v" {
+		t.Errorf("invalid key: %v, %v", p, err)
+	}
+}
+
+func TestInvalidUTF8Long(t *testing.T) {
+	// A long string of mixed valid and invalid runs keeps every byte.
+	var raw, quoted strings.Builder
+	for raw.Len() < 1<<20 {
+		raw.WriteString("ok \t\"\xfe日本\xe6\x97 ")
+		quoted.WriteString("ok \\t\\\"\xfe日本\xe6\x97 ")
+	}
+	data := binaryPayload(quoted.String())
+	p, err := hooksdk.ParseHookPayload(data, hooksdk.WithInvalidUTF8(hooksdk.InvalidUTF8Base64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := base64.StdEncoding.DecodeString(p.RawPayload["output_preview__base64"].(string))
+	if err != nil || string(got) != raw.String() {
+		t.Errorf("copy of %d bytes: got %d bytes, %v", raw.Len(), len(got), err)
+	}
+}
+
+func TestReadPayloadJSONInvalidUTF8(t *testing.T) {
+	read := func(policy hooksdk.InvalidUTF8Policy) (hooksdk.HookPayloadJSON, error) {
+		stdio, _, _ := testIO(binaryPayload("\xff"), nil)
+		return hooksdk.ReadPayloadJSON(hooksdk.WithIO(stdio), hooksdk.WithInvalidUTF8(policy))
+	}
+	p, err := read(hooksdk.InvalidUTF8Base64)
+	if err != nil || p["output_preview__base64"] != "/w==" {
+		t.Errorf("base64: %v, %v", p["output_preview__base64"], err)
+	}
+	// Numbers are still json.Number.
+	if _, ok := p["duration_ms"].(json.Number); !ok {
+		t.Errorf("duration_ms = %T", p["duration_ms"])
+	}
+	if _, err := read(hooksdk.InvalidUTF8Fail); !errors.Is(err, hooksdk.ErrInvalidUTF8) {
+		t.Errorf("fail: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package hooksdk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseHookPayloadValidated parses data like ParseHookPayload, then checks the typed payload of
+// its event type (see HookPayload.Event) with its Validate method: a payload with an empty
+// session id, say, fails with a *SchemaError instead of reaching the handler. Payloads of event
+// types the SDK doesn't know are returned unchecked.
+func ParseHookPayloadValidated(data []byte, opts ...Option) (*HookPayload, error) {
+	p, err := ParseHookPayload(data, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := p.Event()
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := ev.(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// fieldChecks collects the violations the generated Validate methods find, in the same terms as
+// ValidatePayload's.
+type fieldChecks []Violation
+
+func (c *fieldChecks) nonEmpty(ptr, v string) {
+	if v == "" {
+		*c = append(*c, Violation{ptr, "must not be empty"})
+	}
+}
+
+func (c *fieldChecks) oneOf(ptr, v string, allowed ...string) {
+	for _, a := range allowed {
+		if v == a {
+			return
+		}
+	}
+	quoted := make([]string, len(allowed))
+	for i, a := range allowed {
+		quoted[i] = strconv.Quote(a)
+	}
+	*c = append(*c, Violation{ptr, "must be one of " + strings.Join(quoted, ", ")})
+}
+
+func (c *fieldChecks) atLeast(ptr string, v, min int64) {
+	if v < min {
+		*c = append(*c, Violation{ptr, fmt.Sprintf("must be at least %d", min)})
+	}
+}
+
+func (c fieldChecks) err(eventType EventType) error {
+	if len(c) == 0 {
+		return nil
+	}
+	return &SchemaError{EventType: string(eventType), Violations: c}
+}
+
+func itemPointer(ptr string, i int) string {
+	return ptr + "/" + strconv.Itoa(i)
+}
@@ -0,0 +1,172 @@
+package hooksdk_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+// validate decodes the payload b builds and runs its Validate method.
+func validate(t *testing.T, b *hooktest.Builder) error {
+	t.Helper()
+	ev, err := b.Build().Event()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, ok := ev.(interface{ Validate() error })
+	if !ok {
+		t.Fatalf("%T has no Validate method", ev)
+	}
+	return v.Validate()
+}
+
+func violations(t *testing.T, err error) []hooksdk.Violation {
+	t.Helper()
+	var se *hooksdk.SchemaError
+	if !errors.As(err, &se) {
+		t.Fatalf("error = %v, want a *SchemaError", err)
+	}
+	vs := append([]hooksdk.Violation(nil), se.Violations...)
+	sort.Slice(vs, func(i, j int) bool { return vs[i].Pointer < vs[j].Pointer })
+	return vs
+}
+
+func containsViolation(vs []hooksdk.Violation, v hooksdk.Violation) bool {
+	for _, w := range vs {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
+
+// constrained is a case the schema of an event type rules out: a value for one of its fields.
+type constrained struct {
+	field string
+	value any
+}
+
+// constrainedFields lists, from the schema of eventType, a bad value for each field Validate
+// checks: "" for a string with minLength, an unlisted value for an enum, and -1 for an integer with
+// a minimum.
+func constrainedFields(t *testing.T, eventType string) []constrained {
+	t.Helper()
+	data, _ := hooksdk.SchemaFor(eventType)
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	var out []constrained
+	for field, raw := range schema.Properties {
+		var prop struct {
+			MinLength *int     `json:"minLength"`
+			Enum      []string `json:"enum"`
+			Minimum   *float64 `json:"minimum"`
+		}
+		if json.Unmarshal(raw, &prop) != nil {
+			continue
+		}
+		switch {
+		case prop.MinLength != nil && *prop.MinLength > 0:
+			out = append(out, constrained{field, ""})
+		case len(prop.Enum) > 0:
+			out = append(out, constrained{field, "not-a-value"})
+		case prop.Minimum != nil && *prop.Minimum == 0:
+			out = append(out, constrained{field, -1})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].field < out[j].field })
+	return out
+}
+
+func TestValidateFixtures(t *testing.T) {
+	for eventType, b := range hooktest.Fixtures() {
+		if err := validate(t, b); err != nil {
+			t.Errorf("%s fixture: %v", eventType, err)
+		}
+	}
+}
+
+func TestValidateAgreesWithSchema(t *testing.T) {
+	for _, et := range hooksdk.AllEventTypes() {
+		eventType := string(et)
+		cases := constrainedFields(t, eventType)
+		if len(cases) == 0 {
+			t.Errorf("%s: no constrained fields", eventType)
+		}
+		for _, c := range cases {
+			b := hooktest.Fixtures()[eventType].With(c.field, c.value)
+			got := violations(t, validate(t, b))
+			// ValidatePayload may add a violation Validate leaves out, such as -1 being out of
+			// range for a uint32, but it reports the same one too.
+			want := violations(t, hooksdk.ValidatePayload(b.Bytes()))
+			if len(got) != 1 || got[0].Pointer != "/"+c.field || !containsViolation(want, got[0]) {
+				t.Errorf("%s with %s = %v: Validate reports %v, ValidatePayload %v", eventType, c.field, c.value, got, want)
+			}
+		}
+	}
+}
+
+func TestValidateViolations(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload *hooktest.Builder
+		want    []hooksdk.Violation
+	}{
+		{"empty session id", hooktest.SessionStart().WithSessionID(""),
+			[]hooksdk.Violation{{Pointer: "/session_id", Message: "must not be empty"}}},
+		{"missing session id", hooktest.SessionStart().With("session_id", nil),
+			[]hooksdk.Violation{{Pointer: "/session_id", Message: "must not be empty"}}},
+		{"bad status", hooktest.ToolCallFinished().With("status", "exploded"),
+			[]hooksdk.Violation{{Pointer: "/status", Message: `must be one of "completed", "aborted"`}}},
+		{"negative duration", hooktest.ToolCallFinished().With("duration_ms", -5),
+			[]hooksdk.Violation{{Pointer: "/duration_ms", Message: "must be at least 0"}}},
+		// An enum through a $ref, reported with the other problems of the payload.
+		{"several", hooktest.ApprovalRequested().With("approval_policy", "sometimes").With("kind", "magic").WithCwd(""),
+			[]hooksdk.Violation{
+				{Pointer: "/approval_policy", Message: `must be one of "untrusted", "on-failure", "on-request", "never"`},
+				{Pointer: "/cwd", Message: "must not be empty"},
+				{Pointer: "/kind", Message: `must be one of "exec", "apply-patch", "elicitation"`},
+			}},
+		// The host sends transcript_path empty, so it isn't checked.
+		{"empty transcript path", hooktest.SessionStart().With("transcript_path", ""), nil},
+		{"null approval policy", hooktest.ApprovalRequested().With("approval_policy", nil), nil},
+	}
+	for _, tt := range tests {
+		err := validate(t, tt.payload)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if got := violations(t, err); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: violations = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseHookPayloadValidated(t *testing.T) {
+	if p, err := hooksdk.ParseHookPayloadValidated(hooktest.ToolCallStarted().Bytes()); err != nil || p.Type() != hooksdk.EventToolCallStarted {
+		t.Errorf("valid payload: %v", err)
+	}
+	bad := hooktest.ToolCallStarted().With("tool_name", "").Bytes()
+	var se *hooksdk.SchemaError
+	if p, err := hooksdk.ParseHookPayloadValidated(bad); p != nil || !errors.As(err, &se) || se.EventType != "tool-call-started" {
+		t.Errorf("payload without a tool name = %v, %v; want a SchemaError", p, err)
+	}
+	// Unknown event types have no rules and come back unchecked.
+	if p, err := hooksdk.ParseHookPayloadValidated(hooktest.New("plan-updated", "").With("session_id", "").Bytes()); err != nil || p.EventType() != "plan-updated" {
+		t.Errorf("unknown event type: %v", err)
+	}
+	if _, err := hooksdk.ParseHookPayloadValidated([]byte("{")); err == nil || errors.As(err, &se) {
+		t.Errorf("invalid JSON: %v, want a parse error", err)
+	}
+}
@@ -0,0 +1,181 @@
+package hooksdk
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is SDKVersion unless the build stamps another, e.g. a pre-release:
+//
+//	go build -ldflags "-X example.com/xcodex/hooks-sdk/hooksdk.version=0.5.0-rc.1" ./cmd/...
+var version = SDKVersion
+
+// Version returns the semantic version of the SDK the hook was built with. It is sent with every
+// response (Response.Metadata) and checked against the envelope's `min_sdk_version`.
+func Version() string {
+	return version
+}
+
+// ErrSDKTooOld is returned when the envelope's `min_sdk_version` (or the legacy `min-sdk-version`)
+// is newer than Version: the host needs a newer SDK than the hook was built with. The error is a
+// *SDKVersionError (see errors.As). Run answers such an event with an allow response whose
+// system_message says to rebuild the hook, and exits with ExitError (see WithErrorPolicy for
+// the answer under an error policy).
+var ErrSDKTooOld = errors.New("hooks SDK too old")
+
+// SDKVersionError reports an SDK older than the host requires. It matches ErrSDKTooOld with
+// errors.Is.
+type SDKVersionError struct {
+	// Required is the envelope's min_sdk_version; Installed is Version.
+	Required, Installed string
+}
+
+func (e *SDKVersionError) Error() string {
+	return fmt.Sprintf("host requires hooks SDK %s or later, but the hook was built with %s; rebuild it with the current SDK",
+		e.Required, e.Installed)
+}
+
+func (e *SDKVersionError) Is(target error) bool { return target == ErrSDKTooOld }
+
+// checkMinSDKVersion checks the envelope's min_sdk_version, v, against Version. A version that
+// isn't a semantic version string is an ErrInvalidEnvelope.
+func checkMinSDKVersion(v any) error {
+	min, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("%w: min_sdk_version must be a string", ErrInvalidEnvelope)
+	}
+	c, err := CompareVersions(Version(), min)
+	if err != nil {
+		return fmt.Errorf("%w: min_sdk_version: %v", ErrInvalidEnvelope, err)
+	}
+	if c < 0 {
+		return &SDKVersionError{Required: min, Installed: Version()}
+	}
+	return nil
+}
+
+// CompareVersions compares two semantic versions (https://semver.org), returning -1, 0 or +1 as a
+// is older than, the same as, or newer than b. A leading "v" is allowed. Pre-releases come before
+// their release (1.0.0-rc.1 < 1.0.0) and compare by identifier, numeric ones numerically and
+// before alphanumeric ones (1.0.0-alpha < 1.0.0-alpha.1 < 1.0.0-beta < 1.0.0-beta.2 <
+// 1.0.0-beta.11); build metadata (`+...`) is ignored.
+func CompareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va.core {
+		if c := compareInt(va.core[i], vb.core[i]); c != 0 {
+			return c, nil
+		}
+	}
+	switch {
+	case va.pre == nil && vb.pre == nil:
+		return 0, nil
+	case va.pre == nil:
+		return 1, nil
+	case vb.pre == nil:
+		return -1, nil
+	}
+	for i := 0; i < len(va.pre) && i < len(vb.pre); i++ {
+		if c := comparePrerelease(va.pre[i], vb.pre[i]); c != 0 {
+			return c, nil
+		}
+	}
+	return compareInt(uint64(len(va.pre)), uint64(len(vb.pre))), nil
+}
+
+// semver is a parsed semantic version: MAJOR.MINOR.PATCH and the pre-release identifiers.
+type semver struct {
+	core [3]uint64
+	pre  []string
+}
+
+func parseVersion(s string) (semver, error) {
+	var v semver
+	rest := strings.TrimPrefix(s, "v")
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, pre, hasPre := strings.Cut(rest, "-")
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("version %q isn't MAJOR.MINOR.PATCH", s)
+	}
+	for i, p := range parts {
+		n, ok := numericIdentifier(p)
+		if !ok {
+			return v, fmt.Errorf("version %q: %q isn't a number", s, p)
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		v.pre = strings.Split(pre, ".")
+		for _, id := range v.pre {
+			if !validPrerelease(id) {
+				return v, fmt.Errorf("version %q: bad pre-release identifier %q", s, id)
+			}
+		}
+	}
+	return v, nil
+}
+
+// numericIdentifier parses a number without leading zeros.
+func numericIdentifier(s string) (uint64, bool) {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	return n, err == nil
+}
+
+// validPrerelease reports whether id is a non-empty run of [0-9A-Za-z-], without leading zeros if
+// it is numeric.
+func validPrerelease(id string) bool {
+	if id == "" {
+		return false
+	}
+	numeric := true
+	for _, r := range id {
+		switch {
+		case r >= '0' && r <= '9':
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '-':
+			numeric = false
+		default:
+			return false
+		}
+	}
+	if numeric {
+		_, ok := numericIdentifier(id)
+		return ok
+	}
+	return true
+}
+
+func comparePrerelease(a, b string) int {
+	na, aNum := numericIdentifier(a)
+	nb, bNum := numericIdentifier(b)
+	switch {
+	case aNum && bNum:
+		return compareInt(na, nb)
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInt(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package hooksdk_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"example.com/xcodex/hooks-sdk/hooksdk"
+	"example.com/xcodex/hooks-sdk/hooksdk/hooktest"
+)
+
+func TestCompareVersions(t *testing.T) {
+	// Each is older than the next (semver.org, section 11).
+	ordered := []string{
+		"0.9.9", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "1.10.0", "2.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			want := 0
+			switch {
+			case i < j:
+				want = -1
+			case i > j:
+				want = 1
+			}
+			if got, err := hooksdk.CompareVersions(a, b); err != nil || got != want {
+				t.Errorf("CompareVersions(%s, %s) = %d, %v; want %d", a, b, got, err, want)
+			}
+		}
+	}
+	for _, equal := range [][2]string{{"v1.2.3", "1.2.3"}, {"1.2.3+build.5", "1.2.3"}, {"1.0.0-rc.1+x", "1.0.0-rc.1"}} {
+		if got, err := hooksdk.CompareVersions(equal[0], equal[1]); err != nil || got != 0 {
+			t.Errorf("CompareVersions(%s, %s) = %d, %v; want 0", equal[0], equal[1], got, err)
+		}
+	}
+	for _, bad := range []string{"", "1", "1.2", "1.2.3.4", "01.2.3", "1.x.3", "1.2.3-", "1.2.3-rc..1", "1.2.3-01", "1.2.3-rc_1", "latest"} {
+		if _, err := hooksdk.CompareVersions(bad, "1.0.0"); err == nil {
+			t.Errorf("CompareVersions(%q, 1.0.0) succeeded", bad)
+		}
+		if _, err := hooksdk.CompareVersions("1.0.0", bad); err == nil {
+			t.Errorf("CompareVersions(1.0.0, %q) succeeded", bad)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	if hooksdk.Version() != hooksdk.SDKVersion {
+		t.Errorf("Version() = %s, want SDKVersion %s in an unstamped build", hooksdk.Version(), hooksdk.SDKVersion)
+	}
+}
+
+// minVersionEnvelope returns an inline envelope for a session-start payload with key set to min.
+func minVersionEnvelope(t *testing.T, key string, min any) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{"payload": hooktest.SessionStart().Map(), key: min})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestMinSDKVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		min     any
+		tooOld  bool
+		invalid bool
+	}{
+		{"equal", hooksdk.Version(), false, false},
+		{"older", "0.1.0", false, false},
+		{"pre-release of this version", hooksdk.Version() + "-rc.1", false, false},
+		{"newer", "99.0.0", true, false},
+		{"newer pre-release", "99.0.0-alpha", true, false},
+		{"malformed", "1.2", false, true},
+		{"not a string", 1, false, true},
+	}
+	for _, key := range []string{"min_sdk_version", "min-sdk-version"} {
+		for _, tt := range tests {
+			_, err := hooksdk.ReadPayloadFrom(bytes.NewReader(minVersionEnvelope(t, key, tt.min)))
+			var ve *hooksdk.SDKVersionError
+			switch {
+			case tt.tooOld:
+				if !errors.Is(err, hooksdk.ErrSDKTooOld) || !errors.As(err, &ve) || ve.Required != tt.min || ve.Installed != hooksdk.Version() {
+					t.Errorf("%s %s: %v, want ErrSDKTooOld", key, tt.name, err)
+				}
+			case tt.invalid:
+				if !errors.Is(err, hooksdk.ErrInvalidEnvelope) || errors.Is(err, hooksdk.ErrSDKTooOld) {
+					t.Errorf("%s %s: %v, want ErrInvalidEnvelope", key, tt.name, err)
+				}
+			case err != nil:
+				t.Errorf("%s %s: %v", key, tt.name, err)
+			}
+		}
+	}
+}
+
+func TestRunSDKTooOld(t *testing.T) {
+	called := false
+	h := func(context.Context, *hooksdk.HookPayload) (hooksdk.Response, error) {
+		called = true
+		return hooksdk.Deny("no"), nil
+	}
+	var out, errOut bytes.Buffer
+	code := hooksdk.RunIO(context.Background(), bytes.NewReader(minVersionEnvelope(t, "min_sdk_version", "99.0.0")), &out, &errOut, h)
+	if code != hooksdk.ExitError || called {
+		t.Errorf("exit code %d, handler called %v; want %d without calling it", code, called, hooksdk.ExitError)
+	}
+	var resp hooksdk.Response
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		t.Fatalf("response %q: %v", out.String(), err)
+	}
+	if resp.Decision != hooksdk.DecisionAllow || resp.ReasonCode != "SDK_TOO_OLD" || !strings.Contains(resp.SystemMessage, "requires hooks SDK 99.0.0 or later") {
+		t.Errorf("response = %+v", resp)
+	}
+	if resp.Metadata == nil || resp.Metadata.SDKVersion != hooksdk.Version() {
+		t.Errorf("metadata = %+v, want the SDK version", resp.Metadata)
+	}
+	if !strings.Contains(errOut.String(), "read_payload") {
+		t.Errorf("stderr = %q, want the error logged", errOut.String())
+	}
+}
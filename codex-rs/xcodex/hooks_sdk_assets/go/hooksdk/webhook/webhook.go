@@ -0,0 +1,162 @@
+// Package webhook POSTs hook events to an HTTP endpoint, signing each body with HMAC-SHA256 and
+// retrying transient failures within a short deadline so a slow endpoint can't stall the session.
+//
+// Receivers verify the `X-Hook-Signature` header with Verify (or by comparing it to
+// "sha256=" + hex(HMAC-SHA256(secret, body))). The `X-Hook-Invocation-Id` header names the hook
+// invocation that sent the body, to match it with the hook's logs and response.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/internal/invocation"
+	"example.com/xcodex/hooks-sdk/hooksdk/retry"
+)
+
+// SignatureHeader carries the body signature, "sha256=<hex>".
+const SignatureHeader = "X-Hook-Signature"
+
+// InvocationIDHeader carries the id of the hook invocation sending the request (see
+// hooksdk.HookPayload.InvocationID): the one Send's ctx carries, or else that of the event the
+// process read on stdin. Client.Header can set it instead, e.g. for an event queued by another
+// process.
+const InvocationIDHeader = "X-Hook-Invocation-Id"
+
+// DefaultDeadline bounds a Send, including all retries, when Client.Deadline is zero.
+const DefaultDeadline = 5 * time.Second
+
+// The retry timing of Send. The deadline ends the retries well before the cap matters.
+const (
+	initialBackoff = 200 * time.Millisecond
+	maxBackoff     = 2 * time.Second
+	backoffJitter  = 0.2
+)
+
+// Sign returns the SignatureHeader value for body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the SignatureHeader value for body, in constant time.
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// StatusError is returned when the endpoint answers with a non-2xx status that isn't retried (or
+// still fails when the deadline runs out).
+type StatusError struct {
+	StatusCode int
+	// Body is the start of the response body, for diagnostics.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("webhook: endpoint returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("webhook: endpoint returned %d: %s", e.StatusCode, e.Body)
+}
+
+// Client sends events to URL.
+type Client struct {
+	URL string
+	// Secret signs each body in SignatureHeader. Empty sends unsigned requests.
+	Secret []byte
+	// Header holds extra request headers; a Content-Type here replaces the default
+	// application/json.
+	Header http.Header
+	// Deadline bounds each Send, retries included. Zero means DefaultDeadline.
+	Deadline time.Duration
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// OnRetry, if set, is called before each retry with the attempt that failed, its error, and
+	// the wait (see retry.Policy), e.g. to log it.
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// Send POSTs body (JSON, unless Header says otherwise). Connection errors, timeouts, and 408, 429,
+// and 5xx responses are retried with exponential backoff and jitter until the deadline (see
+// hooksdk/retry); other non-2xx responses fail at once with a *StatusError.
+func (c *Client) Send(ctx context.Context, body []byte) error {
+	deadline := c.Deadline
+	if deadline <= 0 {
+		deadline = DefaultDeadline
+	}
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+
+	policy := retry.Policy{
+		InitialBackoff: initialBackoff,
+		MaxBackoff:     maxBackoff,
+		Jitter:         backoffJitter,
+		Classify:       retryable,
+		OnRetry:        c.OnRetry,
+	}
+	err := retry.Do(ctx, policy, func() error { return c.post(ctx, body) })
+	var giveUp *retry.GiveUpError
+	if errors.As(err, &giveUp) {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	return err
+}
+
+func (c *Client) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, vs := range c.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if req.Header.Get(InvocationIDHeader) == "" {
+		if id := invocation.FromContext(ctx); id != "" {
+			req.Header.Set(InvocationIDHeader, id)
+		}
+	}
+	if len(c.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(c.Secret, body))
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(snippet))}
+}
+
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return retry.HTTPStatus(se.StatusCode)
+	}
+	// Anything else is a transport error: refused connections, resets, timeouts.
+	return true
+}
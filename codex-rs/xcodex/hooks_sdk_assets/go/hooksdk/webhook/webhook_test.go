@@ -0,0 +1,138 @@
+package webhook_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/xcodex/hooks-sdk/hooksdk/webhook"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret, body := []byte("s3cret"), []byte(`{"type":"session-start"}`)
+	sig := webhook.Sign(secret, body)
+	// echo -n '{"type":"session-start"}' | openssl dgst -sha256 -hmac s3cret
+	const want = "sha256=96f7bdae4be1bf6b6f28ad5da2af175f26edac7aa8924d85356c2b833be30eef"
+	if sig != want {
+		t.Errorf("Sign = %s, want %s", sig, want)
+	}
+	if !webhook.Verify(secret, body, sig) {
+		t.Errorf("Verify rejected its own signature")
+	}
+	if webhook.Verify([]byte("other"), body, sig) || webhook.Verify(secret, []byte("{}"), sig) {
+		t.Errorf("Verify accepted a signature for another secret or body")
+	}
+}
+
+func TestSend(t *testing.T) {
+	secret, body := []byte("s3cret"), []byte(`{"session_id":"s1"}`)
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	c := &webhook.Client{URL: srv.URL, Secret: secret, Header: http.Header{"X-Extra": {"1"}}}
+	if err := c.Send(context.Background(), body); err != nil {
+		t.Fatal(err)
+	}
+	if got.Method != http.MethodPost || string(gotBody) != string(body) {
+		t.Errorf("request = %s %s", got.Method, gotBody)
+	}
+	if got.Header.Get("Content-Type") != "application/json" || got.Header.Get("X-Extra") != "1" {
+		t.Errorf("headers = %v", got.Header)
+	}
+	if !webhook.Verify(secret, gotBody, got.Header.Get(webhook.SignatureHeader)) {
+		t.Errorf("signature %q doesn't verify", got.Header.Get(webhook.SignatureHeader))
+	}
+
+	// Without a secret the request isn't signed.
+	c.Secret = nil
+	if err := c.Send(context.Background(), body); err != nil {
+		t.Fatal(err)
+	}
+	if sig := got.Header.Get(webhook.SignatureHeader); sig != "" {
+		t.Errorf("unsigned request has signature %q", sig)
+	}
+}
+
+func TestSendRetriesTransientFailures(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	var retries []int
+	c := &webhook.Client{URL: srv.URL, OnRetry: func(attempt int, err error, wait time.Duration) {
+		retries = append(retries, attempt)
+	}}
+	if err := c.Send(context.Background(), []byte("{}")); err != nil {
+		t.Fatalf("Send after two 503s: %v", err)
+	}
+	if calls.Load() != 3 || len(retries) != 2 {
+		t.Errorf("%d calls, retries %v; want 3 calls and 2 retries", calls.Load(), retries)
+	}
+}
+
+func TestSendTerminalStatus(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	err := (&webhook.Client{URL: srv.URL}).Send(context.Background(), []byte("{}"))
+	var se *webhook.StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusUnauthorized || se.Body != "bad signature" {
+		t.Fatalf("Send = %v, want a 401 StatusError", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("a 401 was tried %d times, want once", calls.Load())
+	}
+}
+
+func TestSendDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	err := (&webhook.Client{URL: srv.URL, Deadline: 300 * time.Millisecond}).Send(context.Background(), []byte("{}"))
+	if err == nil {
+		t.Fatal("Send to an endpoint that always fails succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send took %v, past its 300ms deadline", elapsed)
+	}
+}
+
+func TestSendRetriedStatuses(t *testing.T) {
+	for code, retried := range map[int]bool{http.StatusTooManyRequests: true, http.StatusRequestTimeout: true, http.StatusBadRequest: false, http.StatusNotFound: false} {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(code)
+			}
+		}))
+		err := (&webhook.Client{URL: srv.URL}).Send(context.Background(), []byte("{}"))
+		srv.Close()
+		if retried && (err != nil || calls.Load() != 2) {
+			t.Errorf("%d: Send = %v after %d calls, want a retry that succeeds", code, err, calls.Load())
+		}
+		if !retried && (err == nil || calls.Load() != 1) {
+			t.Errorf("%d: Send = %v after %d calls, want to fail at once", code, err, calls.Load())
+		}
+	}
+}
@@ -359,21 +359,1340 @@ fn assets_for(sdk: HookSdk) -> Vec<Asset> {
                 content: include_str!("hooks_sdk_assets/go/README.md"),
                 executable: false,
             },
+            Asset {
+                rel_path: "templates/go/hooksdk/aggregate/aggregate.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/aggregate/aggregate.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/anonymize/anonymize.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/anonymize/anonymize.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/batch.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/batch.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/canonicaljson/cj.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/canonicaljson/cj.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/capabilities.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/capabilities.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/cbor.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/cbor.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/chat/batch.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/chat/batch.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/chat/chat.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/chat/chat.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/clone.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/clone.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/cloudevents/cloudevents.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/cloudevents/cloudevents.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/coalesce/coalesce.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/coalesce/coalesce.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/codexhome.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/codexhome.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/config.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/config.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/context.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/context.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/correlate/correlate.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/correlate/correlate.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/debugcapture.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/debugcapture.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/decisioncache/decisioncache.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/decisioncache/decisioncache.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/dedup/dedup.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/dedup/dedup.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/detach.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/detach.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/detach_other.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/detach_other.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/detach_unix.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/detach_unix.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/detach_windows.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/detach_windows.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/diffview/diffview.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/diffview/diffview.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/diffview/lines.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/diffview/lines.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/diffview/parse.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/diffview/parse.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/dryrun.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/dryrun.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/email/email.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/email/email.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/email/emailtest/emailtest.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/email/emailtest/emailtest.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/envelope.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/envelope.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/environ.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/environ.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/errorpolicy.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/errorpolicy.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/errors.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/errors.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/event.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/event.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/eventlog/eventlog.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/eventlog/eventlog.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/eventlog/eventlog_other.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/eventlog/eventlog_other.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/eventlog/eventlog_windows.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/eventlog/eventlog_windows.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/events.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/events.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/events_gen.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/events_gen.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/execadapter/execadapter.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/execadapter/execadapter.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/fields.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/fields.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/filter.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/filter.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/filterexpr/filterexpr.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/filterexpr/filterexpr.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/filterexpr/parse.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/filterexpr/parse.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/gha/emit.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/gha/emit.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/gha/gha.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/gha/gha.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/gha/session.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/gha/session.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/gha/summary.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/gha/summary.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/gitsnap/gitsnap.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/gitsnap/gitsnap.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/gitsnap/paths.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/gitsnap/paths.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/guard/builtin.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/guard/builtin.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/guard/config.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/guard/config.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/guard/corpus.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/guard/corpus.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/guard/guard.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/guard/guard.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/guard/shell.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/guard/shell.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/history.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/history.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/hooklog/hooklog.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/hooklog/hooklog.go"),
+                executable: false,
+            },
             Asset {
                 rel_path: "templates/go/hooksdk/hooksdk.go",
                 content: include_str!("hooks_sdk_assets/go/hooksdk/hooksdk.go"),
                 executable: false,
             },
+            Asset {
+                rel_path: "templates/go/hooksdk/hooktest/hooktest.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/hooktest/hooktest.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/atomicfile/atomicfile.go",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/internal/atomicfile/atomicfile.go"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/cbor/cbor.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/cbor/cbor.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/filelock/filelock.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/filelock/filelock.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/filelock/filelock_other.go",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/internal/filelock/filelock_other.go"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/filelock/filelock_unix.go",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/internal/filelock/filelock_unix.go"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/filelock/filelock_windows.go",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/internal/filelock/filelock_windows.go"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/gen/main.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/gen/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/invocation/invocation.go",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/internal/invocation/invocation.go"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/minitoml/minitoml.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/minitoml/minitoml.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/term/term.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/term/term.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/term/term_bsd.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/term/term_bsd.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/term/term_linux.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/term/term_linux.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/term/term_other.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/term/term_other.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/term/term_windows.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/term/term_windows.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/internal/utf8safe/utf8safe.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/internal/utf8safe/utf8safe.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/invocation.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/invocation.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/io.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/io.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/audit.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/audit.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/compress.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/compress.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/follow.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/follow.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/format.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/format.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/jsonl.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/jsonl.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/legacy.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/legacy.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/meta.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/meta.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/names.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/names.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/read.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/read.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/spool.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/spool.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/sync.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/sync.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonl/sync_windows.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonl/sync_windows.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/jsonschema.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/jsonschema.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/lazy.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/lazy.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/limits.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/limits.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/lock.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/lock.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/marshal.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/marshal.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/mcp/http.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/mcp/http.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/mcp/mcp.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/mcp/mcp.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/mcp/mcptest/mcptest.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/mcp/mcptest/mcptest.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/mcp/stdio.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/mcp/stdio.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/meta.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/meta.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/metrics/metrics.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/metrics/metrics.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/metrics/recorder.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/metrics/recorder.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/middleware.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/middleware.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/migrate.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/migrate.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/modify.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/modify.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/multi.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/multi.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/multierror.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/multierror.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/mux.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/mux.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/netguard/netguard.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/netguard/netguard.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/netguard/tools.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/netguard/tools.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/notify/notify.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/notify/notify.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/ntfy/ntfy.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/ntfy/ntfy.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/ntfy/ntfytest/ntfytest.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/ntfy/ntfytest/ntfytest.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/numbers.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/numbers.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/openpayload.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/openpayload.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/options.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/options.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/otel/export.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/otel/export.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/otel/json.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/otel/json.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/otel/otel.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/otel/otel.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/otel/proto.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/otel/proto.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/otel/tracer.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/otel/tracer.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/outbox/outbox.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/outbox/outbox.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/parquet/parquet.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/parquet/parquet.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/parquet/parquettest/parquettest.go",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/parquet/parquettest/parquettest.go"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/parquet/thrift.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/parquet/thrift.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/pathfilter/pathfilter.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/pathfilter/pathfilter.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/pathfilter/pattern.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/pathfilter/pattern.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/payload.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/payload.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/payloadfd.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/payloadfd.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/payloadfd_other.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/payloadfd_other.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/payloadfd_unix.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/payloadfd_unix.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/payloadpath.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/payloadpath.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/payloadretry.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/payloadretry.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/peek.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/peek.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/pipeline.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/pipeline.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/projectconfig.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/projectconfig.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/projectconfig_other.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/projectconfig_other.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/projectconfig_unix.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/projectconfig_unix.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/question.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/question.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/ratelimit/ratelimit.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/ratelimit/ratelimit.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/redact/redact.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/redact/redact.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/reload.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/reload.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/reload_other.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/reload_other.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/reload_unix.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/reload_unix.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/response.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/response.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/retry/retry.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/retry/retry.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/run.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/run.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/run/group_other.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/run/group_other.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/run/group_unix.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/run/group_unix.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/run/group_windows.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/run/group_windows.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/run/run.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/run/run.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/s3/s3.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/s3/s3.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/s3/s3test/s3test.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/s3/s3test/s3test.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/sample.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/sample.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schema.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/schema.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/agent-turn-complete.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/agent-turn-complete.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/approval-requested.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/approval-requested.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/model-request-started.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/model-request-started.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/model-response-completed.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/model-response-completed.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/notification.json",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/schemas/notification.json"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/pre-compact.json",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/schemas/pre-compact.json"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/agent-turn-complete.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/agent-turn-complete.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/approval-requested.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/approval-requested.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/model-request-started.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/model-request-started.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/model-response-completed.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/model-response-completed.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/notification.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/notification.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/pre-compact.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/pre-compact.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/session-end.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/session-end.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/session-start.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/session-start.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/subagent-stop.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/subagent-stop.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/tool-call-finished.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/tool-call-finished.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/tool-call-started.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/tool-call-started.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/responses/user-prompt-submit.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/responses/user-prompt-submit.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/session-end.json",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/schemas/session-end.json"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/session-start.json",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/schemas/session-start.json"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/subagent-stop.json",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/schemas/subagent-stop.json"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/tool-call-finished.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/tool-call-finished.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/tool-call-started.json",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/schemas/tool-call-started.json"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/schemas/user-prompt-submit.json",
+                content: include_str!(
+                    "hooks_sdk_assets/go/hooksdk/schemas/user-prompt-submit.json"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/secrets/config.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/secrets/config.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/secrets/patch.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/secrets/patch.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/secrets/secrets.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/secrets/secrets.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/selftest.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/selftest.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/serve.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/serve.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/shortid.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/shortid.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/signature.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/signature.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/sink/msgsize_other.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/sink/msgsize_other.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/sink/msgsize_plan9.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/sink/msgsize_plan9.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/sink/sink.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/sink/sink.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/sink/socket.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/sink/socket.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/sizestats/sizestats.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/sizestats/sizestats.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/sketch/sketch.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/sketch/sketch.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/state/state.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/state/state.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/summarize/summarize.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/summarize/summarize.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/suppress/suppress.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/suppress/suppress.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/syslog/dial.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/syslog/dial.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/syslog/journal.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/syslog/journal.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/syslog/syslog.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/syslog/syslog.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/telemetry.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/telemetry.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/timeout.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/timeout.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/truncate.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/truncate.go"),
+                executable: false,
+            },
             Asset {
                 rel_path: "templates/go/hooksdk/types.go",
                 content: include_str!("hooks_sdk_assets/go/hooksdk/types.go"),
                 executable: false,
             },
+            Asset {
+                rel_path: "templates/go/hooksdk/unknown_fields.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/unknown_fields.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/usage/csv.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/usage/csv.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/usage/prices.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/usage/prices.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/usage/usage.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/usage/usage.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/utf8.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/utf8.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/validate.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/validate.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/version.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/version.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/hooksdk/webhook/webhook.go",
+                content: include_str!("hooks_sdk_assets/go/hooksdk/webhook/webhook.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/approve_push/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/approve_push/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/archive_s3/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/archive_s3/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/deny_example/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/deny_example/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/exec_hook/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/exec_hook/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/fmt_on_write/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/fmt_on_write/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/forward_webhook/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/forward_webhook/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/gha_annotate/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/gha_annotate/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/git_snapshot/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/git_snapshot/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/guard_exec/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/guard_exec/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/guard_network/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/guard_network/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/guard_secrets/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/guard_secrets/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/hookd/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/hookd/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/hookd_forward/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/hookd_forward/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/hookdigest/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/hookdigest/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/hookdoctor/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/hookdoctor/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/hookexport/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/hookexport/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/hookq/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/hookq/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/hookreplay/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/hookreplay/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/hookstats/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/hookstats/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/hooktail/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/hooktail/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/log_csv/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/log_csv/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/log_eventlog/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/log_eventlog/main.go"),
+                executable: false,
+            },
             Asset {
                 rel_path: "templates/go/cmd/log_jsonl/main.go",
                 content: include_str!("hooks_sdk_assets/go/cmd/log_jsonl/main.go"),
                 executable: false,
             },
+            Asset {
+                rel_path: "templates/go/cmd/log_multi/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/log_multi/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/log_sqlite/go.mod",
+                content: include_str!("hooks_sdk_assets/go/cmd/log_sqlite/go.mod"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/log_sqlite/go.sum",
+                content: include_str!("hooks_sdk_assets/go/cmd/log_sqlite/go.sum"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/log_sqlite/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/log_sqlite/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/log_syslog/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/log_syslog/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/mcp_forward/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/mcp_forward/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/metrics_prom/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/metrics_prom/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/multi_event/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/multi_event/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/multi_hook/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/multi_hook/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/newhook/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/newhook/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/newhook/templates/bundle_main.go.tmpl",
+                content: include_str!(
+                    "hooks_sdk_assets/go/cmd/newhook/templates/bundle_main.go.tmpl"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/newhook/templates/config.go.tmpl",
+                content: include_str!("hooks_sdk_assets/go/cmd/newhook/templates/config.go.tmpl"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/newhook/templates/go.mod.tmpl",
+                content: include_str!("hooks_sdk_assets/go/cmd/newhook/templates/go.mod.tmpl"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/newhook/templates/hooks_gen.go.tmpl",
+                content: include_str!(
+                    "hooks_sdk_assets/go/cmd/newhook/templates/hooks_gen.go.tmpl"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/newhook/templates/main.go.tmpl",
+                content: include_str!("hooks_sdk_assets/go/cmd/newhook/templates/main.go.tmpl"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/newhook/templates/main_test.go.tmpl",
+                content: include_str!(
+                    "hooks_sdk_assets/go/cmd/newhook/templates/main_test.go.tmpl"
+                ),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/notify_chat/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/notify_chat/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/notify_desktop/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/notify_desktop/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/notify_email/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/notify_email/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/otel_export/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/otel_export/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/pipeline/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/pipeline/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/rewrite_command/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/rewrite_command/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/session_summary/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/session_summary/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/test_on_patch/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/test_on_patch/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/track_time/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/track_time/main.go"),
+                executable: false,
+            },
+            Asset {
+                rel_path: "templates/go/cmd/track_usage/main.go",
+                content: include_str!("hooks_sdk_assets/go/cmd/track_usage/main.go"),
+                executable: false,
+            },
         ],
         HookSdk::Rust => vec![
             Asset {